@@ -0,0 +1,90 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	accessAuthTypeKey = "access_auth_type"
+	accessIdentityKey = "access_identity"
+	accessClaimsKey   = "access_claims"
+)
+
+// setAccessIdentity records who made the request for the access log
+func setAccessIdentity(c echo.Context, authType, identity string) {
+	c.Set(accessAuthTypeKey, authType)
+	c.Set(accessIdentityKey, identity)
+}
+
+// accessIdentity returns who made the request: the OIDC user name, or "token" for the API token
+func accessIdentity(c echo.Context) string {
+	identity, _ := c.Get(accessIdentityKey).(string)
+	return identity
+}
+
+// apiAccessLog writes one JSON line per request to the access log and passes it to the
+// access log inputs of this node, after applying the api_access_log redaction settings
+func apiAccessLog(w io.Writer, cfg *common.APIAccessLogConfig) echo.MiddlewareFunc {
+	accessLogger := common.NewAPIAccessLogger(cfg)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if accessLogger.Skip(c.Path()) {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// Let echo write the error response so the logged status is the one sent
+				c.Error(err)
+			}
+
+			req := c.Request()
+			res := c.Response()
+			record := &common.APIAccessRecord{
+				Time:      start.UTC().Format(time.RFC3339),
+				RequestID: req.Header.Get(echo.HeaderXRequestID),
+				Method:    req.Method,
+				Route:     c.Path(),
+				URI:       req.RequestURI,
+				Status:    res.Status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				BytesIn:   req.ContentLength,
+				BytesOut:  res.Size,
+				AuthType:  "none",
+				RemoteIP:  c.RealIP(),
+				UserAgent: req.UserAgent(),
+			}
+			if record.RequestID == "" {
+				record.RequestID = res.Header().Get(echo.HeaderXRequestID)
+			}
+			if record.BytesIn < 0 {
+				record.BytesIn = 0
+			}
+			if authType, ok := c.Get(accessAuthTypeKey).(string); ok {
+				record.AuthType = authType
+				record.Identity, _ = c.Get(accessIdentityKey).(string)
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+
+			event := accessLogger.Event(record)
+			if line, mErr := json.Marshal(event); mErr == nil {
+				if _, wErr := w.Write(append(line, '\n')); wErr != nil {
+					logger.Warn("Failed to write access log", "error", wErr)
+				}
+			}
+			common.PublishAPIAccessEvent(event)
+
+			// The error was handled above
+			return nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetAlerts returns the alerts fired in a time range, newest first, from the fired alerts index.
+// Optional query params:
+// - rule (string): filter by rule id
+// - project (string): filter by project id
+// - since (RFC3339 or age like 24h, 7d): start of the range, default the whole retention window
+// - until (RFC3339 or age like 1h): end of the range, default now
+// - limit (int): maximum alerts returned, default 100, at most 1000
+func GetAlerts(c echo.Context) error {
+	now := time.Now()
+	until := now
+	since := now.Add(-common.RetentionPeriod(common.RetentionFiredAlerts))
+
+	if v := c.QueryParam("since"); v != "" {
+		t, ok := parseAlertTime(v, now)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since, expected RFC3339 time or an age like 24h or 7d"})
+		}
+		since = t
+	}
+	if v := c.QueryParam("until"); v != "" {
+		t, ok := parseAlertTime(v, now)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid until, expected RFC3339 time or an age like 24h or 7d"})
+		}
+		until = t
+	}
+	if !since.Before(until) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "since must be before until"})
+	}
+
+	limit := common.DefaultFiredAlertLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > common.MaxFiredAlertLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to " + strconv.Itoa(common.MaxFiredAlertLimit)})
+		}
+		limit = n
+	}
+
+	rule := c.QueryParam("rule")
+	project := c.QueryParam("project")
+	alerts, total, err := common.QueryFiredAlerts(rule, project, since, until, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to query fired alerts: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rule":    rule,
+		"project": project,
+		"since":   since.UTC().Format(time.RFC3339),
+		"until":   until.UTC().Format(time.RFC3339),
+		"total":   total,
+		"count":   len(alerts),
+		"alerts":  alerts,
+	})
+}
+
+// parseAlertTime accepts an RFC3339 time or an age before now, as a Go duration or a number of days like 7d
+func parseAlertTime(v string, now time.Time) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, false
+		}
+		return now.AddDate(0, 0, -n), true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, false
+	}
+	return now.Add(-d), true
+}
@@ -74,11 +74,8 @@ func VerifyOIDCToken(ctx context.Context, rawToken string) (map[string]interface
 	return claims, nil
 }
 
-func isUserAllowed(claims map[string]interface{}) bool {
-	allowed := common.Config.OIDCAllowedUsers
-	if len(allowed) == 0 {
-		return false
-	}
+// oidcUsername returns the username claim of an ID token
+func oidcUsername(claims map[string]interface{}) string {
 	claimKey := common.Config.OIDCUsernameClaim
 	if claimKey == "" {
 		// default fallbacks
@@ -89,6 +86,15 @@ func isUserAllowed(claims map[string]interface{}) bool {
 		}
 	}
 	val, _ := claims[claimKey].(string)
+	return val
+}
+
+func isUserAllowed(claims map[string]interface{}) bool {
+	allowed := common.Config.OIDCAllowedUsers
+	if len(allowed) == 0 {
+		return false
+	}
+	val := oidcUsername(claims)
 	if val == "" {
 		return false
 	}
@@ -105,6 +111,7 @@ func AuthenticateRequest(c echo.Context) error {
 	// Legacy token header
 	token := c.Request().Header.Get("token")
 	if token != "" && token == common.Config.Token {
+		setAccessIdentity(c, "token", "token")
 		return nil
 	}
 
@@ -131,11 +138,36 @@ func AuthenticateRequest(c echo.Context) error {
 		return errors.New("authentication failed")
 	}
 	if !isUserAllowed(claims) {
+		setAccessIdentity(c, "oidc", oidcUsername(claims))
 		return errors.New("user not allowed")
 	}
+	setAccessIdentity(c, "oidc", oidcUsername(claims))
+	c.Set(accessClaimsKey, claims)
 	return nil
 }
 
+// requireSamplerAccess only lets the users allowed by sampler_access read sampled events,
+// and records every read and refusal in the operations history
+func requireSamplerAccess(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		authType, _ := c.Get(accessAuthTypeKey).(string)
+		identity, _ := c.Get(accessIdentityKey).(string)
+		claims, _ := c.Get(accessClaimsKey).(map[string]interface{})
+		componentType := c.QueryParam("name")
+		nodeSequence := c.QueryParam("projectNodeSequence")
+
+		if !common.Config.SamplerAccess.Allows(authType, identity, claims) {
+			logger.Warn("Sampler access denied", "auth_type", authType, "identity", identity, "path", c.Path())
+			common.RecordSamplerAccess(authType, identity, c.Path(), componentType, nodeSequence, c.RealIP(), "denied")
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "Not allowed to read sample data",
+			})
+		}
+		common.RecordSamplerAccess(authType, identity, c.Path(), componentType, nodeSequence, c.RealIP(), "success")
+		return next(c)
+	}
+}
+
 // GET /auth/config
 func getAuthConfig(c echo.Context) error {
 	resp := AuthConfigResponse{
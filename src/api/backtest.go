@@ -0,0 +1,396 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/project"
+	"AgentSmith-HUB/rules_engine"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	backtestSourceSamples = "samples"
+
+	defaultBacktestMaxEvents   = 10000
+	maxBacktestMaxEvents       = 200000
+	defaultBacktestMaxExamples = 20
+	backtestTimeout            = 5 * time.Minute
+
+	// exclude rulesets have no hit rule id, dropped events are counted under this key
+	backtestExcludedKey = "excluded"
+)
+
+type backtestRequest struct {
+	Ruleset string `json:"ruleset"`
+	// Content is the candidate version; when empty the pending (unsaved) version of the ruleset is used
+	Content string `json:"content,omitempty"`
+	// Source is "samples" (the ruleset's sampled input, the default) or an archive location as accepted by replay
+	Source         string           `json:"source"`
+	Days           int              `json:"days"`
+	From           string           `json:"from"` // RFC3339, optional, overrides days
+	To             string           `json:"to"`   // RFC3339, optional
+	TimestampField string           `json:"timestamp_field"`
+	MaxEvents      int              `json:"max_events"`
+	MaxExamples    int              `json:"max_examples"`
+	S3             *common.S3Config `json:"s3"`
+}
+
+// backtestSide summarises what one ruleset version fired on the backtest events
+type backtestSide struct {
+	Fired   int            `json:"fired"`   // events that produced at least one alert
+	Results int            `json:"results"` // alerts produced
+	Rules   map[string]int `json:"rules"`   // events fired per rule
+}
+
+type backtestRuleDiff struct {
+	RuleID    string `json:"rule_id"`
+	Current   int    `json:"current"`
+	Candidate int    `json:"candidate"`
+	Delta     int    `json:"delta"`
+}
+
+type backtestExample struct {
+	Event     map[string]interface{} `json:"event"`
+	Current   []string               `json:"current"`
+	Candidate []string               `json:"candidate"`
+}
+
+type backtestDiff struct {
+	NewlyFired    int                `json:"newly_fired"`     // fired only by the candidate
+	NoLongerFired int                `json:"no_longer_fired"` // fired only by the current version
+	Changed       int                `json:"changed"`         // fired by both, but by different rules
+	Unchanged     int                `json:"unchanged"`
+	Rules         []backtestRuleDiff `json:"rules"`
+}
+
+type backtestResponse struct {
+	Ruleset    string            `json:"ruleset"`
+	Source     string            `json:"source"`
+	Events     int               `json:"events"`
+	Truncated  bool              `json:"truncated"`
+	Current    backtestSide      `json:"current"`
+	Candidate  backtestSide      `json:"candidate"`
+	Diff       backtestDiff      `json:"diff"`
+	Examples   []backtestExample `json:"examples"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// backtestRun evaluates both ruleset versions on each event and accumulates the comparison
+type backtestRun struct {
+	current, candidate     *rules_engine.Ruleset
+	currentID, candidateID string
+	maxExamples            int
+	resp                   *backtestResponse
+}
+
+// RunBacktest evaluates a candidate ruleset version against archived or sampled events and
+// reports what it would have fired compared to the current version, without deploying it.
+func RunBacktest(c echo.Context) error {
+	var req backtestRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+	if req.Ruleset == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ruleset is required"})
+	}
+	if req.Source == "" {
+		req.Source = backtestSourceSamples
+	}
+	if req.MaxEvents <= 0 {
+		req.MaxEvents = defaultBacktestMaxEvents
+	}
+	if req.MaxEvents > maxBacktestMaxEvents {
+		req.MaxEvents = maxBacktestMaxEvents
+	}
+	if req.MaxExamples <= 0 {
+		req.MaxExamples = defaultBacktestMaxExamples
+	}
+
+	from, to, err := backtestWindow(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	currentRaw, ok := currentRulesetContent(req.Ruleset)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Ruleset not found: " + req.Ruleset})
+	}
+	candidateRaw := req.Content
+	if candidateRaw == "" {
+		if candidateRaw, ok = pendingRulesetContent(req.Ruleset); !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "No candidate version: provide content or save a pending change for " + req.Ruleset})
+		}
+	}
+
+	// unique ids keep threshold and cache state apart from the live ruleset
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	run := &backtestRun{
+		currentID:   "backtest_current_" + suffix,
+		candidateID: "backtest_candidate_" + suffix,
+		maxExamples: req.MaxExamples,
+		resp: &backtestResponse{
+			Ruleset:   req.Ruleset,
+			Source:    req.Source,
+			Current:   backtestSide{Rules: map[string]int{}},
+			Candidate: backtestSide{Rules: map[string]int{}},
+			Examples:  []backtestExample{},
+		},
+	}
+	if run.current, err = rules_engine.NewRuleset("", currentRaw, run.currentID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build current ruleset: " + err.Error()})
+	}
+	defer stopBacktestRuleset(run.current)
+	if run.candidate, err = rules_engine.NewRuleset("", candidateRaw, run.candidateID); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to build candidate ruleset: " + err.Error()})
+	}
+	defer stopBacktestRuleset(run.candidate)
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request().Context(), backtestTimeout)
+	defer cancel()
+
+	if req.Source == backtestSourceSamples {
+		err = run.fromSamples(ctx, req.Ruleset, from, to, req.MaxEvents)
+	} else {
+		err = run.fromArchive(ctx, req, from, to)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Backtest failed: " + err.Error()})
+	}
+
+	run.finish()
+	run.resp.DurationMs = time.Since(started).Milliseconds()
+	logger.Info("Backtest completed", "ruleset", req.Ruleset, "source", req.Source, "events", run.resp.Events,
+		"newly_fired", run.resp.Diff.NewlyFired, "no_longer_fired", run.resp.Diff.NoLongerFired)
+	return c.JSON(http.StatusOK, run.resp)
+}
+
+func backtestWindow(req backtestRequest) (time.Time, time.Time, error) {
+	var from, to time.Time
+	if req.Days > 0 {
+		from = time.Now().Add(-time.Duration(req.Days) * 24 * time.Hour)
+	}
+	if req.From != "" {
+		t, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from, expected RFC3339 time")
+		}
+		from = t
+	}
+	if req.To != "" {
+		t, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to, expected RFC3339 time")
+		}
+		to = t
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// currentRulesetContent returns the running version, falling back to the saved file
+func currentRulesetContent(id string) (string, bool) {
+	if r, ok := project.GetRuleset(id); ok && r.RawConfig != "" {
+		return r.RawConfig, true
+	}
+	if path, ok := GetComponentPath("ruleset", id, false); ok {
+		if content, err := ReadComponent(path); err == nil {
+			return content, true
+		}
+	}
+	return "", false
+}
+
+func pendingRulesetContent(id string) (string, bool) {
+	if path, ok := GetComponentPath("ruleset", id, true); ok {
+		if content, err := ReadComponent(path); err == nil {
+			return content, true
+		}
+	}
+	return project.GetRulesetNew(id)
+}
+
+func stopBacktestRuleset(r *rules_engine.Ruleset) {
+	if err := r.Stop(); err != nil {
+		logger.Warn("Failed to stop backtest ruleset", "ruleset", r.RulesetID, "error", err)
+	}
+}
+
+// fromSamples evaluates the input samples recorded for the ruleset, which are kept for the sample TTL
+func (b *backtestRun) fromSamples(ctx context.Context, rulesetID string, from, to time.Time, maxEvents int) error {
+	rsm := common.GetRedisSampleManager()
+	if rsm == nil {
+		return fmt.Errorf("sample data is only available on the leader")
+	}
+	samples, err := rsm.GetSamples("ruleset." + rulesetID)
+	if err != nil {
+		return err
+	}
+
+	var events []common.SampleData
+	for _, list := range samples {
+		for _, s := range list {
+			if (!from.IsZero() && s.Timestamp.Before(from)) || (!to.IsZero() && !s.Timestamp.Before(to)) {
+				continue
+			}
+			events = append(events, s)
+		}
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no samples recorded for ruleset %s in the requested window", rulesetID)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	for _, s := range events {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		event, ok := s.Data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if b.resp.Events >= maxEvents {
+			b.resp.Truncated = true
+			break
+		}
+		b.evaluate(event)
+	}
+	return nil
+}
+
+// fromArchive reads newline-delimited JSON archives through the replay reader without pacing
+func (b *backtestRun) fromArchive(ctx context.Context, req backtestRequest, from, to time.Time) error {
+	cfg := common.ReplayConfig{
+		Source:         req.Source,
+		From:           from,
+		To:             to,
+		TimestampField: req.TimestampField,
+		S3:             req.S3,
+	}
+	replay, err := common.NewReplay("", "", cfg, func(_ context.Context, event map[string]interface{}) bool {
+		if b.resp.Events >= req.MaxEvents {
+			b.resp.Truncated = true
+			return false
+		}
+		// events are evaluated as they were archived, not as replayed traffic
+		delete(event, common.ReplayFieldName)
+		b.evaluate(event)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			replay.Stop()
+		case <-replay.Done():
+		}
+	}()
+	if err := replay.Run(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (b *backtestRun) evaluate(event map[string]interface{}) {
+	b.resp.Events++
+	currentHits := backtestHits(b.current, b.currentID, common.MapDeepCopy(event), &b.resp.Current)
+	candidateHits := backtestHits(b.candidate, b.candidateID, common.MapDeepCopy(event), &b.resp.Candidate)
+
+	diff := &b.resp.Diff
+	switch {
+	case len(currentHits) == 0 && len(candidateHits) == 0:
+		diff.Unchanged++
+		return
+	case len(currentHits) == 0:
+		diff.NewlyFired++
+	case len(candidateHits) == 0:
+		diff.NoLongerFired++
+	case strings.Join(currentHits, ",") != strings.Join(candidateHits, ","):
+		diff.Changed++
+	default:
+		diff.Unchanged++
+		return
+	}
+	if len(b.resp.Examples) < b.maxExamples {
+		b.resp.Examples = append(b.resp.Examples, backtestExample{Event: event, Current: currentHits, Candidate: candidateHits})
+	}
+}
+
+// backtestHits returns the sorted rule ids that fired on event and updates the side totals
+func backtestHits(r *rules_engine.Ruleset, id string, event map[string]interface{}, side *backtestSide) []string {
+	results := r.EngineCheck(event)
+
+	hits := map[string]bool{}
+	if !r.IsDetection {
+		if len(results) == 0 {
+			hits[backtestExcludedKey] = true
+		}
+	} else {
+		for _, res := range results {
+			if res[rules_engine.VerdictFieldName] == rules_engine.VerdictNoMatch {
+				continue
+			}
+			side.Results++
+			raw, _ := res[rules_engine.HitRuleIdFieldName].(string)
+			for _, ruleID := range strings.Split(raw, ",") {
+				if ruleID = strings.TrimPrefix(ruleID, id+"."); ruleID != "" {
+					hits[ruleID] = true
+				}
+			}
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+
+	side.Fired++
+	ids := make([]string, 0, len(hits))
+	for ruleID := range hits {
+		side.Rules[ruleID]++
+		ids = append(ids, ruleID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// finish builds the per rule comparison, largest changes first
+func (b *backtestRun) finish() {
+	seen := map[string]bool{}
+	for ruleID := range b.resp.Current.Rules {
+		seen[ruleID] = true
+	}
+	for ruleID := range b.resp.Candidate.Rules {
+		seen[ruleID] = true
+	}
+	rules := make([]backtestRuleDiff, 0, len(seen))
+	for ruleID := range seen {
+		cur, cand := b.resp.Current.Rules[ruleID], b.resp.Candidate.Rules[ruleID]
+		rules = append(rules, backtestRuleDiff{RuleID: ruleID, Current: cur, Candidate: cand, Delta: cand - cur})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		di, dj := rules[i].Delta, rules[j].Delta
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		if di != dj {
+			return di > dj
+		}
+		return rules[i].RuleID < rules[j].RuleID
+	})
+	b.resp.Diff.Rules = rules
+}
@@ -488,6 +488,60 @@ func getClusterSystemMetrics(c echo.Context) error {
 	}
 }
 
+// steppedDownReadOnlyPrefixes are POST endpoints that only validate or test and stay available after a step down
+var steppedDownReadOnlyPrefixes = []string{"/verify", "/connect-check/", "/test-", "/samplers/"}
+
+// rejectWritesWhenSteppedDown refuses modifying requests while the leader has lost its lock,
+// so no config change is accepted that could conflict with a new leader
+func rejectWritesWhenSteppedDown(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if !common.IsCurrentNodeLeader() {
+			return next(c)
+		}
+		steppedDown, reason, since := common.IsLeaderSteppedDown()
+		if !steppedDown {
+			return next(c)
+		}
+		path := c.Request().URL.Path
+		for _, prefix := range steppedDownReadOnlyPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return next(c)
+			}
+		}
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error":           "Leader lost its lock and stepped down, changes are rejected until it is reacquired",
+			"reason":          reason,
+			"stepped_down_at": since,
+		})
+	}
+}
+
+// getLeaderLock returns the leader lock TTL, renewal latency and lock loss events
+func getLeaderLock(c echo.Context) error {
+	if err := common.RequireLeader(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Leader lock metrics are only available from leader nodes",
+		})
+	}
+
+	metrics := cluster.GetLeaderLockMetrics()
+	if metrics == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "Leader lock not initialized",
+		})
+	}
+	return c.JSON(http.StatusOK, metrics)
+}
+
+// getRedisReplicas returns the Redis read replicas of this node and the reads each one served
+func getRedisReplicas(c echo.Context) error {
+	return c.JSON(http.StatusOK, common.GetRedisReplicaStatus())
+}
+
 // getClusterSystemStats returns cluster system manager statistics
 func getClusterSystemStats(c echo.Context) error {
 	// Only provide cluster system stats from leader nodes
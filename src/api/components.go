@@ -607,6 +607,32 @@ func getPlugins(c echo.Context) error {
 						return true // Continue to next ruleset
 					}
 				}
+				// Check in all/any/not groups
+				for _, group := range rule.GroupMap {
+					used := false
+					group.ForEachCheckNode(func(node *rules_engine.CheckNodes) {
+						if node.Type == "PLUGIN" && strings.Contains(node.Value, pluginName+"(") {
+							used = true
+						}
+					})
+					if used {
+						rulesets = append(rulesets, r.RulesetID)
+						return true // Continue to next ruleset
+					}
+				}
+				// Check in sequence steps
+				for _, sequence := range rule.SequenceMap {
+					used := false
+					sequence.ForEachCheckNode(func(node *rules_engine.CheckNodes) {
+						if node.Type == "PLUGIN" && strings.Contains(node.Value, pluginName+"(") {
+							used = true
+						}
+					})
+					if used {
+						rulesets = append(rulesets, r.RulesetID)
+						return true // Continue to next ruleset
+					}
+				}
 				// Check in append elements
 				for _, appendElem := range rule.AppendsMap {
 					if appendElem.Type == "PLUGIN" && strings.Contains(appendElem.Value, pluginName+"(") {
@@ -1590,11 +1616,16 @@ func verifyComponent(c echo.Context) error {
 			// If detailed validation fails, fall back to simple error
 			result = createSimpleResult(err)
 		}
-		return c.JSON(http.StatusOK, map[string]interface{}{
+		response := map[string]interface{}{
 			"valid":    result.IsValid,
 			"errors":   result.Errors,
 			"warnings": result.Warnings,
-		})
+		}
+		// Rulesets with includes or extends are validated after expansion, return it so error lines can be located
+		if result.Expanded != "" {
+			response["expanded"] = result.Expanded
+		}
+		return c.JSON(http.StatusOK, response)
 	case "project":
 		err := project.Verify("", req.Raw)
 		result := createSimpleResult(err)
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetDeliveryReconciliation returns a per-output reconciliation report of matched events
+// against sent/acked/failed/dropped delivery receipts, in hourly windows.
+// Optional query params:
+// - project (string): filter by project id
+// - from (RFC3339): start of the range, default 24 hours ago
+// - to (RFC3339): end of the range, default now
+func GetDeliveryReconciliation(c echo.Context) error {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from, expected RFC3339 time"})
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to, expected RFC3339 time"})
+		}
+		to = t
+	}
+
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	if to.Sub(from) > 31*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Time range too large, maximum is 31 days"})
+	}
+
+	report, err := common.GetDeliveryReconciliation(from, to, c.QueryParam("project"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build reconciliation report: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/project"
+	"AgentSmith-HUB/rules_engine"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// finished rollouts are kept this long for status queries
+const rolloutRetention = 7 * 24 * time.Hour
+
+type startRolloutRequest struct {
+	Rulesets   []string `json:"rulesets"`
+	Children   []string `json:"children"`    // optional subset of the registered children
+	StageDelay string   `json:"stage_delay"` // optional, overrides distribution.stage_delay
+}
+
+// renderRuleset applies the overrides of a child to a ruleset version
+func renderRuleset(child common.DistributionChild, id, content string) (string, error) {
+	for _, ruleID := range child.DisabledRules[id] {
+		rendered, err := removeRuleFromXML(content, ruleID)
+		if err != nil {
+			return "", fmt.Errorf("disabled rule of child %s: %w", child.ID, err)
+		}
+		content = rendered
+	}
+	return content, nil
+}
+
+// StartRollout publishes the current versions of rulesets to the registered child hubs,
+// stage by stage in the order of their stage numbers
+func StartRollout(c echo.Context) error {
+	if err := common.RequireLeader(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	cfg := common.GetDistributionConfig()
+	if cfg == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No child hubs configured, set distribution.children in the hub config"})
+	}
+
+	var req startRolloutRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+	if len(req.Rulesets) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rulesets is required"})
+	}
+
+	stageDelay := time.Duration(0)
+	delay := cfg.StageDelay
+	if req.StageDelay != "" {
+		delay = req.StageDelay
+	}
+	if delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid stage_delay, expected e.g. 30m"})
+		}
+		stageDelay = d
+	}
+
+	contents := make(map[string]string, len(req.Rulesets))
+	for _, id := range req.Rulesets {
+		content, ok := common.GetRawConfig("ruleset", id)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Ruleset not found: " + id})
+		}
+		contents[id] = content
+	}
+
+	selected := make(map[string]bool, len(req.Children))
+	for _, id := range req.Children {
+		selected[id] = true
+	}
+
+	var pushes []common.DistributionPush
+	for _, child := range cfg.Children {
+		if len(selected) > 0 && !selected[child.ID] {
+			continue
+		}
+		delete(selected, child.ID)
+		push := common.DistributionPush{Child: child, Rulesets: make(map[string]string)}
+		for id, content := range contents {
+			if child.Excludes(id) {
+				continue
+			}
+			rendered, err := renderRuleset(child, id, content)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			// Catch broken overrides before any child is touched
+			if err := rules_engine.Verify("", rendered); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Ruleset %s is invalid for child %s: %v", id, child.ID, err)})
+			}
+			push.Rulesets[id] = rendered
+		}
+		if len(push.Rulesets) > 0 {
+			pushes = append(pushes, push)
+		}
+	}
+	for id := range selected {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Child hub not registered: " + id})
+	}
+
+	common.PruneRollouts(rolloutRetention)
+	rollout, err := common.StartRollout(cfg, req.Rulesets, pushes, stageDelay)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to start rollout: " + err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, rollout.Report())
+}
+
+// GetRollouts lists rollouts started on this node
+func GetRollouts(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"rollouts": common.ListRollouts()})
+}
+
+// GetRollout returns the progress of one rollout
+func GetRollout(c echo.Context) error {
+	rollout, ok := common.GetRollout(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Rollout not found"})
+	}
+	return c.JSON(http.StatusOK, rollout.Report())
+}
+
+// StopRollout halts a rollout before its next stage, children already updated are not rolled back
+func StopRollout(c echo.Context) error {
+	rollout, ok := common.GetRollout(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Rollout not found"})
+	}
+	rollout.Stop()
+	return c.JSON(http.StatusOK, rollout.Report())
+}
+
+// GetDistributionChildren compares the ruleset versions each child runs with the versions
+// this hub would publish to it now. Rulesets the child never received are listed as missing.
+func GetDistributionChildren(c echo.Context) error {
+	cfg := common.GetDistributionConfig()
+	if cfg == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"children": []interface{}{}})
+	}
+
+	children := make([]map[string]interface{}, len(cfg.Children))
+	done := make(chan struct{}, len(cfg.Children))
+	for i, child := range cfg.Children {
+		go func(i int, child common.DistributionChild) {
+			defer func() { done <- struct{}{} }()
+			entry := map[string]interface{}{
+				"id":    child.ID,
+				"url":   child.URL,
+				"stage": child.Stage,
+			}
+			children[i] = entry
+
+			running, err := common.FetchChildVersions(cfg, child)
+			if err != nil {
+				entry["status"] = "unreachable"
+				entry["error"] = err.Error()
+				return
+			}
+			rulesets := make(map[string]interface{})
+			outdated := 0
+			common.ForEachRawConfig("ruleset", func(id, content string) bool {
+				if child.Excludes(id) {
+					return true
+				}
+				rendered, err := renderRuleset(child, id, content)
+				if err != nil {
+					rulesets[id] = map[string]string{"status": "override_error", "error": err.Error()}
+					outdated++
+					return true
+				}
+				expected := common.RulesetVersion(rendered)
+				actual, ok := running[id]
+				status := "in_sync"
+				switch {
+				case !ok:
+					status = "missing"
+				case actual != expected:
+					status = "outdated"
+				}
+				if status == "outdated" {
+					outdated++
+				}
+				rulesets[id] = map[string]string{"status": status, "expected": expected, "running": actual}
+				return true
+			})
+			entry["rulesets"] = rulesets
+			entry["status"] = "in_sync"
+			if outdated > 0 {
+				entry["status"] = "outdated"
+				entry["outdated"] = outdated
+			}
+		}(i, child)
+	}
+	for range cfg.Children {
+		<-done
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"children": children})
+}
+
+// GetDistributedVersions returns the version of every ruleset on this hub, used by a parent
+// hub to check which of its versions a child runs
+func GetDistributedVersions(c echo.Context) error {
+	versions := make(map[string]string)
+	common.ForEachRawConfig("ruleset", func(id, content string) bool {
+		versions[id] = common.RulesetVersion(content)
+		return true
+	})
+	return c.JSON(http.StatusOK, map[string]interface{}{"versions": versions})
+}
+
+type receiveRulesetRequest struct {
+	Content string `json:"content"`
+	Version string `json:"version"`
+	Parent  string `json:"parent"`
+	Rollout string `json:"rollout"`
+}
+
+// ReceiveDistributedRuleset applies a ruleset version published by a parent hub.
+// It is verified, written to the config root and synced to the followers like an applied change.
+func ReceiveDistributedRuleset(c echo.Context) error {
+	if err := common.RequireLeader(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	id := c.Param("id")
+	var req receiveRulesetRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+	if req.Content == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "content is required"})
+	}
+	if req.Version != "" && req.Version != common.RulesetVersion(req.Content) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "content does not match version " + req.Version})
+	}
+
+	oldContent, _ := common.GetRawConfig("ruleset", id)
+	if oldContent == req.Content {
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": id, "version": common.RulesetVersion(req.Content), "changed": false})
+	}
+
+	affectedProjects, err := reloadComponentUnified(&ComponentReloadRequest{
+		Type:        "ruleset",
+		ID:          id,
+		NewContent:  req.Content,
+		OldContent:  oldContent,
+		Source:      SourceDistribution,
+		WriteToFile: true,
+	})
+	if err != nil {
+		logger.Error("Failed to apply distributed ruleset", "id", id, "parent", req.Parent, "rollout", req.Rollout, "error", err)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	// Restart only the projects the user wants running, as for applied changes
+	var projectsToRestart []string
+	for _, projectID := range affectedProjects {
+		if _, ok := project.GetProject(projectID); !ok {
+			continue
+		}
+		userWantsRunning, err := common.GetProjectUserIntention(projectID)
+		if err != nil || userWantsRunning {
+			projectsToRestart = append(projectsToRestart, projectID)
+		}
+	}
+	sort.Strings(projectsToRestart)
+	go func() {
+		for _, projectID := range projectsToRestart {
+			if p, ok := project.GetProject(projectID); ok {
+				if err := p.Restart(true, "distribution"); err != nil {
+					logger.Error("Failed to restart project after distributed ruleset", "project_id", projectID, "error", err)
+				}
+			}
+		}
+	}()
+
+	logger.Info("Applied distributed ruleset", "id", id, "version", req.Version, "parent", req.Parent, "rollout", req.Rollout)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":                  id,
+		"version":             common.RulesetVersion(req.Content),
+		"changed":             true,
+		"projects_to_restart": projectsToRestart,
+	})
+}
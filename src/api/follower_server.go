@@ -51,6 +51,7 @@ func ServerStartFollower(listenAddr string) error {
 			// Allow legacy token for followers for backward compatibility
 			token := c.Request().Header.Get("token")
 			if token != "" && token == followerToken {
+				setAccessIdentity(c, "token", "token")
 				return next(c)
 			}
 			// Otherwise try OIDC Bearer if enabled
@@ -113,7 +114,7 @@ func ServerStartFollower(listenAddr string) error {
 	auth.GET("/plugins/:id/usage", getPluginUsage)
 
 	// Read-only configuration endpoints
-	auth.GET("/samplers/data", GetSamplerData)
+	auth.GET("/samplers/data", GetSamplerData, requireSamplerAccess)
 	auth.GET("/ruleset-fields/:id", GetRulesetFields)
 	auth.GET("/ruleset-fields", GetBatchRulesetFields)
 
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetLatencySLI returns per-project end-to-end latency SLIs measured with synthetic canary events
+// Optional query params:
+// - project (string): filter by project id
+// - node_id (string): filter by node
+// - breached (bool): only return projects currently breaching the latency SLO
+func GetLatencySLI(c echo.Context) error {
+	if common.Config == nil || common.Config.Canary == nil || !common.Config.Canary.Enabled {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"enabled": false,
+			"slis":    []common.LatencySLI{},
+		})
+	}
+
+	slis, err := common.GetClusterLatencySLIs()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get latency SLIs: " + err.Error()})
+	}
+
+	projectID := c.QueryParam("project")
+	nodeID := c.QueryParam("node_id")
+	onlyBreached := c.QueryParam("breached") == "true"
+
+	filtered := make([]common.LatencySLI, 0, len(slis))
+	for _, sli := range slis {
+		if projectID != "" && sli.ProjectID != projectID {
+			continue
+		}
+		if nodeID != "" && nodeID != "all" && sli.NodeID != nodeID {
+			continue
+		}
+		if onlyBreached && !sli.Breached {
+			continue
+		}
+		filtered = append(filtered, sli)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enabled": true,
+		"slis":    filtered,
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"AgentSmith-HUB/cluster"
+	"AgentSmith-HUB/common"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetLeakDetector returns the goroutine and channel queue samples of every project on this node,
+// the warnings raised here with stack samples, and the active warnings reported by followers.
+// Optional query params:
+// - project (string): filter by project id
+func GetLeakDetector(c echo.Context) error {
+	ld := common.GlobalLeakDetector
+	if ld == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"enabled":  false,
+			"projects": []common.LeakProjectStatus{},
+			"warnings": []common.LeakWarning{},
+		})
+	}
+
+	projectID := c.QueryParam("project")
+	projects := make([]common.LeakProjectStatus, 0)
+	for _, status := range ld.Status() {
+		if projectID == "" || status.ProjectID == projectID {
+			projects = append(projects, status)
+		}
+	}
+	warnings := make([]common.LeakWarning, 0)
+	for _, w := range ld.Warnings() {
+		if projectID == "" || w.ProjectID == projectID {
+			warnings = append(warnings, w)
+		}
+	}
+
+	// Followers only report active warnings in their heartbeat, stack samples stay in their logs
+	clusterWarnings := make([]common.LeakWarning, 0)
+	if common.IsCurrentNodeLeader() && cluster.GlobalHeartbeatManager != nil {
+		for _, hb := range cluster.GlobalHeartbeatManager.GetNodes() {
+			for _, w := range hb.Leaks {
+				if projectID == "" || w.ProjectID == projectID {
+					clusterWarnings = append(clusterWarnings, w)
+				}
+			}
+		}
+		sort.Slice(clusterWarnings, func(i, j int) bool {
+			return clusterWarnings[i].DetectedAt.After(clusterWarnings[j].DetectedAt)
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enabled":          true,
+		"node_id":          common.GetNodeID(),
+		"projects":         projects,
+		"warnings":         warnings,
+		"cluster_warnings": clusterWarnings,
+	})
+}
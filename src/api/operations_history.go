@@ -91,8 +91,8 @@ func RecordChangePush(componentType, componentID, oldContent, newContent, diff,
 		if err := common.RedisLPush("cluster:ops_history", string(jsonData), 10000); err != nil {
 			logger.Error("Failed to record change push operation to Redis", "error", err)
 		} else {
-			// Set TTL for the entire list to 31 days
-			if err := common.RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+			// Set TTL for the entire list to the operation history retention
+			if err := common.RedisExpire("cluster:ops_history", common.RetentionSeconds(common.RetentionOperationHistory)); err != nil {
 				logger.Warn("Failed to set TTL for operations history", "error", err)
 			}
 			logger.Info("Change push operation recorded to Redis", "type", record.Type, "component", record.ComponentType, "id", record.ComponentID)
@@ -127,8 +127,8 @@ func RecordLocalPush(componentType, componentID, content, status, errorMsg strin
 		if err := common.RedisLPush("cluster:ops_history", string(jsonData), 10000); err != nil {
 			logger.Error("Failed to record local push operation to Redis", "error", err)
 		} else {
-			// Set TTL for the entire list to 31 days
-			if err := common.RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+			// Set TTL for the entire list to the operation history retention
+			if err := common.RedisExpire("cluster:ops_history", common.RetentionSeconds(common.RetentionOperationHistory)); err != nil {
 				logger.Warn("Failed to set TTL for operations history", "error", err)
 			}
 			logger.Info("Local push operation recorded to Redis", "type", record.Type, "component", record.ComponentType, "id", record.ComponentID)
@@ -163,8 +163,8 @@ func RecordComponentDelete(componentType, componentID, status, errorMsg string,
 		if err := common.RedisLPush("cluster:ops_history", string(jsonData), 10000); err != nil {
 			logger.Error("Failed to record component delete operation to Redis", "error", err)
 		} else {
-			// Set TTL for the entire list to 31 days
-			if err := common.RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+			// Set TTL for the entire list to the operation history retention
+			if err := common.RedisExpire("cluster:ops_history", common.RetentionSeconds(common.RetentionOperationHistory)); err != nil {
 				logger.Warn("Failed to set TTL for operations history", "error", err)
 			}
 			logger.Info("Component delete operation recorded to Redis", "type", record.Type, "component", record.ComponentType, "id", record.ComponentID)
@@ -184,6 +184,9 @@ func (pcm *PendingChangeManager) VerifyChange(changeType, id string) error {
 	switch changeType {
 	case "plugin":
 		err = plugin.Verify("", change.NewContent, id)
+		if err == nil {
+			err = verifyPluginTests(id, change.NewContent)
+		}
 	case "input":
 		err = input.Verify("", change.NewContent)
 	case "output":
@@ -695,9 +698,11 @@ func CancelAllPendingChanges(c echo.Context) error {
 type ComponentReloadSource string
 
 const (
-	SourceChangePush  ComponentReloadSource = "change_push"
-	SourceLocalFile   ComponentReloadSource = "local_file"
-	SourceClusterSync ComponentReloadSource = "cluster_sync"
+	SourceChangePush   ComponentReloadSource = "change_push"
+	SourceLocalFile    ComponentReloadSource = "local_file"
+	SourceClusterSync  ComponentReloadSource = "cluster_sync"
+	SourceDistribution ComponentReloadSource = "distribution"
+	SourceRollback     ComponentReloadSource = "rollback"
 )
 
 // ComponentReloadRequest represents a request to reload a component
@@ -709,6 +714,7 @@ type ComponentReloadRequest struct {
 	Source      ComponentReloadSource `json:"source"`
 	SkipVerify  bool                  `json:"skip_verify,omitempty"`
 	WriteToFile bool                  `json:"write_to_file,omitempty"`
+	Author      string                `json:"author,omitempty"` // who applied the change, kept in the plugin version history
 }
 
 // reloadComponentUnified provides unified component reload logic for all sources
@@ -726,6 +732,10 @@ func reloadComponentUnified(req *ComponentReloadRequest) ([]string, error) {
 		switch req.Type {
 		case "plugin":
 			verifyErr = plugin.Verify("", req.NewContent, req.ID)
+			// Plugin tests live on the leader, changes synced to followers were tested there
+			if verifyErr == nil && req.Source == SourceChangePush {
+				verifyErr = verifyPluginTests(req.ID, req.NewContent)
+			}
 		case "input":
 			verifyErr = input.Verify("", req.NewContent)
 		case "output":
@@ -919,6 +929,9 @@ func reloadComponentUnified(req *ComponentReloadRequest) ([]string, error) {
 
 	// Phase 5: Update global config maps and sync to followers
 	if common.IsCurrentNodeLeader() {
+		if req.Type == "plugin" && req.Source != SourceClusterSync {
+			recordAppliedPluginVersion(req)
+		}
 		updateGlobalComponentConfigMap(req.Type, req.ID, req.NewContent)
 
 		// Sync to followers using instruction system
@@ -929,7 +942,7 @@ func reloadComponentUnified(req *ComponentReloadRequest) ([]string, error) {
 
 	// Phase 6: Record operation history
 	switch req.Source {
-	case SourceChangePush:
+	case SourceChangePush, SourceDistribution, SourceRollback:
 		RecordChangePush(req.Type, req.ID, req.OldContent, req.NewContent, "", "success", "")
 	case SourceLocalFile:
 		RecordLocalPush(req.Type, req.ID, req.NewContent, "success", "")
@@ -1020,6 +1033,7 @@ func ApplySingleChange(c echo.Context) error {
 		Source:      SourceChangePush,
 		SkipVerify:  false, // Always verify for single changes
 		WriteToFile: true,  // Always write to file for persistence
+		Author:      accessIdentity(c),
 	}
 
 	affectedProjects, err := reloadComponentUnified(reloadReq)
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"AgentSmith-HUB/plugin"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetPluginHealth returns the execution budgets of the user plugins on this node, their
+// violations and whether they are marked unhealthy
+func GetPluginHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"plugins": plugin.PluginsHealth()})
+}
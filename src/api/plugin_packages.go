@@ -0,0 +1,18 @@
+package api
+
+import (
+	"AgentSmith-HUB/plugin"
+	"AgentSmith-HUB/plugin/symbols"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetPluginPackages returns the third-party packages bundled for plugins and those plugin_packages
+// allows them to import
+func GetPluginPackages(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"bundled": symbols.Packages(),
+		"allowed": plugin.AllowedPackages(),
+	})
+}
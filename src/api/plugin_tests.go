@@ -0,0 +1,120 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/plugin"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxReportedPluginTestFailures bounds the failures listed in a verification error
+const maxReportedPluginTestFailures = 3
+
+// runPluginTestSuite runs the test file of a plugin, plugin/<id>_test.json, against its pending
+// version when there is one. The cases field of the body replaces the test file and the content
+// field the plugin source.
+func runPluginTestSuite(c echo.Context) error {
+	id := c.Param("id")
+	var req struct {
+		Content string                  `json:"content,omitempty"`
+		Cases   []plugin.PluginTestCase `json:"cases,omitempty"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+
+	content := req.Content
+	if content == "" {
+		if pending, ok := getPendingPluginChange(id); ok {
+			content = pending
+		} else {
+			content = getExistingPluginContent(id)
+		}
+	}
+	if content == "" {
+		plugin.PluginsMu.RLock()
+		p, ok := plugin.Plugins[id]
+		plugin.PluginsMu.RUnlock()
+		if !ok || p.Type != plugin.LOCAL_PLUGIN {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Plugin not found: " + id})
+		}
+	}
+
+	cases := req.Cases
+	if len(cases) == 0 {
+		var found bool
+		var err error
+		cases, found, err = plugin.LoadPluginTests(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if !found {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Plugin %s has no tests, add plugin/%s%s", id, id, plugin.PluginTestSuffix)})
+		}
+	}
+
+	report, err := runPluginTests(id, content, cases)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": report.Failed == 0,
+		"report":  report,
+	})
+}
+
+// runPluginTests runs cases against a test instance of the plugin source, so the loaded plugin
+// and its statistics are not touched. Built-in plugins, without source, run directly.
+func runPluginTests(id, content string, cases []plugin.PluginTestCase) (*plugin.PluginTestReport, error) {
+	if content == "" {
+		plugin.PluginsMu.RLock()
+		p, ok := plugin.Plugins[id]
+		plugin.PluginsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("plugin not found: %s", id)
+		}
+		return p.RunTests(cases), nil
+	}
+	// The test instance has its own name, so plugin_kv writes of the cases stay out of the
+	// plugin's store. It runs with the runtime and budgets the plugin is loaded with.
+	p, err := plugin.NewTestSuitePlugin(content, id+"_test_suite")
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	report := p.RunTests(cases)
+	report.Plugin = id
+	return report, nil
+}
+
+// verifyPluginTests gates a plugin change on its test file. A change fails when a case fails, or
+// when the plugin has no test file and require_plugin_tests is set.
+func verifyPluginTests(id, content string) error {
+	cases, found, err := plugin.LoadPluginTests(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if common.Config.RequirePluginTests {
+			return fmt.Errorf("plugin %s has no tests and require_plugin_tests is set, add plugin/%s%s", id, id, plugin.PluginTestSuffix)
+		}
+		return nil
+	}
+	report, err := runPluginTests(id, content, cases)
+	if err != nil {
+		return err
+	}
+	if report.Failed == 0 {
+		return nil
+	}
+	var failures []string
+	for _, res := range report.Results {
+		if !res.Passed && len(failures) < maxReportedPluginTestFailures {
+			failures = append(failures, res.Name+": "+res.Failure)
+		}
+	}
+	return fmt.Errorf("%d of %d plugin tests failed: %s", report.Failed, len(report.Results), strings.Join(failures, "; "))
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/project"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pluginRollbackMu serializes rollbacks, so two rollbacks of a plugin cannot interleave their
+// reload and follower sync
+var pluginRollbackMu sync.Mutex
+
+// recordAppliedPluginVersion adds an applied plugin change to the version history. The version
+// running before the first recorded change is added first, so it can be rolled back to.
+func recordAppliedPluginVersion(req *ComponentReloadRequest) {
+	if previous, ok := common.GetRawConfig("plugin", req.ID); ok && previous != "" {
+		if versions, err := common.GetPluginVersions(req.ID, false); err == nil && len(versions) == 0 {
+			if err := common.RecordPluginVersion(req.ID, previous, "", "initial"); err != nil {
+				logger.Warn("Failed to record initial plugin version", "id", req.ID, "error", err)
+			}
+		}
+	}
+	if err := common.RecordPluginVersion(req.ID, req.NewContent, req.Author, string(req.Source)); err != nil {
+		logger.Warn("Failed to record plugin version", "id", req.ID, "error", err)
+	}
+}
+
+// GetPluginVersions lists the applied versions of a plugin, newest first, without their content
+func GetPluginVersions(c echo.Context) error {
+	id := c.Param("id")
+	versions, err := common.GetPluginVersions(id, false)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	current := ""
+	if content, ok := common.GetRawConfig("plugin", id); ok {
+		current = common.PluginContentHash(content)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"plugin":   id,
+		"current":  current,
+		"versions": versions,
+	})
+}
+
+// GetPluginVersion returns a version of a plugin with its content
+func GetPluginVersion(c echo.Context) error {
+	v, err := common.GetPluginVersion(c.Param("id"), c.Param("hash"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, v)
+}
+
+// RollbackPlugin applies a previous version of a plugin. It is verified, written to the config
+// root and synced to the followers in one instruction, like an applied change, and recorded as a
+// new version.
+func RollbackPlugin(c echo.Context) error {
+	if err := common.RequireLeader(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	id := c.Param("id")
+	hash := c.Param("hash")
+
+	pluginRollbackMu.Lock()
+	defer pluginRollbackMu.Unlock()
+
+	// Applying the rollback removes the pending version, it must not be lost silently
+	if _, pending := getPendingPluginChange(id); pending {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "plugin " + id + " has a pending change, apply or cancel it first"})
+	}
+	current, exists := common.GetRawConfig("plugin", id)
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Plugin not found: " + id})
+	}
+	v, err := common.GetPluginVersion(id, hash)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if v.Content == current {
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": id, "version": hash, "changed": false})
+	}
+
+	affectedProjects, err := reloadComponentUnified(&ComponentReloadRequest{
+		Type:        "plugin",
+		ID:          id,
+		NewContent:  v.Content,
+		OldContent:  current,
+		Source:      SourceRollback,
+		WriteToFile: true,
+		Author:      accessIdentity(c),
+	})
+	if err != nil {
+		logger.Error("Failed to roll back plugin", "id", id, "version", hash, "error", err)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	// Restart only the projects the user wants running, as for applied changes
+	var projectsToRestart []string
+	for _, projectID := range affectedProjects {
+		if _, ok := project.GetProject(projectID); !ok {
+			continue
+		}
+		userWantsRunning, err := common.GetProjectUserIntention(projectID)
+		if err != nil || userWantsRunning {
+			projectsToRestart = append(projectsToRestart, projectID)
+		}
+	}
+	sort.Strings(projectsToRestart)
+	go func() {
+		for _, projectID := range projectsToRestart {
+			if p, ok := project.GetProject(projectID); ok {
+				if err := p.Restart(true, "rollback"); err != nil {
+					logger.Error("Failed to restart project after plugin rollback", "project_id", projectID, "error", err)
+				}
+			}
+		}
+	}()
+
+	logger.Info("Rolled back plugin", "id", id, "version", hash)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":                  id,
+		"version":             hash,
+		"changed":             true,
+		"projects_to_restart": projectsToRestart,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/plugin"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	rollbackV1 = "package plugin\n\nfunc Eval(s string) (bool, error) {\n\treturn s == \"v1\", nil\n}\n"
+	rollbackV2 = "package plugin\n\nfunc Eval(s string) (bool, error) {\n\treturn s == \"v2\", nil\n}\n"
+)
+
+// setupRollback records v1 and v2 of a plugin, v2 being the running one
+func setupRollback(t *testing.T, id string) {
+	t.Helper()
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.db")); err != nil {
+		t.Fatal(err)
+	}
+	common.SetClusterState(true, "test-node")
+	t.Cleanup(func() { common.SetClusterState(false, "") })
+	for _, content := range []string{rollbackV1, rollbackV2} {
+		if err := common.RecordPluginVersion(id, content, "alice", "change_push"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	common.SetRawConfig("plugin", id, rollbackV2)
+	t.Cleanup(func() { common.DeleteRawConfig("plugin", id) })
+}
+
+func callRollback(t *testing.T, id, hash string) (int, map[string]interface{}) {
+	t.Helper()
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	c.SetParamNames("id", "hash")
+	c.SetParamValues(id, hash)
+	if err := RollbackPlugin(c); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestRollbackPluginMissingVersion(t *testing.T) {
+	setupRollback(t, "rb_missing")
+
+	code, body := callRollback(t, "rb_missing", common.PluginContentHash("package plugin // never applied"))
+	if code != http.StatusNotFound || body["error"] == nil {
+		t.Fatalf("unknown version: %d %v", code, body)
+	}
+	code, body = callRollback(t, "rb_absent", common.PluginContentHash(rollbackV1))
+	if code != http.StatusNotFound {
+		t.Fatalf("unknown plugin: %d %v", code, body)
+	}
+	if content, _ := common.GetRawConfig("plugin", "rb_missing"); content != rollbackV2 {
+		t.Fatal("a failed rollback changed the plugin")
+	}
+
+	// Rolling back to the running version changes nothing
+	code, body = callRollback(t, "rb_missing", common.PluginContentHash(rollbackV2))
+	if code != http.StatusOK || body["changed"] != false {
+		t.Fatalf("running version: %d %v", code, body)
+	}
+
+	common.SetClusterState(false, "test-node")
+	if code, _ := callRollback(t, "rb_missing", common.PluginContentHash(rollbackV1)); code != http.StatusBadRequest {
+		t.Fatalf("rollback on a follower: %d", code)
+	}
+}
+
+func TestRollbackPluginPendingChange(t *testing.T) {
+	setupRollback(t, "rb_pending")
+	pending := rollbackV2 + "// pending\n"
+	common.GlobalMu.Lock()
+	plugin.PluginsNew["rb_pending"] = pending
+	common.GlobalMu.Unlock()
+	t.Cleanup(func() {
+		common.GlobalMu.Lock()
+		delete(plugin.PluginsNew, "rb_pending")
+		common.GlobalMu.Unlock()
+	})
+
+	code, body := callRollback(t, "rb_pending", common.PluginContentHash(rollbackV1))
+	if code != http.StatusConflict || body["error"] == nil {
+		t.Fatalf("rollback with a pending change: %d %v", code, body)
+	}
+	// The pending change and the running version are kept
+	if content, ok := getPendingPluginChange("rb_pending"); !ok || content != pending {
+		t.Fatal("the pending change was dropped")
+	}
+	if content, _ := common.GetRawConfig("plugin", "rb_pending"); content != rollbackV2 {
+		t.Fatal("the plugin was rolled back")
+	}
+	if versions, _ := common.GetPluginVersions("rb_pending", false); len(versions) != 2 {
+		t.Fatalf("%d versions, the rejected rollback was recorded", len(versions))
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/project"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// finished replays are kept this long for status queries
+const replayRetention = 24 * time.Hour
+
+type startReplayRequest struct {
+	Source         string           `json:"source"`
+	From           string           `json:"from"` // RFC3339, optional
+	To             string           `json:"to"`   // RFC3339, optional
+	Speed          float64          `json:"speed"`
+	TimestampField string           `json:"timestamp_field"`
+	Project        string           `json:"project"` // limit the replay to the flows of one running project
+	S3             *common.S3Config `json:"s3"`
+}
+
+// StartInputReplay streams archived events through a running input on this node.
+// Replayed events carry a _hub_replay field so rules and outputs can tell them apart from live data.
+func StartInputReplay(c echo.Context) error {
+	inputID := c.Param("id")
+
+	var req startReplayRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+
+	cfg := common.ReplayConfig{
+		Source:         req.Source,
+		Speed:          req.Speed,
+		TimestampField: req.TimestampField,
+		S3:             req.S3,
+	}
+	if req.From != "" {
+		t, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from, expected RFC3339 time"})
+		}
+		cfg.From = t
+	}
+	if req.To != "" {
+		t, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to, expected RFC3339 time"})
+		}
+		cfg.To = t
+	}
+
+	in, ok := project.GetInput(inputID)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Input not found: " + inputID})
+	}
+
+	var targets []string
+	if req.Project != "" {
+		proj, ok := project.GetProject(req.Project)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Project not found: " + req.Project})
+		}
+		if proj.Status != common.StatusRunning {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Project is not running: " + req.Project})
+		}
+		for _, node := range proj.FlowNodes {
+			if node.FromType == "INPUT" && node.FromID == inputID {
+				targets = append(targets, node.ToPNS)
+			}
+		}
+		if len(targets) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Project " + req.Project + " does not use input " + inputID})
+		}
+	}
+
+	common.PruneReplays(replayRetention)
+	replay, err := in.StartReplay(cfg, req.Project, targets)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to start replay: " + err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, replay.Stats())
+}
+
+// GetReplays lists replay sessions started on this node
+func GetReplays(c echo.Context) error {
+	replays := common.ListReplays()
+	if inputID := c.QueryParam("input"); inputID != "" {
+		filtered := make([]common.ReplayStats, 0, len(replays))
+		for _, r := range replays {
+			if r.InputID == inputID {
+				filtered = append(filtered, r)
+			}
+		}
+		replays = filtered
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"replays": replays})
+}
+
+// GetReplay returns the progress of one replay session
+func GetReplay(c echo.Context) error {
+	replay, ok := common.GetReplay(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Replay not found"})
+	}
+	return c.JSON(http.StatusOK, replay.Stats())
+}
+
+// StopReplay cancels a running replay session
+func StopReplay(c echo.Context) error {
+	replay, ok := common.GetReplay(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Replay not found"})
+	}
+	replay.Stop()
+	return c.JSON(http.StatusOK, replay.Stats())
+}
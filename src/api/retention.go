@@ -0,0 +1,43 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetRetention returns the effective retention policy and the report of the last janitor run
+func GetRetention(c echo.Context) error {
+	resp := map[string]interface{}{
+		"policy":      common.GetRetentionPolicy(),
+		"last_report": nil,
+	}
+	if j := common.GlobalRetentionJanitor; j != nil {
+		resp["last_report"] = j.LastReport()
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RunRetention runs the retention janitor now.
+// Optional query params:
+// - dry_run (bool): only report what would be removed, default true
+func RunRetention(c echo.Context) error {
+	j := common.GlobalRetentionJanitor
+	if j == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "Retention janitor only runs on the leader",
+		})
+	}
+
+	dryRun := true
+	if v := c.QueryParam("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid dry_run: " + v})
+		}
+		dryRun = b
+	}
+	return c.JSON(http.StatusOK, j.Run(dryRun))
+}
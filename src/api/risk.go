@@ -0,0 +1,60 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultRiskTopLimit = 20
+	maxRiskTopLimit     = 1000
+)
+
+// GetRiskScores returns the current risk scores of an entity type, added by <score> elements
+// Query params:
+// - entity (string, required): entity type, such as user, host or source_ip
+// - id (string): the entity to return, otherwise the entities with the highest scores
+// - limit (int): number of entities, default 20
+func GetRiskScores(c echo.Context) error {
+	entity := c.QueryParam("entity")
+	if entity == "" || strings.Contains(entity, ":") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "entity is required and cannot contain ':'"})
+	}
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+
+	if id := c.QueryParam("id"); id != "" {
+		score, err := common.RiskScore(entity, id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"entity":    entity,
+			"half_life": common.RiskHalfLife().String(),
+			"entities":  []common.RiskEntity{{ID: id, Score: score}},
+		})
+	}
+
+	limit := defaultRiskTopLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxRiskTopLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to " + strconv.Itoa(maxRiskTopLimit)})
+		}
+		limit = n
+	}
+	top, err := common.RiskTop(entity, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"entity":    entity,
+		"half_life": common.RiskHalfLife().String(),
+		"entities":  top,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"AgentSmith-HUB/project"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// coverageRule is a rule of a deployed ruleset with its metadata
+type coverageRule struct {
+	Ruleset    string   `json:"ruleset"`
+	Rule       string   `json:"rule"`
+	Name       string   `json:"name,omitempty"`
+	Severity   string   `json:"severity,omitempty"`
+	Confidence string   `json:"confidence,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Attack     []string `json:"attack,omitempty"`
+	References []string `json:"references,omitempty"`
+}
+
+// getRuleCoverage reports the ATT&CK techniques, severities and tags covered by the rules of the
+// deployed rulesets, from their <meta> elements
+// Optional query params:
+// - severity (string): only rules of this severity
+// - tag (string): only rules with this tag
+// - technique (string): only rules covering this technique, T1110 also matches its sub-techniques
+func getRuleCoverage(c echo.Context) error {
+	severity := strings.ToLower(c.QueryParam("severity"))
+	tag := c.QueryParam("tag")
+	technique := strings.ToUpper(c.QueryParam("technique"))
+
+	rules := []coverageRule{}
+	withoutMeta := 0
+	for id, rs := range project.GetAllRulesets() {
+		for i := range rs.Rules {
+			rule := &rs.Rules[i]
+			meta := rule.Meta
+			if meta == nil {
+				withoutMeta++
+				continue
+			}
+			if severity != "" && meta.Severity != severity {
+				continue
+			}
+			if tag != "" && !containsString(meta.Tags, tag) {
+				continue
+			}
+			if technique != "" && !coversTechnique(meta.Attack, technique) {
+				continue
+			}
+			rules = append(rules, coverageRule{
+				Ruleset:    id,
+				Rule:       rule.ID,
+				Name:       rule.Name,
+				Severity:   meta.Severity,
+				Confidence: meta.Confidence,
+				Tags:       meta.Tags,
+				Attack:     meta.Attack,
+				References: meta.References,
+			})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Ruleset != rules[j].Ruleset {
+			return rules[i].Ruleset < rules[j].Ruleset
+		}
+		return rules[i].Rule < rules[j].Rule
+	})
+
+	techniques := make(map[string][]string) // technique -> "ruleset.rule"
+	severities := make(map[string]int)
+	tags := make(map[string]int)
+	for _, r := range rules {
+		for _, t := range r.Attack {
+			techniques[t] = append(techniques[t], r.Ruleset+"."+r.Rule)
+		}
+		if r.Severity != "" {
+			severities[r.Severity]++
+		}
+		for _, t := range r.Tags {
+			tags[t]++
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rules":              rules,
+		"techniques":         techniques,
+		"technique_count":    len(techniques),
+		"severities":         severities,
+		"tags":               tags,
+		"rules_without_meta": withoutMeta,
+	})
+}
+
+// coversTechnique returns whether techniques holds technique or, for a technique without
+// sub-technique, one of its sub-techniques
+func coversTechnique(techniques []string, technique string) bool {
+	for _, t := range techniques {
+		if t == technique || (!strings.Contains(technique, ".") && strings.HasPrefix(t, technique+".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"AgentSmith-HUB/rules_engine"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetRuleMetrics returns the evaluation profile of each rule, the hottest rules first
+// Optional query params:
+// - ruleset (string): filter by ruleset ID
+// - node_id (string): only the profiles of one node, default all nodes merged
+// - sort (string): time (default, total evaluation time), p95, evaluations, matches, plugin or regex
+// - limit (int): maximum number of rules, default 50
+func GetRuleMetrics(c echo.Context) error {
+	rulesetID := c.QueryParam("ruleset")
+	nodeID := c.QueryParam("node_id")
+	sortBy := c.QueryParam("sort")
+	if sortBy == "" {
+		sortBy = "time"
+	}
+	limit := 50
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be a positive number"})
+		}
+		limit = n
+	}
+
+	var key func(m *rules_engine.RuleMetrics) float64
+	switch sortBy {
+	case "time":
+		key = func(m *rules_engine.RuleMetrics) float64 { return m.Latency.SumMs }
+	case "p95":
+		key = func(m *rules_engine.RuleMetrics) float64 { return m.Latency.P95Ms }
+	case "evaluations":
+		key = func(m *rules_engine.RuleMetrics) float64 { return float64(m.Evaluations) }
+	case "matches":
+		key = func(m *rules_engine.RuleMetrics) float64 { return float64(m.Matches) }
+	case "plugin":
+		key = func(m *rules_engine.RuleMetrics) float64 { return m.Plugin.SumMs }
+	case "regex":
+		key = func(m *rules_engine.RuleMetrics) float64 { return m.Regex.SumMs }
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "sort must be time, p95, evaluations, matches, plugin or regex"})
+	}
+
+	all, err := rules_engine.GetClusterRuleMetrics()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get rule metrics: " + err.Error()})
+	}
+
+	filtered := make([]rules_engine.RuleMetrics, 0, len(all))
+	for _, m := range all {
+		if rulesetID != "" && m.RulesetID != rulesetID {
+			continue
+		}
+		if nodeID != "" && nodeID != "all" && m.NodeID != nodeID {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	// Merging also computes the time shares within the selected rules
+	filtered = rules_engine.MergeRuleMetrics(filtered)
+	if nodeID != "" && nodeID != "all" {
+		for i := range filtered {
+			filtered[i].NodeID = nodeID
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool { return key(&filtered[i]) > key(&filtered[j]) })
+	total := len(filtered)
+	if len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"bucket_bounds_us": rules_engine.RuleLatencyBucketsUs,
+		"rules":            filtered,
+		"total":            total,
+	})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"AgentSmith-HUB/project"
+	"AgentSmith-HUB/rules_engine"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// runRuleTests runs the tests embedded in the rules of a ruleset and reports rule coverage.
+// /rule-tests/:id tests the pending version of the ruleset when there is one, /rule-tests-content
+// the ruleset in the content field of the body.
+func runRuleTests(c echo.Context) error {
+	id := c.Param("id")
+	var req struct {
+		Content string `json:"content,omitempty"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+
+	content := req.Content
+	if content == "" && id != "" {
+		if tempPath, ok := GetComponentPath("ruleset", id, true); ok {
+			content, _ = ReadComponent(tempPath)
+		}
+		if content == "" {
+			if formalPath, ok := GetComponentPath("ruleset", id, false); ok {
+				content, _ = ReadComponent(formalPath)
+			}
+		}
+		if content == "" {
+			if rs, ok := project.GetRuleset(id); ok {
+				content = rs.RawConfig
+			}
+		}
+		if content == "" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Ruleset not found: " + id})
+		}
+	}
+	if content == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Either ruleset ID or content must be provided"})
+	}
+
+	report, err := rules_engine.RunRuleTests(content)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to parse ruleset: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": report.Failed == 0,
+		"report":  report,
+	})
+}
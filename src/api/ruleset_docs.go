@@ -0,0 +1,72 @@
+package api
+
+import (
+	"AgentSmith-HUB/project"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// getRulesetDocs renders the documentation of a deployed ruleset from its parsed rules. The format
+// query parameter selects markdown (default), html, json, or a zip bundle holding all three.
+func getRulesetDocs(c echo.Context) error {
+	id := c.Param("id")
+	rs, ok := project.GetRuleset(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "ruleset not found"})
+	}
+	doc := rs.Doc()
+
+	switch format := c.QueryParam("format"); format {
+	case "", "markdown", "md":
+		return c.Blob(http.StatusOK, "text/markdown; charset=utf-8", []byte(doc.Markdown()))
+	case "html":
+		page, err := doc.HTML()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to render ruleset docs: %v", err)})
+		}
+		return c.HTML(http.StatusOK, page)
+	case "json":
+		return c.JSON(http.StatusOK, doc)
+	case "bundle", "zip":
+		page, err := doc.HTML()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to render ruleset docs: %v", err)})
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to render ruleset docs: %v", err)})
+		}
+
+		var buf bytes.Buffer
+		zipWriter := zip.NewWriter(&buf)
+		for _, f := range []struct {
+			name    string
+			content []byte
+		}{
+			{id + ".md", []byte(doc.Markdown())},
+			{id + ".html", []byte(page)},
+			{id + ".json", data},
+		} {
+			w, err := zipWriter.Create(f.name)
+			if err == nil {
+				_, err = w.Write(f.content)
+			}
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create zip: %v", err)})
+			}
+		}
+		if err := zipWriter.Close(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to close zip: %v", err)})
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", id+"-docs.zip"))
+		return c.Blob(http.StatusOK, "application/zip", buf.Bytes())
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unsupported format %q, must be markdown, html, json or bundle", format)})
+	}
+}
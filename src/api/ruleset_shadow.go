@@ -0,0 +1,77 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/project"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetRulesetShadows lists the divergence reports of the rulesets in shadow mode
+func GetRulesetShadows(c echo.Context) error {
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	ids, err := project.RulesetShadowIDs()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	reports := make([]project.RulesetShadowReport, 0, len(ids))
+	for _, id := range ids {
+		report, err := project.GetRulesetShadowReport(id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		reports = append(reports, report)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"shadows": reports})
+}
+
+// StartRulesetShadow evaluates the pending changes of a ruleset on live traffic next to the active
+// version on every node. Matches are counted in Redis, the new version forwards nothing.
+func StartRulesetShadow(c echo.Context) error {
+	id := c.Param("id")
+	if _, ok := project.GetRuleset(id); !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Ruleset not found: " + id})
+	}
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	if err := project.StartRulesetShadow(id); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to start shadow mode: " + err.Error()})
+	}
+	report, err := project.GetRulesetShadowReport(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetRulesetShadow returns the divergence counted for a ruleset, it is kept after the shadow mode ends
+func GetRulesetShadow(c echo.Context) error {
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	report, err := project.GetRulesetShadowReport(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// StopRulesetShadow ends the shadow mode of a ruleset
+func StopRulesetShadow(c echo.Context) error {
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	id := c.Param("id")
+	if err := project.StopRulesetShadow(id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	report, err := project.GetRulesetShadowReport(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
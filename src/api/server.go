@@ -1,6 +1,7 @@
 package api
 
 import (
+	"AgentSmith-HUB/common"
 	"AgentSmith-HUB/logger"
 	"AgentSmith-HUB/mcp"
 	"errors"
@@ -38,12 +39,22 @@ func ServerStart(listener string) error {
 		return err
 	}
 
-	// Configure access logger with custom format and output to access.log
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Output: accessLogWriter,
-		Format: `{"time":"${time_rfc3339}","id":"${id}","remote_ip":"${remote_ip}","host":"${host}","method":"${method}","uri":"${uri}","user_agent":"${user_agent}","status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}","bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n",
-	}))
+	// Structured access log with route and identity, written to access.log and passed to access log inputs
+	if cfg := common.Config.APIAccessLog; cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			logger.Error("invalid api_access_log configuration", "error", err)
+			return err
+		}
+	}
+	if cfg := common.Config.SamplerAccess; cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			logger.Error("invalid sampler_access configuration", "error", err)
+			return err
+		}
+	}
+	e.Use(apiAccessLog(accessLogWriter, common.Config.APIAccessLog))
 	e.Use(middleware.Recover())
+	e.Use(rejectWritesWhenSteppedDown)
 
 	// Authentication middleware will be applied selectively via AuthenticateRequest
 
@@ -95,6 +106,8 @@ func ServerStart(listener string) error {
 	// Ruleset endpoints (use plural form for consistency) - REQUIRE AUTH
 	auth.GET("/rulesets", getRulesets)
 	auth.GET("/rulesets/:id", getRuleset)
+	auth.GET("/rulesets/:id/docs", getRulesetDocs)
+	auth.GET("/rule-coverage", getRuleCoverage)
 	auth.POST("/rulesets", createRuleset)
 	auth.PUT("/rulesets/:id", updateRuleset)
 	auth.DELETE("/rulesets/:id", deleteRuleset)
@@ -132,6 +145,11 @@ func ServerStart(listener string) error {
 	auth.GET("/plugin-parameters/:id", GetPluginParameters)
 	auth.GET("/plugin-parameters", GetBatchPluginParameters)
 	auth.GET("/plugins/:id/usage", getPluginUsage)
+	auth.GET("/plugin-packages", GetPluginPackages)
+	auth.GET("/plugin-health", GetPluginHealth)
+	auth.GET("/plugin-versions/:id", GetPluginVersions)
+	auth.GET("/plugin-versions/:id/:hash", GetPluginVersion)
+	auth.POST("/plugin-versions/:id/:hash/rollback", RollbackPlugin)
 
 	// Component verification and testing - REQUIRE AUTH
 	auth.POST("/verify/:type/:id", verifyComponent)
@@ -139,9 +157,14 @@ func ServerStart(listener string) error {
 	auth.POST("/connect-check/:type/:id", connectCheck)
 	auth.POST("/test-plugin/:id", testPlugin)
 	auth.POST("/test-plugin-content", testPlugin)
+	auth.POST("/test-plugin-suite/:id", runPluginTestSuite)
 	auth.POST("/test-ruleset/:id", testRuleset)
 	auth.POST("/test-ruleset-content", testRuleset)
+	auth.POST("/rule-tests/:id", runRuleTests)
+	auth.POST("/rule-tests-content", runRuleTests)
 	auth.POST("/test-output/:id", testOutput)
+	auth.GET("/output-captures/:id", getOutputCaptures, requireSamplerAccess)
+	auth.DELETE("/output-captures/:id", clearOutputCaptures)
 	auth.POST("/test-project/:id", testProject)
 	auth.POST("/test-project-content/:inputNode", testProject)
 
@@ -150,6 +173,8 @@ func ServerStart(listener string) error {
 	auth.GET("/config/download", downloadConfig)
 	auth.GET("/cluster/instruction-stats", getInstructionStats)
 	auth.GET("/cluster/follower-execution-status", getFollowerExecutionStatus)
+	auth.GET("/cluster/leader-lock", getLeaderLock)
+	auth.GET("/cluster/redis-replicas", getRedisReplicas)
 
 	// Pending changes management (enhanced) - REQUIRE AUTH
 	auth.GET("/pending-changes", GetPendingChanges)                  // Legacy endpoint
@@ -166,8 +191,8 @@ func ServerStart(listener string) error {
 	auth.DELETE("/temp-file/:type/:id", DeleteTempFile)
 
 	// Sampler endpoints - REQUIRE AUTH
-	auth.GET("/samplers/data", GetSamplerData)
-	auth.POST("/samplers/data/intelligent", GetSamplersDataIntelligent)
+	auth.GET("/samplers/data", GetSamplerData, requireSamplerAccess)
+	auth.POST("/samplers/data/intelligent", GetSamplersDataIntelligent, requireSamplerAccess)
 	auth.GET("/ruleset-fields/:id", GetRulesetFields)
 	auth.GET("/ruleset-fields", GetBatchRulesetFields)
 
@@ -221,6 +246,81 @@ func ServerStart(listener string) error {
 
 	// Plugin statistics endpoint - REQUIRE AUTH
 	auth.GET("/plugin-stats", GetPluginStats)
+	auth.GET("/suppress-stats", GetSuppressStats)
+	auth.GET("/exclude-stats", GetExcludeStats)
+
+	// End-to-end latency SLI endpoint - REQUIRE AUTH
+	auth.GET("/latency-sli", GetLatencySLI)
+
+	// Per-rule evaluation profiles - REQUIRE AUTH
+	auth.GET("/rule-metrics", GetRuleMetrics)
+
+	// Goroutine and channel leak detector endpoint - REQUIRE AUTH
+	auth.GET("/leak-detector", GetLeakDetector)
+
+	// Retention policy and janitor runs - REQUIRE AUTH
+	auth.GET("/retention", GetRetention)
+	auth.POST("/retention/run", RunRetention)
+
+	// Threat intel feeds - REQUIRE AUTH
+	auth.GET("/threat-intel/feeds", GetThreatIntelFeeds)
+	auth.POST("/threat-intel/feeds/:name/refresh", RefreshThreatIntelFeed)
+
+	// Shared lists of IN_LIST checks - REQUIRE AUTH
+	auth.GET("/lists", GetSharedLists)
+	auth.POST("/lists", CreateSharedList)
+	auth.GET("/lists/:name", GetSharedList)
+	auth.DELETE("/lists/:name", DeleteSharedList)
+	auth.POST("/lists/:name/entries", AddSharedListEntries)
+	auth.DELETE("/lists/:name/entries", RemoveSharedListEntries)
+
+	// Runtime values of thresholds with a value_ref - REQUIRE AUTH
+	auth.GET("/threshold-values", GetThresholdValues)
+	auth.POST("/threshold-values", SetThresholdValue)
+	auth.DELETE("/threshold-values", DeleteThresholdValue)
+
+	// Entity risk scores of <score> elements - REQUIRE AUTH
+	auth.GET("/risk-scores", GetRiskScores)
+
+	// Sigma rule conversion - REQUIRE AUTH
+	auth.POST("/sigma/convert", ConvertSigmaRules)
+
+	// Fired alerts time-range query - REQUIRE AUTH
+	auth.GET("/alerts", GetAlerts)
+
+	// Delivery receipts reconciliation endpoint - REQUIRE AUTH
+	auth.GET("/delivery-reconciliation", GetDeliveryReconciliation)
+
+	// Input replay endpoints - REQUIRE AUTH
+	auth.POST("/inputs/:id/replay", StartInputReplay)
+	auth.GET("/replays", GetReplays, requireSamplerAccess)
+	auth.GET("/replays/:id", GetReplay, requireSamplerAccess)
+	auth.DELETE("/replays/:id", StopReplay, requireSamplerAccess)
+
+	// Ruleset backtest endpoint - REQUIRE AUTH
+	auth.POST("/backtest", RunBacktest, requireSamplerAccess)
+
+	// Shadow project endpoints - REQUIRE AUTH
+	auth.POST("/shadows", StartShadow, requireSamplerAccess)
+	auth.GET("/shadows", GetShadows, requireSamplerAccess)
+	auth.GET("/shadows/:id", GetShadow, requireSamplerAccess)
+	auth.DELETE("/shadows/:id", StopShadow, requireSamplerAccess)
+
+	// Ruleset shadow mode endpoints - REQUIRE AUTH
+	auth.GET("/ruleset-shadows", GetRulesetShadows)
+	auth.POST("/ruleset-shadows/:id", StartRulesetShadow)
+	auth.GET("/ruleset-shadows/:id", GetRulesetShadow)
+	auth.DELETE("/ruleset-shadows/:id", StopRulesetShadow)
+
+	// Ruleset distribution to child hubs - REQUIRE AUTH
+	auth.POST("/distribution/rollouts", StartRollout)
+	auth.GET("/distribution/rollouts", GetRollouts)
+	auth.GET("/distribution/rollouts/:id", GetRollout)
+	auth.DELETE("/distribution/rollouts/:id", StopRollout)
+	auth.GET("/distribution/children", GetDistributionChildren)
+	// Called by the parent hub on a child hub
+	auth.GET("/distribution/rulesets", GetDistributedVersions)
+	auth.PUT("/distribution/rulesets/:id", ReceiveDistributedRuleset)
 
 	if err := e.Start(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
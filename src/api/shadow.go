@@ -0,0 +1,118 @@
+package api
+
+import (
+	"AgentSmith-HUB/project"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// finished shadow runs are kept this long for report queries
+const shadowRetention = 24 * time.Hour
+
+type startShadowRequest struct {
+	Project     string            `json:"project"`
+	Candidates  map[string]string `json:"candidates"` // ruleset ID -> raw config, an empty value uses the pending change
+	Duration    string            `json:"duration"`
+	MaxEvents   int               `json:"max_events"`
+	MaxExamples int               `json:"max_examples"`
+}
+
+// StartShadow clones a running project into a shadow that reads the same input with candidate
+// ruleset versions and compares its outputs with the live copy until the window ends.
+// Without candidates every ruleset of the project that has a pending change is used.
+func StartShadow(c echo.Context) error {
+	var req startShadowRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+	if req.Project == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project is required"})
+	}
+	proj, ok := project.GetProject(req.Project)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Project not found: " + req.Project})
+	}
+
+	cfg := project.ShadowConfig{
+		ProjectID:   req.Project,
+		Candidates:  make(map[string]string),
+		MaxEvents:   req.MaxEvents,
+		MaxExamples: req.MaxExamples,
+	}
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid duration, expected e.g. 15m"})
+		}
+		cfg.Duration = d
+	}
+
+	if len(req.Candidates) == 0 {
+		for _, node := range proj.FlowNodes {
+			if node.ToType != "RULESET" {
+				continue
+			}
+			if raw, ok := pendingRulesetContent(node.ToID); ok {
+				cfg.Candidates[node.ToID] = raw
+			}
+		}
+		if len(cfg.Candidates) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "No candidate version: provide candidates or save a pending change for a ruleset of " + req.Project})
+		}
+	}
+	for id, raw := range req.Candidates {
+		if raw == "" {
+			if raw, ok = pendingRulesetContent(id); !ok {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "No candidate version: provide content or save a pending change for " + id})
+			}
+		}
+		cfg.Candidates[id] = raw
+	}
+
+	project.PruneShadows(shadowRetention)
+	shadow, err := project.StartShadow(cfg)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to start shadow: " + err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, shadow.Report())
+}
+
+// GetShadows lists shadow runs started on this node, without examples
+func GetShadows(c echo.Context) error {
+	shadows := project.ListShadows()
+	if projectID := c.QueryParam("project"); projectID != "" {
+		filtered := make([]project.ShadowReport, 0, len(shadows))
+		for _, s := range shadows {
+			if s.ProjectID == projectID {
+				filtered = append(filtered, s)
+			}
+		}
+		shadows = filtered
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"shadows": shadows})
+}
+
+// GetShadow returns the difference report of one shadow run
+func GetShadow(c echo.Context) error {
+	shadow, ok := project.GetShadow(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Shadow not found"})
+	}
+	return c.JSON(http.StatusOK, shadow.Report())
+}
+
+// StopShadow ends a shadow run early, the report covers the events seen so far
+func StopShadow(c echo.Context) error {
+	shadow, ok := project.GetShadow(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Shadow not found"})
+	}
+	shadow.Stop()
+	select {
+	case <-shadow.Done():
+	case <-time.After(30 * time.Second):
+	}
+	return c.JSON(http.StatusOK, shadow.Report())
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type sharedListRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type sharedListEntriesRequest struct {
+	Values []string `json:"values"`
+	// TTL is a duration like 24h, entries without TTL never expire
+	TTL string `json:"ttl"`
+}
+
+func sharedListError(c echo.Context, err error) error {
+	if errors.Is(err, common.ErrSharedListNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// GetSharedLists returns the shared lists IN_LIST checks can reference
+func GetSharedLists(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"lists": []common.SharedListInfo{}})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"lists": m.Lists()})
+}
+
+// GetSharedList returns a shared list with its unexpired entries
+func GetSharedList(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Shared lists are not initialized"})
+	}
+	info, entries, ok := m.List(c.Param("name"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "list not found: " + c.Param("name")})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"list": info, "entries": entries})
+}
+
+// CreateSharedList creates an empty shared list
+func CreateSharedList(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Shared lists are not initialized"})
+	}
+	var req sharedListRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	info, err := m.CreateList(req.Name, req.Type, req.Description)
+	if err != nil {
+		return sharedListError(c, err)
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{"list": info})
+}
+
+// DeleteSharedList removes a shared list, rulesets referencing it fail to load afterwards
+func DeleteSharedList(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Shared lists are not initialized"})
+	}
+	if err := m.DeleteList(c.Param("name")); err != nil {
+		return sharedListError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "List deleted"})
+}
+
+// AddSharedListEntries adds values to a shared list, optionally expiring after a TTL
+func AddSharedListEntries(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Shared lists are not initialized"})
+	}
+	var req sharedListEntriesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req.Values) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "values cannot be empty"})
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ttl, expected e.g. 24h"})
+		}
+	}
+	added, err := m.AddEntries(c.Param("name"), req.Values, ttl)
+	if err != nil {
+		return sharedListError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"added": added})
+}
+
+// RemoveSharedListEntries removes values from a shared list
+func RemoveSharedListEntries(c echo.Context) error {
+	m := common.GlobalSharedLists
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Shared lists are not initialized"})
+	}
+	var req sharedListEntriesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	removed, err := m.RemoveEntries(c.Param("name"), req.Values)
+	if err != nil {
+		return sharedListError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"removed": removed})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/rules_engine"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type sigmaConvertRequest struct {
+	// Content is one Sigma rule, or several separated by "---"
+	Content string `json:"content"`
+	// Mapping overrides the sigma mapping of config.yaml
+	Mapping *common.SigmaMapping `json:"mapping,omitempty"`
+}
+
+// ConvertSigmaRules converts Sigma rules to ruleset XML, which can then be saved as a new ruleset
+func ConvertSigmaRules(c echo.Context) error {
+	var req sigmaConvertRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+	}
+	if req.Content == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "content is required"})
+	}
+	mapping := req.Mapping
+	if mapping == nil {
+		mapping = common.Config.Sigma
+	}
+
+	content, rules, err := rules_engine.ConvertSigma([]byte(req.Content), mapping)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// The output must parse, plugins and data sources are only resolved when the ruleset is saved
+	if _, err := rules_engine.ParseRuleset([]byte(content)); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "converted ruleset is invalid: " + err.Error(), "content": content})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"content": content, "rules": rules})
+}
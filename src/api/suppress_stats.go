@@ -0,0 +1,75 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetSuppressStats returns the matches suppressed by <suppress> per ruleset and rule for the given
+// date (default today), aggregated across all nodes
+// Optional query params:
+// - date (YYYY-MM-DD): filter by date
+// - project (string): filter by project
+// - ruleset (string): filter by ruleset ID
+func GetSuppressStats(c echo.Context) error {
+	// For suppressions projectNodeSequence is "SUPPRESS.{rulesetID}.{ruleID}"
+	return getRuleStats(c, "rule_suppressed")
+}
+
+// GetExcludeStats returns the events dropped by the rules of EXCLUDE rulesets per ruleset and rule
+// for the given date (default today), aggregated across all nodes
+// Optional query params:
+// - date (YYYY-MM-DD): filter by date
+// - project (string): filter by project
+// - ruleset (string): filter by ruleset ID
+func GetExcludeStats(c echo.Context) error {
+	// For exclusions projectNodeSequence is "EXCLUDE.{rulesetID}.{ruleID}"
+	return getRuleStats(c, "rule_excluded")
+}
+
+// getRuleStats sums the per rule counters of componentType by ruleset and rule
+func getRuleStats(c echo.Context, componentType string) error {
+	date := c.QueryParam("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	projectID := c.QueryParam("project")
+	filterRuleset := c.QueryParam("ruleset")
+
+	if common.GlobalDailyStatsManager == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Daily stats manager not initialized"})
+	}
+
+	allData := common.GlobalDailyStatsManager.GetDailyStats(date, projectID, "")
+
+	stats := make(map[string]map[string]uint64) // rulesetID -> ruleID -> count
+	var total uint64
+	for _, data := range allData {
+		if data.ComponentType != componentType {
+			continue
+		}
+		parts := strings.SplitN(data.ProjectNodeSequence, ".", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		rulesetID, ruleID := parts[1], parts[2]
+		if filterRuleset != "" && rulesetID != filterRuleset {
+			continue
+		}
+		if stats[rulesetID] == nil {
+			stats[rulesetID] = make(map[string]uint64)
+		}
+		stats[rulesetID][ruleID] += data.TotalMessages
+		total += data.TotalMessages
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"date":  date,
+		"stats": stats,
+		"total": total,
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"AgentSmith-HUB/common"
 	"AgentSmith-HUB/input"
 	"AgentSmith-HUB/local_plugin"
 	"AgentSmith-HUB/logger"
@@ -424,6 +425,8 @@ func testOutput(c echo.Context) error {
 	// Parse request body
 	var req struct {
 		Data map[string]interface{} `json:"data"`
+		// Mode "capture" stores the serialized event instead of sending it, default "send"
+		Mode string `json:"mode"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -442,6 +445,13 @@ func testOutput(c echo.Context) error {
 			"result":  nil,
 		})
 	}
+	if req.Mode != "" && req.Mode != "send" && req.Mode != "capture" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid mode: " + req.Mode + ", expected send or capture",
+			"result":  nil,
+		})
+	}
 
 	// Check if output exists in formal or temporary files
 	var outputContent string
@@ -500,6 +510,32 @@ func testOutput(c echo.Context) error {
 		})
 	}
 
+	// Capture mode renders the event without starting the output, so no sink is contacted
+	if req.Mode == "capture" {
+		captured, err := tempOutput.Capture(req.Data)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+				"result":  nil,
+			})
+		}
+		if err := common.StoreOutputCapture(id, captured); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"error":   "Failed to store capture: " + err.Error(),
+				"result":  nil,
+			})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"success":    true,
+			"isTemp":     isTemp,
+			"outputType": string(tempOutput.Type),
+			"mode":       "capture",
+			"result":     captured,
+		})
+	}
+
 	// Create channels for testing
 	inputCh := make(chan map[string]interface{}, 100)
 	tempOutput.UpStream["_testing"] = &inputCh
@@ -577,6 +613,36 @@ done:
 	return c.JSON(http.StatusOK, response)
 }
 
+// getOutputCaptures returns the events captured by test-output in capture mode, newest first
+func getOutputCaptures(c echo.Context) error {
+	id := c.Param("id")
+	captures, err := common.GetOutputCaptures(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Failed to read captures: " + err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"id":       id,
+		"captures": captures,
+		"total":    len(captures),
+	})
+}
+
+// clearOutputCaptures deletes the captures of an output
+func clearOutputCaptures(c echo.Context) error {
+	id := c.Param("id")
+	if err := common.ClearOutputCaptures(id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Failed to clear captures: " + err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"success": true, "id": id})
+}
+
 // Helper function to return appropriate error format based on call mode
 func projectErrorResponse(isContentMode bool, httpStatus int, success bool, errorMsg string) map[string]interface{} {
 	if isContentMode {
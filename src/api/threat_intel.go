@@ -0,0 +1,36 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetThreatIntelFeeds returns the state of the threat intel feeds on this node
+func GetThreatIntelFeeds(c echo.Context) error {
+	m := common.GlobalThreatIntel
+	if m == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"feeds": []common.ThreatIntelFeedStatus{}})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"feeds": m.Status()})
+}
+
+// RefreshThreatIntelFeed downloads a feed now, the other nodes load it on their next sync
+func RefreshThreatIntelFeed(c echo.Context) error {
+	m := common.GlobalThreatIntel
+	if m == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "No threat intel feed configured"})
+	}
+	if !common.IsLeader {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Threat intel feeds are refreshed by the leader"})
+	}
+	name := c.Param("name")
+	if !m.HasFeed(name) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "threat intel feed not found: " + name})
+	}
+	if err := m.Refresh(name); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"feeds": m.Status()})
+}
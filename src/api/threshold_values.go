@@ -0,0 +1,57 @@
+package api
+
+import (
+	"AgentSmith-HUB/common"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type thresholdValueRequest struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+// GetThresholdValues returns the values of thresholds with a value_ref
+func GetThresholdValues(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"values": common.ThresholdValues()})
+}
+
+// SetThresholdValue sets the value of the thresholds whose value_ref is redis:<name>, every node
+// applies it within a few seconds without reloading the rulesets
+func SetThresholdValue(c echo.Context) error {
+	var req thresholdValueRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if err := common.ValidateThresholdValueName(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.Value <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "value must be greater than 0"})
+	}
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	if err := common.SetThresholdValue(req.Name, req.Value); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"value": common.ThresholdValue{Name: req.Name, Value: req.Value}})
+}
+
+// DeleteThresholdValue removes a value, the thresholds referencing it use the value of their element
+// Query params:
+// - name (string, required): name of the value
+func DeleteThresholdValue(c echo.Context) error {
+	name := c.QueryParam("name")
+	if err := common.ValidateThresholdValueName(name); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if common.GetRedisClient() == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Redis is not available"})
+	}
+	if err := common.DeleteThresholdValue(name); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Threshold value deleted"})
+}
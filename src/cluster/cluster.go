@@ -107,6 +107,15 @@ func GetClusterStatus() map[string]interface{} {
 	// Set current node status based on leader flag
 	if common.IsCurrentNodeLeader() {
 		status["status"] = "leader"
+		if lockMetrics := GetLeaderLockMetrics(); lockMetrics != nil {
+			status["leader_lock"] = lockMetrics
+		}
+		steppedDown, _, _ := common.IsLeaderSteppedDown()
+		status["stepped_down"] = steppedDown
+	} else if GlobalSyncListener != nil {
+		if stepDown := GlobalSyncListener.GetLastLeaderStepDown(); stepDown != nil {
+			status["last_leader_step_down"] = stepDown
+		}
 	}
 
 	nodeList := make(map[string]interface{})
@@ -123,6 +132,9 @@ func GetClusterStatus() map[string]interface{} {
 			"timestamp": time.Now().Unix(),
 			"online":    true,
 			"role":      "leader",
+			"probes":    common.GetProbeStatuses(),
+			"leaks":     common.GetActiveLeakWarnings(),
+			"breakers":  common.GetOutputBreakerStatuses(true),
 		}
 	} else {
 		// Follower node
@@ -131,6 +143,9 @@ func GetClusterStatus() map[string]interface{} {
 			"timestamp": time.Now().Unix(),
 			"online":    true,
 			"role":      "follower",
+			"probes":    common.GetProbeStatuses(),
+			"leaks":     common.GetActiveLeakWarnings(),
+			"breakers":  common.GetOutputBreakerStatuses(true),
 		}
 	}
 
@@ -151,6 +166,9 @@ func GetClusterStatus() map[string]interface{} {
 				"online":    true,
 				"role":      "follower",
 				"healthy":   isHealthy, // Add health status
+				"probes":    heartbeat.Probes,
+				"leaks":     heartbeat.Leaks,
+				"breakers":  heartbeat.Breakers,
 			}
 		}
 	}
@@ -20,6 +20,11 @@ type HeartbeatData struct {
 	MemoryUsedMB   float64 `json:"memory_used_mb"`
 	MemoryPercent  float64 `json:"memory_percent"`
 	GoroutineCount int     `json:"goroutine_count"`
+
+	Probes []common.ProbeStatus `json:"probes,omitempty"`
+	Leaks  []common.LeakWarning `json:"leaks,omitempty"`
+	// Output circuit breakers that are not closed
+	Breakers []common.OutputBreakerStatus `json:"breakers,omitempty"`
 }
 
 // HeartbeatManager manages heartbeat and version sync
@@ -185,6 +190,9 @@ func (hm *HeartbeatManager) sendHeartbeat() {
 		MemoryUsedMB:   memoryUsedMB,
 		MemoryPercent:  memoryPercent,
 		GoroutineCount: goroutineCount,
+		Probes:         common.GetProbeStatuses(),
+		Leaks:          common.GetActiveLeakWarnings(),
+		Breakers:       common.GetOutputBreakerStatuses(true),
 	}
 
 	data, err := json.Marshal(heartbeat)
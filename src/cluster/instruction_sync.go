@@ -210,6 +210,9 @@ func (im *InstructionManager) processInstructionInternal(componentName, componen
 	if !common.IsCurrentNodeLeader() {
 		return fmt.Errorf("only leader can initialize instructions")
 	}
+	if steppedDown, reason, _ := common.IsLeaderSteppedDown(); steppedDown {
+		return fmt.Errorf("leader has stepped down, refusing to publish instruction: %s", reason)
+	}
 
 	if componentName == "" || componentType == "" || operation == "" {
 		return fmt.Errorf("component name, type, and operation are required")
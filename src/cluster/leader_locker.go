@@ -3,6 +3,9 @@ package cluster
 import (
 	"AgentSmith-HUB/common"
 	"AgentSmith-HUB/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,15 +15,70 @@ import (
 
 var leaderLockerKey = "cluster:leader:lock"
 
+const (
+	leaderLockExpiry        = time.Minute
+	leaderLockRefreshPeriod = 10 * time.Second
+	// leaderLockRetryPeriod is used after a renewal failed but the lock has not expired yet
+	leaderLockRetryPeriod = 2 * time.Second
+	// leaderLockReacquirePeriod is how often a stepped down leader tries to take the lock back
+	leaderLockReacquirePeriod = 5 * time.Second
+	maxLeaderLockLossEvents   = 20
+)
+
+// LeaderLockLossEvent records one loss of the leader lock
+type LeaderLockLossEvent struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	Reason       string     `json:"reason"`
+	ReacquiredAt *time.Time `json:"reacquired_at,omitempty"`
+}
+
+// LeaderLockMetrics describes the state of the leader lock held by this node
+type LeaderLockMetrics struct {
+	Held        bool      `json:"held"`
+	SteppedDown bool      `json:"stepped_down"`
+	TTLSeconds  float64   `json:"ttl_seconds"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	LastRenewal          time.Time `json:"last_renewal"`
+	LastRenewalLatencyMs float64   `json:"last_renewal_latency_ms"`
+	MaxRenewalLatencyMs  float64   `json:"max_renewal_latency_ms"`
+	AvgRenewalLatencyMs  float64   `json:"avg_renewal_latency_ms"`
+	Renewals             uint64    `json:"renewals"`
+	RenewalFailures      uint64    `json:"renewal_failures"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+
+	LockLosses     uint64                `json:"lock_losses"`
+	Reacquisitions uint64                `json:"reacquisitions"`
+	RecentLosses   []LeaderLockLossEvent `json:"recent_losses"`
+}
+
 type LeaderLocker struct {
 	lock *redsync.Mutex
 	done chan struct{}
 	once sync.Once
+
+	mu           sync.Mutex
+	held         bool
+	expiresAt    time.Time
+	lastRenewal  time.Time
+	lastLatency  time.Duration
+	maxLatency   time.Duration
+	totalLatency time.Duration
+	renewals     uint64
+	failures     uint64
+	consecutive  int
+	losses       uint64
+	reacquired   uint64
+	lossEvents   []LeaderLockLossEvent
+}
+
+func newLeaderMutex() *redsync.Mutex {
+	return redsync.New(goredis.NewPool(common.GetRedisClient())).NewMutex(leaderLockerKey, redsync.WithExpiry(leaderLockExpiry), redsync.WithRetryDelay(time.Second), redsync.WithTries(60))
 }
 
 func ObtainLeaderLocker() (*LeaderLocker, error) {
 
-	lock := redsync.New(goredis.NewPool(common.GetRedisClient())).NewMutex(leaderLockerKey, redsync.WithExpiry(time.Minute), redsync.WithRetryDelay(time.Second), redsync.WithTries(60))
+	lock := newLeaderMutex()
 	err := lock.Lock()
 	if err != nil {
 		return nil, err
@@ -28,7 +86,7 @@ func ObtainLeaderLocker() (*LeaderLocker, error) {
 	logger.Debug("Obtained leader locker", "lock_value", lock.Value())
 
 	done := make(chan struct{})
-	locker := &LeaderLocker{lock: lock, done: done}
+	locker := &LeaderLocker{lock: lock, done: done, held: true, expiresAt: lock.Until(), lastRenewal: time.Now()}
 
 	go locker.startRefreshLoop()
 
@@ -36,34 +94,190 @@ func ObtainLeaderLocker() (*LeaderLocker, error) {
 }
 
 func (l *LeaderLocker) startRefreshLoop() {
-	ticker := time.NewTicker(time.Second * 10)
-	defer ticker.Stop()
+	timer := time.NewTimer(leaderLockRefreshPeriod)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			if err := l.refreshLock(); err != nil {
-				logger.Error("Failed to refresh leader locker", "error", err)
+		case <-timer.C:
+			l.mu.Lock()
+			held := l.held
+			l.mu.Unlock()
+
+			if held {
+				timer.Reset(l.refreshLock())
+			} else {
+				timer.Reset(l.reacquireLock())
 			}
-			logger.Debug("Leader locker refreshed", "lock_value", l.lock.Value())
 		case <-l.done:
 			return
 		}
 	}
 }
 
-func (l *LeaderLocker) refreshLock() error {
-	_, err := l.lock.Extend()
-	return err
+// refreshLock extends the lock and returns when the next attempt is due.
+// The leader steps down once the lock is taken by another node or has expired.
+func (l *LeaderLocker) refreshLock() time.Duration {
+	start := time.Now()
+	ok, err := l.lock.Extend()
+	latency := time.Since(start)
+
+	l.mu.Lock()
+	l.lastLatency = latency
+	if latency > l.maxLatency {
+		l.maxLatency = latency
+	}
+	if ok && err == nil {
+		l.renewals++
+		l.totalLatency += latency
+		l.lastRenewal = time.Now()
+		l.expiresAt = l.lock.Until()
+		l.consecutive = 0
+		l.mu.Unlock()
+		logger.Debug("Leader locker refreshed", "lock_value", l.lock.Value(), "latency", latency)
+		return leaderLockRefreshPeriod
+	}
+	l.failures++
+	l.consecutive++
+	consecutive := l.consecutive
+	l.mu.Unlock()
+
+	if err == nil {
+		err = redsync.ErrExtendFailed
+	}
+	if reason, lost := leaderLockLost(err, l.lock.Until()); lost {
+		l.stepDown(reason)
+		return leaderLockReacquirePeriod
+	}
+
+	logger.Warn("Failed to refresh leader locker, retrying", "error", err, "consecutive_failures", consecutive, "expires_at", l.lock.Until())
+	return leaderLockRetryPeriod
+}
+
+// leaderLockLost reports whether a failed extension means the lock is gone,
+// as opposed to a transient Redis error while the lock is still valid
+func leaderLockLost(err error, until time.Time) (string, bool) {
+	var taken *redsync.ErrTaken
+	var nodeTaken *redsync.ErrNodeTaken
+	switch {
+	case errors.As(err, &taken), errors.As(err, &nodeTaken):
+		return "leader lock taken by another node", true
+	case errors.Is(err, redsync.ErrExtendFailed):
+		return "leader lock could not be extended before expiry", true
+	case !time.Now().Before(until):
+		return fmt.Sprintf("leader lock expired: %v", err), true
+	}
+	return "", false
+}
+
+// stepDown stops accepting writes on this node and tells the followers.
+// Running projects are left alone so event processing is not interrupted.
+func (l *LeaderLocker) stepDown(reason string) {
+	l.mu.Lock()
+	l.held = false
+	l.losses++
+	l.lossEvents = append(l.lossEvents, LeaderLockLossEvent{Timestamp: time.Now(), Reason: reason})
+	if len(l.lossEvents) > maxLeaderLockLossEvents {
+		l.lossEvents = l.lossEvents[len(l.lossEvents)-maxLeaderLockLossEvents:]
+	}
+	l.mu.Unlock()
+
+	common.SetLeaderSteppedDown(reason)
+	logger.Error("Leader lock lost, stepping down and rejecting writes", "reason", reason, "node_id", common.GetNodeID())
+
+	stepDown := map[string]interface{}{
+		"action":    "leader_step_down",
+		"leader":    common.GetNodeID(),
+		"reason":    reason,
+		"timestamp": time.Now().Unix(),
+	}
+	if data, err := json.Marshal(stepDown); err == nil {
+		if err := common.RedisPublish("cluster:sync_command", string(data)); err != nil {
+			logger.Warn("Failed to notify followers of leader step down", "error", err)
+		}
+	}
+}
+
+// reacquireLock tries once to take the lock back after a step down
+func (l *LeaderLocker) reacquireLock() time.Duration {
+	lock := newLeaderMutex()
+	if err := lock.TryLock(); err != nil {
+		logger.Debug("Leader lock still unavailable", "error", err)
+		return leaderLockReacquirePeriod
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	l.lock = lock
+	l.held = true
+	l.lastRenewal = now
+	l.expiresAt = lock.Until()
+	l.consecutive = 0
+	l.reacquired++
+	if n := len(l.lossEvents); n > 0 && l.lossEvents[n-1].ReacquiredAt == nil {
+		l.lossEvents[n-1].ReacquiredAt = &now
+	}
+	l.mu.Unlock()
+
+	common.ClearLeaderSteppedDown()
+	logger.Info("Leader lock reacquired, accepting writes again", "lock_value", lock.Value())
+	return leaderLockRefreshPeriod
+}
+
+// Metrics returns a snapshot of the lock state and renewal statistics
+func (l *LeaderLocker) Metrics() LeaderLockMetrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := LeaderLockMetrics{
+		Held:                 l.held,
+		SteppedDown:          !l.held,
+		LastRenewal:          l.lastRenewal,
+		LastRenewalLatencyMs: float64(l.lastLatency.Microseconds()) / 1000,
+		MaxRenewalLatencyMs:  float64(l.maxLatency.Microseconds()) / 1000,
+		Renewals:             l.renewals,
+		RenewalFailures:      l.failures,
+		ConsecutiveFailures:  l.consecutive,
+		LockLosses:           l.losses,
+		Reacquisitions:       l.reacquired,
+		RecentLosses:         append([]LeaderLockLossEvent(nil), l.lossEvents...),
+	}
+	if l.renewals > 0 {
+		m.AvgRenewalLatencyMs = float64(l.totalLatency.Microseconds()) / 1000 / float64(l.renewals)
+	}
+	if l.held {
+		m.ExpiresAt = l.expiresAt
+		if ttl := time.Until(m.ExpiresAt); ttl > 0 {
+			m.TTLSeconds = ttl.Seconds()
+		}
+	}
+	return m
+}
+
+// GetLeaderLockMetrics returns the leader lock metrics of this node, nil when it does not hold a lock
+func GetLeaderLockMetrics() *LeaderLockMetrics {
+	if GlobalClusterManager == nil || GlobalClusterManager.leaderLocker == nil {
+		return nil
+	}
+	m := GlobalClusterManager.leaderLocker.Metrics()
+	return &m
 }
 
 func (l *LeaderLocker) Release() {
 	l.once.Do(func() {
 		close(l.done)
 
-		if _, err := l.lock.Unlock(); err != nil {
+		l.mu.Lock()
+		held, lock := l.held, l.lock
+		l.mu.Unlock()
+		if !held {
+			logger.Debug("Leader locker not held, nothing to release")
+			return
+		}
+
+		if _, err := lock.Unlock(); err != nil {
 			logger.Error("Failed to release leader locker", "error", err)
 		}
-		logger.Debug("Leader locker released", "lock_value", l.lock.Value())
+		logger.Debug("Leader locker released", "lock_value", lock.Value())
 	})
 }
@@ -26,6 +26,9 @@ type SyncListener struct {
 	baseVersion      string
 	executionFlagTTL time.Duration // TTL for execution flag, default 5 minutes
 	mu               sync.RWMutex
+
+	// lastLeaderStepDown is the last leader_step_down notice received from the leader
+	lastLeaderStepDown map[string]interface{}
 }
 
 var GlobalSyncListener *SyncListener
@@ -198,6 +201,11 @@ func (sl *SyncListener) handleSyncCommand(syncCmd map[string]interface{}) {
 	action, _ := syncCmd["action"].(string)
 	leaderVersion, _ := syncCmd["leader_version"].(string)
 
+	if action == "leader_step_down" {
+		sl.handleLeaderStepDown(syncCmd)
+		return
+	}
+
 	// Handle both publish_complete and sync commands
 	if action != "publish_complete" && action != "sync" {
 		return
@@ -213,6 +221,27 @@ func (sl *SyncListener) handleSyncCommand(syncCmd map[string]interface{}) {
 	}
 }
 
+// handleLeaderStepDown records that the leader lost its lock. Followers keep running
+// their projects; instructions resume once a leader publishes again.
+func (sl *SyncListener) handleLeaderStepDown(syncCmd map[string]interface{}) {
+	leader, _ := syncCmd["leader"].(string)
+	if leader == sl.nodeID {
+		return
+	}
+	logger.Warn("Leader stepped down after losing the leader lock", "leader", leader, "reason", syncCmd["reason"])
+
+	sl.mu.Lock()
+	sl.lastLeaderStepDown = syncCmd
+	sl.mu.Unlock()
+}
+
+// GetLastLeaderStepDown returns the last leader step down notice, nil if none was received
+func (sl *SyncListener) GetLastLeaderStepDown() map[string]interface{} {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+	return sl.lastLeaderStepDown
+}
+
 func (sl *SyncListener) SyncInstructions(toVersion string) error {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
@@ -0,0 +1,264 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	firedAlertsKey        = "hub:alerts:all"
+	firedAlertsRulePrefix = "hub:alerts:rule:"
+
+	firedAlertQueueSize    = 10000
+	firedAlertFlushSize    = 500
+	firedAlertFlushEvery   = time.Second
+	maxFiredAlertsPerKey   = 500000 // oldest entries are trimmed beyond this, whatever the retention
+	maxFiredAlertQueryScan = 10000  // entries scanned when filtering a rule by project
+	DefaultFiredAlertLimit = 100
+	MaxFiredAlertLimit     = 1000
+)
+
+// FiredAlert is the metadata of one alert delivered by an output
+type FiredAlert struct {
+	Fingerprint string    `json:"fingerprint"`
+	Rule        string    `json:"rule"`
+	Project     string    `json:"project"`
+	Time        time.Time `json:"time"`
+}
+
+// firedAlertMember is what is stored in the sorted sets, the score holds the time.
+// The same alert delivered by several outputs collapses into one member.
+type firedAlertMember struct {
+	Fingerprint string `json:"f"`
+	Rule        string `json:"r"`
+	Project     string `json:"p"`
+}
+
+// FiredAlertIndex keeps a rolling window of fired alerts in Redis so they can be queried
+// by rule and time range. Alerts are written in batches and dropped rather than slowing down outputs.
+type FiredAlertIndex struct {
+	queue    chan FiredAlert
+	stopChan chan struct{}
+	done     chan struct{}
+
+	recorded uint64
+	dropped  uint64
+}
+
+var GlobalFiredAlertIndex *FiredAlertIndex
+
+// InitFiredAlertIndex starts the global fired alerts index
+func InitFiredAlertIndex() {
+	if GlobalFiredAlertIndex == nil {
+		GlobalFiredAlertIndex = &FiredAlertIndex{
+			queue:    make(chan FiredAlert, firedAlertQueueSize),
+			stopChan: make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		go GlobalFiredAlertIndex.flushLoop()
+	}
+}
+
+// StopFiredAlertIndex writes the queued alerts and stops the global fired alerts index
+func StopFiredAlertIndex() {
+	if GlobalFiredAlertIndex != nil {
+		close(GlobalFiredAlertIndex.stopChan)
+		<-GlobalFiredAlertIndex.done
+		GlobalFiredAlertIndex = nil
+		logger.Info("Fired alert index stopped")
+	}
+}
+
+// RecordFiredAlert indexes an event delivered by an output of a project. Events without
+// _hub_hit_rule_id are not alerts and are ignored, an event hitting several rules is one alert per rule.
+func RecordFiredAlert(project string, msg map[string]interface{}) {
+	idx := GlobalFiredAlertIndex
+	if idx == nil {
+		return
+	}
+	hit, _ := msg["_hub_hit_rule_id"].(string)
+	if hit == "" {
+		return
+	}
+
+	now := time.Now().UTC()
+	fingerprint := alertFingerprint(msg)
+	for _, rule := range strings.Split(hit, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		select {
+		case idx.queue <- FiredAlert{Fingerprint: fingerprint, Rule: rule, Project: project, Time: now}:
+			atomic.AddUint64(&idx.recorded, 1)
+		default:
+			atomic.AddUint64(&idx.dropped, 1)
+		}
+	}
+}
+
+// alertFingerprint identifies an alert by its content, leaving out the metadata that
+// differs between the outputs delivering it
+func alertFingerprint(msg map[string]interface{}) string {
+	content := make(map[string]interface{}, len(msg))
+	for k, v := range msg {
+		if k == "_hub_project_node_sequence" || k == "_hub_output_timestamp" {
+			continue
+		}
+		content[k] = v
+	}
+	// encoding/json sorts map keys, so equal events give equal fingerprints
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// GetStats returns the number of alerts queued for indexing and dropped because the queue was full
+func (idx *FiredAlertIndex) GetStats() (recorded, dropped uint64) {
+	return atomic.LoadUint64(&idx.recorded), atomic.LoadUint64(&idx.dropped)
+}
+
+func (idx *FiredAlertIndex) flushLoop() {
+	defer close(idx.done)
+	ticker := time.NewTicker(firedAlertFlushEvery)
+	defer ticker.Stop()
+
+	batch := make([]FiredAlert, 0, firedAlertFlushSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := writeFiredAlerts(batch); err != nil {
+			logger.Warn("Failed to index fired alerts", "count", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-idx.stopChan:
+			for {
+				select {
+				case a := <-idx.queue:
+					batch = append(batch, a)
+					if len(batch) >= firedAlertFlushSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case a := <-idx.queue:
+			batch = append(batch, a)
+			if len(batch) >= firedAlertFlushSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func writeFiredAlerts(alerts []FiredAlert) error {
+	if rdb == nil {
+		return nil
+	}
+	pipe := GetRedisPipeline()
+	touched := map[string]bool{firedAlertsKey: true}
+	for _, a := range alerts {
+		member, err := json.Marshal(firedAlertMember{Fingerprint: a.Fingerprint, Rule: a.Rule, Project: a.Project})
+		if err != nil {
+			continue
+		}
+		z := redis.Z{Score: float64(a.Time.UnixMilli()), Member: string(member)}
+		ruleKey := firedAlertsRulePrefix + a.Rule
+		pipe.ZAdd(ctx, firedAlertsKey, z)
+		pipe.ZAdd(ctx, ruleKey, z)
+		touched[ruleKey] = true
+	}
+	for key := range touched {
+		pipe.ZRemRangeByRank(ctx, key, 0, -maxFiredAlertsPerKey-1)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// QueryFiredAlerts returns the newest alerts fired between since and until, optionally limited to
+// one rule and/or project. total is the number of matching alerts in the window, which can be
+// larger than the returned page.
+func QueryFiredAlerts(rule, project string, since, until time.Time, limit int) ([]FiredAlert, int64, error) {
+	if limit <= 0 {
+		limit = DefaultFiredAlertLimit
+	}
+	limit = min(limit, MaxFiredAlertLimit)
+
+	key := firedAlertsKey
+	if rule != "" {
+		key = firedAlertsRulePrefix + rule
+	}
+	minScore := strconv.FormatInt(since.UnixMilli(), 10)
+	maxScore := strconv.FormatInt(until.UnixMilli(), 10)
+
+	// Without a project filter Redis does the paging, otherwise a bounded window is filtered here
+	count := int64(limit)
+	if project != "" {
+		count = maxFiredAlertQueryScan
+	}
+	entries, err := RedisReadZRevRangeByScore(key, maxScore, minScore, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	alerts := make([]FiredAlert, 0, min(len(entries), limit))
+	var matched int64
+	for _, z := range entries {
+		s, _ := z.Member.(string)
+		var m firedAlertMember
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			continue
+		}
+		if project != "" && m.Project != project {
+			continue
+		}
+		matched++
+		if len(alerts) < limit {
+			alerts = append(alerts, FiredAlert{
+				Fingerprint: m.Fingerprint,
+				Rule:        m.Rule,
+				Project:     m.Project,
+				Time:        time.UnixMilli(int64(z.Score)).UTC(),
+			})
+		}
+	}
+
+	if project != "" {
+		return alerts, matched, nil
+	}
+	total, err := RedisReadZCount(key, minScore, maxScore)
+	if err != nil {
+		return alerts, int64(len(alerts)), nil
+	}
+	return alerts, total, nil
+}
+
+// retainFiredAlerts removes alerts older than the cutoff from the fired alert sorted sets
+func retainFiredAlerts(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	keys, err := RedisKeys(firedAlertsRulePrefix + "*")
+	if err != nil {
+		return err
+	}
+	keys = append(keys, firedAlertsKey)
+	return retainScoredKeys(keys, strconv.FormatInt(cutoff.UnixMilli(), 10), dryRun, r)
+}
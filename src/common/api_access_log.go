@@ -0,0 +1,285 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	AccessLogPlain    = "plain"
+	AccessLogHash     = "hash"     // identity only, first 16 hex characters of its SHA-256
+	AccessLogTruncate = "truncate" // remote_ip only, last octet (IPv4) or last 80 bits (IPv6) zeroed
+	AccessLogOmit     = "omit"
+
+	apiAccessRedacted = "REDACTED"
+)
+
+// defaultAccessLogRedactParams are query parameters whose values never reach the access log
+var defaultAccessLogRedactParams = []string{"token", "password", "secret", "api_key", "apikey", "access_token", "id_token", "code"}
+
+// APIAccessLogConfig controls what the API access log records about a request
+type APIAccessLogConfig struct {
+	Identity     string   `yaml:"identity,omitempty"`      // plain (default), hash or omit
+	RemoteIP     string   `yaml:"remote_ip,omitempty"`     // plain (default), truncate or omit
+	UserAgent    *bool    `yaml:"user_agent,omitempty"`    // default true
+	RedactParams []string `yaml:"redact_params,omitempty"` // query parameters whose values are replaced, added to the defaults
+	SkipPaths    []string `yaml:"skip_paths,omitempty"`    // routes that are not logged, e.g. /ping
+}
+
+// Validate checks an access log config
+func (c *APIAccessLogConfig) Validate() error {
+	switch c.Identity {
+	case "", AccessLogPlain, AccessLogHash, AccessLogOmit:
+	default:
+		return fmt.Errorf("invalid api_access_log.identity %q, must be %s, %s or %s", c.Identity, AccessLogPlain, AccessLogHash, AccessLogOmit)
+	}
+	switch c.RemoteIP {
+	case "", AccessLogPlain, AccessLogTruncate, AccessLogOmit:
+	default:
+		return fmt.Errorf("invalid api_access_log.remote_ip %q, must be %s, %s or %s", c.RemoteIP, AccessLogPlain, AccessLogTruncate, AccessLogOmit)
+	}
+	return nil
+}
+
+// APIAccessRecord is one API request as recorded by the access log
+type APIAccessRecord struct {
+	Time      string
+	RequestID string
+	Method    string
+	Route     string // registered route, e.g. /rulesets/:id
+	URI       string
+	Status    int
+	LatencyMs float64
+	BytesIn   int64
+	BytesOut  int64
+	Identity  string
+	AuthType  string // token, oidc or none
+	RemoteIP  string
+	UserAgent string
+	Error     string
+}
+
+// APIAccessLogger applies the redaction settings and fans records out to the access log inputs
+type APIAccessLogger struct {
+	identity  string
+	remoteIP  string
+	userAgent bool
+	redact    map[string]bool
+	skip      map[string]bool
+}
+
+// NewAPIAccessLogger creates an access logger, cfg may be nil
+func NewAPIAccessLogger(cfg *APIAccessLogConfig) *APIAccessLogger {
+	l := &APIAccessLogger{
+		identity:  AccessLogPlain,
+		remoteIP:  AccessLogPlain,
+		userAgent: true,
+		redact:    make(map[string]bool),
+		skip:      make(map[string]bool),
+	}
+	for _, p := range defaultAccessLogRedactParams {
+		l.redact[p] = true
+	}
+	if cfg == nil {
+		return l
+	}
+	if cfg.Identity != "" {
+		l.identity = cfg.Identity
+	}
+	if cfg.RemoteIP != "" {
+		l.remoteIP = cfg.RemoteIP
+	}
+	if cfg.UserAgent != nil {
+		l.userAgent = *cfg.UserAgent
+	}
+	for _, p := range cfg.RedactParams {
+		l.redact[strings.ToLower(p)] = true
+	}
+	for _, p := range cfg.SkipPaths {
+		l.skip[p] = true
+	}
+	return l
+}
+
+// Skip reports whether a route is not logged
+func (l *APIAccessLogger) Skip(route string) bool {
+	return l.skip[route]
+}
+
+// Event redacts a record and returns it as an access log event
+func (l *APIAccessLogger) Event(r *APIAccessRecord) map[string]interface{} {
+	event := map[string]interface{}{
+		"time":       r.Time,
+		"id":         r.RequestID,
+		"method":     r.Method,
+		"route":      r.Route,
+		"uri":        l.redactURI(r.URI),
+		"status":     r.Status,
+		"latency_ms": r.LatencyMs,
+		"bytes_in":   r.BytesIn,
+		"bytes_out":  r.BytesOut,
+		"auth_type":  r.AuthType,
+		"node_id":    GetNodeID(),
+	}
+	if r.Error != "" {
+		event["error"] = truncateRunes(r.Error, 512)
+	}
+	switch l.identity {
+	case AccessLogPlain:
+		event["identity"] = r.Identity
+	case AccessLogHash:
+		if r.Identity != "" {
+			sum := sha256.Sum256([]byte(r.Identity))
+			event["identity"] = hex.EncodeToString(sum[:])[:16]
+		}
+	}
+	switch l.remoteIP {
+	case AccessLogPlain:
+		event["remote_ip"] = r.RemoteIP
+	case AccessLogTruncate:
+		event["remote_ip"] = truncateIP(r.RemoteIP)
+	}
+	if l.userAgent {
+		event["user_agent"] = r.UserAgent
+	}
+	return event
+}
+
+// redactURI replaces the values of sensitive query parameters
+func (l *APIAccessLogger) redactURI(uri string) string {
+	path, query, found := strings.Cut(uri, "?")
+	if !found || query == "" {
+		return uri
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		// Do not risk logging a value that could not be parsed
+		return path + "?" + apiAccessRedacted
+	}
+	changed := false
+	for k := range values {
+		if l.redact[strings.ToLower(k)] {
+			values[k] = []string{apiAccessRedacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return uri
+	}
+	return path + "?" + values.Encode()
+}
+
+func truncateIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+var (
+	apiAccessSubsMu sync.RWMutex
+	apiAccessSubs   = make(map[string]*APIAccessLogReader)
+)
+
+// PublishAPIAccessEvent passes an access log event to the access log inputs running on this node
+func PublishAPIAccessEvent(event map[string]interface{}) {
+	apiAccessSubsMu.RLock()
+	defer apiAccessSubsMu.RUnlock()
+	for _, r := range apiAccessSubs {
+		r.offer(event)
+	}
+}
+
+// APIAccessLogReader feeds the API access log of this node into an input
+type APIAccessLogReader struct {
+	InputID string
+	MsgChan chan map[string]interface{}
+
+	writesOnly bool
+	prefixes   []string
+
+	readTotal    uint64
+	droppedTotal uint64
+}
+
+// NewAPIAccessLogReader creates a reader. With writesOnly only requests changing state are passed on,
+// prefixes limits the routes when not empty.
+func NewAPIAccessLogReader(inputID string, writesOnly bool, prefixes []string, msgChan chan map[string]interface{}) *APIAccessLogReader {
+	return &APIAccessLogReader{
+		InputID:    inputID,
+		MsgChan:    msgChan,
+		writesOnly: writesOnly,
+		prefixes:   prefixes,
+	}
+}
+
+// Start subscribes the reader to the access log
+func (r *APIAccessLogReader) Start() {
+	apiAccessSubsMu.Lock()
+	apiAccessSubs[r.InputID] = r
+	apiAccessSubsMu.Unlock()
+}
+
+// Close unsubscribes the reader
+func (r *APIAccessLogReader) Close() {
+	apiAccessSubsMu.Lock()
+	if apiAccessSubs[r.InputID] == r {
+		delete(apiAccessSubs, r.InputID)
+	}
+	apiAccessSubsMu.Unlock()
+}
+
+// offer never blocks the API, events are dropped while the input is behind
+func (r *APIAccessLogReader) offer(event map[string]interface{}) {
+	if r.writesOnly {
+		switch event["method"] {
+		case "GET", "HEAD", "OPTIONS":
+			return
+		}
+	}
+	if len(r.prefixes) > 0 {
+		route, _ := event["route"].(string)
+		matched := false
+		for _, p := range r.prefixes {
+			if strings.HasPrefix(route, p) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+
+	// Every input gets its own copy since the pipeline modifies events
+	msg := make(map[string]interface{}, len(event))
+	for k, v := range event {
+		msg[k] = v
+	}
+	select {
+	case r.MsgChan <- msg:
+		atomic.AddUint64(&r.readTotal, 1)
+	default:
+		atomic.AddUint64(&r.droppedTotal, 1)
+	}
+}
+
+// GetReadTotal returns the number of access log events passed to the input
+func (r *APIAccessLogReader) GetReadTotal() uint64 {
+	return atomic.LoadUint64(&r.readTotal)
+}
+
+// GetDroppedTotal returns the number of access log events dropped because the input was behind
+func (r *APIAccessLogReader) GetDroppedTotal() uint64 {
+	return atomic.LoadUint64(&r.droppedTotal)
+}
@@ -0,0 +1,745 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditLogProvider identifies a SaaS audit log API
+type AuditLogProvider string
+
+const (
+	AuditLogProviderOkta            AuditLogProvider = "okta"
+	AuditLogProviderGoogleWorkspace AuditLogProvider = "google_workspace"
+	AuditLogProviderGitHub          AuditLogProvider = "github"
+)
+
+const (
+	auditLogCursorKeyPrefix = "hub:input_cursor:"
+	auditLogLockKeyPrefix   = "input_puller:"
+	auditLogMaxBackoff      = 5 * time.Minute
+	auditLogMaxRetries      = 8
+)
+
+// AuditLogPullerConfig holds the settings shared by all audit log providers
+type AuditLogPullerConfig struct {
+	Provider     AuditLogProvider
+	PollInterval time.Duration
+	PageSize     int
+	Lookback     time.Duration // How far back to start when no cursor is stored
+
+	// Okta
+	Domain string
+	// Okta and GitHub
+	Token string
+	// GitHub
+	Organization string
+	Enterprise   string
+	// Google Workspace
+	ServiceAccountFile string
+	ServiceAccountJSON string
+	Subject            string // Admin user to impersonate
+	Application        string // Reports API application name, e.g. login, admin, drive
+}
+
+// auditLogCursor is persisted in Redis so that pulling resumes where it stopped after restarts
+type auditLogCursor struct {
+	Time time.Time `json:"time"`
+	IDs  []string  `json:"ids,omitempty"`  // IDs of events already emitted at Time
+	Next string    `json:"next,omitempty"` // Provider polling URL, used by Okta
+}
+
+type auditLogPage struct {
+	events []map[string]interface{}
+	next   string
+}
+
+// auditLogSource implements the provider-specific part of an audit log puller
+type auditLogSource interface {
+	firstRequest(cursor *auditLogCursor, pageSize int) (*http.Request, error)
+	nextRequest(next string) (*http.Request, error)
+	parse(resp *http.Response) (*auditLogPage, error)
+	eventKey(event map[string]interface{}) (time.Time, string)
+	// ascending reports whether pages are returned oldest first, which allows the cursor to be saved per page
+	ascending() bool
+	authorize(req *http.Request) error
+}
+
+// AuditLogPuller periodically pulls SaaS audit logs and forwards them to MsgChan
+type AuditLogPuller struct {
+	InputID string
+	MsgChan chan map[string]interface{}
+
+	cfg    AuditLogPullerConfig
+	source auditLogSource
+	client *http.Client
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	pulledTotal uint64
+	rateLimited uint64
+}
+
+// NewAuditLogPuller creates a puller for the given provider
+func NewAuditLogPuller(inputID string, cfg AuditLogPullerConfig, msgChan chan map[string]interface{}) (*AuditLogPuller, error) {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 100
+	}
+	if cfg.Lookback <= 0 {
+		cfg.Lookback = time.Hour
+	}
+
+	source, err := newAuditLogSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLogPuller{
+		InputID:  inputID,
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		source:   source,
+		client:   &http.Client{Timeout: 60 * time.Second},
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+func newAuditLogSource(cfg AuditLogPullerConfig) (auditLogSource, error) {
+	switch cfg.Provider {
+	case AuditLogProviderOkta:
+		if cfg.Domain == "" || cfg.Token == "" {
+			return nil, fmt.Errorf("okta audit log requires domain and token")
+		}
+		return &oktaSource{domain: strings.TrimSuffix(cfg.Domain, "/"), token: cfg.Token}, nil
+	case AuditLogProviderGitHub:
+		if cfg.Token == "" || (cfg.Organization == "" && cfg.Enterprise == "") {
+			return nil, fmt.Errorf("github audit log requires token and organization or enterprise")
+		}
+		return &githubSource{org: cfg.Organization, enterprise: cfg.Enterprise, token: cfg.Token}, nil
+	case AuditLogProviderGoogleWorkspace:
+		keyJSON := cfg.ServiceAccountJSON
+		if keyJSON == "" && cfg.ServiceAccountFile != "" {
+			data, err := os.ReadFile(cfg.ServiceAccountFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read service account file: %w", err)
+			}
+			keyJSON = string(data)
+		}
+		if keyJSON == "" || cfg.Subject == "" {
+			return nil, fmt.Errorf("google workspace audit log requires service account credentials and subject")
+		}
+		tokenSource, err := newGoogleTokenSource(keyJSON, cfg.Subject, "https://www.googleapis.com/auth/admin.reports.audit.readonly")
+		if err != nil {
+			return nil, err
+		}
+		app := cfg.Application
+		if app == "" {
+			app = "login"
+		}
+		return &googleSource{application: app, tokens: tokenSource}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit log provider: %s", cfg.Provider)
+	}
+}
+
+// Start begins periodic polling
+func (p *AuditLogPuller) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in audit log puller", "input", p.InputID, "panic", r)
+			}
+		}()
+
+		ticker := time.NewTicker(p.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			p.pollWithLock()
+			select {
+			case <-p.stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops polling and waits for the current poll to finish
+func (p *AuditLogPuller) Close() {
+	select {
+	case <-p.stopChan:
+	default:
+		close(p.stopChan)
+	}
+	p.wg.Wait()
+}
+
+// GetPulledTotal returns the number of events pulled since start
+func (p *AuditLogPuller) GetPulledTotal() uint64 {
+	return atomic.LoadUint64(&p.pulledTotal)
+}
+
+// GetRateLimitedTotal returns how many times the provider answered with a rate limit
+func (p *AuditLogPuller) GetRateLimitedTotal() uint64 {
+	return atomic.LoadUint64(&p.rateLimited)
+}
+
+// pollWithLock makes sure that only one node in the cluster pulls a given input at a time
+func (p *AuditLogPuller) pollWithLock() {
+	lock := NewDistributedLock(auditLogLockKeyPrefix+p.InputID, p.cfg.PollInterval+5*time.Minute)
+	if err := lock.Acquire(); err != nil {
+		logger.Debug("Audit log puller lock held by another node, skipping poll", "input", p.InputID)
+		return
+	}
+	defer func() { _ = lock.Release() }()
+
+	if err := p.poll(); err != nil {
+		logger.Warn("Audit log poll failed", "input", p.InputID, "provider", p.cfg.Provider, "error", err)
+	}
+}
+
+func (p *AuditLogPuller) poll() error {
+	cursor := p.loadCursor()
+
+	req, err := p.source.firstRequest(cursor, p.cfg.PageSize)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(cursor.IDs))
+	for _, id := range cursor.IDs {
+		seen[id] = true
+	}
+	pending := *cursor
+
+	for req != nil {
+		page, err := p.doWithBackoff(req)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range page.events {
+			ts, id := p.source.eventKey(event)
+			if id != "" && seen[id] {
+				continue
+			}
+			if !ts.IsZero() && ts.Before(cursor.Time) {
+				continue
+			}
+			if !p.emit(event) {
+				return nil
+			}
+			atomic.AddUint64(&p.pulledTotal, 1)
+
+			if ts.After(pending.Time) {
+				pending.Time = ts
+				pending.IDs = pending.IDs[:0]
+			}
+			if ts.Equal(pending.Time) && id != "" {
+				pending.IDs = append(pending.IDs, id)
+			}
+		}
+
+		if p.source.ascending() {
+			if page.next != "" {
+				pending.Next = page.next
+			}
+			p.saveCursor(&pending)
+		}
+
+		// An empty page ends the poll; polling URLs such as Okta's always carry a next link
+		if page.next == "" || len(page.events) == 0 {
+			break
+		}
+		req, err = p.source.nextRequest(page.next)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.source.ascending() {
+		p.saveCursor(&pending)
+	}
+	return nil
+}
+
+// emit forwards one event, returning false if the puller is stopping
+func (p *AuditLogPuller) emit(event map[string]interface{}) bool {
+	event["_hub_audit_provider"] = string(p.cfg.Provider)
+	select {
+	case p.MsgChan <- event:
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
+
+// doWithBackoff executes a request, backing off on HTTP 429 and rate-limit responses
+func (p *AuditLogPuller) doWithBackoff(req *http.Request) (*auditLogPage, error) {
+	backoff := time.Second
+	for attempt := 0; attempt < auditLogMaxRetries; attempt++ {
+		if err := p.source.authorize(req); err != nil {
+			return nil, err
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			if !p.sleep(backoff) {
+				return nil, fmt.Errorf("puller stopped")
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		if wait, limited := rateLimitWait(resp); limited {
+			resp.Body.Close()
+			atomic.AddUint64(&p.rateLimited, 1)
+			if wait <= 0 {
+				wait = backoff
+				backoff = nextBackoff(backoff)
+			}
+			logger.Warn("Audit log API rate limited, backing off", "input", p.InputID, "provider", p.cfg.Provider, "wait", wait)
+			if !p.sleep(wait) {
+				return nil, fmt.Errorf("puller stopped")
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			if !p.sleep(backoff) {
+				return nil, fmt.Errorf("puller stopped")
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("audit log API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		page, err := p.source.parse(resp)
+		resp.Body.Close()
+		return page, err
+	}
+	return nil, fmt.Errorf("audit log API request failed after %d attempts", auditLogMaxRetries)
+}
+
+func (p *AuditLogPuller) sleep(d time.Duration) bool {
+	if d > auditLogMaxBackoff {
+		d = auditLogMaxBackoff
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
+
+func nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > auditLogMaxBackoff {
+		return auditLogMaxBackoff
+	}
+	return d
+}
+
+// rateLimitWait detects rate-limit responses and how long the provider asks us to wait
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	// GitHub signals exhausted primary rate limits with 403
+	if resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		limited = true
+	}
+	if !limited {
+		return 0, false
+	}
+
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(ra); err == nil {
+			return time.Until(t), true
+		}
+	}
+	for _, h := range []string{"X-Rate-Limit-Reset", "X-RateLimit-Reset"} {
+		if reset := resp.Header.Get(h); reset != "" {
+			if epoch, err := strconv.ParseInt(reset, 10, 64); err == nil {
+				return time.Until(time.Unix(epoch, 0)) + time.Second, true
+			}
+		}
+	}
+	return 0, true
+}
+
+func (p *AuditLogPuller) loadCursor() *auditLogCursor {
+	cursor := &auditLogCursor{}
+	raw, err := RedisGet(auditLogCursorKeyPrefix + p.InputID)
+	if err == nil && raw != "" {
+		if err := json.Unmarshal([]byte(raw), cursor); err == nil {
+			return cursor
+		}
+		logger.Warn("Invalid audit log cursor in Redis, starting from lookback", "input", p.InputID)
+	}
+	cursor.Time = time.Now().UTC().Add(-p.cfg.Lookback)
+	return cursor
+}
+
+func (p *AuditLogPuller) saveCursor(cursor *auditLogCursor) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return
+	}
+	if _, err := RedisSet(auditLogCursorKeyPrefix+p.InputID, string(data), 0); err != nil {
+		logger.Warn("Failed to persist audit log cursor", "input", p.InputID, "error", err)
+	}
+}
+
+// ResetAuditLogCursor removes the stored cursor of an input so the next poll starts from the lookback window
+func ResetAuditLogCursor(inputID string) error {
+	return RedisDel(auditLogCursorKeyPrefix + inputID)
+}
+
+// TestAuditLogConnection performs a single small request against the provider API
+func TestAuditLogConnection(cfg AuditLogPullerConfig) error {
+	source, err := newAuditLogSource(cfg)
+	if err != nil {
+		return err
+	}
+	req, err := source.firstRequest(&auditLogCursor{Time: time.Now().UTC().Add(-time.Minute)}, 1)
+	if err != nil {
+		return err
+	}
+	if err := source.authorize(req); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, limited := rateLimitWait(resp); limited {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("audit log API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+func parseLinkNext(header string) string {
+	if m := linkNextRegex.FindStringSubmatch(header); len(m) == 2 {
+		return m[1]
+	}
+	return ""
+}
+
+func decodeEventArray(body io.Reader) ([]map[string]interface{}, error) {
+	var events []map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to decode audit log response: %w", err)
+	}
+	return events, nil
+}
+
+// ===================== Okta =====================
+
+type oktaSource struct {
+	domain string
+	token  string
+}
+
+func (s *oktaSource) firstRequest(cursor *auditLogCursor, pageSize int) (*http.Request, error) {
+	if cursor.Next != "" {
+		return http.NewRequest(http.MethodGet, cursor.Next, nil)
+	}
+	q := url.Values{}
+	q.Set("since", cursor.Time.UTC().Format(time.RFC3339))
+	q.Set("sortOrder", "ASCENDING")
+	q.Set("limit", strconv.Itoa(pageSize))
+	return http.NewRequest(http.MethodGet, "https://"+strings.TrimPrefix(s.domain, "https://")+"/api/v1/logs?"+q.Encode(), nil)
+}
+
+func (s *oktaSource) nextRequest(next string) (*http.Request, error) {
+	return http.NewRequest(http.MethodGet, next, nil)
+}
+
+func (s *oktaSource) parse(resp *http.Response) (*auditLogPage, error) {
+	events, err := decodeEventArray(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogPage{events: events, next: parseLinkNext(resp.Header.Get("Link"))}, nil
+}
+
+func (s *oktaSource) eventKey(event map[string]interface{}) (time.Time, string) {
+	published, _ := event["published"].(string)
+	id, _ := event["uuid"].(string)
+	ts, _ := time.Parse(time.RFC3339Nano, published)
+	return ts, id
+}
+
+func (s *oktaSource) ascending() bool { return true }
+
+func (s *oktaSource) authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "SSWS "+s.token)
+	req.Header.Set("Accept", "application/json")
+	return nil
+}
+
+// ===================== GitHub =====================
+
+type githubSource struct {
+	org        string
+	enterprise string
+	token      string
+}
+
+func (s *githubSource) firstRequest(cursor *auditLogCursor, pageSize int) (*http.Request, error) {
+	base := "https://api.github.com/orgs/" + url.PathEscape(s.org) + "/audit-log"
+	if s.enterprise != "" {
+		base = "https://api.github.com/enterprises/" + url.PathEscape(s.enterprise) + "/audit-log"
+	}
+	q := url.Values{}
+	q.Set("phrase", "created:>="+cursor.Time.UTC().Format("2006-01-02T15:04:05Z"))
+	q.Set("order", "asc")
+	q.Set("include", "all")
+	q.Set("per_page", strconv.Itoa(pageSize))
+	return http.NewRequest(http.MethodGet, base+"?"+q.Encode(), nil)
+}
+
+func (s *githubSource) nextRequest(next string) (*http.Request, error) {
+	return http.NewRequest(http.MethodGet, next, nil)
+}
+
+func (s *githubSource) parse(resp *http.Response) (*auditLogPage, error) {
+	events, err := decodeEventArray(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogPage{events: events, next: parseLinkNext(resp.Header.Get("Link"))}, nil
+}
+
+func (s *githubSource) eventKey(event map[string]interface{}) (time.Time, string) {
+	id, _ := event["_document_id"].(string)
+	var ts time.Time
+	if ms, ok := event["@timestamp"].(float64); ok {
+		ts = time.UnixMilli(int64(ms)).UTC()
+	}
+	return ts, id
+}
+
+func (s *githubSource) ascending() bool { return true }
+
+func (s *githubSource) authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return nil
+}
+
+// ===================== Google Workspace =====================
+
+type googleSource struct {
+	application string
+	tokens      *googleTokenSource
+}
+
+func (s *googleSource) firstRequest(cursor *auditLogCursor, pageSize int) (*http.Request, error) {
+	q := url.Values{}
+	q.Set("startTime", cursor.Time.UTC().Format(time.RFC3339Nano))
+	q.Set("maxResults", strconv.Itoa(pageSize))
+	return http.NewRequest(http.MethodGet, s.baseURL()+"?"+q.Encode(), nil)
+}
+
+func (s *googleSource) baseURL() string {
+	return "https://admin.googleapis.com/admin/reports/v1/activity/users/all/applications/" + url.PathEscape(s.application)
+}
+
+// nextRequest receives the full URL built by parse, since Google returns only a page token
+func (s *googleSource) nextRequest(next string) (*http.Request, error) {
+	return http.NewRequest(http.MethodGet, next, nil)
+}
+
+func (s *googleSource) parse(resp *http.Response) (*auditLogPage, error) {
+	var body struct {
+		Items         []map[string]interface{} `json:"items"`
+		NextPageToken string                   `json:"nextPageToken"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode audit log response: %w", err)
+	}
+	page := &auditLogPage{events: body.Items}
+	if body.NextPageToken != "" {
+		q := resp.Request.URL.Query()
+		q.Set("pageToken", body.NextPageToken)
+		page.next = s.baseURL() + "?" + q.Encode()
+	}
+	return page, nil
+}
+
+func (s *googleSource) eventKey(event map[string]interface{}) (time.Time, string) {
+	id, _ := event["id"].(map[string]interface{})
+	if id == nil {
+		return time.Time{}, ""
+	}
+	t, _ := id["time"].(string)
+	ts, _ := time.Parse(time.RFC3339Nano, t)
+	var uq string
+	switch v := id["uniqueQualifier"].(type) {
+	case string:
+		uq = v
+	case float64:
+		uq = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ts, t + "/" + uq
+}
+
+// Reports API returns newest events first
+func (s *googleSource) ascending() bool { return false }
+
+func (s *googleSource) authorize(req *http.Request) error {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// googleTokenSource exchanges a service account JWT for an access token, impersonating subject
+// through domain-wide delegation when it is set
+type googleTokenSource struct {
+	email    string
+	tokenURI string
+	subject  string
+	scope    string
+	key      *rsa.PrivateKey
+	client   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newGoogleTokenSource(keyJSON, subject, scope string) (*googleTokenSource, error) {
+	var sa struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal([]byte(keyJSON), &sa); err != nil {
+		return nil, fmt.Errorf("invalid service account json: %w", err)
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not RSA")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &googleTokenSource{
+		email:    sa.ClientEmail,
+		tokenURI: sa.TokenURI,
+		subject:  subject,
+		scope:    scope,
+		key:      key,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Token returns a cached access token, refreshing it shortly before expiry
+func (g *googleTokenSource) Token() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.expires.Add(-time.Minute)) {
+		return g.token, nil
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claimSet := map[string]interface{}{
+		"iss":   g.email,
+		"scope": g.scope,
+		"aud":   g.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if g.subject != "" {
+		claimSet["sub"] = g.subject
+	}
+	claims, _ := json.Marshal(claimSet)
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign service account assertion: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", signingInput+"."+base64.RawURLEncoding.EncodeToString(sig))
+	resp, err := g.client.Post(g.tokenURI, "application/x-www-form-urlencoded", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain google access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to decode google token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", fmt.Errorf("google token request failed (%d): %s", resp.StatusCode, tok.Error)
+	}
+
+	g.token = tok.AccessToken
+	g.expires = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return g.token, nil
+}
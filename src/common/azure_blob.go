@@ -0,0 +1,206 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureBlobAPIVersion = "2021-08-06"
+
+// AzureBlobConfig holds the account and credentials of an Azure Blob Storage account.
+// Either account_key (Shared Key) or sas_token is required, empty values fall back to
+// the AZURE_STORAGE_KEY and AZURE_STORAGE_SAS_TOKEN environment variables.
+type AzureBlobConfig struct {
+	AccountName string `yaml:"account_name" json:"account_name"`
+	AccountKey  string `yaml:"account_key,omitempty" json:"account_key,omitempty"`
+	SASToken    string `yaml:"sas_token,omitempty" json:"sas_token,omitempty"`
+	Endpoint    string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"` // default https://<account>.blob.core.windows.net
+}
+
+// AzureBlobClient is a minimal Blob Storage client for block blob uploads
+type AzureBlobClient struct {
+	cfg    AzureBlobConfig
+	key    []byte
+	client *http.Client
+}
+
+// NewAzureBlobClient creates a Blob Storage client, filling missing credentials from the environment
+func NewAzureBlobClient(cfg AzureBlobConfig) (*AzureBlobClient, error) {
+	if cfg.AccountName == "" {
+		cfg.AccountName = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	}
+	if cfg.AccountName == "" {
+		return nil, fmt.Errorf("azure storage account_name not configured")
+	}
+	if cfg.AccountKey == "" && cfg.SASToken == "" {
+		cfg.AccountKey = os.Getenv("AZURE_STORAGE_KEY")
+		cfg.SASToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+	c := &AzureBlobClient{cfg: cfg, client: &http.Client{Timeout: 5 * time.Minute}}
+	switch {
+	case cfg.AccountKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure storage account_key: %w", err)
+		}
+		c.key = key
+	case cfg.SASToken != "":
+		c.cfg.SASToken = strings.TrimPrefix(cfg.SASToken, "?")
+	default:
+		return nil, fmt.Errorf("azure storage credentials not configured, set account_key or sas_token")
+	}
+	return c, nil
+}
+
+func (c *AzureBlobClient) blobURL(container, blob string, query url.Values) (*url.URL, error) {
+	endpoint := c.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + c.cfg.AccountName + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure blob endpoint: %w", err)
+	}
+	u.Path += "/" + container
+	if blob != "" {
+		u.Path += "/" + blob
+	}
+	u.RawPath = s3EscapePath(u.Path)
+
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.key == nil {
+		sas, err := url.ParseQuery(c.cfg.SASToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure sas_token: %w", err)
+		}
+		for k, v := range sas {
+			query[k] = v
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// PutBlob uploads body as a block blob, headers (content type, encryption scope) are sent with the request
+func (c *AzureBlobClient) PutBlob(ctx context.Context, container, blob string, body []byte, headers map[string]string) error {
+	u, err := c.blobURL(container, blob, nil)
+	if err != nil {
+		return err
+	}
+	h := map[string]string{"x-ms-blob-type": "BlockBlob"}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return c.do(ctx, http.MethodPut, u, body, h)
+}
+
+// CheckContainer verifies that the container exists and the credentials can access it
+func (c *AzureBlobClient) CheckContainer(ctx context.Context, container string) error {
+	q := url.Values{}
+	q.Set("restype", "container")
+	q.Set("comp", "list")
+	q.Set("maxresults", "1")
+	u, err := c.blobURL(container, "", q)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodGet, u, nil, nil)
+}
+
+func (c *AzureBlobClient) do(ctx context.Context, method string, u *url.URL, body []byte, headers map[string]string) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureBlobAPIVersion)
+	if c.key != nil {
+		c.sign(req, len(body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("azure blob %s %s failed with status %d: %s", method, u.Path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// sign adds a Shared Key Authorization header to req
+func (c *AzureBlobClient) sign(req *http.Request, contentLength int) {
+	length := ""
+	if contentLength > 0 {
+		length = strconv.Itoa(contentLength)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + c.cfg.AccountName + req.URL.EscapedPath()
+	query := make(map[string][]string)
+	for k, v := range req.URL.Query() {
+		query[strings.ToLower(k)] = append(query[strings.ToLower(k)], v...)
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		resource += "\n" + k + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+	}, "\n") + "\n" + resource
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+c.cfg.AccountName+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
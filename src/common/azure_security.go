@@ -0,0 +1,500 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Microsoft security destinations
+const (
+	AzureSecuritySentinel = "sentinel"       // Log Analytics workspace through the Logs Ingestion API
+	AzureSecurityGraph    = "graph_security" // Microsoft Graph Security alerts
+)
+
+const (
+	defaultAzureAuthorityHost = "https://login.microsoftonline.com"
+	defaultGraphSecurityURL   = "https://graph.microsoft.com/v1.0/security/alerts"
+	azureMonitorScope         = "https://monitor.azure.com/.default"
+	graphScope                = "https://graph.microsoft.com/.default"
+	logsIngestionAPIVersion   = "2023-01-01"
+	defaultGraphAlertSeverity = "medium"
+	defaultAzureBatchSize     = 500
+	defaultAzureFlushInterval = time.Second
+	maxLogsIngestionBody      = 1000000 // the API accepts up to 1MB per call
+	maxGraphAlertTitle        = 256
+	maxGraphAlertDescription  = 10000
+	azureRetryAfterMaxSec     = 60
+	azureSecurityVendor       = "AgentSmith-HUB"
+)
+
+// graphAlertSeverities are the severities of a Graph Security alert
+var graphAlertSeverities = map[string]bool{"high": true, "medium": true, "low": true, "informational": true}
+
+// AzureSecurityConfig holds the settings of a Sentinel or Graph Security producer. Both authenticate
+// as an Entra ID (AAD) application with client credentials.
+type AzureSecurityConfig struct {
+	Provider      string
+	TenantID      string
+	ClientID      string
+	ClientSecret  string
+	AuthorityHost string // default https://login.microsoftonline.com, set for sovereign clouds
+
+	// sentinel
+	Endpoint string // data collection endpoint, e.g. https://hub-dce.westeurope-1.ingest.monitor.azure.com
+	RuleID   string // immutable id of the data collection rule, dcr-...
+	Stream   string // stream declared by the rule, e.g. Custom-HubAlerts_CL
+
+	// graph_security
+	URL             string            // alerts endpoint, default https://graph.microsoft.com/v1.0/security/alerts
+	SummaryField    string            // event field used as alert title
+	SeverityField   string            // event field holding the detection severity
+	SeverityMap     map[string]string // detection severity -> high, medium, low or informational
+	DefaultSeverity string            // default medium
+	Category        string            // alert category, default the matched rule id
+
+	BatchSize     int // sentinel only, events per request
+	FlushInterval time.Duration
+	MaxRetries    int
+	Timeout       time.Duration
+	HTTP          *OutputHTTPConfig // TLS and proxy of the client
+}
+
+// Validate checks the settings and fills in the defaults
+func (cfg *AzureSecurityConfig) Validate() error {
+	if cfg.TenantID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return fmt.Errorf("%s tenant_id, client_id and client_secret are required", cfg.Provider)
+	}
+	if cfg.AuthorityHost == "" {
+		cfg.AuthorityHost = defaultAzureAuthorityHost
+	}
+	cfg.AuthorityHost = strings.TrimRight(cfg.AuthorityHost, "/")
+	switch cfg.Provider {
+	case AzureSecuritySentinel:
+		if cfg.Endpoint == "" || cfg.RuleID == "" || cfg.Stream == "" {
+			return fmt.Errorf("sentinel endpoint, dcr_immutable_id and stream are required")
+		}
+		if u, err := url.Parse(cfg.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid sentinel endpoint %q, expected an https URL", cfg.Endpoint)
+		}
+		cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	case AzureSecurityGraph:
+		if cfg.URL == "" {
+			cfg.URL = defaultGraphSecurityURL
+		}
+		if u, err := url.Parse(cfg.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid graph_security url %q, expected an https URL", cfg.URL)
+		}
+		if cfg.DefaultSeverity == "" {
+			cfg.DefaultSeverity = defaultGraphAlertSeverity
+		}
+		if !graphAlertSeverities[cfg.DefaultSeverity] {
+			return fmt.Errorf("invalid default_severity %q, expected high, medium, low or informational", cfg.DefaultSeverity)
+		}
+	default:
+		return fmt.Errorf("unsupported azure security provider: %s", cfg.Provider)
+	}
+	return nil
+}
+
+// scope returns the OAuth scope of the destination API
+func (cfg *AzureSecurityConfig) scope() string {
+	if cfg.Provider == AzureSecurityGraph {
+		return graphScope
+	}
+	return azureMonitorScope
+}
+
+// azureTokenSource obtains app-only access tokens with the client credentials grant
+type azureTokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newAzureTokenSource(cfg AzureSecurityConfig, client *http.Client) *azureTokenSource {
+	return &azureTokenSource{
+		tokenURL:     cfg.AuthorityHost + "/" + url.PathEscape(cfg.TenantID) + "/oauth2/v2.0/token",
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		scope:        cfg.scope(),
+		client:       client,
+	}
+}
+
+// Token returns a cached access token, refreshing it shortly before expiry
+func (a *azureTokenSource) Token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires.Add(-time.Minute)) {
+		return a.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", a.clientID)
+	form.Set("client_secret", a.clientSecret)
+	form.Set("scope", a.scope)
+	now := time.Now()
+	resp, err := a.client.Post(a.tokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain azure access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to decode azure token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", fmt.Errorf("azure token request failed (%d): %s", resp.StatusCode, tok.Error)
+	}
+
+	a.token = tok.AccessToken
+	a.expires = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+// invalidate drops the cached token after the API refused it
+func (a *azureTokenSource) invalidate() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+// AzureSecurityProducer sends events to a Sentinel workspace in batches, or as Graph Security alerts one by one
+type AzureSecurityProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg    AzureSecurityConfig
+	client *http.Client
+	tokens *azureTokenSource
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	sent     uint64
+	requests uint64
+	failed   uint64
+}
+
+// NewAzureSecurityProducer starts sending the events read from msgChan
+func NewAzureSecurityProducer(cfg AzureSecurityConfig, msgChan chan map[string]interface{}) (*AzureSecurityProducer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultAzureBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultAzureFlushInterval
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &AzureSecurityProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		client:   client,
+		tokens:   newAzureTokenSource(cfg, client),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *AzureSecurityProducer) run() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.cfg.BatchSize)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			atomic.AddUint64(&p.failed, uint64(len(batch)))
+			p.Receipts.AddFailed(uint64(len(batch)))
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush sends a batch: Sentinel takes it in requests of up to 1MB, Graph takes one alert per request
+func (p *AzureSecurityProducer) flush(batch []map[string]interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	if p.cfg.Provider == AzureSecurityGraph {
+		for _, msg := range batch {
+			data, err := json.Marshal(p.graphAlert(msg))
+			if err != nil {
+				p.fail(1, fmt.Errorf("failed to encode alert: %w", err))
+				continue
+			}
+			p.deliver(p.cfg.URL, data, 1)
+		}
+		return
+	}
+
+	endpoint := fmt.Sprintf("%s/dataCollectionRules/%s/streams/%s?api-version=%s",
+		p.cfg.Endpoint, url.PathEscape(p.cfg.RuleID), url.PathEscape(p.cfg.Stream), logsIngestionAPIVersion)
+	var (
+		body  = []byte{'['}
+		count int
+	)
+	for _, msg := range batch {
+		record, err := json.Marshal(sentinelRecord(msg))
+		if err != nil {
+			p.fail(1, fmt.Errorf("failed to encode event: %w", err))
+			continue
+		}
+		if len(record)+2 > maxLogsIngestionBody {
+			p.fail(1, fmt.Errorf("event of %d bytes exceeds the 1MB limit of the Logs Ingestion API", len(record)))
+			continue
+		}
+		if count > 0 && len(body)+len(record)+2 > maxLogsIngestionBody {
+			p.deliver(endpoint, append(body, ']'), count)
+			body, count = []byte{'['}, 0
+		}
+		if count > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, record...)
+		count++
+	}
+	if count > 0 {
+		p.deliver(endpoint, append(body, ']'), count)
+	}
+}
+
+// sentinelRecord adds the TimeGenerated column Log Analytics tables require when the event has none
+func sentinelRecord(msg map[string]interface{}) map[string]interface{} {
+	if _, ok := msg["TimeGenerated"]; ok {
+		return msg
+	}
+	record := make(map[string]interface{}, len(msg)+1)
+	for k, v := range msg {
+		record[k] = v
+	}
+	record["TimeGenerated"] = time.Now().UTC().Format(time.RFC3339Nano)
+	return record
+}
+
+// graphAlert builds a Graph Security alert from an event, the event itself goes into the description
+func (p *AzureSecurityProducer) graphAlert(msg map[string]interface{}) map[string]interface{} {
+	rule, _ := GetCheckData(msg, []string{"_hub_hit_rule_id"})
+	title := ""
+	if p.cfg.SummaryField != "" {
+		title, _ = GetCheckData(msg, StringToList(p.cfg.SummaryField))
+	}
+	if title == "" && rule != "" {
+		title = "AgentSmith-HUB detection " + rule
+	}
+	if title == "" {
+		title = "AgentSmith-HUB detection"
+	}
+	category := p.cfg.Category
+	if category == "" {
+		category = rule
+	}
+	description, _ := json.MarshalIndent(msg, "", "  ")
+	now := time.Now().UTC().Format(time.RFC3339)
+	return map[string]interface{}{
+		"title":           truncateRunes(title, maxGraphAlertTitle),
+		"description":     truncateRunes(string(description), maxGraphAlertDescription),
+		"severity":        p.graphSeverity(msg),
+		"category":        category,
+		"status":          "newAlert",
+		"eventDateTime":   now,
+		"createdDateTime": now,
+		"azureTenantId":   p.cfg.TenantID,
+		"vendorInformation": map[string]interface{}{
+			"provider": azureSecurityVendor,
+			"vendor":   azureSecurityVendor,
+		},
+	}
+}
+
+// graphSeverity maps the detection severity of an event to a Graph alert severity
+func (p *AzureSecurityProducer) graphSeverity(msg map[string]interface{}) string {
+	if p.cfg.SeverityField == "" {
+		return p.cfg.DefaultSeverity
+	}
+	v, ok := GetCheckData(msg, StringToList(p.cfg.SeverityField))
+	if !ok || v == "" {
+		return p.cfg.DefaultSeverity
+	}
+	severity := strings.ToLower(v)
+	if mapped, ok := p.cfg.SeverityMap[v]; ok {
+		severity = mapped
+	} else if mapped, ok := p.cfg.SeverityMap[severity]; ok {
+		severity = mapped
+	}
+	if graphAlertSeverities[severity] {
+		return severity
+	}
+	return p.cfg.DefaultSeverity
+}
+
+// deliver posts one request carrying count events, retrying throttling, server errors and an expired token
+func (p *AzureSecurityProducer) deliver(endpoint string, body []byte, count int) {
+	var err error
+retry:
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = p.post(endpoint, body)
+		atomic.AddUint64(&p.requests, 1)
+		if err == nil {
+			atomic.AddUint64(&p.sent, uint64(count))
+			p.Receipts.AddAcked(uint64(count))
+			return
+		}
+		if retryAfter < 0 {
+			break
+		}
+		if retryAfter == 0 {
+			retryAfter = time.Second * time.Duration(attempt+1)
+		}
+		select {
+		case <-p.stopChan:
+			break retry
+		case <-time.After(retryAfter):
+		}
+	}
+	p.fail(count, err)
+}
+
+func (p *AzureSecurityProducer) fail(count int, err error) {
+	logger.Error("Failed to send events to Microsoft security API", "provider", p.cfg.Provider, "events", count, "error", err)
+	atomic.AddUint64(&p.failed, uint64(count))
+	p.Receipts.AddFailed(uint64(count))
+}
+
+// post performs one API call. retryAfter is negative when the error must not be retried,
+// zero for the default backoff, or the delay asked for by the API.
+func (p *AzureSecurityProducer) post(endpoint string, body []byte) (time.Duration, error) {
+	token, err := p.tokens.Token()
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		// The token may have been revoked or rotated, the retry fetches a new one
+		p.tokens.invalidate()
+		return 0, fmt.Errorf("%s rejected the access token: %s", p.cfg.Provider, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter := time.Duration(0)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(min(secs, azureRetryAfterMaxSec)) * time.Second
+		}
+		return retryAfter, fmt.Errorf("%s rate limited: %s", p.cfg.Provider, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("%s returned %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		return -1, fmt.Errorf("%s rejected events with %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// Close waits for the queued events to be sent once msgChan is closed by its owner, giving up after 30s
+func (p *AzureSecurityProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many events were sent or failed and how many requests were made
+func (p *AzureSecurityProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"sent":     atomic.LoadUint64(&p.sent),
+		"requests": atomic.LoadUint64(&p.requests),
+		"failed":   atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestAzureSecurityConnection checks that the application credentials are accepted and the API is reachable.
+// Nothing is written, any HTTP answer of the API counts as reachable.
+func TestAzureSecurityConnection(cfg AzureSecurityConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if _, err := newAzureTokenSource(cfg, client).Token(); err != nil {
+		return err
+	}
+	endpoint := cfg.URL
+	if cfg.Provider == AzureSecuritySentinel {
+		endpoint = cfg.Endpoint
+	}
+	resp, err := client.Head(endpoint)
+	if err != nil {
+		return fmt.Errorf("%s not reachable: %w", cfg.Provider, err)
+	}
+	resp.Body.Close()
+	return nil
+}
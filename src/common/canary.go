@@ -0,0 +1,547 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+// CanaryFieldName is the field that marks a message as a synthetic canary event.
+// Canary events are evaluated by the rulesets of their project like any other event, then forwarded
+// whatever the verdict, and are never delivered to external systems.
+const CanaryFieldName = "_hub_canary"
+
+const (
+	defaultCanaryInterval = 30 * time.Second
+	defaultCanarySLO      = 5 * time.Second
+	defaultCanaryWindow   = 100
+	canarySLIRedisKey     = "hub:latency_sli"
+	// canaries not received after the SLO beyond this count make a project breach the SLO, a few may be
+	// dropped at injection when the input channel is full
+	canaryOverdueTolerance = 2
+
+	canaryAlertTitle = `Latency SLO {{.state}} for project {{.project}}`
+	canaryAlertText  = `Project {{.project}} on node {{.node}}: p95 {{.p95_ms}}ms against an SLO of {{.slo_ms}}ms, {{.overdue}} canaries overdue ({{.sent}} sent, {{.received}} received).`
+)
+
+// CanaryConfig controls synthetic canary injection and latency SLI evaluation
+type CanaryConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Interval   string `yaml:"interval,omitempty"`    // How often canaries are injected, default 30s
+	LatencySLO string `yaml:"latency_slo,omitempty"` // p95 end-to-end latency objective, default 5s
+	Window     int    `yaml:"window,omitempty"`      // Number of recent samples kept per project, default 100
+
+	// Breaches and recoveries are sent here, the targets are the same as for schema contracts.
+	// Breaches are only logged and counted when unset.
+	Notify  string            `yaml:"notify,omitempty"` // slack, teams, dingtalk or webhook
+	URL     string            `yaml:"url,omitempty"`    // incoming webhook or HTTP endpoint
+	Secret  string            `yaml:"secret,omitempty"` // dingtalk signing secret
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// CanaryInjector injects one canary event into every running project.
+// It is registered by the project package to avoid circular imports.
+type CanaryInjector func()
+
+// LatencySLI is the end-to-end latency summary of a single project on one node
+type LatencySLI struct {
+	NodeID      string    `json:"node_id"`
+	ProjectID   string    `json:"project_id"`
+	Samples     int       `json:"samples"`
+	P50Ms       float64   `json:"p50_ms"`
+	P95Ms       float64   `json:"p95_ms"`
+	P99Ms       float64   `json:"p99_ms"`
+	MaxMs       float64   `json:"max_ms"`
+	SLOMs       float64   `json:"slo_ms"`
+	Breached    bool      `json:"breached"`
+	Sent        uint64    `json:"sent"`
+	Received    uint64    `json:"received"`
+	Overdue     int       `json:"overdue"`    // canaries sent longer than the SLO ago and not received yet
+	Duplicates  uint64    `json:"duplicates"` // further copies of received canaries, e.g. from fan-out to several outputs
+	Breaches    uint64    `json:"breaches"`   // how often the project went from within the SLO to breached
+	LastOutput  string    `json:"last_output,omitempty"`
+	LastUpdated time.Time `json:"last_updated"`
+	// Set while breached
+	BreachedSince *time.Time `json:"breached_since,omitempty"`
+}
+
+type canaryProjectStats struct {
+	samples  []time.Duration
+	next     int
+	sent     uint64
+	received uint64
+	// canaries in flight by id, a canary is counted when its first copy reaches an output
+	pending    map[string]time.Time
+	duplicates uint64
+	// project node sequences of the project's outputs, canaries reaching other outputs
+	// through a component shared with another project are ignored
+	outputs       map[string]bool
+	breached      bool
+	breachedSince time.Time
+	breaches      uint64
+	lastOutput    string
+	updated       time.Time
+}
+
+// CanaryMonitor periodically injects canary events and aggregates their latencies
+type CanaryMonitor struct {
+	nodeID   string
+	interval time.Duration
+	slo      time.Duration
+	window   int
+	key      []byte
+
+	mu       sync.Mutex
+	projects map[string]*canaryProjectStats
+
+	// breach notifications, nil when not configured
+	alertChan  chan map[string]interface{}
+	alertClose func()
+	alerts     uint64
+	dropped    uint64
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GlobalCanaryMonitor is nil when canary measurement is disabled
+var GlobalCanaryMonitor *CanaryMonitor
+
+var canaryInjector CanaryInjector
+
+// SetCanaryInjector sets the global canary injector function
+func SetCanaryInjector(injector CanaryInjector) {
+	GlobalMu.Lock()
+	defer GlobalMu.Unlock()
+	canaryInjector = injector
+}
+
+// NewCanaryMonitor creates a canary monitor from config, falling back to defaults for unset values
+func NewCanaryMonitor(nodeID string, cfg *CanaryConfig) (*CanaryMonitor, error) {
+	cm := &CanaryMonitor{
+		nodeID:   nodeID,
+		interval: defaultCanaryInterval,
+		slo:      defaultCanarySLO,
+		window:   defaultCanaryWindow,
+		key:      make([]byte, 32),
+		projects: make(map[string]*canaryProjectStats),
+		stopChan: make(chan struct{}),
+	}
+
+	if cfg != nil {
+		if cfg.Interval != "" {
+			d, err := time.ParseDuration(cfg.Interval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid canary interval: %s", cfg.Interval)
+			}
+			cm.interval = d
+		}
+		if cfg.LatencySLO != "" {
+			d, err := time.ParseDuration(cfg.LatencySLO)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid canary latency_slo: %s", cfg.LatencySLO)
+			}
+			cm.slo = d
+		}
+		if cfg.Window > 0 {
+			cm.window = cfg.Window
+		}
+		if cfg.Notify != "" {
+			if err := cm.startAlerts(cfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Canaries are injected and received on the same node, so a per-process key is sufficient
+	if _, err := rand.Read(cm.key); err != nil {
+		cm.stopAlerts()
+		return nil, fmt.Errorf("failed to generate canary signing key: %w", err)
+	}
+
+	return cm, nil
+}
+
+// startAlerts starts the producer breach notifications are sent through
+func (cm *CanaryMonitor) startAlerts(cfg *CanaryConfig) error {
+	msgChan := make(chan map[string]interface{}, 16)
+	switch cfg.Notify {
+	case SchemaContractNotifySlack, SchemaContractNotifyTeams, SchemaContractNotifyDingTalk:
+		p, err := NewChatNotifyProducer(ChatNotifyConfig{
+			Platform:      cfg.Notify,
+			WebhookURL:    cfg.URL,
+			Secret:        cfg.Secret,
+			TitleTemplate: canaryAlertTitle,
+			TextTemplate:  canaryAlertText,
+		}, msgChan)
+		if err != nil {
+			return fmt.Errorf("invalid canary notify: %w", err)
+		}
+		cm.alertClose = p.Close
+	case SchemaContractNotifyWebhook:
+		p, err := NewWebhookProducer(WebhookConfig{URL: cfg.URL, Headers: cfg.Headers}, msgChan)
+		if err != nil {
+			return fmt.Errorf("invalid canary notify: %w", err)
+		}
+		cm.alertClose = p.Close
+	default:
+		return fmt.Errorf("unsupported canary notify type: %s", cfg.Notify)
+	}
+	cm.alertChan = msgChan
+	return nil
+}
+
+func (cm *CanaryMonitor) stopAlerts() {
+	if cm.alertChan == nil {
+		return
+	}
+	close(cm.alertChan)
+	cm.alertClose()
+	cm.alertChan = nil
+}
+
+// InitCanaryMonitor initializes and starts the global canary monitor if enabled in config
+func InitCanaryMonitor(nodeID string, cfg *CanaryConfig) {
+	if cfg == nil || !cfg.Enabled || GlobalCanaryMonitor != nil {
+		return
+	}
+	cm, err := NewCanaryMonitor(nodeID, cfg)
+	if err != nil {
+		logger.Error("Failed to initialize canary monitor", "error", err)
+		return
+	}
+	GlobalCanaryMonitor = cm
+	cm.Start()
+}
+
+// StopCanaryMonitor stops the global canary monitor
+func StopCanaryMonitor() {
+	if GlobalCanaryMonitor != nil {
+		GlobalCanaryMonitor.Stop()
+		GlobalCanaryMonitor = nil
+	}
+}
+
+// Start begins periodic canary injection
+func (cm *CanaryMonitor) Start() {
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		ticker := time.NewTicker(cm.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cm.stopChan:
+				return
+			case <-ticker.C:
+				cm.evaluate()
+				GlobalMu.RLock()
+				injector := canaryInjector
+				GlobalMu.RUnlock()
+				if injector != nil {
+					injector()
+				}
+			}
+		}
+	}()
+	logger.Info("Canary monitor started", "interval", cm.interval, "latency_slo", cm.slo)
+}
+
+// Stop stops canary injection
+func (cm *CanaryMonitor) Stop() {
+	close(cm.stopChan)
+	cm.wg.Wait()
+	cm.stopAlerts()
+	logger.Info("Canary monitor stopped")
+}
+
+func (cm *CanaryMonitor) sign(projectID, id string, sentAt int64) string {
+	mac := hmac.New(sha256.New, cm.key)
+	mac.Write([]byte(projectID + "|" + id + "|" + strconv.FormatInt(sentAt, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewEvent builds a signed canary event for the given project and input. outputs are the
+// project node sequences of the project's outputs, the only ones the canary is counted at.
+func (cm *CanaryMonitor) NewEvent(projectID, inputID string, outputs []string) map[string]interface{} {
+	now := time.Now()
+	sentAt := now.UnixNano()
+	id := NewUUID()
+	cm.mu.Lock()
+	stats := cm.statsLocked(projectID)
+	stats.sent++
+	stats.outputs = make(map[string]bool, len(outputs))
+	for _, pns := range outputs {
+		stats.outputs[pns] = true
+	}
+	if len(stats.pending) >= cm.window {
+		// A project losing every canary would grow this forever, the oldest is overdue anyway
+		var oldestID string
+		var oldest time.Time
+		for pendingID, t := range stats.pending {
+			if oldestID == "" || t.Before(oldest) {
+				oldestID, oldest = pendingID, t
+			}
+		}
+		delete(stats.pending, oldestID)
+	}
+	stats.pending[id] = now
+	cm.mu.Unlock()
+
+	return map[string]interface{}{
+		"_hub_input": inputID,
+		CanaryFieldName: map[string]interface{}{
+			"project": projectID,
+			"id":      id,
+			"sent_at": sentAt,
+			"sig":     cm.sign(projectID, id, sentAt),
+		},
+	}
+}
+
+// Record verifies a canary event that reached an output and records its latency. Only the first
+// copy of a canary reaching one of the outputs of its own project is counted.
+func (cm *CanaryMonitor) Record(msg map[string]interface{}, outputID, outputPNS string) {
+	canary, ok := msg[CanaryFieldName].(map[string]interface{})
+	if !ok {
+		return
+	}
+	projectID, _ := canary["project"].(string)
+	id, _ := canary["id"].(string)
+	sig, _ := canary["sig"].(string)
+	sentAt, ok := canary["sent_at"].(int64)
+	if !ok || !hmac.Equal([]byte(sig), []byte(cm.sign(projectID, id, sentAt))) {
+		logger.Warn("Dropping canary event with invalid signature", "output", outputID)
+		return
+	}
+
+	latency := time.Since(time.Unix(0, sentAt))
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	stats, ok := cm.projects[projectID]
+	if !ok || !stats.outputs[outputPNS] {
+		// The project was stopped, or the canary left it through a component shared with another project
+		return
+	}
+	if _, ok := stats.pending[id]; !ok {
+		stats.duplicates++
+		return
+	}
+	delete(stats.pending, id)
+	if len(stats.samples) < cm.window {
+		stats.samples = append(stats.samples, latency)
+	} else {
+		stats.samples[stats.next] = latency
+		stats.next = (stats.next + 1) % cm.window
+	}
+	stats.received++
+	stats.lastOutput = outputID
+	stats.updated = time.Now()
+}
+
+// RemoveProject drops collected samples for a project, e.g. after it has been stopped
+func (cm *CanaryMonitor) RemoveProject(projectID string) {
+	cm.mu.Lock()
+	delete(cm.projects, projectID)
+	cm.mu.Unlock()
+}
+
+func (cm *CanaryMonitor) statsLocked(projectID string) *canaryProjectStats {
+	stats, ok := cm.projects[projectID]
+	if !ok {
+		stats = &canaryProjectStats{
+			samples: make([]time.Duration, 0, cm.window),
+			pending: make(map[string]time.Time),
+		}
+		cm.projects[projectID] = stats
+	}
+	return stats
+}
+
+// GetSLIs returns the latency SLIs of all projects measured on this node
+func (cm *CanaryMonitor) GetSLIs() []LatencySLI {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	result := make([]LatencySLI, 0, len(cm.projects))
+	for projectID, stats := range cm.projects {
+		result = append(result, cm.buildSLI(projectID, stats, time.Now()))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ProjectID < result[j].ProjectID })
+	return result
+}
+
+func (cm *CanaryMonitor) buildSLI(projectID string, stats *canaryProjectStats, now time.Time) LatencySLI {
+	sli := LatencySLI{
+		NodeID:      cm.nodeID,
+		ProjectID:   projectID,
+		Samples:     len(stats.samples),
+		SLOMs:       durationMs(cm.slo),
+		Sent:        stats.sent,
+		Received:    stats.received,
+		Duplicates:  stats.duplicates,
+		Breaches:    stats.breaches,
+		LastOutput:  stats.lastOutput,
+		LastUpdated: stats.updated,
+		Breached:    stats.breached,
+	}
+	if stats.breached {
+		since := stats.breachedSince
+		sli.BreachedSince = &since
+	}
+	for _, t := range stats.pending {
+		if now.Sub(t) > cm.slo {
+			sli.Overdue++
+		}
+	}
+	if len(stats.samples) == 0 {
+		return sli
+	}
+
+	sorted := make([]time.Duration, len(stats.samples))
+	copy(sorted, stats.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	sli.P50Ms = durationMs(percentile(sorted, 0.50))
+	sli.P95Ms = durationMs(percentile(sorted, 0.95))
+	sli.P99Ms = durationMs(percentile(sorted, 0.99))
+	sli.MaxMs = durationMs(sorted[len(sorted)-1])
+	return sli
+}
+
+// evaluate checks every project against the latency SLO, reports breaches and recoveries
+// and publishes SLIs to Redis
+func (cm *CanaryMonitor) evaluate() {
+	now := time.Now()
+	cm.mu.Lock()
+	slis := make([]LatencySLI, 0, len(cm.projects))
+	var changed []LatencySLI
+	for projectID, stats := range cm.projects {
+		sli := cm.buildSLI(projectID, stats, now)
+		// Canaries that never arrive are a breach too, the samples only hold the ones that did
+		breached := sli.P95Ms > sli.SLOMs || sli.Overdue > canaryOverdueTolerance
+		if breached && !stats.breached {
+			stats.breaches++
+			stats.breachedSince = now
+			logger.Error("Project end-to-end latency SLO breached", "project", projectID,
+				"p95_ms", sli.P95Ms, "slo_ms", sli.SLOMs, "overdue", sli.Overdue, "sent", stats.sent, "received", stats.received)
+		} else if !breached && stats.breached {
+			logger.Info("Project end-to-end latency back within SLO", "project", projectID, "p95_ms", sli.P95Ms)
+		}
+		if breached != stats.breached {
+			stats.breached = breached
+			sli = cm.buildSLI(projectID, stats, now)
+			changed = append(changed, sli)
+		}
+		slis = append(slis, sli)
+	}
+	cm.mu.Unlock()
+
+	for _, sli := range changed {
+		cm.notify(sli)
+	}
+
+	if len(slis) == 0 {
+		return
+	}
+	data, err := json.Marshal(slis)
+	if err != nil {
+		return
+	}
+	if err := RedisHSet(canarySLIRedisKey, cm.nodeID, string(data)); err != nil {
+		logger.Debug("Failed to publish latency SLI to Redis", "error", err)
+	}
+}
+
+// notify queues a breach or recovery notification without blocking the monitor
+func (cm *CanaryMonitor) notify(sli LatencySLI) {
+	if cm.alertChan == nil {
+		return
+	}
+	state := "recovered"
+	if sli.Breached {
+		state = "breached"
+	}
+	msg := map[string]interface{}{
+		"state":    state,
+		"project":  sli.ProjectID,
+		"node":     sli.NodeID,
+		"p50_ms":   sli.P50Ms,
+		"p95_ms":   sli.P95Ms,
+		"p99_ms":   sli.P99Ms,
+		"slo_ms":   sli.SLOMs,
+		"overdue":  sli.Overdue,
+		"sent":     sli.Sent,
+		"received": sli.Received,
+		"breaches": sli.Breaches,
+		"time":     time.Now().UTC().Format(time.RFC3339),
+	}
+	select {
+	case cm.alertChan <- msg:
+		atomic.AddUint64(&cm.alerts, 1)
+	default:
+		atomic.AddUint64(&cm.dropped, 1)
+		logger.Warn("Canary alert queue full, dropping notification", "project", sli.ProjectID, "state", state)
+	}
+}
+
+// GetAlertStats returns how many breach notifications were queued or dropped
+func (cm *CanaryMonitor) GetAlertStats() map[string]uint64 {
+	return map[string]uint64{
+		"alerts":         atomic.LoadUint64(&cm.alerts),
+		"alerts_dropped": atomic.LoadUint64(&cm.dropped),
+	}
+}
+
+// GetClusterLatencySLIs returns latency SLIs published by all nodes
+func GetClusterLatencySLIs() ([]LatencySLI, error) {
+	all, err := RedisHGetAll(canarySLIRedisKey)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]LatencySLI, 0)
+	for _, raw := range all {
+		var slis []LatencySLI
+		if err := json.Unmarshal([]byte(raw), &slis); err != nil {
+			continue
+		}
+		result = append(result, slis...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProjectID == result[j].ProjectID {
+			return result[i].NodeID < result[j].NodeID
+		}
+		return result[i].ProjectID < result[j].ProjectID
+	})
+	return result, nil
+}
+
+// IsCanaryEvent reports whether the message is a synthetic canary event
+func IsCanaryEvent(msg map[string]interface{}) bool {
+	if msg == nil {
+		return false
+	}
+	_, ok := msg[CanaryFieldName]
+	return ok
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestRedis points the package Redis client at a lite store for the duration of the test
+func useTestRedis(t *testing.T) {
+	t.Helper()
+	_, client := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	prev := rdb
+	rdb = client
+	t.Cleanup(func() { rdb = prev })
+}
+
+func canarySLI(t *testing.T, cm *CanaryMonitor, projectID string) LatencySLI {
+	t.Helper()
+	for _, sli := range cm.GetSLIs() {
+		if sli.ProjectID == projectID {
+			return sli
+		}
+	}
+	t.Fatalf("no SLI for project %s", projectID)
+	return LatencySLI{}
+}
+
+func TestCanaryReceiptsDedupedAndScopedToProject(t *testing.T) {
+	cm, err := NewCanaryMonitor("node-1", &CanaryConfig{LatencySLO: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := cm.NewEvent("p1", "in", []string{"OUTPUT.a", "OUTPUT.b"})
+	b := cm.NewEvent("p2", "in", []string{"OUTPUT.c"})
+
+	// Fan-out to both outputs of p1 counts the canary once
+	cm.Record(a, "a", "OUTPUT.a")
+	cm.Record(a, "b", "OUTPUT.b")
+	// A canary of p2 reaching an output of p1 through a shared ruleset is not p2's receipt
+	cm.Record(b, "a", "OUTPUT.a")
+	// A forged canary is dropped
+	forged := map[string]interface{}{CanaryFieldName: map[string]interface{}{
+		"project": "p1", "id": "x", "sent_at": time.Now().UnixNano(), "sig": "00",
+	}}
+	cm.Record(forged, "a", "OUTPUT.a")
+
+	p1 := canarySLI(t, cm, "p1")
+	if p1.Sent != 1 || p1.Received != 1 || p1.Duplicates != 1 || p1.Samples != 1 || p1.LastOutput != "a" {
+		t.Fatalf("unexpected p1 SLI %+v", p1)
+	}
+	p2 := canarySLI(t, cm, "p2")
+	if p2.Sent != 1 || p2.Received != 0 || p2.Duplicates != 0 {
+		t.Fatalf("unexpected p2 SLI %+v", p2)
+	}
+
+	cm.Record(b, "c", "OUTPUT.c")
+	if p2 = canarySLI(t, cm, "p2"); p2.Received != 1 {
+		t.Fatalf("p2 canary not counted at its own output: %+v", p2)
+	}
+}
+
+func TestCanaryBreachAndRecoveryAlerts(t *testing.T) {
+	useTestRedis(t)
+
+	var mu sync.Mutex
+	var alerts []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var alert map[string]interface{}
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Errorf("invalid alert body %s: %v", body, err)
+		}
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cm, err := NewCanaryMonitor("node-1", &CanaryConfig{LatencySLO: "1ms", Notify: "webhook", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := []string{"OUTPUT.a"}
+	events := make([]map[string]interface{}, 0, canaryOverdueTolerance+1)
+	for i := 0; i <= canaryOverdueTolerance; i++ {
+		events = append(events, cm.NewEvent("p1", "in", outputs))
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// None of the canaries arrived: the sent/received gap alone breaches the SLO
+	cm.evaluate()
+	sli := canarySLI(t, cm, "p1")
+	if !sli.Breached || sli.Breaches != 1 || sli.Overdue != canaryOverdueTolerance+1 || sli.BreachedSince == nil {
+		t.Fatalf("lost canaries did not breach the SLO: %+v", sli)
+	}
+	// Staying breached is not a new breach
+	cm.evaluate()
+	if sli = canarySLI(t, cm, "p1"); sli.Breaches != 1 {
+		t.Fatalf("breach counted twice: %+v", sli)
+	}
+
+	for _, e := range events {
+		cm.Record(e, "a", "OUTPUT.a")
+	}
+	cm.slo = time.Hour
+	cm.evaluate()
+	if sli = canarySLI(t, cm, "p1"); sli.Breached || sli.Overdue != 0 || sli.BreachedSince != nil {
+		t.Fatalf("project did not recover: %+v", sli)
+	}
+
+	published, err := RedisHGet(canarySLIRedisKey, "node-1")
+	if err != nil || published == "" {
+		t.Fatalf("SLIs not published: %q %v", published, err)
+	}
+
+	cm.stopAlerts()
+	if stats := cm.GetAlertStats(); stats["alerts"] != 2 || stats["alerts_dropped"] != 0 {
+		t.Fatalf("unexpected alert stats %v", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(alerts) != 2 || alerts[0]["state"] != "breached" || alerts[1]["state"] != "recovered" || alerts[0]["project"] != "p1" {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+}
+
+func TestCanaryNotifyValidated(t *testing.T) {
+	if _, err := NewCanaryMonitor("node-1", &CanaryConfig{Notify: "pager"}); err == nil {
+		t.Fatal("unsupported notify type accepted")
+	}
+	if _, err := NewCanaryMonitor("node-1", &CanaryConfig{Notify: "webhook"}); err == nil {
+		t.Fatal("webhook without url accepted")
+	}
+}
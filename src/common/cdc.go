@@ -0,0 +1,306 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CDCDriver identifies the database a CDC reader tails
+type CDCDriver string
+
+const (
+	CDCDriverPostgres CDCDriver = "postgres"
+	CDCDriverMySQL    CDCDriver = "mysql"
+)
+
+const (
+	cdcLockTTL          = time.Minute
+	cdcLockRefresh      = 20 * time.Second
+	cdcLockRetry        = 10 * time.Second
+	cdcCursorSaveTicker = 5 * time.Second
+)
+
+// CDCReaderConfig holds the connection and filter settings of a CDC reader
+type CDCReaderConfig struct {
+	Driver   CDCDriver
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	// Tables limits captured changes, as schema.table (postgres) or database.table (mysql)
+	Tables []string
+
+	// PostgreSQL: logical replication slot using the wal2json output plugin
+	Slot       string
+	CreateSlot bool
+
+	// MySQL: binlog reader server id, must be unique among the replicas of the server
+	ServerID int
+	// FromBeginning starts at the oldest available binlog when no position is stored, otherwise at the current one
+	FromBeginning bool
+}
+
+// cdcSource implements the database specific part of a CDC reader
+type cdcSource interface {
+	// prepare runs before each follow, e.g. to create the slot or resolve the start position
+	prepare(ctx context.Context) error
+	command(ctx context.Context) *exec.Cmd
+	// handleLine parses one line of command output and returns completed change events
+	handleLine(line string) []map[string]interface{}
+	// cursor returns the position to persist, empty if the position is tracked by the server
+	cursor() string
+}
+
+// CDCReader streams row changes from a database through its replication tooling
+// (pg_recvlogical with wal2json, or mysqlbinlog) and forwards them to MsgChan.
+// Only one node of the cluster reads a given input at a time.
+type CDCReader struct {
+	InputID string
+	MsgChan chan map[string]interface{}
+
+	cfg    CDCReaderConfig
+	source cdcSource
+	saved  string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	readTotal uint64
+	active    int32
+}
+
+// NewCDCReader creates a CDC reader, failing early if the replication tool is not installed
+func NewCDCReader(inputID string, cfg CDCReaderConfig, msgChan chan map[string]interface{}) (*CDCReader, error) {
+	r := &CDCReader{
+		InputID: inputID,
+		MsgChan: msgChan,
+		cfg:     cfg,
+	}
+
+	switch cfg.Driver {
+	case CDCDriverPostgres:
+		if _, err := exec.LookPath("pg_recvlogical"); err != nil {
+			return nil, fmt.Errorf("pg_recvlogical not found, postgres cdc requires the PostgreSQL client tools: %w", err)
+		}
+		r.source = &pgCDCSource{cfg: cfg}
+	case CDCDriverMySQL:
+		for _, tool := range []string{"mysqlbinlog", "mysql"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				return nil, fmt.Errorf("%s not found, mysql cdc requires the MySQL client tools: %w", tool, err)
+			}
+		}
+		src := &mysqlCDCSource{cfg: cfg, columns: make(map[string][]string)}
+		if raw, err := RedisGet(auditLogCursorKeyPrefix + inputID); err == nil && raw != "" {
+			if err := src.setCursor(raw); err != nil {
+				logger.Warn("Invalid binlog position in Redis, ignoring", "input", inputID, "error", err)
+			} else {
+				r.saved = raw
+			}
+		}
+		r.source = src
+	default:
+		return nil, fmt.Errorf("unsupported cdc driver: %s", cfg.Driver)
+	}
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r, nil
+}
+
+// Start keeps trying to become the active reader of the input and follows the change stream while it is
+func (r *CDCReader) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			r.followWithLock()
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(cdcLockRetry):
+			}
+		}
+	}()
+}
+
+// Close stops the replication tool and persists the last position
+func (r *CDCReader) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.saveCursor()
+}
+
+// GetReadTotal returns the number of change events read since start
+func (r *CDCReader) GetReadTotal() uint64 {
+	return atomic.LoadUint64(&r.readTotal)
+}
+
+// IsActive reports whether this node currently holds the input lock and reads changes
+func (r *CDCReader) IsActive() bool {
+	return atomic.LoadInt32(&r.active) == 1
+}
+
+// followWithLock follows the change stream for as long as this node holds the input lock
+func (r *CDCReader) followWithLock() {
+	lock := NewDistributedLock(auditLogLockKeyPrefix+r.InputID, cdcLockTTL)
+	if err := lock.Acquire(); err != nil {
+		logger.Debug("CDC input lock held by another node", "input", r.InputID)
+		return
+	}
+	defer func() { _ = lock.Release() }()
+
+	atomic.StoreInt32(&r.active, 1)
+	defer atomic.StoreInt32(&r.active, 0)
+	logger.Info("CDC reader became active on this node", "input", r.InputID, "driver", r.cfg.Driver)
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(cdcLockRefresh)
+		defer ticker.Stop()
+		saveTicker := time.NewTicker(cdcCursorSaveTicker)
+		defer saveTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-saveTicker.C:
+				r.saveCursor()
+			case <-ticker.C:
+				if err := lock.Refresh(); err != nil {
+					logger.Warn("Lost CDC input lock, stopping reader on this node", "input", r.InputID, "error", err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	defer wg.Wait()
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		if err := r.follow(ctx); err != nil && ctx.Err() == nil {
+			logger.Warn("CDC reader exited, restarting", "input", r.InputID, "driver", r.cfg.Driver, "error", err)
+		}
+		r.saveCursor()
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+func (r *CDCReader) follow(ctx context.Context) error {
+	if err := r.source.prepare(ctx); err != nil {
+		return err
+	}
+
+	cmd := r.source.command(ctx)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &limitedBuffer{max: 4096}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		for _, event := range r.source.handleLine(scanner.Text()) {
+			select {
+			case r.MsgChan <- event:
+				atomic.AddUint64(&r.readTotal, 1)
+			case <-ctx.Done():
+				_ = cmd.Wait()
+				return nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (r *CDCReader) saveCursor() {
+	cursor := r.source.cursor()
+	if cursor == "" || cursor == r.saved {
+		return
+	}
+	if _, err := RedisSet(auditLogCursorKeyPrefix+r.InputID, cursor, 0); err != nil {
+		logger.Warn("Failed to persist cdc position", "input", r.InputID, "error", err)
+		return
+	}
+	r.saved = cursor
+}
+
+// TestCDCConnection checks that the database is reachable with the configured credentials
+func TestCDCConnection(cfg CDCReaderConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	switch cfg.Driver {
+	case CDCDriverPostgres:
+		if _, err := exec.LookPath("pg_recvlogical"); err != nil {
+			return fmt.Errorf("pg_recvlogical not found: %w", err)
+		}
+		src := &pgCDCSource{cfg: cfg}
+		return src.ping(ctx)
+	case CDCDriverMySQL:
+		src := &mysqlCDCSource{cfg: cfg}
+		_, err := src.query(ctx, "SELECT 1")
+		return err
+	default:
+		return fmt.Errorf("unsupported cdc driver: %s", cfg.Driver)
+	}
+}
+
+// limitedBuffer keeps the first max bytes written to it, used to report tool errors
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
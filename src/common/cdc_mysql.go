@@ -0,0 +1,356 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	mysqlRowHeaderRegex = regexp.MustCompile("^### (INSERT INTO|UPDATE|DELETE FROM) `([^`]+)`\\.`([^`]+)`")
+	mysqlColumnRegex    = regexp.MustCompile(`^###\s+@(\d+)=(.*)$`)
+	mysqlEventTimeRegex = regexp.MustCompile(`^#(\d{6}\s+\d{1,2}:\d{2}:\d{2})\s+server id`)
+	mysqlRotateRegex    = regexp.MustCompile(`Rotate to (\S+)\s+pos: (\d+)`)
+	mysqlValueComment   = regexp.MustCompile(`\s*/\*.*\*/\s*$`)
+)
+
+// mysqlCDCSource reads row events with mysqlbinlog in remote mode.
+// The binlog file and position after the last complete transaction is stored as the cursor.
+type mysqlCDCSource struct {
+	cfg CDCReaderConfig
+
+	mu      sync.Mutex
+	file    string
+	pos     uint64
+	safe    string // file:pos of the last transaction boundary
+	atTxEnd bool
+
+	// row event being assembled from ### lines
+	current   map[string]interface{}
+	section   string
+	eventTime string
+
+	columns map[string][]string // db.table -> column names by ordinal position
+}
+
+func (s *mysqlCDCSource) connArgs() []string {
+	args := []string{"--host=" + s.cfg.Host, "--user=" + s.cfg.User}
+	if s.cfg.Port > 0 {
+		args = append(args, "--port="+strconv.Itoa(s.cfg.Port))
+	}
+	return args
+}
+
+func (s *mysqlCDCSource) env() []string {
+	env := os.Environ()
+	if s.cfg.Password != "" {
+		env = append(env, "MYSQL_PWD="+s.cfg.Password)
+	}
+	return env
+}
+
+// query runs a statement with the mysql client and returns its tab separated rows
+func (s *mysqlCDCSource) query(ctx context.Context, stmt string) ([][]string, error) {
+	if _, err := exec.LookPath("mysql"); err != nil {
+		return nil, fmt.Errorf("mysql client not found: %w", err)
+	}
+	args := append(s.connArgs(), "--batch", "--skip-column-names", "-e", stmt)
+	cmd := exec.CommandContext(ctx, "mysql", args...)
+	cmd.Env = s.env()
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
+
+func (s *mysqlCDCSource) setCursor(raw string) error {
+	idx := strings.LastIndex(raw, ":")
+	if idx <= 0 {
+		return fmt.Errorf("expected file:position, got %q", raw)
+	}
+	pos, err := strconv.ParseUint(raw[idx+1:], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid binlog position %q: %w", raw, err)
+	}
+	s.mu.Lock()
+	s.file, s.pos, s.safe = raw[:idx], pos, raw
+	s.mu.Unlock()
+	return nil
+}
+
+// prepare resolves the start position when none is stored yet
+func (s *mysqlCDCSource) prepare(ctx context.Context) error {
+	s.mu.Lock()
+	resolved := s.safe != ""
+	s.mu.Unlock()
+	if resolved {
+		return s.setCursor(s.safe)
+	}
+
+	var rows [][]string
+	var err error
+	if s.cfg.FromBeginning {
+		rows, err = s.query(ctx, "SHOW BINARY LOGS")
+	} else {
+		rows, err = s.query(ctx, "SHOW MASTER STATUS")
+		if err != nil {
+			// MySQL 8.4 removed SHOW MASTER STATUS
+			rows, err = s.query(ctx, "SHOW BINARY LOG STATUS")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve binlog position: %w", err)
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return fmt.Errorf("failed to resolve binlog position: binary logging is not enabled")
+	}
+
+	pos := "4"
+	if !s.cfg.FromBeginning {
+		pos = rows[0][1]
+	}
+	return s.setCursor(rows[0][0] + ":" + pos)
+}
+
+func (s *mysqlCDCSource) command(ctx context.Context) *exec.Cmd {
+	s.mu.Lock()
+	file, pos := s.file, s.pos
+	s.current, s.section, s.atTxEnd = nil, "", false
+	s.mu.Unlock()
+
+	args := append(s.connArgs(),
+		"--read-from-remote-server", "--stop-never",
+		"--base64-output=DECODE-ROWS", "--verbose",
+		"--start-position="+strconv.FormatUint(pos, 10),
+	)
+	if s.cfg.ServerID > 0 {
+		args = append(args, "--connection-server-id="+strconv.Itoa(s.cfg.ServerID))
+	}
+	args = append(args, file)
+
+	cmd := exec.CommandContext(ctx, "mysqlbinlog", args...)
+	cmd.Env = s.env()
+	return cmd
+}
+
+// handleLine follows the mysqlbinlog text output. Row images arrive as ### lines;
+// an event is complete when the next header or a non ### line shows up.
+func (s *mysqlCDCSource) handleLine(line string) []map[string]interface{} {
+	var out []map[string]interface{}
+
+	if strings.HasPrefix(line, "### ") {
+		if m := mysqlRowHeaderRegex.FindStringSubmatch(line); m != nil {
+			if ev := s.flush(); ev != nil {
+				out = append(out, ev)
+			}
+			s.startRow(m[1], m[2], m[3])
+			return out
+		}
+		if s.current == nil {
+			return nil
+		}
+		switch strings.TrimSpace(line[4:]) {
+		case "WHERE":
+			s.section = "old"
+			return nil
+		case "SET":
+			s.section = "row"
+			return nil
+		}
+		if m := mysqlColumnRegex.FindStringSubmatch(line); m != nil && s.section != "" {
+			idx, _ := strconv.Atoi(m[1])
+			s.current[s.section].(map[string]interface{})[s.columnName(idx)] = parseMySQLValue(m[2])
+		}
+		return nil
+	}
+
+	if ev := s.flush(); ev != nil {
+		out = append(out, ev)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "# at "):
+		pos, err := strconv.ParseUint(strings.TrimSpace(line[5:]), 10, 64)
+		if err == nil {
+			s.mu.Lock()
+			s.pos = pos
+			if s.atTxEnd {
+				s.safe = s.file + ":" + strconv.FormatUint(pos, 10)
+				s.atTxEnd = false
+			}
+			s.mu.Unlock()
+		}
+	case strings.HasPrefix(line, "COMMIT"):
+		s.mu.Lock()
+		s.atTxEnd = true
+		s.mu.Unlock()
+	case strings.HasPrefix(line, "#"):
+		if m := mysqlEventTimeRegex.FindStringSubmatch(line); m != nil {
+			s.eventTime = m[1]
+		}
+		if m := mysqlRotateRegex.FindStringSubmatch(line); m != nil {
+			pos, _ := strconv.ParseUint(m[2], 10, 64)
+			s.mu.Lock()
+			s.file, s.pos = m[1], pos
+			s.safe = m[1] + ":" + m[2]
+			s.mu.Unlock()
+		}
+	default:
+		upper := strings.ToUpper(line)
+		if strings.Contains(upper, "ALTER TABLE") || strings.Contains(upper, "CREATE TABLE") || strings.Contains(upper, "RENAME TABLE") {
+			// column layout may have changed, reload lazily
+			s.columns = make(map[string][]string)
+		}
+	}
+	return out
+}
+
+func (s *mysqlCDCSource) startRow(stmt, db, table string) {
+	if !s.wanted(db, table) {
+		s.current = nil
+		return
+	}
+
+	op := "insert"
+	switch stmt {
+	case "UPDATE":
+		op = "update"
+	case "DELETE FROM":
+		op = "delete"
+	}
+
+	s.mu.Lock()
+	position := s.file + ":" + strconv.FormatUint(s.pos, 10)
+	s.mu.Unlock()
+
+	s.current = map[string]interface{}{
+		"source":    string(CDCDriverMySQL),
+		"database":  db,
+		"schema":    db,
+		"table":     table,
+		"operation": op,
+		"timestamp": parseMySQLEventTime(s.eventTime),
+		"position":  position,
+		"row":       map[string]interface{}{},
+		"old":       map[string]interface{}{},
+	}
+	s.section = ""
+}
+
+func (s *mysqlCDCSource) flush() map[string]interface{} {
+	ev := s.current
+	s.current, s.section = nil, ""
+	if ev == nil {
+		return nil
+	}
+	if ev["operation"] == "delete" {
+		// DELETE images are printed under WHERE, expose them as the affected row
+		ev["row"] = ev["old"]
+		delete(ev, "old")
+	} else if len(ev["old"].(map[string]interface{})) == 0 {
+		delete(ev, "old")
+	}
+	return ev
+}
+
+func (s *mysqlCDCSource) wanted(db, table string) bool {
+	if len(s.cfg.Tables) == 0 {
+		return s.cfg.Database == "" || s.cfg.Database == db
+	}
+	full := db + "." + table
+	for _, t := range s.cfg.Tables {
+		if t == full || (s.cfg.Database == db && t == table) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnName maps an @N column index to its name, falling back to colN
+func (s *mysqlCDCSource) columnName(idx int) string {
+	db, _ := s.current["database"].(string)
+	table, _ := s.current["table"].(string)
+	key := db + "." + table
+
+	cols, ok := s.columns[key]
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		rows, err := s.query(ctx, fmt.Sprintf(
+			"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA='%s' AND TABLE_NAME='%s' ORDER BY ORDINAL_POSITION",
+			strings.ReplaceAll(db, "'", "''"), strings.ReplaceAll(table, "'", "''")))
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to load table columns for cdc", "table", key, "error", err)
+		}
+		for _, r := range rows {
+			cols = append(cols, r[0])
+		}
+		s.columns[key] = cols
+	}
+
+	if idx >= 1 && idx <= len(cols) {
+		return cols[idx-1]
+	}
+	return "col" + strconv.Itoa(idx)
+}
+
+func (s *mysqlCDCSource) cursor() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.safe
+}
+
+// parseMySQLValue converts a mysqlbinlog --verbose literal into a Go value
+func parseMySQLValue(raw string) interface{} {
+	raw = mysqlValueComment.ReplaceAllString(raw, "")
+	if raw == "NULL" {
+		return nil
+	}
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		return strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\n`, "\n", `\r`, "\r", `\t`, "\t").Replace(raw[1 : len(raw)-1])
+	}
+	// unsigned columns are printed as "-1 (4294967295)"
+	if i := strings.Index(raw, " ("); i > 0 && strings.HasSuffix(raw, ")") {
+		raw = raw[i+2 : len(raw)-1]
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n
+	}
+	// BIGINT UNSIGNED beyond int64 would lose precision as a float
+	if n, err := strconv.ParseUint(raw, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
+
+func parseMySQLEventTime(raw string) string {
+	if raw == "" {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	t, err := time.ParseInLocation("060102 15:04:05", strings.Join(strings.Fields(raw), " "), time.Local)
+	if err != nil {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,466 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Chat notification platforms
+const (
+	ChatPlatformSlack    = "slack"
+	ChatPlatformTeams    = "teams"
+	ChatPlatformDingTalk = "dingtalk"
+)
+
+const (
+	defaultChatTitleTemplate = `AgentSmith-HUB alert{{with get . "_hub_hit_rule_id"}}: {{.}}{{end}}`
+	defaultChatTextTemplate  = "```\n{{json . | truncate 2500}}\n```"
+	defaultChatRateLimit     = 30
+	defaultChatRateWindow    = time.Minute
+	maxChatTextLength        = 20000
+	// dingTalkRateLimitCode is returned when a DingTalk robot sends more than 20 messages a minute
+	dingTalkRateLimitCode = 130101
+)
+
+// ChatNotifyConfig holds the settings of a chat notification producer
+type ChatNotifyConfig struct {
+	Platform      string
+	WebhookURL    string
+	Secret        string   // DingTalk signing secret
+	TitleTemplate string   // Go template over the event
+	TextTemplate  string   // Go template over the event, markdown for Slack and DingTalk
+	Fields        []string // event fields shown as a fact list
+	Blocks        bool     // Slack: send Block Kit blocks instead of plain text
+	AtMobiles     []string // DingTalk: mobiles to @mention
+	AtAll         bool     // DingTalk: @all
+
+	RateLimit  int           // messages per RateWindow and webhook, default 30
+	RateWindow time.Duration // default 1m
+	MaxRetries int
+	Timeout    time.Duration
+	HTTP       *OutputHTTPConfig // TLS and proxy of the client
+}
+
+// chatRateLimiter limits the messages sent to one webhook in fixed windows. It is shared by
+// every output instance posting to the same webhook, since the limit protects the channel.
+type chatRateLimiter struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	sent        int
+	suppressed  int
+}
+
+var chatRateLimiters sync.Map // webhook URL -> *chatRateLimiter
+
+// allow reports whether a message may be sent now. When a new window starts it also returns
+// how many messages were suppressed in the previous one.
+func (l *chatRateLimiter) allow(limit int, window time.Duration) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	previouslySuppressed := 0
+	if now.Sub(l.windowStart) >= window {
+		previouslySuppressed = l.suppressed
+		l.windowStart = now
+		l.sent = 0
+		l.suppressed = 0
+	}
+	if l.sent >= limit {
+		l.suppressed++
+		return false, previouslySuppressed
+	}
+	l.sent++
+	return true, previouslySuppressed
+}
+
+// ChatNotifyProducer posts events to a Slack, Microsoft Teams or DingTalk webhook
+type ChatNotifyProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg     ChatNotifyConfig
+	client  *http.Client
+	title   *template.Template
+	text    *template.Template
+	limiter *chatRateLimiter
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	sent       uint64
+	suppressed uint64
+	failed     uint64
+}
+
+// NewChatNotifyProducer starts posting the events read from msgChan
+func NewChatNotifyProducer(cfg ChatNotifyConfig, msgChan chan map[string]interface{}) (*ChatNotifyProducer, error) {
+	p, err := newChatNotifyProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewOutputHTTPClient(p.cfg.HTTP, p.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	limiter, _ := chatRateLimiters.LoadOrStore(p.cfg.WebhookURL, &chatRateLimiter{})
+
+	p.MsgChan = msgChan
+	p.client = client
+	p.limiter = limiter.(*chatRateLimiter)
+	p.stopChan = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+	return p, nil
+}
+
+// newChatNotifyProducer applies the defaults of the config and returns a producer without client,
+// only able to render messages
+func newChatNotifyProducer(cfg ChatNotifyConfig) (*ChatNotifyProducer, error) {
+	switch cfg.Platform {
+	case ChatPlatformSlack, ChatPlatformTeams, ChatPlatformDingTalk:
+	default:
+		return nil, fmt.Errorf("unsupported chat platform: %s", cfg.Platform)
+	}
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("%s webhook_url is required", cfg.Platform)
+	}
+	if cfg.TitleTemplate == "" {
+		cfg.TitleTemplate = defaultChatTitleTemplate
+	}
+	if cfg.TextTemplate == "" {
+		cfg.TextTemplate = defaultChatTextTemplate
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = defaultChatRateLimit
+	}
+	if cfg.RateWindow <= 0 {
+		cfg.RateWindow = defaultChatRateWindow
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	title, err := ParseEventTemplate("title", cfg.TitleTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %w", err)
+	}
+	text, err := ParseEventTemplate("text", cfg.TextTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid text template: %w", err)
+	}
+
+	return &ChatNotifyProducer{
+		cfg:   cfg,
+		title: title,
+		text:  text,
+	}, nil
+}
+
+// CaptureChatNotification renders the message a producer with this config would post for msg,
+// without posting it or counting it against the rate limit
+func CaptureChatNotification(cfg ChatNotifyConfig, msg map[string]interface{}) (*CapturedPayload, error) {
+	p, err := newChatNotifyProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	title, text, err := p.render(msg)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.payload(title, text, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCapturedPayload(p.webhookURL(), body)
+	c.Method = http.MethodPost
+	c.ContentType = "application/json"
+	return c, nil
+}
+
+func (p *ChatNotifyProducer) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return
+			}
+			p.handle(msg)
+		}
+	}
+}
+
+func (p *ChatNotifyProducer) handle(msg map[string]interface{}) {
+	allowed, suppressedBefore := p.limiter.allow(p.cfg.RateLimit, p.cfg.RateWindow)
+	if !allowed {
+		atomic.AddUint64(&p.suppressed, 1)
+		p.Receipts.AddDropped(1)
+		return
+	}
+
+	title, text, err := p.render(msg)
+	if err != nil {
+		logger.Error("Failed to render chat notification", "platform", p.cfg.Platform, "error", err)
+		atomic.AddUint64(&p.failed, 1)
+		p.Receipts.AddFailed(1)
+		return
+	}
+	if suppressedBefore > 0 {
+		text += fmt.Sprintf("\n\n_%d notifications were suppressed by the rate limit in the previous %s_", suppressedBefore, p.cfg.RateWindow)
+	}
+
+	body, err := p.payload(title, text, msg)
+	if err != nil {
+		logger.Error("Failed to encode chat notification", "platform", p.cfg.Platform, "error", err)
+		atomic.AddUint64(&p.failed, 1)
+		p.Receipts.AddFailed(1)
+		return
+	}
+
+retry:
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = p.post(body)
+		if err == nil {
+			atomic.AddUint64(&p.sent, 1)
+			p.Receipts.AddAcked(1)
+			return
+		}
+		if retryAfter < 0 {
+			break
+		}
+		if retryAfter == 0 {
+			retryAfter = time.Second * time.Duration(attempt+1)
+		}
+		select {
+		case <-p.stopChan:
+			break retry
+		case <-time.After(retryAfter):
+		}
+	}
+
+	logger.Error("Failed to send chat notification", "platform", p.cfg.Platform, "error", err)
+	atomic.AddUint64(&p.failed, 1)
+	p.Receipts.AddFailed(1)
+}
+
+// render executes the title and text templates
+func (p *ChatNotifyProducer) render(msg map[string]interface{}) (string, string, error) {
+	title, err := ExecuteEventTemplate(p.title, msg)
+	if err != nil {
+		return "", "", err
+	}
+	text, err := ExecuteEventTemplate(p.text, msg)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(truncateRunes(title, maxChatTextLength)), truncateRunes(text, maxChatTextLength), nil
+}
+
+// facts returns the configured fields of an event in order
+func (p *ChatNotifyProducer) facts(msg map[string]interface{}) [][2]string {
+	facts := make([][2]string, 0, len(p.cfg.Fields))
+	for _, field := range p.cfg.Fields {
+		if v, ok := GetCheckData(msg, StringToList(field)); ok {
+			facts = append(facts, [2]string{field, v})
+		}
+	}
+	return facts
+}
+
+// payload builds the webhook body of the platform
+func (p *ChatNotifyProducer) payload(title, text string, msg map[string]interface{}) ([]byte, error) {
+	facts := p.facts(msg)
+	var body interface{}
+
+	switch p.cfg.Platform {
+	case ChatPlatformSlack:
+		if !p.cfg.Blocks {
+			lines := []string{"*" + title + "*", text}
+			for _, f := range facts {
+				lines = append(lines, fmt.Sprintf("*%s:* %s", f[0], f[1]))
+			}
+			body = map[string]interface{}{"text": strings.Join(lines, "\n")}
+			break
+		}
+		blocks := []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]interface{}{"type": "plain_text", "text": truncateRunes(title, 150)},
+			},
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": truncateRunes(text, 3000)},
+			},
+		}
+		if len(facts) > 0 {
+			fields := make([]interface{}, 0, len(facts))
+			for _, f := range facts[:min(len(facts), 10)] {
+				fields = append(fields, map[string]interface{}{
+					"type": "mrkdwn",
+					"text": truncateRunes(fmt.Sprintf("*%s*\n%s", f[0], f[1]), 2000),
+				})
+			}
+			blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+		}
+		// text is the fallback shown in notifications
+		body = map[string]interface{}{"text": title, "blocks": blocks}
+
+	case ChatPlatformTeams:
+		cardBody := []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+			map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true},
+		}
+		if len(facts) > 0 {
+			factSet := make([]interface{}, 0, len(facts))
+			for _, f := range facts {
+				factSet = append(factSet, map[string]interface{}{"title": f[0], "value": f[1]})
+			}
+			cardBody = append(cardBody, map[string]interface{}{"type": "FactSet", "facts": factSet})
+		}
+		body = map[string]interface{}{
+			"type": "message",
+			"attachments": []interface{}{
+				map[string]interface{}{
+					"contentType": "application/vnd.microsoft.card.adaptive",
+					"content": map[string]interface{}{
+						"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+						"type":    "AdaptiveCard",
+						"version": "1.4",
+						"body":    cardBody,
+					},
+				},
+			},
+		}
+
+	case ChatPlatformDingTalk:
+		lines := []string{"### " + title, text}
+		for _, f := range facts {
+			lines = append(lines, fmt.Sprintf("- **%s**: %s", f[0], f[1]))
+		}
+		// DingTalk only notifies mentioned users if their mobiles appear in the text
+		for _, mobile := range p.cfg.AtMobiles {
+			lines = append(lines, "@"+mobile)
+		}
+		body = map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]interface{}{"title": title, "text": strings.Join(lines, "\n\n")},
+			"at":       map[string]interface{}{"atMobiles": p.cfg.AtMobiles, "isAtAll": p.cfg.AtAll},
+		}
+	}
+	return json.Marshal(body)
+}
+
+// webhookURL returns the URL to post to, signed for DingTalk robots with a secret
+func (p *ChatNotifyProducer) webhookURL() string {
+	if p.cfg.Platform != ChatPlatformDingTalk || p.cfg.Secret == "" {
+		return p.cfg.WebhookURL
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(p.cfg.Secret))
+	mac.Write([]byte(timestamp + "\n" + p.cfg.Secret))
+	sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	sep := "?"
+	if strings.Contains(p.cfg.WebhookURL, "?") {
+		sep = "&"
+	}
+	return p.cfg.WebhookURL + sep + "timestamp=" + timestamp + "&sign=" + sign
+}
+
+// post sends one message. retryAfter is negative when the error must not be retried,
+// zero for the default backoff, or the delay asked for by the platform.
+func (p *ChatNotifyProducer) post(body []byte) (time.Duration, error) {
+	resp, err := p.client.Post(p.webhookURL(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter := time.Duration(0)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(min(secs, 60)) * time.Second
+		}
+		return retryAfter, fmt.Errorf("%s rate limited: %s", p.cfg.Platform, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("%s returned %d: %s", p.cfg.Platform, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return -1, fmt.Errorf("%s rejected message with %d: %s", p.cfg.Platform, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	// DingTalk reports errors in the body of a 200 response
+	if p.cfg.Platform == ChatPlatformDingTalk {
+		var result struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		if json.Unmarshal(respBody, &result) == nil && result.ErrCode != 0 {
+			if result.ErrCode == dingTalkRateLimitCode {
+				return 0, fmt.Errorf("dingtalk rate limited: %s", result.ErrMsg)
+			}
+			return -1, fmt.Errorf("dingtalk error %d: %s", result.ErrCode, result.ErrMsg)
+		}
+	}
+	return 0, nil
+}
+
+// Close waits for the queued notifications to be sent once msgChan is closed by its owner, giving up after 30s
+func (p *ChatNotifyProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many notifications were sent, suppressed by the rate limit or failed
+func (p *ChatNotifyProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"sent":       atomic.LoadUint64(&p.sent),
+		"suppressed": atomic.LoadUint64(&p.suppressed),
+		"failed":     atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestChatWebhook checks that the webhook host is reachable without posting a message
+func TestChatWebhook(webhookURL string, httpCfg *OutputHTTPConfig) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid webhook_url: %s", webhookURL)
+	}
+	client, err := NewOutputHTTPClient(httpCfg, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Head(u.Scheme + "://" + u.Host)
+	if err != nil {
+		return fmt.Errorf("webhook host not reachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
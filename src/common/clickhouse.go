@@ -0,0 +1,339 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClickHouseColumn maps an event field to a table column
+type ClickHouseColumn struct {
+	Name  string `yaml:"name" json:"name"`
+	Field string `yaml:"field" json:"field"` // dot separated path, e.g. process.pid, or * for the whole event as JSON
+}
+
+// ClickHouseConfig holds the settings of a ClickHouse producer
+type ClickHouseConfig struct {
+	Hosts    []string // host:port of the native protocol, replicas are tried in order
+	Database string
+	Table    string
+	Username string
+	Password string
+	Columns  []ClickHouseColumn // empty inserts every table column from the event field of the same name
+	TLS      *KafkaTLSConfig
+
+	AsyncInsert        bool
+	WaitForAsyncInsert bool
+	Settings           map[string]string // extra query settings sent with every insert
+
+	BatchSize  int
+	FlushDur   time.Duration
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// clickhouseRetryableCodes are server errors worth retrying on another replica
+var clickhouseRetryableCodes = map[int32]bool{
+	159: true, // TIMEOUT_EXCEEDED
+	164: true, // READONLY
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: true, // NO_FREE_CONNECTION
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	225: true, // NO_ZOOKEEPER
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	279: true, // ALL_CONNECTION_TRIES_FAILED
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	999: true, // KEEPER_EXCEPTION
+}
+
+// ClickHouseProducer batches events and inserts them over the native protocol,
+// failing over to the next host when a replica is unreachable or read only
+type ClickHouseProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg      ClickHouseConfig
+	table    string
+	columns  []string
+	fields   map[string][]string
+	settings map[string]string
+
+	conn    *clickhouseConn
+	hostIdx int
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	rowsWritten   uint64
+	insertsFailed uint64
+	failovers     uint64
+}
+
+// clickhouseTable returns the quoted database.table name
+func clickhouseTable(database, table string) string {
+	if database == "" {
+		return ClickHouseQuoteIdentifier(table)
+	}
+	return ClickHouseQuoteIdentifier(database) + "." + ClickHouseQuoteIdentifier(table)
+}
+
+// NewClickHouseProducer starts inserting the events read from msgChan
+func NewClickHouseProducer(cfg ClickHouseConfig, msgChan chan map[string]interface{}) (*ClickHouseProducer, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("clickhouse hosts are required")
+	}
+	if cfg.Table == "" {
+		return nil, fmt.Errorf("clickhouse table is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.FlushDur <= 0 {
+		cfg.FlushDur = time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	p := &ClickHouseProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		table:    clickhouseTable(cfg.Database, cfg.Table),
+		fields:   make(map[string][]string, len(cfg.Columns)),
+		settings: map[string]string{},
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, col := range cfg.Columns {
+		if col.Name == "" || col.Field == "" {
+			return nil, fmt.Errorf("clickhouse column mapping needs both name and field")
+		}
+		p.columns = append(p.columns, col.Name)
+		p.fields[col.Name] = StringToList(col.Field)
+		if col.Field == "*" {
+			p.fields[col.Name] = nil
+		}
+	}
+	for k, v := range cfg.Settings {
+		p.settings[k] = v
+	}
+	if cfg.AsyncInsert {
+		p.settings["async_insert"] = "1"
+		p.settings["async_insert_deduplicate"] = "1"
+		if cfg.WaitForAsyncInsert {
+			p.settings["wait_for_async_insert"] = "1"
+		} else {
+			p.settings["wait_for_async_insert"] = "0"
+		}
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (p *ClickHouseProducer) run() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.cfg.BatchSize)
+	timer := time.NewTimer(p.cfg.FlushDur)
+	defer timer.Stop()
+	defer func() {
+		if p.conn != nil {
+			p.conn.Close()
+			p.conn = nil
+		}
+	}()
+
+	for {
+		select {
+		case <-p.stopChan:
+			p.Receipts.AddFailed(uint64(len(batch)))
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				if len(batch) > 0 {
+					p.flush(batch)
+				}
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(p.cfg.FlushDur)
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+			timer.Reset(p.cfg.FlushDur)
+		}
+	}
+}
+
+// flush inserts a batch, retrying on the next replica. Every attempt carries the same
+// deduplication token so a retry after an unknown insert status is not written twice.
+func (p *ClickHouseProducer) flush(batch []map[string]interface{}) {
+	settings := make(map[string]string, len(p.settings)+1)
+	for k, v := range p.settings {
+		settings[k] = v
+	}
+	settings["insert_deduplication_token"] = NewUUID()
+	tokens := TakeDeliveryTokens(batch)
+
+	var err error
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-p.stopChan:
+				p.Receipts.AddFailed(uint64(len(batch)))
+				tokens.Fail()
+				return
+			case <-time.After(p.cfg.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		err = p.insert(batch, settings)
+		if err == nil {
+			atomic.AddUint64(&p.rowsWritten, uint64(len(batch)))
+			p.Receipts.AddAcked(uint64(len(batch)))
+			tokens.Release()
+			return
+		}
+		if !clickhouseRetryable(err) {
+			break
+		}
+		logger.Warn("ClickHouse insert failed, failing over to next host", "host", p.cfg.Hosts[p.hostIdx], "attempt", attempt+1, "error", err)
+		p.hostIdx = (p.hostIdx + 1) % len(p.cfg.Hosts)
+		atomic.AddUint64(&p.failovers, 1)
+	}
+
+	logger.Error("Failed to insert batch into ClickHouse", "table", p.table, "rows", len(batch), "error", err)
+	atomic.AddUint64(&p.insertsFailed, 1)
+	p.Receipts.AddFailed(uint64(len(batch)))
+	tokens.Fail()
+}
+
+func (p *ClickHouseProducer) insert(batch []map[string]interface{}, settings map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go func() {
+		// Abort a blocked insert on shutdown
+		select {
+		case <-p.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if p.conn == nil {
+		conn, err := dialClickHouse(ctx, p.cfg.Hosts[p.hostIdx], p.cfg.Database, p.cfg.Username, p.cfg.Password, p.cfg.TLS)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	err := p.conn.Insert(ctx, p.table, p.columns, len(batch), settings, func(row int, column string) interface{} {
+		path, mapped := p.fields[column]
+		if !mapped {
+			path = StringToList(column)
+		} else if path == nil {
+			return AnyToString(batch[row])
+		}
+		v, ok := GetCheckDataWithType(batch[row], path)
+		if !ok {
+			return nil
+		}
+		return v
+	})
+	if err != nil {
+		// The protocol state is unknown after a failed insert
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+// clickhouseRetryable reports whether err is a connection error or a transient server error
+func clickhouseRetryable(err error) bool {
+	var exception *ClickHouseException
+	if errors.As(err, &exception) {
+		return clickhouseRetryableCodes[exception.Code]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		strings.Contains(err.Error(), "EOF") || strings.Contains(err.Error(), "connection reset")
+}
+
+// Close flushes the pending batch once msgChan is closed by its owner, giving up after 30s
+func (p *ClickHouseProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetRowsWritten returns the number of rows acknowledged by ClickHouse
+func (p *ClickHouseProducer) GetRowsWritten() uint64 {
+	return atomic.LoadUint64(&p.rowsWritten)
+}
+
+// GetFailovers returns how many times the producer switched to another host
+func (p *ClickHouseProducer) GetFailovers() uint64 {
+	return atomic.LoadUint64(&p.failovers)
+}
+
+// GetFailedInserts returns the number of batches dropped after all retries
+func (p *ClickHouseProducer) GetFailedInserts() uint64 {
+	return atomic.LoadUint64(&p.insertsFailed)
+}
+
+// TestClickHouseConnection connects to the first reachable host and checks that the table exists.
+// It returns the version of the server that answered.
+func TestClickHouseConnection(cfg ClickHouseConfig) (string, error) {
+	if len(cfg.Hosts) == 0 {
+		return "", fmt.Errorf("clickhouse hosts are required")
+	}
+	var errs []string
+	for _, host := range cfg.Hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		conn, err := dialClickHouse(ctx, host, cfg.Database, cfg.Username, cfg.Password, cfg.TLS)
+		if err != nil {
+			cancel()
+			errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+			continue
+		}
+		result, err := conn.Query(ctx, "EXISTS TABLE "+clickhouseTable(cfg.Database, cfg.Table), nil)
+		conn.Close()
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", host, err)
+		}
+		if len(result) == 0 || len(result[0].Values) == 0 || result[0].Values[0] != uint64(1) {
+			return conn.ServerVersion, fmt.Errorf("table %s does not exist", clickhouseTable(cfg.Database, cfg.Table))
+		}
+		return conn.ServerVersion, nil
+	}
+	return "", fmt.Errorf("no clickhouse host reachable: %s", strings.Join(errs, "; "))
+}
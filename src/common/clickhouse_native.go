@@ -0,0 +1,1031 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClickHouse native TCP protocol, just enough of it to ping, run small queries and
+// INSERT Native format blocks. The client speaks revision 54429 (settings serialized
+// as strings, ClickHouse 20.5+) and servers answer with the same revision.
+const (
+	clickhouseRevision     = 54429
+	clickhouseClientName   = "AgentSmith-HUB"
+	clickhouseVersionMajor = 1
+	clickhouseVersionMinor = 0
+
+	chClientHello = 0
+	chClientQuery = 1
+	chClientData  = 2
+	chClientPing  = 4
+
+	chServerHello        = 0
+	chServerData         = 1
+	chServerException    = 2
+	chServerProgress     = 3
+	chServerPong         = 4
+	chServerEndOfStream  = 5
+	chServerProfileInfo  = 6
+	chServerTotals       = 7
+	chServerExtremes     = 8
+	chServerTableColumns = 11
+
+	chStageComplete = 2
+)
+
+// ClickHouseException is an error returned by the server
+type ClickHouseException struct {
+	Code    int32
+	Name    string
+	Message string
+}
+
+func (e *ClickHouseException) Error() string {
+	return fmt.Sprintf("clickhouse exception %d (%s): %s", e.Code, e.Name, e.Message)
+}
+
+// clickhouseColumnData is one column of a block, values are decoded for the simple types only
+type clickhouseColumnData struct {
+	Name   string
+	Type   string
+	Values []interface{}
+}
+
+type clickhouseConn struct {
+	addr string
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+
+	ServerName    string
+	ServerVersion string
+	Timezone      string
+}
+
+// dialClickHouse connects to addr and performs the handshake
+func dialClickHouse(ctx context.Context, addr, database, user, password string, tlsCfg *KafkaTLSConfig) (*clickhouseConn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		cfg, err := BuildTLSConfig(tlsCfg)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(raw, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = tlsConn
+	}
+
+	c := &clickhouseConn{addr: addr, conn: raw, r: bufio.NewReader(raw), w: bufio.NewWriter(raw)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+		defer raw.SetDeadline(time.Time{})
+	}
+
+	var b chBuffer
+	b.uvarint(chClientHello)
+	b.str(clickhouseClientName)
+	b.uvarint(clickhouseVersionMajor)
+	b.uvarint(clickhouseVersionMinor)
+	b.uvarint(clickhouseRevision)
+	b.str(database)
+	b.str(user)
+	b.str(password)
+	if err := c.send(b.Bytes()); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	packet, err := c.uvarint()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	switch packet {
+	case chServerHello:
+		name, _ := c.str()
+		major, _ := c.uvarint()
+		minor, _ := c.uvarint()
+		revision, err := c.uvarint()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if revision < clickhouseRevision {
+			c.Close()
+			return nil, fmt.Errorf("clickhouse server %s revision %d is too old, %d or newer is required", addr, revision, clickhouseRevision)
+		}
+		c.ServerName = name
+		c.Timezone, _ = c.str()
+		_, _ = c.str() // display name
+		patch, err := c.uvarint()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.ServerVersion = fmt.Sprintf("%d.%d.%d", major, minor, patch)
+		return c, nil
+	case chServerException:
+		err := c.exception()
+		c.Close()
+		return nil, err
+	default:
+		c.Close()
+		return nil, fmt.Errorf("unexpected clickhouse packet %d during handshake", packet)
+	}
+}
+
+// Close closes the underlying connection, the conn can't be used afterwards
+func (c *clickhouseConn) Close() error {
+	return c.conn.Close()
+}
+
+// Ping checks that the server is still answering on this connection
+func (c *clickhouseConn) Ping(ctx context.Context) error {
+	c.setDeadline(ctx)
+	var b chBuffer
+	b.uvarint(chClientPing)
+	if err := c.send(b.Bytes()); err != nil {
+		return err
+	}
+	for {
+		packet, err := c.uvarint()
+		if err != nil {
+			return err
+		}
+		switch packet {
+		case chServerPong:
+			return nil
+		case chServerProgress:
+			if err := c.skipProgress(); err != nil {
+				return err
+			}
+		case chServerException:
+			return c.exception()
+		default:
+			return fmt.Errorf("unexpected clickhouse packet %d while waiting for pong", packet)
+		}
+	}
+}
+
+// Query runs a statement and returns the columns of all result blocks.
+// Only String, integer, Float and Bool result columns are decoded.
+func (c *clickhouseConn) Query(ctx context.Context, query string, settings map[string]string) ([]clickhouseColumnData, error) {
+	c.setDeadline(ctx)
+	if err := c.sendQuery(query, settings); err != nil {
+		return nil, err
+	}
+	var result []clickhouseColumnData
+	for {
+		packet, block, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch packet {
+		case chServerData:
+			if result == nil {
+				result = block
+				continue
+			}
+			for i := range block {
+				if i < len(result) {
+					result[i].Values = append(result[i].Values, block[i].Values...)
+				}
+			}
+		case chServerEndOfStream:
+			return result, nil
+		}
+	}
+}
+
+// Insert writes rows into table. columns selects the insert columns, empty means every column
+// of the table, and value(row, column) returns the raw event value for a cell.
+// The column types come from the sample block the server sends for the INSERT.
+func (c *clickhouseConn) Insert(ctx context.Context, table string, columns []string, rows int, settings map[string]string, value func(row int, column string) interface{}) error {
+	c.setDeadline(ctx)
+	query := "INSERT INTO " + table
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, col := range columns {
+			quoted[i] = ClickHouseQuoteIdentifier(col)
+		}
+		query += " (" + strings.Join(quoted, ", ") + ")"
+	}
+	query += " VALUES"
+	if err := c.sendQuery(query, settings); err != nil {
+		return err
+	}
+
+	var sample []clickhouseColumnData
+	for sample == nil {
+		packet, block, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch packet {
+		case chServerData:
+			sample = block
+		case chServerEndOfStream:
+			return fmt.Errorf("clickhouse ended the insert before sending the table structure")
+		}
+	}
+
+	var b chBuffer
+	b.uvarint(chClientData)
+	b.str("")
+	b.blockHeader(len(sample), rows)
+	values := make([]interface{}, rows)
+	for _, col := range sample {
+		for i := range values {
+			values[i] = value(i, col.Name)
+		}
+		b.str(col.Name)
+		b.str(col.Type)
+		if err := chEncodeColumn(&b, col.Type, values); err != nil {
+			// The connection is mid-insert, callers drop it on error
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+	}
+	if err := c.send(b.Bytes()); err != nil {
+		return err
+	}
+	if err := c.sendEmptyBlock(); err != nil {
+		return err
+	}
+
+	for {
+		packet, _, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if packet == chServerEndOfStream {
+			return nil
+		}
+	}
+}
+
+func (c *clickhouseConn) setDeadline(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	_ = c.conn.SetDeadline(deadline)
+}
+
+func (c *clickhouseConn) sendQuery(query string, settings map[string]string) error {
+	hostname, _ := os.Hostname()
+	var b chBuffer
+	b.uvarint(chClientQuery)
+	b.str(NewUUID())
+
+	// client info
+	b.byte(1) // initial query
+	b.str("") // initial user
+	b.str("") // initial query id
+	b.str("0.0.0.0:0")
+	b.byte(1) // TCP interface
+	b.str(os.Getenv("USER"))
+	b.str(hostname)
+	b.str(clickhouseClientName)
+	b.uvarint(clickhouseVersionMajor)
+	b.uvarint(clickhouseVersionMinor)
+	b.uvarint(clickhouseRevision)
+	b.str("") // quota key
+	b.uvarint(0)
+
+	// settings as strings, flags 0 lets older servers ignore settings they don't know
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.str(name)
+		b.uvarint(0)
+		b.str(settings[name])
+	}
+	b.str("")
+
+	b.uvarint(chStageComplete)
+	b.uvarint(0) // no compression
+	b.str(query)
+	if err := c.send(b.Bytes()); err != nil {
+		return err
+	}
+	// End of external tables
+	return c.sendEmptyBlock()
+}
+
+func (c *clickhouseConn) sendEmptyBlock() error {
+	var b chBuffer
+	b.uvarint(chClientData)
+	b.str("")
+	b.blockHeader(0, 0)
+	return c.send(b.Bytes())
+}
+
+func (c *clickhouseConn) send(data []byte) error {
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// receive reads the next server packet, skipping progress and metadata packets
+func (c *clickhouseConn) receive() (uint64, []clickhouseColumnData, error) {
+	for {
+		packet, err := c.uvarint()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch packet {
+		case chServerData, chServerTotals, chServerExtremes:
+			if _, err := c.str(); err != nil {
+				return 0, nil, err
+			}
+			block, err := c.block()
+			if err != nil {
+				return 0, nil, err
+			}
+			if packet != chServerData {
+				continue
+			}
+			return packet, block, nil
+		case chServerException:
+			return 0, nil, c.exception()
+		case chServerProgress:
+			if err := c.skipProgress(); err != nil {
+				return 0, nil, err
+			}
+		case chServerProfileInfo:
+			for _, read := range []func() error{c.skipUvarint, c.skipUvarint, c.skipUvarint, c.skipByte, c.skipUvarint, c.skipByte} {
+				if err := read(); err != nil {
+					return 0, nil, err
+				}
+			}
+		case chServerTableColumns:
+			if _, err := c.str(); err != nil {
+				return 0, nil, err
+			}
+			if _, err := c.str(); err != nil {
+				return 0, nil, err
+			}
+		case chServerEndOfStream:
+			return packet, nil, nil
+		default:
+			return 0, nil, fmt.Errorf("unexpected clickhouse packet %d", packet)
+		}
+	}
+}
+
+func (c *clickhouseConn) block() ([]clickhouseColumnData, error) {
+	// block info: field 1 is_overflows, field 2 bucket_num, 0 terminates
+	for {
+		field, err := c.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if field == 0 {
+			break
+		}
+		switch field {
+		case 1:
+			err = c.skipByte()
+		case 2:
+			_, err = io.ReadFull(c.r, make([]byte, 4))
+		default:
+			err = fmt.Errorf("unknown clickhouse block info field %d", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	numColumns, err := c.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	numRows, err := c.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]clickhouseColumnData, numColumns)
+	for i := range columns {
+		if columns[i].Name, err = c.str(); err != nil {
+			return nil, err
+		}
+		if columns[i].Type, err = c.str(); err != nil {
+			return nil, err
+		}
+		if numRows > 0 {
+			if columns[i].Values, err = c.decodeColumn(columns[i].Type, int(numRows)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return columns, nil
+}
+
+func (c *clickhouseConn) decodeColumn(typ string, rows int) ([]interface{}, error) {
+	values := make([]interface{}, rows)
+	if typ == "String" {
+		for i := range values {
+			s, err := c.str()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = s
+		}
+		return values, nil
+	}
+	size, signed, float := chNumericType(typ)
+	if size == 0 {
+		return nil, fmt.Errorf("decoding clickhouse column type %s is not supported", typ)
+	}
+	buf := make([]byte, size)
+	for i := range values {
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		var u uint64
+		for j := size - 1; j >= 0; j-- {
+			u = u<<8 | uint64(buf[j])
+		}
+		switch {
+		case float && size == 4:
+			values[i] = float64(math.Float32frombits(uint32(u)))
+		case float:
+			values[i] = math.Float64frombits(u)
+		case typ == "Bool":
+			values[i] = u != 0
+		case signed:
+			shift := 64 - 8*size
+			values[i] = int64(u<<shift) >> shift
+		default:
+			values[i] = u
+		}
+	}
+	return values, nil
+}
+
+func (c *clickhouseConn) exception() error {
+	var first *ClickHouseException
+	for {
+		var code int32
+		if err := binary.Read(c.r, binary.LittleEndian, &code); err != nil {
+			return err
+		}
+		name, _ := c.str()
+		message, _ := c.str()
+		_, _ = c.str() // stack trace
+		nested, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = &ClickHouseException{Code: code, Name: name, Message: message}
+		}
+		if nested == 0 {
+			return first
+		}
+	}
+}
+
+func (c *clickhouseConn) skipProgress() error {
+	// rows, bytes, total rows, written rows, written bytes
+	for i := 0; i < 5; i++ {
+		if err := c.skipUvarint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clickhouseConn) uvarint() (uint64, error) {
+	return binary.ReadUvarint(c.r)
+}
+
+func (c *clickhouseConn) skipUvarint() error {
+	_, err := c.uvarint()
+	return err
+}
+
+func (c *clickhouseConn) skipByte() error {
+	_, err := c.r.ReadByte()
+	return err
+}
+
+func (c *clickhouseConn) str() (string, error) {
+	n, err := c.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<30 {
+		return "", fmt.Errorf("clickhouse string of %d bytes is too large", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// chBuffer encodes protocol primitives
+type chBuffer struct {
+	bytes.Buffer
+}
+
+func (b *chBuffer) uvarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	b.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func (b *chBuffer) byte(v byte) {
+	b.WriteByte(v)
+}
+
+func (b *chBuffer) str(s string) {
+	b.uvarint(uint64(len(s)))
+	b.WriteString(s)
+}
+
+func (b *chBuffer) fixed(v uint64, size int) {
+	for i := 0; i < size; i++ {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+func (b *chBuffer) blockHeader(columns, rows int) {
+	b.uvarint(1)
+	b.byte(0) // is_overflows
+	b.uvarint(2)
+	b.fixed(math.MaxUint32, 4) // bucket_num -1
+	b.uvarint(0)
+	b.uvarint(uint64(columns))
+	b.uvarint(uint64(rows))
+}
+
+// ClickHouseQuoteIdentifier quotes a column, database or table name with backticks
+func ClickHouseQuoteIdentifier(name string) string {
+	return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+}
+
+// chNumericType returns the byte size of a fixed width numeric type, 0 for other types
+func chNumericType(typ string) (size int, signed, float bool) {
+	switch typ {
+	case "UInt8", "Bool":
+		return 1, false, false
+	case "UInt16":
+		return 2, false, false
+	case "UInt32":
+		return 4, false, false
+	case "UInt64":
+		return 8, false, false
+	case "Int8":
+		return 1, true, false
+	case "Int16":
+		return 2, true, false
+	case "Int32":
+		return 4, true, false
+	case "Int64":
+		return 8, true, false
+	case "Float32":
+		return 4, true, true
+	case "Float64":
+		return 8, true, true
+	}
+	return 0, false, false
+}
+
+// chTypeArgs splits "Name(a, b)" into Name and its top level arguments
+func chTypeArgs(typ string) (string, []string) {
+	open := strings.IndexByte(typ, '(')
+	if open < 0 || !strings.HasSuffix(typ, ")") {
+		return typ, nil
+	}
+	var args []string
+	depth, start, quoted := 0, open+1, false
+	inner := typ[:len(typ)-1]
+	for i := open + 1; i < len(inner); i++ {
+		switch ch := inner[i]; {
+		case ch == '\\' && quoted:
+			i++
+		case ch == '\'':
+			quoted = !quoted
+		case quoted:
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	args = append(args, strings.TrimSpace(inner[start:]))
+	return typ[:open], args
+}
+
+// ClickHouseTypeSupported reports whether values can be written into a column of type typ
+func ClickHouseTypeSupported(typ string) bool {
+	return chEncodeColumn(&chBuffer{}, typ, nil) == nil
+}
+
+// chEncodeColumn writes values as a Native format column of type typ.
+// Values that can't be converted are written as the type's default value, nil is NULL for Nullable columns.
+func chEncodeColumn(b *chBuffer, typ string, values []interface{}) error {
+	if size, signed, float := chNumericType(typ); size > 0 {
+		for _, v := range values {
+			switch {
+			case typ == "Bool":
+				if chBool(v) {
+					b.byte(1)
+				} else {
+					b.byte(0)
+				}
+			case float && size == 4:
+				f, _ := chFloat(v)
+				b.fixed(uint64(math.Float32bits(float32(f))), 4)
+			case float:
+				f, _ := chFloat(v)
+				b.fixed(math.Float64bits(f), 8)
+			case signed:
+				n, _ := chInt(v)
+				b.fixed(uint64(n), size)
+			default:
+				n, _ := chUint(v)
+				b.fixed(n, size)
+			}
+		}
+		return nil
+	}
+
+	name, args := chTypeArgs(typ)
+	switch name {
+	case "String":
+		for _, v := range values {
+			if v == nil {
+				b.str("")
+			} else {
+				b.str(AnyToString(v))
+			}
+		}
+	case "FixedString":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		for _, v := range values {
+			s := ""
+			if v != nil {
+				s = AnyToString(v)
+			}
+			buf := make([]byte, n)
+			copy(buf, s)
+			b.Write(buf)
+		}
+	case "Date", "Date32":
+		for _, v := range values {
+			t, _ := chTime(v)
+			days := t.Unix() / 86400
+			if t.IsZero() || days < 0 {
+				days = 0
+			}
+			if name == "Date" {
+				b.fixed(uint64(days), 2)
+			} else {
+				b.fixed(uint64(days), 4)
+			}
+		}
+	case "DateTime":
+		for _, v := range values {
+			t, _ := chTime(v)
+			sec := t.Unix()
+			if t.IsZero() || sec < 0 {
+				sec = 0
+			}
+			b.fixed(uint64(sec), 4)
+		}
+	case "DateTime64":
+		if len(args) == 0 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		precision, err := strconv.Atoi(args[0])
+		if err != nil || precision < 0 || precision > 9 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		scale := int64(math.Pow10(9 - precision))
+		for _, v := range values {
+			t, _ := chTime(v)
+			ticks := int64(0)
+			if !t.IsZero() {
+				ticks = t.UnixNano() / scale
+			}
+			b.fixed(uint64(ticks), 8)
+		}
+	case "UUID":
+		for _, v := range values {
+			var u [16]byte
+			if s, ok := v.(string); ok {
+				if raw, err := hex.DecodeString(strings.ReplaceAll(s, "-", "")); err == nil && len(raw) == 16 {
+					copy(u[:], raw)
+				}
+			}
+			// Two little endian UInt64 halves
+			for i := 7; i >= 0; i-- {
+				b.byte(u[i])
+			}
+			for i := 15; i >= 8; i-- {
+				b.byte(u[i])
+			}
+		}
+	case "IPv4":
+		for _, v := range values {
+			var n uint32
+			if s, ok := v.(string); ok {
+				if ip := net.ParseIP(s).To4(); ip != nil {
+					n = binary.BigEndian.Uint32(ip)
+				}
+			}
+			b.fixed(uint64(n), 4)
+		}
+	case "IPv6":
+		for _, v := range values {
+			ip := make(net.IP, 16)
+			if s, ok := v.(string); ok {
+				if parsed := net.ParseIP(s).To16(); parsed != nil {
+					ip = parsed
+				}
+			}
+			b.Write(ip)
+		}
+	case "Enum8", "Enum16":
+		codes := make(map[string]int64, len(args))
+		for _, arg := range args {
+			label, code, ok := strings.Cut(arg, "=")
+			label = strings.TrimSpace(label)
+			if !ok || len(label) < 2 || label[0] != '\'' {
+				return fmt.Errorf("invalid type %s", typ)
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(code), 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid type %s", typ)
+			}
+			codes[strings.ReplaceAll(label[1:len(label)-1], "\\'", "'")] = n
+		}
+		size := 1
+		if name == "Enum16" {
+			size = 2
+		}
+		for _, v := range values {
+			n, ok := codes[AnyToString(v)]
+			if !ok {
+				n, _ = chInt(v)
+			}
+			b.fixed(uint64(n), size)
+		}
+	case "Nullable":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		for _, v := range values {
+			if v == nil {
+				b.byte(1)
+			} else {
+				b.byte(0)
+			}
+		}
+		return chEncodeColumn(b, args[0], values)
+	case "Array":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		var flat []interface{}
+		for _, v := range values {
+			if list, ok := v.([]interface{}); ok {
+				flat = append(flat, list...)
+			}
+			b.fixed(uint64(len(flat)), 8)
+		}
+		return chEncodeColumn(b, args[0], flat)
+	case "Map":
+		if len(args) != 2 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		var keys, items []interface{}
+		for _, v := range values {
+			if m, ok := v.(map[string]interface{}); ok {
+				sorted := make([]string, 0, len(m))
+				for k := range m {
+					sorted = append(sorted, k)
+				}
+				sort.Strings(sorted)
+				for _, k := range sorted {
+					keys = append(keys, k)
+					items = append(items, m[k])
+				}
+			}
+			b.fixed(uint64(len(keys)), 8)
+		}
+		if err := chEncodeColumn(b, args[0], keys); err != nil {
+			return err
+		}
+		return chEncodeColumn(b, args[1], items)
+	case "LowCardinality":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid type %s", typ)
+		}
+		return chEncodeLowCardinality(b, args[0], values)
+	default:
+		return fmt.Errorf("unsupported clickhouse column type %s", typ)
+	}
+	return nil
+}
+
+// chEncodeLowCardinality writes values with a per block dictionary. The dictionary
+// starts with the default value, preceded by NULL for LowCardinality(Nullable(T)).
+func chEncodeLowCardinality(b *chBuffer, inner string, values []interface{}) error {
+	nullable := false
+	dictType := inner
+	if name, args := chTypeArgs(inner); name == "Nullable" && len(args) == 1 {
+		nullable = true
+		dictType = args[0]
+	}
+	if err := chEncodeColumn(&chBuffer{}, dictType, nil); err != nil {
+		return err
+	}
+
+	var dict []interface{}
+	index := make(map[string]uint64)
+	if nullable {
+		dict = append(dict, nil)
+	}
+	dict = append(dict, nil) // default value
+	defaultKey := uint64(len(dict) - 1)
+	keys := make([]uint64, len(values))
+	for i, v := range values {
+		if v == nil {
+			if nullable {
+				keys[i] = 0
+			} else {
+				keys[i] = defaultKey
+			}
+			continue
+		}
+		s := AnyToString(v)
+		k, ok := index[s]
+		if !ok {
+			k = uint64(len(dict))
+			index[s] = k
+			dict = append(dict, v)
+		}
+		keys[i] = k
+	}
+
+	keySize, keyType := 1, uint64(0)
+	switch n := uint64(len(dict)); {
+	case n > math.MaxUint32:
+		keySize, keyType = 8, 3
+	case n > math.MaxUint16:
+		keySize, keyType = 4, 2
+	case n > math.MaxUint8:
+		keySize, keyType = 2, 1
+	}
+
+	b.fixed(1, 8) // shared dictionaries with additional keys
+	if len(values) == 0 {
+		return nil
+	}
+	// has additional keys | need update dictionary | key type
+	b.fixed(1<<9|1<<10|keyType, 8)
+	b.fixed(uint64(len(dict)), 8)
+	if err := chEncodeColumn(b, dictType, dict); err != nil {
+		return err
+	}
+	b.fixed(uint64(len(keys)), 8)
+	for _, k := range keys {
+		b.fixed(k, keySize)
+	}
+	return nil
+}
+
+func chBool(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case string:
+		parsed, _ := strconv.ParseBool(x)
+		return parsed
+	}
+	n, _ := chFloat(v)
+	return n != 0
+}
+
+func chFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func chInt(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint64:
+		return int64(x), true
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+			return n, true
+		}
+	}
+	f, ok := chFloat(v)
+	return int64(f), ok
+}
+
+func chUint(v interface{}) (uint64, bool) {
+	switch x := v.(type) {
+	case uint64:
+		return x, true
+	case string:
+		if n, err := strconv.ParseUint(strings.TrimSpace(x), 10, 64); err == nil {
+			return n, true
+		}
+	}
+	n, ok := chInt(v)
+	if n < 0 {
+		return 0, false
+	}
+	return uint64(n), ok
+}
+
+// chTime converts RFC 3339 / "YYYY-MM-DD hh:mm:ss" strings and unix timestamps in
+// seconds, milliseconds, microseconds or nanoseconds to a time
+func chTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+	}
+	f, ok := chFloat(v)
+	if !ok {
+		return time.Time{}, false
+	}
+	abs := math.Abs(f)
+	switch {
+	case abs < 1e11:
+		return time.Unix(0, int64(f*1e9)), true
+	case abs < 1e14:
+		return time.UnixMilli(int64(f)), true
+	case abs < 1e17:
+		return time.UnixMicro(int64(f)), true
+	default:
+		return time.Unix(0, int64(f)), true
+	}
+}
@@ -0,0 +1,302 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Expected Native format columns, from the ClickHouse docs on the Native format and the
+// serialization of each data type
+func TestClickHouseColumnGoldenEncode(t *testing.T) {
+	for _, tc := range []struct {
+		typ    string
+		values []interface{}
+		golden string
+	}{
+		{"UInt8", []interface{}{1, "255"}, "01ff"},
+		{"Int32", []interface{}{-1, float64(2)}, "ffffffff02000000"},
+		{"UInt64", []interface{}{uint64(1 << 63)}, "0000000000000080"},
+		{"Float32", []interface{}{1.5}, "0000c03f"},
+		{"Float64", []interface{}{"-2.25"}, "00000000000002c0"},
+		{"Bool", []interface{}{true, "false", 0}, "010000"},
+		{"String", []interface{}{"ab", nil, 5}, "02616200" + "0135"},
+		{"FixedString(3)", []interface{}{"ab", "abcd"}, "616200" + "616263"},
+		{"Date", []interface{}{"1970-01-11"}, "0a00"},
+		{"DateTime", []interface{}{"2024-01-15T10:00:01Z", nil}, "2102a565" + "00000000"},
+		{"DateTime64(3)", []interface{}{int64(1705312801123)}, "6351900c8d010000"},
+		{"UUID", []interface{}{"01234567-89ab-cdef-0123-456789abcdef"}, "efcdab8967452301" + "efcdab8967452301"},
+		{"IPv4", []interface{}{"10.0.0.1"}, "0100000a"},
+		{"IPv6", []interface{}{"::1"}, "00000000000000000000000000000001"},
+		{"Enum8('a' = 1, 'b' = 2)", []interface{}{"b", "x"}, "0200"},
+		{"Nullable(Int8)", []interface{}{nil, 3}, "0100" + "0003"},
+		// offsets are cumulative, followed by the flattened elements
+		{"Array(UInt8)", []interface{}{[]interface{}{1, 2}, nil, []interface{}{3}},
+			"0200000000000000" + "0200000000000000" + "0300000000000000" + "010203"},
+		// keys are sorted, keys and values are written as two columns
+		{"Map(String, UInt16)", []interface{}{map[string]interface{}{"b": 2, "a": 1}},
+			"0200000000000000" + "0161" + "0162" + "0100" + "0200"},
+		// version, flags (additional keys, update dictionary, UInt8 keys), dictionary with the default value first, keys
+		{"LowCardinality(String)", []interface{}{"x", "y", "x", nil},
+			"0100000000000000" + "0006000000000000" + "0300000000000000" + "00" + "0178" + "0179" + "0400000000000000" + "01020100"},
+		// NULL takes dictionary key 0, the default value key 1
+		{"LowCardinality(Nullable(String))", []interface{}{nil, "x"},
+			"0100000000000000" + "0006000000000000" + "0300000000000000" + "00" + "00" + "0178" + "0200000000000000" + "0002"},
+	} {
+		var b chBuffer
+		if err := chEncodeColumn(&b, tc.typ, tc.values); err != nil {
+			t.Errorf("%s: %v", tc.typ, err)
+			continue
+		}
+		if got := hex.EncodeToString(b.Bytes()); got != tc.golden {
+			t.Errorf("%s: encoded %s, want %s", tc.typ, got, tc.golden)
+		}
+	}
+
+	for _, typ := range []string{"Decimal(10, 2)", "Tuple(String, UInt8)", "FixedString(0)", "Nullable(Object('json'))"} {
+		if ClickHouseTypeSupported(typ) {
+			t.Errorf("%s reported as supported", typ)
+		}
+	}
+}
+
+// chTestServer reads the client side of the protocol
+type chTestServer struct {
+	t *testing.T
+	r *bufio.Reader
+	w net.Conn
+}
+
+func (s *chTestServer) uvarint() uint64 {
+	v, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		s.t.Errorf("server read: %v", err)
+	}
+	return v
+}
+
+func (s *chTestServer) str() string {
+	buf := make([]byte, s.uvarint())
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		s.t.Errorf("server read: %v", err)
+	}
+	return string(buf)
+}
+
+func (s *chTestServer) expect(what, golden string) {
+	want, _ := hex.DecodeString(golden)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(s.r, got); err != nil {
+		s.t.Errorf("%s: %v", what, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		s.t.Errorf("%s: client sent %x, want %x", what, got, want)
+	}
+}
+
+func (s *chTestServer) send(golden string) {
+	raw, _ := hex.DecodeString(golden)
+	if _, err := s.w.Write(raw); err != nil {
+		s.t.Errorf("server write: %v", err)
+	}
+}
+
+// readQuery consumes a Query packet and the empty external tables block that follows it
+func (s *chTestServer) readQuery() (query string, settings map[string]string) {
+	if p := s.uvarint(); p != chClientQuery {
+		s.t.Fatalf("packet %d, want query", p)
+	}
+	s.str() // query id
+	s.r.ReadByte()
+	s.str()
+	s.str()
+	s.str()
+	s.r.ReadByte()
+	s.str()
+	s.str()
+	if name := s.str(); name != clickhouseClientName {
+		s.t.Errorf("client name %q", name)
+	}
+	s.uvarint()
+	s.uvarint()
+	if rev := s.uvarint(); rev != clickhouseRevision {
+		s.t.Errorf("client info revision %d", rev)
+	}
+	s.str()
+	s.uvarint()
+	settings = make(map[string]string)
+	for name := s.str(); name != ""; name = s.str() {
+		if flags := s.uvarint(); flags != 0 {
+			s.t.Errorf("setting %s flags %d", name, flags)
+		}
+		settings[name] = s.str()
+	}
+	if stage := s.uvarint(); stage != chStageComplete {
+		s.t.Errorf("stage %d", stage)
+	}
+	if compression := s.uvarint(); compression != 0 {
+		s.t.Errorf("compression %d", compression)
+	}
+	query = s.str()
+	s.expect("end of external tables", chGoldenEmptyBlock)
+	return query, settings
+}
+
+func chHex(s string) string {
+	return hex.EncodeToString(append([]byte{byte(len(s))}, s...))
+}
+
+const (
+	// Data packet, no temporary table, block info {is_overflows false, bucket_num -1}
+	chGoldenBlockStart = "02" + "00" + "0100" + "02ffffffff" + "00"
+	chGoldenEmptyBlock = chGoldenBlockStart + "00" + "00"
+	// Hello of a 24.3.2 server at revision 54460
+	chGoldenServerHello = "00" + "0a436c69636b486f757365" + "18" + "03" + "bca903" + "03555443" + "03636831" + "02"
+)
+
+// startClickHouseServer accepts one connection, checks the client hello and runs serve
+func startClickHouseServer(t *testing.T, serve func(s *chTestServer)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		s := &chTestServer{t: t, r: bufio.NewReader(conn), w: conn}
+		s.expect("client hello", "00"+chHex("AgentSmith-HUB")+"01"+"00"+"9da903"+chHex("logs")+chHex("hub")+chHex("secret"))
+		serve(s)
+	}()
+	return ln.Addr().String()
+}
+
+func TestClickHouseHandshakeAndInsert(t *testing.T) {
+	addr := startClickHouseServer(t, func(s *chTestServer) {
+		s.send(chGoldenServerHello)
+
+		query, settings := s.readQuery()
+		if query != "INSERT INTO logs.events (`id`, `msg`) VALUES" {
+			t.Errorf("query %q", query)
+		}
+		if !reflect.DeepEqual(settings, map[string]string{"async_insert": "1"}) {
+			t.Errorf("settings %v", settings)
+		}
+
+		// Table columns metadata, then the sample block with the structure of the insert
+		s.send("0b" + "00" + chHex("columns format version: 1"))
+		s.send("01" + "00" + "0100" + "02ffffffff" + "00" + "02" + "00" + chHex("id") + chHex("UInt32") + chHex("msg") + chHex("Nullable(String)"))
+
+		s.expect("data block", chGoldenBlockStart+"02"+"02"+
+			chHex("id")+chHex("UInt32")+"01000000"+"02000000"+
+			chHex("msg")+chHex("Nullable(String)")+"0001"+"026869"+"00")
+		s.expect("end of data", chGoldenEmptyBlock)
+
+		// Progress: read rows, bytes, total rows, written rows, written bytes
+		s.send("03" + "00" + "00" + "00" + "02" + "10")
+		s.send("05")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := dialClickHouse(ctx, addr, "logs", "hub", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.ServerName != "ClickHouse" || c.ServerVersion != "24.3.2" || c.Timezone != "UTC" {
+		t.Errorf("server %s %s %s", c.ServerName, c.ServerVersion, c.Timezone)
+	}
+
+	rows := []map[string]interface{}{{"id": 1, "msg": "hi"}, {"id": 2}}
+	err = c.Insert(ctx, "logs.events", []string{"id", "msg"}, len(rows), map[string]string{"async_insert": "1"},
+		func(row int, column string) interface{} { return rows[row][column] })
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClickHouseQueryDecodesBlocks(t *testing.T) {
+	addr := startClickHouseServer(t, func(s *chTestServer) {
+		s.send(chGoldenServerHello)
+		if query, _ := s.readQuery(); query != "SELECT name, n, f, ok FROM t" {
+			t.Errorf("query %q", query)
+		}
+		header := chHex("name") + chHex("String") + chHex("n") + chHex("Int16") + chHex("f") + chHex("Float32") + chHex("ok") + chHex("Bool")
+		// Empty header block, then two data blocks split across rows
+		s.send("01" + "00" + "0100" + "02ffffffff" + "00" + "04" + "00" + header)
+		s.send("01" + "00" + "0100" + "02ffffffff" + "00" + "04" + "01" +
+			chHex("name") + chHex("String") + chHex("a") +
+			chHex("n") + chHex("Int16") + "feff" +
+			chHex("f") + chHex("Float32") + "0000c03f" +
+			chHex("ok") + chHex("Bool") + "01")
+		// Totals blocks are skipped
+		s.send("07" + "00" + "0100" + "02ffffffff" + "00" + "01" + "01" + chHex("n") + chHex("Int16") + "0100")
+		s.send("01" + "00" + "0100" + "02ffffffff" + "00" + "04" + "01" +
+			chHex("name") + chHex("String") + chHex("b") +
+			chHex("n") + chHex("Int16") + "0700" +
+			chHex("f") + chHex("Float32") + "00000000" +
+			chHex("ok") + chHex("Bool") + "00")
+		// ProfileInfo: rows, blocks, bytes, applied_limit, rows_before_limit, calculated_rows_before_limit
+		s.send("06" + "02" + "02" + "20" + "00" + "00" + "00")
+		s.send("05")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := dialClickHouse(ctx, addr, "logs", "hub", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.Query(ctx, "SELECT name, n, f, ok FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []clickhouseColumnData{
+		{Name: "name", Type: "String", Values: []interface{}{"a", "b"}},
+		{Name: "n", Type: "Int16", Values: []interface{}{int64(-2), int64(7)}},
+		{Name: "f", Type: "Float32", Values: []interface{}{1.5, 0.0}},
+		{Name: "ok", Type: "Bool", Values: []interface{}{true, false}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("result %#v\nwant %#v", result, want)
+	}
+}
+
+func TestClickHouseException(t *testing.T) {
+	addr := startClickHouseServer(t, func(s *chTestServer) {
+		// code 516, nested exception following
+		s.send("02" + "04020000" + chHex("DB::Exception") + chHex("hub: Authentication failed") + chHex("stack") + "01" +
+			"e8030000" + chHex("DB::Exception") + chHex("nested") + chHex("") + "00")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := dialClickHouse(ctx, addr, "logs", "hub", "secret", nil)
+	var chErr *ClickHouseException
+	if !errors.As(err, &chErr) || chErr.Code != 516 || chErr.Name != "DB::Exception" || !strings.Contains(chErr.Message, "Authentication failed") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 // ClusterState manages the centralized cluster state
@@ -11,6 +12,11 @@ type ClusterState struct {
 	isLeader bool
 	nodeID   string
 	leaderID string
+
+	// Set when the leader lost its lock; the node keeps running its projects but refuses writes
+	steppedDown    bool
+	stepDownReason string
+	stepDownAt     time.Time
 }
 
 // Global cluster state instance
@@ -43,6 +49,33 @@ func GetNodeID() string {
 	return globalClusterState.nodeID
 }
 
+// SetLeaderSteppedDown marks the leader as stepped down after losing the leader lock
+func SetLeaderSteppedDown(reason string) {
+	globalClusterState.mu.Lock()
+	defer globalClusterState.mu.Unlock()
+
+	globalClusterState.steppedDown = true
+	globalClusterState.stepDownReason = reason
+	globalClusterState.stepDownAt = time.Now()
+}
+
+// ClearLeaderSteppedDown clears the step down flag once the leader lock is held again
+func ClearLeaderSteppedDown() {
+	globalClusterState.mu.Lock()
+	defer globalClusterState.mu.Unlock()
+
+	globalClusterState.steppedDown = false
+	globalClusterState.stepDownReason = ""
+	globalClusterState.stepDownAt = time.Time{}
+}
+
+// IsLeaderSteppedDown returns whether the leader lost its lock, with the reason and time
+func IsLeaderSteppedDown() (bool, string, time.Time) {
+	globalClusterState.mu.RLock()
+	defer globalClusterState.mu.RUnlock()
+	return globalClusterState.steppedDown, globalClusterState.stepDownReason, globalClusterState.stepDownAt
+}
+
 // RequireLeader returns an error if current node is not the leader
 func RequireLeader() error {
 	if !IsCurrentNodeLeader() {
@@ -14,6 +14,10 @@ type ComponentMonitor struct {
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
 	interval time.Duration
+
+	// custom health probes by name, each runs on its own interval
+	probesMu sync.RWMutex
+	probes   map[string]*healthProbe
 }
 
 // NewComponentMonitor creates a new component monitor instance
@@ -23,6 +27,7 @@ func NewComponentMonitor(interval time.Duration) *ComponentMonitor {
 		ctx:      ctx,
 		cancel:   cancel,
 		interval: interval,
+		probes:   make(map[string]*healthProbe),
 	}
 }
 
@@ -87,6 +92,16 @@ func (cm *ComponentMonitor) performHealthCheck() {
 		}
 	}()
 
+	// Open breakers are reported without failing the project, the producer recovers on its own
+	for _, b := range GetOutputBreakerStatuses(true) {
+		logger.Warn("Output circuit breaker not closed",
+			"output", b.Output,
+			"project_node_sequence", b.ProjectNodeSequence,
+			"state", b.State,
+			"rejected", b.Rejected,
+			"error", b.LastError)
+	}
+
 	// Get all component errors using the registered checker
 	componentErrors := CheckAllProjectComponents()
 
@@ -12,7 +12,7 @@ import (
 
 // ComponentInfo represents a component extracted from ProjectNodeSequence
 type ComponentInfo struct {
-	Type string // input, output, ruleset, plugin_success, plugin_failure
+	Type string // input, output, ruleset, plugin_success, plugin_failure, rule_suppressed, rule_excluded
 	ID   string // component identifier
 }
 
@@ -21,6 +21,8 @@ type ComponentInfo struct {
 //   - "INPUT.kafka1" -> [{Type: "input", ID: "kafka1"}]
 //   - "INPUT.kafka1.RULESET.test.OUTPUT.print" -> [{Type: "input", ID: "kafka1"}, {Type: "ruleset", ID: "test"}, {Type: "output", ID: "print"}]
 //   - "PLUGIN.hash_md5.success" -> [{Type: "plugin_success", ID: "hash_md5"}]
+//   - "SUPPRESS.test.rule1" -> [{Type: "rule_suppressed", ID: "test"}]
+//   - "EXCLUDE.test.rule1" -> [{Type: "rule_excluded", ID: "test"}]
 func ParseProjectNodeSequence(sequence string) []ComponentInfo {
 	if sequence == "" {
 		return nil
@@ -41,6 +43,24 @@ func ParseProjectNodeSequence(sequence string) []ComponentInfo {
 					ID:   parts[i+1],
 				})
 			}
+		case "suppress":
+			// Suppression sequences are like "SUPPRESS.ruleset_id.rule_id"
+			if i+2 < len(parts) {
+				components = append(components, ComponentInfo{
+					Type: "rule_suppressed",
+					ID:   parts[i+1],
+				})
+				i++ // Skip the rule ID
+			}
+		case "exclude":
+			// Exclusion sequences are like "EXCLUDE.ruleset_id.rule_id"
+			if i+2 < len(parts) {
+				components = append(components, ComponentInfo{
+					Type: "rule_excluded",
+					ID:   parts[i+1],
+				})
+				i++ // Skip the rule ID
+			}
 		case "plugin":
 			// Plugin sequences are like "PLUGIN.plugin_name.success" or "PLUGIN.plugin_name.failure"
 			if i+2 < len(parts) {
@@ -71,10 +91,19 @@ func ParseProjectNodeSequence(sequence string) []ComponentInfo {
 //   - "INPUT.kafka1" -> "input" (last component type is INPUT)
 //   - "INPUT.kafka1.RULESET.test.OUTPUT.print" -> "output" (last component type is OUTPUT)
 //   - "PLUGIN.hash_md5.success" -> "plugin_success" (ends with success after PLUGIN)
+//   - "SUPPRESS.test.rule1" -> "rule_suppressed" (matches suppressed by a rule)
+//   - "EXCLUDE.test.rule1" -> "rule_excluded" (events dropped by a rule of an EXCLUDE ruleset)
 func GetComponentTypeFromSequence(sequence, fallbackType string) string {
 	if sequence == "" {
 		return fallbackType
 	}
+	// The rule ID may be any word, so suppression sequences are recognized by their prefix
+	if strings.HasPrefix(strings.ToUpper(sequence), "SUPPRESS.") {
+		return "rule_suppressed"
+	}
+	if strings.HasPrefix(strings.ToUpper(sequence), "EXCLUDE.") {
+		return "rule_excluded"
+	}
 
 	// Split by dots and scan backwards to find the last component type
 	parts := strings.Split(sequence, ".")
@@ -126,16 +155,14 @@ type DailyStatsManager struct {
 	stopChan       chan struct{}
 	redisKeyPrefix string
 	saveInterval   time.Duration
-	retentionDays  int
 }
 
 // NewDailyStatsManager creates a new daily statistics manager instance
 func NewDailyStatsManager() *DailyStatsManager {
 	dsm := &DailyStatsManager{
 		stopChan:       make(chan struct{}),
-		redisKeyPrefix: "hub:daily_stats:", // Redis key prefix
+		redisKeyPrefix: dailyStatsKeyPrefix,
 		saveInterval:   30 * time.Second,
-		retentionDays:  10,
 	}
 
 	go dsm.persistenceLoop()
@@ -169,7 +196,7 @@ func (dsm *DailyStatsManager) parserKey(key string) (res DailyStatsData, err err
 	if len(ss) != 4 {
 		return res, fmt.Errorf("invalid key format: %s", key)
 	} else {
-		msgT, err := RedisGet(key)
+		msgT, err := RedisReadGet(key)
 		if err != nil {
 			return res, err
 		}
@@ -213,7 +240,7 @@ func (dsm *DailyStatsManager) getDailyStatsLegacy(date, projectID, nodeID string
 		pattern = fmt.Sprintf("%s%s#*", dsm.redisKeyPrefix, date)
 	}
 
-	keys, err := RedisKeys(pattern)
+	keys, err := RedisReadKeys(pattern)
 	if err != nil {
 		logger.Error("Failed to get daily stats keys from Redis", "pattern", pattern, "error", err)
 		return result
@@ -295,7 +322,7 @@ func (dsm *DailyStatsManager) ApplyBatchUpdates(dailyStatsData []DailyStatsData)
 	now := time.Now()
 	date := now.Format("2006-01-02")
 
-	expiration := int((time.Duration(dsm.retentionDays) * 24 * time.Hour).Seconds())
+	expiration := RetentionSeconds(RetentionDailyStats)
 
 	for i := range dailyStatsData {
 		data := dailyStatsData[i]
@@ -388,6 +415,8 @@ func (dsm *DailyStatsManager) GetAggregatedDailyStats(date string) map[string]in
 	totalRulesetMessages := uint64(0)
 	totalPluginSuccess := uint64(0)
 	totalPluginFailures := uint64(0)
+	totalRuleSuppressed := uint64(0)
+	totalRuleExcluded := uint64(0)
 
 	for _, data := range allData {
 		if _, exists := projectStats[data.ProjectID]; !exists {
@@ -412,6 +441,10 @@ func (dsm *DailyStatsManager) GetAggregatedDailyStats(date string) map[string]in
 			totalPluginSuccess += data.TotalMessages
 		case "plugin_failure":
 			totalPluginFailures += data.TotalMessages
+		case "rule_suppressed":
+			totalRuleSuppressed += data.TotalMessages
+		case "rule_excluded":
+			totalRuleExcluded += data.TotalMessages
 		}
 	}
 
@@ -446,6 +479,8 @@ func (dsm *DailyStatsManager) GetAggregatedDailyStats(date string) map[string]in
 		"total_ruleset_messages": totalRulesetMessages,
 		"total_plugin_success":   totalPluginSuccess,
 		"total_plugin_failures":  totalPluginFailures,
+		"total_rule_suppressed":  totalRuleSuppressed,
+		"total_rule_excluded":    totalRuleExcluded,
 		"project_breakdown":      projectBreakdown, // Changed from "projects" to match frontend expectation
 		"timestamp":              time.Now(),
 	}
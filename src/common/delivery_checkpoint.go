@@ -0,0 +1,394 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// DeliveryTokenField carries the checkpoint token of an event consumed for an at-least-once project.
+// The _hub_ prefix keeps it through field projections, outputs remove it before serializing the event.
+const DeliveryTokenField = "_hub_delivery"
+
+// DeliveryToken follows one consumed record through the pipeline. A component handing the event
+// on takes a reference for every downstream and releases its own, the record is checkpointed once
+// every reference is released and none failed.
+type DeliveryToken struct {
+	refs   int32
+	failed atomic.Bool
+	done   func(ok bool) // nil when the record is not checkpointed
+}
+
+func newDeliveryToken(done func(ok bool)) *DeliveryToken {
+	return &DeliveryToken{refs: 1, done: done}
+}
+
+// Retain takes a reference for one more downstream
+func (t *DeliveryToken) Retain() {
+	if t == nil {
+		return
+	}
+	atomic.AddInt32(&t.refs, 1)
+}
+
+// Release gives a reference back once the event is delivered, or was refused by the sink for its
+// content so that sending it again cannot help
+func (t *DeliveryToken) Release() {
+	if t == nil {
+		return
+	}
+	if atomic.AddInt32(&t.refs, -1) == 0 && t.done != nil {
+		t.done(!t.failed.Load())
+	}
+}
+
+// Fail gives a reference back for an event that was dropped or whose delivery is unknown.
+// The record is not checkpointed and is consumed again after a restart.
+func (t *DeliveryToken) Fail() {
+	if t == nil {
+		return
+	}
+	t.failed.Store(true)
+	t.Release()
+}
+
+// MarshalJSON keeps the token out of samples and other serialized copies of an event
+func (t *DeliveryToken) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// GetDeliveryToken returns the checkpoint token of an event, nil when it has none
+func GetDeliveryToken(msg map[string]interface{}) *DeliveryToken {
+	token, _ := msg[DeliveryTokenField].(*DeliveryToken)
+	return token
+}
+
+// SetDeliveryToken attaches a token to an event that does not carry one yet
+func SetDeliveryToken(msg map[string]interface{}, token *DeliveryToken) {
+	if token == nil || msg == nil {
+		return
+	}
+	if _, ok := msg[DeliveryTokenField]; !ok {
+		msg[DeliveryTokenField] = token
+	}
+}
+
+// TakeDeliveryToken removes the token from an event owned by the caller and returns it
+func TakeDeliveryToken(msg map[string]interface{}) *DeliveryToken {
+	token := GetDeliveryToken(msg)
+	if token != nil {
+		delete(msg, DeliveryTokenField)
+	}
+	return token
+}
+
+// DeliveryTokens are the tokens of a batch, entries may be nil
+type DeliveryTokens []*DeliveryToken
+
+// TakeDeliveryTokens removes the tokens from the events of a batch, it returns nil when none has one
+func TakeDeliveryTokens(batch []map[string]interface{}) DeliveryTokens {
+	var tokens DeliveryTokens
+	for _, msg := range batch {
+		if token := TakeDeliveryToken(msg); token != nil {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Release releases every token of the batch
+func (ts DeliveryTokens) Release() {
+	for _, t := range ts {
+		t.Release()
+	}
+}
+
+// Fail fails every token of the batch
+func (ts DeliveryTokens) Fail() {
+	for _, t := range ts {
+		t.Fail()
+	}
+}
+
+// kafkaCheckpoint tracks the records of a consumer still in the pipeline. The offset committed for
+// a partition is the one after its last record whose predecessors are all delivered.
+type kafkaCheckpoint struct {
+	mu         sync.Mutex
+	partitions map[string]map[int32]*partitionCheckpoint
+	rewound    uint64 // partitions consumed again after a failed delivery
+}
+
+type checkpointRecord struct {
+	offset int64
+	epoch  int32
+}
+
+type partitionCheckpoint struct {
+	topic     string
+	partition int32
+	pending   []checkpointRecord // in consume order
+	done      map[int64]bool
+	commit    kgo.EpochOffset // next offset to commit, Offset -1 when none
+	committed int64
+	// held is set when a record failed, nothing after it is committed and the partition is
+	// consumed again from rewind, its oldest record in flight
+	held   bool
+	rewind kgo.EpochOffset
+	// resume is the offset the partition was rewound to, records fetched before the seek are
+	// not tracked until it comes back. -1 when not rewinding.
+	resume int64
+	// gen tells the tokens tracked before a rewind apart, their outcome no longer counts
+	gen int
+}
+
+func newKafkaCheckpoint() *kafkaCheckpoint {
+	return &kafkaCheckpoint{partitions: make(map[string]map[int32]*partitionCheckpoint)}
+}
+
+// track starts following a record and returns its token
+func (c *kafkaCheckpoint) track(rec *kgo.Record) *DeliveryToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	topic := c.partitions[rec.Topic]
+	if topic == nil {
+		topic = make(map[int32]*partitionCheckpoint)
+		c.partitions[rec.Topic] = topic
+	}
+	p := topic[rec.Partition]
+	if p == nil {
+		p = &partitionCheckpoint{
+			topic:     rec.Topic,
+			partition: rec.Partition,
+			done:      make(map[int64]bool),
+			commit:    kgo.EpochOffset{Epoch: -1, Offset: -1},
+			committed: -1,
+			resume:    -1,
+		}
+		topic[rec.Partition] = p
+	}
+	// Records behind a failed one are delivered again after the rewind, they are tracked then
+	if p.held || (p.resume >= 0 && rec.Offset > p.resume) {
+		return newDeliveryToken(nil)
+	}
+	p.resume = -1
+	p.pending = append(p.pending, checkpointRecord{offset: rec.Offset, epoch: rec.LeaderEpoch})
+	offset, gen := rec.Offset, p.gen
+	return newDeliveryToken(func(ok bool) { c.finish(p, gen, offset, ok) })
+}
+
+func (c *kafkaCheckpoint) finish(p *partitionCheckpoint, gen int, offset int64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The partition was revoked, rewound or the checkpoint reset while the record was in flight
+	if c.partitions[p.topic][p.partition] != p || p.gen != gen || p.held {
+		return
+	}
+	if !ok {
+		// Every record in flight is consumed again, the oldest one may still fail as well
+		p.held = true
+		p.rewind = kgo.EpochOffset{Epoch: p.pending[0].epoch, Offset: p.pending[0].offset}
+		logger.Warn("[KafkaConsumer] delivery failed, the partition is consumed again from its oldest record in flight",
+			"topic", p.topic, "partition", p.partition, "offset", offset, "rewind", p.rewind.Offset)
+		return
+	}
+	p.done[offset] = true
+	for len(p.pending) > 0 && p.done[p.pending[0].offset] {
+		rec := p.pending[0]
+		delete(p.done, rec.offset)
+		p.commit = kgo.EpochOffset{Epoch: rec.epoch, Offset: rec.offset + 1}
+		p.pending = p.pending[1:]
+	}
+}
+
+// due returns the offsets to commit since the last call
+func (c *kafkaCheckpoint) due() map[string]map[int32]kgo.EpochOffset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var offsets map[string]map[int32]kgo.EpochOffset
+	for topic, partitions := range c.partitions {
+		for partition, p := range partitions {
+			if p.commit.Offset < 0 || p.commit.Offset == p.committed {
+				continue
+			}
+			if offsets == nil {
+				offsets = make(map[string]map[int32]kgo.EpochOffset)
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]kgo.EpochOffset)
+			}
+			offsets[topic][partition] = p.commit
+			p.committed = p.commit.Offset
+		}
+	}
+	return offsets
+}
+
+// retry makes offsets whose commit failed due again
+func (c *kafkaCheckpoint) retry(offsets map[string]map[int32]kgo.EpochOffset) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, partitions := range offsets {
+		for partition, o := range partitions {
+			if p := c.partitions[topic][partition]; p != nil && p.committed == o.Offset {
+				p.committed = -1
+			}
+		}
+	}
+}
+
+// rewinds returns the offsets to seek the partitions held by a failed delivery to, and re-arms
+// them: records in flight are forgotten and tracking resumes once the rewound record comes back
+func (c *kafkaCheckpoint) rewinds() map[string]map[int32]kgo.EpochOffset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var offsets map[string]map[int32]kgo.EpochOffset
+	for topic, partitions := range c.partitions {
+		for partition, p := range partitions {
+			if !p.held {
+				continue
+			}
+			if offsets == nil {
+				offsets = make(map[string]map[int32]kgo.EpochOffset)
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]kgo.EpochOffset)
+			}
+			offsets[topic][partition] = p.rewind
+			c.rewound++
+			p.held = false
+			p.resume = p.rewind.Offset
+			p.pending = nil
+			p.done = make(map[int64]bool)
+			p.gen++
+		}
+	}
+	return offsets
+}
+
+// revoke forgets partitions the consumer no longer owns, their records in flight are ignored
+func (c *kafkaCheckpoint) revoke(revoked map[string][]int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, partitions := range revoked {
+		for _, partition := range partitions {
+			delete(c.partitions[topic], partition)
+		}
+	}
+}
+
+// reset forgets every partition
+func (c *kafkaCheckpoint) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.partitions = make(map[string]map[int32]*partitionCheckpoint)
+}
+
+// stats returns the records in flight, the partitions waiting for a rewind after a failed delivery
+// and the number of rewinds
+func (c *kafkaCheckpoint) stats() (pending int, held []string, rewound uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	held = []string{}
+	for _, partitions := range c.partitions {
+		for _, p := range partitions {
+			pending += len(p.pending)
+			if p.held {
+				held = append(held, fmt.Sprintf("%s/%d", p.topic, p.partition))
+			}
+		}
+	}
+	return pending, held, c.rewound
+}
+
+// commitCheckpoint commits the offsets of the records delivered by every output
+func (c *KafkaConsumer) commitCheckpoint(ctx context.Context) {
+	offsets := c.checkpoint.due()
+	if len(offsets) == 0 {
+		return
+	}
+	c.Client.CommitOffsetsSync(ctx, offsets, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		if err == nil && resp != nil {
+		topics:
+			for _, t := range resp.Topics {
+				for _, p := range t.Partitions {
+					if err = kerr.ErrorForCode(p.ErrorCode); err != nil {
+						break topics
+					}
+				}
+			}
+		}
+		if err != nil {
+			logger.Error("[KafkaConsumer] failed to commit checkpointed offsets", "err", err.Error())
+			c.checkpoint.retry(offsets)
+		}
+	})
+}
+
+// rewindFailed seeks the partitions whose delivery failed back to their oldest record in flight,
+// so the failed record is consumed again without waiting for a restart
+func (c *KafkaConsumer) rewindFailed() {
+	// Seeking a partition being revoked would move the new owner's position
+	c.rebalanceMu.Lock()
+	defer c.rebalanceMu.Unlock()
+	if offsets := c.checkpoint.rewinds(); len(offsets) > 0 {
+		c.Client.SetOffsets(offsets)
+	}
+}
+
+// commitLoop commits checkpointed offsets while no fetch returns, outputs confirm deliveries in the background
+func (c *KafkaConsumer) commitLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			if c.atLeastOnce.Load() {
+				c.rewindFailed()
+				c.commitCheckpoint(context.Background())
+			}
+		}
+	}
+}
+
+// onRevoked commits what was delivered from the partitions handed to another consumer
+func (c *KafkaConsumer) onRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	c.rebalanceMu.Lock()
+	defer c.rebalanceMu.Unlock()
+	if c.atLeastOnce.Load() {
+		c.commitCheckpoint(ctx)
+	}
+	c.checkpoint.revoke(revoked)
+}
+
+func (c *KafkaConsumer) onLost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	c.rebalanceMu.Lock()
+	defer c.rebalanceMu.Unlock()
+	c.checkpoint.revoke(lost)
+}
+
+// SetAtLeastOnce switches between committing offsets once records are handed to the pipeline and
+// committing them once every output confirmed their delivery
+func (c *KafkaConsumer) SetAtLeastOnce(on bool) {
+	if c.atLeastOnce.Swap(on) && !on {
+		c.checkpoint.reset()
+	}
+}
+
+// CheckpointStats returns the records waiting for delivery, the partitions waiting to be consumed
+// again after a failed delivery and the number of rewinds, in at-least-once mode
+func (c *KafkaConsumer) CheckpointStats() (pending int, held []string, rewound uint64) {
+	return c.checkpoint.stats()
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func checkpointRecords(c *kafkaCheckpoint, offsets ...int64) []*DeliveryToken {
+	tokens := make([]*DeliveryToken, 0, len(offsets))
+	for _, o := range offsets {
+		tokens = append(tokens, c.track(&kgo.Record{Topic: "t", Partition: 0, Offset: o, LeaderEpoch: 1}))
+	}
+	return tokens
+}
+
+func dueOffset(t *testing.T, c *kafkaCheckpoint) int64 {
+	t.Helper()
+	due := c.due()
+	if due == nil {
+		return -1
+	}
+	return due["t"][0].Offset
+}
+
+func TestKafkaCheckpointResumesAfterFailedDelivery(t *testing.T) {
+	c := newKafkaCheckpoint()
+
+	tokens := checkpointRecords(c, 10, 11, 12, 13)
+	tokens[0].Release()
+	if got := dueOffset(t, c); got != 11 {
+		t.Fatalf("committed %d, want 11", got)
+	}
+
+	// 12 fails while 11 is still in flight: nothing past 10 is committed and the partition is
+	// rewound to 11, the oldest record in flight
+	tokens[2].Fail()
+	tokens[1].Release()
+	tokens[3].Release()
+	if got := dueOffset(t, c); got != -1 {
+		t.Fatalf("committed %d past a failed delivery", got)
+	}
+	if _, held, _ := c.stats(); !reflect.DeepEqual(held, []string{"t/0"}) {
+		t.Fatalf("held partitions %v", held)
+	}
+
+	// Records fetched before the seek are delivered again later, they are not tracked
+	stale := checkpointRecords(c, 14)
+	rewinds := c.rewinds()
+	if want := map[string]map[int32]kgo.EpochOffset{"t": {0: {Epoch: 1, Offset: 11}}}; !reflect.DeepEqual(rewinds, want) {
+		t.Fatalf("rewinds %v, want %v", rewinds, want)
+	}
+	stale = append(stale, checkpointRecords(c, 15)...)
+	for _, token := range stale {
+		token.Release()
+	}
+	if pending, held, rewound := c.stats(); pending != 0 || len(held) != 0 || rewound != 1 {
+		t.Fatalf("stats after rewind: pending %d, held %v, rewound %d", pending, held, rewound)
+	}
+
+	// The failed record and its successors come back and are committed once delivered
+	again := checkpointRecords(c, 11, 12, 13, 14, 15)
+	for _, token := range again {
+		token.Release()
+	}
+	if got := dueOffset(t, c); got != 16 {
+		t.Fatalf("committed %d after the rewind, want 16", got)
+	}
+	if c.rewinds() != nil {
+		t.Fatal("partition rewound twice")
+	}
+}
@@ -0,0 +1,407 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	deliveryReceiptsKeyPrefix = "hub:delivery_receipts:"
+	deliveryWindowLayout      = "2006-01-02T15" // one hourly window per Redis hash
+)
+
+// DeliveryCounts holds the delivery lifecycle counters of one output.
+// Matched: events that reached the output after rule matching
+// Sent:    events handed to the producer
+// Acked:   events confirmed by the downstream system
+// Failed:  events the producer gave up on (serialization errors, exhausted retries)
+// Dropped: events discarded before reaching the producer (producer queue full)
+type DeliveryCounts struct {
+	Matched uint64 `json:"matched"`
+	Sent    uint64 `json:"sent"`
+	Acked   uint64 `json:"acked"`
+	Failed  uint64 `json:"failed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+func (c *DeliveryCounts) add(o DeliveryCounts) {
+	c.Matched += o.Matched
+	c.Sent += o.Sent
+	c.Acked += o.Acked
+	c.Failed += o.Failed
+	c.Dropped += o.Dropped
+}
+
+func (c DeliveryCounts) isZero() bool {
+	return c == DeliveryCounts{}
+}
+
+// DeliveryReceipts tracks delivery counters for a running output.
+// All methods are safe to call on a nil receiver so producers can record unconditionally.
+type DeliveryReceipts struct {
+	matched uint64
+	sent    uint64
+	acked   uint64
+	failed  uint64
+	dropped uint64
+
+	// last persisted values, used to calculate increments
+	reported DeliveryCounts
+}
+
+// NewDeliveryReceipts creates an empty set of delivery counters
+func NewDeliveryReceipts() *DeliveryReceipts {
+	return &DeliveryReceipts{}
+}
+
+func (d *DeliveryReceipts) AddMatched(n uint64) {
+	if d != nil {
+		atomic.AddUint64(&d.matched, n)
+	}
+}
+
+func (d *DeliveryReceipts) AddSent(n uint64) {
+	if d != nil {
+		atomic.AddUint64(&d.sent, n)
+	}
+}
+
+func (d *DeliveryReceipts) AddAcked(n uint64) {
+	if d != nil {
+		atomic.AddUint64(&d.acked, n)
+	}
+}
+
+func (d *DeliveryReceipts) AddFailed(n uint64) {
+	if d != nil {
+		atomic.AddUint64(&d.failed, n)
+	}
+}
+
+func (d *DeliveryReceipts) AddDropped(n uint64) {
+	if d != nil {
+		atomic.AddUint64(&d.dropped, n)
+	}
+}
+
+// Snapshot returns the cumulative counters since the output was started
+func (d *DeliveryReceipts) Snapshot() DeliveryCounts {
+	if d == nil {
+		return DeliveryCounts{}
+	}
+	return DeliveryCounts{
+		Matched: atomic.LoadUint64(&d.matched),
+		Sent:    atomic.LoadUint64(&d.sent),
+		Acked:   atomic.LoadUint64(&d.acked),
+		Failed:  atomic.LoadUint64(&d.failed),
+		Dropped: atomic.LoadUint64(&d.dropped),
+	}
+}
+
+// GetIncrementAndUpdate returns the increments since the last call and updates the baseline.
+// It is only called by the single collection loop, so the baseline needs no extra locking.
+func (d *DeliveryReceipts) GetIncrementAndUpdate() DeliveryCounts {
+	if d == nil {
+		return DeliveryCounts{}
+	}
+	current := d.Snapshot()
+	inc := DeliveryCounts{
+		Matched: current.Matched - d.reported.Matched,
+		Sent:    current.Sent - d.reported.Sent,
+		Acked:   current.Acked - d.reported.Acked,
+		Failed:  current.Failed - d.reported.Failed,
+		Dropped: current.Dropped - d.reported.Dropped,
+	}
+	d.reported = current
+	return inc
+}
+
+// DeliveryReceiptData is the delivery counter increment of one output in one project
+type DeliveryReceiptData struct {
+	ProjectID string
+	OutputID  string
+	Counts    DeliveryCounts
+}
+
+// DeliveryReceiptCollectorFunc collects delivery counter increments from all running outputs
+type DeliveryReceiptCollectorFunc func() []DeliveryReceiptData
+
+// deliveryReceiptCollector is a global callback function set by the project package
+var deliveryReceiptCollector DeliveryReceiptCollectorFunc
+
+// SetDeliveryReceiptCollector sets the callback function for collecting delivery receipts
+func SetDeliveryReceiptCollector(collector DeliveryReceiptCollectorFunc) {
+	deliveryReceiptCollector = collector
+}
+
+// DeliveryReceiptManager periodically persists delivery counters into hourly windows in Redis.
+// Counters from all nodes are summed into the same window, so reports are cluster-wide.
+type DeliveryReceiptManager struct {
+	mu           sync.Mutex // serializes collection between the loop and the final flush
+	stopChan     chan struct{}
+	saveInterval time.Duration
+}
+
+var GlobalDeliveryReceiptManager *DeliveryReceiptManager
+
+// InitDeliveryReceiptManager initializes the global delivery receipt manager
+func InitDeliveryReceiptManager() {
+	if GlobalDeliveryReceiptManager == nil {
+		GlobalDeliveryReceiptManager = &DeliveryReceiptManager{
+			stopChan:     make(chan struct{}),
+			saveInterval: 30 * time.Second,
+		}
+		go GlobalDeliveryReceiptManager.persistenceLoop()
+	}
+}
+
+// StopDeliveryReceiptManager flushes pending counters and stops the global delivery receipt manager
+func StopDeliveryReceiptManager() {
+	if GlobalDeliveryReceiptManager != nil {
+		close(GlobalDeliveryReceiptManager.stopChan)
+		GlobalDeliveryReceiptManager.collect()
+		GlobalDeliveryReceiptManager = nil
+		logger.Info("Delivery receipt manager stopped")
+	}
+}
+
+func (m *DeliveryReceiptManager) persistenceLoop() {
+	ticker := time.NewTicker(m.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.collect()
+		}
+	}
+}
+
+func (m *DeliveryReceiptManager) collect() {
+	if deliveryReceiptCollector == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := deliveryReceiptCollector()
+	if len(data) == 0 {
+		return
+	}
+	if err := m.write(time.Now(), data); err != nil {
+		logger.Error("Failed to persist delivery receipts", "error", err)
+	}
+}
+
+func (m *DeliveryReceiptManager) write(now time.Time, data []DeliveryReceiptData) error {
+	key := deliveryReceiptsKeyPrefix + now.UTC().Format(deliveryWindowLayout)
+
+	ctx := context.Background()
+	pipe := GetRedisClient().Pipeline()
+	for _, d := range data {
+		if d.Counts.isZero() {
+			continue
+		}
+		prefix := d.ProjectID + "#" + d.OutputID + "#"
+		for name, v := range map[string]uint64{
+			"matched": d.Counts.Matched,
+			"sent":    d.Counts.Sent,
+			"acked":   d.Counts.Acked,
+			"failed":  d.Counts.Failed,
+			"dropped": d.Counts.Dropped,
+		} {
+			if v > 0 {
+				pipe.HIncrBy(ctx, key, prefix+name, int64(v))
+			}
+		}
+	}
+	pipe.Expire(ctx, key, RetentionPeriod(RetentionDeliveryReceipts))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to write delivery receipts: %w", err)
+	}
+	return nil
+}
+
+// OutputReconciliation compares matched events with delivery outcomes for one output
+type OutputReconciliation struct {
+	OutputID string `json:"output_id"`
+	DeliveryCounts
+	// Pending = sent - acked - failed, events still in flight (negative when acks cross a window boundary)
+	Pending int64 `json:"pending"`
+	// Unaccounted = matched - sent - dropped, should always be zero
+	Unaccounted int64  `json:"unaccounted"`
+	Status      string `json:"status"` // reconciled, in_flight, discrepancy
+}
+
+// ProjectReconciliation is the reconciliation result of one project
+type ProjectReconciliation struct {
+	ProjectID string                  `json:"project_id"`
+	Matched   uint64                  `json:"matched"` // summed over outputs, an event routed to two outputs counts twice
+	Status    string                  `json:"status"`
+	Outputs   []*OutputReconciliation `json:"outputs"`
+}
+
+// ReconciliationWindow is the reconciliation result of one hourly window
+type ReconciliationWindow struct {
+	Start    time.Time                `json:"start"`
+	End      time.Time                `json:"end"`
+	Projects []*ProjectReconciliation `json:"projects"`
+}
+
+// DeliveryReconciliationReport summarizes delivery receipts for a time range
+type DeliveryReconciliationReport struct {
+	From     time.Time                `json:"from"`
+	To       time.Time                `json:"to"`
+	Status   string                   `json:"status"`
+	Totals   []*ProjectReconciliation `json:"totals"`
+	Windows  []*ReconciliationWindow  `json:"windows"`
+	Complete bool                     `json:"complete"` // false if part of the range is older than retention
+}
+
+// GetDeliveryReconciliation builds a reconciliation report for all hourly windows between from and to.
+// An empty projectID includes all projects.
+func GetDeliveryReconciliation(from, to time.Time, projectID string) (*DeliveryReconciliationReport, error) {
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC()
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid time range: from must be before to")
+	}
+	if to.Sub(from) > 31*24*time.Hour {
+		return nil, fmt.Errorf("time range too large, maximum is 31 days")
+	}
+
+	report := &DeliveryReconciliationReport{
+		From:     from,
+		To:       to,
+		Windows:  make([]*ReconciliationWindow, 0),
+		Complete: time.Since(from) <= RetentionPeriod(RetentionDeliveryReceipts),
+	}
+	totals := make(map[string]map[string]*DeliveryCounts)
+
+	for start := from; start.Before(to); start = start.Add(time.Hour) {
+		raw, err := RedisReadHGetAll(deliveryReceiptsKeyPrefix + start.Format(deliveryWindowLayout))
+		if err != nil {
+			return nil, err
+		}
+		counts := parseDeliveryReceiptFields(raw, projectID)
+		if len(counts) == 0 {
+			continue
+		}
+		for pid, outputs := range counts {
+			if totals[pid] == nil {
+				totals[pid] = make(map[string]*DeliveryCounts)
+			}
+			for oid, c := range outputs {
+				if totals[pid][oid] == nil {
+					totals[pid][oid] = &DeliveryCounts{}
+				}
+				totals[pid][oid].add(*c)
+			}
+		}
+		report.Windows = append(report.Windows, &ReconciliationWindow{
+			Start:    start,
+			End:      start.Add(time.Hour),
+			Projects: reconcileProjects(counts),
+		})
+	}
+
+	report.Totals = reconcileProjects(totals)
+	report.Status = worstReconciliationStatus(report.Totals)
+	return report, nil
+}
+
+func parseDeliveryReceiptFields(raw map[string]string, projectID string) map[string]map[string]*DeliveryCounts {
+	result := make(map[string]map[string]*DeliveryCounts)
+	for field, value := range raw {
+		parts := strings.Split(field, "#")
+		if len(parts) != 3 {
+			continue
+		}
+		if projectID != "" && parts[0] != projectID {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if result[parts[0]] == nil {
+			result[parts[0]] = make(map[string]*DeliveryCounts)
+		}
+		c := result[parts[0]][parts[1]]
+		if c == nil {
+			c = &DeliveryCounts{}
+			result[parts[0]][parts[1]] = c
+		}
+		switch parts[2] {
+		case "matched":
+			c.Matched += v
+		case "sent":
+			c.Sent += v
+		case "acked":
+			c.Acked += v
+		case "failed":
+			c.Failed += v
+		case "dropped":
+			c.Dropped += v
+		}
+	}
+	return result
+}
+
+func reconcileProjects(counts map[string]map[string]*DeliveryCounts) []*ProjectReconciliation {
+	projects := make([]*ProjectReconciliation, 0, len(counts))
+	for pid, outputs := range counts {
+		pr := &ProjectReconciliation{ProjectID: pid, Outputs: make([]*OutputReconciliation, 0, len(outputs))}
+		for oid, c := range outputs {
+			or := &OutputReconciliation{
+				OutputID:       oid,
+				DeliveryCounts: *c,
+				Pending:        int64(c.Sent) - int64(c.Acked) - int64(c.Failed),
+				Unaccounted:    int64(c.Matched) - int64(c.Sent) - int64(c.Dropped),
+			}
+			switch {
+			case or.Failed > 0 || or.Dropped > 0 || or.Unaccounted != 0:
+				or.Status = "discrepancy"
+			case or.Pending != 0:
+				or.Status = "in_flight"
+			default:
+				or.Status = "reconciled"
+			}
+			pr.Matched += c.Matched
+			pr.Outputs = append(pr.Outputs, or)
+		}
+		sort.Slice(pr.Outputs, func(i, j int) bool { return pr.Outputs[i].OutputID < pr.Outputs[j].OutputID })
+		pr.Status = "reconciled"
+		for _, or := range pr.Outputs {
+			pr.Status = worseStatus(pr.Status, or.Status)
+		}
+		projects = append(projects, pr)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ProjectID < projects[j].ProjectID })
+	return projects
+}
+
+func worstReconciliationStatus(projects []*ProjectReconciliation) string {
+	status := "reconciled"
+	for _, p := range projects {
+		status = worseStatus(status, p.Status)
+	}
+	return status
+}
+
+func worseStatus(a, b string) string {
+	rank := map[string]int{"reconciled": 0, "in_flight": 1, "discrepancy": 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,487 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RolloutStatusRunning   = "running"
+	RolloutStatusCompleted = "completed"
+	RolloutStatusStopped   = "stopped"
+	RolloutStatusFailed    = "failed"
+)
+
+// Per-child states of a rollout
+const (
+	ChildRolloutPending = "pending"
+	ChildRolloutPushed  = "pushed"
+	ChildRolloutFailed  = "failed"
+	ChildRolloutSkipped = "skipped"
+)
+
+const (
+	defaultDistributionTimeout = 30 * time.Second
+	distributionRulesetsPath   = "/distribution/rulesets"
+)
+
+// DistributionConfig lists the child hubs a parent hub publishes rulesets to
+type DistributionConfig struct {
+	HubID      string              `yaml:"hub_id,omitempty" json:"hub_id"` // name of this parent hub, recorded by the children
+	StageDelay string              `yaml:"stage_delay,omitempty" json:"stage_delay"`
+	Timeout    string              `yaml:"timeout,omitempty" json:"timeout"` // per request, default 30s
+	Children   []DistributionChild `yaml:"children" json:"children"`
+}
+
+// DistributionChild is a registered child hub and its overrides
+type DistributionChild struct {
+	ID     string `yaml:"id" json:"id"`
+	URL    string `yaml:"url" json:"url"` // API address of the child leader, e.g. https://hub-eu:8080
+	Token  string `yaml:"token" json:"-"`
+	CAFile string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	// Stage orders the rollout, lower stages are updated first
+	Stage int `yaml:"stage,omitempty" json:"stage"`
+	// ExcludeRulesets are never published to this child
+	ExcludeRulesets []string `yaml:"exclude_rulesets,omitempty" json:"exclude_rulesets,omitempty"`
+	// DisabledRules removes rules from the published version, ruleset ID -> rule IDs
+	DisabledRules map[string][]string `yaml:"disabled_rules,omitempty" json:"disabled_rules,omitempty"`
+}
+
+// Excludes reports whether a ruleset is never published to the child
+func (c DistributionChild) Excludes(rulesetID string) bool {
+	for _, id := range c.ExcludeRulesets {
+		if id == rulesetID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDistributionConfig returns the configured distribution, nil when this hub has no children
+func GetDistributionConfig() *DistributionConfig {
+	if Config == nil || Config.Distribution == nil || len(Config.Distribution.Children) == 0 {
+		return nil
+	}
+	return Config.Distribution
+}
+
+// DistributionTimeout returns the per request timeout of the distribution config
+func (c *DistributionConfig) DistributionTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultDistributionTimeout
+}
+
+// RulesetVersion identifies a ruleset version by its content, so parent and child
+// agree on it without keeping state
+func RulesetVersion(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:6])
+}
+
+// DistributionPush holds the rendered ruleset versions published to one child
+type DistributionPush struct {
+	Child    DistributionChild
+	Rulesets map[string]string // ruleset ID -> content after overrides
+}
+
+// ChildRolloutReport is the state of one child in a rollout
+type ChildRolloutReport struct {
+	Child    string            `json:"child"`
+	Stage    int               `json:"stage"`
+	Status   string            `json:"status"`
+	Versions map[string]string `json:"versions"` // ruleset ID -> version published
+	Error    string            `json:"error,omitempty"`
+	PushedAt *time.Time        `json:"pushed_at,omitempty"`
+}
+
+// RolloutReport is a point-in-time view of a rollout
+type RolloutReport struct {
+	ID           string               `json:"id"`
+	Rulesets     []string             `json:"rulesets"`
+	Status       string               `json:"status"`
+	Error        string               `json:"error,omitempty"`
+	Stages       []int                `json:"stages"`
+	CurrentStage int                  `json:"current_stage"`
+	StageDelay   string               `json:"stage_delay"`
+	Children     []ChildRolloutReport `json:"children"`
+	StartedAt    time.Time            `json:"started_at"`
+	FinishedAt   *time.Time           `json:"finished_at,omitempty"`
+}
+
+// Rollout publishes ruleset versions to child hubs stage by stage. A stage starts once every
+// child of the previous stage accepted the push and StageDelay passed; a failed push halts the rollout.
+type Rollout struct {
+	ID string
+
+	cfg        *DistributionConfig
+	rulesets   []string
+	stages     []int
+	pushes     map[int][]DistributionPush
+	stageDelay time.Duration
+	client     func(DistributionChild) (*http.Client, error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu           sync.Mutex
+	status       string
+	err          error
+	currentStage int
+	children     map[string]*ChildRolloutReport
+	startedAt    time.Time
+	finishedAt   *time.Time
+}
+
+var (
+	rolloutsMu sync.RWMutex
+	rollouts   = make(map[string]*Rollout)
+)
+
+// StartRollout validates the pushes and publishes them in the background
+func StartRollout(cfg *DistributionConfig, rulesets []string, pushes []DistributionPush, stageDelay time.Duration) (*Rollout, error) {
+	if len(pushes) == 0 {
+		return nil, fmt.Errorf("no child hub to publish to")
+	}
+	rolloutsMu.RLock()
+	for _, r := range rollouts {
+		if r.Report().Status == RolloutStatusRunning {
+			rolloutsMu.RUnlock()
+			return nil, fmt.Errorf("rollout %s is still running", r.ID)
+		}
+	}
+	rolloutsMu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Rollout{
+		ID:         uuid.New().String(),
+		cfg:        cfg,
+		rulesets:   rulesets,
+		pushes:     make(map[int][]DistributionPush),
+		stageDelay: stageDelay,
+		client:     distributionClientFunc(cfg.DistributionTimeout()),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		status:     RolloutStatusRunning,
+		children:   make(map[string]*ChildRolloutReport),
+		startedAt:  time.Now(),
+	}
+	for _, push := range pushes {
+		if _, ok := r.pushes[push.Child.Stage]; !ok {
+			r.stages = append(r.stages, push.Child.Stage)
+		}
+		r.pushes[push.Child.Stage] = append(r.pushes[push.Child.Stage], push)
+		versions := make(map[string]string, len(push.Rulesets))
+		for id, content := range push.Rulesets {
+			versions[id] = RulesetVersion(content)
+		}
+		r.children[push.Child.ID] = &ChildRolloutReport{
+			Child:    push.Child.ID,
+			Stage:    push.Child.Stage,
+			Status:   ChildRolloutPending,
+			Versions: versions,
+		}
+	}
+	sort.Ints(r.stages)
+	r.currentStage = r.stages[0]
+
+	rolloutsMu.Lock()
+	rollouts[r.ID] = r
+	rolloutsMu.Unlock()
+
+	go func() {
+		defer close(r.done)
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Error("Panic in rollout", "rollout", r.ID, "panic", p)
+				r.finish(fmt.Errorf("panic: %v", p))
+			}
+		}()
+		r.finish(r.run())
+	}()
+	logger.Info("Rollout started", "rollout", r.ID, "rulesets", rulesets, "children", len(pushes), "stages", len(r.stages))
+	return r, nil
+}
+
+func (r *Rollout) run() error {
+	for i, stage := range r.stages {
+		if i > 0 && r.stageDelay > 0 {
+			// Soak time: the previous stage runs the new versions before more children get them
+			select {
+			case <-r.ctx.Done():
+				return nil
+			case <-time.After(r.stageDelay):
+			}
+		}
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		r.mu.Lock()
+		r.currentStage = stage
+		r.mu.Unlock()
+
+		var wg sync.WaitGroup
+		var failedMu sync.Mutex
+		var failed []string
+		for _, push := range r.pushes[stage] {
+			wg.Add(1)
+			go func(push DistributionPush) {
+				defer wg.Done()
+				if err := r.push(push); err != nil {
+					failedMu.Lock()
+					failed = append(failed, push.Child.ID)
+					failedMu.Unlock()
+				}
+			}(push)
+		}
+		wg.Wait()
+
+		if len(failed) > 0 {
+			sort.Strings(failed)
+			return fmt.Errorf("stage %d failed on %s, later stages were not updated", stage, strings.Join(failed, ", "))
+		}
+	}
+	return nil
+}
+
+// push publishes every ruleset of a child, stopping at the first rejected one
+func (r *Rollout) push(push DistributionPush) error {
+	err := func() error {
+		client, err := r.client(push.Child)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(push.Rulesets))
+		for id := range push.Rulesets {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if err := r.pushRuleset(client, push.Child, id, push.Rulesets[id]); err != nil {
+				return fmt.Errorf("ruleset %s: %w", id, err)
+			}
+		}
+		return nil
+	}()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.children[push.Child.ID]
+	if err != nil {
+		report.Status = ChildRolloutFailed
+		report.Error = err.Error()
+		logger.Error("Failed to publish rulesets to child hub", "rollout", r.ID, "child", push.Child.ID, "error", err)
+		return err
+	}
+	now := time.Now()
+	report.Status = ChildRolloutPushed
+	report.PushedAt = &now
+	logger.Info("Published rulesets to child hub", "rollout", r.ID, "child", push.Child.ID, "rulesets", len(push.Rulesets))
+	return nil
+}
+
+func (r *Rollout) pushRuleset(client *http.Client, child DistributionChild, id, content string) error {
+	body, err := json.Marshal(map[string]string{
+		"content": content,
+		"version": RulesetVersion(content),
+		"parent":  r.cfg.HubID,
+		"rollout": r.ID,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(child.URL, "/") + distributionRulesetsPath + "/" + url.PathEscape(id)
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("token", child.Token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &msg) == nil && msg.Error != "" {
+			return fmt.Errorf("child hub returned %d: %s", resp.StatusCode, msg.Error)
+		}
+		return fmt.Errorf("child hub returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func (r *Rollout) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finishedAt != nil {
+		return
+	}
+	now := time.Now()
+	r.finishedAt = &now
+	for _, child := range r.children {
+		if child.Status == ChildRolloutPending {
+			child.Status = ChildRolloutSkipped
+		}
+	}
+	switch {
+	case err != nil:
+		r.status = RolloutStatusFailed
+		r.err = err
+		logger.Error("Rollout failed", "rollout", r.ID, "error", err)
+	case r.ctx.Err() != nil:
+		r.status = RolloutStatusStopped
+		logger.Info("Rollout stopped", "rollout", r.ID)
+	default:
+		r.status = RolloutStatusCompleted
+		logger.Info("Rollout completed", "rollout", r.ID)
+	}
+}
+
+// Stop halts the rollout, children already updated keep their new versions
+func (r *Rollout) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Done is closed once the rollout has finished
+func (r *Rollout) Done() <-chan struct{} {
+	return r.done
+}
+
+// Report returns the current progress of the rollout
+func (r *Rollout) Report() RolloutReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := RolloutReport{
+		ID:           r.ID,
+		Rulesets:     r.rulesets,
+		Status:       r.status,
+		Stages:       r.stages,
+		CurrentStage: r.currentStage,
+		StageDelay:   r.stageDelay.String(),
+		Children:     make([]ChildRolloutReport, 0, len(r.children)),
+		StartedAt:    r.startedAt,
+		FinishedAt:   r.finishedAt,
+	}
+	if r.err != nil {
+		report.Error = r.err.Error()
+	}
+	for _, child := range r.children {
+		c := *child
+		report.Children = append(report.Children, c)
+	}
+	sort.Slice(report.Children, func(i, j int) bool {
+		if report.Children[i].Stage != report.Children[j].Stage {
+			return report.Children[i].Stage < report.Children[j].Stage
+		}
+		return report.Children[i].Child < report.Children[j].Child
+	})
+	return report
+}
+
+// GetRollout returns a rollout by id
+func GetRollout(id string) (*Rollout, bool) {
+	rolloutsMu.RLock()
+	defer rolloutsMu.RUnlock()
+	r, ok := rollouts[id]
+	return r, ok
+}
+
+// ListRollouts returns the reports of all rollouts started on this node, newest first
+func ListRollouts() []RolloutReport {
+	rolloutsMu.RLock()
+	list := make([]RolloutReport, 0, len(rollouts))
+	for _, r := range rollouts {
+		list = append(list, r.Report())
+	}
+	rolloutsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// PruneRollouts drops finished rollouts older than maxAge
+func PruneRollouts(maxAge time.Duration) {
+	rolloutsMu.Lock()
+	defer rolloutsMu.Unlock()
+	for id, r := range rollouts {
+		r.mu.Lock()
+		expired := r.finishedAt != nil && time.Since(*r.finishedAt) > maxAge
+		r.mu.Unlock()
+		if expired {
+			delete(rollouts, id)
+		}
+	}
+}
+
+// FetchChildVersions returns the ruleset versions a child hub currently runs
+func FetchChildVersions(cfg *DistributionConfig, child DistributionChild) (map[string]string, error) {
+	client, err := distributionClientFunc(cfg.DistributionTimeout())(child)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(child.URL, "/")+distributionRulesetsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("token", child.Token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("child hub returned %d", resp.StatusCode)
+	}
+	var body struct {
+		Versions map[string]string `json:"versions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid response from child hub: %w", err)
+	}
+	return body.Versions, nil
+}
+
+func distributionClientFunc(timeout time.Duration) func(DistributionChild) (*http.Client, error) {
+	return func(child DistributionChild) (*http.Client, error) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if child.CAFile != "" {
+			caPEM, err := os.ReadFile(child.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file of child %s: %w", child.ID, err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("no certificates found in CA file of child %s", child.ID)
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+		return &http.Client{Timeout: timeout, Transport: transport}, nil
+	}
+}
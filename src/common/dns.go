@@ -0,0 +1,312 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+const (
+	dnsCacheKeyPrefix      = "hub:dns:"
+	defaultDNSWorkers      = 16
+	defaultDNSQueueSize    = 1024
+	defaultDNSTimeout      = 2 * time.Second
+	defaultDNSBudget       = 50 * time.Millisecond
+	defaultDNSCacheTTL     = time.Hour
+	defaultDNSNegativeTTL  = 5 * time.Minute
+	dnsServerDefaultPort   = "53"
+	dnsServerDialTimeout   = time.Second
+	dnsMaxCachedNameLength = 253
+)
+
+// Kinds of DNS lookups
+const (
+	DNSLookupForward = "forward" // addresses of a host name
+	DNSLookupReverse = "reverse" // host names of an address
+)
+
+// DNSConfig configures the resolver of <append type="DNS"> elements. Every field is optional,
+// lookups use the system resolver by default.
+type DNSConfig struct {
+	Servers     []string      `yaml:"servers,omitempty"`      // host or host:port, tried in turn, instead of the system resolver
+	Workers     int           `yaml:"workers,omitempty"`      // concurrent lookups, default 16
+	QueueSize   int           `yaml:"queue_size,omitempty"`   // lookups waiting for a worker, default 1024
+	Timeout     time.Duration `yaml:"timeout,omitempty"`      // per lookup, default 2s
+	Budget      time.Duration `yaml:"budget,omitempty"`       // time an event waits for all its lookups, default 50ms
+	CacheTTL    time.Duration `yaml:"cache_ttl,omitempty"`    // of answers, default 1h
+	NegativeTTL time.Duration `yaml:"negative_ttl,omitempty"` // of names that do not exist, default 5m
+}
+
+// Validate checks the DNS configuration
+func (c *DNSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Workers < 0 || c.QueueSize < 0 {
+		return fmt.Errorf("dns workers and queue_size cannot be negative")
+	}
+	if c.Timeout < 0 || c.Budget < 0 || c.CacheTTL < 0 || c.NegativeTTL < 0 {
+		return fmt.Errorf("dns durations cannot be negative")
+	}
+	for _, server := range c.Servers {
+		if strings.TrimSpace(server) == "" {
+			return fmt.Errorf("dns server cannot be empty")
+		}
+	}
+	return nil
+}
+
+type dnsLookup struct {
+	kind, name string
+	done       chan struct{}
+	result     []string
+}
+
+// DNSResolver runs forward and reverse lookups on a bounded pool of workers. Answers are cached in
+// Redis, so nodes share them and a name is resolved once per TTL. A lookup that does not finish
+// within the wait of the caller keeps running and fills the cache for the next events.
+type DNSResolver struct {
+	timeout     time.Duration
+	budget      time.Duration
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	queue   chan *dnsLookup
+	mu      sync.Mutex
+	pending map[string]*dnsLookup
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	workers  int
+}
+
+// GlobalDNS is the resolver of <append type="DNS"> elements
+var GlobalDNS *DNSResolver
+
+// NewDNSResolver creates a resolver, cfg may be nil
+func NewDNSResolver(cfg *DNSConfig) (*DNSResolver, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &DNSConfig{}
+	}
+	d := &DNSResolver{
+		timeout:     defaultDNSTimeout,
+		budget:      defaultDNSBudget,
+		ttl:         defaultDNSCacheTTL,
+		negativeTTL: defaultDNSNegativeTTL,
+		workers:     defaultDNSWorkers,
+		pending:     make(map[string]*dnsLookup),
+		stopChan:    make(chan struct{}),
+	}
+	if cfg.Timeout > 0 {
+		d.timeout = cfg.Timeout
+	}
+	if cfg.Budget > 0 {
+		d.budget = cfg.Budget
+	}
+	if cfg.CacheTTL > 0 {
+		d.ttl = cfg.CacheTTL
+	}
+	if cfg.NegativeTTL > 0 {
+		d.negativeTTL = cfg.NegativeTTL
+	}
+	if cfg.Workers > 0 {
+		d.workers = cfg.Workers
+	}
+	queueSize := defaultDNSQueueSize
+	if cfg.QueueSize > 0 {
+		queueSize = cfg.QueueSize
+	}
+	d.queue = make(chan *dnsLookup, queueSize)
+
+	resolver := net.DefaultResolver
+	if len(cfg.Servers) > 0 {
+		servers := make([]string, len(cfg.Servers))
+		for i, s := range cfg.Servers {
+			s = strings.TrimSpace(s)
+			if _, _, err := net.SplitHostPort(s); err != nil {
+				s = net.JoinHostPort(s, dnsServerDefaultPort)
+			}
+			servers[i] = s
+		}
+		var next atomic.Uint32
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dialer := net.Dialer{Timeout: dnsServerDialTimeout}
+				server := servers[int(next.Add(1)-1)%len(servers)]
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	d.lookupAddr = resolver.LookupAddr
+	d.lookupHost = resolver.LookupHost
+	return d, nil
+}
+
+// SetLookupFuncs replaces the functions resolving addresses and host names, for tests
+func (d *DNSResolver) SetLookupFuncs(addr, host func(ctx context.Context, name string) ([]string, error)) {
+	d.lookupAddr = addr
+	d.lookupHost = host
+}
+
+// Budget is the time an event may wait for its lookups
+func (d *DNSResolver) Budget() time.Duration {
+	return d.budget
+}
+
+// Start starts the workers
+func (d *DNSResolver) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-d.stopChan:
+					return
+				case l := <-d.queue:
+					d.resolve(l)
+				}
+			}
+		}()
+	}
+}
+
+// Stop stops the workers, lookups still queued are abandoned
+func (d *DNSResolver) Stop() {
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+// Lookup resolves name, an IP address for a reverse lookup or a host name for a forward lookup,
+// waiting at most wait. It returns the host names or addresses and whether the answer is known in
+// time; a name that does not exist is known and has no result. When the queue is full the lookup
+// is dropped rather than blocking the caller.
+func (d *DNSResolver) Lookup(kind, name string, wait time.Duration) ([]string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	if name == "" || len(name) > dnsMaxCachedNameLength {
+		return nil, false
+	}
+	if kind == DNSLookupReverse && net.ParseIP(name) == nil {
+		return nil, false
+	}
+	key := dnsCacheKeyPrefix + kind + ":" + name
+
+	d.mu.Lock()
+	l, inFlight := d.pending[key]
+	if !inFlight {
+		l = &dnsLookup{kind: kind, name: name, done: make(chan struct{})}
+		select {
+		case d.queue <- l:
+			d.pending[key] = l
+		default:
+			d.mu.Unlock()
+			return nil, false
+		}
+	}
+	d.mu.Unlock()
+
+	if wait <= 0 {
+		return nil, false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-l.done:
+		return l.result, l.result != nil
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+// resolve answers a lookup from the cache or the DNS and caches the answer. Errors other than a
+// name that does not exist, such as timeouts, are not cached.
+func (d *DNSResolver) resolve(l *dnsLookup) {
+	key := dnsCacheKeyPrefix + l.kind + ":" + l.name
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, key)
+		d.mu.Unlock()
+		close(l.done)
+	}()
+
+	cacheable := GetRedisClient() != nil
+	if cacheable {
+		if cached, err := RedisGet(key); err == nil {
+			var result []string
+			if json.Unmarshal([]byte(cached), &result) == nil && result != nil {
+				l.result = result
+				return
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	var result []string
+	var err error
+	if l.kind == DNSLookupReverse {
+		result, err = d.lookupAddr(ctx, l.name)
+		for i := range result {
+			result[i] = strings.TrimSuffix(result[i], ".")
+		}
+	} else {
+		result, err = d.lookupHost(ctx, l.name)
+	}
+
+	ttl := d.ttl
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			logger.Debug("DNS lookup failed", "kind", l.kind, "name", l.name, "error", err)
+			return
+		}
+		result, ttl = []string{}, d.negativeTTL
+	}
+	if result == nil {
+		result = []string{}
+	}
+	l.result = result
+	if cacheable {
+		value, _ := json.Marshal(result)
+		if _, err := RedisSet(key, string(value), max(1, int(ttl/time.Second))); err != nil {
+			logger.Debug("Failed to cache DNS answer", "name", l.name, "error", err)
+		}
+	}
+}
+
+// InitDNS starts the resolver of <append type="DNS"> elements
+func InitDNS(cfg *DNSConfig) {
+	if GlobalDNS != nil {
+		return
+	}
+	d, err := NewDNSResolver(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize DNS resolver", "error", err)
+		return
+	}
+	GlobalDNS = d
+	d.Start()
+}
+
+// StopDNS stops the resolver
+func StopDNS() {
+	if GlobalDNS != nil {
+		GlobalDNS.Stop()
+		GlobalDNS = nil
+	}
+}
@@ -1,16 +1,20 @@
 package common
 
 import (
+	"AgentSmith-HUB/logger"
 	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
 // ElasticsearchAuthConfig represents authentication configuration for Elasticsearch
@@ -22,17 +26,48 @@ type ElasticsearchAuthConfig struct {
 	Token    string `yaml:"token,omitempty"`    // for bearer token auth
 }
 
+const defaultESQuarantineMaxLen = 10000
+
+// ElasticsearchQuarantineConfig sends documents the cluster rejects for their content, such as
+// mapping conflicts, to a quarantine index and/or Redis list together with the rejection reason
+type ElasticsearchQuarantineConfig struct {
+	Index       string `yaml:"index,omitempty"`         // index in the same cluster, supports the same placeholders as the output index
+	RedisList   string `yaml:"redis_list,omitempty"`    // Redis list receiving the quarantined documents, newest first
+	RedisMaxLen int64  `yaml:"redis_max_len,omitempty"` // default 10000
+}
+
+// ElasticsearchProducerOptions holds the optional index management settings of a producer
+type ElasticsearchProducerOptions struct {
+	DataStream bool   // index into a data stream with create actions, @timestamp is added when missing
+	Project    string // value of the {project} placeholder
+	Template   *ElasticsearchTemplateConfig
+	ILM        *ElasticsearchILMConfig
+	Quarantine *ElasticsearchQuarantineConfig
+	HTTP       *OutputHTTPConfig // TLS and proxy of the client
+}
+
 // ElasticsearchProducer wraps the Elasticsearch client with a channel-based interface
 type ElasticsearchProducer struct {
 	Client        *elasticsearch.Client
 	MsgChan       chan map[string]interface{}
-	Index         string
-	IndexTemplate string // Store the original index template for time pattern replacement
+	Index         string // index of the last batch
+	IndexTemplate string // index name template, resolved per event when a batch is sent
+	Version       ElasticsearchVersion
+	dataStream    bool
 	batchSize     int
 	flushDur      time.Duration
 	maxRetries    int
 	retryDelay    time.Duration
-	stopChan      chan struct{} // Add stop channel for graceful shutdown
+	Receipts      *DeliveryReceipts // optional, records acked/failed deliveries
+	Breaker       *OutputBreaker    // optional, fails batches without retries while the cluster is down
+	// PriorityChan is optional, high priority events read from it are indexed immediately instead of waiting for a batch
+	PriorityChan chan map[string]interface{}
+	stopChan     chan struct{} // Add stop channel for graceful shutdown
+
+	// quarantine of rejected documents, nil when not configured
+	quarantine      *ElasticsearchQuarantineConfig
+	quarantineIndex string
+	quarantineTotal uint64
 }
 
 // replaceTimePatterns replaces time patterns in index name with actual values
@@ -56,6 +91,12 @@ func replaceTimePatterns(indexTemplate string) string {
 		"{YYYY-MM}":    now.Format("2006-01"),
 		"{YYYY/MM}":    now.Format("2006/01"),
 		"{YYYY_MM}":    now.Format("2006_01"),
+		// Logstash / Java style date patterns
+		"{yyyy}":       now.Format("2006"),
+		"{yyyy.MM.dd}": now.Format("2006.01.02"),
+		"{yyyy-MM-dd}": now.Format("2006-01-02"),
+		"{yyyy.MM}":    now.Format("2006.01"),
+		"{yyyy-MM}":    now.Format("2006-01"),
 	}
 
 	result := indexTemplate
@@ -66,17 +107,32 @@ func replaceTimePatterns(indexTemplate string) string {
 	return result
 }
 
+// esTransport returns the transport of an Elasticsearch client. Without a tls block certificates
+// are not verified, as before tls could be configured.
+func esTransport(httpCfg *OutputHTTPConfig) (*http.Transport, error) {
+	transport, err := NewOutputHTTPTransport(httpCfg)
+	if err != nil {
+		return nil, err
+	}
+	if httpCfg == nil || httpCfg.TLS == nil {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true, // Skip TLS certificate verification
+		}
+	}
+	return transport, nil
+}
+
 // NewElasticsearchProducer creates a new Elasticsearch producer
-func NewElasticsearchProducer(hosts []string, index string, msgChan chan map[string]interface{}, batchSize int, flushDur time.Duration, auth *ElasticsearchAuthConfig) (*ElasticsearchProducer, error) {
+func NewElasticsearchProducer(hosts []string, index string, msgChan chan map[string]interface{}, batchSize int, flushDur time.Duration, auth *ElasticsearchAuthConfig, options ElasticsearchProducerOptions) (*ElasticsearchProducer, error) {
+	transport, err := esTransport(options.HTTP)
+	if err != nil {
+		return nil, err
+	}
 	cfg := elasticsearch.Config{
 		Addresses:     hosts,
 		MaxRetries:    3,
 		RetryOnStatus: []int{502, 503, 504, 429},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip TLS certificate verification
-			},
-		},
+		Transport:     transport,
 	}
 
 	// Configure authentication if provided
@@ -105,19 +161,47 @@ func NewElasticsearchProducer(hosts []string, index string, msgChan chan map[str
 		return nil, fmt.Errorf("failed to create ES client: %v", err)
 	}
 
-	// Replace time patterns in index name
-	resolvedIndex := replaceTimePatterns(index)
+	var quarantineIndex string
+	if options.Quarantine != nil {
+		quarantineIndex = options.Quarantine.Index
+	}
+	if options.Project != "" {
+		index = strings.ReplaceAll(index, "{project}", strings.ToLower(options.Project))
+		quarantineIndex = strings.ReplaceAll(quarantineIndex, "{project}", strings.ToLower(options.Project))
+	}
+
+	// The v8 client refuses clusters that fail its product check, so the version is read
+	// through the raw transport and decides how bulk requests are sent
+	ctx, cancel := context.WithTimeout(context.Background(), esBootstrapTimeout)
+	defer cancel()
+	version, err := detectElasticsearchVersion(ctx, client.Transport)
+	if err != nil {
+		if options.DataStream || options.Template != nil || options.ILM != nil {
+			return nil, fmt.Errorf("failed to detect Elasticsearch version: %v", err)
+		}
+		// Keep the previous behaviour of starting while the cluster is unreachable
+		logger.Warn("Failed to detect Elasticsearch version, assuming 8.x", "hosts", hosts, "error", err)
+		version = ElasticsearchVersion{Distribution: DistributionElasticsearch, Major: 8}
+	}
+	if err := esBootstrap(ctx, client.Transport, version, index, options.DataStream, options.Template, options.ILM); err != nil {
+		return nil, err
+	}
 
 	prod := &ElasticsearchProducer{
 		Client:        client,
 		MsgChan:       msgChan,
-		Index:         resolvedIndex,
-		IndexTemplate: index, // Store original template for potential future use
+		Index:         replaceTimePatterns(index),
+		IndexTemplate: index,
+		Version:       version,
+		dataStream:    options.DataStream,
 		batchSize:     batchSize,
 		flushDur:      flushDur,
 		maxRetries:    3,
 		retryDelay:    1 * time.Second,
 		stopChan:      make(chan struct{}),
+
+		quarantine:      options.Quarantine,
+		quarantineIndex: quarantineIndex,
 	}
 
 	go prod.run()
@@ -130,6 +214,14 @@ func (p *ElasticsearchProducer) run() {
 	defer timer.Stop()
 
 	for {
+		// Serve the priority lane first so critical events never wait behind a bulk batch
+		select {
+		case msg := <-p.PriorityChan:
+			p.flushPriority(msg)
+			continue
+		default:
+		}
+
 		select {
 		case <-p.stopChan:
 			// Stop timer to prevent any further timer events
@@ -141,6 +233,7 @@ func (p *ElasticsearchProducer) run() {
 			}
 			// Don't flush remaining batch during shutdown to avoid blocking
 			// Just return immediately to ensure fast shutdown
+			p.Receipts.AddFailed(uint64(len(batch)))
 			return
 		case msg, ok := <-p.MsgChan:
 			if !ok {
@@ -149,6 +242,7 @@ func (p *ElasticsearchProducer) run() {
 				select {
 				case <-p.stopChan:
 					// Stop signal received, skip flushing and return immediately
+					p.Receipts.AddFailed(uint64(len(batch)))
 					return
 				default:
 					// No stop signal, flush remaining batch
@@ -167,6 +261,8 @@ func (p *ElasticsearchProducer) run() {
 				}
 				timer.Reset(p.flushDur)
 			}
+		case msg := <-p.PriorityChan:
+			p.flushPriority(msg)
 		case <-timer.C:
 			if len(batch) > 0 {
 				p.flush(batch)
@@ -177,6 +273,21 @@ func (p *ElasticsearchProducer) run() {
 	}
 }
 
+// flushPriority indexes a high priority event together with any others already waiting in the priority lane
+func (p *ElasticsearchProducer) flushPriority(first map[string]interface{}) {
+	batch := []map[string]interface{}{first}
+	for len(batch) < p.batchSize {
+		select {
+		case msg := <-p.PriorityChan:
+			batch = append(batch, msg)
+		default:
+			p.flush(batch)
+			return
+		}
+	}
+	p.flush(batch)
+}
+
 // sendBatch sends a batch of documents to Elasticsearch with retry logic
 func (p *ElasticsearchProducer) sendBatch(batch []map[string]interface{}) {
 	if len(batch) == 0 {
@@ -184,22 +295,54 @@ func (p *ElasticsearchProducer) sendBatch(batch []map[string]interface{}) {
 	}
 
 	var buf bytes.Buffer
+	encoded := 0
+	// documents and indices in bulk order, to match rejected items back to their document
+	docs := make([]map[string]interface{}, 0, len(batch))
+	indices := make([]string, 0, len(batch))
+	// checkpoint tokens in bulk order, documents that cannot be encoded are released right away
+	var tokens DeliveryTokens
 	for _, doc := range batch {
-		// Add index action
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index": p.Index,
-			},
+		token := TakeDeliveryToken(doc)
+		index := ResolveIndexName(p.IndexTemplate, doc)
+		p.Index = index
+		action := map[string]interface{}{"_index": index}
+		if !p.Version.IsOpenSearch() && p.Version.Major > 0 && p.Version.Major < 7 {
+			// 6.x still requires a mapping type
+			action["_type"] = "_doc"
+		}
+		op := "index"
+		if p.dataStream {
+			// Data streams are append-only and only accept create
+			op = "create"
+			if _, ok := doc["@timestamp"]; !ok {
+				doc["@timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+			}
 		}
+		meta := map[string]interface{}{op: action}
+		lineStart := buf.Len()
 		if err := json.NewEncoder(&buf).Encode(meta); err != nil {
 			fmt.Printf("Failed to encode meta: %v\n", err)
+			p.Receipts.AddFailed(1)
+			token.Release()
 			continue
 		}
 		// Add document
 		if err := json.NewEncoder(&buf).Encode(doc); err != nil {
 			fmt.Printf("Failed to encode document: %v\n", err)
+			p.Receipts.AddFailed(1)
+			token.Release()
+			// Drop the dangling action line so the bulk body stays valid
+			buf.Truncate(lineStart)
 			continue
 		}
+		encoded++
+		docs = append(docs, doc)
+		indices = append(indices, index)
+		tokens = append(tokens, token)
+	}
+
+	if encoded == 0 {
+		return
 	}
 
 	// Try to send with retries and timeout control
@@ -208,50 +351,266 @@ func (p *ElasticsearchProducer) sendBatch(batch []map[string]interface{}) {
 		select {
 		case <-p.stopChan:
 			// Stop signal received, abort sending
+			p.Receipts.AddFailed(uint64(encoded))
+			tokens.Fail()
 			return
 		default:
 		}
+		if !p.Breaker.Allow() {
+			p.Receipts.AddFailed(uint64(encoded))
+			tokens.Fail()
+			return
+		}
 
 		// Create context with shorter timeout for faster shutdown (reduced from 5s to 2s)
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 
-		// Use context for bulk request
-		res, err := p.Client.Bulk(bytes.NewReader(buf.Bytes()), p.Client.Bulk.WithContext(ctx))
-
-		cancel() // Always cancel context
+		res, err := p.bulk(ctx, buf.Bytes())
 
 		if err != nil {
+			cancel()
+			p.Breaker.Failure(err)
 			if i == p.maxRetries {
 				fmt.Printf("Failed to send batch to ES after %d retries: %v\n", p.maxRetries, err)
+				p.Receipts.AddFailed(uint64(encoded))
+				tokens.Fail()
 				return
 			}
 			// Check stop signal before retry delay
 			select {
 			case <-p.stopChan:
+				p.Receipts.AddFailed(uint64(encoded))
+				tokens.Fail()
 				return
 			case <-time.After(p.retryDelay):
 			}
 			continue
 		}
-		defer res.Body.Close()
 
 		if res.IsError() {
+			res.Body.Close()
+			cancel()
+			if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+				p.Breaker.Failure(fmt.Errorf("bulk request returned %d", res.StatusCode))
+			} else {
+				// The cluster answered, the request itself was refused and sending it again will not help
+				p.Breaker.Success()
+				logger.Warn("Elasticsearch refused bulk request", "index", p.Index, "status", res.StatusCode, "documents", encoded)
+				p.Receipts.AddFailed(uint64(encoded))
+				tokens.Fail()
+				return
+			}
 			if i == p.maxRetries {
 				fmt.Printf("ES returned error after %d retries: %s\n", p.maxRetries, res.String())
+				p.Receipts.AddFailed(uint64(encoded))
+				tokens.Fail()
 				return
 			}
 			// Check stop signal before retry delay
 			select {
 			case <-p.stopChan:
+				p.Receipts.AddFailed(uint64(encoded))
+				tokens.Fail()
 				return
 			case <-time.After(p.retryDelay):
 			}
 			continue
 		}
 
-		// Success
+		// Success at request level, individual documents may still have been rejected
+		p.Breaker.Success()
+		failures := bulkItemFailures(res.Body)
+		res.Body.Close()
+		cancel()
+		failed := min(len(failures), encoded)
+		p.Receipts.AddFailed(uint64(failed))
+		p.Receipts.AddAcked(uint64(encoded - failed))
+		p.quarantineRejected(docs, indices, failures)
+		releaseBulkTokens(tokens, failures)
+		return
+	}
+}
+
+// releaseBulkTokens releases the checkpoint tokens of an answered bulk request. Documents rejected
+// for their content (400) were refused for good and are released too, the others failed.
+func releaseBulkTokens(tokens DeliveryTokens, failures []bulkItemFailure) {
+	if len(tokens) == 0 {
+		return
+	}
+	for _, f := range failures {
+		if f.status != http.StatusBadRequest && f.pos < len(tokens) {
+			tokens[f.pos].Fail()
+			tokens[f.pos] = nil
+		}
+	}
+	tokens.Release()
+}
+
+// bulk sends a bulk body, through the v8 client on Elasticsearch 7.14+ and through the raw
+// transport on clusters it does not accept
+func (p *ElasticsearchProducer) bulk(ctx context.Context, body []byte) (*esapi.Response, error) {
+	if p.Version.usesElasticClient() {
+		return p.Client.Bulk(bytes.NewReader(body), p.Client.Bulk.WithContext(ctx))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res, err := p.Client.Transport.Perform(req)
+	if err != nil {
+		return nil, err
+	}
+	return &esapi.Response{StatusCode: res.StatusCode, Header: res.Header, Body: res.Body}, nil
+}
+
+// bulkItemFailure is a document rejected in a bulk response
+type bulkItemFailure struct {
+	pos    int // position of the document in the bulk request
+	status int
+	kind   string // error type, e.g. mapper_parsing_exception
+	reason string
+}
+
+// bulkItemFailures returns the rejected documents of a bulk response
+func bulkItemFailures(body io.Reader) []bulkItemFailure {
+	type bulkError struct {
+		Type     string `json:"type"`
+		Reason   string `json:"reason"`
+		CausedBy *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"caused_by"`
+	}
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int        `json:"status"`
+			Error  *bulkError `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil || !resp.Errors {
+		return nil
+	}
+	var failures []bulkItemFailure
+	for pos, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			f := bulkItemFailure{pos: pos, status: result.Status}
+			if e := result.Error; e != nil {
+				f.kind, f.reason = e.Type, e.Reason
+				if e.CausedBy != nil && e.CausedBy.Reason != "" {
+					f.reason += ": " + e.CausedBy.Reason
+				}
+			}
+			failures = append(failures, f)
+		}
+	}
+	return failures
+}
+
+// quarantineRejected sends documents rejected for their content (status 400, e.g. mapping conflicts)
+// to the quarantine. Overloaded or unavailable shards are not quarantined since the document itself is fine.
+func (p *ElasticsearchProducer) quarantineRejected(docs []map[string]interface{}, indices []string, failures []bulkItemFailure) {
+	if p.quarantine == nil || len(failures) == 0 {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var entries []map[string]interface{}
+	var targets []string // quarantine index of each entry, resolved with the original document
+	var first bulkItemFailure
+	for _, f := range failures {
+		if f.status != http.StatusBadRequest || f.pos >= len(docs) {
+			continue
+		}
+		doc, err := json.Marshal(docs[f.pos])
+		if err != nil {
+			continue
+		}
+		if len(entries) == 0 {
+			first = f
+		}
+		if p.quarantineIndex != "" {
+			targets = append(targets, ResolveIndexName(p.quarantineIndex, docs[f.pos]))
+		}
+		entries = append(entries, map[string]interface{}{
+			"@timestamp": now,
+			"_hub_quarantine": map[string]interface{}{
+				"index":  indices[f.pos],
+				"status": f.status,
+				"type":   f.kind,
+				"reason": truncateRunes(f.reason, 1024),
+			},
+			// Kept as a string so the conflict that rejected it cannot reject it again
+			"document": string(doc),
+		})
+	}
+	if len(entries) == 0 {
 		return
 	}
+	atomic.AddUint64(&p.quarantineTotal, uint64(len(entries)))
+	logger.Warn("Elasticsearch rejected documents, sending them to quarantine", "index", indices[first.pos],
+		"count", len(entries), "type", first.kind, "reason", first.reason)
+
+	if key := p.quarantine.RedisList; key != "" {
+		maxLen := p.quarantine.RedisMaxLen
+		if maxLen <= 0 {
+			maxLen = defaultESQuarantineMaxLen
+		}
+		for _, entry := range entries {
+			data, _ := json.Marshal(entry)
+			if err := RedisLPush(key, data, maxLen); err != nil {
+				logger.Warn("Failed to push quarantined document to Redis", "list", key, "error", err)
+				break
+			}
+		}
+	}
+	if p.quarantineIndex != "" {
+		if err := p.indexQuarantine(entries, targets); err != nil {
+			logger.Warn("Failed to index quarantined documents", "index", p.quarantineIndex, "count", len(entries), "error", err)
+		}
+	}
+}
+
+// indexQuarantine writes quarantined documents to the quarantine index in one attempt
+func (p *ElasticsearchProducer) indexQuarantine(entries []map[string]interface{}, targets []string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, entry := range entries {
+		action := map[string]interface{}{"_index": targets[i]}
+		if !p.Version.IsOpenSearch() && p.Version.Major > 0 && p.Version.Major < 7 {
+			action["_type"] = "_doc"
+		}
+		if err := enc.Encode(map[string]interface{}{"index": action}); err != nil {
+			return err
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := p.bulk(ctx, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("bulk request returned %d", res.StatusCode)
+	}
+	if failures := bulkItemFailures(res.Body); len(failures) > 0 {
+		return fmt.Errorf("%d documents rejected: %s", len(failures), failures[0].reason)
+	}
+	return nil
+}
+
+// GetQuarantineTotal returns the number of rejected documents sent to the quarantine
+func (p *ElasticsearchProducer) GetQuarantineTotal() uint64 {
+	return atomic.LoadUint64(&p.quarantineTotal)
 }
 
 // flush batch writes to ES
@@ -272,16 +631,16 @@ func (p *ElasticsearchProducer) Close() {
 
 // TestConnection tests the connection to Elasticsearch cluster
 // This method creates a temporary client to test connectivity without affecting the main producer
-func TestElasticsearchConnection(hosts []string, auth *ElasticsearchAuthConfig) error {
+func TestElasticsearchConnection(hosts []string, auth *ElasticsearchAuthConfig, httpCfg *OutputHTTPConfig) error {
+	transport, err := esTransport(httpCfg)
+	if err != nil {
+		return err
+	}
 	cfg := elasticsearch.Config{
 		Addresses:     hosts,
 		MaxRetries:    1,
 		RetryOnStatus: []int{502, 503, 504, 429},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip TLS certificate verification
-			},
-		},
+		Transport:     transport,
 	}
 
 	// Configure authentication if provided
@@ -315,30 +674,30 @@ func TestElasticsearchConnection(hosts []string, auth *ElasticsearchAuthConfig)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	res, err := testClient.Ping(testClient.Ping.WithContext(ctx))
+	// The raw transport skips the product check of the v8 client so OpenSearch can be reached too
+	status, body, err := esPerform(ctx, testClient.Transport, http.MethodHead, "/", nil, "")
 	if err != nil {
 		return fmt.Errorf("failed to ping Elasticsearch cluster: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		return fmt.Errorf("Elasticsearch cluster returned error: %s", res.String())
+	if status >= 300 {
+		return fmt.Errorf("Elasticsearch cluster returned error: [%d] %s", status, truncateRunes(string(body), 256))
 	}
 
 	return nil
 }
 
 // TestIndexExists tests if a specific index exists in Elasticsearch
-func TestElasticsearchIndexExists(hosts []string, index string, auth *ElasticsearchAuthConfig) (bool, error) {
+func TestElasticsearchIndexExists(hosts []string, index string, auth *ElasticsearchAuthConfig, httpCfg *OutputHTTPConfig) (bool, error) {
+	transport, err := esTransport(httpCfg)
+	if err != nil {
+		return false, err
+	}
 	cfg := elasticsearch.Config{
 		Addresses:     hosts,
 		MaxRetries:    1,
 		RetryOnStatus: []int{502, 503, 504, 429},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip TLS certificate verification
-			},
-		},
+		Transport:     transport,
 	}
 
 	// Configure authentication if provided
@@ -372,33 +731,32 @@ func TestElasticsearchIndexExists(hosts []string, index string, auth *Elasticsea
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	res, err := testClient.Indices.Exists([]string{index}, testClient.Indices.Exists.WithContext(ctx))
+	status, _, err := esPerform(ctx, testClient.Transport, http.MethodHead, "/"+index, nil, "")
 	if err != nil {
 		return false, fmt.Errorf("failed to check index existence: %w", err)
 	}
-	defer res.Body.Close()
 
 	// 200 means index exists, 404 means index doesn't exist
-	if res.StatusCode == 200 {
+	if status == 200 {
 		return true, nil
-	} else if res.StatusCode == 404 {
+	} else if status == 404 {
 		return false, nil
 	} else {
-		return false, fmt.Errorf("unexpected response when checking index: %s", res.String())
+		return false, fmt.Errorf("unexpected response when checking index: status %d", status)
 	}
 }
 
 // GetElasticsearchClusterInfo gets basic cluster information
-func GetElasticsearchClusterInfo(hosts []string, auth *ElasticsearchAuthConfig) (map[string]interface{}, error) {
+func GetElasticsearchClusterInfo(hosts []string, auth *ElasticsearchAuthConfig, httpCfg *OutputHTTPConfig) (map[string]interface{}, error) {
+	transport, err := esTransport(httpCfg)
+	if err != nil {
+		return nil, err
+	}
 	cfg := elasticsearch.Config{
 		Addresses:     hosts,
 		MaxRetries:    1,
 		RetryOnStatus: []int{502, 503, 504, 429},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip TLS certificate verification
-			},
-		},
+		Transport:     transport,
 	}
 
 	// Configure authentication if provided
@@ -432,18 +790,17 @@ func GetElasticsearchClusterInfo(hosts []string, auth *ElasticsearchAuthConfig)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	res, err := testClient.Info(testClient.Info.WithContext(ctx))
+	status, body, err := esPerform(ctx, testClient.Transport, http.MethodGet, "/", nil, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cluster info: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		return nil, fmt.Errorf("Elasticsearch cluster returned error: %s", res.String())
+	if status >= 300 {
+		return nil, fmt.Errorf("Elasticsearch cluster returned error: [%d] %s", status, truncateRunes(string(body), 256))
 	}
 
 	var clusterInfo map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&clusterInfo); err != nil {
+	if err := json.Unmarshal(body, &clusterInfo); err != nil {
 		return nil, fmt.Errorf("failed to decode cluster info: %w", err)
 	}
 
@@ -0,0 +1,394 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+// Search engine distributions reported by GET /
+const (
+	DistributionElasticsearch = "elasticsearch"
+	DistributionOpenSearch    = "opensearch"
+)
+
+// esBootstrapTimeout bounds version detection and template bootstrap when a producer starts
+const esBootstrapTimeout = 30 * time.Second
+
+// ElasticsearchTemplateConfig bootstraps an index template matching the output's indices
+type ElasticsearchTemplateConfig struct {
+	Name      string                 `yaml:"name,omitempty"`      // default: index prefix before the first placeholder
+	Patterns  []string               `yaml:"patterns,omitempty"`  // default: index with every placeholder replaced by *
+	Priority  int                    `yaml:"priority,omitempty"`  // default 200 for composable templates, order for legacy templates
+	Shards    int                    `yaml:"shards,omitempty"`    // number_of_shards
+	Replicas  *int                   `yaml:"replicas,omitempty"`  // number_of_replicas
+	Settings  map[string]interface{} `yaml:"settings,omitempty"`  // additional index settings
+	Mappings  string                 `yaml:"mappings,omitempty"`  // JSON mappings body
+	Overwrite bool                   `yaml:"overwrite,omitempty"` // replace an existing template
+}
+
+// ElasticsearchILMConfig bootstraps a lifecycle policy, ILM on Elasticsearch and ISM on OpenSearch
+type ElasticsearchILMConfig struct {
+	Policy          string `yaml:"policy"`
+	RolloverMaxAge  string `yaml:"rollover_max_age,omitempty"`  // e.g. 1d, data streams only
+	RolloverMaxSize string `yaml:"rollover_max_size,omitempty"` // primary shard size, e.g. 50gb, data streams only
+	DeleteAfter     string `yaml:"delete_after,omitempty"`      // e.g. 30d
+	Overwrite       bool   `yaml:"overwrite,omitempty"`         // replace an existing ILM policy, ISM policies are only created
+}
+
+// ElasticsearchVersion is the distribution and version of the cluster, it decides which APIs are used
+type ElasticsearchVersion struct {
+	Distribution string `json:"distribution"`
+	Number       string `json:"number"`
+	Major        int    `json:"major"`
+	Minor        int    `json:"minor"`
+}
+
+// IsOpenSearch reports whether the cluster is OpenSearch
+func (v ElasticsearchVersion) IsOpenSearch() bool {
+	return v.Distribution == DistributionOpenSearch
+}
+
+// atLeast compares an Elasticsearch version, OpenSearch always passes as it forked from 7.10
+func (v ElasticsearchVersion) atLeast(major, minor int) bool {
+	if v.IsOpenSearch() {
+		return major < 7 || (major == 7 && minor <= 10)
+	}
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// usesElasticClient reports whether the v8 client can talk to the cluster, it rejects
+// servers that do not identify as Elasticsearch (OpenSearch and Elasticsearch before 7.14)
+func (v ElasticsearchVersion) usesElasticClient() bool {
+	return !v.IsOpenSearch() && v.atLeast(7, 14)
+}
+
+// esVersionPattern matches the major and minor version number
+var esVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)`)
+
+// detectElasticsearchVersion reads GET / through the raw transport, which skips the product check
+func detectElasticsearchVersion(ctx context.Context, tp elastictransport.Interface) (ElasticsearchVersion, error) {
+	status, body, err := esPerform(ctx, tp, http.MethodGet, "/", nil, "")
+	if err != nil {
+		return ElasticsearchVersion{}, err
+	}
+	if status != http.StatusOK {
+		return ElasticsearchVersion{}, fmt.Errorf("cluster returned %d: %s", status, truncateRunes(string(body), 200))
+	}
+	var info struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return ElasticsearchVersion{}, fmt.Errorf("invalid cluster info: %w", err)
+	}
+	v := ElasticsearchVersion{Distribution: DistributionElasticsearch, Number: info.Version.Number}
+	if info.Version.Distribution == DistributionOpenSearch {
+		v.Distribution = DistributionOpenSearch
+	}
+	if m := esVersionPattern.FindStringSubmatch(info.Version.Number); m != nil {
+		v.Major, _ = strconv.Atoi(m[1])
+		v.Minor, _ = strconv.Atoi(m[2])
+	}
+	return v, nil
+}
+
+// esPerform sends a request through the raw transport and returns status and body
+func esPerform(ctx context.Context, tp elastictransport.Interface, method, path string, body []byte, contentType string) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := tp.Perform(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	respBody, err := io.ReadAll(res.Body)
+	return res.StatusCode, respBody, err
+}
+
+// esPlaceholder matches {name} placeholders in index names
+var esPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// esIndexInvalidChars matches characters not allowed in index names from event values
+var esIndexInvalidChars = regexp.MustCompile(`[^a-z0-9_.\-]+`)
+
+// ResolveIndexName resolves an index name for one event: time patterns such as {YYYY.MM.DD} use the
+// current time, every other {field} placeholder is replaced by the lowercased value of the event field
+func ResolveIndexName(template string, event map[string]interface{}) string {
+	resolved := replaceTimePatterns(template)
+	if !strings.Contains(resolved, "{") {
+		return resolved
+	}
+	return esPlaceholder.ReplaceAllStringFunc(resolved, func(m string) string {
+		value, ok := GetCheckData(event, StringToList(m[1:len(m)-1]))
+		if !ok {
+			return "unknown"
+		}
+		value = esIndexInvalidChars.ReplaceAllString(strings.ToLower(value), "_")
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	})
+}
+
+// IndexPattern returns the wildcard pattern matching every index an index name template resolves to
+func IndexPattern(template string) string {
+	return esPlaceholder.ReplaceAllString(template, "*")
+}
+
+// indexTemplateName derives a template name from the index prefix before the first placeholder
+func indexTemplateName(index string) string {
+	name := index
+	if i := strings.Index(name, "{"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, "-_.")
+	if name == "" {
+		return "agentsmith-hub"
+	}
+	return name
+}
+
+// esBootstrap creates the lifecycle policy and the index template of an output when they are missing
+func esBootstrap(ctx context.Context, tp elastictransport.Interface, v ElasticsearchVersion, index string, dataStream bool, tmpl *ElasticsearchTemplateConfig, ilm *ElasticsearchILMConfig) error {
+	if dataStream && !v.atLeast(7, 9) {
+		return fmt.Errorf("data streams require Elasticsearch 7.9 or later, cluster runs %s", v.Number)
+	}
+	patterns := []string{IndexPattern(index)}
+	if tmpl != nil && len(tmpl.Patterns) > 0 {
+		patterns = tmpl.Patterns
+	}
+
+	if ilm != nil {
+		if err := esPutLifecyclePolicy(ctx, tp, v, ilm, patterns, dataStream); err != nil {
+			return err
+		}
+	}
+	if tmpl == nil && !dataStream && (ilm == nil || v.IsOpenSearch()) {
+		return nil
+	}
+	if tmpl == nil {
+		// A data stream needs a matching template, and ILM policies are attached through one
+		tmpl = &ElasticsearchTemplateConfig{}
+	}
+	return esPutIndexTemplate(ctx, tp, v, index, patterns, dataStream, tmpl, ilm)
+}
+
+func esPutLifecyclePolicy(ctx context.Context, tp elastictransport.Interface, v ElasticsearchVersion, ilm *ElasticsearchILMConfig, patterns []string, dataStream bool) error {
+	var path string
+	var policy map[string]interface{}
+	if v.IsOpenSearch() {
+		path = "/_plugins/_ism/policies/" + ilm.Policy
+		policy = ismPolicy(ilm, patterns, dataStream)
+	} else {
+		path = "/_ilm/policy/" + ilm.Policy
+		policy = ilmPolicy(v, ilm, dataStream)
+	}
+
+	// ISM policies need sequence numbers to be updated, so they are only created
+	overwrite := ilm.Overwrite && !v.IsOpenSearch()
+	if !overwrite {
+		status, _, err := esPerform(ctx, tp, http.MethodGet, path, nil, "")
+		if err != nil {
+			return fmt.Errorf("failed to check lifecycle policy %s: %w", ilm.Policy, err)
+		}
+		if status == http.StatusOK {
+			return nil
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"policy": policy})
+	if err != nil {
+		return err
+	}
+	status, resp, err := esPerform(ctx, tp, http.MethodPut, path, body, "")
+	if err != nil {
+		return fmt.Errorf("failed to create lifecycle policy %s: %w", ilm.Policy, err)
+	}
+	if status >= 300 {
+		return fmt.Errorf("failed to create lifecycle policy %s: %d %s", ilm.Policy, status, truncateRunes(string(resp), 500))
+	}
+	logger.Info("Created Elasticsearch lifecycle policy", "policy", ilm.Policy, "distribution", v.Distribution)
+	return nil
+}
+
+// ilmPolicy builds an ILM policy: rollover in the hot phase for data streams and an optional delete phase
+func ilmPolicy(v ElasticsearchVersion, ilm *ElasticsearchILMConfig, dataStream bool) map[string]interface{} {
+	phases := map[string]interface{}{}
+	hotActions := map[string]interface{}{}
+	if dataStream && (ilm.RolloverMaxAge != "" || ilm.RolloverMaxSize != "") {
+		rollover := map[string]interface{}{}
+		if ilm.RolloverMaxAge != "" {
+			rollover["max_age"] = ilm.RolloverMaxAge
+		}
+		if ilm.RolloverMaxSize != "" {
+			// max_primary_shard_size exists since 7.13, older versions only know the total size
+			if v.atLeast(7, 13) {
+				rollover["max_primary_shard_size"] = ilm.RolloverMaxSize
+			} else {
+				rollover["max_size"] = ilm.RolloverMaxSize
+			}
+		}
+		hotActions["rollover"] = rollover
+	}
+	phases["hot"] = map[string]interface{}{"min_age": "0ms", "actions": hotActions}
+	if ilm.DeleteAfter != "" {
+		phases["delete"] = map[string]interface{}{
+			"min_age": ilm.DeleteAfter,
+			"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+		}
+	}
+	return map[string]interface{}{"phases": phases}
+}
+
+// ismPolicy builds the OpenSearch ISM equivalent, attached to new indices by its ism_template
+func ismPolicy(ilm *ElasticsearchILMConfig, patterns []string, dataStream bool) map[string]interface{} {
+	var hotActions []interface{}
+	if dataStream && (ilm.RolloverMaxAge != "" || ilm.RolloverMaxSize != "") {
+		rollover := map[string]interface{}{}
+		if ilm.RolloverMaxAge != "" {
+			rollover["min_index_age"] = ilm.RolloverMaxAge
+		}
+		if ilm.RolloverMaxSize != "" {
+			rollover["min_primary_shard_size"] = ilm.RolloverMaxSize
+		}
+		hotActions = append(hotActions, map[string]interface{}{"rollover": rollover})
+	}
+	hot := map[string]interface{}{"name": "hot", "actions": hotActions, "transitions": []interface{}{}}
+	states := []interface{}{hot}
+	if ilm.DeleteAfter != "" {
+		hot["transitions"] = []interface{}{
+			map[string]interface{}{"state_name": "delete", "conditions": map[string]interface{}{"min_index_age": ilm.DeleteAfter}},
+		}
+		states = append(states, map[string]interface{}{
+			"name":        "delete",
+			"actions":     []interface{}{map[string]interface{}{"delete": map[string]interface{}{}}},
+			"transitions": []interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"description":   "Managed by AgentSmith-HUB",
+		"default_state": "hot",
+		"states":        states,
+		"ism_template":  []interface{}{map[string]interface{}{"index_patterns": patterns, "priority": 100}},
+	}
+}
+
+func esPutIndexTemplate(ctx context.Context, tp elastictransport.Interface, v ElasticsearchVersion, index string, patterns []string, dataStream bool, tmpl *ElasticsearchTemplateConfig, ilm *ElasticsearchILMConfig) error {
+	name := tmpl.Name
+	if name == "" {
+		name = indexTemplateName(index)
+	}
+
+	settings := map[string]interface{}{}
+	for k, val := range tmpl.Settings {
+		settings[k] = val
+	}
+	if tmpl.Shards > 0 {
+		settings["number_of_shards"] = tmpl.Shards
+	}
+	if tmpl.Replicas != nil {
+		settings["number_of_replicas"] = *tmpl.Replicas
+	}
+	if ilm != nil && !v.IsOpenSearch() {
+		settings["index.lifecycle.name"] = ilm.Policy
+	}
+	var mappings map[string]interface{}
+	if tmpl.Mappings != "" {
+		if err := json.Unmarshal([]byte(tmpl.Mappings), &mappings); err != nil {
+			return fmt.Errorf("invalid template mappings: %w", err)
+		}
+	}
+
+	// Composable templates exist since 7.8, older clusters only have legacy templates
+	composable := v.atLeast(7, 8)
+	var path string
+	var body map[string]interface{}
+	if composable {
+		// Built-in templates such as logs-*-* use priority 100, overlapping templates of equal priority are rejected
+		priority := tmpl.Priority
+		if priority == 0 {
+			priority = 200
+		}
+		path = "/_index_template/" + name
+		template := map[string]interface{}{}
+		if len(settings) > 0 {
+			template["settings"] = settings
+		}
+		if mappings != nil {
+			template["mappings"] = mappings
+		}
+		body = map[string]interface{}{
+			"index_patterns": patterns,
+			"template":       template,
+			"priority":       priority,
+			"_meta":          map[string]interface{}{"managed_by": "agentsmith-hub"},
+		}
+		if dataStream {
+			body["data_stream"] = map[string]interface{}{}
+		}
+	} else {
+		path = "/_template/" + name
+		body = map[string]interface{}{
+			"index_patterns": patterns,
+			"order":          tmpl.Priority,
+		}
+		if len(settings) > 0 {
+			body["settings"] = settings
+		}
+		if mappings != nil {
+			if v.Major < 7 {
+				// Mapping types were removed in 7, 6.x still expects the _doc type
+				mappings = map[string]interface{}{"_doc": mappings}
+			}
+			body["mappings"] = mappings
+		}
+	}
+
+	if !tmpl.Overwrite {
+		status, _, err := esPerform(ctx, tp, http.MethodGet, path, nil, "")
+		if err != nil {
+			return fmt.Errorf("failed to check index template %s: %w", name, err)
+		}
+		if status == http.StatusOK {
+			return nil
+		}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	status, resp, err := esPerform(ctx, tp, http.MethodPut, path, payload, "")
+	if err != nil {
+		return fmt.Errorf("failed to create index template %s: %w", name, err)
+	}
+	if status >= 300 {
+		return fmt.Errorf("failed to create index template %s: %d %s", name, status, truncateRunes(string(resp), 500))
+	}
+	logger.Info("Created Elasticsearch index template", "template", name, "patterns", patterns, "data_stream", dataStream, "composable", composable)
+	return nil
+}
@@ -43,8 +43,8 @@ func WriteErrorLogToRedis(entry ErrorLogEntry) error {
 		return fmt.Errorf("failed to push error log to Redis: %w", err)
 	}
 
-	// Set TTL for the key to 7 days (7 * 24 * 60 * 60 = 604800 seconds)
-	if err := RedisExpire(key, 14*24*60*60); err != nil {
+	// Expire the list of an idle node after the retention period, the janitor trims older entries
+	if err := RedisExpire(key, RetentionSeconds(RetentionErrorLogs)); err != nil {
 		// Don't fail if TTL setting fails, just log it
 		return nil
 	}
@@ -63,7 +63,7 @@ func GetErrorLogsFromRedis(nodeID string, limit int, offset int) ([]ErrorLogEntr
 	if nodeID == "" || nodeID == "all" {
 		// Get logs from all nodes
 		pattern := "cluster:error_logs:*"
-		keys, err := RedisKeys(pattern)
+		keys, err := RedisReadKeys(pattern)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get error log keys: %w", err)
 		}
@@ -145,7 +145,7 @@ func GetErrorLogsFromRedisWithFilter(nodeID string, source string, startTime, en
 	if nodeID == "" || nodeID == "all" {
 		// Get logs from all nodes with limited entries per node
 		pattern := "cluster:error_logs:*"
-		keys, err := RedisKeys(pattern)
+		keys, err := RedisReadKeys(pattern)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to get error log keys: %w", err)
 		}
@@ -249,7 +249,7 @@ func getErrorLogsFromKey(key string, limit int, offset int) ([]ErrorLogEntry, er
 	}
 
 	// Get entries from Redis list
-	jsonEntries, err := RedisLRange(key, start, stop)
+	jsonEntries, err := RedisReadLRange(key, start, stop)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get error logs from Redis: %w", err)
 	}
@@ -277,7 +277,7 @@ func GetErrorLogStats() (map[string]int, error) {
 
 	stats := make(map[string]int)
 	pattern := "cluster:error_logs:*"
-	keys, err := RedisKeys(pattern)
+	keys, err := RedisReadKeys(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get error log keys: %w", err)
 	}
@@ -287,7 +287,7 @@ func GetErrorLogStats() (map[string]int, error) {
 		nodeID := key[len("cluster:error_logs:"):]
 
 		// Get list length
-		length, err := rdb.LLen(ctx, key).Result()
+		length, err := RedisReadLLen(key)
 		if err != nil {
 			continue
 		}
@@ -0,0 +1,433 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Wire serializations of output events
+const (
+	SerializationJSON     = "json"
+	SerializationMsgpack  = "msgpack"
+	SerializationProtobuf = "protobuf"
+)
+
+// Payload compressions, also used as HTTP Content-Encoding
+const (
+	PayloadCompressionNone   = "none"
+	PayloadCompressionGzip   = "gzip"
+	PayloadCompressionZstd   = "zstd"
+	PayloadCompressionSnappy = "snappy"
+)
+
+// EncodingConfig selects how an output serializes and compresses events on the wire
+type EncodingConfig struct {
+	Serialization string                  `yaml:"serialization,omitempty"` // json (default), msgpack or protobuf
+	Compression   string                  `yaml:"compression,omitempty"`   // none (default), gzip, zstd or snappy
+	Protobuf      *ProtobufEncodingConfig `yaml:"protobuf,omitempty"`
+}
+
+// ProtobufEncodingConfig names the message events are converted to. Event fields are matched to
+// message fields by their proto or JSON name, fields without a match are dropped.
+type ProtobufEncodingConfig struct {
+	DescriptorFile string `yaml:"descriptor_file"` // FileDescriptorSet, e.g. protoc --include_imports --descriptor_set_out
+	Message        string `yaml:"message"`         // fully qualified message name, e.g. acme.security.Alert
+}
+
+// Validate checks the names of the config, the protobuf descriptor is loaded by NewEventEncoder
+func (c *EncodingConfig) Validate() error {
+	switch c.Serialization {
+	case "", SerializationJSON, SerializationMsgpack:
+		if c.Protobuf != nil {
+			return fmt.Errorf("encoding.protobuf requires serialization protobuf")
+		}
+	case SerializationProtobuf:
+		if c.Protobuf == nil || c.Protobuf.DescriptorFile == "" || c.Protobuf.Message == "" {
+			return fmt.Errorf("serialization protobuf requires encoding.protobuf with descriptor_file and message")
+		}
+	default:
+		return fmt.Errorf("unsupported serialization %q, expected json, msgpack or protobuf", c.Serialization)
+	}
+	switch c.Compression {
+	case "", PayloadCompressionNone, PayloadCompressionGzip, PayloadCompressionZstd, PayloadCompressionSnappy:
+	default:
+		return fmt.Errorf("unsupported compression %q, expected none, gzip, zstd or snappy", c.Compression)
+	}
+	return nil
+}
+
+// EventEncoder serializes and compresses events as configured, it is safe for concurrent use
+type EventEncoder struct {
+	serialization string
+	compression   string
+	message       protoreflect.MessageDescriptor
+}
+
+// NewEventEncoder creates the encoder of a config, nil selects uncompressed JSON
+func NewEventEncoder(cfg *EncodingConfig) (*EventEncoder, error) {
+	e := &EventEncoder{serialization: SerializationJSON, compression: PayloadCompressionNone}
+	if cfg == nil {
+		return e, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Serialization != "" {
+		e.serialization = cfg.Serialization
+	}
+	if cfg.Compression != "" {
+		e.compression = cfg.Compression
+	}
+	if e.serialization == SerializationProtobuf {
+		md, err := loadProtobufMessage(cfg.Protobuf)
+		if err != nil {
+			return nil, err
+		}
+		e.message = md
+	}
+	return e, nil
+}
+
+func loadProtobufMessage(cfg *ProtobufEncodingConfig) (protoreflect.MessageDescriptor, error) {
+	data, err := os.ReadFile(cfg.DescriptorFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protobuf descriptor: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid protobuf descriptor %s, expected a FileDescriptorSet: %w", cfg.DescriptorFile, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf descriptor %s: %w", cfg.DescriptorFile, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(cfg.Message))
+	if err != nil {
+		return nil, fmt.Errorf("protobuf message %s not found in %s", cfg.Message, cfg.DescriptorFile)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a protobuf message", cfg.Message)
+	}
+	return md, nil
+}
+
+// Serialization returns the configured serialization
+func (e *EventEncoder) Serialization() string {
+	return e.serialization
+}
+
+// Compression returns the configured compression, none when payloads are not compressed
+func (e *EventEncoder) Compression() string {
+	return e.compression
+}
+
+// ContentType returns the media type of serialized events
+func (e *EventEncoder) ContentType() string {
+	switch e.serialization {
+	case SerializationMsgpack:
+		return "application/msgpack"
+	case SerializationProtobuf:
+		return "application/x-protobuf"
+	default:
+		return "application/json"
+	}
+}
+
+// ContentEncoding returns the HTTP Content-Encoding of compressed payloads, empty when uncompressed
+func (e *EventEncoder) ContentEncoding() string {
+	if e.compression == PayloadCompressionNone {
+		return ""
+	}
+	return e.compression
+}
+
+// Encode serializes and compresses one event
+func (e *EventEncoder) Encode(msg map[string]interface{}) ([]byte, error) {
+	data, err := e.Serialize(msg)
+	if err != nil {
+		return nil, err
+	}
+	return e.Compress(data)
+}
+
+// Serialize converts one event to the configured serialization
+func (e *EventEncoder) Serialize(msg map[string]interface{}) ([]byte, error) {
+	switch e.serialization {
+	case SerializationMsgpack:
+		return appendMsgpack(nil, msg)
+	case SerializationProtobuf:
+		data, err := sonic.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		m := dynamicpb.NewMessage(e.message)
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("event does not match protobuf message %s: %w", e.message.FullName(), err)
+		}
+		return proto.Marshal(m)
+	default:
+		return sonic.Marshal(msg)
+	}
+}
+
+// Compress compresses a payload with the configured compression
+func (e *EventEncoder) Compress(data []byte) ([]byte, error) {
+	return CompressPayload(e.compression, data)
+}
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+)
+
+// CompressPayload compresses data as a whole, the result can be read by DecompressReader
+func CompressPayload(compression string, data []byte) ([]byte, error) {
+	switch compression {
+	case "", PayloadCompressionNone:
+		return data, nil
+	case PayloadCompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case PayloadCompressionZstd:
+		// EncodeAll may be called concurrently, so one encoder serves all outputs
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+		})
+		if zstdEncoderErr != nil {
+			return nil, zstdEncoderErr
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case PayloadCompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+// DecompressReader reads a payload compressed by CompressPayload. limit bounds the size of the
+// decompressed payload for encodings that are decoded as a whole.
+func DecompressReader(encoding string, r io.Reader, limit int64) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity", PayloadCompressionNone:
+		return io.NopCloser(r), nil
+	case PayloadCompressionGzip:
+		return gzip.NewReader(r)
+	case PayloadCompressionZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case PayloadCompressionSnappy:
+		data, err := io.ReadAll(io.LimitReader(r, limit))
+		if err != nil {
+			return nil, err
+		}
+		if n, err := snappy.DecodedLen(data); err != nil {
+			return nil, err
+		} else if int64(n) > limit {
+			return nil, fmt.Errorf("decompressed payload exceeds %d bytes", limit)
+		}
+		decoded, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(decoded)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// appendMsgpack appends the MessagePack encoding of a value decoded from JSON. Whole floats are
+// written as integers, like JSON prints them, and other types go through their JSON form.
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if val {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case string:
+		return appendMsgpackString(b, val), nil
+	case []byte:
+		return appendMsgpackBinary(b, val), nil
+	case int:
+		return appendMsgpackInt(b, int64(val)), nil
+	case int8:
+		return appendMsgpackInt(b, int64(val)), nil
+	case int16:
+		return appendMsgpackInt(b, int64(val)), nil
+	case int32:
+		return appendMsgpackInt(b, int64(val)), nil
+	case int64:
+		return appendMsgpackInt(b, val), nil
+	case uint:
+		return appendMsgpackUint(b, uint64(val)), nil
+	case uint8:
+		return appendMsgpackUint(b, uint64(val)), nil
+	case uint16:
+		return appendMsgpackUint(b, uint64(val)), nil
+	case uint32:
+		return appendMsgpackUint(b, uint64(val)), nil
+	case uint64:
+		return appendMsgpackUint(b, val), nil
+	case float32:
+		return appendMsgpackFloat(b, float64(val)), nil
+	case float64:
+		return appendMsgpackFloat(b, val), nil
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return appendMsgpackInt(b, i), nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackFloat(b, f), nil
+	case time.Time:
+		return appendMsgpackString(b, val.Format(time.RFC3339Nano)), nil
+	case map[string]interface{}:
+		b = appendMsgpackHeader(b, len(val), 0x80, 0xde, 0xdf)
+		var err error
+		for k, item := range val {
+			b = appendMsgpackString(b, k)
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case []interface{}:
+		b = appendMsgpackHeader(b, len(val), 0x90, 0xdc, 0xdd)
+		var err error
+		for _, item := range val {
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case []string:
+		b = appendMsgpackHeader(b, len(val), 0x90, 0xdc, 0xdd)
+		for _, item := range val {
+			b = appendMsgpackString(b, item)
+		}
+		return b, nil
+	default:
+		data, err := sonic.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := sonic.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		return appendMsgpack(b, generic)
+	}
+}
+
+// appendMsgpackHeader writes the length of a map or array with its fix, 16 and 32 bit forms
+func appendMsgpackHeader(b []byte, n int, fix, code16, code32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, data...)
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func appendMsgpackFloat(b []byte, f float64) []byte {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return appendMsgpackInt(b, int64(f))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// eventTemplateFuncs are available in the Go templates outputs render over events
+var eventTemplateFuncs = template.FuncMap{
+	// get reads a dotted path, e.g. {{get . "host.name"}}
+	"get": func(event map[string]interface{}, path string) interface{} {
+		v, _ := GetCheckDataWithType(event, StringToList(path))
+		return v
+	},
+	"json": func(v interface{}) string {
+		data, _ := json.MarshalIndent(v, "", "  ")
+		return string(data)
+	},
+	// compactjson renders a value as single line JSON, e.g. to embed event fields in a JSON body
+	"compactjson": func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	},
+	"truncate": func(n int, s string) string {
+		if len([]rune(s)) <= n {
+			return s
+		}
+		return truncateRunes(s, n) + "..."
+	},
+	"default": func(def string, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339)
+	},
+}
+
+// ParseEventTemplate parses a Go template over events with the event template functions
+func ParseEventTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(eventTemplateFuncs).Parse(text)
+}
+
+// ExecuteEventTemplate renders a template for one event. Missing event fields render as empty strings.
+func ExecuteEventTemplate(tmpl *template.Template, event map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+}
@@ -0,0 +1,601 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FederationFieldName holds the federation metadata of a forwarded event:
+// id (assigned once at the origin), origin hub, origin input and the path of hubs it passed
+const FederationFieldName = "_hub_federation"
+
+const (
+	federationEventsPath = "/federation/v1/events"
+	federationHubHeader  = "X-Hub-Federation-Hub"
+
+	defaultFederationBatchSize      = 500
+	defaultFederationFlushInterval  = time.Second
+	defaultFederationMaxHops        = 4
+	defaultFederationMaxMessageSize = 32 * 1024 * 1024
+	federationEnqueueTimeout        = 5 * time.Second
+	federationRetryMaxBackoff       = 30 * time.Second
+)
+
+var errFederationBusy = errors.New("pipeline is busy")
+
+// FederationTLSConfig holds the certificates of a federation link, both sides authenticate each other
+type FederationTLSConfig struct {
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CAFile     string `yaml:"ca_file"`               // CA verifying the other hub's certificate
+	ServerName string `yaml:"server_name,omitempty"` // sender only, overrides the host name verified
+}
+
+func (c *FederationTLSConfig) load() (tls.Certificate, *x509.CertPool, error) {
+	if c == nil || c.CertFile == "" || c.KeyFile == "" || c.CAFile == "" {
+		return tls.Certificate{}, nil, fmt.Errorf("federation requires tls cert_file, key_file and ca_file")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to load federation cert/key: %w", err)
+	}
+	caPEM, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to read federation CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificates found in federation CA file %s", c.CAFile)
+	}
+	return cert, pool, nil
+}
+
+// federationMeta returns the federation metadata of an event, nil when it was never forwarded
+func federationMeta(msg map[string]interface{}) map[string]interface{} {
+	meta, _ := msg[FederationFieldName].(map[string]interface{})
+	return meta
+}
+
+// federationPath returns the hubs an event has been forwarded by
+func federationPath(meta map[string]interface{}) []string {
+	var path []string
+	switch v := meta["path"].(type) {
+	case []string:
+		path = v
+	case []interface{}:
+		for _, hub := range v {
+			if s, ok := hub.(string); ok {
+				path = append(path, s)
+			}
+		}
+	}
+	return path
+}
+
+func newFederationID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ===================== Sender =====================
+
+// FederationConfig holds the settings of a federation producer
+type FederationConfig struct {
+	URL           string // central hub receiver, e.g. https://central-hub:9443
+	HubID         string // identity of this hub, appended to the path of every forwarded event
+	TLS           *FederationTLSConfig
+	IncludeRaw    bool // forward events without a rule hit as well, by default only alerts are forwarded
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+	Timeout       time.Duration
+	Compression   string // gzip (default), zstd, snappy or none
+}
+
+// FederationProducer forwards events to a central hub in compressed NDJSON batches over mutual TLS
+type FederationProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg      FederationConfig
+	client   *http.Client
+	endpoint string
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	forwarded uint64
+	filtered  uint64
+	loops     uint64
+	failed    uint64
+}
+
+// NewFederationProducer starts forwarding the events read from msgChan
+func NewFederationProducer(cfg FederationConfig, msgChan chan map[string]interface{}) (*FederationProducer, error) {
+	client, err := newFederationClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HubID == "" {
+		return nil, fmt.Errorf("federation hub_id is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultFederationBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFederationFlushInterval
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = PayloadCompressionGzip
+	}
+	if _, err := CompressPayload(cfg.Compression, nil); err != nil {
+		return nil, err
+	}
+
+	p := &FederationProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		client:   client,
+		endpoint: strings.TrimRight(cfg.URL, "/") + federationEventsPath,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+func newFederationClient(cfg FederationConfig) (*http.Client, error) {
+	if !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("federation url must use https")
+	}
+	cert, pool, err := cfg.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      pool,
+				ServerName:   cfg.TLS.ServerName,
+				MinVersion:   tls.VersionTLS12,
+			},
+		},
+	}, nil
+}
+
+func (p *FederationProducer) run() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.cfg.BatchSize)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			p.Receipts.AddFailed(uint64(len(batch)))
+			atomic.AddUint64(&p.failed, uint64(len(batch)))
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			if !p.prepare(msg) {
+				continue
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// prepare stamps the federation metadata on an event, false when it must not be forwarded
+func (p *FederationProducer) prepare(msg map[string]interface{}) bool {
+	if _, hit := msg["_hub_hit_rule_id"]; !hit && !p.cfg.IncludeRaw {
+		atomic.AddUint64(&p.filtered, 1)
+		p.Receipts.AddDropped(1)
+		return false
+	}
+
+	meta := federationMeta(msg)
+	if meta == nil {
+		// First hop: the id and origin stay the same however often the event is forwarded
+		meta = map[string]interface{}{
+			"id":     newFederationID(),
+			"origin": p.cfg.HubID,
+		}
+		if input, ok := msg["_hub_input"].(string); ok {
+			meta["input"] = input
+		}
+	} else {
+		copied := make(map[string]interface{}, len(meta)+1)
+		for k, v := range meta {
+			copied[k] = v
+		}
+		meta = copied
+	}
+
+	path := federationPath(meta)
+	for _, hub := range path {
+		if hub == p.cfg.HubID {
+			// The event already passed this hub, forwarding it again would loop
+			atomic.AddUint64(&p.loops, 1)
+			p.Receipts.AddDropped(1)
+			return false
+		}
+	}
+	meta["path"] = append(append([]string{}, path...), p.cfg.HubID)
+	msg[FederationFieldName] = meta
+	return true
+}
+
+// flush sends a batch, retrying network errors, 429 and 5xx with backoff
+func (p *FederationProducer) flush(batch []map[string]interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := encodeFederationBatch(batch, p.cfg.Compression)
+	if err != nil {
+		logger.Error("Failed to encode federation batch", "error", err)
+		atomic.AddUint64(&p.failed, uint64(len(batch)))
+		p.Receipts.AddFailed(uint64(len(batch)))
+		return
+	}
+
+	backoff := time.Second
+retry:
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		var retryable bool
+		retryable, err = p.send(body)
+		if err == nil {
+			atomic.AddUint64(&p.forwarded, uint64(len(batch)))
+			p.Receipts.AddAcked(uint64(len(batch)))
+			return
+		}
+		if !retryable {
+			break
+		}
+		select {
+		case <-p.stopChan:
+			break retry
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, federationRetryMaxBackoff)
+	}
+
+	logger.Error("Failed to forward events to central hub", "url", p.cfg.URL, "events", len(batch), "error", err)
+	atomic.AddUint64(&p.failed, uint64(len(batch)))
+	p.Receipts.AddFailed(uint64(len(batch)))
+}
+
+func encodeFederationBatch(batch []map[string]interface{}, compression string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, msg := range batch {
+		if err := enc.Encode(msg); err != nil {
+			return nil, err
+		}
+	}
+	return CompressPayload(compression, buf.Bytes())
+}
+
+// send posts one batch and reports whether a failure may be retried
+func (p *FederationProducer) send(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if p.cfg.Compression != PayloadCompressionNone {
+		req.Header.Set("Content-Encoding", p.cfg.Compression)
+	}
+	req.Header.Set(federationHubHeader, p.cfg.HubID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("central hub returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		return false, fmt.Errorf("central hub rejected batch with %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// Close forwards the queued events once msgChan is closed by its owner, giving up after 30s
+func (p *FederationProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many events were forwarded, filtered as raw events, dropped as loops or failed
+func (p *FederationProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"forwarded": atomic.LoadUint64(&p.forwarded),
+		"filtered":  atomic.LoadUint64(&p.filtered),
+		"loops":     atomic.LoadUint64(&p.loops),
+		"failed":    atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestFederationConnection completes a mutual TLS handshake with the central hub
+func TestFederationConnection(cfg FederationConfig) error {
+	client, err := newFederationClient(cfg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodHead, strings.TrimRight(cfg.URL, "/")+federationEventsPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("central hub not reachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("central hub does not accept this hub's certificate")
+	}
+	return nil
+}
+
+// ===================== Receiver =====================
+
+// FederationReceiverConfig holds the settings of a federation receiver
+type FederationReceiverConfig struct {
+	Listen         string
+	HubID          string // identity of this hub, events that already passed it are dropped
+	TLS            *FederationTLSConfig
+	AllowedHubs    []string // certificate common names or DNS names accepted, default every certificate of the CA
+	MaxHops        int
+	MaxMessageSize int64
+}
+
+// FederationReceiver accepts events forwarded by regional hubs over mutual TLS
+type FederationReceiver struct {
+	MsgChan chan map[string]interface{}
+
+	cfg     FederationReceiverConfig
+	allowed map[string]bool
+	server  *http.Server
+
+	receivedTotal uint64
+	loopTotal     uint64
+	rejectedTotal uint64
+}
+
+// NewFederationReceiver creates a federation receiver, Start binds the listener
+func NewFederationReceiver(cfg FederationReceiverConfig, msgChan chan map[string]interface{}) (*FederationReceiver, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("federation receiver requires listen")
+	}
+	if cfg.HubID == "" {
+		return nil, fmt.Errorf("federation hub_id is required")
+	}
+	if cfg.MaxHops <= 0 {
+		cfg.MaxHops = defaultFederationMaxHops
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = defaultFederationMaxMessageSize
+	}
+	r := &FederationReceiver{MsgChan: msgChan, cfg: cfg}
+	if len(cfg.AllowedHubs) > 0 {
+		r.allowed = make(map[string]bool, len(cfg.AllowedHubs))
+		for _, hub := range cfg.AllowedHubs {
+			r.allowed[hub] = true
+		}
+	}
+	return r, nil
+}
+
+// Start binds the listener and serves requests in the background
+func (r *FederationReceiver) Start() error {
+	cert, pool, err := r.cfg.TLS.load()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", r.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", r.cfg.Listen, err)
+	}
+	tlsLn := tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	r.server = &http.Server{
+		Handler:           http.HandlerFunc(r.handle),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func(srv *http.Server) {
+		if err := srv.Serve(tlsLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Federation receiver stopped unexpectedly", "listen", r.cfg.Listen, "error", err)
+		}
+	}(r.server)
+	logger.Info("Federation receiver listening", "listen", r.cfg.Listen, "hub_id", r.cfg.HubID)
+	return nil
+}
+
+// Close shuts down the listener, waiting briefly for in-flight batches
+func (r *FederationReceiver) Close() {
+	if r.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = r.server.Shutdown(ctx)
+	r.server = nil
+}
+
+// GetStats returns how many events were received, dropped as loops, and how many batches were rejected
+func (r *FederationReceiver) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"received_total": atomic.LoadUint64(&r.receivedTotal),
+		"loop_total":     atomic.LoadUint64(&r.loopTotal),
+		"rejected_total": atomic.LoadUint64(&r.rejectedTotal),
+	}
+}
+
+// peerHub returns the hub identity of the verified client certificate accepted by AllowedHubs
+func (r *FederationReceiver) peerHub(req *http.Request) (string, bool) {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+	cert := req.TLS.PeerCertificates[0]
+	if r.allowed == nil {
+		return cert.Subject.CommonName, true
+	}
+	for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+		if r.allowed[name] {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (r *FederationReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != federationEventsPath {
+		http.NotFound(w, req)
+		return
+	}
+	peer, ok := r.peerHub(req)
+	if !ok {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		http.Error(w, "hub not allowed", http.StatusForbidden)
+		return
+	}
+	if req.Method == http.MethodHead {
+		// Used by the sender's connectivity check
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	zr, err := DecompressReader(req.Header.Get("Content-Encoding"), http.MaxBytesReader(w, req.Body, r.cfg.MaxMessageSize), r.cfg.MaxMessageSize)
+	if err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer zr.Close()
+	body := io.LimitReader(zr, r.cfg.MaxMessageSize)
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), int(r.cfg.MaxMessageSize))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			atomic.AddUint64(&r.rejectedTotal, 1)
+			http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.loops(msg) {
+			atomic.AddUint64(&r.loopTotal, 1)
+			continue
+		}
+		if meta := federationMeta(msg); meta != nil {
+			meta["received_from"] = peer
+		}
+		events = append(events, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		http.Error(w, "failed to read batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := r.enqueue(req.Context(), events); err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		// The sender retries the whole batch, duplicates can be removed by the federation id
+		w.Header().Set("Retry-After", strconv.Itoa(int(federationEnqueueTimeout/time.Second)))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loops reports whether an event already passed this hub or exceeded the hop limit
+func (r *FederationReceiver) loops(msg map[string]interface{}) bool {
+	path := federationPath(federationMeta(msg))
+	if len(path) > r.cfg.MaxHops {
+		return true
+	}
+	for _, hub := range path {
+		if hub == r.cfg.HubID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *FederationReceiver) enqueue(ctx context.Context, events []map[string]interface{}) error {
+	timeout := time.NewTimer(federationEnqueueTimeout)
+	defer timeout.Stop()
+	for _, msg := range events {
+		select {
+		case r.MsgChan <- msg:
+			atomic.AddUint64(&r.receivedTotal, 1)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errFederationBusy
+		}
+	}
+	return nil
+}
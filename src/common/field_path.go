@@ -0,0 +1,227 @@
+package common
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// Keys of field paths that can match several values or need the length of an array. They start
+// with a NUL byte, which never appears in the keys of an event.
+const (
+	pathWildcard        = "\x00*"  // every element of an array or value of an object
+	pathRecursivePrefix = "\x00.." // the key at any depth, followed by the key name
+	pathNegativePrefix  = "\x00-"  // element counted from the end of an array, followed by the count
+)
+
+// isJSONPath returns whether a field is a JSONPath expression: "$.a" or "$[0]". A lone "$" stays
+// a key, selecting the whole event has no use in a check.
+func isJSONPath(field string) bool {
+	return len(field) > 1 && field[0] == '$' && (field[1] == '.' || field[1] == '[')
+}
+
+// jsonPathToList splits a JSONPath expression into the keys of a field path. Supported are
+// .key, ['key'], [n], [-n], [*], .* and ..key for a key at any depth.
+func jsonPathToList(path string) []string {
+	var res []string
+	for i := 1; i < len(path); {
+		switch {
+		case strings.HasPrefix(path[i:], ".."):
+			name, n := jsonPathName(path[i+2:])
+			res = append(res, pathRecursivePrefix+name)
+			i += 2 + n
+		case path[i] == '.':
+			name, n := jsonPathName(path[i+1:])
+			if name == "*" {
+				name = pathWildcard
+			}
+			res = append(res, name)
+			i += 1 + n
+		default:
+			key, n, ok := parsePathBracket(path[i:], true)
+			if !ok {
+				// Not a valid selector, the rest is looked up as a key and will not match
+				return append(res, path[i:])
+			}
+			res = append(res, key)
+			i += n
+		}
+	}
+	return res
+}
+
+// jsonPathName returns the key name at the start of s and its length
+func jsonPathName(s string) (string, int) {
+	n := strings.IndexAny(s, ".[")
+	if n < 0 {
+		n = len(s)
+	}
+	return s[:n], n
+}
+
+// parsePathBracket parses a selector at the start of s: [n], [-n], [*], and in JSONPath also
+// ['key'] and ["key"]. Returns the key, the length of the selector and whether it is valid.
+func parsePathBracket(s string, jsonPath bool) (string, int, bool) {
+	if len(s) < 3 || s[0] != '[' {
+		return "", 0, false
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return "", 0, false
+	}
+	inner := s[1:end]
+	if jsonPath && len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') {
+		// A quoted key may contain ']', so look for the closing quote first
+		closing := strings.IndexByte(s[2:], inner[0])
+		if closing < 0 || len(s) <= closing+3 || s[closing+3] != ']' {
+			return "", 0, false
+		}
+		return s[2 : closing+2], closing + 4, true
+	}
+	if inner == "*" {
+		return pathWildcard, end + 1, true
+	}
+	if n, err := strconv.Atoi(inner); err == nil {
+		if n < 0 {
+			return pathNegativePrefix + strconv.Itoa(-n), end + 1, true
+		}
+		if inner[0] != '+' {
+			return "#" + inner, end + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// isPatternPath returns whether a field path has a key that GetCheckData cannot look up directly
+func isPatternPath(keys []string) bool {
+	for _, k := range keys {
+		if len(k) > 0 && k[0] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getPatternPath looks up a path with wildcards, keys at any depth or negative indexes. A path
+// with a wildcard or a key at any depth returns the list of the values found, even when only
+// one value is found.
+func getPatternPath(data map[string]interface{}, keys []string) (interface{}, bool) {
+	var out []interface{}
+	walkPatternPath(data, keys, &out)
+	if len(out) == 0 {
+		return nil, false
+	}
+	for _, k := range keys {
+		if k == pathWildcard || strings.HasPrefix(k, pathRecursivePrefix) {
+			return out, true
+		}
+	}
+	return out[0], true
+}
+
+func walkPatternPath(value interface{}, keys []string, out *[]interface{}) {
+	if len(keys) == 0 {
+		if value != nil {
+			*out = append(*out, value)
+		}
+		return
+	}
+	k, rest := keys[0], keys[1:]
+	switch {
+	case k == pathWildcard:
+		forEachPathChild(value, true, func(child interface{}) {
+			walkPatternPath(child, rest, out)
+		})
+	case strings.HasPrefix(k, pathRecursivePrefix):
+		name := k[len(pathRecursivePrefix):]
+		if name == "*" {
+			forEachPathChild(value, false, func(child interface{}) {
+				walkPatternPath(child, rest, out)
+			})
+		} else if m, _ := pathNode(value, false); m != nil {
+			if v, ok := m[name]; ok {
+				walkPatternPath(v, rest, out)
+			}
+		}
+		// Descend into objects and arrays only, parsing every string of the event would be costly
+		forEachPathChild(value, false, func(child interface{}) {
+			walkPatternPath(child, keys, out)
+		})
+	case strings.HasPrefix(k, pathNegativePrefix):
+		_, list := pathNode(value, true)
+		if n, err := strconv.Atoi(k[len(pathNegativePrefix):]); err == nil && n > 0 && n <= len(list) {
+			walkPatternPath(list[len(list)-n], rest, out)
+		}
+	default:
+		m, list := pathNode(value, true)
+		if m != nil {
+			if v, ok := m[k]; ok {
+				walkPatternPath(v, rest, out)
+			}
+		} else if list != nil && strings.HasPrefix(k, "#") {
+			if i, err := strconv.Atoi(k[1:]); err == nil && i >= 0 && i < len(list) {
+				walkPatternPath(list[i], rest, out)
+			}
+		}
+	}
+}
+
+// pathNode returns the object or the array a value holds, parsing JSON strings if parseStrings
+func pathNode(value interface{}, parseStrings bool) (map[string]interface{}, []interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		return nil, v
+	case string:
+		if !parseStrings {
+			return nil, nil
+		}
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "{") {
+			var m map[string]interface{}
+			if err := sonic.Unmarshal([]byte(trimmed), &m); err == nil {
+				return m, nil
+			}
+		} else if strings.HasPrefix(trimmed, "[") {
+			var list []interface{}
+			if err := sonic.Unmarshal([]byte(trimmed), &list); err == nil {
+				return nil, list
+			}
+		}
+		return nil, nil
+	case nil:
+		return nil, nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return nil, list
+	}
+	return nil, nil
+}
+
+// forEachPathChild calls fn with the elements of an array or the values of an object, in key order
+func forEachPathChild(value interface{}, parseStrings bool, fn func(child interface{})) {
+	m, list := pathNode(value, parseStrings)
+	if m != nil {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fn(m[k])
+		}
+		return
+	}
+	for _, child := range list {
+		fn(child)
+	}
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// legacyStringToList is the field path splitting before brackets and JSONPath were supported
+func legacyStringToList(checkKey string) []string {
+	var res []string
+	var cur []byte
+	for i := 0; i < len(checkKey); i++ {
+		if checkKey[i] == '\\' && i+1 < len(checkKey) && checkKey[i+1] == '.' {
+			cur = append(cur, '.')
+			i++
+		} else if checkKey[i] == '.' {
+			res = append(res, string(cur))
+			cur = cur[:0]
+		} else {
+			cur = append(cur, checkKey[i])
+		}
+	}
+	if len(cur) > 0 {
+		res = append(res, string(cur))
+	}
+	return res
+}
+
+func TestStringToListCompatibility(t *testing.T) {
+	// Paths without a selector split exactly as before
+	for _, path := range []string{
+		"a", "a.b.c", "headers.x\\.forwarded\\.for", "list.#0.name", "$", "$ref", "price$",
+		"tags[]", "tags[abc]", "a[+1]", "a[", "a]", "data.a-b_c", `a\b`,
+	} {
+		if got, want := StringToList(path), legacyStringToList(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("StringToList(%q) = %q, want %q as before", path, got, want)
+		}
+	}
+
+	// Keys that now read as selectors stay reachable with a backslash
+	for path, want := range map[string][]string{
+		`tags\[0]`:       {"tags[0]"},
+		`a.b\[*]`:        {"a", "b[*]"},
+		`\$.a`:           {"$", "a"}, // the meaning of $.a before JSONPath
+		`\$\.a`:          {"$.a"},
+		`\$\[0].b`:       {"$[0]", "b"},
+		`x\.y\[-1]`:      {"x.y[-1]"},
+		`tags[0]`:        {"tags", "#0"},
+		`$.tags[0]`:      {"tags", "#0"},
+		`$['a.b'][-1]`:   {"a.b", pathNegativePrefix + "1"},
+		`items[*].name`:  {"items", pathWildcard, "name"},
+		`$..user.name`:   {pathRecursivePrefix + "user", "name"},
+		`a[0][1].b\[2]`:  {"a", "#0", "#1", "b[2]"},
+		`cost\$`:         {"cost$"},
+		`\$`:             {"$"},
+		`a\\.b`:          {`a\.b`},
+		`\[0]`:           {"[0]"},
+		`$.a\[0]`:        {"a\\", "#0"}, // no escapes inside JSONPath, quote the key instead
+		`$['a[0]']`:      {"a[0]"},
+		`a.\$.b`:         {"a", "$", "b"},
+		`$.store.book.*`: {"store", "book", pathWildcard},
+	} {
+		if got := StringToList(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("StringToList(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	data := map[string]interface{}{"tags[0]": "literal", "tags": []interface{}{"first"}, "$.a": 1}
+	if v, _ := GetCheckData(data, StringToList(`tags\[0]`)); v != "literal" {
+		t.Errorf("escaped bracket key = %q", v)
+	}
+	if v, _ := GetCheckData(data, StringToList(`tags[0]`)); v != "first" {
+		t.Errorf("array element = %q", v)
+	}
+	if v, _ := GetCheckData(data, StringToList(`\$\.a`)); v != "1" {
+		t.Errorf("escaped dollar key = %q", v)
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hubFieldPrefix marks the metadata fields the hub adds to events
+const hubFieldPrefix = "_hub_"
+
+// OutputFieldsConfig reshapes the events of an output just before they are serialized.
+// Steps run in the order include, exclude, rename, add. Paths use dots for nested fields.
+type OutputFieldsConfig struct {
+	Include []string               `yaml:"include,omitempty"` // keep only these fields, _hub_ metadata is always kept
+	Exclude []string               `yaml:"exclude,omitempty"` // remove these fields
+	Rename  map[string]string      `yaml:"rename,omitempty"`  // old path -> new path
+	Add     map[string]interface{} `yaml:"add,omitempty"`     // static fields, overwriting existing values
+}
+
+type fieldRename struct {
+	from []string
+	to   []string
+}
+
+// FieldProjection is a compiled OutputFieldsConfig
+type FieldProjection struct {
+	include [][]string
+	exclude [][]string
+	rename  []fieldRename
+	add     map[string]interface{}
+}
+
+// NewFieldProjection compiles a fields config, nil if it changes nothing
+func NewFieldProjection(cfg *OutputFieldsConfig) (*FieldProjection, error) {
+	if cfg == nil || (len(cfg.Include) == 0 && len(cfg.Exclude) == 0 && len(cfg.Rename) == 0 && len(cfg.Add) == 0) {
+		return nil, nil
+	}
+	p := &FieldProjection{}
+	for _, f := range cfg.Include {
+		path := StringToList(strings.TrimSpace(f))
+		if len(path) == 0 {
+			return nil, fmt.Errorf("empty field in include")
+		}
+		p.include = append(p.include, path)
+	}
+	for _, f := range cfg.Exclude {
+		path := StringToList(strings.TrimSpace(f))
+		if len(path) == 0 {
+			return nil, fmt.Errorf("empty field in exclude")
+		}
+		p.exclude = append(p.exclude, path)
+	}
+	// Renames run in a stable order so the result does not depend on map iteration
+	froms := make([]string, 0, len(cfg.Rename))
+	for from := range cfg.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		fromPath := StringToList(strings.TrimSpace(from))
+		toPath := StringToList(strings.TrimSpace(cfg.Rename[from]))
+		if len(fromPath) == 0 || len(toPath) == 0 {
+			return nil, fmt.Errorf("rename %q -> %q needs both fields", from, cfg.Rename[from])
+		}
+		p.rename = append(p.rename, fieldRename{from: fromPath, to: toPath})
+	}
+	if len(cfg.Add) > 0 {
+		p.add = make(map[string]interface{}, len(cfg.Add))
+		for k, v := range cfg.Add {
+			if strings.TrimSpace(k) == "" {
+				return nil, fmt.Errorf("empty field in add")
+			}
+			p.add[k] = v
+		}
+	}
+	return p, nil
+}
+
+// Apply reshapes an event. The event is modified in place unless include is set, in which case
+// a new map holding the included fields is returned. A nil projection returns the event unchanged.
+func (p *FieldProjection) Apply(event map[string]interface{}) map[string]interface{} {
+	if p == nil {
+		return event
+	}
+	if len(p.include) > 0 {
+		projected := make(map[string]interface{}, len(p.include))
+		for k, v := range event {
+			if strings.HasPrefix(k, hubFieldPrefix) {
+				projected[k] = v
+			}
+		}
+		for _, path := range p.include {
+			if v, ok := getNestedField(event, path); ok {
+				setNestedField(projected, path, v)
+			}
+		}
+		event = projected
+	}
+	for _, path := range p.exclude {
+		deleteNestedField(event, path)
+	}
+	for _, r := range p.rename {
+		if v, ok := getNestedField(event, r.from); ok {
+			deleteNestedField(event, r.from)
+			setNestedField(event, r.to, v)
+		}
+	}
+	for k, v := range p.add {
+		setNestedField(event, StringToList(k), MapDeepCopyAction(v))
+	}
+	return event
+}
+
+// getNestedField returns the value at a path through nested maps
+func getNestedField(data map[string]interface{}, path []string) (interface{}, bool) {
+	for i, k := range path {
+		v, ok := data[k]
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return v, true
+		}
+		next, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data = next
+	}
+	return nil, false
+}
+
+// setNestedField sets the value at a path, creating or replacing intermediate maps
+func setNestedField(data map[string]interface{}, path []string, value interface{}) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := data[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			data[k] = next
+		}
+		data = next
+	}
+	data[path[len(path)-1]] = value
+}
+
+// deleteNestedField removes the value at a path, leaving the parents in place
+func deleteNestedField(data map[string]interface{}, path []string) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := data[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		data = next
+	}
+	delete(data, path[len(path)-1])
+}
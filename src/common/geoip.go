@@ -0,0 +1,258 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const defaultGeoIPReloadInterval = time.Minute
+
+// GeoIPConfig lists the mmdb databases used by <geoip> elements of rulesets. MaxMind GeoIP2 and
+// GeoLite2 City, Country and ASN databases are supported, as are IP2Location databases in their
+// GeoIP2-compatible MMDB format.
+type GeoIPConfig struct {
+	Databases      []string `yaml:"databases"`                 // mmdb files, looked up in order
+	ReloadInterval string   `yaml:"reload_interval,omitempty"` // How often the files are checked for changes, default 1m
+	Language       string   `yaml:"language,omitempty"`        // Language of country and city names, default en
+}
+
+// geoIPRecord holds the fields read from a database, the layout of GeoIP2 City and ASN records
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoIPDatabase is one mmdb file, reopened when its modification time changes
+type geoIPDatabase struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// GeoIPResolver looks addresses up in the configured databases
+type GeoIPResolver struct {
+	mu        sync.RWMutex
+	databases []*geoIPDatabase
+	language  string
+	interval  time.Duration
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GlobalGeoIP is the resolver of <geoip> elements, nil when no database is configured
+var GlobalGeoIP *GeoIPResolver
+
+// NewGeoIPResolver opens the databases of cfg. A database that cannot be opened is logged and
+// retried on every reload, so a file deployed after the start is picked up.
+func NewGeoIPResolver(cfg *GeoIPConfig) (*GeoIPResolver, error) {
+	if cfg == nil || len(cfg.Databases) == 0 {
+		return nil, fmt.Errorf("no geoip database configured")
+	}
+	g := &GeoIPResolver{
+		language: "en",
+		interval: defaultGeoIPReloadInterval,
+		stopChan: make(chan struct{}),
+	}
+	if cfg.Language != "" {
+		g.language = cfg.Language
+	}
+	if cfg.ReloadInterval != "" {
+		d, err := time.ParseDuration(cfg.ReloadInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid geoip reload_interval %q", cfg.ReloadInterval)
+		}
+		g.interval = d
+	}
+	for _, path := range cfg.Databases {
+		if strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("geoip database path cannot be empty")
+		}
+		g.databases = append(g.databases, &geoIPDatabase{path: path})
+	}
+	g.reload()
+	return g, nil
+}
+
+// reload reopens the databases whose file changed since they were opened
+func (g *GeoIPResolver) reload() {
+	for i, db := range g.databases {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			if db.reader == nil {
+				logger.Error("GeoIP database not available", "path", db.path, "error", err)
+			}
+			continue
+		}
+		if db.reader != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+			continue
+		}
+
+		reader, err := maxminddb.Open(db.path)
+		if err != nil {
+			// Keep the previous version, the file may still be being written
+			logger.Error("Failed to open GeoIP database", "path", db.path, "error", err)
+			continue
+		}
+		g.mu.Lock()
+		old := db.reader
+		g.databases[i] = &geoIPDatabase{path: db.path, reader: reader, modTime: info.ModTime(), size: info.Size()}
+		g.mu.Unlock()
+		if old != nil {
+			old.Close()
+			logger.Info("GeoIP database reloaded", "path", db.path, "type", reader.Metadata.DatabaseType)
+		} else {
+			logger.Info("GeoIP database loaded", "path", db.path, "type", reader.Metadata.DatabaseType)
+		}
+	}
+}
+
+// Start checks the databases for changes every reload interval
+func (g *GeoIPResolver) Start() {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stopChan:
+				return
+			case <-ticker.C:
+				g.reload()
+			}
+		}
+	}()
+}
+
+// Stop ends the reloads and closes the databases
+func (g *GeoIPResolver) Stop() {
+	close(g.stopChan)
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, db := range g.databases {
+		if db.reader != nil {
+			db.reader.Close()
+			db.reader = nil
+		}
+	}
+}
+
+// Lookup returns the location and network owner of an address, merged over the databases in
+// order: country, country_name, region, region_name, city, latitude, longitude, timezone, asn
+// and as_org. Only the fields found are returned, nil when the address is invalid or unknown.
+func (g *GeoIPResolver) Lookup(address string) map[string]interface{} {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return nil
+	}
+
+	var result map[string]interface{}
+	set := func(key string, value interface{}) {
+		if result == nil {
+			result = make(map[string]interface{}, 8)
+		}
+		if _, exists := result[key]; !exists {
+			result[key] = value
+		}
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, db := range g.databases {
+		if db.reader == nil {
+			continue
+		}
+		var rec geoIPRecord
+		if err := db.reader.Lookup(ip, &rec); err != nil {
+			continue
+		}
+		if rec.Country.ISOCode != "" {
+			set("country", rec.Country.ISOCode)
+		}
+		if name := g.name(rec.Country.Names); name != "" {
+			set("country_name", name)
+		}
+		if len(rec.Subdivisions) > 0 {
+			if rec.Subdivisions[0].ISOCode != "" {
+				set("region", rec.Subdivisions[0].ISOCode)
+			}
+			if name := g.name(rec.Subdivisions[0].Names); name != "" {
+				set("region_name", name)
+			}
+		}
+		if name := g.name(rec.City.Names); name != "" {
+			set("city", name)
+		}
+		if rec.Location.Latitude != nil && rec.Location.Longitude != nil {
+			set("latitude", *rec.Location.Latitude)
+			set("longitude", *rec.Location.Longitude)
+		}
+		if rec.Location.TimeZone != "" {
+			set("timezone", rec.Location.TimeZone)
+		}
+		if rec.ASN != 0 {
+			set("asn", rec.ASN)
+		}
+		if rec.ASOrg != "" {
+			set("as_org", rec.ASOrg)
+		}
+	}
+	return result
+}
+
+// name returns the name in the configured language, falling back to English
+func (g *GeoIPResolver) name(names map[string]string) string {
+	if name, ok := names[g.language]; ok {
+		return name
+	}
+	return names["en"]
+}
+
+// InitGeoIP opens the databases used by <geoip> elements if configured
+func InitGeoIP(cfg *GeoIPConfig) {
+	if cfg == nil || len(cfg.Databases) == 0 || GlobalGeoIP != nil {
+		return
+	}
+	g, err := NewGeoIPResolver(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize GeoIP", "error", err)
+		return
+	}
+	GlobalGeoIP = g
+	g.Start()
+}
+
+// StopGeoIP stops the reloads and closes the databases
+func StopGeoIP() {
+	if GlobalGeoIP != nil {
+		GlobalGeoIP.Stop()
+		GlobalGeoIP = nil
+	}
+}
@@ -0,0 +1,462 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProbeTypeHTTP   = "http"
+	ProbeTypeScript = "script"
+	ProbeTypePlugin = "plugin"
+
+	// ProbeActionWarn only reports the probe state, ProbeActionError also puts the projects
+	// using the probed component into error like a failed built-in check
+	ProbeActionWarn  = "warn"
+	ProbeActionError = "error"
+
+	ProbeStateUnknown   = "unknown"
+	ProbeStateHealthy   = "healthy"
+	ProbeStateDegraded  = "degraded"  // failing, but fewer than failure_threshold times in a row
+	ProbeStateUnhealthy = "unhealthy" // failed failure_threshold times in a row
+)
+
+const (
+	defaultProbeInterval         = 30 * time.Second
+	defaultProbeTimeout          = 5 * time.Second
+	defaultProbeFailureThreshold = 3
+	defaultProbeSuccessThreshold = 1
+	maxProbeOutput               = 4096
+)
+
+// HealthProbeConfig describes a custom health probe run by the component monitor
+type HealthProbeConfig struct {
+	Name             string            `yaml:"name" json:"name"`
+	Component        string            `yaml:"component,omitempty" json:"component,omitempty"` // type/id, e.g. output/es_alerts, empty for a hub-level probe
+	Type             string            `yaml:"type" json:"type"`                               // http, script or plugin
+	Interval         string            `yaml:"interval,omitempty" json:"interval,omitempty"`   // default 30s
+	Timeout          string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`     // default 5s
+	FailureThreshold int               `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"`
+	SuccessThreshold int               `yaml:"success_threshold,omitempty" json:"success_threshold,omitempty"`
+	Action           string            `yaml:"action,omitempty" json:"action,omitempty"` // warn (default) or error
+	URL              string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Method           string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Headers          map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	ExpectStatus     []int             `yaml:"expect_status,omitempty" json:"expect_status,omitempty"` // default any 2xx
+	ExpectBody       string            `yaml:"expect_body,omitempty" json:"expect_body,omitempty"`     // substring the response body must contain
+	Command          []string          `yaml:"command,omitempty" json:"command,omitempty"`             // argv, exit code 0 means healthy
+	Plugin           string            `yaml:"plugin,omitempty" json:"plugin,omitempty"`               // checknode plugin called with (component_type, component_id)
+}
+
+// ProbeStatus is the current state of a health probe on this node
+type ProbeStatus struct {
+	Name                 string     `json:"name"`
+	Component            string     `json:"component,omitempty"`
+	Type                 string     `json:"type"`
+	Action               string     `json:"action"`
+	State                string     `json:"state"`
+	PreviousState        string     `json:"previous_state,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutive_failures"`
+	ConsecutiveSuccesses int        `json:"consecutive_successes"`
+	LastCheck            *time.Time `json:"last_check,omitempty"`
+	LastTransition       *time.Time `json:"last_transition,omitempty"`
+	LastError            string     `json:"last_error,omitempty"`
+	LatencyMs            float64    `json:"latency_ms"`
+}
+
+// ProbePluginRunner evaluates a checknode plugin for a probe.
+// It is registered by the project package to avoid circular imports.
+type ProbePluginRunner func(pluginName, componentType, componentID string) (bool, error)
+
+var probePluginRunner ProbePluginRunner
+
+// SetProbePluginRunner sets the global plugin runner used by plugin probes
+func SetProbePluginRunner(runner ProbePluginRunner) {
+	GlobalMu.Lock()
+	defer GlobalMu.Unlock()
+	probePluginRunner = runner
+}
+
+type healthProbe struct {
+	cfg              HealthProbeConfig
+	componentType    string
+	componentID      string
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	successThreshold int
+	cancel           context.CancelFunc
+
+	mu     sync.Mutex
+	status ProbeStatus
+}
+
+// newHealthProbe validates a probe config and applies defaults
+func newHealthProbe(cfg HealthProbeConfig) (*healthProbe, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("probe name is required")
+	}
+	p := &healthProbe{
+		interval:         defaultProbeInterval,
+		timeout:          defaultProbeTimeout,
+		failureThreshold: defaultProbeFailureThreshold,
+		successThreshold: defaultProbeSuccessThreshold,
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("probe %s: invalid interval %q, expected a duration of at least 1s", cfg.Name, cfg.Interval)
+		}
+		p.interval = d
+	}
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("probe %s: invalid timeout %q", cfg.Name, cfg.Timeout)
+		}
+		p.timeout = d
+	}
+	if cfg.FailureThreshold > 0 {
+		p.failureThreshold = cfg.FailureThreshold
+	}
+	if cfg.SuccessThreshold > 0 {
+		p.successThreshold = cfg.SuccessThreshold
+	}
+	switch cfg.Action {
+	case "":
+		cfg.Action = ProbeActionWarn
+	case ProbeActionWarn, ProbeActionError:
+	default:
+		return nil, fmt.Errorf("probe %s: unsupported action %q, expected warn or error", cfg.Name, cfg.Action)
+	}
+
+	if cfg.Component != "" {
+		parts := strings.SplitN(cfg.Component, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("probe %s: component must be type/id, got %q", cfg.Name, cfg.Component)
+		}
+		switch parts[0] {
+		case "input", "output", "ruleset":
+		default:
+			return nil, fmt.Errorf("probe %s: unsupported component type %q, expected input, output or ruleset", cfg.Name, parts[0])
+		}
+		p.componentType, p.componentID = parts[0], parts[1]
+	} else if cfg.Action == ProbeActionError {
+		return nil, fmt.Errorf("probe %s: action error requires a component", cfg.Name)
+	}
+
+	switch cfg.Type {
+	case ProbeTypeHTTP:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("probe %s: url is required for http probes", cfg.Name)
+		}
+		if cfg.Method == "" {
+			cfg.Method = http.MethodGet
+		}
+	case ProbeTypeScript:
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("probe %s: command is required for script probes", cfg.Name)
+		}
+	case ProbeTypePlugin:
+		if cfg.Plugin == "" {
+			return nil, fmt.Errorf("probe %s: plugin is required for plugin probes", cfg.Name)
+		}
+	default:
+		return nil, fmt.Errorf("probe %s: unsupported type %q, expected http, script or plugin", cfg.Name, cfg.Type)
+	}
+
+	p.cfg = cfg
+	p.status = ProbeStatus{
+		Name:      cfg.Name,
+		Component: cfg.Component,
+		Type:      cfg.Type,
+		Action:    cfg.Action,
+		State:     ProbeStateUnknown,
+	}
+	return p, nil
+}
+
+// check runs the probe once
+func (p *healthProbe) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	switch p.cfg.Type {
+	case ProbeTypeHTTP:
+		return p.checkHTTP(ctx)
+	case ProbeTypeScript:
+		return p.checkScript(ctx)
+	case ProbeTypePlugin:
+		return p.checkPlugin(ctx)
+	}
+	return fmt.Errorf("unsupported probe type %q", p.cfg.Type)
+}
+
+func (p *healthProbe) checkHTTP(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, p.cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxProbeOutput))
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if len(p.cfg.ExpectStatus) > 0 {
+		ok = false
+		for _, code := range p.cfg.ExpectStatus {
+			if resp.StatusCode == code {
+				ok = true
+				break
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if p.cfg.ExpectBody != "" && !bytes.Contains(body, []byte(p.cfg.ExpectBody)) {
+		return fmt.Errorf("response body does not contain %q", p.cfg.ExpectBody)
+	}
+	return nil
+}
+
+func (p *healthProbe) checkScript(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.cfg.Command[0], p.cfg.Command[1:]...)
+	cmd.Env = append(cmd.Environ(), "HUB_PROBE_NAME="+p.cfg.Name, "HUB_COMPONENT_TYPE="+p.componentType, "HUB_COMPONENT_ID="+p.componentID)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", p.timeout)
+	}
+	msg := strings.TrimSpace(string(out))
+	if len(msg) > maxProbeOutput {
+		msg = msg[:maxProbeOutput]
+	}
+	if msg != "" {
+		return fmt.Errorf("%v: %s", err, msg)
+	}
+	return err
+}
+
+func (p *healthProbe) checkPlugin(ctx context.Context) error {
+	GlobalMu.RLock()
+	runner := probePluginRunner
+	GlobalMu.RUnlock()
+	if runner == nil {
+		return fmt.Errorf("plugin probes are not available")
+	}
+
+	type result struct {
+		ok  bool
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ok, err := runner(p.cfg.Plugin, p.componentType, p.componentID)
+		done <- result{ok, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+		if !r.ok {
+			return fmt.Errorf("plugin %s returned false", p.cfg.Plugin)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("plugin %s timed out after %s", p.cfg.Plugin, p.timeout)
+	}
+}
+
+// record applies one check result to the probe state and returns the previous and new state
+func (p *healthProbe) record(err error, latency time.Duration) (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	s := &p.status
+	prev := s.State
+	s.LastCheck = &now
+	s.LatencyMs = float64(latency.Microseconds()) / 1000
+
+	if err != nil {
+		s.ConsecutiveFailures++
+		s.ConsecutiveSuccesses = 0
+		s.LastError = err.Error()
+		if s.ConsecutiveFailures >= p.failureThreshold {
+			s.State = ProbeStateUnhealthy
+		} else if s.State != ProbeStateUnhealthy {
+			s.State = ProbeStateDegraded
+		}
+	} else {
+		s.ConsecutiveSuccesses++
+		s.ConsecutiveFailures = 0
+		s.LastError = ""
+		// an unhealthy probe must pass success_threshold times in a row before it is healthy again
+		if s.State != ProbeStateUnhealthy || s.ConsecutiveSuccesses >= p.successThreshold {
+			s.State = ProbeStateHealthy
+		}
+	}
+
+	if s.State != prev {
+		s.PreviousState = prev
+		s.LastTransition = &now
+	}
+	return prev, s.State
+}
+
+func (p *healthProbe) snapshot() ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// run checks the probe on its interval until ctx is cancelled
+func (p *healthProbe) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := p.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		prev, state := p.record(err, time.Since(start))
+		if prev != state {
+			switch state {
+			case ProbeStateUnhealthy:
+				logger.Warn("Health probe unhealthy", "probe", p.cfg.Name, "component", p.cfg.Component, "previous", prev, "error", err)
+			case ProbeStateDegraded:
+				logger.Warn("Health probe degraded", "probe", p.cfg.Name, "component", p.cfg.Component, "previous", prev, "error", err)
+			default:
+				logger.Info("Health probe state changed", "probe", p.cfg.Name, "component", p.cfg.Component, "previous", prev, "state", state)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterProbes registers every probe in cfgs, stopping at the first invalid one
+func (cm *ComponentMonitor) RegisterProbes(cfgs []HealthProbeConfig) error {
+	for _, cfg := range cfgs {
+		if err := cm.RegisterProbe(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterProbe adds a custom health probe, replacing a probe with the same name.
+// The probe starts running immediately and runs until it is unregistered or the monitor stops.
+func (cm *ComponentMonitor) RegisterProbe(cfg HealthProbeConfig) error {
+	p, err := newHealthProbe(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(cm.ctx)
+	p.cancel = cancel
+
+	cm.probesMu.Lock()
+	if old, ok := cm.probes[cfg.Name]; ok {
+		old.cancel()
+	}
+	cm.probes[cfg.Name] = p
+	cm.probesMu.Unlock()
+
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in health probe", "probe", cfg.Name, "panic", r)
+			}
+		}()
+		p.run(ctx)
+	}()
+
+	logger.Info("Health probe registered", "probe", cfg.Name, "type", cfg.Type, "component", cfg.Component, "interval", p.interval)
+	return nil
+}
+
+// UnregisterProbe stops and removes a custom health probe
+func (cm *ComponentMonitor) UnregisterProbe(name string) bool {
+	cm.probesMu.Lock()
+	defer cm.probesMu.Unlock()
+	p, ok := cm.probes[name]
+	if ok {
+		p.cancel()
+		delete(cm.probes, name)
+	}
+	return ok
+}
+
+// ProbeStatuses returns the state of all custom health probes, sorted by name
+func (cm *ComponentMonitor) ProbeStatuses() []ProbeStatus {
+	cm.probesMu.RLock()
+	list := make([]ProbeStatus, 0, len(cm.probes))
+	for _, p := range cm.probes {
+		list = append(list, p.snapshot())
+	}
+	cm.probesMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ComponentProbeError returns an error if a probe with action error is unhealthy for the component
+func (cm *ComponentMonitor) ComponentProbeError(componentType, componentID string) error {
+	cm.probesMu.RLock()
+	defer cm.probesMu.RUnlock()
+	var failed []string
+	for _, p := range cm.probes {
+		if p.cfg.Action != ProbeActionError || p.componentType != componentType || p.componentID != componentID {
+			continue
+		}
+		if s := p.snapshot(); s.State == ProbeStateUnhealthy {
+			failed = append(failed, fmt.Sprintf("probe %s: %s", s.Name, s.LastError))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("%s", strings.Join(failed, "; "))
+}
+
+// GetProbeStatuses returns the probe states of the global component monitor on this node
+func GetProbeStatuses() []ProbeStatus {
+	if GlobalComponentMonitor == nil {
+		return nil
+	}
+	return GlobalComponentMonitor.ProbeStatuses()
+}
+
+// GetComponentProbeError checks the probes of a component on the global component monitor
+func GetComponentProbeError(componentType, componentID string) error {
+	if GlobalComponentMonitor == nil {
+		return nil
+	}
+	return GlobalComponentMonitor.ComponentProbeError(componentType, componentID)
+}
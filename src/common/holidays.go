@@ -0,0 +1,108 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+// HolidayCalendarsConfig maps a calendar name to its holidays, used by the holidays= option of
+// TIME checks. A holiday is a date such as 2026-11-26, a day of every year such as 12-25, or an
+// inclusive range of dates such as 2026-12-24..2026-12-31.
+type HolidayCalendarsConfig map[string][]string
+
+// HolidayCalendar is a parsed holiday calendar
+type HolidayCalendar struct {
+	dates  map[string]bool // 2006-01-02
+	yearly map[string]bool // 01-02
+}
+
+var (
+	holidayCalendarsMu sync.RWMutex
+	holidayCalendars   map[string]*HolidayCalendar
+)
+
+// maxHolidayRangeDays bounds a range of dates, a longer range is most likely a typo
+const maxHolidayRangeDays = 366
+
+// Validate checks the dates of every calendar
+func (c HolidayCalendarsConfig) Validate() error {
+	_, err := parseHolidayCalendars(c)
+	return err
+}
+
+func parseHolidayCalendars(c HolidayCalendarsConfig) (map[string]*HolidayCalendar, error) {
+	calendars := make(map[string]*HolidayCalendar, len(c))
+	for name, days := range c {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ", ") {
+			return nil, fmt.Errorf("invalid calendar name %q", name)
+		}
+		cal := &HolidayCalendar{dates: make(map[string]bool), yearly: make(map[string]bool)}
+		for _, day := range days {
+			if err := cal.add(strings.TrimSpace(day)); err != nil {
+				return nil, fmt.Errorf("calendar %s: %v", name, err)
+			}
+		}
+		calendars[name] = cal
+	}
+	return calendars, nil
+}
+
+func (h *HolidayCalendar) add(day string) error {
+	if from, to, ok := strings.Cut(day, ".."); ok {
+		start, err := time.Parse(time.DateOnly, strings.TrimSpace(from))
+		if err != nil {
+			return fmt.Errorf("invalid start of range %q, expected 2006-01-02..2006-01-02", day)
+		}
+		end, err := time.Parse(time.DateOnly, strings.TrimSpace(to))
+		if err != nil {
+			return fmt.Errorf("invalid end of range %q, expected 2006-01-02..2006-01-02", day)
+		}
+		if end.Before(start) || end.Sub(start) > maxHolidayRangeDays*24*time.Hour {
+			return fmt.Errorf("range %q must end after its start and span at most %d days", day, maxHolidayRangeDays)
+		}
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			h.dates[d.Format(time.DateOnly)] = true
+		}
+		return nil
+	}
+	if t, err := time.Parse(time.DateOnly, day); err == nil {
+		h.dates[t.Format(time.DateOnly)] = true
+		return nil
+	}
+	// 2000 is a leap year, so 02-29 is accepted
+	if t, err := time.Parse("2006-01-02", "2000-"+day); err == nil {
+		h.yearly[t.Format("01-02")] = true
+		return nil
+	}
+	return fmt.Errorf("invalid holiday %q, expected 2006-01-02, 01-02 or 2006-01-02..2006-01-02", day)
+}
+
+// Contains reports whether the date of t, in the location of t, is a holiday
+func (h *HolidayCalendar) Contains(t time.Time) bool {
+	date := t.Format(time.DateOnly)
+	return h.dates[date] || h.yearly[date[5:]]
+}
+
+// InitHolidayCalendars loads the holiday calendars of TIME checks
+func InitHolidayCalendars(cfg HolidayCalendarsConfig) {
+	calendars, err := parseHolidayCalendars(cfg)
+	if err != nil {
+		logger.Error("Failed to load holiday calendars", "error", err)
+		return
+	}
+	holidayCalendarsMu.Lock()
+	holidayCalendars = calendars
+	holidayCalendarsMu.Unlock()
+}
+
+// GetHolidayCalendar returns a calendar configured under holiday_calendars
+func GetHolidayCalendar(name string) (*HolidayCalendar, bool) {
+	holidayCalendarsMu.RLock()
+	defer holidayCalendarsMu.RUnlock()
+	cal, ok := holidayCalendars[name]
+	return cal, ok
+}
@@ -0,0 +1,456 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Incident management providers
+const (
+	IncidentProviderPagerDuty = "pagerduty"
+	IncidentProviderOpsgenie  = "opsgenie"
+)
+
+// Incident actions, taken from the action field of an event
+const (
+	IncidentActionTrigger     = "trigger"
+	IncidentActionAcknowledge = "acknowledge"
+	IncidentActionResolve     = "resolve"
+)
+
+const (
+	defaultPagerDutyURL      = "https://events.pagerduty.com"
+	defaultOpsgenieURL       = "https://api.opsgenie.com"
+	defaultIncidentSeverity  = "error"
+	defaultIncidentSource    = "agentsmith-hub"
+	maxPagerDutyDedupKey     = 255
+	maxPagerDutySummary      = 1024
+	maxOpsgenieMessage       = 130
+	maxOpsgenieDetailValue   = 1000
+	incidentRetryAfterMaxSec = 60
+)
+
+// pagerDutySeverities are the severities accepted by the PagerDuty Events API v2
+var pagerDutySeverities = map[string]bool{"critical": true, "error": true, "warning": true, "info": true}
+
+// opsgeniePriorities maps PagerDuty style severities to Opsgenie priorities
+var opsgeniePriorities = map[string]string{"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}
+
+// IncidentConfig holds the settings of an incident producer
+type IncidentConfig struct {
+	Provider   string
+	URL        string // API base URL, e.g. https://api.eu.opsgenie.com
+	RoutingKey string // PagerDuty Events API v2 integration key
+	APIKey     string // Opsgenie API integration key
+
+	DedupFields     []string          // event fields the dedup key is built from, default the matched rule id
+	ActionField     string            // event field holding trigger, acknowledge or resolve, default always trigger
+	SummaryField    string            // event field used as incident title
+	SourceField     string            // event field used as incident source, e.g. host.name
+	SeverityField   string            // event field holding the detection severity
+	SeverityMap     map[string]string // detection severity -> provider severity (PagerDuty) or priority (Opsgenie)
+	DefaultSeverity string            // used when the severity field is missing or unmapped, default error
+	Tags            []string          // Opsgenie tags
+
+	MaxRetries int
+	Timeout    time.Duration
+	HTTP       *OutputHTTPConfig // TLS and proxy of the client
+}
+
+// IncidentProducer creates, acknowledges and resolves PagerDuty or Opsgenie incidents from events
+type IncidentProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg         IncidentConfig
+	client      *http.Client
+	dedupFields [][]string
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	triggered    uint64
+	acknowledged uint64
+	resolved     uint64
+	failed       uint64
+}
+
+// NewIncidentProducer starts sending the events read from msgChan as incident actions
+func NewIncidentProducer(cfg IncidentConfig, msgChan chan map[string]interface{}) (*IncidentProducer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &IncidentProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		client:   client,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, field := range cfg.DedupFields {
+		p.dedupFields = append(p.dedupFields, StringToList(field))
+	}
+	if len(p.dedupFields) == 0 {
+		p.dedupFields = [][]string{{"_hub_hit_rule_id"}}
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (cfg *IncidentConfig) validate() error {
+	switch cfg.Provider {
+	case IncidentProviderPagerDuty:
+		if cfg.RoutingKey == "" {
+			return fmt.Errorf("pagerduty routing_key is required")
+		}
+		if cfg.URL == "" {
+			cfg.URL = defaultPagerDutyURL
+		}
+	case IncidentProviderOpsgenie:
+		if cfg.APIKey == "" {
+			return fmt.Errorf("opsgenie api_key is required")
+		}
+		if cfg.URL == "" {
+			cfg.URL = defaultOpsgenieURL
+		}
+	default:
+		return fmt.Errorf("unsupported incident provider: %s", cfg.Provider)
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.DefaultSeverity == "" {
+		cfg.DefaultSeverity = defaultIncidentSeverity
+	}
+	return nil
+}
+
+func (p *IncidentProducer) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return
+			}
+			p.handle(msg)
+		}
+	}
+}
+
+// handle sends one event, retrying rate limited and server errors
+func (p *IncidentProducer) handle(msg map[string]interface{}) {
+	action := p.action(msg)
+	var err error
+retry:
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = p.send(action, msg)
+		if err == nil {
+			switch action {
+			case IncidentActionAcknowledge:
+				atomic.AddUint64(&p.acknowledged, 1)
+			case IncidentActionResolve:
+				atomic.AddUint64(&p.resolved, 1)
+			default:
+				atomic.AddUint64(&p.triggered, 1)
+			}
+			p.Receipts.AddAcked(1)
+			return
+		}
+		if retryAfter < 0 {
+			break
+		}
+		if retryAfter == 0 {
+			retryAfter = time.Second * time.Duration(attempt+1)
+		}
+		select {
+		case <-p.stopChan:
+			break retry
+		case <-time.After(retryAfter):
+		}
+	}
+
+	logger.Error("Failed to send incident", "provider", p.cfg.Provider, "action", action, "dedup_key", p.DedupKey(msg), "error", err)
+	atomic.AddUint64(&p.failed, 1)
+	p.Receipts.AddFailed(1)
+}
+
+// action returns the incident action requested by an event, trigger by default
+func (p *IncidentProducer) action(msg map[string]interface{}) string {
+	if p.cfg.ActionField == "" {
+		return IncidentActionTrigger
+	}
+	v, ok := GetCheckData(msg, StringToList(p.cfg.ActionField))
+	if !ok {
+		return IncidentActionTrigger
+	}
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "ack", IncidentActionAcknowledge:
+		return IncidentActionAcknowledge
+	case "close", "resolved", IncidentActionResolve:
+		return IncidentActionResolve
+	}
+	return IncidentActionTrigger
+}
+
+// DedupKey builds the key that groups events into one incident from the dedup fields.
+// Keys longer than PagerDuty accepts are replaced by their SHA-256.
+func (p *IncidentProducer) DedupKey(msg map[string]interface{}) string {
+	values := make([]string, 0, len(p.dedupFields))
+	for _, path := range p.dedupFields {
+		v, _ := GetCheckData(msg, path)
+		values = append(values, v)
+	}
+	key := strings.Join(values, "|")
+	if len(key) > maxPagerDutyDedupKey {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// severity maps the detection severity of an event to the provider severity or priority
+func (p *IncidentProducer) severity(msg map[string]interface{}) string {
+	severity := p.cfg.DefaultSeverity
+	if p.cfg.SeverityField != "" {
+		if v, ok := GetCheckData(msg, StringToList(p.cfg.SeverityField)); ok && v != "" {
+			if mapped, ok := p.cfg.SeverityMap[v]; ok {
+				severity = mapped
+			} else if mapped, ok := p.cfg.SeverityMap[strings.ToLower(v)]; ok {
+				severity = mapped
+			} else {
+				severity = strings.ToLower(v)
+			}
+		}
+	}
+
+	if p.cfg.Provider == IncidentProviderOpsgenie {
+		if priority, ok := opsgeniePriorities[severity]; ok {
+			return priority
+		}
+		upper := strings.ToUpper(severity)
+		if len(upper) == 2 && upper[0] == 'P' && upper[1] >= '1' && upper[1] <= '5' {
+			return upper
+		}
+		if priority, ok := opsgeniePriorities[p.cfg.DefaultSeverity]; ok {
+			return priority
+		}
+		return "P3"
+	}
+	if pagerDutySeverities[severity] {
+		return severity
+	}
+	if pagerDutySeverities[p.cfg.DefaultSeverity] {
+		return p.cfg.DefaultSeverity
+	}
+	return defaultIncidentSeverity
+}
+
+func (p *IncidentProducer) summary(msg map[string]interface{}, dedupKey string) string {
+	if p.cfg.SummaryField != "" {
+		if v, ok := GetCheckData(msg, StringToList(p.cfg.SummaryField)); ok && v != "" {
+			return v
+		}
+	}
+	if rule, ok := GetCheckData(msg, []string{"_hub_hit_rule_id"}); ok && rule != "" {
+		return fmt.Sprintf("AgentSmith-HUB detection %s: %s", rule, dedupKey)
+	}
+	return "AgentSmith-HUB detection: " + dedupKey
+}
+
+func (p *IncidentProducer) source(msg map[string]interface{}) string {
+	if p.cfg.SourceField != "" {
+		if v, ok := GetCheckData(msg, StringToList(p.cfg.SourceField)); ok && v != "" {
+			return v
+		}
+	}
+	return defaultIncidentSource
+}
+
+// send performs one API call. retryAfter is negative when the error must not be retried,
+// zero for the default backoff, or the delay asked for by the provider.
+func (p *IncidentProducer) send(action string, msg map[string]interface{}) (time.Duration, error) {
+	dedupKey := p.DedupKey(msg)
+	if strings.Trim(dedupKey, "|") == "" {
+		return -1, fmt.Errorf("empty dedup key, none of the dedup fields are set")
+	}
+
+	var (
+		endpoint string
+		body     interface{}
+		header   = http.Header{}
+	)
+	switch p.cfg.Provider {
+	case IncidentProviderPagerDuty:
+		endpoint = p.cfg.URL + "/v2/enqueue"
+		event := map[string]interface{}{
+			"routing_key":  p.cfg.RoutingKey,
+			"event_action": action,
+			"dedup_key":    dedupKey,
+		}
+		if action == IncidentActionTrigger {
+			event["payload"] = map[string]interface{}{
+				"summary":        truncateRunes(p.summary(msg, dedupKey), maxPagerDutySummary),
+				"source":         p.source(msg),
+				"severity":       p.severity(msg),
+				"timestamp":      time.Now().UTC().Format(time.RFC3339),
+				"custom_details": msg,
+			}
+		}
+		body = event
+	case IncidentProviderOpsgenie:
+		header.Set("Authorization", "GenieKey "+p.cfg.APIKey)
+		alias := url.PathEscape(dedupKey)
+		switch action {
+		case IncidentActionAcknowledge:
+			endpoint = p.cfg.URL + "/v2/alerts/" + alias + "/acknowledge?identifierType=alias"
+			body = map[string]interface{}{"source": p.source(msg), "user": defaultIncidentSource}
+		case IncidentActionResolve:
+			endpoint = p.cfg.URL + "/v2/alerts/" + alias + "/close?identifierType=alias"
+			body = map[string]interface{}{"source": p.source(msg), "user": defaultIncidentSource}
+		default:
+			endpoint = p.cfg.URL + "/v2/alerts"
+			details := make(map[string]string, len(msg))
+			for k, v := range msg {
+				details[k] = truncateRunes(AnyToString(v), maxOpsgenieDetailValue)
+			}
+			description, _ := json.MarshalIndent(msg, "", "  ")
+			body = map[string]interface{}{
+				"message":     truncateRunes(p.summary(msg, dedupKey), maxOpsgenieMessage),
+				"alias":       dedupKey,
+				"description": truncateRunes(string(description), 15000),
+				"priority":    p.severity(msg),
+				"source":      p.source(msg),
+				"details":     details,
+				"tags":        p.cfg.Tags,
+			}
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return -1, fmt.Errorf("failed to encode incident: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return -1, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter := time.Duration(0)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(min(secs, incidentRetryAfterMaxSec)) * time.Second
+		}
+		return retryAfter, fmt.Errorf("%s rate limited: %s", p.cfg.Provider, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("%s returned %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		return -1, fmt.Errorf("%s rejected incident with %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// Close waits for the queued events to be sent once msgChan is closed by its owner, giving up after 30s
+func (p *IncidentProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many incidents were triggered, acknowledged, resolved or failed
+func (p *IncidentProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"triggered":    atomic.LoadUint64(&p.triggered),
+		"acknowledged": atomic.LoadUint64(&p.acknowledged),
+		"resolved":     atomic.LoadUint64(&p.resolved),
+		"failed":       atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestIncidentConnection checks that the provider API is reachable and, for Opsgenie, that the API key is accepted.
+// PagerDuty has no read-only call for integration keys, so only reachability is checked.
+func TestIncidentConnection(cfg IncidentConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	switch cfg.Provider {
+	case IncidentProviderPagerDuty:
+		req, err = http.NewRequest(http.MethodGet, cfg.URL+"/v2/enqueue", nil)
+	case IncidentProviderOpsgenie:
+		req, err = http.NewRequest(http.MethodGet, cfg.URL+"/v2/alerts/count", nil)
+		if err == nil {
+			req.Header.Set("Authorization", "GenieKey "+cfg.APIKey)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s not reachable: %w", cfg.Provider, err)
+	}
+	resp.Body.Close()
+	if cfg.Provider == IncidentProviderOpsgenie && resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("opsgenie rejected the api key")
+	}
+	return nil
+}
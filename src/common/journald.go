@@ -0,0 +1,268 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const journaldCursorSaveInterval = 5 * time.Second
+
+// JournaldReaderConfig selects which journal entries are collected
+type JournaldReaderConfig struct {
+	Units       []string // systemd units, journalctl -u
+	Identifiers []string // syslog identifiers, journalctl -t
+	Matches     []string // raw field matches, e.g. _TRANSPORT=kernel
+	Priority    string   // max priority, e.g. "warning" or "0..4"
+	Directory   string   // journal directory, default is the system journal
+	SinceNow    bool     // without a stored cursor, start at the tail instead of the beginning of the journal
+}
+
+// JournaldReader follows the systemd journal through journalctl and forwards entries to MsgChan.
+// The journal cursor is persisted per node so collection resumes after restarts.
+type JournaldReader struct {
+	InputID string
+	MsgChan chan map[string]interface{}
+
+	cfg      JournaldReaderConfig
+	cursorMu sync.Mutex
+	cursor   string
+	saved    string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	readTotal uint64
+}
+
+// hostCursorKey is the Redis key of a host-local input cursor, such as a journal cursor or event log bookmark
+func hostCursorKey(inputID string) string {
+	return auditLogCursorKeyPrefix + inputID + ":" + GetNodeID()
+}
+
+// NewJournaldReader creates a journald reader, failing early if journalctl is not available
+func NewJournaldReader(inputID string, cfg JournaldReaderConfig, msgChan chan map[string]interface{}) (*JournaldReader, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, fmt.Errorf("journalctl not found, journald input requires systemd: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JournaldReader{
+		InputID: inputID,
+		MsgChan: msgChan,
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start launches journalctl and keeps it running until Close is called
+func (r *JournaldReader) Start() {
+	if cursor, err := RedisGet(hostCursorKey(r.InputID)); err == nil && cursor != "" {
+		r.cursor = cursor
+		r.saved = cursor
+	}
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		backoff := time.Second
+		for {
+			started := time.Now()
+			if err := r.follow(); err != nil && r.ctx.Err() == nil {
+				logger.Warn("journalctl exited, restarting", "input", r.InputID, "error", err)
+			}
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = nextBackoff(backoff)
+		}
+	}()
+
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(journaldCursorSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				r.saveCursor()
+			}
+		}
+	}()
+}
+
+// Close stops journalctl and persists the last cursor
+func (r *JournaldReader) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.saveCursor()
+}
+
+// GetReadTotal returns the number of journal entries read since start
+func (r *JournaldReader) GetReadTotal() uint64 {
+	return atomic.LoadUint64(&r.readTotal)
+}
+
+func (r *JournaldReader) args() []string {
+	args := []string{"--output=json", "--follow", "--no-pager", "--quiet"}
+
+	r.cursorMu.Lock()
+	cursor := r.cursor
+	r.cursorMu.Unlock()
+
+	switch {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case r.cfg.SinceNow:
+		args = append(args, "--lines=0")
+	default:
+		args = append(args, "--lines=all")
+	}
+	if r.cfg.Directory != "" {
+		args = append(args, "--directory="+r.cfg.Directory)
+	}
+	if r.cfg.Priority != "" {
+		args = append(args, "--priority="+r.cfg.Priority)
+	}
+	for _, u := range r.cfg.Units {
+		args = append(args, "--unit="+u)
+	}
+	for _, t := range r.cfg.Identifiers {
+		args = append(args, "--identifier="+t)
+	}
+	return append(args, r.cfg.Matches...)
+}
+
+func (r *JournaldReader) follow() error {
+	cmd := exec.CommandContext(r.ctx, "journalctl", r.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := sonic.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warn("Failed to parse journal entry", "input", r.InputID, "error", err)
+			continue
+		}
+
+		select {
+		case r.MsgChan <- buildJournalEvent(entry):
+		case <-r.ctx.Done():
+			_ = cmd.Wait()
+			return nil
+		}
+		atomic.AddUint64(&r.readTotal, 1)
+
+		if cursor, ok := entry["__CURSOR"].(string); ok {
+			r.cursorMu.Lock()
+			r.cursor = cursor
+			r.cursorMu.Unlock()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+func (r *JournaldReader) saveCursor() {
+	r.cursorMu.Lock()
+	cursor := r.cursor
+	r.cursorMu.Unlock()
+
+	if cursor == "" || cursor == r.saved {
+		return
+	}
+	if _, err := RedisSet(hostCursorKey(r.InputID), cursor, 0); err != nil {
+		logger.Warn("Failed to persist journal cursor", "input", r.InputID, "error", err)
+		return
+	}
+	r.saved = cursor
+}
+
+// ResetHostInputCursor removes the stored journal cursor or event log bookmark of an input on this node
+func ResetHostInputCursor(inputID string) error {
+	return RedisDel(hostCursorKey(inputID))
+}
+
+// buildJournalEvent maps the well-known journal fields to readable names and keeps the raw entry under "journal"
+func buildJournalEvent(entry map[string]interface{}) map[string]interface{} {
+	event := map[string]interface{}{
+		"message": journalString(entry["MESSAGE"]),
+		"journal": entry,
+	}
+
+	if us, err := strconv.ParseInt(journalString(entry["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		event["timestamp"] = time.UnixMicro(us).UTC().Format(time.RFC3339Nano)
+	}
+	if p, err := strconv.Atoi(journalString(entry["PRIORITY"])); err == nil {
+		event["priority"] = p
+	}
+	if pid, err := strconv.Atoi(journalString(entry["_PID"])); err == nil {
+		event["pid"] = pid
+	}
+	for field, name := range map[string]string{
+		"_SYSTEMD_UNIT":     "unit",
+		"SYSLOG_IDENTIFIER": "identifier",
+		"_HOSTNAME":         "hostname",
+		"_COMM":             "command",
+		"_TRANSPORT":        "transport",
+	} {
+		if v := journalString(entry[field]); v != "" {
+			event[name] = v
+		}
+	}
+	return event
+}
+
+// journalString converts a journal field value to string.
+// journalctl encodes non-UTF-8 values as byte arrays and repeated fields as arrays of strings.
+func journalString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []interface{}:
+		if len(val) == 0 {
+			return ""
+		}
+		if _, isNum := val[0].(float64); isNum {
+			b := make([]byte, 0, len(val))
+			for _, x := range val {
+				if n, ok := x.(float64); ok {
+					b = append(b, byte(n))
+				}
+			}
+			return string(b)
+		}
+		return journalString(val[0])
+	default:
+		return fmt.Sprint(val)
+	}
+}
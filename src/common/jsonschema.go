@@ -0,0 +1,478 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema is a compiled JSON Schema used to validate decoded events.
+// It supports the structural subset of draft 2020-12 that matters for event data:
+// type, enum, const, properties, required, additionalProperties, items,
+// min/max length, pattern, minimum/maximum (incl. exclusive), min/max items,
+// allOf, anyOf, oneOf and not. Unknown keywords are ignored, as the spec requires.
+// Top-level _hub_* fields are hub metadata and are never validated.
+type JSONSchema struct {
+	types      []string
+	enum       []interface{}
+	constVal   interface{}
+	hasConst   bool
+	properties map[string]*JSONSchema
+	required   []string
+	// additional is nil when unrestricted; noAdditional rejects unknown properties
+	additional   *JSONSchema
+	noAdditional bool
+	items        *JSONSchema
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	exclusiveMin         *float64
+	exclusiveMax         *float64
+	minItems, maxItems   *int
+
+	allOf, anyOf, oneOf []*JSONSchema
+	not                 *JSONSchema
+}
+
+// CompileJSONSchema compiles a schema definition decoded from JSON or YAML
+func CompileJSONSchema(def map[string]interface{}) (*JSONSchema, error) {
+	return compileJSONSchema(def, "#")
+}
+
+func compileJSONSchema(def map[string]interface{}, path string) (*JSONSchema, error) {
+	s := &JSONSchema{}
+	var err error
+
+	if t, ok := def["type"]; ok {
+		switch v := t.(type) {
+		case string:
+			s.types = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/type: expected string items", path)
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return nil, fmt.Errorf("%s/type: expected string or array", path)
+		}
+		for _, name := range s.types {
+			switch name {
+			case "object", "array", "string", "number", "integer", "boolean", "null":
+			default:
+				return nil, fmt.Errorf("%s/type: unknown type %q", path, name)
+			}
+		}
+	}
+
+	if e, ok := def["enum"]; ok {
+		list, ok := e.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/enum: expected array", path)
+		}
+		s.enum = list
+	}
+	if c, ok := def["const"]; ok {
+		s.constVal, s.hasConst = c, true
+	}
+
+	if p, ok := def["properties"]; ok {
+		props, ok := toStringMap(p)
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: expected object", path)
+		}
+		s.properties = make(map[string]*JSONSchema, len(props))
+		for name, sub := range props {
+			if s.properties[name], err = compileSubSchema(sub, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r, ok := def["required"]; ok {
+		list, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/required: expected array", path)
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: expected string items", path)
+			}
+			s.required = append(s.required, name)
+		}
+	}
+
+	if a, ok := def["additionalProperties"]; ok {
+		if b, isBool := a.(bool); isBool {
+			s.noAdditional = !b
+		} else if s.additional, err = compileSubSchema(a, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if i, ok := def["items"]; ok {
+		if s.items, err = compileSubSchema(i, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.minLength, err = schemaInt(def, "minLength", path); err != nil {
+		return nil, err
+	}
+	if s.maxLength, err = schemaInt(def, "maxLength", path); err != nil {
+		return nil, err
+	}
+	if s.minItems, err = schemaInt(def, "minItems", path); err != nil {
+		return nil, err
+	}
+	if s.maxItems, err = schemaInt(def, "maxItems", path); err != nil {
+		return nil, err
+	}
+	if s.minimum, err = schemaNumber(def, "minimum", path); err != nil {
+		return nil, err
+	}
+	if s.maximum, err = schemaNumber(def, "maximum", path); err != nil {
+		return nil, err
+	}
+	if s.exclusiveMin, err = schemaNumber(def, "exclusiveMinimum", path); err != nil {
+		return nil, err
+	}
+	if s.exclusiveMax, err = schemaNumber(def, "exclusiveMaximum", path); err != nil {
+		return nil, err
+	}
+
+	if p, ok := def["pattern"]; ok {
+		expr, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: expected string", path)
+		}
+		if s.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+
+	for _, kw := range []string{"allOf", "anyOf", "oneOf"} {
+		raw, ok := def[kw]
+		if !ok {
+			continue
+		}
+		list, ok := raw.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s/%s: expected non-empty array", path, kw)
+		}
+		subs := make([]*JSONSchema, 0, len(list))
+		for i, item := range list {
+			sub, err := compileSubSchema(item, fmt.Sprintf("%s/%s/%d", path, kw, i))
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+		switch kw {
+		case "allOf":
+			s.allOf = subs
+		case "anyOf":
+			s.anyOf = subs
+		case "oneOf":
+			s.oneOf = subs
+		}
+	}
+	if n, ok := def["not"]; ok {
+		if s.not, err = compileSubSchema(n, path+"/not"); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func compileSubSchema(v interface{}, path string) (*JSONSchema, error) {
+	if b, ok := v.(bool); ok {
+		// true accepts everything, false nothing
+		if b {
+			return &JSONSchema{}, nil
+		}
+		return &JSONSchema{not: &JSONSchema{}}, nil
+	}
+	def, ok := toStringMap(v)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected schema object", path)
+	}
+	return compileJSONSchema(def, path)
+}
+
+// Validate checks a value against the schema and returns one message per violation
+func (s *JSONSchema) Validate(v interface{}) []string {
+	var errs []string
+	s.validate(v, "", &errs)
+	return errs
+}
+
+func (s *JSONSchema) validate(v interface{}, path string, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		loc := path
+		if loc == "" {
+			loc = "(root)"
+		}
+		*errs = append(*errs, loc+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.types) > 0 {
+		matched := false
+		for _, t := range s.types {
+			if jsonTypeMatches(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(v))
+			return
+		}
+	}
+
+	if s.hasConst && !jsonEqual(v, s.constVal) {
+		fail("must be %v", s.constVal)
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.minLength != nil && n < *s.minLength {
+			fail("shorter than %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("longer than %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("does not match pattern %q", s.pattern.String())
+		}
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := val[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if path == "" && strings.HasPrefix(k, "_hub_") {
+				// hub metadata added by inputs, replays and canaries is not part of the event
+				continue
+			}
+			sub, known := s.properties[k]
+			switch {
+			case known:
+				sub.validate(val[k], path+"/"+k, errs)
+			case s.noAdditional:
+				fail("unexpected property %q", k)
+			case s.additional != nil:
+				s.additional.validate(val[k], path+"/"+k, errs)
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(val) < *s.minItems {
+			fail("fewer than %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(val) > *s.maxItems {
+			fail("more than %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range val {
+				s.items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	default:
+		if f, ok := jsonNumber(v); ok {
+			if s.minimum != nil && f < *s.minimum {
+				fail("less than minimum %v", *s.minimum)
+			}
+			if s.maximum != nil && f > *s.maximum {
+				fail("greater than maximum %v", *s.maximum)
+			}
+			if s.exclusiveMin != nil && f <= *s.exclusiveMin {
+				fail("must be greater than %v", *s.exclusiveMin)
+			}
+			if s.exclusiveMax != nil && f >= *s.exclusiveMax {
+				fail("must be less than %v", *s.exclusiveMax)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, errs)
+	}
+	if len(s.anyOf) > 0 {
+		ok := false
+		for _, sub := range s.anyOf {
+			if len(sub.Validate(v)) == 0 {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("does not match any schema in anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if len(sub.Validate(v)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+	if s.not != nil && len(s.not.Validate(v)) == 0 {
+		fail("must not match schema in not")
+	}
+}
+
+func jsonTypeMatches(v interface{}, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "number":
+		_, ok := jsonNumber(v)
+		return ok
+	case "integer":
+		f, ok := jsonNumber(v)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if _, ok := jsonNumber(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares decoded values, treating all numeric types alike
+func jsonEqual(a, b interface{}) bool {
+	if fa, ok := jsonNumber(a); ok {
+		fb, ok := jsonNumber(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toStringMap accepts both JSON decoded objects and YAML decoded maps
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[fmt.Sprint(k)] = val
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func schemaInt(def map[string]interface{}, key, path string) (*int, error) {
+	raw, ok := def[key]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := jsonNumber(raw)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s/%s: expected non-negative integer", path, key)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func schemaNumber(def map[string]interface{}, key, path string) (*float64, error) {
+	raw, ok := def[key]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := jsonNumber(raw)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: expected number", path, key)
+	}
+	return &f, nil
+}
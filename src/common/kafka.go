@@ -5,6 +5,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"crypto/tls"
@@ -65,6 +68,18 @@ type KafkaTLSConfig struct {
 	SkipVerify bool   `yaml:"skip_verify"`
 }
 
+// KafkaProducerOptions holds the optional features of a Kafka producer
+type KafkaProducerOptions struct {
+	KeyTemplate string            // Go template over the event building the record key, overrides the key field
+	Headers     map[string]string // record header -> event field, for routing without decoding the value
+	Encoding    *EncodingConfig   // record value serialization, default JSON
+
+	// TransactionalID enables transactions, every batch of events is committed atomically
+	TransactionalID string
+	BatchSize       int           // events per transaction, default 1000
+	BatchTimeout    time.Duration // longest wait for a transaction to fill, default 100ms
+}
+
 // KafkaProducer wraps the franz-go producer with a channel-based interface
 type KafkaProducer struct {
 	Client       *kgo.Client
@@ -74,7 +89,16 @@ type KafkaProducer struct {
 	KeyFieldList []string // List of fields to use as keys
 	BatchSize    int
 	BatchTimeout time.Duration
+	Receipts     *DeliveryReceipts // optional, records acked/failed deliveries
+	// PriorityChan is optional, high priority events read from it are produced ahead of MsgChan
+	PriorityChan chan map[string]interface{}
 	stopChan     chan struct{} // Add stop channel for graceful shutdown
+	done         chan struct{}
+
+	keyTemplate   *template.Template
+	headers       map[string][]string // record header -> event field path
+	encoder       *EventEncoder
+	transactional bool
 }
 
 func EnsureTopicExists(cl *kgo.Client, topic string) (bool, error) {
@@ -103,11 +127,17 @@ func NewKafkaProducer(
 	keyField string,
 	tlsCfg *KafkaTLSConfig,
 	idempotentEnabled bool,
+	options KafkaProducerOptions,
 ) (*KafkaProducer, error) {
+	// Keyed records are hashed to partitions so events with the same key keep their order
+	partitioner := kgo.RoundRobinPartitioner()
+	if keyField != "" || options.KeyTemplate != "" {
+		partitioner = kgo.StickyKeyPartitioner(nil)
+	}
 	opts := []kgo.Opt{
 		kgo.SeedBrokers(brokers...),
 		kgo.DefaultProduceTopic(topic),
-		kgo.RecordPartitioner(kgo.RoundRobinPartitioner()),
+		kgo.RecordPartitioner(partitioner),
 		kgo.ProducerBatchMaxBytes(1_000_000),
 		kgo.ProducerLinger(50 * time.Millisecond),
 	}
@@ -138,40 +168,122 @@ func NewKafkaProducer(
 	}
 
 	// Control idempotent producer (default enabled). If disabled, avoid InitProducerID requiring cluster ACL.
-	if !idempotentEnabled {
+	if options.TransactionalID != "" {
+		if !idempotentEnabled {
+			return nil, fmt.Errorf("kafka transactions require the idempotent producer")
+		}
+		opts = append(opts, kgo.TransactionalID(options.TransactionalID))
+	} else if !idempotentEnabled {
 		opts = append(opts, kgo.DisableIdempotentWrite())
 	}
 
-	cl, err := kgo.NewClient(opts...)
+	prod, err := newKafkaRecordBuilder(topic, keyField, options)
 	if err != nil {
 		return nil, err
 	}
 
-	prod := &KafkaProducer{
-		Client:       cl,
-		MsgChan:      msgChan,
-		Topic:        topic,
-		KeyField:     keyField,
-		KeyFieldList: StringToList(keyField),
-		BatchSize:    1000,
-		BatchTimeout: 100 * time.Millisecond,
-		stopChan:     make(chan struct{}),
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
 	}
+	prod.Client = cl
+	prod.MsgChan = msgChan
+	prod.stopChan = make(chan struct{})
+	prod.done = make(chan struct{})
 
 	_, err = EnsureTopicExists(cl, topic)
 	if err != nil {
+		cl.Close()
 		return nil, err
 	}
 
-	go prod.run()
+	if prod.transactional {
+		go prod.runTransactional()
+	} else {
+		go prod.run()
+	}
 	return prod, nil
 }
 
+// newKafkaRecordBuilder returns a producer without client, only able to build records
+func newKafkaRecordBuilder(topic string, keyField string, options KafkaProducerOptions) (*KafkaProducer, error) {
+	var keyTemplate *template.Template
+	if options.KeyTemplate != "" {
+		var err error
+		if keyTemplate, err = ParseEventTemplate("key", options.KeyTemplate); err != nil {
+			return nil, fmt.Errorf("invalid key template: %w", err)
+		}
+	}
+	encoder, err := NewEventEncoder(options.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	prod := &KafkaProducer{
+		Topic:         topic,
+		KeyField:      keyField,
+		KeyFieldList:  StringToList(keyField),
+		BatchSize:     1000,
+		BatchTimeout:  100 * time.Millisecond,
+		keyTemplate:   keyTemplate,
+		encoder:       encoder,
+		transactional: options.TransactionalID != "",
+	}
+	if options.BatchSize > 0 {
+		prod.BatchSize = options.BatchSize
+	}
+	if options.BatchTimeout > 0 {
+		prod.BatchTimeout = options.BatchTimeout
+	}
+	if len(options.Headers) > 0 {
+		prod.headers = make(map[string][]string, len(options.Headers))
+		for name, field := range options.Headers {
+			prod.headers[name] = StringToList(field)
+		}
+	}
+	return prod, nil
+}
+
+// CaptureKafkaRecord builds the record a producer with these settings would send for msg,
+// without connecting to the brokers
+func CaptureKafkaRecord(topic string, keyField string, options KafkaProducerOptions, msg map[string]interface{}) (*CapturedPayload, error) {
+	builder, err := newKafkaRecordBuilder(topic, keyField, options)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := builder.record(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCapturedPayload(topic, rec.Value)
+	c.Key = string(rec.Key)
+	c.ContentType = builder.encoder.ContentType()
+	if len(rec.Headers) > 0 {
+		c.Headers = make(map[string]string, len(rec.Headers))
+		for _, h := range rec.Headers {
+			c.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return c, nil
+}
+
 // run processes messages from the input channel and sends them to Kafka
 // It handles message serialization and error reporting
 func (p *KafkaProducer) run() {
+	defer close(p.done)
 	for {
+		// Serve the priority lane first so critical events skip the queued bulk messages
 		select {
+		case msg := <-p.PriorityChan:
+			p.produce(msg)
+			continue
+		default:
+		}
+
+		select {
+		case msg := <-p.PriorityChan:
+			p.produce(msg)
 		case <-p.stopChan:
 			logger.Info("[KafkaProducer] Stop signal received, draining remaining messages")
 			// Process any remaining messages before exiting
@@ -183,31 +295,188 @@ func (p *KafkaProducer) run() {
 				logger.Info("[KafkaProducer] Message channel closed")
 				return
 			}
+			p.produce(msg)
+		}
+	}
+}
 
-			value, err := sonic.Marshal(msg)
-			if err != nil {
-				logger.Error("[KafkaProducer] failed to serialize message", "error", err.Error())
-				continue // skip invalid message
+// record builds the Kafka record of a message with its key and headers
+func (p *KafkaProducer) record(msg map[string]interface{}) (*kgo.Record, error) {
+	value, err := p.encoder.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &kgo.Record{
+		Topic: p.Topic,
+		Value: value,
+	}
+	// Consumers need the header to tell the binary serializations apart
+	if p.encoder.Serialization() != SerializationJSON {
+		rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: "content-type", Value: []byte(p.encoder.ContentType())})
+	}
+
+	if p.keyTemplate != nil {
+		if key, err := ExecuteEventTemplate(p.keyTemplate, msg); err == nil && key != "" {
+			rec.Key = []byte(key)
+		}
+	} else if p.KeyField != "" {
+		if tmp, ok := GetCheckData(msg, p.KeyFieldList); ok {
+			rec.Key = []byte(tmp)
+		}
+	}
+
+	for name, path := range p.headers {
+		if v, ok := GetCheckData(msg, path); ok {
+			rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: name, Value: []byte(v)})
+		}
+	}
+	return rec, nil
+}
+
+// produce serializes one message and hands it to the client asynchronously
+func (p *KafkaProducer) produce(msg map[string]interface{}) {
+	token := TakeDeliveryToken(msg)
+	rec, err := p.record(msg)
+	if err != nil {
+		logger.Error("[KafkaProducer] failed to serialize message", "error", err.Error())
+		p.Receipts.AddFailed(1)
+		// Sending it again cannot help, so the record is not held back
+		token.Release()
+		return // skip invalid message
+	}
+
+	p.Client.Produce(context.Background(), rec, func(r *kgo.Record, err error) {
+		if err != nil {
+			logger.Error("[KafkaProducer] failed to produce message to topic", "topic", p.Topic, "error", err)
+			p.Receipts.AddFailed(1)
+			token.Fail()
+			return
+		}
+		p.Receipts.AddAcked(1)
+		token.Release()
+	})
+}
+
+// runTransactional collects messages into batches and commits every batch in one transaction.
+// High priority events commit the open batch immediately.
+func (p *KafkaProducer) runTransactional() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.BatchSize)
+	timer := time.NewTimer(p.BatchTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case msg := <-p.PriorityChan:
+			batch = append(batch, msg)
+			p.commit(batch)
+			batch = batch[:0]
+		case <-p.stopChan:
+			logger.Info("[KafkaProducer] Stop signal received, committing remaining messages")
+			batch = p.collectRemaining(batch)
+			p.commit(batch)
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				logger.Info("[KafkaProducer] Message channel closed")
+				p.commit(batch)
+				return
 			}
+			batch = append(batch, msg)
+			if len(batch) >= p.BatchSize {
+				p.commit(batch)
+				batch = batch[:0]
+			}
+		case <-timer.C:
+			p.commit(batch)
+			batch = batch[:0]
+			timer.Reset(p.BatchTimeout)
+		}
+	}
+}
 
-			rec := &kgo.Record{
-				Topic: p.Topic,
-				Value: value,
+// collectRemaining appends the messages still queued at shutdown
+func (p *KafkaProducer) collectRemaining(batch []map[string]interface{}) []map[string]interface{} {
+	for {
+		select {
+		case msg := <-p.PriorityChan:
+			batch = append(batch, msg)
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return batch
 			}
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+}
 
-			if p.KeyField != "" {
-				if tmp, ok := GetCheckData(msg, p.KeyFieldList); ok {
-					rec.Key = []byte(tmp)
-				}
+// commit produces a batch in one transaction. Either every record of the batch becomes
+// visible to read_committed consumers or, after an abort, none of them.
+func (p *KafkaProducer) commit(batch []map[string]interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := p.Client.BeginTransaction(); err != nil {
+		logger.Error("[KafkaProducer] failed to begin transaction", "topic", p.Topic, "error", err)
+		p.Receipts.AddFailed(uint64(len(batch)))
+		TakeDeliveryTokens(batch).Fail()
+		return
+	}
+
+	var produceErr atomic.Value
+	var tokens DeliveryTokens
+	produced := 0
+	for _, msg := range batch {
+		token := TakeDeliveryToken(msg)
+		rec, err := p.record(msg)
+		if err != nil {
+			logger.Error("[KafkaProducer] failed to serialize message", "error", err.Error())
+			p.Receipts.AddFailed(1)
+			token.Release()
+			continue
+		}
+		produced++
+		tokens = append(tokens, token)
+		p.Client.Produce(ctx, rec, func(r *kgo.Record, err error) {
+			if err != nil {
+				produceErr.Store(err)
 			}
+		})
+	}
 
-			p.Client.Produce(context.Background(), rec, func(r *kgo.Record, err error) {
-				if err != nil {
-					logger.Error("[KafkaProducer] failed to produce message to topic", "topic", p.Topic, "error", err)
-				}
-			})
+	err := p.Client.Flush(ctx)
+	if err == nil {
+		if v := produceErr.Load(); v != nil {
+			err = v.(error)
+		}
+	}
+	if err != nil {
+		logger.Error("[KafkaProducer] aborting transaction", "topic", p.Topic, "messages", produced, "error", err)
+		if abortErr := p.Client.AbortBufferedRecords(ctx); abortErr != nil {
+			logger.Warn("[KafkaProducer] failed to abort buffered records", "error", abortErr)
+		}
+		if endErr := p.Client.EndTransaction(ctx, kgo.TryAbort); endErr != nil {
+			logger.Warn("[KafkaProducer] failed to abort transaction", "error", endErr)
 		}
+		p.Receipts.AddFailed(uint64(produced))
+		tokens.Fail()
+		return
+	}
+
+	if err := p.Client.EndTransaction(ctx, kgo.TryCommit); err != nil {
+		logger.Error("[KafkaProducer] failed to commit transaction", "topic", p.Topic, "messages", produced, "error", err)
+		p.Receipts.AddFailed(uint64(produced))
+		tokens.Fail()
+		return
 	}
+	p.Receipts.AddAcked(uint64(produced))
+	tokens.Release()
 }
 
 // drainRemainingMessages processes any remaining messages in the message channel
@@ -223,6 +492,9 @@ func (p *KafkaProducer) drainRemainingMessages() {
 				logger.Info("[KafkaProducer] Drain timeout reached", "processed_messages", drainCount)
 			}
 			return
+		case msg := <-p.PriorityChan:
+			p.produce(msg)
+			drainCount++
 		case msg, ok := <-p.MsgChan:
 			if !ok {
 				// Channel is closed
@@ -231,29 +503,7 @@ func (p *KafkaProducer) drainRemainingMessages() {
 				}
 				return
 			}
-
-			value, err := sonic.Marshal(msg)
-			if err != nil {
-				logger.Error("[KafkaProducer] failed to serialize message during drain", "error", err.Error())
-				continue
-			}
-
-			rec := &kgo.Record{
-				Topic: p.Topic,
-				Value: value,
-			}
-
-			if p.KeyField != "" {
-				if tmp, ok := GetCheckData(msg, p.KeyFieldList); ok {
-					rec.Key = []byte(tmp)
-				}
-			}
-
-			p.Client.Produce(context.Background(), rec, func(r *kgo.Record, err error) {
-				if err != nil {
-					logger.Error("[KafkaProducer] failed to produce message to topic during drain", "topic", p.Topic, "error", err)
-				}
-			})
+			p.produce(msg)
 			drainCount++
 		}
 	}
@@ -262,6 +512,11 @@ func (p *KafkaProducer) drainRemainingMessages() {
 // Close gracefully shuts down the Kafka producer
 func (p *KafkaProducer) Close() {
 	close(p.stopChan)
+	// Let the remaining messages be handed to the client, or the open transaction commit, before closing it
+	select {
+	case <-p.done:
+	case <-time.After(40 * time.Second):
+	}
 	p.Client.Close()
 }
 
@@ -270,6 +525,11 @@ type KafkaConsumer struct {
 	Client   *kgo.Client
 	MsgChan  chan map[string]interface{}
 	stopChan chan struct{}
+
+	// at-least-once delivery, offsets are committed once every output confirmed the records
+	atLeastOnce atomic.Bool
+	checkpoint  *kafkaCheckpoint
+	rebalanceMu sync.Mutex // keeps rewinds apart from revocations
 }
 
 // getCompression returns the appropriate compression option based on the compression type
@@ -326,12 +586,22 @@ func getSASLMechanism(cfg *KafkaSASLConfig) (sasl.Mechanism, error) {
 }
 
 // NewKafkaConsumer creates a new high-performance Kafka consumer with compression and SASL support.
-func NewKafkaConsumer(brokers []string, group, topic string, compression KafkaCompressionType, saslCfg *KafkaSASLConfig, tlsCfg *KafkaTLSConfig, offsetReset string, balancer string, msgChan chan map[string]interface{}) (*KafkaConsumer, error) {
+// With atLeastOnce, offsets are only committed once the records are delivered, see SetAtLeastOnce.
+func NewKafkaConsumer(brokers []string, group, topic string, compression KafkaCompressionType, saslCfg *KafkaSASLConfig, tlsCfg *KafkaTLSConfig, offsetReset string, balancer string, msgChan chan map[string]interface{}, atLeastOnce bool) (*KafkaConsumer, error) {
+	cons := &KafkaConsumer{
+		MsgChan:    msgChan,
+		stopChan:   make(chan struct{}),
+		checkpoint: newKafkaCheckpoint(),
+	}
+	cons.atLeastOnce.Store(atLeastOnce)
+
 	opts := []kgo.Opt{
 		kgo.SeedBrokers(brokers...),
 		kgo.ConsumerGroup(group),
 		kgo.ConsumeTopics(topic),
 		kgo.DisableAutoCommit(), // manual commit for perf
+		kgo.OnPartitionsRevoked(cons.onRevoked),
+		kgo.OnPartitionsLost(cons.onLost),
 	}
 
 	// Set offset reset strategy based on configuration
@@ -422,12 +692,9 @@ func NewKafkaConsumer(brokers []string, group, topic string, compression KafkaCo
 		return nil, err
 	}
 
-	cons := &KafkaConsumer{
-		Client:   cl,
-		MsgChan:  msgChan,
-		stopChan: make(chan struct{}),
-	}
+	cons.Client = cl
 	go cons.run()
+	go cons.commitLoop()
 	return cons, nil
 }
 
@@ -462,11 +729,12 @@ func (c *KafkaConsumer) run() {
 				continue // skip errored fetches
 			}
 
+			atLeastOnce := c.atLeastOnce.Load()
+
 			// Process messages immediately when available
 			fetches.EachRecord(func(rec *kgo.Record) {
-				var m map[string]interface{}
-				if err := sonic.Unmarshal(rec.Value, &m); err != nil {
-					logger.Error("[KafkaConsumer] failed to deserialize message", "error", err.Error())
+				m, ok := c.decode(rec, atLeastOnce)
+				if !ok {
 					return
 				}
 
@@ -474,6 +742,11 @@ func (c *KafkaConsumer) run() {
 				// If downstream is full, this will block and prevent further consumption
 				c.MsgChan <- m
 			})
+			if atLeastOnce {
+				// Records still in the pipeline are committed by commitLoop once delivered
+				c.commitCheckpoint(context.Background())
+				continue
+			}
 			// manual commit for batch performance
 			if err := c.Client.CommitUncommittedOffsets(context.Background()); err != nil {
 				logger.Error("[KafkaConsumer] failed to commit offsets", "err", err.Error())
@@ -482,6 +755,28 @@ func (c *KafkaConsumer) run() {
 	}
 }
 
+// decode deserializes a record. In at-least-once mode the event carries the checkpoint token of
+// the record, records that cannot be decoded are checkpointed right away.
+func (c *KafkaConsumer) decode(rec *kgo.Record, atLeastOnce bool) (map[string]interface{}, bool) {
+	var token *DeliveryToken
+	if atLeastOnce {
+		token = c.checkpoint.track(rec)
+	}
+	var m map[string]interface{}
+	if err := sonic.Unmarshal(rec.Value, &m); err != nil {
+		logger.Error("[KafkaConsumer] failed to deserialize message", "error", err.Error())
+		token.Release()
+		return nil, false
+	}
+	if token != nil {
+		if m == nil {
+			m = make(map[string]interface{}, 2)
+		}
+		m[DeliveryTokenField] = token
+	}
+	return m, true
+}
+
 // drainRemainingMessages processes any remaining messages in the Kafka client
 func (c *KafkaConsumer) drainRemainingMessages() {
 	// Set a timeout for draining
@@ -507,10 +802,10 @@ func (c *KafkaConsumer) drainRemainingMessages() {
 				return
 			}
 
+			atLeastOnce := c.atLeastOnce.Load()
 			fetches.EachRecord(func(rec *kgo.Record) {
-				var m map[string]interface{}
-				if err := sonic.Unmarshal(rec.Value, &m); err != nil {
-					logger.Error("[KafkaConsumer] failed to deserialize message during drain", "error", err.Error())
+				m, ok := c.decode(rec, atLeastOnce)
+				if !ok {
 					return
 				}
 
@@ -520,6 +815,7 @@ func (c *KafkaConsumer) drainRemainingMessages() {
 					drainCount++
 				default:
 					logger.Warn("[KafkaConsumer] message channel closed during drain, dropping message")
+					GetDeliveryToken(m).Fail()
 				}
 			})
 
@@ -639,6 +935,16 @@ func getTLSDialOpt(cfg *KafkaTLSConfig) (kgo.Opt, error) {
 		return nil, nil
 	}
 
+	tlsCfg, err := BuildTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return kgo.DialTLSConfig(tlsCfg), nil
+}
+
+// BuildTLSConfig turns file-based TLS settings into a *tls.Config.
+// It is shared by every client that accepts the KafkaTLSConfig block.
+func BuildTLSConfig(cfg *KafkaTLSConfig) (*tls.Config, error) {
 	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.SkipVerify}
 
 	if cfg.CAFilePath != "" {
@@ -661,5 +967,5 @@ func getTLSDialOpt(cfg *KafkaTLSConfig) (kgo.Opt, error) {
 		tlsCfg.Certificates = []tls.Certificate{cert}
 	}
 
-	return kgo.DialTLSConfig(tlsCfg), nil
+	return tlsCfg, nil
 }
@@ -0,0 +1,416 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+// LeakProjectLabel is the pprof label set on goroutines started on behalf of a project.
+// Goroutines inherit it from the goroutine that created them.
+const LeakProjectLabel = "project"
+
+// LeakUnlabeledScope collects goroutines that were not started by a project
+const LeakUnlabeledScope = "_node"
+
+const (
+	defaultLeakInterval        = time.Minute
+	defaultLeakWindow          = 10
+	defaultLeakGoroutineGrowth = 100
+	defaultLeakChannelGrowth   = 500
+	defaultLeakStackSamples    = 5
+	maxLeakWarnings            = 100
+	maxLeakStackBytes          = 4096
+	leakWarningActiveFor       = time.Hour
+)
+
+var leakLabelRegex = regexp.MustCompile(`"` + LeakProjectLabel + `":("(?:[^"\\]|\\.)*")`)
+
+// LeakDetectorConfig controls goroutine and channel growth detection
+type LeakDetectorConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Interval        string `yaml:"interval,omitempty"`         // How often a snapshot is taken, default 1m
+	Window          int    `yaml:"window,omitempty"`           // Consecutive snapshots that must not decrease, default 10
+	GoroutineGrowth int    `yaml:"goroutine_growth,omitempty"` // Minimum goroutine growth over the window, default 100
+	ChannelGrowth   int    `yaml:"channel_growth,omitempty"`   // Minimum growth of queued messages over the window, default 500
+	StackSamples    int    `yaml:"stack_samples,omitempty"`    // Most common stacks attached to a goroutine warning, default 5
+}
+
+// ChannelQueueCollector returns the queued message count of every channel, by project and channel name.
+// It is registered by the project package to avoid circular imports.
+type ChannelQueueCollector func() map[string]map[string]int
+
+// LeakSample is one snapshot of a project
+type LeakSample struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	Queued     int       `json:"queued"`
+}
+
+// LeakStackSample is a goroutine stack and how many goroutines are parked in it
+type LeakStackSample struct {
+	Count int    `json:"count"`
+	Stack string `json:"stack"`
+}
+
+// LeakWarning reports monotonic growth of goroutines or queued messages in one project
+type LeakWarning struct {
+	NodeID     string            `json:"node_id"`
+	ProjectID  string            `json:"project_id"`
+	Kind       string            `json:"kind"` // goroutines or channels
+	From       int               `json:"from"`
+	To         int               `json:"to"`
+	Since      time.Time         `json:"since"`
+	DetectedAt time.Time         `json:"detected_at"`
+	Stacks     []LeakStackSample `json:"stacks,omitempty"`
+	Channels   map[string]int    `json:"channels,omitempty"`
+}
+
+// LeakProjectStatus is the current view of one project
+type LeakProjectStatus struct {
+	ProjectID  string         `json:"project_id"`
+	Goroutines int            `json:"goroutines"`
+	Queued     int            `json:"queued"`
+	Channels   map[string]int `json:"channels,omitempty"`
+	Samples    []LeakSample   `json:"samples"`
+}
+
+// LeakDetector periodically snapshots goroutine counts and channel queues per project
+// and warns when either keeps growing over a full window
+type LeakDetector struct {
+	nodeID          string
+	interval        time.Duration
+	window          int
+	goroutineGrowth int
+	channelGrowth   int
+	stackSamples    int
+
+	mu       sync.Mutex
+	series   map[string][]LeakSample
+	channels map[string]map[string]int
+	warnings []LeakWarning
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GlobalLeakDetector is nil when leak detection is disabled
+var GlobalLeakDetector *LeakDetector
+
+var channelQueueCollector ChannelQueueCollector
+
+// SetChannelQueueCollector sets the global channel queue collector function
+func SetChannelQueueCollector(collector ChannelQueueCollector) {
+	GlobalMu.Lock()
+	defer GlobalMu.Unlock()
+	channelQueueCollector = collector
+}
+
+// NewLeakDetector creates a leak detector from config, falling back to defaults for unset values
+func NewLeakDetector(nodeID string, cfg *LeakDetectorConfig) (*LeakDetector, error) {
+	ld := &LeakDetector{
+		nodeID:          nodeID,
+		interval:        defaultLeakInterval,
+		window:          defaultLeakWindow,
+		goroutineGrowth: defaultLeakGoroutineGrowth,
+		channelGrowth:   defaultLeakChannelGrowth,
+		stackSamples:    defaultLeakStackSamples,
+		series:          make(map[string][]LeakSample),
+		channels:        make(map[string]map[string]int),
+		stopChan:        make(chan struct{}),
+	}
+	if cfg != nil {
+		if cfg.Interval != "" {
+			d, err := time.ParseDuration(cfg.Interval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid leak detector interval %q", cfg.Interval)
+			}
+			ld.interval = d
+		}
+		if cfg.Window > 0 {
+			if cfg.Window < 2 {
+				return nil, fmt.Errorf("leak detector window must be at least 2")
+			}
+			ld.window = cfg.Window
+		}
+		if cfg.GoroutineGrowth > 0 {
+			ld.goroutineGrowth = cfg.GoroutineGrowth
+		}
+		if cfg.ChannelGrowth > 0 {
+			ld.channelGrowth = cfg.ChannelGrowth
+		}
+		if cfg.StackSamples > 0 {
+			ld.stackSamples = cfg.StackSamples
+		}
+	}
+	return ld, nil
+}
+
+// InitLeakDetector initializes and starts the global leak detector if enabled in config
+func InitLeakDetector(nodeID string, cfg *LeakDetectorConfig) {
+	if cfg == nil || !cfg.Enabled || GlobalLeakDetector != nil {
+		return
+	}
+	ld, err := NewLeakDetector(nodeID, cfg)
+	if err != nil {
+		logger.Error("Failed to initialize leak detector", "error", err)
+		return
+	}
+	GlobalLeakDetector = ld
+	ld.Start()
+}
+
+// StopLeakDetector stops the global leak detector
+func StopLeakDetector() {
+	if GlobalLeakDetector != nil {
+		GlobalLeakDetector.Stop()
+		GlobalLeakDetector = nil
+	}
+}
+
+// Start begins periodic snapshots
+func (ld *LeakDetector) Start() {
+	ld.wg.Add(1)
+	go func() {
+		defer ld.wg.Done()
+		ticker := time.NewTicker(ld.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ld.stopChan:
+				return
+			case <-ticker.C:
+				ld.Snapshot()
+			}
+		}
+	}()
+	logger.Info("Leak detector started", "node_id", ld.nodeID, "interval", ld.interval, "window", ld.window)
+}
+
+// Stop stops periodic snapshots
+func (ld *LeakDetector) Stop() {
+	close(ld.stopChan)
+	ld.wg.Wait()
+}
+
+// Snapshot records one sample for every project and checks for growth
+func (ld *LeakDetector) Snapshot() {
+	goroutines, stacks := goroutinesByProject(ld.stackSamples)
+
+	GlobalMu.RLock()
+	collector := channelQueueCollector
+	GlobalMu.RUnlock()
+	var queues map[string]map[string]int
+	if collector != nil {
+		queues = collector()
+	}
+
+	now := time.Now()
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	scopes := make(map[string]bool, len(goroutines)+len(queues))
+	for scope := range goroutines {
+		scopes[scope] = true
+	}
+	for scope := range queues {
+		scopes[scope] = true
+	}
+	// Forget projects that are gone
+	for scope := range ld.series {
+		if !scopes[scope] {
+			delete(ld.series, scope)
+			delete(ld.channels, scope)
+		}
+	}
+
+	for scope := range scopes {
+		sample := LeakSample{Time: now, Goroutines: goroutines[scope]}
+		for _, n := range queues[scope] {
+			sample.Queued += n
+		}
+		series := append(ld.series[scope], sample)
+		if len(series) > ld.window {
+			series = series[len(series)-ld.window:]
+		}
+		ld.series[scope] = series
+		ld.channels[scope] = queues[scope]
+
+		if from, ok := ld.growth(series, func(s LeakSample) int { return s.Goroutines }, ld.goroutineGrowth); ok {
+			ld.warn(LeakWarning{
+				NodeID:     ld.nodeID,
+				ProjectID:  scope,
+				Kind:       "goroutines",
+				From:       from.Goroutines,
+				To:         sample.Goroutines,
+				Since:      from.Time,
+				DetectedAt: now,
+				Stacks:     stacks[scope],
+			})
+			ld.series[scope] = series[len(series)-1:]
+			continue
+		}
+		if from, ok := ld.growth(series, func(s LeakSample) int { return s.Queued }, ld.channelGrowth); ok {
+			ld.warn(LeakWarning{
+				NodeID:     ld.nodeID,
+				ProjectID:  scope,
+				Kind:       "channels",
+				From:       from.Queued,
+				To:         sample.Queued,
+				Since:      from.Time,
+				DetectedAt: now,
+				Channels:   queues[scope],
+			})
+			// Start a new window so the same growth is reported once
+			ld.series[scope] = series[len(series)-1:]
+		}
+	}
+}
+
+// growth reports whether value never decreased over a full window and grew by at least threshold
+func (ld *LeakDetector) growth(series []LeakSample, value func(LeakSample) int, threshold int) (LeakSample, bool) {
+	if len(series) < ld.window {
+		return LeakSample{}, false
+	}
+	for i := 1; i < len(series); i++ {
+		if value(series[i]) < value(series[i-1]) {
+			return LeakSample{}, false
+		}
+	}
+	return series[0], value(series[len(series)-1])-value(series[0]) >= threshold
+}
+
+func (ld *LeakDetector) warn(w LeakWarning) {
+	ld.warnings = append(ld.warnings, w)
+	if len(ld.warnings) > maxLeakWarnings {
+		ld.warnings = ld.warnings[len(ld.warnings)-maxLeakWarnings:]
+	}
+	args := []interface{}{"project", w.ProjectID, "kind", w.Kind, "from", w.From, "to", w.To, "since", w.Since.Format(time.RFC3339)}
+	if len(w.Stacks) > 0 {
+		args = append(args, "top_stack_count", w.Stacks[0].Count, "top_stack", w.Stacks[0].Stack)
+	}
+	logger.Warn("Possible leak detected: monotonic growth over the detection window", args...)
+}
+
+// Status returns the current samples of every project, sorted by project ID
+func (ld *LeakDetector) Status() []LeakProjectStatus {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	result := make([]LeakProjectStatus, 0, len(ld.series))
+	for scope, series := range ld.series {
+		status := LeakProjectStatus{ProjectID: scope, Samples: append([]LeakSample(nil), series...), Channels: ld.channels[scope]}
+		if len(series) > 0 {
+			status.Goroutines = series[len(series)-1].Goroutines
+			status.Queued = series[len(series)-1].Queued
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ProjectID < result[j].ProjectID })
+	return result
+}
+
+// Warnings returns the recorded warnings, newest first
+func (ld *LeakDetector) Warnings() []LeakWarning {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	result := make([]LeakWarning, len(ld.warnings))
+	for i, w := range ld.warnings {
+		result[len(result)-1-i] = w
+	}
+	return result
+}
+
+// GetActiveLeakWarnings returns the warnings of the last hour without stack samples, for heartbeats
+func GetActiveLeakWarnings() []LeakWarning {
+	ld := GlobalLeakDetector
+	if ld == nil {
+		return nil
+	}
+	var active []LeakWarning
+	cutoff := time.Now().Add(-leakWarningActiveFor)
+	for _, w := range ld.Warnings() {
+		if w.DetectedAt.Before(cutoff) {
+			break
+		}
+		w.Stacks = nil
+		active = append(active, w)
+	}
+	return active
+}
+
+// goroutinesByProject counts goroutines by project label and returns the most common stacks of each project
+func goroutinesByProject(stackSamples int) (map[string]int, map[string][]LeakStackSample) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		logger.Error("Failed to read goroutine profile", "error", err)
+		return map[string]int{LeakUnlabeledScope: runtime.NumGoroutine()}, nil
+	}
+
+	counts := make(map[string]int)
+	stacks := make(map[string][]LeakStackSample)
+	var (
+		count   int
+		scope   string
+		frames  []string
+		inGroup bool
+	)
+	flush := func() {
+		if !inGroup {
+			return
+		}
+		counts[scope] += count
+		stack := strings.Join(frames, "\n")
+		if len(stack) > maxLeakStackBytes {
+			stack = stack[:maxLeakStackBytes]
+		}
+		stacks[scope] = append(stacks[scope], LeakStackSample{Count: count, Stack: stack})
+		inGroup = false
+	}
+
+	// Records look like "N @ 0x... 0x...", an optional "# labels: {...}" line and "#\t0x...\tfunc+0x..\tfile:line" frames
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# labels:"):
+			if m := leakLabelRegex.FindStringSubmatch(line); m != nil {
+				if project, err := strconv.Unquote(m[1]); err == nil {
+					scope = project
+				}
+			}
+		case strings.HasPrefix(line, "#\t"):
+			fields := strings.Split(strings.TrimPrefix(line, "#\t"), "\t")
+			if len(fields) >= 3 {
+				frames = append(frames, fields[1]+" "+strings.TrimSpace(fields[2]))
+			}
+		case strings.Contains(line, " @ "):
+			flush()
+			n, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(line, " @ ", 2)[0]))
+			if err != nil {
+				continue
+			}
+			count, scope, frames, inGroup = n, LeakUnlabeledScope, nil, true
+		}
+	}
+	flush()
+
+	for scope, samples := range stacks {
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].Count > samples[j].Count })
+		if len(samples) > stackSamples {
+			samples = samples[:stackSamples]
+		}
+		stacks[scope] = samples
+	}
+	return counts, stacks
+}
@@ -0,0 +1,1617 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Lite mode replaces the Redis server with an in-process store for single node deployments.
+// The store speaks the subset of RESP used by the hub, so the go-redis client and every
+// helper built on it keep working unchanged; the client simply dials an in-memory pipe.
+// The keyspace is persisted to a bbolt file so intentions, stats and cursors survive restarts:
+// keys changed since the last flush are written in one transaction every few seconds.
+
+const (
+	liteTypeString = "string"
+	liteTypeHash   = "hash"
+	liteTypeList   = "list"
+	liteTypeSet    = "set"
+	liteTypeZSet   = "zset"
+
+	liteFlushInterval = 5 * time.Second
+)
+
+var liteBucket = []byte("keys")
+
+var liteStoreInstance *liteStore
+
+type liteEntry struct {
+	Type     string             `json:"type"`
+	Str      string             `json:"str,omitempty"`
+	Hash     map[string]string  `json:"hash,omitempty"`
+	List     []string           `json:"list,omitempty"`
+	Set      map[string]bool    `json:"set,omitempty"`
+	ZSet     map[string]float64 `json:"zset,omitempty"`
+	ExpireAt int64              `json:"expire_at,omitempty"` // unix milliseconds, 0 means no expiration
+}
+
+type liteStore struct {
+	mu      sync.Mutex
+	data    map[string]*liteEntry
+	path    string
+	db      *bolt.DB
+	changed map[string]bool // keys to write or delete on the next flush
+
+	subMu sync.Mutex
+	subs  map[string]map[*liteConn]bool
+
+	started     time.Time
+	clients     int64
+	connections int64
+	commands    int64
+	expired     int64
+	hits        int64
+	misses      int64
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// reply values written back to the client
+type liteStatus string
+type liteError string
+type liteNoReply struct{}
+
+var (
+	liteOK        = liteStatus("OK")
+	liteWrongType = liteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	liteNotInt    = liteError("ERR value is not an integer or out of range")
+	liteSyntax    = liteError("ERR syntax error")
+)
+
+// liteReadOnly lists the commands that never modify the keyspace
+var liteReadOnly = map[string]bool{
+	"GET": true, "EXISTS": true, "TTL": true, "PTTL": true, "TYPE": true, "KEYS": true, "SCAN": true, "DBSIZE": true,
+	"HGET": true, "HGETALL": true, "HLEN": true, "LRANGE": true, "LLEN": true, "SMEMBERS": true, "SCARD": true,
+	"ZRANGE": true, "ZREVRANGE": true, "ZCARD": true, "INFO": true,
+	"ZCOUNT": true, "ZRANGEBYSCORE": true, "ZREVRANGEBYSCORE": true, "ZSCORE": true,
+}
+
+func newLiteStore(path string) (*liteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lite store %s: %w", path, err)
+	}
+	s := &liteStore{
+		data:    make(map[string]*liteEntry),
+		path:    path,
+		db:      db,
+		changed: make(map[string]bool),
+		subs:    make(map[string]map[*liteConn]bool),
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s, nil
+}
+
+func (s *liteStore) load() error {
+	now := time.Now().UnixMilli()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(liteBucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			key := string(k)
+			e := &liteEntry{}
+			if err := sonic.Unmarshal(v, e); err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			// locks were held by the previous process, which was the only node
+			if (e.ExpireAt > 0 && e.ExpireAt <= now) || strings.HasPrefix(key, "lock:") || strings.HasSuffix(key, ":lock") {
+				s.changed[key] = true
+				return nil
+			}
+			s.data[key] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load lite store %s: %w", s.path, err)
+	}
+	logger.Info("Lite store loaded", "path", s.path, "keys", len(s.data))
+	return nil
+}
+
+// markChanged records keys to persist on the next flush, the caller must hold s.mu
+func (s *liteStore) markChanged(keys ...string) {
+	for _, k := range keys {
+		s.changed[k] = true
+	}
+}
+
+// save writes the keys changed since the last flush in one transaction
+func (s *liteStore) save() error {
+	s.mu.Lock()
+	if len(s.changed) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	// a nil value deletes the key
+	writes := make(map[string][]byte, len(s.changed))
+	for k := range s.changed {
+		e := s.data[k]
+		if e == nil {
+			writes[k] = nil
+			continue
+		}
+		raw, err := sonic.Marshal(e)
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to encode lite store key %s: %w", k, err)
+		}
+		writes[k] = raw
+	}
+	s.changed = make(map[string]bool)
+	s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(liteBucket)
+		for k, v := range writes {
+			var err error
+			if v == nil {
+				err = b.Delete([]byte(k))
+			} else {
+				err = b.Put([]byte(k), v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.mu.Lock()
+		for k := range writes {
+			s.changed[k] = true
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to write lite store %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *liteStore) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(liteFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sweepExpired()
+			if err := s.save(); err != nil {
+				logger.Error("Lite store flush failed", "error", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *liteStore) sweepExpired() {
+	now := time.Now().UnixMilli()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.data {
+		if e.ExpireAt > 0 && e.ExpireAt <= now {
+			delete(s.data, k)
+			s.expired++
+			s.changed[k] = true
+		}
+	}
+}
+
+func (s *liteStore) close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		err = s.save()
+		if cerr := s.db.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// dial returns the client end of a new in-memory connection
+func (s *liteStore) dial(_ context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	c := &liteConn{
+		store:    s,
+		conn:     server,
+		r:        bufio.NewReader(server),
+		channels: make(map[string]bool),
+	}
+	c.outCond = sync.NewCond(&c.outMu)
+	atomic.AddInt64(&s.clients, 1)
+	atomic.AddInt64(&s.connections, 1)
+	go c.writeLoop()
+	go c.serve()
+	return client, nil
+}
+
+// CloseLiteStore flushes the lite mode store to disk and closes it. It is a no-op when lite mode is not in use.
+func CloseLiteStore() {
+	if liteStoreInstance == nil {
+		return
+	}
+	if err := liteStoreInstance.close(); err != nil {
+		logger.Error("Failed to flush lite store", "error", err)
+		return
+	}
+	logger.Info("Lite store flushed", "path", liteStoreInstance.path)
+}
+
+// ===================== Connection handling =====================
+
+type liteConn struct {
+	store *liteStore
+	conn  net.Conn
+	r     *bufio.Reader
+
+	// replies are queued and written by a separate goroutine, as net.Pipe is unbuffered
+	// and a pipelined client only starts reading once its whole batch is written
+	outMu   sync.Mutex
+	outCond *sync.Cond
+	out     [][]byte
+	closed  bool
+
+	multi    bool
+	queued   [][]string
+	channels map[string]bool
+}
+
+func (c *liteConn) serve() {
+	defer c.shutdown()
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := c.handle(args)
+		if _, ok := reply.(liteNoReply); !ok {
+			c.send(reply)
+		}
+		if strings.EqualFold(args[0], "QUIT") {
+			return
+		}
+	}
+}
+
+func (c *liteConn) shutdown() {
+	c.store.unsubscribeAll(c)
+	c.outMu.Lock()
+	c.closed = true
+	c.outCond.Signal()
+	c.outMu.Unlock()
+	atomic.AddInt64(&c.store.clients, -1)
+}
+
+func (c *liteConn) send(reply interface{}) {
+	buf := appendLiteReply(nil, reply)
+	c.outMu.Lock()
+	if !c.closed {
+		c.out = append(c.out, buf)
+		c.outCond.Signal()
+	}
+	c.outMu.Unlock()
+}
+
+func (c *liteConn) writeLoop() {
+	defer c.conn.Close()
+	for {
+		c.outMu.Lock()
+		for len(c.out) == 0 && !c.closed {
+			c.outCond.Wait()
+		}
+		batch := c.out
+		c.out = nil
+		closed := c.closed
+		c.outMu.Unlock()
+
+		for _, b := range batch {
+			if _, err := c.conn.Write(b); err != nil {
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// readCommand reads one RESP array of bulk strings, falling back to inline commands
+func (c *liteConn) readCommand() ([]string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid multibulk length %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		hdr, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if hdr == "" || hdr[0] != '$' {
+			return nil, fmt.Errorf("expected bulk string, got %q", hdr)
+		}
+		size, err := strconv.Atoi(hdr[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk length %q", hdr)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func (c *liteConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *liteConn) handle(args []string) interface{} {
+	s := c.store
+	name := strings.ToUpper(args[0])
+	atomic.AddInt64(&s.commands, 1)
+
+	if c.multi {
+		switch name {
+		case "MULTI":
+			return liteError("ERR MULTI calls can not be nested")
+		case "EXEC", "DISCARD":
+		default:
+			c.queued = append(c.queued, args)
+			return liteStatus("QUEUED")
+		}
+	}
+
+	switch name {
+	case "PING":
+		if len(args) > 1 {
+			return args[1]
+		}
+		return liteStatus("PONG")
+	case "HELLO":
+		// answering with an error makes go-redis fall back to RESP2
+		return liteError("ERR unknown command 'HELLO'")
+	case "CLIENT", "SELECT", "AUTH", "READONLY", "QUIT":
+		return liteOK
+	case "MULTI":
+		c.multi, c.queued = true, nil
+		return liteOK
+	case "DISCARD":
+		if !c.multi {
+			return liteError("ERR DISCARD without MULTI")
+		}
+		c.multi, c.queued = false, nil
+		return liteOK
+	case "EXEC":
+		if !c.multi {
+			return liteError("ERR EXEC without MULTI")
+		}
+		queued := c.queued
+		c.multi, c.queued = false, nil
+		replies := make([]interface{}, 0, len(queued))
+		s.mu.Lock()
+		for _, q := range queued {
+			replies = append(replies, s.exec(strings.ToUpper(q[0]), q))
+		}
+		s.mu.Unlock()
+		return replies
+	case "SUBSCRIBE":
+		for _, ch := range args[1:] {
+			s.subscribe(c, ch)
+			c.send([]interface{}{"subscribe", ch, int64(len(c.channels))})
+		}
+		return liteNoReply{}
+	case "UNSUBSCRIBE":
+		channels := args[1:]
+		if len(channels) == 0 {
+			for ch := range c.channels {
+				channels = append(channels, ch)
+			}
+		}
+		for _, ch := range channels {
+			s.unsubscribe(c, ch)
+			c.send([]interface{}{"unsubscribe", ch, int64(len(c.channels))})
+		}
+		return liteNoReply{}
+	case "PUBLISH":
+		if len(args) != 3 {
+			return liteArity(name)
+		}
+		return s.publish(args[1], args[2])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exec(name, args)
+}
+
+func (s *liteStore) subscribe(c *liteConn, channel string) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	if s.subs[channel] == nil {
+		s.subs[channel] = make(map[*liteConn]bool)
+	}
+	s.subs[channel][c] = true
+	c.channels[channel] = true
+}
+
+func (s *liteStore) unsubscribe(c *liteConn, channel string) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	delete(s.subs[channel], c)
+	if len(s.subs[channel]) == 0 {
+		delete(s.subs, channel)
+	}
+	delete(c.channels, channel)
+}
+
+func (s *liteStore) unsubscribeAll(c *liteConn) {
+	for ch := range c.channels {
+		s.unsubscribe(c, ch)
+	}
+}
+
+func (s *liteStore) publish(channel, message string) int64 {
+	s.subMu.Lock()
+	receivers := make([]*liteConn, 0, len(s.subs[channel]))
+	for c := range s.subs[channel] {
+		receivers = append(receivers, c)
+	}
+	s.subMu.Unlock()
+
+	for _, c := range receivers {
+		c.send([]interface{}{"message", channel, message})
+	}
+	return int64(len(receivers))
+}
+
+// ===================== Commands =====================
+
+// exec runs a keyspace command, the caller must hold s.mu
+func (s *liteStore) exec(name string, args []string) interface{} {
+	if !liteReadOnly[name] {
+		s.markChanged(liteWrittenKeys(name, args)...)
+	}
+	switch name {
+	case "GET":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+		e, errReply := s.lookup(args[1], liteTypeString)
+		if errReply != nil {
+			return errReply
+		}
+		if e == nil {
+			s.misses++
+			return nil
+		}
+		s.hits++
+		return e.Str
+	case "SET":
+		return s.cmdStringSet(args)
+	case "SETNX":
+		if len(args) != 3 {
+			return liteArity(name)
+		}
+		if s.exists(args[1]) {
+			return int64(0)
+		}
+		s.data[args[1]] = &liteEntry{Type: liteTypeString, Str: args[2]}
+		return int64(1)
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		return s.cmdIncr(name, args)
+	case "DEL", "UNLINK":
+		var n int64
+		for _, k := range args[1:] {
+			if s.exists(k) {
+				delete(s.data, k)
+				n++
+			}
+		}
+		return n
+	case "EXISTS":
+		var n int64
+		for _, k := range args[1:] {
+			if s.exists(k) {
+				n++
+			}
+		}
+		return n
+	case "TYPE":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+		if e := s.entry(args[1]); e != nil {
+			return liteStatus(e.Type)
+		}
+		return liteStatus("none")
+	case "EXPIRE", "PEXPIRE":
+		if len(args) < 3 {
+			return liteArity(name)
+		}
+		d, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return liteNotInt
+		}
+		e := s.entry(args[1])
+		if e == nil {
+			return int64(0)
+		}
+		if name == "EXPIRE" {
+			d *= 1000
+		}
+		if d <= 0 {
+			delete(s.data, args[1])
+		} else {
+			e.ExpireAt = time.Now().UnixMilli() + d
+		}
+		return int64(1)
+	case "PERSIST":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+		if e := s.entry(args[1]); e != nil && e.ExpireAt > 0 {
+			e.ExpireAt = 0
+			return int64(1)
+		}
+		return int64(0)
+	case "TTL", "PTTL":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+		e := s.entry(args[1])
+		if e == nil {
+			return int64(-2)
+		}
+		if e.ExpireAt == 0 {
+			return int64(-1)
+		}
+		ms := e.ExpireAt - time.Now().UnixMilli()
+		if name == "TTL" {
+			return (ms + 999) / 1000
+		}
+		return ms
+	case "KEYS":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+		return s.matchKeys(args[1], "")
+	case "SCAN":
+		return s.cmdScan(args)
+	case "DBSIZE":
+		return int64(len(s.data))
+	case "HSET", "HMSET", "HGET", "HGETALL", "HDEL", "HLEN", "HINCRBY":
+		return s.cmdHash(name, args)
+	case "LPUSH", "RPUSH", "LTRIM", "LRANGE", "LLEN":
+		return s.cmdList(name, args)
+	case "SADD", "SREM", "SMEMBERS", "SCARD":
+		return s.cmdSetMembers(name, args)
+	case "ZADD", "ZRANGE", "ZREVRANGE", "ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZCOUNT", "ZCARD",
+		"ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZINCRBY", "ZSCORE":
+		return s.cmdZSet(name, args)
+	case "EVAL", "EVALSHA":
+		return s.cmdEval(name, args)
+	case "SCRIPT":
+		return s.cmdScript(args)
+	case "INFO":
+		return s.info()
+	}
+	return liteError(fmt.Sprintf("ERR unknown command '%s' in lite mode", strings.ToLower(name)))
+}
+
+func liteArity(name string) liteError {
+	return liteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// entry returns a live key of any type, dropping it when expired
+func (s *liteStore) entry(key string) *liteEntry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if e.ExpireAt > 0 && e.ExpireAt <= time.Now().UnixMilli() {
+		delete(s.data, key)
+		s.expired++
+		s.changed[key] = true
+		return nil
+	}
+	return e
+}
+
+func (s *liteStore) exists(key string) bool {
+	return s.entry(key) != nil
+}
+
+// lookup returns the key if it holds the given type; missing keys return nil without error
+func (s *liteStore) lookup(key, typ string) (*liteEntry, interface{}) {
+	e := s.entry(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != typ {
+		return nil, liteWrongType
+	}
+	return e, nil
+}
+
+// create returns the key, creating an empty value of the given type when missing
+func (s *liteStore) create(key, typ string) (*liteEntry, interface{}) {
+	e, errReply := s.lookup(key, typ)
+	if errReply != nil || e != nil {
+		return e, errReply
+	}
+	e = &liteEntry{Type: typ}
+	switch typ {
+	case liteTypeHash:
+		e.Hash = make(map[string]string)
+	case liteTypeSet:
+		e.Set = make(map[string]bool)
+	case liteTypeZSet:
+		e.ZSet = make(map[string]float64)
+	}
+	s.data[key] = e
+	return e, nil
+}
+
+func (s *liteStore) cmdStringSet(args []string) interface{} {
+	if len(args) < 3 {
+		return liteArity("SET")
+	}
+	var expireAt int64
+	var nx, xx, keepTTL bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return liteSyntax
+			}
+			d, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || d <= 0 {
+				return liteError("ERR invalid expire time in 'set' command")
+			}
+			if strings.EqualFold(args[i], "EX") {
+				d *= 1000
+			}
+			expireAt = time.Now().UnixMilli() + d
+			i++
+		default:
+			return liteSyntax
+		}
+	}
+
+	old := s.entry(args[1])
+	if (nx && old != nil) || (xx && old == nil) {
+		return nil
+	}
+	e := &liteEntry{Type: liteTypeString, Str: args[2], ExpireAt: expireAt}
+	if keepTTL && old != nil {
+		e.ExpireAt = old.ExpireAt
+	}
+	s.data[args[1]] = e
+	return liteOK
+}
+
+func (s *liteStore) cmdIncr(name string, args []string) interface{} {
+	delta := int64(1)
+	switch name {
+	case "INCR", "DECR":
+		if len(args) != 2 {
+			return liteArity(name)
+		}
+	default:
+		if len(args) != 3 {
+			return liteArity(name)
+		}
+		d, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return liteNotInt
+		}
+		delta = d
+	}
+	if name == "DECR" || name == "DECRBY" {
+		delta = -delta
+	}
+
+	e, errReply := s.create(args[1], liteTypeString)
+	if errReply != nil {
+		return errReply
+	}
+	var cur int64
+	if e.Str != "" {
+		v, err := strconv.ParseInt(e.Str, 10, 64)
+		if err != nil {
+			return liteNotInt
+		}
+		cur = v
+	}
+	cur += delta
+	e.Str = strconv.FormatInt(cur, 10)
+	return cur
+}
+
+func (s *liteStore) cmdScan(args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity("SCAN")
+	}
+	pattern, typ := "*", ""
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "TYPE":
+			typ = strings.ToLower(args[i+1])
+		case "COUNT":
+		default:
+			return liteSyntax
+		}
+	}
+	// the whole keyspace is returned at once, so the cursor always finishes
+	return []interface{}{"0", s.matchKeys(pattern, typ)}
+}
+
+func (s *liteStore) matchKeys(pattern, typ string) []interface{} {
+	keys := make([]interface{}, 0)
+	for k := range s.data {
+		e := s.entry(k)
+		if e == nil || (typ != "" && e.Type != typ) {
+			continue
+		}
+		if liteMatch(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *liteStore) cmdHash(name string, args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity(name)
+	}
+	key := args[1]
+	switch name {
+	case "HSET", "HMSET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return liteArity(name)
+		}
+		e, errReply := s.create(key, liteTypeHash)
+		if errReply != nil {
+			return errReply
+		}
+		var added int64
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := e.Hash[args[i]]; !ok {
+				added++
+			}
+			e.Hash[args[i]] = args[i+1]
+		}
+		if name == "HMSET" {
+			return liteOK
+		}
+		return added
+	case "HINCRBY":
+		if len(args) != 4 {
+			return liteArity(name)
+		}
+		delta, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return liteNotInt
+		}
+		e, errReply := s.create(key, liteTypeHash)
+		if errReply != nil {
+			return errReply
+		}
+		var cur int64
+		if v, ok := e.Hash[args[2]]; ok {
+			if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return liteError("ERR hash value is not an integer")
+			}
+		}
+		cur += delta
+		e.Hash[args[2]] = strconv.FormatInt(cur, 10)
+		return cur
+	}
+
+	e, errReply := s.lookup(key, liteTypeHash)
+	if errReply != nil {
+		return errReply
+	}
+	switch name {
+	case "HGET":
+		if len(args) != 3 {
+			return liteArity(name)
+		}
+		if e == nil {
+			return nil
+		}
+		if v, ok := e.Hash[args[2]]; ok {
+			return v
+		}
+		return nil
+	case "HGETALL":
+		res := make([]interface{}, 0)
+		if e != nil {
+			for f, v := range e.Hash {
+				res = append(res, f, v)
+			}
+		}
+		return res
+	case "HLEN":
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.Hash))
+	case "HDEL":
+		var n int64
+		if e != nil {
+			for _, f := range args[2:] {
+				if _, ok := e.Hash[f]; ok {
+					delete(e.Hash, f)
+					n++
+				}
+			}
+			if len(e.Hash) == 0 {
+				delete(s.data, key)
+			}
+		}
+		return n
+	}
+	return nil
+}
+
+func (s *liteStore) cmdList(name string, args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity(name)
+	}
+	key := args[1]
+	switch name {
+	case "LPUSH", "RPUSH":
+		if len(args) < 3 {
+			return liteArity(name)
+		}
+		e, errReply := s.create(key, liteTypeList)
+		if errReply != nil {
+			return errReply
+		}
+		for _, v := range args[2:] {
+			if name == "LPUSH" {
+				e.List = append([]string{v}, e.List...)
+			} else {
+				e.List = append(e.List, v)
+			}
+		}
+		return int64(len(e.List))
+	}
+
+	e, errReply := s.lookup(key, liteTypeList)
+	if errReply != nil {
+		return errReply
+	}
+	switch name {
+	case "LLEN":
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.List))
+	case "LRANGE", "LTRIM":
+		if len(args) != 4 {
+			return liteArity(name)
+		}
+		start, err1 := strconv.Atoi(args[2])
+		stop, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			return liteNotInt
+		}
+		var list []string
+		if e != nil {
+			list = e.List
+		}
+		from, to, ok := liteRange(start, stop, len(list))
+		if name == "LTRIM" {
+			if e != nil {
+				if !ok {
+					delete(s.data, key)
+				} else {
+					e.List = append([]string(nil), list[from:to+1]...)
+				}
+			}
+			return liteOK
+		}
+		res := make([]interface{}, 0)
+		if ok {
+			for _, v := range list[from : to+1] {
+				res = append(res, v)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func (s *liteStore) cmdSetMembers(name string, args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity(name)
+	}
+	key := args[1]
+	if name == "SADD" {
+		if len(args) < 3 {
+			return liteArity(name)
+		}
+		e, errReply := s.create(key, liteTypeSet)
+		if errReply != nil {
+			return errReply
+		}
+		var n int64
+		for _, m := range args[2:] {
+			if !e.Set[m] {
+				e.Set[m] = true
+				n++
+			}
+		}
+		return n
+	}
+
+	e, errReply := s.lookup(key, liteTypeSet)
+	if errReply != nil {
+		return errReply
+	}
+	switch name {
+	case "SREM":
+		var n int64
+		if e != nil {
+			for _, m := range args[2:] {
+				if e.Set[m] {
+					delete(e.Set, m)
+					n++
+				}
+			}
+			if len(e.Set) == 0 {
+				delete(s.data, key)
+			}
+		}
+		return n
+	case "SMEMBERS":
+		res := make([]interface{}, 0)
+		if e != nil {
+			for m := range e.Set {
+				res = append(res, m)
+			}
+		}
+		return res
+	case "SCARD":
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.Set))
+	}
+	return nil
+}
+
+type liteZMember struct {
+	member string
+	score  float64
+}
+
+// sortedZSet orders members by score, then lexicographically like Redis
+func sortedZSet(e *liteEntry) []liteZMember {
+	if e == nil {
+		return nil
+	}
+	members := make([]liteZMember, 0, len(e.ZSet))
+	for m, sc := range e.ZSet {
+		members = append(members, liteZMember{m, sc})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func (s *liteStore) cmdZSet(name string, args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity(name)
+	}
+	key := args[1]
+	if name == "ZADD" {
+		if len(args) < 4 || len(args)%2 != 0 {
+			return liteArity(name)
+		}
+		e, errReply := s.create(key, liteTypeZSet)
+		if errReply != nil {
+			return errReply
+		}
+		var added int64
+		for i := 2; i+1 < len(args); i += 2 {
+			sc, err := parseLiteScore(args[i])
+			if err != nil {
+				return liteError("ERR value is not a valid float")
+			}
+			if _, ok := e.ZSet[args[i+1]]; !ok {
+				added++
+			}
+			e.ZSet[args[i+1]] = sc
+		}
+		return added
+	}
+	if name == "ZINCRBY" {
+		if len(args) != 4 {
+			return liteArity(name)
+		}
+		incr, err := parseLiteScore(args[2])
+		if err != nil {
+			return liteError("ERR value is not a valid float")
+		}
+		e, errReply := s.create(key, liteTypeZSet)
+		if errReply != nil {
+			return errReply
+		}
+		e.ZSet[args[3]] += incr
+		return strconv.FormatFloat(e.ZSet[args[3]], 'g', -1, 64)
+	}
+
+	e, errReply := s.lookup(key, liteTypeZSet)
+	if errReply != nil {
+		return errReply
+	}
+	switch name {
+	case "ZSCORE":
+		if len(args) != 3 {
+			return liteArity(name)
+		}
+		if e == nil {
+			return nil
+		}
+		sc, ok := e.ZSet[args[2]]
+		if !ok {
+			return nil
+		}
+		return strconv.FormatFloat(sc, 'g', -1, 64)
+	case "ZCARD":
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.ZSet))
+	case "ZRANGE", "ZREVRANGE", "ZREMRANGEBYRANK":
+		if len(args) < 4 {
+			return liteArity(name)
+		}
+		start, err1 := strconv.Atoi(args[2])
+		stop, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			return liteNotInt
+		}
+		members := sortedZSet(e)
+		if name == "ZREVRANGE" {
+			for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+				members[i], members[j] = members[j], members[i]
+			}
+		}
+		from, to, ok := liteRange(start, stop, len(members))
+		if name == "ZREMRANGEBYRANK" {
+			if !ok {
+				return int64(0)
+			}
+			for _, m := range members[from : to+1] {
+				delete(e.ZSet, m.member)
+			}
+			if len(e.ZSet) == 0 {
+				delete(s.data, key)
+			}
+			return int64(to - from + 1)
+		}
+		withScores := len(args) > 4 && strings.EqualFold(args[4], "WITHSCORES")
+		res := make([]interface{}, 0)
+		if ok {
+			for _, m := range members[from : to+1] {
+				res = append(res, m.member)
+				if withScores {
+					res = append(res, strconv.FormatFloat(m.score, 'g', -1, 64))
+				}
+			}
+		}
+		return res
+	case "ZRANGEBYSCORE", "ZREVRANGEBYSCORE":
+		return liteZRangeByScore(name, e, args)
+	case "ZREMRANGEBYSCORE", "ZCOUNT":
+		if len(args) != 4 {
+			return liteArity(name)
+		}
+		minScore, minExcl, err1 := parseLiteScoreBound(args[2])
+		maxScore, maxExcl, err2 := parseLiteScoreBound(args[3])
+		if err1 != nil || err2 != nil {
+			return liteError("ERR min or max is not a float")
+		}
+		var n int64
+		if e != nil {
+			for m, sc := range e.ZSet {
+				if (sc > minScore || (!minExcl && sc == minScore)) && (sc < maxScore || (!maxExcl && sc == maxScore)) {
+					if name == "ZREMRANGEBYSCORE" {
+						delete(e.ZSet, m)
+					}
+					n++
+				}
+			}
+			if len(e.ZSet) == 0 {
+				delete(s.data, key)
+			}
+		}
+		return n
+	}
+	return nil
+}
+
+// liteZRangeByScore serves ZRANGEBYSCORE key min max and ZREVRANGEBYSCORE key max min,
+// both with optional WITHSCORES and LIMIT offset count
+func liteZRangeByScore(name string, e *liteEntry, args []string) interface{} {
+	if len(args) < 4 {
+		return liteArity(name)
+	}
+	lo, hi := args[2], args[3]
+	if name == "ZREVRANGEBYSCORE" {
+		lo, hi = hi, lo
+	}
+	minScore, minExcl, err1 := parseLiteScoreBound(lo)
+	maxScore, maxExcl, err2 := parseLiteScoreBound(hi)
+	if err1 != nil || err2 != nil {
+		return liteError("ERR min or max is not a float")
+	}
+
+	withScores := false
+	offset, count := 0, -1
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return liteSyntax
+			}
+			var err error
+			if offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return liteNotInt
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil {
+				return liteNotInt
+			}
+			i += 2
+		default:
+			return liteSyntax
+		}
+	}
+
+	res := make([]interface{}, 0)
+	if e == nil || offset < 0 {
+		return res
+	}
+	members := sortedZSet(e)
+	if name == "ZREVRANGEBYSCORE" {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	for _, m := range members {
+		if (m.score < minScore || (minExcl && m.score == minScore)) || (m.score > maxScore || (maxExcl && m.score == maxScore)) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if count == 0 {
+			break
+		}
+		res = append(res, m.member)
+		if withScores {
+			res = append(res, strconv.FormatFloat(m.score, 'g', -1, 64))
+		}
+		count--
+	}
+	return res
+}
+
+func parseLiteScore(v string) (float64, error) {
+	switch strings.ToLower(v) {
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+func parseLiteScoreBound(v string) (float64, bool, error) {
+	if strings.HasPrefix(v, "(") {
+		f, err := parseLiteScore(v[1:])
+		return f, true, err
+	}
+	f, err := parseLiteScore(v)
+	return f, false, err
+}
+
+// liteScript runs a known Lua script natively, the caller must hold s.mu
+type liteScript func(s *liteStore, keys, argv []string) interface{}
+
+// The scripts sent by redsync, which the leader lock uses. They must match its sources byte for
+// byte, since they are looked up by SHA1.
+const (
+	redsyncDeleteScript  = "\n\tlocal val = redis.call(\"GET\", KEYS[1])\n\tif val == ARGV[1] then\n\t\treturn redis.call(\"DEL\", KEYS[1])\n\telseif val == false then\n\t\treturn -1\n\telse\n\t\treturn 0\n\tend\n"
+	redsyncTouchScript   = "\n\tif redis.call(\"GET\", KEYS[1]) == ARGV[1] then\n\t\treturn redis.call(\"PEXPIRE\", KEYS[1], ARGV[2])\n\telse\n\t\treturn 0\n\tend\n"
+	redsyncTouchNXScript = "\n\tif redis.call(\"GET\", KEYS[1]) == ARGV[1] then\n\t\treturn redis.call(\"PEXPIRE\", KEYS[1], ARGV[2])\n\telseif redis.call(\"SET\", KEYS[1], ARGV[1], \"PX\", ARGV[2], \"NX\") then\n\t\treturn 1\n\telse\n\t\treturn 0\n\tend\n"
+)
+
+// liteScripts holds the scripts lite mode runs by the SHA1 of their source, as it has no Lua
+// interpreter. EVAL and EVALSHA of any other script fail.
+var liteScripts = map[string]liteScript{
+	liteScriptSHA(lockReleaseScript):    liteCompareAndDelete(0),
+	liteScriptSHA(lockRefreshScript):    liteCompareAndExpire(false),
+	liteScriptSHA(preflightScript):      liteExistsScript,
+	liteScriptSHA(redsyncDeleteScript):  liteCompareAndDelete(-1),
+	liteScriptSHA(redsyncTouchScript):   liteCompareAndExpire(false),
+	liteScriptSHA(redsyncTouchNXScript): liteCompareAndExpire(true),
+}
+
+func liteScriptSHA(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+// liteCompareAndDelete deletes KEYS[1] if it holds ARGV[1], replying missing when it does not exist
+func liteCompareAndDelete(missing int64) liteScript {
+	return func(s *liteStore, keys, argv []string) interface{} {
+		if len(keys) != 1 || len(argv) != 1 {
+			return liteError("ERR wrong number of keys or arguments for script")
+		}
+		e, errReply := s.lookup(keys[0], liteTypeString)
+		if errReply != nil {
+			return errReply
+		}
+		switch {
+		case e == nil:
+			return missing
+		case e.Str == argv[0]:
+			delete(s.data, keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	}
+}
+
+// liteCompareAndExpire sets a TTL of ARGV[2] milliseconds on KEYS[1] if it holds ARGV[1]. With
+// create, a missing key is set to ARGV[1] with the TTL.
+func liteCompareAndExpire(create bool) liteScript {
+	return func(s *liteStore, keys, argv []string) interface{} {
+		if len(keys) != 1 || len(argv) != 2 {
+			return liteError("ERR wrong number of keys or arguments for script")
+		}
+		ms, err := strconv.ParseInt(argv[1], 10, 64)
+		if err != nil {
+			return liteNotInt
+		}
+		e, errReply := s.lookup(keys[0], liteTypeString)
+		if errReply != nil {
+			return errReply
+		}
+		switch {
+		case e != nil && e.Str == argv[0]:
+			e.ExpireAt = time.Now().UnixMilli() + ms
+			return int64(1)
+		case e == nil && create:
+			s.data[keys[0]] = &liteEntry{Type: liteTypeString, Str: argv[0], ExpireAt: time.Now().UnixMilli() + ms}
+			return int64(1)
+		}
+		return int64(0)
+	}
+}
+
+func liteExistsScript(s *liteStore, keys, _ []string) interface{} {
+	if len(keys) != 1 {
+		return liteError("ERR wrong number of keys or arguments for script")
+	}
+	if s.exists(keys[0]) {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+// liteScriptArgs splits the KEYS and ARGV of EVAL and EVALSHA
+func liteScriptArgs(args []string) (keys, argv []string, errReply interface{}) {
+	if len(args) < 3 {
+		return nil, nil, liteArity(args[0])
+	}
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 || 3+numKeys > len(args) {
+		return nil, nil, liteError("ERR Number of keys can't be greater than number of args")
+	}
+	return args[3 : 3+numKeys], args[3+numKeys:], nil
+}
+
+// cmdEval runs EVAL with the source of a known script and EVALSHA with its SHA1
+func (s *liteStore) cmdEval(name string, args []string) interface{} {
+	keys, argv, errReply := liteScriptArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	sha := args[1]
+	if name == "EVAL" {
+		sha = liteScriptSHA(args[1])
+	}
+	script, ok := liteScripts[strings.ToLower(sha)]
+	if !ok {
+		if name == "EVALSHA" {
+			return liteError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return liteError("ERR script is not supported in lite mode")
+	}
+	return script(s, keys, argv)
+}
+
+func (s *liteStore) cmdScript(args []string) interface{} {
+	if len(args) < 2 {
+		return liteArity("SCRIPT")
+	}
+	switch strings.ToUpper(args[1]) {
+	case "LOAD":
+		if len(args) != 3 {
+			return liteArity("SCRIPT|LOAD")
+		}
+		sha := liteScriptSHA(args[2])
+		if _, ok := liteScripts[sha]; !ok {
+			return liteError("ERR script is not supported in lite mode")
+		}
+		return sha
+	case "EXISTS":
+		res := make([]interface{}, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			if _, ok := liteScripts[strings.ToLower(sha)]; ok {
+				res = append(res, int64(1))
+			} else {
+				res = append(res, int64(0))
+			}
+		}
+		return res
+	case "FLUSH":
+		// the known scripts are always available
+		return liteOK
+	}
+	return liteError(fmt.Sprintf("ERR unknown subcommand '%s' in lite mode", args[1]))
+}
+
+// liteWrittenKeys returns the keys a write command may modify
+func liteWrittenKeys(name string, args []string) []string {
+	switch name {
+	case "DEL", "UNLINK":
+		return args[1:]
+	case "EVAL", "EVALSHA":
+		keys, _, _ := liteScriptArgs(args)
+		return keys
+	case "SCRIPT":
+		return nil
+	}
+	if len(args) > 1 {
+		return args[1:2]
+	}
+	return nil
+}
+
+func (s *liteStore) info() string {
+	var expires int
+	for _, e := range s.data {
+		if e.ExpireAt > 0 {
+			expires++
+		}
+	}
+	s.subMu.Lock()
+	channels := len(s.subs)
+	s.subMu.Unlock()
+	uptime := int64(time.Since(s.started).Seconds())
+
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString("redis_version:lite\r\nredis_mode:standalone\r\n")
+	fmt.Fprintf(&b, "os:%s %s\r\nprocess_id:%d\r\n", runtime.GOOS, runtime.GOARCH, os.Getpid())
+	fmt.Fprintf(&b, "uptime_in_seconds:%d\r\nuptime_in_days:%d\r\n", uptime, uptime/86400)
+	fmt.Fprintf(&b, "config_file:%s\r\n", s.path)
+	b.WriteString("# Clients\r\n")
+	fmt.Fprintf(&b, "connected_clients:%d\r\n", atomic.LoadInt64(&s.clients))
+	b.WriteString("# Stats\r\n")
+	fmt.Fprintf(&b, "total_connections_received:%d\r\n", atomic.LoadInt64(&s.connections))
+	fmt.Fprintf(&b, "total_commands_processed:%d\r\n", atomic.LoadInt64(&s.commands))
+	fmt.Fprintf(&b, "expired_keys:%d\r\nevicted_keys:0\r\n", s.expired)
+	fmt.Fprintf(&b, "keyspace_hits:%d\r\nkeyspace_misses:%d\r\n", s.hits, s.misses)
+	fmt.Fprintf(&b, "pubsub_channels:%d\r\npubsub_patterns:0\r\n", channels)
+	b.WriteString("# Replication\r\nrole:master\r\nconnected_slaves:0\r\n")
+	b.WriteString("# Keyspace\r\n")
+	fmt.Fprintf(&b, "db0:keys=%d,expires=%d\r\n", len(s.data), expires)
+	return b.String()
+}
+
+// ===================== Helpers =====================
+
+// liteRange normalises Redis style inclusive start/stop indexes against a length
+func liteRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// liteMatch implements Redis glob matching: *, ?, [abc], [^a-z] and \ escapes
+func liteMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if liteMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				if s == "" || s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+			if s == "" {
+				return false
+			}
+			class := pattern[1 : 1+end]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= s[0] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern, s = pattern[end+2:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
+
+func appendLiteReply(buf []byte, v interface{}) []byte {
+	switch r := v.(type) {
+	case liteStatus:
+		buf = append(buf, '+')
+		buf = append(buf, r...)
+	case liteError:
+		buf = append(buf, '-')
+		buf = append(buf, r...)
+	case int64:
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, r, 10)
+	case string:
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(r)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, r...)
+	case []interface{}:
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(r)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, item := range r {
+			buf = appendLiteReply(buf, item)
+		}
+		return buf
+	case nil:
+		buf = append(buf, "$-1"...)
+	default:
+		buf = append(buf, "-ERR unsupported reply type"...)
+	}
+	return append(buf, '\r', '\n')
+}
@@ -0,0 +1,263 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLiteStore(t *testing.T, path string) (*liteStore, *redis.Client) {
+	t.Helper()
+	store, err := newLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:            "lite",
+		Dialer:          store.dial,
+		Protocol:        2,
+		DisableIdentity: true,
+	})
+	t.Cleanup(func() {
+		client.Close()
+		store.close()
+	})
+	return store, client
+}
+
+func TestLiteStoreStrings(t *testing.T) {
+	_, c := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	bg := context.Background()
+
+	if err := c.Set(bg, "a", "1", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c.SetNX(bg, "a", "2", 0).Result(); ok {
+		t.Error("SETNX overwrote an existing key")
+	}
+	if v, _ := c.IncrBy(bg, "a", 4).Result(); v != 5 {
+		t.Errorf("INCRBY = %d, want 5", v)
+	}
+	if err := c.Set(bg, "s", "x", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Incr(bg, "s").Err(); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("INCR of a string: err = %v", err)
+	}
+	if err := c.HSet(bg, "s", "f", "v").Err(); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Errorf("HSET of a string: err = %v", err)
+	}
+
+	c.Set(bg, "ttl", "v", time.Minute)
+	if d, _ := c.TTL(bg, "ttl").Result(); d <= 0 || d > time.Minute {
+		t.Errorf("TTL = %v", d)
+	}
+	c.PExpire(bg, "ttl", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n, _ := c.Exists(bg, "ttl").Result(); n != 0 {
+		t.Error("expired key still exists")
+	}
+	if err := c.Get(bg, "ttl").Err(); err != redis.Nil {
+		t.Errorf("GET of an expired key: err = %v", err)
+	}
+
+	keys, _, err := c.Scan(bg, 0, "*", 10).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if want := []string{"a", "s"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("SCAN = %v, want %v", keys, want)
+	}
+	if n, _ := c.Del(bg, "a", "s", "missing").Result(); n != 2 {
+		t.Errorf("DEL = %d, want 2", n)
+	}
+	if err := c.Do(bg, "FLUSHALL").Err(); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("unsupported command: err = %v", err)
+	}
+}
+
+func TestLiteStoreCollections(t *testing.T) {
+	_, c := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	bg := context.Background()
+
+	c.HSet(bg, "h", "a", "1", "b", "2")
+	c.HIncrBy(bg, "h", "a", 2)
+	if m, _ := c.HGetAll(bg, "h").Result(); !reflect.DeepEqual(m, map[string]string{"a": "3", "b": "2"}) {
+		t.Errorf("HGETALL = %v", m)
+	}
+
+	c.RPush(bg, "l", "a", "b", "c")
+	c.LPush(bg, "l", "z")
+	c.LTrim(bg, "l", 0, 2)
+	if l, _ := c.LRange(bg, "l", 0, -1).Result(); !reflect.DeepEqual(l, []string{"z", "a", "b"}) {
+		t.Errorf("LRANGE = %v", l)
+	}
+
+	c.SAdd(bg, "set", "a", "b", "a")
+	c.SRem(bg, "set", "b")
+	if m, _ := c.SMembers(bg, "set").Result(); !reflect.DeepEqual(m, []string{"a"}) {
+		t.Errorf("SMEMBERS = %v", m)
+	}
+
+	c.ZAdd(bg, "z", redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"})
+	c.ZIncrBy(bg, "z", 10, "a")
+	if m, _ := c.ZRange(bg, "z", 0, -1).Result(); !reflect.DeepEqual(m, []string{"b", "c", "a"}) {
+		t.Errorf("ZRANGE = %v", m)
+	}
+	if m, _ := c.ZRangeByScore(bg, "z", &redis.ZRangeBy{Min: "2", Max: "(11"}).Result(); !reflect.DeepEqual(m, []string{"b", "c"}) {
+		t.Errorf("ZRANGEBYSCORE = %v", m)
+	}
+	c.ZRemRangeByRank(bg, "z", 0, 0)
+	if n, _ := c.ZCard(bg, "z").Result(); n != 2 {
+		t.Errorf("ZCARD = %d, want 2", n)
+	}
+}
+
+func TestLiteStoreTransactionAndPubSub(t *testing.T) {
+	_, c := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	bg := context.Background()
+
+	pipe := c.TxPipeline()
+	incr := pipe.Incr(bg, "n")
+	pipe.Expire(bg, "n", time.Minute)
+	if _, err := pipe.Exec(bg); err != nil {
+		t.Fatal(err)
+	}
+	if incr.Val() != 1 {
+		t.Errorf("INCR in MULTI = %d, want 1", incr.Val())
+	}
+
+	sub := c.Subscribe(bg, "ch")
+	defer sub.Close()
+	if _, err := sub.Receive(bg); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.Publish(bg, "ch", "hello").Result(); n != 1 {
+		t.Errorf("PUBLISH reached %d subscribers, want 1", n)
+	}
+	msg, err := sub.ReceiveMessage(bg)
+	if err != nil || msg.Payload != "hello" {
+		t.Errorf("message = %v, err = %v", msg, err)
+	}
+}
+
+func TestLiteStoreScripts(t *testing.T) {
+	_, c := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	bg := context.Background()
+
+	c.Set(bg, "lock", "me", time.Minute)
+	if n, _ := c.Eval(bg, lockRefreshScript, []string{"lock"}, "other", 1000).Int(); n != 0 {
+		t.Error("refresh of a lock held by another owner succeeded")
+	}
+	if n, _ := c.Eval(bg, lockRefreshScript, []string{"lock"}, "me", 1000).Int(); n != 1 {
+		t.Error("refresh by the owner failed")
+	}
+	if d, _ := c.PTTL(bg, "lock").Result(); d > time.Second {
+		t.Errorf("PTTL after refresh = %v", d)
+	}
+
+	// EVALSHA runs a known script without sending its source first
+	release := redis.NewScript(lockReleaseScript)
+	if n, err := c.EvalSha(bg, release.Hash(), []string{"lock"}, "me").Int(); err != nil || n != 1 {
+		t.Errorf("EVALSHA release = %d, %v", n, err)
+	}
+	if n, _ := release.Run(bg, c, []string{"lock"}, "me").Int(); n != 0 {
+		t.Error("release of a missing lock succeeded")
+	}
+	if n, _ := c.Eval(bg, preflightScript, []string{"lock"}).Int(); n != 0 {
+		t.Error("released lock still exists")
+	}
+
+	if sha, err := c.ScriptLoad(bg, lockReleaseScript).Result(); err != nil || sha != release.Hash() {
+		t.Errorf("SCRIPT LOAD = %s, %v", sha, err)
+	}
+	unknown := "return redis.call('GET', KEYS[1])"
+	if err := c.ScriptLoad(bg, unknown).Err(); err == nil {
+		t.Error("SCRIPT LOAD of an unknown script succeeded")
+	}
+	if exists, _ := c.ScriptExists(bg, release.Hash(), redis.NewScript(unknown).Hash()).Result(); !reflect.DeepEqual(exists, []bool{true, false}) {
+		t.Errorf("SCRIPT EXISTS = %v", exists)
+	}
+	if err := c.Eval(bg, unknown, []string{"lock"}).Err(); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("EVAL of an unknown script: err = %v", err)
+	}
+	if err := c.EvalSha(bg, redis.NewScript(unknown).Hash(), []string{"lock"}).Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		t.Errorf("EVALSHA of an unknown script: err = %v", err)
+	}
+}
+
+func TestLiteStoreRedsync(t *testing.T) {
+	_, c := newTestLiteStore(t, filepath.Join(t.TempDir(), "lite.db"))
+	rs := redsync.New(goredis.NewPool(c))
+
+	m := rs.NewMutex("leader", redsync.WithExpiry(time.Minute), redsync.WithTries(1))
+	if err := m.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.NewMutex("leader", redsync.WithTries(1)).Lock(); err == nil {
+		t.Fatal("a held lock was acquired twice")
+	}
+	if ok, err := m.Extend(); err != nil || !ok {
+		t.Fatalf("extend = %v, %v", ok, err)
+	}
+	if ok, err := m.Unlock(); err != nil || !ok {
+		t.Fatalf("unlock = %v, %v", ok, err)
+	}
+	if _, err := m.Unlock(); err == nil || !strings.Contains(err.Error(), redsync.ErrLockAlreadyExpired.Error()) {
+		t.Fatalf("second unlock: err = %v", err)
+	}
+
+	nx := rs.NewMutex("leader", redsync.WithSetNXOnExtend(), redsync.WithTries(1))
+	if ok, err := nx.Extend(); err != nil || !ok {
+		t.Fatalf("extend with SETNX of a released lock = %v, %v", ok, err)
+	}
+}
+
+func TestLiteStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lite.db")
+	store, c := newTestLiteStore(t, path)
+	bg := context.Background()
+
+	c.Set(bg, "kept", "v", 0)
+	c.HSet(bg, "hash", "f", "1")
+	c.Set(bg, "deleted", "v", 0)
+	c.Set(bg, "leader:lock", "node", 0)
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Del(bg, "deleted")
+	c.ZAdd(bg, "z", redis.Z{Score: 1, Member: "a"})
+	c.Set(bg, "short", "v", 50*time.Millisecond)
+	c.Close()
+	// close flushes the changes made since the last save
+	if err := store.close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	_, c = newTestLiteStore(t, path)
+	if v, _ := c.Get(bg, "kept").Result(); v != "v" {
+		t.Errorf("kept = %q", v)
+	}
+	if v, _ := c.HGet(bg, "hash", "f").Result(); v != "1" {
+		t.Errorf("hash.f = %q", v)
+	}
+	if n, _ := c.ZCard(bg, "z").Result(); n != 1 {
+		t.Errorf("ZCARD z = %d, want 1", n)
+	}
+	// deleted and expired keys are gone, and locks of the previous process are dropped
+	for _, k := range []string{"deleted", "short", "leader:lock"} {
+		if n, _ := c.Exists(bg, k).Result(); n != 0 {
+			t.Errorf("%s survived the restart", k)
+		}
+	}
+}
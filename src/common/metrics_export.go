@@ -0,0 +1,606 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	MetricsProtocolRemoteWrite = "remote_write" // Prometheus remote-write 1.0, protobuf + snappy
+	MetricsProtocolOTLP        = "otlp"         // OTLP/HTTP metrics, JSON encoding
+
+	MetricKindCounter   = "counter"   // events counted, or a numeric field summed
+	MetricKindGauge     = "gauge"     // last value of a numeric field
+	MetricKindThreshold = "threshold" // threshold counters of rulesets with explain="true"
+
+	defaultMetricsFlushInterval = 15 * time.Second
+	defaultMetricsMaxSeries     = 10000
+	// gauges not updated for this many flushes are no longer sent
+	metricsGaugeStaleFlushes = 5
+)
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var metricLabelRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricSeriesConfig defines a metric derived from the events of a metrics output
+type MetricSeriesConfig struct {
+	Name   string            `yaml:"name"`
+	Type   string            `yaml:"type,omitempty"`   // counter (default), gauge or threshold
+	Value  string            `yaml:"value,omitempty"`  // counter: field added instead of 1, gauge: field holding the value
+	Labels map[string]string `yaml:"labels,omitempty"` // label name -> event field
+}
+
+// Validate checks a metric definition
+func (c *MetricSeriesConfig) Validate() error {
+	if !metricNameRegex.MatchString(c.Name) {
+		return fmt.Errorf("invalid metric name %q", c.Name)
+	}
+	switch c.Type {
+	case "", MetricKindCounter, MetricKindThreshold:
+	case MetricKindGauge:
+		if c.Value == "" {
+			return fmt.Errorf("metric %s: gauge requires value", c.Name)
+		}
+	default:
+		return fmt.Errorf("metric %s: invalid type %q, must be %s, %s or %s", c.Name, c.Type, MetricKindCounter, MetricKindGauge, MetricKindThreshold)
+	}
+	for label, field := range c.Labels {
+		if !metricLabelRegex.MatchString(label) || strings.HasPrefix(label, "__") {
+			return fmt.Errorf("metric %s: invalid label name %q", c.Name, label)
+		}
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("metric %s: label %s needs a field", c.Name, label)
+		}
+	}
+	return nil
+}
+
+// MetricsExporterConfig holds the settings of a metrics producer
+type MetricsExporterConfig struct {
+	Protocol      string
+	Endpoint      string
+	Headers       map[string]string
+	Username      string // basic auth
+	Password      string
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	HTTP          *OutputHTTPConfig // TLS and proxy of the client
+	MaxSeries     int
+	StaticLabels  map[string]string // added to every series, OTLP resource attributes
+	Series        []MetricSeriesConfig
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type metricSeries struct {
+	name    string
+	kind    string // counter or gauge
+	labels  []metricLabel
+	value   float64
+	updated time.Time
+}
+
+type compiledMetric struct {
+	cfg    MetricSeriesConfig
+	value  []string
+	labels []string // sorted label names
+	fields map[string][]string
+}
+
+// MetricsProducer aggregates events into metrics and pushes them every flush interval.
+// Counters are cumulative from the producer start. Events are acked once a push containing them succeeds;
+// after a failed push the values are kept and sent with the next one.
+type MetricsProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg     MetricsExporterConfig
+	client  *http.Client
+	metrics []compiledMetric
+	start   time.Time
+
+	mu      sync.Mutex
+	series  map[string]*metricSeries
+	pending uint64 // events observed since the last successful push
+
+	done chan struct{}
+
+	observed      uint64
+	pushes        uint64
+	failedPushes  uint64
+	droppedSeries uint64
+	lastError     atomic.Value
+}
+
+// NewMetricsProducer starts aggregating the events read from msgChan
+func NewMetricsProducer(cfg MetricsExporterConfig, msgChan chan map[string]interface{}) (*MetricsProducer, error) {
+	if cfg.Protocol != MetricsProtocolRemoteWrite && cfg.Protocol != MetricsProtocolOTLP {
+		return nil, fmt.Errorf("invalid protocol %q, must be %s or %s", cfg.Protocol, MetricsProtocolRemoteWrite, MetricsProtocolOTLP)
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("metrics endpoint is required")
+	}
+	if len(cfg.Series) == 0 {
+		return nil, fmt.Errorf("at least one metric is required")
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultMetricsFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxSeries <= 0 {
+		cfg.MaxSeries = defaultMetricsMaxSeries
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &MetricsProducer{
+		MsgChan: msgChan,
+		cfg:     cfg,
+		client:  client,
+		start:   time.Now(),
+		series:  make(map[string]*metricSeries),
+		done:    make(chan struct{}),
+	}
+	for _, s := range cfg.Series {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		m := compiledMetric{cfg: s, fields: make(map[string][]string, len(s.Labels))}
+		if m.cfg.Type == "" {
+			m.cfg.Type = MetricKindCounter
+		}
+		if s.Value != "" {
+			m.value = StringToList(s.Value)
+		}
+		for label, field := range s.Labels {
+			m.labels = append(m.labels, label)
+			m.fields[label] = StringToList(field)
+		}
+		sort.Strings(m.labels)
+		p.metrics = append(p.metrics, m)
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *MetricsProducer) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				p.final()
+				return
+			}
+			p.observe(msg)
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// final pushes the last values, events that never made it into a push are failed
+func (p *MetricsProducer) final() {
+	if err := p.flush(); err != nil {
+		p.mu.Lock()
+		n := p.pending
+		p.pending = 0
+		p.mu.Unlock()
+		p.Receipts.AddFailed(n)
+	}
+}
+
+func (p *MetricsProducer) observe(msg map[string]interface{}) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.metrics {
+		m := &p.metrics[i]
+		switch m.cfg.Type {
+		case MetricKindCounter:
+			inc := 1.0
+			if m.value != nil {
+				v, ok := metricFieldValue(msg, m.value)
+				if !ok {
+					continue
+				}
+				inc = v
+			}
+			if s := p.getSeries(m.cfg.Name, MetricKindCounter, m.eventLabels(msg, nil)); s != nil {
+				s.value += inc
+				s.updated = now
+			}
+		case MetricKindGauge:
+			v, ok := metricFieldValue(msg, m.value)
+			if !ok {
+				continue
+			}
+			if s := p.getSeries(m.cfg.Name, MetricKindGauge, m.eventLabels(msg, nil)); s != nil {
+				s.value = v
+				s.updated = now
+			}
+		case MetricKindThreshold:
+			p.observeThresholds(m, msg, now)
+		}
+	}
+	p.pending++
+	atomic.AddUint64(&p.observed, 1)
+}
+
+// observeThresholds records the counters in the explanation of each hit rule as gauges
+// labelled with the rule and the threshold id (or range when it has no id)
+func (p *MetricsProducer) observeThresholds(m *compiledMetric, msg map[string]interface{}, now time.Time) {
+	explanations, ok := msg["_hub_explain"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for ruleID, e := range explanations {
+		explanation, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		thresholds, _ := explanation["thresholds"].([]map[string]interface{})
+		if thresholds == nil {
+			// Events that passed through JSON carry generic slices
+			if list, ok := explanation["thresholds"].([]interface{}); ok {
+				for _, t := range list {
+					if tm, ok := t.(map[string]interface{}); ok {
+						thresholds = append(thresholds, tm)
+					}
+				}
+			}
+		}
+		for _, t := range thresholds {
+			count, ok := toFloat(t["count"])
+			if !ok {
+				continue
+			}
+			threshold := fmt.Sprint(t["range"])
+			if id, ok := t["id"].(string); ok && id != "" {
+				threshold = id
+			}
+			extra := []metricLabel{{name: "rule", value: ruleID}, {name: "threshold", value: threshold}}
+			if s := p.getSeries(m.cfg.Name, MetricKindGauge, m.eventLabels(msg, extra)); s != nil {
+				s.value = count
+				s.updated = now
+			}
+		}
+	}
+}
+
+// eventLabels returns the sorted labels of a metric for an event, missing fields give empty values
+func (m *compiledMetric) eventLabels(msg map[string]interface{}, extra []metricLabel) []metricLabel {
+	labels := make([]metricLabel, 0, len(m.labels)+len(extra))
+	for _, name := range m.labels {
+		v, _ := GetCheckData(msg, m.fields[name])
+		labels = append(labels, metricLabel{name: name, value: v})
+	}
+	for _, l := range extra {
+		if _, configured := m.fields[l.name]; !configured {
+			labels = append(labels, l)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// getSeries must be called with mu held, nil when the series limit is reached
+func (p *MetricsProducer) getSeries(name, kind string, labels []metricLabel) *metricSeries {
+	var key strings.Builder
+	key.WriteString(name)
+	for _, l := range labels {
+		key.WriteByte(0)
+		key.WriteString(l.name)
+		key.WriteByte(0)
+		key.WriteString(l.value)
+	}
+	if s, ok := p.series[key.String()]; ok {
+		return s
+	}
+	if len(p.series) >= p.cfg.MaxSeries {
+		if atomic.AddUint64(&p.droppedSeries, 1) == 1 {
+			logger.Warn("Metrics output reached max_series, new series are dropped", "endpoint", p.cfg.Endpoint, "max_series", p.cfg.MaxSeries)
+		}
+		return nil
+	}
+	s := &metricSeries{name: name, kind: kind, labels: labels}
+	p.series[key.String()] = s
+	return s
+}
+
+func metricFieldValue(msg map[string]interface{}, path []string) (float64, bool) {
+	v, ok := GetCheckDataWithType(msg, path)
+	if !ok {
+		return 0, false
+	}
+	return toFloat(v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil && !math.IsNaN(f)
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// snapshot copies the series to push and drops stale gauges
+func (p *MetricsProducer) snapshot(now time.Time) ([]metricSeries, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stale := now.Add(-metricsGaugeStaleFlushes * p.cfg.FlushInterval)
+	list := make([]metricSeries, 0, len(p.series))
+	for key, s := range p.series {
+		if s.kind == MetricKindGauge && s.updated.Before(stale) {
+			delete(p.series, key)
+			continue
+		}
+		list = append(list, *s)
+	}
+	return list, p.pending
+}
+
+// flush pushes the current values, acking the events observed before it on success
+func (p *MetricsProducer) flush() error {
+	now := time.Now()
+	list, pending := p.snapshot(now)
+	if len(list) == 0 {
+		// Nothing to push, the events did not produce a value
+		p.mu.Lock()
+		p.pending -= pending
+		p.mu.Unlock()
+		p.Receipts.AddAcked(pending)
+		return nil
+	}
+
+	var body []byte
+	var err error
+	if p.cfg.Protocol == MetricsProtocolRemoteWrite {
+		body = snappy.Encode(nil, p.encodeRemoteWrite(list, now))
+	} else {
+		body, err = p.encodeOTLP(list, now)
+	}
+	if err == nil {
+		err = p.push(body)
+	}
+	if err != nil {
+		atomic.AddUint64(&p.failedPushes, 1)
+		p.lastError.Store(truncateRunes(err.Error(), 512))
+		logger.Warn("Failed to push metrics", "endpoint", p.cfg.Endpoint, "series", len(list), "error", err)
+		return err
+	}
+
+	atomic.AddUint64(&p.pushes, 1)
+	p.mu.Lock()
+	p.pending -= pending
+	p.mu.Unlock()
+	p.Receipts.AddAcked(pending)
+	return nil
+}
+
+func (p *MetricsProducer) push(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if p.cfg.Protocol == MetricsProtocolRemoteWrite {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.cfg.Username != "" {
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("metrics endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// encodeRemoteWrite builds a prometheus.WriteRequest, field numbers follow prometheus/prompb/types.proto
+func (p *MetricsProducer) encodeRemoteWrite(list []metricSeries, now time.Time) []byte {
+	ts := now.UnixMilli()
+	var out []byte
+	for _, s := range list {
+		labels := make([]metricLabel, 0, len(s.labels)+len(p.cfg.StaticLabels)+1)
+		labels = append(labels, metricLabel{name: "__name__", value: s.name})
+		labels = append(labels, s.labels...)
+		for k, v := range p.cfg.StaticLabels {
+			labels = append(labels, metricLabel{name: k, value: v})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		var series []byte
+		for _, l := range labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, series)
+	}
+	return out
+}
+
+func otlpAttributes(labels []metricLabel) []map[string]interface{} {
+	attrs := make([]map[string]interface{}, 0, len(labels))
+	for _, l := range labels {
+		attrs = append(attrs, map[string]interface{}{"key": l.name, "value": map[string]interface{}{"stringValue": l.value}})
+	}
+	return attrs
+}
+
+// encodeOTLP builds an ExportMetricsServiceRequest in the OTLP/JSON encoding. Counters are
+// cumulative monotonic sums starting at the producer start.
+func (p *MetricsProducer) encodeOTLP(list []metricSeries, now time.Time) ([]byte, error) {
+	start := strconv.FormatInt(p.start.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	byName := make(map[string][]map[string]interface{})
+	kinds := make(map[string]string)
+	var names []string
+	for _, s := range list {
+		if _, ok := byName[s.name]; !ok {
+			names = append(names, s.name)
+			kinds[s.name] = s.kind
+		}
+		point := map[string]interface{}{
+			"attributes":   otlpAttributes(s.labels),
+			"timeUnixNano": ts,
+			"asDouble":     s.value,
+		}
+		if s.kind == MetricKindCounter {
+			point["startTimeUnixNano"] = start
+		}
+		byName[s.name] = append(byName[s.name], point)
+	}
+	sort.Strings(names)
+
+	metrics := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		metric := map[string]interface{}{"name": name}
+		if kinds[name] == MetricKindCounter {
+			metric["sum"] = map[string]interface{}{
+				"aggregationTemporality": 2, // cumulative
+				"isMonotonic":            true,
+				"dataPoints":             byName[name],
+			}
+		} else {
+			metric["gauge"] = map[string]interface{}{"dataPoints": byName[name]}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	resource := []metricLabel{{name: "service.name", value: "agentsmith-hub"}, {name: "host.name", value: GetNodeID()}}
+	for k, v := range p.cfg.StaticLabels {
+		resource = append(resource, metricLabel{name: k, value: v})
+	}
+	sort.Slice(resource, func(i, j int) bool { return resource[i].name < resource[j].name })
+
+	return json.Marshal(map[string]interface{}{
+		"resourceMetrics": []map[string]interface{}{{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(resource)},
+			"scopeMetrics": []map[string]interface{}{{
+				"scope":   map[string]interface{}{"name": "agentsmith-hub"},
+				"metrics": metrics,
+			}},
+		}},
+	})
+}
+
+// Close waits for the last push once msgChan is closed by its owner, giving up after 30s
+func (p *MetricsProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		logger.Warn("Timed out waiting for the last metrics push", "endpoint", p.cfg.Endpoint)
+	}
+}
+
+// GetStats returns the number of events observed, pushes and series
+func (p *MetricsProducer) GetStats() map[string]interface{} {
+	p.mu.Lock()
+	series := len(p.series)
+	p.mu.Unlock()
+	stats := map[string]interface{}{
+		"observed":       atomic.LoadUint64(&p.observed),
+		"series":         series,
+		"pushes":         atomic.LoadUint64(&p.pushes),
+		"failed_pushes":  atomic.LoadUint64(&p.failedPushes),
+		"dropped_series": atomic.LoadUint64(&p.droppedSeries),
+	}
+	if err, ok := p.lastError.Load().(string); ok {
+		stats["last_error"] = err
+	}
+	return stats
+}
+
+// TestMetricsEndpoint checks that the endpoint answers, with a HEAD request so nothing is pushed.
+// Any HTTP response counts as reachable.
+func TestMetricsEndpoint(cfg MetricsExporterConfig) error {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	req, err := http.NewRequest(http.MethodHead, cfg.Endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, timeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("metrics endpoint not reachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,326 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// metricsServer records the bodies pushed to it and answers with status
+type metricsServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  int
+	bodies  [][]byte
+	headers []http.Header
+}
+
+func newMetricsServer(t *testing.T) *metricsServer {
+	s := &metricsServer{status: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, body)
+		s.headers = append(s.headers, r.Header.Clone())
+		w.WriteHeader(s.status)
+		if s.status >= 300 {
+			w.Write([]byte("ingester unavailable"))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *metricsServer) setStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *metricsServer) last() ([]byte, http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) == 0 {
+		return nil, nil
+	}
+	return s.bodies[len(s.bodies)-1], s.headers[len(s.headers)-1]
+}
+
+// remoteWriteSamples decodes a WriteRequest into the value of each series, keyed by its labels
+// formatted as name{k=v,...}
+func remoteWriteSamples(t *testing.T, body []byte) map[string]float64 {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("body is not snappy encoded: %v", err)
+	}
+	fields := func(b []byte) map[protowire.Number][][]byte {
+		out := make(map[protowire.Number][][]byte)
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			var v []byte
+			switch typ {
+			case protowire.BytesType:
+				v, n = protowire.ConsumeBytes(b)
+			case protowire.Fixed64Type:
+				var x uint64
+				x, n = protowire.ConsumeFixed64(b)
+				v = protowire.AppendFixed64(nil, x)
+			case protowire.VarintType:
+				_, n = protowire.ConsumeVarint(b)
+			default:
+				t.Fatalf("unexpected wire type %d", typ)
+			}
+			if n < 0 {
+				t.Fatalf("invalid protobuf: %v", protowire.ParseError(n))
+			}
+			out[num] = append(out[num], v)
+			b = b[n:]
+		}
+		return out
+	}
+
+	samples := make(map[string]float64)
+	for _, series := range fields(raw)[1] {
+		sf := fields(series)
+		var name string
+		var labels []string
+		for _, l := range sf[1] {
+			lf := fields(l)
+			k, v := string(lf[1][0]), string(lf[2][0])
+			if k == "__name__" {
+				name = v
+			} else {
+				labels = append(labels, k+"="+v)
+			}
+		}
+		bits, _ := protowire.ConsumeFixed64(fields(sf[2][0])[1][0])
+		samples[name+"{"+strings.Join(labels, ",")+"}"] = math.Float64frombits(bits)
+	}
+	return samples
+}
+
+func newTestMetricsProducer(t *testing.T, cfg MetricsExporterConfig) *MetricsProducer {
+	t.Helper()
+	cfg.FlushInterval = time.Hour
+	msgChan := make(chan map[string]interface{}, 16)
+	p, err := NewMetricsProducer(cfg, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Receipts = NewDeliveryReceipts()
+	t.Cleanup(func() {
+		close(msgChan)
+		p.Close()
+	})
+	return p
+}
+
+func TestMetricsRemoteWrite(t *testing.T) {
+	srv := newMetricsServer(t)
+	p := newTestMetricsProducer(t, MetricsExporterConfig{
+		Protocol:     MetricsProtocolRemoteWrite,
+		Endpoint:     srv.URL,
+		Username:     "hub",
+		Password:     "secret",
+		Headers:      map[string]string{"X-Scope-OrgID": "soc"},
+		StaticLabels: map[string]string{"env": "prod"},
+		Series: []MetricSeriesConfig{
+			{Name: "alerts_total", Labels: map[string]string{"rule": "rule_id"}},
+			{Name: "bytes_total", Value: "bytes"},
+			{Name: "queue_depth", Type: MetricKindGauge, Value: "queue.depth"},
+		},
+	})
+
+	p.observe(map[string]interface{}{"rule_id": "r1", "bytes": 10, "queue": map[string]interface{}{"depth": 3}})
+	p.observe(map[string]interface{}{"rule_id": "r1", "bytes": "5.5", "queue": map[string]interface{}{"depth": 7}})
+	p.observe(map[string]interface{}{"rule_id": "r2"})
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, header := srv.last()
+	if header.Get("Content-Encoding") != "snappy" || header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("headers = %v", header)
+	}
+	if header.Get("X-Scope-OrgID") != "soc" || !strings.HasPrefix(header.Get("Authorization"), "Basic ") {
+		t.Errorf("auth and custom headers missing: %v", header)
+	}
+	want := map[string]float64{
+		"alerts_total{env=prod,rule=r1}": 2,
+		"alerts_total{env=prod,rule=r2}": 1,
+		"bytes_total{env=prod}":          15.5,
+		"queue_depth{env=prod}":          7,
+	}
+	got := remoteWriteSamples(t, body)
+	if len(got) != len(want) {
+		t.Fatalf("samples = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if acked := p.Receipts.Snapshot().Acked; acked != 3 {
+		t.Errorf("acked = %d, want 3", acked)
+	}
+}
+
+func TestMetricsOTLP(t *testing.T) {
+	srv := newMetricsServer(t)
+	p := newTestMetricsProducer(t, MetricsExporterConfig{
+		Protocol: MetricsProtocolOTLP,
+		Endpoint: srv.URL,
+		Series: []MetricSeriesConfig{
+			{Name: "alerts_total"},
+			{Name: "threshold_count", Type: MetricKindThreshold},
+		},
+	})
+
+	p.observe(map[string]interface{}{"_hub_explain": map[string]interface{}{
+		"brute_force": map[string]interface{}{"thresholds": []interface{}{map[string]interface{}{"id": "per_user", "count": 12}}},
+	}})
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, header := srv.last()
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+	var req struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string `json:"name"`
+					Sum  *struct {
+						IsMonotonic bool `json:"isMonotonic"`
+						DataPoints  []struct {
+							AsDouble float64 `json:"asDouble"`
+						} `json:"dataPoints"`
+					} `json:"sum"`
+					Gauge *struct {
+						DataPoints []struct {
+							AsDouble   float64 `json:"asDouble"`
+							Attributes []struct {
+								Key   string `json:"key"`
+								Value struct {
+									StringValue string `json:"stringValue"`
+								} `json:"value"`
+							} `json:"attributes"`
+						} `json:"dataPoints"`
+					} `json:"gauge"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 || metrics[0].Name != "alerts_total" || metrics[1].Name != "threshold_count" {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	if sum := metrics[0].Sum; sum == nil || !sum.IsMonotonic || sum.DataPoints[0].AsDouble != 1 {
+		t.Errorf("alerts_total = %+v", sum)
+	}
+	gauge := metrics[1].Gauge
+	if gauge == nil || gauge.DataPoints[0].AsDouble != 12 {
+		t.Fatalf("threshold_count = %+v", gauge)
+	}
+	attrs := map[string]string{}
+	for _, a := range gauge.DataPoints[0].Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	if attrs["rule"] != "brute_force" || attrs["threshold"] != "per_user" {
+		t.Errorf("threshold attributes = %v", attrs)
+	}
+}
+
+func TestMetricsPushFailure(t *testing.T) {
+	srv := newMetricsServer(t)
+	srv.setStatus(http.StatusServiceUnavailable)
+	p := newTestMetricsProducer(t, MetricsExporterConfig{
+		Protocol:  MetricsProtocolRemoteWrite,
+		Endpoint:  srv.URL,
+		MaxSeries: 1,
+		Series:    []MetricSeriesConfig{{Name: "alerts_total", Labels: map[string]string{"rule": "rule_id"}}},
+	})
+
+	p.observe(map[string]interface{}{"rule_id": "r1"})
+	p.observe(map[string]interface{}{"rule_id": "r2"}) // over max_series
+	err := p.flush()
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "ingester unavailable") {
+		t.Fatalf("err = %v, want the 503 of the endpoint", err)
+	}
+	stats := p.GetStats()
+	if stats["failed_pushes"] != uint64(1) || stats["dropped_series"] != uint64(1) || stats["last_error"] == nil {
+		t.Errorf("stats = %v", stats)
+	}
+	if acked := p.Receipts.Snapshot().Acked; acked != 0 {
+		t.Errorf("acked = %d after a failed push", acked)
+	}
+
+	// The values are kept and the events acked by the next successful push
+	srv.setStatus(http.StatusOK)
+	p.observe(map[string]interface{}{"rule_id": "r1"})
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := srv.last()
+	if got := remoteWriteSamples(t, body); len(got) != 1 || got["alerts_total{rule=r1}"] != 2 {
+		t.Errorf("samples = %v", got)
+	}
+	if acked := p.Receipts.Snapshot().Acked; acked != 3 {
+		t.Errorf("acked = %d, want 3", acked)
+	}
+}
+
+func TestMetricsFinalPushOnClose(t *testing.T) {
+	srv := newMetricsServer(t)
+	msgChan := make(chan map[string]interface{}, 4)
+	p, err := NewMetricsProducer(MetricsExporterConfig{
+		Protocol:      MetricsProtocolRemoteWrite,
+		Endpoint:      srv.URL,
+		FlushInterval: time.Hour,
+		Series:        []MetricSeriesConfig{{Name: "alerts_total"}},
+	}, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgChan <- map[string]interface{}{}
+	msgChan <- map[string]interface{}{}
+	close(msgChan)
+	p.Close()
+
+	body, _ := srv.last()
+	if got := remoteWriteSamples(t, body); got["alerts_total{}"] != 2 {
+		t.Errorf("samples = %v", got)
+	}
+}
+
+func TestMetricsConfigErrors(t *testing.T) {
+	for name, cfg := range map[string]MetricsExporterConfig{
+		"protocol": {Protocol: "statsd", Endpoint: "http://x", Series: []MetricSeriesConfig{{Name: "a"}}},
+		"endpoint": {Protocol: MetricsProtocolOTLP, Series: []MetricSeriesConfig{{Name: "a"}}},
+		"series":   {Protocol: MetricsProtocolOTLP, Endpoint: "http://x"},
+		"name":     {Protocol: MetricsProtocolOTLP, Endpoint: "http://x", Series: []MetricSeriesConfig{{Name: "bad-name"}}},
+		"gauge":    {Protocol: MetricsProtocolOTLP, Endpoint: "http://x", Series: []MetricSeriesConfig{{Name: "a", Type: MetricKindGauge}}},
+		"label":    {Protocol: MetricsProtocolOTLP, Endpoint: "http://x", Series: []MetricSeriesConfig{{Name: "a", Labels: map[string]string{"__x": "f"}}}},
+	} {
+		if _, err := NewMetricsProducer(cfg, make(chan map[string]interface{})); err == nil {
+			t.Errorf("%s: invalid config accepted", name)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	ObjectStoreS3    = "s3"
+	ObjectStoreGCS   = "gcs"
+	ObjectStoreAzure = "azure"
+
+	ObjectFormatNDJSON  = "ndjson"
+	ObjectFormatParquet = "parquet"
+
+	DefaultObjectPartition = "{project}/dt={YYYY-MM-DD}/hour={HH}"
+
+	defaultObjectMaxSize = 64 << 20
+	defaultObjectMaxAge  = 5 * time.Minute
+	objectUploadRetries  = 3
+	objectCloseTimeout   = 30 * time.Second
+)
+
+// ObjectEncryptionConfig selects server-side encryption for archived objects.
+// S3 supports AES256 and aws:kms (with kms_key_id), GCS a Cloud KMS key name in kms_key_id
+// and Azure an encryption scope.
+type ObjectEncryptionConfig struct {
+	Type            string `yaml:"type,omitempty" json:"type,omitempty"` // S3: AES256 or aws:kms
+	KMSKeyID        string `yaml:"kms_key_id,omitempty" json:"kms_key_id,omitempty"`
+	EncryptionScope string `yaml:"encryption_scope,omitempty" json:"encryption_scope,omitempty"` // Azure
+}
+
+// ObjectStoreConfig describes where and how events are archived to object storage
+type ObjectStoreConfig struct {
+	Provider       string // s3, gcs or azure
+	Bucket         string // bucket, or container for Azure
+	Prefix         string
+	Partition      string // key template, see DefaultObjectPartition
+	Format         string // ndjson (default) or parquet
+	Compress       bool   // gzip the NDJSON object or the Parquet pages
+	MaxSize        int64  // roll over an object once its buffered size reaches this many bytes
+	MaxAge         time.Duration
+	ProjectID      string
+	OutputID       string
+	S3             S3Config
+	Azure          AzureBlobConfig
+	Encryption     *ObjectEncryptionConfig
+	ParquetColumns []ParquetColumn
+}
+
+// objectUploader abstracts the provider specific upload call
+type objectUploader interface {
+	put(ctx context.Context, key string, body []byte, contentType, contentEncoding string) error
+	check(ctx context.Context) error
+}
+
+type s3Uploader struct {
+	client  *S3Client
+	bucket  string
+	headers map[string]string
+}
+
+func (u *s3Uploader) put(ctx context.Context, key string, body []byte, contentType, contentEncoding string) error {
+	h := map[string]string{"Content-Type": contentType}
+	if contentEncoding != "" {
+		h["Content-Encoding"] = contentEncoding
+	}
+	for k, v := range u.headers {
+		h[k] = v
+	}
+	return u.client.PutObject(ctx, u.bucket, key, body, h)
+}
+
+func (u *s3Uploader) check(ctx context.Context) error {
+	return u.client.CheckBucket(ctx, u.bucket)
+}
+
+type azureUploader struct {
+	client    *AzureBlobClient
+	container string
+	headers   map[string]string
+}
+
+func (u *azureUploader) put(ctx context.Context, key string, body []byte, contentType, contentEncoding string) error {
+	h := map[string]string{"Content-Type": contentType}
+	if contentEncoding != "" {
+		h["Content-Encoding"] = contentEncoding
+	}
+	for k, v := range u.headers {
+		h[k] = v
+	}
+	return u.client.PutBlob(ctx, u.container, key, body, h)
+}
+
+func (u *azureUploader) check(ctx context.Context) error {
+	return u.client.CheckContainer(ctx, u.container)
+}
+
+// newObjectUploader creates the client for the configured provider
+func newObjectUploader(cfg ObjectStoreConfig) (objectUploader, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	enc := cfg.Encryption
+	switch cfg.Provider {
+	case ObjectStoreS3, ObjectStoreGCS:
+		s3cfg := cfg.S3
+		headers := map[string]string{}
+		if cfg.Provider == ObjectStoreGCS {
+			// GCS is used through its S3 compatible XML API with HMAC keys
+			if s3cfg.Endpoint == "" {
+				s3cfg.Endpoint = "https://storage.googleapis.com"
+			}
+			if s3cfg.Region == "" {
+				s3cfg.Region = "auto"
+			}
+			if enc != nil && enc.KMSKeyID != "" {
+				headers["x-goog-encryption-kms-key-name"] = enc.KMSKeyID
+			}
+		} else if enc != nil && enc.Type != "" {
+			headers["x-amz-server-side-encryption"] = enc.Type
+			if enc.KMSKeyID != "" {
+				headers["x-amz-server-side-encryption-aws-kms-key-id"] = enc.KMSKeyID
+			}
+		}
+		client, err := NewS3Client(s3cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Uploader{client: client, bucket: cfg.Bucket, headers: headers}, nil
+	case ObjectStoreAzure:
+		client, err := NewAzureBlobClient(cfg.Azure)
+		if err != nil {
+			return nil, err
+		}
+		headers := map[string]string{}
+		if enc != nil && enc.EncryptionScope != "" {
+			headers["x-ms-encryption-scope"] = enc.EncryptionScope
+		}
+		return &azureUploader{client: client, container: cfg.Bucket, headers: headers}, nil
+	}
+	return nil, fmt.Errorf("unsupported object store provider %q", cfg.Provider)
+}
+
+// TestObjectStoreConnection checks that the bucket or container is reachable with the configured credentials
+func TestObjectStoreConnection(cfg ObjectStoreConfig) error {
+	u, err := newObjectUploader(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return u.check(ctx)
+}
+
+// objectBuffer collects the events of one partition until rollover
+type objectBuffer struct {
+	partition string
+	opened    time.Time
+	count     uint64
+	size      int64
+
+	// ndjson
+	buf *bytes.Buffer
+	gz  *gzip.Writer
+	// parquet
+	rows []map[string]interface{}
+}
+
+// ObjectStoreProducer archives events to object storage, one object per partition and rollover
+type ObjectStoreProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg      ObjectStoreConfig
+	uploader objectUploader
+	buffers  map[string]*objectBuffer
+	seq      uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	upWg   sync.WaitGroup
+
+	objectsWritten uint64
+	bytesWritten   uint64
+}
+
+// NewObjectStoreProducer validates the configuration and starts archiving events read from msgChan.
+// Objects still open when msgChan is closed are uploaded by Close.
+func NewObjectStoreProducer(cfg ObjectStoreConfig, msgChan chan map[string]interface{}) (*ObjectStoreProducer, error) {
+	if cfg.Format == "" {
+		cfg.Format = ObjectFormatNDJSON
+	}
+	if cfg.Format != ObjectFormatNDJSON && cfg.Format != ObjectFormatParquet {
+		return nil, fmt.Errorf("unsupported format %q, expected ndjson or parquet", cfg.Format)
+	}
+	if cfg.Format == ObjectFormatParquet {
+		if len(cfg.ParquetColumns) == 0 {
+			cfg.ParquetColumns = []ParquetColumn{{Name: "event", Field: "*", Type: ParquetTypeString}}
+		}
+		if err := ValidateParquetColumns(cfg.ParquetColumns); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Partition == "" {
+		cfg.Partition = DefaultObjectPartition
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultObjectMaxSize
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultObjectMaxAge
+	}
+	uploader, err := newObjectUploader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &ObjectStoreProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		uploader: uploader,
+		buffers:  make(map[string]*objectBuffer),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// ObjectPartition expands a partition template for the given time, project and output
+func ObjectPartition(template string, t time.Time, projectID, outputID string) string {
+	t = t.UTC()
+	r := strings.NewReplacer(
+		"{project}", projectID,
+		"{output}", outputID,
+		"{YYYY-MM-DD}", t.Format("2006-01-02"),
+		"{YYYY}", t.Format("2006"),
+		"{MM}", t.Format("01"),
+		"{DD}", t.Format("02"),
+		"{HH}", t.Format("15"),
+	)
+	return strings.Trim(r.Replace(template), "/")
+}
+
+func (p *ObjectStoreProducer) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			for _, b := range p.buffers {
+				p.Receipts.AddFailed(b.count)
+			}
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				for key := range p.buffers {
+					p.rollover(key)
+				}
+				return
+			}
+			p.add(msg)
+		case <-ticker.C:
+			now := time.Now()
+			for key, b := range p.buffers {
+				if now.Sub(b.opened) >= p.cfg.MaxAge {
+					p.rollover(key)
+				}
+			}
+		}
+	}
+}
+
+func (p *ObjectStoreProducer) add(msg map[string]interface{}) {
+	partition := ObjectPartition(p.cfg.Partition, time.Now(), p.cfg.ProjectID, p.cfg.OutputID)
+	b, ok := p.buffers[partition]
+	if !ok {
+		b = &objectBuffer{partition: partition, opened: time.Now()}
+		if p.cfg.Format == ObjectFormatNDJSON {
+			b.buf = &bytes.Buffer{}
+			if p.cfg.Compress {
+				b.gz = gzip.NewWriter(b.buf)
+			}
+		}
+		p.buffers[partition] = b
+	}
+
+	line, err := sonic.Marshal(msg)
+	if err != nil {
+		logger.Error("Failed to serialize event for object storage", "output", p.cfg.OutputID, "error", err)
+		p.Receipts.AddFailed(1)
+		return
+	}
+	if p.cfg.Format == ObjectFormatParquet {
+		b.rows = append(b.rows, msg)
+		b.size += int64(len(line))
+	} else {
+		line = append(line, '\n')
+		if b.gz != nil {
+			_, _ = b.gz.Write(line)
+		} else {
+			b.buf.Write(line)
+		}
+		b.size = int64(b.buf.Len())
+	}
+	b.count++
+
+	if b.size >= p.cfg.MaxSize {
+		p.rollover(partition)
+	}
+}
+
+// rollover closes the buffer of a partition and uploads it in the background
+func (p *ObjectStoreProducer) rollover(partition string) {
+	b := p.buffers[partition]
+	delete(p.buffers, partition)
+	if b == nil || b.count == 0 {
+		return
+	}
+
+	var body []byte
+	contentType, contentEncoding, ext := "application/x-ndjson", "", ".ndjson"
+	if p.cfg.Format == ObjectFormatParquet {
+		data, err := EncodeParquet(p.cfg.ParquetColumns, b.rows, p.cfg.Compress)
+		if err != nil {
+			logger.Error("Failed to encode parquet object", "output", p.cfg.OutputID, "events", b.count, "error", err)
+			p.Receipts.AddFailed(b.count)
+			return
+		}
+		body, contentType, ext = data, "application/vnd.apache.parquet", ".parquet"
+	} else {
+		if b.gz != nil {
+			_ = b.gz.Close()
+			contentEncoding, ext = "gzip", ".ndjson.gz"
+		}
+		body = b.buf.Bytes()
+	}
+
+	seq := atomic.AddUint64(&p.seq, 1)
+	node := strings.NewReplacer(":", "_", "/", "_").Replace(GetNodeID())
+	name := fmt.Sprintf("%s-%s-%06d%s", b.opened.UTC().Format("20060102T150405Z"), node, seq, ext)
+	key := strings.Trim(strings.Trim(p.cfg.Prefix, "/")+"/"+b.partition+"/"+name, "/")
+
+	p.upWg.Add(1)
+	go func() {
+		defer p.upWg.Done()
+		p.upload(key, body, contentType, contentEncoding, b.count)
+	}()
+}
+
+func (p *ObjectStoreProducer) upload(key string, body []byte, contentType, contentEncoding string, count uint64) {
+	var err error
+	delay := time.Second
+	for attempt := 1; attempt <= objectUploadRetries; attempt++ {
+		if err = p.uploader.put(p.ctx, key, body, contentType, contentEncoding); err == nil {
+			atomic.AddUint64(&p.objectsWritten, 1)
+			atomic.AddUint64(&p.bytesWritten, uint64(len(body)))
+			p.Receipts.AddAcked(count)
+			logger.Debug("Archived object", "output", p.cfg.OutputID, "key", key, "events", count, "bytes", len(body))
+			return
+		}
+		if p.ctx.Err() != nil {
+			break
+		}
+		logger.Warn("Object upload failed, retrying", "output", p.cfg.OutputID, "key", key, "attempt", attempt, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-p.ctx.Done():
+		}
+		delay *= 2
+	}
+	logger.Error("Failed to archive object", "output", p.cfg.OutputID, "key", key, "events", count, "error", err)
+	p.Receipts.AddFailed(count)
+}
+
+// Close waits until msgChan is closed and drained and every open object is uploaded.
+// Objects still buffered or uploading after the close timeout are dropped and counted as failed.
+func (p *ObjectStoreProducer) Close() {
+	uploaded := make(chan struct{})
+	go func() {
+		<-p.done
+		p.upWg.Wait()
+		close(uploaded)
+	}()
+	select {
+	case <-uploaded:
+	case <-time.After(objectCloseTimeout):
+		logger.Warn("Timeout waiting for object uploads, cancelling", "output", p.cfg.OutputID)
+		p.cancel()
+		<-uploaded
+	}
+	p.cancel()
+}
+
+// GetObjectsWritten returns the number of objects uploaded since start
+func (p *ObjectStoreProducer) GetObjectsWritten() uint64 {
+	return atomic.LoadUint64(&p.objectsWritten)
+}
+
+// GetBytesWritten returns the number of bytes uploaded since start
+func (p *ObjectStoreProducer) GetBytesWritten() uint64 {
+	return atomic.LoadUint64(&p.bytesWritten)
+}
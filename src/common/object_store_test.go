@@ -0,0 +1,233 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var parquetGoldenColumns = []ParquetColumn{
+	{Name: "pid", Field: "process.pid", Type: ParquetTypeInt64},
+	{Name: "ok", Field: "ok", Type: ParquetTypeBoolean},
+}
+
+var parquetGoldenRows = []map[string]interface{}{
+	{"process": map[string]interface{}{"pid": float64(7)}, "ok": true},
+	{"ok": "false"}, // pid missing, ok converted from a string
+}
+
+// parquetGolden is the file for parquetGoldenRows, derived by hand from parquet.thrift and the
+// Parquet encoding spec (Thrift compact protocol, RLE definition levels, PLAIN values)
+var parquetGolden = strings.Join([]string{
+	"50415231", // PAR1
+	// pid: PageHeader{type DATA_PAGE, uncompressed 16, compressed 16, DataPageHeader{2 values, PLAIN, RLE, RLE}}
+	"1500" + "1520" + "1520" + "2c" + "1504" + "1500" + "1506" + "1506" + "00" + "00",
+	"04000000" + "0201" + "0200", // definition levels: 1x defined, 1x null
+	"0700000000000000",           // int64 7
+	// ok: PageHeader with 7 byte page
+	"1500" + "150e" + "150e" + "2c" + "1504" + "1500" + "1506" + "1506" + "00" + "00",
+	"02000000" + "0401", // definition levels: 2x defined
+	"01",                // bit-packed true, false
+	// FileMetaData
+	"1502", // version 1
+	"193c", // schema: list of 3 SchemaElement
+	"4806" + hex.EncodeToString([]byte("schema")) + "1504" + "00",       // root, 2 children
+	"1504" + "2502" + "1803" + hex.EncodeToString([]byte("pid")) + "00", // INT64, OPTIONAL
+	"1500" + "2502" + "1802" + hex.EncodeToString([]byte("ok")) + "00",  // BOOLEAN, OPTIONAL
+	"1604",        // num_rows 2
+	"191c",        // row_groups: list of 1 RowGroup
+	"192c",        // columns: list of 2 ColumnChunk
+	"2608" + "1c", // file_offset 4, ColumnMetaData
+	"1504" + "1925" + "0006" + "1918" + "03" + hex.EncodeToString([]byte("pid")) + "1500" + "1604" + "1642" + "1642" + "2608" + "00" + "00",
+	"264a" + "1c", // file_offset 37, ColumnMetaData
+	"1500" + "1925" + "0006" + "1918" + "02" + hex.EncodeToString([]byte("ok")) + "1500" + "1604" + "1630" + "1630" + "264a" + "00" + "00",
+	"1672" + "1604" + "00", // total_byte_size 57, num_rows 2
+	"280e" + hex.EncodeToString([]byte("AgentSmith-HUB")) + "00", // created_by
+}, "")
+
+func TestParquetGoldenEncode(t *testing.T) {
+	golden, err := hex.DecodeString(parquetGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	footerLen := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footerLen, uint32(len(golden)-61))
+	golden = append(append(golden, footerLen...), "PAR1"...)
+
+	got, err := EncodeParquet(parquetGoldenColumns, parquetGoldenRows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, golden) {
+		t.Fatalf("encoded\n%x\nwant\n%x", got, golden)
+	}
+}
+
+func TestParquetGzipPages(t *testing.T) {
+	plain, err := EncodeParquet(parquetGoldenColumns, parquetGoldenRows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := EncodeParquet(parquetGoldenColumns, parquetGoldenRows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first page header keeps the uncompressed size and records the gzip size, the page itself inflates
+	// back to the uncompressed page of the plain file
+	const headerLen = 17
+	header := compressed[4 : 4+headerLen]
+	if header[2] != 0x15 || header[3] != 0x20 || header[4] != 0x15 {
+		t.Fatalf("unexpected page header %x", header)
+	}
+	size := int(header[5] >> 1)
+	zr, err := gzip.NewReader(bytes.NewReader(compressed[4+headerLen : 4+headerLen+size]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := plain[4+headerLen : 4+headerLen+16]; !bytes.Equal(page, want) {
+		t.Fatalf("inflated page %x, want %x", page, want)
+	}
+	if !bytes.HasSuffix(compressed, []byte("PAR1")) {
+		t.Fatal("missing trailing magic")
+	}
+}
+
+func TestObjectPartition(t *testing.T) {
+	// Partitions are always cut in UTC, whatever the zone of the event time
+	at := time.Date(2024, 1, 15, 1, 30, 0, 0, time.FixedZone("UTC+3", 3*3600))
+	for template, want := range map[string]string{
+		DefaultObjectPartition:                     "p1/dt=2024-01-14/hour=22",
+		"/{output}/{YYYY}/{MM}/{DD}/{HH}/":         "o1/2024/01/14/22",
+		"year={YYYY}/month={MM}/project={project}": "year=2024/month=01/project=p1",
+	} {
+		if got := ObjectPartition(template, at, "p1", "o1"); got != want {
+			t.Errorf("ObjectPartition(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+type capturedObject struct {
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+// fakeS3 accepts every PUT and keeps the uploaded objects
+func fakeS3(t *testing.T) (*httptest.Server, func() []capturedObject) {
+	t.Helper()
+	var mu sync.Mutex
+	var objects []capturedObject
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects = append(objects, capturedObject{path: r.URL.Path, headers: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []capturedObject {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedObject(nil), objects...)
+	}
+}
+
+func runObjectStoreProducer(t *testing.T, cfg ObjectStoreConfig, events ...map[string]interface{}) {
+	t.Helper()
+	cfg.Provider = ObjectStoreS3
+	cfg.MaxAge = time.Hour
+	msgChan := make(chan map[string]interface{}, len(events))
+	p, err := NewObjectStoreProducer(cfg, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		msgChan <- e
+	}
+	close(msgChan)
+	p.Close()
+	if p.GetObjectsWritten() != 1 {
+		t.Fatalf("objects written = %d, want 1", p.GetObjectsWritten())
+	}
+}
+
+func TestObjectStoreParquetObject(t *testing.T) {
+	srv, objects := fakeS3(t)
+	start := time.Now().UTC()
+	runObjectStoreProducer(t, ObjectStoreConfig{
+		Bucket:         "archive",
+		Prefix:         "/hub/",
+		Partition:      "{project}/{output}/dt={YYYY-MM-DD}",
+		Format:         ObjectFormatParquet,
+		ProjectID:      "p1",
+		OutputID:       "o1",
+		ParquetColumns: parquetGoldenColumns,
+		S3:             S3Config{Endpoint: srv.URL, Region: "us-east-1", AccessKeyID: "AK", SecretAccessKey: "SK", PathStyle: true},
+		Encryption:     &ObjectEncryptionConfig{Type: "aws:kms", KMSKeyID: "alias/hub"},
+	}, parquetGoldenRows...)
+
+	got := objects()
+	if len(got) != 1 {
+		t.Fatalf("uploaded %d objects, want 1", len(got))
+	}
+	obj := got[0]
+	keyRegex := regexp.MustCompile(`^/archive/hub/p1/o1/dt=` + start.Format("2006-01-02") + `/\d{8}T\d{6}Z-[^/]*-000001\.parquet$`)
+	if !keyRegex.MatchString(obj.path) {
+		t.Errorf("object key %s does not match %s", obj.path, keyRegex)
+	}
+	if ct := obj.headers.Get("Content-Type"); ct != "application/vnd.apache.parquet" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if sse := obj.headers.Get("X-Amz-Server-Side-Encryption"); sse != "aws:kms" || obj.headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != "alias/hub" {
+		t.Errorf("server-side encryption headers = %v", obj.headers)
+	}
+	want, _ := EncodeParquet(parquetGoldenColumns, parquetGoldenRows, false)
+	if !bytes.Equal(obj.body, want) {
+		t.Errorf("object body differs from the encoded rows")
+	}
+}
+
+func TestObjectStoreGzipNDJSONObject(t *testing.T) {
+	srv, objects := fakeS3(t)
+	runObjectStoreProducer(t, ObjectStoreConfig{
+		Bucket:    "archive",
+		Compress:  true,
+		ProjectID: "p1",
+		OutputID:  "o1",
+		S3:        S3Config{Endpoint: srv.URL, Region: "us-east-1", AccessKeyID: "AK", SecretAccessKey: "SK", PathStyle: true},
+	}, map[string]interface{}{"a": 1}, map[string]interface{}{"b": "x"})
+
+	obj := objects()[0]
+	if !strings.HasSuffix(obj.path, ".ndjson.gz") || !strings.HasPrefix(obj.path, "/archive/p1/dt=") {
+		t.Errorf("object key %s", obj.path)
+	}
+	if obj.headers.Get("Content-Encoding") != "gzip" || obj.headers.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("headers = %v", obj.headers)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(obj.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, _ := io.ReadAll(zr)
+	if string(lines) != "{\"a\":1}\n{\"b\":\"x\"}\n" {
+		t.Errorf("object content %q", lines)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"AgentSmith-HUB/logger"
@@ -50,8 +51,8 @@ func RecordProjectOperation(operationType OperationType, projectID, status, erro
 		return
 	}
 
-	// Set TTL for the entire list to 31 days (31 * 24 * 60 * 60 = 2,678,400 seconds)
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -108,8 +109,8 @@ func RecordClusterInstruction(operationType OperationType, instructionType, comp
 		return
 	}
 
-	// Set TTL for the entire list to 31 days (31 * 24 * 60 * 60 = 2,678,400 seconds)
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -149,8 +150,8 @@ func RecordComponentAdd(componentType, componentID, content, status, errorMsg st
 		return
 	}
 
-	// Set TTL for the entire list to 31 days
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -190,8 +191,8 @@ func RecordComponentUpdate(componentType, componentID, content, status, errorMsg
 		return
 	}
 
-	// Set TTL for the entire list to 31 days
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -231,8 +232,8 @@ func RecordComponentDelete(componentType, componentID, status, errorMsg string,
 		return
 	}
 
-	// Set TTL for the entire list to 31 days
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -274,8 +275,8 @@ func RecordChangePush(componentType, componentID, oldContent, newContent, diff,
 		return
 	}
 
-	// Set TTL for the entire list to 31 days
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
@@ -315,14 +316,112 @@ func RecordLocalPush(componentType, componentID, content, status, errorMsg strin
 		return
 	}
 
-	// Set TTL for the entire list to 31 days
-	if err := RedisExpire("cluster:ops_history", 31*24*60*60); err != nil {
+	// Set TTL for the entire list to the operation history retention
+	if err := RedisExpire("cluster:ops_history", RetentionSeconds(RetentionOperationHistory)); err != nil {
 		logger.Warn("Failed to set TTL for operations history", "error", err)
 	}
 
 	logger.Info("Local push operation recorded", "type", componentType, "component", componentID, "status", status)
 }
 
+// Sampler access records go to their own list, so UI polling of samples never pushes
+// configuration changes out of the operations history
+const (
+	samplerAccessKey            = "cluster:sampler_access"
+	samplerAccessMaxRecords     = 5000
+	samplerAccessCoalesceWindow = time.Minute
+)
+
+type samplerAccessSeen struct {
+	recordedAt time.Time
+	repeats    int
+}
+
+var (
+	samplerAccessMu   sync.Mutex
+	samplerAccessLast = make(map[string]*samplerAccessSeen)
+)
+
+// coalesceSamplerAccess returns false for a read repeating the same identity, endpoint, node and
+// status within the coalesce window. Otherwise it returns true with the number of reads folded
+// into the previous record since it was written
+func coalesceSamplerAccess(key string, now time.Time) (bool, int) {
+	samplerAccessMu.Lock()
+	defer samplerAccessMu.Unlock()
+
+	if seen, ok := samplerAccessLast[key]; ok && now.Sub(seen.recordedAt) < samplerAccessCoalesceWindow {
+		seen.repeats++
+		return false, 0
+	}
+
+	repeats := 0
+	if seen, ok := samplerAccessLast[key]; ok {
+		repeats = seen.repeats
+	}
+	samplerAccessLast[key] = &samplerAccessSeen{recordedAt: now}
+
+	// Forget identities that stopped polling
+	if len(samplerAccessLast) > samplerAccessMaxRecords {
+		for k, seen := range samplerAccessLast {
+			if now.Sub(seen.recordedAt) >= samplerAccessCoalesceWindow {
+				delete(samplerAccessLast, k)
+			}
+		}
+	}
+	return true, repeats
+}
+
+// RecordSamplerAccess records a read of sampled events, status is success or denied.
+// Repeated reads of the same identity, endpoint and node within a minute are coalesced, the next
+// record carries their count in "repeats"
+func RecordSamplerAccess(authType, identity, endpoint, componentType, nodeSequence, remoteIP, status string) {
+	now := time.Now()
+	record, repeats := coalesceSamplerAccess(strings.Join([]string{authType, identity, endpoint, componentType, nodeSequence, status}, "\x00"), now)
+	if !record {
+		return
+	}
+
+	details := map[string]interface{}{
+		"node_id":      Config.LocalIP,
+		"node_address": Config.LocalIP,
+		"executed_by":  Config.LocalIP,
+		"auth_type":    authType,
+		"identity":     identity,
+		"endpoint":     endpoint,
+		"remote_ip":    remoteIP,
+	}
+	if repeats > 0 {
+		details["repeats"] = repeats
+	}
+
+	op := OperationRecord{
+		Type:          OpTypeSamplerAccess,
+		Timestamp:     now,
+		ComponentType: componentType,
+		ComponentID:   nodeSequence,
+		Status:        status,
+		Details:       details,
+	}
+	if status != "success" {
+		op.Error = "sampler access denied"
+	}
+
+	jsonData, err := json.Marshal(op)
+	if err != nil {
+		logger.Error("Failed to marshal sampler access record", "identity", identity, "error", err)
+		return
+	}
+
+	if err := RedisLPush(samplerAccessKey, string(jsonData), samplerAccessMaxRecords); err != nil {
+		logger.Error("Failed to record sampler access to Redis", "identity", identity, "error", err)
+		return
+	}
+
+	if err := RedisExpire(samplerAccessKey, RetentionSeconds(RetentionOperationHistory)); err != nil {
+		logger.Warn("Failed to set TTL for sampler access history", "error", err)
+	}
+}
+
 // StartComponentUpdate starts a new component update operation
 func (cum *ComponentUpdateManager) StartComponentUpdate(componentType, componentID string, affectedProjects []string) (*ComponentUpdateOperation, error) {
 	cum.mutex.Lock()
@@ -451,11 +550,18 @@ type OperationHistoryFilter struct {
 
 // GetOperationsFromRedisWithFilter retrieves operations from Redis with server-side filtering and pagination
 func GetOperationsFromRedisWithFilter(filter OperationHistoryFilter) ([]OperationRecord, int, error) {
-	// Read all operations from Redis
-	redisLines, err := RedisLRange("cluster:ops_history", 0, -1)
-	if err != nil {
-		logger.Error("Failed to read operations from Redis", "error", err)
-		return []OperationRecord{}, 0, err
+	// Read all operations from Redis, sampler accesses are kept in their own list
+	var redisLines []string
+	for _, key := range []string{"cluster:ops_history", samplerAccessKey} {
+		if filter.OperationType != "" && (filter.OperationType == OpTypeSamplerAccess) != (key == samplerAccessKey) {
+			continue
+		}
+		lines, err := RedisLRange(key, 0, -1)
+		if err != nil {
+			logger.Error("Failed to read operations from Redis", "key", key, "error", err)
+			return []OperationRecord{}, 0, err
+		}
+		redisLines = append(redisLines, lines...)
 	}
 
 	var filteredOperations []OperationRecord
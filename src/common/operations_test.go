@@ -0,0 +1,60 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplerAccessKeptOutOfOperationsHistory(t *testing.T) {
+	useTestRedis(t)
+	prevConfig := Config
+	Config = &HubConfig{LocalIP: "10.0.0.9"}
+	t.Cleanup(func() {
+		Config = prevConfig
+		samplerAccessMu.Lock()
+		samplerAccessLast = make(map[string]*samplerAccessSeen)
+		samplerAccessMu.Unlock()
+	})
+
+	if err := RedisLPush("cluster:ops_history", `{"type":"change_push","timestamp":"2024-01-15T10:00:00Z","status":"success"}`, 10000); err != nil {
+		t.Fatal(err)
+	}
+
+	// A UI polling samples every second writes one record per minute, not one per read
+	for i := 0; i < 30; i++ {
+		RecordSamplerAccess("oidc", "alice", "/samplers/data", "ruleset", "INPUT.in.RULESET.r", "10.0.0.1", "success")
+	}
+	RecordSamplerAccess("oidc", "alice", "/samplers/data", "ruleset", "INPUT.in.RULESET.r", "10.0.0.1", "denied")
+
+	history, err := RedisLRange("cluster:ops_history", 0, -1)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("operations history = %v %v, want only the change push", history, err)
+	}
+	accesses, err := RedisLRange(samplerAccessKey, 0, -1)
+	if err != nil || len(accesses) != 2 {
+		t.Fatalf("sampler access records = %d %v, want 2", len(accesses), err)
+	}
+
+	ops, total, err := GetOperationsFromRedisWithFilter(OperationHistoryFilter{OperationType: OpTypeSamplerAccess, Limit: 10})
+	if err != nil || total != 2 || ops[0].Type != OpTypeSamplerAccess {
+		t.Fatalf("sampler access filter = %d %v", total, err)
+	}
+	if _, total, _ = GetOperationsFromRedisWithFilter(OperationHistoryFilter{Limit: 10}); total != 3 {
+		t.Fatalf("unfiltered history = %d records, want 3", total)
+	}
+
+	// Once the window has passed, the next record carries the reads folded into the previous one
+	samplerAccessMu.Lock()
+	for _, seen := range samplerAccessLast {
+		seen.recordedAt = seen.recordedAt.Add(-samplerAccessCoalesceWindow)
+	}
+	samplerAccessMu.Unlock()
+	RecordSamplerAccess("oidc", "alice", "/samplers/data", "ruleset", "INPUT.in.RULESET.r", "10.0.0.1", "success")
+	ops, _, _ = GetOperationsFromRedisWithFilter(OperationHistoryFilter{OperationType: OpTypeSamplerAccess, Status: "success", Limit: 10})
+	if len(ops) != 2 || ops[0].Details["repeats"] != float64(29) {
+		t.Fatalf("latest sampler access record %+v, want 29 repeats", ops)
+	}
+	if ops[0].Timestamp.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("unexpected timestamp %v", ops[0].Timestamp)
+	}
+}
@@ -0,0 +1,700 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	otlpGRPCLogsPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpHTTPLogsPath = "/v1/logs"
+
+	defaultOTLPMaxMessageSize = 16 * 1024 * 1024
+	otlpEnqueueTimeout        = 5 * time.Second
+)
+
+var errOTLPBusy = errors.New("pipeline is busy")
+
+// OTLPReceiver implements the OTLP logs receiver over gRPC and HTTP (protobuf and JSON encodings)
+type OTLPReceiver struct {
+	MsgChan chan map[string]interface{}
+
+	grpcListen     string
+	httpListen     string
+	maxMessageSize int64
+
+	servers []*http.Server
+
+	receivedTotal uint64
+	rejectedTotal uint64
+}
+
+// NewOTLPReceiver creates an OTLP logs receiver. At least one of grpcListen and httpListen must be set.
+func NewOTLPReceiver(grpcListen, httpListen string, maxMessageSize int64, msgChan chan map[string]interface{}) (*OTLPReceiver, error) {
+	if grpcListen == "" && httpListen == "" {
+		return nil, fmt.Errorf("otlp receiver requires grpc_listen or http_listen")
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultOTLPMaxMessageSize
+	}
+	return &OTLPReceiver{
+		MsgChan:        msgChan,
+		grpcListen:     grpcListen,
+		httpListen:     httpListen,
+		maxMessageSize: maxMessageSize,
+	}, nil
+}
+
+// Start binds the configured listeners and serves requests in the background
+func (r *OTLPReceiver) Start() error {
+	listeners := make(map[string]net.Listener)
+	for _, addr := range []string{r.grpcListen, r.httpListen} {
+		if addr == "" || listeners[addr] != nil {
+			continue
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners[addr] = ln
+	}
+
+	for addr, ln := range listeners {
+		// h2c lets gRPC clients use HTTP/2 without TLS while plain HTTP/1.1 clients keep working
+		srv := &http.Server{
+			Handler:           h2c.NewHandler(http.HandlerFunc(r.handle), &http2.Server{}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		r.servers = append(r.servers, srv)
+		go func(addr string, ln net.Listener) {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("OTLP receiver stopped unexpectedly", "listen", addr, "error", err)
+			}
+		}(addr, ln)
+		logger.Info("OTLP logs receiver listening", "listen", addr)
+	}
+	return nil
+}
+
+// Close shuts down all listeners, waiting briefly for in-flight requests
+func (r *OTLPReceiver) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range r.servers {
+		_ = srv.Shutdown(ctx)
+	}
+	r.servers = nil
+}
+
+// GetReceivedTotal returns the number of log records received
+func (r *OTLPReceiver) GetReceivedTotal() uint64 {
+	return atomic.LoadUint64(&r.receivedTotal)
+}
+
+// GetRejectedTotal returns the number of requests rejected because of decoding errors or backpressure
+func (r *OTLPReceiver) GetRejectedTotal() uint64 {
+	return atomic.LoadUint64(&r.rejectedTotal)
+}
+
+func (r *OTLPReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	switch {
+	case req.URL.Path == otlpGRPCLogsPath && strings.HasPrefix(contentType, "application/grpc"):
+		r.handleGRPC(w, req)
+	case req.URL.Path == otlpHTTPLogsPath:
+		r.handleHTTP(w, req, contentType)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *OTLPReceiver) handleHTTP(w http.ResponseWriter, req *http.Request, contentType string) {
+	var body io.Reader = http.MaxBytesReader(w, req.Body, r.maxMessageSize)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			atomic.AddUint64(&r.rejectedTotal, 1)
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, r.maxMessageSize)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	var records []map[string]interface{}
+	if strings.HasPrefix(contentType, "application/json") {
+		records, err = decodeOTLPLogsJSON(data)
+		contentType = "application/json"
+	} else {
+		records, err = decodeOTLPLogsProto(data)
+		contentType = "application/x-protobuf"
+	}
+	if err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := r.enqueue(req.Context(), records); err != nil {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		// 503 is retryable for OTLP exporters
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Empty ExportLogsServiceResponse
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if contentType == "application/json" {
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+// handleGRPC serves the unary LogsService/Export method using gRPC length-prefixed framing
+func (r *OTLPReceiver) handleGRPC(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	fail := func(code int, msg string) {
+		atomic.AddUint64(&r.rejectedTotal, 1)
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", msg)
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(req.Body, header); err != nil {
+		fail(13, "failed to read grpc frame")
+		return
+	}
+	compressed := header[0] == 1
+	size := int64(binary.BigEndian.Uint32(header[1:]))
+	if size > r.maxMessageSize {
+		fail(8, "message larger than max size")
+		return
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(req.Body, data); err != nil {
+		fail(13, "failed to read grpc message")
+		return
+	}
+	if compressed {
+		if req.Header.Get("Grpc-Encoding") != "gzip" {
+			fail(12, "unsupported grpc-encoding")
+			return
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			fail(3, "invalid gzip message")
+			return
+		}
+		data, err = io.ReadAll(io.LimitReader(gz, r.maxMessageSize))
+		gz.Close()
+		if err != nil {
+			fail(3, "invalid gzip message")
+			return
+		}
+	}
+
+	records, err := decodeOTLPLogsProto(data)
+	if err != nil {
+		fail(3, err.Error()) // INVALID_ARGUMENT
+		return
+	}
+	if err := r.enqueue(req.Context(), records); err != nil {
+		fail(14, err.Error()) // UNAVAILABLE, retried by the collector
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	// Empty ExportLogsServiceResponse frame
+	_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+	w.Header().Set("Grpc-Status", "0")
+	w.Header().Set("Grpc-Message", "")
+}
+
+func (r *OTLPReceiver) enqueue(ctx context.Context, records []map[string]interface{}) error {
+	timeout := time.NewTimer(otlpEnqueueTimeout)
+	defer timeout.Stop()
+	for _, rec := range records {
+		select {
+		case r.MsgChan <- rec:
+			atomic.AddUint64(&r.receivedTotal, 1)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errOTLPBusy
+		}
+	}
+	return nil
+}
+
+// ===================== Protobuf decoding =====================
+// Field numbers follow opentelemetry/proto/logs/v1/logs.proto and common/v1/common.proto
+
+type otlpScope struct {
+	name       string
+	version    string
+	attributes map[string]interface{}
+}
+
+func decodeOTLPLogsProto(b []byte) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			rs, err := decodeResourceLogs(v)
+			if err != nil {
+				return err
+			}
+			records = append(records, rs...)
+		}
+		return nil
+	})
+	return records, err
+}
+
+func decodeResourceLogs(b []byte) ([]map[string]interface{}, error) {
+	resource := make(map[string]interface{})
+	var scopeLogs [][]byte
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1: // Resource
+			return walkProto(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 && typ == protowire.BytesType {
+					return decodeKeyValue(v, resource)
+				}
+				return nil
+			})
+		case 2: // ScopeLogs
+			scopeLogs = append(scopeLogs, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+	for _, sl := range scopeLogs {
+		scope := otlpScope{attributes: make(map[string]interface{})}
+		var logRecords [][]byte
+		err := walkProto(sl, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+			if typ != protowire.BytesType {
+				return nil
+			}
+			switch num {
+			case 1: // InstrumentationScope
+				return walkProto(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+					switch num {
+					case 1:
+						scope.name = string(v)
+					case 2:
+						scope.version = string(v)
+					case 3:
+						return decodeKeyValue(v, scope.attributes)
+					}
+					return nil
+				})
+			case 2:
+				logRecords = append(logRecords, v)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, lr := range logRecords {
+			rec, err := decodeLogRecord(lr)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, buildOTLPEvent(rec, resource, scope))
+		}
+	}
+	return records, nil
+}
+
+func decodeLogRecord(b []byte) (map[string]interface{}, error) {
+	rec := make(map[string]interface{})
+	attrs := make(map[string]interface{})
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			rec["time_unix_nano"] = scalar
+		case 11:
+			rec["observed_time_unix_nano"] = scalar
+		case 2:
+			rec["severity_number"] = int64(scalar)
+		case 3:
+			rec["severity_text"] = string(v)
+		case 5:
+			val, err := decodeAnyValue(v)
+			if err != nil {
+				return err
+			}
+			rec["body"] = val
+		case 6:
+			return decodeKeyValue(v, attrs)
+		case 8:
+			rec["flags"] = int64(scalar)
+		case 9:
+			if len(v) > 0 {
+				rec["trace_id"] = hex.EncodeToString(v)
+			}
+		case 10:
+			if len(v) > 0 {
+				rec["span_id"] = hex.EncodeToString(v)
+			}
+		case 12:
+			rec["event_name"] = string(v)
+		}
+		return nil
+	})
+	rec["attributes"] = attrs
+	return rec, err
+}
+
+func decodeKeyValue(b []byte, into map[string]interface{}) error {
+	var key string
+	var value interface{}
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			val, err := decodeAnyValue(v)
+			if err != nil {
+				return err
+			}
+			value = val
+		}
+		return nil
+	})
+	if err == nil && key != "" {
+		into[key] = value
+	}
+	return err
+}
+
+func decodeAnyValue(b []byte) (interface{}, error) {
+	var value interface{}
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			value = string(v)
+		case 2:
+			value = scalar != 0
+		case 3:
+			value = int64(scalar)
+		case 4:
+			value = math.Float64frombits(scalar)
+		case 5: // ArrayValue
+			arr := make([]interface{}, 0)
+			err := walkProto(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 {
+					item, err := decodeAnyValue(v)
+					if err != nil {
+						return err
+					}
+					arr = append(arr, item)
+				}
+				return nil
+			})
+			value = arr
+			return err
+		case 6: // KeyValueList
+			kv := make(map[string]interface{})
+			err := walkProto(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 {
+					return decodeKeyValue(v, kv)
+				}
+				return nil
+			})
+			value = kv
+			return err
+		case 7:
+			value = base64.StdEncoding.EncodeToString(v)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// walkProto iterates over the fields of a protobuf message, passing length-delimited
+// payloads as v and varint/fixed values as scalar
+func walkProto(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, scalar uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("invalid otlp protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		var scalar uint64
+		switch typ {
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			scalar, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var s32 uint32
+			s32, n = protowire.ConsumeFixed32(b)
+			scalar = uint64(s32)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid otlp protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ===================== JSON decoding =====================
+
+type otlpJSONAnyValue struct {
+	StringValue *string             `json:"stringValue"`
+	BoolValue   *bool               `json:"boolValue"`
+	IntValue    json.RawMessage     `json:"intValue"` // int64 is encoded as string in OTLP/JSON
+	DoubleValue *float64            `json:"doubleValue"`
+	ArrayValue  *otlpJSONArrayValue `json:"arrayValue"`
+	KvlistValue *otlpJSONKvList     `json:"kvlistValue"`
+	BytesValue  *string             `json:"bytesValue"`
+}
+
+type otlpJSONArrayValue struct {
+	Values []otlpJSONAnyValue `json:"values"`
+}
+
+type otlpJSONKvList struct {
+	Values []otlpJSONKeyValue `json:"values"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name       string             `json:"name"`
+				Version    string             `json:"version"`
+				Attributes []otlpJSONKeyValue `json:"attributes"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano         json.Number        `json:"timeUnixNano"`
+				ObservedTimeUnixNano json.Number        `json:"observedTimeUnixNano"`
+				SeverityNumber       int64              `json:"severityNumber"`
+				SeverityText         string             `json:"severityText"`
+				Body                 *otlpJSONAnyValue  `json:"body"`
+				Attributes           []otlpJSONKeyValue `json:"attributes"`
+				Flags                int64              `json:"flags"`
+				TraceID              string             `json:"traceId"`
+				SpanID               string             `json:"spanId"`
+				EventName            string             `json:"eventName"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+func decodeOTLPLogsJSON(data []byte) ([]map[string]interface{}, error) {
+	var req otlpJSONRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid otlp json: %w", err)
+	}
+
+	var records []map[string]interface{}
+	for _, rl := range req.ResourceLogs {
+		resource := jsonKeyValues(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			scope := otlpScope{
+				name:       sl.Scope.Name,
+				version:    sl.Scope.Version,
+				attributes: jsonKeyValues(sl.Scope.Attributes),
+			}
+			for _, lr := range sl.LogRecords {
+				rec := map[string]interface{}{
+					"severity_number": lr.SeverityNumber,
+					"severity_text":   lr.SeverityText,
+					"attributes":      jsonKeyValues(lr.Attributes),
+					"flags":           lr.Flags,
+				}
+				if ts, err := strconv.ParseUint(lr.TimeUnixNano.String(), 10, 64); err == nil {
+					rec["time_unix_nano"] = ts
+				}
+				if ts, err := strconv.ParseUint(lr.ObservedTimeUnixNano.String(), 10, 64); err == nil {
+					rec["observed_time_unix_nano"] = ts
+				}
+				if lr.Body != nil {
+					rec["body"] = jsonAnyValue(*lr.Body)
+				}
+				if lr.TraceID != "" {
+					rec["trace_id"] = strings.ToLower(lr.TraceID)
+				}
+				if lr.SpanID != "" {
+					rec["span_id"] = strings.ToLower(lr.SpanID)
+				}
+				if lr.EventName != "" {
+					rec["event_name"] = lr.EventName
+				}
+				records = append(records, buildOTLPEvent(rec, resource, scope))
+			}
+		}
+	}
+	return records, nil
+}
+
+func jsonKeyValues(kvs []otlpJSONKeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = jsonAnyValue(kv.Value)
+	}
+	return m
+}
+
+func jsonAnyValue(v otlpJSONAnyValue) interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case len(v.IntValue) > 0:
+		i, err := strconv.ParseInt(strings.Trim(string(v.IntValue), `"`), 10, 64)
+		if err != nil {
+			return string(v.IntValue)
+		}
+		return i
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		arr := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			arr = append(arr, jsonAnyValue(item))
+		}
+		return arr
+	case v.KvlistValue != nil:
+		return jsonKeyValues(v.KvlistValue.Values)
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	}
+	return nil
+}
+
+// ===================== Event mapping =====================
+
+// buildOTLPEvent maps a decoded log record into a hub event. Dotted attribute keys such as
+// service.name are expanded into nested maps so rules can address them as resource.service.name.
+func buildOTLPEvent(rec map[string]interface{}, resource map[string]interface{}, scope otlpScope) map[string]interface{} {
+	event := make(map[string]interface{}, 12)
+
+	for _, k := range []string{"severity_number", "severity_text", "body", "flags", "trace_id", "span_id", "event_name"} {
+		if v, ok := rec[k]; ok {
+			event[k] = v
+		}
+	}
+	if ts, ok := rec["time_unix_nano"].(uint64); ok && ts > 0 {
+		event["timestamp"] = time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano)
+	}
+	if ts, ok := rec["observed_time_unix_nano"].(uint64); ok && ts > 0 {
+		event["observed_timestamp"] = time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano)
+	}
+	if attrs, ok := rec["attributes"].(map[string]interface{}); ok {
+		event["attributes"] = expandDottedKeys(attrs)
+	}
+
+	event["resource"] = expandDottedKeys(resource)
+
+	scopeMap := map[string]interface{}{
+		"name":       scope.name,
+		"version":    scope.version,
+		"attributes": expandDottedKeys(scope.attributes),
+	}
+	event["scope"] = scopeMap
+
+	return event
+}
+
+func expandDottedKeys(attrs map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(attrs))
+	for key, value := range attrs {
+		parts := strings.Split(key, ".")
+		cur := out
+		ok := true
+		for _, part := range parts[:len(parts)-1] {
+			next, exists := cur[part]
+			if !exists {
+				m := make(map[string]interface{})
+				cur[part] = m
+				cur = m
+				continue
+			}
+			m, isMap := next.(map[string]interface{})
+			if !isMap {
+				// Conflicts with a scalar value, keep the original key flat
+				ok = false
+				break
+			}
+			cur = m
+		}
+		if ok {
+			if _, exists := cur[parts[len(parts)-1]]; !exists {
+				cur[parts[len(parts)-1]] = value
+				continue
+			}
+		}
+		out[key] = value
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// otlpGoldenRequest is an ExportLogsServiceRequest encoded field by field following
+// opentelemetry/proto/collector/logs/v1, independently of the decoder under test
+var otlpGoldenRequest = strings.Join([]string{
+	"0a9501", // resource_logs
+	"0a18",   // . resource
+	"0a16",   // . . attributes
+	"0a0c" + hex.EncodeToString([]byte("service.name")) + "1206" + "0a04" + hex.EncodeToString([]byte("auth")),
+	"1279", // . scope_logs
+	"0a0a", // . . scope
+	"0a03" + hex.EncodeToString([]byte("lib")) + "1203" + hex.EncodeToString([]byte("1.0")),
+	"126b",               // . . log_records
+	"0900002a36fe9c9717", // . . . time_unix_nano, fixed64
+	"1011",               // . . . severity_number
+	"1a05" + hex.EncodeToString([]byte("ERROR")),
+	"2a0e" + "0a0c" + hex.EncodeToString([]byte("login failed")),                                       // . . . body
+	"320d" + "0a07" + hex.EncodeToString([]byte("user.id")) + "1202" + "182a",                          // . . . attributes, int_value
+	"3213" + "0a04" + hex.EncodeToString([]byte("tags")) + "120b" + "2a09" + "0a030a0161" + "0a021001", // . . . attributes, array_value
+	"4a10" + "0102030405060708090a0b0c0d0e0f10",                                                        // . . . trace_id
+	"5208" + "0102030405060708",                                                                        // . . . span_id
+	"590065f753fe9c9717",                                                                               // . . . observed_time_unix_nano, fixed64
+}, "")
+
+func otlpGoldenEvent() map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp":          "2023-11-14T22:13:20Z",
+		"observed_timestamp": "2023-11-14T22:13:20.5Z",
+		"severity_number":    int64(17),
+		"severity_text":      "ERROR",
+		"body":               "login failed",
+		"trace_id":           "0102030405060708090a0b0c0d0e0f10",
+		"span_id":            "0102030405060708",
+		"attributes": map[string]interface{}{
+			"user": map[string]interface{}{"id": int64(42)},
+			"tags": []interface{}{"a", true},
+		},
+		"resource": map[string]interface{}{
+			"service": map[string]interface{}{"name": "auth"},
+		},
+		"scope": map[string]interface{}{
+			"name":       "lib",
+			"version":    "1.0",
+			"attributes": map[string]interface{}{},
+		},
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOTLPProtoGoldenDecode(t *testing.T) {
+	golden := mustHex(t, otlpGoldenRequest)
+	records, err := decodeOTLPLogsProto(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !reflect.DeepEqual(records[0], otlpGoldenEvent()) {
+		t.Fatalf("decoded %#v\nwant %#v", records, otlpGoldenEvent())
+	}
+
+	// Every truncation of the request is rejected rather than decoded partially
+	for _, n := range []int{2, 20, len(golden) - 1} {
+		if _, err := decodeOTLPLogsProto(golden[:n]); err == nil {
+			t.Errorf("request truncated to %d bytes decoded", n)
+		}
+	}
+}
+
+func TestOTLPJSONMatchesProto(t *testing.T) {
+	body := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"auth"}}]},
+		"scopeLogs":[{"scope":{"name":"lib","version":"1.0"},"logRecords":[{
+			"timeUnixNano":"1700000000000000000","observedTimeUnixNano":"1700000000500000000",
+			"severityNumber":17,"severityText":"ERROR","body":{"stringValue":"login failed"},
+			"attributes":[{"key":"user.id","value":{"intValue":"42"}},
+				{"key":"tags","value":{"arrayValue":{"values":[{"stringValue":"a"},{"boolValue":true}]}}}],
+			"traceId":"0102030405060708090A0B0C0D0E0F10","spanId":"0102030405060708"}]}]}]}`
+	records, err := decodeOTLPLogsJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := otlpGoldenEvent()
+	want["flags"] = int64(0) // always present in JSON, omitted from protobuf when zero
+	if len(records) != 1 || !reflect.DeepEqual(records[0], want) {
+		t.Fatalf("decoded %#v\nwant %#v", records, want)
+	}
+}
+
+// startOTLPReceiver starts a receiver with a gRPC listener on a free local port
+func startOTLPReceiver(t *testing.T, msgChan chan map[string]interface{}) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	r, err := NewOTLPReceiver(addr, "", 0, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return addr
+}
+
+// h2cClient speaks HTTP/2 with prior knowledge over plain TCP, like a gRPC client without TLS
+func h2cClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func exportGRPC(t *testing.T, addr string, message []byte) (*http.Response, []byte) {
+	t.Helper()
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+otlpGRPCLogsPath, strings.NewReader(string(frame)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := h2cClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Trailers are only populated once the body is read
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("response over HTTP/%d.%d, want h2c", resp.ProtoMajor, resp.ProtoMinor)
+	}
+	return resp, body
+}
+
+func TestOTLPGRPCOverH2C(t *testing.T) {
+	msgChan := make(chan map[string]interface{}, 4)
+	addr := startOTLPReceiver(t, msgChan)
+
+	resp, body := exportGRPC(t, addr, mustHex(t, otlpGoldenRequest))
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("grpc-status = %q, message %q", status, resp.Trailer.Get("Grpc-Message"))
+	}
+	// An uncompressed, empty ExportLogsServiceResponse
+	if want := []byte{0, 0, 0, 0, 0}; !reflect.DeepEqual(body, want) {
+		t.Fatalf("response frame = %x, want %x", body, want)
+	}
+	select {
+	case event := <-msgChan:
+		if !reflect.DeepEqual(event, otlpGoldenEvent()) {
+			t.Fatalf("received %#v", event)
+		}
+	default:
+		t.Fatal("no event received")
+	}
+
+	resp, _ = exportGRPC(t, addr, mustHex(t, otlpGoldenRequest)[:20])
+	if status := resp.Trailer.Get("Grpc-Status"); status != "3" {
+		t.Fatalf("grpc-status of a malformed request = %q, want 3 (INVALID_ARGUMENT)", status)
+	}
+}
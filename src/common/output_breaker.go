@@ -0,0 +1,279 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open" // one probe request is let through
+
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 10 * time.Second
+	defaultBreakerMaxOpenTimeout   = 5 * time.Minute
+)
+
+// OutputBreakerConfig configures the circuit breaker of an output
+type OutputBreakerConfig struct {
+	Disabled         bool   `yaml:"disabled,omitempty"`
+	FailureThreshold int    `yaml:"failure_threshold,omitempty"` // consecutive failed requests that open the breaker, default 5
+	OpenTimeout      string `yaml:"open_timeout,omitempty"`      // wait before the first probe, default 10s
+	MaxOpenTimeout   string `yaml:"max_open_timeout,omitempty"`  // the wait doubles after every failed probe up to this, default 5m
+}
+
+// Validate checks the durations of a breaker config
+func (c *OutputBreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failure_threshold must not be negative")
+	}
+	for name, v := range map[string]string{"open_timeout": c.OpenTimeout, "max_open_timeout": c.MaxOpenTimeout} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q, expected a duration like 30s", name, v)
+		}
+	}
+	return nil
+}
+
+// OutputBreakerStatus is the state of an output circuit breaker
+type OutputBreakerStatus struct {
+	Output              string     `json:"output"`
+	ProjectNodeSequence string     `json:"project_node_sequence"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Trips               uint64     `json:"trips"`
+	Rejected            uint64     `json:"rejected"` // requests failed without being sent while open
+	OpenTimeout         string     `json:"open_timeout"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	LastTransition      *time.Time `json:"last_transition,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// OutputBreaker stops a producer from sending to a destination that keeps failing.
+// After failure_threshold consecutive failures it opens and requests fail immediately, so batches
+// do not pile up behind retries. After open_timeout one probe is let through: success closes the
+// breaker, failure opens it again with the timeout doubled. A nil breaker allows everything.
+type OutputBreaker struct {
+	output   string
+	sequence string
+
+	threshold  int
+	baseOpen   time.Duration
+	maxOpen    time.Duration
+	mu         sync.Mutex
+	state      string
+	failures   int
+	openFor    time.Duration
+	retryAt    time.Time
+	probing    bool
+	trips      uint64
+	rejected   uint64
+	lastError  string
+	transition time.Time
+}
+
+// NewOutputBreaker creates the breaker of an output instance, nil if it is disabled
+func NewOutputBreaker(output, projectNodeSequence string, cfg *OutputBreakerConfig) *OutputBreaker {
+	b := &OutputBreaker{
+		output:    output,
+		sequence:  projectNodeSequence,
+		threshold: defaultBreakerFailureThreshold,
+		baseOpen:  defaultBreakerOpenTimeout,
+		maxOpen:   defaultBreakerMaxOpenTimeout,
+		state:     BreakerClosed,
+	}
+	if cfg != nil {
+		if cfg.Disabled {
+			return nil
+		}
+		if cfg.FailureThreshold > 0 {
+			b.threshold = cfg.FailureThreshold
+		}
+		if d, err := time.ParseDuration(cfg.OpenTimeout); err == nil && d > 0 {
+			b.baseOpen = d
+		}
+		if d, err := time.ParseDuration(cfg.MaxOpenTimeout); err == nil && d > 0 {
+			b.maxOpen = d
+		}
+	}
+	if b.maxOpen < b.baseOpen {
+		b.maxOpen = b.baseOpen
+	}
+	b.openFor = b.baseOpen
+	return b
+}
+
+// Allow reports whether a request may be sent now. In the half-open state only the probe is allowed.
+func (b *OutputBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Now().Before(b.retryAt) {
+			b.rejected++
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	default:
+		if b.probing {
+			b.rejected++
+			return false
+		}
+		b.probing = true
+		return true
+	}
+}
+
+// Success records a request the destination accepted
+func (b *OutputBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	if b.state != BreakerClosed {
+		b.openFor = b.baseOpen
+		b.setState(BreakerClosed)
+		logger.Info("Output circuit breaker closed, destination recovered", "output", b.output, "project_node_sequence", b.sequence)
+	}
+}
+
+// Failure records a request that failed because of the destination
+func (b *OutputBreaker) Failure(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if err != nil {
+		b.lastError = truncateRunes(err.Error(), 512)
+	}
+	switch b.state {
+	case BreakerClosed:
+		if b.failures < b.threshold {
+			return
+		}
+		b.trips++
+		b.open()
+		logger.Warn("Output circuit breaker opened", "output", b.output, "project_node_sequence", b.sequence,
+			"failures", b.failures, "retry_in", b.openFor, "error", b.lastError)
+	case BreakerHalfOpen:
+		// The probe failed, wait longer before the next one
+		b.probing = false
+		b.openFor = min(b.openFor*2, b.maxOpen)
+		b.open()
+		logger.Warn("Output circuit breaker probe failed", "output", b.output, "project_node_sequence", b.sequence,
+			"retry_in", b.openFor, "error", b.lastError)
+	}
+}
+
+// open must be called with mu held
+func (b *OutputBreaker) open() {
+	b.retryAt = time.Now().Add(b.openFor)
+	b.setState(BreakerOpen)
+}
+
+// setState must be called with mu held
+func (b *OutputBreaker) setState(state string) {
+	b.state = state
+	b.transition = time.Now()
+}
+
+// State returns closed, open or half_open, closed for a nil breaker
+func (b *OutputBreaker) State() string {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status returns a snapshot of the breaker
+func (b *OutputBreaker) Status() OutputBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := OutputBreakerStatus{
+		Output:              b.output,
+		ProjectNodeSequence: b.sequence,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+		Rejected:            b.rejected,
+		OpenTimeout:         b.openFor.String(),
+		LastError:           b.lastError,
+	}
+	if b.state == BreakerOpen {
+		retryAt := b.retryAt
+		s.RetryAt = &retryAt
+	}
+	if !b.transition.IsZero() {
+		transition := b.transition
+		s.LastTransition = &transition
+	}
+	return s
+}
+
+var (
+	outputBreakersMu sync.RWMutex
+	outputBreakers   = make(map[*OutputBreaker]struct{})
+)
+
+// RegisterOutputBreaker makes a breaker visible to component monitoring
+func RegisterOutputBreaker(b *OutputBreaker) {
+	if b == nil {
+		return
+	}
+	outputBreakersMu.Lock()
+	outputBreakers[b] = struct{}{}
+	outputBreakersMu.Unlock()
+}
+
+// UnregisterOutputBreaker removes the breaker of a stopped output
+func UnregisterOutputBreaker(b *OutputBreaker) {
+	if b == nil {
+		return
+	}
+	outputBreakersMu.Lock()
+	delete(outputBreakers, b)
+	outputBreakersMu.Unlock()
+}
+
+// GetOutputBreakerStatuses returns the breakers of the running outputs on this node,
+// only the ones not closed when onlyTripped is set
+func GetOutputBreakerStatuses(onlyTripped bool) []OutputBreakerStatus {
+	outputBreakersMu.RLock()
+	list := make([]OutputBreakerStatus, 0, len(outputBreakers))
+	for b := range outputBreakers {
+		s := b.Status()
+		if onlyTripped && s.State == BreakerClosed {
+			continue
+		}
+		list = append(list, s)
+	}
+	outputBreakersMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Output != list[j].Output {
+			return list[i].Output < list[j].Output
+		}
+		return list[i].ProjectNodeSequence < list[j].ProjectNodeSequence
+	})
+	return list
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	outputCaptureKeyPrefix = "hub:output_capture:"
+	maxOutputCaptures      = 100
+	outputCaptureTTL       = 3600 // seconds
+)
+
+// CapturedPayload is an event serialized exactly as an output would send it, stored for
+// inspection instead of being delivered
+type CapturedPayload struct {
+	OutputType      string            `json:"output_type"`
+	Target          string            `json:"target"` // topic, index or URL the payload is addressed to
+	Method          string            `json:"method,omitempty"`
+	Key             string            `json:"key,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Body            string            `json:"body"`
+	Base64          bool              `json:"base64,omitempty"` // body is base64 encoded because it is binary
+	CapturedAt      time.Time         `json:"captured_at"`
+}
+
+// NewCapturedPayload returns a capture of body, base64 encoding it unless it is valid UTF-8 text
+func NewCapturedPayload(target string, body []byte) *CapturedPayload {
+	c := &CapturedPayload{Target: target, CapturedAt: time.Now().UTC()}
+	if utf8.Valid(body) {
+		c.Body = string(body)
+	} else {
+		c.Body = base64.StdEncoding.EncodeToString(body)
+		c.Base64 = true
+	}
+	return c
+}
+
+// StoreOutputCapture keeps the capture in the list of the output, newest first. The list
+// holds the last 100 captures and expires an hour after the last one.
+func StoreOutputCapture(outputID string, c *CapturedPayload) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode capture: %w", err)
+	}
+	key := outputCaptureKeyPrefix + outputID
+	if err := RedisLPush(key, string(data), maxOutputCaptures); err != nil {
+		return err
+	}
+	return RedisExpire(key, outputCaptureTTL)
+}
+
+// GetOutputCaptures returns the stored captures of an output, newest first
+func GetOutputCaptures(outputID string) ([]CapturedPayload, error) {
+	items, err := RedisLRange(outputCaptureKeyPrefix+outputID, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	captures := make([]CapturedPayload, 0, len(items))
+	for _, item := range items {
+		var c CapturedPayload
+		if err := json.Unmarshal([]byte(item), &c); err != nil {
+			continue
+		}
+		captures = append(captures, c)
+	}
+	return captures, nil
+}
+
+// ClearOutputCaptures deletes the stored captures of an output
+func ClearOutputCaptures(outputID string) error {
+	return RedisDel(outputCaptureKeyPrefix + outputID)
+}
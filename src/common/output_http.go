@@ -0,0 +1,141 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// OutputProxyNone disables the proxy of an output, including the one from HTTP_PROXY/HTTPS_PROXY
+const OutputProxyNone = "none"
+
+// OutputHTTPConfig holds the TLS and proxy settings of HTTP-based outputs. It is set per output
+// and as a default for all outputs in config.yaml.
+type OutputHTTPConfig struct {
+	TLS   *OutputTLSConfig `yaml:"tls,omitempty"`
+	Proxy string           `yaml:"proxy,omitempty"` // http, https or socks5 URL, or none; default from HTTP_PROXY/HTTPS_PROXY
+}
+
+// OutputTLSConfig configures the TLS client of an output
+type OutputTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`     // PEM bundle verifying the server, default the system roots
+	CertFile           string `yaml:"cert_file,omitempty"`   // client certificate for mutual TLS
+	KeyFile            string `yaml:"key_file,omitempty"`    // key of cert_file
+	ServerName         string `yaml:"server_name,omitempty"` // SNI and verified host name, default the host of the URL
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// Validate checks the config without reading the certificate files
+func (c *OutputHTTPConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if _, err := parseOutputProxy(c.Proxy); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseOutputProxy(proxy string) (*url.URL, error) {
+	if proxy == "" || proxy == OutputProxyNone {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+}
+
+// MergeOutputHTTPConfig applies the settings of an output over the global defaults. A tls block
+// of the output replaces the global one as a whole.
+func MergeOutputHTTPConfig(global, local *OutputHTTPConfig) *OutputHTTPConfig {
+	if global == nil {
+		return local
+	}
+	if local == nil {
+		return global
+	}
+	merged := *global
+	if local.TLS != nil {
+		merged.TLS = local.TLS
+	}
+	if local.Proxy != "" {
+		merged.Proxy = local.Proxy
+	}
+	return &merged
+}
+
+// NewOutputHTTPTransport returns a transport honoring the TLS and proxy settings, nil selects the
+// defaults of http.DefaultTransport
+func NewOutputHTTPTransport(cfg *OutputHTTPConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg == nil {
+		return transport, nil
+	}
+	proxyURL, err := parseOutputProxy(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case proxyURL != nil:
+		transport.Proxy = http.ProxyURL(proxyURL)
+	case cfg.Proxy == OutputProxyNone:
+		transport.Proxy = nil
+	}
+	if cfg.TLS != nil {
+		tlsCfg, err := cfg.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+	return transport, nil
+}
+
+// NewOutputHTTPClient returns a client with the transport of NewOutputHTTPTransport
+func NewOutputHTTPClient(cfg *OutputHTTPConfig, timeout time.Duration) (*http.Client, error) {
+	transport, err := NewOutputHTTPTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+func (c *OutputTLSConfig) load() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		caPEM, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in tls ca_file %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls cert_file/key_file: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
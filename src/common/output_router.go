@@ -0,0 +1,232 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	RouterModeAll   = "all"   // an event goes to every route it matches
+	RouterModeFirst = "first" // an event goes to the first route it matches only
+)
+
+// OutputRouterConfig splits the delivery of one output between child outputs.
+// Events matching no route go to the default outputs, or nowhere without default.
+type OutputRouterConfig struct {
+	Mode    string        `yaml:"mode,omitempty"` // all (default) or first
+	Routes  []RouterRoute `yaml:"routes"`
+	Default []string      `yaml:"default,omitempty"`
+}
+
+// RouterRoute sends the events matching all its conditions to its outputs.
+// A route without conditions matches every event.
+type RouterRoute struct {
+	Name    string            `yaml:"name,omitempty"`
+	When    []RouterCondition `yaml:"when,omitempty"`
+	Outputs []string          `yaml:"outputs"`
+}
+
+// RouterCondition checks one field with the check types of rules: EQU, NEQ, INCL, NI, START, END,
+// REGEX, MT, LT, ISNULL and NOTNULL. Paths use dots for nested fields.
+type RouterCondition struct {
+	Field string `yaml:"field"`
+	Type  string `yaml:"type"`
+	Value string `yaml:"value,omitempty"`
+}
+
+type routerCondition struct {
+	path   []string
+	typ    string
+	value  string
+	number float64
+	regex  *regexp.Regexp
+}
+
+type routerRoute struct {
+	conds   []routerCondition
+	outputs []string
+}
+
+// OutputRouter is a compiled OutputRouterConfig
+type OutputRouter struct {
+	first    bool
+	routes   []routerRoute
+	fallback []string
+	outputs  []string
+}
+
+// NewOutputRouter compiles a router config
+func NewOutputRouter(cfg *OutputRouterConfig) (*OutputRouter, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("router config is missing")
+	}
+	r := &OutputRouter{}
+	switch strings.ToLower(cfg.Mode) {
+	case "", RouterModeAll:
+	case RouterModeFirst:
+		r.first = true
+	default:
+		return nil, fmt.Errorf("unknown mode %q, expected all or first", cfg.Mode)
+	}
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("at least one route is required")
+	}
+
+	seen := map[string]bool{}
+	addOutputs := func(ids []string, where string) ([]string, error) {
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("%s has no outputs", where)
+		}
+		res := make([]string, 0, len(ids))
+		for _, id := range ids {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				return nil, fmt.Errorf("%s has an empty output id", where)
+			}
+			res = append(res, id)
+			if !seen[id] {
+				seen[id] = true
+				r.outputs = append(r.outputs, id)
+			}
+		}
+		return res, nil
+	}
+
+	for i, route := range cfg.Routes {
+		where := fmt.Sprintf("route %d", i+1)
+		if route.Name != "" {
+			where = fmt.Sprintf("route %q", route.Name)
+		}
+		var compiled routerRoute
+		for _, c := range route.When {
+			cond, err := compileRouterCondition(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			compiled.conds = append(compiled.conds, cond)
+		}
+		outputs, err := addOutputs(route.Outputs, where)
+		if err != nil {
+			return nil, err
+		}
+		compiled.outputs = outputs
+		r.routes = append(r.routes, compiled)
+	}
+	if len(cfg.Default) > 0 {
+		fallback, err := addOutputs(cfg.Default, "default")
+		if err != nil {
+			return nil, err
+		}
+		r.fallback = fallback
+	}
+	return r, nil
+}
+
+func compileRouterCondition(c RouterCondition) (routerCondition, error) {
+	cond := routerCondition{
+		path:  StringToList(strings.TrimSpace(c.Field)),
+		typ:   strings.ToUpper(strings.TrimSpace(c.Type)),
+		value: c.Value,
+	}
+	if len(cond.path) == 0 {
+		return cond, fmt.Errorf("condition without field")
+	}
+	switch cond.typ {
+	case "EQU", "NEQ", "INCL", "NI", "START", "END":
+	case "ISNULL", "NOTNULL":
+	case "REGEX":
+		re, err := regexp.Compile(c.Value)
+		if err != nil {
+			return cond, fmt.Errorf("invalid regex %q on field %s: %v", c.Value, c.Field, err)
+		}
+		cond.regex = re
+	case "MT", "LT":
+		n, err := strconv.ParseFloat(strings.TrimSpace(c.Value), 64)
+		if err != nil {
+			return cond, fmt.Errorf("%s on field %s needs a number, got %q", cond.typ, c.Field, c.Value)
+		}
+		cond.number = n
+	case "":
+		return cond, fmt.Errorf("condition on field %s has no type", c.Field)
+	default:
+		return cond, fmt.Errorf("unsupported condition type %q on field %s", c.Type, c.Field)
+	}
+	return cond, nil
+}
+
+func (c *routerCondition) match(msg map[string]interface{}) bool {
+	data, exist := GetCheckData(msg, c.path)
+	switch c.typ {
+	case "ISNULL":
+		return !exist || data == ""
+	case "NOTNULL":
+		return exist && data != ""
+	case "NEQ":
+		return data != c.value
+	case "NI":
+		return !strings.Contains(data, c.value)
+	}
+	if !exist {
+		return false
+	}
+	switch c.typ {
+	case "EQU":
+		return data == c.value
+	case "INCL":
+		return strings.Contains(data, c.value)
+	case "START":
+		return strings.HasPrefix(data, c.value)
+	case "END":
+		return strings.HasSuffix(data, c.value)
+	case "REGEX":
+		return c.regex.MatchString(data)
+	case "MT", "LT":
+		n, err := strconv.ParseFloat(strings.TrimSpace(data), 64)
+		if err != nil {
+			return false
+		}
+		if c.typ == "MT" {
+			return n > c.number
+		}
+		return n < c.number
+	}
+	return false
+}
+
+// Match returns the outputs an event is routed to, each at most once
+func (r *OutputRouter) Match(msg map[string]interface{}) []string {
+	var res []string
+	for i := range r.routes {
+		route := &r.routes[i]
+		matched := true
+		for j := range route.conds {
+			if !route.conds[j].match(msg) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, id := range route.outputs {
+			if !slices.Contains(res, id) {
+				res = append(res, id)
+			}
+		}
+		if r.first {
+			break
+		}
+	}
+	if len(res) == 0 {
+		return r.fallback
+	}
+	return res
+}
+
+// Outputs returns every output the router can send to, in config order
+func (r *OutputRouter) Outputs() []string {
+	return r.outputs
+}
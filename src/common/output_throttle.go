@@ -0,0 +1,350 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ThrottleOverflowQueue     = "queue"     // hold events and release them at the rate
+	ThrottleOverflowDrop      = "drop"      // discard events over the rate
+	ThrottleOverflowSummarize = "summarize" // discard events over the rate and send one summary event per interval
+	ThrottleOverflowSample    = "sample"    // send one in sample_every events over the rate and discard the others
+
+	// ThrottleSummaryFieldName holds the summary of the events suppressed by a rate limit
+	ThrottleSummaryFieldName = "_hub_throttle_summary"
+	// ThrottleSuppressedFieldName holds the number of events dropped or sampled out since the previous sent event
+	ThrottleSuppressedFieldName = "_hub_throttle_suppressed"
+
+	defaultThrottleQueueSize       = 10000
+	defaultThrottleSummaryInterval = time.Minute
+	defaultThrottleGroupBy         = "_hub_hit_rule_id"
+	defaultThrottleSampleEvery     = 10
+	maxThrottleSummaryGroups       = 100
+)
+
+// OutputRateLimitConfig limits the events an output sends with a token bucket
+type OutputRateLimitConfig struct {
+	Rate            float64 `yaml:"rate"`                       // events per second
+	Burst           int     `yaml:"burst,omitempty"`            // bucket size, default the rate rounded up
+	Overflow        string  `yaml:"overflow,omitempty"`         // queue (default), drop, summarize or sample
+	QueueSize       int     `yaml:"queue_size,omitempty"`       // queue only, default 10000
+	SummaryInterval string  `yaml:"summary_interval,omitempty"` // summarize only, default 1m
+	GroupBy         string  `yaml:"group_by,omitempty"`         // summarize only, field counted in the summary, default _hub_hit_rule_id
+	SampleEvery     int     `yaml:"sample_every,omitempty"`     // sample only, one in sample_every events over the rate is sent, default 10
+}
+
+// Validate checks a rate limit config
+func (c *OutputRateLimitConfig) Validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("rate must be greater than 0")
+	}
+	if c.Burst < 0 || c.QueueSize < 0 || c.SampleEvery < 0 {
+		return fmt.Errorf("burst, queue_size and sample_every must not be negative")
+	}
+	switch c.Overflow {
+	case "", ThrottleOverflowQueue, ThrottleOverflowDrop, ThrottleOverflowSummarize, ThrottleOverflowSample:
+	default:
+		return fmt.Errorf("invalid overflow %q, must be %s, %s, %s or %s", c.Overflow, ThrottleOverflowQueue, ThrottleOverflowDrop, ThrottleOverflowSummarize, ThrottleOverflowSample)
+	}
+	if c.SummaryInterval != "" {
+		if d, err := time.ParseDuration(c.SummaryInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid summary_interval %q, expected a duration like 1m", c.SummaryInterval)
+		}
+	}
+	return nil
+}
+
+// OutputThrottle sits between an output and its producer and passes events on at the configured rate.
+// Events over the rate are queued, dropped, summarized or sampled. Events it discards are recorded as
+// failed in the delivery receipts, since they were already handed to the producer side. Outside of
+// summarize, the next sent event carries the number of events discarded before it.
+type OutputThrottle struct {
+	output   string
+	in       chan map[string]interface{}
+	out      chan map[string]interface{}
+	receipts *DeliveryReceipts
+
+	rate            float64
+	burst           float64
+	overflow        string
+	queueSize       int
+	summaryInterval time.Duration
+	groupBy         []string
+	sampleEvery     uint64
+
+	tokens float64
+	last   time.Time
+	queue  []map[string]interface{}
+
+	// summary of the current window
+	suppressed  uint64
+	groups      map[string]uint64
+	windowStart time.Time
+
+	overRate   uint64 // events over the rate seen by the sampler
+	unreported uint64 // events discarded since the previous sent event
+
+	passed    uint64
+	sampled   uint64
+	delayed   uint64
+	dropped   uint64
+	summaries uint64
+	queued    int64
+}
+
+// NewOutputThrottle creates a throttle reading from in. The producer reads from Out(), which is
+// closed once in is closed after Start.
+func NewOutputThrottle(output string, cfg *OutputRateLimitConfig, in chan map[string]interface{}, receipts *DeliveryReceipts) *OutputThrottle {
+	t := &OutputThrottle{
+		output:          output,
+		in:              in,
+		out:             make(chan map[string]interface{}, cap(in)),
+		receipts:        receipts,
+		rate:            cfg.Rate,
+		burst:           float64(cfg.Burst),
+		overflow:        cfg.Overflow,
+		queueSize:       cfg.QueueSize,
+		summaryInterval: defaultThrottleSummaryInterval,
+		groupBy:         StringToList(defaultThrottleGroupBy),
+		sampleEvery:     defaultThrottleSampleEvery,
+		groups:          make(map[string]uint64),
+	}
+	if t.burst <= 0 {
+		t.burst = math.Ceil(cfg.Rate)
+	}
+	if t.overflow == "" {
+		t.overflow = ThrottleOverflowQueue
+	}
+	if t.queueSize <= 0 {
+		t.queueSize = defaultThrottleQueueSize
+	}
+	if d, err := time.ParseDuration(cfg.SummaryInterval); err == nil && d > 0 {
+		t.summaryInterval = d
+	}
+	if cfg.GroupBy != "" {
+		t.groupBy = StringToList(cfg.GroupBy)
+	}
+	if cfg.SampleEvery > 0 {
+		t.sampleEvery = uint64(cfg.SampleEvery)
+	}
+	return t
+}
+
+// Start begins passing events on, called once the producer reading Out() is running
+func (t *OutputThrottle) Start() {
+	t.tokens = t.burst
+	t.last = time.Now()
+	go t.run()
+}
+
+// Out returns the channel the producer reads from
+func (t *OutputThrottle) Out() chan map[string]interface{} {
+	return t.out
+}
+
+func (t *OutputThrottle) run() {
+	defer close(t.out)
+
+	// Queued events are released at most every 1/rate, checked at least every 10ms
+	tick := time.Duration(float64(time.Second) / t.rate)
+	tick = max(tick, 10*time.Millisecond)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	summaryTicker := time.NewTicker(t.summaryInterval)
+	defer summaryTicker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-t.in:
+			if !ok {
+				t.stop()
+				return
+			}
+			t.handle(msg)
+		case <-ticker.C:
+			t.release()
+		case <-summaryTicker.C:
+			t.emitSummary()
+		}
+	}
+}
+
+// take refills the bucket and takes a token if one is available
+func (t *OutputThrottle) take() bool {
+	now := time.Now()
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+func (t *OutputThrottle) handle(msg map[string]interface{}) {
+	// Queued events go first so the order is kept
+	if len(t.queue) == 0 && t.take() {
+		atomic.AddUint64(&t.passed, 1)
+		t.send(msg)
+		return
+	}
+
+	switch t.overflow {
+	case ThrottleOverflowQueue:
+		if len(t.queue) >= t.queueSize {
+			t.discard()
+			t.unreported++
+			TakeDeliveryToken(msg).Fail()
+			return
+		}
+		t.queue = append(t.queue, msg)
+		atomic.StoreInt64(&t.queued, int64(len(t.queue)))
+	case ThrottleOverflowSummarize:
+		if t.suppressed == 0 {
+			t.windowStart = time.Now()
+		}
+		t.suppressed++
+		group, ok := GetCheckData(msg, t.groupBy)
+		if !ok || group == "" {
+			group = "unknown"
+		}
+		if _, seen := t.groups[group]; seen || len(t.groups) < maxThrottleSummaryGroups {
+			t.groups[group]++
+		} else {
+			t.groups["other"]++
+		}
+		t.discard()
+		TakeDeliveryToken(msg).Release()
+	case ThrottleOverflowSample:
+		// Sampled events are sent without a token, so the downstream rate grows by 1/sample_every
+		// of the excess instead of going silent
+		t.overRate++
+		if t.overRate%t.sampleEvery == 0 {
+			atomic.AddUint64(&t.passed, 1)
+			atomic.AddUint64(&t.sampled, 1)
+			t.send(msg)
+			return
+		}
+		t.discard()
+		t.unreported++
+		TakeDeliveryToken(msg).Release()
+	default:
+		t.discard()
+		t.unreported++
+		// Discarded on purpose by the overflow policy, replaying it would not change that
+		TakeDeliveryToken(msg).Release()
+	}
+}
+
+// send passes an event on, noting how many events were discarded since the previous one
+func (t *OutputThrottle) send(msg map[string]interface{}) {
+	if t.unreported > 0 {
+		msg[ThrottleSuppressedFieldName] = t.unreported
+		t.unreported = 0
+	}
+	t.out <- msg
+}
+
+// discard records an event the throttle will not send
+func (t *OutputThrottle) discard() {
+	atomic.AddUint64(&t.dropped, 1)
+	t.receipts.AddFailed(1)
+}
+
+// release sends queued events while there are tokens
+func (t *OutputThrottle) release() {
+	for len(t.queue) > 0 && t.take() {
+		msg := t.queue[0]
+		t.queue[0] = nil
+		t.queue = t.queue[1:]
+		atomic.AddUint64(&t.passed, 1)
+		atomic.AddUint64(&t.delayed, 1)
+		t.send(msg)
+	}
+	if len(t.queue) == 0 {
+		t.queue = nil
+	}
+	atomic.StoreInt64(&t.queued, int64(len(t.queue)))
+}
+
+// emitSummary sends one event describing the events suppressed in the current window.
+// The summary is sent regardless of the rate so suppressed alerts are never silent.
+func (t *OutputThrottle) emitSummary() {
+	if t.suppressed == 0 {
+		return
+	}
+	groups := make([]map[string]interface{}, 0, len(t.groups))
+	for name, count := range t.groups {
+		groups = append(groups, map[string]interface{}{"value": name, "count": count})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i]["count"].(uint64) > groups[j]["count"].(uint64) })
+
+	now := time.Now().UTC()
+	summary := map[string]interface{}{
+		ThrottleSummaryFieldName: map[string]interface{}{
+			"output":       t.output,
+			"suppressed":   t.suppressed,
+			"rate":         t.rate,
+			"window_start": t.windowStart.UTC().Format(time.RFC3339),
+			"window_end":   now.Format(time.RFC3339),
+			"group_by":     strings.Join(t.groupBy, "."),
+			"groups":       groups,
+		},
+		"_hub_output_timestamp": now.Format(time.RFC3339),
+	}
+	logger.Warn("Output rate limit suppressed events", "output", t.output, "suppressed", t.suppressed)
+
+	t.suppressed = 0
+	t.groups = make(map[string]uint64)
+	atomic.AddUint64(&t.summaries, 1)
+	// The summary is an event of its own, so it is matched and sent like one
+	t.receipts.AddMatched(1)
+	t.receipts.AddSent(1)
+	t.out <- summary
+}
+
+// stop is called once the output closed its channel. Queued events are not sent any more,
+// a pending summary still is.
+func (t *OutputThrottle) stop() {
+	if n := len(t.queue); n > 0 {
+		atomic.AddUint64(&t.dropped, uint64(n))
+		t.receipts.AddFailed(uint64(n))
+		logger.Warn("Output stopped with rate limited events queued", "output", t.output, "discarded", n)
+		TakeDeliveryTokens(t.queue).Fail()
+		t.queue = nil
+		atomic.StoreInt64(&t.queued, 0)
+	}
+	if t.unreported > 0 {
+		logger.Warn("Output stopped with rate limited events not reported to the destination", "output", t.output, "suppressed", t.unreported)
+	}
+	t.emitSummary()
+}
+
+// Pending returns the number of events not yet passed to the producer
+func (t *OutputThrottle) Pending() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.in) + int(atomic.LoadInt64(&t.queued))
+}
+
+// GetStats returns the throttle counters
+func (t *OutputThrottle) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"rate":      t.rate,
+		"burst":     t.burst,
+		"overflow":  t.overflow,
+		"passed":    atomic.LoadUint64(&t.passed),
+		"sampled":   atomic.LoadUint64(&t.sampled),
+		"delayed":   atomic.LoadUint64(&t.delayed),
+		"dropped":   atomic.LoadUint64(&t.dropped),
+		"summaries": atomic.LoadUint64(&t.summaries),
+		"queued":    atomic.LoadInt64(&t.queued),
+	}
+}
@@ -0,0 +1,412 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+)
+
+// Minimal Parquet writer for flat archives: one row group, one PLAIN encoded data page per column,
+// every column OPTIONAL, codec UNCOMPRESSED or GZIP. It covers what object storage archiving needs
+// without pulling in a full Parquet implementation.
+
+const (
+	ParquetTypeString  = "string"
+	ParquetTypeInt64   = "int64"
+	ParquetTypeDouble  = "double"
+	ParquetTypeBoolean = "boolean"
+)
+
+// parquet.thrift enum values
+const (
+	parquetPhysicalBoolean   = 0
+	parquetPhysicalInt64     = 2
+	parquetPhysicalDouble    = 5
+	parquetPhysicalByteArray = 6
+
+	parquetConvertedUTF8 = 0
+	parquetOptional      = 1
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetPageData      = 0
+	parquetCodecNone     = 0
+	parquetCodecGzip     = 2
+)
+
+// ParquetColumn maps an event field to a Parquet column
+type ParquetColumn struct {
+	Name  string `yaml:"name" json:"name"`
+	Field string `yaml:"field" json:"field"` // dot separated path, e.g. process.pid, or * for the whole event as JSON
+	Type  string `yaml:"type" json:"type"`   // string (default), int64, double or boolean
+}
+
+// ValidateParquetColumns checks column names and types
+func ValidateParquetColumns(columns []ParquetColumn) error {
+	seen := make(map[string]bool)
+	for i, c := range columns {
+		if c.Name == "" || c.Field == "" {
+			return fmt.Errorf("parquet column %d: name and field are required", i)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate parquet column %q", c.Name)
+		}
+		seen[c.Name] = true
+		switch c.Type {
+		case "", ParquetTypeString, ParquetTypeInt64, ParquetTypeDouble, ParquetTypeBoolean:
+		default:
+			return fmt.Errorf("parquet column %q: unsupported type %q, expected string, int64, double or boolean", c.Name, c.Type)
+		}
+	}
+	return nil
+}
+
+// EncodeParquet writes rows as a Parquet file. Values that are missing or cannot be
+// converted to the column type are written as null.
+func EncodeParquet(columns []ParquetColumn, rows []map[string]interface{}, gzipPages bool) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+
+	codec := parquetCodecNone
+	if gzipPages {
+		codec = parquetCodecGzip
+	}
+
+	type chunkMeta struct {
+		offset             int64
+		uncompressed, size int64
+	}
+	chunks := make([]chunkMeta, len(columns))
+	var totalSize int64
+
+	for ci, col := range columns {
+		path := StringToList(col.Field)
+		var defLevels []bool
+		var values bytes.Buffer
+		var bools []bool
+		for _, row := range rows {
+			var raw interface{} = row
+			ok := true
+			if col.Field != "*" {
+				raw, ok = GetCheckDataWithType(row, path)
+			}
+			if ok {
+				ok = parquetAppendValue(&values, &bools, col.Type, raw)
+			}
+			defLevels = append(defLevels, ok)
+		}
+		if col.Type == ParquetTypeBoolean {
+			values.Write(parquetBitPack(bools))
+		}
+
+		var page bytes.Buffer
+		levels := parquetRLE(defLevels)
+		_ = binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+		page.Write(values.Bytes())
+
+		data := page.Bytes()
+		uncompressed := len(data)
+		if gzipPages {
+			var gz bytes.Buffer
+			w := gzip.NewWriter(&gz)
+			if _, err := w.Write(data); err != nil {
+				return nil, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			data = gz.Bytes()
+		}
+
+		var header parquetThriftWriter
+		header.structBegin()
+		header.fieldI32(1, parquetPageData)
+		header.fieldI32(2, int32(uncompressed))
+		header.fieldI32(3, int32(len(data)))
+		header.fieldStructBegin(5)
+		header.fieldI32(1, int32(len(rows)))
+		header.fieldI32(2, parquetEncodingPlain)
+		header.fieldI32(3, parquetEncodingRLE)
+		header.fieldI32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		offset := int64(out.Len())
+		out.Write(header.buf.Bytes())
+		out.Write(data)
+		chunks[ci] = chunkMeta{
+			offset:       offset,
+			uncompressed: int64(header.buf.Len() + uncompressed),
+			size:         int64(header.buf.Len() + len(data)),
+		}
+		totalSize += chunks[ci].uncompressed
+	}
+
+	// FileMetaData
+	var meta parquetThriftWriter
+	meta.structBegin()
+	meta.fieldI32(1, 1)
+	meta.fieldListBegin(2, parquetThriftStruct, len(columns)+1)
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(columns)))
+	meta.structEnd()
+	for _, col := range columns {
+		meta.structBegin()
+		meta.fieldI32(1, parquetPhysicalType(col.Type))
+		meta.fieldI32(3, parquetOptional)
+		meta.fieldString(4, col.Name)
+		if col.Type == "" || col.Type == ParquetTypeString {
+			meta.fieldI32(6, parquetConvertedUTF8)
+		}
+		meta.structEnd()
+	}
+	meta.fieldI64(3, int64(len(rows)))
+	meta.fieldListBegin(4, parquetThriftStruct, 1)
+	meta.structBegin() // RowGroup
+	meta.fieldListBegin(1, parquetThriftStruct, len(columns))
+	for ci, col := range columns {
+		meta.structBegin() // ColumnChunk
+		meta.fieldI64(2, chunks[ci].offset)
+		meta.fieldStructBegin(3) // ColumnMetaData
+		meta.fieldI32(1, parquetPhysicalType(col.Type))
+		meta.fieldListBegin(2, parquetThriftI32, 2)
+		meta.i32(parquetEncodingPlain)
+		meta.i32(parquetEncodingRLE)
+		meta.fieldListBegin(3, parquetThriftBinary, 1)
+		meta.binary(col.Name)
+		meta.fieldI32(4, int32(codec))
+		meta.fieldI64(5, int64(len(rows)))
+		meta.fieldI64(6, chunks[ci].uncompressed)
+		meta.fieldI64(7, chunks[ci].size)
+		meta.fieldI64(9, chunks[ci].offset)
+		meta.structEnd()
+		meta.structEnd()
+	}
+	meta.fieldI64(2, totalSize)
+	meta.fieldI64(3, int64(len(rows)))
+	meta.structEnd()
+	meta.fieldString(6, "AgentSmith-HUB")
+	meta.structEnd()
+
+	out.Write(meta.buf.Bytes())
+	_ = binary.Write(&out, binary.LittleEndian, uint32(meta.buf.Len()))
+	out.WriteString("PAR1")
+	return out.Bytes(), nil
+}
+
+func parquetPhysicalType(t string) int32 {
+	switch t {
+	case ParquetTypeInt64:
+		return parquetPhysicalInt64
+	case ParquetTypeDouble:
+		return parquetPhysicalDouble
+	case ParquetTypeBoolean:
+		return parquetPhysicalBoolean
+	default:
+		return parquetPhysicalByteArray
+	}
+}
+
+// parquetAppendValue PLAIN encodes v, returning false if it cannot be represented as the column type
+func parquetAppendValue(buf *bytes.Buffer, bools *[]bool, colType string, v interface{}) bool {
+	switch colType {
+	case ParquetTypeInt64:
+		var n int64
+		switch x := v.(type) {
+		case int:
+			n = int64(x)
+		case int64:
+			n = x
+		case uint64:
+			n = int64(x)
+		case float64:
+			if x != math.Trunc(x) {
+				return false
+			}
+			n = int64(x)
+		case string:
+			parsed, err := strconv.ParseInt(x, 10, 64)
+			if err != nil {
+				return false
+			}
+			n = parsed
+		default:
+			return false
+		}
+		_ = binary.Write(buf, binary.LittleEndian, n)
+	case ParquetTypeDouble:
+		var f float64
+		switch x := v.(type) {
+		case float64:
+			f = x
+		case int:
+			f = float64(x)
+		case int64:
+			f = float64(x)
+		case uint64:
+			f = float64(x)
+		case string:
+			parsed, err := strconv.ParseFloat(x, 64)
+			if err != nil {
+				return false
+			}
+			f = parsed
+		default:
+			return false
+		}
+		_ = binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+	case ParquetTypeBoolean:
+		switch x := v.(type) {
+		case bool:
+			*bools = append(*bools, x)
+		case string:
+			parsed, err := strconv.ParseBool(x)
+			if err != nil {
+				return false
+			}
+			*bools = append(*bools, parsed)
+		default:
+			return false
+		}
+	default:
+		var s string
+		switch x := v.(type) {
+		case string:
+			s = x
+		case map[string]interface{}, []interface{}:
+			raw, err := sonic.Marshal(x)
+			if err != nil {
+				return false
+			}
+			s = string(raw)
+		default:
+			s = AnyToString(x)
+		}
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	return true
+}
+
+// parquetRLE encodes 1-bit definition levels as RLE runs of the RLE/bit-packing hybrid encoding
+func parquetRLE(levels []bool) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if levels[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// parquetBitPack packs booleans LSB first, as PLAIN encoding requires
+func parquetBitPack(values []bool) []byte {
+	out := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// Thrift compact protocol type ids
+const (
+	parquetThriftI32    = 5
+	parquetThriftI64    = 6
+	parquetThriftBinary = 8
+	parquetThriftList   = 9
+	parquetThriftStruct = 12
+)
+
+// parquetThriftWriter writes the Thrift compact protocol used by Parquet metadata.
+// Field ids are delta encoded against the previous field of the enclosing struct.
+type parquetThriftWriter struct {
+	buf    bytes.Buffer
+	stack  []int16
+	lastID int16
+}
+
+func (w *parquetThriftWriter) structBegin() {
+	w.stack = append(w.stack, w.lastID)
+	w.lastID = 0
+}
+
+func (w *parquetThriftWriter) structEnd() {
+	w.buf.WriteByte(0)
+	w.lastID = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+func (w *parquetThriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(uint64(uint16((id << 1) ^ (id >> 15))))
+	}
+	w.lastID = id
+}
+
+func (w *parquetThriftWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *parquetThriftWriter) i32(v int32) {
+	w.varint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+func (w *parquetThriftWriter) i64(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *parquetThriftWriter) binary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *parquetThriftWriter) fieldI32(id int16, v int32) {
+	w.fieldHeader(id, parquetThriftI32)
+	w.i32(v)
+}
+
+func (w *parquetThriftWriter) fieldI64(id int16, v int64) {
+	w.fieldHeader(id, parquetThriftI64)
+	w.i64(v)
+}
+
+func (w *parquetThriftWriter) fieldString(id int16, s string) {
+	w.fieldHeader(id, parquetThriftBinary)
+	w.binary(s)
+}
+
+func (w *parquetThriftWriter) fieldStructBegin(id int16) {
+	w.fieldHeader(id, parquetThriftStruct)
+	w.structBegin()
+}
+
+// fieldListBegin writes a list field header, the caller then writes size elements
+// (structBegin/structEnd around each struct element)
+func (w *parquetThriftWriter) fieldListBegin(id int16, elemType byte, size int) {
+	w.fieldHeader(id, parquetThriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.varint(uint64(size))
+	}
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	pluginKVKeyPrefix = "hub:plugin_kv:" // followed by <plugin>:<key>
+	pluginKVMaxKeyLen = 512
+)
+
+func pluginKVKey(namespace, key string) (string, error) {
+	if rdb == nil {
+		return "", errors.New("plugin_kv requires redis")
+	}
+	if key == "" || len(key) > pluginKVMaxKeyLen {
+		return "", fmt.Errorf("plugin_kv key must have 1 to %d characters", pluginKVMaxKeyLen)
+	}
+	return pluginKVKeyPrefix + namespace + ":" + key, nil
+}
+
+// PluginKVGet returns the value of a key in the store of a plugin, false when it is not set
+func PluginKVGet(namespace, key string) (string, bool, error) {
+	k, err := pluginKVKey(namespace, key)
+	if err != nil {
+		return "", false, err
+	}
+	v, err := rdb.Get(ctx, k).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// PluginKVSet sets a key in the store of a plugin, it expires after ttl unless ttl is 0
+func PluginKVSet(namespace, key, value string, ttl time.Duration) error {
+	k, err := pluginKVKey(namespace, key)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return errors.New("plugin_kv ttl must not be negative")
+	}
+	return rdb.Set(ctx, k, value, ttl).Err()
+}
+
+// PluginKVIncr adds delta to a counter in the store of a plugin and returns the new value. A
+// counter created by the call expires after ttl unless ttl is 0, later calls keep its expiry.
+func PluginKVIncr(namespace, key string, delta int64, ttl time.Duration) (int64, error) {
+	k, err := pluginKVKey(namespace, key)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, errors.New("plugin_kv ttl must not be negative")
+	}
+	n, err := rdb.IncrBy(ctx, k, delta).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl > 0 && n == delta {
+		if err := rdb.PExpire(ctx, k, ttl).Err(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// PluginKVDelete removes a key from the store of a plugin
+func PluginKVDelete(namespace, key string) error {
+	k, err := pluginKVKey(namespace, key)
+	if err != nil {
+		return err
+	}
+	return rdb.Del(ctx, k).Err()
+}
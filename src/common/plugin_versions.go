@@ -0,0 +1,95 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	pluginVersionsKeyPrefix = "hub:plugin_versions:" // list of versions per plugin, newest first
+	// MaxPluginVersions is the number of versions kept per plugin
+	MaxPluginVersions = 50
+)
+
+// PluginVersion is an applied version of a plugin
+type PluginVersion struct {
+	Hash      string    `json:"hash"` // sha256 of the source
+	Author    string    `json:"author,omitempty"`
+	Source    string    `json:"source"` // how it was applied: change_push, local_file, rollback...
+	Timestamp time.Time `json:"timestamp"`
+	Content   string    `json:"content,omitempty"`
+}
+
+// PluginContentHash returns the hash identifying a plugin version
+func PluginContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordPluginVersion adds a version to the history of a plugin, unless it is already the latest
+// one. The history keeps the MaxPluginVersions latest versions.
+func RecordPluginVersion(id, content, author, source string) error {
+	if rdb == nil {
+		return errors.New("redis is not available")
+	}
+	v := PluginVersion{
+		Hash:      PluginContentHash(content),
+		Author:    author,
+		Source:    source,
+		Timestamp: time.Now(),
+		Content:   content,
+	}
+	if latest, err := RedisLRange(pluginVersionsKeyPrefix+id, 0, 0); err == nil && len(latest) == 1 {
+		var prev PluginVersion
+		if json.Unmarshal([]byte(latest[0]), &prev) == nil && prev.Hash == v.Hash {
+			return nil
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return RedisLPush(pluginVersionsKeyPrefix+id, string(data), MaxPluginVersions)
+}
+
+// GetPluginVersions returns the versions of a plugin, newest first. The content is only included
+// when withContent is set.
+func GetPluginVersions(id string, withContent bool) ([]PluginVersion, error) {
+	if rdb == nil {
+		return nil, errors.New("redis is not available")
+	}
+	raw, err := RedisLRange(pluginVersionsKeyPrefix+id, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]PluginVersion, 0, len(raw))
+	for _, r := range raw {
+		var v PluginVersion
+		if err := json.Unmarshal([]byte(r), &v); err != nil {
+			continue
+		}
+		if !withContent {
+			v.Content = ""
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// GetPluginVersion returns the version of a plugin with the given hash, including its content
+func GetPluginVersion(id, hash string) (*PluginVersion, error) {
+	versions, err := GetPluginVersions(id, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Hash == hash {
+			return &versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("plugin %s has no version %s", id, hash)
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLiteRedis points the Redis helpers at a lite store in a temporary directory
+func useLiteRedis(t *testing.T) {
+	t.Helper()
+	saved, savedStore := rdb, liteStoreInstance
+	if err := RedisInitLite(filepath.Join(t.TempDir(), "lite.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rdb.Close()
+		liteStoreInstance.close()
+		rdb, liteStoreInstance = saved, savedStore
+	})
+}
+
+func TestPluginVersionsCap(t *testing.T) {
+	useLiteRedis(t)
+	for i := 0; i < MaxPluginVersions+10; i++ {
+		if err := RecordPluginVersion("geo", fmt.Sprintf("package plugin // v%d", i), "alice", "change_push"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := GetPluginVersions("geo", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != MaxPluginVersions {
+		t.Fatalf("%d versions kept, want %d", len(versions), MaxPluginVersions)
+	}
+	// The newest are kept, newest first, without their content
+	newest, oldest := PluginContentHash(fmt.Sprintf("package plugin // v%d", MaxPluginVersions+9)), PluginContentHash("package plugin // v10")
+	if versions[0].Hash != newest || versions[len(versions)-1].Hash != oldest || versions[0].Content != "" || versions[0].Author != "alice" {
+		t.Fatalf("first = %+v, last = %+v", versions[0], versions[len(versions)-1])
+	}
+	if _, err := GetPluginVersion("geo", PluginContentHash("package plugin // v9")); err == nil || !strings.Contains(err.Error(), "has no version") {
+		t.Fatalf("trimmed version: err = %v", err)
+	}
+	v, err := GetPluginVersion("geo", oldest)
+	if err != nil || v.Content != "package plugin // v10" {
+		t.Fatalf("oldest kept version = %+v, %v", v, err)
+	}
+}
+
+func TestPluginVersionsSkipSameContent(t *testing.T) {
+	useLiteRedis(t)
+	for _, content := range []string{"a", "a", "b", "a"} {
+		if err := RecordPluginVersion("dedup", content, "", "local_file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := GetPluginVersions("dedup", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, v := range versions {
+		contents = append(contents, v.Content)
+	}
+	// Only a repeat of the latest version is skipped, going back to an older one is recorded
+	if strings.Join(contents, ",") != "a,b,a" {
+		t.Fatalf("contents = %v", contents)
+	}
+	if versions, err := GetPluginVersions("unknown", false); err != nil || len(versions) != 0 {
+		t.Fatalf("unknown plugin: %v, %v", versions, err)
+	}
+}
@@ -0,0 +1,23 @@
+package common
+
+// PriorityFieldName marks alerts of high priority rules so outputs can deliver them ahead of bulk matches
+const PriorityFieldName = "_hub_priority"
+
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+)
+
+// defaultPriorityLaneSize is the capacity of a producer's priority lane
+const defaultPriorityLaneSize = 256
+
+// NewPriorityLane creates the channel high priority events are handed to a producer through
+func NewPriorityLane() chan map[string]interface{} {
+	return make(chan map[string]interface{}, defaultPriorityLaneSize)
+}
+
+// IsHighPriority reports whether an event was marked high priority by its rule
+func IsHighPriority(msg map[string]interface{}) bool {
+	p, _ := msg[PriorityFieldName].(string)
+	return p == PriorityHigh
+}
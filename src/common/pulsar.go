@@ -0,0 +1,295 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	PulsarSubscriptionShared    = "Shared"
+	PulsarSubscriptionFailover  = "Failover"
+	PulsarSubscriptionExclusive = "Exclusive"
+	PulsarSubscriptionKeyShared = "Key_Shared"
+)
+
+// PulsarConsumerConfig describes a Pulsar subscription consumed through the broker WebSocket API
+type PulsarConsumerConfig struct {
+	ServiceURL        string // broker or proxy web service, e.g. http://pulsar:8080 or wss://pulsar:8443
+	Topic             string // persistent://tenant/namespace/topic, tenant/namespace/topic or a topic in public/default
+	Subscription      string
+	SubscriptionType  string // Shared (default), Failover, Exclusive or Key_Shared
+	Token             string // JWT sent as a bearer token
+	TLS               *KafkaTLSConfig
+	AckTimeout        time.Duration // unacknowledged messages are redelivered by the broker after this timeout, 0 disables it
+	ReceiverQueueSize int
+}
+
+// PulsarConsumer receives messages from a Pulsar subscription and forwards them to MsgChan.
+// Messages are acknowledged once they have been handed to MsgChan.
+type PulsarConsumer struct {
+	InputID string
+	MsgChan chan map[string]interface{}
+
+	cfg PulsarConsumerConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	readTotal uint64
+}
+
+type pulsarMessage struct {
+	MessageID string `json:"messageId"`
+	Payload   string `json:"payload"` // base64 encoded
+}
+
+type pulsarAck struct {
+	MessageID string `json:"messageId"`
+}
+
+// NormalizePulsarSubscriptionType validates a subscription type, accepting any letter case
+func NormalizePulsarSubscriptionType(t string) (string, error) {
+	if t == "" {
+		return PulsarSubscriptionShared, nil
+	}
+	for _, known := range []string{PulsarSubscriptionShared, PulsarSubscriptionFailover, PulsarSubscriptionExclusive, PulsarSubscriptionKeyShared} {
+		if strings.EqualFold(t, known) || strings.EqualFold(strings.ReplaceAll(t, "-", "_"), known) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported subscription type %q, expected shared, failover, exclusive or key_shared", t)
+}
+
+// pulsarTopicPath converts a topic name to the {persistent|non-persistent}/tenant/namespace/topic form used by the WebSocket API
+func pulsarTopicPath(topic string) (string, error) {
+	domain := "persistent"
+	if i := strings.Index(topic, "://"); i >= 0 {
+		domain = topic[:i]
+		topic = topic[i+3:]
+		if domain != "persistent" && domain != "non-persistent" {
+			return "", fmt.Errorf("unsupported topic domain %q", domain)
+		}
+	}
+	parts := strings.Split(topic, "/")
+	switch len(parts) {
+	case 1:
+		parts = []string{"public", "default", parts[0]}
+	case 3:
+	default:
+		return "", fmt.Errorf("invalid topic %q, expected tenant/namespace/topic", topic)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("invalid topic %q, expected tenant/namespace/topic", topic)
+		}
+	}
+	return domain + "/" + strings.Join(parts, "/"), nil
+}
+
+// pulsarWebSocketConfig builds the dial configuration for a consumer or reader endpoint
+func pulsarWebSocketConfig(cfg PulsarConsumerConfig, endpoint string, query url.Values) (*websocket.Config, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.ServiceURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service URL: %w", err)
+	}
+	origin := *base
+	switch base.Scheme {
+	case "ws", "http":
+		base.Scheme, origin.Scheme = "ws", "http"
+	case "wss", "https":
+		base.Scheme, origin.Scheme = "wss", "https"
+	default:
+		return nil, fmt.Errorf("unsupported service URL scheme %q, expected http, https, ws or wss", base.Scheme)
+	}
+	if base.Host == "" {
+		return nil, fmt.Errorf("service URL has no host")
+	}
+
+	topicPath, err := pulsarTopicPath(cfg.Topic)
+	if err != nil {
+		return nil, err
+	}
+	base.Path += "/ws/v2/" + endpoint + "/" + topicPath
+	base.RawQuery = query.Encode()
+
+	wsCfg, err := websocket.NewConfig(base.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token != "" {
+		wsCfg.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	if cfg.TLS != nil {
+		tlsCfg, err := BuildTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		wsCfg.TlsConfig = tlsCfg
+	}
+	return wsCfg, nil
+}
+
+// NewPulsarConsumer validates the configuration and prepares a consumer, call Start to begin receiving
+func NewPulsarConsumer(inputID string, cfg PulsarConsumerConfig, msgChan chan map[string]interface{}) (*PulsarConsumer, error) {
+	subType, err := NormalizePulsarSubscriptionType(cfg.SubscriptionType)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SubscriptionType = subType
+	if cfg.Subscription == "" {
+		return nil, fmt.Errorf("subscription is required")
+	}
+	// fail early on a bad URL, topic or certificate
+	if _, err := pulsarWebSocketConfig(cfg, "consumer", nil); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PulsarConsumer{
+		InputID: inputID,
+		MsgChan: msgChan,
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start subscribes and keeps the subscription alive, reconnecting with backoff until Close is called
+func (c *PulsarConsumer) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		backoff := time.Second
+		for {
+			started := time.Now()
+			if err := c.consume(); err != nil && c.ctx.Err() == nil {
+				logger.Warn("Pulsar consumer disconnected, reconnecting", "input", c.InputID, "topic", c.cfg.Topic, "error", err)
+			}
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = nextBackoff(backoff)
+		}
+	}()
+}
+
+// Close closes the subscription connection, unacknowledged messages are redelivered by the broker
+func (c *PulsarConsumer) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// GetReadTotal returns the number of messages received since start
+func (c *PulsarConsumer) GetReadTotal() uint64 {
+	return atomic.LoadUint64(&c.readTotal)
+}
+
+func (c *PulsarConsumer) consumerQuery() url.Values {
+	q := url.Values{}
+	q.Set("subscriptionType", c.cfg.SubscriptionType)
+	if c.cfg.AckTimeout > 0 {
+		q.Set("ackTimeoutMillis", strconv.FormatInt(c.cfg.AckTimeout.Milliseconds(), 10))
+	}
+	if c.cfg.ReceiverQueueSize > 0 {
+		q.Set("receiverQueueSize", strconv.Itoa(c.cfg.ReceiverQueueSize))
+	}
+	q.Set("consumerName", "agentsmith-hub-"+GetNodeID())
+	return q
+}
+
+func (c *PulsarConsumer) consume() error {
+	wsCfg, err := pulsarWebSocketConfig(c.cfg, "consumer", c.consumerQuery())
+	if err != nil {
+		return err
+	}
+	wsCfg.Location.Path += "/" + c.cfg.Subscription
+
+	conn, err := wsCfg.DialContext(c.ctx)
+	if err != nil {
+		return err
+	}
+	// Receive blocks until the broker sends something, closing the connection is the only way to interrupt it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	logger.Info("Pulsar consumer subscribed", "input", c.InputID, "topic", c.cfg.Topic, "subscription", c.cfg.Subscription, "type", c.cfg.SubscriptionType)
+	for {
+		var msg pulsarMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return err
+		}
+		if msg.MessageID == "" {
+			continue
+		}
+
+		if event, err := decodePulsarPayload(msg.Payload); err != nil {
+			logger.Error("Failed to deserialize Pulsar message", "input", c.InputID, "message_id", msg.MessageID, "error", err)
+		} else {
+			select {
+			case c.MsgChan <- event:
+				atomic.AddUint64(&c.readTotal, 1)
+			case <-c.ctx.Done():
+				// not acknowledged, the broker redelivers it to another consumer
+				return nil
+			}
+		}
+
+		if err := websocket.JSON.Send(conn, pulsarAck{MessageID: msg.MessageID}); err != nil {
+			return fmt.Errorf("failed to acknowledge message: %w", err)
+		}
+	}
+}
+
+func decodePulsarPayload(payload string) (map[string]interface{}, error) {
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 payload: %w", err)
+	}
+	var m map[string]interface{}
+	if err := sonic.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TestPulsarConnection opens a non-durable reader on the topic to check reachability and authorization
+// without creating a subscription
+func TestPulsarConnection(cfg PulsarConsumerConfig) error {
+	q := url.Values{}
+	q.Set("messageId", "latest")
+	wsCfg, err := pulsarWebSocketConfig(cfg, "reader", q)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := wsCfg.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -246,6 +246,32 @@ func RedisInit(addr string, passwd string) error {
 	return RedisPing()
 }
 
+// RedisInitLite starts the embedded single node store and points the Redis client at it.
+// The keyspace is loaded from and persisted to the bbolt file at path.
+func RedisInitLite(path string) error {
+	store, err := newLiteStore(path)
+	if err != nil {
+		return err
+	}
+	liteStoreInstance = store
+
+	rdb = redis.NewClient(&redis.Options{
+		Addr:            "lite",
+		Dialer:          store.dial,
+		Protocol:        2,
+		DisableIdentity: true,
+		PoolSize:        64,
+		ConnMaxIdleTime: 30 * time.Second,
+		PoolTimeout:     2 * time.Second,
+		ReadTimeout:     1 * time.Second,
+		WriteTimeout:    1 * time.Second,
+	})
+
+	redisFailureHandler = NewRedisFailureHandler()
+
+	return RedisPing()
+}
+
 func RedisPing() error {
 	// Ping the Redis server to check connection with retry
 	var lastErr error
@@ -271,12 +297,26 @@ func RedisGet(key string) (string, error) {
 	return val, nil
 }
 
+// RedisExists reports whether a key exists
+func RedisExists(key string) (bool, error) {
+	n, err := rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
 // RedisGetInt64 gets a value from Redis as int64
 func RedisGetInt64(key string) (int64, error) {
 	return rdb.Get(ctx, key).Int64()
 }
 
 func RedisKeys(key string) ([]string, error) {
+	return scanKeys(rdb, key)
+}
+
+// scanKeys collects the keys matching a pattern with SCAN
+func scanKeys(c *redis.Client, key string) ([]string, error) {
 	var (
 		cursor uint64 = 0
 		keys   []string
@@ -286,7 +326,7 @@ func RedisKeys(key string) ([]string, error) {
 		var scanKeys []string
 		var err error
 
-		scanKeys, cursor, err = rdb.Scan(ctx, cursor, key, 100).Result()
+		scanKeys, cursor, err = c.Scan(ctx, cursor, key, 100).Result()
 		if err != nil {
 			return nil, err
 		}
@@ -371,6 +411,25 @@ func RedisLPush(key string, value interface{}, maxLen int64) error {
 	return nil
 }
 
+// RedisLPushWindow pushes value to the head of a list, keeps its maxLen first elements and returns
+// them. The expiration is set when the push creates the list, so the list expires expiration
+// seconds after its first element.
+func RedisLPushWindow(key string, value interface{}, maxLen int64, expiration int) ([]string, error) {
+	pipe := rdb.TxPipeline()
+	pushCmd := pipe.LPush(ctx, key, value)
+	pipe.LTrim(ctx, key, 0, maxLen-1)
+	rangeCmd := pipe.LRange(ctx, key, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	if pushCmd.Val() == 1 {
+		if err := rdb.Expire(ctx, key, time.Duration(expiration)*time.Second).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return rangeCmd.Val(), nil
+}
+
 // RedisLRange returns list range
 func RedisLRange(key string, start, stop int64) ([]string, error) {
 	return rdb.LRange(ctx, key, start, stop).Result()
@@ -420,6 +479,81 @@ func RedisZRemRangeByScore(key string, min, max string) (int64, error) {
 	return rdb.ZRemRangeByScore(ctx, key, min, max).Result()
 }
 
+// RedisZWindowAdd adds a member to a sorted set used as a sliding window: members scored at or
+// below min are removed, the key expires after expiration seconds, and the members scored in
+// (min, max] are counted. They are returned as well when withMembers is set.
+func RedisZWindowAdd(key string, score float64, member string, min, max float64, expiration int, withMembers bool) (int64, []string, error) {
+	lower := "(" + strconv.FormatFloat(min, 'f', -1, 64)
+	upper := strconv.FormatFloat(max, 'f', -1, 64)
+	pipe := rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatFloat(min, 'f', -1, 64))
+	pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: member})
+	pipe.Expire(ctx, key, time.Duration(expiration)*time.Second)
+	var countCmd *redis.IntCmd
+	var membersCmd *redis.StringSliceCmd
+	if withMembers {
+		membersCmd = pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: lower, Max: upper})
+	} else {
+		countCmd = pipe.ZCount(ctx, key, lower, upper)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, nil, err
+	}
+	if withMembers {
+		members := membersCmd.Val()
+		return int64(len(members)), members, nil
+	}
+	return countCmd.Val(), nil, nil
+}
+
+// RedisHSetAll sets fields of a Redis hash and the expiration of the hash in one transaction
+func RedisHSetAll(key string, fields map[string]interface{}, expiration int) error {
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, time.Duration(expiration)*time.Second)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisHIncrByAll increments fields of a Redis hash in one transaction
+func RedisHIncrByAll(key string, incr map[string]int64) error {
+	pipe := rdb.TxPipeline()
+	for field, n := range incr {
+		pipe.HIncrBy(ctx, key, field, n)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisHUpdate sets and deletes fields of a Redis hash and sets the expiration of the hash in one
+// transaction
+func RedisHUpdate(key string, set map[string]interface{}, del []string, expiration int) error {
+	pipe := rdb.TxPipeline()
+	if len(del) > 0 {
+		pipe.HDel(ctx, key, del...)
+	}
+	if len(set) > 0 {
+		pipe.HSet(ctx, key, set)
+	}
+	pipe.Expire(ctx, key, time.Duration(expiration)*time.Second)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisZWindowAddNew adds a member to a sorted set used as a sliding window like RedisZWindowAdd.
+// It returns whether the member was not in the window yet and the number of other members in it.
+func RedisZWindowAddNew(key string, score float64, member string, min float64, expiration int) (bool, int64, error) {
+	pipe := rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatFloat(min, 'f', -1, 64))
+	addCmd := pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: member})
+	pipe.Expire(ctx, key, time.Duration(expiration)*time.Second)
+	cardCmd := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+	return addCmd.Val() > 0, cardCmd.Val() - 1, nil
+}
+
 // ===================== Pipeline Operations =====================
 
 // GetRedisPipeline returns a new Redis pipeline for batch operations
@@ -510,23 +644,33 @@ func (dl *DistributedLock) Acquire() error {
 	})
 }
 
-// Release releases the distributed lock
-func (dl *DistributedLock) Release() error {
-	if !dl.acquired {
-		return nil
-	}
-
-	// Use Lua script to ensure atomic release
-	script := `
+// Lua scripts of DistributedLock, they release or extend the lock atomically only while it is
+// still held. Lite mode runs them natively, see liteScripts.
+const (
+	lockReleaseScript = `
 		if redis.call("get", KEYS[1]) == ARGV[1] then
 			return redis.call("del", KEYS[1])
 		else
 			return 0
 		end
 	`
+	lockRefreshScript = `
+		if redis.call("get", KEYS[1]) == ARGV[1] then
+			return redis.call("pexpire", KEYS[1], ARGV[2])
+		else
+			return 0
+		end
+	`
+)
+
+// Release releases the distributed lock
+func (dl *DistributedLock) Release() error {
+	if !dl.acquired {
+		return nil
+	}
 
 	return redisFailureHandler.circuitBreaker.Call(func() error {
-		_, err := rdb.Eval(ctx, script, []string{dl.key}, dl.value).Result()
+		_, err := rdb.Eval(ctx, lockReleaseScript, []string{dl.key}, dl.value).Result()
 		if err != nil {
 			return err
 		}
@@ -535,6 +679,25 @@ func (dl *DistributedLock) Release() error {
 	})
 }
 
+// Refresh extends the expiration of a held lock, failing if the lock has been lost
+func (dl *DistributedLock) Refresh() error {
+	if !dl.acquired {
+		return fmt.Errorf("lock not acquired")
+	}
+
+	return redisFailureHandler.circuitBreaker.Call(func() error {
+		res, err := rdb.Eval(ctx, lockRefreshScript, []string{dl.key}, dl.value, dl.expiration.Milliseconds()).Int()
+		if err != nil {
+			return err
+		}
+		if res == 0 {
+			dl.acquired = false
+			return fmt.Errorf("lock lost")
+		}
+		return nil
+	})
+}
+
 // TryAcquire attempts to acquire the lock with a timeout
 func (dl *DistributedLock) TryAcquire(timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
@@ -693,3 +856,102 @@ func GetKnownNodes() ([]string, error) {
 
 	return nodes, nil
 }
+
+// RedisAccessCheck is the result of trying one command family the hub relies on
+type RedisAccessCheck struct {
+	Command string
+	Err     error
+}
+
+// preflightScript checks that the Redis user may run scripts
+const preflightScript = "return redis.call('EXISTS', KEYS[1])"
+
+// RedisCheckAccess runs every command family the hub uses against a scratch key and reports
+// the ones that fail, for example because of a restrictive ACL user
+func RedisCheckAccess() []RedisAccessCheck {
+	if rdb == nil {
+		return []RedisAccessCheck{{Command: "PING", Err: fmt.Errorf("Redis client not initialized")}}
+	}
+	key := "hub:preflight:" + NewUUID()
+	defer rdb.Del(ctx, key, key+":h", key+":l", key+":s", key+":z")
+
+	checks := []struct {
+		command string
+		run     func() error
+	}{
+		{"SET/GET", func() error {
+			if err := rdb.Set(ctx, key, "1", time.Minute).Err(); err != nil {
+				return err
+			}
+			return rdb.Get(ctx, key).Err()
+		}},
+		{"SETNX/INCRBY/EXPIRE", func() error {
+			if err := rdb.SetNX(ctx, key, "1", time.Minute).Err(); err != nil {
+				return err
+			}
+			if err := rdb.IncrBy(ctx, key, 1).Err(); err != nil {
+				return err
+			}
+			return rdb.Expire(ctx, key, time.Minute).Err()
+		}},
+		{"HSET/HGETALL", func() error {
+			if err := rdb.HSet(ctx, key+":h", "f", "1").Err(); err != nil {
+				return err
+			}
+			return rdb.HGetAll(ctx, key+":h").Err()
+		}},
+		{"LPUSH/LRANGE", func() error {
+			if err := rdb.LPush(ctx, key+":l", "1").Err(); err != nil {
+				return err
+			}
+			return rdb.LRange(ctx, key+":l", 0, -1).Err()
+		}},
+		{"SADD/SMEMBERS", func() error {
+			if err := rdb.SAdd(ctx, key+":s", "1").Err(); err != nil {
+				return err
+			}
+			return rdb.SMembers(ctx, key+":s").Err()
+		}},
+		{"ZADD/ZRANGEBYSCORE", func() error {
+			if err := rdb.ZAdd(ctx, key+":z", redis.Z{Score: 1, Member: "1"}).Err(); err != nil {
+				return err
+			}
+			return rdb.ZRangeByScore(ctx, key+":z", &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Err()
+		}},
+		{"MULTI/EXEC", func() error {
+			pipe := rdb.TxPipeline()
+			pipe.Get(ctx, key)
+			_, err := pipe.Exec(ctx)
+			return err
+		}},
+		{"SCAN", func() error {
+			return rdb.Scan(ctx, 0, "hub:preflight:*", 10).Err()
+		}},
+		{"EVAL", func() error {
+			return rdb.Eval(ctx, preflightScript, []string{key}).Err()
+		}},
+		{"PUBLISH", func() error {
+			return rdb.Publish(ctx, "hub:preflight", "1").Err()
+		}},
+		{"SUBSCRIBE", func() error {
+			subCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			pubsub := rdb.Subscribe(subCtx, "hub:preflight")
+			defer pubsub.Close()
+			_, err := pubsub.Receive(subCtx)
+			return err
+		}},
+		{"INFO", func() error {
+			return rdb.Info(ctx, "server").Err()
+		}},
+		{"DEL", func() error {
+			return rdb.Del(ctx, key).Err()
+		}},
+	}
+
+	res := make([]RedisAccessCheck, 0, len(checks))
+	for _, c := range checks {
+		res = append(res, RedisAccessCheck{Command: c.command, Err: c.run()})
+	}
+	return res
+}
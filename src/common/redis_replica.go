@@ -0,0 +1,216 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// replicaBackoff is how long a replica that failed a read is skipped before it is tried again
+const replicaBackoff = 30 * time.Second
+
+// redisReplica is a read replica of the primary Redis
+type redisReplica struct {
+	addr      string
+	client    *redis.Client
+	downUntil atomic.Int64 // unix nano, reads go elsewhere until then
+	reads     atomic.Uint64
+	failures  atomic.Uint64
+}
+
+// Read replicas serve the heavy read paths (samples, statistics and error logs).
+// Writes always go to the primary, so reads served by a replica can lag behind by the replication delay.
+var (
+	rdbReplicas    []*redisReplica
+	replicaCursor  atomic.Uint64
+	primaryReads   atomic.Uint64
+	replicaEnabled atomic.Bool
+)
+
+// RedisInitReplicas connects the read replicas. Unreachable replicas are kept and retried
+// after a backoff, reads fall back to the primary in the meantime.
+func RedisInitReplicas(addrs []string, passwd string) {
+	replicas := make([]*redisReplica, 0, len(addrs))
+	for _, addr := range addrs {
+		r := &redisReplica{
+			addr: addr,
+			client: redis.NewClient(&redis.Options{
+				Addr:            addr,
+				Password:        passwd,
+				PoolSize:        32,
+				MinIdleConns:    4,
+				ConnMaxIdleTime: 30 * time.Second,
+				ConnMaxLifetime: 5 * time.Minute,
+				PoolTimeout:     2 * time.Second,
+				DialTimeout:     2 * time.Second,
+				ReadTimeout:     2 * time.Second,
+				WriteTimeout:    1 * time.Second,
+				MaxRetries:      1,
+			}),
+		}
+		if err := r.client.Ping(ctx).Err(); err != nil {
+			logger.Warn("Redis read replica unreachable, reads use the primary until it recovers", "addr", addr, "error", err)
+			r.downUntil.Store(time.Now().Add(replicaBackoff).UnixNano())
+		}
+		replicas = append(replicas, r)
+	}
+	rdbReplicas = replicas
+	replicaEnabled.Store(len(replicas) > 0)
+	if len(replicas) > 0 {
+		logger.Info("Redis read replicas configured", "count", len(replicas))
+	}
+}
+
+// pickReplica returns the next healthy replica in round robin order, nil if none is available
+func pickReplica() *redisReplica {
+	if !replicaEnabled.Load() {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	start := replicaCursor.Add(1)
+	for i := 0; i < len(rdbReplicas); i++ {
+		r := rdbReplicas[(start+uint64(i))%uint64(len(rdbReplicas))]
+		if r.downUntil.Load() <= now {
+			return r
+		}
+	}
+	return nil
+}
+
+// redisRead runs a read on a replica when one is available and falls back to the primary
+// if the replica fails. A missing key (redis.Nil) is a result, not a failure.
+func redisRead(fn func(c *redis.Client) error) error {
+	if r := pickReplica(); r != nil {
+		r.reads.Add(1)
+		err := fn(r.client)
+		if err == nil || errors.Is(err, redis.Nil) {
+			return err
+		}
+		r.failures.Add(1)
+		r.downUntil.Store(time.Now().Add(replicaBackoff).UnixNano())
+		logger.Warn("Redis read replica failed, falling back to the primary", "addr", r.addr, "error", err)
+	}
+	primaryReads.Add(1)
+	return fn(rdb)
+}
+
+// RedisReadKeys is RedisKeys served by a read replica when configured
+func RedisReadKeys(pattern string) ([]string, error) {
+	var keys []string
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		keys, err = scanKeys(c, pattern)
+		return err
+	})
+	return keys, err
+}
+
+// RedisReadGet is RedisGet served by a read replica when configured
+func RedisReadGet(key string) (string, error) {
+	var val string
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		val, err = c.Get(ctx, key).Result()
+		return err
+	})
+	return val, err
+}
+
+// RedisReadGetInt64 is RedisGetInt64 served by a read replica when configured
+func RedisReadGetInt64(key string) (int64, error) {
+	var val int64
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		val, err = c.Get(ctx, key).Int64()
+		return err
+	})
+	return val, err
+}
+
+// RedisReadLRange is RedisLRange served by a read replica when configured
+func RedisReadLRange(key string, start, stop int64) ([]string, error) {
+	var vals []string
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		vals, err = c.LRange(ctx, key, start, stop).Result()
+		return err
+	})
+	return vals, err
+}
+
+// RedisReadLLen returns the length of a list, served by a read replica when configured
+func RedisReadLLen(key string) (int64, error) {
+	var n int64
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		n, err = c.LLen(ctx, key).Result()
+		return err
+	})
+	return n, err
+}
+
+// RedisReadZRevRange is RedisZRevRange served by a read replica when configured
+func RedisReadZRevRange(key string, start, stop int64) ([]string, error) {
+	var vals []string
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		vals, err = c.ZRevRange(ctx, key, start, stop).Result()
+		return err
+	})
+	return vals, err
+}
+
+// RedisReadZRevRangeByScore returns up to count members scored between min and max, highest score first,
+// served by a read replica when configured
+func RedisReadZRevRangeByScore(key, max, min string, count int64) ([]redis.Z, error) {
+	var vals []redis.Z
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		vals, err = c.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: min, Max: max, Count: count}).Result()
+		return err
+	})
+	return vals, err
+}
+
+// RedisReadZCount counts the members scored between min and max, served by a read replica when configured
+func RedisReadZCount(key, min, max string) (int64, error) {
+	var n int64
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		n, err = c.ZCount(ctx, key, min, max).Result()
+		return err
+	})
+	return n, err
+}
+
+// RedisReadHGetAll is RedisHGetAll served by a read replica when configured
+func RedisReadHGetAll(hash string) (map[string]string, error) {
+	var vals map[string]string
+	err := redisRead(func(c *redis.Client) error {
+		var err error
+		vals, err = c.HGetAll(ctx, hash).Result()
+		return err
+	})
+	return vals, err
+}
+
+// GetRedisReplicaStatus reports the read replicas and how many reads each one served
+func GetRedisReplicaStatus() map[string]interface{} {
+	now := time.Now().UnixNano()
+	replicas := make([]map[string]interface{}, 0, len(rdbReplicas))
+	for _, r := range rdbReplicas {
+		replicas = append(replicas, map[string]interface{}{
+			"addr":     r.addr,
+			"healthy":  r.downUntil.Load() <= now,
+			"reads":    r.reads.Load(),
+			"failures": r.failures.Load(),
+		})
+	}
+	return map[string]interface{}{
+		"replicas":      replicas,
+		"primary_reads": primaryReads.Load(),
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -18,9 +17,7 @@ const (
 	RedisSampleHashKey   = "sample_hash:"
 
 	// Configuration constants
-	DefaultSampleTTL        = 24 * time.Hour // 24 hours TTL
-	DefaultMaxSamplesPerKey = 100            // Maximum 100 samples per project-sampler combination
-	DefaultCleanupInterval  = 1 * time.Hour  // Cleanup expired data every hour
+	DefaultMaxSamplesPerKey = 100 // Maximum 100 samples per project-sampler combination
 )
 
 // RedisSampleData represents sample data stored in Redis
@@ -36,7 +33,6 @@ type RedisSampleData struct {
 type RedisSampleManager struct {
 	ttl              time.Duration
 	maxSamplesPerKey int
-	cleanupTicker    *time.Ticker
 	stopChan         chan struct{}
 	batchChannel     chan SampleData // Channel for batch processing
 	batchTicker      *time.Ticker    // Ticker for batch processing
@@ -45,17 +41,13 @@ type RedisSampleManager struct {
 // NewRedisSampleManager creates a new Redis Sample Manager
 func NewRedisSampleManager() *RedisSampleManager {
 	rsm := &RedisSampleManager{
-		ttl:              DefaultSampleTTL,
+		ttl:              RetentionPeriod(RetentionSamples), // expired samples are removed by the retention janitor
 		maxSamplesPerKey: DefaultMaxSamplesPerKey,
-		cleanupTicker:    time.NewTicker(DefaultCleanupInterval),
 		stopChan:         make(chan struct{}),
 		batchChannel:     make(chan SampleData, 5000),            // Large buffer for batch processing
 		batchTicker:      time.NewTicker(200 * time.Millisecond), // Batch every 200ms
 	}
 
-	// Start cleanup goroutine
-	go rsm.startCleanup()
-
 	// Start batch processing goroutine
 	go rsm.startBatchProcessor()
 
@@ -149,7 +141,7 @@ func (rsm *RedisSampleManager) GetSamples(samplerName string) (map[string][]Samp
 	pattern := fmt.Sprintf("%s%s:*", RedisSampleKeyPrefix, samplerName)
 
 	// Get all keys matching the pattern
-	keys, err := RedisKeys(pattern)
+	keys, err := RedisReadKeys(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sample keys: %w", err)
 	}
@@ -179,7 +171,7 @@ func (rsm *RedisSampleManager) GetSamples(samplerName string) (map[string][]Samp
 // getSamplesFromKey retrieves samples from a specific Redis key
 func (rsm *RedisSampleManager) getSamplesFromKey(key string) ([]SampleData, error) {
 	// Get all samples from sorted set (latest first)
-	members, err := RedisZRevRange(key, 0, -1)
+	members, err := RedisReadZRevRange(key, 0, -1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get samples from key %s: %w", key, err)
 	}
@@ -213,7 +205,7 @@ func (rsm *RedisSampleManager) GetStats(samplerName string) (map[string]int64, e
 	pattern := fmt.Sprintf("%s%s:*", RedisSampleCountKey, samplerName)
 
 	// Get all count keys
-	keys, err := RedisKeys(pattern)
+	keys, err := RedisReadKeys(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get count keys: %w", err)
 	}
@@ -225,7 +217,7 @@ func (rsm *RedisSampleManager) GetStats(samplerName string) (map[string]int64, e
 		projectNodeSequence := key[len(fmt.Sprintf("%s%s:", RedisSampleCountKey, samplerName)):]
 
 		// Get count
-		count, err := RedisGetInt64(key)
+		count, err := RedisReadGetInt64(key)
 		if err != nil {
 			continue // Skip this key if error
 		}
@@ -283,46 +275,8 @@ func (rsm *RedisSampleManager) SetMaxSamplesPerKey(max int) {
 	rsm.maxSamplesPerKey = max
 }
 
-// startCleanup starts the cleanup routine
-func (rsm *RedisSampleManager) startCleanup() {
-	for {
-		select {
-		case <-rsm.cleanupTicker.C:
-			rsm.cleanupExpiredData()
-		case <-rsm.stopChan:
-			return
-		}
-	}
-}
-
-// cleanupExpiredData removes expired data
-func (rsm *RedisSampleManager) cleanupExpiredData() {
-	if rdb == nil {
-		return
-	}
-
-	// Get all sample keys
-	pattern := fmt.Sprintf("%s*", RedisSampleKeyPrefix)
-	keys, err := RedisKeys(pattern)
-	if err != nil {
-		return
-	}
-
-	// Remove expired samples based on timestamp
-	cutoffTime := time.Now().Add(-rsm.ttl)
-	cutoffScore := float64(cutoffTime.Unix())
-
-	for _, key := range keys {
-		// Remove samples older than TTL
-		RedisZRemRangeByScore(key, "0", strconv.FormatFloat(cutoffScore, 'f', -1, 64))
-	}
-}
-
-// Close stops the cleanup routine
+// Close stops the batch processor
 func (rsm *RedisSampleManager) Close() {
-	if rsm.cleanupTicker != nil {
-		rsm.cleanupTicker.Stop()
-	}
 	close(rsm.stopChan)
 }
 
@@ -0,0 +1,532 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+)
+
+// ReplayFieldName is the field added to every replayed event so rules and outputs can tell it from live traffic
+const ReplayFieldName = "_hub_replay"
+
+const (
+	ReplayStatusRunning   = "running"
+	ReplayStatusCompleted = "completed"
+	ReplayStatusStopped   = "stopped"
+	ReplayStatusFailed    = "failed"
+)
+
+// ReplayConfig describes which archived events are replayed and how fast
+type ReplayConfig struct {
+	// Source is a file, a directory, a glob pattern or an s3://bucket/prefix location.
+	// Archives are newline-delimited JSON, optionally gzip compressed (.gz).
+	Source string `json:"source"`
+	// From/To restrict replayed events to [From, To), zero means unbounded
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+	// Speed is a multiplier of the original event rate, 0 replays as fast as possible
+	Speed float64 `json:"speed"`
+	// TimestampField is the (dot separated) event field holding the event time, default "timestamp"
+	TimestampField string `json:"timestamp_field,omitempty"`
+	// S3 holds optional credentials for s3:// sources
+	S3 *S3Config `json:"s3,omitempty"`
+}
+
+// ReplayStats is a point-in-time view of a replay session
+type ReplayStats struct {
+	ID            string     `json:"id"`
+	InputID       string     `json:"input_id"`
+	ProjectID     string     `json:"project_id,omitempty"`
+	Source        string     `json:"source"`
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	Speed         float64    `json:"speed"`
+	Objects       int        `json:"objects"`
+	CurrentObject string     `json:"current_object,omitempty"`
+	Read          uint64     `json:"read"`
+	Replayed      uint64     `json:"replayed"`
+	Skipped       uint64     `json:"skipped"`
+	Invalid       uint64     `json:"invalid"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// Replay streams archived events into an input's downstream through Emit.
+// Emit must block until the event is accepted or ctx is done, and return false once the receiver is gone.
+type Replay struct {
+	ID        string
+	InputID   string
+	ProjectID string
+	Emit      func(ctx context.Context, event map[string]interface{}) bool
+
+	cfg    ReplayConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu            sync.Mutex
+	status        string
+	err           error
+	objects       int
+	currentObject string
+	startedAt     time.Time
+	finishedAt    *time.Time
+
+	read     uint64
+	replayed uint64
+	skipped  uint64
+	invalid  uint64
+}
+
+var (
+	replaysMu sync.RWMutex
+	replays   = make(map[string]*Replay)
+)
+
+type archiveObject struct {
+	name string
+	open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// NewReplay validates cfg and creates a replay session, Start must be called to run it
+func NewReplay(inputID, projectID string, cfg ReplayConfig, emit func(ctx context.Context, event map[string]interface{}) bool) (*Replay, error) {
+	if strings.TrimSpace(cfg.Source) == "" {
+		return nil, fmt.Errorf("replay source is required")
+	}
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative")
+	}
+	if !cfg.From.IsZero() && !cfg.To.IsZero() && !cfg.From.Before(cfg.To) {
+		return nil, fmt.Errorf("replay from must be before to")
+	}
+	if cfg.TimestampField == "" {
+		cfg.TimestampField = "timestamp"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Replay{
+		ID:        uuid.New().String(),
+		InputID:   inputID,
+		ProjectID: projectID,
+		Emit:      emit,
+		cfg:       cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		status:    ReplayStatusRunning,
+	}, nil
+}
+
+// Start registers the replay and streams the archive in the background
+func (r *Replay) Start() {
+	r.mu.Lock()
+	r.startedAt = time.Now()
+	r.mu.Unlock()
+
+	replaysMu.Lock()
+	replays[r.ID] = r
+	replaysMu.Unlock()
+
+	go func() {
+		defer close(r.done)
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Error("Panic in replay", "replay", r.ID, "input", r.InputID, "panic", p)
+				r.finish(fmt.Errorf("panic: %v", p))
+			}
+		}()
+		r.finish(r.run())
+	}()
+	logger.Info("Replay started", "replay", r.ID, "input", r.InputID, "project", r.ProjectID, "source", r.cfg.Source, "speed", r.cfg.Speed)
+}
+
+// Run reads the archive synchronously without registering the session, for callers
+// that consume events themselves such as backtests. Stop cancels it from another goroutine.
+func (r *Replay) Run() error {
+	r.mu.Lock()
+	r.startedAt = time.Now()
+	r.mu.Unlock()
+
+	defer close(r.done)
+	err := r.run()
+	r.finish(err)
+	return err
+}
+
+// Stop cancels the replay and waits for it to finish
+func (r *Replay) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Done is closed once the replay has finished
+func (r *Replay) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stats returns the current progress of the replay
+func (r *Replay) Stats() ReplayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := ReplayStats{
+		ID:            r.ID,
+		InputID:       r.InputID,
+		ProjectID:     r.ProjectID,
+		Source:        r.cfg.Source,
+		Status:        r.status,
+		Speed:         r.cfg.Speed,
+		Objects:       r.objects,
+		CurrentObject: r.currentObject,
+		Read:          atomic.LoadUint64(&r.read),
+		Replayed:      atomic.LoadUint64(&r.replayed),
+		Skipped:       atomic.LoadUint64(&r.skipped),
+		Invalid:       atomic.LoadUint64(&r.invalid),
+		StartedAt:     r.startedAt,
+		FinishedAt:    r.finishedAt,
+	}
+	if r.err != nil {
+		stats.Error = r.err.Error()
+	}
+	return stats
+}
+
+func (r *Replay) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finishedAt != nil {
+		return
+	}
+	now := time.Now()
+	r.finishedAt = &now
+	r.currentObject = ""
+	switch {
+	case err != nil:
+		r.status = ReplayStatusFailed
+		r.err = err
+		logger.Error("Replay failed", "replay", r.ID, "input", r.InputID, "error", err)
+	case r.ctx.Err() != nil:
+		r.status = ReplayStatusStopped
+		logger.Info("Replay stopped", "replay", r.ID, "input", r.InputID, "replayed", atomic.LoadUint64(&r.replayed))
+	default:
+		r.status = ReplayStatusCompleted
+		logger.Info("Replay completed", "replay", r.ID, "input", r.InputID, "replayed", atomic.LoadUint64(&r.replayed))
+	}
+}
+
+func (r *Replay) run() error {
+	objects, err := listArchiveObjects(r.ctx, r.cfg)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no archive objects found at %s", r.cfg.Source)
+	}
+	r.mu.Lock()
+	r.objects = len(objects)
+	r.mu.Unlock()
+
+	p := &replayPacer{speed: r.cfg.Speed}
+	for _, obj := range objects {
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		r.mu.Lock()
+		r.currentObject = obj.name
+		r.mu.Unlock()
+
+		if err := r.replayObject(obj, p); err != nil {
+			if r.ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to replay %s: %w", obj.name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Replay) replayObject(obj archiveObject, p *replayPacer) error {
+	rc, err := obj.open(r.ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var reader io.Reader = rc
+	if strings.HasSuffix(obj.name, ".gz") {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		atomic.AddUint64(&r.read, 1)
+
+		var event map[string]interface{}
+		if err := sonic.Unmarshal(line, &event); err != nil {
+			atomic.AddUint64(&r.invalid, 1)
+			continue
+		}
+
+		ts, hasTS := replayEventTime(event, r.cfg.TimestampField)
+		if !r.inRange(ts, hasTS) {
+			atomic.AddUint64(&r.skipped, 1)
+			continue
+		}
+		if hasTS && !p.wait(r.ctx, ts) {
+			return nil
+		}
+
+		event[ReplayFieldName] = map[string]interface{}{"id": r.ID, "source": r.cfg.Source}
+		if !r.Emit(r.ctx, event) {
+			r.cancel()
+			return nil
+		}
+		atomic.AddUint64(&r.replayed, 1)
+	}
+	return scanner.Err()
+}
+
+func (r *Replay) inRange(ts time.Time, hasTS bool) bool {
+	if r.cfg.From.IsZero() && r.cfg.To.IsZero() {
+		return true
+	}
+	if !hasTS {
+		return false
+	}
+	if !r.cfg.From.IsZero() && ts.Before(r.cfg.From) {
+		return false
+	}
+	if !r.cfg.To.IsZero() && !ts.Before(r.cfg.To) {
+		return false
+	}
+	return true
+}
+
+// replayPacer spaces events by their original time distance divided by speed
+type replayPacer struct {
+	speed     float64
+	firstTS   time.Time
+	firstWall time.Time
+}
+
+func (p *replayPacer) wait(ctx context.Context, ts time.Time) bool {
+	if p.speed <= 0 {
+		return ctx.Err() == nil
+	}
+	if p.firstTS.IsZero() {
+		p.firstTS = ts
+		p.firstWall = time.Now()
+		return ctx.Err() == nil
+	}
+	target := p.firstWall.Add(time.Duration(float64(ts.Sub(p.firstTS)) / p.speed))
+	delay := time.Until(target)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// replayEventTime reads the event time from a dot separated field path
+func replayEventTime(event map[string]interface{}, field string) (time.Time, bool) {
+	var v interface{} = event
+	for _, part := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return time.Time{}, false
+		}
+		if v, ok = m[part]; !ok {
+			return time.Time{}, false
+		}
+	}
+	return ParseEventTime(v)
+}
+
+// ParseEventTime converts the value of a timestamp field to a time.
+// RFC3339 strings and unix timestamps in seconds or milliseconds are supported.
+func ParseEventTime(v interface{}) (time.Time, bool) {
+	var num float64
+	switch val := v.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return t, true
+		}
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		num = n
+	case float64:
+		num = val
+	case int64:
+		num = float64(val)
+	case int:
+		num = float64(val)
+	default:
+		return time.Time{}, false
+	}
+	if num > 1e12 {
+		return time.UnixMilli(int64(num)), true
+	}
+	return time.Unix(int64(num), int64((num-float64(int64(num)))*1e9)), true
+}
+
+// listArchiveObjects resolves a replay source to the archive objects to read, in name order
+func listArchiveObjects(ctx context.Context, cfg ReplayConfig) ([]archiveObject, error) {
+	if strings.HasPrefix(cfg.Source, "s3://") {
+		bucket, prefix, err := ParseS3URL(cfg.Source)
+		if err != nil {
+			return nil, err
+		}
+		s3cfg := S3Config{}
+		if cfg.S3 != nil {
+			s3cfg = *cfg.S3
+		}
+		client, err := NewS3Client(s3cfg)
+		if err != nil {
+			return nil, err
+		}
+		listed, err := client.ListObjects(ctx, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects := make([]archiveObject, 0, len(listed))
+		for _, o := range listed {
+			if strings.HasSuffix(o.Key, "/") || o.Size == 0 {
+				continue
+			}
+			key := o.Key
+			objects = append(objects, archiveObject{
+				name: key,
+				open: func(ctx context.Context) (io.ReadCloser, error) {
+					return client.GetObject(ctx, bucket, key)
+				},
+			})
+		}
+		return objects, nil
+	}
+
+	var paths []string
+	if strings.ContainsAny(cfg.Source, "*?[") {
+		matches, err := filepath.Glob(cfg.Source)
+		if err != nil {
+			return nil, err
+		}
+		paths = matches
+	} else {
+		info, err := os.Stat(cfg.Source)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = []string{cfg.Source}
+		} else {
+			err := filepath.WalkDir(cfg.Source, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					paths = append(paths, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	objects := make([]archiveObject, 0, len(paths))
+	for _, path := range paths {
+		p := path
+		objects = append(objects, archiveObject{
+			name: p,
+			open: func(context.Context) (io.ReadCloser, error) {
+				return os.Open(p)
+			},
+		})
+	}
+	return objects, nil
+}
+
+// GetReplay returns a replay session by id
+func GetReplay(id string) (*Replay, bool) {
+	replaysMu.RLock()
+	defer replaysMu.RUnlock()
+	r, ok := replays[id]
+	return r, ok
+}
+
+// ListReplays returns the stats of all replay sessions started on this node, newest first
+func ListReplays() []ReplayStats {
+	replaysMu.RLock()
+	list := make([]ReplayStats, 0, len(replays))
+	for _, r := range replays {
+		list = append(list, r.Stats())
+	}
+	replaysMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// StopInputReplays stops all running replays feeding the given input
+func StopInputReplays(inputID string) {
+	replaysMu.RLock()
+	var running []*Replay
+	for _, r := range replays {
+		if r.InputID == inputID {
+			running = append(running, r)
+		}
+	}
+	replaysMu.RUnlock()
+
+	for _, r := range running {
+		r.Stop()
+	}
+}
+
+// PruneReplays drops finished replay sessions older than maxAge
+func PruneReplays(maxAge time.Duration) {
+	replaysMu.Lock()
+	defer replaysMu.Unlock()
+	for id, r := range replays {
+		r.mu.Lock()
+		expired := r.finishedAt != nil && time.Since(*r.finishedAt) > maxAge
+		r.mu.Unlock()
+		if expired {
+			delete(replays, id)
+		}
+	}
+}
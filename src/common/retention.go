@@ -0,0 +1,384 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+const (
+	defaultRetentionSamplesDays          = 1
+	defaultRetentionErrorLogsDays        = 14
+	defaultRetentionOperationHistoryDays = 31
+	defaultRetentionStatsDays            = 10
+	defaultRetentionAlertsDays           = 7
+	defaultRetentionInterval             = time.Hour
+
+	errorLogKeyPattern  = "cluster:error_logs:*"
+	opsHistoryKey       = "cluster:ops_history"
+	dailyStatsKeyPrefix = "hub:daily_stats:"
+)
+
+// Retention artifact names used in janitor reports
+const (
+	RetentionSamples          = "samples"
+	RetentionErrorLogs        = "error_logs"
+	RetentionOperationHistory = "operation_history"
+	RetentionDailyStats       = "daily_stats"
+	RetentionDeliveryReceipts = "delivery_receipts"
+	RetentionFiredAlerts      = "fired_alerts"
+)
+
+// RetentionConfig is the central retention policy for everything the hub keeps in Redis
+type RetentionConfig struct {
+	SamplesDays          int    `yaml:"samples_days,omitempty" json:"samples_days"`                     // Component data samples, default 1
+	ErrorLogsDays        int    `yaml:"error_logs_days,omitempty" json:"error_logs_days"`               // Error logs of every node, default 14
+	OperationHistoryDays int    `yaml:"operation_history_days,omitempty" json:"operation_history_days"` // Operations history, default 31
+	StatsDays            int    `yaml:"stats_days,omitempty" json:"stats_days"`                         // Daily message statistics and delivery receipts, default 10
+	AlertsDays           int    `yaml:"alerts_days,omitempty" json:"alerts_days"`                       // Fired alerts index queried by GET /alerts, default 7
+	Interval             string `yaml:"interval,omitempty" json:"interval"`                             // How often the janitor runs, default 1h
+	DryRun               bool   `yaml:"dry_run,omitempty" json:"dry_run"`                               // Only report what would be removed
+}
+
+// GetRetentionPolicy returns the configured retention policy with defaults applied
+func GetRetentionPolicy() RetentionConfig {
+	var policy RetentionConfig
+	if Config != nil && Config.Retention != nil {
+		policy = *Config.Retention
+	}
+	if policy.SamplesDays <= 0 {
+		policy.SamplesDays = defaultRetentionSamplesDays
+	}
+	if policy.ErrorLogsDays <= 0 {
+		policy.ErrorLogsDays = defaultRetentionErrorLogsDays
+	}
+	if policy.OperationHistoryDays <= 0 {
+		policy.OperationHistoryDays = defaultRetentionOperationHistoryDays
+	}
+	if policy.StatsDays <= 0 {
+		policy.StatsDays = defaultRetentionStatsDays
+	}
+	if policy.AlertsDays <= 0 {
+		policy.AlertsDays = defaultRetentionAlertsDays
+	}
+	if policy.Interval == "" {
+		policy.Interval = defaultRetentionInterval.String()
+	}
+	return policy
+}
+
+// RetentionPeriod returns how long an artifact is kept under the current policy
+func RetentionPeriod(artifact string) time.Duration {
+	policy := GetRetentionPolicy()
+	days := 0
+	switch artifact {
+	case RetentionSamples:
+		days = policy.SamplesDays
+	case RetentionErrorLogs:
+		days = policy.ErrorLogsDays
+	case RetentionOperationHistory:
+		days = policy.OperationHistoryDays
+	case RetentionDailyStats, RetentionDeliveryReceipts:
+		days = policy.StatsDays
+	case RetentionFiredAlerts:
+		days = policy.AlertsDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RetentionSeconds is RetentionPeriod in seconds, as used for Redis TTLs
+func RetentionSeconds(artifact string) int {
+	return int(RetentionPeriod(artifact).Seconds())
+}
+
+// RetentionArtifactReport is what one janitor run found for one artifact
+type RetentionArtifactReport struct {
+	Artifact      string    `json:"artifact"`
+	RetentionDays int       `json:"retention_days"`
+	Cutoff        time.Time `json:"cutoff"`
+	KeysScanned   int       `json:"keys_scanned"`
+	ExpiredItems  int64     `json:"expired_items"` // list entries, sorted set members or whole keys
+	KeysDeleted   int       `json:"keys_deleted"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// RetentionReport is the result of one janitor run
+type RetentionReport struct {
+	StartedAt  time.Time                 `json:"started_at"`
+	DurationMs int64                     `json:"duration_ms"`
+	DryRun     bool                      `json:"dry_run"`
+	Artifacts  []RetentionArtifactReport `json:"artifacts"`
+}
+
+// RetentionJanitor applies the retention policy to all Redis-stored artifacts of the cluster.
+// It runs on the leader only, since the data is shared by all nodes.
+type RetentionJanitor struct {
+	interval time.Duration
+	dryRun   bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	runMu      sync.Mutex // one run at a time
+	mu         sync.RWMutex
+	lastReport *RetentionReport
+}
+
+var GlobalRetentionJanitor *RetentionJanitor
+
+// InitRetentionJanitor starts the global retention janitor
+func InitRetentionJanitor() {
+	if GlobalRetentionJanitor != nil {
+		return
+	}
+	policy := GetRetentionPolicy()
+	interval, err := time.ParseDuration(policy.Interval)
+	if err != nil || interval <= 0 {
+		logger.Warn("Invalid retention interval, using default", "interval", policy.Interval, "default", defaultRetentionInterval)
+		interval = defaultRetentionInterval
+	}
+
+	j := &RetentionJanitor{
+		interval: interval,
+		dryRun:   policy.DryRun,
+		stopChan: make(chan struct{}),
+	}
+	GlobalRetentionJanitor = j
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stopChan:
+				return
+			case <-ticker.C:
+				if steppedDown, _, _ := IsLeaderSteppedDown(); steppedDown {
+					continue
+				}
+				j.Run(j.dryRun)
+			}
+		}
+	}()
+	logger.Info("Retention janitor started", "interval", interval, "dry_run", policy.DryRun,
+		"samples_days", policy.SamplesDays, "error_logs_days", policy.ErrorLogsDays,
+		"operation_history_days", policy.OperationHistoryDays, "stats_days", policy.StatsDays, "alerts_days", policy.AlertsDays)
+}
+
+// StopRetentionJanitor stops the global retention janitor
+func StopRetentionJanitor() {
+	if GlobalRetentionJanitor != nil {
+		close(GlobalRetentionJanitor.stopChan)
+		GlobalRetentionJanitor.wg.Wait()
+		GlobalRetentionJanitor = nil
+	}
+}
+
+// LastReport returns the report of the last run, nil before the first run
+func (j *RetentionJanitor) LastReport() *RetentionReport {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.lastReport
+}
+
+// Run applies the retention policy once. With dryRun nothing is removed and the report
+// shows what a real run would remove.
+func (j *RetentionJanitor) Run(dryRun bool) *RetentionReport {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
+	policy := GetRetentionPolicy()
+	now := time.Now()
+	report := &RetentionReport{StartedAt: now, DryRun: dryRun}
+
+	for _, step := range []struct {
+		artifact string
+		days     int
+		apply    func(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error
+	}{
+		{RetentionSamples, policy.SamplesDays, retainSamples},
+		{RetentionErrorLogs, policy.ErrorLogsDays, retainErrorLogs},
+		{RetentionOperationHistory, policy.OperationHistoryDays, retainOperationHistory},
+		{RetentionDailyStats, policy.StatsDays, retainDailyStats},
+		{RetentionDeliveryReceipts, policy.StatsDays, retainDeliveryReceipts},
+		{RetentionFiredAlerts, policy.AlertsDays, retainFiredAlerts},
+	} {
+		r := RetentionArtifactReport{
+			Artifact:      step.artifact,
+			RetentionDays: step.days,
+			Cutoff:        now.Add(-time.Duration(step.days) * 24 * time.Hour),
+		}
+		if err := step.apply(r.Cutoff, dryRun, &r); err != nil {
+			r.Error = err.Error()
+			logger.Warn("Retention janitor failed", "artifact", step.artifact, "error", err)
+		}
+		report.Artifacts = append(report.Artifacts, r)
+	}
+	report.DurationMs = time.Since(now).Milliseconds()
+
+	var expired int64
+	for _, r := range report.Artifacts {
+		expired += r.ExpiredItems
+	}
+	if dryRun {
+		logger.Info("Retention janitor dry run", "would_remove", expired, "duration_ms", report.DurationMs)
+	} else {
+		logger.Info("Retention janitor run", "removed", expired, "duration_ms", report.DurationMs)
+	}
+
+	j.mu.Lock()
+	j.lastReport = report
+	j.mu.Unlock()
+	return report
+}
+
+// retainSamples removes samples older than the cutoff from the sample sorted sets
+func retainSamples(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	keys, err := RedisKeys(RedisSampleKeyPrefix + "*")
+	if err != nil {
+		return err
+	}
+	return retainScoredKeys(keys, strconv.FormatInt(cutoff.Unix(), 10), dryRun, r)
+}
+
+// retainScoredKeys removes the members scored below maxScore from sorted sets
+func retainScoredKeys(keys []string, maxScore string, dryRun bool, r *RetentionArtifactReport) error {
+	r.KeysScanned = len(keys)
+	for _, key := range keys {
+		var n int64
+		var err error
+		if dryRun {
+			n, err = rdb.ZCount(context.Background(), key, "-inf", "("+maxScore).Result()
+		} else {
+			n, err = rdb.ZRemRangeByScore(context.Background(), key, "-inf", "("+maxScore).Result()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		r.ExpiredItems += n
+	}
+	return nil
+}
+
+// retainErrorLogs trims the per-node error log lists
+func retainErrorLogs(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	keys, err := RedisKeys(errorLogKeyPattern)
+	if err != nil {
+		return err
+	}
+	r.KeysScanned = len(keys)
+	for _, key := range keys {
+		if err := retainTimestampedList(key, cutoff, dryRun, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retainOperationHistory trims the cluster operations history and sampler access lists
+func retainOperationHistory(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	r.KeysScanned = 2
+	for _, key := range []string{opsHistoryKey, samplerAccessKey} {
+		if err := retainTimestampedList(key, cutoff, dryRun, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retainTimestampedList trims a newest-first list of JSON records with a "timestamp" field
+// to the records newer than the cutoff
+func retainTimestampedList(key string, cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	entries, err := RedisLRange(key, 0, -1)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Entries are pushed to the head, so the first expired entry starts the expired tail.
+	// Records written concurrently can be slightly out of order, which only delays their removal.
+	keep := sort.Search(len(entries), func(i int) bool {
+		var record struct {
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal([]byte(entries[i]), &record); err != nil {
+			return false
+		}
+		return record.Timestamp.Before(cutoff)
+	})
+	expired := len(entries) - keep
+	if expired == 0 {
+		return nil
+	}
+	r.ExpiredItems += int64(expired)
+	if dryRun {
+		return nil
+	}
+
+	if keep == 0 {
+		r.KeysDeleted++
+		return RedisDel(key)
+	}
+	if err := rdb.LTrim(context.Background(), key, 0, int64(keep-1)).Err(); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// retainDailyStats deletes daily statistics of days before the cutoff
+func retainDailyStats(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	return retainDatedKeys(dailyStatsKeyPrefix, func(suffix string) (time.Time, bool) {
+		date, _, _ := strings.Cut(suffix, "#")
+		t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		// Keep the whole day until its end has passed the cutoff
+		return t.AddDate(0, 0, 1), err == nil
+	}, cutoff, dryRun, r)
+}
+
+// retainDeliveryReceipts deletes hourly delivery receipt windows before the cutoff
+func retainDeliveryReceipts(cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	return retainDatedKeys(deliveryReceiptsKeyPrefix, func(suffix string) (time.Time, bool) {
+		t, err := time.Parse(deliveryWindowLayout, suffix)
+		return t.Add(time.Hour), err == nil
+	}, cutoff, dryRun, r)
+}
+
+// retainDatedKeys deletes keys whose name ends before the cutoff. end parses the part
+// after prefix into the end of the period the key covers.
+func retainDatedKeys(prefix string, end func(suffix string) (time.Time, bool), cutoff time.Time, dryRun bool, r *RetentionArtifactReport) error {
+	keys, err := RedisKeys(prefix + "*")
+	if err != nil {
+		return err
+	}
+	r.KeysScanned = len(keys)
+
+	var expired []string
+	for _, key := range keys {
+		if t, ok := end(strings.TrimPrefix(key, prefix)); ok && t.Before(cutoff) {
+			expired = append(expired, key)
+		}
+	}
+	r.ExpiredItems += int64(len(expired))
+	if dryRun || len(expired) == 0 {
+		return nil
+	}
+
+	for start := 0; start < len(expired); start += 500 {
+		batch := expired[start:min(start+500, len(expired))]
+		if err := RedisDelMultiple(batch...); err != nil {
+			return err
+		}
+		r.KeysDeleted += len(batch)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	riskKeyPrefix       = "hub:risk:"
+	defaultRiskHalfLife = 24 * time.Hour
+	// riskEraHalfLives is the length of an era in half-lives. Scores are stored relative to the
+	// start of their era, so they grow by at most 2^32 within an era, and a score older than an
+	// era has lost all but 2^-32 of its weight.
+	riskEraHalfLives = 32
+	// riskMinScore hides the entities whose score decayed to almost nothing
+	riskMinScore = 0.01
+)
+
+// RiskConfig configures the entity risk scores of <score> elements
+type RiskConfig struct {
+	HalfLife time.Duration `yaml:"half_life,omitempty"` // time for a score to halve, default 24h
+}
+
+// Validate checks the risk configuration
+func (c *RiskConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.HalfLife < 0 {
+		return fmt.Errorf("risk half_life cannot be negative")
+	}
+	if c.HalfLife > 0 && c.HalfLife < time.Minute {
+		return fmt.Errorf("risk half_life must be at least 1m")
+	}
+	return nil
+}
+
+// RiskEntity is the current score of an entity
+type RiskEntity struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+var riskHalfLife atomic.Int64
+
+// InitRisk sets the decay of entity risk scores
+func InitRisk(cfg *RiskConfig) {
+	halfLife := defaultRiskHalfLife
+	if cfg != nil && cfg.HalfLife > 0 {
+		halfLife = cfg.HalfLife
+	}
+	riskHalfLife.Store(int64(halfLife))
+}
+
+// RiskHalfLife is the time for a score to halve
+func RiskHalfLife() time.Duration {
+	if h := riskHalfLife.Load(); h > 0 {
+		return time.Duration(h)
+	}
+	return defaultRiskHalfLife
+}
+
+// riskEra returns the era of t and its start. The sorted set of an era holds the scores of an
+// entity type multiplied by 2^((t - start) / half-life), so adding a weight is a single ZINCRBY
+// and every score of the set decays at the same rate.
+func riskEra(t time.Time, halfLife time.Duration) (int64, time.Time) {
+	length := int64(halfLife) * riskEraHalfLives
+	era := t.UnixNano() / length
+	return era, time.Unix(0, era*length)
+}
+
+func riskKey(entity string, halfLife time.Duration, era int64) string {
+	return riskKeyPrefix + strconv.FormatInt(int64(halfLife/time.Second), 10) + ":" + entity + ":" + strconv.FormatInt(era, 10)
+}
+
+// riskDecay returns the factor turning a score stored relative to start into a score at t
+func riskDecay(start, t time.Time, halfLife time.Duration) float64 {
+	return math.Exp2(-float64(t.Sub(start)) / float64(halfLife))
+}
+
+// validateRiskEntity checks the entity type and id of a score
+func validateRiskEntity(entity, id string) error {
+	if entity == "" || strings.Contains(entity, ":") {
+		return fmt.Errorf("invalid risk entity type '%s'", entity)
+	}
+	if id == "" {
+		return errors.New("risk entity id cannot be empty")
+	}
+	return nil
+}
+
+// RiskAdd adds weight to the score of the entity id of an entity type, such as a user name or an
+// IP address, and returns the score of the entity. Scores are kept in Redis, shared by the
+// cluster, and halve every half-life.
+func RiskAdd(entity, id string, weight float64) (float64, error) {
+	if err := validateRiskEntity(entity, id); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	halfLife := RiskHalfLife()
+	era, start := riskEra(now, halfLife)
+	key := riskKey(entity, halfLife, era)
+	_, prevStart := riskEra(start.Add(-1), halfLife)
+
+	pipe := rdb.TxPipeline()
+	incrCmd := pipe.ZIncrBy(ctx, key, weight/riskDecay(start, now, halfLife), id)
+	pipe.Expire(ctx, key, 2*riskEraHalfLives*halfLife)
+	prevCmd := pipe.ZScore(ctx, riskKey(entity, halfLife, era-1), id)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	score := incrCmd.Val() * riskDecay(start, now, halfLife)
+	if prev, err := prevCmd.Result(); err == nil {
+		score += prev * riskDecay(prevStart, now, halfLife)
+	}
+	return score, nil
+}
+
+// RiskScore returns the current score of an entity, 0 when it has none
+func RiskScore(entity, id string) (float64, error) {
+	if err := validateRiskEntity(entity, id); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	halfLife := RiskHalfLife()
+	era, start := riskEra(now, halfLife)
+	_, prevStart := riskEra(start.Add(-1), halfLife)
+
+	pipe := rdb.Pipeline()
+	curCmd := pipe.ZScore(ctx, riskKey(entity, halfLife, era), id)
+	prevCmd := pipe.ZScore(ctx, riskKey(entity, halfLife, era-1), id)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	var score float64
+	if cur, err := curCmd.Result(); err == nil {
+		score += cur * riskDecay(start, now, halfLife)
+	}
+	if prev, err := prevCmd.Result(); err == nil {
+		score += prev * riskDecay(prevStart, now, halfLife)
+	}
+	return score, nil
+}
+
+// RiskTop returns the limit entities of an entity type with the highest scores
+func RiskTop(entity string, limit int) ([]RiskEntity, error) {
+	if err := validateRiskEntity(entity, "-"); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return []RiskEntity{}, nil
+	}
+	halfLife := RiskHalfLife()
+	era, _ := riskEra(time.Now(), halfLife)
+
+	// The top entities of either era are the candidates, their score is the sum of both eras
+	candidates := make(map[string]struct{})
+	for _, e := range []int64{era, era - 1} {
+		top, err := rdb.ZRevRangeWithScores(ctx, riskKey(entity, halfLife, e), 0, int64(limit-1)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range top {
+			if id, ok := z.Member.(string); ok {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+	result := make([]RiskEntity, 0, len(candidates))
+	for id := range candidates {
+		score, err := RiskScore(entity, id)
+		if err != nil {
+			return nil, err
+		}
+		if score >= riskMinScore {
+			result = append(result, RiskEntity{ID: id, Score: score})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].ID < result[j].ID
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
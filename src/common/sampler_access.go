@@ -0,0 +1,71 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultSamplerGroupsClaim = "groups"
+
+// SamplerAccessConfig limits who can read sampled events, which are raw production data.
+// Without it every authenticated user can read samples.
+type SamplerAccessConfig struct {
+	Users       []string `yaml:"users,omitempty"`        // OIDC usernames allowed to read samples
+	Groups      []string `yaml:"groups,omitempty"`       // OIDC groups allowed to read samples
+	GroupsClaim string   `yaml:"groups_claim,omitempty"` // ID token claim holding the groups, default groups
+	Token       *bool    `yaml:"token,omitempty"`        // whether the hub token, also used by MCP, can read samples, default true
+}
+
+// Validate checks a sampler access config
+func (c *SamplerAccessConfig) Validate() error {
+	if len(c.Users) == 0 && len(c.Groups) == 0 && !c.tokenAllowed() {
+		return fmt.Errorf("sampler_access allows nobody, set users, groups or token")
+	}
+	return nil
+}
+
+func (c *SamplerAccessConfig) tokenAllowed() bool {
+	return c.Token == nil || *c.Token
+}
+
+// Allows reports whether an authenticated identity may read samples. claims are the ID token
+// claims of OIDC users and nil for the hub token.
+func (c *SamplerAccessConfig) Allows(authType, identity string, claims map[string]interface{}) bool {
+	if c == nil {
+		return true
+	}
+	if authType == "token" {
+		return c.tokenAllowed()
+	}
+	for _, u := range c.Users {
+		if identity != "" && strings.EqualFold(strings.TrimSpace(u), identity) {
+			return true
+		}
+	}
+	if len(c.Groups) == 0 {
+		return false
+	}
+	claim := c.GroupsClaim
+	if claim == "" {
+		claim = defaultSamplerGroupsClaim
+	}
+	var groups []string
+	switch v := claims[claim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = strings.Split(v, ",")
+	}
+	for _, g := range groups {
+		for _, allowed := range c.Groups {
+			if strings.EqualFold(strings.TrimSpace(g), strings.TrimSpace(allowed)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Targets a schema contract report can be sent to
+const (
+	SchemaContractNotifySlack    = "slack"
+	SchemaContractNotifyTeams    = "teams"
+	SchemaContractNotifyDingTalk = "dingtalk"
+	SchemaContractNotifyWebhook  = "webhook"
+)
+
+const (
+	defaultSchemaContractInterval = 15 * time.Minute
+	defaultSchemaContractSamples  = 5
+	maxSchemaContractErrorKinds   = 50
+	maxSchemaContractSampleLength = 1000
+	maxSchemaContractTopErrors    = 10
+
+	schemaContractTitle = `Schema contract violated by input {{.input}}`
+	schemaContractText  = `{{.violations}} events of input {{.input}} (owner: {{.owner}}, node: {{.node}}) violated the schema contract between {{.start}} and {{.end}}.
+
+Top violations:
+{{range .top_errors}}- {{.count}}x {{.error}}
+{{end}}{{if .omitted_errors}}- {{.omitted_errors}} more
+{{end}}
+Samples:
+{{range .samples}}- {{.event}}
+  {{range .errors}}{{.}}; {{end}}
+{{end}}`
+)
+
+// SchemaContractConfig holds the settings of a schema contract reporter
+type SchemaContractConfig struct {
+	InputID       string
+	Owner         string        // team producing the input
+	Interval      time.Duration // report window, default 15m
+	MinViolations int           // violations in a window needed to send a report, default 1
+	Samples       int           // sample events per report, default 5
+
+	Notify  string // slack, teams, dingtalk or webhook
+	URL     string // incoming webhook or HTTP endpoint
+	Secret  string // dingtalk signing secret
+	Headers map[string]string
+}
+
+// SchemaContractReporter aggregates the schema violations of an input and reports them
+// to the producing team once per window through a chat or webhook producer
+type SchemaContractReporter struct {
+	cfg     SchemaContractConfig
+	msgChan chan map[string]interface{}
+	close   func()
+
+	mu          sync.Mutex
+	windowStart time.Time
+	violations  int
+	errors      map[string]int
+	otherErrors int
+	samples     []map[string]interface{}
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	violationTotal uint64
+	reports        uint64
+	dropped        uint64
+}
+
+// NewSchemaContractReporter starts the producer of the notify target and the report timer
+func NewSchemaContractReporter(cfg SchemaContractConfig) (*SchemaContractReporter, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultSchemaContractInterval
+	}
+	if cfg.MinViolations <= 0 {
+		cfg.MinViolations = 1
+	}
+	if cfg.Samples <= 0 {
+		cfg.Samples = defaultSchemaContractSamples
+	}
+
+	r := &SchemaContractReporter{
+		cfg:         cfg,
+		msgChan:     make(chan map[string]interface{}, 16),
+		windowStart: time.Now(),
+		errors:      make(map[string]int),
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	switch cfg.Notify {
+	case SchemaContractNotifySlack, SchemaContractNotifyTeams, SchemaContractNotifyDingTalk:
+		p, err := NewChatNotifyProducer(ChatNotifyConfig{
+			Platform:      cfg.Notify,
+			WebhookURL:    cfg.URL,
+			Secret:        cfg.Secret,
+			TitleTemplate: schemaContractTitle,
+			TextTemplate:  schemaContractText,
+		}, r.msgChan)
+		if err != nil {
+			return nil, err
+		}
+		r.close = p.Close
+	case SchemaContractNotifyWebhook:
+		// The report is posted as JSON, the default webhook body
+		p, err := NewWebhookProducer(WebhookConfig{URL: cfg.URL, Headers: cfg.Headers}, r.msgChan)
+		if err != nil {
+			return nil, err
+		}
+		r.close = p.Close
+	default:
+		return nil, fmt.Errorf("unsupported schema contract notify type: %s", cfg.Notify)
+	}
+
+	go r.run()
+	return r, nil
+}
+
+func (r *SchemaContractReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopChan:
+			r.report()
+			return
+		case <-ticker.C:
+			r.report()
+		}
+	}
+}
+
+// Record counts one event that failed the schema and keeps it as a sample while there is room.
+// It is nil-safe so inputs without a contract can call it unconditionally.
+func (r *SchemaContractReporter) Record(msg map[string]interface{}, errs []string) {
+	if r == nil {
+		return
+	}
+	atomic.AddUint64(&r.violationTotal, 1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.violations++
+	for _, e := range errs {
+		if _, ok := r.errors[e]; ok || len(r.errors) < maxSchemaContractErrorKinds {
+			r.errors[e]++
+		} else {
+			r.otherErrors++
+		}
+	}
+	if len(r.samples) < r.cfg.Samples {
+		// Encode now, the event keeps flowing and may be modified downstream
+		event, _ := json.Marshal(msg)
+		r.samples = append(r.samples, map[string]interface{}{
+			"event":  truncateRunes(string(event), maxSchemaContractSampleLength),
+			"errors": append([]string(nil), errs...),
+		})
+	}
+}
+
+// report sends the violations of the ending window when there are enough of them and starts a new window
+func (r *SchemaContractReporter) report() {
+	r.mu.Lock()
+	now := time.Now()
+	start, violations, counts, otherErrors, samples := r.windowStart, r.violations, r.errors, r.otherErrors, r.samples
+	r.windowStart, r.violations, r.errors, r.otherErrors, r.samples = now, 0, make(map[string]int), 0, nil
+	r.mu.Unlock()
+
+	if violations == 0 || violations < r.cfg.MinViolations {
+		return
+	}
+
+	kinds := make([]string, 0, len(counts))
+	for e := range counts {
+		kinds = append(kinds, e)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if counts[kinds[i]] != counts[kinds[j]] {
+			return counts[kinds[i]] > counts[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	omitted := otherErrors
+	if len(kinds) > maxSchemaContractTopErrors {
+		for _, e := range kinds[maxSchemaContractTopErrors:] {
+			omitted += counts[e]
+		}
+		kinds = kinds[:maxSchemaContractTopErrors]
+	}
+	top := make([]map[string]interface{}, 0, len(kinds))
+	for _, e := range kinds {
+		top = append(top, map[string]interface{}{"error": e, "count": counts[e]})
+	}
+
+	msg := map[string]interface{}{
+		"input":          r.cfg.InputID,
+		"owner":          r.cfg.Owner,
+		"node":           GetNodeID(),
+		"violations":     violations,
+		"start":          start.UTC().Format(time.RFC3339),
+		"end":            now.UTC().Format(time.RFC3339),
+		"top_errors":     top,
+		"omitted_errors": omitted,
+		"samples":        samples,
+	}
+	select {
+	case r.msgChan <- msg:
+		atomic.AddUint64(&r.reports, 1)
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+		logger.Warn("Schema contract report queue full, dropping report", "input", r.cfg.InputID, "violations", violations)
+	}
+}
+
+// Close sends the report of the current window and waits for the producer to deliver it
+func (r *SchemaContractReporter) Close() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stopChan) })
+	<-r.done
+	close(r.msgChan)
+	r.close()
+}
+
+// GetStats returns the recorded violations and how many reports were queued or dropped
+func (r *SchemaContractReporter) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"violations":      atomic.LoadUint64(&r.violationTotal),
+		"reports":         atomic.LoadUint64(&r.reports),
+		"reports_dropped": atomic.LoadUint64(&r.dropped),
+	}
+}
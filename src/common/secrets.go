@@ -0,0 +1,317 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSecretsEnvPrefix  = "HUB_SECRET_"
+	defaultSecretsCacheTTL   = 5 * time.Minute
+	defaultVaultMount        = "secret"
+	defaultVaultField        = "value"
+	secretsProviderTimeout   = 10 * time.Second
+	secretsProviderRespLimit = 1 << 20
+)
+
+// SecretRefPattern matches a ${secret:name} reference
+var SecretRefPattern = regexp.MustCompile(`\$\{secret:([^}\s]+)\}`)
+
+// SecretsConfig configures the providers of ${secret:...} references in plugins and output configs
+type SecretsConfig struct {
+	// Secrets kept in config.yaml, by name
+	Values map[string]string `yaml:"values,omitempty"`
+	// ${secret:db_password} reads HUB_SECRET_DB_PASSWORD when it is not in values
+	EnvPrefix string `yaml:"env_prefix,omitempty"`
+	// ${secret:vault:<path>#<field>} reads a HashiCorp Vault KV v2 secret
+	Vault *VaultSecretsConfig `yaml:"vault,omitempty"`
+	// ${secret:aws:<secret id>#<json field>} reads an AWS Secrets Manager secret
+	AWS *S3Config `yaml:"aws,omitempty"`
+	// How long values from Vault and AWS are reused, default 5m
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+}
+
+// VaultSecretsConfig is the Vault server of ${secret:vault:...} references
+type VaultSecretsConfig struct {
+	Address   string `yaml:"address"`
+	Token     string `yaml:"token,omitempty"` // VAULT_TOKEN when empty
+	Namespace string `yaml:"namespace,omitempty"`
+	Mount     string `yaml:"mount,omitempty"` // KV v2 mount, default secret
+}
+
+// Validate checks the secrets configuration
+func (c *SecretsConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("secrets cache_ttl cannot be negative")
+	}
+	if c.Vault != nil && strings.TrimSpace(c.Vault.Address) == "" {
+		return fmt.Errorf("secrets vault address is required")
+	}
+	return nil
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+var (
+	secretsMu     sync.RWMutex
+	secretsConfig *SecretsConfig
+	secretsCache  = make(map[string]cachedSecret)
+	secretsClient = &http.Client{Timeout: secretsProviderTimeout}
+)
+
+// InitSecrets sets the providers of ${secret:...} references
+func InitSecrets(cfg *SecretsConfig) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secretsConfig = cfg
+	secretsCache = make(map[string]cachedSecret)
+}
+
+// HasSecretRefs reports whether s references a secret
+func HasSecretRefs(s string) bool {
+	return strings.Contains(s, "${secret:")
+}
+
+// ResolveSecretRefs replaces the ${secret:...} references of s by their values. The result must
+// only be used to load a component, never stored as its raw config.
+func ResolveSecretRefs(s string) (string, error) {
+	if !HasSecretRefs(s) {
+		return s, nil
+	}
+	var firstErr error
+	resolved := SecretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if firstErr != nil {
+			return ref
+		}
+		value, err := GetSecret(SecretRefPattern.FindStringSubmatch(ref)[1])
+		if err != nil {
+			firstErr = err
+			return ref
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return resolved, nil
+}
+
+// GetSecret returns the value of a secret reference without the ${secret:...} wrapping: a name,
+// vault:<path>#<field> or aws:<secret id>#<json field>
+func GetSecret(ref string) (string, error) {
+	secretsMu.RLock()
+	cfg := secretsConfig
+	cached, ok := secretsCache[ref]
+	secretsMu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	var value string
+	var err error
+	cache := true
+	switch {
+	case strings.HasPrefix(ref, "vault:"):
+		value, err = getVaultSecret(cfg, strings.TrimPrefix(ref, "vault:"))
+	case strings.HasPrefix(ref, "aws:"):
+		value, err = getAWSSecret(cfg, strings.TrimPrefix(ref, "aws:"))
+	default:
+		// config.yaml and the environment are read every time, they are cheap
+		value, err = getLocalSecret(cfg, ref)
+		cache = false
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", ref, err)
+	}
+
+	if cache {
+		ttl := defaultSecretsCacheTTL
+		if cfg != nil && cfg.CacheTTL > 0 {
+			ttl = cfg.CacheTTL
+		}
+		secretsMu.Lock()
+		secretsCache[ref] = cachedSecret{value: value, expires: time.Now().Add(ttl)}
+		secretsMu.Unlock()
+	}
+	return value, nil
+}
+
+func getLocalSecret(cfg *SecretsConfig, name string) (string, error) {
+	prefix := defaultSecretsEnvPrefix
+	if cfg != nil {
+		if v, ok := cfg.Values[name]; ok {
+			return v, nil
+		}
+		if cfg.EnvPrefix != "" {
+			prefix = cfg.EnvPrefix
+		}
+	}
+	env := prefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if v, ok := os.LookupEnv(env); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("not found in secrets.values or %s", env)
+}
+
+// splitSecretField splits <path>#<field>
+func splitSecretField(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+func getVaultSecret(cfg *SecretsConfig, ref string) (string, error) {
+	if cfg == nil || cfg.Vault == nil {
+		return "", fmt.Errorf("secrets.vault is not configured")
+	}
+	v := cfg.Vault
+	path, field := splitSecretField(ref)
+	if field == "" {
+		field = defaultVaultField
+	}
+	mount := v.Mount
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsProviderTimeout)
+	defer cancel()
+	url := strings.TrimRight(v.Address, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	body, err := doSecretsRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	value, ok := resp.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret has no field %s", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func getAWSSecret(cfg *SecretsConfig, ref string) (string, error) {
+	var aws S3Config
+	if cfg != nil && cfg.AWS != nil {
+		aws = *cfg.AWS
+	}
+	if aws.AccessKeyID == "" {
+		aws.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		aws.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		aws.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if aws.Region == "" {
+		aws.Region = os.Getenv("AWS_REGION")
+	}
+	if aws.Region == "" {
+		aws.Region = "us-east-1"
+	}
+	if aws.AccessKeyID == "" || aws.SecretAccessKey == "" {
+		return "", fmt.Errorf("aws credentials not configured")
+	}
+	endpoint := aws.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + aws.Region + ".amazonaws.com"
+	}
+
+	id, field := splitSecretField(ref)
+	payload, _ := json.Marshal(map[string]string{"SecretId": id})
+	ctx, cancel := context.WithTimeout(context.Background(), secretsProviderTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSV4(req, payload, time.Now().UTC(), aws, "secretsmanager")
+	body, err := doSecretsRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	if field == "" {
+		return resp.SecretString, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot read field %s", field)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %s", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func doSecretsRequest(req *http.Request) ([]byte, error) {
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, secretsProviderRespLimit))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		// The body of an error response describes the error, it does not hold the secret
+		return nil, fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,222 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func useSecrets(t *testing.T, cfg *SecretsConfig) {
+	t.Helper()
+	InitSecrets(cfg)
+	t.Cleanup(func() { InitSecrets(nil) })
+}
+
+// fakeVault serves KV v2 secrets under the kv mount, by path
+func fakeVault(t *testing.T, secrets map[string]map[string]interface{}) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodGet || r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "soc" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		data, ok := secrets[strings.TrimPrefix(r.URL.Path, "/v1/kv/data/")]
+		if !ok || !strings.HasPrefix(r.URL.Path, "/v1/kv/data/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 3}}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestVaultSecrets(t *testing.T) {
+	srv, requests := fakeVault(t, map[string]map[string]interface{}{
+		"hub/intel": {"value": "v-default", "token": "v-token", "port": 8443},
+	})
+	t.Setenv("VAULT_TOKEN", "s.token")
+	useSecrets(t, &SecretsConfig{Vault: &VaultSecretsConfig{Address: srv.URL + "/", Namespace: "soc", Mount: "/kv/"}})
+
+	for ref, want := range map[string]string{
+		"vault:hub/intel":       "v-default",
+		"vault:hub/intel#token": "v-token",
+		"vault:/hub/intel#port": "8443",
+	} {
+		got, err := GetSecret(ref)
+		if err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+
+	// Values are cached for the TTL
+	n := requests.Load()
+	if got, err := ResolveSecretRefs("Bearer ${secret:vault:hub/intel#token}"); err != nil || got != "Bearer v-token" {
+		t.Fatalf("resolved = %q, %v", got, err)
+	}
+	if requests.Load() != n {
+		t.Fatal("a cached secret was read from vault again")
+	}
+
+	for ref, want := range map[string]string{
+		"vault:hub/intel#missing": "has no field missing",
+		"vault:hub/absent":        "returned status 404",
+	} {
+		if _, err := GetSecret(ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", ref, err, want)
+		}
+	}
+
+	// A rejected token is reported with the status, failures are not cached
+	useSecrets(t, &SecretsConfig{Vault: &VaultSecretsConfig{Address: srv.URL, Token: "s.other", Namespace: "soc", Mount: "kv"}})
+	for i := 0; i < 2; i++ {
+		if _, err := GetSecret("vault:hub/intel"); err == nil || !strings.Contains(err.Error(), "returned status 403") {
+			t.Fatalf("wrong token: err = %v", err)
+		}
+	}
+	useSecrets(t, &SecretsConfig{})
+	if _, err := GetSecret("vault:hub/intel"); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Fatalf("without vault: err = %v", err)
+	}
+}
+
+// verifySigV4 checks the signature of a request independently of signAWSV4
+func verifySigV4(r *http.Request, body []byte, secretKey, region, service string) string {
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			fields[k] = v
+		}
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(credential) != 5 || len(amzDate) < 8 || credential[1] != amzDate[:8] || credential[2] != region || credential[3] != service || credential[4] != "aws4_request" {
+		return "bad credential scope " + fields["Credential"]
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return "bad payload hash"
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return "signed headers are not sorted"
+	}
+	var canonical strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonical.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	for _, required := range []string{"host", "x-amz-date", "x-amz-target", "content-type"} {
+		if !strings.Contains(";"+fields["SignedHeaders"]+";", ";"+required+";") {
+			return required + " is not signed"
+		}
+	}
+	request := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, canonical.String(), fields["SignedHeaders"], hex.EncodeToString(sum[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(request))
+	scope := strings.Join(credential[1:], "/")
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range append(credential[1:], toSign) {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(part))
+		key = h.Sum(nil)
+	}
+	if hex.EncodeToString(key) != fields["Signature"] {
+		return "signature mismatch"
+	}
+	return ""
+}
+
+func TestAWSSecrets(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if problem := verifySigV4(r, body, "wJalrXUtnFEMI", "eu-west-1", "secretsmanager"); problem != "" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"__type":"InvalidSignatureException","message":"` + problem + `"}`))
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || r.Header.Get("X-Amz-Security-Token") != "session" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req struct{ SecretId string }
+		json.Unmarshal(body, &req)
+		switch req.SecretId {
+		case "hub/db":
+			w.Write([]byte(`{"Name":"hub/db","SecretString":"{\"password\":\"p@ss\",\"port\":5432}"}`))
+		case "hub/plain":
+			w.Write([]byte(`{"Name":"hub/plain","SecretString":"plain-value"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+		}
+	}))
+	defer srv.Close()
+	useSecrets(t, &SecretsConfig{AWS: &S3Config{
+		Endpoint: srv.URL, Region: "eu-west-1", AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI", SessionToken: "session",
+	}, CacheTTL: time.Hour})
+
+	for ref, want := range map[string]string{
+		"aws:hub/db#password": "p@ss",
+		"aws:hub/db#port":     "5432",
+		"aws:hub/plain":       "plain-value",
+	} {
+		got, err := GetSecret(ref)
+		if err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+	n := requests.Load()
+	if _, err := GetSecret("aws:hub/db#password"); err != nil || requests.Load() != n {
+		t.Fatalf("cached secret: err = %v, %d requests", err, requests.Load()-n)
+	}
+	for ref, want := range map[string]string{
+		"aws:hub/db#user":     "has no field user",
+		"aws:hub/plain#field": "not a JSON object",
+		"aws:hub/absent":      "ResourceNotFoundException",
+	} {
+		if _, err := GetSecret(ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", ref, err, want)
+		}
+	}
+
+	// A wrong secret key fails the signature check
+	useSecrets(t, &SecretsConfig{AWS: &S3Config{Endpoint: srv.URL, Region: "eu-west-1", AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wrong", SessionToken: "session"}})
+	if _, err := GetSecret("aws:hub/plain"); err == nil || !strings.Contains(err.Error(), "signature mismatch") {
+		t.Fatalf("wrong key: err = %v", err)
+	}
+}
+
+func TestLocalSecrets(t *testing.T) {
+	useSecrets(t, &SecretsConfig{Values: map[string]string{"db_password": "from-config"}, EnvPrefix: "SOC_"})
+	t.Setenv("SOC_API_KEY_2", "from-env")
+	got, err := ResolveSecretRefs("${secret:db_password}:${secret:api-key.2}")
+	if err != nil || got != "from-config:from-env" {
+		t.Fatalf("resolved = %q, %v", got, err)
+	}
+	if _, err := ResolveSecretRefs("x ${secret:missing}"); err == nil || !strings.Contains(err.Error(), "SOC_MISSING") {
+		t.Fatalf("missing secret: err = %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Shared list types, they decide how entries are validated
+const (
+	SharedListTypeIP       = "ip"
+	SharedListTypeDomain   = "domain"
+	SharedListTypeHash     = "hash"
+	SharedListTypeUsername = "username"
+	SharedListTypeString   = "string"
+)
+
+const (
+	sharedListKeyPrefix    = "hub:list:"
+	sharedListIndexKey     = "hub:list:index"   // hash of list name to SharedListInfo
+	sharedListVersionKey   = "hub:list:version" // incremented by every change
+	sharedListSyncInterval = 5 * time.Second
+	sharedListWriteBatch   = 1000
+	// MaxSharedListEntries bounds the entries of one request
+	MaxSharedListEntries = 100000
+)
+
+// ErrSharedListNotFound is returned by changes of a list that does not exist
+var ErrSharedListNotFound = errors.New("list not found")
+
+// SharedListInfo describes a named list of values shared by every ruleset and node
+type SharedListInfo struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Description string    `json:"description,omitempty"`
+	Entries     int       `json:"entries"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SharedListEntry is a value of a list, ExpiresAt is a unix time, 0 when it never expires
+type SharedListEntry struct {
+	Value     string `json:"value"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+type sharedList struct {
+	info    SharedListInfo
+	entries map[string]int64 // normalized value to expiry
+}
+
+// SharedListManager keeps a copy of the lists stored in Redis on every node for IN_LIST checks.
+// Changes are written to Redis and picked up by the other nodes on their next sync.
+type SharedListManager struct {
+	mu      sync.RWMutex
+	lists   map[string]*sharedList
+	version string
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GlobalSharedLists serves IN_LIST checks, nil until InitSharedLists
+var GlobalSharedLists *SharedListManager
+
+// InitSharedLists loads the shared lists and keeps them in sync
+func InitSharedLists() {
+	if GlobalSharedLists != nil {
+		return
+	}
+	m := NewSharedListManager()
+	if err := m.sync(); err != nil {
+		logger.Error("Failed to load shared lists", "error", err)
+	}
+	GlobalSharedLists = m
+	m.Start()
+}
+
+// StopSharedLists stops the sync of the shared lists
+func StopSharedLists() {
+	if GlobalSharedLists != nil {
+		GlobalSharedLists.Stop()
+		GlobalSharedLists = nil
+	}
+}
+
+// NewSharedListManager creates an empty manager, Start loads the lists
+func NewSharedListManager() *SharedListManager {
+	return &SharedListManager{
+		lists:    make(map[string]*sharedList),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start syncs the lists every few seconds. The leader also removes the expired entries.
+func (m *SharedListManager) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(sharedListSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopChan:
+				return
+			case <-ticker.C:
+				if err := m.sync(); err != nil {
+					logger.Error("Failed to sync shared lists", "error", err)
+				}
+				if IsLeader {
+					m.purgeExpired()
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the sync
+func (m *SharedListManager) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+
+// Has reports whether a list exists
+func (m *SharedListManager) Has(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.lists[name]
+	return ok
+}
+
+// Contains reports whether value is an unexpired entry of one of the lists
+func (m *SharedListManager) Contains(names []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	value = NormalizeIndicator(value)
+	now := time.Now().Unix()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, name := range names {
+		list, ok := m.lists[name]
+		if !ok {
+			continue
+		}
+		if expiresAt, ok := list.entries[value]; ok && (expiresAt == 0 || expiresAt > now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists returns the lists sorted by name
+func (m *SharedListManager) Lists() []SharedListInfo {
+	now := time.Now().Unix()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos := make([]SharedListInfo, 0, len(m.lists))
+	for _, list := range m.lists {
+		infos = append(infos, list.infoAt(now))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// List returns a list and its unexpired entries sorted by value
+func (m *SharedListManager) List(name string) (SharedListInfo, []SharedListEntry, bool) {
+	now := time.Now().Unix()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list, ok := m.lists[name]
+	if !ok {
+		return SharedListInfo{}, nil, false
+	}
+	entries := make([]SharedListEntry, 0, len(list.entries))
+	for value, expiresAt := range list.entries {
+		if expiresAt == 0 || expiresAt > now {
+			entries = append(entries, SharedListEntry{Value: value, ExpiresAt: expiresAt})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Value < entries[j].Value })
+	return list.infoAt(now), entries, true
+}
+
+func (l *sharedList) infoAt(now int64) SharedListInfo {
+	info := l.info
+	info.Entries = 0
+	for _, expiresAt := range l.entries {
+		if expiresAt == 0 || expiresAt > now {
+			info.Entries++
+		}
+	}
+	return info
+}
+
+// ValidateSharedListName checks a list name, which is referenced from checks
+func ValidateSharedListName(name string) error {
+	if name == "" {
+		return fmt.Errorf("list name is required")
+	}
+	if len(name) > 128 || strings.ContainsAny(name, ", :/") {
+		return fmt.Errorf("list name %q must be at most 128 characters without commas, colons, slashes or spaces", name)
+	}
+	return nil
+}
+
+// NormalizeSharedListEntry validates a value for a list type and returns its stored form
+func NormalizeSharedListEntry(listType, value string) (string, error) {
+	value = NormalizeIndicator(value)
+	if value == "" {
+		return "", fmt.Errorf("empty value")
+	}
+	switch listType {
+	case SharedListTypeIP:
+		if _, err := netip.ParseAddr(value); err != nil {
+			return "", fmt.Errorf("invalid IP address %q", value)
+		}
+	case SharedListTypeHash:
+		if _, err := hex.DecodeString(value); err != nil || len(value) < 32 {
+			return "", fmt.Errorf("invalid hash %q, expected a hex digest", value)
+		}
+	case SharedListTypeDomain:
+		if strings.ContainsAny(value, " /@") {
+			return "", fmt.Errorf("invalid domain %q", value)
+		}
+	}
+	return value, nil
+}
+
+// CreateList creates an empty list
+func (m *SharedListManager) CreateList(name, listType, description string) (SharedListInfo, error) {
+	if err := ValidateSharedListName(name); err != nil {
+		return SharedListInfo{}, err
+	}
+	switch listType {
+	case "":
+		listType = SharedListTypeString
+	case SharedListTypeIP, SharedListTypeDomain, SharedListTypeHash, SharedListTypeUsername, SharedListTypeString:
+	default:
+		return SharedListInfo{}, fmt.Errorf("unsupported list type %q, expected ip, domain, hash, username or string", listType)
+	}
+	if existing, _ := RedisHGet(sharedListIndexKey, name); existing != "" {
+		return SharedListInfo{}, fmt.Errorf("list %s already exists", name)
+	}
+
+	now := time.Now().UTC()
+	info := SharedListInfo{Name: name, Type: listType, Description: description, CreatedAt: now, UpdatedAt: now}
+	if err := m.storeInfo(info); err != nil {
+		return SharedListInfo{}, err
+	}
+	return info, m.changed()
+}
+
+// DeleteList removes a list and its entries
+func (m *SharedListManager) DeleteList(name string) error {
+	if _, err := m.storedInfo(name); err != nil {
+		return err
+	}
+	if err := RedisDel(sharedListEntriesKey(name)); err != nil {
+		return err
+	}
+	if err := RedisHDel(sharedListIndexKey, name); err != nil {
+		return err
+	}
+	return m.changed()
+}
+
+// AddEntries adds values to a list, they expire after ttl unless it is 0. Existing values get
+// the new expiry. It returns the number of values written.
+func (m *SharedListManager) AddEntries(name string, values []string, ttl time.Duration) (int, error) {
+	info, err := m.storedInfo(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) > MaxSharedListEntries {
+		return 0, fmt.Errorf("at most %d entries per request", MaxSharedListEntries)
+	}
+	normalized := make([]string, 0, len(values))
+	for _, v := range values {
+		value, err := NormalizeSharedListEntry(info.Type, v)
+		if err != nil {
+			return 0, err
+		}
+		normalized = append(normalized, value)
+	}
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	key := sharedListEntriesKey(name)
+	pipe := GetRedisPipeline()
+	for i, value := range normalized {
+		pipe.HSet(ctx, key, value, strconv.FormatInt(expiresAt, 10))
+		if (i+1)%sharedListWriteBatch == 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return 0, err
+			}
+			pipe = GetRedisPipeline()
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return len(normalized), m.touch(info)
+}
+
+// RemoveEntries removes values from a list and returns the number of values given
+func (m *SharedListManager) RemoveEntries(name string, values []string) (int, error) {
+	info, err := m.storedInfo(name)
+	if err != nil {
+		return 0, err
+	}
+	fields := make([]string, 0, len(values))
+	for _, v := range values {
+		if value := NormalizeIndicator(v); value != "" {
+			fields = append(fields, value)
+		}
+	}
+	if len(fields) > 0 {
+		if err := GetRedisClient().HDel(ctx, sharedListEntriesKey(name), fields...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return len(fields), m.touch(info)
+}
+
+func sharedListEntriesKey(name string) string {
+	return sharedListKeyPrefix + name + ":entries"
+}
+
+func (m *SharedListManager) storedInfo(name string) (SharedListInfo, error) {
+	var info SharedListInfo
+	raw, err := RedisHGet(sharedListIndexKey, name)
+	if err != nil {
+		return info, err
+	}
+	if raw == "" {
+		return info, fmt.Errorf("%w: %s", ErrSharedListNotFound, name)
+	}
+	if err := json.Unmarshal([]byte(raw), &info); err != nil {
+		return info, fmt.Errorf("invalid stored list %s: %w", name, err)
+	}
+	return info, nil
+}
+
+func (m *SharedListManager) storeInfo(info SharedListInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return RedisHSet(sharedListIndexKey, info.Name, string(data))
+}
+
+// touch records a change of the entries of a list
+func (m *SharedListManager) touch(info SharedListInfo) error {
+	info.UpdatedAt = time.Now().UTC()
+	if err := m.storeInfo(info); err != nil {
+		return err
+	}
+	return m.changed()
+}
+
+// changed bumps the version the nodes compare and reloads the lists of this node at once
+func (m *SharedListManager) changed() error {
+	if _, err := RedisIncrby(sharedListVersionKey, 1); err != nil {
+		return err
+	}
+	return m.sync()
+}
+
+// sync reloads the lists when the stored version differs from the one in memory
+func (m *SharedListManager) sync() error {
+	version, err := RedisGet(sharedListVersionKey)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	m.mu.RLock()
+	current := m.version
+	m.mu.RUnlock()
+	if version == current && current != "" {
+		return nil
+	}
+
+	index, err := RedisHGetAll(sharedListIndexKey)
+	if err != nil {
+		return err
+	}
+	lists := make(map[string]*sharedList, len(index))
+	for name, raw := range index {
+		var info SharedListInfo
+		if err := json.Unmarshal([]byte(raw), &info); err != nil {
+			logger.Error("Invalid stored shared list", "list", name, "error", err)
+			continue
+		}
+		stored, err := RedisHGetAll(sharedListEntriesKey(name))
+		if err != nil {
+			return err
+		}
+		entries := make(map[string]int64, len(stored))
+		for value, expiresAt := range stored {
+			entries[value], _ = strconv.ParseInt(expiresAt, 10, 64)
+		}
+		lists[name] = &sharedList{info: info, entries: entries}
+	}
+
+	m.mu.Lock()
+	m.lists = lists
+	m.version = version
+	m.mu.Unlock()
+	return nil
+}
+
+// purgeExpired removes the expired entries from Redis
+func (m *SharedListManager) purgeExpired() {
+	now := time.Now().Unix()
+	m.mu.RLock()
+	expired := make(map[string][]string)
+	for name, list := range m.lists {
+		for value, expiresAt := range list.entries {
+			if expiresAt != 0 && expiresAt <= now {
+				expired[name] = append(expired[name], value)
+			}
+		}
+	}
+	m.mu.RUnlock()
+	for name, values := range expired {
+		if _, err := m.RemoveEntries(name, values); err != nil {
+			logger.Error("Failed to purge expired shared list entries", "list", name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// SMTP connection security modes
+const (
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+	SMTPSecurityNone     = "none"
+)
+
+const (
+	defaultSMTPSubjectTemplate       = `[AgentSmith-HUB] {{get . "_hub_hit_rule_id" | default "alert"}}`
+	defaultSMTPBodyTemplate          = "{{json .}}\n"
+	defaultSMTPDigestSubjectTemplate = `[AgentSmith-HUB] {{.count}} alerts between {{.start}} and {{.end}}`
+	defaultSMTPDigestBodyTemplate    = `{{.count}} alerts between {{.start}} and {{.end}}.
+
+Alerts per rule:
+{{range $rule, $n := .rules}}  {{$rule}}: {{$n}}
+{{end}}
+{{range .events}}{{compactjson .}}
+{{end}}{{if .omitted}}... {{.omitted}} more alerts not listed
+{{end}}`
+	defaultSMTPDigestMaxEvents = 100
+)
+
+// SMTPConfig holds the settings of an SMTP producer
+type SMTPConfig struct {
+	Host               string
+	Port               int // default 587 for starttls, 465 for tls, 25 for none
+	Username           string
+	Password           string
+	From               string
+	To                 []string
+	Cc                 []string
+	Security           string // starttls (default), tls or none
+	InsecureSkipVerify bool
+	Subject            string // Go template over the event
+	Body               string // Go template over the event
+	HTML               bool   // send the body as text/html
+
+	// DigestWindow batches the matches of a window into one email when set
+	DigestWindow    time.Duration
+	DigestMaxEvents int    // events listed in one digest, default 100, the rest are only counted
+	DigestSubject   string // Go template over the digest
+	DigestBody      string // Go template over the digest
+
+	MaxRetries int
+	Timeout    time.Duration
+}
+
+// SMTPProducer emails matched events, one email per event or one digest per window
+type SMTPProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg     SMTPConfig
+	subject *template.Template
+	body    *template.Template
+
+	// digest state, only used by run
+	digest      []map[string]interface{}
+	digestCount int
+	digestRules map[string]int
+	digestStart time.Time
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	emails uint64
+	events uint64
+	failed uint64
+}
+
+func (cfg *SMTPConfig) applyDefaults() {
+	if cfg.Security == "" {
+		cfg.Security = SMTPSecurityStartTLS
+	}
+	cfg.Security = strings.ToLower(cfg.Security)
+	if cfg.Port == 0 {
+		switch cfg.Security {
+		case SMTPSecurityTLS:
+			cfg.Port = 465
+		case SMTPSecurityNone:
+			cfg.Port = 25
+		default:
+			cfg.Port = 587
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+}
+
+// NewSMTPProducer starts emailing the events read from msgChan
+func NewSMTPProducer(cfg SMTPConfig, msgChan chan map[string]interface{}) (*SMTPProducer, error) {
+	cfg.applyDefaults()
+	switch cfg.Security {
+	case SMTPSecurityStartTLS, SMTPSecurityTLS, SMTPSecurityNone:
+	default:
+		return nil, fmt.Errorf("unsupported smtp security: %s", cfg.Security)
+	}
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("smtp host, from and to are required")
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+
+	subject, body := cfg.Subject, cfg.Body
+	if cfg.DigestWindow > 0 {
+		subject, body = cfg.DigestSubject, cfg.DigestBody
+		if subject == "" {
+			subject = defaultSMTPDigestSubjectTemplate
+		}
+		if body == "" {
+			body = defaultSMTPDigestBodyTemplate
+		}
+		if cfg.DigestMaxEvents <= 0 {
+			cfg.DigestMaxEvents = defaultSMTPDigestMaxEvents
+		}
+	} else {
+		if subject == "" {
+			subject = defaultSMTPSubjectTemplate
+		}
+		if body == "" {
+			body = defaultSMTPBodyTemplate
+		}
+	}
+
+	p := &SMTPProducer{
+		MsgChan:     msgChan,
+		cfg:         cfg,
+		digestRules: make(map[string]int),
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	var err error
+	if p.subject, err = ParseEventTemplate("subject", subject); err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	if p.body, err = ParseEventTemplate("body", body); err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (p *SMTPProducer) run() {
+	defer close(p.done)
+
+	// The digest timer only runs while matches are buffered
+	var flush <-chan time.Time
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		// Send what is buffered so a shutdown does not lose a pending digest
+		p.flushDigest()
+	}()
+
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-flush:
+			p.flushDigest()
+			flush = nil
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return
+			}
+			if p.cfg.DigestWindow <= 0 {
+				p.sendEvent(msg)
+				continue
+			}
+			p.addToDigest(msg)
+			if flush == nil {
+				timer = time.NewTimer(p.cfg.DigestWindow)
+				flush = timer.C
+			}
+		}
+	}
+}
+
+func (p *SMTPProducer) sendEvent(msg map[string]interface{}) {
+	if err := p.renderAndSend(msg); err != nil {
+		logger.Error("Failed to send alert email", "host", p.cfg.Host, "error", err)
+		atomic.AddUint64(&p.failed, 1)
+		p.Receipts.AddFailed(1)
+		return
+	}
+	atomic.AddUint64(&p.emails, 1)
+	atomic.AddUint64(&p.events, 1)
+	p.Receipts.AddAcked(1)
+}
+
+func (p *SMTPProducer) addToDigest(msg map[string]interface{}) {
+	if p.digestCount == 0 {
+		p.digestStart = time.Now()
+	}
+	p.digestCount++
+	rule, _ := GetCheckData(msg, []string{"_hub_hit_rule_id"})
+	if rule == "" {
+		rule = "unknown"
+	}
+	p.digestRules[rule]++
+	if len(p.digest) < p.cfg.DigestMaxEvents {
+		p.digest = append(p.digest, msg)
+	}
+}
+
+// flushDigest sends the buffered matches as one email
+func (p *SMTPProducer) flushDigest() {
+	count := p.digestCount
+	if count == 0 {
+		return
+	}
+
+	rules := make(map[string]interface{}, len(p.digestRules))
+	for rule, n := range p.digestRules {
+		rules[rule] = n
+	}
+	events := make([]interface{}, len(p.digest))
+	for i, e := range p.digest {
+		events[i] = e
+	}
+	digest := map[string]interface{}{
+		"count":   count,
+		"events":  events,
+		"rules":   rules,
+		"omitted": count - len(p.digest),
+		"start":   p.digestStart.UTC().Format(time.RFC3339),
+		"end":     time.Now().UTC().Format(time.RFC3339),
+	}
+
+	p.digest = nil
+	p.digestCount = 0
+	p.digestRules = make(map[string]int)
+
+	if err := p.renderAndSend(digest); err != nil {
+		logger.Error("Failed to send digest email", "host", p.cfg.Host, "events", count, "error", err)
+		atomic.AddUint64(&p.failed, uint64(count))
+		p.Receipts.AddFailed(uint64(count))
+		return
+	}
+	atomic.AddUint64(&p.emails, 1)
+	atomic.AddUint64(&p.events, uint64(count))
+	p.Receipts.AddAcked(uint64(count))
+}
+
+func (p *SMTPProducer) renderAndSend(data map[string]interface{}) error {
+	subject, err := ExecuteEventTemplate(p.subject, data)
+	if err != nil {
+		return fmt.Errorf("render subject: %w", err)
+	}
+	body, err := ExecuteEventTemplate(p.body, data)
+	if err != nil {
+		return fmt.Errorf("render body: %w", err)
+	}
+	msg, err := p.buildMessage(strings.TrimSpace(subject), body)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = p.send(msg)
+		if err == nil || attempt >= p.cfg.MaxRetries || !retryableSMTPError(err) {
+			return err
+		}
+		select {
+		case <-p.stopChan:
+			return err
+		case <-time.After(time.Duration(attempt+1) * 2 * time.Second):
+		}
+	}
+}
+
+// retryableSMTPError reports whether a send may succeed later: network errors and 4xx replies
+func retryableSMTPError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	return len(msg) >= 3 && msg[0] == '4' && msg[1] >= '0' && msg[1] <= '9'
+}
+
+// buildMessage renders an RFC 5322 message with a quoted-printable UTF-8 body
+func (p *SMTPProducer) buildMessage(subject, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	contentType := "text/plain"
+	if p.cfg.HTML {
+		contentType = "text/html"
+	}
+	headers := [][2]string{
+		{"From", p.cfg.From},
+		{"To", strings.Join(p.cfg.To, ", ")},
+	}
+	if len(p.cfg.Cc) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(p.cfg.Cc, ", ")})
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		[2]string{"Date", time.Now().Format(time.RFC1123Z)},
+		[2]string{"Message-ID", "<" + hex.EncodeToString(id) + "@agentsmith-hub>"},
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", contentType + "; charset=UTF-8"},
+		[2]string{"Content-Transfer-Encoding", "quoted-printable"},
+	)
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *SMTPProducer) send(msg []byte) error {
+	c, err := dialSMTP(p.cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Mail(smtpAddress(p.cfg.From)); err != nil {
+		return err
+	}
+	for _, rcpt := range append(append([]string(nil), p.cfg.To...), p.cfg.Cc...) {
+		if err := c.Rcpt(smtpAddress(rcpt)); err != nil {
+			return fmt.Errorf("recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// smtpAddress returns the bare address of "Name <addr>"
+func smtpAddress(addr string) string {
+	if i := strings.LastIndex(addr, "<"); i >= 0 {
+		if j := strings.LastIndex(addr, ">"); j > i {
+			return addr[i+1 : j]
+		}
+	}
+	return strings.TrimSpace(addr)
+}
+
+// dialSMTP connects, negotiates TLS and authenticates
+func dialSMTP(cfg SMTPConfig) (*smtp.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if cfg.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(cfg.Timeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.Hello(smtpHelloName()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if cfg.Security == SMTPSecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtpAuth(c, cfg)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func smtpHelloName() string {
+	if id := GetNodeID(); id != "" {
+		if host, _, err := net.SplitHostPort(id); err == nil {
+			return host
+		}
+		return id
+	}
+	return "localhost"
+}
+
+// smtpAuth prefers PLAIN and falls back to LOGIN, which some servers (e.g. Office 365) only offer
+func smtpAuth(c *smtp.Client, cfg SMTPConfig) smtp.Auth {
+	if ok, mechs := c.Extension("AUTH"); ok {
+		if !strings.Contains(strings.ToUpper(mechs), "PLAIN") && strings.Contains(strings.ToUpper(mechs), "LOGIN") {
+			return &smtpLoginAuth{username: cfg.Username, password: cfg.Password}
+		}
+	}
+	return smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+}
+
+type smtpLoginAuth struct {
+	username, password string
+}
+
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("refusing LOGIN authentication over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge: %s", fromServer)
+}
+
+// Close sends the queued emails and a pending digest once msgChan is closed by its owner, giving up after 30s
+func (p *SMTPProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many emails were sent, the events they carried and the events that failed
+func (p *SMTPProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"emails": atomic.LoadUint64(&p.emails),
+		"events": atomic.LoadUint64(&p.events),
+		"failed": atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestSMTPConnection connects and authenticates without sending an email
+func TestSMTPConnection(cfg SMTPConfig) error {
+	cfg.applyDefaults()
+	c, err := dialSMTP(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
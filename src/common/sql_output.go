@@ -0,0 +1,591 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SQLDriverPostgres = "postgres"
+	SQLDriverMySQL    = "mysql"
+
+	sqlStatementName = "hub_insert"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// SQLColumn maps an event field to a table column
+type SQLColumn struct {
+	Name  string `yaml:"name" json:"name"`
+	Field string `yaml:"field,omitempty" json:"field"` // dot separated path, * for the whole event as JSON, default the column name
+}
+
+// SQLUpsertConfig turns inserts into upserts on a unique key
+type SQLUpsertConfig struct {
+	// Key is the conflict target, columns or index expressions of a unique index, e.g. "rule_id, host" or "(lower(host))".
+	// PostgreSQL uses it in ON CONFLICT, MySQL resolves conflicts on any unique index and only uses it for the default update list.
+	Key    string   `yaml:"key"`
+	Update []string `yaml:"update,omitempty"` // columns overwritten on conflict, default every column not named in key
+}
+
+// SQLConfig holds the settings of a PostgreSQL or MySQL table producer
+type SQLConfig struct {
+	Driver   string // postgres or mysql
+	Host     string
+	Port     int
+	Database string
+	User     string
+	Password string
+	Table    string // optionally schema qualified, e.g. public.alerts
+	Columns  []SQLColumn
+	Upsert   *SQLUpsertConfig
+
+	BatchSize  int
+	FlushDur   time.Duration
+	Timeout    time.Duration // per batch
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// Validate checks the table, column and upsert settings
+func (c *SQLConfig) Validate() error {
+	if c.Driver != SQLDriverPostgres && c.Driver != SQLDriverMySQL {
+		return fmt.Errorf("unsupported sql driver %q, must be %s or %s", c.Driver, SQLDriverPostgres, SQLDriverMySQL)
+	}
+	if c.Host == "" || c.User == "" || c.Database == "" {
+		return fmt.Errorf("host, user and database are required")
+	}
+	parts := strings.Split(c.Table, ".")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid table %q, expected table or schema.table", c.Table)
+	}
+	for _, part := range parts {
+		if !sqlIdentifier.MatchString(part) {
+			return fmt.Errorf("invalid table %q, expected table or schema.table", c.Table)
+		}
+	}
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("at least one column is required")
+	}
+	names := make(map[string]bool, len(c.Columns))
+	for _, col := range c.Columns {
+		if !sqlIdentifier.MatchString(col.Name) {
+			return fmt.Errorf("invalid column name %q", col.Name)
+		}
+		if names[col.Name] {
+			return fmt.Errorf("duplicate column %q", col.Name)
+		}
+		names[col.Name] = true
+	}
+	if u := c.Upsert; u != nil {
+		if strings.TrimSpace(u.Key) == "" {
+			return fmt.Errorf("upsert.key is required")
+		}
+		if strings.ContainsAny(u.Key, ";'\"`") || strings.Contains(u.Key, "--") {
+			return fmt.Errorf("invalid upsert.key %q", u.Key)
+		}
+		for _, col := range u.Update {
+			if !names[col] {
+				return fmt.Errorf("upsert.update column %q is not one of the columns", col)
+			}
+		}
+	}
+	return nil
+}
+
+// SQLProducer batches events into a PostgreSQL or MySQL table through the psql or mysql client.
+// Every batch is one transaction running a prepared insert per event.
+type SQLProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg     SQLConfig
+	fields  [][]string // event path per column, nil for the whole event
+	prepare string     // PREPARE statement of the batch script
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	rowsWritten   uint64
+	rowsFailed    uint64
+	batchesFailed uint64
+}
+
+// NewSQLProducer starts writing the events read from msgChan
+func NewSQLProducer(cfg SQLConfig, msgChan chan map[string]interface{}) (*SQLProducer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath(sqlClient(cfg.Driver)); err != nil {
+		return nil, fmt.Errorf("%s client not found: %w", sqlClient(cfg.Driver), err)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushDur <= 0 {
+		cfg.FlushDur = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	p := &SQLProducer{
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		prepare:  sqlPrepareStatement(cfg),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, col := range cfg.Columns {
+		switch col.Field {
+		case "*":
+			p.fields = append(p.fields, nil)
+		case "":
+			p.fields = append(p.fields, StringToList(col.Name))
+		default:
+			p.fields = append(p.fields, StringToList(col.Field))
+		}
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func sqlClient(driver string) string {
+	if driver == SQLDriverMySQL {
+		return "mysql"
+	}
+	return "psql"
+}
+
+func sqlQuoteIdentifier(driver, name string) string {
+	if driver == SQLDriverMySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+func sqlTable(driver, table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = sqlQuoteIdentifier(driver, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlUpdateColumns returns the columns overwritten on conflict
+func sqlUpdateColumns(cfg SQLConfig) []string {
+	if len(cfg.Upsert.Update) > 0 {
+		return cfg.Upsert.Update
+	}
+	key := make(map[string]bool)
+	for _, part := range strings.Split(cfg.Upsert.Key, ",") {
+		key[strings.Trim(strings.TrimSpace(part), "()")] = true
+	}
+	var update []string
+	for _, col := range cfg.Columns {
+		if !key[col.Name] {
+			update = append(update, col.Name)
+		}
+	}
+	return update
+}
+
+// sqlPrepareStatement builds the PREPARE statement of the insert or upsert
+func sqlPrepareStatement(cfg SQLConfig) string {
+	cols := make([]string, len(cfg.Columns))
+	params := make([]string, len(cfg.Columns))
+	for i, col := range cfg.Columns {
+		cols[i] = sqlQuoteIdentifier(cfg.Driver, col.Name)
+		if cfg.Driver == SQLDriverMySQL {
+			params[i] = "?"
+		} else {
+			params[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	insert := "INSERT INTO " + sqlTable(cfg.Driver, cfg.Table) + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+
+	if cfg.Upsert != nil {
+		update := sqlUpdateColumns(cfg)
+		sets := make([]string, len(update))
+		for i, col := range update {
+			q := sqlQuoteIdentifier(cfg.Driver, col)
+			if cfg.Driver == SQLDriverMySQL {
+				sets[i] = q + " = VALUES(" + q + ")"
+			} else {
+				sets[i] = q + " = EXCLUDED." + q
+			}
+		}
+		switch {
+		case cfg.Driver == SQLDriverMySQL && len(sets) == 0:
+			// Every column is part of the key, a duplicate leaves the row as it is
+			first := sqlQuoteIdentifier(cfg.Driver, cfg.Columns[0].Name)
+			insert += " ON DUPLICATE KEY UPDATE " + first + " = " + first
+		case cfg.Driver == SQLDriverMySQL:
+			insert += " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+		case len(sets) == 0:
+			insert += " ON CONFLICT (" + cfg.Upsert.Key + ") DO NOTHING"
+		default:
+			insert += " ON CONFLICT (" + cfg.Upsert.Key + ") DO UPDATE SET " + strings.Join(sets, ", ")
+		}
+	}
+
+	if cfg.Driver == SQLDriverMySQL {
+		return "PREPARE " + sqlStatementName + " FROM " + sqlLiteral(cfg.Driver, insert) + ";\n"
+	}
+	return "PREPARE " + sqlStatementName + " AS " + insert + ";\n"
+}
+
+// sqlLiteral renders an event value as a SQL literal
+func sqlLiteral(driver string, v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "NULL"
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(value)
+	case string:
+		s = value
+	default:
+		s = AnyToString(value)
+	}
+
+	if driver == SQLDriverMySQL {
+		var b strings.Builder
+		b.Grow(len(s) + 2)
+		b.WriteByte('\'')
+		for _, r := range s {
+			switch r {
+			case 0:
+				b.WriteString(`\0`)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\\':
+				b.WriteString(`\\`)
+			case '\'':
+				b.WriteString(`\'`)
+			case 0x1a:
+				b.WriteString(`\Z`)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('\'')
+		return b.String()
+	}
+	// standard_conforming_strings is on, only quotes need escaping; text cannot hold NUL bytes
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, "\x00", ""), "'", "''") + "'"
+}
+
+// script builds the statements for a batch. A transactional script stops at the first error
+// and leaves the table untouched.
+func (p *SQLProducer) script(batch []map[string]interface{}, transactional bool) string {
+	var b strings.Builder
+	mysql := p.cfg.Driver == SQLDriverMySQL
+	if mysql {
+		// Escaping relies on backslashes, whatever the server default
+		b.WriteString("SET SESSION sql_mode = REPLACE(@@sql_mode, 'NO_BACKSLASH_ESCAPES', '');\n")
+	}
+	if transactional {
+		if mysql {
+			b.WriteString("START TRANSACTION;\n")
+		} else {
+			b.WriteString("BEGIN;\n")
+		}
+	}
+	b.WriteString(p.prepare)
+
+	values := make([]string, len(p.fields))
+	vars := make([]string, len(p.fields))
+	for _, msg := range batch {
+		for i, path := range p.fields {
+			var v interface{}
+			if path == nil {
+				v = AnyToString(msg)
+			} else if found, ok := GetCheckDataWithType(msg, path); ok {
+				v = found
+			}
+			values[i] = sqlLiteral(p.cfg.Driver, v)
+		}
+		if mysql {
+			for i := range values {
+				vars[i] = "@p" + strconv.Itoa(i+1)
+				values[i] = vars[i] + " = " + values[i]
+			}
+			b.WriteString("SET " + strings.Join(values, ", ") + ";\n")
+			b.WriteString("EXECUTE " + sqlStatementName + " USING " + strings.Join(vars, ", ") + ";\n")
+		} else {
+			b.WriteString("EXECUTE " + sqlStatementName + "(" + strings.Join(values, ", ") + ");\n")
+		}
+	}
+
+	if transactional {
+		b.WriteString("COMMIT;\n")
+	}
+	b.WriteString("DEALLOCATE PREPARE " + sqlStatementName + ";\n")
+	return b.String()
+}
+
+func (p *SQLProducer) run() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.cfg.BatchSize)
+	timer := time.NewTimer(p.cfg.FlushDur)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			p.Receipts.AddFailed(uint64(len(batch)))
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				if len(batch) > 0 {
+					p.flush(batch)
+				}
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(p.cfg.FlushDur)
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+			timer.Reset(p.cfg.FlushDur)
+		}
+	}
+}
+
+// flush writes a batch in one transaction, retrying while the server is unreachable. When the
+// server rejects the batch, the events are written one by one so a single bad event only loses itself.
+func (p *SQLProducer) flush(batch []map[string]interface{}) {
+	tokens := TakeDeliveryTokens(batch)
+	script := p.script(batch, true)
+
+	var err error
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-p.stopChan:
+				p.Receipts.AddFailed(uint64(len(batch)))
+				tokens.Fail()
+				return
+			case <-time.After(p.cfg.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		_, err = p.exec(script, false)
+		if err == nil {
+			atomic.AddUint64(&p.rowsWritten, uint64(len(batch)))
+			p.Receipts.AddAcked(uint64(len(batch)))
+			tokens.Release()
+			return
+		}
+		if !sqlRetryable(p.cfg.Driver, err) {
+			break
+		}
+		logger.Warn("SQL batch failed, retrying", "driver", p.cfg.Driver, "table", p.cfg.Table, "attempt", attempt+1, "error", err)
+	}
+
+	if len(batch) > 1 && !sqlRetryable(p.cfg.Driver, err) {
+		logger.Warn("SQL batch rejected, writing events one by one", "driver", p.cfg.Driver, "table", p.cfg.Table, "rows", len(batch), "error", err)
+		failed, eachErr := p.exec(p.script(batch, false), true)
+		if eachErr == nil {
+			failed = min(failed, len(batch))
+			atomic.AddUint64(&p.rowsWritten, uint64(len(batch)-failed))
+			atomic.AddUint64(&p.rowsFailed, uint64(failed))
+			p.Receipts.AddAcked(uint64(len(batch) - failed))
+			p.Receipts.AddFailed(uint64(failed))
+			// The server answered for every event, the rejected ones were refused for their content
+			tokens.Release()
+			return
+		}
+		err = eachErr
+	}
+
+	logger.Error("Failed to write batch to SQL table", "driver", p.cfg.Driver, "table", p.cfg.Table, "rows", len(batch), "error", err)
+	atomic.AddUint64(&p.batchesFailed, 1)
+	atomic.AddUint64(&p.rowsFailed, uint64(len(batch)))
+	p.Receipts.AddFailed(uint64(len(batch)))
+	tokens.Fail()
+}
+
+// sqlExitError is a client run that ended with an error
+type sqlExitError struct {
+	code   int
+	output string
+}
+
+func (e *sqlExitError) Error() string {
+	return fmt.Sprintf("exit status %d: %s", e.code, e.output)
+}
+
+// sqlRetryable reports whether err means the server could not be reached, rather than
+// the server rejecting the statements
+func sqlRetryable(driver string, err error) bool {
+	var exitErr *sqlExitError
+	if !errors.As(err, &exitErr) {
+		return true
+	}
+	if driver == SQLDriverMySQL {
+		// Client errors 2000-2999 are connection problems, e.g. ERROR 2003 (HY000): Can't connect
+		return strings.Contains(exitErr.output, "ERROR 20")
+	}
+	// psql exits with 2 when the connection failed or went bad, 3 when a statement failed
+	return exitErr.code == 2
+}
+
+// exec runs a script with the database client. With keepGoing the client continues after failing
+// statements and the number of errors it reported is returned.
+func (p *SQLProducer) exec(script string, keepGoing bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	go func() {
+		// Abort a blocked batch on shutdown
+		select {
+		case <-p.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cmd := sqlCommand(ctx, p.cfg, keepGoing)
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return 0, &sqlExitError{code: exitErr.ExitCode(), output: truncateRunes(output, 512)}
+		}
+		return 0, fmt.Errorf("%w: %s", err, truncateRunes(output, 512))
+	}
+	if !keepGoing {
+		return 0, nil
+	}
+	failed := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "ERROR") || strings.Contains(line, "ERROR:") {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// sqlCommand prepares a psql or mysql run reading statements from stdin
+func sqlCommand(ctx context.Context, cfg SQLConfig, keepGoing bool) *exec.Cmd {
+	env := os.Environ()
+	var cmd *exec.Cmd
+	if cfg.Driver == SQLDriverMySQL {
+		args := []string{"--host=" + cfg.Host, "--user=" + cfg.User, "--database=" + cfg.Database, "--batch", "--silent"}
+		if cfg.Port > 0 {
+			args = append(args, "--port="+strconv.Itoa(cfg.Port))
+		}
+		if keepGoing {
+			args = append(args, "--force")
+		}
+		cmd = exec.CommandContext(ctx, "mysql", args...)
+		if cfg.Password != "" {
+			env = append(env, "MYSQL_PWD="+cfg.Password)
+		}
+	} else {
+		args := []string{"-X", "-q", "-w", "-h", cfg.Host, "-U", cfg.User, "-d", cfg.Database}
+		if cfg.Port > 0 {
+			args = append(args, "-p", strconv.Itoa(cfg.Port))
+		}
+		if !keepGoing {
+			args = append(args, "-v", "ON_ERROR_STOP=1")
+		}
+		cmd = exec.CommandContext(ctx, "psql", args...)
+		if cfg.Password != "" {
+			env = append(env, "PGPASSWORD="+cfg.Password)
+		}
+	}
+	cmd.Env = env
+	return cmd
+}
+
+// Close flushes the pending batch once msgChan is closed by its owner, giving up after 30s
+func (p *SQLProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetRowsWritten returns the number of rows committed to the table
+func (p *SQLProducer) GetRowsWritten() uint64 {
+	return atomic.LoadUint64(&p.rowsWritten)
+}
+
+// GetRowsFailed returns the number of events that could not be written
+func (p *SQLProducer) GetRowsFailed() uint64 {
+	return atomic.LoadUint64(&p.rowsFailed)
+}
+
+// GetFailedBatches returns the number of batches dropped after all retries
+func (p *SQLProducer) GetFailedBatches() uint64 {
+	return atomic.LoadUint64(&p.batchesFailed)
+}
+
+// TestSQLConnection checks that the database is reachable and the table exists
+func TestSQLConnection(cfg SQLConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(sqlClient(cfg.Driver)); err != nil {
+		return fmt.Errorf("%s client not found: %w", sqlClient(cfg.Driver), err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cmd := sqlCommand(ctx, cfg, false)
+	cmd.Stdin = strings.NewReader("SELECT 1 FROM " + sqlTable(cfg.Driver, cfg.Table) + " WHERE 1 = 0;\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, truncateRunes(strings.TrimSpace(string(out)), 512))
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSQLClient stands in for psql and mysql: it records each script and its arguments, and
+// answers according to the mode file:
+//
+//	ok      every statement succeeds
+//	down    the server cannot be reached
+//	reject  transactions fail, and outside a transaction each EXECUTE of a value containing 'bad' fails
+const fakeSQLClient = `#!/bin/sh
+dir=$(dirname "$0")
+n=$(ls "$dir" | grep -c '\.sql$')
+cat > "$dir/run-$n.sql"
+echo "$@" > "$dir/run-$n.args"
+client=$(basename "$0")
+case "$(cat "$dir/mode")" in
+down)
+  if [ "$client" = mysql ]; then echo "ERROR 2003 (HY000): Can't connect to MySQL server"; exit 1; fi
+  echo "psql: error: connection to server failed: Connection refused" >&2; exit 2;;
+reject)
+  if grep -q '^BEGIN;\|^START TRANSACTION;' "$dir/run-$n.sql"; then
+    if [ "$client" = mysql ]; then echo "ERROR 1062 (23000): Duplicate entry"; exit 1; fi
+    echo "ERROR:  invalid input syntax" >&2; exit 3
+  fi
+  grep "^EXECUTE\|^SET @p" "$dir/run-$n.sql" | grep bad | sed 's/.*/ERROR:  invalid input syntax/' >&2
+  exit 0;;
+esac
+exit 0
+`
+
+type fakeSQL struct {
+	dir string
+}
+
+func newFakeSQL(t *testing.T, mode string) *fakeSQL {
+	t.Helper()
+	dir := t.TempDir()
+	for _, client := range []string{"psql", "mysql"} {
+		if err := os.WriteFile(filepath.Join(dir, client), []byte(fakeSQLClient), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mode"), []byte(mode), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return &fakeSQL{dir: dir}
+}
+
+// runs returns the scripts received, in order
+func (f *fakeSQL) runs(t *testing.T) []string {
+	t.Helper()
+	var scripts []string
+	for i := 0; ; i++ {
+		raw, err := os.ReadFile(filepath.Join(f.dir, "run-"+strconv.Itoa(i)+".sql"))
+		if os.IsNotExist(err) {
+			return scripts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, string(raw))
+	}
+}
+
+func testSQLConfig(driver string) SQLConfig {
+	return SQLConfig{
+		Driver:     driver,
+		Host:       "db",
+		Database:   "soc",
+		User:       "hub",
+		Password:   "secret",
+		Table:      "public.alerts",
+		Columns:    []SQLColumn{{Name: "rule_id"}, {Name: "host", Field: "data.host"}, {Name: "event", Field: "*"}},
+		BatchSize:  2,
+		FlushDur:   time.Hour,
+		MaxRetries: 2,
+		RetryDelay: time.Millisecond,
+	}
+}
+
+// writeSQLEvents sends events through a producer and waits for the last batch
+func writeSQLEvents(t *testing.T, cfg SQLConfig, events ...map[string]interface{}) *SQLProducer {
+	t.Helper()
+	msgChan := make(chan map[string]interface{}, len(events))
+	p, err := NewSQLProducer(cfg, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Receipts = NewDeliveryReceipts()
+	for _, e := range events {
+		msgChan <- e
+	}
+	close(msgChan)
+	p.Close()
+	return p
+}
+
+func TestSQLProducerBatches(t *testing.T) {
+	fake := newFakeSQL(t, "ok")
+	p := writeSQLEvents(t, testSQLConfig(SQLDriverPostgres),
+		map[string]interface{}{"rule_id": "r1", "data": map[string]interface{}{"host": "web-1"}},
+		map[string]interface{}{"rule_id": "it's", "data": map[string]interface{}{"host": "web-2"}},
+		map[string]interface{}{"rule_id": "r3"},
+	)
+
+	runs := fake.runs(t)
+	if len(runs) != 2 {
+		t.Fatalf("%d scripts, want 2 batches", len(runs))
+	}
+	first := runs[0]
+	for _, want := range []string{
+		"BEGIN;\n",
+		`PREPARE hub_insert AS INSERT INTO "public"."alerts" ("rule_id", "host", "event") VALUES ($1, $2, $3);`,
+		`EXECUTE hub_insert('r1', 'web-1', '{"`,
+		`EXECUTE hub_insert('it''s', 'web-2', `,
+		"COMMIT;\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("first batch lacks %q:\n%s", want, first)
+		}
+	}
+	if !strings.Contains(runs[1], `EXECUTE hub_insert('r3', NULL, '{"rule_id":"r3"}');`) {
+		t.Errorf("missing field is not NULL:\n%s", runs[1])
+	}
+	args, _ := os.ReadFile(filepath.Join(fake.dir, "run-0.args"))
+	if !strings.Contains(string(args), "ON_ERROR_STOP=1") || !strings.Contains(string(args), "-h db -U hub -d soc") {
+		t.Errorf("psql arguments = %s", args)
+	}
+	if p.GetRowsWritten() != 3 || p.Receipts.Snapshot().Acked != 3 {
+		t.Errorf("rows written = %d, acked = %d", p.GetRowsWritten(), p.Receipts.Snapshot().Acked)
+	}
+}
+
+func TestSQLUpsertStatements(t *testing.T) {
+	cfg := testSQLConfig(SQLDriverPostgres)
+	cfg.Upsert = &SQLUpsertConfig{Key: "rule_id, host"}
+	if got, want := sqlPrepareStatement(cfg), `ON CONFLICT (rule_id, host) DO UPDATE SET "event" = EXCLUDED."event";`; !strings.Contains(got, want) {
+		t.Errorf("postgres upsert = %s, want %s", got, want)
+	}
+	cfg.Upsert.Update = []string{"host"}
+	if got := sqlPrepareStatement(cfg); !strings.Contains(got, `DO UPDATE SET "host" = EXCLUDED."host";`) {
+		t.Errorf("postgres upsert with update list = %s", got)
+	}
+	cfg.Upsert = &SQLUpsertConfig{Key: "rule_id, host, event"}
+	if got := sqlPrepareStatement(cfg); !strings.Contains(got, "ON CONFLICT (rule_id, host, event) DO NOTHING;") {
+		t.Errorf("postgres upsert on every column = %s", got)
+	}
+
+	cfg = testSQLConfig(SQLDriverMySQL)
+	cfg.Upsert = &SQLUpsertConfig{Key: "rule_id"}
+	want := "PREPARE hub_insert FROM 'INSERT INTO `public`.`alerts` (`rule_id`, `host`, `event`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `host` = VALUES(`host`), `event` = VALUES(`event`)';\n"
+	if got := sqlPrepareStatement(cfg); got != want {
+		t.Errorf("mysql upsert = %s, want %s", got, want)
+	}
+}
+
+func TestSQLProducerMySQLScript(t *testing.T) {
+	fake := newFakeSQL(t, "ok")
+	writeSQLEvents(t, testSQLConfig(SQLDriverMySQL), map[string]interface{}{"rule_id": "a\\b'c\n"})
+	runs := fake.runs(t)
+	if len(runs) != 1 {
+		t.Fatalf("%d scripts, want 1", len(runs))
+	}
+	for _, want := range []string{
+		"SET SESSION sql_mode = REPLACE(@@sql_mode, 'NO_BACKSLASH_ESCAPES', '');\n",
+		"START TRANSACTION;\n",
+		`SET @p1 = 'a\\b\'c\n', @p2 = NULL, @p3 = `,
+		"EXECUTE hub_insert USING @p1, @p2, @p3;\n",
+	} {
+		if !strings.Contains(runs[0], want) {
+			t.Errorf("script lacks %q:\n%s", want, runs[0])
+		}
+	}
+}
+
+func TestSQLProducerRetriesUnreachableServer(t *testing.T) {
+	for _, driver := range []string{SQLDriverPostgres, SQLDriverMySQL} {
+		t.Run(driver, func(t *testing.T) {
+			fake := newFakeSQL(t, "down")
+			p := writeSQLEvents(t, testSQLConfig(driver), map[string]interface{}{"rule_id": "r1"})
+			// The first attempt and MaxRetries retries, no fallback to single events
+			if n := len(fake.runs(t)); n != 3 {
+				t.Errorf("%d runs, want 3", n)
+			}
+			if p.GetFailedBatches() != 1 || p.GetRowsFailed() != 1 || p.Receipts.Snapshot().Failed != 1 {
+				t.Errorf("failed batches = %d, rows = %d", p.GetFailedBatches(), p.GetRowsFailed())
+			}
+		})
+	}
+}
+
+func TestSQLProducerRejectedBatch(t *testing.T) {
+	fake := newFakeSQL(t, "reject")
+	p := writeSQLEvents(t, testSQLConfig(SQLDriverPostgres),
+		map[string]interface{}{"rule_id": "good"},
+		map[string]interface{}{"rule_id": "bad"},
+	)
+	runs := fake.runs(t)
+	// The rejected transaction is not retried, the events are then written one by one
+	if len(runs) != 2 || strings.Contains(runs[1], "BEGIN;") {
+		t.Fatalf("runs = %q", runs)
+	}
+	args, _ := os.ReadFile(filepath.Join(fake.dir, "run-1.args"))
+	if strings.Contains(string(args), "ON_ERROR_STOP") {
+		t.Errorf("one by one run stops at the first error: %s", args)
+	}
+	if p.GetRowsWritten() != 1 || p.GetRowsFailed() != 1 || p.GetFailedBatches() != 0 {
+		t.Errorf("written = %d, failed = %d, failed batches = %d", p.GetRowsWritten(), p.GetRowsFailed(), p.GetFailedBatches())
+	}
+	if counts := p.Receipts.Snapshot(); counts.Acked != 1 || counts.Failed != 1 {
+		t.Errorf("receipts = %+v", counts)
+	}
+}
+
+func TestSQLConfigValidate(t *testing.T) {
+	for name, change := range map[string]func(*SQLConfig){
+		"driver":        func(c *SQLConfig) { c.Driver = "sqlite" },
+		"host":          func(c *SQLConfig) { c.Host = "" },
+		"table":         func(c *SQLConfig) { c.Table = "a.b.c" },
+		"table quote":   func(c *SQLConfig) { c.Table = `alerts"; DROP TABLE x` },
+		"no columns":    func(c *SQLConfig) { c.Columns = nil },
+		"column":        func(c *SQLConfig) { c.Columns = []SQLColumn{{Name: "a b"}} },
+		"duplicate":     func(c *SQLConfig) { c.Columns = []SQLColumn{{Name: "a"}, {Name: "a"}} },
+		"upsert key":    func(c *SQLConfig) { c.Upsert = &SQLUpsertConfig{} },
+		"upsert inject": func(c *SQLConfig) { c.Upsert = &SQLUpsertConfig{Key: "id); DROP TABLE x; --"} },
+		"upsert update": func(c *SQLConfig) { c.Upsert = &SQLUpsertConfig{Key: "rule_id", Update: []string{"missing"}} },
+	} {
+		cfg := testSQLConfig(SQLDriverPostgres)
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: invalid config accepted", name)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"AgentSmith-HUB/logger"
@@ -199,22 +198,6 @@ func (sm *SystemMonitor) calculateCPUPercent() float64 {
 	return cpuPercent
 }
 
-// getCurrentProcessCPUTime gets the current process CPU time (user + system time)
-func getCurrentProcessCPUTime() time.Duration {
-	var usage syscall.Rusage
-	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
-	if err != nil {
-		// Fallback to a minimal value if syscall fails
-		return time.Duration(0)
-	}
-
-	// Convert timeval to duration (user time + system time)
-	userTime := time.Duration(usage.Utime.Sec)*time.Second + time.Duration(usage.Utime.Usec)*time.Microsecond
-	sysTime := time.Duration(usage.Stime.Sec)*time.Second + time.Duration(usage.Stime.Usec)*time.Microsecond
-
-	return userTime + sysTime
-}
-
 // getProcessRSSMB gets the current process RSS (Resident Set Size) memory in MB
 func getProcessRSSMB() float64 {
 	// For Linux, read from /proc/self/status
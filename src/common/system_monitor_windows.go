@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package common
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// getCurrentProcessCPUTime gets the current process CPU time (user + system time)
+func getCurrentProcessCPUTime() time.Duration {
+	var creation, exit, kernel, user windows.Filetime
+	err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user)
+	if err != nil {
+		// Fallback to a minimal value if syscall fails
+		return time.Duration(0)
+	}
+
+	// FILETIME values are in 100-nanosecond intervals
+	ticks := uint64(kernel.HighDateTime)<<32 | uint64(kernel.LowDateTime)
+	ticks += uint64(user.HighDateTime)<<32 | uint64(user.LowDateTime)
+	return time.Duration(ticks * 100)
+}
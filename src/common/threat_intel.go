@@ -0,0 +1,550 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+// Threat intel feed types
+const (
+	ThreatIntelFeedMISP  = "misp"
+	ThreatIntelFeedOTX   = "otx"
+	ThreatIntelFeedTAXII = "taxii"
+	ThreatIntelFeedCSV   = "csv"
+)
+
+// Indicator types, the types of the feeds are mapped to these
+const (
+	IndicatorTypeIP     = "ip"
+	IndicatorTypeDomain = "domain"
+	IndicatorTypeURL    = "url"
+	IndicatorTypeHash   = "hash"
+	IndicatorTypeEmail  = "email"
+	IndicatorTypeOther  = "other"
+)
+
+const (
+	threatIntelKeyPrefix       = "hub:intel:"
+	threatIntelStatusKey       = "hub:intel:status"
+	defaultThreatIntelInterval = time.Hour
+	defaultThreatIntelTimeout  = 60 * time.Second
+	threatIntelSyncInterval    = 30 * time.Second
+	threatIntelWriteBatch      = 1000
+)
+
+// ThreatIntelConfig lists the feeds used by INTEL checks and appends
+type ThreatIntelConfig struct {
+	Feeds []ThreatIntelFeedConfig `yaml:"feeds"`
+}
+
+// ThreatIntelFeedConfig configures one feed. The leader downloads it every interval into Redis,
+// every node keeps a copy in memory for the lookups.
+type ThreatIntelFeedConfig struct {
+	Name     string            `yaml:"name"`
+	Type     string            `yaml:"type"` // misp, otx, taxii or csv
+	URL      string            `yaml:"url"`
+	APIKey   string            `yaml:"api_key,omitempty"`
+	Username string            `yaml:"username,omitempty"` // TAXII basic auth
+	Password string            `yaml:"password,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Interval time.Duration     `yaml:"interval,omitempty"` // default 1h
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`  // per request, default 60s
+	// Indicator types kept (ip, domain, url, hash, email, other), all when empty
+	Types []string          `yaml:"types,omitempty"`
+	HTTP  *OutputHTTPConfig `yaml:"http,omitempty"`
+
+	// MISP: attribute tags to match, window of the search (e.g. 30d) and whether only attributes
+	// flagged for IDS are kept (default true)
+	Tags  []string `yaml:"tags,omitempty"`
+	Since string   `yaml:"since,omitempty"`
+	ToIDS *bool    `yaml:"to_ids,omitempty"`
+
+	// OTX and TAXII: most pages read per refresh, default 20
+	MaxPages int `yaml:"max_pages,omitempty"`
+
+	// CSV and plain text lists: column of the indicator (index from 0 or header name, default 0),
+	// optional column of its type, delimiter (default ",") and whether the first line is a header.
+	// Lines starting with # are ignored.
+	Column        string `yaml:"column,omitempty"`
+	TypeColumn    string `yaml:"type_column,omitempty"`
+	Delimiter     string `yaml:"delimiter,omitempty"`
+	Header        bool   `yaml:"header,omitempty"`
+	IndicatorType string `yaml:"indicator_type,omitempty"` // type of all indicators without type column
+}
+
+// IntelIndicator is an indicator with its context
+type IntelIndicator struct {
+	Value       string   `json:"value"`
+	Type        string   `json:"type"`
+	Feed        string   `json:"feed"`
+	Source      string   `json:"source,omitempty"` // event, pulse or report it comes from
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Confidence  int      `json:"confidence,omitempty"`
+	FirstSeen   string   `json:"first_seen,omitempty"`
+	Reference   string   `json:"reference,omitempty"`
+}
+
+// Map returns the indicator as event fields
+func (i *IntelIndicator) Map() map[string]interface{} {
+	m := map[string]interface{}{
+		"value": i.Value,
+		"type":  i.Type,
+		"feed":  i.Feed,
+	}
+	if i.Source != "" {
+		m["source"] = i.Source
+	}
+	if i.Description != "" {
+		m["description"] = i.Description
+	}
+	if len(i.Tags) > 0 {
+		tags := make([]interface{}, len(i.Tags))
+		for k, t := range i.Tags {
+			tags[k] = t
+		}
+		m["tags"] = tags
+	}
+	if i.Confidence > 0 {
+		m["confidence"] = i.Confidence
+	}
+	if i.FirstSeen != "" {
+		m["first_seen"] = i.FirstSeen
+	}
+	if i.Reference != "" {
+		m["reference"] = i.Reference
+	}
+	return m
+}
+
+// ThreatIntelFeedStatus is the state of a feed, written by the leader after every refresh
+type ThreatIntelFeedStatus struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Indicators  int       `json:"indicators"`
+	Version     string    `json:"version,omitempty"`
+	LastRefresh time.Time `json:"last_refresh,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Duration    string    `json:"duration,omitempty"`
+}
+
+// Validate checks the config of the feeds
+func (c *ThreatIntelConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(c.Feeds))
+	for _, f := range c.Feeds {
+		if f.Name == "" {
+			return fmt.Errorf("threat intel feed name is required")
+		}
+		if strings.ContainsAny(f.Name, ", :") {
+			return fmt.Errorf("threat intel feed name %q cannot contain commas, colons or spaces", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate threat intel feed %q", f.Name)
+		}
+		seen[f.Name] = true
+		switch f.Type {
+		case ThreatIntelFeedMISP, ThreatIntelFeedOTX:
+			if f.APIKey == "" {
+				return fmt.Errorf("threat intel feed %s: api_key is required for %s", f.Name, f.Type)
+			}
+		case ThreatIntelFeedTAXII, ThreatIntelFeedCSV:
+		default:
+			return fmt.Errorf("threat intel feed %s: unsupported type %q, expected misp, otx, taxii or csv", f.Name, f.Type)
+		}
+		if f.URL == "" && f.Type != ThreatIntelFeedOTX {
+			return fmt.Errorf("threat intel feed %s: url is required", f.Name)
+		}
+		for _, t := range f.Types {
+			switch t {
+			case IndicatorTypeIP, IndicatorTypeDomain, IndicatorTypeURL, IndicatorTypeHash, IndicatorTypeEmail, IndicatorTypeOther:
+			default:
+				return fmt.Errorf("threat intel feed %s: unknown indicator type %q", f.Name, t)
+			}
+		}
+		if err := f.HTTP.Validate(); err != nil {
+			return fmt.Errorf("threat intel feed %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// NormalizeIndicator returns the form indicators are stored and looked up in: trimmed and lower
+// case, IP addresses in canonical form and domains without trailing dot
+func NormalizeIndicator(value string) string {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().String()
+	}
+	return strings.TrimSuffix(strings.ToLower(value), ".")
+}
+
+type threatIntelFeed struct {
+	cfg ThreatIntelFeedConfig
+
+	mu         sync.RWMutex
+	indicators map[string]*IntelIndicator
+	version    string
+
+	refreshing sync.Mutex
+	status     ThreatIntelFeedStatus
+}
+
+// ThreatIntelManager refreshes the feeds on the leader and serves the lookups on every node
+type ThreatIntelManager struct {
+	feeds map[string]*threatIntelFeed
+	names []string
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GlobalThreatIntel serves INTEL checks and appends, nil when no feed is configured
+var GlobalThreatIntel *ThreatIntelManager
+
+// NewThreatIntelManager creates the manager of the configured feeds
+func NewThreatIntelManager(cfg *ThreatIntelConfig) (*ThreatIntelManager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg == nil || len(cfg.Feeds) == 0 {
+		return nil, fmt.Errorf("no threat intel feed configured")
+	}
+	m := &ThreatIntelManager{
+		feeds:    make(map[string]*threatIntelFeed, len(cfg.Feeds)),
+		stopChan: make(chan struct{}),
+	}
+	for _, f := range cfg.Feeds {
+		if f.Interval <= 0 {
+			f.Interval = defaultThreatIntelInterval
+		}
+		if f.Timeout <= 0 {
+			f.Timeout = defaultThreatIntelTimeout
+		}
+		if f.MaxPages <= 0 {
+			f.MaxPages = 20
+		}
+		m.feeds[f.Name] = &threatIntelFeed{
+			cfg:    f,
+			status: ThreatIntelFeedStatus{Name: f.Name, Type: f.Type},
+		}
+		m.names = append(m.names, f.Name)
+	}
+	sort.Strings(m.names)
+	return m, nil
+}
+
+// HasFeed reports whether a feed is configured
+func (m *ThreatIntelManager) HasFeed(name string) bool {
+	_, ok := m.feeds[name]
+	return ok
+}
+
+// Lookup returns the indicator matching value in the first of the feeds that has it
+func (m *ThreatIntelManager) Lookup(feeds []string, value string) *IntelIndicator {
+	if value == "" {
+		return nil
+	}
+	value = NormalizeIndicator(value)
+	for _, name := range feeds {
+		feed, ok := m.feeds[name]
+		if !ok {
+			continue
+		}
+		feed.mu.RLock()
+		indicator := feed.indicators[value]
+		feed.mu.RUnlock()
+		if indicator != nil {
+			return indicator
+		}
+	}
+	return nil
+}
+
+// Start loads the stored feeds and starts the refreshes on the leader and the syncs on every node
+func (m *ThreatIntelManager) Start() {
+	for _, name := range m.names {
+		feed := m.feeds[name]
+		m.sync(feed)
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.refreshLoop(feed)
+		}()
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(threatIntelSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopChan:
+				return
+			case <-ticker.C:
+				for _, name := range m.names {
+					m.sync(m.feeds[name])
+				}
+			}
+		}
+	}()
+	logger.Info("Threat intel started", "feeds", len(m.names))
+}
+
+// Stop ends the refreshes and syncs
+func (m *ThreatIntelManager) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+
+// refreshLoop refreshes a feed every interval while this node is the leader. The first refresh
+// happens at once unless the stored version is recent.
+func (m *ThreatIntelManager) refreshLoop(feed *threatIntelFeed) {
+	wait := time.Duration(0)
+	feed.mu.RLock()
+	if feed.version != "" {
+		if ns, err := strconv.ParseInt(feed.version, 10, 64); err == nil {
+			wait = max(0, feed.cfg.Interval-time.Since(time.Unix(0, ns)))
+		}
+	}
+	feed.mu.RUnlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-timer.C:
+			if IsLeader {
+				if err := m.Refresh(feed.cfg.Name); err != nil {
+					logger.Error("Failed to refresh threat intel feed", "feed", feed.cfg.Name, "error", err)
+				}
+			}
+			timer.Reset(feed.cfg.Interval)
+		}
+	}
+}
+
+// Refresh downloads a feed, stores it in Redis and swaps the in-memory copy of this node
+func (m *ThreatIntelManager) Refresh(name string) error {
+	feed, ok := m.feeds[name]
+	if !ok {
+		return fmt.Errorf("threat intel feed not found: %s", name)
+	}
+	feed.refreshing.Lock()
+	defer feed.refreshing.Unlock()
+
+	start := time.Now()
+	indicators, err := fetchThreatIntelFeed(feed.cfg)
+	if err == nil && len(indicators) == 0 {
+		// An empty download is more likely a broken feed than a feed without indicators
+		err = fmt.Errorf("feed returned no indicators")
+	}
+
+	status := feed.Status()
+	status.LastRefresh = start.UTC()
+	status.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		// Keep serving the previous version
+		status.LastError = err.Error()
+		feed.setStatus(status)
+		m.storeStatus(status)
+		return err
+	}
+
+	version := strconv.FormatInt(start.UnixNano(), 10)
+	if err := storeThreatIntelFeed(name, version, indicators); err != nil {
+		status.LastError = "failed to store indicators: " + err.Error()
+		feed.setStatus(status)
+		m.storeStatus(status)
+		return err
+	}
+
+	feed.mu.Lock()
+	oldVersion := feed.version
+	feed.indicators = indicators
+	feed.version = version
+	feed.mu.Unlock()
+	if oldVersion != "" && oldVersion != version {
+		_ = RedisDelMultiple(threatIntelValuesKey(name, oldVersion), threatIntelContextKey(name, oldVersion))
+	}
+
+	status.Indicators = len(indicators)
+	status.Version = version
+	status.LastError = ""
+	feed.setStatus(status)
+	m.storeStatus(status)
+	logger.Info("Threat intel feed refreshed", "feed", name, "indicators", len(indicators), "duration", status.Duration)
+	return nil
+}
+
+// sync loads the stored version of a feed if it differs from the one in memory
+func (m *ThreatIntelManager) sync(feed *threatIntelFeed) {
+	name := feed.cfg.Name
+	version, err := RedisGet(threatIntelKeyPrefix + name + ":version")
+	if err != nil || version == "" {
+		return
+	}
+	feed.mu.RLock()
+	current := feed.version
+	feed.mu.RUnlock()
+	if version == current {
+		return
+	}
+
+	stored, err := RedisHGetAll(threatIntelContextKey(name, version))
+	if err != nil {
+		logger.Error("Failed to load threat intel feed", "feed", name, "error", err)
+		return
+	}
+	indicators := make(map[string]*IntelIndicator, len(stored))
+	for value, raw := range stored {
+		var indicator IntelIndicator
+		if err := json.Unmarshal([]byte(raw), &indicator); err != nil {
+			continue
+		}
+		indicators[value] = &indicator
+	}
+
+	feed.mu.Lock()
+	feed.indicators = indicators
+	feed.version = version
+	feed.mu.Unlock()
+
+	if raw, err := RedisHGet(threatIntelStatusKey, name); err == nil {
+		var status ThreatIntelFeedStatus
+		if json.Unmarshal([]byte(raw), &status) == nil {
+			feed.setStatus(status)
+		}
+	}
+	logger.Info("Threat intel feed loaded", "feed", name, "indicators", len(indicators), "version", version)
+}
+
+// Status returns the state of every feed
+func (m *ThreatIntelManager) Status() []ThreatIntelFeedStatus {
+	statuses := make([]ThreatIntelFeedStatus, 0, len(m.names))
+	for _, name := range m.names {
+		statuses = append(statuses, m.feeds[name].Status())
+	}
+	return statuses
+}
+
+// Status returns the state of the feed with the size of the copy of this node
+func (f *threatIntelFeed) Status() ThreatIntelFeedStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	status := f.status
+	status.Indicators = len(f.indicators)
+	status.Version = f.version
+	return status
+}
+
+func (f *threatIntelFeed) setStatus(status ThreatIntelFeedStatus) {
+	f.mu.Lock()
+	f.status = status
+	f.mu.Unlock()
+}
+
+func (m *ThreatIntelManager) storeStatus(status ThreatIntelFeedStatus) {
+	if data, err := json.Marshal(status); err == nil {
+		_ = RedisHSet(threatIntelStatusKey, status.Name, string(data))
+	}
+}
+
+func threatIntelValuesKey(feed, version string) string {
+	return threatIntelKeyPrefix + feed + ":" + version + ":values"
+}
+
+func threatIntelContextKey(feed, version string) string {
+	return threatIntelKeyPrefix + feed + ":" + version + ":context"
+}
+
+// storeThreatIntelFeed writes a version of a feed: a set of the indicator values and a hash of
+// their context. The version key is switched once both are complete.
+func storeThreatIntelFeed(feed, version string, indicators map[string]*IntelIndicator) error {
+	valuesKey := threatIntelValuesKey(feed, version)
+	contextKey := threatIntelContextKey(feed, version)
+
+	pipe := GetRedisPipeline()
+	n := 0
+	for value, indicator := range indicators {
+		data, err := json.Marshal(indicator)
+		if err != nil {
+			continue
+		}
+		pipe.SAdd(ctx, valuesKey, value)
+		pipe.HSet(ctx, contextKey, value, string(data))
+		n++
+		if n%threatIntelWriteBatch == 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				_ = RedisDelMultiple(valuesKey, contextKey)
+				return err
+			}
+			pipe = GetRedisPipeline()
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		_ = RedisDelMultiple(valuesKey, contextKey)
+		return err
+	}
+	_, err := RedisSet(threatIntelKeyPrefix+feed+":version", version, 0)
+	return err
+}
+
+// filterIndicators keeps the indicators of the configured types and normalizes their values
+func filterIndicators(cfg ThreatIntelFeedConfig, indicators []*IntelIndicator) map[string]*IntelIndicator {
+	var types map[string]bool
+	if len(cfg.Types) > 0 {
+		types = make(map[string]bool, len(cfg.Types))
+		for _, t := range cfg.Types {
+			types[t] = true
+		}
+	}
+	result := make(map[string]*IntelIndicator, len(indicators))
+	for _, indicator := range indicators {
+		if indicator.Value == "" || (types != nil && !types[indicator.Type]) {
+			continue
+		}
+		indicator.Feed = cfg.Name
+		indicator.Value = NormalizeIndicator(indicator.Value)
+		if _, exists := result[indicator.Value]; !exists {
+			result[indicator.Value] = indicator
+		}
+	}
+	return result
+}
+
+// InitThreatIntel starts the threat intel feeds if configured
+func InitThreatIntel(cfg *ThreatIntelConfig) {
+	if cfg == nil || len(cfg.Feeds) == 0 || GlobalThreatIntel != nil {
+		return
+	}
+	m, err := NewThreatIntelManager(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize threat intel", "error", err)
+		return
+	}
+	GlobalThreatIntel = m
+	m.Start()
+}
+
+// StopThreatIntel stops the threat intel feeds
+func StopThreatIntel() {
+	if GlobalThreatIntel != nil {
+		GlobalThreatIntel.Stop()
+		GlobalThreatIntel = nil
+	}
+}
@@ -0,0 +1,545 @@
+package common
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOTXURL       = "https://otx.alienvault.com"
+	threatIntelMaxBody  = 512 << 20
+	taxiiMediaType      = "application/taxii+json;version=2.1"
+	otxPageLimit        = 50
+	taxiiPageLimit      = 1000
+	intelDescriptionMax = 256
+)
+
+// fetchThreatIntelFeed downloads the indicators of a feed
+func fetchThreatIntelFeed(cfg ThreatIntelFeedConfig) (map[string]*IntelIndicator, error) {
+	client, err := NewOutputHTTPClient(MergeOutputHTTPConfig(Config.OutputHTTP, cfg.HTTP), cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	var indicators []*IntelIndicator
+	switch cfg.Type {
+	case ThreatIntelFeedMISP:
+		indicators, err = fetchMISP(client, cfg)
+	case ThreatIntelFeedOTX:
+		indicators, err = fetchOTX(client, cfg)
+	case ThreatIntelFeedTAXII:
+		indicators, err = fetchTAXII(client, cfg)
+	case ThreatIntelFeedCSV:
+		indicators, err = fetchCSV(client, cfg)
+	default:
+		err = fmt.Errorf("unsupported threat intel feed type %q", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filterIndicators(cfg, indicators), nil
+}
+
+// intelRequest sends a request with the headers of the feed and returns the body of a 2xx response
+func intelRequest(client *http.Client, cfg ThreatIntelFeedConfig, method, rawURL string, body []byte, headers map[string]string) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, rawURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, threatIntelMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned status %d: %s", req.URL.Redacted(), resp.StatusCode, truncateIntelText(string(data), 200))
+	}
+	return data, nil
+}
+
+// parseIntelSince converts a window such as 30d, 12h or 90m to the time it starts at
+func parseIntelSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("invalid since %q", since)
+		}
+		return time.Now().Add(-time.Duration(n) * 24 * time.Hour), nil
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q", since)
+	}
+	return time.Now().Add(-d), nil
+}
+
+func truncateIntelText(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
+
+// MISP
+
+type mispSearchResponse struct {
+	Response struct {
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"response"`
+}
+
+type mispAttribute struct {
+	Type      string `json:"type"`
+	Category  string `json:"category"`
+	Value     string `json:"value"`
+	Comment   string `json:"comment"`
+	EventID   string `json:"event_id"`
+	FirstSeen string `json:"first_seen"`
+	Timestamp string `json:"timestamp"`
+	Event     struct {
+		Info string `json:"info"`
+	} `json:"Event"`
+	Tag []struct {
+		Name string `json:"name"`
+	} `json:"Tag"`
+}
+
+// fetchMISP reads the attributes of the MISP REST search
+func fetchMISP(client *http.Client, cfg ThreatIntelFeedConfig) ([]*IntelIndicator, error) {
+	search := map[string]interface{}{
+		"returnFormat":     "json",
+		"to_ids":           cfg.ToIDS == nil || *cfg.ToIDS,
+		"includeEventTags": true,
+	}
+	if len(cfg.Tags) > 0 {
+		search["tags"] = cfg.Tags
+	}
+	if cfg.Since != "" {
+		search["last"] = cfg.Since
+	}
+	body, _ := json.Marshal(search)
+	data, err := intelRequest(client, cfg, http.MethodPost, strings.TrimSuffix(cfg.URL, "/")+"/attributes/restSearch", body, map[string]string{
+		"Authorization": cfg.APIKey,
+		"Accept":        "application/json",
+		"Content-Type":  "application/json",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resp mispSearchResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid MISP response: %w", err)
+	}
+
+	reference := strings.TrimSuffix(cfg.URL, "/") + "/events/view/"
+	indicators := make([]*IntelIndicator, 0, len(resp.Response.Attribute))
+	for _, attr := range resp.Response.Attribute {
+		value, indicatorType := mispIndicator(attr.Type, attr.Value)
+		if value == "" {
+			continue
+		}
+		indicator := &IntelIndicator{
+			Value:       value,
+			Type:        indicatorType,
+			Source:      attr.Event.Info,
+			Description: truncateIntelText(attr.Comment, intelDescriptionMax),
+			FirstSeen:   attr.FirstSeen,
+		}
+		if indicator.FirstSeen == "" && attr.Timestamp != "" {
+			if ts, err := strconv.ParseInt(attr.Timestamp, 10, 64); err == nil {
+				indicator.FirstSeen = time.Unix(ts, 0).UTC().Format(time.RFC3339)
+			}
+		}
+		if attr.EventID != "" {
+			indicator.Reference = reference + attr.EventID
+		}
+		for _, tag := range attr.Tag {
+			indicator.Tags = append(indicator.Tags, tag.Name)
+		}
+		indicators = append(indicators, indicator)
+	}
+	return indicators, nil
+}
+
+// mispIndicator maps a MISP attribute type to an indicator type. Composite attributes such as
+// ip-dst|port or domain|ip keep their first part, filename|sha256 and the like their hash.
+func mispIndicator(attrType, value string) (string, string) {
+	base, second, composite := strings.Cut(attrType, "|")
+	if composite {
+		first, rest, _ := strings.Cut(value, "|")
+		if base == "filename" {
+			base, value = second, rest
+		} else {
+			value = first
+		}
+	}
+	switch base {
+	case "ip-src", "ip-dst":
+		return value, IndicatorTypeIP
+	case "domain", "hostname":
+		return value, IndicatorTypeDomain
+	case "url", "uri", "link":
+		return value, IndicatorTypeURL
+	case "md5", "sha1", "sha224", "sha256", "sha384", "sha512", "imphash", "ssdeep", "tlsh":
+		return value, IndicatorTypeHash
+	case "email", "email-src", "email-dst":
+		return value, IndicatorTypeEmail
+	}
+	return value, IndicatorTypeOther
+}
+
+// OTX
+
+type otxPulsesResponse struct {
+	Results []struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+		Created     string   `json:"created"`
+		Indicators  []struct {
+			Indicator   string `json:"indicator"`
+			Type        string `json:"type"`
+			Created     string `json:"created"`
+			Description string `json:"description"`
+		} `json:"indicators"`
+	} `json:"results"`
+	Next *string `json:"next"`
+}
+
+// fetchOTX reads the indicators of the subscribed OTX pulses
+func fetchOTX(client *http.Client, cfg ThreatIntelFeedConfig) ([]*IntelIndicator, error) {
+	base := cfg.URL
+	if base == "" {
+		base = defaultOTXURL
+	}
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(otxPageLimit))
+	if cfg.Since != "" {
+		since, err := parseIntelSince(cfg.Since)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("modified_since", since.UTC().Format(time.RFC3339))
+	}
+	next := strings.TrimSuffix(base, "/") + "/api/v1/pulses/subscribed?" + query.Encode()
+	headers := map[string]string{"X-OTX-API-KEY": cfg.APIKey, "Accept": "application/json"}
+
+	var indicators []*IntelIndicator
+	for page := 0; next != "" && page < cfg.MaxPages; page++ {
+		data, err := intelRequest(client, cfg, http.MethodGet, next, nil, headers)
+		if err != nil {
+			return nil, err
+		}
+		var resp otxPulsesResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("invalid OTX response: %w", err)
+		}
+		for _, pulse := range resp.Results {
+			for _, i := range pulse.Indicators {
+				description := i.Description
+				if description == "" {
+					description = pulse.Description
+				}
+				indicators = append(indicators, &IntelIndicator{
+					Value:       i.Indicator,
+					Type:        otxIndicatorType(i.Type),
+					Source:      pulse.Name,
+					Description: truncateIntelText(description, intelDescriptionMax),
+					Tags:        pulse.Tags,
+					FirstSeen:   i.Created,
+					Reference:   "https://otx.alienvault.com/pulse/" + pulse.ID,
+				})
+			}
+		}
+		next = ""
+		if resp.Next != nil {
+			next = *resp.Next
+		}
+	}
+	return indicators, nil
+}
+
+func otxIndicatorType(t string) string {
+	switch t {
+	case "IPv4", "IPv6":
+		return IndicatorTypeIP
+	case "domain", "hostname":
+		return IndicatorTypeDomain
+	case "URL", "URI":
+		return IndicatorTypeURL
+	case "FileHash-MD5", "FileHash-SHA1", "FileHash-SHA256", "FileHash-PEHASH", "FileHash-IMPHASH":
+		return IndicatorTypeHash
+	case "email":
+		return IndicatorTypeEmail
+	}
+	return IndicatorTypeOther
+}
+
+// STIX/TAXII
+
+type taxiiEnvelope struct {
+	More    bool              `json:"more"`
+	Next    string            `json:"next"`
+	Objects []json.RawMessage `json:"objects"`
+}
+
+type stixIndicator struct {
+	Type        string   `json:"type"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Pattern     string   `json:"pattern"`
+	PatternType string   `json:"pattern_type"`
+	Labels      []string `json:"labels"`
+	Confidence  int      `json:"confidence"`
+	ValidFrom   string   `json:"valid_from"`
+	Revoked     bool     `json:"revoked"`
+}
+
+// stixComparison matches the equality comparisons of a STIX pattern, e.g. [ipv4-addr:value = '1.2.3.4']
+var stixComparison = regexp.MustCompile(`([a-z0-9-]+):([A-Za-z0-9_.'\-]+)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// fetchTAXII reads the indicators of a TAXII 2.1 collection, url is the collection URL
+func fetchTAXII(client *http.Client, cfg ThreatIntelFeedConfig) ([]*IntelIndicator, error) {
+	objectsURL := strings.TrimSuffix(cfg.URL, "/")
+	if !strings.HasSuffix(objectsURL, "/objects") {
+		objectsURL += "/objects"
+	}
+	objectsURL += "/"
+	query := url.Values{}
+	query.Set("match[type]", "indicator")
+	query.Set("limit", strconv.Itoa(taxiiPageLimit))
+	if cfg.Since != "" {
+		since, err := parseIntelSince(cfg.Since)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("added_after", since.UTC().Format(time.RFC3339))
+	}
+	headers := map[string]string{"Accept": taxiiMediaType}
+	if cfg.Username == "" && cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + cfg.APIKey
+	}
+
+	var indicators []*IntelIndicator
+	for page := 0; page < cfg.MaxPages; page++ {
+		data, err := intelRequest(client, cfg, http.MethodGet, objectsURL+"?"+query.Encode(), nil, headers)
+		if err != nil {
+			return nil, err
+		}
+		var envelope taxiiEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, fmt.Errorf("invalid TAXII response: %w", err)
+		}
+		for _, raw := range envelope.Objects {
+			var obj stixIndicator
+			if err := json.Unmarshal(raw, &obj); err != nil || obj.Type != "indicator" || obj.Revoked {
+				continue
+			}
+			if obj.PatternType != "" && obj.PatternType != "stix" {
+				continue
+			}
+			for _, m := range stixComparison.FindAllStringSubmatch(obj.Pattern, -1) {
+				indicators = append(indicators, &IntelIndicator{
+					Value:       strings.ReplaceAll(m[3], `\'`, `'`),
+					Type:        stixIndicatorType(m[1]),
+					Source:      obj.Name,
+					Description: truncateIntelText(obj.Description, intelDescriptionMax),
+					Tags:        obj.Labels,
+					Confidence:  obj.Confidence,
+					FirstSeen:   obj.ValidFrom,
+					Reference:   obj.ID,
+				})
+			}
+		}
+		if !envelope.More || envelope.Next == "" {
+			break
+		}
+		query.Set("next", envelope.Next)
+	}
+	return indicators, nil
+}
+
+func stixIndicatorType(objectType string) string {
+	switch objectType {
+	case "ipv4-addr", "ipv6-addr":
+		return IndicatorTypeIP
+	case "domain-name":
+		return IndicatorTypeDomain
+	case "url":
+		return IndicatorTypeURL
+	case "file":
+		return IndicatorTypeHash
+	case "email-addr":
+		return IndicatorTypeEmail
+	}
+	return IndicatorTypeOther
+}
+
+// CSV and plain text lists
+
+// fetchCSV reads a CSV or plain text list, one indicator per line
+func fetchCSV(client *http.Client, cfg ThreatIntelFeedConfig) ([]*IntelIndicator, error) {
+	data, err := intelRequest(client, cfg, http.MethodGet, cfg.URL, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseIntelCSV(cfg, data)
+}
+
+func parseIntelCSV(cfg ThreatIntelFeedConfig, data []byte) ([]*IntelIndicator, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	if cfg.Delimiter != "" {
+		reader.Comma = []rune(cfg.Delimiter)[0]
+	}
+
+	column, typeColumn := 0, -1
+	if !cfg.Header {
+		var err error
+		if cfg.Column != "" {
+			if column, err = strconv.Atoi(cfg.Column); err != nil {
+				return nil, fmt.Errorf("column %q must be an index without header", cfg.Column)
+			}
+		}
+		if cfg.TypeColumn != "" {
+			if typeColumn, err = strconv.Atoi(cfg.TypeColumn); err != nil {
+				return nil, fmt.Errorf("type_column %q must be an index without header", cfg.TypeColumn)
+			}
+		}
+	}
+
+	var indicators []*IntelIndicator
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if first && cfg.Header {
+			first = false
+			if column, err = csvColumn(record, cfg.Column, 0); err != nil {
+				return nil, err
+			}
+			if typeColumn, err = csvColumn(record, cfg.TypeColumn, -1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if column >= len(record) {
+			continue
+		}
+		value := strings.TrimSpace(record[column])
+		if value == "" {
+			continue
+		}
+		indicatorType := cfg.IndicatorType
+		if typeColumn >= 0 && typeColumn < len(record) {
+			indicatorType = normalizeIndicatorType(record[typeColumn])
+		}
+		if indicatorType == "" {
+			indicatorType = GuessIndicatorType(value)
+		}
+		indicators = append(indicators, &IntelIndicator{Value: value, Type: indicatorType})
+	}
+	return indicators, nil
+}
+
+// csvColumn resolves a column given as index or header name
+func csvColumn(header []string, column string, fallback int) (int, error) {
+	if column == "" {
+		return fallback, nil
+	}
+	if n, err := strconv.Atoi(column); err == nil {
+		return n, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column %q not found in CSV header", column)
+}
+
+// normalizeIndicatorType maps the type names used by CSV lists to indicator types
+func normalizeIndicatorType(t string) string {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "ip", "ipv4", "ipv6", "ip-src", "ip-dst", "ipv4-addr", "ipv6-addr":
+		return IndicatorTypeIP
+	case "domain", "hostname", "fqdn", "domain-name":
+		return IndicatorTypeDomain
+	case "url", "uri":
+		return IndicatorTypeURL
+	case "hash", "md5", "sha1", "sha256", "sha512", "filehash":
+		return IndicatorTypeHash
+	case "email", "email-addr", "email-src", "email-dst":
+		return IndicatorTypeEmail
+	case "":
+		return ""
+	}
+	return IndicatorTypeOther
+}
+
+var hexHash = regexp.MustCompile(`^[0-9a-fA-F]{32}$|^[0-9a-fA-F]{40}$|^[0-9a-fA-F]{64}$|^[0-9a-fA-F]{128}$`)
+
+// GuessIndicatorType returns the type of an indicator from its value
+func GuessIndicatorType(value string) string {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
+		return ""
+	case isIntelIP(value):
+		return IndicatorTypeIP
+	case strings.Contains(value, "://"):
+		return IndicatorTypeURL
+	case strings.Contains(value, "@"):
+		return IndicatorTypeEmail
+	case hexHash.MatchString(value):
+		return IndicatorTypeHash
+	case strings.Contains(value, ".") && !strings.ContainsAny(value, " /"):
+		return IndicatorTypeDomain
+	}
+	return IndicatorTypeOther
+}
+
+func isIntelIP(value string) bool {
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
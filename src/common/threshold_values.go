@@ -0,0 +1,141 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/logger"
+)
+
+const (
+	thresholdValuesKey          = "hub:threshold:values" // hash of name to value
+	thresholdValuesSyncInterval = 5 * time.Second
+	// ThresholdValueRefPrefix starts the value_ref of thresholds reading their value from Redis
+	ThresholdValueRefPrefix = "redis:"
+)
+
+// ThresholdValue is a threshold value set through /threshold-values
+type ThresholdValue struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+var (
+	thresholdValuesMu   sync.RWMutex
+	thresholdValues     = make(map[string]int)
+	thresholdValuesOnce sync.Once
+)
+
+// ValidateThresholdValueName checks the name of a threshold value, such as thresholds/login_failures
+func ValidateThresholdValueName(name string) error {
+	if name == "" || len(name) > 256 {
+		return errors.New("threshold value name must have 1 to 256 characters")
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == '/' || c == ':') {
+			return fmt.Errorf("threshold value name '%s' can only contain letters, digits, '_', '-', '.', '/' and ':'", name)
+		}
+	}
+	return nil
+}
+
+// InitThresholdValues loads the threshold values and reloads them every few seconds, so a value
+// set on the leader reaches the followers
+func InitThresholdValues() {
+	thresholdValuesOnce.Do(func() {
+		if err := syncThresholdValues(); err != nil {
+			logger.Error("Failed to load threshold values", "error", err)
+		}
+		go func() {
+			ticker := time.NewTicker(thresholdValuesSyncInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := syncThresholdValues(); err != nil {
+					logger.Error("Failed to sync threshold values", "error", err)
+				}
+			}
+		}()
+	})
+}
+
+// syncThresholdValues replaces the values of this node by the values in Redis. The values are
+// kept when Redis is unavailable.
+func syncThresholdValues() error {
+	if rdb == nil {
+		return nil
+	}
+	raw, err := RedisHGetAll(thresholdValuesKey)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]int, len(raw))
+	for name, v := range raw {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			values[name] = n
+		}
+	}
+	thresholdValuesMu.Lock()
+	thresholdValues = values
+	thresholdValuesMu.Unlock()
+	return nil
+}
+
+// GetThresholdValue returns the value set for name
+func GetThresholdValue(name string) (int, bool) {
+	thresholdValuesMu.RLock()
+	defer thresholdValuesMu.RUnlock()
+	v, ok := thresholdValues[name]
+	return v, ok
+}
+
+// ThresholdValues returns the values sorted by name
+func ThresholdValues() []ThresholdValue {
+	thresholdValuesMu.RLock()
+	defer thresholdValuesMu.RUnlock()
+	values := make([]ThresholdValue, 0, len(thresholdValues))
+	for name, v := range thresholdValues {
+		values = append(values, ThresholdValue{Name: name, Value: v})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+// SetThresholdValue stores the value of the thresholds referencing name, it applies to this node
+// at once and to the other nodes on their next sync
+func SetThresholdValue(name string, value int) error {
+	if err := ValidateThresholdValueName(name); err != nil {
+		return err
+	}
+	if value <= 0 {
+		return errors.New("threshold value must be greater than 0")
+	}
+	if rdb == nil {
+		return errors.New("redis is not available")
+	}
+	if err := RedisHSet(thresholdValuesKey, name, value); err != nil {
+		return err
+	}
+	thresholdValuesMu.Lock()
+	thresholdValues[name] = value
+	thresholdValuesMu.Unlock()
+	return nil
+}
+
+// DeleteThresholdValue removes the value of name, the thresholds referencing it fall back to the
+// value of their element
+func DeleteThresholdValue(name string) error {
+	if rdb == nil {
+		return errors.New("redis is not available")
+	}
+	if err := RedisHDel(thresholdValuesKey, name); err != nil {
+		return err
+	}
+	thresholdValuesMu.Lock()
+	delete(thresholdValues, name)
+	thresholdValuesMu.Unlock()
+	return nil
+}
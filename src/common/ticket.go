@@ -0,0 +1,666 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Ticketing providers
+const (
+	TicketProviderJira       = "jira"
+	TicketProviderTheHive    = "thehive"
+	TicketProviderServiceNow = "servicenow"
+)
+
+const (
+	defaultTicketTitle       = `AgentSmith-HUB detection {{get . "_hub_hit_rule_id"}}`
+	defaultTicketDescription = `{{json .}}`
+	defaultJiraIssueType     = "Task"
+	defaultServiceNowTable   = "incident"
+	defaultTicketDedupWindow = 24 * time.Hour
+	ticketFingerprintPrefix  = "hub-fp-"
+	ticketEventFileName      = "event.json"
+	maxTicketTitle           = 250
+	maxTicketDedupEntries    = 10000
+	ticketRetryAfterMaxSec   = 60
+)
+
+// theHiveSeverities maps severity names to TheHive case severities
+var theHiveSeverities = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// TicketConfig holds the settings of a ticket producer
+type TicketConfig struct {
+	Provider string
+	URL      string // instance base URL, e.g. https://acme.atlassian.net
+	Username string // jira user (with token as API token) or servicenow user
+	Password string // servicenow password
+	Token    string // jira API token or personal access token, thehive API key
+
+	Project   string // jira project key
+	IssueType string // jira issue type, default Task
+	Table     string // servicenow table, default incident
+
+	Title       string            // Go template over the event
+	Description string            // Go template over the event, default the event as JSON
+	Fields      map[string]string // ticket field (dotted for nested objects) -> event field
+	Labels      []string          // jira labels or thehive tags
+
+	SeverityField string            // event field holding the detection severity
+	SeverityMap   map[string]string // detection severity -> jira priority, thehive severity or servicenow impact/urgency
+
+	DedupFields       []string      // event fields the fingerprint is built from, default the matched rule id
+	DedupWindow       time.Duration // how long a fingerprint maps to its open ticket, default 24h
+	CommentDuplicates bool          // add duplicate events as comments to the open ticket
+	AttachEvent       bool          // attach the raw event JSON to new tickets
+
+	MaxRetries int
+	Timeout    time.Duration
+	HTTP       *OutputHTTPConfig // TLS and proxy of the client
+}
+
+// ticketRef is an open ticket known for a fingerprint
+type ticketRef struct {
+	id      string // jira issue key, thehive case id or servicenow sys_id
+	expires time.Time
+}
+
+// TicketProducer opens Jira issues, TheHive cases or ServiceNow records from events, one per alert fingerprint
+type TicketProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg         TicketConfig
+	client      *http.Client
+	title       *template.Template
+	description *template.Template
+	dedupFields [][]string
+
+	// open tickets by fingerprint, only used by the run goroutine
+	open map[string]ticketRef
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	created      uint64
+	deduplicated uint64
+	commented    uint64
+	failed       uint64
+}
+
+// NewTicketProducer starts opening tickets for the events read from msgChan
+func NewTicketProducer(cfg TicketConfig, msgChan chan map[string]interface{}) (*TicketProducer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = defaultTicketDedupWindow
+	}
+	if cfg.Title == "" {
+		cfg.Title = defaultTicketTitle
+	}
+	if cfg.Description == "" {
+		cfg.Description = defaultTicketDescription
+	}
+
+	title, err := ParseEventTemplate("title", cfg.Title)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %w", err)
+	}
+	description, err := ParseEventTemplate("description", cfg.Description)
+	if err != nil {
+		return nil, fmt.Errorf("invalid description template: %w", err)
+	}
+	client, err := NewOutputHTTPClient(cfg.HTTP, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &TicketProducer{
+		MsgChan:     msgChan,
+		cfg:         cfg,
+		client:      client,
+		title:       title,
+		description: description,
+		open:        make(map[string]ticketRef),
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, field := range cfg.DedupFields {
+		p.dedupFields = append(p.dedupFields, StringToList(field))
+	}
+	if len(p.dedupFields) == 0 {
+		p.dedupFields = [][]string{{"_hub_hit_rule_id"}}
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (cfg *TicketConfig) validate() error {
+	if cfg.URL == "" {
+		return fmt.Errorf("%s url is required", cfg.Provider)
+	}
+	switch cfg.Provider {
+	case TicketProviderJira:
+		if cfg.Project == "" {
+			return fmt.Errorf("jira project is required")
+		}
+		if cfg.Token == "" {
+			return fmt.Errorf("jira token is required")
+		}
+		if cfg.IssueType == "" {
+			cfg.IssueType = defaultJiraIssueType
+		}
+	case TicketProviderTheHive:
+		if cfg.Token == "" {
+			return fmt.Errorf("thehive token is required")
+		}
+	case TicketProviderServiceNow:
+		if cfg.Username == "" || cfg.Password == "" {
+			return fmt.Errorf("servicenow username and password are required")
+		}
+		if cfg.Table == "" {
+			cfg.Table = defaultServiceNowTable
+		}
+	default:
+		return fmt.Errorf("unsupported ticket provider: %s", cfg.Provider)
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return nil
+}
+
+func (p *TicketProducer) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return
+			}
+			p.handle(msg)
+		}
+	}
+}
+
+// handle opens a ticket for an event, or deduplicates it against the open ticket of its fingerprint
+func (p *TicketProducer) handle(msg map[string]interface{}) {
+	fingerprint := p.Fingerprint(msg)
+	var err error
+retry:
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = p.deliver(fingerprint, msg)
+		if err == nil {
+			p.Receipts.AddAcked(1)
+			return
+		}
+		if retryAfter < 0 {
+			break
+		}
+		if retryAfter == 0 {
+			retryAfter = time.Second * time.Duration(attempt+1)
+		}
+		select {
+		case <-p.stopChan:
+			break retry
+		case <-time.After(retryAfter):
+		}
+	}
+
+	logger.Error("Failed to create ticket", "provider", p.cfg.Provider, "fingerprint", fingerprint, "error", err)
+	atomic.AddUint64(&p.failed, 1)
+	p.Receipts.AddFailed(1)
+}
+
+// deliver creates the ticket of a fingerprint unless one is open, see send for retryAfter
+func (p *TicketProducer) deliver(fingerprint string, msg map[string]interface{}) (time.Duration, error) {
+	now := time.Now()
+	ref, ok := p.open[fingerprint]
+	if !ok || now.After(ref.expires) {
+		// The ticket may have been opened before a restart or by another hub instance
+		id, retryAfter, err := p.findOpen(fingerprint)
+		if err != nil {
+			return retryAfter, err
+		}
+		ref = ticketRef{id: id}
+		ok = id != ""
+	}
+
+	if ok {
+		atomic.AddUint64(&p.deduplicated, 1)
+		p.remember(fingerprint, ref.id, now)
+		if p.cfg.CommentDuplicates {
+			if retryAfter, err := p.comment(ref.id, msg); err != nil {
+				return retryAfter, err
+			}
+			atomic.AddUint64(&p.commented, 1)
+		}
+		return 0, nil
+	}
+
+	id, retryAfter, err := p.create(fingerprint, msg)
+	if err != nil {
+		return retryAfter, err
+	}
+	atomic.AddUint64(&p.created, 1)
+	p.remember(fingerprint, id, now)
+
+	if p.cfg.AttachEvent {
+		// The ticket exists already, a failed attachment must not create it again
+		if _, err := p.attach(id, msg); err != nil {
+			logger.Warn("Failed to attach event to ticket", "provider", p.cfg.Provider, "ticket", id, "error", err)
+		}
+	}
+	return 0, nil
+}
+
+// remember maps a fingerprint to its open ticket for the dedup window
+func (p *TicketProducer) remember(fingerprint, id string, now time.Time) {
+	if len(p.open) >= maxTicketDedupEntries {
+		for k, ref := range p.open {
+			if now.After(ref.expires) {
+				delete(p.open, k)
+			}
+		}
+	}
+	p.open[fingerprint] = ticketRef{id: id, expires: now.Add(p.cfg.DedupWindow)}
+}
+
+// Fingerprint identifies the alert of an event from the dedup fields
+func (p *TicketProducer) Fingerprint(msg map[string]interface{}) string {
+	values := make([]string, 0, len(p.dedupFields))
+	for _, path := range p.dedupFields {
+		v, _ := GetCheckData(msg, path)
+		values = append(values, v)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(values, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fields builds the mapped ticket fields of an event, dotted ticket fields become nested objects
+func (p *TicketProducer) fields(msg map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(p.cfg.Fields))
+	for target, source := range p.cfg.Fields {
+		v, ok := GetCheckDataWithType(msg, StringToList(source))
+		if !ok || v == nil {
+			continue
+		}
+		parts := strings.Split(target, ".")
+		node := fields
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = v
+	}
+	return fields
+}
+
+// severity maps the detection severity of an event, empty when there is none
+func (p *TicketProducer) severity(msg map[string]interface{}) string {
+	if p.cfg.SeverityField == "" {
+		return ""
+	}
+	v, ok := GetCheckData(msg, StringToList(p.cfg.SeverityField))
+	if !ok || v == "" {
+		return ""
+	}
+	if mapped, ok := p.cfg.SeverityMap[v]; ok {
+		return mapped
+	}
+	if mapped, ok := p.cfg.SeverityMap[strings.ToLower(v)]; ok {
+		return mapped
+	}
+	return v
+}
+
+// create opens a ticket and returns its id
+func (p *TicketProducer) create(fingerprint string, msg map[string]interface{}) (string, time.Duration, error) {
+	title, err := ExecuteEventTemplate(p.title, msg)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to render title: %w", err)
+	}
+	title = truncateRunes(strings.TrimSpace(title), maxTicketTitle)
+	description, err := ExecuteEventTemplate(p.description, msg)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to render description: %w", err)
+	}
+
+	fields := p.fields(msg)
+	severity := p.severity(msg)
+	label := ticketFingerprintPrefix + fingerprint
+
+	switch p.cfg.Provider {
+	case TicketProviderJira:
+		fields["project"] = map[string]interface{}{"key": p.cfg.Project}
+		fields["issuetype"] = map[string]interface{}{"name": p.cfg.IssueType}
+		fields["summary"] = title
+		fields["description"] = description
+		fields["labels"] = append(append([]string{}, p.cfg.Labels...), label)
+		if severity != "" {
+			fields["priority"] = map[string]interface{}{"name": severity}
+		}
+		var resp struct {
+			Key string `json:"key"`
+		}
+		retryAfter, err := p.do(http.MethodPost, p.cfg.URL+"/rest/api/2/issue", map[string]interface{}{"fields": fields}, &resp)
+		return resp.Key, retryAfter, err
+
+	case TicketProviderTheHive:
+		fields["title"] = title
+		fields["description"] = description
+		fields["tags"] = append(append([]string{}, p.cfg.Labels...), label)
+		if severity != "" {
+			if n, ok := theHiveSeverities[strings.ToLower(severity)]; ok {
+				fields["severity"] = n
+			} else if n, err := strconv.Atoi(severity); err == nil && n >= 1 && n <= 4 {
+				fields["severity"] = n
+			}
+		}
+		var resp struct {
+			ID string `json:"_id"`
+		}
+		retryAfter, err := p.do(http.MethodPost, p.cfg.URL+"/api/v1/case", fields, &resp)
+		return resp.ID, retryAfter, err
+
+	default:
+		fields["short_description"] = title
+		fields["description"] = description
+		fields["correlation_id"] = fingerprint
+		fields["correlation_display"] = defaultIncidentSource
+		if severity != "" {
+			fields["impact"] = severity
+			fields["urgency"] = severity
+		}
+		var resp struct {
+			Result struct {
+				SysID string `json:"sys_id"`
+			} `json:"result"`
+		}
+		retryAfter, err := p.do(http.MethodPost, p.cfg.URL+"/api/now/table/"+url.PathEscape(p.cfg.Table), fields, &resp)
+		return resp.Result.SysID, retryAfter, err
+	}
+}
+
+// findOpen returns the id of a ticket of the fingerprint that is still open, empty when there is none
+func (p *TicketProducer) findOpen(fingerprint string) (string, time.Duration, error) {
+	label := ticketFingerprintPrefix + fingerprint
+
+	switch p.cfg.Provider {
+	case TicketProviderJira:
+		query := url.Values{}
+		query.Set("jql", fmt.Sprintf(`project = "%s" AND labels = "%s" AND statusCategory != Done`, p.cfg.Project, label))
+		query.Set("maxResults", "1")
+		query.Set("fields", "key")
+		var resp struct {
+			Issues []struct {
+				Key string `json:"key"`
+			} `json:"issues"`
+		}
+		retryAfter, err := p.do(http.MethodGet, p.cfg.URL+"/rest/api/2/search?"+query.Encode(), nil, &resp)
+		if err != nil || len(resp.Issues) == 0 {
+			return "", retryAfter, err
+		}
+		return resp.Issues[0].Key, 0, nil
+
+	case TicketProviderTheHive:
+		body := map[string]interface{}{
+			"query": []map[string]interface{}{
+				{"_name": "listCase"},
+				{"_name": "filter", "_and": []map[string]interface{}{
+					{"_eq": map[string]interface{}{"_field": "tags", "_value": label}},
+					{"_not": map[string]interface{}{"_eq": map[string]interface{}{"_field": "stage", "_value": "Closed"}}},
+				}},
+				{"_name": "page", "from": 0, "to": 1},
+			},
+		}
+		var resp []struct {
+			ID string `json:"_id"`
+		}
+		retryAfter, err := p.do(http.MethodPost, p.cfg.URL+"/api/v1/query?name=hub-dedup", body, &resp)
+		if err != nil || len(resp) == 0 {
+			return "", retryAfter, err
+		}
+		return resp[0].ID, 0, nil
+
+	default:
+		query := url.Values{}
+		query.Set("sysparm_query", "correlation_id="+fingerprint+"^active=true")
+		query.Set("sysparm_limit", "1")
+		query.Set("sysparm_fields", "sys_id")
+		var resp struct {
+			Result []struct {
+				SysID string `json:"sys_id"`
+			} `json:"result"`
+		}
+		retryAfter, err := p.do(http.MethodGet, p.cfg.URL+"/api/now/table/"+url.PathEscape(p.cfg.Table)+"?"+query.Encode(), nil, &resp)
+		if err != nil || len(resp.Result) == 0 {
+			return "", retryAfter, err
+		}
+		return resp.Result[0].SysID, 0, nil
+	}
+}
+
+// comment adds a duplicate event to an open ticket
+func (p *TicketProducer) comment(id string, msg map[string]interface{}) (time.Duration, error) {
+	event, _ := json.MarshalIndent(msg, "", "  ")
+	text := "Duplicate alert received by AgentSmith-HUB:\n" + string(event)
+
+	switch p.cfg.Provider {
+	case TicketProviderJira:
+		return p.do(http.MethodPost, p.cfg.URL+"/rest/api/2/issue/"+url.PathEscape(id)+"/comment", map[string]interface{}{"body": text}, nil)
+	case TicketProviderTheHive:
+		return p.do(http.MethodPost, p.cfg.URL+"/api/v1/case/"+url.PathEscape(id)+"/comment", map[string]interface{}{"message": text}, nil)
+	default:
+		return p.do(http.MethodPatch, p.cfg.URL+"/api/now/table/"+url.PathEscape(p.cfg.Table)+"/"+url.PathEscape(id), map[string]interface{}{"work_notes": text}, nil)
+	}
+}
+
+// attach uploads the raw event JSON to a ticket
+func (p *TicketProducer) attach(id string, msg map[string]interface{}) (time.Duration, error) {
+	event, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return -1, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if p.cfg.Provider == TicketProviderServiceNow {
+		query := url.Values{}
+		query.Set("table_name", p.cfg.Table)
+		query.Set("table_sys_id", id)
+		query.Set("file_name", ticketEventFileName)
+		return p.send(http.MethodPost, p.cfg.URL+"/api/now/attachment/file?"+query.Encode(), "application/json", event, nil, nil)
+	}
+
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	fieldName, endpoint := "file", p.cfg.URL+"/rest/api/2/issue/"+url.PathEscape(id)+"/attachments"
+	if p.cfg.Provider == TicketProviderTheHive {
+		fieldName, endpoint = "attachments", p.cfg.URL+"/api/v1/case/"+url.PathEscape(id)+"/attachments"
+	}
+	part, err := form.CreateFormFile(fieldName, ticketEventFileName)
+	if err != nil {
+		return -1, err
+	}
+	if _, err := part.Write(event); err != nil {
+		return -1, err
+	}
+	if err := form.Close(); err != nil {
+		return -1, err
+	}
+
+	header := http.Header{}
+	if p.cfg.Provider == TicketProviderJira {
+		// Jira rejects attachment uploads without this header as XSRF
+		header.Set("X-Atlassian-Token", "no-check")
+	}
+	return p.send(http.MethodPost, endpoint, form.FormDataContentType(), buf.Bytes(), header, nil)
+}
+
+// do sends a JSON request and decodes the JSON response into out when it is not nil
+func (p *TicketProducer) do(method, endpoint string, body interface{}, out interface{}) (time.Duration, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return -1, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	return p.send(method, endpoint, "application/json", data, nil, out)
+}
+
+// send performs one API call. retryAfter is negative when the error must not be retried,
+// zero for the default backoff, or the delay asked for by the provider.
+func (p *TicketProducer) send(method, endpoint, contentType string, data []byte, header http.Header, out interface{}) (time.Duration, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, endpoint, body)
+	if err != nil {
+		return -1, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	p.cfg.authorize(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if out == nil {
+			return 0, nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return -1, fmt.Errorf("failed to decode %s response: %w", p.cfg.Provider, err)
+		}
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		retryAfter := time.Duration(0)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(min(secs, ticketRetryAfterMaxSec)) * time.Second
+		}
+		return retryAfter, fmt.Errorf("%s rate limited: %s", p.cfg.Provider, strings.TrimSpace(string(respBody)))
+	case resp.StatusCode >= 500:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return 0, fmt.Errorf("%s returned %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return -1, fmt.Errorf("%s rejected request with %d: %s", p.cfg.Provider, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// authorize sets the credentials of the provider on a request
+func (cfg *TicketConfig) authorize(req *http.Request) {
+	switch cfg.Provider {
+	case TicketProviderJira:
+		if cfg.Username != "" {
+			// Jira Cloud: account email with API token
+			req.SetBasicAuth(cfg.Username, cfg.Token)
+		} else {
+			// Jira Data Center personal access token
+			req.Header.Set("Authorization", "Bearer "+cfg.Token)
+		}
+	case TicketProviderTheHive:
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	case TicketProviderServiceNow:
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+}
+
+// Close waits for the queued events to be sent once msgChan is closed by its owner, giving up after 30s
+func (p *TicketProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many tickets were created, how many events were deduplicated or commented, and failures
+func (p *TicketProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"created":      atomic.LoadUint64(&p.created),
+		"deduplicated": atomic.LoadUint64(&p.deduplicated),
+		"commented":    atomic.LoadUint64(&p.commented),
+		"failed":       atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestTicketConnection checks that the provider API is reachable and accepts the credentials
+func TestTicketConnection(cfg TicketConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	var endpoint string
+	switch cfg.Provider {
+	case TicketProviderJira:
+		endpoint = cfg.URL + "/rest/api/2/myself"
+	case TicketProviderTheHive:
+		endpoint = cfg.URL + "/api/v1/user/current"
+	case TicketProviderServiceNow:
+		endpoint = cfg.URL + "/api/now/table/" + url.PathEscape(cfg.Table) + "?sysparm_limit=1&sysparm_fields=sys_id"
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	cfg.authorize(req)
+
+	client, err := NewOutputHTTPClient(cfg.HTTP, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s not reachable: %w", cfg.Provider, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s rejected the credentials", cfg.Provider)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%s returned %d", cfg.Provider, resp.StatusCode)
+	}
+	return nil
+}
@@ -25,13 +25,18 @@ type CheckCoreCache struct {
 type HubConfig struct {
 	Redis         string `yaml:"redis"`
 	RedisPassword string `yaml:"redis_password,omitempty"`
-	PprofEnable   bool   `yaml:"pprof_enable"`
-	PprofPort     string `yaml:"pprof_port"`
-	SIMDEnabled   bool   `yaml:"simd_enabled"`
-	ConfigRoot    string
-	Leader        string
-	LocalIP       string
-	Token         string
+	// Read replicas for samples, statistics and error logs, they share redis_password with the primary
+	RedisReplicas []string `yaml:"redis_replicas,omitempty"`
+	PprofEnable   bool     `yaml:"pprof_enable"`
+	PprofPort     string   `yaml:"pprof_port"`
+	SIMDEnabled   bool     `yaml:"simd_enabled"`
+	// Lite mode runs a single node without Redis, using an embedded store persisted to LiteDataFile
+	Lite         bool   `yaml:"lite"`
+	LiteDataFile string `yaml:"lite_data_file,omitempty"`
+	ConfigRoot   string
+	Leader       string
+	LocalIP      string
+	Token        string
 	// OIDC/OAuth2 configuration
 	OIDCEnabled       bool     `yaml:"oidc_enabled"`
 	OIDCIssuer        string   `yaml:"oidc_issuer"`
@@ -40,6 +45,87 @@ type HubConfig struct {
 	OIDCAllowedUsers  []string `yaml:"oidc_allowed_users"`
 	OIDCRedirectURI   string   `yaml:"oidc_redirect_uri"`
 	OIDCScope         string   `yaml:"oidc_scope"`
+	// Synthetic canary latency measurement
+	Canary *CanaryConfig `yaml:"canary,omitempty"`
+	// Custom health probes run by the component monitor in addition to the built-in checks
+	HealthProbes []HealthProbeConfig `yaml:"health_probes,omitempty"`
+	// Goroutine and channel growth detection per project
+	LeakDetector *LeakDetectorConfig `yaml:"leak_detector,omitempty"`
+	// Retention policy for samples, error logs, operations history and statistics kept in Redis
+	Retention *RetentionConfig `yaml:"retention,omitempty"`
+	// Child hubs this hub publishes ruleset versions to
+	Distribution *DistributionConfig `yaml:"distribution,omitempty"`
+	// Redaction of the API access log
+	APIAccessLog *APIAccessLogConfig `yaml:"api_access_log,omitempty"`
+	// Users allowed to read sampled events, every authenticated user when unset
+	SamplerAccess *SamplerAccessConfig `yaml:"sampler_access,omitempty"`
+	// TLS and proxy defaults of HTTP-based outputs, an output's own http block overrides them
+	OutputHTTP *OutputHTTPConfig `yaml:"output_http,omitempty"`
+	// Databases of the <geoip> element of rulesets
+	GeoIP *GeoIPConfig `yaml:"geoip,omitempty"`
+	// Threat intel feeds of INTEL checks and appends
+	ThreatIntel *ThreatIntelConfig `yaml:"threat_intel,omitempty"`
+	// Resolver of DNS appends
+	DNS *DNSConfig `yaml:"dns,omitempty"`
+	// Decay of the entity risk scores of <score> elements
+	Risk *RiskConfig `yaml:"risk,omitempty"`
+	// Holidays excluded from the schedules of TIME checks
+	HolidayCalendars HolidayCalendarsConfig `yaml:"holiday_calendars,omitempty"`
+	// Default field and logsource mapping of Sigma rule conversion
+	Sigma *SigmaMapping `yaml:"sigma,omitempty"`
+	// Bundled third-party packages Yaegi plugins may import, such as github.com/google/uuid
+	PluginPackages []string `yaml:"plugin_packages,omitempty"`
+	// Toolchain compiling plugins with the native or process runtime
+	PluginBuild *PluginBuildConfig `yaml:"plugin_build,omitempty"`
+	// Default execution budgets of user plugins
+	PluginLimits *PluginLimitsConfig `yaml:"plugin_limits,omitempty"`
+	// Block applying plugin changes when the plugin has no plugin/<name>_test.json
+	RequirePluginTests bool `yaml:"require_plugin_tests,omitempty"`
+	// Providers of the ${secret:name} references of plugins and output configs
+	Secrets *SecretsConfig `yaml:"secrets,omitempty"`
+}
+
+// PluginLimitsConfig are the default execution budgets of user plugins. A plugin overrides them
+// with //hub:timeout, //hub:max_memory and //hub:max_concurrency directives.
+type PluginLimitsConfig struct {
+	// Wall-clock limit of one call, none when zero
+	Timeout time.Duration `yaml:"timeout"`
+	// Memory limit such as 256MB, only enforced for plugins with the process or wasm runtime
+	MaxMemory string `yaml:"max_memory"`
+	// Calls of the plugin running at once, none when zero
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// Consecutive violations marking the plugin unhealthy, 5 when zero
+	MaxViolations int `yaml:"max_violations"`
+	// How long an unhealthy plugin fails without being called, 1m when zero
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// PluginBuildConfig configures how plugins with a //hub:runtime native or process directive are
+// compiled. Native plugins must be built by the Go version that built the hub.
+type PluginBuildConfig struct {
+	// Go binary, "go" from PATH when empty
+	Go string `yaml:"go"`
+	// Directory of the build cache, a directory under the system temp directory when empty
+	Dir string `yaml:"dir"`
+	// Time limit of one build, 2m when zero
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SigmaMapping maps Sigma rules to the events of the hub
+type SigmaMapping struct {
+	// Sigma field name to event field, fields not listed keep their name
+	Fields map[string]string `yaml:"fields" json:"fields"`
+	// Checks added to the rules of a logsource
+	Logsources []SigmaLogsource `yaml:"logsources" json:"logsources"`
+}
+
+// SigmaLogsource adds EQU checks on Conditions to the rules whose logsource has the set Product,
+// Category and Service
+type SigmaLogsource struct {
+	Product    string            `yaml:"product" json:"product"`
+	Category   string            `yaml:"category" json:"category"`
+	Service    string            `yaml:"service" json:"service"`
+	Conditions map[string]string `yaml:"conditions" json:"conditions"`
 }
 
 // Operation types for project operations
@@ -54,6 +140,7 @@ const (
 	OpTypeProjectStart    OperationType = "project_start"
 	OpTypeProjectStop     OperationType = "project_stop"
 	OpTypeProjectRestart  OperationType = "project_restart"
+	OpTypeSamplerAccess   OperationType = "sampler_access" // Read of sampled events, allowed or denied
 	// Cluster instruction operations
 	OpTypeInstructionPublish OperationType = "instruction_publish" // Leader发布指令
 )
@@ -37,6 +37,16 @@ func GetComponentFromSequenceID(sequence string) (string, string) {
 		}
 	}
 
+	// Suppressed matches of a rule: "SUPPRESS.rulesetID.ruleID"
+	if len(parts) == 3 && strings.ToUpper(parts[0]) == "SUPPRESS" {
+		return "rule_suppressed", parts[1]
+	}
+
+	// Events dropped by a rule of an EXCLUDE ruleset: "EXCLUDE.rulesetID.ruleID"
+	if len(parts) == 3 && strings.ToUpper(parts[0]) == "EXCLUDE" {
+		return "rule_excluded", parts[1]
+	}
+
 	// For other components, use the last two parts
 	return parts[len(parts)-2], parts[len(parts)-1]
 }
@@ -170,22 +180,41 @@ func MapDel(data map[string]interface{}, key []string) {
 	}
 }
 
+// StringToList splits a field path into its keys: "a.b" is a then b, and "a[0]" or "a.#0" is the
+// a dot, a bracket or a leading dollar: "a\[0]" is the key a[0] and "\$.a" is a in the key $.
+// a dot, a bracket or a leading dollar, so "\\[0]" and "\\$.a" are literal keys.
 func StringToList(checkKey string) []string {
 	if len(checkKey) == 0 {
 		return nil
 	}
+	if isJSONPath(checkKey) {
+		return jsonPathToList(checkKey)
+	}
 	var res []string
 	var sb strings.Builder
+	afterBracket := false
 	for i := 0; i < len(checkKey); i++ {
-		if checkKey[i] == '\\' && i+1 < len(checkKey) && checkKey[i+1] == '.' {
-			sb.WriteByte('.')
+		if checkKey[i] == '\\' && i+1 < len(checkKey) && strings.IndexByte(".[$", checkKey[i+1]) >= 0 {
+			sb.WriteByte(checkKey[i+1])
 			i++
 		} else if checkKey[i] == '.' {
-			res = append(res, sb.String())
+			if !afterBracket || sb.Len() > 0 {
+				res = append(res, sb.String())
+			}
 			sb.Reset()
+		} else if key, n, ok := parsePathBracket(checkKey[i:], false); ok {
+			if sb.Len() > 0 {
+				res = append(res, sb.String())
+				sb.Reset()
+			}
+			res = append(res, key)
+			i += n - 1
+			afterBracket = true
+			continue
 		} else {
 			sb.WriteByte(checkKey[i])
 		}
+		afterBracket = false
 	}
 	if sb.Len() > 0 {
 		res = append(res, sb.String())
@@ -228,6 +257,13 @@ func AnyToString(tmp interface{}) string {
 // Returns the string value and whether it exists.
 // Handles map, slice, JSON string, and URL query string as intermediate nodes.
 func GetCheckData(data map[string]interface{}, checkKeyList []string) (res string, exist bool) {
+	if isPatternPath(checkKeyList) {
+		v, ok := getPatternPath(data, checkKeyList)
+		if !ok {
+			return "", false
+		}
+		return AnyToString(v), true
+	}
 	tmp := data
 	res = ""
 	keyListLen := len(checkKeyList) - 1
@@ -289,6 +325,9 @@ func GetCheckData(data map[string]interface{}, checkKeyList []string) (res strin
 // Handles map, slice, JSON string, and URL query string as intermediate nodes.
 // Unlike GetCheckData, this function preserves the original data type.
 func GetCheckDataWithType(data map[string]interface{}, checkKeyList []string) (res interface{}, exist bool) {
+	if isPatternPath(checkKeyList) {
+		return getPatternPath(data, checkKeyList)
+	}
 	tmp := data
 	res = nil
 	keyListLen := len(checkKeyList) - 1
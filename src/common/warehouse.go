@@ -0,0 +1,482 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	WarehouseSnowflake = "snowflake"
+	WarehouseBigQuery  = "bigquery"
+)
+
+// WarehouseColumn maps an event field to a warehouse table column
+type WarehouseColumn struct {
+	Name  string `yaml:"name" json:"name"`
+	Field string `yaml:"field,omitempty" json:"field"` // dot separated path, * for the whole event, default the column name
+	Type  string `yaml:"type,omitempty" json:"type"`   // string (default), int, float, bool, timestamp or json
+}
+
+// warehouseColumnTypes maps the column types to the Snowflake and BigQuery types used to create tables
+var warehouseColumnTypes = map[string][2]string{
+	"string":    {"VARCHAR", "STRING"},
+	"int":       {"NUMBER(38,0)", "INT64"},
+	"float":     {"FLOAT", "FLOAT64"},
+	"bool":      {"BOOLEAN", "BOOL"},
+	"timestamp": {"TIMESTAMP_TZ", "TIMESTAMP"},
+	"json":      {"VARIANT", "JSON"},
+}
+
+// WarehouseConfig holds the settings of a Snowflake or BigQuery table producer
+type WarehouseConfig struct {
+	Provider    string // snowflake or bigquery
+	Table       string // snowflake: database.schema.table, bigquery: project.dataset.table or dataset.table
+	Columns     []WarehouseColumn
+	CreateTable bool // create the table from the columns when it does not exist
+	Snowflake   SnowflakeConfig
+	BigQuery    BigQueryConfig
+
+	BatchSize  int
+	FlushDur   time.Duration
+	Timeout    time.Duration // per request
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// Validate checks the table and column settings
+func (c *WarehouseConfig) Validate() error {
+	parts := strings.Split(c.Table, ".")
+	switch c.Provider {
+	case WarehouseSnowflake:
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid table %q, expected database.schema.table", c.Table)
+		}
+		if c.Snowflake.Account == "" || c.Snowflake.User == "" || c.Snowflake.PrivateKey == "" {
+			return fmt.Errorf("account, user and private_key are required")
+		}
+	case WarehouseBigQuery:
+		if len(parts) != 2 && len(parts) != 3 {
+			return fmt.Errorf("invalid table %q, expected project.dataset.table or dataset.table", c.Table)
+		}
+		if c.BigQuery.CredentialsJSON == "" {
+			return fmt.Errorf("credentials_json or credentials_file is required")
+		}
+	default:
+		return fmt.Errorf("unsupported warehouse %q, must be %s or %s", c.Provider, WarehouseSnowflake, WarehouseBigQuery)
+	}
+	for _, part := range parts {
+		// BigQuery project ids may contain dashes
+		if !sqlIdentifier.MatchString(strings.ReplaceAll(part, "-", "_")) {
+			return fmt.Errorf("invalid table %q", c.Table)
+		}
+	}
+
+	if c.CreateTable && len(c.Columns) == 0 {
+		return fmt.Errorf("create_table needs the columns of the table")
+	}
+	names := make(map[string]bool, len(c.Columns))
+	for _, col := range c.Columns {
+		if !sqlIdentifier.MatchString(col.Name) || strings.Contains(col.Name, "$") {
+			return fmt.Errorf("invalid column name %q", col.Name)
+		}
+		if names[strings.ToLower(col.Name)] {
+			return fmt.Errorf("duplicate column %q", col.Name)
+		}
+		names[strings.ToLower(col.Name)] = true
+		if _, ok := warehouseColumnTypes[warehouseColumnType(col)]; !ok {
+			return fmt.Errorf("column %s has unsupported type %q, must be string, int, float, bool, timestamp or json", col.Name, col.Type)
+		}
+	}
+	if c.Provider == WarehouseBigQuery && c.BigQuery.PartitionField != "" && !names[strings.ToLower(c.BigQuery.PartitionField)] {
+		return fmt.Errorf("partition_field %q is not one of the columns", c.BigQuery.PartitionField)
+	}
+	return nil
+}
+
+func warehouseColumnType(col WarehouseColumn) string {
+	if col.Type == "" {
+		if col.Field == "*" {
+			return "json"
+		}
+		return "string"
+	}
+	return strings.ToLower(col.Type)
+}
+
+// warehouseWriter is the provider specific part of a warehouse producer
+type warehouseWriter interface {
+	// createTable creates the table from the columns unless it exists
+	createTable(ctx context.Context) error
+	// write appends rows to the table and returns how many the warehouse refused for their content
+	write(ctx context.Context, rows []map[string]interface{}, ids []string) (int, error)
+	// check verifies the credentials and that the table is reachable
+	check(ctx context.Context) error
+}
+
+// warehouseHTTPError is a response of the warehouse API with an error status
+type warehouseHTTPError struct {
+	status int
+	body   string
+}
+
+func (e *warehouseHTTPError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.body)
+}
+
+// warehouseRetryable reports whether a failed request may succeed when sent again. Only explicit
+// rejections of the request are final, network errors and throttling are retried.
+func warehouseRetryable(err error) bool {
+	var httpErr *warehouseHTTPError
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+	return httpErr.status == http.StatusUnauthorized || httpErr.status == http.StatusRequestTimeout ||
+		httpErr.status == http.StatusTooManyRequests || httpErr.status >= 500
+}
+
+func newWarehouseWriter(cfg WarehouseConfig) (warehouseWriter, error) {
+	switch cfg.Provider {
+	case WarehouseSnowflake:
+		return newSnowflakeWriter(cfg)
+	case WarehouseBigQuery:
+		return newBigQueryWriter(cfg)
+	}
+	return nil, fmt.Errorf("unsupported warehouse %q", cfg.Provider)
+}
+
+// WarehouseProducer micro-batches events into a Snowflake or BigQuery table
+type WarehouseProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+
+	cfg        WarehouseConfig
+	writer     warehouseWriter
+	fields     [][]string // event path per column, nil for the whole event
+	jsonString bool       // json columns are sent as encoded strings
+	tableReady bool
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	rowsWritten   uint64
+	rowsRejected  uint64
+	batchesFailed uint64
+}
+
+// NewWarehouseProducer starts writing the events read from msgChan
+func NewWarehouseProducer(cfg WarehouseConfig, msgChan chan map[string]interface{}) (*WarehouseProducer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushDur <= 0 {
+		cfg.FlushDur = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	writer, err := newWarehouseWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &WarehouseProducer{
+		MsgChan:    msgChan,
+		cfg:        cfg,
+		writer:     writer,
+		jsonString: cfg.Provider == WarehouseBigQuery,
+		tableReady: !cfg.CreateTable,
+		stopChan:   make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, col := range cfg.Columns {
+		switch col.Field {
+		case "*":
+			p.fields = append(p.fields, nil)
+		case "":
+			p.fields = append(p.fields, StringToList(col.Name))
+		default:
+			p.fields = append(p.fields, StringToList(col.Field))
+		}
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (p *WarehouseProducer) run() {
+	defer close(p.done)
+	batch := make([]map[string]interface{}, 0, p.cfg.BatchSize)
+	timer := time.NewTimer(p.cfg.FlushDur)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			p.Receipts.AddFailed(uint64(len(batch)))
+			TakeDeliveryTokens(batch).Fail()
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				if len(batch) > 0 {
+					p.flush(batch)
+				}
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(p.cfg.FlushDur)
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+			timer.Reset(p.cfg.FlushDur)
+		}
+	}
+}
+
+// flush writes a batch, retrying while the warehouse is unreachable or throttling. Insert ids stay
+// the same across retries so BigQuery can drop the rows of an attempt that went through.
+func (p *WarehouseProducer) flush(batch []map[string]interface{}) {
+	tokens := TakeDeliveryTokens(batch)
+	rows := make([]map[string]interface{}, len(batch))
+	ids := make([]string, len(batch))
+	for i, msg := range batch {
+		rows[i] = p.row(msg)
+		ids[i] = newFederationID()
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-p.stopChan:
+				p.Receipts.AddFailed(uint64(len(batch)))
+				tokens.Fail()
+				return
+			case <-time.After(p.cfg.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		var rejected int
+		rejected, err = p.write(rows, ids)
+		if err == nil {
+			atomic.AddUint64(&p.rowsWritten, uint64(len(batch)-rejected))
+			atomic.AddUint64(&p.rowsRejected, uint64(rejected))
+			p.Receipts.AddAcked(uint64(len(batch) - rejected))
+			p.Receipts.AddFailed(uint64(rejected))
+			if rejected > 0 {
+				logger.Warn("Warehouse refused rows of a batch", "warehouse", p.cfg.Provider, "table", p.cfg.Table, "rows", rejected)
+			}
+			// Refused rows were refused for their content, sending them again cannot help
+			tokens.Release()
+			return
+		}
+		if !warehouseRetryable(err) {
+			break
+		}
+		logger.Warn("Warehouse batch failed, retrying", "warehouse", p.cfg.Provider, "table", p.cfg.Table, "attempt", attempt+1, "error", err)
+	}
+
+	logger.Error("Failed to write batch to warehouse", "warehouse", p.cfg.Provider, "table", p.cfg.Table, "rows", len(batch), "error", err)
+	atomic.AddUint64(&p.batchesFailed, 1)
+	atomic.AddUint64(&p.rowsRejected, uint64(len(batch)))
+	p.Receipts.AddFailed(uint64(len(batch)))
+	tokens.Fail()
+}
+
+// write creates the table on first use and appends the rows, aborting on shutdown
+func (p *WarehouseProducer) write(rows []map[string]interface{}, ids []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if !p.tableReady {
+		if err := p.writer.createTable(ctx); err != nil {
+			return 0, fmt.Errorf("failed to create table: %w", err)
+		}
+		p.tableReady = true
+	}
+	return p.writer.write(ctx, rows, ids)
+}
+
+// row builds the table row of an event, without columns every event field is sent
+func (p *WarehouseProducer) row(msg map[string]interface{}) map[string]interface{} {
+	if len(p.cfg.Columns) == 0 {
+		return msg
+	}
+	row := make(map[string]interface{}, len(p.cfg.Columns))
+	for i, col := range p.cfg.Columns {
+		var v interface{}
+		if p.fields[i] == nil {
+			v = msg
+		} else if found, ok := GetCheckDataWithType(msg, p.fields[i]); ok {
+			v = found
+		}
+		row[col.Name] = warehouseValue(warehouseColumnType(col), v, p.jsonString)
+	}
+	return row
+}
+
+// warehouseValue converts an event value to the type of its column, nil when it does not convert
+func warehouseValue(typ string, v interface{}, jsonString bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch typ {
+	case "int":
+		switch n := v.(type) {
+		case float64:
+			if n == math.Trunc(n) && !math.IsInf(n, 0) {
+				return int64(n)
+			}
+			return nil
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return n
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(AnyToString(v)), 10, 64); err == nil {
+			return n
+		}
+		return nil
+	case "float":
+		if n, ok := v.(float64); ok {
+			if math.IsNaN(n) || math.IsInf(n, 0) {
+				return nil
+			}
+			return n
+		}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(AnyToString(v)), 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n
+		}
+		return nil
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b
+		}
+		if b, err := strconv.ParseBool(strings.TrimSpace(AnyToString(v))); err == nil {
+			return b
+		}
+		return nil
+	case "timestamp":
+		return warehouseTimestamp(v)
+	case "json":
+		if !jsonString {
+			return v
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		data, err := sonic.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(data)
+	}
+	return AnyToString(v)
+}
+
+// warehouseTimestamp accepts RFC 3339 strings and epoch seconds or milliseconds
+func warehouseTimestamp(v interface{}) interface{} {
+	var epoch float64
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case float64:
+		epoch = t
+	case int64:
+		epoch = float64(t)
+	case int:
+		epoch = float64(t)
+	default:
+		s := strings.TrimSpace(AnyToString(v))
+		if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return ts.UTC().Format(time.RFC3339Nano)
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			// Leave other layouts to the warehouse
+			return s
+		}
+		epoch = n
+	}
+	if epoch > 1e12 {
+		epoch /= 1000
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano)
+}
+
+// Close flushes the pending batch once msgChan is closed by its owner, giving up after 30s
+func (p *WarehouseProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetRowsWritten returns the number of rows accepted by the warehouse
+func (p *WarehouseProducer) GetRowsWritten() uint64 {
+	return atomic.LoadUint64(&p.rowsWritten)
+}
+
+// GetRowsRejected returns the number of events refused by the warehouse or dropped after all retries
+func (p *WarehouseProducer) GetRowsRejected() uint64 {
+	return atomic.LoadUint64(&p.rowsRejected)
+}
+
+// GetFailedBatches returns the number of batches dropped after all retries
+func (p *WarehouseProducer) GetFailedBatches() uint64 {
+	return atomic.LoadUint64(&p.batchesFailed)
+}
+
+// TestWarehouseConnection checks the credentials and that the table exists, or can be created
+func TestWarehouseConnection(cfg WarehouseConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	writer, err := newWarehouseWriter(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return writer.check(ctx)
+}
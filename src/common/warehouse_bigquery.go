@@ -0,0 +1,199 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// BigQueryConfig holds the settings of a BigQuery table producer
+type BigQueryConfig struct {
+	CredentialsJSON string // service account key
+	PartitionField  string // timestamp column partitioning a created table by day
+	Endpoint        string // default https://bigquery.googleapis.com
+}
+
+// bigQueryRetryReasons are row errors caused by BigQuery rather than by the row
+var bigQueryRetryReasons = map[string]bool{
+	"backendError":      true,
+	"internalError":     true,
+	"timeout":           true,
+	"rateLimitExceeded": true,
+}
+
+// bigQueryWriter streams rows with the legacy tabledata.insertAll, not the Storage Write API, and
+// creates tables with tables.insert. Rows are deduplicated on their insert id on a best effort basis.
+type bigQueryWriter struct {
+	cfg      BigQueryConfig
+	columns  []WarehouseColumn
+	create   bool
+	project  string
+	dataset  string
+	table    string
+	endpoint string
+	tokens   *googleTokenSource
+	client   *http.Client
+}
+
+func newBigQueryWriter(cfg WarehouseConfig) (*bigQueryWriter, error) {
+	tokens, err := newGoogleTokenSource(cfg.BigQuery.CredentialsJSON, "", "https://www.googleapis.com/auth/bigquery")
+	if err != nil {
+		return nil, err
+	}
+	w := &bigQueryWriter{
+		cfg:      cfg.BigQuery,
+		columns:  cfg.Columns,
+		create:   cfg.CreateTable,
+		endpoint: strings.TrimRight(cfg.BigQuery.Endpoint, "/"),
+		tokens:   tokens,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+	if w.endpoint == "" {
+		w.endpoint = "https://bigquery.googleapis.com"
+	}
+	parts := strings.Split(cfg.Table, ".")
+	if len(parts) == 3 {
+		w.project, w.dataset, w.table = parts[0], parts[1], parts[2]
+	} else {
+		// The table is in the project of the service account
+		var sa struct {
+			ProjectID string `json:"project_id"`
+		}
+		_ = json.Unmarshal([]byte(cfg.BigQuery.CredentialsJSON), &sa)
+		if sa.ProjectID == "" {
+			return nil, fmt.Errorf("table %q has no project and the service account has no project_id", cfg.Table)
+		}
+		w.project, w.dataset, w.table = sa.ProjectID, parts[0], parts[1]
+	}
+	return w, nil
+}
+
+func (w *bigQueryWriter) datasetURL() string {
+	return w.endpoint + "/bigquery/v2/projects/" + url.PathEscape(w.project) + "/datasets/" + url.PathEscape(w.dataset)
+}
+
+func (w *bigQueryWriter) tableURL() string {
+	return w.datasetURL() + "/tables/" + url.PathEscape(w.table)
+}
+
+// do sends an authorized request and decodes the response into out when set
+func (w *bigQueryWriter) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := sonic.Marshal(body)
+		if err != nil {
+			return &warehouseHTTPError{status: http.StatusBadRequest, body: "failed to encode request: " + err.Error()}
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	token, err := w.tokens.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &warehouseHTTPError{status: resp.StatusCode, body: truncateRunes(strings.TrimSpace(string(data)), 512)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode bigquery response: %w", err)
+	}
+	return nil
+}
+
+func (w *bigQueryWriter) write(ctx context.Context, rows []map[string]interface{}, ids []string) (int, error) {
+	type insertRow struct {
+		InsertID string                 `json:"insertId"`
+		JSON     map[string]interface{} `json:"json"`
+	}
+	req := struct {
+		SkipInvalidRows     bool        `json:"skipInvalidRows"`
+		IgnoreUnknownValues bool        `json:"ignoreUnknownValues"`
+		Rows                []insertRow `json:"rows"`
+	}{SkipInvalidRows: true, IgnoreUnknownValues: true, Rows: make([]insertRow, len(rows))}
+	for i, row := range rows {
+		req.Rows[i] = insertRow{InsertID: ids[i], JSON: row}
+	}
+
+	var resp struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := w.do(ctx, http.MethodPost, w.tableURL()+"/insertAll", req, &resp); err != nil {
+		return 0, err
+	}
+
+	rejected := 0
+	for _, rowErr := range resp.InsertErrors {
+		for _, e := range rowErr.Errors {
+			if bigQueryRetryReasons[e.Reason] {
+				// Rows sent again keep their insert id, BigQuery drops the ones it already has
+				return 0, fmt.Errorf("bigquery could not insert row %d: %s: %s", rowErr.Index, e.Reason, e.Message)
+			}
+		}
+		rejected++
+	}
+	return rejected, nil
+}
+
+// createTable creates the table from the columns, an existing table is left as it is
+func (w *bigQueryWriter) createTable(ctx context.Context) error {
+	fields := make([]map[string]string, len(w.columns))
+	for i, col := range w.columns {
+		fields[i] = map[string]string{
+			"name": col.Name,
+			"type": warehouseColumnTypes[warehouseColumnType(col)][1],
+			"mode": "NULLABLE",
+		}
+	}
+	table := map[string]interface{}{
+		"tableReference": map[string]string{"projectId": w.project, "datasetId": w.dataset, "tableId": w.table},
+		"schema":         map[string]interface{}{"fields": fields},
+	}
+	if w.cfg.PartitionField != "" {
+		table["timePartitioning"] = map[string]string{"type": "DAY", "field": w.cfg.PartitionField}
+	}
+	err := w.do(ctx, http.MethodPost, w.datasetURL()+"/tables", table, nil)
+	var httpErr *warehouseHTTPError
+	if errors.As(err, &httpErr) && httpErr.status == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func (w *bigQueryWriter) check(ctx context.Context) error {
+	err := w.do(ctx, http.MethodGet, w.tableURL(), nil, nil)
+	var httpErr *warehouseHTTPError
+	if w.create && errors.As(err, &httpErr) && httpErr.status == http.StatusNotFound {
+		// The table is created on the first write, its dataset must exist
+		return w.do(ctx, http.MethodGet, w.datasetURL(), nil, nil)
+	}
+	return err
+}
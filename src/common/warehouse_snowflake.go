@@ -0,0 +1,349 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// SnowflakeConfig holds the Snowpipe Streaming settings of a Snowflake table producer
+type SnowflakeConfig struct {
+	Account    string // account identifier, e.g. myorg-myaccount
+	User       string
+	PrivateKey string // PEM encoded RSA key whose public key is set as RSA_PUBLIC_KEY of the user
+	Role       string // role of the CREATE TABLE statement
+	Warehouse  string // warehouse of the CREATE TABLE statement
+	Pipe       string // default the streaming pipe of the table, <TABLE>-STREAMING
+	Channel    string // unique per writer, every hub node streams through its own channel
+	URL        string // default https://<account>.snowflakecomputing.com
+}
+
+// snowflakeWriter appends rows through the Snowpipe Streaming REST API and creates tables through
+// the SQL API, both authenticated with a key pair JWT
+type snowflakeWriter struct {
+	cfg      SnowflakeConfig
+	columns  []WarehouseColumn
+	create   bool
+	baseURL  string
+	database string
+	schema   string
+	table    string
+	pipe     string
+	key      *rsa.PrivateKey
+	issuer   string
+	subject  string
+	client   *http.Client
+
+	jwt          string
+	jwtExpires   time.Time
+	ingestHost   string
+	scoped       string // token scoped to the ingest host
+	scopedExpiry time.Time
+	continuation string // empty until the channel is opened
+	offset       uint64
+}
+
+func newSnowflakeWriter(cfg WarehouseConfig) (*snowflakeWriter, error) {
+	key, err := parseRSAPrivateKey(cfg.Snowflake.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snowflake private_key: %w", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snowflake private_key: %w", err)
+	}
+	fingerprint := sha256.Sum256(pub)
+
+	// The JWT names the account without region or cloud of a legacy locator
+	account := strings.ToUpper(strings.SplitN(cfg.Snowflake.Account, ".", 2)[0])
+	user := strings.ToUpper(cfg.Snowflake.User)
+
+	parts := strings.Split(strings.ToUpper(cfg.Table), ".")
+	w := &snowflakeWriter{
+		cfg:      cfg.Snowflake,
+		columns:  cfg.Columns,
+		create:   cfg.CreateTable,
+		baseURL:  strings.TrimRight(cfg.Snowflake.URL, "/"),
+		database: parts[0],
+		schema:   parts[1],
+		table:    parts[2],
+		pipe:     cfg.Snowflake.Pipe,
+		key:      key,
+		issuer:   account + "." + user + ".SHA256:" + base64.StdEncoding.EncodeToString(fingerprint[:]),
+		subject:  account + "." + user,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+	if w.baseURL == "" {
+		w.baseURL = "https://" + strings.ToLower(cfg.Snowflake.Account) + ".snowflakecomputing.com"
+	}
+	if w.pipe == "" {
+		w.pipe = w.table + "-STREAMING"
+	}
+	if w.cfg.Channel == "" {
+		w.cfg.Channel = "agentsmith_hub"
+	}
+	return w, nil
+}
+
+// parseRSAPrivateKey reads an unencrypted PKCS#8 or PKCS#1 PEM key
+func parseRSAPrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not RSA")
+	}
+	return key, nil
+}
+
+// keyPairJWT returns the JWT authenticating the user, renewed well before its one hour lifetime ends
+func (w *snowflakeWriter) keyPairJWT() (string, error) {
+	now := time.Now()
+	if w.jwt != "" && now.Before(w.jwtExpires.Add(-10*time.Minute)) {
+		return w.jwt, nil
+	}
+	expires := now.Add(time.Hour)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": w.issuer,
+		"sub": w.subject,
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	})
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, w.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign snowflake jwt: %w", err)
+	}
+	w.jwt = signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	w.jwtExpires = expires
+	return w.jwt, nil
+}
+
+// do sends a request and returns the response body, error statuses become a warehouseHTTPError
+func (w *snowflakeWriter) do(ctx context.Context, method, endpoint, contentType string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", "AgentSmith-HUB")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &warehouseHTTPError{status: resp.StatusCode, body: truncateRunes(strings.TrimSpace(string(data)), 512)}
+	}
+	return data, nil
+}
+
+// jwtHeader authenticates a request to the account with the key pair JWT
+func (w *snowflakeWriter) jwtHeader() (http.Header, error) {
+	jwt, err := w.keyPairJWT()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{
+		"Authorization":                        {"Bearer " + jwt},
+		"X-Snowflake-Authorization-Token-Type": {"KEYPAIR_JWT"},
+		"Accept":                               {"application/json"},
+	}, nil
+}
+
+// ensureIngest discovers the ingest host of the account and exchanges the JWT for a token scoped to it
+func (w *snowflakeWriter) ensureIngest(ctx context.Context) error {
+	if w.ingestHost != "" && time.Now().Before(w.scopedExpiry) {
+		return nil
+	}
+	header, err := w.jwtHeader()
+	if err != nil {
+		return err
+	}
+	if w.ingestHost == "" {
+		data, err := w.do(ctx, http.MethodGet, w.baseURL+"/v2/streaming/hostname", "", nil, header)
+		if err != nil {
+			return fmt.Errorf("failed to discover snowflake ingest host: %w", err)
+		}
+		w.ingestHost = strings.Trim(strings.TrimSpace(string(data)), `"`)
+		if w.ingestHost == "" {
+			return fmt.Errorf("snowflake returned an empty ingest host")
+		}
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("scope", w.ingestHost)
+	data, err := w.do(ctx, http.MethodPost, w.baseURL+"/oauth/token", "application/x-www-form-urlencoded", []byte(form.Encode()), header)
+	if err != nil {
+		return fmt.Errorf("failed to obtain snowflake scoped token: %w", err)
+	}
+	w.scoped = strings.TrimSpace(string(data))
+	w.scopedExpiry = time.Now().Add(45 * time.Minute)
+	return nil
+}
+
+func (w *snowflakeWriter) ingestHeader() http.Header {
+	return http.Header{
+		"Authorization":                        {"Bearer " + w.scoped},
+		"X-Snowflake-Authorization-Token-Type": {"OAUTH"},
+		"Accept":                               {"application/json"},
+	}
+}
+
+func (w *snowflakeWriter) channelPath() string {
+	return "/databases/" + url.PathEscape(w.database) + "/schemas/" + url.PathEscape(w.schema) +
+		"/pipes/" + url.PathEscape(w.pipe) + "/channels/" + url.PathEscape(w.cfg.Channel)
+}
+
+// openChannel opens the streaming channel of this writer, which invalidates older continuation tokens
+func (w *snowflakeWriter) openChannel(ctx context.Context) error {
+	data, err := w.do(ctx, http.MethodPut, "https://"+w.ingestHost+"/v2/streaming"+w.channelPath(), "application/json", []byte("{}"), w.ingestHeader())
+	if err != nil {
+		return fmt.Errorf("failed to open snowflake channel %s on pipe %s: %w", w.cfg.Channel, w.pipe, err)
+	}
+	var resp struct {
+		NextContinuationToken string `json:"next_continuation_token"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || resp.NextContinuationToken == "" {
+		return fmt.Errorf("unexpected snowflake open channel response: %s", truncateRunes(string(data), 512))
+	}
+	w.continuation = resp.NextContinuationToken
+	return nil
+}
+
+func (w *snowflakeWriter) write(ctx context.Context, rows []map[string]interface{}, _ []string) (int, error) {
+	if err := w.ensureIngest(ctx); err != nil {
+		return 0, err
+	}
+	if w.continuation == "" {
+		if err := w.openChannel(ctx); err != nil {
+			w.dropTokensOn(err)
+			return 0, err
+		}
+	}
+
+	var body bytes.Buffer
+	for _, row := range rows {
+		data, err := sonic.Marshal(row)
+		if err != nil {
+			return 0, &warehouseHTTPError{status: http.StatusBadRequest, body: "failed to encode row: " + err.Error()}
+		}
+		body.Write(data)
+		body.WriteByte('\n')
+	}
+
+	w.offset++
+	query := url.Values{}
+	query.Set("continuationToken", w.continuation)
+	query.Set("offsetToken", strconv.FormatUint(w.offset, 10))
+	endpoint := "https://" + w.ingestHost + "/v2/streaming/data" + w.channelPath() + "/rows?" + query.Encode()
+	data, err := w.do(ctx, http.MethodPost, endpoint, "application/x-ndjson", body.Bytes(), w.ingestHeader())
+	if err != nil {
+		// The channel is opened again before the next attempt
+		w.continuation = ""
+		w.dropTokensOn(err)
+		return 0, err
+	}
+	var resp struct {
+		NextContinuationToken string `json:"next_continuation_token"`
+	}
+	if err := json.Unmarshal(data, &resp); err == nil && resp.NextContinuationToken != "" {
+		w.continuation = resp.NextContinuationToken
+	} else {
+		w.continuation = ""
+	}
+	// Rows failing the table schema are reported asynchronously in the channel status
+	return 0, nil
+}
+
+// dropTokensOn forgets the scoped token when the ingest host refused it
+func (w *snowflakeWriter) dropTokensOn(err error) {
+	var httpErr *warehouseHTTPError
+	if errors.As(err, &httpErr) && httpErr.status == http.StatusUnauthorized {
+		w.scopedExpiry = time.Time{}
+	}
+}
+
+// statement runs a SQL statement through the SQL API
+func (w *snowflakeWriter) statement(ctx context.Context, sql string) error {
+	header, err := w.jwtHeader()
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"statement": sql,
+		"timeout":   60,
+		"database":  w.database,
+		"schema":    w.schema,
+	}
+	if w.cfg.Warehouse != "" {
+		req["warehouse"] = w.cfg.Warehouse
+	}
+	if w.cfg.Role != "" {
+		req["role"] = w.cfg.Role
+	}
+	body, _ := json.Marshal(req)
+	if _, err := w.do(ctx, http.MethodPost, w.baseURL+"/api/v2/statements", "application/json", body, header); err != nil {
+		return fmt.Errorf("snowflake statement failed: %w", err)
+	}
+	return nil
+}
+
+// createTable creates the table, its default streaming pipe matches the row fields to the columns by name
+func (w *snowflakeWriter) createTable(ctx context.Context) error {
+	cols := make([]string, len(w.columns))
+	for i, col := range w.columns {
+		cols[i] = strings.ToUpper(col.Name) + " " + warehouseColumnTypes[warehouseColumnType(col)][0]
+	}
+	return w.statement(ctx, "CREATE TABLE IF NOT EXISTS "+w.database+"."+w.schema+"."+w.table+" ("+strings.Join(cols, ", ")+")")
+}
+
+func (w *snowflakeWriter) check(ctx context.Context) error {
+	if err := w.ensureIngest(ctx); err != nil {
+		return err
+	}
+	if w.create {
+		// The table may only be created on the first write, check the access to the SQL API instead
+		return w.statement(ctx, "SELECT 1")
+	}
+	return w.openChannel(ctx)
+}
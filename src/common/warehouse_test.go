@@ -0,0 +1,549 @@
+package common
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testRSAKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// startWarehouseProducer starts a producer whose batches are only flushed by size or on close
+func startWarehouseProducer(t *testing.T, cfg WarehouseConfig) (*WarehouseProducer, chan map[string]interface{}) {
+	t.Helper()
+	cfg.BatchSize = 2
+	cfg.FlushDur = time.Hour
+	cfg.MaxRetries = 2
+	cfg.RetryDelay = time.Millisecond
+	msgChan := make(chan map[string]interface{}, 16)
+	p, err := NewWarehouseProducer(cfg, msgChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Receipts = NewDeliveryReceipts()
+	return p, msgChan
+}
+
+func closeWarehouseProducer(p *WarehouseProducer, msgChan chan map[string]interface{}, events ...map[string]interface{}) {
+	for _, e := range events {
+		msgChan <- e
+	}
+	close(msgChan)
+	p.Close()
+}
+
+// fakeBigQuery serves the token endpoint and the tables and insertAll calls of one dataset
+type fakeBigQuery struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	tables  []map[string]interface{}
+	inserts [][]map[string]interface{} // rows of each insertAll request
+	// insertReply answers the nth insertAll request, nil means success
+	insertReply func(n int, w http.ResponseWriter)
+	tableStatus int
+}
+
+func newFakeBigQuery(t *testing.T) *fakeBigQuery {
+	f := &fakeBigQuery{tableStatus: http.StatusOK}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("assertion") == "" {
+				http.Error(w, `{"error_description":"no assertion"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"bq-token","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer bq-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		if r.Body != nil {
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &body)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/bigquery/v2/projects/proj/datasets/soc/tables":
+			f.tables = append(f.tables, body)
+			w.WriteHeader(f.tableStatus)
+		case r.Method == http.MethodPost && r.URL.Path == "/bigquery/v2/projects/proj/datasets/soc/tables/alerts/insertAll":
+			var rows []map[string]interface{}
+			for _, row := range body["rows"].([]interface{}) {
+				rows = append(rows, row.(map[string]interface{}))
+			}
+			f.inserts = append(f.inserts, rows)
+			if f.insertReply != nil {
+				f.insertReply(len(f.inserts)-1, w)
+				return
+			}
+			w.Write([]byte(`{}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/bigquery/v2/projects/proj/datasets/soc":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBigQuery) config(t *testing.T) WarehouseConfig {
+	_, keyPEM := testRSAKey(t)
+	creds, _ := json.Marshal(map[string]string{
+		"client_email": "hub@proj.iam.gserviceaccount.com",
+		"private_key":  keyPEM,
+		"token_uri":    f.URL + "/token",
+		"project_id":   "proj",
+	})
+	return WarehouseConfig{
+		Provider: WarehouseBigQuery,
+		Table:    "soc.alerts",
+		Columns: []WarehouseColumn{
+			{Name: "rule_id"},
+			{Name: "count", Field: "data.count", Type: "int"},
+			{Name: "ts", Field: "timestamp", Type: "timestamp"},
+			{Name: "event", Field: "*"},
+		},
+		BigQuery: BigQueryConfig{CredentialsJSON: string(creds), Endpoint: f.URL},
+	}
+}
+
+func TestBigQueryProducer(t *testing.T) {
+	bq := newFakeBigQuery(t)
+	bq.insertReply = func(n int, w http.ResponseWriter) {
+		if n == 1 {
+			w.Write([]byte(`{"insertErrors":[{"index":0,"errors":[{"reason":"invalid","message":"no such field"}]}]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}
+	cfg := bq.config(t)
+	cfg.CreateTable = true
+	cfg.BigQuery.PartitionField = "ts"
+	p, msgChan := startWarehouseProducer(t, cfg)
+	closeWarehouseProducer(p, msgChan,
+		map[string]interface{}{"rule_id": "r1", "data": map[string]interface{}{"count": "7"}, "timestamp": float64(1700000000000)},
+		map[string]interface{}{"rule_id": "r2", "data": map[string]interface{}{"count": 1.5}},
+		map[string]interface{}{"rule_id": "r3"},
+	)
+
+	if len(bq.tables) != 1 {
+		t.Fatalf("%d create table requests, want 1", len(bq.tables))
+	}
+	schema, _ := json.Marshal(bq.tables[0]["schema"])
+	if want := `{"fields":[{"mode":"NULLABLE","name":"rule_id","type":"STRING"},{"mode":"NULLABLE","name":"count","type":"INT64"},{"mode":"NULLABLE","name":"ts","type":"TIMESTAMP"},{"mode":"NULLABLE","name":"event","type":"JSON"}]}`; string(schema) != want {
+		t.Errorf("schema = %s, want %s", schema, want)
+	}
+	if partition := bq.tables[0]["timePartitioning"]; !reflect.DeepEqual(partition, map[string]interface{}{"type": "DAY", "field": "ts"}) {
+		t.Errorf("timePartitioning = %v", partition)
+	}
+
+	if len(bq.inserts) != 2 || len(bq.inserts[0]) != 2 || len(bq.inserts[1]) != 1 {
+		t.Fatalf("insertAll batches = %v", bq.inserts)
+	}
+	first := bq.inserts[0][0]["json"].(map[string]interface{})
+	if first["count"] != float64(7) || first["ts"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("converted row = %v", first)
+	}
+	if event, ok := first["event"].(string); !ok || !strings.Contains(event, `"rule_id":"r1"`) {
+		t.Errorf("json column = %#v, want the encoded event", first["event"])
+	}
+	if second := bq.inserts[0][1]["json"].(map[string]interface{}); second["count"] != nil {
+		t.Errorf("a fraction in an int column = %v, want null", second["count"])
+	}
+	// Every row is deduplicated on its own insert id
+	if id := bq.inserts[0][0]["insertId"]; id == "" || id == bq.inserts[0][1]["insertId"] || id == bq.inserts[1][0]["insertId"] {
+		t.Errorf("insert ids are not unique per row: %v", bq.inserts)
+	}
+
+	// The refused row is not sent again
+	if p.GetRowsWritten() != 2 || p.GetRowsRejected() != 1 || p.GetFailedBatches() != 0 {
+		t.Errorf("written = %d, rejected = %d, failed batches = %d", p.GetRowsWritten(), p.GetRowsRejected(), p.GetFailedBatches())
+	}
+	if counts := p.Receipts.Snapshot(); counts.Acked != 2 || counts.Failed != 1 {
+		t.Errorf("receipts = %+v", counts)
+	}
+}
+
+func TestBigQueryRetriesKeepInsertIDs(t *testing.T) {
+	bq := newFakeBigQuery(t)
+	bq.insertReply = func(n int, w http.ResponseWriter) {
+		switch n {
+		case 0:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 1:
+			w.Write([]byte(`{"insertErrors":[{"index":0,"errors":[{"reason":"backendError"}]}]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}
+	cfg := bq.config(t)
+	cfg.CreateTable = true
+	bq.tableStatus = http.StatusConflict
+	p, msgChan := startWarehouseProducer(t, cfg)
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"})
+
+	if len(bq.inserts) != 3 {
+		t.Fatalf("%d insertAll requests, want 3", len(bq.inserts))
+	}
+	id := bq.inserts[0][0]["insertId"]
+	if s, _ := id.(string); s == "" {
+		t.Fatalf("row without insertId: %v", bq.inserts[0][0])
+	}
+	for i, rows := range bq.inserts {
+		if rows[0]["insertId"] != id {
+			t.Errorf("attempt %d insertId = %v, want %v", i, rows[0]["insertId"], id)
+		}
+	}
+	// An existing table is not an error and is not created again
+	if len(bq.tables) != 1 || p.GetRowsWritten() != 1 || p.GetFailedBatches() != 0 {
+		t.Errorf("tables = %d, written = %d, failed batches = %d", len(bq.tables), p.GetRowsWritten(), p.GetFailedBatches())
+	}
+}
+
+func TestBigQueryErrors(t *testing.T) {
+	bq := newFakeBigQuery(t)
+	bq.insertReply = func(n int, w http.ResponseWriter) {
+		http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+	}
+	p, msgChan := startWarehouseProducer(t, bq.config(t))
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"}, map[string]interface{}{"rule_id": "r2"})
+	// A rejected request is final
+	if len(bq.inserts) != 1 || p.GetFailedBatches() != 1 || p.GetRowsRejected() != 2 || p.Receipts.Snapshot().Failed != 2 {
+		t.Errorf("requests = %d, failed batches = %d, rejected = %d", len(bq.inserts), p.GetFailedBatches(), p.GetRowsRejected())
+	}
+
+	bq = newFakeBigQuery(t)
+	cfg := bq.config(t)
+	cfg.CreateTable = true
+	bq.tableStatus = http.StatusForbidden
+	p, msgChan = startWarehouseProducer(t, cfg)
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"})
+	if len(bq.inserts) != 0 || p.GetFailedBatches() != 1 {
+		t.Errorf("rows inserted without a table: requests = %d, failed batches = %d", len(bq.inserts), p.GetFailedBatches())
+	}
+
+	// The table is missing but will be created in an existing dataset
+	if err := TestWarehouseConnection(cfg); err != nil {
+		t.Errorf("connection check: %v", err)
+	}
+	cfg.CreateTable = false
+	if err := TestWarehouseConnection(cfg); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("connection check of a missing table: err = %v", err)
+	}
+}
+
+// fakeSnowflake serves the account, OAuth, SQL API and Snowpipe Streaming endpoints over TLS
+type fakeSnowflake struct {
+	*httptest.Server
+	key *rsa.PublicKey
+
+	mu         sync.Mutex
+	statements []string
+	opened     int
+	tokens     int
+	batches    []string // ndjson bodies accepted by the rows endpoint
+	offsets    []string
+	// rowsStatus answers the nth rows request, 0 means success
+	rowsStatus   func(n int) int
+	rows         int
+	continuation string
+	issued       int
+}
+
+func newFakeSnowflake(t *testing.T, key *rsa.PublicKey) *fakeSnowflake {
+	f := &fakeSnowflake{key: key}
+	const channel = "/databases/DB/schemas/SOC/pipes/ALERTS-STREAMING/channels/agentsmith_hub"
+	f.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/v2/streaming/hostname", "/oauth/token", "/api/v2/statements":
+			if !f.validJWT(r) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		default:
+			if r.Header.Get("Authorization") != "Bearer scoped-token" || r.Header.Get("X-Snowflake-Authorization-Token-Type") != "OAUTH" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		switch r.URL.Path {
+		case "/v2/streaming/hostname":
+			w.Write([]byte(strings.TrimPrefix(f.URL, "https://")))
+		case "/oauth/token":
+			f.tokens++
+			w.Write([]byte("scoped-token"))
+		case "/api/v2/statements":
+			var req struct {
+				Statement string `json:"statement"`
+			}
+			_ = json.Unmarshal(body, &req)
+			f.statements = append(f.statements, req.Statement)
+			w.Write([]byte(`{}`))
+		case "/v2/streaming" + channel:
+			f.opened++
+			w.Write([]byte(`{"next_continuation_token":"` + f.nextContinuation() + `"}`))
+		case "/v2/streaming/data" + channel + "/rows":
+			f.rows++
+			if f.rowsStatus != nil {
+				if status := f.rowsStatus(f.rows - 1); status != 0 {
+					w.WriteHeader(status)
+					return
+				}
+			}
+			if token := r.URL.Query().Get("continuationToken"); token != f.continuation {
+				http.Error(w, "stale continuation token "+token, http.StatusBadRequest)
+				return
+			}
+			f.batches = append(f.batches, string(body))
+			f.offsets = append(f.offsets, r.URL.Query().Get("offsetToken"))
+			w.Write([]byte(`{"next_continuation_token":"` + f.nextContinuation() + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// nextContinuation issues a token, only the latest one is accepted
+func (f *fakeSnowflake) nextContinuation() string {
+	f.issued++
+	f.continuation = "c" + strconv.Itoa(f.issued)
+	return f.continuation
+}
+
+// validJWT verifies the key pair JWT of a request
+func (f *fakeSnowflake) validJWT(r *http.Request) bool {
+	if r.Header.Get("X-Snowflake-Authorization-Token-Type") != "KEYPAIR_JWT" {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(f.key, crypto.SHA256, digest[:], sig) != nil {
+		return false
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var c struct {
+		Iss string `json:"iss"`
+		Sub string `json:"sub"`
+	}
+	return json.Unmarshal(claims, &c) == nil && c.Sub == "MYORG-ACCT.HUB" && strings.HasPrefix(c.Iss, "MYORG-ACCT.HUB.SHA256:")
+}
+
+func startSnowflakeProducer(t *testing.T, cfg func(*WarehouseConfig)) (*fakeSnowflake, *WarehouseProducer, chan map[string]interface{}) {
+	t.Helper()
+	key, keyPEM := testRSAKey(t)
+	sf := newFakeSnowflake(t, &key.PublicKey)
+	c := WarehouseConfig{
+		Provider: WarehouseSnowflake,
+		Table:    "db.soc.alerts",
+		Columns:  []WarehouseColumn{{Name: "rule_id"}, {Name: "score", Type: "float"}, {Name: "event", Field: "*"}},
+		Snowflake: SnowflakeConfig{
+			Account:    "myorg-acct",
+			User:       "hub",
+			PrivateKey: keyPEM,
+			URL:        sf.URL,
+		},
+	}
+	if cfg != nil {
+		cfg(&c)
+	}
+	p, msgChan := startWarehouseProducer(t, c)
+	// Trust the test certificate, the writer is not used before the first batch
+	p.writer.(*snowflakeWriter).client = sf.Client()
+	return sf, p, msgChan
+}
+
+func TestSnowflakeProducer(t *testing.T) {
+	sf, p, msgChan := startSnowflakeProducer(t, func(c *WarehouseConfig) {
+		c.CreateTable = true
+		c.Snowflake.Warehouse = "LOAD_WH"
+	})
+	closeWarehouseProducer(p, msgChan,
+		map[string]interface{}{"rule_id": "r1", "score": "0.5"},
+		map[string]interface{}{"rule_id": "r2", "score": 2.0},
+		map[string]interface{}{"rule_id": "r3"},
+	)
+
+	if want := []string{"CREATE TABLE IF NOT EXISTS DB.SOC.ALERTS (RULE_ID VARCHAR, SCORE FLOAT, EVENT VARIANT)"}; !reflect.DeepEqual(sf.statements, want) {
+		t.Errorf("statements = %q, want %q", sf.statements, want)
+	}
+	// One channel and one scoped token serve every batch, each batch continues the previous one
+	if sf.opened != 1 || sf.tokens != 1 {
+		t.Errorf("channel opened %d times, %d scoped tokens", sf.opened, sf.tokens)
+	}
+	if !reflect.DeepEqual(sf.offsets, []string{"1", "2"}) {
+		t.Errorf("offset tokens = %v", sf.offsets)
+	}
+	if len(sf.batches) != 2 {
+		t.Fatalf("%d batches, want 2", len(sf.batches))
+	}
+	lines := strings.Split(strings.TrimSpace(sf.batches[0]), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("first batch = %q", sf.batches[0])
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatal(err)
+	}
+	// json columns stay objects in the VARIANT column
+	if row["score"] != 0.5 || !reflect.DeepEqual(row["event"], map[string]interface{}{"rule_id": "r1", "score": "0.5"}) {
+		t.Errorf("row = %v", row)
+	}
+	if p.GetRowsWritten() != 3 || p.Receipts.Snapshot().Acked != 3 {
+		t.Errorf("written = %d", p.GetRowsWritten())
+	}
+}
+
+func TestSnowflakeReopensChannel(t *testing.T) {
+	sf, p, msgChan := startSnowflakeProducer(t, nil)
+	// The scoped token expires on the first attempt and the server fails the second
+	sf.rowsStatus = func(n int) int {
+		switch n {
+		case 0:
+			return http.StatusUnauthorized
+		case 1:
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"})
+
+	if len(sf.batches) != 1 || p.GetRowsWritten() != 1 || p.GetFailedBatches() != 0 {
+		t.Fatalf("batches = %d, written = %d, failed batches = %d", len(sf.batches), p.GetRowsWritten(), p.GetFailedBatches())
+	}
+	// A failed append reopens the channel, a refused token is exchanged again
+	if sf.opened != 3 || sf.tokens != 2 {
+		t.Errorf("channel opened %d times, %d scoped tokens", sf.opened, sf.tokens)
+	}
+	if len(sf.statements) != 0 {
+		t.Errorf("statements without create_table: %q", sf.statements)
+	}
+}
+
+func TestSnowflakeRejectedBatch(t *testing.T) {
+	sf, p, msgChan := startSnowflakeProducer(t, nil)
+	sf.rowsStatus = func(int) int { return http.StatusBadRequest }
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"})
+	if sf.rows != 1 || p.GetFailedBatches() != 1 || p.Receipts.Snapshot().Failed != 1 {
+		t.Errorf("rows requests = %d, failed batches = %d", sf.rows, p.GetFailedBatches())
+	}
+
+	// A wrong key is refused by the account
+	_, otherPEM := testRSAKey(t)
+	sf, p, msgChan = startSnowflakeProducer(t, func(c *WarehouseConfig) { c.MaxRetries = 1 })
+	p.writer.(*snowflakeWriter).key, _ = parseRSAPrivateKey(otherPEM)
+	closeWarehouseProducer(p, msgChan, map[string]interface{}{"rule_id": "r1"})
+	if sf.tokens != 0 || p.GetFailedBatches() != 1 {
+		t.Errorf("scoped tokens = %d, failed batches = %d", sf.tokens, p.GetFailedBatches())
+	}
+}
+
+func TestWarehouseConfigValidate(t *testing.T) {
+	valid := WarehouseConfig{
+		Provider:  WarehouseSnowflake,
+		Table:     "db.soc.alerts",
+		Columns:   []WarehouseColumn{{Name: "rule_id"}},
+		Snowflake: SnowflakeConfig{Account: "a", User: "u", PrivateKey: "k"},
+		BigQuery:  BigQueryConfig{CredentialsJSON: "{}"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, change := range map[string]func(*WarehouseConfig){
+		"provider":          func(c *WarehouseConfig) { c.Provider = "redshift" },
+		"snowflake table":   func(c *WarehouseConfig) { c.Table = "soc.alerts" },
+		"snowflake key":     func(c *WarehouseConfig) { c.Snowflake.PrivateKey = "" },
+		"bigquery table":    func(c *WarehouseConfig) { c.Provider, c.Table = WarehouseBigQuery, "alerts" },
+		"bigquery creds":    func(c *WarehouseConfig) { c.Provider, c.BigQuery.CredentialsJSON = WarehouseBigQuery, "" },
+		"table name":        func(c *WarehouseConfig) { c.Table = "db.soc.alerts;drop" },
+		"create no columns": func(c *WarehouseConfig) { c.CreateTable, c.Columns = true, nil },
+		"column name":       func(c *WarehouseConfig) { c.Columns = []WarehouseColumn{{Name: "a$b"}} },
+		"duplicate column":  func(c *WarehouseConfig) { c.Columns = []WarehouseColumn{{Name: "a"}, {Name: "A"}} },
+		"column type":       func(c *WarehouseConfig) { c.Columns = []WarehouseColumn{{Name: "a", Type: "decimal"}} },
+		"partition field": func(c *WarehouseConfig) {
+			c.Provider, c.Table, c.BigQuery.PartitionField = WarehouseBigQuery, "soc.alerts", "ts"
+		},
+	} {
+		cfg := valid
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: invalid config accepted", name)
+		}
+	}
+
+	cfg := valid
+	cfg.Provider, cfg.Table = WarehouseBigQuery, "my-project.soc.alerts"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("project id with dashes: %v", err)
+	}
+}
+
+func TestWarehouseValue(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		in   interface{}
+		want interface{}
+	}{
+		{"int", float64(3), int64(3)},
+		{"int", "42", int64(42)},
+		{"int", 1.5, nil},
+		{"float", "2.5", 2.5},
+		{"float", "NaN", nil},
+		{"bool", "true", true},
+		{"bool", "maybe", nil},
+		{"timestamp", float64(1700000000), "2023-11-14T22:13:20Z"},
+		{"timestamp", "1700000000500", "2023-11-14T22:13:20.5Z"},
+		{"timestamp", "2023-11-14T23:13:20+01:00", "2023-11-14T22:13:20Z"},
+		{"timestamp", "14/11/2023", "14/11/2023"},
+		{"json", map[string]interface{}{"a": 1}, `{"a":1}`},
+		{"string", 12, "12"},
+		{"string", nil, nil},
+	} {
+		if got := warehouseValue(tc.typ, tc.in, true); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("warehouseValue(%s, %#v) = %#v, want %#v", tc.typ, tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultWebhookSignatureHeader = "X-Hub-Signature-256"
+	defaultWebhookSignaturePrefix = "sha256="
+	defaultWebhookRetryBackoff    = time.Second
+	maxWebhookRetryBackoff        = time.Minute
+	// WebhookRetryNetworkError is the retry policy status matching requests that got no response
+	WebhookRetryNetworkError = "network"
+)
+
+// WebhookRetryPolicy controls the retries of responses with a status, e.g. "429", "5xx" or "network"
+type WebhookRetryPolicy struct {
+	Status  string
+	Retries int
+	Backoff time.Duration // doubled after every attempt, default 1s
+}
+
+// WebhookSigningConfig signs request bodies with HMAC-SHA256
+type WebhookSigningConfig struct {
+	Secret string `yaml:"secret"`
+	Header string `yaml:"header,omitempty"` // default X-Hub-Signature-256
+	Prefix string `yaml:"prefix,omitempty"` // default "sha256="
+	// TimestampHeader, when set, carries the unix time of the request, which is then signed as "<timestamp>.<body>"
+	TimestampHeader string `yaml:"timestamp_header,omitempty"`
+}
+
+// WebhookConfig holds the settings of a webhook producer
+type WebhookConfig struct {
+	URL           string
+	Method        string            // default POST
+	Headers       map[string]string // static headers
+	BodyTemplate  string            // Go template over the event, default the event serialized by Encoding
+	ContentType   string            // default the media type of Encoding, application/json
+	Signing       *WebhookSigningConfig
+	RetryCount    int // retries of 429, 5xx and network errors without a matching policy
+	RetryPolicies []WebhookRetryPolicy
+	Proxy         string // proxy URL, overrides the proxy of HTTP
+	Timeout       time.Duration
+	HTTP          *OutputHTTPConfig // TLS and proxy of the client
+	Encoding      *EncodingConfig   // serialization and compression of the body, default uncompressed JSON
+}
+
+// WebhookProducer sends each event as one HTTP request
+type WebhookProducer struct {
+	MsgChan  chan map[string]interface{}
+	Receipts *DeliveryReceipts // optional, records acked/failed deliveries
+	Breaker  *OutputBreaker    // optional, fails events without sending while the endpoint is down
+
+	cfg     WebhookConfig
+	client  *http.Client
+	body    *template.Template
+	encoder *EventEncoder
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	sent    uint64
+	retried uint64
+	failed  uint64
+}
+
+// NewWebhookHTTPClient returns the HTTP client of a webhook, honoring its TLS and proxy settings
+func NewWebhookHTTPClient(cfg WebhookConfig) (*http.Client, error) {
+	httpCfg := cfg.HTTP
+	if cfg.Proxy != "" {
+		httpCfg = MergeOutputHTTPConfig(httpCfg, &OutputHTTPConfig{Proxy: cfg.Proxy})
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return NewOutputHTTPClient(httpCfg, timeout)
+}
+
+// ParseWebhookRetryStatus validates the status of a retry policy: an exact code, a class like "5xx" or "network"
+func ParseWebhookRetryStatus(status string) error {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == WebhookRetryNetworkError {
+		return nil
+	}
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		return nil
+	}
+	if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+		return nil
+	}
+	return fmt.Errorf("invalid retry status %q, expected a code like 503, a class like 5xx or %s", status, WebhookRetryNetworkError)
+}
+
+// NewWebhookProducer starts sending the events read from msgChan
+func NewWebhookProducer(cfg WebhookConfig, msgChan chan map[string]interface{}) (*WebhookProducer, error) {
+	p, err := newWebhookProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewWebhookHTTPClient(p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.client = client
+	p.MsgChan = msgChan
+	p.stopChan = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+	return p, nil
+}
+
+// newWebhookProducer applies the defaults of the config and returns a producer without client,
+// only able to render requests
+func newWebhookProducer(cfg WebhookConfig) (*WebhookProducer, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	encoder, err := NewEventEncoder(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BodyTemplate != "" && encoder.Serialization() != SerializationJSON {
+		return nil, fmt.Errorf("webhook body template cannot be combined with serialization %s", encoder.Serialization())
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = encoder.ContentType()
+	}
+	if cfg.RetryCount < 0 {
+		cfg.RetryCount = 0
+	}
+	cfg.RetryPolicies = append([]WebhookRetryPolicy(nil), cfg.RetryPolicies...)
+	for i := range cfg.RetryPolicies {
+		if err := ParseWebhookRetryStatus(cfg.RetryPolicies[i].Status); err != nil {
+			return nil, err
+		}
+		cfg.RetryPolicies[i].Status = strings.ToLower(strings.TrimSpace(cfg.RetryPolicies[i].Status))
+	}
+	if cfg.Signing != nil {
+		// Copy so the defaults are not written back to the caller's config
+		signing := *cfg.Signing
+		cfg.Signing = &signing
+		if cfg.Signing.Secret == "" {
+			return nil, fmt.Errorf("webhook signing secret is required")
+		}
+		if cfg.Signing.Header == "" {
+			cfg.Signing.Header = defaultWebhookSignatureHeader
+		}
+		if cfg.Signing.Prefix == "" {
+			cfg.Signing.Prefix = defaultWebhookSignaturePrefix
+		}
+	}
+
+	var body *template.Template
+	if cfg.BodyTemplate != "" {
+		if body, err = ParseEventTemplate("body", cfg.BodyTemplate); err != nil {
+			return nil, fmt.Errorf("invalid body template: %w", err)
+		}
+	}
+
+	return &WebhookProducer{
+		cfg:     cfg,
+		body:    body,
+		encoder: encoder,
+	}, nil
+}
+
+// CaptureWebhookRequest renders the request a producer with this config would send for msg,
+// signature included, without sending it
+func CaptureWebhookRequest(cfg WebhookConfig, msg map[string]interface{}) (*CapturedPayload, error) {
+	p, err := newWebhookProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.render(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := p.request(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCapturedPayload(p.cfg.URL, body)
+	c.Method = req.Method
+	c.ContentType = req.Header.Get("Content-Type")
+	c.ContentEncoding = req.Header.Get("Content-Encoding")
+	c.Headers = make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		c.Headers[name] = req.Header.Get(name)
+	}
+	return c, nil
+}
+
+func (p *WebhookProducer) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case msg, ok := <-p.MsgChan:
+			if !ok {
+				return
+			}
+			p.handle(msg)
+		}
+	}
+}
+
+func (p *WebhookProducer) handle(msg map[string]interface{}) {
+	body, err := p.render(msg)
+	if err != nil {
+		logger.Error("Failed to render webhook body", "url", p.cfg.URL, "error", err)
+		atomic.AddUint64(&p.failed, 1)
+		p.Receipts.AddFailed(1)
+		return
+	}
+
+	attempt := 0
+	for {
+		if !p.Breaker.Allow() {
+			atomic.AddUint64(&p.failed, 1)
+			p.Receipts.AddFailed(1)
+			return
+		}
+		status, retryAfter, err := p.send(body)
+		if err == nil {
+			atomic.AddUint64(&p.sent, 1)
+			p.Receipts.AddAcked(1)
+			p.Breaker.Success()
+			return
+		}
+		// Other client errors are caused by the event, not by the endpoint
+		if status == 0 || status == http.StatusTooManyRequests || status >= 500 {
+			p.Breaker.Failure(err)
+		} else {
+			p.Breaker.Success()
+		}
+
+		policy := p.retryPolicy(status)
+		if attempt >= policy.Retries {
+			logger.Error("Failed to send webhook", "url", p.cfg.URL, "status", status, "attempts", attempt+1, "error", err)
+			atomic.AddUint64(&p.failed, 1)
+			p.Receipts.AddFailed(1)
+			return
+		}
+
+		delay := retryAfter
+		if delay <= 0 {
+			delay = policy.Backoff << min(attempt, 6)
+		}
+		delay = min(delay, maxWebhookRetryBackoff)
+		attempt++
+		atomic.AddUint64(&p.retried, 1)
+		logger.Debug("Retrying webhook", "url", p.cfg.URL, "status", status, "attempt", attempt, "delay", delay)
+
+		select {
+		case <-p.stopChan:
+			atomic.AddUint64(&p.failed, 1)
+			p.Receipts.AddFailed(1)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// render returns the request body: the body template or the serialized event, compressed
+// when the encoding asks for it
+func (p *WebhookProducer) render(msg map[string]interface{}) ([]byte, error) {
+	if p.body == nil {
+		return p.encoder.Encode(msg)
+	}
+	body, err := ExecuteEventTemplate(p.body, msg)
+	if err != nil {
+		return nil, err
+	}
+	return p.encoder.Compress([]byte(body))
+}
+
+// retryPolicy returns the policy of a response status, 0 meaning no response was received.
+// Exact codes take precedence over classes. Without a policy 429, 5xx and network errors
+// are retried RetryCount times and everything else is not retried.
+func (p *WebhookProducer) retryPolicy(status int) WebhookRetryPolicy {
+	exact, class := WebhookRetryNetworkError, WebhookRetryNetworkError
+	if status > 0 {
+		exact = strconv.Itoa(status)
+		class = exact[:1] + "xx"
+	}
+
+	var classPolicy *WebhookRetryPolicy
+	for i := range p.cfg.RetryPolicies {
+		policy := &p.cfg.RetryPolicies[i]
+		if policy.Status == exact {
+			return withDefaultBackoff(*policy)
+		}
+		if policy.Status == class && classPolicy == nil {
+			classPolicy = policy
+		}
+	}
+	if classPolicy != nil {
+		return withDefaultBackoff(*classPolicy)
+	}
+
+	if status == 0 || status == http.StatusTooManyRequests || status >= 500 {
+		return WebhookRetryPolicy{Status: exact, Retries: p.cfg.RetryCount, Backoff: defaultWebhookRetryBackoff}
+	}
+	return WebhookRetryPolicy{Status: exact}
+}
+
+func withDefaultBackoff(policy WebhookRetryPolicy) WebhookRetryPolicy {
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultWebhookRetryBackoff
+	}
+	return policy
+}
+
+// sign sets the signature headers of a request
+func (p *WebhookProducer) sign(req *http.Request, body []byte) {
+	signing := p.cfg.Signing
+	if signing == nil {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(signing.Secret))
+	if signing.TimestampHeader != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(signing.TimestampHeader, timestamp)
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	req.Header.Set(signing.Header, signing.Prefix+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// send makes one request. It returns the response status (0 without response) and the
+// delay asked for by a Retry-After header.
+func (p *WebhookProducer) send(body []byte) (int, time.Duration, error) {
+	req, err := p.request(body)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs) * time.Second
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("webhook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
+
+// request builds the signed request of a body
+func (p *WebhookProducer) request(body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(p.cfg.Method, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", p.cfg.ContentType)
+	if encoding := p.encoder.ContentEncoding(); encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	p.sign(req, body)
+	return req, nil
+}
+
+// Close waits for the queued events to be sent once msgChan is closed by its owner, giving up after 30s
+func (p *WebhookProducer) Close() {
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		p.stopOnce.Do(func() { close(p.stopChan) })
+		<-p.done
+	}
+}
+
+// GetStats returns how many requests were sent, retried or failed
+func (p *WebhookProducer) GetStats() map[string]uint64 {
+	return map[string]uint64{
+		"sent":    atomic.LoadUint64(&p.sent),
+		"retried": atomic.LoadUint64(&p.retried),
+		"failed":  atomic.LoadUint64(&p.failed),
+	}
+}
+
+// TestWebhookConnection checks that the webhook endpoint answers through the configured proxy,
+// with a HEAD request so nothing is delivered. Any HTTP response counts as reachable.
+func TestWebhookConnection(cfg WebhookConfig) error {
+	client, err := NewWebhookHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodHead, cfg.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook not reachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package common
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewWinlogReader is only available on Windows
+func NewWinlogReader(inputID string, cfg WinlogReaderConfig, msgChan chan map[string]interface{}) (*WinlogReader, error) {
+	return nil, fmt.Errorf("winlog input is only supported on Windows (current platform: %s)", runtime.GOOS)
+}
+
+// Start is a no-op outside Windows
+func (r *WinlogReader) Start() {}
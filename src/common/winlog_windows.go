@@ -0,0 +1,254 @@
+//go:build windows
+// +build windows
+
+package common
+
+import (
+	"AgentSmith-HUB/logger"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// wevtapi.dll, see https://learn.microsoft.com/windows/win32/api/winevt/
+var (
+	modwevtapi            = windows.NewLazySystemDLL("wevtapi.dll")
+	procEvtSubscribe      = modwevtapi.NewProc("EvtSubscribe")
+	procEvtNext           = modwevtapi.NewProc("EvtNext")
+	procEvtRender         = modwevtapi.NewProc("EvtRender")
+	procEvtClose          = modwevtapi.NewProc("EvtClose")
+	procEvtCreateBookmark = modwevtapi.NewProc("EvtCreateBookmark")
+	procEvtUpdateBookmark = modwevtapi.NewProc("EvtUpdateBookmark")
+)
+
+type evtHandle uintptr
+
+const (
+	evtSubscribeToFutureEvents      = 1
+	evtSubscribeStartAtOldestRecord = 2
+	evtSubscribeStartAfterBookmark  = 3
+	evtSubscribeStrict              = 0x10000
+
+	evtRenderEventXML = 1
+	evtRenderBookmark = 2
+
+	winlogBatchSize        = 64
+	winlogBookmarkInterval = 5 * time.Second
+)
+
+// NewWinlogReader creates an event log reader, checking that the Windows Event Log API is available
+func NewWinlogReader(inputID string, cfg WinlogReaderConfig, msgChan chan map[string]interface{}) (*WinlogReader, error) {
+	if err := modwevtapi.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load wevtapi.dll: %w", err)
+	}
+	if len(cfg.Channels) == 0 {
+		return nil, fmt.Errorf("no event log channels configured")
+	}
+	return &WinlogReader{
+		InputID:  inputID,
+		MsgChan:  msgChan,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start subscribes to every configured channel
+func (r *WinlogReader) Start() {
+	r.loadBookmarks()
+
+	for _, ch := range r.cfg.Channels {
+		ch := ch
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer func() {
+				if rec := recover(); rec != nil {
+					logger.Error("Panic in event log subscription", "input", r.InputID, "channel", ch.Name, "panic", rec)
+				}
+			}()
+
+			backoff := time.Second
+			for {
+				if err := r.subscribe(ch); err != nil {
+					logger.Warn("Event log subscription failed, retrying", "input", r.InputID, "channel", ch.Name, "error", err)
+				} else {
+					return
+				}
+				select {
+				case <-r.stopChan:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = nextBackoff(backoff)
+			}
+		}()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(winlogBookmarkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopChan:
+				return
+			case <-ticker.C:
+				r.saveBookmarks()
+			}
+		}
+	}()
+}
+
+// subscribe runs a pull subscription on one channel until the reader is stopped
+func (r *WinlogReader) subscribe(ch WinlogChannelConfig) error {
+	query := ch.Query
+	if query == "" {
+		query = "*"
+	}
+	channelPtr, err := windows.UTF16PtrFromString(ch.Name)
+	if err != nil {
+		return err
+	}
+	queryPtr, err := windows.UTF16PtrFromString(query)
+	if err != nil {
+		return err
+	}
+
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return fmt.Errorf("CreateEvent: %w", err)
+	}
+	defer windows.CloseHandle(signal)
+
+	bookmark, err := createBookmark(r.bookmark(ch.Name))
+	if err != nil {
+		return err
+	}
+	defer evtClose(bookmark)
+
+	flags := uintptr(evtSubscribeToFutureEvents)
+	if r.bookmark(ch.Name) != "" {
+		flags = evtSubscribeStartAfterBookmark
+	} else if r.cfg.StartAtOldest {
+		flags = evtSubscribeStartAtOldestRecord
+	}
+	var subscribeBookmark uintptr
+	if flags == evtSubscribeStartAfterBookmark {
+		subscribeBookmark = uintptr(bookmark)
+	}
+
+	sub, _, callErr := procEvtSubscribe.Call(0, uintptr(signal),
+		uintptr(unsafe.Pointer(channelPtr)), uintptr(unsafe.Pointer(queryPtr)),
+		subscribeBookmark, 0, 0, flags|evtSubscribeStrict)
+	if sub == 0 {
+		return fmt.Errorf("EvtSubscribe %s: %w", ch.Name, callErr)
+	}
+	defer evtClose(evtHandle(sub))
+
+	events := make([]evtHandle, winlogBatchSize)
+	for {
+		event, err := windows.WaitForSingleObject(signal, 1000)
+		if err != nil {
+			return fmt.Errorf("WaitForSingleObject: %w", err)
+		}
+		select {
+		case <-r.stopChan:
+			return nil
+		default:
+		}
+		if event != windows.WAIT_OBJECT_0 {
+			continue
+		}
+
+		for {
+			var returned uint32
+			ok, _, callErr := procEvtNext.Call(sub, uintptr(len(events)),
+				uintptr(unsafe.Pointer(&events[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if ok == 0 {
+				if callErr == windows.ERROR_NO_MORE_ITEMS {
+					break
+				}
+				return fmt.Errorf("EvtNext: %w", callErr)
+			}
+
+			stopped := false
+			for _, h := range events[:returned] {
+				if !stopped {
+					stopped = !r.handleEvent(ch.Name, h, bookmark)
+				}
+				evtClose(h)
+			}
+			if stopped {
+				return nil
+			}
+		}
+		_ = windows.ResetEvent(signal)
+	}
+}
+
+// handleEvent renders and forwards one event, then advances the channel bookmark.
+// It returns false if the reader is stopping.
+func (r *WinlogReader) handleEvent(channel string, h evtHandle, bookmark evtHandle) bool {
+	raw, err := evtRender(h, evtRenderEventXML)
+	if err != nil {
+		logger.Warn("Failed to render event", "input", r.InputID, "channel", channel, "error", err)
+		return true
+	}
+	event, err := parseWinlogXML(raw)
+	if err != nil {
+		logger.Warn("Failed to parse event XML", "input", r.InputID, "channel", channel, "error", err)
+		return true
+	}
+	if !r.emit(event) {
+		return false
+	}
+
+	if ok, _, _ := procEvtUpdateBookmark.Call(uintptr(bookmark), uintptr(h)); ok != 0 {
+		if xmlBookmark, err := evtRender(bookmark, evtRenderBookmark); err == nil {
+			r.setBookmark(channel, xmlBookmark)
+		}
+	}
+	return true
+}
+
+func createBookmark(bookmarkXML string) (evtHandle, error) {
+	var ptr uintptr
+	if bookmarkXML != "" {
+		p, err := windows.UTF16PtrFromString(bookmarkXML)
+		if err != nil {
+			return 0, err
+		}
+		ptr = uintptr(unsafe.Pointer(p))
+	}
+	h, _, err := procEvtCreateBookmark.Call(ptr)
+	if h == 0 {
+		return 0, fmt.Errorf("EvtCreateBookmark: %w", err)
+	}
+	return evtHandle(h), nil
+}
+
+// evtRender renders an event or bookmark handle as XML
+func evtRender(h evtHandle, flags uintptr) (string, error) {
+	var used, props uint32
+	buf := make([]uint16, 4096)
+	for {
+		ok, _, err := procEvtRender.Call(0, uintptr(h), flags, uintptr(len(buf)*2),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&props)))
+		if ok != 0 {
+			return windows.UTF16ToString(buf[:used/2]), nil
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return "", fmt.Errorf("EvtRender: %w", err)
+		}
+		buf = make([]uint16, used/2+1)
+	}
+}
+
+func evtClose(h evtHandle) {
+	if h != 0 {
+		_, _, _ = procEvtClose.Call(uintptr(h))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"AgentSmith-HUB/migrate"
+	"fmt"
+	"os"
+)
+
+// runImport converts a Logstash pipeline or Vector config into components under config_root and
+// prints the created files with the features that were not converted. It returns the exit code.
+func runImport(cfgRoot, source, file, name string) int {
+	if file == "" {
+		fmt.Println("import_file is required with -import")
+		return 1
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("cannot read %s: %v\n", file, err)
+		return 1
+	}
+	res, err := migrate.Import(source, file, data, name)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	paths, err := res.Write(cfgRoot)
+	if err != nil {
+		fmt.Printf("import failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Imported %s config %s\n\n", source, file)
+	for _, p := range paths {
+		fmt.Printf("created %s\n", p)
+	}
+	if len(res.Unmapped) == 0 {
+		fmt.Println("\nAll features were converted.")
+		return 0
+	}
+	fmt.Printf("\n%d features were not converted, review the components before starting the project:\n", len(res.Unmapped))
+	for _, f := range res.Unmapped {
+		fmt.Printf("- %s: %s\n", f.Location, f.Detail)
+	}
+	return 0
+}
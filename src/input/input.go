@@ -3,14 +3,18 @@ package input
 import (
 	"AgentSmith-HUB/common"
 	"AgentSmith-HUB/logger"
+	"context"
 	"fmt"
 	"os"
 	"regexp"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/vjeantet/grok"
 	"gopkg.in/yaml.v3"
 )
@@ -23,6 +27,28 @@ const (
 	InputTypeKafkaAzure InputType = "kafka_azure"
 	InputTypeKafkaAWS   InputType = "kafka_aws"
 	InputTypeAliyunSLS  InputType = "aliyun_sls"
+
+	// SaaS audit log pullers
+	InputTypeOkta            InputType = "okta"
+	InputTypeGoogleWorkspace InputType = "google_workspace"
+	InputTypeGitHubAudit     InputType = "github_audit"
+
+	InputTypeOTLP InputType = "otlp"
+
+	// Events forwarded by regional hubs over mutual TLS
+	InputTypeFederation InputType = "federation"
+
+	// Host-local collection, each node reads its own logs
+	InputTypeJournald InputType = "journald"
+	InputTypeWinlog   InputType = "winlog"
+
+	// Database change data capture
+	InputTypeCDC InputType = "cdc"
+
+	InputTypePulsar InputType = "pulsar"
+
+	// Requests made to the API of this hub, each node reads the requests it served
+	InputTypeAPIAccessLog InputType = "api_access_log"
 )
 
 // InputConfig is the YAML config for an input.
@@ -33,7 +59,21 @@ type InputConfig struct {
 	AliyunSLS   *AliyunSLSInputConfig `yaml:"aliyun_sls,omitempty"`
 	GrokPattern string                `yaml:"grok_pattern,omitempty"`
 	GrokField   string                `yaml:"grok_field,omitempty"`
-	RawConfig   string
+
+	Okta            *OktaInputConfig            `yaml:"okta,omitempty"`
+	GoogleWorkspace *GoogleWorkspaceInputConfig `yaml:"google_workspace,omitempty"`
+	GitHubAudit     *GitHubAuditInputConfig     `yaml:"github_audit,omitempty"`
+	OTLP            *OTLPInputConfig            `yaml:"otlp,omitempty"`
+	Federation      *FederationInputConfig      `yaml:"federation,omitempty"`
+	Journald        *JournaldInputConfig        `yaml:"journald,omitempty"`
+	Winlog          *WinlogInputConfig          `yaml:"winlog,omitempty"`
+	CDC             *CDCInputConfig             `yaml:"cdc,omitempty"`
+	Pulsar          *PulsarInputConfig          `yaml:"pulsar,omitempty"`
+	APIAccessLog    *APIAccessLogInputConfig    `yaml:"api_access_log,omitempty"`
+	Schema          *SchemaInputConfig          `yaml:"schema,omitempty"`
+	Dedup           *DedupInputConfig           `yaml:"dedup,omitempty"`
+
+	RawConfig string
 }
 
 // KafkaInputConfig holds Kafka-specific config.
@@ -62,6 +102,213 @@ type AliyunSLSInputConfig struct {
 	Query             string `yaml:"query,omitempty"`             // Optional query for filtering logs
 }
 
+// AuditLogPollConfig holds polling settings shared by all audit log inputs.
+type AuditLogPollConfig struct {
+	PollInterval string `yaml:"poll_interval,omitempty"` // default 1m
+	PageSize     int    `yaml:"page_size,omitempty"`     // default 100
+	Lookback     string `yaml:"lookback,omitempty"`      // where to start without a stored cursor, default 1h
+}
+
+// OktaInputConfig holds Okta System Log specific config.
+type OktaInputConfig struct {
+	Domain             string `yaml:"domain"`
+	APIToken           string `yaml:"api_token"`
+	AuditLogPollConfig `yaml:",inline"`
+}
+
+// GoogleWorkspaceInputConfig holds Google Workspace Reports API specific config.
+type GoogleWorkspaceInputConfig struct {
+	ServiceAccountFile string `yaml:"service_account_file,omitempty"`
+	ServiceAccountJSON string `yaml:"service_account_json,omitempty"`
+	Subject            string `yaml:"subject"`               // admin user impersonated via domain-wide delegation
+	Application        string `yaml:"application,omitempty"` // login, admin, drive, token, ... default login
+	AuditLogPollConfig `yaml:",inline"`
+}
+
+// GitHubAuditInputConfig holds GitHub organization/enterprise audit log specific config.
+type GitHubAuditInputConfig struct {
+	Organization       string `yaml:"organization,omitempty"`
+	Enterprise         string `yaml:"enterprise,omitempty"`
+	Token              string `yaml:"token"`
+	AuditLogPollConfig `yaml:",inline"`
+}
+
+// OTLPInputConfig holds OpenTelemetry OTLP logs receiver config.
+type OTLPInputConfig struct {
+	GRPCListen     string `yaml:"grpc_listen,omitempty"`      // e.g. 0.0.0.0:4317
+	HTTPListen     string `yaml:"http_listen,omitempty"`      // e.g. 0.0.0.0:4318
+	MaxMessageSize int64  `yaml:"max_message_size,omitempty"` // bytes, default 16MB
+}
+
+// FederationInputConfig holds the config of the receiver accepting events from regional hubs.
+type FederationInputConfig struct {
+	Listen         string                      `yaml:"listen"` // e.g. 0.0.0.0:9443
+	HubID          string                      `yaml:"hub_id"`
+	TLS            *common.FederationTLSConfig `yaml:"tls"`                    // ca_file verifies the regional hubs' client certificates
+	AllowedHubs    []string                    `yaml:"allowed_hubs,omitempty"` // certificate CN or DNS names, default any certificate of the CA
+	MaxHops        int                         `yaml:"max_hops,omitempty"`     // default 4
+	MaxMessageSize int64                       `yaml:"max_message_size,omitempty"`
+}
+
+// JournaldInputConfig holds systemd journal specific config.
+type JournaldInputConfig struct {
+	Units         []string `yaml:"units,omitempty"`          // systemd units to follow, default all
+	Identifiers   []string `yaml:"identifiers,omitempty"`    // syslog identifiers to follow
+	Matches       []string `yaml:"matches,omitempty"`        // raw journal matches, e.g. _TRANSPORT=kernel
+	Priority      string   `yaml:"priority,omitempty"`       // e.g. warning or 0..4
+	Directory     string   `yaml:"directory,omitempty"`      // journal directory, default system journal
+	StartPosition string   `yaml:"start_position,omitempty"` // beginning or end (default), used without a stored cursor
+}
+
+// APIAccessLogInputConfig selects which API requests are read, all of them by default.
+type APIAccessLogInputConfig struct {
+	WritesOnly bool     `yaml:"writes_only,omitempty"` // skip GET, HEAD and OPTIONS requests
+	Routes     []string `yaml:"routes,omitempty"`      // route prefixes, e.g. /rulesets
+}
+
+// WinlogInputConfig holds Windows Event Log specific config.
+type WinlogInputConfig struct {
+	Channels      []common.WinlogChannelConfig `yaml:"channels"`
+	StartPosition string                       `yaml:"start_position,omitempty"` // beginning or end (default), used without a stored bookmark
+}
+
+// CDCInputConfig holds database change data capture specific config.
+type CDCInputConfig struct {
+	Driver        string   `yaml:"driver"` // postgres or mysql
+	Host          string   `yaml:"host"`
+	Port          int      `yaml:"port,omitempty"`
+	User          string   `yaml:"user"`
+	Password      string   `yaml:"password,omitempty"`
+	Database      string   `yaml:"database,omitempty"`       // required for postgres
+	Tables        []string `yaml:"tables,omitempty"`         // schema.table (postgres) or database.table (mysql), default all
+	Slot          string   `yaml:"slot,omitempty"`           // postgres logical replication slot (wal2json)
+	CreateSlot    bool     `yaml:"create_slot,omitempty"`    // postgres: create the slot if it does not exist
+	ServerID      int      `yaml:"server_id,omitempty"`      // mysql: replica server id used by the binlog reader
+	StartPosition string   `yaml:"start_position,omitempty"` // mysql: beginning or end (default), used without a stored position
+}
+
+func (c *CDCInputConfig) readerConfig() common.CDCReaderConfig {
+	return common.CDCReaderConfig{
+		Driver:        common.CDCDriver(c.Driver),
+		Host:          c.Host,
+		Port:          c.Port,
+		User:          c.User,
+		Password:      c.Password,
+		Database:      c.Database,
+		Tables:        c.Tables,
+		Slot:          c.Slot,
+		CreateSlot:    c.CreateSlot,
+		ServerID:      c.ServerID,
+		FromBeginning: c.StartPosition == "beginning",
+	}
+}
+
+// PulsarInputConfig holds Apache Pulsar consumer config, messages are received through the broker WebSocket API.
+type PulsarInputConfig struct {
+	ServiceURL        string                 `yaml:"service_url"` // broker or proxy web service, e.g. http://pulsar:8080
+	Topic             string                 `yaml:"topic"`       // persistent://tenant/namespace/topic
+	Subscription      string                 `yaml:"subscription"`
+	SubscriptionType  string                 `yaml:"subscription_type,omitempty"` // shared (default), failover, exclusive or key_shared
+	Token             string                 `yaml:"token,omitempty"`             // JWT for token authentication
+	TLS               *common.KafkaTLSConfig `yaml:"tls,omitempty"`
+	AckTimeout        string                 `yaml:"ack_timeout,omitempty"`         // e.g. 30s, unacknowledged messages are redelivered, default disabled
+	ReceiverQueueSize int                    `yaml:"receiver_queue_size,omitempty"` // broker default 1000
+}
+
+func (c *PulsarInputConfig) consumerConfig() common.PulsarConsumerConfig {
+	// ack_timeout is validated by Verify
+	ackTimeout, _ := time.ParseDuration(c.AckTimeout)
+	return common.PulsarConsumerConfig{
+		ServiceURL:        c.ServiceURL,
+		Topic:             c.Topic,
+		Subscription:      c.Subscription,
+		SubscriptionType:  c.SubscriptionType,
+		Token:             c.Token,
+		TLS:               c.TLS,
+		AckTimeout:        ackTimeout,
+		ReceiverQueueSize: c.ReceiverQueueSize,
+	}
+}
+
+// SchemaInputConfig validates consumed events against a JSON Schema.
+// Events that fail are tagged with the violations and sent to the project's [quarantine] edges
+// of this input and/or a Redis list instead of the regular downstream components.
+type SchemaInputConfig struct {
+	Definition  map[string]interface{} `yaml:"definition"`              // JSON Schema, as YAML or inline JSON
+	RedisList   string                 `yaml:"redis_list,omitempty"`    // optional Redis list receiving quarantined events
+	RedisMaxLen int64                  `yaml:"redis_max_len,omitempty"` // list length cap, default 10000
+	Contract    *SchemaContractConfig  `yaml:"contract,omitempty"`      // optional, reports violations to the producing team
+}
+
+// SchemaContractConfig names the team producing an input and where it is told about schema violations.
+// Violations are aggregated per interval into one report with counts, top errors and samples.
+type SchemaContractConfig struct {
+	Owner         string            `yaml:"owner"`
+	Notify        string            `yaml:"notify"`             // slack, teams, dingtalk or webhook
+	URL           string            `yaml:"url"`                // incoming webhook or HTTP endpoint
+	Secret        string            `yaml:"secret,omitempty"`   // dingtalk signing secret
+	Headers       map[string]string `yaml:"headers,omitempty"`  // webhook only
+	Interval      string            `yaml:"interval,omitempty"` // report window, default 15m
+	MinViolations int               `yaml:"min_violations,omitempty"`
+	Samples       int               `yaml:"samples,omitempty"` // sample events per report, default 5
+}
+
+// reporterConfig converts the contract config for the schema contract reporter
+func (c *SchemaContractConfig) reporterConfig(inputID string) common.SchemaContractConfig {
+	cfg := common.SchemaContractConfig{
+		InputID:       inputID,
+		Owner:         c.Owner,
+		MinViolations: c.MinViolations,
+		Samples:       c.Samples,
+		Notify:        c.Notify,
+		URL:           c.URL,
+		Secret:        c.Secret,
+		Headers:       c.Headers,
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err == nil {
+			cfg.Interval = d
+		}
+	}
+	return cfg
+}
+
+// SchemaErrorsField holds the schema violations of a quarantined event
+const SchemaErrorsField = "_hub_schema_errors"
+
+const defaultQuarantineListMaxLen = 10000
+
+// DedupInputConfig drops events already seen within a sliding window, so duplicates from
+// redundant shippers never reach rulesets and their threshold counters. Events are keyed by
+// a hash of the listed fields and the window is shared by all nodes through Redis.
+type DedupInputConfig struct {
+	Fields []string `yaml:"fields"`           // dot separated field paths, e.g. [message, host.name]
+	Window string   `yaml:"window,omitempty"` // duration, default 60s
+}
+
+const (
+	dedupKeyPrefix     = "hub:dedup:"
+	defaultDedupWindow = 60 * time.Second
+)
+
+func (c *DedupInputConfig) window() (time.Duration, error) {
+	if c.Window == "" {
+		return defaultDedupWindow, nil
+	}
+	d, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("must be at least 1s")
+	}
+	return d, nil
+}
+
+func validStartPosition(pos string) bool {
+	return pos == "" || pos == "beginning" || pos == "end"
+}
+
 // Input represents an input component that consumes data from external sources
 type Input struct {
 	Status              common.Status
@@ -74,8 +321,16 @@ type Input struct {
 	DownStream          map[string]*chan map[string]interface{}
 
 	// runtime
-	kafkaConsumer *common.KafkaConsumer
-	slsConsumer   *common.AliyunSLSConsumer
+	kafkaConsumer  *common.KafkaConsumer
+	slsConsumer    *common.AliyunSLSConsumer
+	auditLogPuller *common.AuditLogPuller
+	otlpReceiver   *common.OTLPReceiver
+	fedReceiver    *common.FederationReceiver
+	journaldReader *common.JournaldReader
+	winlogReader   *common.WinlogReader
+	cdcReader      *common.CDCReader
+	pulsarConsumer *common.PulsarConsumer
+	accessReader   *common.APIAccessLogReader
 
 	// internal message channel for monitoring during shutdown
 	internalMsgChan chan map[string]interface{}
@@ -83,6 +338,33 @@ type Input struct {
 	// config cache
 	kafkaCfg     *KafkaInputConfig
 	aliyunSLSCfg *AliyunSLSInputConfig
+	auditLogCfg  *common.AuditLogPullerConfig
+	otlpCfg      *OTLPInputConfig
+	fedCfg       *FederationInputConfig
+	journaldCfg  *JournaldInputConfig
+	winlogCfg    *WinlogInputConfig
+	cdcCfg       *CDCInputConfig
+	pulsarCfg    *PulsarInputConfig
+	accessLogCfg *APIAccessLogInputConfig
+
+	// schema validation, QuarantineStream marks DownStream keys that only receive invalid events
+	schema           *common.JSONSchema
+	QuarantineStream map[string]bool
+	quarantineTotal  uint64
+	contract         *common.SchemaContractReporter
+
+	// dedup window, dedupFields is nil when dedup is disabled
+	dedupFields [][]string
+	dedupWindow int // seconds
+	dedupTotal  uint64
+
+	// mirrors receive a copy of every consumed event, used by shadow projects
+	mirrorMu sync.RWMutex
+	mirrors  map[string]func(map[string]interface{})
+
+	// projects needing at-least-once delivery from this input, see SetAtLeastOnce
+	atLeastOnceMu       sync.Mutex
+	atLeastOnceProjects map[string]bool
 
 	consumeTotal      uint64
 	lastReportedTotal uint64 // For calculating increments in 10-second intervals
@@ -161,13 +443,245 @@ func Verify(path string, raw string) error {
 			return fmt.Errorf("missing required field 'aliyun_sls' for aliyunSLS input (line: unknown)")
 		}
 		// Add more AliyunSLS specific field validation
+	case InputTypeOkta:
+		if cfg.Okta == nil {
+			return fmt.Errorf("missing required field 'okta' for okta input (line: unknown)")
+		}
+		if cfg.Okta.Domain == "" {
+			return fmt.Errorf("missing required field 'okta.domain' for okta input (line: unknown)")
+		}
+		if cfg.Okta.APIToken == "" {
+			return fmt.Errorf("missing required field 'okta.api_token' for okta input (line: unknown)")
+		}
+	case InputTypeGoogleWorkspace:
+		if cfg.GoogleWorkspace == nil {
+			return fmt.Errorf("missing required field 'google_workspace' for google_workspace input (line: unknown)")
+		}
+		if cfg.GoogleWorkspace.ServiceAccountFile == "" && cfg.GoogleWorkspace.ServiceAccountJSON == "" {
+			return fmt.Errorf("missing required field 'google_workspace.service_account_file' or 'google_workspace.service_account_json' for google_workspace input (line: unknown)")
+		}
+		if cfg.GoogleWorkspace.Subject == "" {
+			return fmt.Errorf("missing required field 'google_workspace.subject' for google_workspace input (line: unknown)")
+		}
+	case InputTypeGitHubAudit:
+		if cfg.GitHubAudit == nil {
+			return fmt.Errorf("missing required field 'github_audit' for github_audit input (line: unknown)")
+		}
+		if cfg.GitHubAudit.Organization == "" && cfg.GitHubAudit.Enterprise == "" {
+			return fmt.Errorf("missing required field 'github_audit.organization' or 'github_audit.enterprise' for github_audit input (line: unknown)")
+		}
+		if cfg.GitHubAudit.Token == "" {
+			return fmt.Errorf("missing required field 'github_audit.token' for github_audit input (line: unknown)")
+		}
+	case InputTypeOTLP:
+		if cfg.OTLP == nil {
+			return fmt.Errorf("missing required field 'otlp' for otlp input (line: unknown)")
+		}
+		if cfg.OTLP.GRPCListen == "" && cfg.OTLP.HTTPListen == "" {
+			return fmt.Errorf("missing required field 'otlp.grpc_listen' or 'otlp.http_listen' for otlp input (line: unknown)")
+		}
+	case InputTypeFederation:
+		if cfg.Federation == nil {
+			return fmt.Errorf("missing required field 'federation' for federation input (line: unknown)")
+		}
+		if cfg.Federation.Listen == "" {
+			return fmt.Errorf("missing required field 'federation.listen' for federation input (line: unknown)")
+		}
+		if strings.TrimSpace(cfg.Federation.HubID) == "" {
+			return fmt.Errorf("missing required field 'federation.hub_id' for federation input (line: unknown)")
+		}
+		if tlsCfg := cfg.Federation.TLS; tlsCfg == nil || tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" || tlsCfg.CAFile == "" {
+			return fmt.Errorf("federation input requires 'federation.tls' with cert_file, key_file and ca_file (line: unknown)")
+		}
+		if cfg.Federation.MaxHops < 0 {
+			return fmt.Errorf("'federation.max_hops' must not be negative (line: unknown)")
+		}
+	case InputTypeJournald:
+		// The journald section is optional, without it the whole journal is followed
+		if cfg.Journald != nil && !validStartPosition(cfg.Journald.StartPosition) {
+			return fmt.Errorf("invalid value for field 'journald.start_position': %s, must be 'beginning' or 'end' (line: unknown)", cfg.Journald.StartPosition)
+		}
+	case InputTypeWinlog:
+		if cfg.Winlog == nil {
+			return fmt.Errorf("missing required field 'winlog' for winlog input (line: unknown)")
+		}
+		if len(cfg.Winlog.Channels) == 0 {
+			return fmt.Errorf("missing required field 'winlog.channels' for winlog input (line: unknown)")
+		}
+		for i, ch := range cfg.Winlog.Channels {
+			if ch.Name == "" {
+				return fmt.Errorf("missing required field 'winlog.channels[%d].name' for winlog input (line: unknown)", i)
+			}
+		}
+		if !validStartPosition(cfg.Winlog.StartPosition) {
+			return fmt.Errorf("invalid value for field 'winlog.start_position': %s, must be 'beginning' or 'end' (line: unknown)", cfg.Winlog.StartPosition)
+		}
+	case InputTypeCDC:
+		if cfg.CDC == nil {
+			return fmt.Errorf("missing required field 'cdc' for cdc input (line: unknown)")
+		}
+		if cfg.CDC.Driver != string(common.CDCDriverPostgres) && cfg.CDC.Driver != string(common.CDCDriverMySQL) {
+			return fmt.Errorf("invalid value for field 'cdc.driver': %s, must be 'postgres' or 'mysql' (line: unknown)", cfg.CDC.Driver)
+		}
+		if cfg.CDC.Host == "" {
+			return fmt.Errorf("missing required field 'cdc.host' for cdc input (line: unknown)")
+		}
+		if cfg.CDC.User == "" {
+			return fmt.Errorf("missing required field 'cdc.user' for cdc input (line: unknown)")
+		}
+		if cfg.CDC.Driver == string(common.CDCDriverPostgres) {
+			if cfg.CDC.Database == "" {
+				return fmt.Errorf("missing required field 'cdc.database' for postgres cdc input (line: unknown)")
+			}
+			if cfg.CDC.Slot == "" {
+				return fmt.Errorf("missing required field 'cdc.slot' for postgres cdc input (line: unknown)")
+			}
+		}
+		if !validStartPosition(cfg.CDC.StartPosition) {
+			return fmt.Errorf("invalid value for field 'cdc.start_position': %s, must be 'beginning' or 'end' (line: unknown)", cfg.CDC.StartPosition)
+		}
+	case InputTypePulsar:
+		if cfg.Pulsar == nil {
+			return fmt.Errorf("missing required field 'pulsar' for pulsar input (line: unknown)")
+		}
+		if cfg.Pulsar.ServiceURL == "" {
+			return fmt.Errorf("missing required field 'pulsar.service_url' for pulsar input (line: unknown)")
+		}
+		if cfg.Pulsar.Topic == "" {
+			return fmt.Errorf("missing required field 'pulsar.topic' for pulsar input (line: unknown)")
+		}
+		if cfg.Pulsar.Subscription == "" {
+			return fmt.Errorf("missing required field 'pulsar.subscription' for pulsar input (line: unknown)")
+		}
+		if _, err := common.NormalizePulsarSubscriptionType(cfg.Pulsar.SubscriptionType); err != nil {
+			return fmt.Errorf("invalid value for field 'pulsar.subscription_type': %v (line: unknown)", err)
+		}
+		if cfg.Pulsar.AckTimeout != "" {
+			// the broker rejects ack timeouts below one second
+			if d, err := time.ParseDuration(cfg.Pulsar.AckTimeout); err != nil || d < time.Second {
+				return fmt.Errorf("invalid value for field 'pulsar.ack_timeout': %s, must be a duration of at least 1s (line: unknown)", cfg.Pulsar.AckTimeout)
+			}
+		}
+		if cfg.Pulsar.ReceiverQueueSize < 0 {
+			return fmt.Errorf("invalid value for field 'pulsar.receiver_queue_size': %d, must not be negative (line: unknown)", cfg.Pulsar.ReceiverQueueSize)
+		}
+	case InputTypeAPIAccessLog:
+		// The api_access_log section is optional, without it every request is read
+		if cfg.APIAccessLog != nil {
+			for i, route := range cfg.APIAccessLog.Routes {
+				if !strings.HasPrefix(route, "/") {
+					return fmt.Errorf("invalid value for field 'api_access_log.routes[%d]': %s, must start with / (line: unknown)", i, route)
+				}
+			}
+		}
 	default:
 		return fmt.Errorf("unsupported input type: %s (line: unknown)", cfg.Type)
 	}
 
+	if _, err := buildAuditLogConfig(&cfg); err != nil {
+		return fmt.Errorf("%s (line: unknown)", err.Error())
+	}
+
+	if cfg.Schema != nil {
+		if len(cfg.Schema.Definition) == 0 {
+			return fmt.Errorf("missing required field 'schema.definition' (line: unknown)")
+		}
+		if _, err := common.CompileJSONSchema(cfg.Schema.Definition); err != nil {
+			return fmt.Errorf("invalid JSON Schema in 'schema.definition': %v (line: unknown)", err)
+		}
+		if c := cfg.Schema.Contract; c != nil {
+			if c.Owner == "" {
+				return fmt.Errorf("missing required field 'schema.contract.owner' (line: unknown)")
+			}
+			switch c.Notify {
+			case common.SchemaContractNotifySlack, common.SchemaContractNotifyTeams, common.SchemaContractNotifyDingTalk, common.SchemaContractNotifyWebhook:
+			default:
+				return fmt.Errorf("invalid 'schema.contract.notify' %q, expected slack, teams, dingtalk or webhook (line: unknown)", c.Notify)
+			}
+			if c.URL == "" {
+				return fmt.Errorf("missing required field 'schema.contract.url' (line: unknown)")
+			}
+			if c.Interval != "" {
+				if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+					return fmt.Errorf("invalid 'schema.contract.interval' %q, expected a duration like 15m (line: unknown)", c.Interval)
+				}
+			}
+		}
+	}
+
+	if cfg.Dedup != nil {
+		if len(cfg.Dedup.Fields) == 0 {
+			return fmt.Errorf("missing required field 'dedup.fields' (line: unknown)")
+		}
+		for i, f := range cfg.Dedup.Fields {
+			if strings.TrimSpace(f) == "" {
+				return fmt.Errorf("empty value for field 'dedup.fields[%d]' (line: unknown)", i)
+			}
+		}
+		if _, err := cfg.Dedup.window(); err != nil {
+			return fmt.Errorf("invalid value for field 'dedup.window': %s, %v (line: unknown)", cfg.Dedup.Window, err)
+		}
+	}
+
 	return nil
 }
 
+// buildAuditLogConfig converts audit log input config to the puller config, returning nil for other input types
+func buildAuditLogConfig(cfg *InputConfig) (*common.AuditLogPullerConfig, error) {
+	var poll AuditLogPollConfig
+	pullerCfg := &common.AuditLogPullerConfig{}
+
+	switch cfg.Type {
+	case InputTypeOkta:
+		if cfg.Okta == nil {
+			return nil, nil
+		}
+		poll = cfg.Okta.AuditLogPollConfig
+		pullerCfg.Provider = common.AuditLogProviderOkta
+		pullerCfg.Domain = cfg.Okta.Domain
+		pullerCfg.Token = cfg.Okta.APIToken
+	case InputTypeGoogleWorkspace:
+		if cfg.GoogleWorkspace == nil {
+			return nil, nil
+		}
+		poll = cfg.GoogleWorkspace.AuditLogPollConfig
+		pullerCfg.Provider = common.AuditLogProviderGoogleWorkspace
+		pullerCfg.ServiceAccountFile = cfg.GoogleWorkspace.ServiceAccountFile
+		pullerCfg.ServiceAccountJSON = cfg.GoogleWorkspace.ServiceAccountJSON
+		pullerCfg.Subject = cfg.GoogleWorkspace.Subject
+		pullerCfg.Application = cfg.GoogleWorkspace.Application
+	case InputTypeGitHubAudit:
+		if cfg.GitHubAudit == nil {
+			return nil, nil
+		}
+		poll = cfg.GitHubAudit.AuditLogPollConfig
+		pullerCfg.Provider = common.AuditLogProviderGitHub
+		pullerCfg.Organization = cfg.GitHubAudit.Organization
+		pullerCfg.Enterprise = cfg.GitHubAudit.Enterprise
+		pullerCfg.Token = cfg.GitHubAudit.Token
+	default:
+		return nil, nil
+	}
+
+	if poll.PollInterval != "" {
+		d, err := time.ParseDuration(poll.PollInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid poll_interval: %s", poll.PollInterval)
+		}
+		pullerCfg.PollInterval = d
+	}
+	if poll.Lookback != "" {
+		d, err := time.ParseDuration(poll.Lookback)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid lookback: %s", poll.Lookback)
+		}
+		pullerCfg.Lookback = d
+	}
+	pullerCfg.PageSize = poll.PageSize
+
+	return pullerCfg, nil
+}
+
 // NewInput creates an Input from config and downstreams.
 func NewInput(path string, raw string, id string) (*Input, error) {
 	var cfg InputConfig
@@ -186,6 +700,8 @@ func NewInput(path string, raw string, id string) (*Input, error) {
 		cfg.RawConfig = raw
 	}
 
+	auditLogCfg, _ := buildAuditLogConfig(&cfg)
+
 	in := &Input{
 		Id:                  id,
 		Path:                path,
@@ -194,6 +710,15 @@ func NewInput(path string, raw string, id string) (*Input, error) {
 		kafkaCfg:            cfg.Kafka,
 		ProjectNodeSequence: "INPUT." + id,
 		aliyunSLSCfg:        cfg.AliyunSLS,
+		auditLogCfg:         auditLogCfg,
+		otlpCfg:             cfg.OTLP,
+		fedCfg:              cfg.Federation,
+		journaldCfg:         cfg.Journald,
+		winlogCfg:           cfg.Winlog,
+		cdcCfg:              cfg.CDC,
+		pulsarCfg:           cfg.Pulsar,
+		accessLogCfg:        cfg.APIAccessLog,
+		QuarantineStream:    make(map[string]bool),
 		Config:              &cfg,
 		sampler:             nil, // Will be set below based on cluster role
 		Status:              common.StatusStopped,
@@ -213,9 +738,98 @@ func NewInput(path string, raw string, id string) (*Input, error) {
 		in.grokParser = g
 	}
 
+	if cfg.Schema != nil {
+		if in.schema, err = common.CompileJSONSchema(cfg.Schema.Definition); err != nil {
+			return nil, fmt.Errorf("failed to compile input schema: %w", err)
+		}
+	}
+
+	if cfg.Dedup != nil {
+		window, _ := cfg.Dedup.window()
+		in.dedupWindow = int(window / time.Second)
+		for _, f := range cfg.Dedup.Fields {
+			in.dedupFields = append(in.dedupFields, common.StringToList(strings.TrimSpace(f)))
+		}
+	}
+
 	return in, nil
 }
 
+// duplicate reports whether an event with the same dedup fields was seen within the window.
+// The first occurrence claims the key; repeats push its expiry out, so the window slides.
+// Redis errors let the event through rather than dropping data.
+func (in *Input) duplicate(msg map[string]interface{}) bool {
+	if in.dedupFields == nil {
+		return false
+	}
+
+	var sb strings.Builder
+	for i, path := range in.dedupFields {
+		if i > 0 {
+			sb.WriteByte(0)
+		}
+		if v, ok := common.GetCheckData(msg, path); ok {
+			sb.WriteString(v)
+		}
+	}
+	scope := in.ProjectNodeSequence
+	if scope == "" {
+		scope = in.Id
+	}
+	key := dedupKeyPrefix + scope + ":" + common.XXHash64(sb.String())
+
+	first, err := common.RedisSetNX(key, 1, in.dedupWindow)
+	if err != nil {
+		logger.Warn("Dedup check failed, forwarding event", "input", in.Id, "error", err)
+		return false
+	}
+	if first {
+		return false
+	}
+	_ = common.RedisExpire(key, in.dedupWindow)
+	atomic.AddUint64(&in.dedupTotal, 1)
+	return true
+}
+
+// GetDedupTotal returns the number of events dropped as duplicates
+func (in *Input) GetDedupTotal() uint64 {
+	return atomic.LoadUint64(&in.dedupTotal)
+}
+
+// quarantine validates msg against the input schema. Invalid messages get the violations
+// attached and are pushed to the configured Redis list; the result tells whether msg is quarantined.
+func (in *Input) quarantine(msg map[string]interface{}) bool {
+	if in.schema == nil {
+		return false
+	}
+	errs := in.schema.Validate(msg)
+	if len(errs) == 0 {
+		return false
+	}
+
+	atomic.AddUint64(&in.quarantineTotal, 1)
+	in.contract.Record(msg, errs)
+	msg[SchemaErrorsField] = errs
+
+	if key := in.Config.Schema.RedisList; key != "" {
+		maxLen := in.Config.Schema.RedisMaxLen
+		if maxLen <= 0 {
+			maxLen = defaultQuarantineListMaxLen
+		}
+		if data, err := sonic.Marshal(msg); err != nil {
+			logger.Warn("Failed to encode quarantined event", "input", in.Id, "error", err)
+		} else if err := common.RedisLPush(key, data, maxLen); err != nil {
+			logger.Warn("Failed to push quarantined event to Redis", "input", in.Id, "list", key, "error", err)
+		}
+	}
+	return true
+}
+
+// GetQuarantineTotal returns the number of events that failed schema validation
+func (in *Input) GetQuarantineTotal() uint64 {
+	return atomic.LoadUint64(&in.quarantineTotal)
+}
+
 // parseWithGrok parses the input data using grok pattern if configured
 func (in *Input) parseWithGrok(data map[string]interface{}) map[string]interface{} {
 	if in.grokParser == nil || in.Config.GrokPattern == "" {
@@ -296,6 +910,49 @@ func (in *Input) cleanup() {
 		in.slsConsumer = nil
 	}
 
+	if in.auditLogPuller != nil {
+		in.auditLogPuller.Close()
+		in.auditLogPuller = nil
+	}
+
+	if in.otlpReceiver != nil {
+		in.otlpReceiver.Close()
+		in.otlpReceiver = nil
+	}
+
+	if in.fedReceiver != nil {
+		in.fedReceiver.Close()
+		in.fedReceiver = nil
+	}
+
+	if in.journaldReader != nil {
+		in.journaldReader.Close()
+		in.journaldReader = nil
+	}
+
+	if in.winlogReader != nil {
+		in.winlogReader.Close()
+		in.winlogReader = nil
+	}
+	if in.cdcReader != nil {
+		in.cdcReader.Close()
+		in.cdcReader = nil
+	}
+	if in.pulsarConsumer != nil {
+		in.pulsarConsumer.Close()
+		in.pulsarConsumer = nil
+	}
+	if in.accessReader != nil {
+		in.accessReader.Close()
+		in.accessReader = nil
+	}
+
+	// Send the report of the current window, consumers are stopped so no violations follow
+	if in.contract != nil {
+		in.contract.Close()
+		in.contract = nil
+	}
+
 	// Clear internal message channel reference
 	in.internalMsgChan = nil
 
@@ -344,6 +1001,18 @@ func (in *Input) Start() error {
 	}
 	logger.Info("Input connectivity verified", "input", in.Id, "type", in.Type)
 
+	if in.Config.Schema != nil && in.Config.Schema.Contract != nil {
+		if in.contract != nil {
+			in.contract.Close()
+		}
+		contract, err := common.NewSchemaContractReporter(in.Config.Schema.Contract.reporterConfig(in.Id))
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create schema contract reporter for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create schema contract reporter for input %s: %v", in.Id, err)
+		}
+		in.contract = contract
+	}
+
 	switch in.Type {
 	case InputTypeKafka, InputTypeKafkaAzure, InputTypeKafkaAWS:
 		if in.kafkaConsumer != nil {
@@ -365,6 +1034,7 @@ func (in *Input) Start() error {
 			in.kafkaCfg.OffsetReset,
 			in.kafkaCfg.Balancer,
 			msgChan,
+			in.atLeastOnce(),
 		)
 		if err != nil {
 			in.SetStatus(common.StatusError, fmt.Errorf("failed to create kafka consumer for input %s: %v", in.Id, err))
@@ -374,52 +1044,7 @@ func (in *Input) Start() error {
 		in.internalMsgChan = msgChan // Store reference for monitoring during shutdown only after successful creation
 
 		// Start consumer goroutine with proper management
-		in.wg.Add(1)
-		go func() {
-			defer in.wg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in kafka consumer goroutine", "input", in.Id, "panic", r)
-					// Set input status to error on panic
-					in.SetStatus(common.StatusError, fmt.Errorf("kafka consumer goroutine panic: %v", r))
-				}
-			}()
-
-			for {
-				select {
-				case <-in.stopChan:
-					logger.Info("Kafka consumer goroutine stopping", "input", in.Id)
-					return
-				case msg, ok := <-msgChan:
-					if !ok {
-						logger.Info("Kafka message channel closed", "input", in.Id)
-						return
-					}
-					// Only increment total count - QPS calculation removed
-					atomic.AddUint64(&in.consumeTotal, 1)
-
-					// Sample the message
-					if in.sampler != nil {
-						in.sampler.Sample(msg, in.ProjectNodeSequence)
-					}
-
-					// Add input ID to message data
-					if msg == nil {
-						msg = make(map[string]interface{}, 2)
-					}
-					msg["_hub_input"] = in.Id
-
-					// Parse with grok if configured
-					msg = in.parseWithGrok(msg)
-
-					// Forward to downstream with blocking sends to ensure no data loss
-					// If any downstream channel is full, this will block and prevent further consumption
-					for _, ch := range in.DownStream {
-						*ch <- msg
-					}
-				}
-			}
-		}()
+		in.startConsumerLoop("kafka", msgChan)
 
 	case InputTypeAliyunSLS:
 		if in.slsConsumer != nil {
@@ -455,52 +1080,211 @@ func (in *Input) Start() error {
 		cons.Start()
 
 		// Start consumer goroutine with proper management
-		in.wg.Add(1)
-		go func() {
-			defer in.wg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in sls consumer goroutine", "input", in.Id, "panic", r)
-					// Set input status to error on panic
-					in.SetStatus(common.StatusError, fmt.Errorf("sls consumer goroutine panic: %v", r))
-				}
-			}()
+		in.startConsumerLoop("sls", msgChan)
 
-			for {
-				select {
-				case <-in.stopChan:
-					logger.Info("SLS consumer goroutine stopping", "input", in.Id)
-					return
-				case msg, ok := <-msgChan:
-					if !ok {
-						logger.Info("SLS message channel closed", "input", in.Id)
-						return
-					}
+	case InputTypeOkta, InputTypeGoogleWorkspace, InputTypeGitHubAudit:
+		if in.auditLogPuller != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("audit log puller already running for input %s", in.Id))
+			return fmt.Errorf("audit log puller already running for input %s", in.Id)
+		}
+		if in.auditLogCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("audit log configuration missing for input %s", in.Id))
+			return fmt.Errorf("audit log configuration missing for input %s", in.Id)
+		}
 
-					atomic.AddUint64(&in.consumeTotal, 1)
+		msgChan := make(chan map[string]interface{}, 512)
+		puller, err := common.NewAuditLogPuller(in.Id, *in.auditLogCfg, msgChan)
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create audit log puller for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create audit log puller for input %s: %v", in.Id, err)
+		}
+		in.auditLogPuller = puller
+		in.internalMsgChan = msgChan
 
-					// Sample the message
-					if in.sampler != nil {
-						in.sampler.Sample(msg, in.ProjectNodeSequence)
-					}
+		puller.Start()
 
-					// Add input ID to message data
-					if msg == nil {
-						msg = make(map[string]interface{}, 2)
-					}
-					msg["_hub_input"] = in.Id
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop(string(in.Type), msgChan)
 
-					// Parse with grok if configured
-					msg = in.parseWithGrok(msg)
+	case InputTypeOTLP:
+		if in.otlpReceiver != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("otlp receiver already running for input %s", in.Id))
+			return fmt.Errorf("otlp receiver already running for input %s", in.Id)
+		}
+		if in.otlpCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("otlp configuration missing for input %s", in.Id))
+			return fmt.Errorf("otlp configuration missing for input %s", in.Id)
+		}
 
-					// Forward to downstream with blocking sends to ensure no data loss
-					// If any downstream channel is full, this will block and prevent further consumption
-					for _, ch := range in.DownStream {
-						*ch <- msg
-					}
-				}
-			}
-		}()
+		msgChan := make(chan map[string]interface{}, 512)
+		receiver, err := common.NewOTLPReceiver(in.otlpCfg.GRPCListen, in.otlpCfg.HTTPListen, in.otlpCfg.MaxMessageSize, msgChan)
+		if err == nil {
+			err = receiver.Start()
+		}
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to start otlp receiver for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to start otlp receiver for input %s: %v", in.Id, err)
+		}
+		in.otlpReceiver = receiver
+		in.internalMsgChan = msgChan
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("otlp", msgChan)
+
+	case InputTypeFederation:
+		if in.fedReceiver != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("federation receiver already running for input %s", in.Id))
+			return fmt.Errorf("federation receiver already running for input %s", in.Id)
+		}
+		if in.fedCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("federation configuration missing for input %s", in.Id))
+			return fmt.Errorf("federation configuration missing for input %s", in.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		receiver, err := common.NewFederationReceiver(common.FederationReceiverConfig{
+			Listen:         in.fedCfg.Listen,
+			HubID:          in.fedCfg.HubID,
+			TLS:            in.fedCfg.TLS,
+			AllowedHubs:    in.fedCfg.AllowedHubs,
+			MaxHops:        in.fedCfg.MaxHops,
+			MaxMessageSize: in.fedCfg.MaxMessageSize,
+		}, msgChan)
+		if err == nil {
+			err = receiver.Start()
+		}
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to start federation receiver for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to start federation receiver for input %s: %v", in.Id, err)
+		}
+		in.fedReceiver = receiver
+		in.internalMsgChan = msgChan
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("federation", msgChan)
+
+	case InputTypeJournald:
+		if in.journaldReader != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("journald reader already running for input %s", in.Id))
+			return fmt.Errorf("journald reader already running for input %s", in.Id)
+		}
+
+		readerCfg := common.JournaldReaderConfig{SinceNow: true}
+		if in.journaldCfg != nil {
+			readerCfg.Units = in.journaldCfg.Units
+			readerCfg.Identifiers = in.journaldCfg.Identifiers
+			readerCfg.Matches = in.journaldCfg.Matches
+			readerCfg.Priority = in.journaldCfg.Priority
+			readerCfg.Directory = in.journaldCfg.Directory
+			readerCfg.SinceNow = in.journaldCfg.StartPosition != "beginning"
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		reader, err := common.NewJournaldReader(in.Id, readerCfg, msgChan)
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create journald reader for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create journald reader for input %s: %v", in.Id, err)
+		}
+		in.journaldReader = reader
+		in.internalMsgChan = msgChan
+		reader.Start()
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("journald", msgChan)
+
+	case InputTypeWinlog:
+		if in.winlogReader != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("winlog reader already running for input %s", in.Id))
+			return fmt.Errorf("winlog reader already running for input %s", in.Id)
+		}
+		if in.winlogCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("winlog configuration missing for input %s", in.Id))
+			return fmt.Errorf("winlog configuration missing for input %s", in.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		reader, err := common.NewWinlogReader(in.Id, common.WinlogReaderConfig{
+			Channels:      in.winlogCfg.Channels,
+			StartAtOldest: in.winlogCfg.StartPosition == "beginning",
+		}, msgChan)
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create winlog reader for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create winlog reader for input %s: %v", in.Id, err)
+		}
+		in.winlogReader = reader
+		in.internalMsgChan = msgChan
+		reader.Start()
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("winlog", msgChan)
+
+	case InputTypeCDC:
+		if in.cdcReader != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("cdc reader already running for input %s", in.Id))
+			return fmt.Errorf("cdc reader already running for input %s", in.Id)
+		}
+		if in.cdcCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("cdc configuration missing for input %s", in.Id))
+			return fmt.Errorf("cdc configuration missing for input %s", in.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		reader, err := common.NewCDCReader(in.Id, in.cdcCfg.readerConfig(), msgChan)
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create cdc reader for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create cdc reader for input %s: %v", in.Id, err)
+		}
+		in.cdcReader = reader
+		in.internalMsgChan = msgChan
+		reader.Start()
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("cdc", msgChan)
+
+	case InputTypePulsar:
+		if in.pulsarConsumer != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("pulsar consumer already running for input %s", in.Id))
+			return fmt.Errorf("pulsar consumer already running for input %s", in.Id)
+		}
+		if in.pulsarCfg == nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("pulsar configuration missing for input %s", in.Id))
+			return fmt.Errorf("pulsar configuration missing for input %s", in.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		cons, err := common.NewPulsarConsumer(in.Id, in.pulsarCfg.consumerConfig(), msgChan)
+		if err != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("failed to create pulsar consumer for input %s: %v", in.Id, err))
+			return fmt.Errorf("failed to create pulsar consumer for input %s: %v", in.Id, err)
+		}
+		in.pulsarConsumer = cons
+		in.internalMsgChan = msgChan
+		cons.Start()
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("pulsar", msgChan)
+
+	case InputTypeAPIAccessLog:
+		if in.accessReader != nil {
+			in.SetStatus(common.StatusError, fmt.Errorf("api access log reader already running for input %s", in.Id))
+			return fmt.Errorf("api access log reader already running for input %s", in.Id)
+		}
+
+		var writesOnly bool
+		var routes []string
+		if in.accessLogCfg != nil {
+			writesOnly = in.accessLogCfg.WritesOnly
+			routes = in.accessLogCfg.Routes
+		}
+
+		msgChan := make(chan map[string]interface{}, 512)
+		reader := common.NewAPIAccessLogReader(in.Id, writesOnly, routes, msgChan)
+		in.accessReader = reader
+		in.internalMsgChan = msgChan
+		reader.Start()
+
+		// Start consumer goroutine with proper management
+		in.startConsumerLoop("api_access_log", msgChan)
 
 	default:
 		in.SetStatus(common.StatusError, fmt.Errorf("unsupported input type %s", in.Type))
@@ -511,6 +1295,77 @@ func (in *Input) Start() error {
 	return nil
 }
 
+// startConsumerLoop starts the goroutine that forwards messages from a source channel to downstream components
+func (in *Input) startConsumerLoop(source string, msgChan chan map[string]interface{}) {
+	in.wg.Add(1)
+	go func() {
+		defer in.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in input consumer goroutine", "input", in.Id, "source", source, "panic", r)
+				// Set input status to error on panic
+				in.SetStatus(common.StatusError, fmt.Errorf("%s consumer goroutine panic: %v", source, r))
+			}
+		}()
+
+		for {
+			select {
+			case <-in.stopChan:
+				logger.Info("Input consumer goroutine stopping", "input", in.Id, "source", source)
+				return
+			case msg, ok := <-msgChan:
+				if !ok {
+					logger.Info("Input message channel closed", "input", in.Id, "source", source)
+					return
+				}
+				in.processMessage(msg)
+			}
+		}
+	}()
+}
+
+// processMessage counts, samples, enriches and forwards a single consumed message
+func (in *Input) processMessage(msg map[string]interface{}) {
+	// Only increment total count - QPS calculation removed
+	atomic.AddUint64(&in.consumeTotal, 1)
+
+	// Sample the message
+	if in.sampler != nil {
+		in.sampler.Sample(msg, in.ProjectNodeSequence)
+	}
+
+	// Add input ID to message data
+	if msg == nil {
+		msg = make(map[string]interface{}, 2)
+	}
+	msg["_hub_input"] = in.Id
+
+	// Every downstream takes a reference to the checkpoint token, the input gives its own back
+	// once the event is handed over or dropped as a duplicate
+	token := common.GetDeliveryToken(msg)
+	defer token.Release()
+
+	// Parse with grok if configured
+	msg = in.parseWithGrok(msg)
+
+	if in.duplicate(msg) {
+		return
+	}
+	in.mirror(msg)
+
+	quarantined := in.quarantine(msg)
+
+	// Forward to downstream with blocking sends to ensure no data loss
+	// If any downstream channel is full, this will block and prevent further consumption
+	for key, ch := range in.DownStream {
+		if in.QuarantineStream[key] != quarantined {
+			continue
+		}
+		token.Retain()
+		*ch <- msg
+	}
+}
+
 // StartForTesting starts the input component in testing mode
 // This version initializes basic infrastructure but doesn't connect to external data sources
 func (in *Input) StartForTesting() error {
@@ -540,15 +1395,135 @@ func (in *Input) ProcessTestData(data map[string]interface{}) {
 	// Parse with grok if configured - same as production logic
 	data = in.parseWithGrok(data)
 
+	quarantined := in.quarantine(data)
+
 	// Forward to downstream with blocking sends to ensure no data loss
 	// If any downstream channel is full, this will block and prevent further processing
-	for _, ch := range in.DownStream {
+	for key, ch := range in.DownStream {
+		if in.QuarantineStream[key] != quarantined {
+			continue
+		}
 		*ch <- data
 	}
 
 	logger.Debug("Test data processed through input", "input", in.Id, "downstream_count", len(in.DownStream))
 }
 
+// AddMirror registers fn to receive a copy of every event consumed by this input that passed deduplication.
+// fn is called on the consumer goroutine and must not block.
+func (in *Input) AddMirror(key string, fn func(map[string]interface{})) {
+	in.mirrorMu.Lock()
+	defer in.mirrorMu.Unlock()
+	if in.mirrors == nil {
+		in.mirrors = make(map[string]func(map[string]interface{}))
+	}
+	in.mirrors[key] = fn
+}
+
+// RemoveMirror unregisters a mirror added with AddMirror
+func (in *Input) RemoveMirror(key string) {
+	in.mirrorMu.Lock()
+	defer in.mirrorMu.Unlock()
+	delete(in.mirrors, key)
+}
+
+func (in *Input) mirror(msg map[string]interface{}) {
+	in.mirrorMu.RLock()
+	defer in.mirrorMu.RUnlock()
+	for _, fn := range in.mirrors {
+		// Mirrored copies are not part of the delivery of the event
+		cp := common.MapDeepCopy(msg)
+		delete(cp, common.DeliveryTokenField)
+		fn(cp)
+	}
+}
+
+// SetAtLeastOnce records whether a project needs at-least-once delivery from this input. While one
+// does, the Kafka consumer only commits the offsets of records delivered by every output.
+func (in *Input) SetAtLeastOnce(projectID string, on bool) {
+	in.atLeastOnceMu.Lock()
+	defer in.atLeastOnceMu.Unlock()
+	if on {
+		if in.atLeastOnceProjects == nil {
+			in.atLeastOnceProjects = make(map[string]bool)
+		}
+		in.atLeastOnceProjects[projectID] = true
+	} else {
+		delete(in.atLeastOnceProjects, projectID)
+	}
+	if in.kafkaConsumer != nil {
+		in.kafkaConsumer.SetAtLeastOnce(len(in.atLeastOnceProjects) > 0)
+	}
+}
+
+func (in *Input) atLeastOnce() bool {
+	in.atLeastOnceMu.Lock()
+	defer in.atLeastOnceMu.Unlock()
+	return len(in.atLeastOnceProjects) > 0
+}
+
+// InjectCanary forwards a synthetic canary event to the downstream keys in targets, the components
+// of the project the canary measures, so a shared input does not hand it to other projects.
+// Sends are non-blocking so that latency measurement never applies backpressure to real traffic.
+func (in *Input) InjectCanary(event map[string]interface{}, targets []string) {
+	if in.Status != common.StatusRunning {
+		return
+	}
+	for key, ch := range in.DownStream {
+		if in.QuarantineStream[key] || !slices.Contains(targets, key) {
+			continue
+		}
+		select {
+		case *ch <- event:
+		default:
+			logger.Debug("Downstream channel full, skipping canary event", "input", in.Id)
+		}
+	}
+}
+
+// StartReplay streams archived events through this input as if they were consumed live.
+// Replayed events are tagged with common.ReplayFieldName and are only forwarded to the
+// downstream keys in targets, or to all downstream components when targets is empty.
+func (in *Input) StartReplay(cfg common.ReplayConfig, projectID string, targets []string) (*common.Replay, error) {
+	if in.Status != common.StatusRunning {
+		return nil, fmt.Errorf("input %s is not running", in.Id)
+	}
+	stopChan := in.stopChan
+
+	emit := func(ctx context.Context, msg map[string]interface{}) bool {
+		msg["_hub_input"] = in.Id
+		msg = in.parseWithGrok(msg)
+		if in.duplicate(msg) {
+			return true
+		}
+		quarantined := in.quarantine(msg)
+
+		for key, ch := range in.DownStream {
+			if len(targets) > 0 && !slices.Contains(targets, key) {
+				continue
+			}
+			if in.QuarantineStream[key] != quarantined {
+				continue
+			}
+			select {
+			case *ch <- msg:
+			case <-ctx.Done():
+				return false
+			case <-stopChan:
+				return false
+			}
+		}
+		return true
+	}
+
+	replay, err := common.NewReplay(in.Id, projectID, cfg, emit)
+	if err != nil {
+		return nil, err
+	}
+	replay.Start()
+	return replay, nil
+}
+
 // StopForTesting stops the input component quickly for testing purposes
 func (in *Input) StopForTesting() error {
 	logger.Info("Stopping test input", "input", in.Id)
@@ -562,6 +1537,7 @@ func (in *Input) StopForTesting() error {
 	// Note: DownStream connections are managed by Project in production
 	// For testing, we can clear them since test inputs are isolated
 	in.DownStream = make(map[string]*chan map[string]interface{})
+	in.QuarantineStream = make(map[string]bool)
 
 	// Reset counters for testing cleanup
 	in.ResetConsumeTotal()
@@ -595,6 +1571,7 @@ func (in *Input) Stop() error {
 
 	// Step 1: Stop consumers first to prevent new messages from flowing in
 	logger.Info("Stopping input consumers to prevent new data", "input", in.Id)
+	common.StopInputReplays(in.Id)
 	if in.kafkaConsumer != nil {
 		in.kafkaConsumer.Close()
 		in.kafkaConsumer = nil
@@ -605,6 +1582,38 @@ func (in *Input) Stop() error {
 		}
 		in.slsConsumer = nil
 	}
+	if in.auditLogPuller != nil {
+		in.auditLogPuller.Close()
+		in.auditLogPuller = nil
+	}
+	if in.otlpReceiver != nil {
+		in.otlpReceiver.Close()
+		in.otlpReceiver = nil
+	}
+	if in.fedReceiver != nil {
+		in.fedReceiver.Close()
+		in.fedReceiver = nil
+	}
+	if in.journaldReader != nil {
+		in.journaldReader.Close()
+		in.journaldReader = nil
+	}
+	if in.winlogReader != nil {
+		in.winlogReader.Close()
+		in.winlogReader = nil
+	}
+	if in.cdcReader != nil {
+		in.cdcReader.Close()
+		in.cdcReader = nil
+	}
+	if in.pulsarConsumer != nil {
+		in.pulsarConsumer.Close()
+		in.pulsarConsumer = nil
+	}
+	if in.accessReader != nil {
+		in.accessReader.Close()
+		in.accessReader = nil
+	}
 
 	// Step 2: Signal goroutines to stop consuming from internal channel
 	// This prevents them from processing more messages while we wait for drain
@@ -793,10 +1802,21 @@ func (in *Input) CheckConnectivity() map[string]interface{} {
 
 		// Add consumer metrics if available
 		if in.kafkaConsumer != nil {
-			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+			metrics := map[string]interface{}{
 				"consume_total":   in.GetConsumeTotal(),
 				"consumer_active": true,
 			}
+			if in.atLeastOnce() {
+				pending, held, rewound := in.kafkaConsumer.CheckpointStats()
+				metrics["delivery_pending"] = pending
+				metrics["delivery_held_partitions"] = held
+				metrics["delivery_rewinds"] = rewound
+				if len(held) > 0 && result["status"] == "success" {
+					result["status"] = "warning"
+					result["message"] = "Offsets of some partitions are held back by failed deliveries"
+				}
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
 		} else {
 			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
 				"consumer_active": false,
@@ -910,12 +1930,302 @@ func (in *Input) CheckConnectivity() map[string]interface{} {
 			}
 		}
 
+	case InputTypeOkta, InputTypeGoogleWorkspace, InputTypeGitHubAudit:
+		if in.auditLogCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Audit log configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "Audit log configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		connectionInfo := map[string]interface{}{
+			"provider":      string(in.auditLogCfg.Provider),
+			"poll_interval": in.auditLogCfg.PollInterval.String(),
+		}
+		switch in.Type {
+		case InputTypeOkta:
+			connectionInfo["domain"] = in.auditLogCfg.Domain
+		case InputTypeGoogleWorkspace:
+			connectionInfo["subject"] = in.auditLogCfg.Subject
+			connectionInfo["application"] = in.auditLogCfg.Application
+		case InputTypeGitHubAudit:
+			connectionInfo["organization"] = in.auditLogCfg.Organization
+			connectionInfo["enterprise"] = in.auditLogCfg.Enterprise
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+
+		if err := common.TestAuditLogConnection(*in.auditLogCfg); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to query audit log API"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully queried audit log API"
+
+		if in.auditLogPuller != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":      in.GetConsumeTotal(),
+				"pulled_total":       in.auditLogPuller.GetPulledTotal(),
+				"rate_limited_total": in.auditLogPuller.GetRateLimitedTotal(),
+				"consumer_active":    true,
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
+	case InputTypeOTLP:
+		if in.otlpCfg == nil {
+			result["status"] = "error"
+			result["message"] = "OTLP configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			return result
+		}
+
+		// OTLP is a push receiver, so there is no upstream system to connect to
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"grpc_listen": in.otlpCfg.GRPCListen,
+			"http_listen": in.otlpCfg.HTTPListen,
+		}
+		if in.otlpReceiver != nil {
+			result["message"] = "OTLP receiver is listening"
+			result["details"].(map[string]interface{})["connection_status"] = "listening"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"received_total":  in.otlpReceiver.GetReceivedTotal(),
+				"rejected_total":  in.otlpReceiver.GetRejectedTotal(),
+				"consumer_active": true,
+			}
+		} else {
+			result["message"] = "OTLP receiver is ready (no external connection required)"
+			result["details"].(map[string]interface{})["connection_status"] = "not_applicable"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
+	case InputTypeFederation:
+		if in.fedCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Federation configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			return result
+		}
+
+		// Regional hubs push to the receiver, so there is no upstream system to connect to
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"listen":       in.fedCfg.Listen,
+			"hub_id":       in.fedCfg.HubID,
+			"allowed_hubs": in.fedCfg.AllowedHubs,
+		}
+		if in.fedReceiver != nil {
+			result["message"] = "Federation receiver is listening"
+			result["details"].(map[string]interface{})["connection_status"] = "listening"
+			metrics := map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"consumer_active": true,
+			}
+			for k, v := range in.fedReceiver.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["message"] = "Federation receiver is ready (no external connection required)"
+			result["details"].(map[string]interface{})["connection_status"] = "not_applicable"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
+	case InputTypeJournald, InputTypeWinlog:
+		if in.Type == InputTypeWinlog && runtime.GOOS != "windows" {
+			result["status"] = "error"
+			result["message"] = "winlog input is only supported on Windows"
+			result["details"].(map[string]interface{})["connection_status"] = "unsupported"
+			return result
+		}
+
+		// Host-local inputs read the local journal / event log, there is no remote system to connect to
+		info := map[string]interface{}{"node_id": common.GetNodeID()}
+		if in.journaldCfg != nil {
+			info["units"] = in.journaldCfg.Units
+			info["identifiers"] = in.journaldCfg.Identifiers
+		}
+		if in.winlogCfg != nil {
+			channels := make([]string, 0, len(in.winlogCfg.Channels))
+			for _, ch := range in.winlogCfg.Channels {
+				channels = append(channels, ch.Name)
+			}
+			info["channels"] = channels
+		}
+		result["details"].(map[string]interface{})["connection_info"] = info
+
+		var readTotal uint64
+		active := false
+		if in.journaldReader != nil {
+			readTotal, active = in.journaldReader.GetReadTotal(), true
+		} else if in.winlogReader != nil {
+			readTotal, active = in.winlogReader.GetReadTotal(), true
+		}
+		if active {
+			result["message"] = fmt.Sprintf("%s reader is running", in.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connected"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"read_total":      readTotal,
+				"consumer_active": true,
+			}
+		} else {
+			result["message"] = fmt.Sprintf("%s reader is ready (no external connection required)", in.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_applicable"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
+	case InputTypeCDC:
+		if in.cdcCfg == nil {
+			result["status"] = "error"
+			result["message"] = "CDC configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			return result
+		}
+
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"driver":   in.cdcCfg.Driver,
+			"host":     in.cdcCfg.Host,
+			"port":     in.cdcCfg.Port,
+			"database": in.cdcCfg.Database,
+			"tables":   in.cdcCfg.Tables,
+		}
+
+		if err := common.TestCDCConnection(in.cdcCfg.readerConfig()); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to database"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+
+		result["message"] = "Successfully connected to database"
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		if in.cdcReader != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"read_total":      in.cdcReader.GetReadTotal(),
+				"reader_active":   in.cdcReader.IsActive(),
+				"consumer_active": true,
+			}
+		}
+
+	case InputTypePulsar:
+		if in.pulsarCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Pulsar configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			return result
+		}
+
+		subType, _ := common.NormalizePulsarSubscriptionType(in.pulsarCfg.SubscriptionType)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"service_url":       in.pulsarCfg.ServiceURL,
+			"topic":             in.pulsarCfg.Topic,
+			"subscription":      in.pulsarCfg.Subscription,
+			"subscription_type": subType,
+		}
+
+		if err := common.TestPulsarConnection(in.pulsarCfg.consumerConfig()); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to Pulsar"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+
+		result["message"] = "Successfully connected to Pulsar"
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		if in.pulsarConsumer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"read_total":      in.pulsarConsumer.GetReadTotal(),
+				"consumer_active": true,
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
+	case InputTypeAPIAccessLog:
+		// Requests to this hub are read in-process, there is no remote system to connect to
+		info := map[string]interface{}{"node_id": common.GetNodeID()}
+		if in.accessLogCfg != nil {
+			info["writes_only"] = in.accessLogCfg.WritesOnly
+			info["routes"] = in.accessLogCfg.Routes
+		}
+		result["details"].(map[string]interface{})["connection_info"] = info
+		if in.accessReader != nil {
+			result["message"] = "API access log reader is running"
+			result["details"].(map[string]interface{})["connection_status"] = "connected"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consume_total":   in.GetConsumeTotal(),
+				"read_total":      in.accessReader.GetReadTotal(),
+				"dropped_total":   in.accessReader.GetDroppedTotal(),
+				"consumer_active": true,
+			}
+		} else {
+			result["message"] = "API access log reader is ready (no external connection required)"
+			result["details"].(map[string]interface{})["connection_status"] = "not_applicable"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"consumer_active": false,
+			}
+		}
+
 	default:
 		result["status"] = "error"
 		result["message"] = "Unsupported input type"
 		result["details"].(map[string]interface{})["connection_status"] = "unsupported"
 	}
 
+	if in.schema != nil {
+		schema := map[string]interface{}{
+			"quarantine_total": in.GetQuarantineTotal(),
+			"redis_list":       in.Config.Schema.RedisList,
+		}
+		if c := in.Config.Schema.Contract; c != nil {
+			contract := map[string]interface{}{
+				"owner":  c.Owner,
+				"notify": c.Notify,
+			}
+			if in.contract != nil {
+				for k, v := range in.contract.GetStats() {
+					contract[k] = v
+				}
+			}
+			schema["contract"] = contract
+		}
+		result["details"].(map[string]interface{})["schema"] = schema
+	}
+	if in.dedupFields != nil {
+		result["details"].(map[string]interface{})["dedup"] = map[string]interface{}{
+			"duplicates_dropped": in.GetDedupTotal(),
+			"window_seconds":     in.dedupWindow,
+		}
+	}
+
 	return result
 }
 
@@ -941,6 +2251,18 @@ func NewFromExisting(existing *Input, newProjectNodeSequence string) (*Input, er
 		DownStream:          make(map[string]*chan map[string]interface{}, 0),
 		kafkaCfg:            existing.kafkaCfg,
 		aliyunSLSCfg:        existing.aliyunSLSCfg,
+		auditLogCfg:         existing.auditLogCfg,
+		otlpCfg:             existing.otlpCfg,
+		fedCfg:              existing.fedCfg,
+		journaldCfg:         existing.journaldCfg,
+		winlogCfg:           existing.winlogCfg,
+		cdcCfg:              existing.cdcCfg,
+		pulsarCfg:           existing.pulsarCfg,
+		accessLogCfg:        existing.accessLogCfg,
+		schema:              existing.schema,
+		QuarantineStream:    make(map[string]bool),
+		dedupFields:         existing.dedupFields,
+		dedupWindow:         existing.dedupWindow,
 		Config:              existing.Config,
 		Status:              common.StatusStopped,
 		// Note: Runtime fields (kafkaConsumer, slsConsumer, wg, stopChan) are intentionally not copied
@@ -0,0 +1,92 @@
+package input
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSchemaQuarantineRouting(t *testing.T) {
+	config := `
+type: kafka
+kafka:
+  brokers:
+    - "localhost:9092"
+  group: "test-group"
+  topic: "test-topic"
+schema:
+  definition:
+    type: object
+    required: [host]
+    additionalProperties: false
+    properties:
+      host: {type: string, minLength: 1}
+      pid: {type: integer}
+`
+
+	in, err := NewInput("", config, "test-input")
+	if err != nil {
+		t.Fatalf("Failed to create input: %v", err)
+	}
+
+	valid := make(chan map[string]interface{}, 4)
+	quarantine := make(chan map[string]interface{}, 4)
+	in.DownStream["valid"] = &valid
+	in.DownStream["quarantine"] = &quarantine
+	in.QuarantineStream["quarantine"] = true
+
+	in.ProcessTestData(map[string]interface{}{"host": "web-1", "pid": float64(42)})
+	in.ProcessTestData(map[string]interface{}{"host": "web-1", "pid": "42"})
+	in.ProcessTestData(map[string]interface{}{"pid": float64(1), "extra": true})
+
+	if len(valid) != 1 {
+		t.Fatalf("expected 1 valid event, got %d", len(valid))
+	}
+	if len(quarantine) != 2 {
+		t.Fatalf("expected 2 quarantined events, got %d", len(quarantine))
+	}
+	if in.GetQuarantineTotal() != 2 {
+		t.Fatalf("expected quarantine total 2, got %d", in.GetQuarantineTotal())
+	}
+
+	msg := <-quarantine
+	errs, ok := msg[SchemaErrorsField].([]string)
+	if !ok || len(errs) == 0 {
+		t.Fatalf("expected schema errors on quarantined event, got %v", msg[SchemaErrorsField])
+	}
+}
+
+func TestSchemaVerifyRejectsInvalidDefinition(t *testing.T) {
+	config := `
+type: journald
+schema:
+  definition:
+    type: text
+`
+	if err := Verify("", config); err == nil {
+		t.Fatalf("expected verify error for invalid schema type")
+	}
+}
+
+func TestSchemaVerifyContract(t *testing.T) {
+	config := `
+type: kafka
+kafka:
+  brokers:
+    - "localhost:9092"
+  group: "test-group"
+  topic: "test-topic"
+schema:
+  definition:
+    type: object
+  contract:
+    owner: team-edr
+    notify: %s
+    url: https://hooks.slack.com/services/T000/B000/XXXX
+`
+	if err := Verify("", fmt.Sprintf(config, "slack")); err != nil {
+		t.Fatalf("unexpected verify error: %v", err)
+	}
+	if err := Verify("", fmt.Sprintf(config, "pager")); err == nil {
+		t.Fatalf("expected verify error for unsupported notify type")
+	}
+}
@@ -8,9 +8,13 @@ import (
 	// time plugins
 	tday "AgentSmith-HUB/local_plugin/time/dayofweek"
 	thour "AgentSmith-HUB/local_plugin/time/hourofday"
+	tnormalize "AgentSmith-HUB/local_plugin/time/normalize_time"
 	tnow "AgentSmith-HUB/local_plugin/time/now"
 	tdate "AgentSmith-HUB/local_plugin/time/timestamp_to_date"
 
+	// unit conversion
+	uconvert "AgentSmith-HUB/local_plugin/unit/convert_unit"
+
 	// encoding / hash
 	b64dec "AgentSmith-HUB/local_plugin/encoding/base64_decode"
 	b64enc "AgentSmith-HUB/local_plugin/encoding/base64_encode"
@@ -66,6 +70,11 @@ var LocalPluginInterfaceAndBoolRes = map[string]func(...interface{}) (interface{
 	"hourOfDay": thour.Eval,
 	"tsToDate":  tdate.Eval,
 
+	"normalizeTime": tnormalize.Eval,
+
+	// unit conversion
+	"convertUnit": uconvert.Eval,
+
 	// encoding / hash
 	"base64Encode": b64enc.Eval,
 	"base64Decode": b64dec.Eval,
@@ -108,6 +117,11 @@ var LocalPluginDesc = map[string]string{
 	"hourOfDay": "Append: hour of day 0-23. Args: optional timestamp.",
 	"tsToDate":  "Append: convert Unix timestamp to RFC3339 string. Args: timestamp int64.",
 
+	"normalizeTime": "Append: parse a timestamp and return RFC3339 in UTC. Args: value, optional formats (unix|unix_ms|unix_us|unix_ns|rfc3339|rfc1123|clf|datetime|Go layout), optional \"tz=<zone>\" for layouts without offset. Without formats unix units and common layouts are detected.",
+
+	// unit conversion append
+	"convertUnit": "Append: convert between units of the same kind: bytes (b, kb, mb, gb, tb, pb; 1024-based), bits (bit, kbit, mbit, gbit) or time (ns, us, ms, s, min, h, d). Args: value, from, to. Empty from reads the unit from the value suffix, e.g. \"512KB\".",
+
 	// encoding / hash append
 	"base64Encode": "Append: base64 encode string. Args: plain string.",
 	"base64Decode": "Append: base64 decode string. Args: encoded string.",
@@ -0,0 +1,159 @@
+package normalize_time
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// namedFormats are accepted besides Go reference layouts such as "2006-01-02 15:04:05"
+var namedFormats = map[string]string{
+	"rfc3339":      time.RFC3339Nano,
+	"rfc1123":      time.RFC1123,
+	"rfc1123z":     time.RFC1123Z,
+	"rfc822":       time.RFC822,
+	"rfc822z":      time.RFC822Z,
+	"ansic":        time.ANSIC,
+	"unixdate":     time.UnixDate,
+	"datetime":     time.DateTime,
+	"clf":          "02/Jan/2006:15:04:05 -0700", // Apache/Nginx access logs
+	"iso8601":      "2006-01-02T15:04:05.999999999",
+	"iso8601basic": "20060102T150405Z0700",
+}
+
+// autoLayouts are tried in order when no format is given
+var autoLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.ANSIC,
+	"02/Jan/2006:15:04:05 -0700",
+	time.DateOnly,
+}
+
+// Eval parses a timestamp and returns it as an RFC3339 string in UTC.
+// Args: value (string or number), then optional formats tried in order: unix, unix_ms, unix_us,
+// unix_ns, a named format (rfc3339, rfc1123, clf, datetime, ...) or a Go layout. An argument
+// "tz=<IANA zone>" sets the zone of layouts without offset, default UTC.
+// Without formats numbers are read as unix time in s/ms/us/ns by magnitude and strings by common layouts.
+func Eval(args ...interface{}) (interface{}, bool, error) {
+	if len(args) == 0 {
+		return nil, false, fmt.Errorf("normalizeTime requires a value")
+	}
+
+	loc := time.UTC
+	var formats []string
+	for _, arg := range args[1:] {
+		f, ok := arg.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("format must be a string, got %T", arg)
+		}
+		if zone, ok := strings.CutPrefix(f, "tz="); ok {
+			l, err := time.LoadLocation(zone)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid time zone %q: %w", zone, err)
+			}
+			loc = l
+			continue
+		}
+		formats = append(formats, f)
+	}
+
+	t, err := parse(args[0], formats, loc)
+	if err != nil {
+		return nil, false, err
+	}
+	return t.UTC().Format(time.RFC3339Nano), true, nil
+}
+
+func parse(value interface{}, formats []string, loc *time.Location) (time.Time, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, fmt.Errorf("value is empty")
+	case time.Time:
+		return v, nil
+	case string:
+		s = strings.TrimSpace(v)
+	case json.Number:
+		s = v.String()
+	case float64, float32, int, int64, int32, uint, uint64, uint32:
+		s = fmt.Sprint(v)
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value type %T", value)
+	}
+	if s == "" {
+		return time.Time{}, fmt.Errorf("value is empty")
+	}
+
+	if len(formats) == 0 {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return fromUnix(n, autoUnixUnit(n)), nil
+		}
+		for _, layout := range autoLayouts {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized time format: %s", s)
+	}
+
+	for _, format := range formats {
+		if unit, ok := unixUnit(format); ok {
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return fromUnix(n, unit), nil
+			}
+			continue
+		}
+		layout := format
+		if named, ok := namedFormats[strings.ToLower(format)]; ok {
+			layout = named
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("time %q does not match any of %v", s, formats)
+}
+
+func unixUnit(format string) (time.Duration, bool) {
+	switch strings.ToLower(format) {
+	case "unix", "unix_s", "epoch":
+		return time.Second, true
+	case "unix_ms", "epoch_millis":
+		return time.Millisecond, true
+	case "unix_us":
+		return time.Microsecond, true
+	case "unix_ns":
+		return time.Nanosecond, true
+	}
+	return 0, false
+}
+
+// autoUnixUnit guesses the unit of a unix timestamp from its magnitude, valid for dates after 1973
+func autoUnixUnit(n float64) time.Duration {
+	switch abs := math.Abs(n); {
+	case abs >= 1e17:
+		return time.Nanosecond
+	case abs >= 1e14:
+		return time.Microsecond
+	case abs >= 1e11:
+		return time.Millisecond
+	default:
+		return time.Second
+	}
+}
+
+func fromUnix(n float64, unit time.Duration) time.Time {
+	sec, frac := math.Modf(n * float64(unit) / float64(time.Second))
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
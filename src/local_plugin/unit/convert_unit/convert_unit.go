@@ -0,0 +1,111 @@
+package convert_unit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type unit struct {
+	kind   string
+	factor float64 // in bytes, bits or seconds
+}
+
+// units are case-insensitive. Byte multiples are binary (1 KB = 1024 bytes) as in most system logs,
+// bit rates are decimal (1 kbit = 1000 bits) as in network devices. Single letters other than
+// b, s, h and d are left out on purpose: "m" could mean minutes or megabytes.
+var units = map[string]unit{
+	"b": {"bytes", 1}, "byte": {"bytes", 1}, "bytes": {"bytes", 1},
+	"kb": {"bytes", 1 << 10}, "kib": {"bytes", 1 << 10},
+	"mb": {"bytes", 1 << 20}, "mib": {"bytes", 1 << 20},
+	"gb": {"bytes", 1 << 30}, "gib": {"bytes", 1 << 30},
+	"tb": {"bytes", 1 << 40}, "tib": {"bytes", 1 << 40},
+	"pb": {"bytes", 1 << 50}, "pib": {"bytes", 1 << 50},
+
+	"bit": {"bits", 1}, "bits": {"bits", 1},
+	"kbit": {"bits", 1e3}, "mbit": {"bits", 1e6}, "gbit": {"bits", 1e9},
+
+	"ns": {"seconds", 1e-9}, "us": {"seconds", 1e-6}, "µs": {"seconds", 1e-6},
+	"ms": {"seconds", 1e-3}, "s": {"seconds", 1}, "sec": {"seconds", 1}, "seconds": {"seconds", 1},
+	"min": {"seconds", 60}, "minutes": {"seconds", 60},
+	"h": {"seconds", 3600}, "hours": {"seconds", 3600},
+	"d": {"seconds", 86400}, "days": {"seconds", 86400},
+}
+
+// Eval converts a value between units of the same kind (bytes, bits or time).
+// Args: value (number or string), from unit, to unit. With an empty from unit the value
+// carries its unit as suffix, e.g. "512KB" or "250ms".
+// Whole results are returned as int64, others as float64.
+func Eval(args ...interface{}) (interface{}, bool, error) {
+	if len(args) != 3 {
+		return nil, false, fmt.Errorf("convertUnit requires 3 args: value, from, to")
+	}
+	fromName, ok1 := args[1].(string)
+	toName, ok2 := args[2].(string)
+	if !ok1 || !ok2 {
+		return nil, false, fmt.Errorf("units must be strings")
+	}
+
+	value, suffix, err := number(args[0])
+	if err != nil {
+		return nil, false, err
+	}
+	if fromName == "" {
+		fromName = suffix
+	}
+	from, ok := units[strings.ToLower(strings.TrimSpace(fromName))]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown unit: %q", fromName)
+	}
+	to, ok := units[strings.ToLower(strings.TrimSpace(toName))]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown unit: %q", toName)
+	}
+	if from.kind != to.kind {
+		return nil, false, fmt.Errorf("cannot convert %s to %s", fromName, toName)
+	}
+
+	res := value * from.factor / to.factor
+	// Remove float noise such as 0.30000000000000004 before deciding whether the result is whole
+	res = math.Round(res*1e9) / 1e9
+	if res == math.Trunc(res) && math.Abs(res) < 1<<53 {
+		return int64(res), true, nil
+	}
+	return res, true, nil
+}
+
+// number returns the numeric part of a value and the unit suffix of a string value
+func number(v interface{}) (float64, string, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, "", nil
+	case float32:
+		return float64(n), "", nil
+	case int:
+		return float64(n), "", nil
+	case int64:
+		return float64(n), "", nil
+	case int32:
+		return float64(n), "", nil
+	case uint64:
+		return float64(n), "", nil
+	case json.Number:
+		f, err := n.Float64()
+		return f, "", err
+	case string:
+		s := strings.TrimSpace(n)
+		i := strings.LastIndexFunc(s, func(r rune) bool { return unicode.IsDigit(r) || r == '.' })
+		if i < 0 {
+			return 0, "", fmt.Errorf("not a number: %q", n)
+		}
+		f, err := strconv.ParseFloat(s[:i+1], 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("not a number: %q", n)
+		}
+		return f, strings.TrimSpace(s[i+1:]), nil
+	}
+	return 0, "", fmt.Errorf("unsupported value type %T", v)
+}
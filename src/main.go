@@ -19,6 +19,7 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
@@ -32,6 +33,12 @@ func main() {
 		isLeader  = flag.Bool("leader", false, "run as cluster leader")
 		apiListen = flag.String("api_listen", "0.0.0.0:8080", "API server listen address")
 		showVer   = flag.Bool("version", false, "show version")
+		preflight = flag.Bool("preflight", false, "check config, redis, ports, components and outputs, print a readiness report and exit")
+		importSrc = flag.String("import", "", "convert a logstash pipeline or vector config (logstash|vector) into components under config_root and exit")
+		importCfg = flag.String("import_file", "", "file converted by -import")
+		importID  = flag.String("import_name", "", "prefix of the component ids created by -import, default the file name")
+		ruleTests = flag.Bool("rule_tests", false, "run the tests embedded in the rulesets under config_root, print the results and rule coverage and exit")
+		plugTests = flag.Bool("plugin_tests", false, "run the plugin/<name>_test.json files under config_root, print the results and exit")
 		buildVers = "v0.1.7"
 	)
 	flag.Parse()
@@ -47,12 +54,38 @@ func main() {
 		return
 	}
 
+	// Import writes converted Logstash/Vector pipelines as components and exits
+	if *importSrc != "" {
+		os.Exit(runImport(*cfgRoot, *importSrc, *importCfg, *importID))
+	}
+
+	// Embedded rule tests gate ruleset changes in deployment pipelines
+	if *ruleTests {
+		os.Exit(runRuleTests(*cfgRoot))
+	}
+
+	// Plugin test files gate plugin changes the same way
+	if *plugTests {
+		os.Exit(runPluginTests(*cfgRoot))
+	}
+
+	// Preflight checks this node without starting it, for deployment pipelines
+	if *preflight {
+		os.Exit(runPreflight(*cfgRoot, *apiListen, *isLeader))
+	}
+
 	// Load hub config (redis etc.)
 	if err := loadHubConfig(*cfgRoot); err != nil {
 		logger.Error("load hub config", "error", err)
 		return
 	}
 
+	// Lite mode has no shared store for followers to join, so the node always leads
+	if common.Config.Lite && !*isLeader {
+		logger.Info("Lite mode runs a single node, starting as leader")
+		*isLeader = true
+	}
+
 	if *isLeader {
 		// Initialize Redis-based sample manager (stores component data samples)
 		common.InitRedisSampleManager()
@@ -61,10 +94,17 @@ func main() {
 		logger.Info("Starting in follower mode", "config_root", *cfgRoot)
 	}
 
-	// Init Redis (mandatory). If fails, terminate Hub immediately.
-	if err := common.RedisInit(common.Config.Redis, common.Config.RedisPassword); err != nil {
+	// Init Redis (mandatory unless running in lite mode). If fails, terminate Hub immediately.
+	if common.Config.Lite {
+		if err := common.RedisInitLite(common.Config.LiteDataFile); err != nil {
+			logger.Error("failed to start lite store, hub will exit", "error", err)
+			os.Exit(1)
+		}
+	} else if err := common.RedisInit(common.Config.Redis, common.Config.RedisPassword); err != nil {
 		logger.Error("failed to connect redis, hub will exit", "error", err)
 		os.Exit(1)
+	} else {
+		common.RedisInitReplicas(common.Config.RedisReplicas, common.Config.RedisPassword)
 	}
 
 	// Detect local IP & init cluster manager
@@ -110,6 +150,12 @@ func main() {
 	// Initialize daily statistics manager (tracks real message counts)
 	common.InitDailyStatsManager()
 
+	// Initialize delivery receipt manager (per-output sent/acked/failed counts for reconciliation)
+	common.InitDeliveryReceiptManager()
+
+	// Initialize fired alerts index (rule, project and time of delivered alerts for GET /alerts)
+	common.InitFiredAlertIndex()
+
 	// Initialize new cluster system
 	cluster.InitCluster(ip, *isLeader)
 
@@ -132,6 +178,36 @@ func main() {
 	} else {
 		logger.Info("Component monitor started successfully")
 	}
+	if err := common.GlobalComponentMonitor.RegisterProbes(common.Config.HealthProbes); err != nil {
+		logger.Error("Failed to register health probes", "error", err)
+	}
+
+	// Initialize synthetic canary latency measurement if enabled
+	common.InitCanaryMonitor(ip, common.Config.Canary)
+
+	// Initialize goroutine and channel leak detection if enabled
+	common.InitLeakDetector(ip, common.Config.LeakDetector)
+
+	// Open the GeoIP databases before any ruleset using <geoip> is built
+	common.InitGeoIP(common.Config.GeoIP)
+
+	// Load the threat intel feeds and shared lists before any ruleset using INTEL or IN_LIST checks is built
+	common.InitThreatIntel(common.Config.ThreatIntel)
+	common.InitSharedLists()
+	common.InitThresholdValues()
+	project.InitRulesetShadows()
+	common.InitHolidayCalendars(common.Config.HolidayCalendars)
+	common.InitDNS(common.Config.DNS)
+	common.InitRisk(common.Config.Risk)
+	common.InitSecrets(common.Config.Secrets)
+
+	// Rulesets validated before a restart skip the validation
+	if err := rules_engine.InitValidationCache(filepath.Join(common.Config.ConfigRoot, ".cache", "rulesets")); err != nil {
+		logger.Warn("Ruleset validation cache disabled", "error", err)
+	}
+
+	// Publish the per-rule evaluation profiles of this node for /rule-metrics
+	rules_engine.StartRuleProfiler(ip)
 
 	// Start pprof server if enabled
 	startPprofServer()
@@ -172,6 +248,9 @@ func main() {
 		common.InitClusterSystemManager()
 		_ = cluster.GlobalClusterManager.Start()
 
+		// Apply the retention policy to samples, error logs, operations history and statistics
+		common.InitRetentionJanitor()
+
 		go api.ServerStart(*apiListen) // start Echo API on specified address
 		logger.Info("Leader API server starting", "address", *apiListen)
 	} else {
@@ -238,8 +317,18 @@ func main() {
 				}
 			}
 
+			rules_engine.StopRuleProfiler()
+			common.StopCanaryMonitor()
+			common.StopLeakDetector()
+			common.StopGeoIP()
+			common.StopThreatIntel()
+			common.StopDNS()
+			common.StopSharedLists()
+			common.StopRetentionJanitor()
 			common.StopClusterSystemManager()
 			common.StopDailyStatsManager()
+			common.StopDeliveryReceiptManager()
+			common.StopFiredAlertIndex()
 			if rsm := common.GetRedisSampleManager(); rsm != nil {
 				rsm.Close()
 			}
@@ -263,6 +352,9 @@ func main() {
 			})
 		}
 
+		// Flush the lite store last so the final stats and states are persisted
+		common.CloseLiteStore()
+
 		logger.Info("Hub shutdown complete — bye")
 		os.Exit(0)
 	}()
@@ -398,13 +490,17 @@ func loadLocalComponents() {
 		}
 	}
 
-	// rulesets
-	for _, f := range traverseComponents(path.Join(root, "ruleset"), ".xml") {
+	// rulesets, all raw configs are stored first so includes and extends can refer to any ruleset
+	rulesetFiles := traverseComponents(path.Join(root, "ruleset"), ".xml")
+	for _, f := range rulesetFiles {
 		id := common.GetFileNameWithoutExt(f)
 		if content, err := os.ReadFile(f); err == nil {
 			// Update global config map
 			common.SetRawConfig("ruleset", id, string(content))
 		}
+	}
+	for _, f := range rulesetFiles {
+		id := common.GetFileNameWithoutExt(f)
 		if rs, err := rules_engine.NewRuleset(f, "", id); err != nil {
 			logger.Error("Failed to load ruleset", "file", f, "error", err)
 			// Create an error placeholder ruleset to show in list
@@ -594,6 +690,24 @@ func loadHubConfig(root string) error {
 		logger.Info("Using Redis password from environment variable")
 	}
 
+	if envReplicas := os.Getenv("REDIS_REPLICAS"); envReplicas != "" {
+		common.Config.RedisReplicas = nil
+		for _, addr := range strings.Split(envReplicas, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				common.Config.RedisReplicas = append(common.Config.RedisReplicas, addr)
+			}
+		}
+		logger.Info("Using Redis read replicas from environment variable", "count", len(common.Config.RedisReplicas))
+	}
+
+	if v := os.Getenv("LITE_MODE"); v != "" {
+		common.Config.Lite = strings.ToLower(v) == "true" || v == "1"
+		logger.Info("Using lite mode from environment variable", "enabled", common.Config.Lite)
+	}
+	if v := os.Getenv("LITE_DATA_FILE"); v != "" {
+		common.Config.LiteDataFile = v
+	}
+
 	// Override SIMD configuration with environment variable if set
 	if envSIMDEnabled := os.Getenv("SIMD_ENABLED"); envSIMDEnabled != "" {
 		simdEnabled := strings.ToLower(envSIMDEnabled) == "true" || envSIMDEnabled == "1"
@@ -656,12 +770,54 @@ func loadHubConfig(root string) error {
 		}
 	}
 
+	if err := common.Config.OutputHTTP.Validate(); err != nil {
+		return fmt.Errorf("invalid output_http: %v", err)
+	}
+	if err := common.Config.ThreatIntel.Validate(); err != nil {
+		return fmt.Errorf("invalid threat_intel: %v", err)
+	}
+	if err := common.Config.HolidayCalendars.Validate(); err != nil {
+		return fmt.Errorf("invalid holiday_calendars: %v", err)
+	}
+	if err := common.Config.DNS.Validate(); err != nil {
+		return fmt.Errorf("invalid dns: %v", err)
+	}
+	if err := common.Config.Risk.Validate(); err != nil {
+		return fmt.Errorf("invalid risk: %v", err)
+	}
+	if err := plugin.SetAllowedPackages(common.Config.PluginPackages); err != nil {
+		return fmt.Errorf("invalid plugin_packages: %v", err)
+	}
+	// Plugins with the native or process runtime are compiled on every node
+	if version, err := plugin.CheckToolchain(common.Config.PluginBuild); err != nil {
+		if common.Config.PluginBuild != nil && common.Config.PluginBuild.Go != "" {
+			return fmt.Errorf("invalid plugin_build: %v", err)
+		}
+		logger.Warn("No Go toolchain, plugins with the native or process runtime will fail to load", "error", err)
+	} else if version != runtime.Version() {
+		logger.Info("Go toolchain differs from the one of the hub, plugins with the native runtime will fail to load", "toolchain", version, "hub", runtime.Version())
+	}
+	if err := common.Config.Secrets.Validate(); err != nil {
+		return fmt.Errorf("invalid secrets: %v", err)
+	}
+
 	// Set config root
 	common.Config.ConfigRoot = root
 
+	if common.Config.Lite {
+		if common.Config.LiteDataFile == "" {
+			common.Config.LiteDataFile = filepath.Join(root, "lite_store.db")
+		} else if !filepath.IsAbs(common.Config.LiteDataFile) {
+			common.Config.LiteDataFile = filepath.Join(root, common.Config.LiteDataFile)
+		}
+		logger.Info("Lite mode enabled, Redis is not required", "data_file", common.Config.LiteDataFile)
+		logger.Info("SIMD configuration", "enabled", common.Config.SIMDEnabled)
+		return nil
+	}
+
 	// Validate Redis configuration
 	if common.Config.Redis == "" {
-		return fmt.Errorf("Redis host not configured. Please set REDIS_HOST environment variable or configure in config.yaml")
+		return fmt.Errorf("Redis host not configured. Please set REDIS_HOST environment variable or configure in config.yaml, or enable lite mode")
 	}
 
 	logger.Info("Final Redis configuration", "host", common.Config.Redis, "password_set", common.Config.RedisPassword != "")
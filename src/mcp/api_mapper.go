@@ -663,6 +663,7 @@ func (m *APIMapper) CallAPITool(toolName string, args map[string]interface{}) (c
 		"test_ruleset":         {"POST", "/test-ruleset/%s", true},
 		"test_ruleset_content": {"POST", "/test-ruleset-content", true},
 		"test_output":          {"POST", "/test-output/%s", true},
+		"get_output_captures":  {"GET", "/output-captures/%s", true},
 		"test_project":         {"POST", "/test-project/%s", true},
 		"test_project_content": {"POST", "/test-project-content/%s", true},
 
@@ -3085,62 +3086,41 @@ func (m *APIMapper) handleProjectWizard(args map[string]interface{}) (common.MCP
 	if autoCreate {
 		results = append(results, "\n## Step 4: Auto-Creating Components")
 
-		// Create components in order
-		// 1. Create Input
-		inputArgs := map[string]interface{}{
-			"id":  fmt.Sprintf("%s_%s", projectID, dataSource),
-			"raw": inputConfig,
-		}
-		if _, err := m.makeHTTPRequest("POST", "/inputs", inputArgs, true); err != nil {
-			results = append(results, fmt.Sprintf("❌ Failed to create input: %v", err))
-			return common.MCPToolResult{
-				Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-				IsError: true,
-			}, nil
-		}
-		results = append(results, fmt.Sprintf("✓ Created input: %s_%s", projectID, dataSource))
-
-		// 2. Create Ruleset
-		rulesetArgs := map[string]interface{}{
-			"id":  fmt.Sprintf("%s_rules", projectID),
-			"raw": rulesetConfig,
-		}
-		if _, err := m.makeHTTPRequest("POST", "/rulesets", rulesetArgs, true); err != nil {
-			results = append(results, fmt.Sprintf("❌ Failed to create ruleset: %v", err))
-			return common.MCPToolResult{
-				Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-				IsError: true,
-			}, nil
-		}
-		results = append(results, fmt.Sprintf("✓ Created ruleset: %s_rules", projectID))
-
-		// 3. Create Output
-		outputArgs := map[string]interface{}{
-			"id":  fmt.Sprintf("%s_%s", projectID, alertChannel),
-			"raw": outputConfig,
-		}
-		if _, err := m.makeHTTPRequest("POST", "/outputs", outputArgs, true); err != nil {
-			results = append(results, fmt.Sprintf("❌ Failed to create output: %v", err))
-			return common.MCPToolResult{
-				Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-				IsError: true,
-			}, nil
-		}
-		results = append(results, fmt.Sprintf("✓ Created output: %s_%s", projectID, alertChannel))
+		// Create components in order, verifying each one first.
+		// The project comes last because it references the other components.
+		steps := []struct {
+			componentType string
+			componentID   string
+			raw           string
+		}{
+			{"input", fmt.Sprintf("%s_%s", projectID, dataSource), inputConfig},
+			{"ruleset", fmt.Sprintf("%s_rules", projectID), rulesetConfig},
+			{"output", fmt.Sprintf("%s_%s", projectID, alertChannel), outputConfig},
+			{"project", projectID, projectConfig},
+		}
+		var created []string
+		for _, step := range steps {
+			diag := workflowDiagnostics{Stage: "verify", ComponentType: step.componentType, ComponentID: step.componentID, Created: created}
+			verification, err := m.verifyComponentRaw(step.componentType, step.componentID, step.raw)
+			if err != nil {
+				return workflowFailure(results, diagnosticsFromError(diag, err)), nil
+			}
+			if !verification.Valid {
+				return workflowFailure(results, diagnosticsFromVerify(diag, verification)), nil
+			}
 
-		// 4. Create Project
-		projectArgs := map[string]interface{}{
-			"id":  projectID,
-			"raw": projectConfig,
-		}
-		if _, err := m.makeHTTPRequest("POST", "/projects", projectArgs, true); err != nil {
-			results = append(results, fmt.Sprintf("❌ Failed to create project: %v", err))
-			return common.MCPToolResult{
-				Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-				IsError: true,
-			}, nil
+			createArgs := map[string]interface{}{
+				"id":  step.componentID,
+				"raw": step.raw,
+			}
+			if _, err := m.makeHTTPRequest("POST", fmt.Sprintf("/%ss", step.componentType), createArgs, true); err != nil {
+				diag.Stage = "create"
+				return workflowFailure(results, diagnosticsFromError(diag, err)), nil
+			}
+			created = append(created, step.componentType+"/"+step.componentID)
+			results = append(results, fmt.Sprintf("✓ Verified and created %s: %s", step.componentType, step.componentID))
+			results = append(results, verifyWarnings(verification)...)
 		}
-		results = append(results, fmt.Sprintf("✓ Created project: %s", projectID))
 
 		results = append(results, "\n🎉 **Project created successfully!**")
 		results = append(results, fmt.Sprintf("You can now start the project with: `project_control action='start' project_id='%s'`", projectID))
@@ -4734,7 +4714,7 @@ func Eval(funcName string, params ...interface{}) (interface{}, error) {
 		%s
 		
 		// TODO: Implement your action logic here
-		// Example: fmt.Printf("Action executed with: %s\n", value)
+		// Example: fmt.Printf("Action executed with: %%v\n", value)
 		fmt.Printf("Action executed\n")
 		return true, nil
 	}
@@ -4960,32 +4940,48 @@ func (m *APIMapper) handleCreateRuleComplete(args map[string]interface{}) (commo
 		"id":       rulesetID,
 		"rule_raw": ruleXML,
 	}
-	_, err := m.handleAddRulesetRule(addArgs)
+	diag := workflowDiagnostics{Stage: "add_rule", ComponentType: "ruleset", ComponentID: rulesetID}
+	addResult, err := m.handleAddRulesetRule(addArgs)
 	if err != nil {
-		results = append(results, fmt.Sprintf("❌ Failed to add rule: %v", err))
-		return common.MCPToolResult{
-			Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-			IsError: true,
-		}, nil
+		return workflowFailure(results, diagnosticsFromError(diag, err)), nil
 	}
-	results = append(results, "✓ Rule successfully added to ruleset")
+	if addResult.IsError {
+		if len(addResult.Content) > 0 {
+			diag.Message = addResult.Content[0].Text
+		}
+		return workflowFailure(results, diag), nil
+	}
+	results = append(results, "✓ Rule added to ruleset")
 
-	// Step 4: Test rule if sample data available
+	// Step 4: Verify the whole ruleset as stored by the backend
+	results = append(results, "\n## Step 4: Verifying Ruleset")
+	verification, err := m.verifyComponentRaw("ruleset", rulesetID, "")
+	if err != nil {
+		diag.Stage = "verify"
+		return workflowFailure(results, diagnosticsFromError(diag, err)), nil
+	}
+	if !verification.Valid {
+		return workflowFailure(results, diagnosticsFromVerify(diag, verification)), nil
+	}
+	results = append(results, "✓ Ruleset verification passed")
+	results = append(results, verifyWarnings(verification)...)
+
+	// Step 5: Test rule if sample data available
 	if sampleData != "" {
-		results = append(results, "\n## Step 4: Testing Rule")
-		testArgs := map[string]interface{}{
-			"id":   rulesetID,
-			"data": sampleData,
-		}
-		_, err := m.makeHTTPRequest("POST", fmt.Sprintf("/test-ruleset/%s", rulesetID), testArgs, true)
+		results = append(results, "\n## Step 5: Testing Rule")
+		emitted, err := m.testRulesetWithSample(rulesetID, sampleData)
 		if err != nil {
-			results = append(results, fmt.Sprintf("⚠️ Rule test failed: %v", err))
+			diag.Stage = "test"
+			return workflowFailure(results, diagnosticsFromError(diag, err)), nil
+		}
+		if emitted > 0 {
+			results = append(results, fmt.Sprintf("✓ Rule test completed, the ruleset emitted %d event(s) for the sample", emitted))
 		} else {
-			results = append(results, "✓ Rule test passed successfully")
+			results = append(results, "✓ Rule test completed, the sample did not trigger the ruleset")
 		}
 	}
 
-	// Step 5: Auto-deploy if requested
+	// Step 6: Auto-deploy if requested
 	if autoDeploy {
 		results = append(results, "\n⚠️ Auto-deployment is not available.")
 		results = append(results, "📋 Please use 'apply_single_change' for individual components or deploy via the UI.")
@@ -5162,18 +5158,13 @@ func (m *APIMapper) handleComponentWizard(args map[string]interface{}) (common.M
 	results = append(results, fmt.Sprintf("🏗️ Creating %s: %s", componentType, componentID))
 	results = append(results, fmt.Sprintf("📋 Using Template: %v\n", useTemplate))
 
-	// Step 1: Generate or validate configuration
+	// Step 1: Generate or take the provided configuration
 	if useTemplate && configContent == "" {
 		results = append(results, "## Step 1: Generating Template Configuration")
 		configContent = m.generateComponentTemplate(componentType, componentID)
 		results = append(results, "✓ Template configuration generated")
 	} else if configContent != "" {
-		results = append(results, "## Step 1: Validating Provided Configuration")
-		if m.validateComponentConfig(componentType, configContent) {
-			results = append(results, "✓ Configuration validation passed")
-		} else {
-			results = append(results, "⚠️ Configuration validation warnings detected")
-		}
+		results = append(results, "## Step 1: Using Provided Configuration")
 	} else {
 		return common.MCPToolResult{
 			Content: []common.MCPToolContent{{Type: "text", Text: "Error: Either use_template='true' or provide config_content"}},
@@ -5186,48 +5177,43 @@ func (m *APIMapper) handleComponentWizard(args map[string]interface{}) (common.M
 	results = append(results, configContent)
 	results = append(results, "```")
 
-	// Step 2: Create component
-	results = append(results, "\n## Step 2: Creating Component")
+	// Step 2: Verify before anything is written, so an invalid configuration leaves no temporary file behind
+	results = append(results, "\n## Step 2: Component Validation")
+	diag := workflowDiagnostics{Stage: "verify", ComponentType: componentType, ComponentID: componentID}
+	verification, err := m.verifyComponentRaw(componentType, componentID, configContent)
+	if err != nil {
+		return workflowFailure(results, diagnosticsFromError(diag, err)), nil
+	}
+	if !verification.Valid {
+		return workflowFailure(results, diagnosticsFromVerify(diag, verification)), nil
+	}
+	results = append(results, "✓ Component verification passed")
+	results = append(results, verifyWarnings(verification)...)
+
+	// Step 3: Create component
+	results = append(results, "\n## Step 3: Creating Component")
 	createArgs := map[string]interface{}{
 		"id":  componentID,
 		"raw": configContent,
 	}
 
 	endpoint := fmt.Sprintf("/%ss", componentType)
-	_, err := m.makeHTTPRequest("POST", endpoint, createArgs, true)
-	if err != nil {
-		results = append(results, fmt.Sprintf("❌ Component creation failed: %v", err))
-		return common.MCPToolResult{
-			Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
-			IsError: true,
-		}, nil
-	}
-	results = append(results, "✅ Component created successfully")
-
-	// Step 3: Validation and testing
-	results = append(results, "\n## Step 3: Component Validation")
-
-	// Verify component
-	_, err = m.makeHTTPRequest("POST", fmt.Sprintf("/verify/%s/%s", componentType, componentID), nil, true)
-	if err != nil {
-		results = append(results, fmt.Sprintf("⚠️ Component verification failed: %v", err))
-	} else {
-		results = append(results, "✓ Component verification passed")
+	if _, err := m.makeHTTPRequest("POST", endpoint, createArgs, true); err != nil {
+		diag.Stage = "create"
+		return workflowFailure(results, diagnosticsFromError(diag, err)), nil
 	}
+	results = append(results, "✅ Component created")
 
 	// Test with sample data if provided
 	if testData != "" && componentType == "ruleset" {
 		results = append(results, "\n## Step 4: Testing with Sample Data")
-		testArgs := map[string]interface{}{
-			"id":   componentID,
-			"data": testData,
-		}
-		_, err := m.makeHTTPRequest("POST", fmt.Sprintf("/test-ruleset/%s", componentID), testArgs, true)
+		emitted, err := m.testRulesetWithSample(componentID, testData)
 		if err != nil {
-			results = append(results, fmt.Sprintf("⚠️ Component test failed: %v", err))
-		} else {
-			results = append(results, "✓ Component test passed")
+			diag.Stage = "test"
+			diag.Created = []string{componentType + "/" + componentID}
+			return workflowFailure(results, diagnosticsFromError(diag, err)), nil
 		}
+		results = append(results, fmt.Sprintf("✓ Component test completed, %d event(s) emitted", emitted))
 	}
 
 	// Step 4/5: Best practices and recommendations
@@ -5789,24 +5775,6 @@ content: |
 	}
 }
 
-func (m *APIMapper) validateComponentConfig(componentType, config string) bool {
-	// Basic validation - check if config is not empty and has reasonable structure
-	if len(config) < 10 {
-		return false
-	}
-
-	switch componentType {
-	case "ruleset":
-		return strings.Contains(config, "<rule") || strings.Contains(config, "<root")
-	case "input", "output", "project":
-		return strings.Contains(config, "name:") || strings.Contains(config, "type:")
-	case "plugin":
-		return strings.Contains(config, "package plugin") || strings.Contains(config, "Eval")
-	}
-
-	return true
-}
-
 func (m *APIMapper) getComponentRecommendations(componentType, componentID string) []string {
 	recommendations := []string{
 		"Test the component thoroughly before deployment",
@@ -5986,10 +5954,29 @@ func (m *APIMapper) handleRuleSyntaxHelp(args map[string]interface{}) (common.MC
 	results = append(results, "**Null Checks:**")
 	results = append(results, "- ISNULL: Field is null - `<check type=\"ISNULL\" field=\"optional\"></check>`")
 	results = append(results, "- NOTNULL: Field not null - `<check type=\"NOTNULL\" field=\"required\"></check>`")
+	results = append(results, "- EXISTS / NOT_EXISTS: Field present or missing, regardless of value - `<check type=\"EXISTS\" field=\"user.sudo\"></check>`")
+	results = append(results, "- IS_TYPE: Value type is string, number, integer, bool, object or array - `<check type=\"IS_TYPE\" field=\"port\">integer</check>`")
+	results = append(results, "- IS_NUMERIC: Value is a number or a numeric string - `<check type=\"IS_NUMERIC\" field=\"port\"></check>`")
+	results = append(results, "- IS_IP: Value is an IP address, value ipv4 or ipv6 restricts the version - `<check type=\"IS_IP\" field=\"client\">ipv4</check>`")
+	results = append(results, "- ARRAY_CONTAINS: An element of the array equals the value - `<check type=\"ARRAY_CONTAINS\" field=\"sourceIPs\">10.0.0.1</check>`")
+	results = append(results, "- ARRAY_LEN: Array length compares to the value (3, !=3, >3, >=3, <3, <=3) - `<check type=\"ARRAY_LEN\" field=\"sourceIPs\">&gt;=2</check>`")
+	results = append(results, "")
+	results = append(results, "**IP Address Checks:**")
+	results = append(results, "- CIDR: IP inside one of the networks - `<check type=\"CIDR\" field=\"source_ip\">10.0.0.0/8,192.168.0.0/16</check>`")
+	results = append(results, "- IP_RANGE: IP inside one of the start-end ranges - `<check type=\"IP_RANGE\" field=\"dest_ip\">172.16.0.10-172.16.0.50</check>`")
 	results = append(results, "")
 	results = append(results, "**Advanced Checks:**")
 	results = append(results, "- REGEX: Regular expression - `<check type=\"REGEX\" field=\"ip\">^\\\\d+\\\\.\\\\d+\\\\.\\\\d+\\\\.\\\\d+$</check>`")
 	results = append(results, "- PLUGIN: Plugin function - `<check type=\"PLUGIN\">isPrivateIP(_$source_ip)</check>`")
+	results = append(results, "- EXPR: Expression over event fields, no field attribute - `<check type=\"EXPR\">bytes_out > 10*bytes_in and dest_port != 443</check>`")
+	results = append(results, "- IN_LIST: Entry of shared lists managed through /lists - `<check type=\"IN_LIST\" field=\"user\">vip_users</check>`")
+	results = append(results, "- TIME: Timestamp in a schedule of days, windows, timezone and holidays, current time without field - `<check type=\"TIME\" field=\"timestamp\">Mon-Fri 08:00-18:00 tz=Europe/Paris holidays=fr</check>`")
+	results = append(results, "- LEVENSHTEIN / JARO / HOMOGLYPH: Lookalike of protected values (equal values never match), threshold is the edit distance (default 2) or the similarity (default 0.9) - `<check type=\"LEVENSHTEIN\" field=\"domain\" threshold=\"2\">paypal.com,google.com</check>`")
+	results = append(results, "- YARA: A rule of a YARA rule file of config_root/yara matches the field, no modules or for loops - `<check type=\"YARA\" field=\"script_body\">powershell.yar</check>`")
+	results = append(results, "- SCORE_GT: Risk score added by <score> elements to the entity in the field is greater than the value, entity defaults to the field - `<check type=\"SCORE_GT\" field=\"user.name\" entity=\"user\">100</check>`")
+	results = append(results, "")
+	results = append(results, "**Check Modifiers:** string, REGEX and ARRAY_CONTAINS checks take nocase, normalize (Unicode NFKC) and fold_space (collapse whitespace) - `<check type=\"INCL\" field=\"cmdline\" nocase=\"true\" fold_space=\"true\">powershell -enc</check>`")
+	results = append(results, "**Plugin Result Cache:** PLUGIN checks take cache_ttl to reuse the result for the same arguments - `<check type=\"PLUGIN\" cache_ttl=\"10m\">isMaliciousIP(source_ip)</check>`")
 	results = append(results, "")
 	results = append(results, "**Multi-value Matching:**")
 	results = append(results, "```xml")
@@ -6024,6 +6011,21 @@ func (m *APIMapper) handleRuleSyntaxHelp(args map[string]interface{}) (common.MC
 	results = append(results, "<threshold group_by=\"user_id\" range=\"30m\" count_type=\"CLASSIFY\" count_field=\"accessed_file\" value=\"25\"/>")
 	results = append(results, "```")
 	results = append(results, "")
+	results = append(results, "**AVG, MIN, MAX, PERCENTILE Modes - Aggregate Numeric Values (value accepts KB/MB/GB/TB):**")
+	results = append(results, "```xml")
+	results = append(results, "<threshold group_by=\"service\" range=\"10m\" count_type=\"PERCENTILE\" percentile=\"99\" count_field=\"response_ms\" value=\"2000\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**Runtime Values - value_ref reads the value set through POST /threshold-values, the element value is the default:**")
+	results = append(results, "```xml")
+	results = append(results, "<threshold group_by=\"user\" range=\"10m\" value_ref=\"redis:thresholds/login_failures\">5</threshold>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**Windows - fixed (default), sliding or tumbling, event time from time_field:**")
+	results = append(results, "```xml")
+	results = append(results, "<threshold group_by=\"source_ip\" range=\"10m\" window=\"sliding\" time_field=\"timestamp\" value=\"5\"/>")
+	results = append(results, "```")
+	results = append(results, "")
 	results = append(results, "**Performance Optimization:**")
 	results = append(results, "```xml")
 	results = append(results, "<threshold group_by=\"user_id\" range=\"5m\" value=\"10\" local_cache=\"true\"/>")
@@ -6032,6 +6034,82 @@ func (m *APIMapper) handleRuleSyntaxHelp(args map[string]interface{}) (common.MC
 	results = append(results, "**Time Ranges**: s (seconds), m (minutes), h (hours), d (days)")
 	results = append(results, "**Grouping**: Single field or comma-separated multiple fields")
 	results = append(results, "")
+	results = append(results, "**SEQUENCE - Ordered Events per Group within Range:**")
+	results = append(results, "```xml")
+	results = append(results, "<sequence group_by=\"source_ip\" range=\"10m\">")
+	results = append(results, "    <step count=\"5\"><check type=\"EQU\" field=\"action\">login_failed</check></step>")
+	results = append(results, "    <step><check type=\"EQU\" field=\"action\">login_success</check></step>")
+	results = append(results, "</sequence>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**SESSION - Summary of the Events of a Group until Idle for Gap:**")
+	results = append(results, "```xml")
+	results = append(results, "<session group_by=\"source_ip\" gap=\"5m\" max_duration=\"1h\">")
+	results = append(results, "    <aggregate type=\"SUM\" field=\"bytes\"/>")
+	results = append(results, "    <aggregate type=\"DISTINCT\" field=\"dest_port\" name=\"ports\"/>")
+	results = append(results, "</session>")
+	results = append(results, "<check type=\"MT\" field=\"session_ports\">100</check>")
+	results = append(results, "```")
+	results = append(results, "**Summary fields**: session_start, session_end, session_duration, session_event_count, session_closed_by and one per aggregate (COUNT, SUM, AVG, MIN, MAX, DISTINCT, VALUES, FIRST, LAST)")
+	results = append(results, "")
+	results = append(results, "**META - Severity, Tags and ATT&CK Techniques (added to alerts as _hub_rule_meta):**")
+	results = append(results, "```xml")
+	results = append(results, "<meta severity=\"high\" confidence=\"medium\">")
+	results = append(results, "    <tag>authentication</tag>")
+	results = append(results, "    <attack>T1110.001</attack>")
+	results = append(results, "    <reference>https://attack.mitre.org/techniques/T1110/001/</reference>")
+	results = append(results, "</meta>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**TEST - Test Cases of the Rule (run by POST /rule-tests/:id, ignored when processing events):**")
+	results = append(results, "```xml")
+	results = append(results, "<test name=\"root login\">")
+	results = append(results, "    <input>{\"user\": \"root\", \"action\": \"login\"}</input>")
+	results = append(results, "    <expect match=\"true\"/>")
+	results = append(results, "</test>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**BASELINE - Pass When a Value is Abnormal for the Entity (cluster-wide, Redis):**")
+	results = append(results, "```xml")
+	results = append(results, "<baseline field=\"bytes_out\" group_by=\"user.name\" range=\"7d\" sigma=\"4\" min_samples=\"50\"/>")
+	results = append(results, "<baseline type=\"EWMA\" field=\"req_per_min\" group_by=\"host\" range=\"1d\" alpha=\"0.2\" direction=\"both\"/>")
+	results = append(results, "<baseline type=\"DISTINCT\" field=\"geo_country\" group_by=\"user.name\" range=\"30d\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**SUPPRESS - Alert Once per Key within a Cooldown (cluster-wide, Redis):**")
+	results = append(results, "```xml")
+	results = append(results, "<suppress key=\"source_ip,user.name\" window=\"30m\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**SCORE - Add a Weight to the Decaying Risk Score of an Entity (cluster-wide, Redis, read by SCORE_GT and /risk-scores):**")
+	results = append(results, "```xml")
+	results = append(results, "<score entity=\"user\" field=\"user.name\" weight=\"20\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**REQUIRES - Rule Chaining, Another Rule of the Ruleset Matched for the Same Key within a Window:**")
+	results = append(results, "```xml")
+	results = append(results, "<requires rule=\"brute_force\" key=\"source_ip\" within=\"1h\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**MASK / DROP_FIELDS - PII Handling of Every Forwarded Event (under <root>, outside of rules):**")
+	results = append(results, "```xml")
+	results = append(results, "<mask field=\"password\" strategy=\"redact\"/>")
+	results = append(results, "<mask field=\"user.email\" strategy=\"tokenize\" salt=\"secret\"/>")
+	results = append(results, "<mask field=\"card_number\" strategy=\"partial\" keep=\"4\"/>")
+	results = append(results, "<drop_fields>session_token,headers.cookie</drop_fields>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**INCLUDE / EXTENDS - Reuse Rules of Other Rulesets (expanded when the ruleset is loaded):**")
+	results = append(results, "```xml")
+	results = append(results, "<root type=\"DETECTION\" extends=\"base_detection\">  <!-- base rules not redefined here are added -->")
+	results = append(results, "    <include ref=\"common_checks\"/>                  <!-- all rules and root elements -->")
+	results = append(results, "    <include ref=\"common_checks\" rule=\"admin_login\"/>")
+	results = append(results, "    <rule id=\"ssh\">")
+	results = append(results, "        <include ref=\"common_checks\" rule=\"not_internal\"/>  <!-- content of the rule -->")
+	results = append(results, "    </rule>")
+	results = append(results, "</root>")
+	results = append(results, "```")
+	results = append(results, "")
 
 	results = append(results, "**DATA PROCESSING:**")
 	results = append(results, "")
@@ -6048,6 +6126,43 @@ func (m *APIMapper) handleRuleSyntaxHelp(args map[string]interface{}) (common.MC
 	results = append(results, "<del>password,secret_key,auth_token</del>")
 	results = append(results, "```")
 	results = append(results, "")
+	results = append(results, "**EXTRACT - Copy a Nested Value (dot path, [n] index or JSONPath) to a Top-level Field:**")
+	results = append(results, "```xml")
+	results = append(results, "<extract source=\"$.Records[0].userIdentity.arn\" field=\"actor_arn\"/>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**SCRIPT - Lua Snippet on the Event (return false fails the rule):**")
+	results = append(results, "```xml")
+	results = append(results, "<script lang=\"lua\"><![CDATA[")
+	results = append(results, "    local user = event.user_name or \"\"")
+	results = append(results, "    if string.match(user, \"^svc_\") then return false end")
+	results = append(results, "    event.user_domain = string.match(user, \"@(.+)$\")")
+	results = append(results, "]]></script>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**GEOIP - Append Location and ASN Fields (needs geoip in config.yaml):**")
+	results = append(results, "```xml")
+	results = append(results, "<geoip field=\"source_ip\" prefix=\"geo_\"/>")
+	results = append(results, "<check type=\"NEQ\" field=\"geo_country\">US</check>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**INTEL - Threat Intel Lookups (needs threat_intel in config.yaml):**")
+	results = append(results, "```xml")
+	results = append(results, "<check type=\"INTEL\" field=\"dest_ip\">misp,otx</check>")
+	results = append(results, "<append type=\"INTEL\" field=\"dest_intel\" source=\"dest_ip\">misp</append>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**TRANSFORM - Built-in Append Functions (lower, upper, trim, md5, sha1, sha256, sha512, base64/hex/url encode and decode, utf16_decode):**")
+	results = append(results, "```xml")
+	results = append(results, "<append type=\"TRANSFORM\" field=\"ps_command\">_$encoded_command | base64_decode | utf16_decode | lower</append>")
+	results = append(results, "```")
+	results = append(results, "")
+	results = append(results, "**DNS - Reverse or Forward Lookup (cached, bounded by the per-event budget of dns in config.yaml):**")
+	results = append(results, "```xml")
+	results = append(results, "<append type=\"DNS\" field=\"src_hostname\" source=\"src_ip\"/>")
+	results = append(results, "<append type=\"DNS\" field=\"dest_addresses\" source=\"dest_domain\">forward</append>")
+	results = append(results, "```")
+	results = append(results, "")
 	results = append(results, "**PLUGIN - Execute Actions:**")
 	results = append(results, "```xml")
 	results = append(results, "<plugin>sendAlert(_$ORIDATA)</plugin>")
@@ -0,0 +1,19 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePluginCodeFormatsCleanly(t *testing.T) {
+	m := &APIMapper{}
+	for _, pluginType := range []string{"check", "data", "action"} {
+		code := m.generatePluginCode(pluginType, "flag suspicious logins", "user, ip")
+		if strings.Contains(code, "%!") {
+			t.Errorf("%s plugin template has a formatting error:\n%s", pluginType, code)
+		}
+		if !strings.Contains(code, "params[1].(string)") {
+			t.Errorf("%s plugin template is missing the parameters:\n%s", pluginType, code)
+		}
+	}
+}
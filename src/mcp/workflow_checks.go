@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/mcp/errors"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// verifyIssue is a single error or warning returned by POST /verify/:type/:id
+type verifyIssue struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// verifyResponse is the body of POST /verify/:type/:id
+type verifyResponse struct {
+	Valid    bool          `json:"valid"`
+	Errors   []verifyIssue `json:"errors"`
+	Warnings []verifyIssue `json:"warnings"`
+}
+
+// workflowDiagnostics describes where a multi-step workflow stopped and why.
+// It is rendered as JSON so the calling agent can act on it instead of parsing prose.
+type workflowDiagnostics struct {
+	Stage         string        `json:"stage"` // verify, create, add_rule, test
+	ComponentType string        `json:"component_type"`
+	ComponentID   string        `json:"component_id"`
+	Message       string        `json:"message"`
+	StatusCode    int           `json:"status_code,omitempty"`
+	Errors        []verifyIssue `json:"errors,omitempty"`
+	Created       []string      `json:"created,omitempty"` // components already created before the failure
+}
+
+// verifyComponentRaw runs the backend validation for a component. With an empty raw the
+// backend validates the stored temporary or formal file.
+func (m *APIMapper) verifyComponentRaw(componentType, componentID, raw string) (*verifyResponse, error) {
+	var body interface{}
+	if raw != "" {
+		body = map[string]interface{}{"raw": raw}
+	} else {
+		body = map[string]interface{}{}
+	}
+	resp, err := m.makeHTTPRequest("POST", fmt.Sprintf("/verify/%s/%s", componentType, componentID), body, true)
+	if err != nil {
+		return nil, err
+	}
+	var result verifyResponse
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unexpected verify response: %w", err)
+	}
+	return &result, nil
+}
+
+// parseSampleEvent turns sample data into the single event accepted by the ruleset test endpoint.
+// A JSON array is accepted and its first object is used.
+func parseSampleEvent(sampleData string) (map[string]interface{}, error) {
+	sampleData = strings.TrimSpace(sampleData)
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(sampleData), &event); err == nil {
+		return event, nil
+	}
+	var events []map[string]interface{}
+	if err := json.Unmarshal([]byte(sampleData), &events); err != nil {
+		return nil, fmt.Errorf("sample data must be a JSON object or an array of objects: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("sample data is an empty array")
+	}
+	return events[0], nil
+}
+
+// testRulesetWithSample runs the ruleset test endpoint and returns the number of events the ruleset emitted
+func (m *APIMapper) testRulesetWithSample(rulesetID, sampleData string) (int, error) {
+	event, err := parseSampleEvent(sampleData)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := m.makeHTTPRequest("POST", fmt.Sprintf("/test-ruleset/%s", rulesetID), map[string]interface{}{"data": event}, true)
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Success bool                     `json:"success"`
+		Error   string                   `json:"error"`
+		Results []map[string]interface{} `json:"results"`
+		Timeout bool                     `json:"timeout"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return 0, fmt.Errorf("unexpected test response: %w", err)
+	}
+	if !result.Success {
+		return 0, fmt.Errorf("ruleset test failed: %s", result.Error)
+	}
+	if result.Timeout {
+		return len(result.Results), fmt.Errorf("ruleset test timed out, results may be incomplete")
+	}
+	return len(result.Results), nil
+}
+
+// diagnosticsFromError fills status code and message from an error returned by makeHTTPRequest
+func diagnosticsFromError(diag workflowDiagnostics, err error) workflowDiagnostics {
+	diag.Message = err.Error()
+	if apiErr, ok := err.(errors.MCPError); ok {
+		if code, ok := apiErr.Details["statusCode"].(int); ok {
+			diag.StatusCode = code
+		}
+	}
+	return diag
+}
+
+// diagnosticsFromVerify converts a failed verification into diagnostics
+func diagnosticsFromVerify(diag workflowDiagnostics, v *verifyResponse) workflowDiagnostics {
+	diag.Stage = "verify"
+	diag.Errors = v.Errors
+	diag.Message = "backend validation failed"
+	if len(v.Errors) > 0 {
+		diag.Message = v.Errors[0].Message
+	}
+	return diag
+}
+
+// workflowFailure ends a workflow with the steps done so far and a machine-readable diagnostics block
+func workflowFailure(results []string, diag workflowDiagnostics) common.MCPToolResult {
+	results = append(results, fmt.Sprintf("\n## ❌ Stopped at stage '%s' for %s '%s'", diag.Stage, diag.ComponentType, diag.ComponentID))
+	results = append(results, diag.Message)
+	for _, e := range diag.Errors {
+		if e.Line > 0 {
+			results = append(results, fmt.Sprintf("- line %d: %s", e.Line, e.Message))
+		} else {
+			results = append(results, fmt.Sprintf("- %s", e.Message))
+		}
+	}
+	if len(diag.Created) > 0 {
+		results = append(results, fmt.Sprintf("⚠️ Already created (temporary, not deployed): %s", strings.Join(diag.Created, ", ")))
+		results = append(results, "Fix the error and re-run, or discard them via `get_pending_changes`.")
+	}
+	if raw, err := json.MarshalIndent(diag, "", "  "); err == nil {
+		results = append(results, "\n### Diagnostics")
+		results = append(results, "```json")
+		results = append(results, string(raw))
+		results = append(results, "```")
+	}
+	return common.MCPToolResult{
+		Content: []common.MCPToolContent{{Type: "text", Text: strings.Join(results, "\n")}},
+		IsError: true,
+	}
+}
+
+// verifyWarnings renders non-fatal verification warnings
+func verifyWarnings(v *verifyResponse) []string {
+	var out []string
+	for _, w := range v.Warnings {
+		if w.Line > 0 {
+			out = append(out, fmt.Sprintf("⚠️ line %d: %s", w.Line, w.Message))
+		} else {
+			out = append(out, fmt.Sprintf("⚠️ %s", w.Message))
+		}
+	}
+	return out
+}
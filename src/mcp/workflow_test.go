@@ -0,0 +1,249 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHub is a minimal stand-in for the hub API that records every call.
+// Handlers keyed by "METHOD /path" override the default empty success response.
+type fakeHub struct {
+	mu       sync.Mutex
+	calls    []string
+	bodies   map[string]map[string]interface{}
+	handlers map[string]func(w http.ResponseWriter)
+}
+
+func newFakeHub(t *testing.T) (*fakeHub, *APIMapper) {
+	h := &fakeHub{
+		bodies:   make(map[string]map[string]interface{}),
+		handlers: make(map[string]func(w http.ResponseWriter)),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		h.mu.Lock()
+		h.calls = append(h.calls, key)
+		h.bodies[key] = body
+		handler := h.handlers[key]
+		h.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if handler != nil {
+			handler(w)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/verify/"):
+			_, _ = w.Write([]byte(`{"valid":true,"errors":[],"warnings":[]}`))
+		case strings.HasPrefix(r.URL.Path, "/test-ruleset/"):
+			_, _ = w.Write([]byte(`{"success":true,"results":[{"matched":true}],"timeout":false}`))
+		default:
+			_, _ = w.Write([]byte(`{"message":"ok"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return h, NewAPIMapper(srv.URL, "test-token")
+}
+
+func (h *fakeHub) on(key string, status int, body string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[key] = func(w http.ResponseWriter) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func (h *fakeHub) called(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.calls {
+		if c == key {
+			return true
+		}
+	}
+	return false
+}
+
+func resultText(t *testing.T, tool string, args map[string]interface{}, m *APIMapper) (string, bool) {
+	t.Helper()
+	res, err := m.CallAPITool(tool, args)
+	if err != nil {
+		t.Fatalf("%s returned error: %v", tool, err)
+	}
+	if len(res.Content) == 0 {
+		t.Fatalf("%s returned no content", tool)
+	}
+	return res.Content[0].Text, res.IsError
+}
+
+func TestComponentWizardStopsWhenVerifyFails(t *testing.T) {
+	hub, m := newFakeHub(t)
+	hub.on("POST /verify/input/bad_input", http.StatusOK,
+		`{"valid":false,"errors":[{"line":3,"message":"missing required field 'kafka.topic'"}],"warnings":[]}`)
+
+	text, isErr := resultText(t, "component_wizard", map[string]interface{}{
+		"component_type": "input",
+		"component_id":   "bad_input",
+		"config_content": "type: kafka\nkafka:\n  brokers: [\"k:9092\"]\n",
+	}, m)
+
+	if !isErr {
+		t.Fatalf("expected an error result, got:\n%s", text)
+	}
+	if hub.called("POST /inputs") {
+		t.Fatal("component must not be created after a failed verification")
+	}
+	if !strings.Contains(text, `"stage": "verify"`) || !strings.Contains(text, "line 3") {
+		t.Fatalf("expected verify diagnostics with line number, got:\n%s", text)
+	}
+	if strings.Contains(text, "created successfully") {
+		t.Fatalf("failure result must not claim success:\n%s", text)
+	}
+}
+
+func TestComponentWizardCreatesAndTestsRuleset(t *testing.T) {
+	hub, m := newFakeHub(t)
+
+	text, isErr := resultText(t, "component_wizard", map[string]interface{}{
+		"component_type": "ruleset",
+		"component_id":   "rs1",
+		"config_content": `<root type="DETECTION"><rule id="r1"><check type="EQU" field="a">1</check></rule></root>`,
+		"test_data":      `[{"a":"1"}]`,
+	}, m)
+
+	if isErr {
+		t.Fatalf("unexpected error result:\n%s", text)
+	}
+	for _, call := range []string{"POST /verify/ruleset/rs1", "POST /rulesets", "POST /test-ruleset/rs1"} {
+		if !hub.called(call) {
+			t.Fatalf("expected call %s, got %v", call, hub.calls)
+		}
+	}
+	// the test endpoint takes a single event object, not the raw sample string
+	data, ok := hub.bodies["POST /test-ruleset/rs1"]["data"].(map[string]interface{})
+	if !ok || data["a"] != "1" {
+		t.Fatalf("expected first sample event as test data, got %v", hub.bodies["POST /test-ruleset/rs1"])
+	}
+}
+
+func TestComponentWizardPropagatesTestFailure(t *testing.T) {
+	hub, m := newFakeHub(t)
+	hub.on("POST /test-ruleset/rs1", http.StatusOK, `{"success":false,"error":"Failed to start ruleset: boom","results":[]}`)
+
+	text, isErr := resultText(t, "component_wizard", map[string]interface{}{
+		"component_type": "ruleset",
+		"component_id":   "rs1",
+		"config_content": `<root type="DETECTION"><rule id="r1"><check type="EQU" field="a">1</check></rule></root>`,
+		"test_data":      `{"a":"1"}`,
+	}, m)
+
+	if !isErr {
+		t.Fatalf("expected an error result, got:\n%s", text)
+	}
+	if !strings.Contains(text, `"stage": "test"`) || !strings.Contains(text, "boom") {
+		t.Fatalf("expected test diagnostics, got:\n%s", text)
+	}
+	if !strings.Contains(text, "ruleset/rs1") {
+		t.Fatalf("expected the created ruleset to be reported, got:\n%s", text)
+	}
+}
+
+func TestProjectWizardReportsPartialCreation(t *testing.T) {
+	hub, m := newFakeHub(t)
+	hub.on("POST /outputs", http.StatusInternalServerError, `{"error":"disk full"}`)
+
+	text, isErr := resultText(t, "project_wizard", map[string]interface{}{
+		"business_goal": "detect brute force",
+		"data_source":   "kafka",
+		"auto_create":   "true",
+	}, m)
+
+	if !isErr {
+		t.Fatalf("expected an error result, got:\n%s", text)
+	}
+	if hub.called("POST /projects") {
+		t.Fatal("project must not be created after a failed output creation")
+	}
+	if !strings.Contains(text, `"stage": "create"`) || !strings.Contains(text, `"status_code": 500`) || !strings.Contains(text, "disk full") {
+		t.Fatalf("expected create diagnostics, got:\n%s", text)
+	}
+	if !strings.Contains(text, `"input/`) || !strings.Contains(text, `"ruleset/`) {
+		t.Fatalf("expected already created components in diagnostics, got:\n%s", text)
+	}
+	if strings.Contains(text, "Project created successfully") {
+		t.Fatalf("failure result must not claim success:\n%s", text)
+	}
+}
+
+func TestProjectWizardVerifiesEveryComponent(t *testing.T) {
+	hub, m := newFakeHub(t)
+
+	text, isErr := resultText(t, "project_wizard", map[string]interface{}{
+		"business_goal": "detect brute force",
+		"data_source":   "kafka",
+		"auto_create":   "true",
+	}, m)
+
+	if isErr {
+		t.Fatalf("unexpected error result:\n%s", text)
+	}
+	verified := 0
+	for _, c := range hub.calls {
+		if strings.HasPrefix(c, "POST /verify/") {
+			verified++
+		}
+	}
+	if verified != 4 {
+		t.Fatalf("expected 4 verify calls, got %d: %v", verified, hub.calls)
+	}
+}
+
+func TestCreateRuleCompletePropagatesAddFailure(t *testing.T) {
+	hub, m := newFakeHub(t)
+	hub.on("POST /rulesets/rs1/rules", http.StatusBadRequest, `{"error":"rule id already exists"}`)
+
+	text, isErr := resultText(t, "create_rule_complete", map[string]interface{}{
+		"ruleset_id":   "rs1",
+		"rule_purpose": "detect failed logins",
+	}, m)
+
+	if !isErr {
+		t.Fatalf("expected an error result, got:\n%s", text)
+	}
+	if hub.called("POST /verify/ruleset/rs1") {
+		t.Fatal("ruleset must not be verified after the rule could not be added")
+	}
+	if !strings.Contains(text, `"stage": "add_rule"`) || !strings.Contains(text, "rule id already exists") {
+		t.Fatalf("expected add_rule diagnostics, got:\n%s", text)
+	}
+}
+
+func TestCreateRuleCompleteStopsWhenRulesetInvalid(t *testing.T) {
+	hub, m := newFakeHub(t)
+	hub.on("POST /verify/ruleset/rs1", http.StatusOK,
+		`{"valid":false,"errors":[{"line":7,"message":"unknown check type"}],"warnings":[]}`)
+
+	text, isErr := resultText(t, "create_rule_complete", map[string]interface{}{
+		"ruleset_id":   "rs1",
+		"rule_purpose": "detect failed logins",
+		"sample_data":  `{"user":"root","result":"failure"}`,
+	}, m)
+
+	if !isErr {
+		t.Fatalf("expected an error result, got:\n%s", text)
+	}
+	if hub.called("POST /test-ruleset/rs1") {
+		t.Fatal("an invalid ruleset must not be tested")
+	}
+	if !strings.Contains(text, "line 7: unknown check type") {
+		t.Fatalf("expected verify diagnostics, got:\n%s", text)
+	}
+}
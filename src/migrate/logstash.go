@@ -0,0 +1,925 @@
+package migrate
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/output"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Logstash pipeline syntax: sections of plugins with settings, and if/else if/else blocks
+
+const (
+	lsWord = iota
+	lsString
+	lsRegex
+	lsPunct
+)
+
+type lsToken struct {
+	kind int
+	text string
+	line int
+}
+
+type lsSetting struct {
+	key   string
+	value interface{} // string, []interface{} or map[string]interface{}
+}
+
+// lsNode is a plugin, or a conditional when branches is set
+type lsNode struct {
+	name     string
+	line     int
+	settings []lsSetting
+	branches []lsBranch
+}
+
+// lsBranch is one if/else if/else block, expr is empty for else
+type lsBranch struct {
+	expr []lsToken
+	body []*lsNode
+}
+
+type lsSection struct {
+	name  string
+	line  int
+	nodes []*lsNode
+}
+
+func lexLogstash(data []byte) ([]lsToken, error) {
+	src := []rune(string(data))
+	var tokens []lsToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			start := line
+			var sb strings.Builder
+			i++
+			for ; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) && (src[i+1] == c || src[i+1] == '\\') {
+					i++
+				}
+				if src[i] == '\n' {
+					line++
+				}
+				sb.WriteRune(src[i])
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at line %d", start)
+			}
+			i++
+			tokens = append(tokens, lsToken{kind: lsString, text: sb.String(), line: start})
+		case c == '/' && len(tokens) > 0 && (tokens[len(tokens)-1].text == "=~" || tokens[len(tokens)-1].text == "!~"):
+			var sb strings.Builder
+			i++
+			for ; i < len(src) && src[i] != '/' && src[i] != '\n'; i++ {
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] == '/' {
+					i++
+				}
+				sb.WriteRune(src[i])
+			}
+			if i >= len(src) || src[i] != '/' {
+				return nil, fmt.Errorf("unterminated regex at line %d", line)
+			}
+			i++
+			tokens = append(tokens, lsToken{kind: lsRegex, text: sb.String(), line: line})
+		case isLogstashWord(c):
+			start := i
+			for i < len(src) && isLogstashWord(src[i]) {
+				i++
+			}
+			tokens = append(tokens, lsToken{kind: lsWord, text: string(src[start:i]), line: line})
+		default:
+			text := string(c)
+			if i+1 < len(src) {
+				switch two := string(src[i : i+2]); two {
+				case "=>", "==", "!=", "<=", ">=", "=~", "!~":
+					text = two
+				}
+			}
+			if !strings.Contains("{}[](),=<>!", string(c)) {
+				return nil, fmt.Errorf("unexpected character %q at line %d", c, line)
+			}
+			i += len(text)
+			tokens = append(tokens, lsToken{kind: lsPunct, text: text, line: line})
+		}
+	}
+	return tokens, nil
+}
+
+func isLogstashWord(c rune) bool {
+	return c == '_' || c == '-' || c == '.' || c == '@' || c == ':' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type lsParser struct {
+	tokens []lsToken
+	pos    int
+}
+
+func (p *lsParser) peek() lsToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	line := 0
+	if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return lsToken{kind: -1, line: line}
+}
+
+func (p *lsParser) next() lsToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *lsParser) expect(text string) error {
+	if t := p.next(); t.kind != lsPunct || t.text != text {
+		return fmt.Errorf("expected %q at line %d, got %q", text, t.line, t.text)
+	}
+	return nil
+}
+
+func (p *lsParser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == lsPunct && t.text == text
+}
+
+func parseLogstash(data []byte) ([]lsSection, error) {
+	tokens, err := lexLogstash(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &lsParser{tokens: tokens}
+	var sections []lsSection
+	for p.pos < len(p.tokens) {
+		t := p.next()
+		if t.kind != lsWord {
+			return nil, fmt.Errorf("expected input, filter or output at line %d, got %q", t.line, t.text)
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		nodes, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, lsSection{name: t.text, line: t.line, nodes: nodes})
+	}
+	return sections, nil
+}
+
+// block parses plugins and conditionals up to the closing brace
+func (p *lsParser) block() ([]*lsNode, error) {
+	var nodes []*lsNode
+	for {
+		t := p.next()
+		switch {
+		case t.kind == lsPunct && t.text == "}":
+			return nodes, nil
+		case t.kind == lsWord && t.text == "if":
+			node, err := p.conditional(t)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case t.kind == lsWord:
+			if err := p.expect("{"); err != nil {
+				return nil, err
+			}
+			settings, err := p.settings()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, &lsNode{name: t.text, line: t.line, settings: settings})
+		default:
+			return nil, fmt.Errorf("unexpected %q at line %d", t.text, t.line)
+		}
+	}
+}
+
+func (p *lsParser) conditional(ifToken lsToken) (*lsNode, error) {
+	node := &lsNode{name: "if", line: ifToken.line}
+	for {
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		node.branches = append(node.branches, lsBranch{expr: expr, body: body})
+
+		if t := p.peek(); t.kind != lsWord || t.text != "else" {
+			return node, nil
+		}
+		p.next()
+		if t := p.peek(); t.kind == lsWord && t.text == "if" {
+			p.next()
+			continue
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		body, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+		node.branches = append(node.branches, lsBranch{body: body})
+		return node, nil
+	}
+}
+
+// expr collects the tokens of a condition up to the brace opening its block
+func (p *lsParser) expr() ([]lsToken, error) {
+	var expr []lsToken
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == -1:
+			return nil, fmt.Errorf("unterminated condition at line %d", t.line)
+		case t.kind == lsPunct && t.text == "{" && depth == 0:
+			if len(expr) == 0 {
+				return nil, fmt.Errorf("empty condition at line %d", t.line)
+			}
+			return expr, nil
+		case t.kind == lsPunct && (t.text == "(" || t.text == "["):
+			depth++
+		case t.kind == lsPunct && (t.text == ")" || t.text == "]"):
+			depth--
+		}
+		expr = append(expr, t)
+	}
+}
+
+func (p *lsParser) settings() ([]lsSetting, error) {
+	var settings []lsSetting
+	for {
+		t := p.next()
+		if t.kind == lsPunct && t.text == "}" {
+			return settings, nil
+		}
+		if t.kind != lsWord && t.kind != lsString {
+			return nil, fmt.Errorf("expected setting name at line %d, got %q", t.line, t.text)
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, lsSetting{key: t.text, value: value})
+	}
+}
+
+func (p *lsParser) value() (interface{}, error) {
+	t := p.next()
+	switch {
+	case t.kind == lsWord || t.kind == lsString:
+		return t.text, nil
+	case t.kind == lsPunct && t.text == "[":
+		var items []interface{}
+		for {
+			if p.isPunct("]") {
+				p.next()
+				return items, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.isPunct(",") {
+				p.next()
+			}
+		}
+	case t.kind == lsPunct && t.text == "{":
+		hash := map[string]interface{}{}
+		for {
+			k := p.next()
+			if k.kind == lsPunct && k.text == "}" {
+				return hash, nil
+			}
+			if k.kind != lsWord && k.kind != lsString {
+				return nil, fmt.Errorf("expected hash key at line %d, got %q", k.line, k.text)
+			}
+			if err := p.expect("=>"); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			hash[k.text] = v
+			if p.isPunct(",") {
+				p.next()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected value at line %d, got %q", t.line, t.text)
+	}
+}
+
+func (n *lsNode) options() *options {
+	values := make(map[string]interface{}, len(n.settings))
+	for _, s := range n.settings {
+		values[s.key] = s.value
+	}
+	return newOptions(values)
+}
+
+func (n *lsNode) location(section string) string {
+	return fmt.Sprintf("%s %s (line %d)", section, n.name, n.line)
+}
+
+// logstashConverter turns the parsed pipeline into components
+type logstashConverter struct {
+	name    string
+	res     *Result
+	grok    *inputDoc // the first filter when it is a grok, moved into the inputs
+	transf  *ruleBuilder
+	drops   *rulesetBuilder
+	filters *rulesetBuilder
+	// grokOpen is true while no filter ran before, so a grok can still move into the inputs
+	grokOpen bool
+}
+
+func importLogstash(data []byte, name string) (*Result, error) {
+	sections, err := parseLogstash(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse logstash pipeline: %w", err)
+	}
+	c := &logstashConverter{
+		name:     name,
+		res:      &Result{},
+		drops:    &rulesetBuilder{typ: "EXCLUDE", name: name + "_drop"},
+		filters:  &rulesetBuilder{typ: "DETECTION", name: name},
+		grokOpen: true,
+	}
+	c.transf = c.filters.rule(name+"_filters", "Converted Logstash filters")
+
+	// Inputs are converted last, since the first grok filter becomes part of them
+	var inputs, outputs []*lsNode
+	var outputConds []*lsNode
+	for _, sec := range sections {
+		switch sec.name {
+		case "input":
+			inputs = append(inputs, sec.nodes...)
+		case "filter":
+			c.filterBlock(sec.nodes)
+		case "output":
+			for _, n := range sec.nodes {
+				if n.branches != nil {
+					outputConds = append(outputConds, n)
+					continue
+				}
+				outputs = append(outputs, n)
+			}
+		default:
+			return nil, fmt.Errorf("unknown section %q at line %d", sec.name, sec.line)
+		}
+	}
+
+	var inputIDs []string
+	for _, n := range inputs {
+		if n.branches != nil {
+			c.res.unmapped(n.location("input"), "conditionals are not supported in inputs")
+			continue
+		}
+		if id := c.input(n); id != "" {
+			inputIDs = append(inputIDs, id)
+		}
+	}
+
+	// Outputs inside conditionals receive all events, the hub routes by project edges instead
+	for _, n := range outputConds {
+		c.res.unmapped(n.location("output"), "condition %q is not converted, its outputs receive all events", lsExprString(n.branches[0].expr))
+		for _, b := range n.branches {
+			outputs = append(outputs, flattenNodes(b.body)...)
+		}
+	}
+	var outputIDs []string
+	for _, n := range outputs {
+		if id := c.output(n); id != "" {
+			outputIDs = append(outputIDs, id)
+		}
+	}
+
+	// Data flow: inputs -> drop conditions -> filters -> outputs
+	var chain []string
+	for _, rs := range []*rulesetBuilder{c.drops, c.filters} {
+		if rs.empty() {
+			continue
+		}
+		content := rs.xml("<!-- Generated from a Logstash pipeline, review before use -->\n")
+		if err := rs.valid(content); err != nil {
+			c.res.unmapped("filter", "generated ruleset %s is invalid and was not written: %v", rs.name, err)
+			continue
+		}
+		chain = append(chain, "RULESET."+c.res.add("RULESET", rs.name, content))
+	}
+
+	var edges []string
+	from := make([]string, 0, len(inputIDs))
+	for _, in := range inputIDs {
+		from = append(from, "INPUT."+in)
+	}
+	for _, node := range chain {
+		for _, f := range from {
+			edges = append(edges, f+" -> "+node)
+		}
+		from = []string{node}
+	}
+	for _, out := range outputIDs {
+		for _, f := range from {
+			edges = append(edges, f+" -> OUTPUT."+out)
+		}
+	}
+	if len(inputIDs) == 0 || len(outputIDs) == 0 {
+		c.res.unmapped("pipeline", "no project generated, the pipeline needs at least one converted input and output")
+	} else {
+		c.res.add("PROJECT", name, projectContent("# Generated from a Logstash pipeline, review before use\n", edges))
+	}
+	return c.res, nil
+}
+
+func flattenNodes(nodes []*lsNode) []*lsNode {
+	var res []*lsNode
+	for _, n := range nodes {
+		if n.branches == nil {
+			res = append(res, n)
+			continue
+		}
+		for _, b := range n.branches {
+			res = append(res, flattenNodes(b.body)...)
+		}
+	}
+	return res
+}
+
+func (c *logstashConverter) input(n *lsNode) string {
+	opts := n.options()
+	opts.ignore("id")
+	loc := n.location("input")
+	doc := &inputDoc{}
+	if c.grok != nil {
+		doc.GrokPattern, doc.GrokField = c.grok.GrokPattern, c.grok.GrokField
+	}
+
+	switch n.name {
+	case "kafka":
+		topics := opts.list("topics")
+		doc.Type = input.InputTypeKafka
+		doc.Kafka = &input.KafkaInputConfig{
+			Brokers:     splitList(opts.list("bootstrap_servers")),
+			Group:       opts.str("group_id"),
+			Topic:       firstTopic(c.res, loc, topics),
+			OffsetReset: opts.str("auto_offset_reset"),
+		}
+		if doc.Kafka.Group == "" {
+			// The default consumer group of the Logstash kafka input
+			doc.Kafka.Group = "logstash"
+		}
+		doc.Kafka.SASL, doc.Kafka.TLS = kafkaSecurity(c.res, loc, opts.str("security_protocol"), opts.str("sasl_mechanism"))
+		if doc.Kafka.SASL != nil {
+			doc.Kafka.SASL.Username, doc.Kafka.SASL.Password = jaasCredentials(opts.str("sasl_jaas_config"))
+		}
+		if codec := opts.str("codec"); codec != "" && codec != "json" {
+			c.res.unmapped(loc, "codec %q is not converted, the hub reads JSON events", codec)
+		}
+	default:
+		c.res.unmapped(loc, "input plugin %q has no hub equivalent", n.name)
+		return ""
+	}
+	for _, k := range opts.unused() {
+		c.res.unmapped(loc, "setting %q is not converted", k)
+	}
+	return c.res.add("INPUT", c.name+"_"+n.name, marshalYAML("# Generated from a Logstash pipeline, review before use\n", doc))
+}
+
+var jaasRe = regexp.MustCompile(`(username|password)\s*=\s*"([^"]*)"`)
+
+// jaasCredentials reads the user name and password of a sasl_jaas_config
+func jaasCredentials(jaas string) (string, string) {
+	var user, pass string
+	for _, m := range jaasRe.FindAllStringSubmatch(jaas, -1) {
+		if m[1] == "username" {
+			user = m[2]
+		} else {
+			pass = m[2]
+		}
+	}
+	return user, pass
+}
+
+func (c *logstashConverter) filterBlock(nodes []*lsNode) {
+	for _, n := range nodes {
+		if n.branches != nil {
+			c.conditional(n)
+			c.grokOpen = false
+			continue
+		}
+		c.filter(n)
+	}
+}
+
+// conditional converts "if <condition> { drop {} }" into an exclude rule, other conditionals are reported
+func (c *logstashConverter) conditional(n *lsNode) {
+	loc := n.location("filter")
+	if len(n.branches) > 1 {
+		c.res.unmapped(loc, "else branches are not supported, the conditional %q is not converted", lsExprString(n.branches[0].expr))
+		return
+	}
+	b := n.branches[0]
+	drops := false
+	for _, f := range b.body {
+		if f.branches == nil && f.name == "drop" {
+			drops = true
+		}
+	}
+	if !drops {
+		c.res.unmapped(loc, "filters under condition %q are not converted, rulesets cannot apply them conditionally without emitting extra records", lsExprString(b.expr))
+		return
+	}
+	checks, err := logstashChecks(b.expr)
+	if err != nil {
+		c.res.unmapped(loc, "drop condition %q is not converted: %v", lsExprString(b.expr), err)
+		return
+	}
+	rule := c.drops.rule(fmt.Sprintf("%s_drop_%d", c.name, len(c.drops.rules)+1), "Dropped by the Logstash pipeline (line "+fmt.Sprint(n.line)+")")
+	for _, ch := range checks {
+		rule.check(ch)
+	}
+}
+
+func (c *logstashConverter) filter(n *lsNode) {
+	loc := n.location("filter")
+	opts := n.options()
+	opts.ignore("id", "add_tag", "remove_tag", "tag_on_failure", "periodic_flush", "enable_metric")
+	r := c.transf
+	firstFilter := c.grokOpen
+	c.grokOpen = false
+
+	switch n.name {
+	case "grok":
+		match := opts.table("match")
+		if !firstFilter || len(match) != 1 {
+			c.res.unmapped(loc, "only a first grok filter with one match field is converted, into the grok_pattern of the inputs")
+			return
+		}
+		for field, patterns := range match {
+			list := newOptions(map[string]interface{}{"p": patterns}).list("p")
+			if len(list) > 1 {
+				c.res.unmapped(loc, "only the first of %d grok patterns is used", len(list))
+			}
+			c.grok = &inputDoc{GrokPattern: list[0]}
+			if f := logstashField(field); f != "message" {
+				c.grok.GrokField = f
+			}
+		}
+		opts.ignore("break_on_match")
+	case "mutate":
+		c.mutate(opts, loc)
+	case "json":
+		source, target := logstashField(opts.str("source")), logstashField(opts.str("target"))
+		if target == "" {
+			r.modifyPlugin("", pluginCall("parseJSON", source))
+			c.res.unmapped(loc, "without a target the parsed document replaces the record instead of being merged into it")
+		} else {
+			r.appendPlugin(target, pluginCall("parseJSON", source))
+		}
+		opts.ignore("skip_on_invalid_json")
+	case "useragent":
+		source, target := logstashField(opts.str("source")), logstashField(opts.str("target"))
+		if target == "" {
+			target = "user_agent"
+		}
+		r.appendPlugin(target, pluginCall("parseUA", source))
+	case "date":
+		match := opts.list("match")
+		if len(match) == 0 {
+			c.res.unmapped(loc, "date filter without match is not converted")
+			return
+		}
+		target := logstashField(opts.str("target"))
+		if target == "" {
+			target = "@timestamp"
+		}
+		args := []string{logstashField(match[0])}
+		for _, f := range match[1:] {
+			if named, ok := logstashDateFormats[strings.ToUpper(f)]; ok {
+				args = append(args, pluginString(named))
+			} else {
+				c.res.unmapped(loc, "Joda date pattern %q is not converted, normalizeTime guesses common layouts", f)
+			}
+		}
+		if tz := opts.str("timezone"); tz != "" {
+			args = append(args, pluginString("tz="+tz))
+		}
+		r.appendPlugin(target, pluginCall("normalizeTime", args...))
+	case "drop":
+		c.res.unmapped(loc, "an unconditional drop discards every event and is not converted")
+		return
+	default:
+		c.res.unmapped(loc, "filter plugin %q has no hub equivalent", n.name)
+		return
+	}
+	for _, k := range opts.unused() {
+		c.res.unmapped(loc, "setting %q is not converted", k)
+	}
+}
+
+// logstashDateFormats maps the named formats of the date filter to normalizeTime formats
+var logstashDateFormats = map[string]string{
+	"ISO8601":  "iso8601",
+	"UNIX":     "unix",
+	"UNIX_MS":  "unix_ms",
+	"RFC3339":  "rfc3339",
+	"RFC1123":  "rfc1123",
+	"HTTPDATE": "clf",
+}
+
+func (c *logstashConverter) mutate(opts *options, loc string) {
+	r := c.transf
+	// Logstash applies the mutations in a fixed order regardless of the order in the config
+	renames := opts.table("rename")
+	for _, from := range sortedKeys(renames) {
+		to := logstashField(scalarString(renames[from]))
+		r.appendValue(to, "_$"+logstashField(from))
+		r.del([]string{logstashField(from)})
+	}
+	for _, key := range []string{"replace", "update"} {
+		values := opts.table(key)
+		for _, field := range sortedKeys(values) {
+			value, ok := logstashValue(scalarString(values[field]))
+			if !ok {
+				c.res.unmapped(loc, "%s of %q uses an sprintf format that is kept as literal text", key, field)
+			}
+			r.modifyValue(logstashField(field), value)
+		}
+	}
+	if gsub := opts.list("gsub"); len(gsub) > 0 {
+		if len(gsub)%3 != 0 {
+			c.res.unmapped(loc, "gsub needs field, pattern and replacement triples")
+		} else {
+			for i := 0; i < len(gsub); i += 3 {
+				field := logstashField(gsub[i])
+				r.modifyPlugin(field, pluginCall("regexReplace", field, pluginString(gsub[i+1]), pluginString(gsub[i+2])))
+			}
+		}
+	}
+	for _, key := range []string{"lowercase", "uppercase", "strip", "convert", "split", "join", "merge", "copy", "coerce", "capitalize"} {
+		if _, ok := opts.values[key]; ok {
+			opts.used[key] = true
+			c.res.unmapped(loc, "mutate %s is not converted", key)
+		}
+	}
+	added := opts.table("add_field")
+	for _, field := range sortedKeys(added) {
+		value, ok := logstashValue(scalarString(added[field]))
+		if !ok {
+			c.res.unmapped(loc, "add_field %q uses an sprintf format that is kept as literal text", field)
+		}
+		r.appendValue(logstashField(field), value)
+	}
+	var removed []string
+	for _, f := range opts.list("remove_field") {
+		removed = append(removed, logstashField(f))
+	}
+	r.del(removed)
+}
+
+var sprintfRe = regexp.MustCompile(`%\{[^}]*\}`)
+
+// logstashValue converts a value, a single field reference like "%{[host][name]}" becomes a
+// dynamic reference. It reports false when other sprintf references remain in the text.
+func logstashValue(v string) (string, bool) {
+	if m := sprintfRe.FindString(v); m == v && v != "" && !strings.HasPrefix(v, "%{+") {
+		return "_$" + logstashField(v[2:len(v)-1]), true
+	}
+	return v, !sprintfRe.MatchString(v)
+}
+
+// logstashField converts a field reference like [a][b] into the path a.b
+func logstashField(f string) string {
+	f = strings.TrimSpace(f)
+	if !strings.HasPrefix(f, "[") {
+		return f
+	}
+	parts := strings.Split(strings.Trim(f, "[]"), "][")
+	return strings.Join(parts, ".")
+}
+
+func lsExprString(expr []lsToken) string {
+	parts := make([]string, len(expr))
+	for i, t := range expr {
+		switch t.kind {
+		case lsString:
+			parts[i] = fmt.Sprintf("%q", t.text)
+		case lsRegex:
+			parts[i] = "/" + t.text + "/"
+		default:
+			parts[i] = t.text
+		}
+	}
+	s := strings.Join(parts, " ")
+	s = strings.ReplaceAll(s, "[ ", "[")
+	s = strings.ReplaceAll(s, " ]", "]")
+	return strings.ReplaceAll(s, "] [", "][")
+}
+
+// logstashChecks converts a condition made of comparisons joined by "and" into checks
+func logstashChecks(expr []lsToken) ([]check, error) {
+	var checks []check
+	for _, part := range splitTokens(expr, "and") {
+		ch, err := logstashCheck(part)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, ch)
+	}
+	return checks, nil
+}
+
+func splitTokens(expr []lsToken, word string) [][]lsToken {
+	var parts [][]lsToken
+	start := 0
+	for i, t := range expr {
+		if t.kind == lsWord && t.text == word {
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// lsOperand reads a field reference or a literal at the start of tokens
+func lsOperand(tokens []lsToken) (field string, literal string, rest []lsToken, ok bool) {
+	if len(tokens) == 0 {
+		return "", "", nil, false
+	}
+	if tokens[0].kind == lsString || tokens[0].kind == lsWord {
+		return "", tokens[0].text, tokens[1:], true
+	}
+	var parts []string
+	i := 0
+	for i+2 < len(tokens) && tokens[i].text == "[" && tokens[i+2].text == "]" && tokens[i+1].kind != lsPunct {
+		parts = append(parts, tokens[i+1].text)
+		i += 3
+		if i >= len(tokens) || tokens[i].text != "[" {
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "", "", nil, false
+	}
+	return strings.Join(parts, "."), "", tokens[i:], true
+}
+
+var lsCompareTypes = map[string]string{"==": "EQU", "!=": "NEQ", ">": "MT", "<": "LT"}
+
+func logstashCheck(tokens []lsToken) (check, error) {
+	for _, t := range tokens {
+		if t.kind == lsWord && (t.text == "or" || t.text == "xor" || t.text == "nand") {
+			return check{}, fmt.Errorf("%q is not supported, only \"and\"", t.text)
+		}
+		if t.kind == lsPunct && t.text == "(" {
+			return check{}, fmt.Errorf("parentheses are not supported")
+		}
+	}
+	negate := false
+	if len(tokens) > 0 && tokens[0].text == "!" {
+		negate = true
+		tokens = tokens[1:]
+	}
+	field, literal, rest, ok := lsOperand(tokens)
+	if !ok {
+		return check{}, fmt.Errorf("unsupported operand")
+	}
+
+	switch {
+	case len(rest) == 0 && field != "":
+		if negate {
+			return check{typ: "ISNULL", field: field}, nil
+		}
+		return check{typ: "NOTNULL", field: field}, nil
+	case negate:
+		return check{}, fmt.Errorf("negated comparisons are not supported")
+	case field != "" && len(rest) == 2 && rest[0].text == "=~" && rest[1].kind == lsRegex:
+		return check{typ: "REGEX", field: field, value: rest[1].text}, nil
+	case field != "" && len(rest) == 2 && lsCompareTypes[rest[0].text] != "":
+		if rest[1].kind != lsString && rest[1].kind != lsWord {
+			return check{}, fmt.Errorf("comparing two fields is not supported")
+		}
+		return check{typ: lsCompareTypes[rest[0].text], field: field, value: rest[1].text}, nil
+	case field != "" && len(rest) > 2 && rest[0].text == "in" && rest[1].text == "[":
+		var values []string
+		for _, t := range rest[2:] {
+			if t.kind == lsString || t.kind == lsWord {
+				values = append(values, t.text)
+			}
+		}
+		return check{typ: "EQU", field: field, value: strings.Join(values, "|"), logic: "OR", delimiter: "|"}, nil
+	case literal != "" && len(rest) > 1 && rest[0].text == "in":
+		target, _, tail, ok := lsOperand(rest[1:])
+		if !ok || target == "" || len(tail) > 0 {
+			return check{}, fmt.Errorf("unsupported \"in\" operand")
+		}
+		return check{typ: "INCL", field: target, value: literal}, nil
+	default:
+		return check{}, fmt.Errorf("unsupported comparison")
+	}
+}
+
+func (c *logstashConverter) output(n *lsNode) string {
+	opts := n.options()
+	opts.ignore("id", "codec")
+	loc := n.location("output")
+	doc := &outputDoc{}
+
+	switch n.name {
+	case "elasticsearch":
+		index, ok := logstashValue(opts.str("index"))
+		if !ok || index == "" {
+			c.res.unmapped(loc, "index %q is not converted, set a fixed index or a data stream", opts.str("index"))
+			index = c.name
+		}
+		doc.Type = output.OutputTypeElasticsearch
+		doc.Elasticsearch = &output.ElasticsearchOutputConfig{
+			Hosts: opts.list("hosts"),
+			Index: index,
+		}
+		if user := opts.str("user"); user != "" {
+			doc.Elasticsearch.Auth = &common.ElasticsearchAuthConfig{Type: "basic", Username: user, Password: opts.str("password")}
+		} else if key := opts.str("api_key"); key != "" {
+			doc.Elasticsearch.Auth = &common.ElasticsearchAuthConfig{Type: "api_key", APIKey: key}
+		}
+		if ds, ok := opts.bool("data_stream"); ok && ds {
+			doc.Elasticsearch.DataStream = true
+		}
+	case "kafka":
+		doc.Type = output.OutputTypeKafka
+		doc.Kafka = &output.KafkaOutputConfig{
+			Brokers:     splitList(opts.list("bootstrap_servers")),
+			Topic:       opts.str("topic_id"),
+			Compression: common.KafkaCompressionType(opts.str("compression_type")),
+		}
+		if key := opts.str("message_key"); key != "" {
+			if ref, ok := logstashValue(key); ok && strings.HasPrefix(ref, "_$") {
+				doc.Kafka.Key = strings.TrimPrefix(ref, "_$")
+			} else {
+				c.res.unmapped(loc, "message_key %q is not a single field reference and is not converted", key)
+			}
+		}
+		if strings.Contains(doc.Kafka.Topic, "%{") {
+			c.res.unmapped(loc, "topic_id %q uses an sprintf format, route events with project edges instead", doc.Kafka.Topic)
+		}
+		doc.Kafka.SASL, doc.Kafka.TLS = kafkaSecurity(c.res, loc, opts.str("security_protocol"), opts.str("sasl_mechanism"))
+		if doc.Kafka.SASL != nil {
+			doc.Kafka.SASL.Username, doc.Kafka.SASL.Password = jaasCredentials(opts.str("sasl_jaas_config"))
+		}
+	case "http":
+		doc.Type = output.OutputTypeWebhook
+		doc.Webhook = &output.WebhookOutputConfig{
+			URL:         opts.str("url"),
+			Method:      strings.ToUpper(opts.str("http_method")),
+			ContentType: opts.str("content_type"),
+		}
+		if headers := opts.table("headers"); len(headers) > 0 {
+			doc.Webhook.Headers = map[string]string{}
+			for k, v := range headers {
+				doc.Webhook.Headers[k] = scalarString(v)
+			}
+		}
+		if format := opts.str("format"); format != "" && format != "json" {
+			c.res.unmapped(loc, "format %q is not converted, the webhook posts each event as JSON", format)
+		}
+	case "stdout":
+		doc.Type = output.OutputTypePrint
+	default:
+		c.res.unmapped(loc, "output plugin %q has no hub equivalent", n.name)
+		return ""
+	}
+	for _, k := range opts.unused() {
+		c.res.unmapped(loc, "setting %q is not converted", k)
+	}
+	return c.res.add("OUTPUT", c.name+"_"+n.name, marshalYAML("# Generated from a Logstash pipeline, review before use\n", doc))
+}
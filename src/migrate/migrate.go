@@ -0,0 +1,477 @@
+// Package migrate converts Logstash pipelines and Vector configurations into hub components.
+// The conversion is best effort: everything that cannot be expressed is listed as unmapped in
+// the result, so the generated components are a starting point for review, not a drop-in copy.
+package migrate
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/output"
+	"AgentSmith-HUB/rules_engine"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SourceLogstash = "logstash"
+	SourceVector   = "vector"
+)
+
+// Component is a generated component file
+type Component struct {
+	Type    string // INPUT, OUTPUT, RULESET or PROJECT
+	ID      string
+	Content string
+}
+
+// Path returns the file of the component under config_root
+func (c Component) Path(cfgRoot string) string {
+	ext := ".yaml"
+	if c.Type == "RULESET" {
+		ext = ".xml"
+	}
+	return filepath.Join(cfgRoot, strings.ToLower(c.Type), c.ID+ext)
+}
+
+// Finding is a feature of the source configuration that was not converted, or only in part
+type Finding struct {
+	Location string `json:"location"` // e.g. "filter mutate (line 12)" or "transforms.parse"
+	Detail   string `json:"detail"`
+}
+
+// Result holds the generated components and the report of unmapped features
+type Result struct {
+	Components []Component
+	Unmapped   []Finding
+}
+
+func (r *Result) unmapped(location, format string, args ...interface{}) {
+	r.Unmapped = append(r.Unmapped, Finding{Location: location, Detail: fmt.Sprintf(format, args...)})
+}
+
+// add registers a component, the id gets a numeric suffix when it is already taken
+func (r *Result) add(typ, id, content string) string {
+	id = componentID(id)
+	base := id
+	for n := 2; r.has(typ, id); n++ {
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+	r.Components = append(r.Components, Component{Type: typ, ID: id, Content: content})
+	return id
+}
+
+func (r *Result) has(typ, id string) bool {
+	for _, c := range r.Components {
+		if c.Type == typ && c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Write saves the components under config_root. Nothing is written when one of the files exists.
+func (r *Result) Write(cfgRoot string) ([]string, error) {
+	var paths []string
+	for _, c := range r.Components {
+		p := c.Path(cfgRoot)
+		if _, err := os.Stat(p); err == nil {
+			return nil, fmt.Errorf("%s already exists, choose another name", p)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	for i, c := range r.Components {
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(paths[i], []byte(c.Content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// Import converts a Logstash pipeline or a Vector configuration. Vector files are read as YAML
+// when the file name ends in .yaml or .yml and as TOML otherwise. name prefixes the component ids.
+func Import(source, fileName string, data []byte, name string) (*Result, error) {
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	}
+	name = componentID(name)
+	switch source {
+	case SourceLogstash:
+		return importLogstash(data, name)
+	case SourceVector:
+		var cfg map[string]interface{}
+		var err error
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &cfg)
+		default:
+			cfg, err = parseTOML(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vector config: %w", err)
+		}
+		return importVector(cfg, name)
+	default:
+		return nil, fmt.Errorf("unsupported source %q, must be logstash or vector", source)
+	}
+}
+
+// componentID turns a name into a component id usable as a file name
+func componentID(name string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			sb.WriteRune(c)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "imported"
+	}
+	return sb.String()
+}
+
+// inputDoc and outputDoc hold the sections the importer fills, in the order of the hub docs
+type inputDoc struct {
+	Type        input.InputType            `yaml:"type"`
+	Kafka       *input.KafkaInputConfig    `yaml:"kafka,omitempty"`
+	Journald    *input.JournaldInputConfig `yaml:"journald,omitempty"`
+	GrokPattern string                     `yaml:"grok_pattern,omitempty"`
+	GrokField   string                     `yaml:"grok_field,omitempty"`
+}
+
+type outputDoc struct {
+	Type          output.OutputType                 `yaml:"type"`
+	Kafka         *output.KafkaOutputConfig         `yaml:"kafka,omitempty"`
+	Elasticsearch *output.ElasticsearchOutputConfig `yaml:"elasticsearch,omitempty"`
+	Webhook       *output.WebhookOutputConfig       `yaml:"webhook,omitempty"`
+}
+
+func marshalYAML(header string, v interface{}) string {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	_ = enc.Encode(v)
+	_ = enc.Close()
+	return buf.String()
+}
+
+// projectContent renders the data flow of a project, one edge per line
+func projectContent(header string, edges []string) string {
+	var sb strings.Builder
+	sb.WriteString(header)
+	sb.WriteString("content: |\n")
+	for _, e := range edges {
+		sb.WriteString("  " + e + "\n")
+	}
+	return sb.String()
+}
+
+// rulesetBuilder renders the XML of a generated ruleset
+type rulesetBuilder struct {
+	typ   string // DETECTION or EXCLUDE
+	name  string
+	rules []*ruleBuilder
+}
+
+type ruleBuilder struct {
+	id   string
+	name string
+	body []string
+}
+
+func (rs *rulesetBuilder) rule(id, name string) *ruleBuilder {
+	r := &ruleBuilder{id: id, name: name}
+	rs.rules = append(rs.rules, r)
+	return r
+}
+
+func (rs *rulesetBuilder) xml(header string) string {
+	var sb strings.Builder
+	sb.WriteString(header)
+	fmt.Fprintf(&sb, "<root type=\"%s\" name=\"%s\" author=\"migrate\">\n", rs.typ, xmlEscape(rs.name))
+	for _, r := range rs.rules {
+		fmt.Fprintf(&sb, "    <rule id=\"%s\" name=\"%s\">\n", xmlEscape(r.id), xmlEscape(r.name))
+		for _, line := range r.body {
+			sb.WriteString("        " + line + "\n")
+		}
+		sb.WriteString("    </rule>\n")
+	}
+	sb.WriteString("</root>\n")
+	return sb.String()
+}
+
+// empty reports whether no rule does anything, such a ruleset is not generated
+func (rs *rulesetBuilder) empty() bool {
+	for _, r := range rs.rules {
+		if len(r.body) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// valid parses the rendered ruleset, so a conversion bug is reported instead of written
+func (rs *rulesetBuilder) valid(content string) error {
+	_, err := rules_engine.ParseRuleset([]byte(content))
+	return err
+}
+
+func (r *ruleBuilder) check(c check) {
+	extra := ""
+	if c.logic != "" {
+		extra = fmt.Sprintf(" logic=\"%s\" delimiter=\"%s\"", c.logic, xmlEscape(c.delimiter))
+	}
+	r.body = append(r.body, fmt.Sprintf("<check type=\"%s\" field=\"%s\"%s>%s</check>", c.typ, xmlEscape(c.field), extra, xmlText(c.value)))
+}
+
+func (r *ruleBuilder) appendValue(field, value string) {
+	r.body = append(r.body, fmt.Sprintf("<append field=\"%s\">%s</append>", xmlEscape(field), xmlText(value)))
+}
+
+func (r *ruleBuilder) appendPlugin(field, call string) {
+	r.body = append(r.body, fmt.Sprintf("<append type=\"PLUGIN\" field=\"%s\">%s</append>", xmlEscape(field), xmlText(call)))
+}
+
+func (r *ruleBuilder) modifyValue(field, value string) {
+	r.body = append(r.body, fmt.Sprintf("<modify field=\"%s\">%s</modify>", xmlEscape(field), xmlText(value)))
+}
+
+// modifyPlugin sets field to the plugin result, or replaces the record when field is empty
+func (r *ruleBuilder) modifyPlugin(field, call string) {
+	if field == "" {
+		r.body = append(r.body, fmt.Sprintf("<modify type=\"PLUGIN\">%s</modify>", xmlText(call)))
+		return
+	}
+	r.body = append(r.body, fmt.Sprintf("<modify type=\"PLUGIN\" field=\"%s\">%s</modify>", xmlEscape(field), xmlText(call)))
+}
+
+func (r *ruleBuilder) del(fields []string) {
+	if len(fields) > 0 {
+		r.body = append(r.body, "<del>"+xmlText(strings.Join(fields, ","))+"</del>")
+	}
+}
+
+// check is a converted condition
+type check struct {
+	typ       string
+	field     string
+	value     string
+	logic     string
+	delimiter string
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+)
+
+// xmlEscape escapes attribute values, xmlText element text
+func xmlEscape(s string) string {
+	return xmlAttrEscaper.Replace(s)
+}
+
+func xmlText(s string) string {
+	return xmlTextEscaper.Replace(s)
+}
+
+// pluginCall renders a plugin call, args are field paths unless quoted with pluginString
+func pluginCall(name string, args ...string) string {
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func pluginString(s string) string {
+	return strconv.Quote(s)
+}
+
+// options reads the settings of a source plugin and remembers which ones were used, so the rest
+// can be reported. Nested tables are flattened into dotted keys.
+type options struct {
+	values map[string]interface{}
+	used   map[string]bool
+}
+
+func newOptions(values map[string]interface{}) *options {
+	o := &options{values: map[string]interface{}{}, used: map[string]bool{}}
+	flattenOptions("", values, o.values)
+	return o
+}
+
+func flattenOptions(prefix string, values map[string]interface{}, out map[string]interface{}) {
+	for k, v := range values {
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			flattenOptions(prefix+k+".", m, out)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
+
+// ignore marks settings that need no conversion
+func (o *options) ignore(keys ...string) {
+	for _, k := range keys {
+		o.used[k] = true
+	}
+}
+
+func (o *options) str(key string) string {
+	v, ok := o.values[key]
+	if !ok {
+		return ""
+	}
+	o.used[key] = true
+	if list, ok := v.([]interface{}); ok && len(list) == 1 {
+		v = list[0]
+	}
+	return scalarString(v)
+}
+
+// list reads an array setting, a single value is a list of one
+func (o *options) list(key string) []string {
+	v, ok := o.values[key]
+	if !ok {
+		return nil
+	}
+	o.used[key] = true
+	items, ok := v.([]interface{})
+	if !ok {
+		return []string{scalarString(v)}
+	}
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, scalarString(item))
+	}
+	return res
+}
+
+// table returns the settings below key with the key prefix removed
+func (o *options) table(key string) map[string]interface{} {
+	prefix := key + "."
+	res := map[string]interface{}{}
+	for k, v := range o.values {
+		if strings.HasPrefix(k, prefix) {
+			o.used[k] = true
+			res[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return res
+}
+
+func (o *options) bool(key string) (bool, bool) {
+	s := o.str(key)
+	if s == "" {
+		return false, false
+	}
+	b, err := strconv.ParseBool(s)
+	return b, err == nil
+}
+
+// unused lists the settings nothing read, sorted
+func (o *options) unused() []string {
+	var res []string
+	for k := range o.values {
+		if !o.used[k] {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func scalarString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = scalarString(item)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitList splits comma separated hosts such as Kafka bootstrap servers
+func splitList(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				res = append(res, part)
+			}
+		}
+	}
+	return res
+}
+
+// firstTopic returns the topic of a Kafka input, hub inputs read one topic each
+func firstTopic(res *Result, loc string, topics []string) string {
+	switch len(topics) {
+	case 0:
+		res.unmapped(loc, "no topic set")
+		return ""
+	case 1:
+	default:
+		res.unmapped(loc, "only topic %q is read, add one input per topic for %s", topics[0], strings.Join(topics[1:], ", "))
+	}
+	return topics[0]
+}
+
+// kafkaSecurity converts a Kafka security protocol (SASL_SSL, SSL, ...) and SASL mechanism
+func kafkaSecurity(res *Result, loc, protocol, mechanism string) (*common.KafkaSASLConfig, *common.KafkaTLSConfig) {
+	var sasl *common.KafkaSASLConfig
+	var tls *common.KafkaTLSConfig
+	protocol = strings.ToUpper(protocol)
+	if strings.HasPrefix(protocol, "SASL") {
+		sasl = &common.KafkaSASLConfig{Enable: true, Mechanism: kafkaMechanism(res, loc, mechanism)}
+	}
+	if strings.HasSuffix(protocol, "SSL") {
+		tls = &common.KafkaTLSConfig{}
+		res.unmapped(loc, "TLS is enabled, set the PEM files of kafka.tls since Java key and trust stores are not converted")
+	}
+	return sasl, tls
+}
+
+func kafkaMechanism(res *Result, loc, mechanism string) common.KafkaSASLType {
+	switch strings.ToUpper(mechanism) {
+	case "", "PLAIN":
+		return common.KafkaSASLPlain
+	case "SCRAM-SHA-256":
+		return common.KafkaSASLSCRAMSHA256
+	case "SCRAM-SHA-512":
+		return common.KafkaSASLSCRAMSHA512
+	case "OAUTHBEARER":
+		res.unmapped(loc, "set the token_url, client_id and client_secret of the oauth SASL mechanism")
+		return common.KafkaSASLOAuth
+	default:
+		res.unmapped(loc, "SASL mechanism %q is not supported, plain is used", mechanism)
+		return common.KafkaSASLPlain
+	}
+}
@@ -0,0 +1,344 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML reads the subset of TOML used by Vector configs: tables, dotted keys, strings,
+// numbers, booleans, arrays and inline tables. Arrays of tables are not supported.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: []rune(string(data)), line: 1}
+	root := map[string]interface{}{}
+	current := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+		if p.peek() == '[' {
+			if p.peekAt(1) == '[' {
+				return nil, fmt.Errorf("arrays of tables are not supported at line %d", p.line)
+			}
+			p.pos++
+			keys, err := p.keyPath()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.peek() != ']' {
+				return nil, fmt.Errorf("expected ] at line %d", p.line)
+			}
+			p.pos++
+			if current, err = tomlTable(root, keys, p.line); err != nil {
+				return nil, err
+			}
+		} else if err := p.keyValue(current); err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	src  []rune
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() rune { return p.peekAt(0) }
+
+func (p *tomlParser) peekAt(n int) rune {
+	if p.pos+n < len(p.src) {
+		return p.src[p.pos+n]
+	}
+	return 0
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:min(len(p.src), p.pos+len(s))]), s)
+}
+
+// skipSpace skips blanks and comments, and newlines when newlines is set
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.line++
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return fmt.Errorf("unexpected %q at line %d", p.peek(), p.line)
+	}
+	return nil
+}
+
+func (p *tomlParser) keyPath() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.stringValue()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isTOMLBareKey(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected key at line %d", p.line)
+			}
+			key = string(p.src[start:p.pos])
+		}
+		keys = append(keys, key)
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isTOMLBareKey(c rune) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.keyPath()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return fmt.Errorf("expected = at line %d", p.line)
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := tomlTable(table, keys[:len(keys)-1], p.line)
+	if err != nil {
+		return err
+	}
+	parent[keys[len(keys)-1]] = value
+	return nil
+}
+
+// tomlTable returns the table at keys below root, creating the missing ones
+func tomlTable(root map[string]interface{}, keys []string, line int) (map[string]interface{}, error) {
+	t := root
+	for _, k := range keys {
+		v, ok := t[k]
+		if !ok {
+			sub := map[string]interface{}{}
+			t[k] = sub
+			t = sub
+			continue
+		}
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table at line %d", k, line)
+		}
+		t = sub
+	}
+	return t, nil
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.stringValue()
+	case c == '[':
+		p.pos++
+		var items []interface{}
+		for {
+			p.skipSpace(true)
+			if p.peek() == ']' {
+				p.pos++
+				return items, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			p.skipSpace(true)
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != ']' {
+				return nil, fmt.Errorf("expected , or ] at line %d", p.line)
+			}
+		}
+	case c == '{':
+		p.pos++
+		table := map[string]interface{}{}
+		for {
+			p.skipSpace(false)
+			if p.peek() == '}' {
+				p.pos++
+				return table, nil
+			}
+			if err := p.keyValue(table); err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != '}' {
+				return nil, fmt.Errorf("expected , or } at line %d", p.line)
+			}
+		}
+	default:
+		start := p.pos
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", p.peek()) {
+			p.pos++
+		}
+		word := string(p.src[start:p.pos])
+		switch {
+		case word == "":
+			return nil, fmt.Errorf("expected value at line %d", p.line)
+		case word == "true" || word == "false":
+			return word == "true", nil
+		}
+		clean := strings.ReplaceAll(word, "_", "")
+		if i, err := strconv.ParseInt(clean, 0, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(clean, 64); err == nil {
+			return f, nil
+		}
+		// Dates and times are kept as text
+		return word, nil
+	}
+}
+
+func (p *tomlParser) stringValue() (string, error) {
+	quote := p.peek()
+	multi := p.hasPrefix(strings.Repeat(string(quote), 3))
+	start := p.line
+	if multi {
+		p.pos += 3
+		// A newline right after the opening quotes is not part of the string
+		if p.peek() == '\r' {
+			p.pos++
+		}
+		if p.peek() == '\n' {
+			p.pos++
+			p.line++
+		}
+	} else {
+		p.pos++
+	}
+
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string at line %d", start)
+		}
+		c := p.peek()
+		if multi && p.hasPrefix(strings.Repeat(string(quote), 3)) {
+			p.pos += 3
+			// Up to two more quotes belong to the string
+			for p.peek() == quote {
+				sb.WriteRune(quote)
+				p.pos++
+			}
+			return sb.String(), nil
+		}
+		if !multi && c == quote {
+			p.pos++
+			return sb.String(), nil
+		}
+		if c == '\n' {
+			if !multi {
+				return "", fmt.Errorf("unterminated string at line %d", start)
+			}
+			p.line++
+		}
+		if c == '\\' && quote == '"' {
+			if err := p.escape(&sb, multi); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteRune(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) escape(sb *strings.Builder, multi bool) error {
+	p.pos++
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case '"', '\\':
+		sb.WriteRune(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return fmt.Errorf("invalid unicode escape at line %d", p.line)
+		}
+		code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid unicode escape at line %d", p.line)
+		}
+		sb.WriteRune(rune(code))
+		p.pos += n
+	case ' ', '\t', '\r', '\n':
+		// A line ending backslash trims the whitespace up to the next text
+		if !multi {
+			return fmt.Errorf("invalid escape at line %d", p.line)
+		}
+		p.pos--
+		for !p.eof() && strings.ContainsRune(" \t\r\n", p.peek()) {
+			if p.peek() == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	default:
+		return fmt.Errorf("invalid escape \\%c at line %d", c, p.line)
+	}
+	return nil
+}
@@ -0,0 +1,585 @@
+package migrate
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/output"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// vectorNode is a source, transform or sink of the Vector topology
+type vectorNode struct {
+	kind   string // sources, transforms or sinks
+	inputs []string
+	ref    string // the hub component, e.g. RULESET.x, empty when not converted
+	bypass bool   // a transform that was not converted, its consumers read its inputs instead
+}
+
+type vectorConverter struct {
+	name  string
+	res   *Result
+	nodes map[string]*vectorNode
+}
+
+func importVector(cfg map[string]interface{}, name string) (*Result, error) {
+	c := &vectorConverter{name: name, res: &Result{}, nodes: map[string]*vectorNode{}}
+	for _, key := range sortedKeys(cfg) {
+		switch key {
+		case "sources", "transforms", "sinks":
+		case "data_dir", "schema", "healthchecks":
+			// Settings of the Vector process, nothing to convert
+		default:
+			c.res.unmapped(key, "top-level %q is not converted", key)
+		}
+	}
+
+	for _, kind := range []string{"sources", "transforms", "sinks"} {
+		section, _ := cfg[kind].(map[string]interface{})
+		for _, id := range sortedKeys(section) {
+			values, ok := section[id].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s.%s is not a table", kind, id)
+			}
+			opts := newOptions(values)
+			node := &vectorNode{kind: kind, inputs: opts.list("inputs")}
+			c.nodes[id] = node
+			loc := kind + "." + id
+			typ := opts.str("type")
+			switch kind {
+			case "sources":
+				node.ref = c.source(id, typ, opts, loc)
+			case "transforms":
+				node.ref = c.transform(id, typ, opts, loc)
+				node.bypass = node.ref == ""
+			case "sinks":
+				node.ref = c.sink(id, typ, opts, loc)
+			}
+			if node.ref == "" {
+				continue
+			}
+			for _, k := range opts.unused() {
+				c.res.unmapped(loc, "setting %q is not converted", k)
+			}
+		}
+	}
+
+	var edges []string
+	seen := map[string]bool{}
+	for _, id := range sortedNodeIDs(c.nodes) {
+		node := c.nodes[id]
+		if node.kind == "sources" || node.ref == "" {
+			continue
+		}
+		for _, from := range c.resolve(node.inputs, node.kind+"."+id, map[string]bool{}) {
+			edge := from + " -> " + node.ref
+			if !seen[edge] {
+				seen[edge] = true
+				edges = append(edges, edge)
+			}
+		}
+	}
+	if len(edges) == 0 {
+		c.res.unmapped("topology", "no project generated, no converted sink is connected to a converted source")
+	} else {
+		c.res.add("PROJECT", name, projectContent("# Generated from a Vector config, review before use\n", edges))
+	}
+	return c.res, nil
+}
+
+func sortedNodeIDs(nodes map[string]*vectorNode) []string {
+	m := make(map[string]interface{}, len(nodes))
+	for id := range nodes {
+		m[id] = nil
+	}
+	return sortedKeys(m)
+}
+
+// resolve returns the hub components feeding a node, looking through transforms that were not converted
+func (c *vectorConverter) resolve(inputs []string, loc string, visiting map[string]bool) []string {
+	var refs []string
+	for _, pattern := range inputs {
+		var matched []string
+		for _, id := range sortedNodeIDs(c.nodes) {
+			if ok, _ := path.Match(pattern, id); ok {
+				matched = append(matched, id)
+			}
+		}
+		if len(matched) == 0 {
+			// Named outputs of a transform, e.g. the routes of a route transform
+			if base, route, ok := strings.Cut(pattern, "."); ok && c.nodes[base] != nil {
+				c.res.unmapped(loc, "input %q reads route %q of %s, which receives all of its events", pattern, route, base)
+				matched = []string{base}
+			} else {
+				c.res.unmapped(loc, "input %q matches no component", pattern)
+			}
+		}
+		for _, id := range matched {
+			node := c.nodes[id]
+			switch {
+			case node.ref != "":
+				refs = append(refs, node.ref)
+			case node.bypass && !visiting[id]:
+				visiting[id] = true
+				refs = append(refs, c.resolve(node.inputs, loc, visiting)...)
+			}
+		}
+	}
+	return refs
+}
+
+func (c *vectorConverter) source(id, typ string, opts *options, loc string) string {
+	doc := &inputDoc{}
+	switch typ {
+	case "kafka":
+		doc.Type = input.InputTypeKafka
+		doc.Kafka = &input.KafkaInputConfig{
+			Brokers:     splitList(opts.list("bootstrap_servers")),
+			Group:       opts.str("group_id"),
+			Topic:       firstTopic(c.res, loc, opts.list("topics")),
+			OffsetReset: opts.str("auto_offset_reset"),
+		}
+		doc.Kafka.SASL, doc.Kafka.TLS = c.kafkaSecurity(opts, loc)
+		c.codec(opts, loc, "decoding.codec")
+	case "journald":
+		doc.Type = input.InputTypeJournald
+		doc.Journald = &input.JournaldInputConfig{
+			Units:     opts.list("include_units"),
+			Directory: opts.str("journal_directory"),
+		}
+		matches := opts.table("include_matches")
+		for _, field := range sortedKeys(matches) {
+			for _, v := range newOptions(map[string]interface{}{"v": matches[field]}).list("v") {
+				doc.Journald.Matches = append(doc.Journald.Matches, field+"="+v)
+			}
+		}
+		if sinceNow, ok := opts.bool("since_now"); ok {
+			doc.Journald.StartPosition = "beginning"
+			if sinceNow {
+				doc.Journald.StartPosition = "end"
+			}
+		}
+		opts.ignore("current_boot_only", "data_dir")
+	default:
+		c.res.unmapped(loc, "source type %q has no hub equivalent", typ)
+		return ""
+	}
+	return "INPUT." + c.res.add("INPUT", c.name+"_"+id, marshalYAML("# Generated from a Vector config, review before use\n", doc))
+}
+
+func (c *vectorConverter) kafkaSecurity(opts *options, loc string) (*common.KafkaSASLConfig, *common.KafkaTLSConfig) {
+	var sasl *common.KafkaSASLConfig
+	var tls *common.KafkaTLSConfig
+	if enabled, _ := opts.bool("sasl.enabled"); enabled {
+		sasl = &common.KafkaSASLConfig{
+			Enable:    true,
+			Mechanism: kafkaMechanism(c.res, loc, opts.str("sasl.mechanism")),
+			Username:  opts.str("sasl.username"),
+			Password:  opts.str("sasl.password"),
+		}
+	}
+	if enabled, _ := opts.bool("tls.enabled"); enabled {
+		tls = &common.KafkaTLSConfig{
+			CAFilePath: opts.str("tls.ca_file"),
+			CertPath:   opts.str("tls.crt_file"),
+			KeyPath:    opts.str("tls.key_file"),
+		}
+		if verify, ok := opts.bool("tls.verify_certificate"); ok && !verify {
+			tls.SkipVerify = true
+		}
+	}
+	return sasl, tls
+}
+
+// codec reports codecs other than json, hub components read and write JSON events
+func (c *vectorConverter) codec(opts *options, loc, key string) {
+	if codec := opts.str(key); codec != "" && codec != "json" {
+		c.res.unmapped(loc, "codec %q is not converted, the hub uses JSON events", codec)
+	}
+}
+
+func (c *vectorConverter) sink(id, typ string, opts *options, loc string) string {
+	doc := &outputDoc{}
+	switch typ {
+	case "elasticsearch":
+		doc.Type = output.OutputTypeElasticsearch
+		hosts := opts.list("endpoints")
+		if endpoint := opts.str("endpoint"); endpoint != "" {
+			hosts = append(hosts, endpoint)
+		}
+		doc.Elasticsearch = &output.ElasticsearchOutputConfig{Hosts: hosts, Index: opts.str("bulk.index")}
+		if opts.str("mode") == "data_stream" {
+			doc.Elasticsearch.DataStream = true
+			ds := []string{"logs", "generic", "default"}
+			for i, key := range []string{"data_stream.type", "data_stream.dataset", "data_stream.namespace"} {
+				if v := opts.str(key); v != "" {
+					ds[i] = v
+				}
+			}
+			doc.Elasticsearch.Index = strings.Join(ds, "-")
+		}
+		if vectorTemplate(doc.Elasticsearch.Index) {
+			c.res.unmapped(loc, "index %q is a template, set a fixed index", doc.Elasticsearch.Index)
+		}
+		if doc.Elasticsearch.Index == "" {
+			doc.Elasticsearch.Index = c.name
+		}
+		switch strategy := opts.str("auth.strategy"); strategy {
+		case "":
+		case "basic":
+			doc.Elasticsearch.Auth = &common.ElasticsearchAuthConfig{Type: "basic", Username: opts.str("auth.user"), Password: opts.str("auth.password")}
+		default:
+			c.res.unmapped(loc, "auth strategy %q is not converted", strategy)
+		}
+		c.codec(opts, loc, "encoding.codec")
+	case "kafka":
+		doc.Type = output.OutputTypeKafka
+		doc.Kafka = &output.KafkaOutputConfig{
+			Brokers:     splitList(opts.list("bootstrap_servers")),
+			Topic:       opts.str("topic"),
+			Key:         vrlPath(opts.str("key_field")),
+			Compression: common.KafkaCompressionType(opts.str("compression")),
+		}
+		if vectorTemplate(doc.Kafka.Topic) {
+			c.res.unmapped(loc, "topic %q is a template, route events with project edges instead", doc.Kafka.Topic)
+		}
+		doc.Kafka.SASL, doc.Kafka.TLS = c.kafkaSecurity(opts, loc)
+		c.codec(opts, loc, "encoding.codec")
+	case "http":
+		doc.Type = output.OutputTypeWebhook
+		doc.Webhook = &output.WebhookOutputConfig{
+			URL:    opts.str("uri"),
+			Method: strings.ToUpper(opts.str("method")),
+		}
+		if headers := opts.table("request.headers"); len(headers) > 0 {
+			doc.Webhook.Headers = map[string]string{}
+			for k, v := range headers {
+				doc.Webhook.Headers[k] = scalarString(v)
+			}
+		}
+		c.codec(opts, loc, "encoding.codec")
+	case "console":
+		doc.Type = output.OutputTypePrint
+		opts.ignore("encoding.codec", "target")
+	default:
+		c.res.unmapped(loc, "sink type %q has no hub equivalent", typ)
+		return ""
+	}
+	opts.ignore("healthcheck.enabled")
+	return "OUTPUT." + c.res.add("OUTPUT", c.name+"_"+id, marshalYAML("# Generated from a Vector config, review before use\n", doc))
+}
+
+func vectorTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func (c *vectorConverter) transform(id, typ string, opts *options, loc string) string {
+	rs := &rulesetBuilder{typ: "DETECTION", name: c.name + "_" + id}
+	rule := rs.rule(id, "Converted Vector "+typ+" transform")
+	switch typ {
+	case "remap":
+		if opts.str("file") != "" {
+			c.res.unmapped(loc, "VRL programs read from files are not converted")
+		}
+		for _, stmt := range vrlStatements(opts.str("source")) {
+			if err := vrlStatement(rule, stmt); err != nil {
+				c.res.unmapped(loc, "VRL %q is not converted: %v", stmt, err)
+			}
+		}
+		opts.ignore("drop_on_error", "drop_on_abort", "reroute_dropped")
+	case "filter":
+		condition := opts.str("condition")
+		if condition == "" {
+			condition = opts.str("condition.source")
+			if t := opts.str("condition.type"); t != "" && t != "vrl" {
+				c.res.unmapped(loc, "condition type %q is not converted, events pass unfiltered", t)
+				return ""
+			}
+		}
+		checks, err := vrlChecks(condition)
+		if err != nil {
+			c.res.unmapped(loc, "condition %q is not converted, events pass unfiltered: %v", condition, err)
+			return ""
+		}
+		for _, ch := range checks {
+			rule.check(ch)
+		}
+	default:
+		c.res.unmapped(loc, "transform type %q has no hub equivalent, events pass through unchanged", typ)
+		return ""
+	}
+	if rs.empty() {
+		return ""
+	}
+	content := rs.xml("<!-- Generated from a Vector config, review before use -->\n")
+	if err := rs.valid(content); err != nil {
+		c.res.unmapped(loc, "generated ruleset is invalid and was not written: %v", err)
+		return ""
+	}
+	return "RULESET." + c.res.add("RULESET", rs.name, content)
+}
+
+// vrlStatements splits a VRL program into top-level statements, dropping comments
+func vrlStatements(src string) []string {
+	var stmts []string
+	var sb strings.Builder
+	depth := 0
+	var quote rune
+	flush := func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		sb.Reset()
+	}
+	runes := []rune(src)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(runes) {
+				sb.WriteRune(c)
+				i++
+				c = runes[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case (c == '\n' || c == ';') && depth == 0:
+			flush()
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	flush()
+	return stmts
+}
+
+var (
+	vrlPathRe   = `\.(?:[A-Za-z0-9_@]+|"[^"]*")(?:\.(?:[A-Za-z0-9_@]+|"[^"]*"))*`
+	vrlFieldRe  = regexp.MustCompile(`^` + vrlPathRe + `$`)
+	vrlDelRe    = regexp.MustCompile(`^del\((` + vrlPathRe + `)\)$`)
+	vrlAssignRe = regexp.MustCompile(`^(\.|` + vrlPathRe + `)\s*=\s*(.+)$`)
+	vrlCallRe   = regexp.MustCompile(`^([a-z0-9_]+)!?\((.*)\)$`)
+)
+
+// vrlFunctions maps VRL functions to built-in plugins with the same arguments
+var vrlFunctions = map[string]string{
+	"parse_json":       "parseJSON",
+	"parse_user_agent": "parseUA",
+	"md5":              "hashMD5",
+	"sha1":             "hashSHA1",
+	"encode_base64":    "base64Encode",
+	"decode_base64":    "base64Decode",
+	"replace":          "replace",
+	"now":              "now",
+}
+
+// vrlStatement converts one remap statement: deleting a field or assigning a literal, a field,
+// or the result of a function with a plugin equivalent
+func vrlStatement(rule *ruleBuilder, stmt string) error {
+	if m := vrlDelRe.FindStringSubmatch(stmt); m != nil {
+		rule.del([]string{vrlPath(m[1])})
+		return nil
+	}
+	m := vrlAssignRe.FindStringSubmatch(stmt)
+	if m == nil {
+		return fmt.Errorf("only field assignments and del() are supported")
+	}
+	target, expr := vrlPath(m[1]), strings.TrimSpace(m[2])
+
+	if d := vrlDelRe.FindStringSubmatch(expr); d != nil && target != "" {
+		// .a = del(.b) renames the field
+		rule.appendValue(target, "_$"+vrlPath(d[1]))
+		rule.del([]string{vrlPath(d[1])})
+		return nil
+	}
+	if call := vrlCallRe.FindStringSubmatch(expr); call != nil {
+		plugin, ok := vrlFunctions[call[1]]
+		if !ok {
+			return fmt.Errorf("function %s has no plugin equivalent", call[1])
+		}
+		args, err := vrlArgs(call[2])
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			rule.modifyPlugin("", pluginCall(plugin, args...))
+		} else {
+			rule.appendPlugin(target, pluginCall(plugin, args...))
+		}
+		return nil
+	}
+	if target == "" {
+		return fmt.Errorf("the record can only be replaced by a function result")
+	}
+	if vrlFieldRe.MatchString(expr) {
+		rule.appendValue(target, "_$"+vrlPath(expr))
+		return nil
+	}
+	value, err := vrlLiteral(expr)
+	if err != nil {
+		return err
+	}
+	rule.appendValue(target, value)
+	return nil
+}
+
+// vrlArgs converts function arguments, which must be fields or literals
+func vrlArgs(src string) ([]string, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	parts := splitVRLArgs(src)
+	if parts == nil {
+		return nil, fmt.Errorf("expression is not a single function call")
+	}
+	var args []string
+	for _, a := range parts {
+		a = strings.TrimSpace(a)
+		if vrlFieldRe.MatchString(a) {
+			args = append(args, vrlPath(a))
+			continue
+		}
+		if strings.Contains(a, ":") && !strings.HasPrefix(a, "\"") {
+			return nil, fmt.Errorf("named argument %q is not supported", a)
+		}
+		lit, err := vrlLiteral(a)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(a, "\"") {
+			lit = pluginString(lit)
+		}
+		args = append(args, lit)
+	}
+	return args, nil
+}
+
+// splitVRLArgs splits the arguments of a call, nil when the parentheses do not balance
+func splitVRLArgs(src string) []string {
+	var args []string
+	var sb strings.Builder
+	depth := 0
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case inString && c == '\\' && i+1 < len(src):
+			sb.WriteByte(c)
+			i++
+			c = src[i]
+		case c == '"':
+			inString = !inString
+		case !inString && (c == '(' || c == '['):
+			depth++
+		case !inString && (c == ')' || c == ']'):
+			if depth--; depth < 0 {
+				return nil
+			}
+		case !inString && c == ',' && depth == 0:
+			args = append(args, sb.String())
+			sb.Reset()
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return append(args, sb.String())
+}
+
+// vrlLiteral converts a string, number or boolean literal
+func vrlLiteral(expr string) (string, error) {
+	if strings.HasPrefix(expr, "\"") {
+		s, err := strconv.Unquote(expr)
+		if err != nil {
+			return "", fmt.Errorf("unsupported string %s", expr)
+		}
+		return s, nil
+	}
+	if expr == "true" || expr == "false" {
+		return expr, nil
+	}
+	if _, err := strconv.ParseFloat(expr, 64); err == nil {
+		return expr, nil
+	}
+	return "", fmt.Errorf("expression %q is not supported", expr)
+}
+
+// vrlPath converts a VRL path like ."a-b".c into a-b.c, "." becomes empty for the whole record
+func vrlPath(p string) string {
+	p = strings.TrimSpace(p)
+	p = strings.TrimPrefix(p, ".")
+	return strings.ReplaceAll(p, "\"", "")
+}
+
+var vrlCompareRe = regexp.MustCompile(`^(` + vrlPathRe + `)\s*(==|!=|>|<)\s*(.+)$`)
+
+// vrlStringFunctions maps VRL string predicates to check types
+var vrlStringFunctions = map[string]string{
+	"contains":    "INCL",
+	"starts_with": "START",
+	"ends_with":   "END",
+	"match":       "REGEX",
+}
+
+var vrlPredicateRe = regexp.MustCompile(`^(!?)([a-z_]+)!?\(\s*(?:string!?\()?(` + vrlPathRe + `)\)?\s*(?:,\s*(.+))?\)$`)
+
+// vrlChecks converts a condition made of comparisons joined by && into checks
+func vrlChecks(condition string) ([]check, error) {
+	if strings.Contains(condition, "||") {
+		return nil, fmt.Errorf("\"||\" is not supported")
+	}
+	var checks []check
+	for _, part := range strings.Split(condition, "&&") {
+		part = strings.TrimSpace(part)
+		if m := vrlCompareRe.FindStringSubmatch(part); m != nil {
+			value, err := vrlLiteral(strings.TrimSpace(m[3]))
+			if err != nil {
+				return nil, err
+			}
+			checks = append(checks, check{typ: lsCompareTypes[m[2]], field: vrlPath(m[1]), value: value})
+			continue
+		}
+		m := vrlPredicateRe.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("%q is not supported", part)
+		}
+		negate, fn, field, arg := m[1] == "!", m[2], vrlPath(m[3]), strings.TrimSpace(m[4])
+		switch {
+		case fn == "exists" && arg == "":
+			typ := "NOTNULL"
+			if negate {
+				typ = "ISNULL"
+			}
+			checks = append(checks, check{typ: typ, field: field})
+		case vrlStringFunctions[fn] != "" && !negate && arg != "":
+			var value string
+			if fn == "match" && strings.HasPrefix(arg, "r'") && strings.HasSuffix(arg, "'") {
+				value = arg[2 : len(arg)-1]
+			} else {
+				v, err := vrlLiteral(arg)
+				if err != nil {
+					return nil, err
+				}
+				value = v
+			}
+			checks = append(checks, check{typ: vrlStringFunctions[fn], field: field, value: value})
+		default:
+			return nil, fmt.Errorf("%q is not supported", part)
+		}
+	}
+	return checks, nil
+}
@@ -0,0 +1,63 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"AgentSmith-HUB/common"
+)
+
+// Capture serializes msg exactly as the output would send it, without sending anything to the
+// sink. Kafka records, webhook requests, chat messages and Elasticsearch documents are rendered
+// by their producer, the other outputs capture the event as JSON after the field projection.
+func (out *Output) Capture(msg map[string]interface{}) (*common.CapturedPayload, error) {
+	// Captured events must not be indexed as fired alerts
+	out.testing = true
+	enhanced := out.enhanceMessageWithProjectNodeSequence(msg)
+	common.TakeDeliveryToken(enhanced).Release()
+
+	var (
+		c   *common.CapturedPayload
+		err error
+	)
+	switch out.Type {
+	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS:
+		if out.kafkaCfg == nil {
+			return nil, fmt.Errorf("kafka configuration missing for output %s", out.Id)
+		}
+		c, err = common.CaptureKafkaRecord(out.kafkaCfg.Topic, out.kafkaCfg.Key, out.kafkaCfg.producerOptions(out.ProjectNodeSequence), enhanced)
+	case OutputTypeElasticsearch:
+		if out.elasticsearchCfg == nil {
+			return nil, fmt.Errorf("elasticsearch configuration missing for output %s", out.Id)
+		}
+		c, err = captureJSON(common.ResolveIndexName(out.elasticsearchCfg.Index, enhanced), enhanced)
+	case OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk:
+		if out.chatCfg == nil {
+			return nil, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+		c, err = common.CaptureChatNotification(out.chatCfg.chatConfig(out.Type), enhanced)
+	case OutputTypeWebhook:
+		if out.webhookCfg == nil {
+			return nil, fmt.Errorf("webhook configuration missing for output %s", out.Id)
+		}
+		c, err = common.CaptureWebhookRequest(out.webhookCfg.webhookConfig(), enhanced)
+	default:
+		c, err = captureJSON(string(out.Type), enhanced)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render event for output %s: %w", out.Id, err)
+	}
+
+	c.OutputType = string(out.Type)
+	return c, nil
+}
+
+func captureJSON(target string, msg map[string]interface{}) (*common.CapturedPayload, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	c := common.NewCapturedPayload(target, body)
+	c.ContentType = "application/json"
+	return c, nil
+}
@@ -5,6 +5,8 @@ import (
 	"AgentSmith-HUB/logger"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -25,6 +27,29 @@ const (
 	OutputTypeElasticsearch OutputType = "elasticsearch"
 	OutputTypeAliyunSLS     OutputType = "aliyun_sls"
 	OutputTypePrint         OutputType = "print"
+	OutputTypeS3            OutputType = "s3"
+	OutputTypeGCS           OutputType = "gcs"
+	OutputTypeAzureBlob     OutputType = "azure_blob"
+	OutputTypeClickHouse    OutputType = "clickhouse"
+	OutputTypePagerDuty     OutputType = "pagerduty"
+	OutputTypeOpsgenie      OutputType = "opsgenie"
+	OutputTypeSlack         OutputType = "slack"
+	OutputTypeTeams         OutputType = "teams"
+	OutputTypeDingTalk      OutputType = "dingtalk"
+	OutputTypeWebhook       OutputType = "webhook"
+	OutputTypeSMTP          OutputType = "smtp"
+	OutputTypeJira          OutputType = "jira"
+	OutputTypeTheHive       OutputType = "thehive"
+	OutputTypeServiceNow    OutputType = "servicenow"
+	OutputTypeFederation    OutputType = "federation"
+	OutputTypeMetrics       OutputType = "metrics"
+	OutputTypePostgres      OutputType = "postgres"
+	OutputTypeMySQL         OutputType = "mysql"
+	OutputTypeSnowflake     OutputType = "snowflake"
+	OutputTypeBigQuery      OutputType = "bigquery"
+	OutputTypeSentinel      OutputType = "sentinel"
+	OutputTypeGraphSecurity OutputType = "graph_security"
+	OutputTypeRouter        OutputType = "router"
 )
 
 // OutputConfig is the YAML config for an output.
@@ -34,7 +59,40 @@ type OutputConfig struct {
 	Kafka         *KafkaOutputConfig         `yaml:"kafka,omitempty"`
 	Elasticsearch *ElasticsearchOutputConfig `yaml:"elasticsearch,omitempty"`
 	AliyunSLS     *AliyunSLSOutputConfig     `yaml:"aliyun_sls,omitempty"`
-	RawConfig     string
+	S3            *ObjectStorageOutputConfig `yaml:"s3,omitempty"`
+	GCS           *ObjectStorageOutputConfig `yaml:"gcs,omitempty"`
+	AzureBlob     *ObjectStorageOutputConfig `yaml:"azure_blob,omitempty"`
+	ClickHouse    *ClickHouseOutputConfig    `yaml:"clickhouse,omitempty"`
+	PagerDuty     *IncidentOutputConfig      `yaml:"pagerduty,omitempty"`
+	Opsgenie      *IncidentOutputConfig      `yaml:"opsgenie,omitempty"`
+	Slack         *ChatOutputConfig          `yaml:"slack,omitempty"`
+	Teams         *ChatOutputConfig          `yaml:"teams,omitempty"`
+	DingTalk      *ChatOutputConfig          `yaml:"dingtalk,omitempty"`
+	Webhook       *WebhookOutputConfig       `yaml:"webhook,omitempty"`
+	SMTP          *SMTPOutputConfig          `yaml:"smtp,omitempty"`
+	Jira          *TicketOutputConfig        `yaml:"jira,omitempty"`
+	TheHive       *TicketOutputConfig        `yaml:"thehive,omitempty"`
+	ServiceNow    *TicketOutputConfig        `yaml:"servicenow,omitempty"`
+	Federation    *FederationOutputConfig    `yaml:"federation,omitempty"`
+	Metrics       *MetricsOutputConfig       `yaml:"metrics,omitempty"`
+	Postgres      *SQLOutputConfig           `yaml:"postgres,omitempty"`
+	MySQL         *SQLOutputConfig           `yaml:"mysql,omitempty"`
+	Snowflake     *WarehouseOutputConfig     `yaml:"snowflake,omitempty"`
+	BigQuery      *WarehouseOutputConfig     `yaml:"bigquery,omitempty"`
+	Sentinel      *AzureSecurityOutputConfig `yaml:"sentinel,omitempty"`
+	GraphSecurity *AzureSecurityOutputConfig `yaml:"graph_security,omitempty"`
+	Router        *common.OutputRouterConfig `yaml:"router,omitempty"`
+	// Priority "high" sends every event of this output through the producer's priority lane
+	Priority string `yaml:"priority,omitempty"`
+	// CircuitBreaker tunes the breaker of elasticsearch and webhook outputs, which is on by default
+	CircuitBreaker *common.OutputBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// RateLimit caps the events per second sent to the destination
+	RateLimit *common.OutputRateLimitConfig `yaml:"rate_limit,omitempty"`
+	// Fields reshapes events for this destination before they are serialized
+	Fields *common.OutputFieldsConfig `yaml:"fields,omitempty"`
+	// HTTP sets the TLS and proxy of HTTP-based outputs over the output_http defaults of config.yaml
+	HTTP      *common.OutputHTTPConfig `yaml:"http,omitempty"`
+	RawConfig string
 }
 
 // KafkaOutputConfig holds Kafka-specific config.
@@ -46,6 +104,35 @@ type KafkaOutputConfig struct {
 	TLS         *common.KafkaTLSConfig      `yaml:"tls,omitempty"`
 	Key         string                      `yaml:"key"`
 	Idempotent  *bool                       `yaml:"idempotent,omitempty"`
+	KeyTemplate string                      `yaml:"key_template,omitempty"` // Go template over the event, overrides key
+	Headers     map[string]string           `yaml:"headers,omitempty"`      // record header -> event field
+	Transaction *KafkaTransactionConfig     `yaml:"transaction,omitempty"`
+	Encoding    *common.EncodingConfig      `yaml:"encoding,omitempty"` // value serialization, batches are compressed by compression
+}
+
+// KafkaTransactionConfig commits the produced events in transactions of up to batch_size events
+type KafkaTransactionConfig struct {
+	ID           string `yaml:"id"` // transactional id prefix, the node and project are appended
+	BatchSize    int    `yaml:"batch_size,omitempty"`
+	BatchTimeout string `yaml:"batch_timeout,omitempty"`
+}
+
+// producerOptions converts the output config for the kafka producer. Transactional ids are made
+// unique per node and project instance, since producers sharing an id fence each other.
+func (c *KafkaOutputConfig) producerOptions(projectNodeSequence string) common.KafkaProducerOptions {
+	opts := common.KafkaProducerOptions{
+		KeyTemplate: c.KeyTemplate,
+		Headers:     c.Headers,
+		Encoding:    c.Encoding,
+	}
+	if c.Transaction != nil {
+		opts.TransactionalID = fmt.Sprintf("%s-%s-%s", c.Transaction.ID, common.GetNodeID(), projectNodeSequence)
+		opts.BatchSize = c.Transaction.BatchSize
+		if d, err := time.ParseDuration(c.Transaction.BatchTimeout); err == nil {
+			opts.BatchTimeout = d
+		}
+	}
+	return opts
 }
 
 // ElasticsearchOutputConfig holds Elasticsearch-specific config.
@@ -55,6 +142,12 @@ type ElasticsearchOutputConfig struct {
 	BatchSize int                             `yaml:"batch_size,omitempty"`
 	FlushDur  string                          `yaml:"flush_dur,omitempty"`
 	Auth      *common.ElasticsearchAuthConfig `yaml:"auth,omitempty"`
+	// DataStream writes with create actions into a data stream named by index, which needs ES 7.9+ or OpenSearch
+	DataStream bool                                `yaml:"data_stream,omitempty"`
+	Template   *common.ElasticsearchTemplateConfig `yaml:"template,omitempty"`
+	ILM        *common.ElasticsearchILMConfig      `yaml:"ilm,omitempty"`
+	// Quarantine receives documents rejected for their content, e.g. mapping conflicts, instead of dropping them
+	Quarantine *common.ElasticsearchQuarantineConfig `yaml:"quarantine,omitempty"`
 }
 
 // AliyunSLSOutputConfig holds Aliyun SLS-specific config.
@@ -66,6 +159,730 @@ type AliyunSLSOutputConfig struct {
 	Logstore        string `yaml:"logstore"`
 }
 
+// ClickHouseOutputConfig holds ClickHouse-specific config.
+type ClickHouseOutputConfig struct {
+	Hosts              []string                  `yaml:"hosts"` // native protocol host:port, replicas are failed over in order
+	Database           string                    `yaml:"database,omitempty"`
+	Table              string                    `yaml:"table"`
+	Username           string                    `yaml:"username,omitempty"`
+	Password           string                    `yaml:"password,omitempty"`
+	Columns            []common.ClickHouseColumn `yaml:"columns,omitempty"`
+	AsyncInsert        *bool                     `yaml:"async_insert,omitempty"`          // default true
+	WaitForAsyncInsert *bool                     `yaml:"wait_for_async_insert,omitempty"` // default true
+	Settings           map[string]string         `yaml:"settings,omitempty"`
+	BatchSize          int                       `yaml:"batch_size,omitempty"`
+	FlushDur           string                    `yaml:"flush_dur,omitempty"`
+	MaxRetries         int                       `yaml:"max_retries,omitempty"`
+	TLS                *common.KafkaTLSConfig    `yaml:"tls,omitempty"`
+}
+
+// clickhouseConfig converts the output config for the ClickHouse producer
+func (c *ClickHouseOutputConfig) clickhouseConfig() common.ClickHouseConfig {
+	cfg := common.ClickHouseConfig{
+		Database:           c.Database,
+		Table:              c.Table,
+		Username:           c.Username,
+		Password:           c.Password,
+		Columns:            c.Columns,
+		TLS:                c.TLS,
+		AsyncInsert:        c.AsyncInsert == nil || *c.AsyncInsert,
+		WaitForAsyncInsert: c.WaitForAsyncInsert == nil || *c.WaitForAsyncInsert,
+		Settings:           c.Settings,
+		BatchSize:          c.BatchSize,
+		MaxRetries:         c.MaxRetries,
+	}
+	defaultPort := "9000"
+	if c.TLS != nil {
+		defaultPort = "9440"
+	}
+	for _, host := range c.Hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, defaultPort)
+		}
+		cfg.Hosts = append(cfg.Hosts, host)
+	}
+	if c.FlushDur != "" {
+		if d, err := time.ParseDuration(c.FlushDur); err == nil {
+			cfg.FlushDur = d
+		}
+	}
+	return cfg
+}
+
+// SQLOutputConfig holds the config of the postgres and mysql table outputs.
+type SQLOutputConfig struct {
+	Host       string                  `yaml:"host"`
+	Port       int                     `yaml:"port,omitempty"`
+	Database   string                  `yaml:"database"`
+	User       string                  `yaml:"user"`
+	Password   string                  `yaml:"password,omitempty"`
+	Table      string                  `yaml:"table"` // table or schema.table
+	Columns    []common.SQLColumn      `yaml:"columns"`
+	Upsert     *common.SQLUpsertConfig `yaml:"upsert,omitempty"`
+	BatchSize  int                     `yaml:"batch_size,omitempty"`
+	FlushDur   string                  `yaml:"flush_dur,omitempty"`
+	Timeout    string                  `yaml:"timeout,omitempty"`
+	MaxRetries int                     `yaml:"max_retries,omitempty"`
+}
+
+// sqlConfig converts the output config for the SQL producer
+func (c *SQLOutputConfig) sqlConfig(t OutputType) common.SQLConfig {
+	cfg := common.SQLConfig{
+		Driver:     string(t),
+		Host:       c.Host,
+		Port:       c.Port,
+		Database:   c.Database,
+		User:       c.User,
+		Password:   c.Password,
+		Table:      c.Table,
+		Columns:    c.Columns,
+		Upsert:     c.Upsert,
+		BatchSize:  c.BatchSize,
+		MaxRetries: c.MaxRetries,
+	}
+	if d, err := time.ParseDuration(c.FlushDur); err == nil {
+		cfg.FlushDur = d
+	}
+	if d, err := time.ParseDuration(c.Timeout); err == nil {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// WarehouseOutputConfig holds the config of the snowflake and bigquery table outputs.
+type WarehouseOutputConfig struct {
+	Table       string                   `yaml:"table"`             // snowflake: database.schema.table, bigquery: project.dataset.table or dataset.table
+	Columns     []common.WarehouseColumn `yaml:"columns,omitempty"` // default every event field
+	CreateTable bool                     `yaml:"create_table,omitempty"`
+	BatchSize   int                      `yaml:"batch_size,omitempty"`
+	FlushDur    string                   `yaml:"flush_dur,omitempty"`
+	Timeout     string                   `yaml:"timeout,omitempty"`
+	MaxRetries  int                      `yaml:"max_retries,omitempty"`
+
+	// snowflake, key pair authentication
+	Account        string `yaml:"account,omitempty"`
+	User           string `yaml:"user,omitempty"`
+	PrivateKey     string `yaml:"private_key,omitempty"`
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"`
+	Role           string `yaml:"role,omitempty"`
+	Warehouse      string `yaml:"warehouse,omitempty"`
+	Pipe           string `yaml:"pipe,omitempty"`
+	URL            string `yaml:"url,omitempty"`
+
+	// bigquery, service account authentication
+	CredentialsJSON string `yaml:"credentials_json,omitempty"`
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
+	PartitionField  string `yaml:"partition_field,omitempty"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+}
+
+// warehouseConfig converts the output config for the warehouse producer. Every node streams
+// through its own Snowflake channel, named after the output and the node.
+func (c *WarehouseOutputConfig) warehouseConfig(t OutputType, outputID string) (common.WarehouseConfig, error) {
+	cfg := common.WarehouseConfig{
+		Provider:    string(t),
+		Table:       c.Table,
+		Columns:     c.Columns,
+		CreateTable: c.CreateTable,
+		BatchSize:   c.BatchSize,
+		MaxRetries:  c.MaxRetries,
+		Snowflake: common.SnowflakeConfig{
+			Account:    c.Account,
+			User:       c.User,
+			PrivateKey: c.PrivateKey,
+			Role:       c.Role,
+			Warehouse:  c.Warehouse,
+			Pipe:       c.Pipe,
+			URL:        c.URL,
+		},
+		BigQuery: common.BigQueryConfig{
+			CredentialsJSON: c.CredentialsJSON,
+			PartitionField:  c.PartitionField,
+			Endpoint:        c.Endpoint,
+		},
+	}
+	for name, value := range map[string]string{"flush_dur": c.FlushDur, "timeout": c.Timeout} {
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q, expected a duration like 5s", name, value)
+		}
+		if name == "flush_dur" {
+			cfg.FlushDur = d
+		} else {
+			cfg.Timeout = d
+		}
+	}
+	if cfg.Snowflake.PrivateKey == "" && c.PrivateKeyFile != "" {
+		data, err := os.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read private_key_file: %w", err)
+		}
+		cfg.Snowflake.PrivateKey = string(data)
+	}
+	if cfg.BigQuery.CredentialsJSON == "" && c.CredentialsFile != "" {
+		data, err := os.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read credentials_file: %w", err)
+		}
+		cfg.BigQuery.CredentialsJSON = string(data)
+	}
+	node := "local"
+	if common.Config != nil && common.Config.LocalIP != "" {
+		node = common.Config.LocalIP
+	}
+	cfg.Snowflake.Channel = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, "hub_"+outputID+"_"+node)
+	return cfg, nil
+}
+
+// AzureSecurityOutputConfig holds the config of the sentinel and graph_security outputs.
+type AzureSecurityOutputConfig struct {
+	TenantID      string `yaml:"tenant_id"`
+	ClientID      string `yaml:"client_id"`
+	ClientSecret  string `yaml:"client_secret"`
+	AuthorityHost string `yaml:"authority_host,omitempty"` // default https://login.microsoftonline.com
+
+	// sentinel, Logs Ingestion API
+	Endpoint       string `yaml:"endpoint,omitempty"`         // data collection endpoint
+	DCRImmutableID string `yaml:"dcr_immutable_id,omitempty"` // immutable id of the data collection rule
+	Stream         string `yaml:"stream,omitempty"`           // stream of the rule, e.g. Custom-HubAlerts_CL
+	BatchSize      int    `yaml:"batch_size,omitempty"`
+	FlushInterval  string `yaml:"flush_interval,omitempty"`
+
+	// graph_security
+	URL             string            `yaml:"url,omitempty"` // default https://graph.microsoft.com/v1.0/security/alerts
+	SummaryField    string            `yaml:"summary_field,omitempty"`
+	SeverityField   string            `yaml:"severity_field,omitempty"`
+	SeverityMap     map[string]string `yaml:"severity_map,omitempty"`
+	DefaultSeverity string            `yaml:"default_severity,omitempty"`
+	Category        string            `yaml:"category,omitempty"`
+
+	MaxRetries int    `yaml:"max_retries,omitempty"`
+	Timeout    string `yaml:"timeout,omitempty"`
+}
+
+// azureSecurityConfig converts the output config for the Sentinel / Graph Security producer
+func (c *AzureSecurityOutputConfig) azureSecurityConfig(t OutputType) common.AzureSecurityConfig {
+	cfg := common.AzureSecurityConfig{
+		Provider:        string(t),
+		TenantID:        c.TenantID,
+		ClientID:        c.ClientID,
+		ClientSecret:    c.ClientSecret,
+		AuthorityHost:   c.AuthorityHost,
+		Endpoint:        c.Endpoint,
+		RuleID:          c.DCRImmutableID,
+		Stream:          c.Stream,
+		URL:             c.URL,
+		SummaryField:    c.SummaryField,
+		SeverityField:   c.SeverityField,
+		SeverityMap:     c.SeverityMap,
+		DefaultSeverity: c.DefaultSeverity,
+		Category:        c.Category,
+		BatchSize:       c.BatchSize,
+		MaxRetries:      c.MaxRetries,
+	}
+	if d, err := time.ParseDuration(c.FlushInterval); err == nil {
+		cfg.FlushInterval = d
+	}
+	if d, err := time.ParseDuration(c.Timeout); err == nil {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// IncidentOutputConfig holds the config of the pagerduty and opsgenie incident outputs.
+type IncidentOutputConfig struct {
+	RoutingKey      string            `yaml:"routing_key,omitempty"` // pagerduty Events API v2 integration key
+	APIKey          string            `yaml:"api_key,omitempty"`     // opsgenie API integration key
+	URL             string            `yaml:"url,omitempty"`         // API base URL, e.g. https://api.eu.opsgenie.com
+	DedupFields     []string          `yaml:"dedup_fields,omitempty"`
+	ActionField     string            `yaml:"action_field,omitempty"`
+	SummaryField    string            `yaml:"summary_field,omitempty"`
+	SourceField     string            `yaml:"source_field,omitempty"`
+	SeverityField   string            `yaml:"severity_field,omitempty"`
+	SeverityMap     map[string]string `yaml:"severity_map,omitempty"`
+	DefaultSeverity string            `yaml:"default_severity,omitempty"`
+	Tags            []string          `yaml:"tags,omitempty"`
+	MaxRetries      int               `yaml:"max_retries,omitempty"`
+	Timeout         string            `yaml:"timeout,omitempty"`
+}
+
+// incidentConfig converts the output config for the incident producer
+func (c *IncidentOutputConfig) incidentConfig(t OutputType) common.IncidentConfig {
+	cfg := common.IncidentConfig{
+		Provider:        string(t),
+		URL:             c.URL,
+		RoutingKey:      c.RoutingKey,
+		APIKey:          c.APIKey,
+		DedupFields:     c.DedupFields,
+		ActionField:     c.ActionField,
+		SummaryField:    c.SummaryField,
+		SourceField:     c.SourceField,
+		SeverityField:   c.SeverityField,
+		SeverityMap:     c.SeverityMap,
+		DefaultSeverity: c.DefaultSeverity,
+		Tags:            c.Tags,
+		MaxRetries:      c.MaxRetries,
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// ChatOutputConfig holds the config of the slack, teams and dingtalk notification outputs.
+type ChatOutputConfig struct {
+	WebhookURL string   `yaml:"webhook_url"`
+	Secret     string   `yaml:"secret,omitempty"` // dingtalk robot signing secret
+	Title      string   `yaml:"title,omitempty"`  // Go template over the event
+	Template   string   `yaml:"template,omitempty"`
+	Fields     []string `yaml:"fields,omitempty"`
+	Blocks     bool     `yaml:"blocks,omitempty"`     // slack only
+	AtMobiles  []string `yaml:"at_mobiles,omitempty"` // dingtalk only
+	AtAll      bool     `yaml:"at_all,omitempty"`     // dingtalk only
+	RateLimit  int      `yaml:"rate_limit,omitempty"` // messages per rate_window, default 30
+	RateWindow string   `yaml:"rate_window,omitempty"`
+	MaxRetries int      `yaml:"max_retries,omitempty"`
+	Timeout    string   `yaml:"timeout,omitempty"`
+}
+
+// chatConfig converts the output config for the chat notification producer
+func (c *ChatOutputConfig) chatConfig(t OutputType) common.ChatNotifyConfig {
+	cfg := common.ChatNotifyConfig{
+		Platform:      string(t),
+		WebhookURL:    c.WebhookURL,
+		Secret:        c.Secret,
+		TitleTemplate: c.Title,
+		TextTemplate:  c.Template,
+		Fields:        c.Fields,
+		Blocks:        c.Blocks,
+		AtMobiles:     c.AtMobiles,
+		AtAll:         c.AtAll,
+		RateLimit:     c.RateLimit,
+		MaxRetries:    c.MaxRetries,
+	}
+	if c.RateWindow != "" {
+		if d, err := time.ParseDuration(c.RateWindow); err == nil {
+			cfg.RateWindow = d
+		}
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// WebhookOutputConfig holds the config of the generic webhook output.
+type WebhookOutputConfig struct {
+	URL           string                       `yaml:"url"`
+	Method        string                       `yaml:"method,omitempty"` // default POST
+	Headers       map[string]string            `yaml:"headers,omitempty"`
+	Body          string                       `yaml:"body,omitempty"` // Go template over the event, default the event as JSON
+	ContentType   string                       `yaml:"content_type,omitempty"`
+	Signing       *common.WebhookSigningConfig `yaml:"signing,omitempty"`
+	RetryCount    int                          `yaml:"retry_count,omitempty"` // retries of 429, 5xx and network errors, default 3
+	RetryPolicies []WebhookRetryPolicyConfig   `yaml:"retry_policies,omitempty"`
+	Proxy         string                       `yaml:"proxy,omitempty"`
+	Timeout       string                       `yaml:"timeout,omitempty"`
+	Encoding      *common.EncodingConfig       `yaml:"encoding,omitempty"`
+}
+
+// WebhookRetryPolicyConfig overrides the retries of one status ("503"), status class ("4xx") or "network"
+type WebhookRetryPolicyConfig struct {
+	Status  string `yaml:"status"`
+	Retries int    `yaml:"retries"`
+	Backoff string `yaml:"backoff,omitempty"` // default 1s, doubled after every attempt
+}
+
+// webhookConfig converts the output config for the webhook producer
+func (c *WebhookOutputConfig) webhookConfig() common.WebhookConfig {
+	cfg := common.WebhookConfig{
+		URL:          c.URL,
+		Method:       c.Method,
+		Headers:      c.Headers,
+		BodyTemplate: c.Body,
+		ContentType:  c.ContentType,
+		Signing:      c.Signing,
+		RetryCount:   c.RetryCount,
+		Proxy:        c.Proxy,
+		Encoding:     c.Encoding,
+	}
+	if cfg.RetryCount == 0 {
+		cfg.RetryCount = 3
+	}
+	for _, policy := range c.RetryPolicies {
+		retry := common.WebhookRetryPolicy{Status: policy.Status, Retries: policy.Retries}
+		if policy.Backoff != "" {
+			if d, err := time.ParseDuration(policy.Backoff); err == nil {
+				retry.Backoff = d
+			}
+		}
+		cfg.RetryPolicies = append(cfg.RetryPolicies, retry)
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// MetricsOutputConfig holds the config of the output converting events into metrics.
+type MetricsOutputConfig struct {
+	Protocol      string                      `yaml:"protocol"` // remote_write or otlp
+	Endpoint      string                      `yaml:"endpoint"`
+	Headers       map[string]string           `yaml:"headers,omitempty"`
+	Username      string                      `yaml:"username,omitempty"`
+	Password      string                      `yaml:"password,omitempty"`
+	FlushInterval string                      `yaml:"flush_interval,omitempty"` // default 15s
+	Timeout       string                      `yaml:"timeout,omitempty"`        // default 10s
+	MaxSeries     int                         `yaml:"max_series,omitempty"`     // default 10000
+	StaticLabels  map[string]string           `yaml:"static_labels,omitempty"`
+	Metrics       []common.MetricSeriesConfig `yaml:"metrics"`
+}
+
+// metricsConfig converts the output config for the metrics producer
+func (c *MetricsOutputConfig) metricsConfig() common.MetricsExporterConfig {
+	cfg := common.MetricsExporterConfig{
+		Protocol:     c.Protocol,
+		Endpoint:     c.Endpoint,
+		Headers:      c.Headers,
+		Username:     c.Username,
+		Password:     c.Password,
+		MaxSeries:    c.MaxSeries,
+		StaticLabels: c.StaticLabels,
+		Series:       c.Metrics,
+	}
+	if d, err := time.ParseDuration(c.FlushInterval); err == nil {
+		cfg.FlushInterval = d
+	}
+	if d, err := time.ParseDuration(c.Timeout); err == nil {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// SMTPOutputConfig holds the config of the smtp email output.
+type SMTPOutputConfig struct {
+	Host               string            `yaml:"host"`
+	Port               int               `yaml:"port,omitempty"`
+	Username           string            `yaml:"username,omitempty"`
+	Password           string            `yaml:"password,omitempty"`
+	From               string            `yaml:"from"`
+	To                 []string          `yaml:"to"`
+	Cc                 []string          `yaml:"cc,omitempty"`
+	Security           string            `yaml:"security,omitempty"` // starttls (default), tls or none
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify,omitempty"`
+	Subject            string            `yaml:"subject,omitempty"` // Go template over the event
+	Body               string            `yaml:"body,omitempty"`    // Go template over the event
+	HTML               bool              `yaml:"html,omitempty"`
+	Digest             *SMTPDigestConfig `yaml:"digest,omitempty"`
+	MaxRetries         int               `yaml:"max_retries,omitempty"`
+	Timeout            string            `yaml:"timeout,omitempty"`
+}
+
+// SMTPDigestConfig batches the matches of a window into one summary email
+type SMTPDigestConfig struct {
+	Window    string `yaml:"window"`
+	MaxEvents int    `yaml:"max_events,omitempty"`
+	Subject   string `yaml:"subject,omitempty"` // Go template over the digest
+	Body      string `yaml:"body,omitempty"`    // Go template over the digest
+}
+
+// smtpConfig converts the output config for the smtp producer
+func (c *SMTPOutputConfig) smtpConfig() common.SMTPConfig {
+	cfg := common.SMTPConfig{
+		Host:               c.Host,
+		Port:               c.Port,
+		Username:           c.Username,
+		Password:           c.Password,
+		From:               c.From,
+		To:                 c.To,
+		Cc:                 c.Cc,
+		Security:           c.Security,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		Subject:            c.Subject,
+		Body:               c.Body,
+		HTML:               c.HTML,
+		MaxRetries:         c.MaxRetries,
+	}
+	if c.Digest != nil {
+		if d, err := time.ParseDuration(c.Digest.Window); err == nil {
+			cfg.DigestWindow = d
+		}
+		cfg.DigestMaxEvents = c.Digest.MaxEvents
+		cfg.DigestSubject = c.Digest.Subject
+		cfg.DigestBody = c.Digest.Body
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// TicketOutputConfig holds the config of the jira, thehive and servicenow case outputs.
+type TicketOutputConfig struct {
+	URL               string            `yaml:"url"`
+	Username          string            `yaml:"username,omitempty"` // jira account email or servicenow user
+	Password          string            `yaml:"password,omitempty"` // servicenow only
+	Token             string            `yaml:"token,omitempty"`    // jira API token or PAT, thehive API key
+	Project           string            `yaml:"project,omitempty"`  // jira only
+	IssueType         string            `yaml:"issue_type,omitempty"`
+	Table             string            `yaml:"table,omitempty"` // servicenow only
+	Title             string            `yaml:"title,omitempty"` // Go template over the event
+	Description       string            `yaml:"description,omitempty"`
+	Fields            map[string]string `yaml:"fields,omitempty"` // ticket field -> event field
+	Labels            []string          `yaml:"labels,omitempty"`
+	SeverityField     string            `yaml:"severity_field,omitempty"`
+	SeverityMap       map[string]string `yaml:"severity_map,omitempty"`
+	DedupFields       []string          `yaml:"dedup_fields,omitempty"`
+	DedupWindow       string            `yaml:"dedup_window,omitempty"`
+	CommentDuplicates bool              `yaml:"comment_duplicates,omitempty"`
+	AttachEvent       *bool             `yaml:"attach_event,omitempty"` // default true
+	MaxRetries        int               `yaml:"max_retries,omitempty"`
+	Timeout           string            `yaml:"timeout,omitempty"`
+}
+
+// ticketConfig converts the output config for the ticket producer
+func (c *TicketOutputConfig) ticketConfig(t OutputType) common.TicketConfig {
+	cfg := common.TicketConfig{
+		Provider:          string(t),
+		URL:               c.URL,
+		Username:          c.Username,
+		Password:          c.Password,
+		Token:             c.Token,
+		Project:           c.Project,
+		IssueType:         c.IssueType,
+		Table:             c.Table,
+		Title:             c.Title,
+		Description:       c.Description,
+		Fields:            c.Fields,
+		Labels:            c.Labels,
+		SeverityField:     c.SeverityField,
+		SeverityMap:       c.SeverityMap,
+		DedupFields:       c.DedupFields,
+		CommentDuplicates: c.CommentDuplicates,
+		AttachEvent:       c.AttachEvent == nil || *c.AttachEvent,
+		MaxRetries:        c.MaxRetries,
+	}
+	if c.DedupWindow != "" {
+		if d, err := time.ParseDuration(c.DedupWindow); err == nil {
+			cfg.DedupWindow = d
+		}
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// FederationOutputConfig holds the config of the federation output forwarding events to a central hub.
+type FederationOutputConfig struct {
+	URL           string                      `yaml:"url"`
+	HubID         string                      `yaml:"hub_id"`
+	TLS           *common.FederationTLSConfig `yaml:"tls"`
+	IncludeRaw    bool                        `yaml:"include_raw,omitempty"` // also forward events without a rule hit
+	BatchSize     int                         `yaml:"batch_size,omitempty"`
+	FlushInterval string                      `yaml:"flush_interval,omitempty"`
+	MaxRetries    int                         `yaml:"max_retries,omitempty"`
+	Timeout       string                      `yaml:"timeout,omitempty"`
+	Compression   string                      `yaml:"compression,omitempty"` // gzip (default), zstd, snappy or none
+}
+
+// federationConfig converts the output config for the federation producer
+func (c *FederationOutputConfig) federationConfig() common.FederationConfig {
+	cfg := common.FederationConfig{
+		URL:         c.URL,
+		HubID:       c.HubID,
+		TLS:         c.TLS,
+		IncludeRaw:  c.IncludeRaw,
+		BatchSize:   c.BatchSize,
+		MaxRetries:  c.MaxRetries,
+		Compression: c.Compression,
+	}
+	if c.FlushInterval != "" {
+		if d, err := time.ParseDuration(c.FlushInterval); err == nil {
+			cfg.FlushInterval = d
+		}
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err == nil {
+			cfg.Timeout = d
+		}
+	}
+	return cfg
+}
+
+// ObjectStorageOutputConfig holds the config of the s3, gcs and azure_blob archive outputs.
+type ObjectStorageOutputConfig struct {
+	Bucket      string                         `yaml:"bucket"` // container for azure_blob
+	Prefix      string                         `yaml:"prefix,omitempty"`
+	Partition   string                         `yaml:"partition,omitempty"`   // default {project}/dt={YYYY-MM-DD}/hour={HH}
+	Format      string                         `yaml:"format,omitempty"`      // ndjson (default) or parquet
+	Compression string                         `yaml:"compression,omitempty"` // gzip (default) or none
+	MaxSizeMB   int                            `yaml:"max_size_mb,omitempty"` // default 64
+	MaxAge      string                         `yaml:"max_age,omitempty"`     // default 5m
+	Columns     []common.ParquetColumn         `yaml:"columns,omitempty"`     // parquet only, default a single JSON event column
+	Encryption  *common.ObjectEncryptionConfig `yaml:"encryption,omitempty"`
+
+	// s3 and gcs (HMAC interoperability keys)
+	Region          string `yaml:"region,omitempty"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+	SessionToken    string `yaml:"session_token,omitempty"`
+	PathStyle       bool   `yaml:"path_style,omitempty"`
+
+	// azure_blob
+	AccountName string `yaml:"account_name,omitempty"`
+	AccountKey  string `yaml:"account_key,omitempty"`
+	SASToken    string `yaml:"sas_token,omitempty"`
+}
+
+// objectStoreConfig converts the output config for the object store producer
+func (c *ObjectStorageOutputConfig) objectStoreConfig(t OutputType, projectID, outputID string) (common.ObjectStoreConfig, error) {
+	cfg := common.ObjectStoreConfig{
+		Bucket:         c.Bucket,
+		Prefix:         c.Prefix,
+		Partition:      c.Partition,
+		Format:         c.Format,
+		Compress:       c.Compression != "none",
+		MaxSize:        int64(c.MaxSizeMB) << 20,
+		ProjectID:      projectID,
+		OutputID:       outputID,
+		Encryption:     c.Encryption,
+		ParquetColumns: c.Columns,
+		S3: common.S3Config{
+			Region:          c.Region,
+			Endpoint:        c.Endpoint,
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			PathStyle:       c.PathStyle,
+		},
+		Azure: common.AzureBlobConfig{
+			AccountName: c.AccountName,
+			AccountKey:  c.AccountKey,
+			SASToken:    c.SASToken,
+			Endpoint:    c.Endpoint,
+		},
+	}
+	switch t {
+	case OutputTypeS3:
+		cfg.Provider = common.ObjectStoreS3
+	case OutputTypeGCS:
+		cfg.Provider = common.ObjectStoreGCS
+	case OutputTypeAzureBlob:
+		cfg.Provider = common.ObjectStoreAzure
+	}
+	if c.MaxAge != "" {
+		d, err := time.ParseDuration(c.MaxAge)
+		if err != nil || d < time.Second {
+			return cfg, fmt.Errorf("invalid max_age %q, expected a duration of at least 1s", c.MaxAge)
+		}
+		cfg.MaxAge = d
+	}
+	return cfg, nil
+}
+
+// objectStorageSection returns the config section matching an object storage output type
+func (cfg *OutputConfig) objectStorageSection() *ObjectStorageOutputConfig {
+	switch cfg.Type {
+	case OutputTypeS3:
+		return cfg.S3
+	case OutputTypeGCS:
+		return cfg.GCS
+	case OutputTypeAzureBlob:
+		return cfg.AzureBlob
+	}
+	return nil
+}
+
+// sqlSection returns the config section matching a SQL table output type
+func (cfg *OutputConfig) sqlSection() *SQLOutputConfig {
+	switch cfg.Type {
+	case OutputTypePostgres:
+		return cfg.Postgres
+	case OutputTypeMySQL:
+		return cfg.MySQL
+	}
+	return nil
+}
+
+// warehouseSection returns the config section matching a warehouse output type
+func (cfg *OutputConfig) warehouseSection() *WarehouseOutputConfig {
+	switch cfg.Type {
+	case OutputTypeSnowflake:
+		return cfg.Snowflake
+	case OutputTypeBigQuery:
+		return cfg.BigQuery
+	}
+	return nil
+}
+
+// azureSecuritySection returns the config section matching a Microsoft security output type
+func (cfg *OutputConfig) azureSecuritySection() *AzureSecurityOutputConfig {
+	switch cfg.Type {
+	case OutputTypeSentinel:
+		return cfg.Sentinel
+	case OutputTypeGraphSecurity:
+		return cfg.GraphSecurity
+	}
+	return nil
+}
+
+// incidentSection returns the config section matching an incident output type
+func (cfg *OutputConfig) incidentSection() *IncidentOutputConfig {
+	switch cfg.Type {
+	case OutputTypePagerDuty:
+		return cfg.PagerDuty
+	case OutputTypeOpsgenie:
+		return cfg.Opsgenie
+	}
+	return nil
+}
+
+// ticketSection returns the config section matching a ticketing output type
+func (cfg *OutputConfig) ticketSection() *TicketOutputConfig {
+	switch cfg.Type {
+	case OutputTypeJira:
+		return cfg.Jira
+	case OutputTypeTheHive:
+		return cfg.TheHive
+	case OutputTypeServiceNow:
+		return cfg.ServiceNow
+	}
+	return nil
+}
+
+// chatSection returns the config section matching a chat notification output type
+func (cfg *OutputConfig) chatSection() *ChatOutputConfig {
+	switch cfg.Type {
+	case OutputTypeSlack:
+		return cfg.Slack
+	case OutputTypeTeams:
+		return cfg.Teams
+	case OutputTypeDingTalk:
+		return cfg.DingTalk
+	}
+	return nil
+}
+
 // Output is the runtime output instance.
 type Output struct {
 	Status              common.Status
@@ -77,20 +894,64 @@ type Output struct {
 	Type                OutputType
 	UpStream            map[string]*chan map[string]interface{}
 
+	// ProjectID is the project that created this PNS instance, instances shared by several projects keep the first one
+	ProjectID string
+
 	// runtime
 	kafkaProducer         *common.KafkaProducer
 	elasticsearchProducer *common.ElasticsearchProducer
+	objectStoreProducer   *common.ObjectStoreProducer
+	clickhouseProducer    *common.ClickHouseProducer
+	incidentProducer      *common.IncidentProducer
+	azureSecurityProducer *common.AzureSecurityProducer
+	chatProducer          *common.ChatNotifyProducer
+	webhookProducer       *common.WebhookProducer
+	smtpProducer          *common.SMTPProducer
+	ticketProducer        *common.TicketProducer
+	federationProducer    *common.FederationProducer
+	metricsProducer       *common.MetricsProducer
+	sqlProducer           *common.SQLProducer
+	warehouseProducer     *common.WarehouseProducer
+	router                *common.OutputRouter
+	routerChildren        map[string]*Output // child output instances by id, nil when the router is not running
+	routerChans           map[string]chan map[string]interface{}
+	routerUnmatched       uint64 // events no route matched
 	wg                    sync.WaitGroup
 
 	// config cache
 	kafkaCfg         *KafkaOutputConfig
 	elasticsearchCfg *ElasticsearchOutputConfig
 	aliyunSLSCfg     *AliyunSLSOutputConfig
+	objectStorageCfg *ObjectStorageOutputConfig
+	clickhouseCfg    *ClickHouseOutputConfig
+	incidentCfg      *IncidentOutputConfig
+	azureSecurityCfg *AzureSecurityOutputConfig
+	chatCfg          *ChatOutputConfig
+	webhookCfg       *WebhookOutputConfig
+	smtpCfg          *SMTPOutputConfig
+	ticketCfg        *TicketOutputConfig
+	federationCfg    *FederationOutputConfig
+	metricsCfg       *MetricsOutputConfig
+	sqlCfg           *SQLOutputConfig
+	warehouseCfg     *WarehouseOutputConfig
+	routerCfg        *common.OutputRouterConfig
 
 	// metrics - only total count is needed now
 	produceTotal      uint64 // cumulative production total
 	lastReportedTotal uint64 // For calculating increments in 10-second intervals
 
+	// delivery receipts for reconciliation, kept across restarts so no increment is lost
+	receipts *common.DeliveryReceipts
+
+	// circuit breaker of the running producer, recreated on every start
+	breaker *common.OutputBreaker
+
+	// rate limit between the output and its producer, nil without rate_limit
+	throttle *common.OutputThrottle
+
+	// include/exclude/rename/add applied to every event, nil without fields
+	projection *common.FieldProjection
+
 	// sampler
 	sampler *common.Sampler
 
@@ -99,6 +960,7 @@ type Output struct {
 
 	// for testing
 	TestCollectionChan *chan map[string]interface{}
+	testing            bool // started by StartForTesting, alerts are not indexed
 
 	// raw config
 	Config *OutputConfig
@@ -115,7 +977,7 @@ func Verify(path string, raw string) error {
 		return fmt.Errorf("failed to read output configuration: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := verifyConfig(data, &cfg); err != nil {
 		errString := err.Error()
 		if yamlErr, ok := err.(*yaml.TypeError); ok && len(yamlErr.Errors) > 0 {
 			errMsg := yamlErr.Errors[0]
@@ -146,6 +1008,41 @@ func Verify(path string, raw string) error {
 	if cfg.Type == "" {
 		return fmt.Errorf("missing required field 'type' (line: unknown)")
 	}
+	if cfg.Priority != "" {
+		if cfg.Priority != common.PriorityHigh && cfg.Priority != common.PriorityNormal {
+			return fmt.Errorf("invalid priority '%s', must be '%s' or '%s' (line: unknown)", cfg.Priority, common.PriorityHigh, common.PriorityNormal)
+		}
+		if !hasPriorityLane(cfg.Type) {
+			return fmt.Errorf("priority is only supported for kafka and elasticsearch outputs (line: unknown)")
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		if !hasCircuitBreaker(cfg.Type) {
+			return fmt.Errorf("circuit_breaker is only supported for elasticsearch and webhook outputs (line: unknown)")
+		}
+		if err := cfg.CircuitBreaker.Validate(); err != nil {
+			return fmt.Errorf("invalid circuit_breaker: %v (line: unknown)", err)
+		}
+	}
+	if cfg.HTTP != nil {
+		if !hasHTTPClient(cfg.Type) {
+			return fmt.Errorf("http is not supported for %s outputs (line: unknown)", cfg.Type)
+		}
+		if err := cfg.HTTP.Validate(); err != nil {
+			return fmt.Errorf("invalid http: %v (line: unknown)", err)
+		}
+	}
+	if cfg.RateLimit != nil {
+		if cfg.Type == OutputTypePrint {
+			return fmt.Errorf("rate_limit is not supported for print outputs (line: unknown)")
+		}
+		if err := cfg.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("invalid rate_limit: %v (line: unknown)", err)
+		}
+	}
+	if _, err := common.NewFieldProjection(cfg.Fields); err != nil {
+		return fmt.Errorf("invalid fields: %v (line: unknown)", err)
+	}
 
 	// Validate type-specific fields
 	switch cfg.Type {
@@ -159,6 +1056,37 @@ func Verify(path string, raw string) error {
 		if cfg.Kafka.Topic == "" {
 			return fmt.Errorf("missing required field 'kafka.topic' for kafka output (line: unknown)")
 		}
+		if cfg.Kafka.KeyTemplate != "" {
+			if _, err := common.ParseEventTemplate("key_template", cfg.Kafka.KeyTemplate); err != nil {
+				return fmt.Errorf("invalid 'kafka.key_template': %v (line: unknown)", err)
+			}
+		}
+		for name, field := range cfg.Kafka.Headers {
+			if strings.TrimSpace(name) == "" || strings.TrimSpace(field) == "" {
+				return fmt.Errorf("'kafka.headers' must map non-empty header names to non-empty event fields (line: unknown)")
+			}
+		}
+		if enc := cfg.Kafka.Encoding; enc != nil {
+			if err := enc.Validate(); err != nil {
+				return fmt.Errorf("invalid 'kafka.encoding': %v (line: unknown)", err)
+			}
+			if enc.Compression != "" && enc.Compression != common.PayloadCompressionNone {
+				return fmt.Errorf("'kafka.encoding.compression' is not supported, record batches are compressed by 'kafka.compression' (line: unknown)")
+			}
+		}
+		if t := cfg.Kafka.Transaction; t != nil {
+			if t.ID == "" {
+				return fmt.Errorf("missing required field 'kafka.transaction.id' for kafka output (line: unknown)")
+			}
+			if cfg.Kafka.Idempotent != nil && !*cfg.Kafka.Idempotent {
+				return fmt.Errorf("'kafka.transaction' requires 'kafka.idempotent' to be enabled (line: unknown)")
+			}
+			if t.BatchTimeout != "" {
+				if d, err := time.ParseDuration(t.BatchTimeout); err != nil || d <= 0 {
+					return fmt.Errorf("invalid 'kafka.transaction.batch_timeout' %q (line: unknown)", t.BatchTimeout)
+				}
+			}
+		}
 	case OutputTypeElasticsearch:
 		if cfg.Elasticsearch == nil {
 			return fmt.Errorf("missing required field 'elasticsearch' for elasticsearch output (line: unknown)")
@@ -169,73 +1097,590 @@ func Verify(path string, raw string) error {
 		if cfg.Elasticsearch.Index == "" {
 			return fmt.Errorf("missing required field 'elasticsearch.index' for elasticsearch output (line: unknown)")
 		}
+		if cfg.Elasticsearch.DataStream && common.IndexPattern(cfg.Elasticsearch.Index) != cfg.Elasticsearch.Index {
+			// Data streams roll over on their own, a dated name would create a new stream every day
+			logger.Warn("Elasticsearch data stream name contains placeholders, one data stream is created per resolved name", "index", cfg.Elasticsearch.Index)
+		}
+		if tmpl := cfg.Elasticsearch.Template; tmpl != nil && tmpl.Mappings != "" {
+			var mappings map[string]interface{}
+			if err := json.Unmarshal([]byte(tmpl.Mappings), &mappings); err != nil {
+				return fmt.Errorf("invalid 'elasticsearch.template.mappings' for elasticsearch output, must be a JSON object: %v (line: unknown)", err)
+			}
+		}
+		if ilm := cfg.Elasticsearch.ILM; ilm != nil {
+			if ilm.Policy == "" {
+				return fmt.Errorf("missing required field 'elasticsearch.ilm.policy' for elasticsearch output (line: unknown)")
+			}
+			if ilm.RolloverMaxAge == "" && ilm.RolloverMaxSize == "" && ilm.DeleteAfter == "" {
+				return fmt.Errorf("elasticsearch.ilm needs at least one of rollover_max_age, rollover_max_size or delete_after (line: unknown)")
+			}
+		}
+		if q := cfg.Elasticsearch.Quarantine; q != nil {
+			if q.Index == "" && q.RedisList == "" {
+				return fmt.Errorf("elasticsearch.quarantine needs an index and/or a redis_list (line: unknown)")
+			}
+			if q.Index == cfg.Elasticsearch.Index {
+				return fmt.Errorf("elasticsearch.quarantine.index must differ from elasticsearch.index (line: unknown)")
+			}
+		}
 	case OutputTypeAliyunSLS:
 		if cfg.AliyunSLS == nil {
 			return fmt.Errorf("missing required field 'aliyun_sls' for aliyunSLS output (line: unknown)")
 		}
 		// Add more AliyunSLS specific field validation
-	case OutputTypePrint:
-		// Print output doesn't require external connectivity
-	default:
-		return fmt.Errorf("unsupported output type: %s (line: unknown)", cfg.Type)
-	}
-
-	return nil
-}
-
-// NewOutput creates an Output from config and upstreams.
-func NewOutput(path string, raw string, id string) (*Output, error) {
-	var cfg OutputConfig
-
-	err := Verify(path, raw)
-	if err != nil {
-		return nil, fmt.Errorf("output verify error: %s %s", id, err.Error())
-	}
-
-	if path != "" {
-		data, _ := os.ReadFile(path)
-		_ = yaml.Unmarshal(data, &cfg)
-		cfg.RawConfig = string(data)
-	} else {
-		_ = yaml.Unmarshal([]byte(raw), &cfg)
-		cfg.RawConfig = raw
-	}
-
-	out := &Output{
-		Id:               id,
-		Path:             path,
-		Type:             cfg.Type,
-		UpStream:         make(map[string]*chan map[string]interface{}, 0),
-		kafkaCfg:         cfg.Kafka,
-		elasticsearchCfg: cfg.Elasticsearch,
-		aliyunSLSCfg:     cfg.AliyunSLS,
-		Config:           &cfg,
-		sampler:          nil, // Will be set below based on cluster role
-		Status:           common.StatusStopped,
-	}
-
-	// Only create sampler on leader node for performance
-	if common.IsLeader {
-		out.sampler = common.GetSampler("output." + id)
-	}
-	return out, nil
-}
-
-// SetStatus sets the output status and error information
-func (out *Output) SetStatus(status common.Status, err error) {
-	if err != nil {
-		out.Err = err
-		logger.Error("Output status changed with error", "output", out.Id, "status", status, "error", err)
-	}
-	out.Status = status
-	t := time.Now()
-	out.StatusChangedAt = &t
-}
-
-// cleanup performs cleanup when normal stop fails or panic occurs
-func (out *Output) cleanup() {
-	// Note: stopChan is already closed in Stop() method, so we don't close it here
-
+	case OutputTypeS3, OutputTypeGCS, OutputTypeAzureBlob:
+		section := cfg.objectStorageSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		if section.Bucket == "" {
+			return fmt.Errorf("missing required field '%s.bucket' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		switch section.Format {
+		case "", common.ObjectFormatNDJSON:
+		case common.ObjectFormatParquet:
+			if err := common.ValidateParquetColumns(section.Columns); err != nil {
+				return fmt.Errorf("invalid '%s.columns': %v (line: unknown)", cfg.Type, err)
+			}
+		default:
+			return fmt.Errorf("unsupported '%s.format' %q, expected ndjson or parquet (line: unknown)", cfg.Type, section.Format)
+		}
+		if section.Compression != "" && section.Compression != "gzip" && section.Compression != "none" {
+			return fmt.Errorf("unsupported '%s.compression' %q, expected gzip or none (line: unknown)", cfg.Type, section.Compression)
+		}
+		if section.MaxSizeMB < 0 {
+			return fmt.Errorf("'%s.max_size_mb' must not be negative (line: unknown)", cfg.Type)
+		}
+		if _, err := section.objectStoreConfig(cfg.Type, "", ""); err != nil {
+			return fmt.Errorf("invalid '%s' config: %v (line: unknown)", cfg.Type, err)
+		}
+		if cfg.Type == OutputTypeAzureBlob && section.AccountName == "" {
+			return fmt.Errorf("missing required field 'azure_blob.account_name' for azure_blob output (line: unknown)")
+		}
+	case OutputTypeClickHouse:
+		if cfg.ClickHouse == nil {
+			return fmt.Errorf("missing required field 'clickhouse' for clickhouse output (line: unknown)")
+		}
+		if len(cfg.ClickHouse.Hosts) == 0 {
+			return fmt.Errorf("missing required field 'clickhouse.hosts' for clickhouse output (line: unknown)")
+		}
+		if cfg.ClickHouse.Table == "" {
+			return fmt.Errorf("missing required field 'clickhouse.table' for clickhouse output (line: unknown)")
+		}
+		for _, col := range cfg.ClickHouse.Columns {
+			if col.Name == "" || col.Field == "" {
+				return fmt.Errorf("each 'clickhouse.columns' entry needs both name and field (line: unknown)")
+			}
+		}
+		if cfg.ClickHouse.FlushDur != "" {
+			if _, err := time.ParseDuration(cfg.ClickHouse.FlushDur); err != nil {
+				return fmt.Errorf("invalid 'clickhouse.flush_dur' %q: %v (line: unknown)", cfg.ClickHouse.FlushDur, err)
+			}
+		}
+	case OutputTypePagerDuty, OutputTypeOpsgenie:
+		section := cfg.incidentSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		if cfg.Type == OutputTypePagerDuty && section.RoutingKey == "" {
+			return fmt.Errorf("missing required field 'pagerduty.routing_key' for pagerduty output (line: unknown)")
+		}
+		if cfg.Type == OutputTypeOpsgenie && section.APIKey == "" {
+			return fmt.Errorf("missing required field 'opsgenie.api_key' for opsgenie output (line: unknown)")
+		}
+		for _, field := range section.DedupFields {
+			if strings.TrimSpace(field) == "" {
+				return fmt.Errorf("'%s.dedup_fields' must not contain empty fields (line: unknown)", cfg.Type)
+			}
+		}
+		if section.Timeout != "" {
+			if _, err := time.ParseDuration(section.Timeout); err != nil {
+				return fmt.Errorf("invalid '%s.timeout' %q: %v (line: unknown)", cfg.Type, section.Timeout, err)
+			}
+		}
+	case OutputTypeSentinel, OutputTypeGraphSecurity:
+		section := cfg.azureSecuritySection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		for name, value := range map[string]string{"flush_interval": section.FlushInterval, "timeout": section.Timeout} {
+			if value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Errorf("invalid '%s.%s' %q, expected a duration like 5s (line: unknown)", cfg.Type, name, value)
+			}
+		}
+		azCfg := section.azureSecurityConfig(cfg.Type)
+		if err := azCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid '%s' config: %v (line: unknown)", cfg.Type, err)
+		}
+	case OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk:
+		section := cfg.chatSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		if section.WebhookURL == "" {
+			return fmt.Errorf("missing required field '%s.webhook_url' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		if _, err := common.ParseEventTemplate("title", section.Title); err != nil {
+			return fmt.Errorf("invalid '%s.title' template: %v (line: unknown)", cfg.Type, err)
+		}
+		if _, err := common.ParseEventTemplate("template", section.Template); err != nil {
+			return fmt.Errorf("invalid '%s.template' template: %v (line: unknown)", cfg.Type, err)
+		}
+		if section.RateLimit < 0 {
+			return fmt.Errorf("'%s.rate_limit' must not be negative (line: unknown)", cfg.Type)
+		}
+		for name, value := range map[string]string{"rate_window": section.RateWindow, "timeout": section.Timeout} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid '%s.%s' %q: %v (line: unknown)", cfg.Type, name, value, err)
+			}
+		}
+	case OutputTypeWebhook:
+		if cfg.Webhook == nil {
+			return fmt.Errorf("missing required field 'webhook' for webhook output (line: unknown)")
+		}
+		if cfg.Webhook.URL == "" {
+			return fmt.Errorf("missing required field 'webhook.url' for webhook output (line: unknown)")
+		}
+		if u, err := url.Parse(cfg.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid 'webhook.url' %q, expected an http or https URL (line: unknown)", cfg.Webhook.URL)
+		}
+		if cfg.Webhook.Body != "" {
+			if _, err := common.ParseEventTemplate("body", cfg.Webhook.Body); err != nil {
+				return fmt.Errorf("invalid 'webhook.body' template: %v (line: unknown)", err)
+			}
+		}
+		if enc := cfg.Webhook.Encoding; enc != nil {
+			if err := enc.Validate(); err != nil {
+				return fmt.Errorf("invalid 'webhook.encoding': %v (line: unknown)", err)
+			}
+			if cfg.Webhook.Body != "" && enc.Serialization != "" && enc.Serialization != common.SerializationJSON {
+				return fmt.Errorf("'webhook.body' cannot be combined with serialization %s (line: unknown)", enc.Serialization)
+			}
+		}
+		if cfg.Webhook.Signing != nil && cfg.Webhook.Signing.Secret == "" {
+			return fmt.Errorf("missing required field 'webhook.signing.secret' for webhook output (line: unknown)")
+		}
+		if cfg.Webhook.RetryCount < 0 {
+			return fmt.Errorf("'webhook.retry_count' must not be negative (line: unknown)")
+		}
+		for _, policy := range cfg.Webhook.RetryPolicies {
+			if err := common.ParseWebhookRetryStatus(policy.Status); err != nil {
+				return fmt.Errorf("invalid 'webhook.retry_policies': %v (line: unknown)", err)
+			}
+			if policy.Retries < 0 {
+				return fmt.Errorf("'webhook.retry_policies' retries must not be negative for status %s (line: unknown)", policy.Status)
+			}
+			if policy.Backoff != "" {
+				if _, err := time.ParseDuration(policy.Backoff); err != nil {
+					return fmt.Errorf("invalid 'webhook.retry_policies' backoff %q: %v (line: unknown)", policy.Backoff, err)
+				}
+			}
+		}
+		if cfg.Webhook.Proxy != "" {
+			if u, err := url.Parse(cfg.Webhook.Proxy); err != nil || u.Host == "" {
+				return fmt.Errorf("invalid 'webhook.proxy' %q (line: unknown)", cfg.Webhook.Proxy)
+			}
+		}
+		if cfg.Webhook.Timeout != "" {
+			if _, err := time.ParseDuration(cfg.Webhook.Timeout); err != nil {
+				return fmt.Errorf("invalid 'webhook.timeout' %q: %v (line: unknown)", cfg.Webhook.Timeout, err)
+			}
+		}
+	case OutputTypeSMTP:
+		if cfg.SMTP == nil {
+			return fmt.Errorf("missing required field 'smtp' for smtp output (line: unknown)")
+		}
+		if cfg.SMTP.Host == "" {
+			return fmt.Errorf("missing required field 'smtp.host' for smtp output (line: unknown)")
+		}
+		if cfg.SMTP.From == "" {
+			return fmt.Errorf("missing required field 'smtp.from' for smtp output (line: unknown)")
+		}
+		if len(cfg.SMTP.To) == 0 {
+			return fmt.Errorf("missing required field 'smtp.to' for smtp output (line: unknown)")
+		}
+		switch strings.ToLower(cfg.SMTP.Security) {
+		case "", common.SMTPSecurityStartTLS, common.SMTPSecurityTLS, common.SMTPSecurityNone:
+		default:
+			return fmt.Errorf("invalid 'smtp.security' %q, expected starttls, tls or none (line: unknown)", cfg.SMTP.Security)
+		}
+		if cfg.SMTP.Username != "" && strings.ToLower(cfg.SMTP.Security) == common.SMTPSecurityNone {
+			return fmt.Errorf("'smtp.username' requires 'smtp.security' starttls or tls (line: unknown)")
+		}
+		templates := map[string]string{"subject": cfg.SMTP.Subject, "body": cfg.SMTP.Body}
+		if cfg.SMTP.Digest != nil {
+			window, err := time.ParseDuration(cfg.SMTP.Digest.Window)
+			if err != nil || window <= 0 {
+				return fmt.Errorf("invalid 'smtp.digest.window' %q, expected a duration like 10m (line: unknown)", cfg.SMTP.Digest.Window)
+			}
+			templates["digest.subject"] = cfg.SMTP.Digest.Subject
+			templates["digest.body"] = cfg.SMTP.Digest.Body
+		}
+		for name, text := range templates {
+			if _, err := common.ParseEventTemplate(name, text); err != nil {
+				return fmt.Errorf("invalid 'smtp.%s' template: %v (line: unknown)", name, err)
+			}
+		}
+		if cfg.SMTP.Timeout != "" {
+			if _, err := time.ParseDuration(cfg.SMTP.Timeout); err != nil {
+				return fmt.Errorf("invalid 'smtp.timeout' %q: %v (line: unknown)", cfg.SMTP.Timeout, err)
+			}
+		}
+	case OutputTypeJira, OutputTypeTheHive, OutputTypeServiceNow:
+		section := cfg.ticketSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		if section.URL == "" {
+			return fmt.Errorf("missing required field '%s.url' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		switch cfg.Type {
+		case OutputTypeJira:
+			if section.Project == "" {
+				return fmt.Errorf("missing required field 'jira.project' for jira output (line: unknown)")
+			}
+			if section.Token == "" {
+				return fmt.Errorf("missing required field 'jira.token' for jira output (line: unknown)")
+			}
+		case OutputTypeTheHive:
+			if section.Token == "" {
+				return fmt.Errorf("missing required field 'thehive.token' for thehive output (line: unknown)")
+			}
+		case OutputTypeServiceNow:
+			if section.Username == "" || section.Password == "" {
+				return fmt.Errorf("missing required fields 'servicenow.username' and 'servicenow.password' for servicenow output (line: unknown)")
+			}
+		}
+		for name, text := range map[string]string{"title": section.Title, "description": section.Description} {
+			if _, err := common.ParseEventTemplate(name, text); err != nil {
+				return fmt.Errorf("invalid '%s.%s' template: %v (line: unknown)", cfg.Type, name, err)
+			}
+		}
+		for target, source := range section.Fields {
+			if strings.TrimSpace(target) == "" || strings.TrimSpace(source) == "" {
+				return fmt.Errorf("'%s.fields' must map non-empty ticket fields to non-empty event fields (line: unknown)", cfg.Type)
+			}
+		}
+		for _, field := range section.DedupFields {
+			if strings.TrimSpace(field) == "" {
+				return fmt.Errorf("'%s.dedup_fields' must not contain empty fields (line: unknown)", cfg.Type)
+			}
+		}
+		for name, value := range map[string]string{"dedup_window": section.DedupWindow, "timeout": section.Timeout} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid '%s.%s' %q: %v (line: unknown)", cfg.Type, name, value, err)
+			}
+		}
+	case OutputTypeFederation:
+		if cfg.Federation == nil {
+			return fmt.Errorf("missing required field 'federation' for federation output (line: unknown)")
+		}
+		if !strings.HasPrefix(cfg.Federation.URL, "https://") {
+			return fmt.Errorf("'federation.url' must be an https URL for federation output (line: unknown)")
+		}
+		if strings.TrimSpace(cfg.Federation.HubID) == "" {
+			return fmt.Errorf("missing required field 'federation.hub_id' for federation output (line: unknown)")
+		}
+		if tlsCfg := cfg.Federation.TLS; tlsCfg == nil || tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" || tlsCfg.CAFile == "" {
+			return fmt.Errorf("federation output requires 'federation.tls' with cert_file, key_file and ca_file (line: unknown)")
+		}
+		switch cfg.Federation.Compression {
+		case "", common.PayloadCompressionGzip, common.PayloadCompressionZstd, common.PayloadCompressionSnappy, common.PayloadCompressionNone:
+		default:
+			return fmt.Errorf("unsupported 'federation.compression' %q, expected gzip, zstd, snappy or none (line: unknown)", cfg.Federation.Compression)
+		}
+		if cfg.Federation.BatchSize < 0 || cfg.Federation.MaxRetries < 0 {
+			return fmt.Errorf("'federation.batch_size' and 'federation.max_retries' must not be negative (line: unknown)")
+		}
+		for name, value := range map[string]string{"flush_interval": cfg.Federation.FlushInterval, "timeout": cfg.Federation.Timeout} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid 'federation.%s' %q: %v (line: unknown)", name, value, err)
+			}
+		}
+	case OutputTypeMetrics:
+		if cfg.Metrics == nil {
+			return fmt.Errorf("missing required field 'metrics' for metrics output (line: unknown)")
+		}
+		if cfg.Metrics.Protocol != common.MetricsProtocolRemoteWrite && cfg.Metrics.Protocol != common.MetricsProtocolOTLP {
+			return fmt.Errorf("invalid 'metrics.protocol' %q, must be '%s' or '%s' (line: unknown)", cfg.Metrics.Protocol, common.MetricsProtocolRemoteWrite, common.MetricsProtocolOTLP)
+		}
+		if u, err := url.Parse(cfg.Metrics.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid 'metrics.endpoint' %q, expected an http or https URL (line: unknown)", cfg.Metrics.Endpoint)
+		}
+		if len(cfg.Metrics.Metrics) == 0 {
+			return fmt.Errorf("missing required field 'metrics.metrics' for metrics output (line: unknown)")
+		}
+		for i := range cfg.Metrics.Metrics {
+			if err := cfg.Metrics.Metrics[i].Validate(); err != nil {
+				return fmt.Errorf("invalid 'metrics.metrics': %v (line: unknown)", err)
+			}
+		}
+		if cfg.Metrics.MaxSeries < 0 {
+			return fmt.Errorf("'metrics.max_series' must not be negative (line: unknown)")
+		}
+		for name, value := range map[string]string{"flush_interval": cfg.Metrics.FlushInterval, "timeout": cfg.Metrics.Timeout} {
+			if value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Errorf("invalid 'metrics.%s' %q, expected a duration like 15s (line: unknown)", name, value)
+			}
+		}
+	case OutputTypePostgres, OutputTypeMySQL:
+		section := cfg.sqlSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		sqlCfg := section.sqlConfig(cfg.Type)
+		if err := sqlCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid '%s' config: %v (line: unknown)", cfg.Type, err)
+		}
+		for name, value := range map[string]string{"flush_dur": section.FlushDur, "timeout": section.Timeout} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid '%s.%s' %q: %v (line: unknown)", cfg.Type, name, value, err)
+			}
+		}
+	case OutputTypeSnowflake, OutputTypeBigQuery:
+		section := cfg.warehouseSection()
+		if section == nil {
+			return fmt.Errorf("missing required field '%s' for %s output (line: unknown)", cfg.Type, cfg.Type)
+		}
+		whCfg, err := section.warehouseConfig(cfg.Type, cfg.Id)
+		if err != nil {
+			return fmt.Errorf("invalid '%s' config: %v (line: unknown)", cfg.Type, err)
+		}
+		if err := whCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid '%s' config: %v (line: unknown)", cfg.Type, err)
+		}
+	case OutputTypeRouter:
+		if cfg.Router == nil {
+			return fmt.Errorf("missing required field 'router' for router output (line: unknown)")
+		}
+		if _, err := common.NewOutputRouter(cfg.Router); err != nil {
+			return fmt.Errorf("invalid 'router' config: %v (line: unknown)", err)
+		}
+		// Children apply their own settings to the events they receive
+		if cfg.RateLimit != nil || cfg.Fields != nil || cfg.Priority != "" {
+			return fmt.Errorf("rate_limit, fields and priority are not supported on router output, set them on the child outputs (line: unknown)")
+		}
+	case OutputTypePrint:
+		// Print output doesn't require external connectivity
+	default:
+		return fmt.Errorf("unsupported output type: %s (line: unknown)", cfg.Type)
+	}
+
+	return nil
+}
+
+// hasPriorityLane reports whether the producer of an output type batches events and has a priority lane
+func hasPriorityLane(t OutputType) bool {
+	switch t {
+	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS, OutputTypeElasticsearch:
+		return true
+	}
+	return false
+}
+
+// hasCircuitBreaker reports whether the producer of an output type retries failed requests behind a circuit breaker
+func hasCircuitBreaker(t OutputType) bool {
+	switch t {
+	case OutputTypeElasticsearch, OutputTypeWebhook:
+		return true
+	}
+	return false
+}
+
+// hasHTTPClient reports whether the producer of an output type talks HTTP through a client honoring the http block
+func hasHTTPClient(t OutputType) bool {
+	switch t {
+	case OutputTypeElasticsearch, OutputTypeWebhook, OutputTypePagerDuty, OutputTypeOpsgenie,
+		OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk, OutputTypeJira, OutputTypeTheHive,
+		OutputTypeServiceNow, OutputTypeMetrics, OutputTypeSentinel, OutputTypeGraphSecurity:
+		return true
+	}
+	return false
+}
+
+// httpConfig returns the TLS and proxy settings of the output over the defaults of config.yaml
+func (out *Output) httpConfig() *common.OutputHTTPConfig {
+	var global, local *common.OutputHTTPConfig
+	if common.Config != nil {
+		global = common.Config.OutputHTTP
+	}
+	if out.Config != nil {
+		local = out.Config.HTTP
+	}
+	return common.MergeOutputHTTPConfig(global, local)
+}
+
+// ConfirmsDelivery reports whether the producer of an output type releases the checkpoint token of
+// an event only once the sink confirmed it
+func ConfirmsDelivery(t OutputType) bool {
+	switch t {
+	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS, OutputTypeElasticsearch,
+		OutputTypeClickHouse, OutputTypePostgres, OutputTypeMySQL, OutputTypeSnowflake, OutputTypeBigQuery:
+		return true
+	}
+	return false
+}
+
+// CheckAtLeastOnce returns why the output cannot be used by an at-least-once project, nil if it can.
+// Print writes events as it reads them, a router needs every child output to qualify.
+func (out *Output) CheckAtLeastOnce() error {
+	switch {
+	case out.Type == OutputTypePrint, ConfirmsDelivery(out.Type):
+		return nil
+	case out.Type == OutputTypeRouter:
+		router, err := common.NewOutputRouter(out.routerCfg)
+		if err != nil {
+			return fmt.Errorf("router output %s: %v", out.Id, err)
+		}
+		for _, id := range router.Outputs() {
+			child, err := resolveRouterChild(id)
+			if err != nil {
+				return fmt.Errorf("router output %s: %v", out.Id, err)
+			}
+			if err := child.CheckAtLeastOnce(); err != nil {
+				return fmt.Errorf("router output %s: %w", out.Id, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("output %s of type %s does not confirm deliveries", out.Id, out.Type)
+}
+
+// producerChan returns the channel a producer reads from. With a rate limit the producer reads
+// from the throttle instead of msgChan, which is started by startThrottle once the producer runs.
+func (out *Output) producerChan(msgChan chan map[string]interface{}) chan map[string]interface{} {
+	out.throttle = nil
+	if out.Config == nil || out.Config.RateLimit == nil {
+		return msgChan
+	}
+	out.throttle = common.NewOutputThrottle(out.Id, out.Config.RateLimit, msgChan, out.receipts)
+	return out.throttle.Out()
+}
+
+// startThrottle starts the rate limit of a producer created with producerChan
+func (out *Output) startThrottle() {
+	if out.throttle != nil {
+		out.throttle.Start()
+	}
+}
+
+// isHighPriority reports whether an event takes the priority lane, either marked by its rule or by the output config
+func (out *Output) isHighPriority(msg map[string]interface{}) bool {
+	if out.Config != nil && out.Config.Priority == common.PriorityHigh {
+		return true
+	}
+	return common.IsHighPriority(msg)
+}
+
+// sendToProducer hands an event to a producer without blocking. High priority events use the
+// priority lane when there is one and fall back to the normal queue if the lane is full.
+func (out *Output) sendToProducer(msg map[string]interface{}, msgChan, priorityChan chan map[string]interface{}) bool {
+	if priorityChan != nil && out.isHighPriority(msg) {
+		select {
+		case priorityChan <- msg:
+			return true
+		default:
+		}
+	}
+	select {
+	case msgChan <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewOutput creates an Output from config and upstreams.
+func NewOutput(path string, raw string, id string) (*Output, error) {
+	var cfg OutputConfig
+
+	err := Verify(path, raw)
+	if err != nil {
+		return nil, fmt.Errorf("output verify error: %s %s", id, err.Error())
+	}
+
+	// Verify only checks the syntax of ${secret:...} references, they are resolved here
+	data, err := common.ReadContentFromPathOrRaw(path, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output configuration: %s %w", id, err)
+	}
+	if err := unmarshalConfig(data, &cfg); err != nil {
+		return nil, fmt.Errorf("output config error: %s %w", id, err)
+	}
+	cfg.RawConfig = string(data)
+
+	out := &Output{
+		Id:               id,
+		Path:             path,
+		Type:             cfg.Type,
+		UpStream:         make(map[string]*chan map[string]interface{}, 0),
+		kafkaCfg:         cfg.Kafka,
+		elasticsearchCfg: cfg.Elasticsearch,
+		aliyunSLSCfg:     cfg.AliyunSLS,
+		objectStorageCfg: cfg.objectStorageSection(),
+		clickhouseCfg:    cfg.ClickHouse,
+		incidentCfg:      cfg.incidentSection(),
+		azureSecurityCfg: cfg.azureSecuritySection(),
+		chatCfg:          cfg.chatSection(),
+		webhookCfg:       cfg.Webhook,
+		smtpCfg:          cfg.SMTP,
+		ticketCfg:        cfg.ticketSection(),
+		federationCfg:    cfg.Federation,
+		metricsCfg:       cfg.Metrics,
+		sqlCfg:           cfg.sqlSection(),
+		warehouseCfg:     cfg.warehouseSection(),
+		routerCfg:        cfg.Router,
+		Config:           &cfg,
+		sampler:          nil, // Will be set below based on cluster role
+		receipts:         common.NewDeliveryReceipts(),
+		Status:           common.StatusStopped,
+	}
+
+	// Verify already compiled the projection once, so this cannot fail
+	out.projection, _ = common.NewFieldProjection(cfg.Fields)
+
+	// Only create sampler on leader node for performance
+	if common.IsLeader {
+		out.sampler = common.GetSampler("output." + id)
+	}
+	return out, nil
+}
+
+// SetStatus sets the output status and error information
+func (out *Output) SetStatus(status common.Status, err error) {
+	if err != nil {
+		out.Err = err
+		logger.Error("Output status changed with error", "output", out.Id, "status", status, "error", err)
+	}
+	out.Status = status
+	t := time.Now()
+	out.StatusChangedAt = &t
+}
+
+// cleanup performs cleanup when normal stop fails or panic occurs
+func (out *Output) cleanup() {
+	// Note: stopChan is already closed in Stop() method, so we don't close it here
+
+	common.UnregisterOutputBreaker(out.breaker)
+
 	// Stop producers (idempotent operations)
 	if out.kafkaProducer != nil {
 		out.kafkaProducer.Close()
@@ -247,6 +1692,68 @@ func (out *Output) cleanup() {
 		out.elasticsearchProducer = nil
 	}
 
+	if out.objectStoreProducer != nil {
+		out.objectStoreProducer.Close()
+		out.objectStoreProducer = nil
+	}
+
+	if out.clickhouseProducer != nil {
+		out.clickhouseProducer.Close()
+		out.clickhouseProducer = nil
+	}
+
+	if out.incidentProducer != nil {
+		out.incidentProducer.Close()
+		out.incidentProducer = nil
+	}
+
+	if out.azureSecurityProducer != nil {
+		out.azureSecurityProducer.Close()
+		out.azureSecurityProducer = nil
+	}
+
+	if out.chatProducer != nil {
+		out.chatProducer.Close()
+		out.chatProducer = nil
+	}
+
+	if out.webhookProducer != nil {
+		out.webhookProducer.Close()
+		out.webhookProducer = nil
+	}
+
+	if out.smtpProducer != nil {
+		out.smtpProducer.Close()
+		out.smtpProducer = nil
+	}
+
+	if out.ticketProducer != nil {
+		out.ticketProducer.Close()
+		out.ticketProducer = nil
+	}
+
+	if out.federationProducer != nil {
+		out.federationProducer.Close()
+		out.federationProducer = nil
+	}
+
+	if out.metricsProducer != nil {
+		out.metricsProducer.Close()
+		out.metricsProducer = nil
+	}
+
+	if out.sqlProducer != nil {
+		out.sqlProducer.Close()
+		out.sqlProducer = nil
+	}
+
+	if out.warehouseProducer != nil {
+		out.warehouseProducer.Close()
+		out.warehouseProducer = nil
+	}
+
+	out.stopRouterChildren()
+
 	// Reset atomic counter
 	atomic.StoreUint64(&out.produceTotal, 0)
 	atomic.StoreUint64(&out.lastReportedTotal, 0)
@@ -259,38 +1766,57 @@ func (out *Output) cleanup() {
 }
 
 // enhanceMessageWithProjectNodeSequence adds ProjectNodeSequence and output metadata to the message
+// and applies the fields projection of the output
 func (out *Output) enhanceMessageWithProjectNodeSequence(msg map[string]interface{}) map[string]interface{} {
 	// Create a deep copy of the original message to avoid concurrent map access issues
 	enhancedMsg := common.MapDeepCopy(msg)
 
+	// Outputs that cannot confirm a delivery count the event as delivered once handed to their
+	// producer, the others leave the checkpoint token to the producer
+	if out.Type != OutputTypeRouter && !ConfirmsDelivery(out.Type) {
+		common.TakeDeliveryToken(enhancedMsg).Release()
+	}
+
 	// Add ProjectNodeSequence information
 	enhancedMsg["_hub_project_node_sequence"] = out.ProjectNodeSequence
 	enhancedMsg["_hub_output_timestamp"] = time.Now().UTC().Format(time.RFC3339)
 
-	return enhancedMsg
+	// Index the alert before the projection can remove the hit rule
+	if !out.testing {
+		common.RecordFiredAlert(out.ProjectID, enhancedMsg)
+	}
+
+	return out.projection.Apply(enhancedMsg)
 }
 
-// StartForTesting starts the output component in testing mode
-// In testing mode, completely ignore output type and only send data to TestCollectionChan
-func (out *Output) StartForTesting() error {
-	if out.Status != common.StatusStopped {
-		return fmt.Errorf("output %s is not stopped", out.Id)
+// consumeCanary records the latency of a synthetic canary event.
+// It returns true if the message was a canary and must not be delivered.
+func (out *Output) consumeCanary(msg map[string]interface{}) bool {
+	if !common.IsCanaryEvent(msg) {
+		return false
 	}
+	if common.GlobalCanaryMonitor != nil {
+		common.GlobalCanaryMonitor.Record(msg, out.Id, out.ProjectNodeSequence)
+	}
+	return true
+}
 
-	out.ResetProduceTotal()
-	out.SetStatus(common.StatusStarting, nil)
-
-	// Initialize stop channel for testing
-	out.stopChan = make(chan struct{})
-
-	// Start single goroutine to read from UpStream and send to TestCollectionChan only
+// consumeUpstream starts the goroutine moving messages from the upstream channels to sink until
+// the output stops. Every tick it takes at most one message from each upstream: canaries are
+// recorded and dropped, other messages are counted, sampled, enhanced with the project node
+// sequence and duplicated to TestCollectionChan before being passed to sink. onExit, if set, runs
+// when the goroutine exits, e.g. to close the producer channel.
+func (out *Output) consumeUpstream(sink func(msg map[string]interface{}), onExit func()) {
 	out.wg.Add(1)
 	go func() {
 		defer out.wg.Done()
+		if onExit != nil {
+			defer onExit()
+		}
 		defer func() {
 			if r := recover(); r != nil {
-				logger.Error("Panic in testing output goroutine", "output", out.Id, "panic", r)
-				// Don't change status here as it's handled by the caller
+				logger.Error("Panic in output goroutine", "output", out.Id, "type", out.Type, "panic", r)
+				// Don't change status here as it may conflict with stop process
 			}
 		}()
 
@@ -301,23 +1827,15 @@ func (out *Output) StartForTesting() error {
 		for {
 			select {
 			case <-out.stopChan:
-				logger.Debug("Testing output goroutine received stop signal", "id", out.Id)
+				logger.Debug("Output goroutine received stop signal", "id", out.Id, "type", out.Type)
 				return
 			case <-ticker.C:
-				// Check for stop signal before processing
-				select {
-				case <-out.stopChan:
-					logger.Debug("Testing output goroutine received stop signal before processing", "id", out.Id)
-					return
-				default:
-				}
-
 				// Non-blocking check for messages from any upstream channel
 				for _, up := range out.UpStream {
 					// Check stop signal again during loop iteration
 					select {
 					case <-out.stopChan:
-						logger.Debug("Testing output goroutine received stop signal during upstream processing", "id", out.Id)
+						logger.Debug("Output goroutine received stop signal during upstream processing", "id", out.Id, "type", out.Type)
 						return
 					default:
 					}
@@ -328,26 +1846,137 @@ func (out *Output) StartForTesting() error {
 							// Channel is closed, skip this channel
 							continue
 						}
+						if out.consumeCanary(msg) {
+							continue
+						}
+
+						// Count immediately at upstream read to ensure all messages are counted
 						atomic.AddUint64(&out.produceTotal, 1)
+						out.receipts.AddMatched(1)
 
-						// Skip sampling in testing mode (handled by SetTestMode)
 						if out.sampler != nil {
 							out.sampler.Sample(msg, out.ProjectNodeSequence)
 						}
 
-						// Enhance message with ProjectNodeSequence information
 						enhancedMsg := out.enhanceMessageWithProjectNodeSequence(msg)
 
+						// Duplicate to TestCollectionChan if present (non-blocking)
 						if out.TestCollectionChan != nil {
 							select {
 							case *out.TestCollectionChan <- enhancedMsg:
-								// Message sent successfully
 							default:
-								logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", "testing")
+								logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", out.Type)
 							}
 						}
+
+						sink(enhancedMsg)
+					default:
+						// No message available from this channel, continue to next
+					}
+				}
+			}
+		}
+	}()
+}
+
+// producerSink hands messages to the channel of a producer, high priority alerts go to
+// priorityChan when set. Messages are dropped when the producer is not keeping up.
+func (out *Output) producerSink(msgChan, priorityChan chan map[string]interface{}) func(msg map[string]interface{}) {
+	return func(msg map[string]interface{}) {
+		if out.sendToProducer(msg, msgChan, priorityChan) {
+			out.receipts.AddSent(1)
+			return
+		}
+		logger.Warn("Output producer channel full, dropping message", "id", out.Id, "type", out.Type)
+		out.receipts.AddDropped(1)
+		common.TakeDeliveryToken(msg).Fail()
+	}
+}
+
+// StartForTesting starts the output component in testing mode
+// In testing mode, completely ignore output type and only send data to TestCollectionChan
+func (out *Output) StartForTesting() error {
+	if out.Status != common.StatusStopped {
+		return fmt.Errorf("output %s is not stopped", out.Id)
+	}
+
+	out.ResetProduceTotal()
+	out.SetStatus(common.StatusStarting, nil)
+	out.testing = true
+
+	// Initialize stop channel for testing
+	out.stopChan = make(chan struct{})
+
+	// Start single goroutine to read from UpStream and send to TestCollectionChan only
+	out.wg.Add(1)
+	go func() {
+		defer out.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in testing output goroutine", "output", out.Id, "panic", r)
+				// Don't change status here as it's handled by the caller
+			}
+		}()
+
+		// Use ticker for more predictable exit timing
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-out.stopChan:
+				logger.Debug("Testing output goroutine received stop signal", "id", out.Id)
+				return
+			case <-ticker.C:
+				// Check for stop signal before processing
+				select {
+				case <-out.stopChan:
+					logger.Debug("Testing output goroutine received stop signal before processing", "id", out.Id)
+					return
+				default:
+				}
+
+				// Non-blocking check for messages from any upstream channel
+				for _, up := range out.UpStream {
+					// Check stop signal again during loop iteration
+					select {
+					case <-out.stopChan:
+						logger.Debug("Testing output goroutine received stop signal during upstream processing", "id", out.Id)
+						return
 					default:
 					}
+
+					// Drain everything currently queued so sustained traffic (e.g. shadow runs) keeps up with the tick
+				drain:
+					for {
+						select {
+						case msg, ok := <-*up:
+							if !ok {
+								// Channel is closed, skip this channel
+								break drain
+							}
+							atomic.AddUint64(&out.produceTotal, 1)
+
+							// Skip sampling in testing mode (handled by SetTestMode)
+							if out.sampler != nil {
+								out.sampler.Sample(msg, out.ProjectNodeSequence)
+							}
+
+							// Enhance message with ProjectNodeSequence information
+							enhancedMsg := out.enhanceMessageWithProjectNodeSequence(msg)
+
+							if out.TestCollectionChan != nil {
+								select {
+								case *out.TestCollectionChan <- enhancedMsg:
+									// Message sent successfully
+								default:
+									logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", "testing")
+								}
+							}
+						default:
+							break drain
+						}
+					}
 				}
 
 				// Final check for stop signal after processing
@@ -402,6 +2031,16 @@ func (out *Output) Start() error {
 	// Determine if we need to duplicate data for testing
 	hasTestCollector := out.TestCollectionChan != nil
 
+	if hasCircuitBreaker(out.Type) {
+		var breakerCfg *common.OutputBreakerConfig
+		if out.Config != nil {
+			breakerCfg = out.Config.CircuitBreaker
+		}
+		common.UnregisterOutputBreaker(out.breaker)
+		out.breaker = common.NewOutputBreaker(out.Id, out.ProjectNodeSequence, breakerCfg)
+		common.RegisterOutputBreaker(out.breaker)
+	}
+
 	effectiveType := out.Type
 
 	switch effectiveType {
@@ -421,112 +2060,28 @@ func (out *Output) Start() error {
 			out.kafkaCfg.Topic,
 			out.kafkaCfg.Compression,
 			out.kafkaCfg.SASL,
-			msgChan,
+			out.producerChan(msgChan),
 			out.kafkaCfg.Key,
 			out.kafkaCfg.TLS,
 			// default idempotent true if not specified
 			(out.kafkaCfg.Idempotent == nil) || (out.kafkaCfg.Idempotent != nil && *out.kafkaCfg.Idempotent),
+			out.kafkaCfg.producerOptions(out.ProjectNodeSequence),
 		)
 		if err != nil {
 			out.SetStatus(common.StatusError, fmt.Errorf("failed to create kafka producer for output %s: %v", out.Id, err))
 			return fmt.Errorf("failed to create kafka producer for output %s: %v", out.Id, err)
 		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		priorityChan := common.NewPriorityLane()
+		producer.PriorityChan = priorityChan
 		out.kafkaProducer = producer
 
 		// Initialize stop channel for this output
 		out.stopChan = make(chan struct{})
 
 		// Start goroutine to read from UpStream and send enhanced messages to msgChan for Kafka producer
-		out.wg.Add(1)
-		go func() {
-			defer out.wg.Done()
-			defer close(msgChan) // Close msgChan when UpStream processing is done
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in kafka output goroutine", "output", out.Id, "panic", r)
-					// Don't change status here as it may conflict with stop process
-				}
-			}()
-
-			// Use ticker for more predictable exit timing
-			ticker := time.NewTicker(10 * time.Millisecond)
-			defer ticker.Stop()
-
-			for {
-				select {
-				case <-out.stopChan:
-					logger.Debug("Kafka output goroutine received stop signal", "id", out.Id)
-					return
-				case <-ticker.C:
-					// Check for stop signal before processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Kafka output goroutine received stop signal before processing", "id", out.Id)
-						return
-					default:
-					}
-
-					// Non-blocking check for messages from any upstream channel
-					for _, up := range out.UpStream {
-						// Check stop signal again during loop iteration
-						select {
-						case <-out.stopChan:
-							logger.Debug("Kafka output goroutine received stop signal during upstream processing", "id", out.Id)
-							return
-						default:
-						}
-
-						select {
-						case msg, ok := <-*up:
-							if !ok {
-								// Channel is closed, skip this channel
-								continue
-							}
-
-							// Always count/sample; duplication handled below
-							// Count immediately at upstream read to ensure all messages are counted
-							atomic.AddUint64(&out.produceTotal, 1)
-
-							// Sample the message
-							if out.sampler != nil {
-								out.sampler.Sample(msg, out.ProjectNodeSequence)
-							}
-
-							// Enhance message with ProjectNodeSequence information before sending
-							enhancedMsg := out.enhanceMessageWithProjectNodeSequence(msg)
-
-							// Duplicate to TestCollectionChan if present (non-blocking)
-							if hasTestCollector {
-								select {
-								case *out.TestCollectionChan <- enhancedMsg:
-								default:
-									logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", "kafka")
-								}
-							}
-
-							// Send enhanced message to msgChan for Kafka producer (non-blocking during shutdown)
-							select {
-							case msgChan <- enhancedMsg:
-								// Message sent successfully
-							default:
-								// Channel is full, log warning and continue
-								logger.Warn("Kafka producer channel full, dropping message", "id", out.Id)
-							}
-						default:
-							// No message available from this channel, continue to next
-						}
-					}
-
-					// Final check for stop signal after processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Kafka output goroutine received stop signal after processing", "id", out.Id)
-						return
-					default:
-					}
-				}
-			}
-		}()
+		out.consumeUpstream(out.producerSink(msgChan, priorityChan), func() { close(msgChan) })
 
 	case OutputTypeElasticsearch:
 		if out.elasticsearchProducer != nil {
@@ -552,15 +2107,28 @@ func (out *Output) Start() error {
 		producer, err := common.NewElasticsearchProducer(
 			out.elasticsearchCfg.Hosts,
 			out.elasticsearchCfg.Index,
-			msgChan,
+			out.producerChan(msgChan),
 			batchSize,
 			flushDur,
 			out.elasticsearchCfg.Auth,
+			common.ElasticsearchProducerOptions{
+				DataStream: out.elasticsearchCfg.DataStream,
+				Project:    out.ProjectID,
+				Template:   out.elasticsearchCfg.Template,
+				ILM:        out.elasticsearchCfg.ILM,
+				Quarantine: out.elasticsearchCfg.Quarantine,
+				HTTP:       out.httpConfig(),
+			},
 		)
 		if err != nil {
 			out.SetStatus(common.StatusError, fmt.Errorf("failed to create elasticsearch producer for output %s: %v", out.Id, err))
 			return fmt.Errorf("failed to create elasticsearch producer for output %s: %v", out.Id, err)
 		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		producer.Breaker = out.breaker
+		priorityChan := common.NewPriorityLane()
+		producer.PriorityChan = priorityChan
 		out.elasticsearchProducer = producer
 
 		// Initialize stop channel for this output (if not already initialized)
@@ -569,183 +2137,384 @@ func (out *Output) Start() error {
 		}
 
 		// Start goroutine to read from UpStream and send enhanced messages to msgChan for Elasticsearch producer
-		out.wg.Add(1)
-		go func() {
-			defer out.wg.Done()
-			defer close(msgChan) // Close msgChan when UpStream processing is done
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in elasticsearch output goroutine", "output", out.Id, "panic", r)
-					// Don't change status here as it may conflict with stop process
-				}
-			}()
+		out.consumeUpstream(out.producerSink(msgChan, priorityChan), func() { close(msgChan) })
 
-			// Use ticker for more predictable exit timing
-			ticker := time.NewTicker(10 * time.Millisecond)
-			defer ticker.Stop()
+	case OutputTypeS3, OutputTypeGCS, OutputTypeAzureBlob:
+		if out.objectStoreProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.objectStorageCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
 
-			for {
-				select {
-				case <-out.stopChan:
-					logger.Debug("Elasticsearch output goroutine received stop signal", "id", out.Id)
-					return
-				case <-ticker.C:
-					// Check for stop signal before processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Elasticsearch output goroutine received stop signal before processing", "id", out.Id)
-						return
-					default:
-					}
+		storeCfg, err := out.objectStorageCfg.objectStoreConfig(out.Type, out.ProjectID, out.Id)
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("invalid %s configuration for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("invalid %s configuration for output %s: %v", out.Type, out.Id, err)
+		}
+		msgChan := make(chan map[string]interface{}, 1024)
+		producer, err := common.NewObjectStoreProducer(storeCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.objectStoreProducer = producer
 
-					// Non-blocking check for messages from any upstream channel
-					for _, up := range out.UpStream {
-						// Check stop signal again during loop iteration
-						select {
-						case <-out.stopChan:
-							logger.Debug("Elasticsearch output goroutine received stop signal during upstream processing", "id", out.Id)
-							return
-						default:
-						}
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
 
-						select {
-						case msg, ok := <-*up:
-							if !ok {
-								// Channel is closed, skip this channel
-								continue
-							}
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for object storage producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
 
-							// Always count/sample; duplication handled separately
-							// Count immediately at upstream read to ensure all messages are counted
-							atomic.AddUint64(&out.produceTotal, 1)
+	case OutputTypeClickHouse:
+		if out.clickhouseProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("clickhouse producer already running for output %s", out.Id))
+			return fmt.Errorf("clickhouse producer already running for output %s", out.Id)
+		}
+		if out.clickhouseCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("clickhouse configuration missing for output %s", out.Id))
+			return fmt.Errorf("clickhouse configuration missing for output %s", out.Id)
+		}
 
-							// Sample the message
-							if out.sampler != nil {
-								out.sampler.Sample(msg, out.ProjectNodeSequence)
-							}
+		msgChan := make(chan map[string]interface{}, 1024)
+		producer, err := common.NewClickHouseProducer(out.clickhouseCfg.clickhouseConfig(), out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create clickhouse producer for output %s: %v", out.Id, err))
+			return fmt.Errorf("failed to create clickhouse producer for output %s: %v", out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.clickhouseProducer = producer
 
-							// Enhance message with ProjectNodeSequence information before sending
-							enhancedMsg := out.enhanceMessageWithProjectNodeSequence(msg)
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
 
-							if hasTestCollector {
-								select {
-								case *out.TestCollectionChan <- enhancedMsg:
-								default:
-									logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", "elasticsearch")
-								}
-							}
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for ClickHouse producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
 
-							// Send enhanced message to msgChan for Elasticsearch producer (non-blocking during shutdown)
-							select {
-							case msgChan <- enhancedMsg:
-								// Message sent successfully
-							default:
-								// Channel is full, log warning and continue
-								logger.Warn("Elasticsearch producer channel full, dropping message", "id", out.Id)
-							}
-						default:
-							// No message available from this channel, continue to next
-						}
-					}
+	case OutputTypePostgres, OutputTypeMySQL:
+		if out.sqlProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.sqlCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
 
-					// Final check for stop signal after processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Elasticsearch output goroutine received stop signal after processing", "id", out.Id)
-						return
-					default:
-					}
-				}
-			}
-		}()
+		msgChan := make(chan map[string]interface{}, 1024)
+		producer, err := common.NewSQLProducer(out.sqlCfg.sqlConfig(out.Type), out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.sqlProducer = producer
 
-	case OutputTypePrint:
 		// Initialize stop channel for this output (if not already initialized)
 		if out.stopChan == nil {
 			out.stopChan = make(chan struct{})
 		}
-		out.wg.Add(1)
-		go func() {
-			defer out.wg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in print output goroutine", "output", out.Id, "panic", r)
-					// Don't change status here as it may conflict with stop process
-				}
-			}()
 
-			// Use ticker for more predictable exit timing
-			ticker := time.NewTicker(10 * time.Millisecond)
-			defer ticker.Stop()
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for SQL producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
 
-			for {
-				select {
-				case <-out.stopChan:
-					logger.Debug("Print output goroutine received stop signal", "id", out.Id)
-					return
-				case <-ticker.C:
-					// Check for stop signal before processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Print output goroutine received stop signal before processing", "id", out.Id)
-						return
-					default:
-					}
+	case OutputTypeSnowflake, OutputTypeBigQuery:
+		if out.warehouseProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.warehouseCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
 
-					// Non-blocking check for messages from any upstream channel
-					for _, up := range out.UpStream {
-						// Check stop signal again during loop iteration
-						select {
-						case <-out.stopChan:
-							logger.Debug("Print output goroutine received stop signal during upstream processing", "id", out.Id)
-							return
-						default:
-						}
+		msgChan := make(chan map[string]interface{}, 1024)
+		whCfg, err := out.warehouseCfg.warehouseConfig(out.Type, out.Id)
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("invalid %s config for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("invalid %s config for output %s: %v", out.Type, out.Id, err)
+		}
+		producer, err := common.NewWarehouseProducer(whCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.warehouseProducer = producer
 
-						select {
-						case msg, ok := <-*up:
-							if !ok {
-								// Channel is closed, skip this channel
-								continue
-							}
-							// Always count/sample.
-							// Count immediately at upstream read to ensure all messages are counted
-							atomic.AddUint64(&out.produceTotal, 1)
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
 
-							// Sample the message
-							if out.sampler != nil {
-								out.sampler.Sample(msg, out.ProjectNodeSequence)
-							}
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for warehouse producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
 
-							// Duplicate to TestCollectionChan if present
-							if hasTestCollector {
-								msgWithId := out.enhanceMessageWithProjectNodeSequence(msg)
-								select {
-								case *out.TestCollectionChan <- msgWithId:
-								default:
-									logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", "print")
-								}
-							}
+	case OutputTypePagerDuty, OutputTypeOpsgenie:
+		if out.incidentProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.incidentCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
 
-							// Enhance message with ProjectNodeSequence information for actual output
-							enhancedMsg := out.enhanceMessageWithProjectNodeSequence(msg)
-							data, _ := json.Marshal(enhancedMsg)
-							logger.Info("[Print Output]", "data", string(data))
-						default:
-							// No message available from this channel, continue to next
-						}
-					}
+		msgChan := make(chan map[string]interface{}, 1024)
+		incCfg := out.incidentCfg.incidentConfig(out.Type)
+		incCfg.HTTP = out.httpConfig()
+		producer, err := common.NewIncidentProducer(incCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.incidentProducer = producer
 
-					// Final check for stop signal after processing
-					select {
-					case <-out.stopChan:
-						logger.Debug("Print output goroutine received stop signal after processing", "id", out.Id)
-						return
-					default:
-					}
-				}
-			}
-		}()
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for incident producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeSentinel, OutputTypeGraphSecurity:
+		if out.azureSecurityProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.azureSecurityCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		azCfg := out.azureSecurityCfg.azureSecurityConfig(out.Type)
+		azCfg.HTTP = out.httpConfig()
+		producer, err := common.NewAzureSecurityProducer(azCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.azureSecurityProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for azure security producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk:
+		if out.chatProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.chatCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		chatCfg := out.chatCfg.chatConfig(out.Type)
+		chatCfg.HTTP = out.httpConfig()
+		producer, err := common.NewChatNotifyProducer(chatCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.chatProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for chat notification producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeWebhook:
+		if out.webhookProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("webhook producer already running for output %s", out.Id))
+			return fmt.Errorf("webhook producer already running for output %s", out.Id)
+		}
+		if out.webhookCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("webhook configuration missing for output %s", out.Id))
+			return fmt.Errorf("webhook configuration missing for output %s", out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		webhookCfg := out.webhookCfg.webhookConfig()
+		webhookCfg.HTTP = out.httpConfig()
+		producer, err := common.NewWebhookProducer(webhookCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create webhook producer for output %s: %v", out.Id, err))
+			return fmt.Errorf("failed to create webhook producer for output %s: %v", out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		producer.Breaker = out.breaker
+		out.webhookProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for webhook producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeSMTP:
+		if out.smtpProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("smtp producer already running for output %s", out.Id))
+			return fmt.Errorf("smtp producer already running for output %s", out.Id)
+		}
+		if out.smtpCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("smtp configuration missing for output %s", out.Id))
+			return fmt.Errorf("smtp configuration missing for output %s", out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		producer, err := common.NewSMTPProducer(out.smtpCfg.smtpConfig(), out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create smtp producer for output %s: %v", out.Id, err))
+			return fmt.Errorf("failed to create smtp producer for output %s: %v", out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.smtpProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for smtp producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeJira, OutputTypeTheHive, OutputTypeServiceNow:
+		if out.ticketProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.ticketCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		ticketCfg := out.ticketCfg.ticketConfig(out.Type)
+		ticketCfg.HTTP = out.httpConfig()
+		producer, err := common.NewTicketProducer(ticketCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.ticketProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for ticket producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeFederation:
+		if out.federationProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.federationCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		producer, err := common.NewFederationProducer(out.federationCfg.federationConfig(), out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.federationProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for federation producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypeMetrics:
+		if out.metricsProducer != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s producer already running for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s producer already running for output %s", out.Type, out.Id)
+		}
+		if out.metricsCfg == nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id))
+			return fmt.Errorf("%s configuration missing for output %s", out.Type, out.Id)
+		}
+
+		msgChan := make(chan map[string]interface{}, 1024)
+		metricsCfg := out.metricsCfg.metricsConfig()
+		metricsCfg.HTTP = out.httpConfig()
+		producer, err := common.NewMetricsProducer(metricsCfg, out.producerChan(msgChan))
+		if err != nil {
+			out.SetStatus(common.StatusError, fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err))
+			return fmt.Errorf("failed to create %s producer for output %s: %v", out.Type, out.Id, err)
+		}
+		producer.Receipts = out.receipts
+		out.startThrottle()
+		out.metricsProducer = producer
+
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+
+		// Start goroutine to read from UpStream and send enhanced messages to msgChan for metrics producer
+		out.consumeUpstream(out.producerSink(msgChan, nil), func() { close(msgChan) })
+
+	case OutputTypePrint:
+		// Initialize stop channel for this output (if not already initialized)
+		if out.stopChan == nil {
+			out.stopChan = make(chan struct{})
+		}
+		out.consumeUpstream(func(msg map[string]interface{}) {
+			data, _ := json.Marshal(msg)
+			logger.Info("[Print Output]", "data", string(data))
+			out.receipts.AddSent(1)
+			out.receipts.AddAcked(1)
+		}, nil)
+
+	case OutputTypeRouter:
+		if err := out.startRouter(hasTestCollector); err != nil {
+			out.SetStatus(common.StatusError, err)
+			return err
+		}
 
 	case OutputTypeAliyunSLS:
 		out.SetStatus(common.StatusError, fmt.Errorf("aliyun SLS output not implemented yet"))
@@ -791,6 +2560,76 @@ func (out *Output) Stop() error {
 		out.elasticsearchProducer.Close()
 		out.elasticsearchProducer = nil
 	}
+	if out.objectStoreProducer != nil {
+		// Waits for the open objects to be uploaded
+		logger.Debug("Closing object storage producer", "id", out.Id)
+		out.objectStoreProducer.Close()
+		out.objectStoreProducer = nil
+	}
+	if out.clickhouseProducer != nil {
+		// Waits for the last batch to be inserted
+		logger.Debug("Closing clickhouse producer", "id", out.Id)
+		out.clickhouseProducer.Close()
+		out.clickhouseProducer = nil
+	}
+	if out.incidentProducer != nil {
+		// Waits for the queued incident actions to be sent
+		logger.Debug("Closing incident producer", "id", out.Id)
+		out.incidentProducer.Close()
+		out.incidentProducer = nil
+	}
+	if out.azureSecurityProducer != nil {
+		// Waits for the queued events to be sent
+		logger.Debug("Closing azure security producer", "id", out.Id)
+		out.azureSecurityProducer.Close()
+		out.azureSecurityProducer = nil
+	}
+	if out.chatProducer != nil {
+		logger.Debug("Closing chat notification producer", "id", out.Id)
+		out.chatProducer.Close()
+		out.chatProducer = nil
+	}
+	if out.webhookProducer != nil {
+		logger.Debug("Closing webhook producer", "id", out.Id)
+		out.webhookProducer.Close()
+		out.webhookProducer = nil
+	}
+	if out.smtpProducer != nil {
+		// Sends a pending digest
+		logger.Debug("Closing smtp producer", "id", out.Id)
+		out.smtpProducer.Close()
+		out.smtpProducer = nil
+	}
+	if out.ticketProducer != nil {
+		// Waits for the queued tickets to be created
+		logger.Debug("Closing ticket producer", "id", out.Id)
+		out.ticketProducer.Close()
+		out.ticketProducer = nil
+	}
+	if out.federationProducer != nil {
+		// Forwards the last batch to the central hub
+		logger.Debug("Closing federation producer", "id", out.Id)
+		out.federationProducer.Close()
+		out.federationProducer = nil
+	}
+	if out.metricsProducer != nil {
+		// Pushes the last values
+		logger.Debug("Closing metrics producer", "id", out.Id)
+		out.metricsProducer.Close()
+		out.metricsProducer = nil
+	}
+	if out.sqlProducer != nil {
+		// Waits for the last batch to be written
+		logger.Debug("Closing sql producer", "id", out.Id)
+		out.sqlProducer.Close()
+		out.sqlProducer = nil
+	}
+	if out.warehouseProducer != nil {
+		// Waits for the last batch to be written
+		logger.Debug("Closing warehouse producer", "id", out.Id)
+		out.warehouseProducer.Close()
+		out.warehouseProducer = nil
+	}
 
 	// Step 3: Wait for goroutines to finish with timeout and force cleanup if needed
 	logger.Info("Waiting for output goroutines to finish", "id", out.Id)
@@ -814,6 +2653,9 @@ func (out *Output) Stop() error {
 		stopError = fmt.Errorf("timeout waiting for goroutines to finish")
 	}
 
+	// Child outputs of a router are stopped once the router no longer sends to them
+	out.stopRouterChildren()
+
 	// Step 4: Final cleanup to ensure all resources are properly released
 	out.cleanup()
 
@@ -832,6 +2674,11 @@ func (out *Output) GetProduceTotal() uint64 {
 	return atomic.LoadUint64(&out.produceTotal)
 }
 
+// GetDeliveryReceipts returns the delivery counters used for reconciliation, nil for test instances.
+func (out *Output) GetDeliveryReceipts() *common.DeliveryReceipts {
+	return out.receipts
+}
+
 // ResetProduceTotal resets the total produced count to zero.
 // This should only be called during component cleanup or forced restart.
 func (out *Output) ResetProduceTotal() uint64 {
@@ -854,188 +2701,809 @@ func (out *Output) GetIncrementAndUpdate() uint64 {
 	return 0
 }
 
-// StopForTesting stops the output quickly for testing purposes without waiting for channel drainage
-func (out *Output) StopForTesting() error {
-	logger.Info("Quick stopping test output", "id", out.Id, "type", out.Type)
+// StopForTesting stops the output quickly for testing purposes without waiting for channel drainage
+func (out *Output) StopForTesting() error {
+	logger.Info("Quick stopping test output", "id", out.Id, "type", out.Type)
+
+	// Step 1: Signal goroutines to stop by closing stopChan channel
+	if out.stopChan != nil {
+		close(out.stopChan)
+		out.stopChan = nil
+	}
+
+	// Step 2: Clear test collection channel
+	out.TestCollectionChan = nil
+
+	// Step 3: Wait for goroutines with very short timeout
+	waitDone := make(chan struct{})
+	go func() {
+		out.wg.Wait()
+		close(waitDone)
+	}()
+
+	select {
+	case <-waitDone:
+		logger.Info("Test output stopped successfully", "id", out.Id)
+	case <-time.After(1 * time.Second): // Very short timeout for testing
+		logger.Warn("Timeout waiting for test output goroutines, proceeding anyway", "id", out.Id)
+	}
+
+	// Step 4: Reset atomic counter for testing cleanup
+	previousTotal := atomic.LoadUint64(&out.produceTotal)
+	atomic.StoreUint64(&out.produceTotal, 0)
+	atomic.StoreUint64(&out.lastReportedTotal, 0)
+	logger.Debug("Reset atomic counter for test output component", "output", out.Id, "previous_total", previousTotal)
+
+	// Step 5: Clear component channel connections to prevent leaks
+	out.UpStream = make(map[string]*chan map[string]interface{})
+
+	out.SetStatus(common.StatusStopped, nil)
+	return nil
+}
+
+// CheckConnectivity performs a real connectivity test for the output component
+// This method tests actual connection to external systems (Kafka, ES, etc.)
+func (out *Output) CheckConnectivity() map[string]interface{} {
+	result := map[string]interface{}{
+		"status":  "success",
+		"message": "Connection check successful",
+		"details": map[string]interface{}{
+			"client_type":         string(out.Type),
+			"connection_status":   "unknown",
+			"connection_info":     map[string]interface{}{},
+			"connection_errors":   []map[string]interface{}{},
+			"connection_warnings": []map[string]interface{}{},
+		},
+	}
+	if out.breaker != nil {
+		result["details"].(map[string]interface{})["circuit_breaker"] = out.breaker.Status()
+	}
+	if out.throttle != nil {
+		result["details"].(map[string]interface{})["rate_limit"] = out.throttle.GetStats()
+	}
+
+	switch out.Type {
+	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS:
+		if out.kafkaCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Kafka configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "Kafka configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info
+		connectionInfo := map[string]interface{}{
+			"brokers":       out.kafkaCfg.Brokers,
+			"topic":         out.kafkaCfg.Topic,
+			"transactional": out.kafkaCfg.Transaction != nil,
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+
+		// Test actual connectivity to Kafka brokers
+		err := common.TestKafkaConnection(out.kafkaCfg.Brokers, out.kafkaCfg.SASL, out.kafkaCfg.TLS)
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to Kafka brokers"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+
+		// Test if topic exists
+		topicExists, err := common.TestKafkaTopicExists(out.kafkaCfg.Brokers, out.kafkaCfg.Topic, out.kafkaCfg.SASL, out.kafkaCfg.TLS)
+		if err != nil {
+			result["status"] = "warning"
+			result["message"] = "Connected to Kafka but failed to verify topic"
+			result["details"].(map[string]interface{})["connection_status"] = "connected_topic_unknown"
+			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("Could not verify topic existence: %v", err), "severity": "warning"},
+			}
+		} else if !topicExists {
+			result["status"] = "warning"
+			result["message"] = "Connected to Kafka but topic does not exist"
+			result["details"].(map[string]interface{})["connection_status"] = "connected_topic_missing"
+			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("Topic '%s' does not exist", out.kafkaCfg.Topic), "severity": "warning"},
+			}
+		} else {
+			result["details"].(map[string]interface{})["connection_status"] = "connected"
+			result["message"] = "Successfully connected to Kafka and verified topic"
+		}
+
+		// Add producer metrics if available
+		if out.kafkaProducer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeElasticsearch:
+		if out.elasticsearchCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Elasticsearch configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "Elasticsearch configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info
+		connectionInfo := map[string]interface{}{
+			"hosts":       out.elasticsearchCfg.Hosts,
+			"index":       out.elasticsearchCfg.Index,
+			"data_stream": out.elasticsearchCfg.DataStream,
+		}
+		if out.elasticsearchProducer != nil {
+			connectionInfo["distribution"] = out.elasticsearchProducer.Version.Distribution
+			connectionInfo["version"] = out.elasticsearchProducer.Version.Number
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+
+		// Test actual connectivity to Elasticsearch cluster
+		err := common.TestElasticsearchConnection(out.elasticsearchCfg.Hosts, out.elasticsearchCfg.Auth, out.httpConfig())
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to Elasticsearch cluster"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+
+		// Test if index exists (this is optional for ES as indices can be auto-created)
+		// Index names resolved from event fields are checked by their wildcard pattern
+		indexExists, err := common.TestElasticsearchIndexExists(out.elasticsearchCfg.Hosts, common.IndexPattern(out.elasticsearchCfg.Index), out.elasticsearchCfg.Auth, out.httpConfig())
+		if err != nil {
+			result["status"] = "warning"
+			result["message"] = "Connected to Elasticsearch but failed to verify index"
+			result["details"].(map[string]interface{})["connection_status"] = "connected_index_unknown"
+			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("Could not verify index existence: %v", err), "severity": "warning"},
+			}
+		} else if !indexExists {
+			result["status"] = "success" // This is OK for ES as indices can be auto-created
+			result["message"] = "Connected to Elasticsearch (index will be auto-created)"
+			result["details"].(map[string]interface{})["connection_status"] = "connected_index_will_be_created"
+			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("Index '%s' does not exist but will be auto-created", out.elasticsearchCfg.Index), "severity": "info"},
+			}
+		} else {
+			result["details"].(map[string]interface{})["connection_status"] = "connected"
+			result["message"] = "Successfully connected to Elasticsearch and verified index"
+		}
+
+		// Get cluster info for additional details
+		clusterInfo, err := common.GetElasticsearchClusterInfo(out.elasticsearchCfg.Hosts, out.elasticsearchCfg.Auth, out.httpConfig())
+		if err == nil {
+			result["details"].(map[string]interface{})["cluster_info"] = clusterInfo
+		}
+
+		// Add producer metrics if available
+		if out.elasticsearchProducer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"produce_total":    out.GetProduceTotal(),
+				"producer_active":  true,
+				"batch_size":       out.elasticsearchCfg.BatchSize,
+				"quarantine_total": out.elasticsearchProducer.GetQuarantineTotal(),
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeS3, OutputTypeGCS, OutputTypeAzureBlob:
+		if out.objectStorageCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Object storage configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		connectionInfo := map[string]interface{}{
+			"bucket":    out.objectStorageCfg.Bucket,
+			"prefix":    out.objectStorageCfg.Prefix,
+			"partition": out.objectStorageCfg.Partition,
+			"format":    out.objectStorageCfg.Format,
+		}
+		if out.objectStorageCfg.Endpoint != "" {
+			connectionInfo["endpoint"] = out.objectStorageCfg.Endpoint
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+
+		storeCfg, err := out.objectStorageCfg.objectStoreConfig(out.Type, out.ProjectID, out.Id)
+		if err == nil {
+			err = common.TestObjectStoreConnection(storeCfg)
+		}
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to access object storage bucket"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully accessed object storage bucket"
+
+		// Add producer metrics if available
+		if out.objectStoreProducer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+				"objects_written": out.objectStoreProducer.GetObjectsWritten(),
+				"bytes_written":   out.objectStoreProducer.GetBytesWritten(),
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeClickHouse:
+		if out.clickhouseCfg == nil {
+			result["status"] = "error"
+			result["message"] = "ClickHouse configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "ClickHouse configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		chCfg := out.clickhouseCfg.clickhouseConfig()
+		connectionInfo := map[string]interface{}{
+			"hosts":    chCfg.Hosts,
+			"database": out.clickhouseCfg.Database,
+			"table":    out.clickhouseCfg.Table,
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+
+		version, err := common.TestClickHouseConnection(chCfg)
+		if version != "" {
+			connectionInfo["server_version"] = version
+		}
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to ClickHouse or verify table"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully connected to ClickHouse and verified table"
+
+		// Add producer metrics if available
+		if out.clickhouseProducer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+				"rows_written":    out.clickhouseProducer.GetRowsWritten(),
+				"failed_inserts":  out.clickhouseProducer.GetFailedInserts(),
+				"failovers":       out.clickhouseProducer.GetFailovers(),
+			}
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypePagerDuty, OutputTypeOpsgenie:
+		if out.incidentCfg == nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		incCfg := out.incidentCfg.incidentConfig(out.Type)
+		incCfg.HTTP = out.httpConfig()
+		err := common.TestIncidentConnection(incCfg)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"provider":     incCfg.Provider,
+			"url":          incCfg.URL,
+			"dedup_fields": incCfg.DedupFields,
+		}
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("Failed to connect to %s", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Successfully reached %s", out.Type)
+		if out.Type == OutputTypePagerDuty {
+			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+				{"message": "PagerDuty routing keys cannot be verified without creating an incident", "severity": "info"},
+			}
+		}
+
+		// Add producer metrics if available
+		if out.incidentProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.incidentProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeSentinel, OutputTypeGraphSecurity:
+		if out.azureSecurityCfg == nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		azCfg := out.azureSecurityCfg.azureSecurityConfig(out.Type)
+		azCfg.HTTP = out.httpConfig()
+		err := common.TestAzureSecurityConnection(azCfg)
+		connectionInfo := map[string]interface{}{
+			"tenant_id": azCfg.TenantID,
+			"client_id": azCfg.ClientID,
+		}
+		if out.Type == OutputTypeSentinel {
+			connectionInfo["endpoint"] = azCfg.Endpoint
+			connectionInfo["dcr_immutable_id"] = azCfg.RuleID
+			connectionInfo["stream"] = azCfg.Stream
+		} else {
+			connectionInfo["url"] = azCfg.URL
+		}
+		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("Failed to connect to %s", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Authenticated and reached %s", out.Type)
+		result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+			{"message": "Write permissions are only checked when the first events are sent", "severity": "info"},
+		}
+
+		// Add producer metrics if available
+		if out.azureSecurityProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.azureSecurityProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk:
+		if out.chatCfg == nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (webhook URLs carry the credentials, so only the host is shown)
+		chatCfg := out.chatCfg.chatConfig(out.Type)
+		chatCfg.HTTP = out.httpConfig()
+		webhookHost := ""
+		if u, err := url.Parse(chatCfg.WebhookURL); err == nil {
+			webhookHost = u.Host
+		}
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"platform":     chatCfg.Platform,
+			"webhook_host": webhookHost,
+			"rate_limit":   chatCfg.RateLimit,
+			"rate_window":  out.chatCfg.RateWindow,
+		}
+		if err := common.TestChatWebhook(chatCfg.WebhookURL, chatCfg.HTTP); err != nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("Failed to connect to %s", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Successfully reached %s", out.Type)
+		result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
+			{"message": "Webhooks cannot be verified without posting a message", "severity": "info"},
+		}
+
+		// Add producer metrics if available
+		if out.chatProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.chatProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
+
+	case OutputTypeWebhook:
+		if out.webhookCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Webhook configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "Webhook configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
 
-	// Step 1: Signal goroutines to stop by closing stopChan channel
-	if out.stopChan != nil {
-		close(out.stopChan)
-		out.stopChan = nil
-	}
+		// Set connection info (without headers, which often carry credentials)
+		webhookCfg := out.webhookCfg.webhookConfig()
+		webhookCfg.HTTP = out.httpConfig()
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"url":    webhookCfg.URL,
+			"method": webhookCfg.Method,
+			"proxy":  webhookCfg.Proxy != "",
+			"signed": webhookCfg.Signing != nil,
+		}
+		if err := common.TestWebhookConnection(webhookCfg); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to webhook"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully reached webhook"
 
-	// Step 2: Clear test collection channel
-	out.TestCollectionChan = nil
+		// Add producer metrics if available
+		if out.webhookProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.webhookProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
 
-	// Step 3: Wait for goroutines with very short timeout
-	waitDone := make(chan struct{})
-	go func() {
-		out.wg.Wait()
-		close(waitDone)
-	}()
+	case OutputTypeSMTP:
+		if out.smtpCfg == nil {
+			result["status"] = "error"
+			result["message"] = "SMTP configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "SMTP configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
 
-	select {
-	case <-waitDone:
-		logger.Info("Test output stopped successfully", "id", out.Id)
-	case <-time.After(1 * time.Second): // Very short timeout for testing
-		logger.Warn("Timeout waiting for test output goroutines, proceeding anyway", "id", out.Id)
-	}
+		// Set connection info (without sensitive credentials)
+		smtpCfg := out.smtpCfg.smtpConfig()
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"host":       smtpCfg.Host,
+			"port":       smtpCfg.Port,
+			"security":   smtpCfg.Security,
+			"from":       smtpCfg.From,
+			"recipients": len(smtpCfg.To) + len(smtpCfg.Cc),
+			"digest":     smtpCfg.DigestWindow.String(),
+		}
+		if err := common.TestSMTPConnection(smtpCfg); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to SMTP server"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully connected to SMTP server"
 
-	// Step 4: Reset atomic counter for testing cleanup
-	previousTotal := atomic.LoadUint64(&out.produceTotal)
-	atomic.StoreUint64(&out.produceTotal, 0)
-	atomic.StoreUint64(&out.lastReportedTotal, 0)
-	logger.Debug("Reset atomic counter for test output component", "output", out.Id, "previous_total", previousTotal)
+		// Add producer metrics if available
+		if out.smtpProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.smtpProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
 
-	// Step 5: Clear component channel connections to prevent leaks
-	out.UpStream = make(map[string]*chan map[string]interface{})
+	case OutputTypeJira, OutputTypeTheHive, OutputTypeServiceNow:
+		if out.ticketCfg == nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
 
-	out.SetStatus(common.StatusStopped, nil)
-	return nil
-}
+		// Set connection info (without sensitive credentials)
+		ticketCfg := out.ticketCfg.ticketConfig(out.Type)
+		ticketCfg.HTTP = out.httpConfig()
+		err := common.TestTicketConnection(ticketCfg)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"provider":     ticketCfg.Provider,
+			"url":          ticketCfg.URL,
+			"project":      ticketCfg.Project,
+			"table":        ticketCfg.Table,
+			"dedup_fields": ticketCfg.DedupFields,
+		}
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("Failed to connect to %s", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Successfully connected to %s", out.Type)
 
-// CheckConnectivity performs a real connectivity test for the output component
-// This method tests actual connection to external systems (Kafka, ES, etc.)
-func (out *Output) CheckConnectivity() map[string]interface{} {
-	result := map[string]interface{}{
-		"status":  "success",
-		"message": "Connection check successful",
-		"details": map[string]interface{}{
-			"client_type":         string(out.Type),
-			"connection_status":   "unknown",
-			"connection_info":     map[string]interface{}{},
-			"connection_errors":   []map[string]interface{}{},
-			"connection_warnings": []map[string]interface{}{},
-		},
-	}
+		// Add producer metrics if available
+		if out.ticketProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+			}
+			for k, v := range out.ticketProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
+		} else {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
+		}
 
-	switch out.Type {
-	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS:
-		if out.kafkaCfg == nil {
+	case OutputTypeFederation:
+		if out.federationCfg == nil {
 			result["status"] = "error"
-			result["message"] = "Kafka configuration missing"
+			result["message"] = "Federation configuration missing"
 			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
 			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
-				{"message": "Kafka configuration is incomplete or missing", "severity": "error"},
+				{"message": "Federation configuration is incomplete or missing", "severity": "error"},
 			}
 			return result
 		}
 
-		// Set connection info
-		connectionInfo := map[string]interface{}{
-			"brokers": out.kafkaCfg.Brokers,
-			"topic":   out.kafkaCfg.Topic,
+		federationCfg := out.federationCfg.federationConfig()
+		err := common.TestFederationConnection(federationCfg)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"url":         federationCfg.URL,
+			"hub_id":      federationCfg.HubID,
+			"include_raw": federationCfg.IncludeRaw,
 		}
-		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
-
-		// Test actual connectivity to Kafka brokers
-		err := common.TestKafkaConnection(out.kafkaCfg.Brokers, out.kafkaCfg.SASL, out.kafkaCfg.TLS)
 		if err != nil {
 			result["status"] = "error"
-			result["message"] = "Failed to connect to Kafka brokers"
+			result["message"] = "Failed to connect to central hub"
 			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
 			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
 				{"message": err.Error(), "severity": "error"},
 			}
 			return result
 		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully connected to central hub"
 
-		// Test if topic exists
-		topicExists, err := common.TestKafkaTopicExists(out.kafkaCfg.Brokers, out.kafkaCfg.Topic, out.kafkaCfg.SASL, out.kafkaCfg.TLS)
-		if err != nil {
-			result["status"] = "warning"
-			result["message"] = "Connected to Kafka but failed to verify topic"
-			result["details"].(map[string]interface{})["connection_status"] = "connected_topic_unknown"
-			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
-				{"message": fmt.Sprintf("Could not verify topic existence: %v", err), "severity": "warning"},
+		// Add producer metrics if available
+		if out.federationProducer != nil {
+			metrics := map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
 			}
-		} else if !topicExists {
-			result["status"] = "warning"
-			result["message"] = "Connected to Kafka but topic does not exist"
-			result["details"].(map[string]interface{})["connection_status"] = "connected_topic_missing"
-			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
-				{"message": fmt.Sprintf("Topic '%s' does not exist", out.kafkaCfg.Topic), "severity": "warning"},
+			for k, v := range out.federationProducer.GetStats() {
+				metrics[k] = v
 			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
 		} else {
-			result["details"].(map[string]interface{})["connection_status"] = "connected"
-			result["message"] = "Successfully connected to Kafka and verified topic"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
 		}
 
+	case OutputTypeMetrics:
+		if out.metricsCfg == nil {
+			result["status"] = "error"
+			result["message"] = "Metrics configuration missing"
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": "Metrics configuration is incomplete or missing", "severity": "error"},
+			}
+			return result
+		}
+
+		metricsCfg := out.metricsCfg.metricsConfig()
+		metricsCfg.HTTP = out.httpConfig()
+		names := make([]string, 0, len(metricsCfg.Series))
+		for _, s := range metricsCfg.Series {
+			names = append(names, s.Name)
+		}
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"protocol": metricsCfg.Protocol,
+			"endpoint": metricsCfg.Endpoint,
+			"metrics":  names,
+		}
+		if err := common.TestMetricsEndpoint(metricsCfg); err != nil {
+			result["status"] = "error"
+			result["message"] = "Failed to connect to metrics endpoint"
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
+		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = "Successfully connected to metrics endpoint"
+
 		// Add producer metrics if available
-		if out.kafkaProducer != nil {
-			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+		if out.metricsProducer != nil {
+			metrics := map[string]interface{}{
 				"produce_total":   out.GetProduceTotal(),
 				"producer_active": true,
 			}
+			for k, v := range out.metricsProducer.GetStats() {
+				metrics[k] = v
+			}
+			result["details"].(map[string]interface{})["metrics"] = metrics
 		} else {
 			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
 				"producer_active": false,
 			}
 		}
 
-	case OutputTypeElasticsearch:
-		if out.elasticsearchCfg == nil {
+	case OutputTypePostgres, OutputTypeMySQL:
+		if out.sqlCfg == nil {
 			result["status"] = "error"
-			result["message"] = "Elasticsearch configuration missing"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
 			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
 			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
-				{"message": "Elasticsearch configuration is incomplete or missing", "severity": "error"},
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
 			}
 			return result
 		}
 
-		// Set connection info
-		connectionInfo := map[string]interface{}{
-			"hosts": out.elasticsearchCfg.Hosts,
-			"index": out.elasticsearchCfg.Index,
+		// Set connection info (without sensitive credentials)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"host":     out.sqlCfg.Host,
+			"port":     out.sqlCfg.Port,
+			"database": out.sqlCfg.Database,
+			"table":    out.sqlCfg.Table,
+			"upsert":   out.sqlCfg.Upsert != nil,
 		}
-		result["details"].(map[string]interface{})["connection_info"] = connectionInfo
-
-		// Test actual connectivity to Elasticsearch cluster
-		err := common.TestElasticsearchConnection(out.elasticsearchCfg.Hosts, out.elasticsearchCfg.Auth)
-		if err != nil {
+		if err := common.TestSQLConnection(out.sqlCfg.sqlConfig(out.Type)); err != nil {
 			result["status"] = "error"
-			result["message"] = "Failed to connect to Elasticsearch cluster"
+			result["message"] = fmt.Sprintf("Failed to connect to %s or verify table", out.Type)
 			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
 			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
 				{"message": err.Error(), "severity": "error"},
 			}
 			return result
 		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Successfully connected to %s and verified table", out.Type)
 
-		// Test if index exists (this is optional for ES as indices can be auto-created)
-		indexExists, err := common.TestElasticsearchIndexExists(out.elasticsearchCfg.Hosts, out.elasticsearchCfg.Index, out.elasticsearchCfg.Auth)
-		if err != nil {
-			result["status"] = "warning"
-			result["message"] = "Connected to Elasticsearch but failed to verify index"
-			result["details"].(map[string]interface{})["connection_status"] = "connected_index_unknown"
-			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
-				{"message": fmt.Sprintf("Could not verify index existence: %v", err), "severity": "warning"},
-			}
-		} else if !indexExists {
-			result["status"] = "success" // This is OK for ES as indices can be auto-created
-			result["message"] = "Connected to Elasticsearch (index will be auto-created)"
-			result["details"].(map[string]interface{})["connection_status"] = "connected_index_will_be_created"
-			result["details"].(map[string]interface{})["connection_warnings"] = []map[string]interface{}{
-				{"message": fmt.Sprintf("Index '%s' does not exist but will be auto-created", out.elasticsearchCfg.Index), "severity": "info"},
+		// Add producer metrics if available
+		if out.sqlProducer != nil {
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"produce_total":   out.GetProduceTotal(),
+				"producer_active": true,
+				"rows_written":    out.sqlProducer.GetRowsWritten(),
+				"rows_failed":     out.sqlProducer.GetRowsFailed(),
+				"failed_batches":  out.sqlProducer.GetFailedBatches(),
 			}
 		} else {
-			result["details"].(map[string]interface{})["connection_status"] = "connected"
-			result["message"] = "Successfully connected to Elasticsearch and verified index"
+			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
+				"producer_active": false,
+			}
 		}
 
-		// Get cluster info for additional details
-		clusterInfo, err := common.GetElasticsearchClusterInfo(out.elasticsearchCfg.Hosts, out.elasticsearchCfg.Auth)
+	case OutputTypeSnowflake, OutputTypeBigQuery:
+		if out.warehouseCfg == nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("%s configuration missing", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "not_configured"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": fmt.Sprintf("%s configuration is incomplete or missing", out.Type), "severity": "error"},
+			}
+			return result
+		}
+
+		// Set connection info (without sensitive credentials)
+		result["details"].(map[string]interface{})["connection_info"] = map[string]interface{}{
+			"table":        out.warehouseCfg.Table,
+			"account":      out.warehouseCfg.Account,
+			"create_table": out.warehouseCfg.CreateTable,
+		}
+		whCfg, err := out.warehouseCfg.warehouseConfig(out.Type, out.Id)
 		if err == nil {
-			result["details"].(map[string]interface{})["cluster_info"] = clusterInfo
+			err = common.TestWarehouseConnection(whCfg)
+		}
+		if err != nil {
+			result["status"] = "error"
+			result["message"] = fmt.Sprintf("Failed to connect to %s or verify table", out.Type)
+			result["details"].(map[string]interface{})["connection_status"] = "connection_failed"
+			result["details"].(map[string]interface{})["connection_errors"] = []map[string]interface{}{
+				{"message": err.Error(), "severity": "error"},
+			}
+			return result
 		}
+		result["details"].(map[string]interface{})["connection_status"] = "connected"
+		result["message"] = fmt.Sprintf("Successfully connected to %s and verified table", out.Type)
 
 		// Add producer metrics if available
-		if out.elasticsearchProducer != nil {
+		if out.warehouseProducer != nil {
 			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
 				"produce_total":   out.GetProduceTotal(),
 				"producer_active": true,
-				"batch_size":      out.elasticsearchCfg.BatchSize,
+				"rows_written":    out.warehouseProducer.GetRowsWritten(),
+				"rows_rejected":   out.warehouseProducer.GetRowsRejected(),
+				"failed_batches":  out.warehouseProducer.GetFailedBatches(),
 			}
 		} else {
 			result["details"].(map[string]interface{})["metrics"] = map[string]interface{}{
@@ -1043,6 +3511,9 @@ func (out *Output) CheckConnectivity() map[string]interface{} {
 			}
 		}
 
+	case OutputTypeRouter:
+		out.routerConnectivity(result)
+
 	case OutputTypePrint:
 		// Print output doesn't require external connectivity testing
 		result["status"] = "success"
@@ -1173,7 +3644,22 @@ func NewFromExisting(existing *Output, newProjectNodeSequence string) (*Output,
 		kafkaCfg:            existing.kafkaCfg,
 		elasticsearchCfg:    existing.elasticsearchCfg,
 		aliyunSLSCfg:        existing.aliyunSLSCfg,
+		objectStorageCfg:    existing.objectStorageCfg,
+		clickhouseCfg:       existing.clickhouseCfg,
+		incidentCfg:         existing.incidentCfg,
+		azureSecurityCfg:    existing.azureSecurityCfg,
+		chatCfg:             existing.chatCfg,
+		webhookCfg:          existing.webhookCfg,
+		smtpCfg:             existing.smtpCfg,
+		ticketCfg:           existing.ticketCfg,
+		federationCfg:       existing.federationCfg,
+		metricsCfg:          existing.metricsCfg,
+		sqlCfg:              existing.sqlCfg,
+		warehouseCfg:        existing.warehouseCfg,
+		routerCfg:           existing.routerCfg,
+		projection:          existing.projection,
 		Config:              existing.Config,
+		receipts:            common.NewDeliveryReceipts(),
 		Status:              common.StatusStopped, // Initialize status to stopped
 		TestCollectionChan:  nil,                  // Reset for new instance
 	}
@@ -1188,7 +3674,8 @@ func NewFromExisting(existing *Output, newProjectNodeSequence string) (*Output,
 
 // SetTestMode configures the output for test mode by disabling sampling and other global state interactions
 func (out *Output) SetTestMode() {
-	out.sampler = nil // Disable sampling for test instances
+	out.sampler = nil  // Disable sampling for test instances
+	out.receipts = nil // Test traffic must not show up in delivery reconciliation
 }
 
 // GetPendingMessageCount returns the total number of pending messages in all channels
@@ -1203,16 +3690,75 @@ func (out *Output) GetPendingMessageCount() int {
 		}
 	}
 
+	// Events held back by the rate limit
+	pendingCount += out.throttle.Pending()
+
 	// Check internal producer channels based on output type
 	switch out.Type {
 	case OutputTypeKafka, OutputTypeKafkaAzure, OutputTypeKafkaAWS:
 		if out.kafkaProducer != nil && out.kafkaProducer.MsgChan != nil {
 			pendingCount += len(out.kafkaProducer.MsgChan)
 		}
+		if out.kafkaProducer != nil {
+			pendingCount += len(out.kafkaProducer.PriorityChan)
+		}
 	case OutputTypeElasticsearch:
 		if out.elasticsearchProducer != nil && out.elasticsearchProducer.MsgChan != nil {
 			pendingCount += len(out.elasticsearchProducer.MsgChan)
 		}
+		if out.elasticsearchProducer != nil {
+			pendingCount += len(out.elasticsearchProducer.PriorityChan)
+		}
+	case OutputTypeS3, OutputTypeGCS, OutputTypeAzureBlob:
+		if out.objectStoreProducer != nil && out.objectStoreProducer.MsgChan != nil {
+			pendingCount += len(out.objectStoreProducer.MsgChan)
+		}
+	case OutputTypeClickHouse:
+		if out.clickhouseProducer != nil && out.clickhouseProducer.MsgChan != nil {
+			pendingCount += len(out.clickhouseProducer.MsgChan)
+		}
+	case OutputTypePagerDuty, OutputTypeOpsgenie:
+		if out.incidentProducer != nil && out.incidentProducer.MsgChan != nil {
+			pendingCount += len(out.incidentProducer.MsgChan)
+		}
+	case OutputTypeSentinel, OutputTypeGraphSecurity:
+		if out.azureSecurityProducer != nil && out.azureSecurityProducer.MsgChan != nil {
+			pendingCount += len(out.azureSecurityProducer.MsgChan)
+		}
+	case OutputTypeSlack, OutputTypeTeams, OutputTypeDingTalk:
+		if out.chatProducer != nil && out.chatProducer.MsgChan != nil {
+			pendingCount += len(out.chatProducer.MsgChan)
+		}
+	case OutputTypeWebhook:
+		if out.webhookProducer != nil && out.webhookProducer.MsgChan != nil {
+			pendingCount += len(out.webhookProducer.MsgChan)
+		}
+	case OutputTypeSMTP:
+		if out.smtpProducer != nil && out.smtpProducer.MsgChan != nil {
+			pendingCount += len(out.smtpProducer.MsgChan)
+		}
+	case OutputTypeJira, OutputTypeTheHive, OutputTypeServiceNow:
+		if out.ticketProducer != nil && out.ticketProducer.MsgChan != nil {
+			pendingCount += len(out.ticketProducer.MsgChan)
+		}
+	case OutputTypeFederation:
+		if out.federationProducer != nil && out.federationProducer.MsgChan != nil {
+			pendingCount += len(out.federationProducer.MsgChan)
+		}
+	case OutputTypeMetrics:
+		if out.metricsProducer != nil && out.metricsProducer.MsgChan != nil {
+			pendingCount += len(out.metricsProducer.MsgChan)
+		}
+	case OutputTypePostgres, OutputTypeMySQL:
+		if out.sqlProducer != nil && out.sqlProducer.MsgChan != nil {
+			pendingCount += len(out.sqlProducer.MsgChan)
+		}
+	case OutputTypeSnowflake, OutputTypeBigQuery:
+		if out.warehouseProducer != nil && out.warehouseProducer.MsgChan != nil {
+			pendingCount += len(out.warehouseProducer.MsgChan)
+		}
+	case OutputTypeRouter:
+		pendingCount += out.routerPendingCount()
 	}
 
 	return pendingCount
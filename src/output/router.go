@@ -0,0 +1,257 @@
+package output
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// componentResolver looks up an output component by id, set by the project package
+var componentResolver func(id string) (*Output, bool)
+
+// SetComponentResolver sets the function used by router outputs to find their child outputs
+func SetComponentResolver(fn func(id string) (*Output, bool)) {
+	componentResolver = fn
+}
+
+// resolveRouterChild returns the output component a router sends to
+func resolveRouterChild(id string) (*Output, error) {
+	if componentResolver == nil {
+		return nil, fmt.Errorf("output resolver is not set")
+	}
+	child, ok := componentResolver(id)
+	if !ok || child == nil {
+		return nil, fmt.Errorf("output %s not found", id)
+	}
+	if child.Type == OutputTypeRouter {
+		return nil, fmt.Errorf("output %s is a router, routers cannot be nested", id)
+	}
+	return child, nil
+}
+
+// startRouter starts one instance of every child output and the goroutine routing events to them.
+// Children share the delivery receipts of the router, so reconciliation counts one delivery per child.
+func (out *Output) startRouter(hasTestCollector bool) error {
+	if out.routerChildren != nil {
+		return fmt.Errorf("router already running for output %s", out.Id)
+	}
+	router, err := common.NewOutputRouter(out.routerCfg)
+	if err != nil {
+		return fmt.Errorf("invalid router config for output %s: %v", out.Id, err)
+	}
+
+	children := make(map[string]*Output, len(router.Outputs()))
+	chans := make(map[string]chan map[string]interface{}, len(router.Outputs()))
+	stopStarted := func() {
+		for _, child := range children {
+			_ = child.Stop()
+		}
+	}
+	for _, id := range router.Outputs() {
+		comp, err := resolveRouterChild(id)
+		if err != nil {
+			stopStarted()
+			return fmt.Errorf("router output %s: %v", out.Id, err)
+		}
+		child, err := NewFromExisting(comp, out.ProjectNodeSequence+".OUTPUT."+id)
+		if err != nil {
+			stopStarted()
+			return fmt.Errorf("router output %s: failed to create child %s: %v", out.Id, id, err)
+		}
+		child.ProjectID = out.ProjectID
+		child.receipts = out.receipts
+		c := make(chan map[string]interface{}, 1024)
+		child.UpStream[out.ProjectNodeSequence] = &c
+		if err := child.Start(); err != nil {
+			stopStarted()
+			return fmt.Errorf("router output %s: failed to start child %s: %v", out.Id, id, err)
+		}
+		children[id] = child
+		chans[id] = c
+	}
+	out.router = router
+	out.routerChildren = children
+	out.routerChans = chans
+	atomic.StoreUint64(&out.routerUnmatched, 0)
+
+	if out.stopChan == nil {
+		out.stopChan = make(chan struct{})
+	}
+
+	out.wg.Add(1)
+	go func() {
+		defer out.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in router output goroutine", "output", out.Id, "panic", r)
+			}
+		}()
+
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-out.stopChan:
+				logger.Debug("Router output goroutine received stop signal", "id", out.Id)
+				return
+			case <-ticker.C:
+				for _, up := range out.UpStream {
+					select {
+					case <-out.stopChan:
+						return
+					default:
+					}
+
+					select {
+					case msg, ok := <-*up:
+						if !ok {
+							continue
+						}
+						if out.consumeCanary(msg) {
+							continue
+						}
+
+						atomic.AddUint64(&out.produceTotal, 1)
+						if out.sampler != nil {
+							out.sampler.Sample(msg, out.ProjectNodeSequence)
+						}
+
+						if hasTestCollector {
+							select {
+							case *out.TestCollectionChan <- out.enhanceMessageWithProjectNodeSequence(msg):
+							default:
+								logger.Warn("Test collection channel full, dropping message", "id", out.Id, "type", out.Type)
+							}
+						}
+
+						// Every child holds a reference to the checkpoint token, unmatched events end here
+						token := common.GetDeliveryToken(msg)
+						targets := router.Match(msg)
+						if len(targets) == 0 {
+							atomic.AddUint64(&out.routerUnmatched, 1)
+							token.Release()
+							continue
+						}
+						// Children copy the event before changing it, so it can be shared
+						for _, id := range targets {
+							token.Retain()
+							select {
+							case chans[id] <- msg:
+							default:
+								logger.Warn("Router child channel full, dropping message", "id", out.Id, "child", id)
+								out.receipts.AddMatched(1)
+								out.receipts.AddDropped(1)
+								token.Fail()
+							}
+						}
+						token.Release()
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// stopRouterChildren gives the children a few seconds to take the routed events and stops them
+func (out *Output) stopRouterChildren() {
+	if out.routerChildren == nil {
+		return
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for id, child := range out.routerChildren {
+		for len(out.routerChans[id]) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := child.Stop(); err != nil {
+			logger.Warn("Failed to stop router child output", "id", out.Id, "child", id, "error", err)
+		}
+	}
+	out.routerChildren = nil
+	out.routerChans = nil
+}
+
+// routerConnectivity checks the child outputs of a router, running children report their live state
+func (out *Output) routerConnectivity(result map[string]interface{}) {
+	details := result["details"].(map[string]interface{})
+	router, err := common.NewOutputRouter(out.routerCfg)
+	if err != nil {
+		result["status"] = "error"
+		result["message"] = "Router configuration invalid"
+		details["connection_status"] = "not_configured"
+		details["connection_errors"] = []map[string]interface{}{
+			{"message": err.Error(), "severity": "error"},
+		}
+		return
+	}
+
+	errs := []map[string]interface{}{}
+	warnings := []map[string]interface{}{}
+	children := map[string]interface{}{}
+	for _, id := range router.Outputs() {
+		child := out.routerChildren[id]
+		if child == nil {
+			comp, err := resolveRouterChild(id)
+			if err != nil {
+				errs = append(errs, map[string]interface{}{"message": err.Error(), "severity": "error"})
+				continue
+			}
+			child = comp
+		}
+		childResult := child.CheckConnectivity()
+		children[id] = childResult
+		switch childResult["status"] {
+		case "error":
+			errs = append(errs, map[string]interface{}{"message": fmt.Sprintf("output %s: %v", id, childResult["message"]), "severity": "error"})
+		case "warning":
+			warnings = append(warnings, map[string]interface{}{"message": fmt.Sprintf("output %s: %v", id, childResult["message"]), "severity": "warning"})
+		}
+	}
+
+	details["connection_info"] = map[string]interface{}{
+		"mode":    out.routerCfg.Mode,
+		"routes":  len(out.routerCfg.Routes),
+		"outputs": router.Outputs(),
+	}
+	details["children"] = children
+	details["connection_errors"] = errs
+	details["connection_warnings"] = warnings
+	if len(errs) > 0 {
+		result["status"] = "error"
+		result["message"] = "One or more router child outputs failed the connection check"
+		details["connection_status"] = "connection_failed"
+		return
+	}
+	if len(warnings) > 0 {
+		result["status"] = "warning"
+		result["message"] = "Router child outputs connected with warnings"
+	} else {
+		result["message"] = "All router child outputs connected"
+	}
+	details["connection_status"] = "connected"
+
+	if out.routerChildren != nil {
+		details["metrics"] = map[string]interface{}{
+			"produce_total":   out.GetProduceTotal(),
+			"producer_active": true,
+			"unmatched":       atomic.LoadUint64(&out.routerUnmatched),
+		}
+	} else {
+		details["metrics"] = map[string]interface{}{
+			"producer_active": false,
+		}
+	}
+}
+
+// routerPendingCount returns the events waiting in the children of a router
+func (out *Output) routerPendingCount() int {
+	pending := 0
+	for _, child := range out.routerChildren {
+		pending += child.GetPendingMessageCount()
+	}
+	return pending
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unmarshalConfig decodes an output config, replacing the ${secret:...} references of its values
+// by the secrets. Values are resolved after parsing so a secret cannot change the YAML structure,
+// and the resolved values never reach RawConfig.
+func unmarshalConfig(data []byte, cfg *OutputConfig) error {
+	return decodeConfig(data, cfg, resolveNodeSecrets)
+}
+
+// verifyConfig decodes an output config like unmarshalConfig but keeps the ${secret:...}
+// references, only their syntax is checked, so verifying a config never calls a secrets provider
+func verifyConfig(data []byte, cfg *OutputConfig) error {
+	return decodeConfig(data, cfg, checkNodeSecrets)
+}
+
+// decodeConfig decodes an output config after passing every scalar referencing a secret to visit
+func decodeConfig(data []byte, cfg *OutputConfig, visit func(n *yaml.Node) error) error {
+	if !common.HasSecretRefs(string(data)) {
+		return yaml.Unmarshal(data, cfg)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if err := walkNodeSecrets(&root, visit); err != nil {
+		return err
+	}
+	return root.Decode(cfg)
+}
+
+func walkNodeSecrets(n *yaml.Node, visit func(n *yaml.Node) error) error {
+	if n.Kind == yaml.ScalarNode {
+		if !common.HasSecretRefs(n.Value) {
+			return nil
+		}
+		return visit(n)
+	}
+	for _, c := range n.Content {
+		if err := walkNodeSecrets(c, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveNodeSecrets(n *yaml.Node) error {
+	value, err := common.ResolveSecretRefs(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	n.Value = value
+	// A resolved value keeps its string type, e.g. a numeric password
+	n.Tag = "!!str"
+	return nil
+}
+
+// checkNodeSecrets rejects a value where a ${secret: does not start a complete reference
+func checkNodeSecrets(n *yaml.Node) error {
+	if strings.Count(n.Value, "${secret:") != len(common.SecretRefPattern.FindAllString(n.Value, -1)) {
+		return fmt.Errorf("line %d: malformed secret reference, expected ${secret:<name>}", n.Line)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPluginMaxViolations = 5
+	defaultPluginCooldown      = time.Minute
+	pluginMemoryCheckInterval  = time.Second
+)
+
+// errPluginTimeout is wrapped by the errors of calls that exceeded their timeout, as
+// "plugin <name> exceeded its timeout of <timeout>"
+var errPluginTimeout = errors.New("exceeded its timeout")
+
+// States of a call run by runLimited in its own goroutine
+const (
+	callRunning int32 = iota
+	callReturned
+	callTimedOut
+)
+
+// pluginLimits are the execution budgets of a user plugin
+type pluginLimits struct {
+	timeout        time.Duration
+	maxMemory      int64
+	maxConcurrency int64
+	maxViolations  int64
+	cooldown       time.Duration
+}
+
+// PluginHealth is the state of the execution budgets of a plugin
+type PluginHealth struct {
+	Plugin                string     `json:"plugin"`
+	Healthy               bool       `json:"healthy"`
+	UnhealthyUntil        *time.Time `json:"unhealthy_until,omitempty"`
+	InFlight              int64      `json:"in_flight"`
+	TimedOutRunning       int64      `json:"timed_out_running"`
+	ConsecutiveViolations int64      `json:"consecutive_violations"`
+	Violations            uint64     `json:"violations"`
+	Rejected              uint64     `json:"rejected"`
+	LastViolation         string     `json:"last_violation,omitempty"`
+	Timeout               string     `json:"timeout,omitempty"`
+	MaxMemory             int64      `json:"max_memory,omitempty"`
+	MaxConcurrency        int64      `json:"max_concurrency,omitempty"`
+}
+
+type limitedResult struct {
+	res interface{}
+	ok  bool
+	err error
+}
+
+// parseMemorySize parses a size such as 512MB, a plain number is bytes
+func parseMemorySize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSuffix(upper, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory size '%s', expected e.g. 256MB", s)
+	}
+	return n * mult, nil
+}
+
+// parseLimits returns the budgets of a plugin from the plugin_limits defaults and the directives
+// of its source, nil when it has none
+func parseLimits(source, runtime string) (*pluginLimits, error) {
+	directives, err := parseDirectives(source)
+	if err != nil {
+		return nil, err
+	}
+	l := &pluginLimits{maxViolations: defaultPluginMaxViolations, cooldown: defaultPluginCooldown}
+	memory := ""
+	if cfg := common.Config; cfg != nil && cfg.PluginLimits != nil {
+		d := cfg.PluginLimits
+		l.timeout, memory, l.maxConcurrency = d.Timeout, d.MaxMemory, int64(d.MaxConcurrency)
+		if d.MaxViolations > 0 {
+			l.maxViolations = int64(d.MaxViolations)
+		}
+		if d.Cooldown > 0 {
+			l.cooldown = d.Cooldown
+		}
+	}
+
+	if v, ok := directives["timeout"]; ok {
+		if l.timeout, err = time.ParseDuration(v); err != nil || l.timeout <= 0 {
+			return nil, fmt.Errorf("invalid //hub:timeout '%s', expected a duration like 100ms", v)
+		}
+	}
+	if v, ok := directives["max_concurrency"]; ok {
+		if l.maxConcurrency, err = strconv.ParseInt(v, 10, 64); err != nil || l.maxConcurrency <= 0 {
+			return nil, fmt.Errorf("invalid //hub:max_concurrency '%s', expected a positive integer", v)
+		}
+	}
+	memoryEnforced := runtime == RuntimeProcess || runtime == RuntimeWasm
+	if v, ok := directives["max_memory"]; ok {
+		if !memoryEnforced {
+			return nil, fmt.Errorf("//hub:max_memory is only supported by plugins with the process or wasm runtime")
+		}
+		memory = v
+	}
+	// The default memory limit only applies where it can be enforced
+	if memory != "" && memoryEnforced {
+		if l.maxMemory, err = parseMemorySize(memory); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.timeout <= 0 && l.maxConcurrency <= 0 && l.maxMemory <= 0 {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// loadLimits sets the budgets of a user plugin. The memory limit is enforced by the process of a
+// process plugin and bounds the memory pages of a wasm plugin, whose calls are cancelled at the
+// timeout.
+func (p *Plugin) loadLimits() error {
+	limits, err := parseLimits(string(p.Payload), p.Runtime)
+	if err != nil {
+		return err
+	}
+	p.limits = limits
+	if limits == nil {
+		return nil
+	}
+	if p.process != nil {
+		p.process.maxMemory = limits.maxMemory
+		p.process.onViolation = p.recordViolation
+	}
+	if p.wasm != nil {
+		if limits.maxMemory > 0 {
+			// The page limit is set when the module is compiled
+			wasm, err := newWasmRuntime(p.Name, p.wasm.bin, limits.maxMemory)
+			if err != nil {
+				return err
+			}
+			p.wasm.close()
+			p.wasm = wasm
+		}
+		p.wasm.timeout = limits.timeout
+	}
+	return nil
+}
+
+// runLimited runs a call of the plugin within its budgets. A wasm call is cancelled at the
+// timeout and the process of a process plugin is killed, it restarts on the next call. A Yaegi or
+// native call cannot be stopped: it keeps running in its goroutine, and the plugin is unhealthy
+// and gets no calls until every timed-out call has returned.
+func (p *Plugin) runLimited(call func() limitedResult) limitedResult {
+	l := p.limits
+	if n := p.timedOutRunning.Load(); n > 0 {
+		p.RecordInvocation(false)
+		return limitedResult{err: fmt.Errorf("plugin %s is unhealthy, %d calls that exceeded the timeout are still running", p.Name, n)}
+	}
+	if until := p.unhealthyUntil.Load(); until != 0 && time.Now().UnixNano() < until {
+		p.RecordInvocation(false)
+		return limitedResult{err: fmt.Errorf("plugin %s is unhealthy after %d consecutive limit violations", p.Name, l.maxViolations)}
+	}
+
+	// A burst over max_concurrency is shed, it says nothing about the health of the plugin
+	if n := p.inflight.Add(1); l.maxConcurrency > 0 && n > l.maxConcurrency {
+		p.inflight.Add(-1)
+		p.RecordInvocation(false)
+		p.rejected.Add(1)
+		return limitedResult{err: fmt.Errorf("plugin %s has %d calls running, the limit is %d", p.Name, n-1, l.maxConcurrency)}
+	}
+	if l.timeout <= 0 || p.wasm != nil {
+		res := call()
+		p.inflight.Add(-1)
+		if errors.Is(res.err, errPluginTimeout) {
+			p.recordViolation(res.err.Error())
+			return res
+		}
+		p.recordCompleted(res)
+		return res
+	}
+
+	var state atomic.Int32
+	done := make(chan limitedResult, 1)
+	go func() {
+		defer p.inflight.Add(-1)
+		res := call()
+		if !state.CompareAndSwap(callRunning, callReturned) {
+			if p.timedOutRunning.Add(-1) == 0 {
+				logger.Info("Timed-out plugin calls returned, the plugin gets calls again", "plugin", p.Name)
+			}
+			return
+		}
+		done <- res
+	}()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		p.recordCompleted(res)
+		return res
+	case <-timer.C:
+		if !state.CompareAndSwap(callRunning, callTimedOut) {
+			// The call returned as the timer fired
+			res := <-done
+			p.recordCompleted(res)
+			return res
+		}
+		if p.timedOutRunning.Add(1) == 1 {
+			logger.PluginError("plugin call exceeded its timeout, the plugin gets no calls until it returns",
+				"plugin", p.Name, "timeout", l.timeout)
+		}
+		if p.process != nil {
+			p.process.kill()
+		}
+		err := fmt.Errorf("plugin %s %w of %s", p.Name, errPluginTimeout, l.timeout)
+		p.recordViolation(err.Error())
+		return limitedResult{err: err}
+	}
+}
+
+// recordViolation counts a violation of the budgets, enough consecutive ones mark the plugin
+// unhealthy for the cooldown
+func (p *Plugin) recordViolation(reason string) {
+	p.violations.Add(1)
+	p.lastViolation.Store(&reason)
+	if p.consecutiveViolations.Add(1) < p.limits.maxViolations {
+		return
+	}
+	now := time.Now()
+	if prev := p.unhealthyUntil.Swap(now.Add(p.limits.cooldown).UnixNano()); prev < now.UnixNano() {
+		logger.PluginError("plugin marked unhealthy", "plugin", p.Name, "violations", p.consecutiveViolations.Load(),
+			"cooldown", p.limits.cooldown, "reason", reason)
+	}
+}
+
+// recordCompleted resets the violations once a call succeeds within the budgets. A call failing
+// because its process was killed for its memory does not.
+func (p *Plugin) recordCompleted(res limitedResult) {
+	if res.err == nil && p.consecutiveViolations.Load() != 0 {
+		p.consecutiveViolations.Store(0)
+		p.unhealthyUntil.Store(0)
+	}
+}
+
+// Health returns the state of the budgets of the plugin
+func (p *Plugin) Health() PluginHealth {
+	h := PluginHealth{
+		Plugin:                p.Name,
+		Healthy:               true,
+		InFlight:              p.inflight.Load(),
+		TimedOutRunning:       p.timedOutRunning.Load(),
+		ConsecutiveViolations: p.consecutiveViolations.Load(),
+		Violations:            p.violations.Load(),
+		Rejected:              p.rejected.Load(),
+	}
+	if reason := p.lastViolation.Load(); reason != nil {
+		h.LastViolation = *reason
+	}
+	if until := p.unhealthyUntil.Load(); until != 0 && time.Now().UnixNano() < until {
+		t := time.Unix(0, until)
+		h.Healthy = false
+		h.UnhealthyUntil = &t
+	}
+	if h.TimedOutRunning > 0 {
+		h.Healthy = false
+	}
+	if l := p.limits; l != nil {
+		if l.timeout > 0 {
+			h.Timeout = l.timeout.String()
+		}
+		h.MaxMemory = l.maxMemory
+		h.MaxConcurrency = l.maxConcurrency
+	}
+	return h
+}
+
+// PluginsHealth returns the budget state of the user plugins, sorted by name
+func PluginsHealth() []PluginHealth {
+	PluginsMu.RLock()
+	health := make([]PluginHealth, 0, len(Plugins))
+	for _, p := range Plugins {
+		if p.Type == YAEGI_PLUGIN {
+			health = append(health, p.Health())
+		}
+	}
+	PluginsMu.RUnlock()
+	sort.Slice(health, func(i, j int) bool { return health[i].Plugin < health[j].Plugin })
+	return health
+}
+
+// readProcessRSS returns the resident memory of a process in bytes, from /proc on Linux
+func readProcessRSS(pid int) (int64, bool) {
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if rest, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return 0, false
+			}
+			kb, err := strconv.ParseInt(fields[0], 10, 64)
+			return kb << 10, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sleepPluginSrc sleeps for the duration it is given
+const sleepPluginSrc = `package plugin
+
+import "time"
+
+func Eval(d string) (bool, error) {
+	t, err := time.ParseDuration(d)
+	if err != nil {
+		return false, err
+	}
+	time.Sleep(t)
+	return true, nil
+}
+`
+
+// loopWasm is echoWasm whose hub_eval loops forever
+var loopWasm = append(append([]byte{}, echoWasm[:len(echoWasm)-0x27]...),
+	0x0a, 0x0f, 0x02,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	// hub_eval: loop br 0 end unreachable
+	0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b,
+)
+
+// usePluginLimits sets the plugin_limits defaults
+func usePluginLimits(t *testing.T, limits common.PluginLimitsConfig) {
+	t.Helper()
+	saved := common.Config
+	cfg := common.HubConfig{}
+	if saved != nil {
+		cfg = *saved
+	}
+	cfg.PluginLimits = &limits
+	common.Config = &cfg
+	t.Cleanup(func() { common.Config = saved })
+}
+
+func newLimitedTestPlugin(t *testing.T, source string) *Plugin {
+	t.Helper()
+	p, err := NewTestPlugin("", source, "limited", YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadRuntime(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadLimits(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	usePluginLimits(t, common.PluginLimitsConfig{MaxMemory: "128MB"})
+	l, err := parseLimits("//hub:timeout 50ms\n//hub:max_concurrency 3\n", RuntimeYaegi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default memory limit cannot be enforced for Yaegi plugins
+	if l.timeout != 50*time.Millisecond || l.maxConcurrency != 3 || l.maxMemory != 0 {
+		t.Fatalf("limits = %+v", l)
+	}
+	if l, err := parseLimits("", RuntimeWasm); err != nil || l.maxMemory != 128<<20 {
+		t.Fatalf("wasm limits = %+v, %v", l, err)
+	}
+	for _, source := range []string{
+		"//hub:max_goroutines 3\n",
+		"//hub:max_concurrency 0\n",
+		"//hub:timeout soon\n",
+		"//hub:max_memory 64MB\n",
+	} {
+		if _, err := parseLimits(source, RuntimeYaegi); err == nil {
+			t.Errorf("%q accepted", source)
+		}
+	}
+}
+
+func TestRunLimitedTimeout(t *testing.T) {
+	p := newLimitedTestPlugin(t, "//hub:timeout 50ms\n"+sleepPluginSrc)
+	_, err := p.FuncEvalCheckNode("300ms")
+	if !errors.Is(err, errPluginTimeout) || !strings.Contains(err.Error(), "exceeded its timeout of 50ms") {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+
+	// The plugin gets no calls while the timed-out call is running
+	if h := p.Health(); h.Healthy || h.TimedOutRunning != 1 || h.Violations != 1 {
+		t.Fatalf("health after timeout = %+v", h)
+	}
+	if _, err := p.FuncEvalCheckNode("0s"); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Fatalf("call during the timed-out call: err = %v", err)
+	}
+
+	waitFor(t, "the timed-out call to return", func() bool { return p.timedOutRunning.Load() == 0 })
+	if ok, err := p.FuncEvalCheckNode("0s"); err != nil || !ok {
+		t.Fatalf("call after the timed-out call returned: ok=%v err=%v", ok, err)
+	}
+	if h := p.Health(); !h.Healthy || h.ConsecutiveViolations != 0 || h.InFlight != 0 {
+		t.Fatalf("health after success = %+v", h)
+	}
+}
+
+func TestRunLimitedConcurrency(t *testing.T) {
+	p := newLimitedTestPlugin(t, "//hub:max_concurrency 1\n"+sleepPluginSrc)
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.FuncEvalCheckNode("200ms")
+		done <- err
+	}()
+	waitFor(t, "the first call to start", func() bool { return p.inflight.Load() == 1 })
+
+	_, err := p.FuncEvalCheckNode("0s")
+	if err == nil || !strings.Contains(err.Error(), "1 calls running, the limit is 1") {
+		t.Fatalf("call over the limit: err = %v", err)
+	}
+	// Shed calls are counted apart and never mark the plugin unhealthy
+	for i := 0; i < defaultPluginMaxViolations; i++ {
+		if _, err := p.FuncEvalCheckNode("0s"); err == nil {
+			t.Fatal("call over the limit ran")
+		}
+	}
+	if h := p.Health(); h.Rejected != defaultPluginMaxViolations+1 || h.Violations != 0 || h.ConsecutiveViolations != 0 || !h.Healthy || h.MaxConcurrency != 1 {
+		t.Fatalf("health = %+v", h)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FuncEvalCheckNode("0s"); err != nil {
+		t.Fatalf("call after the first returned: %v", err)
+	}
+}
+
+func TestRunLimitedUnhealthy(t *testing.T) {
+	usePluginLimits(t, common.PluginLimitsConfig{MaxViolations: 2, Cooldown: 200 * time.Millisecond})
+	p := newLimitedTestPlugin(t, "//hub:timeout 20ms\n"+sleepPluginSrc)
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.FuncEvalCheckNode("60ms"); !errors.Is(err, errPluginTimeout) {
+			t.Fatalf("call %d: err = %v, want a timeout", i, err)
+		}
+		waitFor(t, "the timed-out call to return", func() bool { return p.timedOutRunning.Load() == 0 })
+	}
+
+	// Two consecutive violations mark the plugin unhealthy for the cooldown
+	h := p.Health()
+	if h.Healthy || h.UnhealthyUntil == nil || h.ConsecutiveViolations != 2 {
+		t.Fatalf("health after 2 violations = %+v", h)
+	}
+	if _, err := p.FuncEvalCheckNode("0s"); err == nil || !strings.Contains(err.Error(), "2 consecutive limit violations") {
+		t.Fatalf("call while unhealthy: err = %v", err)
+	}
+
+	waitFor(t, "the cooldown", func() bool { return p.Health().Healthy })
+	if ok, err := p.FuncEvalCheckNode("0s"); err != nil || !ok {
+		t.Fatalf("call after the cooldown: ok=%v err=%v", ok, err)
+	}
+	if h := p.Health(); !h.Healthy || h.ConsecutiveViolations != 0 || h.Violations != 2 {
+		t.Fatalf("health after success = %+v", h)
+	}
+}
+
+func TestWasmLimits(t *testing.T) {
+	dir := t.TempDir()
+	source := func(module []byte, directives string) string {
+		path := filepath.Join(dir, "module.wasm")
+		if err := os.WriteFile(path, module, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return "package plugin\n\n//hub:runtime wasm\n//hub:wasm " + path + "\n" + directives +
+			"\nfunc Eval(reply interface{}) (bool, error) {\n\treturn false, nil\n}\n"
+	}
+
+	// The timeout cancels the call, nothing keeps running
+	p := newLimitedTestPlugin(t, source(loopWasm, "//hub:timeout 50ms\n"))
+	t.Cleanup(p.wasm.close)
+	start := time.Now()
+	if _, err := p.FuncEvalCheckNode(map[string]interface{}{"ok": true}); !errors.Is(err, errPluginTimeout) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the call returned after %s", elapsed)
+	}
+	if h := p.Health(); h.TimedOutRunning != 0 || h.InFlight != 0 || h.Violations != 1 {
+		t.Fatalf("health after timeout = %+v", h)
+	}
+
+	// max_memory bounds the memory pages: echoWasm needs 1 page, 2 are too many for 64KB
+	p = newLimitedTestPlugin(t, source(echoWasm, "//hub:max_memory 64KB\n"))
+	t.Cleanup(p.wasm.close)
+	if ok, err := p.FuncEvalCheckNode(map[string]interface{}{"ok": true}); err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	twoPages := append([]byte{}, echoWasm...)
+	twoPages[31] = 0x02
+	p, err := NewTestPlugin("", source(twoPages, "//hub:max_memory 64KB\n"), "limited", YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadRuntime(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.wasm.close)
+	if err := p.loadLimits(); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Fatalf("a module needing 2 pages loaded with a limit of 1: err = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/plugin/symbols"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+var (
+	allowedPackagesMu sync.RWMutex
+	allowedPackages   = make(map[string]bool) // import paths of bundled packages plugins may import
+)
+
+// SetAllowedPackages sets the third-party packages plugins may import, from the packages bundled
+// with the hub. Plugins loaded from then on see the new list, running plugins keep theirs until
+// they are reloaded.
+func SetAllowedPackages(pkgs []string) error {
+	bundled := symbols.Packages()
+	allowed := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		if !slices.Contains(bundled, pkg) {
+			return fmt.Errorf("package %s is not bundled, available packages: %v", pkg, bundled)
+		}
+		allowed[pkg] = true
+	}
+	allowedPackagesMu.Lock()
+	allowedPackages = allowed
+	allowedPackagesMu.Unlock()
+	return nil
+}
+
+// AllowedPackages returns the third-party packages plugins may import, sorted
+func AllowedPackages() []string {
+	allowedPackagesMu.RLock()
+	defer allowedPackagesMu.RUnlock()
+	pkgs := make([]string, 0, len(allowedPackages))
+	for pkg := range allowedPackages {
+		pkgs = append(pkgs, pkg)
+	}
+	slices.Sort(pkgs)
+	return pkgs
+}
+
+func isAllowedPackage(pkg string) bool {
+	allowedPackagesMu.RLock()
+	defer allowedPackagesMu.RUnlock()
+	return allowedPackages[pkg]
+}
+
+// allowedSymbols returns the symbols of the allowed packages for interp.Use, without the hidden ones
+func allowedSymbols() map[string]map[string]reflect.Value {
+	allowedPackagesMu.RLock()
+	defer allowedPackagesMu.RUnlock()
+	syms := make(map[string]map[string]reflect.Value, len(allowedPackages))
+	for key, values := range symbols.Symbols {
+		if !allowedPackages[symbols.ImportPath(key)] {
+			continue
+		}
+		visible := make(map[string]reflect.Value, len(values))
+		for name, value := range values {
+			if !slices.Contains(symbols.Hidden[key], name) {
+				visible[name] = value
+			}
+		}
+		syms[key] = visible
+	}
+	return syms
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+const uuidPluginSrc = `package plugin
+
+import "github.com/google/uuid"
+
+func Eval(s string) (bool, error) {
+	_, err := uuid.Parse(s)
+	return err == nil, nil
+}
+`
+
+func setAllowedPackages(t *testing.T, pkgs ...string) {
+	t.Helper()
+	saved := AllowedPackages()
+	if err := SetAllowedPackages(pkgs); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = SetAllowedPackages(saved) })
+}
+
+func TestAllowedPackagesRejectsUnlisted(t *testing.T) {
+	setAllowedPackages(t)
+	if _, err := NewTestPlugin("", uuidPluginSrc, "uuid_unlisted", YAEGI_PLUGIN); err == nil || !strings.Contains(err.Error(), "plugin_packages") {
+		t.Fatalf("unlisted package: err = %v", err)
+	}
+
+	// Listing another bundled package does not allow this one
+	setAllowedPackages(t, "github.com/mssola/user_agent")
+	if _, err := NewTestPlugin("", uuidPluginSrc, "uuid_other", YAEGI_PLUGIN); err == nil || !strings.Contains(err.Error(), "github.com/google/uuid") {
+		t.Fatalf("package listed for another: err = %v", err)
+	}
+
+	setAllowedPackages(t, "github.com/google/uuid")
+	p, err := NewTestPlugin("", uuidPluginSrc, "uuid_listed", YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.FuncEvalCheckNode("5f0c7a4e-3c1d-4d0e-9a59-7d5b1c8f2e01"); err != nil || !ok {
+		t.Fatalf("listed package: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSetAllowedPackagesRejectsUnbundled(t *testing.T) {
+	setAllowedPackages(t, "github.com/google/uuid")
+	if err := SetAllowedPackages([]string{"github.com/google/uuid", "os/exec/extra"}); err == nil {
+		t.Fatal("unbundled package accepted")
+	}
+	// The list in use is kept
+	if got := AllowedPackages(); len(got) != 1 || got[0] != "github.com/google/uuid" {
+		t.Fatalf("allowed packages = %v", got)
+	}
+}
+
+func TestAllowedPackagesHideProcessState(t *testing.T) {
+	setAllowedPackages(t, "github.com/google/uuid")
+	for _, name := range []string{"SetRand", "SetNodeID"} {
+		src := strings.Replace(uuidPluginSrc, "_, err := uuid.Parse(s)", "uuid."+name+"(nil)\n\tvar err error", 1)
+		if _, err := NewTestPlugin("", src, "uuid_"+name, YAEGI_PLUGIN); err == nil {
+			t.Errorf("plugin calling uuid.%s loaded", name)
+		}
+	}
+	syms := allowedSymbols()["github.com/google/uuid/uuid"]
+	if _, ok := syms["New"]; !ok {
+		t.Fatal("uuid.New is not exported")
+	}
+	for _, name := range []string{"SetRand", "SetNodeID", "SetClockSequence", "SetNodeInterface"} {
+		if _, ok := syms[name]; ok {
+			t.Errorf("uuid.%s is exported", name)
+		}
+	}
+}
@@ -36,6 +36,21 @@ type Plugin struct {
 	// 1 yaegi
 	Type int
 
+	// Runtime of a yaegi plugin: yaegi, native, process or wasm, see loadRuntime
+	Runtime string `json:"runtime,omitempty"`
+	process *processRuntime
+	wasm    *wasmRuntime
+
+	// Execution budgets, nil when the plugin has none, see runLimited
+	limits                *pluginLimits
+	inflight              atomic.Int64
+	timedOutRunning       atomic.Int64 // calls past their timeout that have not returned
+	consecutiveViolations atomic.Int64
+	violations            atomic.Uint64
+	rejected              atomic.Uint64 // calls shed over max_concurrency, not violations
+	lastViolation         atomic.Pointer[string]
+	unhealthyUntil        atomic.Int64 // unix nanoseconds
+
 	// Function parameter information for autocomplete
 	Parameters []PluginParameter `json:"parameters"`
 
@@ -154,9 +169,23 @@ func NewPlugin(path string, raw string, name string, pluginType int) error {
 		return fmt.Errorf("plugin yaegi load err %s: %w", name, err)
 	}
 
+	err = p.loadRuntime()
+	if err != nil {
+		return fmt.Errorf("plugin runtime load err %s: %w", name, err)
+	}
+
+	err = p.loadLimits()
+	if err != nil {
+		return fmt.Errorf("plugin limits err %s: %w", name, err)
+	}
+
 	PluginsMu.Lock()
+	old := Plugins[p.Name]
 	Plugins[p.Name] = p
 	PluginsMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
 	return nil
 }
 
@@ -195,7 +224,19 @@ func (p *Plugin) yaegiLoad() error {
 		return err
 	}
 
-	_, err = p.yaegiIntp.Eval(string(p.Payload))
+	if err := p.yaegiIntp.Use(allowedSymbols()); err != nil {
+		return err
+	}
+
+	if err := p.yaegiIntp.Use(kvSymbols(p.Name)); err != nil {
+		return err
+	}
+
+	source, err := resolveSourceSecrets(string(p.Payload))
+	if err != nil {
+		return err
+	}
+	_, err = p.yaegiIntp.Eval(source)
 	if err != nil {
 		return err
 	}
@@ -392,6 +433,17 @@ func (p *Plugin) formatTypeString(t reflect.Type) string {
 }
 
 func (p *Plugin) FuncEvalCheckNode(funcArgs ...interface{}) (bool, error) {
+	if p.limits == nil {
+		return p.funcEvalCheckNode(funcArgs...)
+	}
+	res := p.runLimited(func() limitedResult {
+		ok, err := p.funcEvalCheckNode(funcArgs...)
+		return limitedResult{ok: ok, err: err}
+	})
+	return res.ok, res.err
+}
+
+func (p *Plugin) funcEvalCheckNode(funcArgs ...interface{}) (bool, error) {
 	var realArgs []reflect.Value
 
 	switch p.Type {
@@ -486,6 +538,17 @@ func (p *Plugin) FuncEvalCheckNode(funcArgs ...interface{}) (bool, error) {
 }
 
 func (p *Plugin) FuncEvalOther(funcArgs ...interface{}) (interface{}, bool, error) {
+	if p.limits == nil {
+		return p.funcEvalOther(funcArgs...)
+	}
+	res := p.runLimited(func() limitedResult {
+		r, ok, err := p.funcEvalOther(funcArgs...)
+		return limitedResult{res: r, ok: ok, err: err}
+	})
+	return res.res, res.ok, res.err
+}
+
+func (p *Plugin) funcEvalOther(funcArgs ...interface{}) (interface{}, bool, error) {
 	var realArgs []reflect.Value
 
 	switch p.Type {
@@ -620,12 +683,24 @@ func validatePluginCode(source string) error {
 		return fmt.Errorf("plugin must contain an 'Eval' function")
 	}
 
-	// 3. Check imports - only allow Go standard library
+	runtime, err := parseRuntime(source)
+	if err != nil {
+		return err
+	}
+	if _, err := parseLimits(source, runtime); err != nil {
+		return err
+	}
+
+	// 3. Check imports - only allow Go standard library, plugin_kv and the packages of
+	// plugin_packages, compiled plugins are built without them
 	for _, importSpec := range file.Imports {
 		if importSpec.Path != nil {
 			importPath := strings.Trim(importSpec.Path.Value, `"`)
-			if !isStandardLibraryPackage(importPath) {
-				return fmt.Errorf("plugin can only import Go standard library packages, found external package: %s", importPath)
+			if runtime != RuntimeYaegi && !isStandardLibraryPackage(importPath) {
+				return fmt.Errorf("plugins with the %s runtime can only import Go standard library packages, found external package: %s", runtime, importPath)
+			}
+			if !isStandardLibraryPackage(importPath) && importPath != PluginKVPackage && !isAllowedPackage(importPath) {
+				return fmt.Errorf("plugin can only import Go standard library packages and packages allowed by plugin_packages, found external package: %s", importPath)
 			}
 		}
 	}
@@ -870,6 +945,7 @@ func SafeDeletePlugin(id string) ([]string, error) {
 	}
 
 	// Remove from global mappings
+	Plugins[id].Close()
 	delete(Plugins, id)
 	delete(PluginsNew, id)
 	common.DeleteRawConfigUnsafe("plugin", id)
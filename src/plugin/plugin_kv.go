@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"reflect"
+	"time"
+)
+
+// PluginKVPackage is the import path of the key-value store of Yaegi plugins
+const PluginKVPackage = "plugin_kv"
+
+// kvSymbols returns the plugin_kv package of a plugin. Its keys are namespaced by the plugin
+// name, so plugins do not see each other's state.
+func kvSymbols(namespace string) map[string]map[string]reflect.Value {
+	return map[string]map[string]reflect.Value{
+		PluginKVPackage + "/" + PluginKVPackage: {
+			"Get": reflect.ValueOf(func(key string) (string, bool, error) {
+				return common.PluginKVGet(namespace, key)
+			}),
+			"Set": reflect.ValueOf(func(key, value string, ttl time.Duration) error {
+				return common.PluginKVSet(namespace, key, value, ttl)
+			}),
+			"Incr": reflect.ValueOf(func(key string, delta int64, ttl time.Duration) (int64, error) {
+				return common.PluginKVIncr(namespace, key, delta, ttl)
+			}),
+			"Delete": reflect.ValueOf(func(key string) error {
+				return common.PluginKVDelete(namespace, key)
+			}),
+		},
+	}
+}
@@ -0,0 +1,653 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goplugin "plugin"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtimes of a plugin, selected by a //hub:runtime directive in its source
+const (
+	RuntimeYaegi   = "yaegi"   // interpreted, the default
+	RuntimeNative  = "native"  // compiled with -buildmode=plugin and loaded into the hub
+	RuntimeProcess = "process" // compiled to an executable the hub calls over JSON-RPC
+)
+
+const (
+	defaultPluginBuildTimeout = 2 * time.Minute
+	// an event may still be evaluated by the process of a replaced plugin
+	pluginProcessCloseDelay = 5 * time.Second
+)
+
+var (
+	directivePattern = regexp.MustCompile(`(?m)^//\s*hub:(\w+)\s+(\S+)\s*$`)
+	packageClause    = regexp.MustCompile(`(?m)^package\s+plugin\b`)
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+	pluginBuildMu    sync.Mutex
+
+	// privateBuildDir is the build cache of this process when plugin_build.dir is not set
+	privateBuildDir    string
+	privateBuildDirErr error
+	privateBuildOnce   sync.Once
+
+	// toolchainErr is set by CheckToolchain when no Go toolchain can build compiled plugins
+	toolchainErr error
+)
+
+// parseDirectives returns the //hub:<name> <value> directives of a plugin source by name
+func parseDirectives(source string) (map[string]string, error) {
+	directives := make(map[string]string)
+	for _, m := range directivePattern.FindAllStringSubmatch(source, -1) {
+		switch m[1] {
+		case "runtime", "wasm", "timeout", "max_memory", "max_concurrency":
+		default:
+			return nil, fmt.Errorf("unknown plugin directive '//hub:%s'", m[1])
+		}
+		if _, ok := directives[m[1]]; ok {
+			return nil, fmt.Errorf("plugin directive '//hub:%s' is set twice", m[1])
+		}
+		directives[m[1]] = m[2]
+	}
+	return directives, nil
+}
+
+// parseRuntime returns the runtime selected by the //hub:runtime directive of a plugin source
+func parseRuntime(source string) (string, error) {
+	directives, err := parseDirectives(source)
+	if err != nil {
+		return "", err
+	}
+	switch runtime := directives["runtime"]; runtime {
+	case "":
+		return RuntimeYaegi, nil
+	case RuntimeYaegi, RuntimeNative, RuntimeProcess, RuntimeWasm:
+		return runtime, nil
+	default:
+		return "", fmt.Errorf("unknown plugin runtime '%s', expected yaegi, native, process or wasm", runtime)
+	}
+}
+
+// loadRuntime replaces the Yaegi function of a plugin by its compiled version when its source
+// selects the native, process or wasm runtime. The Yaegi load has already checked the signature.
+func (p *Plugin) loadRuntime() error {
+	runtime, err := parseRuntime(string(p.Payload))
+	if err != nil {
+		return err
+	}
+	p.Runtime = runtime
+	switch runtime {
+	case RuntimeYaegi:
+		return nil
+	case RuntimeWasm:
+		// The Go source only declares the signature, the module is built by its own toolchain
+		path, err := wasmModulePath(string(p.Payload))
+		if err != nil {
+			return err
+		}
+		bin, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read wasm module: %w", err)
+		}
+		p.wasm, err = newWasmRuntime(p.Name, bin, 0)
+		if err != nil {
+			return err
+		}
+		p.f = makeRemoteFunc(p.f.Type(), func(args []interface{}) (processReply, error) {
+			return p.wasm.call(context.Background(), args)
+		})
+		return nil
+	}
+
+	// The secrets are passed to the loaded plugin, they are not compiled into it
+	source, secrets, err := rewriteSourceSecrets(string(p.Payload))
+	if err != nil {
+		return err
+	}
+	bin, err := buildPlugin(p.Name, source, runtime)
+	if err != nil {
+		return err
+	}
+	switch runtime {
+	case RuntimeNative:
+		so, err := goplugin.Open(bin)
+		if err != nil {
+			return fmt.Errorf("failed to open native plugin, it must be built by the Go version and with the same settings as the hub: %w", err)
+		}
+		if len(secrets) > 0 {
+			sym, err := so.Lookup("HubSetSecrets")
+			if err != nil {
+				return err
+			}
+			setSecrets, ok := sym.(func(map[string]string))
+			if !ok {
+				return fmt.Errorf("native plugin HubSetSecrets has type %T", sym)
+			}
+			setSecrets(secrets)
+		}
+		sym, err := so.Lookup("Eval")
+		if err != nil {
+			return err
+		}
+		p.f = reflect.ValueOf(sym)
+		return p.validateFunctionSignature()
+	case RuntimeProcess:
+		p.process = &processRuntime{name: p.Name, bin: bin, secrets: secrets}
+		p.f = makeRemoteFunc(p.f.Type(), p.process.call)
+	}
+	return nil
+}
+
+// Close stops the process of a plugin with the process runtime and releases the module of a
+// plugin with the wasm runtime. Native plugins cannot be unloaded, they stay in memory until the
+// hub restarts.
+func (p *Plugin) Close() {
+	if p.process != nil {
+		time.AfterFunc(pluginProcessCloseDelay, p.process.close)
+	}
+	if p.wasm != nil {
+		time.AfterFunc(pluginProcessCloseDelay, p.wasm.close)
+	}
+}
+
+// goToolchain returns the Go binary of plugin builds, "go" from PATH by default
+func goToolchain(cfg *common.PluginBuildConfig) string {
+	if cfg != nil && cfg.Go != "" {
+		return cfg.Go
+	}
+	return "go"
+}
+
+// CheckToolchain runs the Go toolchain of plugin builds and returns its version. Plugins with the
+// native or process runtime fail to load with the returned error until the toolchain works.
+func CheckToolchain(cfg *common.PluginBuildConfig) (string, error) {
+	goBin := goToolchain(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, goBin, "env", "GOVERSION").Output()
+	version := strings.TrimSpace(string(output))
+	if err == nil && version == "" {
+		err = errors.New("no GOVERSION reported")
+	}
+	if err != nil {
+		toolchainErr = fmt.Errorf("go toolchain %q is not usable: %w", goBin, err)
+		return "", toolchainErr
+	}
+	toolchainErr = nil
+	return version, nil
+}
+
+// pluginBuildDir returns the build cache directory, created private to the hub user. Without
+// plugin_build.dir every process builds into its own new directory.
+func pluginBuildDir(cfg *common.PluginBuildConfig) (string, error) {
+	if cfg == nil || cfg.Dir == "" {
+		privateBuildOnce.Do(func() {
+			// MkdirTemp creates the directory with mode 0700
+			privateBuildDir, privateBuildDirErr = os.MkdirTemp("", "agentsmith-hub-plugins-")
+		})
+		return privateBuildDir, privateBuildDirErr
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(cfg.Dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || !ownedByHub(info) {
+		return "", fmt.Errorf("plugin build directory %s must be a directory owned by the hub user", cfg.Dir)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		if err := os.Chmod(cfg.Dir, 0o700); err != nil {
+			return "", err
+		}
+	}
+	return cfg.Dir, nil
+}
+
+// checkCachedBuild returns whether a build can be reused. A build is only trusted when the hub user
+// owns it and nobody else can replace its content.
+func checkCachedBuild(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || !ownedByHub(info) || info.Mode().Perm()&0o022 != 0 {
+		return false, fmt.Errorf("cached plugin build %s is not owned by the hub user or is writable by others, remove it", path)
+	}
+	return true, nil
+}
+
+// buildPlugin compiles a plugin source and returns the path of the .so or executable. Builds are
+// cached by source, so a restart or another node with the same plugin_build.dir reuses them.
+func buildPlugin(name, source, runtime string) (string, error) {
+	if toolchainErr != nil {
+		return "", fmt.Errorf("cannot build %s plugin: %w", runtime, toolchainErr)
+	}
+	var cfg *common.PluginBuildConfig
+	if common.Config != nil {
+		cfg = common.Config.PluginBuild
+	}
+	goBin, timeout := goToolchain(cfg), defaultPluginBuildTimeout
+	if cfg != nil && cfg.Timeout > 0 {
+		timeout = cfg.Timeout
+	}
+
+	dir, err := pluginBuildDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(runtime + "\n" + source + processMainSource + pluginSecretsSource))
+	id := fmt.Sprintf("%s_%s", name, hex.EncodeToString(sum[:8]))
+	out := filepath.Join(dir, id+"."+runtime)
+	if runtime == RuntimeNative {
+		out += ".so"
+	}
+
+	pluginBuildMu.Lock()
+	defer pluginBuildMu.Unlock()
+	if cached, err := checkCachedBuild(out); err != nil || cached {
+		return out, err
+	}
+	src, err := os.MkdirTemp(dir, id+"-src-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(src)
+
+	// A unique module path lets several versions of a native plugin be loaded
+	files := map[string]string{
+		"go.mod":         "module hubplugin/" + id + "\n\ngo 1.21\n",
+		"plugin.go":      packageClause.ReplaceAllString(source, "package main"),
+		"hub_secrets.go": pluginSecretsSource,
+	}
+	args := []string{"build", "-o", out + ".tmp", "."}
+	if runtime == RuntimeNative {
+		args = []string{"build", "-buildmode=plugin", "-o", out + ".tmp", "."}
+	} else {
+		files["hub_main.go"] = processMainSource
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(src, file), []byte(content), 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, goBin, args...)
+	cmd.Dir = src
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to build %s plugin: %v: %s", runtime, err, strings.TrimSpace(string(output)))
+	}
+	// The executable or .so is readable by the hub user only
+	if err := os.Chmod(out+".tmp", 0o700); err != nil {
+		return "", err
+	}
+	if err := os.Rename(out+".tmp", out); err != nil {
+		return "", err
+	}
+	logger.Info("Plugin built", "plugin", name, "runtime", runtime, "path", out)
+	return out, nil
+}
+
+// processReply is the result of a plugin process, results and arguments pass through JSON. The
+// result is kept encoded until makeRemoteFunc decodes it to the return type of Eval.
+type processReply struct {
+	Result json.RawMessage
+	Ok     bool
+	Err    string
+}
+
+// processRuntime is the process of a plugin with the process runtime. It is started on the first
+// call and again on the next call after it exits.
+type processRuntime struct {
+	name string
+	bin  string
+	// secrets are the values of the rewritten literals, sent to every started process
+	secrets map[string]string
+
+	// maxMemory is the resident memory the process is killed above, onViolation is told when it is
+	maxMemory   int64
+	onViolation func(reason string)
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	client *rpc.Client
+	closed bool
+}
+
+// processConn is the request and response pipes of a plugin process
+type processConn struct {
+	r, w *os.File
+}
+
+func (c processConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c processConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+func (c processConn) Close() error {
+	c.r.Close()
+	return c.w.Close()
+}
+
+func (r *processRuntime) getClient() (*rpc.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errors.New("plugin process is closed")
+	}
+	if r.client != nil {
+		return r.client, nil
+	}
+
+	// The process reads requests from fd 3 and writes responses to fd 4, its stdout stays free
+	// for the plugin
+	reqR, reqW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	respR, respW, err := os.Pipe()
+	if err != nil {
+		reqR.Close()
+		reqW.Close()
+		return nil, err
+	}
+	cmd := exec.Command(r.bin)
+	cmd.ExtraFiles = []*os.File{reqR, respW}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if r.maxMemory > 0 {
+		// The Go runtime of the plugin collects harder as it nears the limit
+		cmd.Env = append(os.Environ(), fmt.Sprintf("GOMEMLIMIT=%d", r.maxMemory))
+	}
+	err = cmd.Start()
+	reqR.Close()
+	respW.Close()
+	if err != nil {
+		reqW.Close()
+		respR.Close()
+		return nil, fmt.Errorf("failed to start plugin process: %w", err)
+	}
+
+	client := jsonrpc.NewClient(processConn{r: respR, w: reqW})
+	if len(r.secrets) > 0 {
+		var ok bool
+		if err := client.Call("Plugin.SetSecrets", r.secrets, &ok); err != nil {
+			client.Close()
+			cmd.Process.Kill()
+			go cmd.Wait()
+			return nil, fmt.Errorf("failed to pass secrets to plugin process: %w", err)
+		}
+	}
+	r.cmd, r.client = cmd, client
+	exited := make(chan struct{})
+	if r.maxMemory > 0 {
+		go r.watchMemory(cmd, exited)
+	}
+	go func() {
+		err := cmd.Wait()
+		close(exited)
+		client.Close()
+		r.mu.Lock()
+		if r.cmd == cmd {
+			r.cmd, r.client = nil, nil
+		}
+		closed := r.closed
+		r.mu.Unlock()
+		if !closed {
+			logger.PluginError("plugin process exited", "plugin", r.name, "error", err)
+		}
+	}()
+	return client, nil
+}
+
+// watchMemory kills the process when its resident memory exceeds maxMemory
+func (r *processRuntime) watchMemory(cmd *exec.Cmd, exited chan struct{}) {
+	ticker := time.NewTicker(pluginMemoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			rss, ok := readProcessRSS(cmd.Process.Pid)
+			if !ok || rss <= r.maxMemory {
+				continue
+			}
+			r.killCmd(cmd)
+			if r.onViolation != nil {
+				r.onViolation(fmt.Sprintf("plugin %s used %d bytes of memory, the limit is %d", r.name, rss, r.maxMemory))
+			}
+			return
+		}
+	}
+}
+
+// kill stops the running process, calls in flight fail and the next call starts a new one
+func (r *processRuntime) kill() {
+	r.mu.Lock()
+	cmd := r.cmd
+	r.mu.Unlock()
+	if cmd != nil {
+		r.killCmd(cmd)
+	}
+}
+
+// killCmd kills a process and forgets it at once, so the next call does not wait for it to exit
+func (r *processRuntime) killCmd(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cmd.Process.Kill()
+	if r.cmd == cmd {
+		r.cmd, r.client = nil, nil
+	}
+}
+
+func (r *processRuntime) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.cmd != nil && r.cmd.Process != nil {
+		r.cmd.Process.Kill()
+	}
+}
+
+// call evaluates the plugin in its process, starting it if needed
+func (r *processRuntime) call(args []interface{}) (processReply, error) {
+	var reply processReply
+	client, err := r.getClient()
+	if err == nil {
+		err = client.Call("Plugin.Eval", args, &reply)
+	}
+	return reply, err
+}
+
+// makeRemoteFunc returns a function of type t evaluating the plugin with call, so a plugin out of
+// Yaegi is invoked like the Yaegi function it replaces
+func makeRemoteFunc(t reflect.Type, call func(args []interface{}) (processReply, error)) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		args := make([]interface{}, 0, len(in))
+		for i, v := range in {
+			if t.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < v.Len(); j++ {
+					args = append(args, v.Index(j).Interface())
+				}
+				continue
+			}
+			args = append(args, v.Interface())
+		}
+
+		reply, err := call(args)
+		if err == nil && reply.Err != "" {
+			err = errors.New(reply.Err)
+		}
+		var result reflect.Value
+		if t.NumOut() == 3 {
+			var decodeErr error
+			result, decodeErr = decodeResult(reply.Result, t.Out(0))
+			if err == nil {
+				err = decodeErr
+			}
+		}
+		errValue := reflect.Zero(errorType)
+		if err != nil {
+			errValue = reflect.ValueOf(&err).Elem()
+		}
+
+		ok := reflect.ValueOf(reply.Ok)
+		if t.NumOut() == 2 {
+			return []reflect.Value{ok.Convert(t.Out(0)), errValue}
+		}
+		return []reflect.Value{result, ok.Convert(t.Out(1)), errValue}
+	})
+}
+
+// decodeResult decodes the JSON result of a plugin out of Yaegi to the return type of its Eval.
+// Numbers are not left as float64: an interface{} gets an int for integral numbers, as the same
+// plugin run by Yaegi would return, and a typed result gets its declared type.
+func decodeResult(raw json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	result := reflect.New(t)
+	if len(raw) == 0 || string(raw) == "null" {
+		return result.Elem(), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(result.Interface()); err != nil {
+		return reflect.Zero(t), fmt.Errorf("plugin result does not match its return type %s: %w", t, err)
+	}
+	if t.Kind() == reflect.Interface {
+		if v := normalizeJSONNumbers(result.Elem().Interface()); v != nil {
+			result.Elem().Set(reflect.ValueOf(v))
+		}
+	} else {
+		// maps and slices of interface{} are normalized in place
+		normalizeJSONNumbers(result.Elem().Interface())
+	}
+	return result.Elem(), nil
+}
+
+// normalizeJSONNumbers replaces the json.Number values of a decoded document by an int when
+// they are integral, as a Go plugin would return, and by a float64 otherwise
+func normalizeJSONNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = normalizeJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = normalizeJSONNumbers(e)
+		}
+	}
+	return v
+}
+
+// processMainSource is compiled with the source of a plugin with the process runtime, it serves
+// its Eval function over JSON-RPC
+const processMainSource = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"reflect"
+)
+
+type HubRPCReply struct {
+	Result interface{}
+	Ok     bool
+	Err    string
+}
+
+type HubRPCPlugin struct{}
+
+func (HubRPCPlugin) Eval(args []json.RawMessage, reply *HubRPCReply) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin execution panicked: %v", r)
+		}
+	}()
+	f := reflect.ValueOf(Eval)
+	t := f.Type()
+	in := make([]reflect.Value, len(args))
+	for i, raw := range args {
+		var pt reflect.Type
+		switch {
+		case t.IsVariadic() && i >= t.NumIn()-1:
+			pt = t.In(t.NumIn() - 1).Elem()
+		case i < t.NumIn():
+			pt = t.In(i)
+		default:
+			return fmt.Errorf("plugin takes %d arguments, got %d", t.NumIn(), len(args))
+		}
+		v := reflect.New(pt)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		in[i] = v.Elem()
+	}
+	out := f.Call(in)
+	if last := out[len(out)-1]; !last.IsNil() {
+		reply.Err = last.Interface().(error).Error()
+	}
+	if len(out) == 3 {
+		reply.Result = out[0].Interface()
+		reply.Ok = out[1].Bool()
+	} else {
+		reply.Ok = out[0].Bool()
+	}
+	return nil
+}
+
+func (HubRPCPlugin) SetSecrets(values map[string]string, reply *bool) error {
+	HubSetSecrets(values)
+	*reply = true
+	return nil
+}
+
+type hubRPCConn struct {
+	r, w *os.File
+}
+
+func (c hubRPCConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c hubRPCConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+func (c hubRPCConn) Close() error {
+	c.r.Close()
+	return c.w.Close()
+}
+
+func main() {
+	if err := rpc.RegisterName("Plugin", HubRPCPlugin{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	jsonrpc.ServeConn(hubRPCConn{r: os.NewFile(3, "requests"), w: os.NewFile(4, "responses")})
+}
+`
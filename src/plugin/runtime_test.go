@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// usePluginBuildDir builds the compiled runtimes in a temporary directory
+func usePluginBuildDir(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	saved := common.Config
+	cfg := common.HubConfig{}
+	if saved != nil {
+		cfg = *saved
+	}
+	cfg.PluginBuild = &common.PluginBuildConfig{Dir: t.TempDir()}
+	common.Config = &cfg
+	t.Cleanup(func() { common.Config = saved })
+}
+
+// newRuntimeTestPlugin loads a plugin source with the given runtime
+func newRuntimeTestPlugin(t *testing.T, runtime, name, source string) *Plugin {
+	t.Helper()
+	src := strings.Replace(source, "package plugin\n", "package plugin\n\n//hub:runtime "+runtime+"\n", 1)
+	p, err := NewTestPlugin("", src, name, YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadRuntime(); err != nil {
+		if runtime == RuntimeNative && strings.Contains(err.Error(), "failed to open native plugin") {
+			t.Skipf("native plugins cannot be loaded by the test binary: %v", err)
+		}
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if p.process != nil {
+			p.process.close()
+		}
+	})
+	return p
+}
+
+func TestRuntimesReturnSameResult(t *testing.T) {
+	usePluginBuildDir(t)
+	sources := map[string]string{
+		"interface": `package plugin
+
+func Eval(n int, label string) (interface{}, bool, error) {
+	return map[string]interface{}{
+		"n":     n,
+		"big":   1<<53 + 1,
+		"half":  float64(n) / 2,
+		"list":  []interface{}{n, label},
+		"label": label,
+	}, true, nil
+}
+`,
+		"typed": `package plugin
+
+func Eval(n int, label string) (map[string]int64, bool, error) {
+	return map[string]int64{label: int64(n), "big": int64(1)<<53 + 1}, true, nil
+}
+`,
+		"scalar": `package plugin
+
+func Eval(n int, label string) (interface{}, bool, error) {
+	return n * 2, n > 0, nil
+}
+`,
+	}
+	// Numbers of an interface{} result come back as int or float64, a plugin returning another
+	// numeric type only gets it back through a typed result
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			want, wantOk, err := newRuntimeTestPlugin(t, RuntimeYaegi, "runtime_"+name, source).FuncEvalOther(3, "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, runtime := range []string{RuntimeProcess, RuntimeNative} {
+				t.Run(runtime, func(t *testing.T) {
+					got, ok, err := newRuntimeTestPlugin(t, runtime, "runtime_"+name, source).FuncEvalOther(3, "x")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if ok != wantOk || !reflect.DeepEqual(got, want) {
+						t.Fatalf("got %#v, %v, want %#v, %v as returned by yaegi", got, ok, want, wantOk)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestPluginBuildCacheIsPrivate(t *testing.T) {
+	usePluginBuildDir(t)
+	dir := common.Config.PluginBuild.Dir
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	bin, err := buildPlugin("private", "package plugin\n\nfunc Eval() (bool, error) {\n\treturn true, nil\n}\n", RuntimeProcess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{dir: 0o700, bin: 0o700} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v (%v)", path, info.Mode().Perm(), want, err)
+		}
+	}
+	// The sources are removed once built
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*-src-*")); len(entries) != 0 {
+		t.Errorf("build sources left behind: %v", entries)
+	}
+
+	// A build others could have replaced is not loaded
+	if err := os.Chmod(bin, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildPlugin("private", "package plugin\n\nfunc Eval() (bool, error) {\n\treturn true, nil\n}\n", RuntimeProcess); err == nil || !strings.Contains(err.Error(), "writable by others") {
+		t.Fatalf("group writable build reused: %v", err)
+	}
+	if cached, err := checkCachedBuild(filepath.Join(dir, "missing")); cached || err != nil {
+		t.Fatalf("missing build: %v %v", cached, err)
+	}
+
+	// Without plugin_build.dir every process builds into its own private directory
+	common.Config.PluginBuild.Dir = ""
+	private, err := pluginBuildDir(common.Config.PluginBuild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(private)
+		privateBuildOnce = sync.Once{}
+	})
+	if info, err := os.Stat(private); err != nil || info.Mode().Perm() != 0o700 || !ownedByHub(info) {
+		t.Fatalf("private build directory %s: %v %v", private, info.Mode(), err)
+	}
+	if again, _ := pluginBuildDir(common.Config.PluginBuild); again != private {
+		t.Fatalf("private build directory changed from %s to %s", private, again)
+	}
+}
+
+func TestCheckToolchain(t *testing.T) {
+	t.Cleanup(func() { toolchainErr = nil })
+	if _, err := CheckToolchain(&common.PluginBuildConfig{Go: filepath.Join(t.TempDir(), "go")}); err == nil {
+		t.Fatal("missing toolchain accepted")
+	}
+	if _, err := buildPlugin("no_toolchain", "package plugin\n", RuntimeProcess); err == nil || !strings.Contains(err.Error(), "not usable") {
+		t.Fatalf("build without a toolchain: %v", err)
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	version, err := CheckToolchain(nil)
+	if err != nil || !strings.HasPrefix(version, "go") {
+		t.Fatalf("toolchain version %q: %v", version, err)
+	}
+	if toolchainErr != nil {
+		t.Fatal("a working toolchain did not clear the previous error")
+	}
+}
+
+func TestDecodeResult(t *testing.T) {
+	v, err := decodeResult([]byte(`{"n":3,"f":1.5,"list":[9007199254740993]}`), reflect.TypeOf((*interface{})(nil)).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"n": 3, "f": 1.5, "list": []interface{}{9007199254740993}}
+	if got := v.Interface(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("interface result = %#v", got)
+	}
+
+	v, err = decodeResult([]byte(`[1,2]`), reflect.TypeOf([]uint8(nil)))
+	if err != nil || !reflect.DeepEqual(v.Interface(), []uint8{1, 2}) {
+		t.Fatalf("typed result = %#v, %v", v, err)
+	}
+	if _, err := decodeResult([]byte(`"text"`), reflect.TypeOf(0)); err == nil {
+		t.Fatal("result of another type accepted")
+	}
+	if v, err := decodeResult(nil, reflect.TypeOf(0)); err != nil || v.Int() != 0 {
+		t.Fatalf("missing result = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package plugin
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByHub reports whether a file of the build cache belongs to the user running the hub
+func ownedByHub(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// resolveSourceSecrets replaces the ${secret:...} references in the string literals of a plugin
+// source by the secrets for the Yaegi interpreter. Payload keeps the references, only the loaded code
+// sees the values.
+func resolveSourceSecrets(source string) (string, error) {
+	if !common.HasSecretRefs(source) {
+		return source, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, parser.SkipObjectResolution)
+	if err != nil {
+		// Loading the source reports the syntax error
+		return source, nil
+	}
+
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	var replacements []replacement
+	ast.Inspect(file, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING || !common.HasSecretRefs(lit.Value) {
+			return true
+		}
+		value, uerr := strconv.Unquote(lit.Value)
+		if uerr != nil {
+			return true
+		}
+		value, err = common.ResolveSecretRefs(value)
+		if err != nil {
+			return false
+		}
+		start := fset.Position(lit.Pos()).Offset
+		replacements = append(replacements, replacement{start, start + len(lit.Value), strconv.Quote(value)})
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		source = source[:r.start] + r.text + source[r.end:]
+	}
+	return source, nil
+}
+
+// rewriteSourceSecrets replaces the string literals of a plugin source that reference secrets by
+// hubPluginSecret calls, and returns the resolved value of each literal. A compiled plugin gets the
+// values when it is loaded, so they never reach its source, its build or the build cache key.
+// Literals are only rewritten in function bodies: package-level values and constants are set
+// before the hub passes the values.
+func rewriteSourceSecrets(source string) (string, map[string]string, error) {
+	if !common.HasSecretRefs(source) {
+		return source, nil, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, parser.SkipObjectResolution)
+	if err != nil {
+		// Building the source reports the syntax error
+		return source, nil, nil
+	}
+
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	var replacements []replacement
+	values := make(map[string]string)
+	inspect := func(root ast.Node, inFunc bool) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				if n.Tok == token.CONST || !inFunc {
+					if lit := findSecretLiteral(n); lit != nil {
+						err = fmt.Errorf("line %d: ${secret:...} references of compiled plugins are only allowed in function bodies, not in constants or package-level values", fset.Position(lit.Pos()).Line)
+					}
+					return false
+				}
+			case *ast.Field:
+				if n.Tag != nil && common.HasSecretRefs(n.Tag.Value) {
+					err = fmt.Errorf("line %d: struct tags cannot reference secrets", fset.Position(n.Tag.Pos()).Line)
+					return false
+				}
+			case *ast.BasicLit:
+				if n.Kind != token.STRING || !common.HasSecretRefs(n.Value) {
+					return true
+				}
+				template, uerr := strconv.Unquote(n.Value)
+				if uerr != nil {
+					return true
+				}
+				if _, ok := values[template]; !ok {
+					var value string
+					if value, err = common.ResolveSecretRefs(template); err != nil {
+						return false
+					}
+					values[template] = value
+				}
+				start := fset.Position(n.Pos()).Offset
+				replacements = append(replacements, replacement{start, start + len(n.Value), "hubPluginSecret(" + strconv.Quote(template) + ")"})
+			}
+			return true
+		})
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			if fn.Body != nil {
+				inspect(fn.Body, true)
+			}
+			continue
+		}
+		inspect(decl, false)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		source = source[:r.start] + r.text + source[r.end:]
+	}
+	return source, values, nil
+}
+
+// findSecretLiteral returns the first string literal of n that references a secret
+func findSecretLiteral(n ast.Node) *ast.BasicLit {
+	var found *ast.BasicLit
+	ast.Inspect(n, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && found == nil && lit.Kind == token.STRING && common.HasSecretRefs(lit.Value) {
+			found = lit
+		}
+		return found == nil
+	})
+	return found
+}
+
+// pluginSecretsSource is compiled with every native or process plugin, the hub calls HubSetSecrets
+// with the values of the literals rewritten by rewriteSourceSecrets before the first Eval
+const pluginSecretsSource = `package main
+
+import "sync"
+
+var (
+	hubSecretsMu sync.RWMutex
+	hubSecrets   map[string]string
+)
+
+func HubSetSecrets(values map[string]string) {
+	hubSecretsMu.Lock()
+	hubSecrets = values
+	hubSecretsMu.Unlock()
+}
+
+func hubPluginSecret(template string) string {
+	hubSecretsMu.RLock()
+	defer hubSecretsMu.RUnlock()
+	return hubSecrets[template]
+}
+`
@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSourceSecrets(t *testing.T) {
+	common.InitSecrets(&common.SecretsConfig{Values: map[string]string{
+		"token": "abc123",
+		"quote": "a \"quoted\"\nline`",
+	}})
+	t.Cleanup(func() { common.InitSecrets(nil) })
+
+	source := "package plugin\n\n" +
+		"// The token is ${secret:token}\n" +
+		"var token = \"${secret:token}\"\n" +
+		"var header = `Bearer ${secret:token} ${secret:token}`\n" +
+		"var tricky = \"${secret:quote}\"\n" +
+		"var plain = \"no secret\"\n\n" +
+		"func Eval() (bool, error) {\n\treturn token == \"abc123\" && plain != \"\", nil\n}\n"
+	got, err := resolveSourceSecrets(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// The token is ${secret:token}\n", // comments are not string literals
+		`var token = "abc123"`,
+		`var header = "Bearer abc123 abc123"`,
+		`var tricky = "a \"quoted\"\nline` + "`" + `"`,
+		`var plain = "no secret"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("resolved source lacks %q:\n%s", want, got)
+		}
+	}
+	// Values are quoted, a secret cannot change the code around its literal
+	if _, err := parser.ParseFile(token.NewFileSet(), "", got, 0); err != nil {
+		t.Fatalf("resolved source does not parse: %v\n%s", err, got)
+	}
+
+	// The loaded plugin sees the value, the payload keeps the reference
+	p, err := NewTestPlugin("", source, "secrets", YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.FuncEvalCheckNode(); err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if !strings.Contains(string(p.Payload), `"${secret:token}"`) {
+		t.Fatal("the payload holds the secret value")
+	}
+}
+
+func TestResolveSourceSecretsErrors(t *testing.T) {
+	common.InitSecrets(&common.SecretsConfig{EnvPrefix: "PLUGIN_TEST_SECRET_"})
+	t.Cleanup(func() { common.InitSecrets(nil) })
+
+	if _, err := resolveSourceSecrets("package plugin\n\nvar x = \"${secret:absent}\"\n"); err == nil || !strings.Contains(err.Error(), "PLUGIN_TEST_SECRET_ABSENT") {
+		t.Fatalf("missing secret: err = %v", err)
+	}
+
+	// Sources without string literal references, or that do not parse, are returned as is
+	for _, source := range []string{
+		"package plugin\n\n// ${secret:absent}\nvar x = 1\n",
+		"package plugin\n\nvar x = \"${secret:absent}\"\nfunc {\n",
+	} {
+		if got, err := resolveSourceSecrets(source); err != nil || got != source {
+			t.Errorf("resolveSourceSecrets(%q) = %q, %v", source, got, err)
+		}
+	}
+}
+
+func TestCompiledPluginSecrets(t *testing.T) {
+	usePluginBuildDir(t)
+	t.Cleanup(func() { common.InitSecrets(nil) })
+	source := "package plugin\n\n" +
+		"func Eval() (interface{}, bool, error) {\n\treturn \"Bearer ${secret:token}\", true, nil\n}\n"
+
+	for _, runtime := range []string{RuntimeProcess, RuntimeNative} {
+		t.Run(runtime, func(t *testing.T) {
+			name := "secrets_" + runtime
+			common.InitSecrets(&common.SecretsConfig{Values: map[string]string{"token": "s3cr3t-value"}})
+			p := newRuntimeTestPlugin(t, runtime, name, source)
+			if result, ok, err := p.FuncEvalOther(); err != nil || !ok || result != "Bearer s3cr3t-value" {
+				t.Fatalf("result=%v ok=%v err=%v", result, ok, err)
+			}
+
+			// Neither the build nor its cache key depend on the value
+			dir := common.Config.PluginBuild.Dir
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					if content, _ := os.ReadFile(path); bytes.Contains(content, []byte("s3cr3t-value")) {
+						t.Errorf("%s holds the secret value", path)
+					}
+				}
+				return nil
+			})
+			builds, _ := filepath.Glob(filepath.Join(dir, name+"_*"))
+			common.InitSecrets(&common.SecretsConfig{Values: map[string]string{"token": "rotated"}})
+			p = newRuntimeTestPlugin(t, runtime, name, source)
+			if result, _, err := p.FuncEvalOther(); err != nil || result != "Bearer rotated" {
+				t.Fatalf("result=%v err=%v", result, err)
+			}
+			if again, _ := filepath.Glob(filepath.Join(dir, name+"_*")); len(builds) != 1 || len(again) != 1 || again[0] != builds[0] {
+				t.Fatalf("builds %v, then %v", builds, again)
+			}
+		})
+	}
+}
+
+func TestRewriteSourceSecrets(t *testing.T) {
+	common.InitSecrets(&common.SecretsConfig{Values: map[string]string{"token": "abc123"}})
+	t.Cleanup(func() { common.InitSecrets(nil) })
+
+	got, values, err := rewriteSourceSecrets("package plugin\n\n" +
+		"// ${secret:token}\n" +
+		"func Eval() (bool, error) {\n\tx := `${secret:token}`\n\treturn x == \"${secret:token}\", nil\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "abc123") || strings.Count(got, `hubPluginSecret("${secret:token}")`) != 2 || !strings.Contains(got, "// ${secret:token}\n") {
+		t.Fatalf("rewritten source:\n%s", got)
+	}
+	if len(values) != 1 || values["${secret:token}"] != "abc123" {
+		t.Fatalf("values = %v", values)
+	}
+
+	// Values set before the hub passes the secrets cannot reference them
+	for _, source := range []string{
+		"package plugin\n\nvar token = \"${secret:token}\"\n",
+		"package plugin\n\nfunc Eval() (bool, error) {\n\tconst token = \"${secret:token}\"\n\treturn token != \"\", nil\n}\n",
+		"package plugin\n\nfunc Eval() (bool, error) {\n\tvar v struct {\n\t\tA string `json:\"${secret:token}\"`\n\t}\n\treturn v.A == \"\", nil\n}\n",
+	} {
+		if _, _, err := rewriteSourceSecrets(source); err == nil || !strings.Contains(err.Error(), "line ") {
+			t.Errorf("rewriteSourceSecrets(%q): err = %v", source, err)
+		}
+	}
+}
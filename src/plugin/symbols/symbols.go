@@ -0,0 +1,39 @@
+// Package symbols holds the Yaegi symbols of the third-party packages bundled for plugins. A
+// package is only visible to plugins when it is listed in plugin_packages.
+package symbols
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//go:generate yaegi extract -name symbols github.com/google/uuid github.com/mssola/user_agent github.com/oschwald/geoip2-golang github.com/oschwald/maxminddb-golang
+
+// Symbols are the exported symbols by "import/path/name", the format of interp.Use
+var Symbols = map[string]map[string]reflect.Value{}
+
+// Hidden are the symbols of Symbols that plugins cannot use, by Symbols key. They change the state
+// of the whole process, such as the random source and node ID uuid shares with the hub. They are
+// listed here rather than removed from the generated files so regenerating them keeps them hidden.
+var Hidden = map[string][]string{
+	"github.com/google/uuid/uuid": {"SetClockSequence", "SetNodeID", "SetNodeInterface", "SetRand"},
+}
+
+// Packages returns the import paths of the bundled packages, sorted
+func Packages() []string {
+	pkgs := make([]string, 0, len(Symbols))
+	for key := range Symbols {
+		pkgs = append(pkgs, ImportPath(key))
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// ImportPath returns the import path of a Symbols key
+func ImportPath(key string) string {
+	if i := strings.LastIndex(key, "/"); i > 0 {
+		return key[:i]
+	}
+	return key
+}
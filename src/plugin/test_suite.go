@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// PluginTestSuffix names the test file of a plugin next to its source: plugin/<name>_test.json
+const PluginTestSuffix = "_test.json"
+
+// PluginTestCase is a case of a plugin test file:
+//
+//	{"cases": [{"name": "private ip", "args": ["10.0.0.1"], "result": true}]}
+//
+// Result is compared as JSON and skipped when absent. Error is a substring of the expected error,
+// a case without it expects the call to succeed.
+type PluginTestCase struct {
+	Name   string          `json:"name"`
+	Args   []interface{}   `json:"args"`
+	Result json.RawMessage `json:"result,omitempty"`
+	OK     *bool           `json:"ok,omitempty"` // second result of plugins returning (interface{}, bool, error)
+	Error  string          `json:"error,omitempty"`
+}
+
+// PluginTestFile is the content of a plugin test file
+type PluginTestFile struct {
+	Cases []PluginTestCase `json:"cases"`
+}
+
+// PluginTestResult is the outcome of one case
+type PluginTestResult struct {
+	Name    string      `json:"name"`
+	Passed  bool        `json:"passed"`
+	Result  interface{} `json:"result"`
+	OK      *bool       `json:"ok,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Failure string      `json:"failure,omitempty"`
+}
+
+// PluginTestReport is the outcome of the test file of a plugin
+type PluginTestReport struct {
+	Plugin  string             `json:"plugin"`
+	Passed  int                `json:"passed"`
+	Failed  int                `json:"failed"`
+	Results []PluginTestResult `json:"results"`
+}
+
+// PluginTestPath returns the path of the test file of a plugin under config_root
+func PluginTestPath(name string) string {
+	return filepath.Join(common.Config.ConfigRoot, "plugin", name+PluginTestSuffix)
+}
+
+// LoadPluginTests reads the test file of a plugin, found is false when it has none
+func LoadPluginTests(name string) (cases []PluginTestCase, found bool, err error) {
+	data, err := os.ReadFile(PluginTestPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	cases, err = ParsePluginTests(data)
+	return cases, true, err
+}
+
+// ParsePluginTests parses the content of a plugin test file
+func ParsePluginTests(data []byte) ([]PluginTestCase, error) {
+	var file PluginTestFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid plugin test file: %w", err)
+	}
+	if len(file.Cases) == 0 {
+		return nil, fmt.Errorf("plugin test file has no cases")
+	}
+	for i := range file.Cases {
+		if file.Cases[i].Name == "" {
+			file.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+	}
+	return file.Cases, nil
+}
+
+// NewTestSuitePlugin loads a plugin source to run its test file: like NewPlugin, it gets the
+// runtime and budgets of its directives and plugin_limits, but it is not added to the registry.
+// Close releases its process or module once the tests ran.
+func NewTestSuitePlugin(raw string, name string) (*Plugin, error) {
+	p, err := NewTestPlugin("", raw, name, YAEGI_PLUGIN)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.loadRuntime(); err != nil {
+		return nil, fmt.Errorf("plugin runtime load err %s: %w", name, err)
+	}
+	if err := p.loadLimits(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin limits err %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// RunTests runs test cases against the plugin. Calls go through the budgets and statistics of
+// the plugin like calls from rulesets, so a plugin with side effects should be tested on a
+// test plugin, see NewTestPlugin.
+func (p *Plugin) RunTests(cases []PluginTestCase) *PluginTestReport {
+	report := &PluginTestReport{Plugin: p.Name, Results: make([]PluginTestResult, 0, len(cases))}
+	for _, tc := range cases {
+		res := p.runTestCase(tc)
+		if res.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func (p *Plugin) runTestCase(tc PluginTestCase) PluginTestResult {
+	res := PluginTestResult{Name: tc.Name}
+	args, err := p.testArgs(tc.Args)
+	if err != nil {
+		res.Failure = err.Error()
+		return res
+	}
+
+	if p.ReturnType == "bool" {
+		var b bool
+		b, err = p.FuncEvalCheckNode(args...)
+		res.Result = b
+	} else {
+		var ok bool
+		res.Result, ok, err = p.FuncEvalOther(args...)
+		res.OK = &ok
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	switch {
+	case tc.Error == "" && err != nil:
+		res.Failure = "unexpected error: " + err.Error()
+	case tc.Error != "" && err == nil:
+		res.Failure = fmt.Sprintf("expected an error containing %q, got none", tc.Error)
+	case tc.Error != "" && !strings.Contains(err.Error(), tc.Error):
+		res.Failure = fmt.Sprintf("expected an error containing %q, got %q", tc.Error, err.Error())
+	case tc.OK != nil && res.OK == nil:
+		res.Failure = "ok is only returned by plugins returning (interface{}, bool, error)"
+	case tc.OK != nil && *res.OK != *tc.OK:
+		res.Failure = fmt.Sprintf("expected ok %t, got %t", *tc.OK, *res.OK)
+	case len(tc.Result) > 0:
+		if msg := compareTestResult(tc.Result, res.Result); msg != "" {
+			res.Failure = msg
+		}
+	}
+	res.Passed = res.Failure == ""
+	return res
+}
+
+// testArgs converts the JSON arguments of a case to the parameter types of Eval, so a number
+// reaches an int parameter as an int
+func (p *Plugin) testArgs(raw []interface{}) ([]interface{}, error) {
+	if !p.f.IsValid() {
+		return nil, fmt.Errorf("plugin %s is not loaded", p.Name)
+	}
+	ft := p.f.Type()
+	if (!ft.IsVariadic() && len(raw) != ft.NumIn()) || (ft.IsVariadic() && len(raw) < ft.NumIn()-1) {
+		return nil, fmt.Errorf("Eval takes %d arguments, the case has %d", ft.NumIn(), len(raw))
+	}
+	args := make([]interface{}, len(raw))
+	for i, v := range raw {
+		var t reflect.Type
+		if ft.IsVariadic() && i >= ft.NumIn()-1 {
+			t = ft.In(ft.NumIn() - 1).Elem()
+		} else {
+			t = ft.In(i)
+		}
+		if t.Kind() == reflect.Interface {
+			args[i] = v
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		arg := reflect.New(t)
+		if err := json.Unmarshal(data, arg.Interface()); err != nil {
+			return nil, fmt.Errorf("argument %d cannot be converted to %s: %w", i+1, t, err)
+		}
+		args[i] = arg.Elem().Interface()
+	}
+	return args, nil
+}
+
+// compareTestResult compares a result with the expected JSON, after a JSON round trip of the
+// result so a struct or int matches its JSON form
+func compareTestResult(expected json.RawMessage, actual interface{}) string {
+	var want, got interface{}
+	if err := json.Unmarshal(expected, &want); err != nil {
+		return "invalid expected result: " + err.Error()
+	}
+	data, err := json.Marshal(actual)
+	if err != nil {
+		return "result cannot be encoded as JSON: " + err.Error()
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		return "result cannot be encoded as JSON: " + err.Error()
+	}
+	if !reflect.DeepEqual(want, got) {
+		return fmt.Sprintf("expected result %s, got %s", expected, data)
+	}
+	return ""
+}
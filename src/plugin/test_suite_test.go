@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"AgentSmith-HUB/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sumPluginSrc = `package plugin
+
+import "errors"
+
+func Eval(a int, b int) (interface{}, bool, error) {
+	if a < 0 || b < 0 {
+		return nil, false, errors.New("negative argument")
+	}
+	return map[string]interface{}{"sum": a + b}, a+b > 0, nil
+}
+`
+
+func TestParsePluginTests(t *testing.T) {
+	cases, err := ParsePluginTests([]byte(`{"cases": [{"name": "first", "args": [1]}, {"args": [2], "result": true}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 || cases[0].Name != "first" || cases[1].Name != "case 2" || string(cases[1].Result) != "true" {
+		t.Fatalf("cases = %+v", cases)
+	}
+	for _, data := range []string{`{"cases": []}`, `{}`, `[1, 2]`, `{"cases": [`} {
+		if _, err := ParsePluginTests([]byte(data)); err == nil {
+			t.Errorf("%s accepted", data)
+		}
+	}
+}
+
+func TestLoadPluginTests(t *testing.T) {
+	saved := common.Config
+	common.Config = &common.HubConfig{ConfigRoot: t.TempDir()}
+	t.Cleanup(func() { common.Config = saved })
+
+	if _, found, err := LoadPluginTests("sum"); found || err != nil {
+		t.Fatalf("without a test file: found=%v err=%v", found, err)
+	}
+	if err := os.MkdirAll(filepath.Join(common.Config.ConfigRoot, "plugin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PluginTestPath("sum"), []byte(`{"cases": [{"args": [1, 2]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cases, found, err := LoadPluginTests("sum"); !found || err != nil || len(cases) != 1 {
+		t.Fatalf("cases=%v found=%v err=%v", cases, found, err)
+	}
+	if err := os.WriteFile(PluginTestPath("sum"), []byte(`{"cases": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := LoadPluginTests("sum"); !found || err == nil {
+		t.Fatalf("invalid test file: found=%v err=%v", found, err)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	p, err := NewTestSuitePlugin(sumPluginSrc, "sum_test_suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases, err := ParsePluginTests([]byte(`{"cases": [
+		{"name": "sum", "args": [1, 2], "result": {"sum": 3}, "ok": true},
+		{"name": "zero", "args": [0, 0], "ok": false},
+		{"name": "expected error", "args": [-1, 2], "error": "negative"},
+		{"name": "wrong result", "args": [1, 2], "result": {"sum": 4}},
+		{"name": "wrong ok", "args": [1, 2], "ok": false},
+		{"name": "unexpected error", "args": [-1, 2]},
+		{"name": "missing error", "args": [1, 2], "error": "negative"},
+		{"name": "other error", "args": [-1, 2], "error": "overflow"},
+		{"name": "argument count", "args": [1]},
+		{"name": "argument type", "args": ["one", 2]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := p.RunTests(cases)
+	if report.Plugin != "sum_test_suite" || report.Passed != 3 || report.Failed != 7 || len(report.Results) != 10 {
+		t.Fatalf("report = %+v", report)
+	}
+	for i, want := range []string{
+		"", "", "",
+		`expected result {"sum": 4}, got {"sum":3}`,
+		"expected ok false, got true",
+		"unexpected error: negative argument",
+		`expected an error containing "negative", got none`,
+		`expected an error containing "overflow", got "negative argument"`,
+		"Eval takes 2 arguments, the case has 1",
+		"argument 1 cannot be converted to int",
+	} {
+		res := report.Results[i]
+		if res.Passed != (want == "") || !strings.Contains(res.Failure, want) {
+			t.Errorf("%s: passed=%v failure=%q, want %q", res.Name, res.Passed, res.Failure, want)
+		}
+	}
+	if res := report.Results[2]; res.Error != "negative argument" || res.OK == nil || *res.OK {
+		t.Errorf("expected error case = %+v", res)
+	}
+
+	// ok is only checked for plugins returning it
+	check, err := NewTestSuitePlugin("package plugin\n\nfunc Eval(s string) (bool, error) {\n\treturn s != \"\", nil\n}\n", "check_test_suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report = check.RunTests([]PluginTestCase{
+		{Name: "result", Args: []interface{}{"x"}, Result: []byte("true")},
+		{Name: "ok", Args: []interface{}{"x"}, OK: new(bool)},
+	})
+	if !report.Results[0].Passed || report.Results[1].Passed || !strings.Contains(report.Results[1].Failure, "ok is only returned") {
+		t.Fatalf("report = %+v", report.Results)
+	}
+}
+
+func TestNewTestSuitePluginLoadsRuntimeAndLimits(t *testing.T) {
+	p, err := NewTestSuitePlugin("//hub:timeout 20ms\n"+sleepPluginSrc, "sleep_test_suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.limits == nil || p.Runtime != RuntimeYaegi {
+		t.Fatalf("limits = %+v, runtime = %s", p.limits, p.Runtime)
+	}
+	report := p.RunTests([]PluginTestCase{{Name: "slow", Args: []interface{}{"200ms"}, Result: []byte("true")}})
+	if report.Failed != 1 || !strings.Contains(report.Results[0].Failure, "exceeded its timeout of 20ms") {
+		t.Fatalf("slow case = %+v", report.Results[0])
+	}
+
+	if _, err := NewTestSuitePlugin("//hub:max_memory 64MB\n"+sleepPluginSrc, "memory_test_suite"); err == nil || !strings.Contains(err.Error(), "max_memory") {
+		t.Fatalf("limits of another runtime: err = %v", err)
+	}
+
+	usePluginBuildDir(t)
+	p, err = NewTestSuitePlugin(strings.Replace(sumPluginSrc, "package plugin\n", "package plugin\n\n//hub:runtime process\n", 1), "sum_process_test_suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.process == nil {
+		t.Fatal("the process runtime was not loaded")
+	}
+	t.Cleanup(p.process.close)
+	report = p.RunTests([]PluginTestCase{{Name: "sum", Args: []interface{}{1, 2}, Result: []byte(`{"sum": 3}`)}})
+	if report.Passed != 1 {
+		t.Fatalf("process case = %+v", report.Results[0])
+	}
+}
@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"AgentSmith-HUB/common"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// RuntimeWasm runs a WebAssembly module, e.g. built from Rust, TinyGo or AssemblyScript. The
+// source declares the signature of Eval and names the module with a //hub:wasm directive.
+const RuntimeWasm = "wasm"
+
+const (
+	wasmPageSize = 64 << 10
+	// defaultWasmMemoryLimit bounds the linear memory of a module instance
+	defaultWasmMemoryLimit = 64 << 20
+)
+
+// wasmReply is the JSON document returned by hub_eval
+type wasmReply struct {
+	Result json.RawMessage `json:"result"`
+	Ok     bool            `json:"ok"`
+	Err    string          `json:"error"`
+}
+
+// wasmRuntime is the compiled module of a plugin with the wasm runtime. An instance serves one
+// call at a time, idle instances are kept for the next calls.
+type wasmRuntime struct {
+	name     string
+	bin      []byte
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	// timeout cancels a call that runs longer, set by loadLimits
+	timeout time.Duration
+
+	mu     sync.Mutex
+	idle   []api.Module
+	closed bool
+}
+
+// wasmModulePath returns the path of the module named by the //hub:wasm directive of a source,
+// relative paths are in the plugin directory of config_root
+func wasmModulePath(source string) (string, error) {
+	directives, err := parseDirectives(source)
+	if err != nil {
+		return "", err
+	}
+	path := directives["wasm"]
+	if path == "" {
+		return "", errors.New("plugins with the wasm runtime need a //hub:wasm <module file> directive")
+	}
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	root := ""
+	if common.Config != nil {
+		root = common.Config.ConfigRoot
+	}
+	return filepath.Join(root, "plugin", path), nil
+}
+
+// newWasmRuntime compiles a module and checks its exports:
+//
+//	memory
+//	hub_alloc(size i32) -> i32                 buffer for the JSON array of arguments
+//	hub_eval(ptr i32, len i32) -> i64          JSON reply, its pointer in the high 32 bits and its length in the low ones
+//	hub_free(ptr i32, len i32)                 optional, releases the buffers once read
+//
+// The module runs with WASI, without filesystem, environment or network access.
+func newWasmRuntime(name string, bin []byte, memoryLimit int64) (*wasmRuntime, error) {
+	if memoryLimit <= 0 {
+		memoryLimit = defaultWasmMemoryLimit
+	}
+	ctx := context.Background()
+	cfg := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(uint32((memoryLimit + wasmPageSize - 1) / wasmPageSize))
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	compiled, err := rt.CompileModule(ctx, bin)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("invalid wasm module: %w", err)
+	}
+	if err := checkWasmExports(compiled); err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	return &wasmRuntime{name: name, bin: bin, runtime: rt, compiled: compiled}, nil
+}
+
+func checkWasmExports(compiled wazero.CompiledModule) error {
+	if len(compiled.ExportedMemories()) == 0 {
+		return errors.New("wasm module must export its memory")
+	}
+	i32, i64 := api.ValueTypeI32, api.ValueTypeI64
+	want := []struct {
+		name            string
+		params, results []api.ValueType
+		optional        bool
+	}{
+		{"hub_alloc", []api.ValueType{i32}, []api.ValueType{i32}, false},
+		{"hub_eval", []api.ValueType{i32, i32}, []api.ValueType{i64}, false},
+		{"hub_free", []api.ValueType{i32, i32}, nil, true},
+	}
+	exports := compiled.ExportedFunctions()
+	for _, w := range want {
+		def, ok := exports[w.name]
+		if !ok {
+			if w.optional {
+				continue
+			}
+			return fmt.Errorf("wasm module must export %s", w.name)
+		}
+		if !bytes.Equal(def.ParamTypes(), w.params) || !bytes.Equal(def.ResultTypes(), w.results) {
+			return fmt.Errorf("wasm export %s has signature %v -> %v, expected %v -> %v",
+				w.name, valueTypeNames(def.ParamTypes()), valueTypeNames(def.ResultTypes()), valueTypeNames(w.params), valueTypeNames(w.results))
+		}
+	}
+	return nil
+}
+
+func valueTypeNames(types []api.ValueType) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = api.ValueTypeName(t)
+	}
+	return names
+}
+
+func (r *wasmRuntime) acquire(ctx context.Context) (api.Module, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("wasm plugin is closed")
+	}
+	if n := len(r.idle); n > 0 {
+		mod := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return mod, nil
+	}
+	r.mu.Unlock()
+
+	// Reactor modules initialize in _initialize, the _start of a command would exit the instance
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(os.Stdout).
+		WithStderr(os.Stderr).
+		WithRandSource(crand.Reader).
+		WithSysWalltime().
+		WithSysNanotime()
+	mod, err := r.runtime.InstantiateModule(ctx, r.compiled, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module: %w", err)
+	}
+	return mod, nil
+}
+
+// release keeps an instance for the next call, an instance that failed is dropped since its
+// memory may be left inconsistent
+func (r *wasmRuntime) release(ctx context.Context, mod api.Module, failed bool) {
+	r.mu.Lock()
+	keep := !failed && !r.closed && !mod.IsClosed()
+	if keep {
+		r.idle = append(r.idle, mod)
+	}
+	r.mu.Unlock()
+	if !keep {
+		mod.Close(ctx)
+	}
+}
+
+// call runs hub_eval on an instance with the JSON array of the arguments
+func (r *wasmRuntime) call(ctx context.Context, args []interface{}) (processReply, error) {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return processReply{}, fmt.Errorf("arguments cannot be encoded as JSON: %w", err)
+	}
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	mod, err := r.acquire(ctx)
+	if err != nil {
+		return processReply{}, err
+	}
+	reply, err := r.eval(ctx, mod, input)
+	r.release(ctx, mod, err != nil)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return processReply{}, fmt.Errorf("plugin %s %w of %s", r.name, errPluginTimeout, r.timeout)
+		}
+		return processReply{}, err
+	}
+	return processReply{Result: reply.Result, Ok: reply.Ok, Err: reply.Err}, nil
+}
+
+func (r *wasmRuntime) eval(ctx context.Context, mod api.Module, input []byte) (wasmReply, error) {
+	var reply wasmReply
+	res, err := mod.ExportedFunction("hub_alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return reply, fmt.Errorf("wasm hub_alloc failed: %w", err)
+	}
+	inPtr := uint32(res[0])
+	if !mod.Memory().Write(inPtr, input) {
+		return reply, fmt.Errorf("wasm hub_alloc returned %d, out of memory bounds", inPtr)
+	}
+	res, err = mod.ExportedFunction("hub_eval").Call(ctx, uint64(inPtr), uint64(len(input)))
+	if err != nil {
+		return reply, fmt.Errorf("wasm hub_eval failed: %w", err)
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	out, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return reply, fmt.Errorf("wasm hub_eval returned %d bytes at %d, out of memory bounds", outLen, outPtr)
+	}
+	// Read returns a view of the memory, the next call may overwrite it
+	out = bytes.Clone(out)
+	if free := mod.ExportedFunction("hub_free"); free != nil {
+		if _, err := free.Call(ctx, uint64(inPtr), uint64(len(input))); err != nil {
+			return reply, fmt.Errorf("wasm hub_free failed: %w", err)
+		}
+		if _, err := free.Call(ctx, uint64(outPtr), uint64(outLen)); err != nil {
+			return reply, fmt.Errorf("wasm hub_free failed: %w", err)
+		}
+	}
+
+	// The result is decoded to the return type of Eval by makeRemoteFunc
+	if err := json.Unmarshal(out, &reply); err != nil {
+		return reply, fmt.Errorf("wasm hub_eval returned invalid JSON: %w", err)
+	}
+	return reply, nil
+}
+
+func (r *wasmRuntime) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.idle = nil
+	r.mu.Unlock()
+	r.runtime.Close(context.Background())
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// echoWasm is a module whose hub_eval replies with its first argument: it strips the brackets of
+// the JSON array of arguments. It traps when the argument is a string.
+var echoWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32) -> i32, (i32, i32) -> i64
+	0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e,
+	// functions: hub_alloc, hub_eval
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// memory: 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// exports: memory, hub_alloc, hub_eval
+	0x07, 0x21, 0x03,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x09, 'h', 'u', 'b', '_', 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+	0x08, 'h', 'u', 'b', '_', 'e', 'v', 'a', 'l', 0x00, 0x01,
+	// code
+	0x0a, 0x25, 0x02,
+	// hub_alloc: the buffer is at 0
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	// hub_eval: if mem[ptr+1] == '"' { unreachable }; return (ptr+1)<<32 | (len-2)
+	0x1e, 0x00,
+	0x20, 0x00, 0x2d, 0x00, 0x01, 0x41, 0x22, 0x46, 0x04, 0x40, 0x00, 0x0b,
+	0x20, 0x00, 0x41, 0x01, 0x6a, 0xad, 0x42, 0x20, 0x86,
+	0x20, 0x01, 0x41, 0x02, 0x6b, 0xad, 0x84, 0x0b,
+}
+
+func newWasmTestPlugin(t *testing.T, signature string, module []byte) *Plugin {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "echo.wasm")
+	if err := os.WriteFile(path, module, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := "package plugin\n\n//hub:runtime wasm\n//hub:wasm " + path + "\n\n" + signature + "\n"
+	p, err := NewTestPlugin("", src, "wasm_echo", YAEGI_PLUGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadRuntime(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.wasm.close)
+	return p
+}
+
+func TestWasmRuntimeEval(t *testing.T) {
+	p := newWasmTestPlugin(t, "func Eval(reply interface{}) (interface{}, bool, error) {\n\treturn nil, false, nil\n}", echoWasm)
+	if p.Runtime != RuntimeWasm {
+		t.Fatalf("runtime = %q, want wasm", p.Runtime)
+	}
+
+	// Several calls reuse the pooled instance
+	for i := 0; i < 3; i++ {
+		result, ok, err := p.FuncEvalOther(map[string]interface{}{"result": map[string]interface{}{"n": 3, "f": 1.5}, "ok": true})
+		if err != nil || !ok {
+			t.Fatalf("call %d: ok=%v err=%v", i, ok, err)
+		}
+		m, _ := result.(map[string]interface{})
+		if m["n"] != 3 || m["f"] != 1.5 {
+			t.Fatalf("call %d: result = %#v", i, result)
+		}
+	}
+
+	_, _, err := p.FuncEvalOther(map[string]interface{}{"error": "boom"})
+	if err == nil || err.Error() != "boom" {
+		t.Fatalf("error reply: err = %v", err)
+	}
+}
+
+func TestWasmRuntimeCheck(t *testing.T) {
+	p := newWasmTestPlugin(t, "func Eval(reply interface{}) (bool, error) {\n\treturn false, nil\n}", echoWasm)
+	ok, err := p.FuncEvalCheckNode(map[string]interface{}{"ok": true})
+	if err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	ok, err = p.FuncEvalCheckNode(map[string]interface{}{"ok": false})
+	if err != nil || ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+}
+
+func TestWasmRuntimeTrap(t *testing.T) {
+	p := newWasmTestPlugin(t, "func Eval(reply interface{}) (bool, error) {\n\treturn false, nil\n}", echoWasm)
+	if _, err := p.FuncEvalCheckNode("trap"); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Fatalf("err = %v, want a trap", err)
+	}
+	// The trapped instance is dropped, the next call gets a new one
+	if len(p.wasm.idle) != 0 {
+		t.Fatalf("%d idle instances after a trap", len(p.wasm.idle))
+	}
+	if ok, err := p.FuncEvalCheckNode(map[string]interface{}{"ok": true}); err != nil || !ok {
+		t.Fatalf("after trap: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestWasmRuntimeInvalidModule(t *testing.T) {
+	// Without the code section hub_alloc and hub_eval have no body
+	truncated := echoWasm[:len(echoWasm)-0x27]
+	noExports := append(append([]byte{}, echoWasm[:8]...), 0x05, 0x03, 0x01, 0x00, 0x01)
+	for name, module := range map[string][]byte{"truncated": truncated, "no exports": noExports} {
+		if _, err := newWasmRuntime("invalid", module, 0); err == nil {
+			t.Errorf("%s: module accepted", name)
+		}
+	}
+
+	if _, err := parseRuntime("//hub:runtime wasm\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wasmModulePath("package plugin\n//hub:runtime wasm\n"); err == nil {
+		t.Fatal("a wasm plugin without //hub:wasm was accepted")
+	}
+}
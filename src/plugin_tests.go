@@ -0,0 +1,87 @@
+package main
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/plugin"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// runPluginTests runs the test file of every plugin under config_root and prints the results. It
+// returns the exit code, 1 when a case failed, a plugin or test file is invalid, or a plugin has
+// no tests while require_plugin_tests is set.
+func runPluginTests(cfgRoot string) int {
+	if err := loadHubConfig(cfgRoot); err != nil {
+		fmt.Printf("cannot load config: %v\n", err)
+		return 1
+	}
+	// Only plugins using plugin_kv need Redis
+	if common.Config.Lite {
+		if err := common.RedisInitLite(common.Config.LiteDataFile); err != nil {
+			fmt.Printf("warning: cannot open lite store, plugins using plugin_kv will fail: %v\n", err)
+		}
+	} else if err := common.RedisInit(common.Config.Redis, common.Config.RedisPassword); err != nil {
+		fmt.Printf("warning: Redis is not reachable, plugins using plugin_kv will fail: %v\n", err)
+	}
+	common.InitSecrets(common.Config.Secrets)
+	loadLocalComponents()
+
+	sources := map[string]string{}
+	plugin.PluginsMu.RLock()
+	for name, p := range plugin.Plugins {
+		if p.Type == plugin.YAEGI_PLUGIN {
+			sources[name] = string(p.Payload)
+		}
+	}
+	plugin.PluginsMu.RUnlock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	code := 0
+	var passed, failed int
+	var untested []string
+	for _, name := range names {
+		cases, found, err := plugin.LoadPluginTests(name)
+		if err != nil {
+			fmt.Printf("plugin %s: INVALID %v\n", name, err)
+			code = 1
+			continue
+		}
+		if !found {
+			untested = append(untested, name)
+			continue
+		}
+		p, err := plugin.NewTestSuitePlugin(sources[name], name+"_test_suite")
+		if err != nil {
+			fmt.Printf("plugin %s: INVALID %v\n", name, err)
+			code = 1
+			continue
+		}
+		report := p.RunTests(cases)
+		p.Close()
+		passed += report.Passed
+		failed += report.Failed
+		fmt.Printf("plugin %s: %d passed, %d failed\n", name, report.Passed, report.Failed)
+		for _, res := range report.Results {
+			if !res.Passed {
+				fmt.Printf("  FAIL %s: %s\n", res.Name, res.Failure)
+			}
+		}
+	}
+	if failed > 0 {
+		code = 1
+	}
+	if len(untested) > 0 {
+		fmt.Printf("untested plugins: %s\n", strings.Join(untested, ", "))
+		if common.Config.RequirePluginTests {
+			code = 1
+		}
+	}
+
+	fmt.Printf("\nResult: %d passed, %d failed, %d/%d plugins tested\n", passed, failed, len(names)-len(untested), len(names))
+	return code
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/output"
+	"AgentSmith-HUB/plugin"
+	"AgentSmith-HUB/project"
+	"AgentSmith-HUB/rules_engine"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	preflightPass = "PASS"
+	preflightWarn = "WARN"
+	preflightFail = "FAIL"
+	preflightSkip = "SKIP"
+)
+
+type preflightResult struct {
+	status string
+	check  string
+	detail string
+}
+
+// preflightReport collects the results of the checks run by --preflight
+type preflightReport struct {
+	results []preflightResult
+}
+
+func (r *preflightReport) add(status, check, format string, args ...interface{}) {
+	r.results = append(r.results, preflightResult{status: status, check: check, detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *preflightReport) count(status string) int {
+	n := 0
+	for _, res := range r.results {
+		if res.status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *preflightReport) print(cfgRoot string) {
+	fmt.Printf("AgentSmith-HUB preflight report (config_root: %s)\n\n", cfgRoot)
+	width := 0
+	for _, res := range r.results {
+		width = max(width, len(res.check))
+	}
+	for _, res := range r.results {
+		fmt.Printf("[%s] %-*s  %s\n", res.status, width, res.check, res.detail)
+	}
+	failed, warned := r.count(preflightFail), r.count(preflightWarn)
+	fmt.Println()
+	if failed > 0 {
+		fmt.Printf("Result: NOT READY (%d failed, %d warnings)\n", failed, warned)
+	} else {
+		fmt.Printf("Result: READY (%d warnings)\n", warned)
+	}
+}
+
+// runPreflight checks that this node can start and serve traffic without starting it: config,
+// Redis connectivity and permissions, listen ports, component configs and output reachability.
+// It prints a readiness report and returns the process exit code, 0 when nothing failed.
+func runPreflight(cfgRoot, apiListen string, isLeader bool) int {
+	report := &preflightReport{}
+	defer report.print(cfgRoot)
+
+	if !preflightConfig(report, cfgRoot) {
+		return 1
+	}
+	if common.Config.Lite {
+		isLeader = true
+	}
+
+	preflightPorts(report, apiListen)
+
+	if !preflightRedis(report) {
+		report.add(preflightSkip, "components", "Redis is not reachable")
+		report.add(preflightSkip, "outputs", "Redis is not reachable")
+		return 1
+	}
+
+	if !isLeader {
+		report.add(preflightSkip, "components", "followers load components from the leader")
+		report.add(preflightSkip, "outputs", "followers load components from the leader")
+	} else {
+		preflightComponents(report)
+		preflightOutputs(report)
+	}
+
+	if report.count(preflightFail) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func preflightConfig(report *preflightReport, cfgRoot string) bool {
+	if info, err := os.Stat(cfgRoot); err != nil || !info.IsDir() {
+		report.add(preflightFail, "config", "config_root %s is not a directory", cfgRoot)
+		return false
+	}
+
+	cfgFile := filepath.Join(cfgRoot, "config.yaml")
+	data, err := os.ReadFile(cfgFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.add(preflightWarn, "config", "%s not found, using environment variables only", cfgFile)
+	case err != nil:
+		report.add(preflightFail, "config", "cannot read %s: %v", cfgFile, err)
+		return false
+	default:
+		var cfg common.HubConfig
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			report.add(preflightFail, "config", "invalid %s: %v", cfgFile, err)
+			return false
+		}
+	}
+
+	if err := loadHubConfig(cfgRoot); err != nil {
+		report.add(preflightFail, "config", "%v", err)
+		return false
+	}
+	if common.Config.Lite {
+		report.add(preflightPass, "config", "loaded, lite mode with data file %s", common.Config.LiteDataFile)
+	} else {
+		report.add(preflightPass, "config", "loaded, Redis %s", common.Config.Redis)
+	}
+	return true
+}
+
+// preflightPorts checks that the listen addresses of this node are free
+func preflightPorts(report *preflightReport, apiListen string) {
+	addrs := map[string]string{"api": apiListen}
+	if common.Config.PprofEnable {
+		pprofAddr := common.Config.PprofPort
+		if pprofAddr == "" {
+			pprofAddr = "0.0.0.0:6060"
+		} else if !strings.Contains(pprofAddr, ":") {
+			pprofAddr = "0.0.0.0:" + pprofAddr
+		}
+		addrs["pprof"] = pprofAddr
+	}
+	for _, name := range []string{"api", "pprof"} {
+		addr, ok := addrs[name]
+		if !ok {
+			continue
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			report.add(preflightFail, "port "+name, "%s is not available: %v", addr, err)
+			continue
+		}
+		_ = ln.Close()
+		report.add(preflightPass, "port "+name, "%s is available", addr)
+	}
+}
+
+func preflightRedis(report *preflightReport) bool {
+	if common.Config.Lite {
+		if err := common.RedisInitLite(common.Config.LiteDataFile); err != nil {
+			report.add(preflightFail, "redis", "cannot open lite store: %v", err)
+			return false
+		}
+		report.add(preflightPass, "redis", "lite store opened")
+		return true
+	}
+
+	if err := common.RedisInit(common.Config.Redis, common.Config.RedisPassword); err != nil {
+		report.add(preflightFail, "redis", "cannot connect to %s: %v", common.Config.Redis, err)
+		return false
+	}
+	report.add(preflightPass, "redis", "connected to %s", common.Config.Redis)
+
+	var denied []string
+	for _, c := range common.RedisCheckAccess() {
+		if c.Err != nil {
+			denied = append(denied, fmt.Sprintf("%s (%v)", c.Command, c.Err))
+		}
+	}
+	if len(denied) > 0 {
+		report.add(preflightFail, "redis acl", "commands refused: %s", strings.Join(denied, "; "))
+	} else {
+		report.add(preflightPass, "redis acl", "all commands used by the hub are allowed")
+	}
+	return true
+}
+
+// preflightComponents loads the components under config_root and reports the ones that do not parse
+func preflightComponents(report *preflightReport) {
+	loadLocalComponents()
+
+	var failed []string
+	total := 0
+	plugin.PluginsMu.RLock()
+	for name, p := range plugin.Plugins {
+		total++
+		if p.Status == common.StatusError {
+			failed = append(failed, fmt.Sprintf("plugin %s: %v", name, p.Err))
+		}
+	}
+	plugin.PluginsMu.RUnlock()
+	project.ForEachInput(func(id string, in *input.Input) bool {
+		total++
+		if in.Status == common.StatusError {
+			failed = append(failed, fmt.Sprintf("input %s: %v", id, in.Err))
+		}
+		return true
+	})
+	project.ForEachOutput(func(id string, out *output.Output) bool {
+		total++
+		if out.Status == common.StatusError {
+			failed = append(failed, fmt.Sprintf("output %s: %v", id, out.Err))
+		}
+		return true
+	})
+	project.ForEachRuleset(func(id string, rs *rules_engine.Ruleset) bool {
+		total++
+		if rs.Status == common.StatusError {
+			failed = append(failed, fmt.Sprintf("ruleset %s: %v", id, rs.Err))
+		}
+		return true
+	})
+
+	// Projects are parsed in test mode so nothing is registered or written to Redis
+	for _, f := range traverseComponents(path.Join(common.Config.ConfigRoot, "project"), ".yaml") {
+		id := common.GetFileNameWithoutExt(f)
+		total++
+		if _, err := project.NewProject(f, "", id, true); err != nil {
+			failed = append(failed, fmt.Sprintf("project %s: %v", id, err))
+		}
+	}
+
+	sort.Strings(failed)
+	for _, f := range failed {
+		report.add(preflightFail, "components", "%s", f)
+	}
+	if len(failed) == 0 {
+		report.add(preflightPass, "components", "%d components parsed", total)
+	}
+}
+
+// preflightOutputs checks the reachability of every output. Outputs of projects meant to be
+// running must be reachable, the others only warn.
+func preflightOutputs(report *preflightReport) {
+	required := map[string]bool{}
+	for _, f := range traverseComponents(path.Join(common.Config.ConfigRoot, "project"), ".yaml") {
+		id := common.GetFileNameWithoutExt(f)
+		if running, err := common.GetProjectUserIntention(id); err != nil || !running {
+			continue
+		}
+		p, err := project.NewProject(f, "", id, true)
+		if err != nil {
+			continue
+		}
+		project.ForEachOutput(func(outID string, _ *output.Output) bool {
+			if p.CheckExist("OUTPUT", outID) {
+				required[outID] = true
+			}
+			return true
+		})
+	}
+
+	var outputs []*output.Output
+	project.ForEachOutput(func(id string, out *output.Output) bool {
+		if out.Status != common.StatusError {
+			outputs = append(outputs, out)
+		}
+		return true
+	})
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Id < outputs[j].Id })
+
+	for _, out := range outputs {
+		check := "output " + out.Id
+		result := out.CheckConnectivity()
+		status, _ := result["status"].(string)
+		switch {
+		case status == "error" && required[out.Id]:
+			report.add(preflightFail, check, "%v", result["message"])
+		case status == "error":
+			report.add(preflightWarn, check, "%v (not used by a running project)", result["message"])
+		case status == "warning":
+			report.add(preflightWarn, check, "%v", result["message"])
+		default:
+			report.add(preflightPass, check, "%v", result["message"])
+		}
+	}
+	if len(outputs) == 0 {
+		report.add(preflightSkip, "outputs", "no outputs configured")
+	}
+}
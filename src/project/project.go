@@ -7,10 +7,13 @@ import (
 	"AgentSmith-HUB/output"
 	"AgentSmith-HUB/plugin"
 	"AgentSmith-HUB/rules_engine"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
+	"runtime/pprof"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -77,6 +80,28 @@ func collectAllComponentStats() []common.DailyStatsData {
 					TotalMessages:       increment,
 				})
 			}
+
+			// Matches suppressed by <suppress>, per rule
+			for ruleID, suppressed := range r.GetSuppressedIncrementAndUpdate() {
+				components = append(components, common.DailyStatsData{
+					ProjectID:           proj.Id,
+					ComponentID:         r.RulesetID,
+					ComponentType:       "rule_suppressed",
+					ProjectNodeSequence: fmt.Sprintf("SUPPRESS.%s.%s", r.RulesetID, ruleID),
+					TotalMessages:       suppressed,
+				})
+			}
+
+			// Events dropped by the rules of EXCLUDE rulesets, per rule
+			for ruleID, excluded := range r.GetExcludedIncrementAndUpdate() {
+				components = append(components, common.DailyStatsData{
+					ProjectID:           proj.Id,
+					ComponentID:         r.RulesetID,
+					ComponentType:       "rule_excluded",
+					ProjectNodeSequence: fmt.Sprintf("EXCLUDE.%s.%s", r.RulesetID, ruleID),
+					TotalMessages:       excluded,
+				})
+			}
 		}
 	}
 
@@ -111,6 +136,44 @@ func collectAllComponentStats() []common.DailyStatsData {
 	return components
 }
 
+// collectDeliveryReceipts gathers delivery counter increments from the outputs of all projects.
+// Stopped projects are included so increments recorded right before a stop are not lost.
+func collectDeliveryReceipts() []common.DeliveryReceiptData {
+	var data []common.DeliveryReceiptData
+	ForEachProject(func(id string, proj *Project) bool {
+		for _, o := range proj.Outputs {
+			inc := o.GetDeliveryReceipts().GetIncrementAndUpdate()
+			if inc == (common.DeliveryCounts{}) {
+				continue
+			}
+			data = append(data, common.DeliveryReceiptData{
+				ProjectID: proj.Id,
+				OutputID:  o.Id,
+				Counts:    inc,
+			})
+		}
+		return true
+	})
+	return data
+}
+
+// collectChannelQueues returns the queued message count of every channel of the running projects
+func collectChannelQueues() map[string]map[string]int {
+	queues := make(map[string]map[string]int)
+	ForEachProject(func(id string, proj *Project) bool {
+		if proj.Status != common.StatusRunning || proj.Testing {
+			return true
+		}
+		channels := make(map[string]int, len(proj.MsgChannels))
+		for pns, ch := range proj.MsgChannels {
+			channels[pns] = len(*ch)
+		}
+		queues[id] = channels
+		return true
+	})
+	return queues
+}
+
 // GetAffectedProjects returns the list of project IDs affected by component changes
 func GetAffectedProjects(componentType string, componentID string) []string {
 	affectedProjects := make(map[string]struct{})
@@ -199,6 +262,34 @@ func GetAffectedProjects(componentType string, componentID string) []string {
 					}
 				}
 				
+				// Check in GroupMap (nested check nodes of all/any/not groups)
+				if !pluginUsed {
+					for _, group := range rule.GroupMap {
+						group.ForEachCheckNode(func(checkNode *rules_engine.CheckNodes) {
+							if checkNode.Plugin != nil && checkNode.Plugin.Name == componentID {
+								pluginUsed = true
+							}
+						})
+						if pluginUsed {
+							break
+						}
+					}
+				}
+				
+				// Check in SequenceMap (check nodes of sequence steps)
+				if !pluginUsed {
+					for _, sequence := range rule.SequenceMap {
+						sequence.ForEachCheckNode(func(checkNode *rules_engine.CheckNodes) {
+							if checkNode.Plugin != nil && checkNode.Plugin.Name == componentID {
+								pluginUsed = true
+							}
+						})
+						if pluginUsed {
+							break
+						}
+					}
+				}
+				
 				// Check in AppendsMap (append operations)
 				if !pluginUsed {
 					for _, appendOp := range rule.AppendsMap {
@@ -362,39 +453,51 @@ func checkAllProjectComponentsImpl() []common.ProjectComponentError {
 
 		// Check input components
 		for _, inputComp := range proj.Inputs {
-			if inputComp.Err != nil {
+			err := inputComp.Err
+			if err == nil {
+				err = common.GetComponentProbeError("input", inputComp.Id)
+			}
+			if err != nil {
 				errors = append(errors, common.ProjectComponentError{
 					ProjectID:   projectID,
 					ComponentID: inputComp.Id,
 					Type:        "input",
 					Status:      inputComp.Status,
-					Error:       inputComp.Err,
+					Error:       err,
 				})
 			}
 		}
 
 		// Check output components
 		for _, outputComp := range proj.Outputs {
-			if outputComp.Err != nil {
+			err := outputComp.Err
+			if err == nil {
+				err = common.GetComponentProbeError("output", outputComp.Id)
+			}
+			if err != nil {
 				errors = append(errors, common.ProjectComponentError{
 					ProjectID:   projectID,
 					ComponentID: outputComp.Id,
 					Type:        "output",
 					Status:      outputComp.Status,
-					Error:       outputComp.Err,
+					Error:       err,
 				})
 			}
 		}
 
 		// Check ruleset components
 		for _, rulesetComp := range proj.Rulesets {
-			if rulesetComp.Err != nil {
+			err := rulesetComp.Err
+			if err == nil {
+				err = common.GetComponentProbeError("ruleset", rulesetComp.RulesetID)
+			}
+			if err != nil {
 				errors = append(errors, common.ProjectComponentError{
 					ProjectID:   projectID,
 					ComponentID: rulesetComp.RulesetID,
 					Type:        "ruleset",
 					Status:      rulesetComp.Status,
-					Error:       rulesetComp.Err,
+					Error:       err,
 				})
 			}
 		}
@@ -405,6 +508,68 @@ func checkAllProjectComponentsImpl() []common.ProjectComponentError {
 	return errors
 }
 
+// runProbePlugin evaluates a checknode plugin for a health probe
+func runProbePlugin(pluginName, componentType, componentID string) (bool, error) {
+	plugin.PluginsMu.RLock()
+	p, ok := plugin.Plugins[pluginName]
+	plugin.PluginsMu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("plugin not found: %s", pluginName)
+	}
+	if p.ReturnType != "bool" {
+		return false, fmt.Errorf("plugin %s must return bool to be used as a probe", pluginName)
+	}
+	return p.FuncEvalCheckNode(componentType, componentID)
+}
+
+// injectCanaryEvents injects one signed canary event into every input of each running project
+func injectCanaryEvents() {
+	cm := common.GlobalCanaryMonitor
+	if cm == nil {
+		return
+	}
+
+	type canaryInput struct {
+		in      *input.Input
+		targets []string
+	}
+	type target struct {
+		projectID string
+		inputs    []canaryInput
+		outputs   []string
+	}
+	var targets []target
+
+	ForEachProject(func(projectID string, proj *Project) bool {
+		if proj.Status != common.StatusRunning || proj.Testing {
+			return true
+		}
+		t := target{projectID: projectID}
+		// Inputs may be shared, the canary only enters this project's components and is only counted at its outputs
+		downstream := make(map[string][]string)
+		for _, node := range proj.FlowNodes {
+			if node.FromType == "INPUT" {
+				downstream[node.FromPNS] = append(downstream[node.FromPNS], node.ToPNS)
+			}
+			if node.ToType == "OUTPUT" && !slices.Contains(t.outputs, node.ToPNS) {
+				t.outputs = append(t.outputs, node.ToPNS)
+			}
+		}
+		for pns, in := range proj.Inputs {
+			t.inputs = append(t.inputs, canaryInput{in: in, targets: downstream[pns]})
+		}
+		targets = append(targets, t)
+		return true
+	})
+
+	// Inject without holding the global lock
+	for _, t := range targets {
+		for _, ci := range t.inputs {
+			ci.in.InjectCanary(cm.NewEvent(t.projectID, ci.in.Id, t.outputs), ci.targets)
+		}
+	}
+}
+
 // SetProjectErrorStatus sets a project status to error with detailed error information
 func SetProjectErrorStatus(projectID string, componentErrors []common.ProjectComponentError) {
 	proj, exists := GetProject(projectID)
@@ -427,6 +592,7 @@ func SetProjectErrorStatus(projectID string, componentErrors []common.ProjectCom
 	// Set project to error status
 	err := fmt.Errorf("%s", errorMsg.String())
 	proj.SetProjectStatus(common.StatusStopped, err)
+	proj.runHooks(ProjectHookCrash, err)
 
 	logger.Error("Project set to error status due to component failures",
 		"project", projectID,
@@ -457,6 +623,21 @@ func init() {
 
 	// Register the project error setter function
 	common.SetProjectErrorSetter(SetProjectErrorStatus)
+
+	// Register the canary injector used for end-to-end latency measurement
+	common.SetCanaryInjector(injectCanaryEvents)
+
+	// Register the delivery receipt collector used for reconciliation reports
+	common.SetDeliveryReceiptCollector(collectDeliveryReceipts)
+
+	// Register the plugin runner used by plugin health probes
+	common.SetProbePluginRunner(runProbePlugin)
+
+	// Register the channel queue collector used by the leak detector
+	common.SetChannelQueueCollector(collectChannelQueues)
+
+	// Register the output lookup used by router outputs to find their child outputs
+	output.SetComponentResolver(GetOutput)
 }
 
 func Verify(path string, raw string) error {
@@ -509,6 +690,10 @@ func Verify(path string, raw string) error {
 		return fmt.Errorf("project content cannot be empty in configuration file")
 	}
 
+	if err := verifyProjectHooks(cfg.Hooks); err != nil {
+		return fmt.Errorf("invalid project hooks: %w", err)
+	}
+
 	p = &Project{
 		Id:     cfg.Id,
 		Status: common.StatusStopped,
@@ -547,6 +732,10 @@ func Verify(path string, raw string) error {
 		return fmt.Errorf("failed to parse project content: %v", errMsg)
 	}
 
+	if err := p.verifyDelivery(); err != nil {
+		return fmt.Errorf("invalid project delivery: %w", err)
+	}
+
 	return nil
 }
 
@@ -654,6 +843,18 @@ func (p *Project) parseContent() error {
 		from := strings.TrimSpace(parts[0])
 		to := strings.TrimSpace(parts[1])
 
+		// Optional verdict routing suffix, e.g. "RULESET.triage -> OUTPUT.alert [match]" or "INPUT.edr -> OUTPUT.bad_events [quarantine]"
+		verdict := ""
+		if strings.HasSuffix(to, "]") {
+			if idx := strings.LastIndex(to, "["); idx > 0 {
+				verdict = strings.ToLower(strings.TrimSpace(to[idx+1 : len(to)-1]))
+				to = strings.TrimSpace(to[:idx])
+				if verdict != rules_engine.VerdictMatch && verdict != rules_engine.VerdictNoMatch && verdict != QuarantineVerdict {
+					return fmt.Errorf("invalid verdict at line %d: [%s] (expected [%s], [%s] or [%s])", lineNum+1, verdict, rules_engine.VerdictMatch, rules_engine.VerdictNoMatch, QuarantineVerdict)
+				}
+			}
+		}
+
 		// Validate node types
 		fromType, fromID := parseNode(from)
 		toType, toID := parseNode(to)
@@ -671,6 +872,14 @@ func (p *Project) parseContent() error {
 			return fmt.Errorf("OUTPUT node %q cannot be a source at line %d", from, lineNum+1)
 		}
 
+		if verdict == QuarantineVerdict {
+			if fromType != "INPUT" {
+				return fmt.Errorf("verdict [%s] at line %d is only allowed on edges from an INPUT", verdict, lineNum+1)
+			}
+		} else if verdict != "" && fromType != "RULESET" {
+			return fmt.Errorf("verdict [%s] at line %d is only allowed on edges from a RULESET", verdict, lineNum+1)
+		}
+
 		// Check for duplicate flows
 		edgeKey := from + "->" + to
 		if _, exists := edgeSet[edgeKey]; exists {
@@ -688,6 +897,7 @@ func (p *Project) parseContent() error {
 			ToID:     toID,
 			ToType:   toType,
 			Content:  line,
+			Verdict:  verdict,
 		}
 
 		p.FlowNodes = append(p.FlowNodes, tmpNode)
@@ -926,6 +1136,20 @@ func (p *Project) validateComponentExistence(flowGraph map[string][]string) erro
 		if err := p.validateComponent(node.ToType, node.ToID, lineNum, "destination"); err != nil {
 			return err
 		}
+
+		if node.Verdict == QuarantineVerdict {
+			if in, ok := GetInput(node.FromID); ok && (in.Config == nil || in.Config.Schema == nil) {
+				return fmt.Errorf("verdict [%s] at line %d requires input '%s' to declare a schema", node.Verdict, lineNum, node.FromID)
+			}
+		} else if node.Verdict != "" {
+			if rs, ok := GetRuleset(node.FromID); ok && rs.ChainMode != rules_engine.ChainModeRoute {
+				return fmt.Errorf("verdict [%s] at line %d requires ruleset '%s' to use chain=\"%s\"", node.Verdict, lineNum, node.FromID, rules_engine.ChainModeRoute)
+			}
+		}
+	}
+
+	if err := p.verifyExcludeOrder(contentLineMap); err != nil {
+		return err
 	}
 
 	// Skip PNS duplication check for testing projects
@@ -984,6 +1208,46 @@ func (p *Project) validateComponentExistence(flowGraph map[string][]string) erro
 	return nil
 }
 
+// verifyExcludeOrder rejects EXCLUDE rulesets downstream of a DETECTION ruleset: exclusions drop
+// noisy events before any detection sees them, not after
+func (p *Project) verifyExcludeOrder(contentLineMap map[string]int) error {
+	// detectionAbove memoizes the first DETECTION ruleset at or above a ruleset, "" when none
+	detectionAbove := make(map[string]string)
+	var above func(rulesetID string) string
+	above = func(rulesetID string) string {
+		if found, ok := detectionAbove[rulesetID]; ok {
+			return found
+		}
+		detectionAbove[rulesetID] = ""
+		if rs, ok := GetRuleset(rulesetID); ok && rs.IsDetection {
+			detectionAbove[rulesetID] = rulesetID
+			return rulesetID
+		}
+		for _, node := range p.FlowNodes {
+			if node.ToType == "RULESET" && node.ToID == rulesetID && node.FromType == "RULESET" {
+				if found := above(node.FromID); found != "" {
+					detectionAbove[rulesetID] = found
+					return found
+				}
+			}
+		}
+		return ""
+	}
+
+	for _, node := range p.FlowNodes {
+		if node.FromType != "RULESET" || node.ToType != "RULESET" {
+			continue
+		}
+		if rs, ok := GetRuleset(node.ToID); !ok || rs.IsDetection {
+			continue
+		}
+		if detection := above(node.FromID); detection != "" {
+			return fmt.Errorf("EXCLUDE ruleset '%s' at line %d runs after DETECTION ruleset '%s', place exclusions before the detection rulesets", node.ToID, contentLineMap[node.Content], detection)
+		}
+	}
+	return nil
+}
+
 // validateComponent validates a single component exists in the system (unified approach)
 func (p *Project) validateComponent(componentType, componentID string, lineNum int, position string) error {
 	componentType = strings.ToUpper(componentType)
@@ -1022,6 +1286,10 @@ func (p *Project) Start(lock bool) error {
 		p.SetProjectStatus(common.StatusError, fmt.Errorf("project parse error: %s", err.Error()))
 		return fmt.Errorf("project parse error: %s", err.Error())
 	}
+	if err := p.verifyDelivery(); err != nil {
+		p.SetProjectStatus(common.StatusError, fmt.Errorf("invalid project delivery: %w", err))
+		return fmt.Errorf("invalid project delivery: %w", err)
+	}
 
 	// Add panic recovery for critical state changes
 	defer func() {
@@ -1043,7 +1311,13 @@ func (p *Project) Start(lock bool) error {
 	p.stopOnce = sync.Once{}
 	p.stopChan = make(chan struct{})
 
-	err = p.initComponents()
+	// Goroutines started by the components inherit the project label, the leak detector counts them per project
+	var runErr error
+	pprof.Do(context.Background(), pprof.Labels(common.LeakProjectLabel, p.Id), func(context.Context) {
+		if err = p.initComponents(); err == nil {
+			runErr = p.runComponents()
+		}
+	})
 	if err != nil {
 		// Stop all components that may have been partially initialized
 		_ = p.stopComponentsInternal()
@@ -1051,7 +1325,7 @@ func (p *Project) Start(lock bool) error {
 		return fmt.Errorf("failed to initialize project components: %w", err)
 	}
 
-	err = p.runComponents()
+	err = runErr
 	if err != nil {
 		// Stop all components that were initialized and may have been started
 		_ = p.stopComponentsInternal()
@@ -1061,6 +1335,7 @@ func (p *Project) Start(lock bool) error {
 
 	// All components started successfully, set project to running
 	p.SetProjectStatus(common.StatusRunning, nil)
+	p.runHooks(ProjectHookStart, nil)
 
 	logger.Info("Project started successfully", "project", p.Id)
 	return nil
@@ -1125,6 +1400,10 @@ func (p *Project) Stop(lock bool) error {
 			return fmt.Errorf("failed to stop project components: %w", err)
 		}
 		p.SetProjectStatus(common.StatusStopped, nil)
+		p.runHooks(ProjectHookStop, nil)
+		if common.GlobalCanaryMonitor != nil {
+			common.GlobalCanaryMonitor.RemoveProject(p.Id)
+		}
 		logger.Info("Project stopped successfully", "project", p.Id)
 		return nil
 	case <-overallTimeout:
@@ -1134,6 +1413,7 @@ func (p *Project) Stop(lock bool) error {
 		logger.Warn("Stop operation timed out, forcing cleanup and stopped status (goroutine may still be running)", "project", p.Id)
 		p.cleanup()
 		p.SetProjectStatus(common.StatusStopped, nil)
+		p.runHooks(ProjectHookStop, nil)
 
 		// Give components extra time to actually stop before next start
 		// This mitigates "component is not stopped" errors on restart
@@ -1442,6 +1722,7 @@ func (p *Project) disconnectInputsFromDownstream() {
 			logger.Debug("Disconnected input from downstream",
 				"project", p.Id, "input", in.Id, "downstream", downstreamID)
 		}
+		in.SetAtLeastOnce(p.Id, false)
 	}
 	logger.Info("All inputs disconnected from downstream", "project", p.Id)
 }
@@ -1637,7 +1918,7 @@ func (p *Project) initComponents() error {
 				nodeChannelStatus[node.ToPNS] = false
 			} else {
 				// Get the original ruleset using safe accessor
-				originalRuleset, exists := GetRuleset(node.ToID)
+				originalRuleset, exists := p.getRuleset(node.ToID)
 
 				if !exists {
 					cleanup()
@@ -1686,6 +1967,8 @@ func (p *Project) initComponents() error {
 					return fmt.Errorf("failed to create test output component: %s %w", node.ToPNS, err)
 				}
 
+				testOutput.ProjectID = p.Id
+
 				// Set test-specific properties to avoid pollution
 				testOutput.SetTestMode() // Disable sampling and global state interactions
 
@@ -1721,6 +2004,8 @@ func (p *Project) initComponents() error {
 						return fmt.Errorf("failed to create output from existing: %s %w", node.ToPNS, err)
 					}
 
+					o.ProjectID = p.Id
+
 					// Use safe accessor to set PNS output
 					SetPNSOutput(node.ToPNS, o)
 
@@ -1748,7 +2033,7 @@ func (p *Project) initComponents() error {
 				p.Rulesets[node.FromPNS] = rs
 			} else {
 				// Get the original ruleset using safe accessor
-				originalRuleset, exists := GetRuleset(node.FromID)
+				originalRuleset, exists := p.getRuleset(node.FromID)
 
 				if !exists {
 					cleanup()
@@ -1817,6 +2102,9 @@ func (p *Project) initComponents() error {
 		switch node.FromType {
 		case "RULESET":
 			if fromRs, exists := p.Rulesets[node.FromPNS]; exists {
+				if node.Verdict != "" {
+					fromRs.DownStreamVerdict[node.ToPNS] = node.Verdict
+				}
 				// Always try to establish connection regardless of channel creation status
 				// This ensures shared PNS components get properly connected
 				if toChannel, channelExists := p.MsgChannels[node.ToPNS]; channelExists {
@@ -1840,6 +2128,17 @@ func (p *Project) initComponents() error {
 			}
 		case "INPUT":
 			if fromInput, exists := p.Inputs[node.FromPNS]; exists {
+				if !p.Testing {
+					fromInput.SetAtLeastOnce(p.Id, p.Config.AtLeastOnce())
+				}
+				if node.Verdict == QuarantineVerdict {
+					if fromInput.QuarantineStream == nil {
+						fromInput.QuarantineStream = make(map[string]bool)
+					}
+					fromInput.QuarantineStream[node.ToPNS] = true
+				} else {
+					delete(fromInput.QuarantineStream, node.ToPNS)
+				}
 				// Always try to establish connection
 				if toChannel, channelExists := p.MsgChannels[node.ToPNS]; channelExists {
 					fromInput.DownStream[node.ToPNS] = toChannel
@@ -1892,6 +2191,14 @@ func (p *Project) initComponents() error {
 	return nil
 }
 
+// getRuleset resolves the ruleset a flow node refers to, preferring the project's overrides
+func (p *Project) getRuleset(id string) (*rules_engine.Ruleset, bool) {
+	if rs, ok := p.RulesetOverrides[id]; ok {
+		return rs, true
+	}
+	return GetRuleset(id)
+}
+
 func (p *Project) runComponents() error {
 	// Start components in reverse dependency order: outputs -> rulesets -> inputs
 	// This ensures downstream components are ready before upstream starts producing data
@@ -2022,4 +2329,8 @@ func (p *Project) SetProjectStatus(status common.Status, err error) {
 	t := time.Now()
 	p.StatusChangedAt = &t
 	updateProjectStatusRedis(p.Id, status, t)
+
+	if status == common.StatusError {
+		p.runHooks(ProjectHookCrash, err)
+	}
 }
@@ -0,0 +1,66 @@
+package project
+
+import (
+	"AgentSmith-HUB/input"
+	"fmt"
+)
+
+const (
+	DeliveryBestEffort  = "best_effort"   // offsets are committed once events are handed to the pipeline (default)
+	DeliveryAtLeastOnce = "at_least_once" // offsets are committed once every output confirmed the events
+)
+
+// AtLeastOnce reports whether the project asks for at-least-once delivery
+func (cfg *ProjectConfig) AtLeastOnce() bool {
+	return cfg != nil && cfg.Delivery == DeliveryAtLeastOnce
+}
+
+// verifyDelivery checks the delivery mode of a project. At-least-once needs inputs with committable
+// offsets and outputs confirming their deliveries; components not loaded yet are checked on start.
+func (p *Project) verifyDelivery() error {
+	switch p.Config.Delivery {
+	case "", DeliveryBestEffort:
+		return nil
+	case DeliveryAtLeastOnce:
+	default:
+		return fmt.Errorf("invalid delivery %q, must be %s or %s", p.Config.Delivery, DeliveryBestEffort, DeliveryAtLeastOnce)
+	}
+
+	checked := make(map[string]bool)
+	check := func(t, id string) error {
+		if checked[t+"."+id] {
+			return nil
+		}
+		checked[t+"."+id] = true
+		switch t {
+		case "INPUT":
+			in, ok := GetInput(id)
+			if !ok {
+				return nil
+			}
+			switch in.Type {
+			case input.InputTypeKafka, input.InputTypeKafkaAzure, input.InputTypeKafkaAWS:
+				return nil
+			}
+			return fmt.Errorf("input %s of type %s has no offsets to commit, %s needs Kafka inputs", id, in.Type, DeliveryAtLeastOnce)
+		case "OUTPUT":
+			out, ok := GetOutput(id)
+			if !ok {
+				return nil
+			}
+			if err := out.CheckAtLeastOnce(); err != nil {
+				return fmt.Errorf("%v, %s needs Kafka, Elasticsearch, ClickHouse, PostgreSQL, MySQL, Snowflake, BigQuery or print outputs", err, DeliveryAtLeastOnce)
+			}
+		}
+		return nil
+	}
+	for _, node := range p.FlowNodes {
+		if err := check(node.FromType, node.FromID); err != nil {
+			return err
+		}
+		if err := check(node.ToType, node.ToID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
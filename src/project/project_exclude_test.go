@@ -0,0 +1,54 @@
+package project
+
+import (
+	"strings"
+	"testing"
+
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/output"
+	"AgentSmith-HUB/rules_engine"
+)
+
+func TestVerifyExcludeOrder(t *testing.T) {
+	SetInput("in", &input.Input{})
+	SetOutput("out", &output.Output{})
+	SetRuleset("exclude", &rules_engine.Ruleset{})
+	SetRuleset("exclude_more", &rules_engine.Ruleset{})
+	SetRuleset("detect", &rules_engine.Ruleset{IsDetection: true})
+	SetRuleset("enrich", &rules_engine.Ruleset{IsDetection: true})
+	t.Cleanup(func() {
+		DeleteInput("in")
+		DeleteOutput("out")
+		for _, id := range []string{"exclude", "exclude_more", "detect", "enrich"} {
+			DeleteRuleset(id)
+		}
+	})
+
+	parse := func(content string) error {
+		p := &Project{Config: &ProjectConfig{Content: content}, Testing: true}
+		return p.parseContent()
+	}
+
+	for _, content := range []string{
+		"INPUT.in -> RULESET.exclude\nRULESET.exclude -> RULESET.detect\nRULESET.detect -> OUTPUT.out",
+		"INPUT.in -> RULESET.exclude\nRULESET.exclude -> RULESET.exclude_more\nRULESET.exclude_more -> RULESET.detect\nRULESET.detect -> OUTPUT.out",
+		// Detections on separate branches of the same exclusion
+		"INPUT.in -> RULESET.exclude\nRULESET.exclude -> RULESET.detect\nRULESET.exclude -> RULESET.enrich\nRULESET.detect -> OUTPUT.out\nRULESET.enrich -> OUTPUT.out",
+	} {
+		if err := parse(content); err != nil {
+			t.Errorf("exclusions before detections rejected: %v\n%s", err, content)
+		}
+	}
+
+	for content, wantDetection := range map[string]string{
+		"INPUT.in -> RULESET.detect\nRULESET.detect -> RULESET.exclude\nRULESET.exclude -> OUTPUT.out":                                                                                 "detect",
+		"INPUT.in -> RULESET.enrich\nRULESET.enrich -> RULESET.exclude\nRULESET.exclude -> RULESET.exclude_more\nRULESET.exclude_more -> OUTPUT.out":                                   "enrich",
+		"INPUT.in -> RULESET.exclude\nRULESET.exclude -> RULESET.detect\nRULESET.detect -> RULESET.exclude_more\nRULESET.exclude_more -> OUTPUT.out":                                   "detect",
+		"INPUT.in -> RULESET.detect\nINPUT.in -> RULESET.exclude\nRULESET.detect -> RULESET.exclude_more\nRULESET.exclude -> RULESET.exclude_more\nRULESET.exclude_more -> OUTPUT.out": "detect",
+	} {
+		err := parse(content)
+		if err == nil || !strings.Contains(err.Error(), "after DETECTION ruleset '"+wantDetection+"'") {
+			t.Errorf("exclusion after %s not rejected: %v\n%s", wantDetection, err, content)
+		}
+	}
+}
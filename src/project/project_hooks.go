@@ -0,0 +1,220 @@
+package project
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/plugin"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ProjectHookStart = "start"
+	ProjectHookStop  = "stop"
+	ProjectHookCrash = "crash" // the project failed to start, stop, or was stopped by a component failure
+
+	defaultProjectHookTimeout = 10 * time.Second
+)
+
+// ProjectHookConfig is an HTTP call or plugin invocation run when a project starts, stops or crashes
+type ProjectHookConfig struct {
+	Name       string            `yaml:"name,omitempty"`
+	On         []string          `yaml:"on"`                    // start, stop and/or crash
+	Type       string            `yaml:"type"`                  // http or plugin
+	URL        string            `yaml:"url,omitempty"`         // http only
+	Method     string            `yaml:"method,omitempty"`      // http only, default POST
+	Headers    map[string]string `yaml:"headers,omitempty"`     // http only
+	Body       string            `yaml:"body,omitempty"`        // http only, Go template over the hook payload, default the payload as JSON
+	Plugin     string            `yaml:"plugin,omitempty"`      // plugin only, called with the hook payload
+	Timeout    string            `yaml:"timeout,omitempty"`     // default 10s
+	LeaderOnly bool              `yaml:"leader_only,omitempty"` // run on the leader only instead of on every node running the project
+}
+
+func (h *ProjectHookConfig) displayName(i int) string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// verifyProjectHooks checks the hooks of a project configuration
+func verifyProjectHooks(hooks []ProjectHookConfig) error {
+	for i := range hooks {
+		h := &hooks[i]
+		name := h.displayName(i)
+		if len(h.On) == 0 {
+			return fmt.Errorf("hook %s: on must list at least one of %s, %s, %s", name, ProjectHookStart, ProjectHookStop, ProjectHookCrash)
+		}
+		for _, event := range h.On {
+			switch event {
+			case ProjectHookStart, ProjectHookStop, ProjectHookCrash:
+			default:
+				return fmt.Errorf("hook %s: invalid event %q, must be %s, %s or %s", name, event, ProjectHookStart, ProjectHookStop, ProjectHookCrash)
+			}
+		}
+		if h.Timeout != "" {
+			if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("hook %s: invalid timeout %q, expected a duration like 10s", name, h.Timeout)
+			}
+		}
+		switch h.Type {
+		case "http":
+			u, err := url.Parse(h.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("hook %s: url must be an http or https URL", name)
+			}
+			if h.Body != "" {
+				if _, err := common.ParseEventTemplate("hook", h.Body); err != nil {
+					return fmt.Errorf("hook %s: invalid body template: %w", name, err)
+				}
+			}
+		case "plugin":
+			if h.Plugin == "" {
+				return fmt.Errorf("hook %s: plugin is required", name)
+			}
+			plugin.PluginsMu.RLock()
+			_, ok := plugin.Plugins[h.Plugin]
+			plugin.PluginsMu.RUnlock()
+			if !ok {
+				return fmt.Errorf("hook %s: plugin not found: %s", name, h.Plugin)
+			}
+		default:
+			return fmt.Errorf("hook %s: invalid type %q, must be http or plugin", name, h.Type)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the hooks of the project registered for an event. Hooks run in the background
+// and their failures are only logged, so a slow or broken hook never delays the project.
+func (p *Project) runHooks(event string, cause error) {
+	if p.Testing || p.Config == nil || len(p.Config.Hooks) == 0 {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"project":   p.Id,
+		"event":     event,
+		"node_id":   common.GetNodeID(),
+		"status":    string(p.Status),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	if cause != nil {
+		payload["error"] = cause.Error()
+	}
+
+	for i := range p.Config.Hooks {
+		h := p.Config.Hooks[i]
+		if !slices.Contains(h.On, event) {
+			continue
+		}
+		if h.LeaderOnly && !common.IsCurrentNodeLeader() {
+			continue
+		}
+		go func(name string) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("Panic in project hook", "project", p.Id, "hook", name, "event", event, "panic", r)
+				}
+			}()
+			var err error
+			if h.Type == "plugin" {
+				err = runPluginHook(&h, payload)
+			} else {
+				err = runHTTPHook(&h, payload)
+			}
+			if err != nil {
+				logger.Warn("Project hook failed", "project", p.Id, "hook", name, "event", event, "error", err)
+				return
+			}
+			logger.Info("Project hook executed", "project", p.Id, "hook", name, "event", event)
+		}(h.displayName(i))
+	}
+}
+
+func hookTimeout(h *ProjectHookConfig) time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultProjectHookTimeout
+}
+
+func runHTTPHook(h *ProjectHookConfig, payload map[string]interface{}) error {
+	var body []byte
+	if h.Body != "" {
+		tmpl, err := common.ParseEventTemplate("hook", h.Body)
+		if err != nil {
+			return fmt.Errorf("invalid body template: %w", err)
+		}
+		rendered, err := common.ExecuteEventTemplate(tmpl, payload)
+		if err != nil {
+			return fmt.Errorf("failed to render body: %w", err)
+		}
+		body = []byte(rendered)
+	} else {
+		body, _ = json.Marshal(payload)
+	}
+
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: hookTimeout(h)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("hook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// runPluginHook calls the plugin with the hook payload. A bool plugin returning false counts as a failure.
+func runPluginHook(h *ProjectHookConfig, payload map[string]interface{}) error {
+	plugin.PluginsMu.RLock()
+	p, ok := plugin.Plugins[h.Plugin]
+	plugin.PluginsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("plugin not found: %s", h.Plugin)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if p.ReturnType == "bool" {
+			ok, err := p.FuncEvalCheckNode(payload)
+			if err == nil && !ok {
+				err = fmt.Errorf("plugin %s returned false", h.Plugin)
+			}
+			done <- err
+			return
+		}
+		_, _, err := p.FuncEvalOther(payload)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(hookTimeout(h)):
+		return fmt.Errorf("plugin %s timed out", h.Plugin)
+	}
+}
@@ -21,8 +21,14 @@ type FlowNode struct {
 	ToID     string
 	FromInit bool
 	ToInit   bool
+	// Verdict limits the edge to "match" or "nomatch" events of a route mode ruleset,
+	// or to schema violations of an input for "quarantine"; empty means all
+	Verdict string
 }
 
+// QuarantineVerdict marks an edge from an INPUT that only receives events failing the input schema
+const QuarantineVerdict = "quarantine"
+
 type GlobalProjectInfo struct {
 	Projects map[string]*Project
 	Inputs   map[string]*input.Input
@@ -85,7 +91,9 @@ func GetRefCount(id string) int {
 // ProjectConfig holds the configuration for a project
 type ProjectConfig struct {
 	Id        string
-	Content   string `yaml:"content"`
+	Content   string              `yaml:"content"`
+	Hooks     []ProjectHookConfig `yaml:"hooks,omitempty"`
+	Delivery  string              `yaml:"delivery,omitempty"` // best_effort (default) or at_least_once
 	RawConfig string
 	Path      string
 }
@@ -99,6 +107,9 @@ type Project struct {
 
 	Testing bool `json:"testing"`
 
+	// RulesetOverrides replaces global rulesets by ID when building components, used by shadow projects
+	RulesetOverrides map[string]*rules_engine.Ruleset `json:"-"`
+
 	Config *ProjectConfig `json:"config"`
 
 	FlowNodes       []FlowNode
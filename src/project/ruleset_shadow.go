@@ -0,0 +1,249 @@
+package project
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/rules_engine"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rulesetShadowsKey         = "hub:ruleset_shadow:configs" // hash of ruleset ID to the raw config evaluated in shadow mode
+	rulesetShadowStatsPrefix  = "hub:ruleset_shadow:stats:"  // hash of the divergence counters of a ruleset
+	rulesetShadowSyncInterval = 5 * time.Second
+
+	rulesetShadowOnlyNewPrefix = "rule_only_new:"
+	rulesetShadowOnlyOldPrefix = "rule_only_old:"
+)
+
+// RulesetShadowReport is the divergence of the new version of a ruleset from the active version, summed
+// over all nodes since the shadow mode started
+type RulesetShadowReport struct {
+	RulesetID string `json:"ruleset_id"`
+	Running   bool   `json:"running"`
+	rules_engine.ShadowStats
+}
+
+var (
+	rulesetShadowMu   sync.Mutex
+	rulesetShadows    = make(map[string]*rules_engine.Ruleset) // built shadow rulesets by ruleset ID
+	rulesetShadowOnce sync.Once
+)
+
+// InitRulesetShadows attaches the shadow rulesets started on any node to the running instances
+// of their ruleset and flushes their counters to Redis every few seconds
+func InitRulesetShadows() {
+	rulesetShadowOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(rulesetShadowSyncInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := syncRulesetShadows(); err != nil {
+					logger.Error("Failed to sync shadow rulesets", "error", err)
+				}
+			}
+		}()
+	})
+}
+
+// StartRulesetShadow evaluates the pending changes of a ruleset in shadow mode next to the active
+// version, the counters of a previous comparison are reset
+func StartRulesetShadow(id string) error {
+	content, ok := GetRulesetNew(id)
+	if !ok {
+		return errors.New("ruleset " + id + " has no pending changes to evaluate")
+	}
+	if _, exists := GetRuleset(id); !exists {
+		return errors.New("ruleset " + id + " not found")
+	}
+	if common.GetRedisClient() == nil {
+		return errors.New("redis is not available")
+	}
+	shadow, err := rules_engine.NewShadowRuleset(content, id)
+	if err != nil {
+		return errors.New("invalid pending changes: " + err.Error())
+	}
+	shadow.ReleaseShadow()
+	if err := common.RedisDel(rulesetShadowStatsPrefix + id); err != nil {
+		return err
+	}
+	if err := common.RedisHSet(rulesetShadowsKey, id, content); err != nil {
+		return err
+	}
+	return syncRulesetShadows()
+}
+
+// StopRulesetShadow ends the shadow mode of a ruleset, its counters are kept
+func StopRulesetShadow(id string) error {
+	if common.GetRedisClient() == nil {
+		return errors.New("redis is not available")
+	}
+	if err := common.RedisHDel(rulesetShadowsKey, id); err != nil {
+		return err
+	}
+	return syncRulesetShadows()
+}
+
+// syncRulesetShadows builds the shadow rulesets configured in Redis, attaches them to the running
+// instances of their ruleset and flushes their counters. On the leader, a shadow follows the
+// pending changes of its ruleset and ends when they are applied or discarded.
+func syncRulesetShadows() error {
+	if common.GetRedisClient() == nil {
+		return nil
+	}
+	configs, err := common.RedisHGetAll(rulesetShadowsKey)
+	if err != nil {
+		return err
+	}
+	if common.IsLeader {
+		for id, raw := range configs {
+			content, ok := GetRulesetNew(id)
+			switch {
+			case !ok:
+				delete(configs, id)
+				if err := common.RedisHDel(rulesetShadowsKey, id); err != nil {
+					logger.Error("Failed to end shadow mode", "ruleset", id, "error", err)
+				}
+			case content != raw:
+				configs[id] = content
+				if err := common.RedisDel(rulesetShadowStatsPrefix + id); err != nil {
+					logger.Error("Failed to reset shadow counters", "ruleset", id, "error", err)
+				}
+				if err := common.RedisHSet(rulesetShadowsKey, id, content); err != nil {
+					logger.Error("Failed to update shadow ruleset", "ruleset", id, "error", err)
+				}
+			}
+		}
+	}
+
+	rulesetShadowMu.Lock()
+	defer rulesetShadowMu.Unlock()
+	var retired []*rules_engine.Ruleset
+	for id, raw := range configs {
+		if current := rulesetShadows[id]; current != nil && current.RawConfig == raw {
+			continue
+		}
+		shadow, err := rules_engine.NewShadowRuleset(raw, id)
+		if err != nil {
+			logger.Error("Failed to build shadow ruleset", "ruleset", id, "error", err)
+			continue
+		}
+		if current := rulesetShadows[id]; current != nil {
+			// The counters of the previous version were reset with its config
+			current.TakeShadowStats()
+			retired = append(retired, current)
+		}
+		rulesetShadows[id] = shadow
+	}
+
+	common.GlobalMu.RLock()
+	for _, rs := range GlobalProject.PNSRulesets {
+		shadow := rulesetShadows[rs.RulesetID]
+		if _, ok := configs[rs.RulesetID]; !ok {
+			shadow = nil
+		}
+		if rs.Shadow() != shadow {
+			rs.SetShadow(shadow)
+		}
+	}
+	common.GlobalMu.RUnlock()
+
+	for id, shadow := range rulesetShadows {
+		flushRulesetShadowStats(id, shadow.TakeShadowStats())
+		if _, ok := configs[id]; !ok {
+			delete(rulesetShadows, id)
+			retired = append(retired, shadow)
+		}
+	}
+	for _, shadow := range retired {
+		shadow.ReleaseShadow()
+	}
+	return nil
+}
+
+// flushRulesetShadowStats adds the counters of this node to the counters of the cluster
+func flushRulesetShadowStats(id string, stats rules_engine.ShadowStats) {
+	if stats.Events == 0 {
+		return
+	}
+	incr := map[string]int64{
+		"events":   int64(stats.Events),
+		"both":     int64(stats.Both),
+		"only_new": int64(stats.OnlyNew),
+		"only_old": int64(stats.OnlyOld),
+		"differ":   int64(stats.Differ),
+	}
+	for rule, n := range stats.RulesOnlyNew {
+		incr[rulesetShadowOnlyNewPrefix+rule] = int64(n)
+	}
+	for rule, n := range stats.RulesOnlyOld {
+		incr[rulesetShadowOnlyOldPrefix+rule] = int64(n)
+	}
+	if err := common.RedisHIncrByAll(rulesetShadowStatsPrefix+id, incr); err != nil {
+		logger.Error("Failed to flush shadow counters", "ruleset", id, "error", err)
+	}
+}
+
+// GetRulesetShadowReport returns the divergence counted for a ruleset by all nodes
+func GetRulesetShadowReport(id string) (RulesetShadowReport, error) {
+	report := RulesetShadowReport{RulesetID: id}
+	if common.GetRedisClient() == nil {
+		return report, errors.New("redis is not available")
+	}
+	raw, err := common.RedisHGet(rulesetShadowsKey, id)
+	if err != nil {
+		return report, err
+	}
+	report.Running = raw != ""
+	fields, err := common.RedisHGetAll(rulesetShadowStatsPrefix + id)
+	if err != nil {
+		return report, err
+	}
+	report.RulesOnlyNew = make(map[string]uint64)
+	report.RulesOnlyOld = make(map[string]uint64)
+	for field, v := range fields {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case field == "events":
+			report.Events = n
+		case field == "both":
+			report.Both = n
+		case field == "only_new":
+			report.OnlyNew = n
+		case field == "only_old":
+			report.OnlyOld = n
+		case field == "differ":
+			report.Differ = n
+		case strings.HasPrefix(field, rulesetShadowOnlyNewPrefix):
+			report.RulesOnlyNew[strings.TrimPrefix(field, rulesetShadowOnlyNewPrefix)] = n
+		case strings.HasPrefix(field, rulesetShadowOnlyOldPrefix):
+			report.RulesOnlyOld[strings.TrimPrefix(field, rulesetShadowOnlyOldPrefix)] = n
+		}
+	}
+	return report, nil
+}
+
+// RulesetShadowIDs returns the rulesets in shadow mode, sorted
+func RulesetShadowIDs() ([]string, error) {
+	if common.GetRedisClient() == nil {
+		return nil, errors.New("redis is not available")
+	}
+	configs, err := common.RedisHGetAll(rulesetShadowsKey)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
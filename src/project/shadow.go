@@ -0,0 +1,590 @@
+package project
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/input"
+	"AgentSmith-HUB/logger"
+	"AgentSmith-HUB/output"
+	"AgentSmith-HUB/rules_engine"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShadowFieldName tags every event fed into a shadow with its sequence number,
+// so output events can be attributed to the input event that caused them
+const ShadowFieldName = "_hub_shadow_seq"
+
+const (
+	ShadowStatusRunning   = "running"
+	ShadowStatusCompleted = "completed"
+	ShadowStatusStopped   = "stopped"
+	ShadowStatusFailed    = "failed"
+)
+
+const (
+	shadowDefaultDuration    = 10 * time.Minute
+	shadowMaxDuration        = 24 * time.Hour
+	shadowDefaultMaxEvents   = 10000
+	shadowMaxEvents          = 100000
+	shadowDefaultMaxExamples = 20
+	shadowMaxExamples        = 200
+	shadowQueueSize          = 4096
+	shadowSettleTimeout      = 10 * time.Second
+)
+
+// ShadowConfig describes a shadow run of a running project
+type ShadowConfig struct {
+	ProjectID   string
+	Candidates  map[string]string // ruleset ID -> candidate raw config, other rulesets keep their running version
+	Duration    time.Duration
+	MaxEvents   int
+	MaxExamples int
+}
+
+// ShadowOutputStats counts the events an output received in the live and the candidate copy
+type ShadowOutputStats struct {
+	Live      uint64 `json:"live"`
+	Candidate uint64 `json:"candidate"`
+}
+
+// ShadowExample is an input event whose outputs differ between live and candidate
+type ShadowExample struct {
+	Seq       uint64                 `json:"seq"`
+	Kind      string                 `json:"kind"` // new_alert, missing_alert or changed
+	Input     string                 `json:"input"`
+	Event     map[string]interface{} `json:"event"`
+	Live      map[string]int         `json:"live"`
+	Candidate map[string]int         `json:"candidate"`
+}
+
+// ShadowDiff summarizes per-event differences
+type ShadowDiff struct {
+	Identical    int `json:"identical"`
+	NewAlerts    int `json:"new_alerts"`     // only the candidate produced output
+	MissingAlert int `json:"missing_alerts"` // only live produced output
+	Changed      int `json:"changed"`        // both produced output, to different outputs or counts
+}
+
+// ShadowReport is the state and difference report of a shadow run
+type ShadowReport struct {
+	ID         string                        `json:"id"`
+	ProjectID  string                        `json:"project_id"`
+	Status     string                        `json:"status"`
+	Error      string                        `json:"error,omitempty"`
+	Candidates []string                      `json:"candidates"`
+	StartedAt  time.Time                     `json:"started_at"`
+	EndsAt     time.Time                     `json:"ends_at"`
+	FinishedAt *time.Time                    `json:"finished_at,omitempty"`
+	Events     uint64                        `json:"events"`
+	Dropped    uint64                        `json:"dropped"` // mirrored events skipped because the shadow fell behind
+	Diff       ShadowDiff                    `json:"diff"`
+	Outputs    map[string]*ShadowOutputStats `json:"outputs"`
+	Untracked  ShadowOutputStats             `json:"untracked"` // output events that lost the sequence tag
+	Examples   []ShadowExample               `json:"examples"`
+}
+
+type shadowItem struct {
+	input string
+	event map[string]interface{}
+}
+
+type shadowEvent struct {
+	input     string
+	event     map[string]interface{}
+	live      map[string]int
+	candidate map[string]int
+}
+
+// Shadow runs two isolated copies of a running project side by side, one with the running component
+// versions and one with candidate versions, feeds both the events consumed by the live inputs and
+// compares which outputs each copy reaches per event. Outputs of both copies only collect events.
+type Shadow struct {
+	ID  string
+	cfg ShadowConfig
+
+	live      *Project
+	candidate *Project
+	rulesets  []*rules_engine.Ruleset
+	inputs    map[string]*input.Input // live inputs being mirrored
+	feedLive  map[string]*input.Input
+	feedCand  map[string]*input.Input
+	collected []chan map[string]interface{}
+
+	queue      chan shadowItem
+	ctx        context.Context
+	cancel     context.CancelFunc
+	feederDone chan struct{}
+	collectWg  sync.WaitGroup
+	done       chan struct{}
+
+	seq     uint64
+	dropped uint64
+
+	mu         sync.Mutex
+	status     string
+	err        error
+	startedAt  time.Time
+	finishedAt *time.Time
+	events     map[uint64]*shadowEvent
+	outputs    map[string]*ShadowOutputStats
+	untracked  ShadowOutputStats
+}
+
+var (
+	shadowsMu sync.RWMutex
+	shadows   = make(map[string]*Shadow)
+)
+
+// StartShadow clones a running project on this node and starts comparing it with candidate versions
+func StartShadow(cfg ShadowConfig) (*Shadow, error) {
+	if cfg.Duration <= 0 {
+		cfg.Duration = shadowDefaultDuration
+	}
+	if cfg.Duration > shadowMaxDuration {
+		return nil, fmt.Errorf("duration must not exceed %s", shadowMaxDuration)
+	}
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = shadowDefaultMaxEvents
+	}
+	if cfg.MaxEvents > shadowMaxEvents {
+		cfg.MaxEvents = shadowMaxEvents
+	}
+	if cfg.MaxExamples <= 0 {
+		cfg.MaxExamples = shadowDefaultMaxExamples
+	}
+	if cfg.MaxExamples > shadowMaxExamples {
+		cfg.MaxExamples = shadowMaxExamples
+	}
+	if len(cfg.Candidates) == 0 {
+		return nil, fmt.Errorf("at least one candidate ruleset is required")
+	}
+
+	p, ok := GetProject(cfg.ProjectID)
+	if !ok {
+		return nil, fmt.Errorf("project not found: %s", cfg.ProjectID)
+	}
+	if p.Status != common.StatusRunning {
+		return nil, fmt.Errorf("project is not running: %s", cfg.ProjectID)
+	}
+
+	shadowsMu.RLock()
+	for _, other := range shadows {
+		if other.cfg.ProjectID == cfg.ProjectID && other.Report().Status == ShadowStatusRunning {
+			shadowsMu.RUnlock()
+			return nil, fmt.Errorf("a shadow of project %s is already running: %s", cfg.ProjectID, other.ID)
+		}
+	}
+	shadowsMu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Shadow{
+		ID:         uuid.New().String(),
+		cfg:        cfg,
+		inputs:     make(map[string]*input.Input),
+		queue:      make(chan shadowItem, shadowQueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		feederDone: make(chan struct{}),
+		done:       make(chan struct{}),
+		status:     ShadowStatusRunning,
+		startedAt:  time.Now(),
+		events:     make(map[uint64]*shadowEvent),
+		outputs:    make(map[string]*ShadowOutputStats),
+	}
+
+	if err := s.build(p); err != nil {
+		cancel()
+		s.teardown()
+		return nil, err
+	}
+
+	shadowsMu.Lock()
+	shadows[s.ID] = s
+	shadowsMu.Unlock()
+
+	for id, in := range s.inputs {
+		inputID := id
+		in.AddMirror("shadow:"+s.ID, func(event map[string]interface{}) {
+			select {
+			case s.queue <- shadowItem{input: inputID, event: event}:
+			default:
+				atomic.AddUint64(&s.dropped, 1)
+			}
+		})
+	}
+	go s.feed()
+	go s.run()
+
+	logger.Info("Shadow started", "shadow", s.ID, "project", cfg.ProjectID, "candidates", len(cfg.Candidates), "duration", cfg.Duration)
+	return s, nil
+}
+
+// build creates the live and candidate copies of p with isolated rulesets
+func (s *Shadow) build(p *Project) error {
+	used := make(map[string]bool)
+	for _, node := range p.FlowNodes {
+		if node.FromType == "RULESET" {
+			used[node.FromID] = true
+		}
+		if node.ToType == "RULESET" {
+			used[node.ToID] = true
+		}
+		if node.FromType == "INPUT" {
+			in, ok := GetInput(node.FromID)
+			if !ok {
+				return fmt.Errorf("input component not found: %s", node.FromID)
+			}
+			s.inputs[node.FromID] = in
+		}
+	}
+	for id := range s.cfg.Candidates {
+		if !used[id] {
+			return fmt.Errorf("ruleset %s is not used by project %s", id, p.Id)
+		}
+	}
+
+	short := s.ID[:8]
+	liveOverrides := make(map[string]*rules_engine.Ruleset)
+	candidateOverrides := make(map[string]*rules_engine.Ruleset)
+	for id := range used {
+		running, ok := GetRuleset(id)
+		if !ok {
+			return fmt.Errorf("ruleset component not found: %s", id)
+		}
+		candidateRaw, ok := s.cfg.Candidates[id]
+		if !ok {
+			candidateRaw = running.RawConfig
+		}
+
+		// unique ids keep threshold and cache state apart from the live rulesets
+		liveRs, err := rules_engine.NewRuleset("", running.RawConfig, fmt.Sprintf("shadow_%s_live_%s", short, id))
+		if err != nil {
+			return fmt.Errorf("failed to build running version of ruleset %s: %w", id, err)
+		}
+		s.rulesets = append(s.rulesets, liveRs)
+		liveOverrides[id] = liveRs
+
+		candidateRs, err := rules_engine.NewRuleset("", candidateRaw, fmt.Sprintf("shadow_%s_candidate_%s", short, id))
+		if err != nil {
+			return fmt.Errorf("failed to build candidate version of ruleset %s: %w", id, err)
+		}
+		s.rulesets = append(s.rulesets, candidateRs)
+		candidateOverrides[id] = candidateRs
+	}
+
+	var err error
+	if s.live, s.feedLive, err = s.startCopy(p, "live", liveOverrides); err != nil {
+		return err
+	}
+	if s.candidate, s.feedCand, err = s.startCopy(p, "candidate", candidateOverrides); err != nil {
+		return err
+	}
+	return nil
+}
+
+// startCopy starts an isolated testing copy of p and collects what its outputs receive
+func (s *Shadow) startCopy(p *Project, side string, overrides map[string]*rules_engine.Ruleset) (*Project, map[string]*input.Input, error) {
+	cp, err := NewProject("", p.Config.RawConfig, fmt.Sprintf("shadow_%s_%s", s.ID[:8], side), true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s copy: %w", side, err)
+	}
+	cp.RulesetOverrides = overrides
+	if err := cp.Start(true); err != nil {
+		return nil, nil, fmt.Errorf("failed to start %s copy: %w", side, err)
+	}
+
+	feed := make(map[string]*input.Input)
+	for _, in := range cp.Inputs {
+		feed[in.Id] = in
+	}
+	for _, out := range cp.Outputs {
+		ch := make(chan map[string]interface{}, shadowQueueSize)
+		out.TestCollectionChan = &ch
+		s.collected = append(s.collected, ch)
+		s.collectWg.Add(1)
+		go s.collect(out, side == "candidate", ch)
+	}
+	return cp, feed, nil
+}
+
+func (s *Shadow) collect(out *output.Output, candidate bool, ch chan map[string]interface{}) {
+	defer s.collectWg.Done()
+	for msg := range ch {
+		s.mu.Lock()
+		stats, ok := s.outputs[out.Id]
+		if !ok {
+			stats = &ShadowOutputStats{}
+			s.outputs[out.Id] = stats
+		}
+		var ev *shadowEvent
+		if seq, ok := msg[ShadowFieldName].(uint64); ok {
+			ev = s.events[seq]
+		}
+		if candidate {
+			stats.Candidate++
+			if ev != nil {
+				ev.candidate[out.Id]++
+			} else {
+				s.untracked.Candidate++
+			}
+		} else {
+			stats.Live++
+			if ev != nil {
+				ev.live[out.Id]++
+			} else {
+				s.untracked.Live++
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// feed hands mirrored events to both copies, tagged with a sequence number
+func (s *Shadow) feed() {
+	defer close(s.feederDone)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case item := <-s.queue:
+			in := s.feedLive[item.input]
+			cand := s.feedCand[item.input]
+			if in == nil || cand == nil {
+				continue
+			}
+
+			seq := atomic.AddUint64(&s.seq, 1)
+			s.mu.Lock()
+			s.events[seq] = &shadowEvent{
+				input:     item.input,
+				event:     item.event,
+				live:      make(map[string]int),
+				candidate: make(map[string]int),
+			}
+			s.mu.Unlock()
+
+			liveEvent := common.MapDeepCopy(item.event)
+			liveEvent[ShadowFieldName] = seq
+			in.ProcessTestData(liveEvent)
+
+			candidateEvent := common.MapDeepCopy(item.event)
+			candidateEvent[ShadowFieldName] = seq
+			cand.ProcessTestData(candidateEvent)
+
+			if seq >= uint64(s.cfg.MaxEvents) {
+				s.finishWith(ShadowStatusCompleted, nil)
+				return
+			}
+		}
+	}
+}
+
+// run ends the shadow when the window elapses or it is stopped, then tears the copies down
+func (s *Shadow) run() {
+	timer := time.NewTimer(s.cfg.Duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		s.finishWith(ShadowStatusCompleted, nil)
+	case <-s.ctx.Done():
+	}
+
+	for _, in := range s.inputs {
+		in.RemoveMirror("shadow:" + s.ID)
+	}
+	<-s.feederDone
+	s.settle()
+	s.teardown()
+
+	now := time.Now()
+	s.mu.Lock()
+	s.finishedAt = &now
+	s.mu.Unlock()
+	close(s.done)
+
+	r := s.Report()
+	logger.Info("Shadow finished", "shadow", s.ID, "project", s.cfg.ProjectID, "status", r.Status, "events", r.Events,
+		"new_alerts", r.Diff.NewAlerts, "missing_alerts", r.Diff.MissingAlert, "changed", r.Diff.Changed)
+}
+
+func (s *Shadow) finishWith(status string, err error) {
+	s.mu.Lock()
+	if s.status == ShadowStatusRunning {
+		s.status = status
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// settle waits until both copies have processed the events already fed to them
+func (s *Shadow) settle() {
+	deadline := time.Now().Add(shadowSettleTimeout)
+	for time.Now().Before(deadline) {
+		if s.live.idle() && s.candidate.idle() {
+			// testing outputs poll their upstream every 10ms
+			time.Sleep(100 * time.Millisecond)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	logger.Warn("Shadow copies did not settle in time, report may be incomplete", "shadow", s.ID)
+}
+
+func (p *Project) idle() bool {
+	if p == nil {
+		return true
+	}
+	for _, ch := range p.MsgChannels {
+		if len(*ch) > 0 {
+			return false
+		}
+	}
+	for _, rs := range p.Rulesets {
+		if rs.GetRunningTaskCount() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Shadow) teardown() {
+	for _, cp := range []*Project{s.live, s.candidate} {
+		if cp == nil {
+			continue
+		}
+		if err := cp.Stop(true); err != nil {
+			logger.Warn("Failed to stop shadow copy", "shadow", s.ID, "project", cp.Id, "error", err)
+		}
+	}
+	for _, ch := range s.collected {
+		close(ch)
+	}
+	s.collectWg.Wait()
+	for _, rs := range s.rulesets {
+		if err := rs.Stop(); err != nil {
+			logger.Warn("Failed to stop shadow ruleset", "shadow", s.ID, "ruleset", rs.RulesetID, "error", err)
+		}
+	}
+}
+
+// Stop ends the shadow early, the report covers the events seen so far
+func (s *Shadow) Stop() {
+	s.finishWith(ShadowStatusStopped, nil)
+}
+
+// Done is closed once the copies are torn down and the report is final
+func (s *Shadow) Done() <-chan struct{} {
+	return s.done
+}
+
+// Report returns the current difference report, it is final once Done is closed
+func (s *Shadow) Report() ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := ShadowReport{
+		ID:         s.ID,
+		ProjectID:  s.cfg.ProjectID,
+		Status:     s.status,
+		StartedAt:  s.startedAt,
+		EndsAt:     s.startedAt.Add(s.cfg.Duration),
+		FinishedAt: s.finishedAt,
+		Events:     uint64(len(s.events)),
+		Dropped:    atomic.LoadUint64(&s.dropped),
+		Outputs:    make(map[string]*ShadowOutputStats, len(s.outputs)),
+		Untracked:  s.untracked,
+		Examples:   []ShadowExample{},
+	}
+	if s.err != nil {
+		r.Error = s.err.Error()
+	}
+	for id := range s.cfg.Candidates {
+		r.Candidates = append(r.Candidates, id)
+	}
+	sort.Strings(r.Candidates)
+	for id, stats := range s.outputs {
+		cp := *stats
+		r.Outputs[id] = &cp
+	}
+
+	seqs := make([]uint64, 0, len(s.events))
+	for seq := range s.events {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		ev := s.events[seq]
+		var kind string
+		switch {
+		case reflect.DeepEqual(ev.live, ev.candidate):
+			r.Diff.Identical++
+			continue
+		case len(ev.live) == 0:
+			kind = "new_alert"
+			r.Diff.NewAlerts++
+		case len(ev.candidate) == 0:
+			kind = "missing_alert"
+			r.Diff.MissingAlert++
+		default:
+			kind = "changed"
+			r.Diff.Changed++
+		}
+		if len(r.Examples) < s.cfg.MaxExamples {
+			r.Examples = append(r.Examples, ShadowExample{
+				Seq:       seq,
+				Kind:      kind,
+				Input:     ev.input,
+				Event:     ev.event,
+				Live:      ev.live,
+				Candidate: ev.candidate,
+			})
+		}
+	}
+	return r
+}
+
+// GetShadow returns a shadow run by id
+func GetShadow(id string) (*Shadow, bool) {
+	shadowsMu.RLock()
+	defer shadowsMu.RUnlock()
+	s, ok := shadows[id]
+	return s, ok
+}
+
+// ListShadows returns the reports of all shadow runs started on this node, newest first
+func ListShadows() []ShadowReport {
+	shadowsMu.RLock()
+	list := make([]ShadowReport, 0, len(shadows))
+	for _, s := range shadows {
+		r := s.Report()
+		// the list is an overview, examples are only returned by GetShadow
+		r.Examples = nil
+		list = append(list, r)
+	}
+	shadowsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// PruneShadows drops finished shadow runs older than maxAge
+func PruneShadows(maxAge time.Duration) {
+	shadowsMu.Lock()
+	defer shadowsMu.Unlock()
+	for id, s := range shadows {
+		s.mu.Lock()
+		expired := s.finishedAt != nil && time.Since(*s.finishedAt) > maxAge
+		s.mu.Unlock()
+		if expired {
+			delete(shadows, id)
+		}
+	}
+}
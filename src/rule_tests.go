@@ -0,0 +1,73 @@
+package main
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/project"
+	"AgentSmith-HUB/rules_engine"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// runRuleTests runs the tests embedded in every ruleset under config_root and prints the results
+// with the rule coverage. It returns the exit code, 1 when a test failed or a ruleset is invalid.
+func runRuleTests(cfgRoot string) int {
+	if err := loadHubConfig(cfgRoot); err != nil {
+		fmt.Printf("cannot load config: %v\n", err)
+		return 1
+	}
+	// Only rules with thresholds, baselines or other shared state need Redis
+	if common.Config.Lite {
+		if err := common.RedisInitLite(common.Config.LiteDataFile); err != nil {
+			fmt.Printf("warning: cannot open lite store, rules using Redis will fail: %v\n", err)
+		}
+	} else if err := common.RedisInit(common.Config.Redis, common.Config.RedisPassword); err != nil {
+		fmt.Printf("warning: Redis is not reachable, rules using Redis will fail: %v\n", err)
+	}
+	loadLocalComponents()
+
+	rulesets := map[string]string{}
+	project.ForEachRuleset(func(id string, rs *rules_engine.Ruleset) bool {
+		rulesets[id] = rs.RawConfig
+		return true
+	})
+	ids := make([]string, 0, len(rulesets))
+	for id := range rulesets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	code := 0
+	var passed, failed, rules, covered int
+	for _, id := range ids {
+		report, err := rules_engine.RunRuleTests(rulesets[id])
+		if err != nil {
+			fmt.Printf("ruleset %s: INVALID %v\n", id, err)
+			code = 1
+			continue
+		}
+		passed += report.Passed
+		failed += report.Failed
+		rules += report.Rules
+		covered += report.RulesCovered
+		fmt.Printf("ruleset %s: %d passed, %d failed, %d/%d rules covered\n", id, report.Passed, report.Failed, report.RulesCovered, report.Rules)
+		for _, res := range report.Results {
+			if !res.Passed {
+				fmt.Printf("  FAIL %s / %s (line %d): expected match=%t, got match=%t\n", res.Rule, res.Test, res.Line, res.Expected, res.Matched)
+			}
+		}
+		if len(report.Untested) > 0 {
+			fmt.Printf("  untested: %s\n", strings.Join(report.Untested, ", "))
+		}
+	}
+	if failed > 0 {
+		code = 1
+	}
+
+	coverage := 0.0
+	if rules > 0 {
+		coverage = 100 * float64(covered) / float64(rules)
+	}
+	fmt.Printf("\nResult: %d passed, %d failed, rule coverage %.0f%% (%d/%d)\n", passed, failed, coverage, covered, rules)
+	return code
+}
@@ -0,0 +1,316 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Baseline types
+const (
+	// BaselineZScore compares a value with the mean and standard deviation of the range
+	BaselineZScore = "ZSCORE"
+	// BaselineEWMA compares a value with an exponentially weighted moving average and variance
+	BaselineEWMA = "EWMA"
+	// BaselineDistinct flags a value the entity did not have within the range
+	BaselineDistinct = "DISTINCT"
+)
+
+// Baseline directions of ZSCORE and EWMA
+const (
+	BaselineUp   = "up"
+	BaselineDown = "down"
+	BaselineBoth = "both"
+)
+
+const (
+	// DefaultBaselinePrefix is prepended to the fields appended by a <baseline> element without prefix
+	DefaultBaselinePrefix = "baseline_"
+
+	defaultBaselineSigma      = 3
+	defaultBaselineAlpha      = 0.1
+	defaultBaselineMinSamples = 10
+
+	// baselineBuckets is the number of buckets the range of a ZSCORE baseline is split into, the
+	// oldest bucket expires as a whole
+	baselineBuckets = 24
+	// baselineMaxScore bounds the score, a value off a baseline without variance scores it
+	baselineMaxScore = 1000
+)
+
+// processBaseline checks the settings of a baseline and parses its fields
+func processBaseline(baseline *Baseline, rulesetID, ruleID string, operationID int) error {
+	switch baseline.Type {
+	case "":
+		baseline.Type = BaselineZScore
+	case BaselineZScore, BaselineEWMA, BaselineDistinct:
+	default:
+		return errors.New("baseline type must be ZSCORE, EWMA or DISTINCT, got '" + baseline.Type + "', rule id: " + ruleID)
+	}
+	switch baseline.Direction {
+	case "":
+		baseline.Direction = BaselineUp
+	case BaselineUp, BaselineDown, BaselineBoth:
+	default:
+		return errors.New("baseline direction must be up, down or both, got '" + baseline.Direction + "', rule id: " + ruleID)
+	}
+
+	rangeInt, err := common.ParseDurationToSecondsInt(baseline.Range)
+	if err != nil {
+		return errors.New("baseline parse range err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	if rangeInt <= 0 {
+		return errors.New("baseline range must be positive, rule id: " + ruleID)
+	}
+	baseline.RangeInt = rangeInt
+
+	if baseline.Sigma == 0 {
+		baseline.Sigma = defaultBaselineSigma
+	}
+	if baseline.Sigma < 0 {
+		return errors.New("baseline sigma must be positive, rule id: " + ruleID)
+	}
+	if baseline.Alpha == 0 {
+		baseline.Alpha = defaultBaselineAlpha
+	}
+	if baseline.Alpha < 0 || baseline.Alpha > 1 {
+		return errors.New("baseline alpha must be between 0 and 1, rule id: " + ruleID)
+	}
+	if baseline.MinSamples == 0 {
+		baseline.MinSamples = defaultBaselineMinSamples
+	}
+	if baseline.MinSamples < 0 {
+		return errors.New("baseline min_samples must be positive, rule id: " + ruleID)
+	}
+	if baseline.Prefix == "" {
+		baseline.Prefix = DefaultBaselinePrefix
+	}
+
+	baseline.FieldList = common.StringToList(baseline.Field)
+	baseline.GroupByFields, baseline.GroupByList = nil, nil
+	for _, field := range strings.Split(baseline.GroupBy, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			baseline.GroupByFields = append(baseline.GroupByFields, field)
+			baseline.GroupByList = append(baseline.GroupByList, common.StringToList(field))
+		}
+	}
+	if len(baseline.GroupByFields) == 0 {
+		return errors.New("baseline group_by cannot be empty, rule id: " + ruleID)
+	}
+	baseline.TimeFieldList = nil
+	if field := strings.TrimSpace(baseline.TimeField); field != "" {
+		baseline.TimeFieldList = common.StringToList(field)
+	}
+
+	// Several baselines of a rule keep separate statistics
+	baseline.GroupByID = rulesetID + ruleID + "_" + strconv.Itoa(operationID)
+	return nil
+}
+
+// baselineStats are the statistics of an entity before the current value is added
+type baselineStats struct {
+	samples float64
+	mean    float64
+	stddev  float64
+}
+
+// score returns how many standard deviations value is from the mean, bounded by baselineMaxScore
+func (s baselineStats) score(value float64) float64 {
+	diff := value - s.mean
+	if s.stddev == 0 {
+		switch {
+		case diff > 0:
+			return baselineMaxScore
+		case diff < 0:
+			return -baselineMaxScore
+		}
+		return 0
+	}
+	return math.Max(-baselineMaxScore, math.Min(baselineMaxScore, diff/s.stddev))
+}
+
+// anomalous returns whether a score deviates by at least sigma in the direction of the baseline
+func (b *Baseline) anomalous(score float64) bool {
+	switch b.Direction {
+	case BaselineDown:
+		return score <= -b.Sigma
+	case BaselineBoth:
+		return math.Abs(score) >= b.Sigma
+	}
+	return score >= b.Sigma
+}
+
+// zscoreUpdate adds value to the bucket counters of a ZSCORE baseline kept in state, a bucket
+// field holds "count,sum,sum of squares". It returns the statistics of the buckets within the
+// range before value is added, the fields to set and the expired buckets to delete.
+func zscoreUpdate(state map[string]string, value float64, nowMs int64, rangeInt int) (baselineStats, map[string]interface{}, []string) {
+	bucketMs := max(int64(rangeInt)*1000/baselineBuckets, 1)
+	current := nowMs / bucketMs
+	oldest := current - baselineBuckets + 1
+
+	var stats baselineStats
+	var sum, sumSq float64
+	var del []string
+	var cur [3]float64
+	for field, v := range state {
+		bucket, err := strconv.ParseInt(field, 10, 64)
+		counters, ok := parseBucket(v)
+		if err != nil || !ok || bucket < oldest {
+			del = append(del, field)
+			continue
+		}
+		if bucket == current {
+			cur = counters
+		}
+		stats.samples += counters[0]
+		sum += counters[1]
+		sumSq += counters[2]
+	}
+	if stats.samples > 0 {
+		stats.mean = sum / stats.samples
+		// Population variance, rounding can make it slightly negative
+		stats.stddev = math.Sqrt(math.Max(sumSq/stats.samples-stats.mean*stats.mean, 0))
+	}
+
+	cur[0]++
+	cur[1] += value
+	cur[2] += value * value
+	set := map[string]interface{}{
+		strconv.FormatInt(current, 10): formatBucket(cur),
+	}
+	return stats, set, del
+}
+
+func parseBucket(v string) ([3]float64, bool) {
+	var counters [3]float64
+	parts := strings.Split(v, ",")
+	if len(parts) != 3 {
+		return counters, false
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return counters, false
+		}
+		counters[i] = f
+	}
+	return counters, true
+}
+
+func formatBucket(counters [3]float64) string {
+	return strconv.FormatFloat(counters[0], 'g', -1, 64) + "," +
+		strconv.FormatFloat(counters[1], 'g', -1, 64) + "," +
+		strconv.FormatFloat(counters[2], 'g', -1, 64)
+}
+
+// ewmaUpdate adds value to the moving average and variance of an EWMA baseline kept in state. It
+// returns the statistics before value is added and the fields to set.
+func ewmaUpdate(state map[string]string, value, alpha float64) (baselineStats, map[string]interface{}) {
+	var stats baselineStats
+	samples, err := strconv.ParseFloat(state["n"], 64)
+	mean, meanErr := strconv.ParseFloat(state["mean"], 64)
+	variance, varErr := strconv.ParseFloat(state["var"], 64)
+	if err != nil || meanErr != nil || varErr != nil || samples <= 0 {
+		// First value or state from an older version
+		samples, mean, variance = 0, value, 0
+	} else {
+		stats = baselineStats{samples: samples, mean: mean, stddev: math.Sqrt(math.Max(variance, 0))}
+		diff := value - mean
+		incr := alpha * diff
+		mean += incr
+		variance = (1 - alpha) * (variance + diff*incr)
+	}
+	set := map[string]interface{}{
+		"n":    strconv.FormatFloat(samples+1, 'g', -1, 64),
+		"mean": strconv.FormatFloat(mean, 'g', -1, 64),
+		"var":  strconv.FormatFloat(variance, 'g', -1, 64),
+	}
+	return stats, set
+}
+
+// executeBaseline adds the value of the event to the baseline of its entity. It returns whether
+// the value is anomalous once the baseline has MinSamples values, and the event with the
+// statistics appended when it is.
+func (r *Ruleset) executeBaseline(rule *Rule, operationID int, copied bool, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) (bool, map[string]interface{}) {
+	baseline, exists := rule.BaselineMap[operationID]
+	if !exists {
+		return true, nil
+	}
+
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(baseline.GroupByID)
+	for i, field := range baseline.GroupByFields {
+		tmpData, _ := GetCheckDataFromCache(ruleCache, field, data, baseline.GroupByList[i])
+		sb.WriteByte(0)
+		sb.WriteString(tmpData)
+	}
+	key := "BL_" + common.XXHash64(sb.String())
+	stringBuilderPool.Put(sb)
+
+	raw, ok := GetCheckDataFromCache(ruleCache, baseline.Field, data, baseline.FieldList)
+	if !ok {
+		return false, nil
+	}
+	nowMs := eventTime(baseline.TimeFieldList, data).UnixMilli()
+
+	fields := make(map[string]interface{}, 4)
+	var anomalous bool
+	if baseline.Type == BaselineDistinct {
+		isNew, distinct, err := common.RedisZWindowAddNew(key, float64(nowMs), raw, float64(nowMs-int64(baseline.RangeInt)*1000), baseline.RangeInt)
+		if err != nil {
+			logger.Error("Baseline state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+			return false, nil
+		}
+		anomalous = isNew && distinct >= int64(baseline.MinSamples)
+		fields["distinct"] = float64(distinct)
+		fields["new"] = isNew
+	} else {
+		value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return false, nil
+		}
+		state, err := common.RedisHGetAll(key)
+		if err != nil {
+			logger.Error("Baseline state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+			return false, nil
+		}
+		var stats baselineStats
+		var set map[string]interface{}
+		var del []string
+		if baseline.Type == BaselineEWMA {
+			stats, set = ewmaUpdate(state, value, baseline.Alpha)
+		} else {
+			stats, set, del = zscoreUpdate(state, value, nowMs, baseline.RangeInt)
+		}
+		// An EWMA forgets old values by itself, its state expires when the entity is idle for range
+		if err := common.RedisHUpdate(key, set, del, baseline.RangeInt); err != nil {
+			logger.Error("Baseline state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+			return false, nil
+		}
+		score := stats.score(value)
+		anomalous = stats.samples >= float64(baseline.MinSamples) && baseline.anomalous(score)
+		fields["mean"] = stats.mean
+		fields["stddev"] = stats.stddev
+		fields["score"] = score
+		fields["samples"] = stats.samples
+	}
+	if !anomalous {
+		return false, nil
+	}
+
+	var modifiedData map[string]interface{}
+	if !copied {
+		modifiedData = common.MapDeepCopy(data)
+	} else {
+		modifiedData = data
+	}
+	for name, v := range fields {
+		modifiedData[baseline.Prefix+name] = v
+	}
+	return true, modifiedData
+}
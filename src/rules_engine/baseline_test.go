@@ -0,0 +1,174 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseline_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<baseline field="bytes_out" group_by="user.name, host" range="7d" sigma="4" min_samples="20"/>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := &rs.Rules[0]
+	for id, baseline := range rule.BaselineMap {
+		if err := processBaseline(&baseline, "rs", rule.ID, id); err != nil {
+			t.Fatalf("processBaseline error: %v", err)
+		}
+		if baseline.Type != BaselineZScore || baseline.Direction != BaselineUp || baseline.Prefix != DefaultBaselinePrefix {
+			t.Fatalf("unexpected defaults %+v", baseline)
+		}
+		if baseline.RangeInt != 7*86400 || baseline.Sigma != 4 || baseline.MinSamples != 20 || len(baseline.GroupByFields) != 2 {
+			t.Fatalf("unexpected baseline %+v", baseline)
+		}
+	}
+
+	for _, bad := range []string{
+		`<baseline group_by="u" range="1d"/>`,
+		`<baseline field="x" range="1d"/>`,
+		`<baseline field="x" group_by="u"/>`,
+		`<baseline field="x" group_by="u" range="1d" sigma="high"/>`,
+		`<baseline field="x" group_by="u" range="1d" window="1d"/>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+	for _, bad := range []Baseline{
+		{Type: "MEDIAN", Field: "x", GroupBy: "u", Range: "1d"},
+		{Field: "x", GroupBy: "u", Range: "1d", Direction: "sideways"},
+		{Field: "x", GroupBy: "u", Range: "1d", Alpha: 2},
+		{Field: "x", GroupBy: " , ", Range: "1d"},
+		{Field: "x", GroupBy: "u", Range: "0s"},
+	} {
+		if err := processBaseline(&bad, "rs", "r1", 1); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestBaseline_Stats(t *testing.T) {
+	// One bucket per hour over a day
+	rangeInt := baselineBuckets * 3600
+	state := map[string]string{}
+	hour := int64(3600 * 1000)
+	for i, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		_, set, del := zscoreUpdate(state, v, int64(i)*hour, rangeInt)
+		for _, f := range del {
+			delete(state, f)
+		}
+		for f, v := range set {
+			state[f] = v.(string)
+		}
+	}
+	stats, _, _ := zscoreUpdate(state, 11, 8*hour, rangeInt)
+	if stats.samples != 8 || stats.mean != 5 || stats.stddev != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if score := stats.score(11); score != 3 {
+		t.Fatalf("score = %v, want 3", score)
+	}
+	// A day later the first buckets expired
+	stats, _, del := zscoreUpdate(state, 1, int64(baselineBuckets+2)*hour, rangeInt)
+	if stats.samples != 5 || len(del) != 3 {
+		t.Fatalf("expected 3 expired buckets, got stats %+v, deleted %v", stats, del)
+	}
+
+	state = map[string]string{}
+	for i := 0; i < 50; i++ {
+		_, set := ewmaUpdate(state, 10, 0.1)
+		for f, v := range set {
+			state[f] = v.(string)
+		}
+	}
+	stats, _ = ewmaUpdate(state, 10, 0.1)
+	if stats.samples != 50 || stats.mean != 10 || stats.stddev != 0 {
+		t.Fatalf("unexpected ewma stats %+v", stats)
+	}
+	if stats.score(11) != baselineMaxScore || stats.score(10) != 0 {
+		t.Fatal("a value off a baseline without variance must score the maximum")
+	}
+
+	b := &Baseline{Sigma: 3, Direction: BaselineUp}
+	if !b.anomalous(3) || b.anomalous(-5) {
+		t.Fatal("unexpected up direction")
+	}
+	b.Direction = BaselineDown
+	if b.anomalous(5) || !b.anomalous(-3) {
+		t.Fatal("unexpected down direction")
+	}
+	b.Direction = BaselineBoth
+	if !b.anomalous(5) || !b.anomalous(-5) || b.anomalous(1) {
+		t.Fatal("unexpected both direction")
+	}
+}
+
+func TestBaseline_Execute(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	xml := `<root type="DETECTION"><rule id="r1">
+		<baseline field="bytes" group_by="user" range="1d" min_samples="5"/>
+		<baseline type="DISTINCT" field="country" group_by="user" range="30d" min_samples="2" prefix="geo_baseline_"/>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := &rs.Rules[0]
+	for id, baseline := range rule.BaselineMap {
+		if err := processBaseline(&baseline, "rs_"+t.Name(), rule.ID, id); err != nil {
+			t.Fatalf("processBaseline error: %v", err)
+		}
+		rule.BaselineMap[id] = baseline
+	}
+	var zscoreID, distinctID int
+	for _, op := range *rule.Queue {
+		if rule.BaselineMap[op.ID].Type == BaselineDistinct {
+			distinctID = op.ID
+		} else {
+			zscoreID = op.ID
+		}
+	}
+
+	run := func(id int, event map[string]interface{}) (bool, map[string]interface{}) {
+		return rs.executeBaseline(rule, id, false, event, map[string]common.CheckCoreCache{})
+	}
+	for i, v := range []int{100, 110, 90, 105, 95, 100} {
+		if ok, _ := run(zscoreID, map[string]interface{}{"user": "alice", "bytes": v}); ok {
+			t.Fatalf("value %d of the learning phase flagged (event %d)", v, i)
+		}
+	}
+	ok, out := run(zscoreID, map[string]interface{}{"user": "alice", "bytes": 500})
+	if !ok {
+		t.Fatal("expected an anomaly for 500 bytes")
+	}
+	if score, _ := out["baseline_score"].(float64); score < 3 || out["baseline_samples"] != float64(6) {
+		t.Fatalf("unexpected statistics %v", out)
+	}
+	// Another entity has its own baseline
+	if ok, _ := run(zscoreID, map[string]interface{}{"user": "bob", "bytes": 500}); ok {
+		t.Fatal("a new entity must not be flagged")
+	}
+	if ok, _ := run(zscoreID, map[string]interface{}{"user": "alice", "bytes": "n/a"}); ok {
+		t.Fatal("a non numeric value must not be flagged")
+	}
+
+	for _, country := range []string{"US", "US", "DE", "US"} {
+		if ok, _ := run(distinctID, map[string]interface{}{"user": "alice", "country": country}); ok {
+			t.Fatalf("country %s flagged while learning", country)
+		}
+	}
+	ok, out = run(distinctID, map[string]interface{}{"user": "alice", "country": "KP"})
+	if !ok || out["geo_baseline_new"] != true || out["geo_baseline_distinct"] != float64(2) {
+		t.Fatalf("expected a new country, got %v %v", ok, out)
+	}
+	if ok, _ := run(distinctID, map[string]interface{}{"user": "alice", "country": "KP"}); ok {
+		t.Fatal("a known country must not be flagged")
+	}
+}
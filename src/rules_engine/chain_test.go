@@ -0,0 +1,84 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+const chainTestRules = `
+  <rule id="r1" name="r1">
+    <check type="INCL" field="cmd">curl</check>
+  </rule>
+  <rule id="r2" name="r2">
+    <check type="INCL" field="cmd">bash</check>
+  </rule>
+ </root>`
+
+func TestChain_ContinueEmitsPerRule(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="chain">`+chainTestRules)
+	if rs.ChainMode != ChainModeContinue {
+		t.Fatalf("expected default chain mode %q, got %q", ChainModeContinue, rs.ChainMode)
+	}
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "curl x | bash"})
+	if len(out) != 2 {
+		t.Fatalf("expected 2 results in continue mode, got %d", len(out))
+	}
+}
+
+func TestChain_StopOnMatch(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="chain" chain="stop_on_match">`+chainTestRules)
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "curl x | bash"})
+	if len(out) != 1 {
+		t.Fatalf("expected 1 result in stop_on_match mode, got %d", len(out))
+	}
+	if out[0][HitRuleIdFieldName] != "TEST.RS.r1" {
+		t.Fatalf("expected first rule to match, got %v", out[0][HitRuleIdFieldName])
+	}
+}
+
+func TestChain_RouteTagsVerdict(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="chain" chain="route">`+chainTestRules)
+
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "bash"})
+	if len(out) != 1 || out[0][VerdictFieldName] != VerdictMatch {
+		t.Fatalf("expected one match verdict, got %v", out)
+	}
+
+	data := map[string]interface{}{"cmd": "ls"}
+	out = rs.EngineCheck(data)
+	if len(out) != 1 || out[0][VerdictFieldName] != VerdictNoMatch {
+		t.Fatalf("expected one nomatch verdict, got %v", out)
+	}
+	if _, ok := data[VerdictFieldName]; ok {
+		t.Fatalf("original event must not be modified")
+	}
+}
+
+func TestChain_RouteDownstreamVerdict(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="chain" chain="route">`+chainTestRules)
+	matchCh := make(chan map[string]interface{}, 1)
+	noMatchCh := make(chan map[string]interface{}, 1)
+	allCh := make(chan map[string]interface{}, 2)
+	rs.DownStream = map[string]*chan map[string]interface{}{"m": &matchCh, "n": &noMatchCh, "a": &allCh}
+	rs.DownStreamVerdict = map[string]string{"m": VerdictMatch, "n": VerdictNoMatch}
+
+	for _, res := range rs.EngineCheck(map[string]interface{}{"cmd": "curl"}) {
+		rs.sendDownstream(res)
+	}
+	for _, res := range rs.EngineCheck(map[string]interface{}{"cmd": "ls"}) {
+		rs.sendDownstream(res)
+	}
+
+	if len(matchCh) != 1 || len(noMatchCh) != 1 || len(allCh) != 2 {
+		t.Fatalf("unexpected routing: match=%d nomatch=%d all=%d", len(matchCh), len(noMatchCh), len(allCh))
+	}
+}
+
+func TestChain_ExcludeRejectsChainMode(t *testing.T) {
+	rs, err := ParseRuleset([]byte(`<root type="EXCLUDE" name="chain" chain="route">` + chainTestRules))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	if err := RulesetBuild(rs); err == nil {
+		t.Fatalf("expected chain mode to be rejected for EXCLUDE rulesets")
+	}
+}
@@ -0,0 +1,96 @@
+package rules_engine
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// checkModifiers are the nocase, normalize and fold_space attributes of a check. They apply to
+// the field and to the value before they are compared.
+type checkModifiers uint8
+
+const (
+	modifierNocase checkModifiers = 1 << iota
+	modifierNormalize
+	modifierFoldSpace
+)
+
+// modifierCheckTypes are the check types comparing strings
+var modifierCheckTypes = map[string]bool{
+	"EQU": true, "NEQ": true, "INCL": true, "NI": true, "START": true, "END": true, "NSTART": true, "NEND": true,
+	"NCS_EQU": true, "NCS_NEQ": true, "NCS_INCL": true, "NCS_NI": true, "NCS_START": true, "NCS_END": true, "NCS_NSTART": true, "NCS_NEND": true,
+	"REGEX": true, "ARRAY_CONTAINS": true,
+}
+
+// parseModifierAttr parses the boolean value of a modifier attribute
+func parseModifierAttr(name, value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	}
+	return false, errors.New("check " + name + " must be 'true' or 'false', got '" + value + "'")
+}
+
+// apply returns s with the modifiers applied: NFKC normalization, then whitespace folding, then
+// lower case. NFKC turns fullwidth and other compatibility forms such as "ｐｏｗｅｒｓｈｅｌｌ" into
+// their plain form, folding turns runs of whitespace into one space and trims the ends.
+func (m checkModifiers) apply(s string) string {
+	if m&modifierNormalize != 0 {
+		s = norm.NFKC.String(s)
+	}
+	if m&modifierFoldSpace != 0 {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	if m&modifierNocase != 0 {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// regexPattern returns the pattern of a REGEX check, a nocase check matches case-insensitively
+// rather than lower casing the pattern
+func (m checkModifiers) regexPattern(pattern string) string {
+	if m&modifierNocase != 0 {
+		return "(?i)" + pattern
+	}
+	return pattern
+}
+
+// prepareCheckModifiers validates the modifiers of a check
+func prepareCheckModifiers(node *CheckNodes) error {
+	var m checkModifiers
+	if node.Nocase {
+		m |= modifierNocase
+	}
+	if node.Normalize {
+		m |= modifierNormalize
+	}
+	if node.FoldSpace {
+		m |= modifierFoldSpace
+	}
+	node.modifiers = m
+	if m != 0 && !modifierCheckTypes[node.Type] {
+		return errors.New("nocase, normalize and fold_space are only supported by string, REGEX and ARRAY_CONTAINS checks, got " + node.Type)
+	}
+	return nil
+}
+
+// modifyCheckValues applies the modifiers to the static values of string checks once, REGEX
+// patterns are left as written
+func modifyCheckValues(node *CheckNodes) {
+	if node.modifiers == 0 || node.Type == "REGEX" {
+		return
+	}
+	if node.Logic == "" && !hasFromRawPrefix(node.Value) {
+		node.Value = node.modifiers.apply(node.Value)
+	}
+	for i, v := range node.DelimiterFieldList {
+		if !hasFromRawPrefix(v) {
+			node.DelimiterFieldList[i] = node.modifiers.apply(v)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckModifiers(t *testing.T) {
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="nocase">
+    <check type="INCL" field="cmdline" nocase="true">PowerShell -Enc</check>
+  </rule>
+  <rule id="normalized">
+    <check type="EQU" field="user" normalize="true" nocase="true">admin</check>
+  </rule>
+  <rule id="folded">
+    <check type="START" field="cmdline" fold_space="true" logic="OR" delimiter="|">net  user|whoami   /all</check>
+  </rule>
+  <rule id="regex">
+    <check type="REGEX" field="user" nocase="true">^ROOT$</check>
+  </rule>
+  <rule id="raw">
+    <check type="EQU" field="user" nocase="true">_$expected</check>
+  </rule>
+</root>`)
+	hits := func(data map[string]interface{}) string {
+		var ids []string
+		for _, res := range rs.EngineCheck(data) {
+			ids = append(ids, strings.TrimPrefix(res[HitRuleIdFieldName].(string), "TEST.RS."))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	for _, tt := range []struct {
+		data map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"cmdline": "POWERSHELL -enc SQBFAFgA"}, "nocase"},
+		{map[string]interface{}{"cmdline": "powershell  -enc"}, ""},
+		{map[string]interface{}{"user": "ＡＤＭＩＮ"}, "normalized"},
+		{map[string]interface{}{"user": "ADMIN"}, "normalized"},
+		{map[string]interface{}{"cmdline": "net \t user bob"}, "folded"},
+		{map[string]interface{}{"cmdline": "  whoami /all"}, "folded"},
+		{map[string]interface{}{"cmdline": "netuser"}, ""},
+		{map[string]interface{}{"user": "Root"}, "regex"},
+		{map[string]interface{}{"user": "Bob", "expected": "BOB"}, "raw"},
+	} {
+		if got := hits(tt.data); got != tt.want {
+			t.Errorf("%v: got hits %q, want %q", tt.data, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<check type="EQU" field="a" nocase="yes">x</check>`, "check nocase must be 'true' or 'false'"},
+		{`<check type="CIDR" field="a" nocase="true">10.0.0.0/8</check>`, "only supported by string, REGEX and ARRAY_CONTAINS checks"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package rules_engine
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// ArrayLenCheck is the parsed value of ARRAY_LEN checks, such as ">=2"
+type ArrayLenCheck struct {
+	Op  string
+	Len int
+}
+
+// parseArrayLenCheck parses a length with an optional operator: =, !=, >, >=, < or <=
+func parseArrayLenCheck(value string) (*ArrayLenCheck, error) {
+	s := strings.TrimSpace(value)
+	op := "="
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = strings.TrimSpace(s[len(candidate):])
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return nil, errors.New("ARRAY_LEN value must be a length with an optional operator such as 3 or >=2, got '" + value + "'")
+	}
+	return &ArrayLenCheck{Op: op, Len: n}, nil
+}
+
+// Match reports whether an array of length n satisfies the check
+func (c *ArrayLenCheck) Match(n int) bool {
+	switch c.Op {
+	case "!=":
+		return n != c.Len
+	case ">":
+		return n > c.Len
+	case ">=":
+		return n >= c.Len
+	case "<":
+		return n < c.Len
+	case "<=":
+		return n <= c.Len
+	}
+	return n == c.Len
+}
+
+// arrayValues returns the elements of an array field. Strings holding a JSON array, as left by
+// inputs that do not decode nested fields, are decoded.
+func arrayValues(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values, true
+	case []map[string]interface{}:
+		values := make([]interface{}, len(v))
+		for i, m := range v {
+			values[i] = m
+		}
+		return values, true
+	case string:
+		s := strings.TrimSpace(v)
+		if !strings.HasPrefix(s, "[") {
+			return nil, false
+		}
+		var values []interface{}
+		if err := sonic.UnmarshalString(s, &values); err != nil {
+			return nil, false
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// arrayContains reports whether an element of an array field equals value. Elements are compared
+// as strings, so 443 matches the number 443 and the string "443".
+func arrayContains(node *CheckNodes, field interface{}, value string) bool {
+	values, ok := arrayValues(field)
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		s := exprString(v)
+		if node.modifiers != 0 {
+			s = node.modifiers.apply(s)
+		}
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumericValue reports whether a field is a number or a string holding a finite number
+func isNumericValue(value interface{}) bool {
+	if _, ok := value.(bool); ok {
+		return false
+	}
+	f, ok := exprNumber(value)
+	return ok && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// isIPValue reports whether a field holds an IP address, of the version when it is ipv4 or ipv6
+func isIPValue(value interface{}, version string) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	switch version {
+	case "ipv4":
+		return addr.Is4() || addr.Is4In6()
+	case "ipv6":
+		return addr.Is6() && !addr.Is4In6()
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStructureChecks(t *testing.T) {
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="numeric">
+    <check type="IS_NUMERIC" field="port"></check>
+  </rule>
+  <rule id="ipv6">
+    <check type="IS_IP" field="addr">ipv6</check>
+  </rule>
+  <rule id="ip">
+    <check type="IS_IP" field="addr"></check>
+  </rule>
+  <rule id="contains">
+    <check type="ARRAY_CONTAINS" field="sourceIPs" logic="OR" delimiter="|">10.0.0.1|443</check>
+  </rule>
+  <rule id="nocase">
+    <check type="ARRAY_CONTAINS" field="groups" nocase="true">System:Masters</check>
+  </rule>
+  <rule id="len">
+    <check type="ARRAY_LEN" field="sourceIPs">>=3</check>
+  </rule>
+</root>`)
+	hits := func(data map[string]interface{}) string {
+		var ids []string
+		for _, res := range rs.EngineCheck(data) {
+			ids = append(ids, strings.TrimPrefix(res[HitRuleIdFieldName].(string), "TEST.RS."))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	for _, tt := range []struct {
+		data map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"port": 443.0}, "numeric"},
+		{map[string]interface{}{"port": " 8080 "}, "numeric"},
+		{map[string]interface{}{"port": "NaN"}, ""},
+		{map[string]interface{}{"port": true}, ""},
+		{map[string]interface{}{"addr": "10.0.0.1"}, "ip"},
+		{map[string]interface{}{"addr": "fe80::1"}, "ipv6,ip"},
+		{map[string]interface{}{"addr": "10.0.0.256"}, ""},
+		{map[string]interface{}{"sourceIPs": []interface{}{"192.168.1.1", "10.0.0.1"}}, "contains"},
+		{map[string]interface{}{"sourceIPs": []interface{}{80.0, 443.0, "10.0.0.2"}}, "contains,len"},
+		{map[string]interface{}{"sourceIPs": `["a","b","c","d"]`}, "len"},
+		{map[string]interface{}{"sourceIPs": "10.0.0.1"}, ""},
+		{map[string]interface{}{"groups": []string{"system:authenticated", "system:masters"}}, "nocase"},
+	} {
+		if got := hits(tt.data); got != tt.want {
+			t.Errorf("%v: got hits %q, want %q", tt.data, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<check type="ARRAY_LEN" field="a">~3</check>`, "ARRAY_LEN value must be a length"},
+		{`<check type="IS_IP" field="a">ipv5</check>`, "IS_IP value must be empty, ipv4 or ipv6"},
+		{`<check type="ARRAY_CONTAINS" field="a"></check>`, "ARRAY_CONTAINS node value cannot be empty"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
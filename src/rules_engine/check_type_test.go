@@ -0,0 +1,102 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+func TestCheck_ExistsAndType(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="exists">
+  <rule id="r1" name="r1">
+    <check type="EXISTS" field="user.name"></check>
+    <check type="NOT_EXISTS" field="user.sudo"></check>
+    <check type="IS_TYPE" field="port">integer</check>
+    <check type="IS_TYPE" field="tags" logic="OR" delimiter="|">array|string</check>
+  </rule>
+ </root>`
+
+	rs := buildRulesetFromXML(t, xml)
+
+	cases := []struct {
+		data  map[string]interface{}
+		match bool
+	}{
+		{map[string]interface{}{"user": map[string]interface{}{"name": ""}, "port": float64(22), "tags": []interface{}{"a"}}, true},
+		{map[string]interface{}{"user": map[string]interface{}{"name": "bob"}, "port": float64(22), "tags": "a"}, true},
+		{map[string]interface{}{"user": map[string]interface{}{}, "port": float64(22), "tags": "a"}, false},
+		{map[string]interface{}{"user": map[string]interface{}{"name": "bob", "sudo": false}, "port": float64(22), "tags": "a"}, false},
+		{map[string]interface{}{"user": map[string]interface{}{"name": "bob"}, "port": "22", "tags": "a"}, false},
+		{map[string]interface{}{"user": map[string]interface{}{"name": "bob"}, "port": 22.5, "tags": "a"}, false},
+		{map[string]interface{}{"user": map[string]interface{}{"name": "bob"}, "port": float64(22), "tags": true}, false},
+	}
+	for i, c := range cases {
+		out := rs.EngineCheck(c.data)
+		if got := len(out) == 1; got != c.match {
+			t.Fatalf("case %d: expected match=%v, got %d results", i, c.match, len(out))
+		}
+	}
+}
+
+func TestCheck_IsTypeUnknownType(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1"><check type="IS_TYPE" field="x">date</check></rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rs.RulesetID = "TEST.RS"
+	if err := RulesetBuild(rs); err == nil {
+		t.Fatalf("expected build error for unknown IS_TYPE type")
+	}
+}
+
+func TestCheck_CIDRAndIPRange(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="cidr">
+  <rule id="r1" name="r1">
+    <check type="CIDR" field="src">10.0.0.0/8, 192.168.0.0/16, 2001:db8::/32</check>
+    <check type="IP_RANGE" field="dst">172.16.0.10-172.16.0.20,8.8.8.8</check>
+  </rule>
+ </root>`
+
+	rs := buildRulesetFromXML(t, xml)
+
+	cases := []struct {
+		src   string
+		dst   string
+		match bool
+	}{
+		{"10.1.2.3", "172.16.0.10", true},
+		{"192.168.255.255", "172.16.0.20", true},
+		{"2001:db8::1", "8.8.8.8", true},
+		{"::ffff:10.0.0.1", "172.16.0.15", true},
+		{"11.0.0.1", "172.16.0.15", false},
+		{"10.0.0.1", "172.16.0.21", false},
+		{"10.0.0.1", "8.8.4.4", false},
+		{"not-an-ip", "8.8.8.8", false},
+		{"2001:db9::1", "8.8.8.8", false},
+	}
+	for i, c := range cases {
+		out := rs.EngineCheck(map[string]interface{}{"src": c.src, "dst": c.dst})
+		if got := len(out) == 1; got != c.match {
+			t.Fatalf("case %d: expected match=%v, got %d results", i, c.match, len(out))
+		}
+	}
+}
+
+func TestCheck_CIDRInvalid(t *testing.T) {
+	for _, check := range []string{
+		`<check type="CIDR" field="x">10.0.0.0/33</check>`,
+		`<check type="CIDR" field="x">10.0.0.1-10.0.0.5</check>`,
+		`<check type="IP_RANGE" field="x">10.0.0.9-10.0.0.1</check>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + check + `</rule></root>`
+		rs, err := ParseRuleset([]byte(xml))
+		if err != nil {
+			t.Fatalf("ParseRuleset error: %v", err)
+		}
+		rs.RulesetID = "TEST.RS"
+		if err := RulesetBuild(rs); err == nil {
+			t.Fatalf("expected build error for %s", check)
+		}
+	}
+}
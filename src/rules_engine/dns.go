@@ -0,0 +1,45 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"net"
+	"time"
+)
+
+// dnsDeadlineCacheKey holds the end of the DNS budget of an event in the rule cache, which is
+// shared by the rules evaluating the event. Field paths cannot start with a NUL byte.
+const dnsDeadlineCacheKey = "\x00dns_deadline"
+
+// validateDNSLookup checks the value of a DNS append: forward, reverse, or empty to pick the
+// lookup from the source value
+func validateDNSLookup(value string) error {
+	switch value {
+	case "", common.DNSLookupForward, common.DNSLookupReverse:
+		return nil
+	}
+	return fmt.Errorf("DNS lookup must be empty, '%s' or '%s', got '%s'", common.DNSLookupForward, common.DNSLookupReverse, value)
+}
+
+// dnsLookupKind returns the lookup of a DNS append, a reverse lookup of IP addresses when not set
+func dnsLookupKind(value, source string) string {
+	if value != "" {
+		return value
+	}
+	if net.ParseIP(source) != nil {
+		return common.DNSLookupReverse
+	}
+	return common.DNSLookupForward
+}
+
+// dnsWait returns the time left in the DNS budget of the event, the budget starts with its first
+// lookup
+func dnsWait(ruleCache map[string]common.CheckCoreCache, budget time.Duration) time.Duration {
+	if c, ok := ruleCache[dnsDeadlineCacheKey]; ok {
+		if deadline, ok := c.TypedData.(time.Time); ok {
+			return time.Until(deadline)
+		}
+	}
+	ruleCache[dnsDeadlineCacheKey] = common.CheckCoreCache{Exist: true, TypedData: time.Now().Add(budget)}
+	return budget
+}
@@ -0,0 +1,124 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setTestDNS(t *testing.T, cfg *common.DNSConfig, addr, host func(ctx context.Context, name string) ([]string, error)) {
+	t.Helper()
+	d, err := common.NewDNSResolver(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetLookupFuncs(addr, host)
+	d.Start()
+	old := common.GlobalDNS
+	common.GlobalDNS = d
+	t.Cleanup(func() {
+		d.Stop()
+		common.GlobalDNS = old
+	})
+}
+
+func TestDNSAppend(t *testing.T) {
+	var lookups atomic.Int32
+	setTestDNS(t, nil,
+		func(ctx context.Context, addr string) ([]string, error) {
+			lookups.Add(1)
+			if addr == "192.0.2.1" {
+				return []string{"mail.example.com."}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+		},
+		func(ctx context.Context, host string) ([]string, error) {
+			lookups.Add(1)
+			return []string{"203.0.113.7", "2001:db8::7"}, nil
+		})
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="dns">
+    <append type="DNS" field="src_hostname" source="src_ip"/>
+    <append type="DNS" field="dest_addresses" source="dest">forward</append>
+    <check type="EXISTS" field="src_ip"/>
+  </rule>
+</root>`)
+	res := rs.EngineCheck(map[string]interface{}{"src_ip": "192.0.2.1", "dest": "Example.com."})
+	if len(res) != 1 || res[0]["src_hostname"] != "mail.example.com" || fmt.Sprint(res[0]["dest_addresses"]) != "[203.0.113.7 2001:db8::7]" {
+		t.Fatalf("unexpected result %v", res)
+	}
+
+	// Names that do not exist append nothing
+	res = rs.EngineCheck(map[string]interface{}{"src_ip": "192.0.2.2"})
+	if len(res) != 1 {
+		t.Fatalf("unexpected result %v", res)
+	}
+	if _, ok := res[0]["src_hostname"]; ok {
+		t.Fatalf("unexpected hostname %v", res[0])
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Fatalf("expected 3 lookups, got %d", n)
+	}
+}
+
+func TestDNSAppend_Budget(t *testing.T) {
+	release := make(chan struct{})
+	setTestDNS(t, &common.DNSConfig{Budget: 20 * time.Millisecond},
+		func(ctx context.Context, addr string) ([]string, error) {
+			<-release
+			return []string{"slow.example.com"}, nil
+		}, nil)
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="dns">
+    <append type="DNS" field="a" source="ip1"/>
+    <append type="DNS" field="b" source="ip2"/>
+    <check type="EXISTS" field="ip1"/>
+  </rule>
+</root>`)
+	start := time.Now()
+	res := rs.EngineCheck(map[string]interface{}{"ip1": "192.0.2.10", "ip2": "192.0.2.11"})
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("event waited %v, the budget is shared by its lookups", elapsed)
+	}
+	if len(res) != 1 || res[0]["a"] != nil || res[0]["b"] != nil {
+		t.Fatalf("unexpected result %v", res)
+	}
+
+	// The lookups go on and later events get their answer
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res = rs.EngineCheck(map[string]interface{}{"ip1": "192.0.2.10", "ip2": "192.0.2.11"})
+		if res[0]["a"] == "slow.example.com" && res[0]["b"] == "slow.example.com" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lookups not completed: %v", res)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDNSAppend_Parse(t *testing.T) {
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<append type="DNS" field="h"/>`, "append DNS source is required"},
+		{`<append type="DNS" field="h" source="ip">mx</append>`, "DNS lookup must be empty, 'forward' or 'reverse'"},
+		{`<append type="TRANSFORM" field="h" source="ip">_$ip | lower</append>`, "only supported by types INTEL and DNS"},
+	} {
+		_, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `<check type="EXISTS" field="ip"/></rule></root>`))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
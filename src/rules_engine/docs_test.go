@@ -0,0 +1,56 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocs_RendersRuleMetadataAndOperations(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="edr" author="secops">
+  <rule id="brute_force" name="SSH brute force" priority="high">
+    <desc>
+      Many failed SSH logins from one source.
+      Tune the threshold for bastion hosts.
+    </desc>
+    <check type="EQU" field="event">ssh_failed</check>
+    <threshold group_by="src_ip" range="5m" local_cache="true">10</threshold>
+    <append field="tactic">credential_access</append>
+  </rule>
+ </root>`)
+
+	doc := rs.Doc()
+	if len(doc.Rules) != 1 {
+		t.Fatalf("expected one rule, got %d", len(doc.Rules))
+	}
+	rule := doc.Rules[0]
+	if rule.Desc != "Many failed SSH logins from one source.\nTune the threshold for bastion hosts." {
+		t.Fatalf("unexpected desc %q", rule.Desc)
+	}
+	if rule.Checks != 1 || rule.Thresholds != 1 || len(rule.Operations) != 3 {
+		t.Fatalf("unexpected operations %+v", rule)
+	}
+
+	md := doc.Markdown()
+	for _, want := range []string{"# edr", "SSH brute force", "Tune the threshold", "`event EQU \"ssh_failed\"`", "events >= 10 within 5m by src_ip", "high"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown misses %q:\n%s", want, md)
+		}
+	}
+
+	page, err := doc.HTML()
+	if err != nil {
+		t.Fatalf("render html: %v", err)
+	}
+	if !strings.Contains(page, "<h2>brute_force</h2>") || !strings.Contains(page, "Many failed SSH logins from one source.<br>") {
+		t.Fatalf("unexpected html:\n%s", page)
+	}
+}
+
+func TestDocs_RejectsDescOutsideRule(t *testing.T) {
+	_, err := ParseRuleset([]byte(`<root type="DETECTION" name="edr">
+  <desc>not allowed here</desc>
+ </root>`))
+	if err == nil {
+		t.Fatalf("expected desc at root level to be rejected")
+	}
+}
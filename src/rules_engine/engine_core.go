@@ -16,6 +16,24 @@ import (
 
 const HitRuleIdFieldName = "_hub_hit_rule_id"
 
+// VerdictFieldName carries the verdict of a route mode ruleset: VerdictMatch or VerdictNoMatch
+const VerdictFieldName = "_hub_verdict"
+
+const (
+	VerdictMatch   = "match"
+	VerdictNoMatch = "nomatch"
+)
+
+// Chain modes of a detection ruleset, set with the root "chain" attribute
+const (
+	// ChainModeContinue evaluates every rule and forwards one event per matching rule
+	ChainModeContinue = "continue"
+	// ChainModeStopOnMatch stops at the first matching rule, forwarding at most one event
+	ChainModeStopOnMatch = "stop_on_match"
+	// ChainModeRoute stops at the first matching rule and forwards every event exactly once, tagged with its verdict
+	ChainModeRoute = "route"
+)
+
 // parseProjectInfoFromPNS parses project information from ProjectNodeSequence
 // Format: "INPUT.api_sec.RULESET.test.OUTPUT.print_demo" -> project: "api_sec", ruleset: "test"
 // Also handles test mode: "TEST.INPUT.api_sec.RULESET.test.OUTPUT.print_demo"
@@ -120,6 +138,7 @@ func (r *Ruleset) Start() error {
 	// Clear error state when restarting
 	r.Err = nil
 	r.SetStatus(common.StatusStarting, nil)
+	r.attachRuleProfiles()
 
 	// Initialize regex result cache if not already initialized
 	if r.RegexResultCache == nil {
@@ -192,6 +211,11 @@ func (r *Ruleset) Start() error {
 		}
 	}()
 
+	if r.hasSessions() {
+		r.wg.Add(1)
+		go r.runSessions(r.stopChan)
+	}
+
 	for upID, upCh := range r.UpStream {
 		go func(id string, ch *chan map[string]interface{}) {
 			defer func() {
@@ -212,6 +236,16 @@ func (r *Ruleset) Start() error {
 					}
 
 					task := func() {
+						// Canary events are evaluated like any other event so their latency includes the rules,
+						// then forwarded whatever the verdict so every output of the project still receives them
+						if common.IsCanaryEvent(data) {
+							r.EngineCheck(canaryEvaluationCopy(data))
+							for _, downCh := range r.DownStream {
+								*downCh <- data
+							}
+							return
+						}
+
 						// Only count and sample in production mode (not test mode)
 						// Test mode flag is pre-computed during ruleset initialization for performance
 						if !r.isTestMode {
@@ -222,13 +256,19 @@ func (r *Ruleset) Start() error {
 						}
 
 						// Now perform rule checking on the input data
+						token := common.GetDeliveryToken(data)
 						results := r.EngineCheck(data)
+						// The new version in shadow mode sees the event before it is forwarded and may change
+						if shadow := r.shadow.Load(); shadow != nil {
+							shadow.compareShadow(r, data, results)
+						}
 						// Send results to downstream channels - blocking to ensure no data loss
 						for _, res := range results {
-							for _, downCh := range r.DownStream {
-								*downCh <- res // Blocking write to ensure data integrity
-							}
+							common.SetDeliveryToken(res, token)
+							r.sendDownstream(res)
 						}
+						// Every result sent holds its own reference, events without a match end here
+						token.Release()
 					}
 
 					// PERFORMANCE FIX: Improved task submission with backpressure handling
@@ -256,6 +296,18 @@ func (r *Ruleset) Start() error {
 	return nil
 }
 
+// canaryEvaluationCopy returns the event rules see for a canary, without the signature so
+// rules and plugins can neither alter nor leak it
+func canaryEvaluationCopy(data map[string]interface{}) map[string]interface{} {
+	evalData := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k != common.CanaryFieldName {
+			evalData[k] = v
+		}
+	}
+	return evalData
+}
+
 // Stop the ruleset engine, waiting for all upstream and downstream data to be processed before shutdown.
 func (r *Ruleset) Stop() error {
 	// Add panic recovery for critical state changes
@@ -455,15 +507,40 @@ func (r *Ruleset) EngineCheck(data map[string]interface{}) []map[string]interfac
 		// Reuse the same slice pattern for consistency
 		result := make([]map[string]interface{}, 1)
 		result[0] = data
+		if r.hasOutputPolicy() {
+			result[0] = mapDeepCopyWithExtraCapacity(data, 0)
+			r.applyOutputPolicy(result[0])
+		}
 		return result
 	}
 
+	stopOnMatch := r.ChainMode == ChainModeStopOnMatch || r.ChainMode == ChainModeRoute
+
 	// Process each rule in the ruleset
 	for ruleIndex := range r.Rules {
 		rule := &r.Rules[ruleIndex] // Use pointer to avoid copying
 
 		// Execute all operations in the order specified by the Queue
-		ruleCheckRes, copied, modifiedData := r.executeRuleOperations(rule, data, ruleCache)
+		explain := newMatchExplanation(r.Explain)
+		profile := r.profileOf(rule)
+		var start time.Time
+		if profile != nil {
+			start = time.Now()
+		}
+		ruleCheckRes, copied, modifiedData := r.executeRuleOperations(rule, data, ruleCache, explain)
+		if profile != nil {
+			profile.latency.observe(time.Since(start))
+			if ruleCheckRes {
+				profile.matches.Add(1)
+			}
+		}
+		if ruleCheckRes && len(rule.hitKeys) > 0 {
+			if modifiedData != nil {
+				r.recordRuleHit(rule, modifiedData, ruleCache)
+			} else {
+				r.recordRuleHit(rule, data, ruleCache)
+			}
+		}
 
 		// Handle rule result based on ruleset type
 		if r.IsDetection {
@@ -472,17 +549,12 @@ func (r *Ruleset) EngineCheck(data map[string]interface{}) []map[string]interfac
 				if !copied {
 					modifiedData = mapDeepCopyWithExtraCapacity(data, 1)
 				}
-				// Add rule info
-				// Build hit rule ID efficiently using string builder pool
-				sb := stringBuilderPool.Get().(*strings.Builder)
-				sb.Reset()
-				sb.WriteString(r.RulesetID)
-				sb.WriteString(".")
-				sb.WriteString(rule.ID)
-				addHitRuleID(modifiedData, sb.String())
-				stringBuilderPool.Put(sb)
+				r.markRuleHit(rule, modifiedData, explain)
 				// Add to final result
 				finalRes = append(finalRes, modifiedData)
+				if stopOnMatch {
+					break
+				}
 			}
 		} else {
 			// For exclude rules
@@ -495,6 +567,9 @@ func (r *Ruleset) EngineCheck(data map[string]interface{}) []map[string]interfac
 
 			if ruleCheckRes {
 				// If exclude rule passes, data is excluded (filtered) - don't pass forward (return empty)
+				if ruleIndex < len(r.excluded) {
+					r.excluded[ruleIndex].Add(1)
+				}
 				ruleCachePool.Put(ruleCache)
 				return make([]map[string]interface{}, 0)
 			}
@@ -506,6 +581,25 @@ func (r *Ruleset) EngineCheck(data map[string]interface{}) []map[string]interfac
 		finalRes = append(finalRes, lastModifiedData)
 	}
 
+	// In route mode events that matched nothing are forwarded as well, so the project can route them by verdict
+	if r.ChainMode == ChainModeRoute && len(finalRes) == 0 {
+		// Copy because the same event may be shared with other components
+		noMatch := mapDeepCopyWithExtraCapacity(data, 1)
+		noMatch[VerdictFieldName] = VerdictNoMatch
+		finalRes = append(finalRes, noMatch)
+	}
+
+	// Masks and dropped fields apply to every event the ruleset forwards
+	if r.hasOutputPolicy() {
+		for i := range finalRes {
+			// An exclude ruleset may forward the event it received, which other components share
+			if !r.IsDetection {
+				finalRes[i] = mapDeepCopyWithExtraCapacity(finalRes[i], 0)
+			}
+			r.applyOutputPolicy(finalRes[i])
+		}
+	}
+
 	// put back to pool
 	ruleCachePool.Put(ruleCache)
 	ruleCache = nil
@@ -516,8 +610,39 @@ func (r *Ruleset) EngineCheck(data map[string]interface{}) []map[string]interfac
 	return result
 }
 
+// markRuleHit adds the hit rule ID, the explanation, the priority, the meta and the verdict of a
+// matched rule to the event it forwards
+func (r *Ruleset) markRuleHit(rule *Rule, modifiedData map[string]interface{}, explain *matchExplanation) {
+	// Build hit rule ID efficiently using string builder pool
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(r.RulesetID)
+	sb.WriteString(".")
+	sb.WriteString(rule.ID)
+	hitRuleID := sb.String()
+	addHitRuleID(modifiedData, hitRuleID)
+	stringBuilderPool.Put(sb)
+	explain.attach(modifiedData, hitRuleID)
+	if rule.Priority == common.PriorityHigh {
+		modifiedData[common.PriorityFieldName] = common.PriorityHigh
+	}
+	if rule.Meta != nil {
+		modifiedData[RuleMetaFieldName] = rule.Meta.eventFields(hitRuleID)
+	}
+	if r.ChainMode == ChainModeRoute {
+		modifiedData[VerdictFieldName] = VerdictMatch
+	}
+}
+
 // executeRuleOperations executes all operations in a rule according to the Queue order
-func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) (bool, bool, map[string]interface{}) {
+// explain collects the evidence of the evaluation and may be nil.
+func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) (bool, bool, map[string]interface{}) {
+	return r.executeRuleOperationsFrom(rule, 0, data, ruleCache, explain)
+}
+
+// executeRuleOperationsFrom executes the operations of a rule from the operation at index start,
+// the rest of a rule runs on the summary of a closed session this way
+func (r *Ruleset) executeRuleOperationsFrom(rule *Rule, start int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) (bool, bool, map[string]interface{}) {
 	copied := false
 
 	if rule.Queue == nil || len(*rule.Queue) == 0 {
@@ -527,12 +652,14 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 		return false, copied, nil
 	}
 	ruleResult := true
+	queue := *rule.Queue
 	// Execute operations in the exact order specified by the Queue
-	for _, op := range *rule.Queue {
+	for opIndex := start; opIndex < len(queue); opIndex++ {
+		op := queue[opIndex]
 		var modifiedRes map[string]interface{}
 		switch op.Type {
 		case T_CheckList:
-			checkResult := r.executeCheckList(rule, op.ID, data, ruleCache)
+			checkResult := r.executeCheckList(rule, op.ID, data, ruleCache, explain)
 			if !checkResult {
 				ruleResult = false
 				// For detection rules, if check fails, stop execution
@@ -542,7 +669,7 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 				// For exclude rules, continue executing other operations
 			}
 		case T_Check:
-			checkResult := r.executeCheck(rule, op.ID, data, ruleCache)
+			checkResult := r.executeCheck(rule, op.ID, data, ruleCache, explain)
 			if !checkResult {
 				ruleResult = false
 				// For detection rules, if check fails, stop execution
@@ -552,7 +679,7 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 				// For exclude rules, continue executing other operations
 			}
 		case T_Threshold:
-			thresholdResult := r.executeThreshold(rule, op.ID, data, ruleCache)
+			thresholdResult := r.executeThreshold(rule, op.ID, data, ruleCache, explain)
 			if !thresholdResult {
 				ruleResult = false
 				// For detection rules, if threshold fails, stop execution
@@ -563,6 +690,9 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 			}
 		case T_Iterator:
 			iteratorResult := r.executeIterator(rule, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("iterator", rule.IteratorMap[op.ID].Type, iteratorResult)
+			}
 			if !iteratorResult {
 				ruleResult = false
 				// For detection rules, if iterator fails, stop execution
@@ -571,9 +701,101 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 				}
 				// For exclude rules, continue executing other operations
 			}
+		case T_Group:
+			groupResult := r.executeGroup(rule, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("group", rule.GroupMap[op.ID].Type, groupResult)
+			}
+			if !groupResult {
+				ruleResult = false
+				// For detection rules, if group fails, stop execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+				// For exclude rules, continue executing other operations
+			}
+		case T_Sequence:
+			sequenceResult := r.executeSequence(rule, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("sequence", rule.SequenceMap[op.ID].ID, sequenceResult)
+			}
+			if !sequenceResult {
+				ruleResult = false
+				// For detection rules, an incomplete sequence stops execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+			}
+		case T_Session:
+			summary := r.executeSession(rule, opIndex, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("session", rule.SessionMap[op.ID].GroupBy, summary != nil)
+			}
+			if summary == nil {
+				// The session holds the event, the rule continues with the summary once it closes
+				return false, copied, data
+			}
+			// The event closed the previous session of its group, the rule continues with its summary
+			modifiedRes = summary
+		case T_Suppress:
+			suppressResult := r.executeSuppress(rule, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("suppress", rule.SuppressMap[op.ID].Key, suppressResult)
+			}
+			if !suppressResult {
+				ruleResult = false
+				// For detection rules, a match within the cooldown stops execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+			}
+		case T_Requires:
+			requiresResult := r.executeRequires(rule, op.ID, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("requires", rule.RequiresMap[op.ID].Rule, requiresResult)
+			}
+			if !requiresResult {
+				ruleResult = false
+				// For detection rules, a required rule that did not match stops execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+			}
+		case T_Script:
+			scriptResult, scriptData := r.executeScript(rule, op.ID, data)
+			if explain != nil {
+				explain.addOperation("script", rule.ScriptMap[op.ID].Lang, scriptResult)
+			}
+			modifiedRes = scriptData
+			if !scriptResult {
+				ruleResult = false
+				// For detection rules, a script returning false or failing stops execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+			}
+		case T_Baseline:
+			baselineResult, baselineData := r.executeBaseline(rule, op.ID, copied, data, ruleCache)
+			if explain != nil {
+				explain.addOperation("baseline", rule.BaselineMap[op.ID].Type, baselineResult)
+			}
+			modifiedRes = baselineData
+			if !baselineResult {
+				ruleResult = false
+				// For detection rules, a value within the baseline stops execution
+				if r.IsDetection {
+					return false, copied, data
+				}
+			}
 		case T_Append:
 			// Execute append operation according to user-defined order
-			modifiedRes = r.executeAppend(rule, op.ID, copied, data, ruleCache)
+			if profile := r.profileOf(rule); profile != nil && rule.AppendsMap[op.ID].Type == "PLUGIN" {
+				start := time.Now()
+				modifiedRes = r.executeAppend(rule, op.ID, copied, data, ruleCache)
+				profile.plugin.observe(time.Since(start))
+			} else {
+				modifiedRes = r.executeAppend(rule, op.ID, copied, data, ruleCache)
+			}
 
 		case T_Modify:
 			// Execute modify operation according to user-defined order
@@ -581,9 +803,21 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 		case T_Del:
 			// Execute del operation according to user-defined order
 			modifiedRes = r.executeDel(rule, op.ID, copied, data)
+		case T_GeoIP:
+			modifiedRes = r.executeGeoIP(rule, op.ID, copied, data)
+		case T_Extract:
+			modifiedRes = r.executeExtract(rule, op.ID, copied, data)
+		case T_Score:
+			r.executeScore(rule, op.ID, data, ruleCache)
 		case T_Plugin:
 			// Execute plugin operation according to user-defined order
-			r.executePlugin(rule, op.ID, data, ruleCache)
+			if profile := r.profileOf(rule); profile != nil {
+				start := time.Now()
+				r.executePlugin(rule, op.ID, data, ruleCache)
+				profile.plugin.observe(time.Since(start))
+			} else {
+				r.executePlugin(rule, op.ID, data, ruleCache)
+			}
 		}
 		if modifiedRes != nil {
 			copied = true
@@ -595,7 +829,7 @@ func (r *Ruleset) executeRuleOperations(rule *Rule, data map[string]interface{},
 }
 
 // executeCheckList executes a checklist operation
-func (r *Ruleset) executeCheckList(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+func (r *Ruleset) executeCheckList(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) bool {
 	checklist, exists := rule.ChecklistMap[operationID]
 	if !exists {
 		return true
@@ -608,8 +842,10 @@ func (r *Ruleset) executeCheckList(rule *Rule, operationID int, data map[string]
 	}
 
 	// Execute each check node in the checklist
+	profile := r.profileOf(rule)
 	for _, checkNode := range checklist.CheckNodes {
-		checkResult := r.executeCheckNode(&checkNode, data, ruleCache)
+		checkResult := r.profiledCheckNode(profile, &checkNode, data, ruleCache)
+		explain.addCheck(&checkNode, checkResult, data, ruleCache)
 
 		if checklist.ConditionFlag {
 			conditionMap[checkNode.ID] = checkResult
@@ -636,7 +872,7 @@ func (r *Ruleset) executeCheckList(rule *Rule, operationID int, data map[string]
 			ThresholdMap: tempThresholdMap,
 		}
 
-		thresholdResult := r.executeThreshold(tempRule, 1, data, ruleCache)
+		thresholdResult := r.executeThreshold(tempRule, 1, data, ruleCache, explain)
 
 		if checklist.ConditionFlag {
 			conditionMap[thresholdID] = thresholdResult
@@ -658,13 +894,15 @@ func (r *Ruleset) executeCheckList(rule *Rule, operationID int, data map[string]
 }
 
 // executeCheck executes a standalone check operation
-func (r *Ruleset) executeCheck(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+func (r *Ruleset) executeCheck(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) bool {
 	checkNode, exists := rule.CheckMap[operationID]
 	if !exists {
 		return true
 	}
 
-	return r.executeCheckNode(&checkNode, data, ruleCache)
+	checkResult := r.profiledCheckNode(r.profileOf(rule), &checkNode, data, ruleCache)
+	explain.addCheck(&checkNode, checkResult, data, ruleCache)
+	return checkResult
 }
 
 // executeCheckNode executes a single check node
@@ -715,11 +953,16 @@ func (r *Ruleset) executeCheckNode(checkNode *CheckNodes, data map[string]interf
 }
 
 // executeThreshold executes a threshold operation
-func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) bool {
 	threshold, exists := rule.ThresholdMap[operationID]
 	if !exists {
 		return true
 	}
+	// threshold is a copy, a value set at runtime applies to this event only
+	threshold.Value = thresholdValue(&threshold)
+	if threshold.Value <= 0 {
+		return false
+	}
 
 	// Isolate by ruleset ID and rule ID
 	// Use strings.Builder pool for better performance
@@ -727,14 +970,43 @@ func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]
 	sb.Reset()
 	sb.WriteString(threshold.GroupByID)
 
+	var groupByValues map[string]string
+	if explain != nil {
+		groupByValues = make(map[string]string, len(threshold.GroupByList))
+	}
 	for k, v := range threshold.GroupByList {
 		tmpData, _ := GetCheckDataFromCache(ruleCache, k, data, v)
 		sb.WriteString(tmpData)
+		if groupByValues != nil {
+			groupByValues[k] = compactExplainValue(tmpData)
+		}
+	}
+
+	// Tumbling windows count in a separate key per window, sliding windows in one sorted set
+	ttl := threshold.RangeInt
+	var ts time.Time
+	switch threshold.Window {
+	case ThresholdWindowTumbling:
+		var window int64
+		window, ttl = tumblingWindow(&threshold, thresholdTime(&threshold, data))
+		sb.WriteString("_w")
+		sb.WriteString(strconv.FormatInt(window, 10))
+	case ThresholdWindowSliding:
+		ts = thresholdTime(&threshold, data)
+		ttl = slidingTTL(&threshold)
 	}
 	groupByKey := common.XXHash64(sb.String())
 	stringBuilderPool.Put(sb)
 
+	if isThresholdStat(threshold.CountType) {
+		return r.executeStatThreshold(rule, &threshold, groupByKey, groupByValues, ts, ttl, data, ruleCache, explain)
+	}
+	if threshold.Window == ThresholdWindowSliding {
+		return r.executeSlidingThreshold(rule, &threshold, groupByKey, groupByValues, ts, ttl, data, ruleCache, explain)
+	}
+
 	var ruleCheckRes bool
+	var count int
 	var err error
 
 	switch threshold.CountType {
@@ -748,9 +1020,9 @@ func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]
 		stringBuilderPool.Put(sb)
 
 		if threshold.LocalCache {
-			ruleCheckRes, err = r.LocalCacheFRQSum(prefixedKey, 1, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = r.LocalCacheFRQSum(prefixedKey, 1, ttl, threshold.Value)
 		} else {
-			ruleCheckRes, err = RedisFRQSum(prefixedKey, 1, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = RedisFRQSum(prefixedKey, 1, ttl, threshold.Value)
 		}
 
 	case "SUM":
@@ -773,9 +1045,9 @@ func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]
 		}
 
 		if threshold.LocalCache {
-			ruleCheckRes, err = r.LocalCacheFRQSum(prefixedKey, sumData, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = r.LocalCacheFRQSum(prefixedKey, sumData, ttl, threshold.Value)
 		} else {
-			ruleCheckRes, err = RedisFRQSum(prefixedKey, sumData, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = RedisFRQSum(prefixedKey, sumData, ttl, threshold.Value)
 		}
 
 	case "CLASSIFY":
@@ -799,9 +1071,9 @@ func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]
 		stringBuilderPool.Put(sb)
 
 		if threshold.LocalCache {
-			ruleCheckRes, err = r.LocalCacheFRQClassify(tmpKey, prefixedKey, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = r.LocalCacheFRQClassify(tmpKey, prefixedKey, ttl, threshold.Value)
 		} else {
-			ruleCheckRes, err = RedisFRQClassify(tmpKey, prefixedKey, threshold.RangeInt, threshold.Value)
+			ruleCheckRes, count, err = RedisFRQClassify(tmpKey, prefixedKey, ttl, threshold.Value)
 		}
 	}
 
@@ -810,6 +1082,51 @@ func (r *Ruleset) executeThreshold(rule *Rule, operationID int, data map[string]
 		return false
 	}
 
+	explain.addThreshold(&threshold, groupByValues, count, ruleCheckRes)
+	return ruleCheckRes
+}
+
+// executeSlidingThreshold counts an event in the sliding window of its group
+func (r *Ruleset) executeSlidingThreshold(rule *Rule, threshold *Threshold, groupByKey string, groupByValues map[string]string, ts time.Time, ttl int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) bool {
+	var key, member string
+	value := 1
+	switch threshold.CountType {
+	case "":
+		key = "FW_" + groupByKey
+	case "SUM":
+		key = "FWS_" + groupByKey
+		sumDataStr, ok := GetCheckDataFromCache(ruleCache, threshold.CountField, data, threshold.CountFieldList)
+		if !ok {
+			return false
+		}
+		sumData, err := strconv.Atoi(sumDataStr)
+		if err != nil {
+			return false
+		}
+		value = sumData
+	case "CLASSIFY":
+		key = "FWC_" + groupByKey
+		classifyData, ok := GetCheckDataFromCache(ruleCache, threshold.CountField, data, threshold.CountFieldList)
+		if !ok {
+			return false
+		}
+		member = common.XXHash64(classifyData)
+	}
+
+	var ruleCheckRes bool
+	var count int
+	var err error
+	if threshold.LocalCache {
+		ruleCheckRes, count, err = r.LocalCacheFRQSliding(key, member, value, ts, threshold.RangeInt, ttl, threshold.Value)
+	} else {
+		ruleCheckRes, count, err = RedisFRQSliding(key, member, value, ts, threshold.RangeInt, ttl, threshold.Value)
+	}
+	if err != nil {
+		logger.Error("Threshold check error:", err, "GroupByKey:", groupByKey, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return false
+	}
+
+	explain.addThreshold(threshold, groupByValues, count, ruleCheckRes)
 	return ruleCheckRes
 }
 
@@ -819,6 +1136,84 @@ func (r *Ruleset) executeAppend(rule *Rule, operationID int, copied bool, data m
 	if !exists {
 		return
 	}
+	if appendOp.Type == "INTEL" {
+		// Nothing is appended when the source is missing or not an indicator of the feeds
+		intel := common.GlobalThreatIntel
+		if intel == nil {
+			return
+		}
+		value, ok := common.GetCheckData(data, appendOp.SourceList)
+		if !ok {
+			return
+		}
+		indicator := intel.Lookup(appendOp.IntelFeeds, value)
+		if indicator == nil {
+			return
+		}
+		if !copied {
+			modifiedData = common.MapDeepCopy(data)
+		} else {
+			modifiedData = data
+		}
+		modifiedData[appendOp.FieldName] = indicator.Map()
+		return modifiedData
+	}
+	if appendOp.Type == "DNS" {
+		// Nothing is appended when the source is missing or the answer is not known within the
+		// budget of the event, the lookup then goes on and caches the answer for the next events
+		dns := common.GlobalDNS
+		if dns == nil {
+			return
+		}
+		value, ok := common.GetCheckData(data, appendOp.SourceList)
+		if !ok {
+			return
+		}
+		kind := dnsLookupKind(appendOp.Value, value)
+		result, ok := dns.Lookup(kind, value, dnsWait(ruleCache, dns.Budget()))
+		if !ok || len(result) == 0 {
+			return
+		}
+		if !copied {
+			modifiedData = common.MapDeepCopy(data)
+		} else {
+			modifiedData = data
+		}
+		if kind == common.DNSLookupReverse {
+			modifiedData[appendOp.FieldName] = result[0]
+		} else {
+			addresses := make([]interface{}, len(result))
+			for i, a := range result {
+				addresses[i] = a
+			}
+			modifiedData[appendOp.FieldName] = addresses
+		}
+		return modifiedData
+	}
+	if appendOp.Type == "TRANSFORM" {
+		// Nothing is appended when the source field is missing or a function cannot convert the
+		// value, such as invalid base64
+		var source string
+		if appendOp.TransformSourceList != nil {
+			var ok bool
+			if source, ok = GetCheckDataFromCache(ruleCache, appendOp.TransformSource[FromRawSymbolLen:], data, appendOp.TransformSourceList); !ok {
+				return
+			}
+		} else {
+			source = replaceFromRawPlaceholders(ruleCache, appendOp.TransformSource, data)
+		}
+		value, ok := applyTransforms(source, appendOp.Transforms)
+		if !ok {
+			return
+		}
+		if !copied {
+			modifiedData = common.MapDeepCopy(data)
+		} else {
+			modifiedData = data
+		}
+		modifiedData[appendOp.FieldName] = value
+		return modifiedData
+	}
 	if !copied {
 		modifiedData = common.MapDeepCopy(data)
 	} else {
@@ -1004,10 +1399,60 @@ func (r *Ruleset) executeDel(rule *Rule, operationID int, copied bool, data map[
 	return modifiedData
 }
 
+// executeGeoIP appends the GeoIP fields of an address, the data is left unchanged when the
+// address is invalid or not found
+func (r *Ruleset) executeGeoIP(rule *Rule, operationID int, copied bool, data map[string]interface{}) (modifiedData map[string]interface{}) {
+	geoIP, exists := rule.GeoIPMap[operationID]
+	resolver := common.GlobalGeoIP
+	if !exists || resolver == nil {
+		return
+	}
+	address, ok := common.GetCheckData(data, geoIP.FieldList)
+	if !ok {
+		return
+	}
+	fields := resolver.Lookup(address)
+	if len(fields) == 0 {
+		return
+	}
+
+	if !copied {
+		modifiedData = common.MapDeepCopy(data)
+	} else {
+		modifiedData = data
+	}
+	for name, value := range fields {
+		modifiedData[geoIP.Prefix+name] = value
+	}
+	return modifiedData
+}
+
+// executeExtract copies a nested value to a top-level field, nothing is added when it is missing
+func (r *Ruleset) executeExtract(rule *Rule, operationID int, copied bool, data map[string]interface{}) (modifiedData map[string]interface{}) {
+	extract, exists := rule.ExtractMap[operationID]
+	if !exists {
+		return
+	}
+	if _, ok := common.GetCheckDataWithType(data, extract.SourceList); !ok {
+		return
+	}
+
+	if !copied {
+		modifiedData = common.MapDeepCopy(data)
+	} else {
+		modifiedData = data
+	}
+	// Read from the copy, so the new field does not share nested values with the input
+	value, _ := common.GetCheckDataWithType(modifiedData, extract.SourceList)
+	modifiedData[extract.FieldName] = value
+	return modifiedData
+}
+
 // executePlugin executes a plugin operation
 func (r *Ruleset) executePlugin(rule *Rule, operationID int, dataCopy map[string]interface{}, ruleCache map[string]common.CheckCoreCache) {
 	pluginOp, exists := rule.PluginMap[operationID]
-	if !exists {
+	// A shadow ruleset does not act on the events it evaluates
+	if !exists || r.shadowState != nil {
 		return
 	}
 	args := GetPluginRealArgs(pluginOp.PluginArgs, dataCopy, ruleCache)
@@ -1125,7 +1570,7 @@ func (r *Ruleset) executeIterator(rule *Rule, operationID int, data map[string]i
 				}
 
 				// Use iteration context so group_by/count_field can reference the iterator variable
-				thresholdResult := r.executeThreshold(tempRule, 1, iterationContext, ruleCache)
+				thresholdResult := r.executeThreshold(tempRule, 1, iterationContext, ruleCache, nil)
 				if !thresholdResult {
 					itemResult = false
 					break
@@ -1142,7 +1587,7 @@ func (r *Ruleset) executeIterator(rule *Rule, operationID int, data map[string]i
 				}
 
 				// Use iteration context so inner checks/thresholds evaluate against iterator variable only
-				checklistResult := r.executeCheckList(tempRule, 1, iterationContext, ruleCache)
+				checklistResult := r.executeCheckList(tempRule, 1, iterationContext, ruleCache, nil)
 				if !checklistResult {
 					itemResult = false
 					break
@@ -1150,6 +1595,16 @@ func (r *Ruleset) executeIterator(rule *Rule, operationID int, data map[string]i
 			}
 		}
 
+		// Execute boolean groups inside iterator
+		if itemResult {
+			for i := range iterator.Groups {
+				if !r.evaluateGroup(&iterator.Groups[i], iterationContext, ruleCache) {
+					itemResult = false
+					break
+				}
+			}
+		}
+
 		if itemResult {
 			successCount++
 		}
@@ -1174,6 +1629,250 @@ func (r *Ruleset) executeIterator(rule *Rule, operationID int, data map[string]i
 	}
 }
 
+// executeGroup executes a standalone <all>, <any> or <not> group
+func (r *Ruleset) executeGroup(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	group, exists := rule.GroupMap[operationID]
+	if !exists {
+		return true
+	}
+	return r.evaluateGroup(&group, data, ruleCache)
+}
+
+// executeSequence advances the sequence of the group of the event. It returns true when the event
+// completes the last step within the range of the first event of the sequence.
+func (r *Ruleset) executeSequence(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	sequence, exists := rule.SequenceMap[operationID]
+	if !exists {
+		return true
+	}
+
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(sequence.GroupByID)
+	for k, v := range sequence.GroupByList {
+		tmpData, _ := GetCheckDataFromCache(ruleCache, k, data, v)
+		sb.WriteString(tmpData)
+	}
+	key := "SQ_" + common.XXHash64(sb.String())
+	stringBuilderPool.Put(sb)
+
+	state, err := common.RedisHGetAll(key)
+	if err != nil {
+		logger.Error("Sequence state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return false
+	}
+	step, _ := strconv.Atoi(state["step"])
+	count, _ := strconv.Atoi(state["count"])
+	start, _ := strconv.ParseInt(state["start"], 10, 64)
+
+	now := eventTime(sequence.TimeFieldList, data).UnixMilli()
+	rangeMs := int64(sequence.RangeInt) * 1000
+	if step < 0 || step >= len(sequence.Steps) || now-start > rangeMs {
+		step, count, start = 0, 0, 0
+	}
+
+	nextStep, nextCount, matched := advanceSequence(&sequence, step, count, func(group *Group) bool {
+		return r.evaluateGroup(group, data, ruleCache)
+	})
+	if !matched {
+		return false
+	}
+	if nextStep == len(sequence.Steps) {
+		if err := common.RedisDel(key); err != nil {
+			logger.Error("failed to delete Redis key %s: %v", key, err)
+		}
+		return true
+	}
+
+	if step == 0 && count == 0 {
+		start = now
+	}
+	// With event time the state lives one range, events may not arrive at the pace of their time
+	ttl := sequence.RangeInt
+	if sequence.TimeFieldList == nil {
+		ttl = int(max((start+rangeMs-now)/1000, 1))
+	}
+	fields := map[string]interface{}{"step": nextStep, "count": nextCount, "start": start}
+	if err := common.RedisHSetAll(key, fields, ttl); err != nil {
+		logger.Error("Sequence state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+	}
+	return false
+}
+
+// executeScript runs a script on the event. It returns false when the script returned false or
+// failed, and the event when the script changed it.
+func (r *Ruleset) executeScript(rule *Rule, operationID int, data map[string]interface{}) (bool, map[string]interface{}) {
+	script, exists := rule.ScriptMap[operationID]
+	if !exists || script.Program == nil {
+		return true, nil
+	}
+	rets, modifiedData, err := script.Program.Run(data)
+	if err != nil {
+		logger.Error("Script execution error:", err, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return false, nil
+	}
+	if len(rets) > 0 && rets[0] == false {
+		return false, modifiedData
+	}
+	return true, modifiedData
+}
+
+// executeSuppress starts the cooldown of the key of the event. It returns false when the cooldown
+// was already running, the match is then counted as suppressed.
+func (r *Ruleset) executeSuppress(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	suppress, exists := rule.SuppressMap[operationID]
+	if !exists {
+		return true
+	}
+
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(suppress.GroupByID)
+	for i, field := range suppress.KeyFields {
+		tmpData, _ := GetCheckDataFromCache(ruleCache, field, data, suppress.KeyList[i])
+		sb.WriteByte(0)
+		sb.WriteString(tmpData)
+	}
+	key := "SUP_" + common.XXHash64(sb.String())
+	stringBuilderPool.Put(sb)
+
+	started, err := common.RedisSetNX(key, 1, suppress.WindowInt)
+	if err != nil {
+		// Alert rather than lose a match when Redis is unavailable
+		logger.Error("Suppress state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return true
+	}
+	if !started {
+		r.suppressedMu.Lock()
+		if r.suppressed == nil {
+			r.suppressed = make(map[string]uint64)
+		}
+		r.suppressed[rule.ID]++
+		r.suppressedMu.Unlock()
+	}
+	return started
+}
+
+// executeScore adds the weight of a <score> element to the risk score of the entity of the event,
+// events without the entity field are not scored
+func (r *Ruleset) executeScore(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) {
+	score, exists := rule.ScoreMap[operationID]
+	if !exists || r.shadowState != nil {
+		return
+	}
+	id, ok := GetCheckDataFromCache(ruleCache, score.Field, data, score.FieldList)
+	if !ok || id == "" {
+		return
+	}
+	if _, err := common.RiskAdd(score.Entity, id, score.Weight); err != nil {
+		logger.Error("Risk score error:", err, "Entity:", score.Entity, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+	}
+}
+
+// ruleHitRedisKey returns the key recording that rule ruleID matched for the values of the key
+// fields of the event, false when a key field is missing
+func (r *Ruleset) ruleHitRedisKey(ruleID, key string, keyFields []string, keyList [][]string, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) (string, bool) {
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	defer stringBuilderPool.Put(sb)
+	sb.Reset()
+	sb.WriteString(r.RulesetID)
+	sb.WriteByte(0)
+	sb.WriteString(ruleID)
+	sb.WriteByte(0)
+	sb.WriteString(key)
+	for i, field := range keyFields {
+		tmpData, ok := GetCheckDataFromCache(ruleCache, field, data, keyList[i])
+		if !ok {
+			return "", false
+		}
+		sb.WriteByte(0)
+		sb.WriteString(tmpData)
+	}
+	return "REQ_" + common.XXHash64(sb.String()), true
+}
+
+// recordRuleHit records a match of a rule required by other rules, for each key they require
+func (r *Ruleset) recordRuleHit(rule *Rule, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) {
+	for i := range rule.hitKeys {
+		hit := &rule.hitKeys[i]
+		key, ok := r.ruleHitRedisKey(rule.ID, hit.Key, hit.KeyFields, hit.KeyList, data, ruleCache)
+		if !ok {
+			continue
+		}
+		if _, err := common.RedisSet(key, 1, hit.TTL); err != nil {
+			logger.Error("Rule hit record error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		}
+	}
+}
+
+// executeRequires returns whether the required rule matched within the window for the key of the
+// event
+func (r *Ruleset) executeRequires(rule *Rule, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	requires, exists := rule.RequiresMap[operationID]
+	if !exists {
+		return true
+	}
+
+	key, ok := r.ruleHitRedisKey(requires.Rule, requires.Key, requires.KeyFields, requires.KeyList, data, ruleCache)
+	if !ok {
+		return false
+	}
+	matched, err := common.RedisExists(key)
+	if err != nil {
+		logger.Error("Requires state error:", err, "Key:", key, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return false
+	}
+	return matched
+}
+
+// advanceSequence counts an event matching the current step and moves to the next step once the
+// step count is reached. The progress is unchanged when the event does not match the step.
+func advanceSequence(sequence *Sequence, step, count int, match func(group *Group) bool) (int, int, bool) {
+	if !match(&sequence.Steps[step].Group) {
+		return step, count, false
+	}
+	count++
+	if count >= sequence.Steps[step].Count {
+		return step + 1, 0, true
+	}
+	return step, count, true
+}
+
+// evaluateGroup evaluates a boolean group, short-circuiting as soon as the result is known
+func (r *Ruleset) evaluateGroup(group *Group, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	isAny := group.Type == GroupTypeAny
+
+	allMatched := true
+	for _, child := range group.Children {
+		var childResult bool
+		if child.Check != nil {
+			childResult = r.executeCheckNode(child.Check, data, ruleCache)
+		} else {
+			childResult = r.evaluateGroup(child.Group, data, ruleCache)
+		}
+
+		if isAny {
+			if childResult {
+				return true
+			}
+			continue
+		}
+		if !childResult {
+			allMatched = false
+			break
+		}
+	}
+
+	switch group.Type {
+	case GroupTypeAny:
+		return false
+	case GroupTypeNot:
+		return !allMatched
+	default:
+		return allMatched
+	}
+}
+
 // executeIteratorThreshold executes a threshold check within an iterator context
 func (r *Ruleset) executeIteratorThreshold(threshold *Threshold, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
 	// This is similar to executeThreshold but operates within iterator context
@@ -1210,13 +1909,58 @@ func (r *Ruleset) executeIteratorThreshold(threshold *Threshold, data map[string
 	}
 
 	// Simple threshold check - in practice, this would accumulate over time/iterations
-	return countValue >= threshold.Value
+	value := thresholdValue(threshold)
+	return value > 0 && countValue >= value
 }
 
 // checkNodeLogic executes the check logic for a single check node.
 func checkNodeLogic(checkNode *CheckNodes, data map[string]interface{}, checkNodeValue string, checkNodeValueFromRaw bool, ruleCache map[string]common.CheckCoreCache, regexResultCache *RegexResultCache) bool {
 	var checkListFlag = false
 
+	// Existence and type checks look at the raw value, before it is converted to a string
+	switch checkNode.Type {
+	case "EXPR":
+		return checkNode.Expr != nil && checkNode.Expr.Match(data)
+	case "TIME":
+		return checkTime(checkNode, data)
+	case "EXISTS", "NOT_EXISTS", "IS_TYPE":
+		value, exist := common.GetCheckDataWithType(data, checkNode.FieldList)
+		switch checkNode.Type {
+		case "EXISTS":
+			return exist
+		case "NOT_EXISTS":
+			return !exist
+		default:
+			return exist && isValueType(value, strings.ToLower(strings.TrimSpace(checkNodeValue)))
+		}
+	case "IS_NUMERIC", "IS_IP", "ARRAY_CONTAINS", "ARRAY_LEN":
+		value, exist := common.GetCheckDataWithType(data, checkNode.FieldList)
+		if !exist {
+			return false
+		}
+		switch checkNode.Type {
+		case "IS_NUMERIC":
+			return isNumericValue(value)
+		case "IS_IP":
+			return isIPValue(value, strings.ToLower(strings.TrimSpace(checkNodeValue)))
+		case "ARRAY_CONTAINS":
+			if checkNodeValueFromRaw && checkNode.modifiers != 0 {
+				checkNodeValue = checkNode.modifiers.apply(checkNodeValue)
+			}
+			return arrayContains(checkNode, value, checkNodeValue)
+		default:
+			check := checkNode.ArrayLen
+			if check == nil || checkNodeValueFromRaw {
+				var err error
+				if check, err = parseArrayLenCheck(checkNodeValue); err != nil {
+					return false
+				}
+			}
+			values, ok := arrayValues(value)
+			return ok && check.Match(len(values))
+		}
+	}
+
 	needCheckData, exist := common.GetCheckData(data, checkNode.FieldList)
 
 	// CRITICAL FIX: Handle field existence properly for ISNULL and NOTNULL checks
@@ -1243,9 +1987,23 @@ func checkNodeLogic(checkNode *CheckNodes, data map[string]interface{}, checkNod
 		return false
 	}
 
+	if checkNode.modifiers != 0 {
+		needCheckData = checkNode.modifiers.apply(needCheckData)
+		if checkNodeValueFromRaw {
+			if checkNode.Type == "REGEX" {
+				checkNodeValue = checkNode.modifiers.regexPattern(checkNodeValue)
+			} else {
+				checkNodeValue = checkNode.modifiers.apply(checkNodeValue)
+			}
+		}
+	}
+
 	switch checkNode.Type {
 	case "REGEX":
-		if !checkNodeValueFromRaw {
+		if checkNode.regexSet != nil && !checkNodeValueFromRaw {
+			// Static regex matched with the other patterns on the field in one pass
+			checkListFlag = checkNode.regexSet.matches(ruleCache, needCheckData)[checkNode.regexSetIndex]
+		} else if !checkNodeValueFromRaw {
 			// Static regex value - use result cache with pre-compiled regex for better performance
 			// This maintains the same behavior as original: REGEX(needCheckData, checkNode.Regex)
 			checkListFlag = CachedRegexMatchWithPrecompiled(regexResultCache, checkNode.Regex, checkNodeValue, needCheckData)
@@ -1258,9 +2016,76 @@ func checkNodeLogic(checkNode *CheckNodes, data map[string]interface{}, checkNod
 			}
 			checkListFlag, _ = REGEX(needCheckData, regex)
 		}
+	case "CIDR", "IP_RANGE":
+		ranges := checkNode.IPRanges
+		if ranges == nil || checkNodeValueFromRaw {
+			// values of logic checks and values read from the event
+			var err error
+			if ranges, err = getIPRangeSet(checkNode.Type, checkNodeValue); err != nil {
+				break
+			}
+		}
+		checkListFlag = ranges.Contains(needCheckData)
+	case "INTEL":
+		intel := common.GlobalThreatIntel
+		if intel == nil {
+			break
+		}
+		feeds := checkNode.IntelFeeds
+		if feeds == nil || checkNodeValueFromRaw {
+			feeds = strings.Split(checkNodeValue, ",")
+			for i := range feeds {
+				feeds[i] = strings.TrimSpace(feeds[i])
+			}
+		}
+		checkListFlag = intel.Lookup(feeds, needCheckData) != nil
+	case "LEVENSHTEIN", "JARO", "HOMOGLYPH":
+		list := checkNode.Similar
+		if list == nil || checkNodeValueFromRaw {
+			var err error
+			if list, err = parseSimilarityList(checkNode.Type, checkNodeValue); err != nil {
+				break
+			}
+		}
+		checkListFlag = list.Lookalike(checkNode.Type, checkNode.SimilarThreshold, needCheckData)
+	case "YARA":
+		rules := checkNode.Yara
+		if rules == nil || checkNodeValueFromRaw {
+			var err error
+			if rules, err = LoadYaraRules(checkNodeValue); err != nil {
+				break
+			}
+		}
+		checkListFlag = rules.IsMatch([]byte(needCheckData))
+	case "SCORE_GT":
+		threshold := checkNode.RiskScore
+		if checkNodeValueFromRaw {
+			var err error
+			if threshold, err = strconv.ParseFloat(strings.TrimSpace(checkNodeValue), 64); err != nil {
+				break
+			}
+		}
+		score, err := common.RiskScore(checkNode.Entity, needCheckData)
+		if err != nil {
+			break
+		}
+		checkListFlag = score > threshold
+	case "IN_LIST":
+		lists := common.GlobalSharedLists
+		if lists == nil {
+			break
+		}
+		names := checkNode.SharedLists
+		if names == nil || checkNodeValueFromRaw {
+			names = strings.Split(checkNodeValue, ",")
+			for i := range names {
+				names[i] = strings.TrimSpace(names[i])
+			}
+		}
+		checkListFlag = lists.Contains(names, needCheckData)
 	case "PLUGIN":
 		args := GetPluginRealArgs(checkNode.PluginArgs, data, ruleCache)
-		result, err := checkNode.Plugin.FuncEvalCheckNode(args...)
+		result, err := evalPluginCheck(checkNode, args)
 		if err != nil {
 			return false
 		}
@@ -1318,6 +2143,23 @@ func mapDeepCopyWithExtraCapacity(m map[string]interface{}, extraCap int) map[st
 	return result
 }
 
+// sendDownstream forwards one result to every downstream, honoring verdict routing in route mode.
+// Writes are blocking to ensure no data loss.
+func (r *Ruleset) sendDownstream(res map[string]interface{}) {
+	verdict := ""
+	if r.ChainMode == ChainModeRoute {
+		verdict, _ = res[VerdictFieldName].(string)
+	}
+	token := common.GetDeliveryToken(res)
+	for key, downCh := range r.DownStream {
+		if want := r.DownStreamVerdict[key]; want != "" && verdict != "" && want != verdict {
+			continue
+		}
+		token.Retain()
+		*downCh <- res
+	}
+}
+
 // addHitRuleID appends the hit rule ID to the data map.
 func addHitRuleID(data map[string]interface{}, ruleID string) {
 	// data is guaranteed to be non-nil when called from EngineCheck
@@ -1369,6 +2211,30 @@ func (r *Ruleset) GetIncrementAndUpdate() uint64 {
 	return 0
 }
 
+// GetSuppressedIncrementAndUpdate returns the matches suppressed per rule ID since the last call
+func (r *Ruleset) GetSuppressedIncrementAndUpdate() map[string]uint64 {
+	r.suppressedMu.Lock()
+	defer r.suppressedMu.Unlock()
+	increment := r.suppressed
+	r.suppressed = nil
+	return increment
+}
+
+// GetExcludedIncrementAndUpdate returns the events dropped per rule ID of an EXCLUDE ruleset since
+// the last call
+func (r *Ruleset) GetExcludedIncrementAndUpdate() map[string]uint64 {
+	var increment map[string]uint64
+	for i := range r.excluded {
+		if n := r.excluded[i].Swap(0); n > 0 && i < len(r.Rules) {
+			if increment == nil {
+				increment = make(map[string]uint64)
+			}
+			increment[r.Rules[i].ID] += n
+		}
+	}
+	return increment
+}
+
 // GetRunningTaskCount returns the number of currently running tasks in the thread pool
 // Returns 0 if the thread pool is not initialized
 func (r *Ruleset) GetRunningTaskCount() int {
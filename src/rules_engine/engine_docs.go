@@ -0,0 +1,561 @@
+package rules_engine
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// RulesetDoc describes a parsed ruleset for detection catalogs
+type RulesetDoc struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Type      string    `json:"type"`
+	ChainMode string    `json:"chain,omitempty"`
+	Explain   bool      `json:"explain,omitempty"`
+	Masks     []string  `json:"masks,omitempty"`
+	Drop      []string  `json:"drop_fields,omitempty"`
+	Rules     []RuleDoc `json:"rules"`
+}
+
+// RuleDoc describes one rule, Operations lists its operations in execution order
+type RuleDoc struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name,omitempty"`
+	Desc       string         `json:"desc,omitempty"`
+	Priority   string         `json:"priority,omitempty"`
+	Meta       *RuleMeta      `json:"meta,omitempty"`
+	Checks     int            `json:"checks"`
+	Thresholds int            `json:"thresholds"`
+	Operations []OperationDoc `json:"operations"`
+}
+
+// OperationDoc is one line of a rule description. Nested operations, such as the checks of a
+// checklist or the children of a group, follow their parent with a greater depth.
+type OperationDoc struct {
+	Depth  int    `json:"depth"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Doc builds the documentation of the ruleset from its parsed rules
+func (r *Ruleset) Doc() *RulesetDoc {
+	doc := &RulesetDoc{
+		ID:        r.RulesetID,
+		Name:      r.Name,
+		Author:    r.Author,
+		Type:      r.Type,
+		ChainMode: r.ChainMode,
+		Explain:   r.Explain,
+		Rules:     make([]RuleDoc, 0, len(r.Rules)),
+	}
+	if doc.Type == "" {
+		doc.Type = "DETECTION"
+	}
+	for _, mask := range r.Masks {
+		doc.Masks = append(doc.Masks, mask.Field+" ("+mask.Strategy+")")
+	}
+	for _, fieldPath := range r.DropFields {
+		doc.Drop = append(doc.Drop, strings.Join(fieldPath, "."))
+	}
+	for i := range r.Rules {
+		doc.Rules = append(doc.Rules, ruleDoc(&r.Rules[i]))
+	}
+	return doc
+}
+
+func ruleDoc(rule *Rule) RuleDoc {
+	doc := RuleDoc{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		Desc:       rule.Desc,
+		Priority:   rule.Priority,
+		Meta:       rule.Meta,
+		Operations: []OperationDoc{},
+	}
+	add := func(depth int, kind, detail string) {
+		doc.Operations = append(doc.Operations, OperationDoc{Depth: depth, Kind: kind, Detail: detail})
+	}
+	addCheck := func(depth int, node *CheckNodes) {
+		doc.Checks++
+		kind := "Check"
+		if node.ID != "" {
+			kind = "Check " + node.ID
+		}
+		add(depth, kind, checkDetail(node))
+	}
+	addThreshold := func(depth int, threshold *Threshold) {
+		doc.Thresholds++
+		kind := "Threshold"
+		if threshold.ID != "" {
+			kind = "Threshold " + threshold.ID
+		}
+		add(depth, kind, thresholdDetail(threshold))
+	}
+	var addGroup func(depth int, group *Group)
+	addGroup = func(depth int, group *Group) {
+		add(depth, groupKind(group.Type), "")
+		for _, child := range group.Children {
+			if child.Check != nil {
+				addCheck(depth+1, child.Check)
+			} else if child.Group != nil {
+				addGroup(depth+1, child.Group)
+			}
+		}
+	}
+	addChecklist := func(depth int, checklist *Checklist) {
+		condition := checklist.Condition
+		if condition == "" {
+			condition = "all checks"
+		}
+		add(depth, "Checklist", condition)
+		for i := range checklist.CheckNodes {
+			addCheck(depth+1, &checklist.CheckNodes[i])
+		}
+		for i := range checklist.ThresholdNodes {
+			addThreshold(depth+1, &checklist.ThresholdNodes[i])
+		}
+	}
+
+	if rule.Queue == nil {
+		return doc
+	}
+	for _, op := range *rule.Queue {
+		switch op.Type {
+		case T_Check:
+			node := rule.CheckMap[op.ID]
+			addCheck(0, &node)
+		case T_CheckList:
+			checklist := rule.ChecklistMap[op.ID]
+			addChecklist(0, &checklist)
+		case T_Threshold:
+			threshold := rule.ThresholdMap[op.ID]
+			addThreshold(0, &threshold)
+		case T_Iterator:
+			iterator := rule.IteratorMap[op.ID]
+			add(0, "Iterator "+iterator.Type, fmt.Sprintf("%s as %s", iterator.Field, iterator.Variable))
+			for i := range iterator.CheckNodes {
+				addCheck(1, &iterator.CheckNodes[i])
+			}
+			for i := range iterator.ThresholdNodes {
+				addThreshold(1, &iterator.ThresholdNodes[i])
+			}
+			for i := range iterator.Checklists {
+				addChecklist(1, &iterator.Checklists[i])
+			}
+			for i := range iterator.Groups {
+				addGroup(1, &iterator.Groups[i])
+			}
+		case T_Group:
+			group := rule.GroupMap[op.ID]
+			addGroup(0, &group)
+		case T_Sequence:
+			sequence := rule.SequenceMap[op.ID]
+			detail := fmt.Sprintf("by %s within %s", sequence.GroupBy, sequence.Range)
+			if sequence.TimeField != "" {
+				detail += " (event time " + sequence.TimeField + ")"
+			}
+			add(0, "Sequence", detail)
+			for i := range sequence.Steps {
+				step := &sequence.Steps[i]
+				kind := fmt.Sprintf("Step %d", i+1)
+				if step.ID != "" {
+					kind += " " + step.ID
+				}
+				detail := ""
+				if step.Count > 1 {
+					detail = fmt.Sprintf("%d times", step.Count)
+				}
+				add(1, kind, detail)
+				for _, child := range step.Group.Children {
+					if child.Check != nil {
+						addCheck(2, child.Check)
+					} else if child.Group != nil {
+						addGroup(2, child.Group)
+					}
+				}
+			}
+		case T_Append:
+			appendOp := rule.AppendsMap[op.ID]
+			if appendOp.Type == "INTEL" {
+				add(0, "Append", fmt.Sprintf("%s = intel(%s in %s)", appendOp.FieldName, appendOp.Source, appendOp.Value))
+			} else if appendOp.Type == "TRANSFORM" {
+				add(0, "Append", fmt.Sprintf("%s = transform(%s)", appendOp.FieldName, appendOp.Value))
+			} else if appendOp.Type == "DNS" {
+				add(0, "Append", fmt.Sprintf("%s = dns(%s)", appendOp.FieldName, appendOp.Source))
+			} else {
+				add(0, "Append", fmt.Sprintf("%s = %s", appendOp.FieldName, appendOp.Value))
+			}
+		case T_Modify:
+			modify := rule.ModifyMap[op.ID]
+			if modify.FieldName == "" {
+				add(0, "Modify", "event = "+modify.Value)
+			} else {
+				add(0, "Modify", fmt.Sprintf("%s = %s", modify.FieldName, modify.Value))
+			}
+		case T_Plugin:
+			add(0, "Plugin", rule.PluginMap[op.ID].Value)
+		case T_Del:
+			fields := make([]string, 0, len(rule.DelMap[op.ID]))
+			for _, path := range rule.DelMap[op.ID] {
+				fields = append(fields, strings.Join(path, "."))
+			}
+			add(0, "Delete", strings.Join(fields, ", "))
+		case T_GeoIP:
+			geoIP := rule.GeoIPMap[op.ID]
+			add(0, "GeoIP", fmt.Sprintf("%s -> %s*", geoIP.Field, geoIP.Prefix))
+		case T_Extract:
+			extract := rule.ExtractMap[op.ID]
+			add(0, "Extract", fmt.Sprintf("%s = %s", extract.FieldName, extract.Source))
+		case T_Suppress:
+			suppress := rule.SuppressMap[op.ID]
+			detail := "alert once per " + suppress.Window
+			if suppress.Key != "" {
+				detail += " by " + suppress.Key
+			}
+			add(0, "Suppress", detail)
+		case T_Score:
+			score := rule.ScoreMap[op.ID]
+			add(0, "Score", fmt.Sprintf("%+g to %s %s", score.Weight, score.Entity, score.Field))
+		case T_Requires:
+			requires := rule.RequiresMap[op.ID]
+			detail := fmt.Sprintf("rule %s matched within %s", requires.Rule, requires.Within)
+			if requires.Key != "" {
+				detail += " by " + requires.Key
+			}
+			add(0, "Requires", detail)
+		case T_Baseline:
+			baseline := rule.BaselineMap[op.ID]
+			detail := fmt.Sprintf("%s of %s by %s over %s", baseline.Type, baseline.Field, baseline.GroupBy, baseline.Range)
+			if baseline.Type != BaselineDistinct {
+				detail += fmt.Sprintf(", %g sigma %s", baseline.Sigma, baseline.Direction)
+			}
+			add(0, "Baseline", detail)
+		case T_Session:
+			session := rule.SessionMap[op.ID]
+			detail := fmt.Sprintf("by %s until idle for %s", session.GroupBy, session.Gap)
+			if session.MaxDuration != "" {
+				detail += " or lasting " + session.MaxDuration
+			}
+			if session.TimeField != "" {
+				detail += " (event time " + session.TimeField + ")"
+			}
+			add(0, "Session", detail)
+			for _, aggregate := range session.Aggregates {
+				add(1, "Aggregate", fmt.Sprintf("%s of %s as %s%s", aggregate.Type, aggregate.Field, session.Prefix, aggregate.Name))
+			}
+		case T_Script:
+			script := rule.ScriptMap[op.ID]
+			add(0, "Script", fmt.Sprintf("%s, %d lines", script.Lang, strings.Count(script.Source, "\n")+1))
+		}
+	}
+	return doc
+}
+
+func checkDetail(node *CheckNodes) string {
+	var detail string
+	switch node.Type {
+	case "PLUGIN", "EXPR":
+		detail = node.Value
+	case "ISNULL", "NOTNULL":
+		detail = fmt.Sprintf("%s %s", node.Field, node.Type)
+	case "TIME":
+		detail = fmt.Sprintf("%s TIME %q", node.Field, node.Value)
+		if node.Field == "" {
+			detail = fmt.Sprintf("current time %q", node.Value)
+		}
+	default:
+		detail = fmt.Sprintf("%s %s %q", node.Field, node.Type, node.Value)
+	}
+	if node.Threshold != "" {
+		detail += " threshold " + node.Threshold
+	}
+	if node.Logic != "" {
+		detail += fmt.Sprintf(" (%s of values split by %q)", node.Logic, node.Delimiter)
+	}
+	return detail
+}
+
+func thresholdDetail(threshold *Threshold) string {
+	var counted string
+	switch threshold.CountType {
+	case "SUM":
+		counted = fmt.Sprintf("sum of %s", threshold.CountField)
+	case "CLASSIFY":
+		counted = fmt.Sprintf("distinct %s", threshold.CountField)
+	case ThresholdCountAvg, ThresholdCountMin, ThresholdCountMax:
+		counted = fmt.Sprintf("%s of %s", strings.ToLower(threshold.CountType), threshold.CountField)
+	case ThresholdCountPercentile:
+		counted = fmt.Sprintf("p%g of %s", threshold.Percentile, threshold.CountField)
+	default:
+		counted = "events"
+	}
+	value := strconv.Itoa(threshold.Value)
+	if threshold.ValueRef != "" && threshold.Value > 0 {
+		value = fmt.Sprintf("%s (default %d)", threshold.ValueRef, threshold.Value)
+	} else if threshold.ValueRef != "" {
+		value = threshold.ValueRef
+	}
+	detail := fmt.Sprintf("%s >= %s within %s by %s", counted, value, threshold.Range, threshold.group_by)
+	if threshold.Window != "" && threshold.Window != ThresholdWindowFixed {
+		detail += fmt.Sprintf(" (%s window", threshold.Window)
+		if threshold.TimeField != "" {
+			detail += " on " + threshold.TimeField
+		}
+		detail += ")"
+	}
+	return detail
+}
+
+func groupKind(t string) string {
+	switch t {
+	case "ALL":
+		return "All of"
+	case "ANY":
+		return "Any of"
+	case "NOT":
+		return "None of"
+	}
+	return t
+}
+
+// Markdown renders the documentation as a Markdown document
+func (d *RulesetDoc) Markdown() string {
+	var b strings.Builder
+
+	title := d.ID
+	if d.Name != "" {
+		title = fmt.Sprintf("%s (%s)", d.Name, d.ID)
+	}
+	fmt.Fprintf(&b, "# %s\n\n", mdText(title))
+	fmt.Fprintf(&b, "- **Type:** %s\n", d.Type)
+	if d.Author != "" {
+		fmt.Fprintf(&b, "- **Author:** %s\n", mdText(d.Author))
+	}
+	if d.ChainMode != "" {
+		fmt.Fprintf(&b, "- **Chain:** %s\n", d.ChainMode)
+	}
+	if d.Explain {
+		b.WriteString("- **Explain:** true\n")
+	}
+	if len(d.Masks) > 0 {
+		fmt.Fprintf(&b, "- **Masked fields:** %s\n", mdText(strings.Join(d.Masks, ", ")))
+	}
+	if len(d.Drop) > 0 {
+		fmt.Fprintf(&b, "- **Dropped fields:** %s\n", mdText(strings.Join(d.Drop, ", ")))
+	}
+	fmt.Fprintf(&b, "- **Rules:** %d\n\n", len(d.Rules))
+
+	if len(d.Rules) > 0 {
+		b.WriteString("| Rule | Name | Priority | Checks | Thresholds |\n")
+		b.WriteString("|------|------|----------|--------|------------|\n")
+		for _, rule := range d.Rules {
+			fmt.Fprintf(&b, "| [%s](#%s) | %s | %s | %d | %d |\n", mdCell(rule.ID), mdAnchor(rule.ID), mdCell(rule.Name),
+				orDash(rule.Priority), rule.Checks, rule.Thresholds)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, rule := range d.Rules {
+		fmt.Fprintf(&b, "<a id=\"%s\"></a>\n\n## %s\n\n", mdAnchor(rule.ID), mdText(rule.ID))
+		if rule.Name != "" {
+			fmt.Fprintf(&b, "**%s**\n\n", mdText(rule.Name))
+		}
+		if rule.Desc != "" {
+			fmt.Fprintf(&b, "%s\n\n", rule.Desc)
+		}
+		if rule.Priority != "" {
+			fmt.Fprintf(&b, "Priority: %s\n\n", rule.Priority)
+		}
+		if m := rule.Meta; m != nil {
+			for _, field := range []struct {
+				name   string
+				values []string
+			}{
+				{"Severity", nonEmpty(m.Severity)},
+				{"Confidence", nonEmpty(m.Confidence)},
+				{"Tags", m.Tags},
+				{"ATT&CK", m.Attack},
+				{"References", m.References},
+			} {
+				if len(field.values) > 0 {
+					fmt.Fprintf(&b, "- **%s:** %s\n", field.name, mdText(strings.Join(field.values, ", ")))
+				}
+			}
+			b.WriteString("\n")
+		}
+		if len(rule.Operations) == 0 {
+			continue
+		}
+		b.WriteString("Operations, in execution order:\n\n")
+		for _, op := range rule.Operations {
+			b.WriteString(strings.Repeat("  ", op.Depth))
+			fmt.Fprintf(&b, "- **%s**", mdText(op.Kind))
+			if op.Detail != "" {
+				fmt.Fprintf(&b, ": %s", mdCode(op.Detail))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+var mdEscaper = strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]", "<", "&lt;", ">", "&gt;", "#", "\\#")
+
+func mdText(s string) string {
+	return mdEscaper.Replace(s)
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(mdText(s), "|", "\\|"), "\n", " ")
+}
+
+// mdCode wraps s in a code span with a fence longer than any backtick run it contains
+func mdCode(s string) string {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if longest > 0 {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+func mdAnchor(id string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(id) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return "rule-" + b.String()
+}
+
+// nonEmpty returns s as a list, empty when s is empty
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var rulesetDocHTML = template.Must(template.New("ruleset").Funcs(template.FuncMap{
+	"anchor": mdAnchor,
+	"indent": func(depth int) int { return depth * 24 },
+	"dash":   orDash,
+	"lines":  func(s string) []string { return strings.Split(s, "\n") },
+	"join":   func(values []string) string { return strings.Join(values, ", ") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Name}}{{.Name}} ({{.ID}}){{else}}{{.ID}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+code { background: #f4f4f4; padding: 1px 4px; }
+.rule { border-top: 1px solid #ddd; margin-top: 2em; }
+.op { margin: 2px 0; }
+</style>
+</head>
+<body>
+<h1>{{if .Name}}{{.Name}} ({{.ID}}){{else}}{{.ID}}{{end}}</h1>
+<ul>
+<li><strong>Type:</strong> {{.Type}}</li>
+{{- if .Author}}
+<li><strong>Author:</strong> {{.Author}}</li>
+{{- end}}
+{{- if .ChainMode}}
+<li><strong>Chain:</strong> {{.ChainMode}}</li>
+{{- end}}
+{{- if .Explain}}
+<li><strong>Explain:</strong> true</li>
+{{- end}}
+{{- if .Masks}}
+<li><strong>Masked fields:</strong> {{join .Masks}}</li>
+{{- end}}
+{{- if .Drop}}
+<li><strong>Dropped fields:</strong> {{join .Drop}}</li>
+{{- end}}
+<li><strong>Rules:</strong> {{len .Rules}}</li>
+</ul>
+{{- if .Rules}}
+<table>
+<tr><th>Rule</th><th>Name</th><th>Priority</th><th>Checks</th><th>Thresholds</th></tr>
+{{- range .Rules}}
+<tr><td><a href="#{{anchor .ID}}">{{.ID}}</a></td><td>{{.Name}}</td><td>{{dash .Priority}}</td><td>{{.Checks}}</td><td>{{.Thresholds}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- range .Rules}}
+<div class="rule" id="{{anchor .ID}}">
+<h2>{{.ID}}</h2>
+{{- if .Name}}
+<p><strong>{{.Name}}</strong></p>
+{{- end}}
+{{- if .Desc}}
+<p>{{range $i, $line := lines .Desc}}{{if $i}}<br>{{end}}{{$line}}{{end}}</p>
+{{- end}}
+{{- if .Priority}}
+<p>Priority: {{.Priority}}</p>
+{{- end}}
+{{- with .Meta}}
+<ul>
+{{- if .Severity}}
+<li><strong>Severity:</strong> {{.Severity}}</li>
+{{- end}}
+{{- if .Confidence}}
+<li><strong>Confidence:</strong> {{.Confidence}}</li>
+{{- end}}
+{{- if .Tags}}
+<li><strong>Tags:</strong> {{join .Tags}}</li>
+{{- end}}
+{{- if .Attack}}
+<li><strong>ATT&amp;CK:</strong> {{join .Attack}}</li>
+{{- end}}
+{{- range .References}}
+<li><strong>Reference:</strong> <a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Operations}}
+<p>Operations, in execution order:</p>
+{{- range .Operations}}
+<div class="op" style="margin-left: {{indent .Depth}}px"><strong>{{.Kind}}</strong>{{if .Detail}}: <code>{{.Detail}}</code>{{end}}</div>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML renders the documentation as a standalone HTML page
+func (d *RulesetDoc) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := rulesetDocHTML.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
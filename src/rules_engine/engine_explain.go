@@ -0,0 +1,128 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"unicode/utf8"
+)
+
+// ExplainFieldName carries the "why matched" evidence of rulesets with explain="true",
+// keyed by hit rule ID like HitRuleIdFieldName
+const ExplainFieldName = "_hub_explain"
+
+// maxExplainValueLength keeps explanations compact when matched fields hold large values
+const maxExplainValueLength = 256
+
+// matchExplanation collects the evidence of one rule evaluation. It is only allocated for
+// rulesets with explanations enabled, a nil *matchExplanation records nothing.
+type matchExplanation struct {
+	checks     []map[string]interface{}
+	thresholds []map[string]interface{}
+	operations []map[string]interface{}
+}
+
+func newMatchExplanation(enabled bool) *matchExplanation {
+	if !enabled {
+		return nil
+	}
+	return &matchExplanation{}
+}
+
+// addCheck records a check node with the event value it was evaluated against
+func (e *matchExplanation) addCheck(node *CheckNodes, matched bool, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) {
+	if e == nil {
+		return
+	}
+	check := map[string]interface{}{
+		"type":    node.Type,
+		"matched": matched,
+	}
+	if node.ID != "" {
+		check["id"] = node.ID
+	}
+	if node.Field != "" {
+		check["field"] = node.Field
+		if v, ok := GetCheckDataFromCache(ruleCache, node.Field, data, node.FieldList); ok {
+			check["matched_value"] = compactExplainValue(v)
+		}
+	}
+	if node.Value != "" {
+		check["value"] = compactExplainValue(node.Value)
+	}
+	if node.Logic != "" {
+		check["logic"] = node.Logic
+	}
+	e.checks = append(e.checks, check)
+}
+
+// addThreshold records a threshold with its group and the counter at evaluation time
+func (e *matchExplanation) addThreshold(threshold *Threshold, groupBy map[string]string, count int, matched bool) {
+	if e == nil {
+		return
+	}
+	t := map[string]interface{}{
+		"range":   threshold.Range,
+		"value":   threshold.Value,
+		"count":   count,
+		"matched": matched,
+	}
+	if threshold.ID != "" {
+		t["id"] = threshold.ID
+	}
+	if threshold.CountType != "" {
+		t["count_type"] = threshold.CountType
+		t["count_field"] = threshold.CountField
+	}
+	if len(groupBy) > 0 {
+		t["group_by"] = groupBy
+	}
+	e.thresholds = append(e.thresholds, t)
+}
+
+// addOperation records the result of an iterator or group, whose nested checks are not itemized
+func (e *matchExplanation) addOperation(kind, opType string, matched bool) {
+	if e == nil {
+		return
+	}
+	e.operations = append(e.operations, map[string]interface{}{
+		"kind":    kind,
+		"type":    opType,
+		"matched": matched,
+	})
+}
+
+// attach adds the explanation of a hit rule to the emitted event
+func (e *matchExplanation) attach(data map[string]interface{}, hitRuleID string) {
+	if e == nil {
+		return
+	}
+	explanation := map[string]interface{}{}
+	if len(e.checks) > 0 {
+		explanation["checks"] = e.checks
+	}
+	if len(e.thresholds) > 0 {
+		explanation["thresholds"] = e.thresholds
+	}
+	if len(e.operations) > 0 {
+		explanation["operations"] = e.operations
+	}
+
+	// An event passing several explained rulesets keeps the evidence of each hit
+	explanations, ok := data[ExplainFieldName].(map[string]interface{})
+	if !ok {
+		explanations = make(map[string]interface{}, 1)
+		data[ExplainFieldName] = explanations
+	}
+	explanations[hitRuleID] = explanation
+}
+
+func compactExplainValue(v string) string {
+	if len(v) <= maxExplainValueLength {
+		return v
+	}
+	// Cut on a rune boundary
+	cut := maxExplainValueLength
+	for cut > 0 && !utf8.RuneStart(v[cut]) {
+		cut--
+	}
+	return v[:cut] + "..."
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 
@@ -43,6 +44,11 @@ func (d *XMLDecoder) Token() (xml.Token, error) {
 }
 
 func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
+	rawRuleset, err := ExpandIncludes(rawRuleset)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a custom decoder that tracks line numbers
 	content := string(rawRuleset)
 	decoder := NewXMLDecoder(strings.NewReader(content))
@@ -86,6 +92,18 @@ func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
 						ruleset.Name = attr.Value
 					case "author":
 						ruleset.Author = attr.Value
+					case "chain":
+						mode := strings.TrimSpace(attr.Value)
+						if mode != ChainModeContinue && mode != ChainModeStopOnMatch && mode != ChainModeRoute {
+							return nil, fmt.Errorf("root chain must be '%s', '%s' or '%s', got '%s' at line %d", ChainModeContinue, ChainModeStopOnMatch, ChainModeRoute, attr.Value, elementLine)
+						}
+						ruleset.ChainMode = mode
+					case "explain":
+						explain, err := strconv.ParseBool(strings.TrimSpace(attr.Value))
+						if err != nil {
+							return nil, fmt.Errorf("root explain must be 'true' or 'false', got '%s' at line %d", attr.Value, elementLine)
+						}
+						ruleset.Explain = explain
 					}
 				}
 
@@ -101,6 +119,16 @@ func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
 					PluginMap:    make(map[int]Plugin),
 					ModifyMap:    make(map[int]Modify),
 					DelMap:       make(map[int][][]string),
+					GroupMap:     make(map[int]Group),
+					GeoIPMap:     make(map[int]GeoIP),
+					SequenceMap:  make(map[int]Sequence),
+					ExtractMap:   make(map[int]Extract),
+					SuppressMap:  make(map[int]Suppress),
+					ScriptMap:    make(map[int]Script),
+					BaselineMap:  make(map[int]Baseline),
+					RequiresMap:  make(map[int]Requires),
+					ScoreMap:     make(map[int]Score),
+					SessionMap:   make(map[int]Session),
 				}
 
 				// Parse rule attributes
@@ -113,6 +141,12 @@ func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
 						currentRule.ID = attr.Value
 					case "name":
 						currentRule.Name = attr.Value
+					case "priority":
+						priority := strings.TrimSpace(attr.Value)
+						if priority != common.PriorityHigh && priority != common.PriorityNormal {
+							return nil, fmt.Errorf("rule priority must be '%s' or '%s', got '%s' at line %d", common.PriorityHigh, common.PriorityNormal, attr.Value, elementLine)
+						}
+						currentRule.Priority = priority
 					}
 				}
 
@@ -201,6 +235,24 @@ func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
 					})
 				}
 
+			case "all", "any", "not":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<%s>' at root level at line %d", element.Name.Local, elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<%s>' is not supported inside checklist in rule '%s' at line %d, use the checklist condition instead", element.Name.Local, currentRule.ID, elementLine)
+				}
+				group, err := parseGroup(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.GroupMap[operatorIDCounter] = group
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Group,
+					ID:   operatorIDCounter,
+				})
+
 			case "append":
 				if currentRule != nil {
 					appendOp, err := parseAppend(element, decoder, elementLine)
@@ -246,6 +298,233 @@ func ParseRuleset(rawRuleset []byte) (*Ruleset, error) {
 					})
 				}
 
+			case "desc":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<%s>' at root level at line %d", element.Name.Local, elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("unsupported element '<%s>' inside checklist in rule '%s' at line %d", element.Name.Local, currentRule.ID, elementLine)
+				}
+				if currentRule.Desc != "" {
+					return nil, fmt.Errorf("rule '%s' has more than one desc at line %d", currentRule.ID, elementLine)
+				}
+				desc, err := parseDesc(decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				currentRule.Desc = desc
+
+			case "test":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<%s>' at root level at line %d", element.Name.Local, elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("unsupported element '<%s>' inside checklist in rule '%s' at line %d", element.Name.Local, currentRule.ID, elementLine)
+				}
+				test, err := parseRuleTest(element, decoder, elementLine, len(currentRule.Tests)+1)
+				if err != nil {
+					return nil, err
+				}
+				currentRule.Tests = append(currentRule.Tests, test)
+
+			case "meta":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<%s>' at root level at line %d", element.Name.Local, elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("unsupported element '<%s>' inside checklist in rule '%s' at line %d", element.Name.Local, currentRule.ID, elementLine)
+				}
+				if currentRule.Meta != nil {
+					return nil, fmt.Errorf("rule '%s' has more than one meta at line %d", currentRule.ID, elementLine)
+				}
+				meta, err := parseMeta(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				currentRule.Meta = meta
+
+			case "geoip":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<geoip>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<geoip>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				geoIP, err := parseGeoIP(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.GeoIPMap[operatorIDCounter] = geoIP
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_GeoIP,
+					ID:   operatorIDCounter,
+				})
+
+			case "extract":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<extract>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<extract>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				extract, err := parseExtract(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.ExtractMap[operatorIDCounter] = extract
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Extract,
+					ID:   operatorIDCounter,
+				})
+
+			case "suppress":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<suppress>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<suppress>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				suppress, err := parseSuppress(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.SuppressMap[operatorIDCounter] = suppress
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Suppress,
+					ID:   operatorIDCounter,
+				})
+
+			case "requires":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<requires>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<requires>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				requires, err := parseRequires(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.RequiresMap[operatorIDCounter] = requires
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Requires,
+					ID:   operatorIDCounter,
+				})
+
+			case "score":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<score>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<score>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				score, err := parseScore(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.ScoreMap[operatorIDCounter] = score
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Score,
+					ID:   operatorIDCounter,
+				})
+
+			case "script":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<script>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<script>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				script, err := parseScript(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.ScriptMap[operatorIDCounter] = script
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Script,
+					ID:   operatorIDCounter,
+				})
+
+			case "baseline":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<baseline>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<baseline>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				baseline, err := parseBaseline(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.BaselineMap[operatorIDCounter] = baseline
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Baseline,
+					ID:   operatorIDCounter,
+				})
+
+			case "session":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<session>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<session>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				session, err := parseSession(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.SessionMap[operatorIDCounter] = session
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Session,
+					ID:   operatorIDCounter,
+				})
+
+			case "sequence":
+				if currentRule == nil {
+					return nil, fmt.Errorf("unsupported element '<sequence>' at root level at line %d", elementLine)
+				}
+				if inChecklist {
+					return nil, fmt.Errorf("element '<sequence>' is not supported inside checklist in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				sequence, err := parseSequence(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				operatorIDCounter++
+				currentRule.SequenceMap[operatorIDCounter] = sequence
+				*currentRule.Queue = append(*currentRule.Queue, EngineOperator{
+					Type: T_Sequence,
+					ID:   operatorIDCounter,
+				})
+
+			case "mask":
+				if currentRule != nil {
+					return nil, fmt.Errorf("element '<mask>' is only allowed at root level, outside of rules, in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				mask, err := parseMask(element, decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				ruleset.Masks = append(ruleset.Masks, mask)
+
+			case "drop_fields":
+				if currentRule != nil {
+					return nil, fmt.Errorf("element '<drop_fields>' is only allowed at root level, outside of rules, in rule '%s' at line %d", currentRule.ID, elementLine)
+				}
+				dropFields, err := parseDropFields(decoder, elementLine)
+				if err != nil {
+					return nil, err
+				}
+				ruleset.DropFields = append(ruleset.DropFields, dropFields...)
+
 			case "del":
 				if currentRule != nil {
 					delFields, err := parseDel(element, decoder, elementLine)
@@ -387,6 +666,12 @@ func parseIterator(element xml.StartElement, decoder *XMLDecoder, elementLine in
 					return iterator, err
 				}
 				iterator.Checklists = append(iterator.Checklists, cl)
+			case "all", "any", "not":
+				group, err := parseGroup(t, decoder, decoder.line)
+				if err != nil {
+					return iterator, err
+				}
+				iterator.Groups = append(iterator.Groups, group)
 			default:
 				// Skip unknown elements
 				if err := decoder.Skip(); err != nil {
@@ -396,7 +681,7 @@ func parseIterator(element xml.StartElement, decoder *XMLDecoder, elementLine in
 		case xml.EndElement:
 			if t.Name.Local == "iterator" {
 				// Validate that iterator has at least one check node or threshold node or checklist
-				if len(iterator.CheckNodes) == 0 && len(iterator.ThresholdNodes) == 0 && len(iterator.Checklists) == 0 {
+				if len(iterator.CheckNodes) == 0 && len(iterator.ThresholdNodes) == 0 && len(iterator.Checklists) == 0 && len(iterator.Groups) == 0 {
 					return iterator, fmt.Errorf("iterator must have at least one check node or threshold node at line %d", elementLine)
 				}
 				return iterator, nil
@@ -464,6 +749,54 @@ func parseIteratorChecklist(element xml.StartElement, decoder *XMLDecoder, eleme
 	}
 }
 
+// parseGroup parses an <all>, <any> or <not> element with its nested checks and groups
+func parseGroup(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Group, error) {
+	group := Group{Type: strings.ToUpper(element.Name.Local)}
+
+	if len(element.Attr) > 0 {
+		return group, fmt.Errorf("'<%s>' does not support attributes, got '%s' at line %d", element.Name.Local, element.Attr[0].Name.Local, elementLine)
+	}
+	err := parseGroupChildren(&group, element, decoder, elementLine)
+	return group, err
+}
+
+// parseGroupChildren parses the checks and groups nested in element until its end
+func parseGroupChildren(group *Group, element xml.StartElement, decoder *XMLDecoder, elementLine int) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error parsing '<%s>' content at line %d: %v", element.Name.Local, elementLine, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "check":
+				checkNode, err := parseCheckNode(t, decoder, decoder.line)
+				if err != nil {
+					return err
+				}
+				group.Children = append(group.Children, GroupChild{Check: &checkNode})
+			case "all", "any", "not":
+				child, err := parseGroup(t, decoder, decoder.line)
+				if err != nil {
+					return err
+				}
+				group.Children = append(group.Children, GroupChild{Group: &child})
+			default:
+				return fmt.Errorf("unsupported element '<%s>' inside '<%s>' at line %d, only check, all, any and not are allowed", t.Name.Local, element.Name.Local, decoder.line)
+			}
+		case xml.EndElement:
+			if t.Name.Local == element.Name.Local {
+				if len(group.Children) == 0 {
+					return fmt.Errorf("'<%s>' must contain at least one check or group at line %d", element.Name.Local, elementLine)
+				}
+				return nil
+			}
+		}
+	}
+}
+
 func parseCheckNode(element xml.StartElement, decoder *XMLDecoder, elementLine int) (CheckNodes, error) {
 	var checkNode CheckNodes
 
@@ -478,8 +811,8 @@ func parseCheckNode(element xml.StartElement, decoder *XMLDecoder, elementLine i
 			checkNode.Type = checkType
 		case "field":
 			field := strings.TrimSpace(attr.Value)
-			// Check if field is empty and type is not PLUGIN (need to check checkNode.Type)
-			if field == "" && checkNode.Type != "PLUGIN" {
+			// Check if field is empty and type is not PLUGIN, EXPR or TIME (need to check checkNode.Type)
+			if field == "" && checkNode.Type != "PLUGIN" && checkNode.Type != "EXPR" && checkNode.Type != "TIME" {
 				return checkNode, fmt.Errorf("check field cannot be empty at line %d", elementLine)
 			}
 			checkNode.Field = field
@@ -493,6 +826,25 @@ func parseCheckNode(element xml.StartElement, decoder *XMLDecoder, elementLine i
 			checkNode.Logic = logic
 		case "delimiter":
 			checkNode.Delimiter = attr.Value
+		case "threshold":
+			checkNode.Threshold = strings.TrimSpace(attr.Value)
+		case "entity":
+			checkNode.Entity = strings.TrimSpace(attr.Value)
+		case "cache_ttl":
+			checkNode.CacheTTL = strings.TrimSpace(attr.Value)
+		case "nocase", "normalize", "fold_space":
+			enabled, err := parseModifierAttr(attr.Name.Local, attr.Value)
+			if err != nil {
+				return checkNode, fmt.Errorf("%v at line %d", err, elementLine)
+			}
+			switch attr.Name.Local {
+			case "nocase":
+				checkNode.Nocase = enabled
+			case "normalize":
+				checkNode.Normalize = enabled
+			default:
+				checkNode.FoldSpace = enabled
+			}
 		}
 	}
 
@@ -520,6 +872,15 @@ func parseCheckNode(element xml.StartElement, decoder *XMLDecoder, elementLine i
 		case xml.EndElement:
 			if t.Name.Local == "check" {
 				// Additional validation
+				if checkNode.Type == "IS_TYPE" && checkNode.Value == "" {
+					return checkNode, fmt.Errorf("IS_TYPE node value cannot be empty at line %d", elementLine)
+				}
+				if (checkNode.Type == "CIDR" || checkNode.Type == "IP_RANGE" || checkNode.Type == "INTEL" || checkNode.Type == "IN_LIST" || checkNode.Type == "EXPR" || checkNode.Type == "TIME" ||
+					checkNode.Type == "LEVENSHTEIN" || checkNode.Type == "JARO" || checkNode.Type == "HOMOGLYPH" || checkNode.Type == "YARA" || checkNode.Type == "SCORE_GT" ||
+					checkNode.Type == "ARRAY_CONTAINS" || checkNode.Type == "ARRAY_LEN") && checkNode.Value == "" {
+					return checkNode, fmt.Errorf("%s node value cannot be empty at line %d", checkNode.Type, elementLine)
+				}
+
 				if checkNode.Type == "REGEX" && checkNode.Value != "" {
 					// Validate regex pattern
 					if _, err := regexp.Compile(checkNode.Value); err != nil {
@@ -586,7 +947,7 @@ func parseThreshold(element xml.StartElement, decoder *XMLDecoder, elementLine i
 			threshold.Range = rangeValue
 		case "value":
 			// Old syntax support - value as attribute
-			if val, err := strconv.Atoi(attr.Value); err != nil {
+			if val, err := parseThresholdValue(attr.Value); err != nil {
 				return threshold, fmt.Errorf("threshold value must be a positive integer, got '%s' at line %d", attr.Value, elementLine)
 			} else if val <= 0 {
 				return threshold, fmt.Errorf("threshold value must be greater than 0, got %d at line %d", val, elementLine)
@@ -595,18 +956,42 @@ func parseThreshold(element xml.StartElement, decoder *XMLDecoder, elementLine i
 			}
 		case "count_type":
 			countType := strings.TrimSpace(attr.Value)
-			if countType != "" && countType != "SUM" && countType != "CLASSIFY" {
-				return threshold, fmt.Errorf("threshold count_type must be empty (default count mode), 'SUM', or 'CLASSIFY', got '%s' at line %d", countType, elementLine)
+			if !isValidThresholdCountType(countType) {
+				return threshold, fmt.Errorf("threshold count_type must be empty (default count mode), 'SUM', 'CLASSIFY', 'AVG', 'MIN', 'MAX' or 'PERCENTILE', got '%s' at line %d", countType, elementLine)
 			}
 			threshold.CountType = countType
 		case "count_field":
 			threshold.CountField = strings.TrimSpace(attr.Value)
+		case "percentile":
+			p, err := strconv.ParseFloat(strings.TrimSpace(attr.Value), 64)
+			if err != nil || p <= 0 || p > 100 {
+				return threshold, fmt.Errorf("threshold percentile must be a number in (0, 100], got '%s' at line %d", attr.Value, elementLine)
+			}
+			threshold.Percentile = p
 		case "local_cache":
 			localCache := strings.TrimSpace(attr.Value)
 			if localCache != "" && localCache != "true" && localCache != "false" {
 				return threshold, fmt.Errorf("threshold local_cache must be 'true' or 'false', got '%s' at line %d", localCache, elementLine)
 			}
 			threshold.LocalCache = localCache == "true"
+		case "window":
+			window := strings.TrimSpace(attr.Value)
+			if window != "" && window != ThresholdWindowFixed && window != ThresholdWindowSliding && window != ThresholdWindowTumbling {
+				return threshold, fmt.Errorf("threshold window must be 'fixed', 'sliding' or 'tumbling', got '%s' at line %d", window, elementLine)
+			}
+			threshold.Window = window
+		case "time_field":
+			threshold.TimeField = strings.TrimSpace(attr.Value)
+		case "value_ref":
+			ref := strings.TrimSpace(attr.Value)
+			name, ok := strings.CutPrefix(ref, common.ThresholdValueRefPrefix)
+			if !ok {
+				return threshold, fmt.Errorf("threshold value_ref must start with '%s', got '%s' at line %d", common.ThresholdValueRefPrefix, ref, elementLine)
+			}
+			if err := common.ValidateThresholdValueName(name); err != nil {
+				return threshold, fmt.Errorf("invalid threshold value_ref at line %d: %v", elementLine, err)
+			}
+			threshold.ValueRef = ref
 		}
 	}
 
@@ -625,8 +1010,8 @@ func parseThreshold(element xml.StartElement, decoder *XMLDecoder, elementLine i
 		case xml.CharData:
 			content := strings.TrimSpace(string(t))
 			if content != "" {
-				if val, err := strconv.Atoi(content); err != nil {
-					return threshold, fmt.Errorf("threshold value must be a positive integer, got '%s' at line %d", content, elementLine)
+				if val, err := parseThresholdValue(content); err != nil {
+					return threshold, fmt.Errorf("threshold value must be a positive integer, optionally with a KB, MB, GB or TB suffix, got '%s' at line %d", content, elementLine)
 				} else if val <= 0 {
 					return threshold, fmt.Errorf("threshold value must be greater than 0, got %d at line %d", val, elementLine)
 				} else {
@@ -639,14 +1024,20 @@ func parseThreshold(element xml.StartElement, decoder *XMLDecoder, elementLine i
 				if threshold.Range == "" {
 					return threshold, fmt.Errorf("threshold range is required at line %d", elementLine)
 				}
-				if threshold.Value <= 0 {
+				if threshold.Value <= 0 && threshold.ValueRef == "" {
 					return threshold, fmt.Errorf("threshold value is required and must be positive at line %d", elementLine)
 				}
 
 				// Validate count_field requirement
-				if (threshold.CountType == "SUM" || threshold.CountType == "CLASSIFY") && threshold.CountField == "" {
+				if thresholdNeedsCountField(threshold.CountType) && threshold.CountField == "" {
 					return threshold, fmt.Errorf("threshold count_field cannot be empty when count_type is '%s' at line %d", threshold.CountType, elementLine)
 				}
+				if threshold.Percentile != 0 && threshold.CountType != ThresholdCountPercentile {
+					return threshold, fmt.Errorf("threshold percentile requires count_type 'PERCENTILE' at line %d", elementLine)
+				}
+				if msg := thresholdWindowError(&threshold); msg != "" {
+					return threshold, fmt.Errorf("%s at line %d", msg, elementLine)
+				}
 
 				return threshold, nil
 			}
@@ -662,8 +1053,8 @@ func parseAppend(element xml.StartElement, decoder *XMLDecoder, elementLine int)
 		switch attr.Name.Local {
 		case "type":
 			appendType := strings.TrimSpace(attr.Value)
-			if appendType != "" && appendType != "PLUGIN" {
-				return appendElem, fmt.Errorf("append type must be empty or 'PLUGIN', got '%s' at line %d", appendType, elementLine)
+			if appendType != "" && appendType != "PLUGIN" && appendType != "INTEL" && appendType != "TRANSFORM" && appendType != "DNS" {
+				return appendElem, fmt.Errorf("append type must be empty, 'PLUGIN', 'INTEL', 'TRANSFORM' or 'DNS', got '%s' at line %d", appendType, elementLine)
 			}
 			appendElem.Type = appendType
 		case "field":
@@ -672,6 +1063,8 @@ func parseAppend(element xml.StartElement, decoder *XMLDecoder, elementLine int)
 				return appendElem, fmt.Errorf("append field cannot be empty at line %d", elementLine)
 			}
 			appendElem.FieldName = field
+		case "source":
+			appendElem.Source = strings.TrimSpace(attr.Value)
 		}
 	}
 
@@ -695,6 +1088,28 @@ func parseAppend(element xml.StartElement, decoder *XMLDecoder, elementLine int)
 				if appendElem.FieldName == "" {
 					return appendElem, fmt.Errorf("append field is required at line %d", elementLine)
 				}
+				if appendElem.Type == "INTEL" {
+					if appendElem.Source == "" {
+						return appendElem, fmt.Errorf("append INTEL source is required at line %d", elementLine)
+					}
+					if appendElem.Value == "" {
+						return appendElem, fmt.Errorf("append INTEL value cannot be empty at line %d, expected feed names", elementLine)
+					}
+				} else if appendElem.Type == "DNS" {
+					if appendElem.Source == "" {
+						return appendElem, fmt.Errorf("append DNS source is required at line %d", elementLine)
+					}
+					if err := validateDNSLookup(appendElem.Value); err != nil {
+						return appendElem, fmt.Errorf("invalid append DNS at line %d: %v", elementLine, err)
+					}
+				} else if appendElem.Source != "" {
+					return appendElem, fmt.Errorf("append source is only supported by types INTEL and DNS at line %d", elementLine)
+				}
+				if appendElem.Type == "TRANSFORM" {
+					if _, _, err := parseTransform(appendElem.Value); err != nil {
+						return appendElem, fmt.Errorf("invalid append TRANSFORM at line %d: %v", elementLine, err)
+					}
+				}
 
 				if appendElem.Type == "PLUGIN" && appendElem.Value != "" {
 					// Validate plugin call syntax
@@ -861,3 +1276,470 @@ func parseDel(element xml.StartElement, decoder *XMLDecoder, elementLine int) ([
 		}
 	}
 }
+
+// parseGeoIP parses a <geoip field="..." prefix="..."/> element
+func parseGeoIP(element xml.StartElement, decoder *XMLDecoder, elementLine int) (GeoIP, error) {
+	geoIP := GeoIP{Prefix: DefaultGeoIPPrefix}
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "field":
+			geoIP.Field = strings.TrimSpace(attr.Value)
+		case "prefix":
+			geoIP.Prefix = strings.TrimSpace(attr.Value)
+		default:
+			return geoIP, fmt.Errorf("unsupported attribute '%s' in geoip at line %d, only field and prefix are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if geoIP.Field == "" {
+		return geoIP, fmt.Errorf("geoip field cannot be empty at line %d", elementLine)
+	}
+	geoIP.FieldList = common.StringToList(geoIP.Field)
+
+	if err := decoder.Skip(); err != nil {
+		return geoIP, fmt.Errorf("error parsing geoip at line %d: %v", elementLine, err)
+	}
+	return geoIP, nil
+}
+
+// parseExtract parses an <extract source="..." field="..."/> element
+func parseExtract(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Extract, error) {
+	var extract Extract
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "source":
+			extract.Source = strings.TrimSpace(attr.Value)
+		case "field":
+			extract.FieldName = strings.TrimSpace(attr.Value)
+		default:
+			return extract, fmt.Errorf("unsupported attribute '%s' in extract at line %d, only source and field are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if extract.Source == "" {
+		return extract, fmt.Errorf("extract source cannot be empty at line %d", elementLine)
+	}
+	if extract.FieldName == "" {
+		return extract, fmt.Errorf("extract field cannot be empty at line %d", elementLine)
+	}
+	extract.SourceList = common.StringToList(extract.Source)
+
+	if err := decoder.Skip(); err != nil {
+		return extract, fmt.Errorf("error parsing extract at line %d: %v", elementLine, err)
+	}
+	return extract, nil
+}
+
+// parseSuppress parses a <suppress key="..." window="..."/> element
+func parseSuppress(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Suppress, error) {
+	var suppress Suppress
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "key":
+			suppress.Key = strings.TrimSpace(attr.Value)
+		case "window":
+			suppress.Window = strings.TrimSpace(attr.Value)
+		default:
+			return suppress, fmt.Errorf("unsupported attribute '%s' in suppress at line %d, only key and window are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if suppress.Window == "" {
+		return suppress, fmt.Errorf("suppress window cannot be empty at line %d", elementLine)
+	}
+
+	if err := decoder.Skip(); err != nil {
+		return suppress, fmt.Errorf("error parsing suppress at line %d: %v", elementLine, err)
+	}
+	return suppress, nil
+}
+
+// parseRequires parses a <requires rule="..." key="..." within="..."/> element
+func parseRequires(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Requires, error) {
+	var requires Requires
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "rule":
+			requires.Rule = strings.TrimSpace(attr.Value)
+		case "key":
+			requires.Key = strings.TrimSpace(attr.Value)
+		case "within":
+			requires.Within = strings.TrimSpace(attr.Value)
+		default:
+			return requires, fmt.Errorf("unsupported attribute '%s' in requires at line %d, only rule, key and within are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if requires.Rule == "" {
+		return requires, fmt.Errorf("requires rule cannot be empty at line %d", elementLine)
+	}
+	if requires.Within == "" {
+		return requires, fmt.Errorf("requires within cannot be empty at line %d", elementLine)
+	}
+
+	if err := decoder.Skip(); err != nil {
+		return requires, fmt.Errorf("error parsing requires at line %d: %v", elementLine, err)
+	}
+	return requires, nil
+}
+
+// parseScore parses a <score entity="..." field="..." weight="..."/> element
+func parseScore(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Score, error) {
+	var score Score
+	weight := ""
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "entity":
+			score.Entity = strings.TrimSpace(attr.Value)
+		case "field":
+			score.Field = strings.TrimSpace(attr.Value)
+		case "weight":
+			weight = strings.TrimSpace(attr.Value)
+		default:
+			return score, fmt.Errorf("unsupported attribute '%s' in score at line %d, only entity, field and weight are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if score.Field == "" {
+		return score, fmt.Errorf("score field cannot be empty at line %d", elementLine)
+	}
+	if score.Entity == "" {
+		score.Entity = score.Field
+	}
+	if strings.Contains(score.Entity, ":") {
+		return score, fmt.Errorf("score entity cannot contain ':' at line %d", elementLine)
+	}
+	w, err := strconv.ParseFloat(weight, 64)
+	if err != nil || w == 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+		return score, fmt.Errorf("score weight must be a non-zero number, got '%s' at line %d", weight, elementLine)
+	}
+	score.Weight = w
+	score.FieldList = common.StringToList(score.Field)
+
+	if err := decoder.Skip(); err != nil {
+		return score, fmt.Errorf("error parsing score at line %d: %v", elementLine, err)
+	}
+	return score, nil
+}
+
+// parseScript parses a <script lang="lua"> element, the source is its text or CDATA section
+func parseScript(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Script, error) {
+	script := Script{Lang: "lua"}
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "lang":
+			script.Lang = strings.ToLower(strings.TrimSpace(attr.Value))
+		default:
+			return script, fmt.Errorf("unsupported attribute '%s' in script at line %d, only lang is allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if script.Lang != "lua" {
+		return script, fmt.Errorf("unsupported script language '%s' at line %d, only lua is supported", script.Lang, elementLine)
+	}
+
+	var source strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return script, fmt.Errorf("error parsing script at line %d: %v", elementLine, err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			source.Write(t)
+		case xml.StartElement:
+			return script, fmt.Errorf("unexpected element '<%s>' in script at line %d, escape '<' as &lt; or use a CDATA section", t.Name.Local, elementLine)
+		case xml.EndElement:
+			script.Source = strings.TrimSpace(source.String())
+			if script.Source == "" {
+				return script, fmt.Errorf("script cannot be empty at line %d", elementLine)
+			}
+			return script, nil
+		}
+	}
+}
+
+// parseBaseline parses a <baseline field="..." group_by="..." range="..."/> element
+func parseBaseline(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Baseline, error) {
+	var baseline Baseline
+	for _, attr := range element.Attr {
+		value := strings.TrimSpace(attr.Value)
+		var err error
+		switch attr.Name.Local {
+		case "type":
+			baseline.Type = strings.ToUpper(value)
+		case "field":
+			baseline.Field = value
+		case "group_by":
+			baseline.GroupBy = value
+		case "range":
+			baseline.Range = value
+		case "time_field":
+			baseline.TimeField = value
+		case "sigma":
+			baseline.Sigma, err = strconv.ParseFloat(value, 64)
+		case "direction":
+			baseline.Direction = strings.ToLower(value)
+		case "alpha":
+			baseline.Alpha, err = strconv.ParseFloat(value, 64)
+		case "min_samples":
+			baseline.MinSamples, err = strconv.Atoi(value)
+		case "prefix":
+			baseline.Prefix = value
+		default:
+			return baseline, fmt.Errorf("unsupported attribute '%s' in baseline at line %d, only type, field, group_by, range, time_field, sigma, direction, alpha, min_samples and prefix are allowed", attr.Name.Local, elementLine)
+		}
+		if err != nil {
+			return baseline, fmt.Errorf("baseline %s must be a number at line %d, got '%s'", attr.Name.Local, elementLine, value)
+		}
+	}
+	if baseline.Field == "" {
+		return baseline, fmt.Errorf("baseline field cannot be empty at line %d", elementLine)
+	}
+	if baseline.GroupBy == "" {
+		return baseline, fmt.Errorf("baseline group_by is required at line %d", elementLine)
+	}
+	if baseline.Range == "" {
+		return baseline, fmt.Errorf("baseline range is required at line %d", elementLine)
+	}
+
+	if err := decoder.Skip(); err != nil {
+		return baseline, fmt.Errorf("error parsing baseline at line %d: %v", elementLine, err)
+	}
+	return baseline, nil
+}
+
+// parseSession parses a <session> element with its <aggregate> children
+func parseSession(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Session, error) {
+	var session Session
+	for _, attr := range element.Attr {
+		value := strings.TrimSpace(attr.Value)
+		switch attr.Name.Local {
+		case "group_by":
+			session.GroupBy = value
+		case "gap":
+			session.Gap = value
+		case "max_duration":
+			session.MaxDuration = value
+		case "time_field":
+			session.TimeField = value
+		case "prefix":
+			session.Prefix = value
+		default:
+			return session, fmt.Errorf("unsupported attribute '%s' in session at line %d, only group_by, gap, max_duration, time_field and prefix are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if session.GroupBy == "" {
+		return session, fmt.Errorf("session group_by is required at line %d", elementLine)
+	}
+	if session.Gap == "" {
+		return session, fmt.Errorf("session gap is required at line %d", elementLine)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return session, fmt.Errorf("error parsing session content at line %d: %v", elementLine, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "aggregate" {
+				return session, fmt.Errorf("unsupported element '<%s>' inside '<session>' at line %d, only aggregate is allowed", t.Name.Local, decoder.line)
+			}
+			var aggregate SessionAggregate
+			for _, attr := range t.Attr {
+				value := strings.TrimSpace(attr.Value)
+				switch attr.Name.Local {
+				case "type":
+					aggregate.Type = strings.ToUpper(value)
+				case "field":
+					aggregate.Field = value
+				case "name":
+					aggregate.Name = value
+				default:
+					return session, fmt.Errorf("unsupported attribute '%s' in aggregate at line %d, only type, field and name are allowed", attr.Name.Local, decoder.line)
+				}
+			}
+			if aggregate.Type == "" || aggregate.Field == "" {
+				return session, fmt.Errorf("session aggregate requires type and field at line %d", decoder.line)
+			}
+			if err := decoder.Skip(); err != nil {
+				return session, fmt.Errorf("error parsing session aggregate at line %d: %v", decoder.line, err)
+			}
+			session.Aggregates = append(session.Aggregates, aggregate)
+		case xml.EndElement:
+			if t.Name.Local == "session" {
+				return session, nil
+			}
+		}
+	}
+}
+
+// parseSequence parses a <sequence> element with its ordered <step> children
+func parseSequence(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Sequence, error) {
+	var sequence Sequence
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "id":
+			sequence.ID = strings.TrimSpace(attr.Value)
+		case "group_by":
+			sequence.GroupBy = strings.TrimSpace(attr.Value)
+		case "range":
+			sequence.Range = strings.TrimSpace(attr.Value)
+		case "time_field":
+			sequence.TimeField = strings.TrimSpace(attr.Value)
+		default:
+			return sequence, fmt.Errorf("unsupported attribute '%s' in sequence at line %d, only id, group_by, range and time_field are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if sequence.GroupBy == "" {
+		return sequence, fmt.Errorf("sequence group_by is required at line %d", elementLine)
+	}
+	if sequence.Range == "" {
+		return sequence, fmt.Errorf("sequence range is required at line %d", elementLine)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return sequence, fmt.Errorf("error parsing sequence content at line %d: %v", elementLine, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "step" {
+				return sequence, fmt.Errorf("unsupported element '<%s>' inside '<sequence>' at line %d, only step is allowed", t.Name.Local, decoder.line)
+			}
+			step, err := parseSequenceStep(t, decoder, decoder.line)
+			if err != nil {
+				return sequence, err
+			}
+			sequence.Steps = append(sequence.Steps, step)
+		case xml.EndElement:
+			if t.Name.Local == "sequence" {
+				if len(sequence.Steps) < 2 {
+					return sequence, fmt.Errorf("sequence must contain at least two steps at line %d", elementLine)
+				}
+				return sequence, nil
+			}
+		}
+	}
+}
+
+// parseSequenceStep parses a <step>, whose checks and groups must all match
+func parseSequenceStep(element xml.StartElement, decoder *XMLDecoder, elementLine int) (SequenceStep, error) {
+	step := SequenceStep{Count: 1, Group: Group{Type: GroupTypeAll}}
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "id":
+			step.ID = strings.TrimSpace(attr.Value)
+		case "count":
+			count, err := strconv.Atoi(strings.TrimSpace(attr.Value))
+			if err != nil || count <= 0 {
+				return step, fmt.Errorf("sequence step count must be a positive integer, got '%s' at line %d", attr.Value, elementLine)
+			}
+			step.Count = count
+		default:
+			return step, fmt.Errorf("unsupported attribute '%s' in step at line %d, only id and count are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	err := parseGroupChildren(&step.Group, element, decoder, elementLine)
+	return step, err
+}
+
+// parseMeta parses a <meta severity="..." confidence="..."> element with its <tag>, <attack> and
+// <reference> children
+func parseMeta(element xml.StartElement, decoder *XMLDecoder, elementLine int) (*RuleMeta, error) {
+	meta := &RuleMeta{}
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "severity":
+			severity, ok := validRuleLevel(attr.Value, RuleSeverities)
+			if !ok {
+				return nil, fmt.Errorf("meta severity must be one of %s, got '%s' at line %d", strings.Join(RuleSeverities, ", "), attr.Value, elementLine)
+			}
+			meta.Severity = severity
+		case "confidence":
+			confidence, ok := validRuleLevel(attr.Value, RuleConfidences)
+			if !ok {
+				return nil, fmt.Errorf("meta confidence must be one of %s, got '%s' at line %d", strings.Join(RuleConfidences, ", "), attr.Value, elementLine)
+			}
+			meta.Confidence = confidence
+		default:
+			return nil, fmt.Errorf("unsupported attribute '%s' in meta at line %d, only severity and confidence are allowed", attr.Name.Local, elementLine)
+		}
+	}
+
+	var child string
+	var content strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing meta at line %d: %v", elementLine, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if child != "" {
+				return nil, fmt.Errorf("meta %s cannot contain element '<%s>' at line %d", child, t.Name.Local, elementLine)
+			}
+			switch t.Name.Local {
+			case "tag", "attack", "reference":
+				child = t.Name.Local
+				content.Reset()
+			default:
+				return nil, fmt.Errorf("unsupported element '<%s>' in meta at line %d, only tag, attack and reference are allowed", t.Name.Local, elementLine)
+			}
+		case xml.CharData:
+			if child != "" {
+				content.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "meta" {
+				return meta, nil
+			}
+			value := strings.TrimSpace(content.String())
+			if value == "" {
+				return nil, fmt.Errorf("meta %s cannot be empty at line %d", child, elementLine)
+			}
+			switch child {
+			case "tag":
+				meta.Tags = append(meta.Tags, value)
+			case "attack":
+				technique := strings.ToUpper(value)
+				if !attackTechniqueRegex.MatchString(technique) {
+					return nil, fmt.Errorf("invalid ATT&CK technique '%s' at line %d, expected an ID such as T1110 or T1110.001", value, elementLine)
+				}
+				meta.Attack = append(meta.Attack, technique)
+			case "reference":
+				meta.References = append(meta.References, value)
+			}
+			child = ""
+		}
+	}
+}
+
+// parseDesc reads the description of a rule, the indentation of every line is removed
+func parseDesc(decoder *XMLDecoder, elementLine int) (string, error) {
+	var content strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			content.Write(t)
+		case xml.StartElement:
+			return "", fmt.Errorf("desc cannot contain element '<%s>' at line %d", t.Name.Local, elementLine)
+		case xml.EndElement:
+			if t.Name.Local == "desc" {
+				lines := strings.Split(strings.TrimSpace(content.String()), "\n")
+				for i := range lines {
+					lines[i] = strings.TrimSpace(lines[i])
+				}
+				desc := strings.Join(lines, "\n")
+				if desc == "" {
+					return "", fmt.Errorf("desc cannot be empty at line %d", elementLine)
+				}
+				return desc, nil
+			}
+		}
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"AgentSmith-HUB/common"
 	"AgentSmith-HUB/logger"
 	"AgentSmith-HUB/plugin"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
-	"os"
+	"maps"
 	regexpgo "regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -112,6 +113,26 @@ const (
 	T_Plugin                        // Plugin = 5
 	T_Iterator                      // Iterator = 6
 	T_Modify                        // Modify = 7
+	T_Group                         // Group = 8
+	T_GeoIP                         // GeoIP = 9
+	T_Sequence                      // Sequence = 10
+	T_Extract                       // Extract = 11
+	T_Suppress                      // Suppress = 12
+	T_Script                        // Script = 13
+	T_Baseline                      // Baseline = 14
+	T_Requires                      // Requires = 15
+	T_Score                         // Score = 16
+	T_Session                       // Session = 17
+)
+
+// DefaultGeoIPPrefix is prepended to the fields appended by a <geoip> element without prefix
+const DefaultGeoIPPrefix = "geo_"
+
+// Boolean group types, written as <all>, <any> and <not> in rules
+const (
+	GroupTypeAll = "ALL"
+	GroupTypeAny = "ANY"
+	GroupTypeNot = "NOT"
 )
 
 type EngineOperator struct {
@@ -123,6 +144,19 @@ type Rule struct {
 	ID   string `xml:"id,attr"`
 	Name string `xml:"name,attr"`
 
+	// Desc is the human readable description from the <desc> element, used by the ruleset documentation
+	Desc string
+
+	// Priority "high" marks the rule's alerts with common.PriorityFieldName so outputs deliver them first
+	Priority string `xml:"priority,attr"`
+
+	// Meta is the severity, tags and ATT&CK techniques from the <meta> element, added to matched
+	// events as RuleMetaFieldName
+	Meta *RuleMeta
+
+	// Tests are the test cases from the <test> elements, run by RunRuleTests and never in production
+	Tests []RuleTest
+
 	Queue *[]EngineOperator
 
 	ChecklistMap map[int]Checklist
@@ -133,6 +167,19 @@ type Rule struct {
 	PluginMap    map[int]Plugin
 	ModifyMap    map[int]Modify
 	DelMap       map[int][][]string
+	GroupMap     map[int]Group
+	GeoIPMap     map[int]GeoIP
+	SequenceMap  map[int]Sequence
+	ExtractMap   map[int]Extract
+	SuppressMap  map[int]Suppress
+	ScriptMap    map[int]Script
+	BaselineMap  map[int]Baseline
+	RequiresMap  map[int]Requires
+	ScoreMap     map[int]Score
+	SessionMap   map[int]Session
+
+	// hitKeys are recorded when the rule matches, for the <requires> of the rules referencing it
+	hitKeys []ruleHitKey
 }
 
 type Ruleset struct {
@@ -151,8 +198,20 @@ type Ruleset struct {
 	Rules       []Rule
 	RulesCount  int
 
+	// ChainMode controls what a detection ruleset forwards when chained with other components
+	ChainMode string
+
+	// Explain embeds the matched checks and threshold counters of each hit in ExplainFieldName
+	Explain bool
+
+	// Masks and DropFields rewrite every event the ruleset forwards, see applyOutputPolicy
+	Masks      []Mask
+	DropFields [][]string
+
 	UpStream   map[string]*chan map[string]interface{}
 	DownStream map[string]*chan map[string]interface{}
+	// DownStreamVerdict restricts a downstream (keyed like DownStream) to "match" or "nomatch" events in route mode
+	DownStreamVerdict map[string]string
 
 	stopChan chan struct{} // Control channel for Start/Stop
 	antsPool *ants.Pool    // Ants thread pool
@@ -160,6 +219,12 @@ type Ruleset struct {
 	Cache            *ristretto.Cache[string, int]
 	CacheForClassify *ristretto.Cache[string, map[string]bool]
 
+	// Sliding windows of local cache thresholds, guarded by mu
+	slidingWindows map[string]*slidingWindow
+	slidingUpdates uint64
+	// Values of local cache thresholds aggregating count_field (AVG, MIN, MAX, PERCENTILE), guarded by mu
+	statWindows map[string]*statWindow
+
 	// Regex result cache for this ruleset instance
 	RegexResultCache *RegexResultCache
 
@@ -172,11 +237,31 @@ type Ruleset struct {
 	// Performance optimization: pre-compute test mode flag
 	isTestMode bool // true if ProjectNodeSequence starts with "TEST."
 
+	// Rule profiles by rule ID, nil for rulesets that are not profiled, see attachRuleProfiles
+	profiles map[string]*ruleProfile
+
 	// metrics - only total count is needed now
 	processTotal      uint64         // cumulative message processing total
 	lastReportedTotal uint64         // For calculating increments in 10-second intervals
 	wg                sync.WaitGroup // WaitGroup for goroutine management
 
+	// Matches suppressed by <suppress> per rule ID since the last collection, guarded by suppressedMu
+	suppressed   map[string]uint64
+	suppressedMu sync.Mutex
+
+	// Events dropped by each rule of an EXCLUDE ruleset since the last collection, by rule index
+	excluded []atomic.Uint64
+
+	// shadow is the new version evaluated on the events of this ruleset in shadow mode, see
+	// SetShadow. shadowState is set on shadow rulesets only.
+	shadow      atomic.Pointer[Ruleset]
+	shadowState *shadowState
+
+	// Open sessions of the <session> elements by group key, guarded by sessionsMu
+	sessions        map[string]*sessionState
+	sessionsDropped uint64 // events not sessionized because maxOpenSessions was reached
+	sessionsMu      sync.Mutex
+
 	// OwnerProjects field removed - project usage is now calculated dynamically
 }
 
@@ -197,6 +282,32 @@ type Iterator struct {
 	CheckNodes     []CheckNodes `xml:"node"`
 	ThresholdNodes []Threshold  `xml:"threshold"`
 	Checklists     []Checklist  `xml:"checklist"`
+	Groups         []Group
+}
+
+// Group combines check nodes and nested groups with explicit boolean logic:
+// ALL matches when every child matches, ANY when at least one child matches,
+// NOT when its children (combined with AND) do not match.
+type Group struct {
+	Type     string
+	Children []GroupChild
+}
+
+// GroupChild is either a check node or a nested group
+type GroupChild struct {
+	Check *CheckNodes
+	Group *Group
+}
+
+// ForEachCheckNode calls fn for every check node in the group, including nested groups
+func (g *Group) ForEachCheckNode(fn func(node *CheckNodes)) {
+	for _, child := range g.Children {
+		if child.Check != nil {
+			fn(child.Check)
+		} else if child.Group != nil {
+			child.Group.ForEachCheckNode(fn)
+		}
+	}
 }
 
 // CheckNodes represents a single check operation in a checklist.
@@ -208,14 +319,38 @@ type CheckNodes struct {
 	FieldList []string                            // parsed field path
 	Logic     string                              `xml:"logic,attr"`
 	Delimiter string                              `xml:"delimiter,attr"`
+	// Largest edit distance of LEVENSHTEIN checks and lowest similarity of JARO checks
+	Threshold string `xml:"threshold,attr"`
 
 	DelimiterFieldList []string
 	Value              string `xml:",chardata"`
 	Regex              *regexp.Regex
+	regexSet           *fieldRegexSet  // set of the static REGEX checks on the field, see buildRegexSets
+	regexSetIndex      int             // index of the pattern in regexSet
+	IPRanges           *IPRangeSet     // parsed value of CIDR and IP_RANGE checks
+	IntelFeeds         []string        // feeds of INTEL checks
+	SharedLists        []string        // lists of IN_LIST checks
+	Expr               *Expression     // compiled value of EXPR checks
+	Schedule           *TimeSchedule   // parsed value of TIME checks
+	Similar            *SimilarityList // protected values of LEVENSHTEIN, JARO and HOMOGLYPH checks
+	SimilarThreshold   float64         // parsed threshold of LEVENSHTEIN and JARO checks
+	Yara               *YaraRules      // compiled rule file of YARA checks
+	// Entity type of SCORE_GT checks, the field when empty
+	Entity    string         `xml:"entity,attr"`
+	RiskScore float64        // parsed value of SCORE_GT checks
+	ArrayLen  *ArrayLenCheck // parsed value of ARRAY_LEN checks
+	// Modifiers of string and REGEX checks, see checkModifiers
+	Nocase    bool `xml:"nocase,attr"`
+	Normalize bool `xml:"normalize,attr"`
+	FoldSpace bool `xml:"fold_space,attr"`
+	modifiers checkModifiers
 
 	Plugin     *plugin.Plugin
 	PluginArgs []*PluginArg
 	IsNegated  bool // Whether the plugin result should be negated (for ! prefix)
+	// Results of PLUGIN checks are cached for CacheTTL by plugin name and arguments
+	CacheTTL       string `xml:"cache_ttl,attr"`
+	PluginCacheTTL time.Duration
 }
 
 type PluginArg struct {
@@ -237,19 +372,32 @@ type Threshold struct {
 	Range          string              `xml:"range,attr"` // Time range for aggregation
 	RangeInt       int                 // Parsed range in seconds
 	LocalCache     bool                `xml:"local_cache,attr"` // Whether to use local cache
-	CountType      string              `xml:"count_type,attr"`  // Type of counting (SUM/CLASSIFY)
+	CountType      string              `xml:"count_type,attr"`  // Type of counting (SUM/CLASSIFY/AVG/MIN/MAX/PERCENTILE)
 	CountField     string              `xml:"count_field,attr"` // Field to count
 	CountFieldList []string            // Parsed count field path
-	Value          int                 `xml:",chardata"` // Threshold value
+	Percentile     float64             `xml:"percentile,attr"` // Percentile of PERCENTILE, default 95
+	Value          int                 `xml:",chardata"`       // Threshold value
+	ValueRef       string              `xml:"value_ref,attr"`  // redis:<name> of a value set through /threshold-values
 	GroupByID      string              // Unique identifier for grouping
+	Window         string              `xml:"window,attr"`     // fixed (default), sliding or tumbling
+	TimeField      string              `xml:"time_field,attr"` // Field of the event time, processing time when empty
+	TimeFieldList  []string            // Parsed time field path
 }
 
 // Append defines additional fields to append after rule matching.
 // It supports both static values and plugin-based dynamic values.
 type Append struct {
-	Type      string `xml:"type,attr"`  // Type of append (PLUGIN)
-	FieldName string `xml:"field,attr"` // Name of field to append
-	Value     string `xml:",chardata"`  // Value to append
+	Type      string `xml:"type,attr"`   // Type of append (PLUGIN, INTEL, TRANSFORM or DNS)
+	FieldName string `xml:"field,attr"`  // Name of field to append
+	Value     string `xml:",chardata"`   // Value to append, the feeds of INTEL, the chain of TRANSFORM, the lookup of DNS
+	Source    string `xml:"source,attr"` // Field looked up in the feeds of INTEL or resolved by DNS
+
+	SourceList []string // Parsed source field path
+	IntelFeeds []string // Feeds of INTEL
+
+	TransformSource     string          // Source of TRANSFORM, a _$ reference or template
+	TransformSourceList []string        // Parsed field path when the source is a single _$ reference
+	Transforms          []transformFunc // Functions of TRANSFORM
 
 	Plugin     *plugin.Plugin // Plugin instance if type is PLUGIN
 	PluginArgs []*PluginArg   // Arguments for plugin execution
@@ -267,6 +415,147 @@ type Modify struct {
 	PluginArgs []*PluginArg
 }
 
+// GeoIP appends the location and network owner of the address in Field, looked up in the
+// databases configured under geoip in config.yaml, as fields named Prefix + country, city, asn...
+type GeoIP struct {
+	Field     string `xml:"field,attr"`
+	FieldList []string
+	Prefix    string `xml:"prefix,attr"`
+}
+
+// Extract copies the value at Source, a nested field or a JSONPath expression, to the top-level
+// field FieldName
+type Extract struct {
+	Source     string `xml:"source,attr"`
+	SourceList []string
+	FieldName  string `xml:"field,attr"`
+}
+
+// Suppress stops a rule for Window after it passed for the same values of the Key fields, so a
+// match alerts once per cooldown. The cooldown is kept in Redis and shared by the cluster.
+type Suppress struct {
+	Key       string
+	KeyFields []string   // key fields, in the order of Key
+	KeyList   [][]string // parsed paths of KeyFields
+	Window    string
+	WindowInt int    // parsed window in seconds
+	GroupByID string // isolates the cooldowns of the ruleset, rule and element
+}
+
+// Requires passes when the rule Rule of the same ruleset matched within Within for the same
+// values of the Key fields. The matches are kept in Redis and shared by the cluster.
+type Requires struct {
+	Rule      string
+	Key       string
+	KeyFields []string   // key fields, in the order of Key
+	KeyList   [][]string // parsed paths of KeyFields
+	Within    string
+	WithinInt int // parsed window in seconds
+}
+
+// Score adds Weight to the risk score of the entity of type Entity whose id is the value of
+// Field, see common.RiskAdd
+type Score struct {
+	Entity    string
+	Field     string
+	FieldList []string
+	Weight    float64
+}
+
+// ruleHitKey is recorded for TTL seconds when a rule required by other rules matches
+type ruleHitKey struct {
+	Key       string
+	KeyFields []string
+	KeyList   [][]string
+	TTL       int
+}
+
+// Script runs a Lua snippet on the event. The event is available as the global table event and
+// changes to it are kept. A script returning false fails the rule like a check.
+type Script struct {
+	Lang    string
+	Source  string
+	Program *LuaScript
+}
+
+// Baseline keeps rolling statistics of Field per GroupBy entity in Redis, shared by the cluster,
+// and passes when the value is anomalous for the entity: Sigma standard deviations from the mean
+// for ZSCORE and EWMA, a value the entity did not have within Range for DISTINCT. The statistics
+// are appended to the event as Prefix + mean, stddev, score and samples (distinct and new).
+type Baseline struct {
+	Type          string // ZSCORE, EWMA or DISTINCT
+	Field         string
+	FieldList     []string
+	GroupBy       string
+	GroupByFields []string   // group_by fields, in the order of GroupBy
+	GroupByList   [][]string // parsed paths of GroupByFields
+	Range         string
+	RangeInt      int
+	TimeField     string // Field of the event time, processing time when empty
+	TimeFieldList []string
+	Sigma         float64
+	Direction     string  // up, down or both
+	Alpha         float64 // smoothing factor of EWMA
+	MinSamples    int     // values needed before the baseline can flag
+	Prefix        string
+	GroupByID     string
+}
+
+// Session groups the events sharing the group_by fields until none arrives for Gap or the session
+// lasts MaxDuration. The rule then continues with a summary event holding the group_by fields and
+// Prefix + start, end, duration, event_count, closed_by and the aggregates. Open sessions are
+// kept in memory by each node.
+type Session struct {
+	GroupBy        string
+	GroupByFields  []string   // group_by fields, in the order of GroupBy
+	GroupByList    [][]string // parsed paths of GroupByFields
+	Gap            string
+	GapInt         int
+	MaxDuration    string
+	MaxDurationInt int    // 0 when sessions only close on inactivity
+	TimeField      string // Field of the event time, processing time when empty
+	TimeFieldList  []string
+	Prefix         string
+	Aggregates     []SessionAggregate
+	GroupByID      string
+}
+
+// SessionAggregate is a value of the session summary computed over Field of the events
+type SessionAggregate struct {
+	Type      string // COUNT, SUM, AVG, MIN, MAX, DISTINCT, VALUES, FIRST or LAST
+	Field     string
+	FieldList []string
+	Name      string // summary field, after the prefix of the session
+}
+
+// Sequence matches events that fulfil its steps in order, sharing the group_by fields, within
+// Range of the first event of the first step. The progress of each group is kept in Redis.
+type Sequence struct {
+	ID            string
+	GroupBy       string
+	GroupByList   map[string][]string
+	Range         string
+	RangeInt      int
+	TimeField     string // Field of the event time, processing time when empty
+	TimeFieldList []string
+	Steps         []SequenceStep
+	GroupByID     string
+}
+
+// SequenceStep is completed by Count events matching all its checks and groups
+type SequenceStep struct {
+	ID    string
+	Count int
+	Group Group
+}
+
+// ForEachCheckNode calls fn for every check node of the steps, including nested groups
+func (s *Sequence) ForEachCheckNode(fn func(node *CheckNodes)) {
+	for i := range s.Steps {
+		s.Steps[i].Group.ForEachCheckNode(fn)
+	}
+}
+
 // Plugin represents a plugin configuration with its execution parameters
 type Plugin struct {
 	Value      string         `xml:",chardata"` // Plugin value/configuration
@@ -293,6 +582,8 @@ type ValidationResult struct {
 	IsValid  bool                `json:"is_valid"`
 	Errors   []ValidationError   `json:"errors"`
 	Warnings []ValidationWarning `json:"warnings"`
+	// Expanded is the ruleset after resolving its includes and extends, empty when it has none
+	Expanded string `json:"expanded,omitempty"`
 }
 
 // ValidateWithDetails performs detailed validation and returns structured errors with line numbers
@@ -309,6 +600,22 @@ func ValidateWithDetails(path string, raw string) (*ValidationResult, error) {
 		Warnings: []ValidationWarning{},
 	}
 
+	// Resolve includes and extends, line numbers of later errors refer to the expanded ruleset
+	expanded, err := ExpandIncludes(rawRuleset)
+	if err != nil {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    extractLineFromXMLError(err.Error()),
+			Message: "Include error",
+			Detail:  err.Error(),
+		})
+		return result, nil
+	}
+	if !bytes.Equal(expanded, rawRuleset) {
+		result.Expanded = string(expanded)
+		rawRuleset = expanded
+	}
+
 	// Parse XML using new ParseRuleset function
 	ruleset, err := ParseRuleset(rawRuleset)
 	if err != nil {
@@ -534,6 +841,29 @@ func validateRulesetStructure(ruleset *Ruleset, xmlContent string, result *Valid
 		}
 	}
 
+	// Check the rules referenced by <requires>, in the order of the elements
+	for ruleIndex, rule := range ruleset.Rules {
+		if rule.Queue == nil {
+			continue
+		}
+		requiresIndex := 0
+		for _, op := range *rule.Queue {
+			if op.Type != T_Requires {
+				continue
+			}
+			requires := rule.RequiresMap[op.ID]
+			if _, exists := ruleIDMap[requires.Rule]; !exists || requires.Rule == rule.ID {
+				result.IsValid = false
+				result.Errors = append(result.Errors, ValidationError{
+					Line:    findElementInRule(xmlContent, rule.ID, "<requires", ruleIndex, requiresIndex),
+					Message: "Requires must reference another rule of the ruleset",
+					Detail:  fmt.Sprintf("Rule ID: %s, Required rule: '%s'", rule.ID, requires.Rule),
+				})
+			}
+			requiresIndex++
+		}
+	}
+
 	// Validate each rule
 	for ruleIndex, rule := range ruleset.Rules {
 		validateRule(&rule, xmlContent, ruleIndex, result)
@@ -574,49 +904,54 @@ func validateRule(rule *Rule, xmlContent string, ruleIndex int, result *Validati
 	validateRuleDuplicateElements(xmlContent, ruleID, ruleIndex, result)
 
 	// Validate standalone checks in CheckMap
-	checkCount := 0
-	for _, checkNode := range rule.CheckMap {
+	// Elements are validated in source order: the index locates the element's line
+	for checkCount, key := range orderedKeys(rule.CheckMap) {
+		checkNode := rule.CheckMap[key]
 		validateStandaloneCheck(&checkNode, xmlContent, ruleID, ruleIndex, checkCount, result)
-		checkCount++
 	}
 
 	// Validate checklists in ChecklistMap
-	for _, checklist := range rule.ChecklistMap {
+	for _, key := range orderedKeys(rule.ChecklistMap) {
+		checklist := rule.ChecklistMap[key]
 		validateChecklist(&checklist, xmlContent, ruleID, ruleIndex, result)
 	}
 
 	// Validate thresholds in ThresholdMap
-	for _, threshold := range rule.ThresholdMap {
+	for _, key := range orderedKeys(rule.ThresholdMap) {
+		threshold := rule.ThresholdMap[key]
 		validateThreshold(&threshold, xmlContent, ruleID, ruleIndex, result)
 	}
 
 	// Validate iterators in IteratorMap
-	for _, iterator := range rule.IteratorMap {
+	for _, key := range orderedKeys(rule.IteratorMap) {
+		iterator := rule.IteratorMap[key]
 		validateIterator(&iterator, xmlContent, ruleID, ruleIndex, result)
 	}
 
 	// Validate appends in AppendsMap
-	appendCount := 0
-	for _, appendElem := range rule.AppendsMap {
+	for appendCount, key := range orderedKeys(rule.AppendsMap) {
+		appendElem := rule.AppendsMap[key]
 		validateAppend(&appendElem, xmlContent, ruleID, ruleIndex, appendCount, result)
-		appendCount++
 	}
 
 	// Validate plugins in PluginMap
-	pluginCount := 0
-	for _, plugin := range rule.PluginMap {
+	for pluginCount, key := range orderedKeys(rule.PluginMap) {
+		plugin := rule.PluginMap[key]
 		validatePlugin(&plugin, xmlContent, ruleID, ruleIndex, pluginCount, result)
-		pluginCount++
 	}
 
 	// Validate modifies in ModifyMap
-	modifyCount := 0
-	for _, modify := range rule.ModifyMap {
+	for modifyCount, key := range orderedKeys(rule.ModifyMap) {
+		modify := rule.ModifyMap[key]
 		validateModify(&modify, xmlContent, ruleID, ruleIndex, modifyCount, result)
-		modifyCount++
 	}
 }
 
+// orderedKeys returns the keys of an element map in source order
+func orderedKeys[T any](m map[int]T) []int {
+	return slices.Sorted(maps.Keys(m))
+}
+
 // validateRuleDuplicateElements checks for duplicate elements within a rule
 // Since all elements now support multiple instances, this function is kept for future validation needs
 func validateRuleDuplicateElements(xmlContent, ruleID string, ruleIndex int, result *ValidationResult) {
@@ -643,6 +978,8 @@ func validateStandaloneCheck(checkNode *CheckNodes, xmlContent, ruleID string, r
 			"PLUGIN", "END", "START", "NEND", "NSTART", "INCL", "NI",
 			"NCS_END", "NCS_START", "NCS_NEND", "NCS_NSTART", "NCS_INCL", "NCS_NI",
 			"MT", "LT", "REGEX", "ISNULL", "NOTNULL", "EQU", "NEQ", "NCS_EQU", "NCS_NEQ",
+			"EXISTS", "NOT_EXISTS", "IS_TYPE", "CIDR", "IP_RANGE", "INTEL", "IN_LIST", "EXPR", "TIME",
+			"LEVENSHTEIN", "JARO", "HOMOGLYPH", "YARA", "SCORE_GT", "IS_NUMERIC", "IS_IP", "ARRAY_CONTAINS", "ARRAY_LEN",
 		}
 
 		isValid := false
@@ -657,15 +994,15 @@ func validateStandaloneCheck(checkNode *CheckNodes, xmlContent, ruleID string, r
 			result.IsValid = false
 			result.Errors = append(result.Errors, ValidationError{
 				Line:    checkLine,
-				Message: "Check type must be one of: PLUGIN, END, START, NEND, NSTART, INCL, NI, NCS_END, NCS_START, NCS_NEND, NCS_NSTART, NCS_INCL, NCS_NI, MT, LT, REGEX, ISNULL, NOTNULL, EQU, NEQ, NCS_EQU, NCS_NEQ",
+				Message: "Check type must be one of: PLUGIN, END, START, NEND, NSTART, INCL, NI, NCS_END, NCS_START, NCS_NEND, NCS_NSTART, NCS_INCL, NCS_NI, MT, LT, REGEX, ISNULL, NOTNULL, EQU, NEQ, NCS_EQU, NCS_NEQ, EXISTS, NOT_EXISTS, IS_TYPE, CIDR, IP_RANGE, INTEL, EXPR",
 				Detail:  fmt.Sprintf("Rule ID: %s, Current value: '%s'", ruleID, checkNode.Type),
 			})
 		}
 	}
 
-	// For PLUGIN type nodes, field is optional since plugins can have their own parameters
+	// For PLUGIN and EXPR type nodes, field is optional since they read the fields they use
 	// For other node types, field is required
-	if checkNode.Type != "PLUGIN" && (checkNode.Field == "" || strings.TrimSpace(checkNode.Field) == "") {
+	if checkNode.Type != "PLUGIN" && checkNode.Type != "EXPR" && checkNode.Type != "TIME" && (checkNode.Field == "" || strings.TrimSpace(checkNode.Field) == "") {
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Line:    checkLine,
@@ -696,6 +1033,121 @@ func validateStandaloneCheck(checkNode *CheckNodes, xmlContent, ruleID string, r
 		}
 	}
 
+	// Validate type check
+	if checkNode.Type == "IS_TYPE" {
+		nodeValue := strings.TrimSpace(checkNode.Value)
+		if nodeValue == "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "IS_TYPE check value cannot be empty",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		} else if checkNode.Logic == "" && !hasFromRawPrefix(nodeValue) && !checkValueTypes[strings.ToLower(nodeValue)] {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "IS_TYPE check value must be one of: string, number, integer, bool, object, array",
+				Detail:  fmt.Sprintf("Rule ID: %s, Current value: '%s'", ruleID, nodeValue),
+			})
+		}
+	}
+
+	// Validate address check
+	if checkNode.Type == "CIDR" || checkNode.Type == "IP_RANGE" {
+		nodeValue := strings.TrimSpace(checkNode.Value)
+		if nodeValue == "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: checkNode.Type + " check value cannot be empty",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		} else if checkNode.Logic == "" && !hasFromRawPrefix(nodeValue) {
+			if _, err := parseIPRangeSet(checkNode.Type, nodeValue); err != nil {
+				result.IsValid = false
+				result.Errors = append(result.Errors, ValidationError{
+					Line:    checkLine,
+					Message: "Invalid " + checkNode.Type + " check value",
+					Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+				})
+			}
+		}
+	}
+
+	// Validate expression check
+	if checkNode.Type == "EXPR" {
+		if checkNode.Logic != "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "EXPR check does not support logic, combine conditions with && and || in the expression",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		} else if _, err := CompileExpression(checkNode.Value); err != nil {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "Invalid EXPR check expression",
+				Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+			})
+		}
+	}
+
+	// Validate threat intel check
+	if checkNode.Type == "INTEL" && strings.TrimSpace(checkNode.Value) == "" {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    checkLine,
+			Message: "INTEL check value cannot be empty, expected feed names",
+			Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+		})
+	}
+
+	// Validate time schedule check
+	if checkNode.Type == "TIME" {
+		if _, err := ParseTimeSchedule(checkNode.Value); err != nil {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "Invalid TIME check schedule",
+				Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+			})
+		}
+	}
+
+	// Validate similarity checks
+	if _, err := parseSimilarityThreshold(checkNode.Type, checkNode.Threshold); err != nil {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    checkLine,
+			Message: "Invalid check threshold",
+			Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+		})
+	}
+
+	// Validate risk score check
+	if checkNode.Type == "SCORE_GT" && !hasFromRawPrefix(strings.TrimSpace(checkNode.Value)) {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(checkNode.Value), 64); err != nil {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    checkLine,
+				Message: "SCORE_GT check value must be a number",
+				Detail:  fmt.Sprintf("Rule ID: %s, Current value: '%s'", ruleID, checkNode.Value),
+			})
+		}
+	}
+
+	// Validate shared list check
+	if checkNode.Type == "IN_LIST" && strings.TrimSpace(checkNode.Value) == "" {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    checkLine,
+			Message: "IN_LIST check value cannot be empty, expected list names",
+			Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+		})
+	}
+
 	// Validate plugin check
 	if checkNode.Type == "PLUGIN" {
 		nodeValue := strings.TrimSpace(checkNode.Value)
@@ -765,6 +1217,8 @@ func validateChecklist(checklist *Checklist, xmlContent, ruleID string, ruleInde
 				"PLUGIN", "END", "START", "NEND", "NSTART", "INCL", "NI",
 				"NCS_END", "NCS_START", "NCS_NEND", "NCS_NSTART", "NCS_INCL", "NCS_NI",
 				"MT", "LT", "REGEX", "ISNULL", "NOTNULL", "EQU", "NEQ", "NCS_EQU", "NCS_NEQ",
+				"EXISTS", "NOT_EXISTS", "IS_TYPE", "CIDR", "IP_RANGE", "INTEL", "IN_LIST", "EXPR", "TIME",
+				"LEVENSHTEIN", "JARO", "HOMOGLYPH", "YARA", "SCORE_GT", "IS_NUMERIC", "IS_IP", "ARRAY_CONTAINS", "ARRAY_LEN",
 			}
 
 			isValid := false
@@ -779,15 +1233,16 @@ func validateChecklist(checklist *Checklist, xmlContent, ruleID string, ruleInde
 				result.IsValid = false
 				result.Errors = append(result.Errors, ValidationError{
 					Line:    nodeLine,
-					Message: "Check node type must be one of: PLUGIN, END, START, NEND, NSTART, INCL, NI, NCS_END, NCS_START, NCS_NEND, NCS_NSTART, NCS_INCL, NCS_NI, MT, LT, REGEX, ISNULL, NOTNULL, EQU, NEQ, NCS_EQU, NCS_NEQ",
+					Message: "Check node type must be one of: PLUGIN, END, START, NEND, NSTART, INCL, NI, NCS_END, NCS_START, NCS_NEND, NCS_NSTART, NCS_INCL, NCS_NI, MT, LT, REGEX, ISNULL, NOTNULL, EQU, NEQ, NCS_EQU, NCS_NEQ, EXISTS, NOT_EXISTS, IS_TYPE, CIDR, IP_RANGE, INTEL, EXPR",
 					Detail:  fmt.Sprintf("Rule ID: %s, Current value: '%s'", ruleID, node.Type),
 				})
 			}
 		}
 
-		// For PLUGIN type nodes, field is optional since plugins can have their own parameters
+		// For PLUGIN, EXPR and TIME type nodes, field is optional since they read the fields they use
+		// or the current time
 		// For other node types, field is required
-		if node.Type != "PLUGIN" && (node.Field == "" || strings.TrimSpace(node.Field) == "") {
+		if node.Type != "PLUGIN" && node.Type != "EXPR" && node.Type != "TIME" && (node.Field == "" || strings.TrimSpace(node.Field) == "") {
 			result.IsValid = false
 			result.Errors = append(result.Errors, ValidationError{
 				Line:    nodeLine,
@@ -891,7 +1346,7 @@ func validateChecklist(checklist *Checklist, xmlContent, ruleID string, ruleInde
 			})
 		}
 
-		if threshold.Value <= 0 {
+		if threshold.Value <= 0 && threshold.ValueRef == "" {
 			result.IsValid = false
 			result.Errors = append(result.Errors, ValidationError{
 				Line:    thresholdLine,
@@ -921,6 +1376,15 @@ func validateChecklist(checklist *Checklist, xmlContent, ruleID string, ruleInde
 			})
 		}
 
+		if msg := thresholdWindowError(&threshold); msg != "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    thresholdLine,
+				Message: "Invalid threshold window",
+				Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, msg),
+			})
+		}
+
 		// Check threshold ID for condition checking
 		if hasCondition {
 			thresholdID := threshold.ID
@@ -956,7 +1420,7 @@ func validateChecklist(checklist *Checklist, xmlContent, ruleID string, ruleInde
 
 // validateThreshold validates threshold elements
 func validateThreshold(threshold *Threshold, xmlContent, ruleID string, ruleIndex int, result *ValidationResult) {
-	if threshold.group_by == "" && threshold.Range == "" && threshold.Value == 0 {
+	if threshold.group_by == "" && threshold.Range == "" && threshold.Value == 0 && threshold.ValueRef == "" {
 		// No threshold defined, skip validation
 		return
 	}
@@ -983,7 +1447,7 @@ func validateThreshold(threshold *Threshold, xmlContent, ruleID string, ruleInde
 	}
 
 	// Enhanced validation for threshold value - must be a positive integer
-	if threshold.Value <= 0 {
+	if threshold.Value <= 0 && threshold.ValueRef == "" {
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Line:    thresholdLine,
@@ -992,23 +1456,40 @@ func validateThreshold(threshold *Threshold, xmlContent, ruleID string, ruleInde
 		})
 	}
 
-	// Validate count_type - must be empty (default count mode), "SUM", or "CLASSIFY"
-	if threshold.CountType != "" && threshold.CountType != "SUM" && threshold.CountType != "CLASSIFY" {
+	// Validate count_type - must be empty (default count mode), "SUM", "CLASSIFY" or an aggregation
+	if !isValidThresholdCountType(threshold.CountType) {
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Line:    thresholdLine,
-			Message: "Threshold count_type must be empty (default count mode), 'SUM', or 'CLASSIFY'",
+			Message: "Threshold count_type must be empty (default count mode), 'SUM', 'CLASSIFY', 'AVG', 'MIN', 'MAX' or 'PERCENTILE'",
 			Detail:  fmt.Sprintf("Rule ID: %s, Current value: '%s'", ruleID, threshold.CountType),
 		})
 	}
+	if threshold.Percentile != 0 && threshold.CountType != ThresholdCountPercentile {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    thresholdLine,
+			Message: "Threshold percentile requires count_type 'PERCENTILE'",
+			Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+		})
+	}
+
+	if msg := thresholdWindowError(threshold); msg != "" {
+		result.IsValid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Line:    thresholdLine,
+			Message: "Invalid threshold window",
+			Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, msg),
+		})
+	}
 
-	// Validate count_field - only required when count_type is "SUM" or "CLASSIFY"
-	if threshold.CountType == "SUM" || threshold.CountType == "CLASSIFY" {
+	// Validate count_field - only required when count_type is set
+	if thresholdNeedsCountField(threshold.CountType) {
 		if threshold.CountField == "" || strings.TrimSpace(threshold.CountField) == "" {
 			result.IsValid = false
 			result.Errors = append(result.Errors, ValidationError{
 				Line:    thresholdLine,
-				Message: "Threshold count_field cannot be empty when count_type is 'SUM' or 'CLASSIFY'",
+				Message: "Threshold count_field cannot be empty when count_type is set",
 				Detail:  fmt.Sprintf("Rule ID: %s, count_type: '%s'", ruleID, threshold.CountType),
 			})
 		}
@@ -1113,8 +1594,8 @@ func validateIteratorCheckNode(checkNode *CheckNodes, xmlContent, ruleID string,
 		})
 	}
 
-	// For non-PLUGIN types, field is required
-	if checkNode.Type != "PLUGIN" && (checkNode.Field == "" || strings.TrimSpace(checkNode.Field) == "") {
+	// For non-PLUGIN and non-EXPR types, field is required
+	if checkNode.Type != "PLUGIN" && checkNode.Type != "EXPR" && checkNode.Type != "TIME" && (checkNode.Field == "" || strings.TrimSpace(checkNode.Field) == "") {
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Line:    checkLine,
@@ -1158,7 +1639,7 @@ func validateIteratorThreshold(threshold *Threshold, xmlContent, ruleID string,
 		})
 	}
 
-	if threshold.Value <= 0 {
+	if threshold.Value <= 0 && threshold.ValueRef == "" {
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Line:    thresholdLine,
@@ -1202,6 +1683,55 @@ func validateAppend(appendElem *Append, xmlContent, ruleID string, ruleIndex, ap
 		})
 	}
 
+	if appendElem.Type == "INTEL" {
+		if strings.TrimSpace(appendElem.Source) == "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    appendLine,
+				Message: "Append INTEL source cannot be empty",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		}
+		if strings.TrimSpace(appendElem.Value) == "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    appendLine,
+				Message: "Append INTEL value cannot be empty, expected feed names",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		}
+	}
+
+	if appendElem.Type == "DNS" {
+		if strings.TrimSpace(appendElem.Source) == "" {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    appendLine,
+				Message: "Append DNS source cannot be empty",
+				Detail:  fmt.Sprintf("Rule ID: %s", ruleID),
+			})
+		}
+		if err := validateDNSLookup(strings.TrimSpace(appendElem.Value)); err != nil {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    appendLine,
+				Message: "Invalid append DNS lookup",
+				Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+			})
+		}
+	}
+
+	if appendElem.Type == "TRANSFORM" {
+		if _, _, err := parseTransform(strings.TrimSpace(appendElem.Value)); err != nil {
+			result.IsValid = false
+			result.Errors = append(result.Errors, ValidationError{
+				Line:    appendLine,
+				Message: "Invalid append TRANSFORM chain",
+				Detail:  fmt.Sprintf("Rule ID: %s, Error: %s", ruleID, err.Error()),
+			})
+		}
+	}
+
 	if appendElem.Type == "PLUGIN" {
 		value := strings.TrimSpace(appendElem.Value)
 		if value == "" {
@@ -1766,19 +2296,37 @@ func formatExpectedParameters(params []plugin.PluginParameter) string {
 }
 
 func Verify(path string, raw string) error {
-	// Use common file reading function
-	rawRuleset, err := common.ReadContentFromPathOrRaw(path, raw)
+	ruleset, _, err := verifyRuleset(path, raw)
 	if err != nil {
-		return fmt.Errorf("failed to read ruleset configuration: %w", err)
+		return err
 	}
 
-	valiRes, err := ValidateWithDetails("", string(raw))
+	// Cleanup caches created during verification to prevent memory leaks
+	// Verify creates temporary ruleset objects that should not persist
+	ruleset.closeCaches()
+	return nil
+}
+
+// verifyRuleset validates, parses and builds a ruleset and returns it with its source. Sources
+// that passed before skip the validation, see validationCache.
+func verifyRuleset(path string, raw string) (*Ruleset, []byte, error) {
+	// Use common file reading function
+	rawRuleset, err := common.ReadContentFromPathOrRaw(path, raw)
 	if err != nil {
-		return fmt.Errorf("failed to validate resource: %w", err)
+		return nil, nil, fmt.Errorf("failed to read ruleset configuration: %w", err)
 	}
 
-	if valiRes != nil && len(valiRes.Errors) > 0 {
-		return fmt.Errorf("%s", valiRes.Errors[0].Message)
+	// Key on the content read, raw is empty when the ruleset is loaded from path
+	validated := rulesetValidationCache.has(string(rawRuleset))
+	if !validated {
+		valiRes, err := ValidateWithDetails("", string(rawRuleset))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to validate resource: %w", err)
+		}
+
+		if valiRes != nil && len(valiRes.Errors) > 0 {
+			return nil, nil, fmt.Errorf("%s", valiRes.Errors[0].Message)
+		}
 	}
 
 	// Parse with new flexible ruleset syntax
@@ -1786,89 +2334,52 @@ func Verify(path string, raw string) error {
 	if err != nil {
 		// Try to extract line number from XML error
 		if strings.Contains(err.Error(), "line") {
-			return fmt.Errorf("failed to parse resource: %w", err)
+			return nil, nil, fmt.Errorf("failed to parse resource: %w", err)
 		}
-		return fmt.Errorf("failed to parse resource: %w (line: unknown)", err)
+		return nil, nil, fmt.Errorf("failed to parse resource: %w (line: unknown)", err)
 	}
 
 	// Build and validate the ruleset completely
 	err = RulesetBuild(ruleset)
 	if err != nil {
+		// Cleanup caches created during RulesetBuild if it failed
+		// to prevent memory leaks when ruleset creation fails
+		ruleset.closeCaches()
 		// RulesetBuild provides detailed validation with rule context
-		if strings.Contains(err.Error(), "line") {
-			return fmt.Errorf("failed to validate resource: %w", err)
-		}
-		return fmt.Errorf("failed to validate resource: %w", err)
+		return nil, nil, fmt.Errorf("failed to validate resource: %w", err)
 	}
 
-	// Cleanup caches created during verification to prevent memory leaks
-	// Verify creates temporary ruleset objects that should not persist
-	if ruleset.Cache != nil {
-		ruleset.Cache.Close()
-		ruleset.Cache = nil
+	if !validated {
+		rulesetValidationCache.add(string(rawRuleset), len(ruleset.Rules))
 	}
-	if ruleset.CacheForClassify != nil {
-		ruleset.CacheForClassify.Close()
-		ruleset.CacheForClassify = nil
+	return ruleset, rawRuleset, nil
+}
+
+// closeCaches releases the caches created by RulesetBuild
+func (r *Ruleset) closeCaches() {
+	if r.Cache != nil {
+		r.Cache.Close()
+		r.Cache = nil
 	}
-	if ruleset.RegexResultCache != nil {
-		ruleset.RegexResultCache.Clear()
-		ruleset.RegexResultCache = nil
+	if r.CacheForClassify != nil {
+		r.CacheForClassify.Close()
+		r.CacheForClassify = nil
+	}
+	if r.RegexResultCache != nil {
+		r.RegexResultCache.Clear()
+		r.RegexResultCache = nil
 	}
-
-	return nil
 }
 
 // NewRuleset creates a new resource from an XML file
 // path: Path to the resource XML file
 func NewRuleset(path string, raw string, id string) (*Ruleset, error) {
-	var rawRuleset []byte
-
-	err := Verify(path, raw)
+	// The ruleset built by the verification is the one returned
+	ruleset, rawRuleset, err := verifyRuleset(path, raw)
 	if err != nil {
 		return nil, fmt.Errorf("ruleset verify error: %s %w", id, err)
 	}
 
-	if path != "" {
-		xmlFile, err := os.Open(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s: %w", path, err)
-		}
-		defer xmlFile.Close()
-
-		rawRuleset, err = io.ReadAll(xmlFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %w", path, err)
-		}
-	} else {
-		rawRuleset = []byte(raw)
-	}
-
-	ruleset, err := ParseRuleset(rawRuleset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ruleset: %w", err)
-	}
-
-	// IMPORTANT: Must call RulesetBuild to initialize all the parsed components
-	err = RulesetBuild(ruleset)
-	if err != nil {
-		// Cleanup caches created during RulesetBuild if it failed
-		// to prevent memory leaks when ruleset creation fails
-		if ruleset.Cache != nil {
-			ruleset.Cache.Close()
-			ruleset.Cache = nil
-		}
-		if ruleset.CacheForClassify != nil {
-			ruleset.CacheForClassify.Close()
-			ruleset.CacheForClassify = nil
-		}
-		if ruleset.RegexResultCache != nil {
-			ruleset.RegexResultCache.Clear()
-			ruleset.RegexResultCache = nil
-		}
-		return nil, fmt.Errorf("ruleset build error: %s %w", id, err)
-	}
-
 	ruleset.Path = path
 
 	if len(ruleset.UpStream) == 0 {
@@ -1971,11 +2482,16 @@ func NewFromExisting(existing *Ruleset, newProjectNodeSequence string) (*Ruleset
 		ProjectNodeSequence: newProjectNodeSequence, // Set the new sequence
 		Type:                existing.Type,
 		IsDetection:         existing.IsDetection,
+		ChainMode:           existing.ChainMode,
+		Explain:             existing.Explain,
+		Masks:               existing.Masks,
+		DropFields:          existing.DropFields,
 		Rules:               existing.Rules,       // Share the same rules
 		RulesCount:          existing.RulesCount,  // Copy the rules count
 		Status:              common.StatusStopped, // Initialize status to stopped
 		UpStream:            make(map[string]*chan map[string]interface{}),
 		DownStream:          make(map[string]*chan map[string]interface{}),
+		DownStreamVerdict:   make(map[string]string),
 		// Performance optimization: pre-compute test mode flag
 		isTestMode: strings.HasPrefix(newProjectNodeSequence, "TEST."),
 		// Note: Cache and CacheForClassify are NOT shared to avoid concurrent access issues
@@ -1983,6 +2499,7 @@ func NewFromExisting(existing *Ruleset, newProjectNodeSequence string) (*Ruleset
 		Cache:            nil,
 		CacheForClassify: nil,
 		RawConfig:        existing.RawConfig,
+		excluded:         make([]atomic.Uint64, len(existing.excluded)),
 		// Note: Runtime fields (stopChan, antsPool, wg, etc.) are intentionally not copied
 		// as they will be initialized when the ruleset starts
 		// Metrics fields (processTotal) are also not copied as they are instance-specific
@@ -2253,6 +2770,19 @@ func RulesetBuild(ruleset *Ruleset) error {
 		return errors.New("resource type only support exclude or detection")
 	}
 
+	if ruleset.ChainMode == "" {
+		ruleset.ChainMode = ChainModeContinue
+	}
+	if !ruleset.IsDetection && ruleset.ChainMode != ChainModeContinue {
+		return fmt.Errorf("chain mode '%s' is only supported for DETECTION rulesets", ruleset.ChainMode)
+	}
+	if !ruleset.IsDetection && ruleset.Explain {
+		return errors.New("explain is only supported for DETECTION rulesets")
+	}
+	if !ruleset.IsDetection {
+		ruleset.excluded = make([]atomic.Uint64, len(ruleset.Rules))
+	}
+
 	for i := range ruleset.Rules {
 		rule := &ruleset.Rules[i]
 
@@ -2260,6 +2790,9 @@ func RulesetBuild(ruleset *Ruleset) error {
 		if strings.TrimSpace(rule.ID) == "" {
 			return errors.New("rule id cannot be empty")
 		}
+		if rule.Priority != "" && !ruleset.IsDetection {
+			return fmt.Errorf("rule %s: priority is only supported for DETECTION rulesets", rule.ID)
+		}
 
 		for i2 := range ruleset.Rules {
 			if strings.TrimSpace(ruleset.Rules[i2].ID) == strings.TrimSpace(rule.ID) && i != i2 {
@@ -2317,6 +2850,9 @@ func RulesetBuild(ruleset *Ruleset) error {
 					}
 					threshold.RangeInt = rangeInt
 				}
+				if err := prepareThresholdWindow(threshold, rule.ID); err != nil {
+					return err
+				}
 
 				// Set threshold group ID - use same format as standalone threshold for consistency
 				threshold.GroupByID = ruleset.RulesetID + rule.ID
@@ -2377,8 +2913,8 @@ func RulesetBuild(ruleset *Ruleset) error {
 			appendType := strings.TrimSpace(appendNode.Type)
 			appendValue := strings.TrimSpace(appendNode.Value)
 
-			if appendType != "" && appendType != "PLUGIN" {
-				return errors.New("append type must be empty or 'PLUGIN': " + rule.ID)
+			if appendType != "" && appendType != "PLUGIN" && appendType != "INTEL" && appendType != "TRANSFORM" && appendType != "DNS" {
+				return errors.New("append type must be empty, 'PLUGIN', 'INTEL', 'TRANSFORM' or 'DNS': " + rule.ID)
 			}
 
 			if appendNode.FieldName == "" {
@@ -2403,6 +2939,41 @@ func RulesetBuild(ruleset *Ruleset) error {
 
 				appendNode.PluginArgs = args
 			}
+
+			if appendNode.Type == "INTEL" {
+				feeds, err := intelFeeds(appendValue)
+				if err != nil {
+					return errors.New(err.Error() + ", rule id: " + rule.ID)
+				}
+				appendNode.IntelFeeds = feeds
+				appendNode.SourceList = common.StringToList(strings.TrimSpace(appendNode.Source))
+				if len(appendNode.SourceList) == 0 {
+					return errors.New("append INTEL source cannot be empty: " + rule.ID)
+				}
+			}
+
+			if appendNode.Type == "TRANSFORM" {
+				source, funcs, err := parseTransform(appendValue)
+				if err != nil {
+					return errors.New(err.Error() + ", rule id: " + rule.ID)
+				}
+				appendNode.TransformSource = source
+				appendNode.TransformSourceList = nil
+				if field, ok := strings.CutPrefix(source, FromRawSymbol); ok && !strings.ContainsAny(field, " "+FromRawSymbol) {
+					appendNode.TransformSourceList = common.StringToList(field)
+				}
+				appendNode.Transforms = funcs
+			}
+
+			if appendNode.Type == "DNS" {
+				if err := validateDNSLookup(appendValue); err != nil {
+					return errors.New(err.Error() + ", rule id: " + rule.ID)
+				}
+				appendNode.SourceList = common.StringToList(strings.TrimSpace(appendNode.Source))
+				if len(appendNode.SourceList) == 0 {
+					return errors.New("append DNS source cannot be empty: " + rule.ID)
+				}
+			}
 			// Update the append node in the map
 			rule.AppendsMap[id] = appendNode
 		}
@@ -2479,7 +3050,7 @@ func RulesetBuild(ruleset *Ruleset) error {
 
 		// Process thresholds in ThresholdMap
 		for id, threshold := range rule.ThresholdMap {
-			if threshold.group_by == "" && threshold.Range == "" && threshold.Value == 0 {
+			if threshold.group_by == "" && threshold.Range == "" && threshold.Value == 0 && threshold.ValueRef == "" {
 				// No threshold configured, skip
 				continue
 			}
@@ -2490,17 +3061,20 @@ func RulesetBuild(ruleset *Ruleset) error {
 			if threshold.Range == "" {
 				return errors.New("threshold range cannot be empty: " + rule.ID)
 			}
-			if threshold.Value <= 0 {
+			if threshold.Value <= 0 && threshold.ValueRef == "" {
 				return errors.New("threshold value must be a positive integer (greater than 0): " + rule.ID)
 			}
 
-			if !(threshold.CountType == "" || threshold.CountType == "SUM" || threshold.CountType == "CLASSIFY") {
-				return errors.New("threshold count_type must be empty (default count mode), 'SUM', or 'CLASSIFY': " + rule.ID)
+			if !isValidThresholdCountType(threshold.CountType) {
+				return errors.New("threshold count_type must be empty (default count mode), 'SUM', 'CLASSIFY', 'AVG', 'MIN', 'MAX' or 'PERCENTILE': " + rule.ID)
+			}
+			if threshold.CountType == ThresholdCountPercentile && threshold.Percentile == 0 {
+				threshold.Percentile = defaultThresholdPercentile
 			}
 
-			if threshold.CountType == "SUM" || threshold.CountType == "CLASSIFY" {
+			if thresholdNeedsCountField(threshold.CountType) {
 				if threshold.CountField == "" {
-					return errors.New("threshold count_field cannot be empty when count_type is 'SUM' or 'CLASSIFY': " + rule.ID)
+					return errors.New("threshold count_field cannot be empty when count_type is '" + threshold.CountType + "': " + rule.ID)
 				} else {
 					// Parse threshold count field path
 					threshold.CountFieldList = common.StringToList(strings.TrimSpace(threshold.CountField))
@@ -2511,6 +3085,9 @@ func RulesetBuild(ruleset *Ruleset) error {
 			if err != nil {
 				return errors.New("threshold parse range err: " + err.Error() + ", rule id: " + rule.ID)
 			}
+			if err := prepareThresholdWindow(&threshold, rule.ID); err != nil {
+				return err
+			}
 
 			threshold.GroupByID = ruleset.RulesetID + rule.ID
 
@@ -2570,6 +3147,13 @@ func RulesetBuild(ruleset *Ruleset) error {
 				}
 			}
 
+			// Process boolean groups within iterator
+			for j := range iterator.Groups {
+				if err := processGroup(&iterator.Groups[j], rule.ID); err != nil {
+					return err
+				}
+			}
+
 			// Process threshold nodes within iterator
 			for j := range iterator.ThresholdNodes {
 				threshold := &iterator.ThresholdNodes[j]
@@ -2594,6 +3178,9 @@ func RulesetBuild(ruleset *Ruleset) error {
 					}
 					threshold.RangeInt = rangeInt
 				}
+				if err := prepareThresholdWindow(threshold, rule.ID); err != nil {
+					return err
+				}
 
 				// Set threshold group ID for iterator thresholds
 				threshold.GroupByID = ruleset.RulesetID + rule.ID
@@ -2675,6 +3262,9 @@ func RulesetBuild(ruleset *Ruleset) error {
 						}
 						threshold.RangeInt = rangeInt
 					}
+					if err := prepareThresholdWindow(threshold, rule.ID); err != nil {
+						return err
+					}
 					threshold.GroupByID = ruleset.RulesetID + rule.ID
 
 					if threshold.LocalCache && !createLocalCache {
@@ -2712,9 +3302,81 @@ func RulesetBuild(ruleset *Ruleset) error {
 			rule.IteratorMap[id] = iterator
 		}
 
+		// Process boolean groups in GroupMap
+		for id, group := range rule.GroupMap {
+			if err := processGroup(&group, rule.ID); err != nil {
+				return err
+			}
+			rule.GroupMap[id] = group
+		}
+
 		// Process del operations in DelMap (no additional processing needed as DelMap already contains parsed field paths)
+
+		// Process sequences in SequenceMap
+		for id, sequence := range rule.SequenceMap {
+			if err := processSequence(&sequence, ruleset.RulesetID, rule.ID, id); err != nil {
+				return err
+			}
+			rule.SequenceMap[id] = sequence
+		}
+
+		// Compile scripts in ScriptMap
+		for id, script := range rule.ScriptMap {
+			if err := processScript(&script, rule.ID); err != nil {
+				return err
+			}
+			rule.ScriptMap[id] = script
+		}
+
+		// Process sessions in SessionMap
+		for id, session := range rule.SessionMap {
+			if !ruleset.IsDetection {
+				return errors.New("session is only supported for DETECTION rulesets, rule id: " + rule.ID)
+			}
+			if err := processSession(&session, ruleset.RulesetID, rule.ID, id); err != nil {
+				return err
+			}
+			rule.SessionMap[id] = session
+		}
+
+		// Process baselines in BaselineMap
+		for id, baseline := range rule.BaselineMap {
+			if err := processBaseline(&baseline, ruleset.RulesetID, rule.ID, id); err != nil {
+				return err
+			}
+			rule.BaselineMap[id] = baseline
+		}
+
+		// Process suppressions in SuppressMap
+		for id, suppress := range rule.SuppressMap {
+			if err := processSuppress(&suppress, ruleset.RulesetID, rule.ID, id); err != nil {
+				return err
+			}
+			rule.SuppressMap[id] = suppress
+		}
+
+		// Process requirements in RequiresMap
+		for id, requires := range rule.RequiresMap {
+			if err := processRequires(&requires, rule.ID); err != nil {
+				return err
+			}
+			rule.RequiresMap[id] = requires
+		}
+
+		// GeoIP lookups need the databases of config.yaml
+		if len(rule.GeoIPMap) > 0 && common.GlobalGeoIP == nil {
+			return errors.New("geoip requires geoip databases in config.yaml, rule id: " + rule.ID)
+		}
 	}
 
+	// Record the matches of the rules referenced by <requires>
+	if err := linkRequiredRules(ruleset); err != nil {
+		return err
+	}
+
+	// Match the static REGEX checks on each field in a single pass
+	buildRegexSets(ruleset)
+
 	// Initialize regex result cache
 	if ruleset.RegexResultCache == nil {
 		ruleset.RegexResultCache = NewRegexResultCache(1000) // Default capacity: 1000 entries
@@ -2727,6 +3389,21 @@ func RulesetBuild(ruleset *Ruleset) error {
 func processCheckNode(node *CheckNodes, checklist *Checklist, ruleID string) error {
 	node.FieldList = common.StringToList(strings.TrimSpace(node.Field))
 
+	threshold, err := parseSimilarityThreshold(node.Type, node.Threshold)
+	if err != nil {
+		return errors.New(err.Error() + ", rule id: " + ruleID)
+	}
+	node.SimilarThreshold = threshold
+	if node.Entity != "" && node.Type != "SCORE_GT" {
+		return errors.New("entity is only supported by SCORE_GT checks, rule id: " + ruleID)
+	}
+	if err := prepareCheckModifiers(node); err != nil {
+		return errors.New(err.Error() + ", rule id: " + ruleID)
+	}
+	if node.CacheTTL != "" && node.Type != "PLUGIN" {
+		return errors.New("cache_ttl is only supported by PLUGIN checks, rule id: " + ruleID)
+	}
+
 	if checklist != nil && checklist.ConditionFlag {
 		id := strings.TrimSpace(node.ID)
 		node.ID = id
@@ -2763,6 +3440,9 @@ func processCheckNode(node *CheckNodes, checklist *Checklist, ruleID string) err
 		}
 
 		node.PluginArgs = args
+		if err := preparePluginCache(node); err != nil {
+			return errors.New(err.Error() + ", rule id: " + ruleID)
+		}
 
 	case "END":
 		node.CheckFunc = END
@@ -2806,14 +3486,172 @@ func processCheckNode(node *CheckNodes, checklist *Checklist, ruleID string) err
 		node.CheckFunc = NCS_EQU
 	case "NCS_NEQ":
 		node.CheckFunc = NCS_NEQ
+	case "EXISTS", "NOT_EXISTS":
+		// handled in checkNodeLogic, the value is ignored
+	case "IS_NUMERIC", "ARRAY_CONTAINS":
+		// handled in checkNodeLogic
+	case "IS_IP":
+		if node.Logic != "" || node.Delimiter != "" {
+			return errors.New("IS_IP check does not support logic and delimiter, rule id: " + ruleID)
+		}
+		switch strings.ToLower(strings.TrimSpace(node.Value)) {
+		case "", "ipv4", "ipv6":
+		default:
+			return errors.New("IS_IP value must be empty, ipv4 or ipv6, got '" + node.Value + "', rule id: " + ruleID)
+		}
+	case "ARRAY_LEN":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			if hasFromRawPrefix(strings.TrimSpace(v)) {
+				continue
+			}
+			check, err := parseArrayLenCheck(v)
+			if err != nil {
+				return errors.New(err.Error() + ", rule id: " + ruleID)
+			}
+			if node.Delimiter == "" {
+				node.ArrayLen = check
+			}
+		}
+	case "IS_TYPE":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if hasFromRawPrefix(v) {
+				continue
+			}
+			if !checkValueTypes[strings.ToLower(v)] {
+				return errors.New("IS_TYPE value must be one of string, number, integer, bool, object, array, got '" + v + "', rule id: " + ruleID)
+			}
+		}
+	case "CIDR", "IP_RANGE":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			if hasFromRawPrefix(strings.TrimSpace(v)) {
+				continue
+			}
+			// Checks with logic look the values up in the cache, which is filled here
+			set, err := getIPRangeSet(node.Type, v)
+			if err != nil {
+				return errors.New(err.Error() + ", rule id: " + ruleID)
+			}
+			if node.Delimiter == "" {
+				node.IPRanges = set
+			}
+		}
+	case "EXPR":
+		if node.Logic != "" {
+			return errors.New("EXPR check does not support logic, rule id: " + ruleID)
+		}
+		expr, err := CompileExpression(node.Value)
+		if err != nil {
+			return errors.New("invalid EXPR check expression: " + err.Error() + ", rule id: " + ruleID)
+		}
+		node.Expr = expr
+	case "INTEL":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			if hasFromRawPrefix(strings.TrimSpace(v)) {
+				continue
+			}
+			feeds, err := intelFeeds(v)
+			if err != nil {
+				return errors.New(err.Error() + ", rule id: " + ruleID)
+			}
+			if node.Delimiter == "" {
+				node.IntelFeeds = feeds
+			}
+		}
+	case "TIME":
+		if node.Logic != "" || node.Delimiter != "" {
+			return errors.New("TIME check does not support logic and delimiter, rule id: " + ruleID)
+		}
+		schedule, err := ParseTimeSchedule(node.Value)
+		if err != nil {
+			return errors.New("invalid TIME check schedule: " + err.Error() + ", rule id: " + ruleID)
+		}
+		node.Schedule = schedule
+	case "LEVENSHTEIN", "JARO", "HOMOGLYPH":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			if hasFromRawPrefix(strings.TrimSpace(v)) {
+				continue
+			}
+			list, err := parseSimilarityList(node.Type, v)
+			if err != nil {
+				return errors.New(err.Error() + ", rule id: " + ruleID)
+			}
+			if node.Delimiter == "" {
+				node.Similar = list
+			}
+		}
+	case "YARA":
+		if node.Logic != "" || node.Delimiter != "" {
+			return errors.New("YARA check does not support logic and delimiter, rule id: " + ruleID)
+		}
+		if hasFromRawPrefix(strings.TrimSpace(node.Value)) {
+			break
+		}
+		rules, err := LoadYaraRules(node.Value)
+		if err != nil {
+			return errors.New(err.Error() + ", rule id: " + ruleID)
+		}
+		node.Yara = rules
+	case "SCORE_GT":
+		if node.Logic != "" || node.Delimiter != "" {
+			return errors.New("SCORE_GT check does not support logic and delimiter, rule id: " + ruleID)
+		}
+		if node.Entity == "" {
+			node.Entity = strings.TrimSpace(node.Field)
+		}
+		if hasFromRawPrefix(strings.TrimSpace(node.Value)) {
+			break
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(node.Value), 64)
+		if err != nil {
+			return errors.New("SCORE_GT value must be a number, got '" + node.Value + "', rule id: " + ruleID)
+		}
+		node.RiskScore = score
+	case "IN_LIST":
+		values := []string{node.Value}
+		if node.Delimiter != "" {
+			values = strings.Split(node.Value, node.Delimiter)
+		}
+		for _, v := range values {
+			if hasFromRawPrefix(strings.TrimSpace(v)) {
+				continue
+			}
+			lists, err := sharedLists(v)
+			if err != nil {
+				return errors.New(err.Error() + ", rule id: " + ruleID)
+			}
+			if node.Delimiter == "" {
+				node.SharedLists = lists
+			}
+		}
 	default:
 		return errors.New("unknown check node type: " + node.Type + ", rule id: " + ruleID)
 	}
 
-	// Compile regex if needed
+	// Compile regex if needed, compiled patterns are shared across ruleset reloads
 	if node.Type == "REGEX" {
 		var err error
-		node.Regex, err = regexp.Compile(node.Value)
+		node.Regex, err = GetCompiledRegex(node.modifiers.regexPattern(node.Value))
 		if err != nil {
 			return err
 		}
@@ -2839,6 +3677,170 @@ func processCheckNode(node *CheckNodes, checklist *Checklist, ruleID string) err
 		}
 	}
 
+	modifyCheckValues(node)
+	return nil
+}
+
+// processGroup validates a boolean group and prepares its check nodes, including nested groups
+func processGroup(group *Group, ruleID string) error {
+	switch group.Type {
+	case GroupTypeAll, GroupTypeAny, GroupTypeNot:
+	default:
+		return errors.New("unknown group type: " + group.Type + ", rule id: " + ruleID)
+	}
+	if len(group.Children) == 0 {
+		return errors.New("group must contain at least one check or group: " + ruleID)
+	}
+
+	for _, child := range group.Children {
+		switch {
+		case child.Check != nil:
+			if err := processCheckNode(child.Check, nil, ruleID); err != nil {
+				return err
+			}
+		case child.Group != nil:
+			if err := processGroup(child.Group, ruleID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processSequence validates a sequence and prepares the check nodes of its steps
+func processSequence(sequence *Sequence, rulesetID, ruleID string, operationID int) error {
+	if len(sequence.Steps) < 2 {
+		return errors.New("sequence must contain at least two steps, rule id: " + ruleID)
+	}
+	rangeInt, err := common.ParseDurationToSecondsInt(sequence.Range)
+	if err != nil {
+		return errors.New("sequence parse range err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	sequence.RangeInt = rangeInt
+
+	sequence.GroupByList = make(map[string][]string)
+	for _, field := range strings.Split(sequence.GroupBy, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			sequence.GroupByList[field] = common.StringToList(field)
+		}
+	}
+	if len(sequence.GroupByList) == 0 {
+		return errors.New("sequence group_by cannot be empty, rule id: " + ruleID)
+	}
+	sequence.TimeFieldList = nil
+	if field := strings.TrimSpace(sequence.TimeField); field != "" {
+		sequence.TimeFieldList = common.StringToList(field)
+	}
+
+	for i := range sequence.Steps {
+		step := &sequence.Steps[i]
+		if step.Count <= 0 {
+			return errors.New("sequence step count must be a positive integer, rule id: " + ruleID)
+		}
+		if err := processGroup(&step.Group, ruleID); err != nil {
+			return err
+		}
+	}
+
+	// Several sequences of a rule keep separate progress
+	sequence.GroupByID = rulesetID + ruleID + "_" + strconv.Itoa(operationID)
+	return nil
+}
+
+// processScript compiles the source of a script
+func processScript(script *Script, ruleID string) error {
+	program, err := CompileLuaScript(script.Source)
+	if err != nil {
+		return errors.New("script compile err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	script.Program = program
+	return nil
+}
+
+// processSuppress parses the window and the key fields of a suppression
+func processSuppress(suppress *Suppress, rulesetID, ruleID string, operationID int) error {
+	windowInt, err := common.ParseDurationToSecondsInt(suppress.Window)
+	if err != nil {
+		return errors.New("suppress parse window err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	if windowInt <= 0 {
+		return errors.New("suppress window must be positive, rule id: " + ruleID)
+	}
+	suppress.WindowInt = windowInt
+
+	suppress.KeyFields, suppress.KeyList = nil, nil
+	for _, field := range strings.Split(suppress.Key, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			suppress.KeyFields = append(suppress.KeyFields, field)
+			suppress.KeyList = append(suppress.KeyList, common.StringToList(field))
+		}
+	}
+
+	suppress.GroupByID = rulesetID + ruleID + "_" + strconv.Itoa(operationID)
+	return nil
+}
+
+// processRequires parses the window and the key fields of a requirement
+func processRequires(requires *Requires, ruleID string) error {
+	withinInt, err := common.ParseDurationToSecondsInt(requires.Within)
+	if err != nil {
+		return errors.New("requires parse within err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	if withinInt <= 0 {
+		return errors.New("requires within must be positive, rule id: " + ruleID)
+	}
+	requires.WithinInt = withinInt
+
+	requires.KeyFields, requires.KeyList = nil, nil
+	for _, field := range strings.Split(requires.Key, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			requires.KeyFields = append(requires.KeyFields, field)
+			requires.KeyList = append(requires.KeyList, common.StringToList(field))
+		}
+	}
+	requires.Key = strings.Join(requires.KeyFields, ",")
+	return nil
+}
+
+// linkRequiredRules tells the rules referenced by <requires> which keys to record when they match,
+// for the longest window of the requirements sharing a key
+func linkRequiredRules(ruleset *Ruleset) error {
+	index := make(map[string]int, len(ruleset.Rules))
+	for i := range ruleset.Rules {
+		index[ruleset.Rules[i].ID] = i
+		ruleset.Rules[i].hitKeys = nil
+	}
+	for i := range ruleset.Rules {
+		rule := &ruleset.Rules[i]
+		for _, requires := range rule.RequiresMap {
+			j, ok := index[requires.Rule]
+			if !ok {
+				return errors.New("requires rule '" + requires.Rule + "' not found in ruleset, rule id: " + rule.ID)
+			}
+			if j == i {
+				return errors.New("a rule cannot require itself, rule id: " + rule.ID)
+			}
+			required := &ruleset.Rules[j]
+			found := false
+			for k := range required.hitKeys {
+				if required.hitKeys[k].Key == requires.Key {
+					required.hitKeys[k].TTL = max(required.hitKeys[k].TTL, requires.WithinInt)
+					found = true
+				}
+			}
+			if !found {
+				required.hitKeys = append(required.hitKeys, ruleHitKey{
+					Key:       requires.Key,
+					KeyFields: requires.KeyFields,
+					KeyList:   requires.KeyList,
+					TTL:       requires.WithinInt,
+				})
+			}
+		}
+	}
 	return nil
 }
 
@@ -2853,9 +3855,10 @@ func sortCheckNodes(checkNodes []CheckNodes) []CheckNodes {
 	tier4 := make([]int, 0)
 
 	for i, v := range checkNodes {
-		if v.Type == "ISNULL" || v.Type == "NOTNULL" {
+		if v.Type == "ISNULL" || v.Type == "NOTNULL" || v.Type == "EXISTS" || v.Type == "NOT_EXISTS" || v.Type == "IS_TYPE" ||
+			v.Type == "IS_NUMERIC" || v.Type == "IS_IP" || v.Type == "ARRAY_LEN" {
 			tier1 = append(tier1, i)
-		} else if v.Type == "REGEX" {
+		} else if v.Type == "REGEX" || v.Type == "EXPR" {
 			tier3 = append(tier3, i)
 		} else if v.Type == "PLUGIN" {
 			tier4 = append(tier4, i)
@@ -2886,3 +3889,49 @@ func sortCheckNodes(checkNodes []CheckNodes) []CheckNodes {
 
 	return sorted
 }
+
+// intelFeeds parses the comma separated feeds of INTEL checks and appends, which must be
+// configured under threat_intel in config.yaml
+func intelFeeds(value string) ([]string, error) {
+	if common.GlobalThreatIntel == nil {
+		return nil, errors.New("INTEL requires threat_intel feeds in config.yaml")
+	}
+	var feeds []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !common.GlobalThreatIntel.HasFeed(name) {
+			return nil, errors.New("threat intel feed not found: " + name)
+		}
+		feeds = append(feeds, name)
+	}
+	if len(feeds) == 0 {
+		return nil, errors.New("INTEL value cannot be empty, expected feed names")
+	}
+	return feeds, nil
+}
+
+// sharedLists parses the comma separated lists of IN_LIST checks, which must have been created
+// through the shared list API
+func sharedLists(value string) ([]string, error) {
+	if common.GlobalSharedLists == nil {
+		return nil, errors.New("IN_LIST requires shared lists, which are not initialized")
+	}
+	var lists []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !common.GlobalSharedLists.Has(name) {
+			return nil, errors.New("shared list not found: " + name)
+		}
+		lists = append(lists, name)
+	}
+	if len(lists) == 0 {
+		return nil, errors.New("IN_LIST value cannot be empty, expected list names")
+	}
+	return lists, nil
+}
@@ -16,19 +16,21 @@ import (
 // sumData: Value to add to the sum
 // rangeInt: Time range in seconds
 // threshold: Threshold value to trigger
-// Returns: true if threshold is exceeded, false otherwise
-func RedisFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (bool, error) {
+// Returns: true if threshold is exceeded, false otherwise, and the counter after adding sumData
+func RedisFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (bool, int, error) {
 	var res = false
+	count := sumData
 	redisSetNXRes, err := common.RedisSetNX(groupByKey, sumData, rangeInt)
 	if err != nil {
-		return false, fmt.Errorf("failed to set Redis key %s: %w", groupByKey, err)
+		return false, 0, fmt.Errorf("failed to set Redis key %s: %w", groupByKey, err)
 	}
 
 	if !redisSetNXRes {
 		groupByValue, err := common.RedisIncrby(groupByKey, int64(sumData))
 		if err != nil {
-			return false, fmt.Errorf("failed to increment Redis key %s: %w", groupByKey, err)
+			return false, 0, fmt.Errorf("failed to increment Redis key %s: %w", groupByKey, err)
 		} else {
+			count = int(groupByValue)
 			if groupByValue > int64(threshold) {
 				res = true
 				if err := common.RedisDel(groupByKey); err != nil {
@@ -37,7 +39,7 @@ func RedisFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (b
 			}
 		}
 	}
-	return res, nil
+	return res, count, nil
 }
 
 // LocalCacheFRQSum performs frequency sum aggregation using local cache
@@ -45,8 +47,8 @@ func RedisFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (b
 // sumData: Value to add to the sum
 // rangeInt: Time range in seconds
 // threshold: Threshold value to trigger
-// Returns: true if threshold is exceeded, false otherwise
-func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (bool, error) {
+// Returns: true if threshold is exceeded, false otherwise, and the counter after adding sumData
+func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int, threshold int) (bool, int, error) {
 	// Acquire write lock to protect cache operations
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -54,7 +56,7 @@ func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int,
 	if v, ok := r.Cache.Get(groupByKey); ok {
 		if v+sumData > threshold {
 			r.Cache.Del(groupByKey)
-			return true, nil
+			return true, v + sumData, nil
 		} else {
 			if tmpTtl, exist := r.Cache.GetTTL(groupByKey); exist {
 				success := r.Cache.SetWithTTL(groupByKey, v+sumData, 1, tmpTtl)
@@ -69,7 +71,7 @@ func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int,
 					r.Cache.Wait()
 				}
 			}
-			return false, nil
+			return false, v + sumData, nil
 		}
 	} else {
 		// Use cost=1 instead of 0, as ristretto may have special handling for cost=0
@@ -79,7 +81,7 @@ func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int,
 			// Wait for the cache to be ready (ristretto is async)
 			r.Cache.Wait()
 		}
-		return false, nil
+		return false, sumData, nil
 	}
 }
 
@@ -88,17 +90,17 @@ func (r *Ruleset) LocalCacheFRQSum(groupByKey string, sumData int, rangeInt int,
 // groupByKey: Base key for grouping
 // rangeInt: Time range in seconds
 // threshold: Threshold value to trigger
-// Returns: true if threshold is exceeded, false otherwise
-func RedisFRQClassify(tmpKey string, groupByKey string, rangeInt int, threshold int) (bool, error) {
+// Returns: true if threshold is exceeded, false otherwise, and the number of distinct values seen
+func RedisFRQClassify(tmpKey string, groupByKey string, rangeInt int, threshold int) (bool, int, error) {
 	var res = false
 	_, err := common.RedisSet(tmpKey, 1, rangeInt)
 	if err != nil {
-		return false, fmt.Errorf("failed to set Redis key %s: %w", tmpKey, err)
+		return false, 0, fmt.Errorf("failed to set Redis key %s: %w", tmpKey, err)
 	}
 
 	tmpRes, err := common.RedisKeys(groupByKey + "*")
 	if err != nil {
-		return false, fmt.Errorf("failed to get Redis keys matching %s*: %w", groupByKey, err)
+		return false, 0, fmt.Errorf("failed to get Redis keys matching %s*: %w", groupByKey, err)
 	}
 
 	if len(tmpRes) > threshold {
@@ -109,10 +111,10 @@ func RedisFRQClassify(tmpKey string, groupByKey string, rangeInt int, threshold
 			}
 		}
 	}
-	return res, nil
+	return res, len(tmpRes), nil
 }
 
-func (r *Ruleset) LocalCacheFRQClassify(tmpKey string, groupByKey string, rangeInt int, threshold int) (bool, error) {
+func (r *Ruleset) LocalCacheFRQClassify(tmpKey string, groupByKey string, rangeInt int, threshold int) (bool, int, error) {
 	// Acquire write lock to protect cache operations
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -137,7 +139,7 @@ func (r *Ruleset) LocalCacheFRQClassify(tmpKey string, groupByKey string, rangeI
 				r.Cache.Del(key)
 			}
 			r.CacheForClassify.Del(groupByKey)
-			return true, nil
+			return true, count, nil
 		} else {
 			keysCopy[tmpKey] = true
 			r.CacheForClassify.SetWithTTL(groupByKey, keysCopy, 1, time.Duration(rangeInt*2)*time.Second)
@@ -146,7 +148,7 @@ func (r *Ruleset) LocalCacheFRQClassify(tmpKey string, groupByKey string, rangeI
 				// Wait for the cache to be ready (ristretto is async)
 				r.Cache.Wait()
 			}
-			return false, nil
+			return false, count, nil
 		}
 	} else {
 		keys := map[string]bool{
@@ -158,7 +160,7 @@ func (r *Ruleset) LocalCacheFRQClassify(tmpKey string, groupByKey string, rangeI
 			r.Cache.Wait()
 		}
 		r.CacheForClassify.SetWithTTL(groupByKey, keys, 1, time.Duration(rangeInt*2)*time.Second)
-		return false, nil
+		return false, 1, nil
 	}
 }
 
@@ -519,6 +521,52 @@ func NOTNULL(data string, _ string) (res bool, hitData string) {
 	}
 }
 
+// Value types accepted by IS_TYPE checks
+var checkValueTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"bool":    true,
+	"object":  true,
+	"array":   true,
+}
+
+// isValueType reports whether a decoded field value has the given IS_TYPE type.
+// Numeric strings are strings; integer matches numbers without a fractional part.
+func isValueType(value interface{}, valueType string) bool {
+	switch valueType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number", "integer":
+		var f float64
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return true
+		case float32:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			return false
+		}
+		return valueType == "number" || f == float64(int64(f))
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		switch value.(type) {
+		case []interface{}, []string, []map[string]interface{}:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
 func EQU(data string, ruleData string) (res bool, hitData string) {
 	return strings.EqualFold(data, ruleData), data
 }
@@ -0,0 +1,47 @@
+package rules_engine
+
+import "testing"
+
+func TestExclude_CountsFirstMatchingRule(t *testing.T) {
+	rs := buildRulesetFromXML(t, `
+<root type="EXCLUDE">
+  <rule id="trusted_ips">
+    <check type="EQU" field="source_ip">10.0.0.1</check>
+  </rule>
+  <rule id="scanner">
+    <check type="EQU" field="user_agent">scanner</check>
+  </rule>
+</root>`)
+
+	events := []map[string]interface{}{
+		{"source_ip": "10.0.0.1", "user_agent": "scanner"},
+		{"source_ip": "10.0.0.1"},
+		{"source_ip": "10.0.0.2", "user_agent": "scanner"},
+		{"source_ip": "10.0.0.2"},
+	}
+	passed := 0
+	for _, e := range events {
+		passed += len(rs.EngineCheck(e))
+	}
+	if passed != 1 {
+		t.Fatalf("expected one event to pass, got %d", passed)
+	}
+
+	// The first event matches both rules and is counted for the first one only
+	got := rs.GetExcludedIncrementAndUpdate()
+	if len(got) != 2 || got["trusted_ips"] != 2 || got["scanner"] != 1 {
+		t.Fatalf("unexpected counters %v", got)
+	}
+	if got := rs.GetExcludedIncrementAndUpdate(); got != nil {
+		t.Fatalf("expected counters to reset, got %v", got)
+	}
+
+	copied, err := NewFromExisting(rs, "TEST.copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied.EngineCheck(events[2])
+	if got := copied.GetExcludedIncrementAndUpdate(); got["scanner"] != 1 {
+		t.Fatalf("unexpected counters of the copy %v", got)
+	}
+}
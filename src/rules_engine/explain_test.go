@@ -0,0 +1,74 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+const explainTestRules = `
+  <rule id="r1" name="r1">
+    <checklist condition="a or b">
+      <check id="a" type="INCL" field="cmd">curl</check>
+      <check id="b" type="INCL" field="cmd">wget</check>
+    </checklist>
+    <threshold group_by="host" range="1m" local_cache="true">1</threshold>
+  </rule>
+ </root>`
+
+func TestExplain_DisabledByDefault(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="explain">`+explainTestRules)
+	rs.EngineCheck(map[string]interface{}{"cmd": "curl x", "host": "h1"})
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "curl x", "host": "h1"})
+	if len(out) != 1 {
+		t.Fatalf("expected threshold to fire on the second event, got %d results", len(out))
+	}
+	if _, ok := out[0][ExplainFieldName]; ok {
+		t.Fatalf("explanation must only be added when explain is enabled")
+	}
+}
+
+func TestExplain_ChecksAndThreshold(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="explain" explain="true">`+explainTestRules)
+	rs.EngineCheck(map[string]interface{}{"cmd": "curl x", "host": "h1"})
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "curl x", "host": "h1"})
+	if len(out) != 1 {
+		t.Fatalf("expected threshold to fire on the second event, got %d results", len(out))
+	}
+
+	explanations, ok := out[0][ExplainFieldName].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected explanation, got %v", out[0][ExplainFieldName])
+	}
+	explanation, ok := explanations["TEST.RS.r1"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected explanation keyed by hit rule ID, got %v", explanations)
+	}
+
+	checks := explanation["checks"].([]map[string]interface{})
+	if len(checks) != 2 {
+		t.Fatalf("expected both checklist nodes, got %v", checks)
+	}
+	if checks[0]["id"] != "a" || checks[0]["matched"] != true || checks[0]["matched_value"] != "curl x" {
+		t.Fatalf("unexpected evidence for check a: %v", checks[0])
+	}
+	if checks[1]["id"] != "b" || checks[1]["matched"] != false {
+		t.Fatalf("unexpected evidence for check b: %v", checks[1])
+	}
+
+	thresholds := explanation["thresholds"].([]map[string]interface{})
+	if len(thresholds) != 1 || thresholds[0]["count"] != 2 || thresholds[0]["value"] != 1 {
+		t.Fatalf("unexpected threshold evidence: %v", thresholds)
+	}
+	if groupBy := thresholds[0]["group_by"].(map[string]string); groupBy["host"] != "h1" {
+		t.Fatalf("unexpected threshold group: %v", groupBy)
+	}
+}
+
+func TestExplain_ExcludeRejectsExplain(t *testing.T) {
+	rs, err := ParseRuleset([]byte(`<root type="EXCLUDE" name="explain" explain="true">` + explainTestRules))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	if err := RulesetBuild(rs); err == nil {
+		t.Fatalf("expected explain to be rejected for EXCLUDE rulesets")
+	}
+}
@@ -0,0 +1,705 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	regexp "github.com/BurntSushi/rure-go"
+)
+
+// Expression is a compiled EXPR check: arithmetic, comparisons and boolean logic on the fields of
+// an event, e.g. `bytes_out > 10*bytes_in && dest_port != 443`.
+//
+// Operators by increasing precedence: `||` (or), `&&` (and), `!` (not), the comparisons
+// == != < <= > >= in contains startsWith endsWith matches, + -, * / %, unary -. Operands are
+// numbers, 'strings' or "strings", true, false, null, lists [a, b], fields (dot paths) and the
+// functions len, lower, upper and abs. Strings holding numbers are compared and computed as
+// numbers when the other operand is a number; a missing field is null.
+type Expression struct {
+	Source string
+	root   exprNode
+}
+
+type exprNode interface {
+	eval(data map[string]interface{}) (interface{}, error)
+}
+
+var errExprType = errors.New("operands of incompatible types")
+
+// CompileExpression parses an EXPR check value
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := exprTokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+	return &Expression{Source: source, root: root}, nil
+}
+
+// Eval evaluates the expression against an event
+func (e *Expression) Eval(data map[string]interface{}) (interface{}, error) {
+	return e.root.eval(data)
+}
+
+// Match returns true when the expression evaluates to true, an error or any other value is false
+func (e *Expression) Match(data map[string]interface{}) bool {
+	v, err := e.root.eval(data)
+	b, ok := v.(bool)
+	return err == nil && ok && b
+}
+
+// ===================== Tokenizer =====================
+
+const (
+	exprTokNumber = iota
+	exprTokString
+	exprTokIdent
+	exprTokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+func exprTokenize(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokNumber, text: s[start:i], pos: start})
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: exprTokString, text: sb.String(), pos: start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] == '.' || unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokIdent, text: s[start:i], pos: start})
+		default:
+			op := ""
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = two
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("<>!+-*/%()[],", rune(c)) {
+					return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+				}
+				op = string(c)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("expression is empty")
+	}
+	return tokens, nil
+}
+
+// ===================== Parser =====================
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// accept consumes the next token when it is one of the operators or keywords
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	t := p.tokens[p.pos]
+	if t.kind != exprTokOp && t.kind != exprTokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	if p.pos >= len(p.tokens) {
+		return errors.New(fmt.Sprintf(format, args...) + " at end of expression")
+	}
+	return fmt.Errorf(format+" at position %d", append(args, p.tokens[p.pos].pos)...)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &exprLogical{and: false, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	lhs, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &exprLogical{and: true, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	lhs, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in", "contains", "startsWith", "endsWith", "matches")
+	if !ok {
+		return lhs, nil
+	}
+	rhs, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	node := &exprCompare{op: op, lhs: lhs, rhs: rhs}
+	if op == "matches" {
+		if lit, ok := rhs.(*exprLiteral); ok {
+			pattern, isString := lit.value.(string)
+			if !isString {
+				return nil, errors.New("matches needs a string pattern")
+			}
+			if node.regex, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid matches pattern '%s': %v", pattern, err)
+			}
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	lhs, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &exprArith{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &exprArith{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprArith{op: "-", lhs: &exprLiteral{value: 0.0}, rhs: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("missing operand")
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case exprTokNumber:
+		p.pos++
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", t.text, t.pos)
+		}
+		return &exprLiteral{value: n}, nil
+	case exprTokString:
+		p.pos++
+		return &exprLiteral{value: t.text}, nil
+	case exprTokIdent:
+		p.pos++
+		switch t.text {
+		case "true":
+			return &exprLiteral{value: true}, nil
+		case "false":
+			return &exprLiteral{value: false}, nil
+		case "null", "nil":
+			return &exprLiteral{value: nil}, nil
+		case "and", "or", "not", "in", "contains", "startsWith", "endsWith", "matches":
+			p.pos--
+			return nil, p.errorf("unexpected '%s'", t.text)
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		return &exprField{path: common.StringToList(t.text)}, nil
+	}
+
+	if _, ok := p.accept("("); ok {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, p.errorf("missing ')'")
+		}
+		return node, nil
+	}
+	if _, ok := p.accept("["); ok {
+		list := &exprList{}
+		if _, ok := p.accept("]"); ok {
+			return list, nil
+		}
+		for {
+			item, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, p.errorf("missing ']'")
+			}
+		}
+	}
+	return nil, p.errorf("unexpected '%s'", t.text)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	switch name.text {
+	case "len", "lower", "upper", "abs":
+	default:
+		return nil, fmt.Errorf("unknown function '%s' at position %d, expected len, lower, upper or abs", name.text, name.pos)
+	}
+	arg, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept(")"); !ok {
+		return nil, p.errorf("%s takes one argument, missing ')'", name.text)
+	}
+	return &exprCall{name: name.text, arg: arg}, nil
+}
+
+// ===================== Evaluation =====================
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (n *exprLiteral) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type exprField struct {
+	path []string
+}
+
+func (n *exprField) eval(data map[string]interface{}) (interface{}, error) {
+	v, _ := common.GetCheckDataWithType(data, n.path)
+	return v, nil
+}
+
+type exprList struct {
+	items []exprNode
+}
+
+func (n *exprList) eval(data map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+type exprLogical struct {
+	and      bool
+	lhs, rhs exprNode
+}
+
+func (n *exprLogical) eval(data map[string]interface{}) (interface{}, error) {
+	lhs, err := exprBool(n.lhs, data)
+	if err != nil {
+		return nil, err
+	}
+	if lhs != n.and {
+		return lhs, nil
+	}
+	return exprBool(n.rhs, data)
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+func (n *exprNot) eval(data map[string]interface{}) (interface{}, error) {
+	v, err := exprBool(n.operand, data)
+	return !v, err
+}
+
+func exprBool(node exprNode, data map[string]interface{}) (bool, error) {
+	v, err := node.eval(data)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %v", v)
+	}
+	return b, nil
+}
+
+type exprArith struct {
+	op       string
+	lhs, rhs exprNode
+}
+
+func (n *exprArith) eval(data map[string]interface{}) (interface{}, error) {
+	lhs, err := n.lhs.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := n.rhs.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// + concatenates unless both operands are numbers
+	if n.op == "+" {
+		ls, lIsString := lhs.(string)
+		rs, rIsString := rhs.(string)
+		if lIsString && rIsString {
+			return ls + rs, nil
+		}
+		if lIsString || rIsString {
+			if _, ok := exprNumber(lhs); !ok {
+				return exprString(lhs) + exprString(rhs), nil
+			}
+			if _, ok := exprNumber(rhs); !ok {
+				return exprString(lhs) + exprString(rhs), nil
+			}
+		}
+	}
+
+	a, ok := exprNumber(lhs)
+	if !ok {
+		return nil, errExprType
+	}
+	b, ok := exprNumber(rhs)
+	if !ok {
+		return nil, errExprType
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return a / b, nil
+	default:
+		if b == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return math.Mod(a, b), nil
+	}
+}
+
+type exprCompare struct {
+	op       string
+	lhs, rhs exprNode
+	regex    *regexp.Regex // compiled pattern of matches with a literal
+}
+
+func (n *exprCompare) eval(data map[string]interface{}) (interface{}, error) {
+	lhs, err := n.lhs.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := n.rhs.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(lhs, rhs), nil
+	case "!=":
+		return !exprEqual(lhs, rhs), nil
+	case "in":
+		return exprContains(rhs, lhs), nil
+	case "contains":
+		return exprContains(lhs, rhs), nil
+	case "startsWith", "endsWith", "matches":
+		if lhs == nil {
+			return false, nil
+		}
+		s := exprString(lhs)
+		switch n.op {
+		case "startsWith":
+			return strings.HasPrefix(s, exprString(rhs)), nil
+		case "endsWith":
+			return strings.HasSuffix(s, exprString(rhs)), nil
+		}
+		re := n.regex
+		if re == nil {
+			if re, err = GetCompiledRegex(exprString(rhs)); err != nil {
+				return nil, err
+			}
+		}
+		matched, _ := REGEX(s, re)
+		return matched, nil
+	}
+
+	if lhs == nil || rhs == nil {
+		return false, nil
+	}
+	var c int
+	ls, lIsString := lhs.(string)
+	rs, rIsString := rhs.(string)
+	if lIsString && rIsString {
+		c = strings.Compare(ls, rs)
+	} else {
+		a, aok := exprNumber(lhs)
+		b, bok := exprNumber(rhs)
+		if !aok || !bok {
+			return nil, errExprType
+		}
+		c = compareFloat(a, b)
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type exprCall struct {
+	name string
+	arg  exprNode
+}
+
+func (n *exprCall) eval(data map[string]interface{}) (interface{}, error) {
+	v, err := n.arg.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	switch n.name {
+	case "len":
+		switch v := v.(type) {
+		case nil:
+			return 0.0, nil
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, errExprType
+	case "lower":
+		return strings.ToLower(exprString(v)), nil
+	case "upper":
+		return strings.ToUpper(exprString(v)), nil
+	default:
+		f, ok := exprNumber(v)
+		if !ok {
+			return nil, errExprType
+		}
+		return math.Abs(f), nil
+	}
+}
+
+// exprNumber converts numbers and strings holding a number to float64
+func exprNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func exprString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// exprEqual compares as numbers when one operand is a number and the other converts to one
+func exprEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ab, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ab == bb
+	}
+	if _, ok := b.(bool); ok {
+		return false
+	}
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if !aIsString || !bIsString {
+		if x, ok := exprNumber(a); ok {
+			if y, ok := exprNumber(b); ok {
+				return x == y
+			}
+		}
+	}
+	return exprString(a) == exprString(b)
+}
+
+// exprContains returns whether a list holds an element, a string a substring or a map a key
+func exprContains(container, element interface{}) bool {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if exprEqual(item, element) {
+				return true
+			}
+		}
+	case string:
+		return element != nil && strings.Contains(c, exprString(element))
+	case map[string]interface{}:
+		_, ok := c[exprString(element)]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package rules_engine
+
+import "testing"
+
+func TestExpression(t *testing.T) {
+	data := map[string]interface{}{
+		"bytes_out": 5000,
+		"bytes_in":  "100",
+		"dest_port": 8443.0,
+		"user":      map[string]interface{}{"name": "Admin", "groups": []interface{}{"ops", "dev"}},
+		"cmd":       "powershell -enc AAAA",
+		"flag":      true,
+	}
+	for src, want := range map[string]bool{
+		`bytes_out > 10*bytes_in && dest_port != 443`:   true,
+		`bytes_out > 100 * bytes_in`:                    false,
+		`(bytes_out - bytes_in) / 2 == 2450`:            true,
+		`bytes_out % 3 == 2`:                            true,
+		`-bytes_in < 0 and not flag == false`:           true,
+		`lower(user.name) == 'admin'`:                   true,
+		`"ops" in user.groups && len(user.groups) == 2`: true,
+		`dest_port in [80, 443, 8443]`:                  true,
+		`cmd contains "-enc" || cmd matches "^cmd"`:     true,
+		`cmd startsWith "power" && cmd endsWith "AAAA"`: true,
+		`cmd matches "(?i)^POWERSHELL"`:                 true,
+		`missing == null && !(missing > 1)`:             true,
+		`missing + 1 > 0`:                               false,
+		`bytes_out / 0 > 1`:                             false,
+		`cmd > 1`:                                       false,
+		`bytes_out`:                                     false,
+		`"a" + bytes_in == "a100"`:                      true,
+	} {
+		expr, err := CompileExpression(src)
+		if err != nil {
+			t.Fatalf("CompileExpression(%q) error: %v", src, err)
+		}
+		if got := expr.Match(data); got != want {
+			t.Fatalf("%q = %v, want %v", src, got, want)
+		}
+	}
+
+	for _, bad := range []string{``, `a >`, `(a > 1`, `a > 1 b`, `foo(a)`, `a matches "("`, `'open`, `a # 1`, `[1, 2`} {
+		if _, err := CompileExpression(bad); err == nil {
+			t.Fatalf("expected compile error for %q", bad)
+		}
+	}
+}
+
+func TestExpression_Check(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1"><check type="EXPR">bytes_out > 10*bytes_in</check></rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	if _, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r1"><check type="EXPR"></check></rule></root>`)); err == nil {
+		t.Fatalf("expected error for empty expression")
+	}
+	for _, node := range rs.Rules[0].CheckMap {
+		if err := processCheckNode(&node, nil, "r1"); err != nil {
+			t.Fatalf("processCheckNode error: %v", err)
+		}
+		if !checkNodeLogic(&node, map[string]interface{}{"bytes_out": 2000, "bytes_in": 10}, node.Value, false, nil, nil) {
+			t.Fatalf("expected EXPR check to match")
+		}
+	}
+}
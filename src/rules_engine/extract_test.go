@@ -0,0 +1,84 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"reflect"
+	"testing"
+)
+
+func TestFieldPaths(t *testing.T) {
+	data := map[string]interface{}{
+		"Records": []interface{}{
+			map[string]interface{}{"eventName": "GetObject", "userIdentity": map[string]interface{}{"arn": "arn:a"}},
+			map[string]interface{}{"eventName": "PutObject", "userIdentity": map[string]interface{}{"arn": "arn:b"}},
+		},
+		"detail":  `{"ip":"10.0.0.1","tags":["x","y"]}`,
+		"a.b":     "dotted",
+		"headers": map[string]interface{}{"x-id": "1"},
+	}
+	for path, want := range map[string]interface{}{
+		"Records[1].eventName":         "PutObject",
+		"Records.#0.userIdentity.arn":  "arn:a",
+		"Records[-1].userIdentity.arn": "arn:b",
+		"detail.tags[0]":               "x",
+		`a\.b`:                         "dotted",
+		"$.Records[0].eventName":       "GetObject",
+		"$['a.b']":                     "dotted",
+		"$.headers['x-id']":            "1",
+		"$.Records[*].eventName":       []interface{}{"GetObject", "PutObject"},
+		"$..arn":                       []interface{}{"arn:a", "arn:b"},
+		"$.Records[-1].userIdentity.*": []interface{}{"arn:b"},
+		"$.detail.tags[-1]":            "y",
+	} {
+		got, ok := common.GetCheckDataWithType(data, common.StringToList(path))
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s = %v (%v), want %v", path, got, ok, want)
+		}
+	}
+	for _, path := range []string{"Records[5].eventName", "$.Records[*].missing", "$..missing", "Records[-3]"} {
+		if got, ok := common.GetCheckDataWithType(data, common.StringToList(path)); ok {
+			t.Fatalf("%s = %v, want missing", path, got)
+		}
+	}
+	if s, ok := common.GetCheckData(data, common.StringToList("$.Records[*].eventName")); !ok || s != `["GetObject","PutObject"]` {
+		t.Fatalf("unexpected string of a wildcard path: %s", s)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<extract source="$.Records[0].userIdentity" field="identity"/>
+		<extract source="missing.field" field="never"/>
+		<check type="EQU" field="identity.arn">arn:a</check>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := &rs.Rules[0]
+	data := map[string]interface{}{
+		"Records": []interface{}{map[string]interface{}{"userIdentity": map[string]interface{}{"arn": "arn:a"}}},
+	}
+	out, copied := data, false
+	for _, op := range *rule.Queue {
+		if op.Type == T_Extract {
+			if res := rs.executeExtract(rule, op.ID, copied, out); res != nil {
+				out, copied = res, true
+			}
+		}
+	}
+	if _, ok := data["identity"]; ok {
+		t.Fatalf("input event was modified")
+	}
+	if _, ok := out["never"]; ok {
+		t.Fatalf("missing source must not add a field")
+	}
+	identity, ok := out["identity"].(map[string]interface{})
+	if !ok || identity["arn"] != "arn:a" {
+		t.Fatalf("unexpected extracted value %v", out["identity"])
+	}
+
+	if _, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r1"><extract source="a"/></rule></root>`)); err == nil {
+		t.Fatalf("expected error for extract without field")
+	}
+}
@@ -0,0 +1,52 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+func TestGeoIP_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1"><geoip field="src.ip"/><geoip field="dst" prefix="dst_geo_"></geoip></rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := rs.Rules[0]
+	if len(rule.GeoIPMap) != 2 {
+		t.Fatalf("expected 2 geoip operations, got %d", len(rule.GeoIPMap))
+	}
+	for _, op := range *rule.Queue {
+		geoIP := rule.GeoIPMap[op.ID]
+		switch geoIP.Field {
+		case "src.ip":
+			if geoIP.Prefix != DefaultGeoIPPrefix || len(geoIP.FieldList) != 2 {
+				t.Fatalf("unexpected geoip %+v", geoIP)
+			}
+		case "dst":
+			if geoIP.Prefix != "dst_geo_" {
+				t.Fatalf("unexpected prefix %q", geoIP.Prefix)
+			}
+		}
+	}
+
+	for _, bad := range []string{
+		`<geoip/>`,
+		`<geoip field="ip" lang="de"/>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
+
+func TestGeoIP_RequiresDatabase(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1"><geoip field="ip"/></rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rs.RulesetID = "TEST.RS"
+	if err := RulesetBuild(rs); err == nil {
+		t.Fatalf("expected build error without geoip databases")
+	}
+}
@@ -0,0 +1,80 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+func TestGroup_NestedAnyNot(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="group">
+  <rule id="r1" name="r1">
+    <check type="EQU" field="event">exec</check>
+    <any>
+      <check type="END" field="exe">/curl</check>
+      <all>
+        <check type="END" field="exe">/bash</check>
+        <check type="INCL" field="args">-c</check>
+      </all>
+    </any>
+    <not>
+      <check type="START" field="user">svc_</check>
+    </not>
+  </rule>
+ </root>`
+
+	rs := buildRulesetFromXML(t, xml)
+
+	cases := []struct {
+		data  map[string]interface{}
+		match bool
+	}{
+		{map[string]interface{}{"event": "exec", "exe": "/usr/bin/curl", "args": "", "user": "alice"}, true},
+		{map[string]interface{}{"event": "exec", "exe": "/bin/bash", "args": "-c id", "user": "alice"}, true},
+		{map[string]interface{}{"event": "exec", "exe": "/bin/bash", "args": "script.sh", "user": "alice"}, false},
+		{map[string]interface{}{"event": "exec", "exe": "/usr/bin/curl", "args": "", "user": "svc_backup"}, false},
+		{map[string]interface{}{"event": "open", "exe": "/usr/bin/curl", "args": "", "user": "alice"}, false},
+	}
+	for i, c := range cases {
+		out := rs.EngineCheck(c.data)
+		if got := len(out) == 1; got != c.match {
+			t.Fatalf("case %d: expected match=%v, got %d results", i, c.match, len(out))
+		}
+	}
+}
+
+func TestGroup_InsideIterator(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="group-iter">
+  <rule id="r1" name="r1">
+    <iterator type="ANY" field="procs" variable="p">
+      <not>
+        <check type="EQU" field="p.signed">true</check>
+      </not>
+    </iterator>
+  </rule>
+ </root>`
+
+	rs := buildRulesetFromXML(t, xml)
+	out := rs.EngineCheck(map[string]interface{}{
+		"procs": []interface{}{
+			map[string]interface{}{"signed": "true"},
+			map[string]interface{}{"signed": "false"},
+		},
+	})
+	if len(out) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(out))
+	}
+}
+
+func TestGroup_ParseErrors(t *testing.T) {
+	cases := []string{
+		`<root type="DETECTION"><rule id="r1"><any></any></rule></root>`,
+		`<root type="DETECTION"><rule id="r1"><any><append field="x">y</append></any></rule></root>`,
+		`<root type="DETECTION"><rule id="r1"><checklist condition="a"><not><check id="a" type="EQU" field="x">y</check></not></checklist></rule></root>`,
+	}
+	for i, xml := range cases {
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("case %d: expected parse error", i)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package rules_engine
+
+import (
+	"testing"
+)
+
+func TestIntel_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<check type="INTEL" field="dest_ip">misp,otx</check>
+		<append type="INTEL" field="dest_intel" source="dest_ip">misp</append>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := rs.Rules[0]
+	if len(rule.AppendsMap) != 1 {
+		t.Fatalf("expected 1 append, got %d", len(rule.AppendsMap))
+	}
+	for _, a := range rule.AppendsMap {
+		if a.Type != "INTEL" || a.Source != "dest_ip" || a.Value != "misp" {
+			t.Fatalf("unexpected append %+v", a)
+		}
+	}
+
+	for _, bad := range []string{
+		`<check type="INTEL" field="dest_ip"></check>`,
+		`<append type="INTEL" field="intel">misp</append>`,
+		`<append type="INTEL" field="intel" source="ip"></append>`,
+		`<append field="intel" source="ip">x</append>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
+
+func TestIntel_RequiresFeeds(t *testing.T) {
+	for _, op := range []string{
+		`<check type="INTEL" field="dest_ip">misp</check>`,
+		`<append type="INTEL" field="intel" source="dest_ip">misp</append>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + op + `</rule></root>`
+		rs, err := ParseRuleset([]byte(xml))
+		if err != nil {
+			t.Fatalf("ParseRuleset error: %v", err)
+		}
+		rs.RulesetID = "TEST.RS"
+		if err := RulesetBuild(rs); err == nil {
+			t.Fatalf("expected build error without threat intel feeds for %s", op)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package rules_engine
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxIPRangeCacheSize bounds the cache of values read from the event with _$ references
+const maxIPRangeCacheSize = 10000
+
+// ipRange is an inclusive range of addresses of one family
+type ipRange struct {
+	from netip.Addr
+	to   netip.Addr
+}
+
+// IPRangeSet is the parsed value of a CIDR or IP_RANGE check: sorted, merged ranges searched
+// with a binary search
+type IPRangeSet struct {
+	ranges []ipRange
+}
+
+var (
+	ipRangeCache     sync.Map // check type + "\x00" + value -> *IPRangeSet
+	ipRangeCacheSize int64
+	ipRangeCacheMu   sync.Mutex
+)
+
+// parseIPRangeSet parses the comma separated value of a CIDR check (prefixes such as 10.0.0.0/8)
+// or an IP_RANGE check (ranges such as 10.0.0.1-10.0.0.50). Both accept single addresses.
+func parseIPRangeSet(checkType string, value string) (*IPRangeSet, error) {
+	set := &IPRangeSet{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		r, err := parseIPRangeEntry(checkType, entry)
+		if err != nil {
+			return nil, err
+		}
+		set.ranges = append(set.ranges, r)
+	}
+	if len(set.ranges) == 0 {
+		return nil, fmt.Errorf("%s value must contain at least one address", checkType)
+	}
+
+	sort.Slice(set.ranges, func(i, j int) bool {
+		return set.ranges[i].from.Less(set.ranges[j].from)
+	})
+	merged := set.ranges[:1]
+	for _, r := range set.ranges[1:] {
+		last := &merged[len(merged)-1]
+		// Ranges of different families never overlap, IPv4 sorts before IPv6
+		if last.to.BitLen() == r.from.BitLen() && (!last.to.Less(r.from) || last.to.Next() == r.from) {
+			if last.to.Less(r.to) {
+				last.to = r.to
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	set.ranges = merged
+	return set, nil
+}
+
+func parseIPRangeEntry(checkType string, entry string) (ipRange, error) {
+	switch {
+	case checkType == "CIDR" && strings.Contains(entry, "/"):
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return ipRange{}, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		prefix = prefix.Masked()
+		return ipRange{from: prefix.Addr(), to: lastAddr(prefix)}, nil
+	case checkType == "IP_RANGE" && strings.Contains(entry, "-"):
+		from, to, _ := strings.Cut(entry, "-")
+		fromAddr, err1 := netip.ParseAddr(strings.TrimSpace(from))
+		toAddr, err2 := netip.ParseAddr(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil {
+			return ipRange{}, fmt.Errorf("invalid IP range %q", entry)
+		}
+		fromAddr, toAddr = fromAddr.Unmap(), toAddr.Unmap()
+		if fromAddr.BitLen() != toAddr.BitLen() || toAddr.Less(fromAddr) {
+			return ipRange{}, fmt.Errorf("invalid IP range %q, expected start-end of the same family", entry)
+		}
+		return ipRange{from: fromAddr, to: toAddr}, nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		if checkType == "CIDR" {
+			return ipRange{}, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		return ipRange{}, fmt.Errorf("invalid IP range %q", entry)
+	}
+	addr = addr.Unmap()
+	return ipRange{from: addr, to: addr}, nil
+}
+
+// lastAddr returns the highest address of a masked prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr()
+	if addr.Is4() {
+		b := addr.As4()
+		for i := prefix.Bits(); i < 32; i++ {
+			b[i/8] |= 1 << (7 - i%8)
+		}
+		return netip.AddrFrom4(b)
+	}
+	b := addr.As16()
+	for i := prefix.Bits(); i < 128; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	return netip.AddrFrom16(b)
+}
+
+// Contains reports whether data is an address inside one of the ranges. IPv4-mapped IPv6
+// addresses match IPv4 ranges.
+func (s *IPRangeSet) Contains(data string) bool {
+	if s == nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(data))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	// first range starting after addr, the candidate is the one before it
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return addr.Less(s.ranges[i].from)
+	})
+	if i == 0 {
+		return false
+	}
+	r := s.ranges[i-1]
+	return r.from.BitLen() == addr.BitLen() && !r.to.Less(addr)
+}
+
+// getIPRangeSet returns the parsed value, cached for values that are not known when the ruleset is built
+func getIPRangeSet(checkType string, value string) (*IPRangeSet, error) {
+	key := checkType + "\x00" + value
+	if cached, ok := ipRangeCache.Load(key); ok {
+		return cached.(*IPRangeSet), nil
+	}
+	set, err := parseIPRangeSet(checkType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	ipRangeCacheMu.Lock()
+	if ipRangeCacheSize < maxIPRangeCacheSize {
+		if _, loaded := ipRangeCache.LoadOrStore(key, set); !loaded {
+			ipRangeCacheSize++
+		}
+	}
+	ipRangeCacheMu.Unlock()
+	return set, nil
+}
@@ -0,0 +1,438 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/logger"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// The <script lang="lua"> element runs Lua 5.1 on gopher-lua. Scripts are compiled once, then run
+// on pooled states in a sandbox: the base functions without loading, environments and metatables,
+// read-only string, table and math libraries and the time functions of os.
+
+const (
+	// luaTimeLimit bounds one script run, so a loop cannot stall the ruleset
+	luaTimeLimit = 100 * time.Millisecond
+	// luaCallDepthLimit bounds the nested calls of a script
+	luaCallDepthLimit = 200
+	// luaMaxStringLen bounds the strings built by string.rep
+	luaMaxStringLen = 16 << 20
+	// luaMaxEventValues bounds the values converted back into the event
+	luaMaxEventValues = 1 << 20
+)
+
+// luaBaseFunctions are the base functions available to scripts
+var luaBaseFunctions = []string{
+	"assert", "error", "ipairs", "next", "pairs", "pcall", "rawequal", "rawget",
+	"select", "tonumber", "tostring", "type", "unpack", "xpcall", "_VERSION",
+}
+
+// LuaScript is a compiled Lua script
+type LuaScript struct {
+	Source string
+	proto  *lua.FunctionProto
+}
+
+// CompileLuaScript compiles a script of a <script lang="lua"> element
+func CompileLuaScript(source string) (*LuaScript, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), "script")
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, "script")
+	if err != nil {
+		return nil, err
+	}
+	return &LuaScript{Source: source, proto: proto}, nil
+}
+
+// luaState is a pooled interpreter. Compiled scripts are shared, every run gets a fresh global
+// environment falling back to the sandbox, so globals do not persist between events.
+type luaState struct {
+	L       *lua.LState
+	envMeta *lua.LTable
+}
+
+var luaStatePool = sync.Pool{
+	New: func() interface{} {
+		return newLuaState()
+	},
+}
+
+func newLuaState() *luaState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       luaCallDepthLimit,
+		MinimizeStackMemory: true,
+	})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.OsLibName, lua.OpenOs},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	// Strings share the metatable of the real library, patch it before it is wrapped
+	stringLib := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	stringLib.RawSetString("rep", L.NewFunction(luaStrRep))
+
+	sandbox := L.NewTable()
+	for _, name := range luaBaseFunctions {
+		sandbox.RawSetString(name, L.GetGlobal(name))
+	}
+	sandbox.RawSetString("print", L.NewFunction(luaPrint))
+	for _, name := range []string{lua.StringLibName, lua.TabLibName, lua.MathLibName} {
+		sandbox.RawSetString(name, luaReadOnly(L, L.GetGlobal(name).(*lua.LTable)))
+	}
+	osLib := L.NewTable()
+	for _, name := range []string{"time", "clock", "date", "difftime"} {
+		osLib.RawSetString(name, L.GetField(L.GetGlobal(lua.OsLibName), name))
+	}
+	sandbox.RawSetString(lua.OsLibName, luaReadOnly(L, osLib))
+
+	envMeta := L.NewTable()
+	envMeta.RawSetString("__index", sandbox)
+	envMeta.RawSetString("__metatable", lua.LFalse)
+	return &luaState{L: L, envMeta: envMeta}
+}
+
+// luaReadOnly wraps a library table shared by all runs of a state
+func luaReadOnly(L *lua.LState, lib *lua.LTable) *lua.LTable {
+	meta := L.NewTable()
+	meta.RawSetString("__index", lib)
+	meta.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("cannot modify the standard library")
+		return 0
+	}))
+	meta.RawSetString("__metatable", lua.LFalse)
+	proxy := L.NewTable()
+	L.SetMetatable(proxy, meta)
+	return proxy
+}
+
+// luaStrRep is string.rep with the separator of Lua 5.2, bounded by luaMaxStringLen
+func luaStrRep(L *lua.LState) int {
+	s := L.CheckString(1)
+	n := float64(L.CheckNumber(2))
+	sep := L.OptString(3, "")
+	if n < 1 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	// Compare before multiplying, the product can overflow
+	if n > float64(luaMaxStringLen/max(1, len(s)+len(sep))) {
+		L.RaiseError("resulting string too large")
+		return 0
+	}
+	parts := make([]string, int(n))
+	for i := range parts {
+		parts[i] = s
+	}
+	L.Push(lua.LString(strings.Join(parts, sep)))
+	return 1
+}
+
+func luaPrint(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	logger.Info("Lua script print", "message", strings.Join(parts, "\t"))
+	return 0
+}
+
+// Run runs the script with the global event holding a copy of data. It returns the values returned
+// by the script and the event when the script changed it, nil otherwise.
+func (s *LuaScript) Run(data map[string]interface{}) ([]interface{}, map[string]interface{}, error) {
+	st := luaStatePool.Get().(*luaState)
+	L := st.L
+	ctx, cancel := context.WithTimeout(context.Background(), luaTimeLimit)
+	defer cancel()
+	L.SetContext(ctx)
+
+	env := L.NewTable()
+	env.RawSetString("_G", env)
+	L.SetMetatable(env, st.envMeta)
+	env.RawSetString("event", luaFromGo(L, data))
+	fn := L.NewFunctionFromProto(s.proto)
+	fn.Env = env
+
+	top := L.GetTop()
+	L.Push(fn)
+	err := L.PCall(0, lua.MultRet, nil)
+	L.RemoveContext()
+	if err != nil {
+		// A failed state may hold the rest of the run, start over with a new one
+		L.Close()
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("script exceeded the time limit of %v", luaTimeLimit)
+		}
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			return nil, nil, errors.New(apiErr.Object.String())
+		}
+		return nil, nil, err
+	}
+	rets := make([]interface{}, L.GetTop()-top)
+	for i := range rets {
+		rets[i] = luaToGo(L.Get(top + i + 1))
+	}
+	L.SetTop(top)
+	event := env.RawGetString("event")
+	luaStatePool.Put(st)
+
+	table, ok := event.(*lua.LTable)
+	if !ok {
+		return nil, nil, fmt.Errorf("event must remain a table, got %s", event.Type())
+	}
+	conv := luaEventConverter{path: make(map[*lua.LTable]bool)}
+	converted, changed, err := conv.toGo(table, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !changed {
+		return rets, nil, nil
+	}
+	modified, _ := converted.(map[string]interface{})
+	if modified == nil {
+		modified = map[string]interface{}{}
+	}
+	return rets, modified, nil
+}
+
+// luaScalar converts an event value that is not an object or array
+func luaScalar(v interface{}) lua.LValue {
+	switch o := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(o)
+	case string:
+		return lua.LString(o)
+	case float64:
+		return lua.LNumber(o)
+	case float32:
+		return lua.LNumber(o)
+	case int:
+		return lua.LNumber(o)
+	case int8:
+		return lua.LNumber(o)
+	case int16:
+		return lua.LNumber(o)
+	case int32:
+		return lua.LNumber(o)
+	case int64:
+		return lua.LNumber(o)
+	case uint:
+		return lua.LNumber(o)
+	case uint8:
+		return lua.LNumber(o)
+	case uint16:
+		return lua.LNumber(o)
+	case uint32:
+		return lua.LNumber(o)
+	case uint64:
+		return lua.LNumber(o)
+	case []byte:
+		return lua.LString(o)
+	}
+	return lua.LString(fmt.Sprint(v))
+}
+
+// luaContainer returns an event value as an object or an array, including typed maps and slices
+func luaContainer(v interface{}) (map[string]interface{}, []interface{}) {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		if o == nil {
+			return map[string]interface{}{}, nil
+		}
+		return o, nil
+	case []interface{}:
+		if o == nil {
+			return nil, []interface{}{}
+		}
+		return nil, o
+	case nil, string, []byte:
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return nil, list
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				m[iter.Key().String()] = iter.Value().Interface()
+			}
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// luaFromGo converts an event value into a Lua value, objects and arrays become tables
+func luaFromGo(L *lua.LState, v interface{}) lua.LValue {
+	m, list := luaContainer(v)
+	switch {
+	case m != nil:
+		table := L.CreateTable(0, len(m))
+		for k, item := range m {
+			table.RawSetString(k, luaFromGo(L, item))
+		}
+		return table
+	case list != nil:
+		table := L.CreateTable(len(list), 0)
+		for i, item := range list {
+			table.RawSetInt(i+1, luaFromGo(L, item))
+		}
+		return table
+	}
+	return luaScalar(v)
+}
+
+// luaToGo converts a value returned by a script. Tables with the keys 1..n become arrays, other
+// tables objects. Functions are dropped.
+func luaToGo(v lua.LValue) interface{} {
+	conv := luaEventConverter{path: make(map[*lua.LTable]bool)}
+	converted, _, err := conv.toGo(v, nil)
+	if err != nil {
+		return nil
+	}
+	return converted
+}
+
+// luaEventConverter converts the event table back after a run. Values the script left as they
+// were keep the original Go value and type; objects and arrays are always new, so the result
+// never shares containers with the original event.
+type luaEventConverter struct {
+	path  map[*lua.LTable]bool // tables being converted, to refuse cycles
+	count int
+}
+
+// toGo converts v, orig is the event value it was converted from. It reports whether v differs.
+func (c *luaEventConverter) toGo(v lua.LValue, orig interface{}) (interface{}, bool, error) {
+	c.count++
+	if c.count > luaMaxEventValues {
+		return nil, true, fmt.Errorf("event has more than %d values", luaMaxEventValues)
+	}
+	switch o := v.(type) {
+	case *lua.LTable:
+		if c.path[o] {
+			return nil, true, fmt.Errorf("event contains a table that contains itself")
+		}
+		c.path[o] = true
+		defer delete(c.path, o)
+		return c.tableToGo(o, orig)
+	case lua.LBool, lua.LNumber, lua.LString, *lua.LNilType:
+		if m, list := luaContainer(orig); m == nil && list == nil && luaScalar(orig) == v {
+			return orig, false, nil
+		}
+		switch o := v.(type) {
+		case lua.LBool:
+			return bool(o), true, nil
+		case lua.LNumber:
+			return float64(o), true, nil
+		case lua.LString:
+			return string(o), true, nil
+		}
+		return nil, true, nil
+	}
+	// Functions and other values cannot be stored in an event
+	return nil, orig != nil, nil
+}
+
+func (c *luaEventConverter) tableToGo(t *lua.LTable, orig interface{}) (interface{}, bool, error) {
+	origMap, origList := luaContainer(orig)
+	for len(origList) > 0 && origList[len(origList)-1] == nil {
+		origList = origList[:len(origList)-1]
+	}
+
+	// Tables with positive integer keys only are arrays, an empty table keeps the kind of the original
+	keys, maxIndex, array := 0, 0, true
+	t.ForEach(func(k, _ lua.LValue) {
+		keys++
+		n, ok := k.(lua.LNumber)
+		if !ok || n < 1 || n > lua.LNumber(luaMaxEventValues) || n != lua.LNumber(int(n)) {
+			array = false
+			return
+		}
+		maxIndex = max(maxIndex, int(n))
+	})
+	if keys == 0 {
+		array = origList != nil
+	}
+	// A sparse table is only an array when the original array had the same holes, e.g. nulls
+	if array && maxIndex > max(keys, len(origList)) {
+		array = false
+	}
+
+	if array {
+		list := make([]interface{}, maxIndex)
+		changed := origList == nil || len(origList) != maxIndex
+		for i := range list {
+			var o interface{}
+			if i < len(origList) {
+				o = origList[i]
+			}
+			item, itemChanged, err := c.toGo(t.RawGetInt(i+1), o)
+			if err != nil {
+				return nil, true, err
+			}
+			list[i] = item
+			changed = changed || itemChanged
+		}
+		return list, changed, nil
+	}
+
+	m := make(map[string]interface{}, keys)
+	changed := origMap == nil
+	var err error
+	t.ForEach(func(k, item lua.LValue) {
+		if err != nil {
+			return
+		}
+		key := k.String()
+		o, exists := origMap[key]
+		converted, itemChanged, convErr := c.toGo(item, o)
+		if convErr != nil {
+			err = convErr
+			return
+		}
+		changed = changed || itemChanged || !exists
+		if converted != nil {
+			m[key] = converted
+		}
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	// Fields set to nil are missing from the table
+	for k, o := range origMap {
+		if _, ok := m[k]; !ok && o != nil {
+			changed = true
+		}
+	}
+	return m, changed, nil
+}
@@ -0,0 +1,331 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func runLua(t *testing.T, src string, data map[string]interface{}) ([]interface{}, map[string]interface{}) {
+	t.Helper()
+	script, err := CompileLuaScript(src)
+	if err != nil {
+		t.Fatalf("compile error: %v\n%s", err, src)
+	}
+	rets, modified, err := script.Run(data)
+	if err != nil {
+		t.Fatalf("run error: %v\n%s", err, src)
+	}
+	return rets, modified
+}
+
+func TestLua_Language(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`return 1 + 2 * 3`, float64(7)},
+		{`return 7 % 3`, float64(1)},
+		{`return 2 ^ 10`, float64(1024)},
+		{`return "a" .. 1 .. "b"`, "a1b"},
+		{`return #"hello"`, float64(5)},
+		{`return not nil and 1 or 2`, float64(1)},
+		{`return nil == false`, false},
+		{`local s = 0 for i = 1, 10 do s = s + i end return s`, float64(55)},
+		{`local s = 0 for i = 10, 1, -2 do s = s + i end return s`, float64(30)},
+		{`local t = {3, 4, 5} local s = 0 for _, v in ipairs(t) do s = s + v end return s`, float64(12)},
+		{`local t = {b = 1, a = 2} local k = {} for key in pairs(t) do table.insert(k, key) end table.sort(k) return table.concat(k)`, "ab"},
+		{`local i = 0 while true do i = i + 1 if i > 4 then break end end return i`, float64(5)},
+		{`local i = 0 repeat local j = i i = i + 1 until j >= 3 return i`, float64(4)},
+		{`local function fib(n) if n < 2 then return n end return fib(n-1) + fib(n-2) end return fib(15)`, float64(610)},
+		{`local function counter() local c = 0 return function() c = c + 1 return c end end
+		  local f = counter() f() f() return f()`, float64(3)},
+		{`local function sum(...) local s = 0 for _, v in ipairs({...}) do s = s + v end return s end return sum(1, 2, 3)`, float64(6)},
+		{`return select("#", 1, nil, 3)`, float64(3)},
+		{`local t = {} t.x = {y = 2} return t.x.y`, float64(2)},
+		{`local t = {n = 1} function t:inc(d) self.n = self.n + d return self end return t:inc(2):inc(3).n`, float64(6)},
+		{`local a, b = 1 return b`, nil},
+		{`local a, b = 1, 2 local c, d = b, a return c - d`, float64(1)},
+		{`return tostring(10 / 2)`, "5"},
+		{`return tostring(0.5)`, "0.5"},
+		{`return tostring(3)`, "3"},
+		{`return tonumber("0x10") + tonumber("ff", 16)`, float64(271)},
+		{`return "10" + 5`, float64(15)},
+		{`return math.max(3, 9, 1) + math.floor(2.7)`, float64(11)},
+		{`local ok, err = pcall(error, {code = 7}) return err.code`, float64(7)},
+		{`local ok = pcall(function() local x = nil .. "a" end) return ok`, false},
+		{`local t = {5, 2, 8} table.sort(t) return table.concat(t, ",")`, "2,5,8"},
+		{`local t = {5, 2, 8} table.sort(t, function(a, b) return a > b end) return t[1]`, float64(8)},
+		{`local t = {1, 2} table.insert(t, 3) table.insert(t, 1, 0) return table.concat(t)`, "0123"},
+		{`local t = {1, 2, 3} local v = table.remove(t, 1) return v .. #t`, "12"},
+		{`return ("x"):rep(3, "-")`, "x-x-x"},
+		{`return string.format("%s=%05.1f %d%%", "v", 3.14159, 7)`, "v=003.1 7%"},
+		{`return ("Hello"):upper():lower():sub(2, -2)`, "ell"},
+		{`return #{1, 2, 3, nil}`, float64(3)},
+	}
+	for _, tt := range tests {
+		rets, _ := runLua(t, tt.src, nil)
+		var got interface{}
+		if len(rets) > 0 {
+			got = rets[0]
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v (%T), want %v", tt.src, got, got, tt.want)
+		}
+	}
+}
+
+func TestLua_Patterns(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`return string.find("hello world", "wor")`, "7"},
+		{`local s, e = string.find("a.b", ".", 1, true) return s .. e`, "22"},
+		{`return string.match("user=admin id=42", "id=(%d+)")`, "42"},
+		{`return string.match("  trim  ", "^%s*(.-)%s*$")`, "trim"},
+		{`local k, v = string.match("key: value", "(%w+):%s*(%w+)") return k .. v`, "keyvalue"},
+		{`return (string.gsub("hello world", "o", "0"))`, "hell0 w0rld"},
+		{`return (string.gsub("hello world", "(%w+)", "<%1>"))`, "<hello> <world>"},
+		{`return (string.gsub("abc", "", "-"))`, "-a-b-c-"},
+		{`return (string.gsub("$name is $age", "%$(%w+)", {name = "bob", age = 3}))`, "bob is 3"},
+		{`return (string.gsub("1 2 3", "%d", function(d) return d * 2 end))`, "2 4 6"},
+		{`local n = 0 for w in string.gmatch("one two three", "%a+") do n = n + 1 end return tostring(n)`, "3"},
+		{`return string.match("f(a(b)c)", "%b()")`, "(a(b)c)"},
+		{`return string.match("2024-01-15", "(%d+)-(%d+)-(%d+)")`, "2024"},
+		{`return string.match("[x]", "[]]")`, "]"},
+		{`return string.match("a-b", "[%-]")`, "-"},
+		{`return tostring(string.match("abc", "()b()"))`, "2"},
+		{`return string.match("aaa", "a-b") or "none"`, "none"},
+		{`return string.match("192.168.1.10", "^(%d+)%.%d+%.%d+%.%d+$")`, "192"},
+	}
+	for _, tt := range tests {
+		rets, _ := runLua(t, tt.src, nil)
+		if len(rets) == 0 {
+			t.Errorf("%s returned nothing", tt.src)
+			continue
+		}
+		if got := fmt.Sprint(rets[0]); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`string.find("a", "[a")`, `string.match("a", "(a")`} {
+		script, err := CompileLuaScript(bad)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		if _, _, err := script.Run(nil); err == nil {
+			t.Errorf("expected malformed pattern error for %s", bad)
+		}
+	}
+}
+
+func TestLua_Errors(t *testing.T) {
+	for _, src := range []string{
+		`return 1 +`,
+		`local = 1`,
+		`goto done`,
+		`return 1 & 2`,
+		`return 7 // 2`,
+		`if x then`,
+		`return "unterminated`,
+	} {
+		if _, err := CompileLuaScript(src); err == nil {
+			t.Errorf("expected compile error for %q", src)
+		}
+	}
+
+	for _, tt := range []struct{ src, msg string }{
+		{`while true do end`, "time limit"},
+		{`local function f() return f() + 1 end return f()`, "stack overflow"},
+		{`return nil + 1`, "add operation between nil and number"},
+		{`return undefined_fn()`, "call a non-function"},
+		{`string.upper = nil`, "standard library"},
+		{`return string.sub()`, "bad argument #1"},
+		{`error("custom failure")`, "custom failure"},
+		{`return ("x"):rep(2 ^ 30)`, "too large"},
+		// The length check must not overflow when the count is huge
+		{`local s = ("x"):rep(1024) return s:rep(2 ^ 53)`, "too large"},
+		{`return ("ab"):rep(1e300, ",")`, "too large"},
+		{`return load("return 1")`, "call a non-function"},
+		{`return loadstring("return 1")`, "call a non-function"},
+		{`return require("os")`, "call a non-function"},
+		{`return dofile("/etc/passwd")`, "call a non-function"},
+		{`return io.open("/etc/passwd")`, "index a non-table"},
+		{`return os.execute("id")`, "call a non-function"},
+		{`return os.getenv("HOME")`, "call a non-function"},
+		{`setmetatable({}, {})`, "call a non-function"},
+		{`rawset(string, "upper", nil)`, "call a non-function"},
+		{`getmetatable("").__index.upper = nil`, "call a non-function"},
+		{`_G.string.upper = nil`, "standard library"},
+	} {
+		script, err := CompileLuaScript(tt.src)
+		if err != nil {
+			if tt.msg == "" {
+				continue
+			}
+			t.Fatalf("compile error for %q: %v", tt.src, err)
+		}
+		_, _, err = script.Run(nil)
+		if err == nil {
+			t.Errorf("expected runtime error for %q", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("error for %q = %v, want it to contain %q", tt.src, err, tt.msg)
+		}
+	}
+}
+
+func TestLua_Event(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{"name": "Alice"},
+		"tags": []interface{}{"a", "b"},
+		"n":    float64(3),
+	}
+
+	rets, modified := runLua(t, `return event.user.name == "Alice" and #event.tags == 2 and event.n == 3`, data)
+	if rets[0] != true || modified != nil {
+		t.Fatalf("read-only script: rets %v, modified %v", rets, modified)
+	}
+
+	_, modified = runLua(t, `
+		event.user.name = string.lower(event.user.name)
+		table.insert(event.tags, "c")
+		event.score = event.n * 10
+		event.n = nil`, data)
+	if modified == nil {
+		t.Fatal("expected the event to be modified")
+	}
+	if modified["user"].(map[string]interface{})["name"] != "alice" || modified["score"] != float64(30) {
+		t.Fatalf("unexpected event %v", modified)
+	}
+	if tags := modified["tags"].([]interface{}); len(tags) != 3 || tags[2] != "c" {
+		t.Fatalf("unexpected tags %v", modified["tags"])
+	}
+	if _, ok := modified["n"]; ok {
+		t.Fatal("n should be removed")
+	}
+	// The original event is untouched
+	if data["user"].(map[string]interface{})["name"] != "Alice" || len(data["tags"].([]interface{})) != 2 {
+		t.Fatalf("original event changed: %v", data)
+	}
+
+	// Globals do not leak between runs of a pooled state
+	runLua(t, `leaked = 1 _G.also = 2 function helper() end`, data)
+	rets, _ = runLua(t, `return leaked == nil and also == nil and helper == nil`, data)
+	if rets[0] != true {
+		t.Fatal("global leaked between runs")
+	}
+}
+
+func TestLua_EventTypes(t *testing.T) {
+	data := map[string]interface{}{
+		"count":  3,
+		"labels": map[string]string{"env": "prod"},
+		"ports":  []int{22, 443},
+		"user":   map[string]interface{}{"name": "alice", "groups": []interface{}{"admins"}},
+		"empty":  []interface{}{},
+		"gap":    []interface{}{"a", nil, "b"},
+	}
+	if _, modified := runLua(t, `local t = event.user event.user = t event.count = 3`, data); modified != nil {
+		t.Fatalf("rewriting the same values modified the event: %v", modified)
+	}
+
+	_, modified := runLua(t, `event.user.name = "bob"`, data)
+	if modified == nil {
+		t.Fatal("expected the event to be modified")
+	}
+	// Values the script did not change keep their types
+	if modified["count"] != 3 || fmt.Sprint(modified["empty"]) != "[]" || fmt.Sprint(modified["gap"]) != "[a <nil> b]" {
+		t.Fatalf("unchanged values converted: %#v", modified)
+	}
+	if fmt.Sprint(modified["ports"]) != "[22 443]" || fmt.Sprint(modified["labels"]) != "map[env:prod]" {
+		t.Fatalf("typed containers: %#v", modified)
+	}
+	// The result does not share objects with the original event
+	modified["user"].(map[string]interface{})["groups"].([]interface{})[0] = "changed"
+	if data["user"].(map[string]interface{})["groups"].([]interface{})[0] != "admins" || data["user"].(map[string]interface{})["name"] != "alice" {
+		t.Fatalf("original event changed: %v", data)
+	}
+
+	_, modified = runLua(t, `event.list = {1, 2} event.obj = {a = 1} event.sparse = {[1] = "x", [5] = "y"} event.fn = print`, nil)
+	if fmt.Sprint(modified["list"]) != "[1 2]" || fmt.Sprint(modified["obj"]) != "map[a:1]" || fmt.Sprint(modified["sparse"]) != "map[1:x 5:y]" {
+		t.Fatalf("new values: %#v", modified)
+	}
+	if _, ok := modified["fn"]; ok {
+		t.Fatal("a function was stored in the event")
+	}
+
+	for _, src := range []string{`event = 1`, `event.self = event`} {
+		script, err := CompileLuaScript(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := script.Run(data); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestScript_Rule(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<script lang="lua"><![CDATA[
+			-- Tag service accounts, drop the rest of the match for them
+			local user = event.user or ""
+			event.domain = string.match(user, "@(.+)$")
+			if user:sub(1, 4) == "svc_" then
+				return false
+			end
+		]]></script>
+		<script>event.checked = #event.domain &lt; 20</script>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rs.IsDetection = true
+	rule := &rs.Rules[0]
+	if len(rule.ScriptMap) != 2 {
+		t.Fatalf("expected two scripts, got %d", len(rule.ScriptMap))
+	}
+	for id, script := range rule.ScriptMap {
+		if err := processScript(&script, rule.ID); err != nil {
+			t.Fatalf("processScript error: %v", err)
+		}
+		rule.ScriptMap[id] = script
+	}
+
+	data := map[string]interface{}{"user": "alice@corp.example"}
+	ok, copied, out := rs.executeRuleOperations(rule, data, map[string]common.CheckCoreCache{}, nil)
+	if !ok || !copied || out["domain"] != "corp.example" || out["checked"] != true {
+		t.Fatalf("unexpected result %v %v %v", ok, copied, out)
+	}
+	if _, exists := data["domain"]; exists {
+		t.Fatal("input event was modified")
+	}
+	if ok, _, _ := rs.executeRuleOperations(rule, map[string]interface{}{"user": "svc_backup@corp.example"}, map[string]common.CheckCoreCache{}, nil); ok {
+		t.Fatal("script returning false must fail the rule")
+	}
+	// A runtime error fails the rule: the second script indexes a missing domain
+	if ok, _, _ := rs.executeRuleOperations(rule, map[string]interface{}{"user": "bob"}, map[string]common.CheckCoreCache{}, nil); ok {
+		t.Fatal("script error must fail the rule")
+	}
+
+	for _, bad := range []string{
+		`<script lang="python">x = 1</script>`,
+		`<script lang="lua"></script>`,
+		`<script lang="lua" name="x">return true</script>`,
+		`<script lang="lua">if a <b/> then end</script>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+	if err := processScript(&Script{Lang: "lua", Source: "return ("}, "r1"); err == nil {
+		t.Fatal("expected compile error")
+	}
+}
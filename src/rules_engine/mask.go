@@ -0,0 +1,230 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mask strategies
+const (
+	// MaskRedact replaces the value with MaskRedacted
+	MaskRedact = "redact"
+	// MaskHash replaces the value with the SHA-256 hex digest of the salt and the value
+	MaskHash = "hash"
+	// MaskPartial keeps the first and last characters of the value and masks the rest with *
+	MaskPartial = "partial"
+	// MaskTokenize replaces the value with a short token, the same value and salt give the same token
+	MaskTokenize = "tokenize"
+)
+
+const (
+	// MaskRedacted is the value of redacted fields
+	MaskRedacted = "[REDACTED]"
+
+	defaultMaskKeep = 2
+	tokenPrefix     = "tok_"
+)
+
+// Mask is a ruleset-level <mask> element, it rewrites a field of every event the ruleset forwards
+type Mask struct {
+	Field    string
+	Strategy string
+	Salt     string
+	// Keep is the number of characters partial keeps at each end
+	Keep int
+
+	FieldList []string
+}
+
+// parseMask parses a <mask field="password" strategy="redact"/> element
+func parseMask(element xml.StartElement, decoder *XMLDecoder, elementLine int) (Mask, error) {
+	mask := Mask{Strategy: MaskRedact, Keep: defaultMaskKeep}
+	keepSet := false
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "field":
+			mask.Field = strings.TrimSpace(attr.Value)
+		case "strategy":
+			mask.Strategy = strings.ToLower(strings.TrimSpace(attr.Value))
+		case "salt":
+			mask.Salt = attr.Value
+		case "keep":
+			keep, err := strconv.Atoi(strings.TrimSpace(attr.Value))
+			if err != nil || keep < 1 {
+				return mask, fmt.Errorf("mask keep must be a positive number of characters, got '%s' at line %d", attr.Value, elementLine)
+			}
+			mask.Keep = keep
+			keepSet = true
+		default:
+			return mask, fmt.Errorf("unsupported attribute '%s' in mask at line %d, only field, strategy, salt and keep are allowed", attr.Name.Local, elementLine)
+		}
+	}
+	if mask.Field == "" {
+		return mask, fmt.Errorf("mask field cannot be empty at line %d", elementLine)
+	}
+	switch mask.Strategy {
+	case MaskRedact, MaskHash, MaskPartial, MaskTokenize:
+	default:
+		return mask, fmt.Errorf("mask strategy must be '%s', '%s', '%s' or '%s', got '%s' at line %d", MaskRedact, MaskHash, MaskPartial, MaskTokenize, mask.Strategy, elementLine)
+	}
+	if keepSet && mask.Strategy != MaskPartial {
+		return mask, fmt.Errorf("mask keep is only supported by the partial strategy at line %d", elementLine)
+	}
+	if mask.Salt != "" && mask.Strategy != MaskHash && mask.Strategy != MaskTokenize {
+		return mask, fmt.Errorf("mask salt is only supported by the hash and tokenize strategies at line %d", elementLine)
+	}
+	mask.FieldList = common.StringToList(mask.Field)
+
+	if err := decoder.Skip(); err != nil {
+		return mask, fmt.Errorf("error parsing mask at line %d: %v", elementLine, err)
+	}
+	return mask, nil
+}
+
+// parseDropFields parses a <drop_fields> element, its content is a comma separated list of fields
+func parseDropFields(decoder *XMLDecoder, elementLine int) ([][]string, error) {
+	var content strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing drop_fields at line %d: %v", elementLine, err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			content.Write(t)
+		case xml.StartElement:
+			return nil, fmt.Errorf("unsupported element '<%s>' inside drop_fields at line %d", t.Name.Local, elementLine)
+		case xml.EndElement:
+			var fields [][]string
+			for _, field := range strings.Split(content.String(), ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					fields = append(fields, common.StringToList(field))
+				}
+			}
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("drop_fields must specify at least one field at line %d", elementLine)
+			}
+			return fields, nil
+		}
+	}
+}
+
+// Apply returns the masked form of a value
+func (m *Mask) Apply(value interface{}) string {
+	if m.Strategy == MaskRedact {
+		return MaskRedacted
+	}
+	s := common.AnyToString(value)
+	switch m.Strategy {
+	case MaskHash:
+		sum := sha256.Sum256([]byte(m.Salt + s))
+		return hex.EncodeToString(sum[:])
+	case MaskTokenize:
+		mac := hmac.New(sha256.New, []byte(m.Salt))
+		mac.Write([]byte(s))
+		return tokenPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+	case MaskPartial:
+		runes := []rune(s)
+		if len(runes) <= 2*m.Keep {
+			return strings.Repeat("*", len(runes))
+		}
+		return string(runes[:m.Keep]) + strings.Repeat("*", len(runes)-2*m.Keep) + string(runes[len(runes)-m.Keep:])
+	}
+	return MaskRedacted
+}
+
+// hasOutputPolicy reports whether the ruleset masks or drops fields of the events it forwards
+func (r *Ruleset) hasOutputPolicy() bool {
+	return len(r.Masks) > 0 || len(r.DropFields) > 0
+}
+
+// applyOutputPolicy drops and masks the fields of an event before it leaves the ruleset, the
+// event is modified in place so it must not be shared with other components
+func (r *Ruleset) applyOutputPolicy(event map[string]interface{}) {
+	for _, fieldPath := range r.DropFields {
+		common.MapDel(event, fieldPath)
+	}
+	for i := range r.Masks {
+		mask := &r.Masks[i]
+		parent, ok := fieldParent(event, mask.FieldList)
+		if !ok {
+			continue
+		}
+		key := mask.FieldList[len(mask.FieldList)-1]
+		if value, exists := parent[key]; exists && value != nil {
+			parent[key] = mask.Apply(value)
+		}
+	}
+	r.maskExplanations(event)
+}
+
+// maskExplanations applies the policy to the matched values recorded by explain, which would
+// otherwise leak the original values of masked and dropped fields
+func (r *Ruleset) maskExplanations(event map[string]interface{}) {
+	explanations, ok := event[ExplainFieldName].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, explanation := range explanations {
+		e, ok := explanation.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		checks, _ := e["checks"].([]map[string]interface{})
+		for i, check := range checks {
+			field, _ := check["field"].(string)
+			value, ok := check["matched_value"]
+			if field == "" || !ok {
+				continue
+			}
+			path := common.StringToList(field)
+			// The slice is shared with the explanations of other events, so it is copied on change
+			masked := copyMap(check)
+			for _, fieldPath := range r.DropFields {
+				if slices.Equal(path, fieldPath) {
+					delete(masked, "matched_value")
+				}
+			}
+			for j := range r.Masks {
+				if _, kept := masked["matched_value"]; kept && slices.Equal(path, r.Masks[j].FieldList) {
+					masked["matched_value"] = r.Masks[j].Apply(value)
+				}
+			}
+			if len(masked) != len(check) || masked["matched_value"] != value {
+				checks = slices.Clone(checks)
+				checks[i] = masked
+				e["checks"] = checks
+			}
+		}
+	}
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// fieldParent returns the map holding the last key of a path
+func fieldParent(data map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	for _, k := range path[:len(path)-1] {
+		next, ok := data[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data = next
+	}
+	return data, true
+}
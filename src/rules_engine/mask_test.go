@@ -0,0 +1,120 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMask_Strategies(t *testing.T) {
+	tests := []struct {
+		mask  Mask
+		value interface{}
+		want  string
+	}{
+		{Mask{Strategy: MaskRedact}, "secret", MaskRedacted},
+		{Mask{Strategy: MaskHash}, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{Mask{Strategy: MaskPartial, Keep: 4}, "4111111111111111", "4111********1111"},
+		{Mask{Strategy: MaskPartial, Keep: 2}, "abcd", "****"},
+		{Mask{Strategy: MaskPartial, Keep: 1}, 12345, "1***5"},
+	}
+	for _, tt := range tests {
+		if got := tt.mask.Apply(tt.value); got != tt.want {
+			t.Errorf("%s(%v) = %q, want %q", tt.mask.Strategy, tt.value, got, tt.want)
+		}
+	}
+
+	tok := Mask{Strategy: MaskTokenize, Salt: "s1"}
+	a, b := tok.Apply("alice@example.com"), tok.Apply("alice@example.com")
+	if a != b || !strings.HasPrefix(a, tokenPrefix) || len(a) != len(tokenPrefix)+16 {
+		t.Fatalf("tokens must be stable and prefixed, got %q and %q", a, b)
+	}
+	other := Mask{Strategy: MaskTokenize, Salt: "s2"}
+	if other.Apply("alice@example.com") == a {
+		t.Fatal("tokens with another salt must differ")
+	}
+}
+
+func TestMask_Ruleset(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="mask" explain="true">
+  <mask field="password" strategy="redact"/>
+  <mask field="user.email" strategy="tokenize" salt="pepper"/>
+  <mask field="card" strategy="partial" keep="4"/>
+  <drop_fields>session_token, user.phone</drop_fields>
+  <rule id="r1" name="r1">
+    <check type="INCL" field="card">4111</check>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+
+	data := map[string]interface{}{
+		"password":      "hunter2",
+		"card":          "4111111111111111",
+		"session_token": "abc",
+		"user":          map[string]interface{}{"email": "alice@example.com", "phone": "555-0100", "name": "alice"},
+	}
+	out := rs.EngineCheck(data)
+	if len(out) != 1 {
+		t.Fatalf("expected one result, got %d", len(out))
+	}
+	ev := out[0]
+	if ev["password"] != MaskRedacted || ev["card"] != "4111********1111" {
+		t.Fatalf("unexpected masked fields %v", ev)
+	}
+	if _, ok := ev["session_token"]; ok {
+		t.Fatalf("session_token must be dropped: %v", ev)
+	}
+	user := ev["user"].(map[string]interface{})
+	if _, ok := user["phone"]; ok || user["name"] != "alice" || !strings.HasPrefix(user["email"].(string), tokenPrefix) {
+		t.Fatalf("unexpected user %v", user)
+	}
+
+	// The explanation must not keep the original value of a masked field
+	explanation := ev[ExplainFieldName].(map[string]interface{})["TEST.RS.r1"].(map[string]interface{})
+	check := explanation["checks"].([]map[string]interface{})[0]
+	if check["matched_value"] != "4111********1111" {
+		t.Fatalf("explanation leaks the card number: %v", check)
+	}
+
+	// The input event is left untouched
+	if data["password"] != "hunter2" || data["session_token"] != "abc" {
+		t.Fatalf("input event was modified: %v", data)
+	}
+}
+
+func TestMask_ExcludePassthrough(t *testing.T) {
+	xml := `
+<root type="EXCLUDE" name="mask">
+  <mask field="password"/>
+  <rule id="r1" name="r1">
+    <check type="EQU" field="user">root</check>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+
+	data := map[string]interface{}{"user": "bob", "password": "hunter2"}
+	out := rs.EngineCheck(data)
+	if len(out) != 1 || out[0]["password"] != MaskRedacted {
+		t.Fatalf("unexpected result %v", out)
+	}
+	if data["password"] != "hunter2" {
+		t.Fatal("the forwarded event must be a copy")
+	}
+}
+
+func TestMask_ParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		`<mask strategy="redact"/>`,
+		`<mask field="a" strategy="scramble"/>`,
+		`<mask field="a" strategy="redact" keep="2"/>`,
+		`<mask field="a" strategy="partial" keep="0"/>`,
+		`<mask field="a" strategy="partial" salt="x"/>`,
+		`<drop_fields> </drop_fields>`,
+		`<rule id="r1"><check type="NOTNULL" field="a"></check><mask field="a"/></rule>`,
+	} {
+		xml := `<root type="DETECTION" name="bad">` + bad + `</root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Errorf("expected parse error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2"
+)
+
+// pluginCheckCacheMaxEntries bounds the results of PLUGIN checks kept by pluginCheckCache
+const pluginCheckCacheMaxEntries = 1 << 20
+
+// pluginCheckCache memoizes the results of PLUGIN checks with a cache_ttl by plugin name and
+// arguments. It is shared by all rulesets, rules calling a plugin with the same arguments share
+// the results.
+var (
+	pluginCheckCache     *ristretto.Cache[string, bool]
+	pluginCheckCacheOnce sync.Once
+)
+
+func getPluginCheckCache() *ristretto.Cache[string, bool] {
+	pluginCheckCacheOnce.Do(func() {
+		cache, err := ristretto.NewCache(&ristretto.Config[string, bool]{
+			NumCounters: 10 * pluginCheckCacheMaxEntries,
+			MaxCost:     pluginCheckCacheMaxEntries,
+			BufferItems: 64,
+		})
+		if err != nil {
+			logger.Error("Failed to create the plugin check cache, PLUGIN checks are not cached", "error", err)
+			return
+		}
+		pluginCheckCache = cache
+	})
+	return pluginCheckCache
+}
+
+// preparePluginCache parses the cache_ttl of a PLUGIN check. Checks receiving the whole event
+// cannot be cached, the event is different every time.
+func preparePluginCache(node *CheckNodes) error {
+	node.PluginCacheTTL = 0
+	ttl := strings.TrimSpace(node.CacheTTL)
+	if ttl == "" {
+		return nil
+	}
+	seconds, err := common.ParseDurationToSecondsInt(ttl)
+	if err != nil {
+		return errors.New("check cache_ttl parse err: " + err.Error())
+	}
+	for _, arg := range node.PluginArgs {
+		if arg.Type == 2 {
+			return errors.New("cache_ttl is not supported by PLUGIN checks receiving _$ORIDATA")
+		}
+	}
+	node.PluginCacheTTL = time.Duration(seconds) * time.Second
+	return nil
+}
+
+// pluginCheckCacheKey returns the cache key of a plugin call, the type of each argument is part
+// of the key since plugins may treat 1 and "1" differently
+func pluginCheckCacheKey(name string, args []interface{}) string {
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(name)
+	for _, arg := range args {
+		sb.WriteByte(0)
+		fmt.Fprintf(sb, "%T:%v", arg, arg)
+	}
+	key := common.XXHash64(sb.String())
+	stringBuilderPool.Put(sb)
+	return key
+}
+
+// evalPluginCheck calls the plugin of a PLUGIN check, or returns its cached result for the same
+// arguments within cache_ttl. Errors are not cached.
+func evalPluginCheck(node *CheckNodes, args []interface{}) (bool, error) {
+	if node.PluginCacheTTL <= 0 {
+		return node.Plugin.FuncEvalCheckNode(args...)
+	}
+	cache := getPluginCheckCache()
+	if cache == nil {
+		return node.Plugin.FuncEvalCheckNode(args...)
+	}
+	key := pluginCheckCacheKey(node.Plugin.Name, args)
+	if result, ok := cache.Get(key); ok {
+		return result, nil
+	}
+	result, err := node.Plugin.FuncEvalCheckNode(args...)
+	if err == nil {
+		cache.SetWithTTL(key, result, 1, node.PluginCacheTTL)
+	}
+	return result, err
+}
@@ -0,0 +1,60 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/local_plugin"
+	"AgentSmith-HUB/plugin"
+	"strings"
+	"testing"
+)
+
+func TestPluginCheckCache(t *testing.T) {
+	calls := 0
+	local_plugin.LocalPluginBoolRes["testCachedLookup"] = func(args ...interface{}) (bool, error) {
+		calls++
+		return args[0] == "10.0.0.1", nil
+	}
+	plugin.Plugins["testCachedLookup"] = &plugin.Plugin{Name: "testCachedLookup", Type: plugin.LOCAL_PLUGIN, ReturnType: "bool"}
+	defer func() {
+		delete(local_plugin.LocalPluginBoolRes, "testCachedLookup")
+		delete(plugin.Plugins, "testCachedLookup")
+	}()
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="bad_ip">
+    <check type="PLUGIN" cache_ttl="10m">testCachedLookup(ip)</check>
+  </rule>
+</root>`)
+
+	check := func(ip string) bool {
+		return len(rs.EngineCheck(map[string]interface{}{"ip": ip})) == 1
+	}
+	if !check("10.0.0.1") || check("10.0.0.2") {
+		t.Fatal("unexpected plugin results")
+	}
+	getPluginCheckCache().Wait()
+	for i := 0; i < 5; i++ {
+		if !check("10.0.0.1") || check("10.0.0.2") {
+			t.Fatal("unexpected cached plugin results")
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected one plugin call per argument, got %d", calls)
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<check type="EQU" field="a" cache_ttl="1m">b</check>`, "cache_ttl is only supported by PLUGIN checks"},
+		{`<check type="PLUGIN" cache_ttl="1s">testCachedLookup(ip)</check>`, "check cache_ttl parse err"},
+		{`<check type="PLUGIN" cache_ttl="1m">testCachedLookup(_$ORIDATA)</check>`, "_$ORIDATA"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package rules_engine
+
+import (
+	"testing"
+
+	"AgentSmith-HUB/common"
+)
+
+func TestPriority_MarksHighPriorityRuleHits(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION" name="priority">
+  <rule id="ransom" name="ransom" priority="high">
+    <check type="INCL" field="cmd">vssadmin delete shadows</check>
+  </rule>
+  <rule id="bulk" name="bulk">
+    <check type="INCL" field="cmd">curl</check>
+  </rule>
+ </root>`)
+
+	out := rs.EngineCheck(map[string]interface{}{"cmd": "vssadmin delete shadows /all"})
+	if len(out) != 1 || !common.IsHighPriority(out[0]) {
+		t.Fatalf("expected a high priority alert, got %v", out)
+	}
+
+	out = rs.EngineCheck(map[string]interface{}{"cmd": "curl x"})
+	if len(out) != 1 {
+		t.Fatalf("expected one alert, got %d", len(out))
+	}
+	if _, ok := out[0][common.PriorityFieldName]; ok {
+		t.Fatalf("rules without priority must not mark their alerts: %v", out[0])
+	}
+}
+
+func TestPriority_RejectsUnknownValue(t *testing.T) {
+	_, err := ParseRuleset([]byte(`<root type="DETECTION" name="priority">
+  <rule id="r1" name="r1" priority="urgent">
+    <check type="INCL" field="cmd">curl</check>
+  </rule>
+ </root>`))
+	if err == nil {
+		t.Fatalf("expected unknown priority to be rejected")
+	}
+}
@@ -0,0 +1,246 @@
+package rules_engine
+
+// #cgo LDFLAGS: -lrure
+//
+// #include <stdbool.h>
+// #include <stdint.h>
+// #include <stdlib.h>
+//
+// typedef struct rure_set rure_set;
+// typedef struct rure_options rure_options;
+// typedef struct rure_error rure_error;
+//
+// rure_set *rure_compile_set(const uint8_t **patterns, const size_t *patterns_lengths,
+//                            size_t patterns_count, uint32_t flags,
+//                            rure_options *options, rure_error *error);
+// void rure_set_free(rure_set *re);
+// bool rure_set_is_match(rure_set *re, const uint8_t *haystack, size_t length,
+//                        size_t start);
+// bool rure_set_matches(rure_set *re, const uint8_t *haystack, size_t length,
+//                       size_t start, bool *matches);
+// rure_options *rure_options_new();
+// void rure_options_free(rure_options *options);
+// void rure_options_size_limit(rure_options *options, size_t limit);
+// void rure_options_dfa_size_limit(rure_options *options, size_t limit);
+// rure_error *rure_error_new();
+// void rure_error_free(rure_error *err);
+// const char *rure_error_message(rure_error *err);
+import "C"
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unsafe"
+
+	regexp "github.com/BurntSushi/rure-go"
+)
+
+const (
+	// minRegexSetSize is the number of static REGEX checks on a field from which they are
+	// matched as one set
+	minRegexSetSize = 2
+	// maxCachedRegexSets bounds the compiled sets kept for reuse across ruleset reloads
+	maxCachedRegexSets = 256
+	// regexSetCachePrefix marks the set results in the per-event check cache, it cannot be
+	// the start of a field name
+	regexSetCachePrefix = "\x00regex_set:"
+
+	// A set needs a much larger DFA cache than a single regex to stay on the DFA, with the
+	// default limit sets of a few hundred patterns fall back to an NFA and run slower than the
+	// patterns one by one
+	regexSetSizeLimit    = 64 << 20
+	regexSetDFASizeLimit = 8 << 20
+)
+
+// RegexSet is a set of regular expressions matched against a value in a single pass, with the
+// same syntax and Unicode semantics as the REGEX check
+type RegexSet struct {
+	p        *C.rure_set
+	patterns []string
+	none     []bool // result when no pattern matches, shared and never modified
+}
+
+// CompileRegexSet compiles patterns into one set, the result of pattern i is reported at index i
+func CompileRegexSet(patterns []string) (*RegexSet, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("regex set needs at least one pattern")
+	}
+	n := len(patterns)
+	ptrs := (*[1 << 28]*C.uint8_t)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof(uintptr(0)))))[:n:n]
+	lens := (*[1 << 28]C.size_t)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof(C.size_t(0)))))[:n:n]
+	defer C.free(unsafe.Pointer(&ptrs[0]))
+	defer C.free(unsafe.Pointer(&lens[0]))
+	for i, pattern := range patterns {
+		ptrs[i] = (*C.uint8_t)(C.CBytes([]byte(pattern)))
+		lens[i] = C.size_t(len(pattern))
+	}
+	defer func() {
+		for i := range ptrs {
+			C.free(unsafe.Pointer(ptrs[i]))
+		}
+	}()
+
+	opts := C.rure_options_new()
+	defer C.rure_options_free(opts)
+	C.rure_options_size_limit(opts, regexSetSizeLimit)
+	C.rure_options_dfa_size_limit(opts, regexSetDFASizeLimit)
+	cerr := C.rure_error_new()
+	defer C.rure_error_free(cerr)
+	p := C.rure_compile_set(&ptrs[0], &lens[0], C.size_t(n), C.uint32_t(regexp.FlagDefault), opts, cerr)
+	if p == nil {
+		return nil, errors.New(C.GoString(C.rure_error_message(cerr)))
+	}
+	set := &RegexSet{p: p, patterns: append([]string(nil), patterns...), none: make([]bool, n)}
+	runtime.SetFinalizer(set, func(set *RegexSet) {
+		C.rure_set_free(set.p)
+	})
+	return set, nil
+}
+
+// Len returns the number of patterns of the set
+func (s *RegexSet) Len() int {
+	return len(s.patterns)
+}
+
+// Matches reports for each pattern whether it matches text, the result must not be modified
+func (s *RegexSet) Matches(text string) []bool {
+	var empty [1]byte
+	haystack := (*C.uint8_t)(unsafe.Pointer(&empty[0]))
+	if len(text) > 0 {
+		haystack = (*C.uint8_t)(unsafe.Pointer(unsafe.StringData(text)))
+	}
+	// Most values match no pattern, which the set tells faster than which patterns match
+	if !C.rure_set_is_match(s.p, haystack, C.size_t(len(text)), 0) {
+		runtime.KeepAlive(text)
+		return s.none
+	}
+	matches := make([]C.bool, len(s.patterns))
+	C.rure_set_matches(s.p, haystack, C.size_t(len(text)), 0, &matches[0])
+	runtime.KeepAlive(text)
+	runtime.KeepAlive(s)
+
+	result := make([]bool, len(matches))
+	for i, m := range matches {
+		result[i] = bool(m)
+	}
+	return result
+}
+
+// fieldRegexSet is the set of the static REGEX checks of a ruleset on one field
+type fieldRegexSet struct {
+	field string
+	set   *RegexSet
+}
+
+// matches returns the results of the set for the value of an event, the results are kept in
+// the check cache of the event so each field is matched once
+func (f *fieldRegexSet) matches(ruleCache map[string]common.CheckCoreCache, value string) []bool {
+	key := regexSetCachePrefix + f.field
+	if cached, ok := ruleCache[key]; ok && cached.Data == value {
+		return cached.TypedData.([]bool)
+	}
+	res := f.set.Matches(value)
+	ruleCache[key] = common.CheckCoreCache{Exist: true, Data: value, TypedData: res}
+	return res
+}
+
+// regexSetCache keeps compiled sets by their patterns, so a reloaded ruleset whose patterns did
+// not change reuses its sets instead of compiling them again
+var regexSetCache = struct {
+	sync.Mutex
+	sets  map[string]*RegexSet
+	order []string
+}{sets: make(map[string]*RegexSet)}
+
+func getCompiledRegexSet(patterns []string) (*RegexSet, error) {
+	key := strings.Join(patterns, "\x00")
+	regexSetCache.Lock()
+	defer regexSetCache.Unlock()
+	if set, ok := regexSetCache.sets[key]; ok {
+		return set, nil
+	}
+	set, err := CompileRegexSet(patterns)
+	if err != nil {
+		return nil, err
+	}
+	regexSetCache.sets[key] = set
+	regexSetCache.order = append(regexSetCache.order, key)
+	if len(regexSetCache.order) > maxCachedRegexSets {
+		delete(regexSetCache.sets, regexSetCache.order[0])
+		regexSetCache.order = regexSetCache.order[1:]
+	}
+	return set, nil
+}
+
+// buildRegexSets groups the static REGEX checks of the rules and checklists of a ruleset by field
+// and matches each group as one set. Checks of iterators, groups and sequences, checks with logic
+// or modifiers and checks reading their pattern from the event keep their own regex.
+func buildRegexSets(ruleset *Ruleset) {
+	type member struct {
+		node      *CheckNodes
+		writeBack func()
+	}
+	byField := make(map[string][]member)
+	var fields []string
+	add := func(node *CheckNodes, writeBack func()) {
+		if node.Type != "REGEX" || node.Logic != "" || node.Regex == nil || node.modifiers != 0 || hasFromRawPrefix(node.Value) {
+			return
+		}
+		node.regexSet = nil
+		if _, ok := byField[node.Field]; !ok {
+			fields = append(fields, node.Field)
+		}
+		byField[node.Field] = append(byField[node.Field], member{node: node, writeBack: writeBack})
+	}
+
+	for i := range ruleset.Rules {
+		rule := &ruleset.Rules[i]
+		// Operation IDs are sorted so the patterns, and the cache key of the set, do not depend
+		// on map iteration
+		for _, id := range slices.Sorted(maps.Keys(rule.CheckMap)) {
+			node := rule.CheckMap[id]
+			add(&node, func() { rule.CheckMap[id] = node })
+		}
+		for _, id := range slices.Sorted(maps.Keys(rule.ChecklistMap)) {
+			checklist := rule.ChecklistMap[id]
+			for j := range checklist.CheckNodes {
+				add(&checklist.CheckNodes[j], func() {})
+			}
+		}
+	}
+
+	for _, field := range fields {
+		members := byField[field]
+		if len(members) < minRegexSetSize {
+			for _, m := range members {
+				m.writeBack()
+			}
+			continue
+		}
+		patterns := make([]string, 0, len(members))
+		for _, m := range members {
+			patterns = append(patterns, m.node.Value)
+		}
+		set, err := getCompiledRegexSet(patterns)
+		if err != nil {
+			// Too large for one set, the checks keep their own regex
+			logger.Warn("Failed to compile regex set, falling back to single regexes", "ruleset", ruleset.RulesetID, "field", field, "patterns", len(patterns), "error", err)
+			for _, m := range members {
+				m.writeBack()
+			}
+			continue
+		}
+		fs := &fieldRegexSet{field: field, set: set}
+		for i, m := range members {
+			m.node.regexSet = fs
+			m.node.regexSetIndex = i
+			m.writeBack()
+		}
+	}
+}
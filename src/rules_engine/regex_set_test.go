@@ -0,0 +1,101 @@
+package rules_engine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegexSet_Matches(t *testing.T) {
+	set, err := CompileRegexSet([]string{`curl.*\|\s*(ba)?sh`, `(?i)invoke-expression`, `^$`, `\d{3}`})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if set.Len() != 4 {
+		t.Fatalf("unexpected length %d", set.Len())
+	}
+	tests := []struct {
+		text string
+		want []bool
+	}{
+		{"curl http://x | bash", []bool{true, false, false, false}},
+		{"powershell Invoke-Expression 123", []bool{false, true, false, true}},
+		{"", []bool{false, false, true, false}},
+		{"héllo wörld", []bool{false, false, false, false}},
+	}
+	for _, tt := range tests {
+		if got := set.Matches(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Matches(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	if _, err := CompileRegexSet([]string{`ok`, `(unclosed`}); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestRegexSet_Ruleset(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="regex_set">
+  <rule id="r1" name="r1">
+    <check type="REGEX" field="cmd">curl.*\|\s*(ba)?sh</check>
+  </rule>
+  <rule id="r2" name="r2">
+    <checklist condition="a and not b">
+      <check id="a" type="REGEX" field="cmd">(?i)invoke-expression</check>
+      <check id="b" type="REGEX" field="cmd">-WindowStyle\s+Hidden</check>
+    </checklist>
+  </rule>
+  <rule id="r3" name="r3">
+    <check type="REGEX" field="user">^svc_</check>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+
+	cmdChecks := 0
+	for _, rule := range rs.Rules {
+		for _, node := range rule.CheckMap {
+			if node.Field == "cmd" && node.regexSet == nil {
+				t.Fatalf("check on cmd is not in a set: %+v", node)
+			}
+			if node.Field == "user" && node.regexSet != nil {
+				t.Fatal("a single check on a field must keep its own regex")
+			}
+		}
+		for _, checklist := range rule.ChecklistMap {
+			for _, node := range checklist.CheckNodes {
+				if node.regexSet == nil || node.regexSet.set.Len() != 3 {
+					t.Fatalf("checklist check is not in the cmd set: %+v", node)
+				}
+				cmdChecks++
+			}
+		}
+	}
+	if cmdChecks != 2 {
+		t.Fatalf("expected two checklist checks, got %d", cmdChecks)
+	}
+
+	hits := func(event map[string]interface{}) []string {
+		var ids []string
+		for _, res := range rs.EngineCheck(event) {
+			ids = append(ids, fmt.Sprint(res[HitRuleIdFieldName]))
+		}
+		return ids
+	}
+	if got := hits(map[string]interface{}{"cmd": "curl x | sh", "user": "svc_backup"}); strings.Join(got, ",") != "TEST.RS.r1,TEST.RS.r3" {
+		t.Fatalf("unexpected hits %v", got)
+	}
+	if got := hits(map[string]interface{}{"cmd": "powershell invoke-expression $x"}); strings.Join(got, ",") != "TEST.RS.r2" {
+		t.Fatalf("unexpected hits %v", got)
+	}
+	if got := hits(map[string]interface{}{"cmd": "powershell -WindowStyle Hidden Invoke-Expression $x"}); len(got) != 0 {
+		t.Fatalf("unexpected hits %v", got)
+	}
+
+	// A reloaded ruleset with the same patterns reuses the compiled set
+	reloaded := buildRulesetFromXML(t, xml)
+	if reloaded.Rules[0].CheckMap[1].regexSet.set != rs.Rules[0].CheckMap[1].regexSet.set {
+		t.Fatal("the compiled set was not reused")
+	}
+}
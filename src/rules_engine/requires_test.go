@@ -0,0 +1,108 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const requiresTestRules = `
+<root type="DETECTION">
+  <rule id="brute_force">
+    <check type="EQU" field="action">login_failed</check>
+  </rule>
+  <rule id="success_after_brute_force">
+    <check type="EQU" field="action">login_success</check>
+    <requires rule="brute_force" key="source_ip" within="1h"/>
+  </rule>
+  <rule id="any_brute_force">
+    <check type="EQU" field="action">logout</check>
+    <requires rule="brute_force" within="10m"/>
+  </rule>
+</root>`
+
+func TestRequires_Build(t *testing.T) {
+	rs := buildRulesetFromXML(t, requiresTestRules)
+	hitKeys := rs.Rules[0].hitKeys
+	if len(hitKeys) != 2 || hitKeys[0].Key != "source_ip" || hitKeys[0].TTL != 3600 || hitKeys[1].Key != "" || hitKeys[1].TTL != 600 {
+		t.Fatalf("unexpected hit keys %+v", hitKeys)
+	}
+	if len(rs.Rules[1].hitKeys) != 0 {
+		t.Fatalf("unexpected hit keys of a rule nobody requires: %+v", rs.Rules[1].hitKeys)
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<rule id="r"><requires rule="x"/></rule>`, "requires within cannot be empty"},
+		{`<rule id="r"><requires within="1h"/></rule>`, "requires rule cannot be empty"},
+		{`<rule id="r"><requires rule="x" within="1h" range="1h"/></rule>`, "only rule, key and within are allowed"},
+	} {
+		_, err := ParseRuleset([]byte(`<root type="DETECTION">` + tt.xml + `</root>`))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<rule id="r"><requires rule="missing" within="1h"/></rule>`, "requires rule 'missing' not found"},
+		{`<rule id="r"><requires rule="r" within="1h"/></rule>`, "cannot require itself"},
+		{`<rule id="r"><requires rule="s" within="0s"/></rule><rule id="s"/>`, "requires parse within err"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION">` + tt.xml + `</root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+
+	result, err := ValidateWithDetails("", `<root type="DETECTION">
+<rule id="r">
+    <requires rule="missing" within="1h"/>
+</rule>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsValid || len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Fatalf("unexpected validation %+v", result)
+	}
+}
+
+func TestRequires_Execute(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	rs := buildRulesetFromXML(t, requiresTestRules)
+	hits := func(action, ip string) []string {
+		var ids []string
+		for _, res := range rs.EngineCheck(map[string]interface{}{"action": action, "source_ip": ip}) {
+			ids = append(ids, res[HitRuleIdFieldName].(string))
+		}
+		return ids
+	}
+
+	if ids := hits("login_success", "10.0.0.1"); len(ids) != 0 {
+		t.Fatalf("unexpected hits %v before the required rule matched", ids)
+	}
+	if ids := hits("logout", "10.0.0.9"); len(ids) != 0 {
+		t.Fatalf("unexpected hits %v before the required rule matched", ids)
+	}
+	hits("login_failed", "10.0.0.1")
+
+	if ids := hits("login_success", "10.0.0.1"); len(ids) != 1 || ids[0] != "TEST.RS.success_after_brute_force" {
+		t.Fatalf("expected the requiring rule to match, got %v", ids)
+	}
+	// The key isolates entities, a requirement without key is met by any match
+	if ids := hits("login_success", "10.0.0.2"); len(ids) != 0 {
+		t.Fatalf("unexpected hits %v for another source", ids)
+	}
+	if ids := hits("logout", "10.0.0.9"); len(ids) != 1 || ids[0] != "TEST.RS.any_brute_force" {
+		t.Fatalf("expected the requirement without key to be met, got %v", ids)
+	}
+}
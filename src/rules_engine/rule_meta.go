@@ -0,0 +1,69 @@
+package rules_engine
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RuleMetaFieldName carries the metadata of the rule that matched an event, set when the rule
+// has a <meta> element. A later matching rule of a chained ruleset replaces it.
+const RuleMetaFieldName = "_hub_rule_meta"
+
+// Rule severities, from the least to the most severe
+var RuleSeverities = []string{"info", "low", "medium", "high", "critical"}
+
+// Rule confidences, from the least to the most confident
+var RuleConfidences = []string{"low", "medium", "high"}
+
+// attackTechniqueRegex matches MITRE ATT&CK technique and sub-technique IDs such as T1110 or T1110.001
+var attackTechniqueRegex = regexp.MustCompile(`^T[0-9]{4}(\.[0-9]{3})?$`)
+
+// RuleMeta holds the structured metadata of a rule, written as a <meta> element:
+//
+//	<meta severity="high" confidence="medium">
+//	    <tag>brute_force</tag>
+//	    <attack>T1110.001</attack>
+//	    <reference>https://attack.mitre.org/techniques/T1110/001/</reference>
+//	</meta>
+type RuleMeta struct {
+	Severity   string   `json:"severity,omitempty"`
+	Confidence string   `json:"confidence,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Attack     []string `json:"attack,omitempty"` // ATT&CK technique IDs
+	References []string `json:"references,omitempty"`
+}
+
+// validRuleLevel returns the lower case value if it is one of levels
+func validRuleLevel(value string, levels []string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, level := range levels {
+		if value == level {
+			return value, true
+		}
+	}
+	return value, false
+}
+
+// eventFields returns the metadata added to an event matched by the rule hitRuleID. A new map is
+// built for every event because downstream components may modify it.
+func (m *RuleMeta) eventFields(hitRuleID string) map[string]interface{} {
+	fields := make(map[string]interface{}, 6)
+	fields["rule"] = hitRuleID
+	if m.Severity != "" {
+		fields["severity"] = m.Severity
+	}
+	if m.Confidence != "" {
+		fields["confidence"] = m.Confidence
+	}
+	for name, values := range map[string][]string{"tags": m.Tags, "attack": m.Attack, "references": m.References} {
+		if len(values) == 0 {
+			continue
+		}
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		fields[name] = list
+	}
+	return fields
+}
@@ -0,0 +1,65 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleMeta_PropagatedToMatches(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION">
+  <rule id="brute_force">
+    <meta severity="HIGH" confidence="medium">
+      <tag>auth</tag>
+      <attack>t1110.001</attack>
+      <reference>https://attack.mitre.org/techniques/T1110/001/</reference>
+    </meta>
+    <check type="EQU" field="event">ssh_failed</check>
+  </rule>
+  <rule id="plain">
+    <check type="EQU" field="event">ssh_failed</check>
+  </rule>
+ </root>`)
+
+	out := rs.EngineCheck(map[string]interface{}{"event": "ssh_failed"})
+	if len(out) != 2 {
+		t.Fatalf("expected two matches, got %d", len(out))
+	}
+	meta, ok := out[0][RuleMetaFieldName].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing rule meta in %v", out[0])
+	}
+	if meta["rule"] != "TEST.RS.brute_force" || meta["severity"] != "high" || meta["confidence"] != "medium" {
+		t.Fatalf("unexpected meta %v", meta)
+	}
+	if attack, _ := meta["attack"].([]interface{}); len(attack) != 1 || attack[0] != "T1110.001" {
+		t.Fatalf("unexpected attack %v", meta["attack"])
+	}
+	if _, ok := out[1][RuleMetaFieldName]; ok {
+		t.Fatalf("rule without meta added %v", out[1][RuleMetaFieldName])
+	}
+
+	md := rs.Doc().Markdown()
+	for _, want := range []string{"**Severity:** high", "**ATT&CK:** T1110.001", "auth"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown misses %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestRuleMeta_ParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		`<meta severity="urgent"/>`,
+		`<meta confidence="sure"/>`,
+		`<meta owner="secops"/>`,
+		`<meta><attack>TA0006</attack></meta>`,
+		`<meta><tag></tag></meta>`,
+		`<meta><note>x</note></meta>`,
+		`<meta><tag><b>x</b></tag></meta>`,
+		`<meta severity="low"/><meta severity="high"/>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `<check type="EQU" field="a">1</check></rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
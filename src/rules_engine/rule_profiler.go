@@ -0,0 +1,348 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ruleMetricsRedisKey      = "hub:rule_metrics"
+	ruleMetricsPublishPeriod = 30 * time.Second
+)
+
+// RuleLatencyBucketsUs are the upper bounds, in microseconds, of the rule profiler histograms.
+// Observations above the last bound fall in an extra overflow bucket.
+var RuleLatencyBucketsUs = []int64{10, 50, 100, 500, 1000, 5000, 10000, 50000, 100000, 500000}
+
+// latencyHistogram is a lock-free histogram over RuleLatencyBucketsUs
+type latencyHistogram struct {
+	buckets []atomic.Uint64
+	sumNs   atomic.Uint64
+	maxNs   atomic.Uint64
+}
+
+func newLatencyHistogram() latencyHistogram {
+	return latencyHistogram{buckets: make([]atomic.Uint64, len(RuleLatencyBucketsUs)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	us := d.Microseconds()
+	i := sort.Search(len(RuleLatencyBucketsUs), func(i int) bool { return RuleLatencyBucketsUs[i] >= us })
+	h.buckets[i].Add(1)
+	ns := uint64(d.Nanoseconds())
+	h.sumNs.Add(ns)
+	for {
+		maxNs := h.maxNs.Load()
+		if ns <= maxNs || h.maxNs.CompareAndSwap(maxNs, ns) {
+			break
+		}
+	}
+}
+
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{Buckets: make([]uint64, len(h.buckets))}
+	for i := range h.buckets {
+		s.Buckets[i] = h.buckets[i].Load()
+		s.Count += s.Buckets[i]
+	}
+	s.SumMs = float64(h.sumNs.Load()) / 1e6
+	s.MaxMs = float64(h.maxNs.Load()) / 1e6
+	s.estimate()
+	return s
+}
+
+// LatencyHistogram is a snapshot of a rule profiler histogram. Percentiles are estimated as the
+// upper bound of the bucket holding them, capped by the largest observation.
+type LatencyHistogram struct {
+	Count   uint64   `json:"count"`
+	SumMs   float64  `json:"sum_ms"`
+	AvgMs   float64  `json:"avg_ms"`
+	P50Ms   float64  `json:"p50_ms"`
+	P95Ms   float64  `json:"p95_ms"`
+	P99Ms   float64  `json:"p99_ms"`
+	MaxMs   float64  `json:"max_ms"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+// merge adds the observations of another snapshot
+func (s *LatencyHistogram) merge(o LatencyHistogram) {
+	if len(s.Buckets) < len(o.Buckets) {
+		s.Buckets = append(s.Buckets, make([]uint64, len(o.Buckets)-len(s.Buckets))...)
+	}
+	for i, n := range o.Buckets {
+		s.Buckets[i] += n
+	}
+	s.Count += o.Count
+	s.SumMs += o.SumMs
+	s.MaxMs = max(s.MaxMs, o.MaxMs)
+	s.estimate()
+}
+
+func (s *LatencyHistogram) estimate() {
+	s.AvgMs, s.P50Ms, s.P95Ms, s.P99Ms = 0, 0, 0, 0
+	if s.Count == 0 {
+		return
+	}
+	s.AvgMs = s.SumMs / float64(s.Count)
+	s.P50Ms = s.quantile(0.50)
+	s.P95Ms = s.quantile(0.95)
+	s.P99Ms = s.quantile(0.99)
+}
+
+func (s *LatencyHistogram) quantile(q float64) float64 {
+	rank := uint64(q * float64(s.Count))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range s.Buckets {
+		seen += n
+		if seen >= rank {
+			if i < len(RuleLatencyBucketsUs) {
+				return min(float64(RuleLatencyBucketsUs[i])/1000, s.MaxMs)
+			}
+			break
+		}
+	}
+	return s.MaxMs
+}
+
+// ruleProfile holds the evaluation statistics of one rule on this node
+type ruleProfile struct {
+	rulesetID string
+	ruleID    string
+	matches   atomic.Uint64
+	latency   latencyHistogram
+	plugin    latencyHistogram
+	regex     latencyHistogram
+}
+
+// RuleMetrics is the profile of one rule. Latency covers the whole evaluation of the rule, plugin
+// and regex the time spent in plugin calls and REGEX checks, which are part of the latency.
+type RuleMetrics struct {
+	NodeID      string           `json:"node_id,omitempty"`
+	RulesetID   string           `json:"ruleset"`
+	RuleID      string           `json:"rule"`
+	Evaluations uint64           `json:"evaluations"`
+	Matches     uint64           `json:"matches"`
+	Latency     LatencyHistogram `json:"latency"`
+	Plugin      LatencyHistogram `json:"plugin"`
+	Regex       LatencyHistogram `json:"regex"`
+	// TimeShare is the share of the evaluation time of all profiled rules spent in this rule
+	TimeShare float64 `json:"time_share"`
+}
+
+var ruleProfiles = struct {
+	sync.Mutex
+	m map[string]*ruleProfile // rulesetID + "\x00" + ruleID
+}{m: make(map[string]*ruleProfile)}
+
+// ruleProfileFor returns the profile of a rule, shared by every instance of its ruleset on this node
+func ruleProfileFor(rulesetID, ruleID string) *ruleProfile {
+	key := rulesetID + "\x00" + ruleID
+	ruleProfiles.Lock()
+	defer ruleProfiles.Unlock()
+	p, ok := ruleProfiles.m[key]
+	if !ok {
+		p = &ruleProfile{rulesetID: rulesetID, ruleID: ruleID, latency: newLatencyHistogram(), plugin: newLatencyHistogram(), regex: newLatencyHistogram()}
+		ruleProfiles.m[key] = p
+	}
+	return p
+}
+
+// attachRuleProfiles enables profiling of the rules of a running ruleset, test rulesets are not profiled
+func (r *Ruleset) attachRuleProfiles() {
+	if r.isTestMode || r.RulesetID == "" {
+		r.profiles = nil
+		return
+	}
+	profiles := make(map[string]*ruleProfile, len(r.Rules))
+	for i := range r.Rules {
+		profiles[r.Rules[i].ID] = ruleProfileFor(r.RulesetID, r.Rules[i].ID)
+	}
+	r.profiles = profiles
+}
+
+// profileOf returns the profile of a rule, nil when the ruleset is not profiled
+func (r *Ruleset) profileOf(rule *Rule) *ruleProfile {
+	if r.profiles == nil {
+		return nil
+	}
+	return r.profiles[rule.ID]
+}
+
+// profiledCheckNode executes a check node and records the time of REGEX and PLUGIN checks
+func (r *Ruleset) profiledCheckNode(profile *ruleProfile, checkNode *CheckNodes, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) bool {
+	if profile == nil || (checkNode.Type != "REGEX" && checkNode.Type != "PLUGIN") {
+		return r.executeCheckNode(checkNode, data, ruleCache)
+	}
+	start := time.Now()
+	res := r.executeCheckNode(checkNode, data, ruleCache)
+	if checkNode.Type == "REGEX" {
+		profile.regex.observe(time.Since(start))
+	} else {
+		profile.plugin.observe(time.Since(start))
+	}
+	return res
+}
+
+// GetRuleMetrics returns the profiles of the rules evaluated on this node
+func GetRuleMetrics() []RuleMetrics {
+	ruleProfiles.Lock()
+	profiles := make([]*ruleProfile, 0, len(ruleProfiles.m))
+	for _, p := range ruleProfiles.m {
+		profiles = append(profiles, p)
+	}
+	ruleProfiles.Unlock()
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].rulesetID == profiles[j].rulesetID {
+			return profiles[i].ruleID < profiles[j].ruleID
+		}
+		return profiles[i].rulesetID < profiles[j].rulesetID
+	})
+
+	result := make([]RuleMetrics, 0, len(profiles))
+	for _, p := range profiles {
+		latency := p.latency.snapshot()
+		if latency.Count == 0 {
+			continue
+		}
+		result = append(result, RuleMetrics{
+			RulesetID:   p.rulesetID,
+			RuleID:      p.ruleID,
+			Evaluations: latency.Count,
+			Matches:     p.matches.Load(),
+			Latency:     latency,
+			Plugin:      p.plugin.snapshot(),
+			Regex:       p.regex.snapshot(),
+		})
+	}
+	setTimeShares(result)
+	return result
+}
+
+// MergeRuleMetrics sums the profiles of the same rule reported by several nodes
+func MergeRuleMetrics(metrics []RuleMetrics) []RuleMetrics {
+	merged := make(map[string]*RuleMetrics)
+	keys := make([]string, 0)
+	for _, m := range metrics {
+		key := m.RulesetID + "\x00" + m.RuleID
+		total, ok := merged[key]
+		if !ok {
+			total = &RuleMetrics{RulesetID: m.RulesetID, RuleID: m.RuleID}
+			merged[key] = total
+			keys = append(keys, key)
+		}
+		total.Evaluations += m.Evaluations
+		total.Matches += m.Matches
+		total.Latency.merge(m.Latency)
+		total.Plugin.merge(m.Plugin)
+		total.Regex.merge(m.Regex)
+	}
+	sort.Strings(keys)
+	result := make([]RuleMetrics, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *merged[key])
+	}
+	setTimeShares(result)
+	return result
+}
+
+func setTimeShares(metrics []RuleMetrics) {
+	var total float64
+	for _, m := range metrics {
+		total += m.Latency.SumMs
+	}
+	for i := range metrics {
+		metrics[i].TimeShare = 0
+		if total > 0 {
+			metrics[i].TimeShare = metrics[i].Latency.SumMs / total
+		}
+	}
+}
+
+var ruleProfiler struct {
+	nodeID   string
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// StartRuleProfiler periodically publishes the rule profiles of this node to Redis
+func StartRuleProfiler(nodeID string) {
+	if ruleProfiler.stopChan != nil {
+		return
+	}
+	ruleProfiler.nodeID = nodeID
+	ruleProfiler.stopChan = make(chan struct{})
+	ruleProfiler.wg.Add(1)
+	go func(stop chan struct{}) {
+		defer ruleProfiler.wg.Done()
+		ticker := time.NewTicker(ruleMetricsPublishPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				publishRuleMetrics()
+			}
+		}
+	}(ruleProfiler.stopChan)
+}
+
+// StopRuleProfiler stops publishing rule profiles
+func StopRuleProfiler() {
+	if ruleProfiler.stopChan == nil {
+		return
+	}
+	close(ruleProfiler.stopChan)
+	ruleProfiler.wg.Wait()
+	ruleProfiler.stopChan = nil
+}
+
+func publishRuleMetrics() {
+	metrics := GetRuleMetrics()
+	if len(metrics) == 0 {
+		return
+	}
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return
+	}
+	if err := common.RedisHSet(ruleMetricsRedisKey, ruleProfiler.nodeID, string(data)); err != nil {
+		logger.Debug("Failed to publish rule metrics to Redis", "error", err)
+	}
+}
+
+// GetClusterRuleMetrics returns the rule profiles published by all nodes, with the current
+// profiles of this node
+func GetClusterRuleMetrics() ([]RuleMetrics, error) {
+	all, err := common.RedisHGetAll(ruleMetricsRedisKey)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RuleMetrics, 0)
+	for nodeID, raw := range all {
+		if nodeID == ruleProfiler.nodeID {
+			continue
+		}
+		var metrics []RuleMetrics
+		if err := json.Unmarshal([]byte(raw), &metrics); err != nil {
+			continue
+		}
+		for i := range metrics {
+			metrics[i].NodeID = nodeID
+		}
+		result = append(result, metrics...)
+	}
+	for _, m := range GetRuleMetrics() {
+		m.NodeID = ruleProfiler.nodeID
+		result = append(result, m)
+	}
+	return result, nil
+}
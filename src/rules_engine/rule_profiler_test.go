@@ -0,0 +1,85 @@
+package rules_engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRuleProfiler_Histogram(t *testing.T) {
+	h := newLatencyHistogram()
+	for i := 0; i < 90; i++ {
+		h.observe(30 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(2 * time.Millisecond)
+	}
+	s := h.snapshot()
+	if s.Count != 100 || s.Buckets[1] != 90 || s.Buckets[5] != 10 {
+		t.Fatalf("unexpected buckets %+v", s)
+	}
+	if s.P50Ms != 0.05 || s.P95Ms != 2 || s.MaxMs != 2 {
+		t.Fatalf("unexpected percentiles %+v", s)
+	}
+
+	// Merged histograms of several nodes
+	other := newLatencyHistogram()
+	other.observe(time.Second)
+	merged := MergeRuleMetrics([]RuleMetrics{
+		{NodeID: "a", RulesetID: "rs", RuleID: "r1", Evaluations: 100, Latency: s},
+		{NodeID: "b", RulesetID: "rs", RuleID: "r1", Evaluations: 1, Latency: other.snapshot()},
+		{NodeID: "b", RulesetID: "rs", RuleID: "r2", Evaluations: 1, Latency: other.snapshot()},
+	})
+	if len(merged) != 2 || merged[0].Evaluations != 101 || merged[0].Latency.Count != 101 {
+		t.Fatalf("unexpected merge %+v", merged)
+	}
+	if merged[0].Latency.MaxMs != 1000 || merged[0].Latency.P99Ms != 5 {
+		t.Fatalf("unexpected merged latency %+v", merged[0].Latency)
+	}
+	if share := merged[0].TimeShare + merged[1].TimeShare; share < 0.999 || share > 1.001 {
+		t.Fatalf("time shares must add up to 1, got %v", share)
+	}
+}
+
+func TestRuleProfiler_Ruleset(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="profile">
+  <rule id="r1" name="r1">
+    <check type="REGEX" field="cmd">curl.*\|\s*(ba)?sh</check>
+  </rule>
+  <rule id="r2" name="r2">
+    <check type="EQU" field="user">root</check>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+	rs.RulesetID = "PROFILER.RS"
+	rs.attachRuleProfiles()
+
+	rs.EngineCheck(map[string]interface{}{"cmd": "curl x | bash", "user": "bob"})
+	rs.EngineCheck(map[string]interface{}{"cmd": "ls", "user": "root"})
+	rs.EngineCheck(map[string]interface{}{"cmd": "ls", "user": "bob"})
+
+	got := map[string]RuleMetrics{}
+	for _, m := range GetRuleMetrics() {
+		if m.RulesetID == "PROFILER.RS" {
+			got[m.RuleID] = m
+		}
+	}
+	if got["r1"].Evaluations != 3 || got["r1"].Matches != 1 || got["r1"].Regex.Count != 3 {
+		t.Fatalf("unexpected r1 profile %+v", got["r1"])
+	}
+	if got["r2"].Evaluations != 3 || got["r2"].Matches != 1 || got["r2"].Regex.Count != 0 {
+		t.Fatalf("unexpected r2 profile %+v", got["r2"])
+	}
+
+	// Test rulesets are not profiled
+	test := buildRulesetFromXML(t, xml)
+	test.RulesetID = "PROFILER.TEST"
+	test.isTestMode = true
+	test.attachRuleProfiles()
+	test.EngineCheck(map[string]interface{}{"cmd": "ls"})
+	for _, m := range GetRuleMetrics() {
+		if m.RulesetID == "PROFILER.TEST" {
+			t.Fatalf("test ruleset was profiled: %+v", m)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RuleTest is a test case embedded in a rule:
+//
+//	<test name="root login"><input>{"user":"root"}</input><expect match="true"/></test>
+type RuleTest struct {
+	Name        string
+	Input       string // JSON object, validated when the ruleset is parsed
+	ExpectMatch bool
+	Line        int
+}
+
+func parseRuleTest(element xml.StartElement, decoder *XMLDecoder, elementLine int, index int) (RuleTest, error) {
+	test := RuleTest{Name: "test " + strconv.Itoa(index), Line: elementLine}
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "name":
+			if name := strings.TrimSpace(attr.Value); name != "" {
+				test.Name = name
+			}
+		default:
+			return test, fmt.Errorf("unsupported attribute '%s' in test at line %d, only name is allowed", attr.Name.Local, elementLine)
+		}
+	}
+
+	var child string
+	var content strings.Builder
+	hasInput, hasExpect := false, false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return test, fmt.Errorf("error parsing test at line %d: %v", elementLine, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if child != "" {
+				return test, fmt.Errorf("test %s cannot contain element '<%s>' at line %d", child, t.Name.Local, elementLine)
+			}
+			switch t.Name.Local {
+			case "input":
+				if hasInput {
+					return test, fmt.Errorf("test '%s' has more than one input at line %d", test.Name, elementLine)
+				}
+				hasInput = true
+			case "expect":
+				if hasExpect {
+					return test, fmt.Errorf("test '%s' has more than one expect at line %d", test.Name, elementLine)
+				}
+				hasExpect = true
+				match := ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local != "match" {
+						return test, fmt.Errorf("unsupported attribute '%s' in expect at line %d, only match is allowed", attr.Name.Local, elementLine)
+					}
+					match = attr.Value
+				}
+				expectMatch, err := strconv.ParseBool(strings.TrimSpace(match))
+				if err != nil {
+					return test, fmt.Errorf("expect match must be 'true' or 'false', got '%s' at line %d", match, elementLine)
+				}
+				test.ExpectMatch = expectMatch
+			default:
+				return test, fmt.Errorf("unsupported element '<%s>' in test at line %d, only input and expect are allowed", t.Name.Local, elementLine)
+			}
+			child = t.Name.Local
+			content.Reset()
+		case xml.CharData:
+			if child != "" {
+				content.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "test" {
+				if !hasInput || !hasExpect {
+					return test, fmt.Errorf("test '%s' needs an input and an expect at line %d", test.Name, elementLine)
+				}
+				return test, nil
+			}
+			if child == "input" {
+				test.Input = strings.TrimSpace(content.String())
+				var event map[string]interface{}
+				if err := json.Unmarshal([]byte(test.Input), &event); err != nil {
+					return test, fmt.Errorf("test '%s' input must be a JSON object at line %d: %v", test.Name, elementLine, err)
+				}
+			}
+			child = ""
+		}
+	}
+}
+
+// RuleTestResult is the outcome of one embedded test
+type RuleTestResult struct {
+	Rule     string `json:"rule"`
+	Test     string `json:"test"`
+	Line     int    `json:"line"`
+	Expected bool   `json:"expected_match"`
+	Matched  bool   `json:"matched"`
+	Passed   bool   `json:"passed"`
+}
+
+// RuleTestReport is the outcome of the embedded tests of a ruleset. A rule is covered when it has
+// at least one test.
+type RuleTestReport struct {
+	Passed       int              `json:"passed"`
+	Failed       int              `json:"failed"`
+	Rules        int              `json:"rules"`
+	RulesCovered int              `json:"rules_covered"`
+	Coverage     float64          `json:"coverage"`
+	Untested     []string         `json:"untested_rules"`
+	Results      []RuleTestResult `json:"results"`
+}
+
+// RunRuleTests runs the embedded tests of a ruleset. Each test evaluates its own rule alone on its
+// input, so other rules of the ruleset do not affect the result. Rules run as in production, so
+// plugins with side effects are called and thresholds count across the tests of a run.
+func RunRuleTests(raw string) (*RuleTestReport, error) {
+	ruleset, err := ParseRuleset([]byte(raw))
+	if err != nil {
+		return nil, err
+	}
+	ruleset.RulesetID = "TEST.RULE_TESTS"
+	ruleset.isTestMode = true
+	defer ruleset.cleanup()
+	if err := RulesetBuild(ruleset); err != nil {
+		return nil, err
+	}
+
+	report := &RuleTestReport{Rules: len(ruleset.Rules), Untested: []string{}, Results: []RuleTestResult{}}
+	for i := range ruleset.Rules {
+		rule := &ruleset.Rules[i]
+		if len(rule.Tests) == 0 {
+			report.Untested = append(report.Untested, rule.ID)
+			continue
+		}
+		report.RulesCovered++
+		for _, test := range rule.Tests {
+			var event map[string]interface{}
+			_ = json.Unmarshal([]byte(test.Input), &event)
+			matched, _, _ := ruleset.executeRuleOperations(rule, event, make(map[string]common.CheckCoreCache), nil)
+			res := RuleTestResult{Rule: rule.ID, Test: test.Name, Line: test.Line, Expected: test.ExpectMatch, Matched: matched, Passed: matched == test.ExpectMatch}
+			if res.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+			report.Results = append(report.Results, res)
+		}
+	}
+	if report.Rules > 0 {
+		report.Coverage = float64(report.RulesCovered) / float64(report.Rules)
+	}
+	return report, nil
+}
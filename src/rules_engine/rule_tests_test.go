@@ -0,0 +1,67 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleTests_Run(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="rule_tests">
+  <rule id="ssh" name="external ssh">
+    <check type="EQU" field="port">22</check>
+    <check type="NSTART" field="src_ip">10.</check>
+    <test name="external">
+      <input>{"port": 22, "src_ip": "1.2.3.4"}</input>
+      <expect match="true"/>
+    </test>
+    <test name="internal">
+      <input><![CDATA[{"port": 22, "src_ip": "10.0.0.1", "note": "<internal>"}]]></input>
+      <expect match="false"/>
+    </test>
+    <test>
+      <input>{"port": 80, "src_ip": "1.2.3.4"}</input>
+      <expect match="true"/>
+    </test>
+  </rule>
+  <rule id="root_login" name="root login">
+    <check type="EQU" field="user">root</check>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+	if len(rs.Rules[0].Tests) != 3 || rs.Rules[0].Tests[2].Name != "test 3" {
+		t.Fatalf("unexpected tests %+v", rs.Rules[0].Tests)
+	}
+	// Tests never change what the rule matches
+	if res := rs.EngineCheck(map[string]interface{}{"port": "22", "src_ip": "1.2.3.4"}); len(res) != 1 {
+		t.Fatalf("unexpected results %v", res)
+	}
+
+	report, err := RunRuleTests(xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed != 2 || report.Failed != 1 || report.RulesCovered != 1 || report.Coverage != 0.5 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if failed := report.Results[2]; failed.Passed || failed.Test != "test 3" || failed.Line != 14 || failed.Matched {
+		t.Fatalf("unexpected failed result %+v", failed)
+	}
+	if len(report.Untested) != 1 || report.Untested[0] != "root_login" {
+		t.Fatalf("unexpected untested rules %v", report.Untested)
+	}
+
+	for _, tt := range []struct {
+		test, err string
+	}{
+		{`<test><input>not json</input><expect match="true"/></test>`, "input must be a JSON object"},
+		{`<test><input>{}</input></test>`, "needs an input and an expect"},
+		{`<test><input>{}</input><expect match="maybe"/></test>`, "expect match must be 'true' or 'false'"},
+		{`<test><input>{}</input><expect match="true"/><output/></test>`, "only input and expect are allowed"},
+	} {
+		_, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r"><check type="EQU" field="a">b</check>` + tt.test + `</rule></root>`))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// maxIncludeDepth bounds the chain of rulesets pulled in through includes and extends
+const maxIncludeDepth = 16
+
+// xmlSpan is a byte range of a ruleset document
+type xmlSpan struct {
+	start, end int
+}
+
+type rulesetInclude struct {
+	ref    string
+	rule   string
+	span   xmlSpan
+	line   int
+	inRule bool
+}
+
+type rulesetRuleSpan struct {
+	id           string
+	outer, inner xmlSpan
+}
+
+// rulesetLayout locates the parts of a ruleset document that includes and extends refer to
+type rulesetLayout struct {
+	root        xml.StartElement
+	rootTag     xmlSpan
+	inner       xmlSpan
+	extends     string
+	extendsLine int
+	rules       []rulesetRuleSpan
+	includes    []rulesetInclude
+}
+
+func (l *rulesetLayout) rootAttr(name string) string {
+	return xmlAttr(l.root.Attr, name)
+}
+
+func (l *rulesetLayout) rule(id string) (rulesetRuleSpan, bool) {
+	for _, r := range l.rules {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return rulesetRuleSpan{}, false
+}
+
+func lineAt(raw []byte, offset int) int {
+	return 1 + bytes.Count(raw[:offset], []byte("\n"))
+}
+
+// scanRuleset returns the layout of a ruleset document, or an error when it is not well formed
+func scanRuleset(raw []byte) (*rulesetLayout, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	l := &rulesetLayout{}
+	var names []string
+	var starts, inners []int
+	var attrs [][]xml.Attr
+
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth := len(names)
+			names = append(names, element.Name.Local)
+			starts = append(starts, start)
+			inners = append(inners, int(decoder.InputOffset()))
+			attrs = append(attrs, slices.Clone(element.Attr))
+			if depth == 0 && element.Name.Local == "root" {
+				l.root = element.Copy()
+				l.rootTag = xmlSpan{start, int(decoder.InputOffset())}
+				l.extends = strings.TrimSuffix(strings.TrimSpace(xmlAttr(element.Attr, "extends")), ".xml")
+				l.extendsLine = lineAt(raw, start)
+			}
+
+		case xml.EndElement:
+			i := len(names) - 1
+			if i < 0 {
+				continue
+			}
+			end := int(decoder.InputOffset())
+			switch {
+			case i == 0 && element.Name.Local == "root":
+				l.inner = xmlSpan{inners[i], start}
+			case i == 1 && element.Name.Local == "rule":
+				l.rules = append(l.rules, rulesetRuleSpan{
+					id:    xmlAttr(attrs[i], "id"),
+					outer: xmlSpan{starts[i], end},
+					inner: xmlSpan{inners[i], start},
+				})
+			case element.Name.Local == "include":
+				line := lineAt(raw, starts[i])
+				inRule := slices.Contains(names[:i], "rule")
+				if !inRule && i != 1 {
+					return nil, fmt.Errorf("element '<include>' must be placed under <root> or inside a rule at line %d", line)
+				}
+				l.includes = append(l.includes, rulesetInclude{
+					ref:    strings.TrimSuffix(strings.TrimSpace(xmlAttr(attrs[i], "ref")), ".xml"),
+					rule:   strings.TrimSpace(xmlAttr(attrs[i], "rule")),
+					span:   xmlSpan{starts[i], end},
+					line:   line,
+					inRule: inRule,
+				})
+			}
+			names, starts, inners, attrs = names[:i], starts[:i], inners[:i], attrs[:i]
+		}
+	}
+	if l.root.Name.Local == "" {
+		return nil, fmt.Errorf("missing <root> element")
+	}
+	return l, nil
+}
+
+func xmlAttr(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// ExpandIncludes resolves the <include> elements and the extends root attribute of a ruleset, the
+// referenced rulesets are looked up by ID. A ruleset without either is returned unchanged.
+//
+// <include ref="common"/> under <root> inserts the rules, masks and other root elements of common,
+// <include ref="common" rule="r"/> only its rule r. Inside a rule, the include inserts the content
+// of rule r, so shared checks and checklists can be kept as a rule of a library ruleset.
+// extends="base" adds the rules of base that the ruleset does not redefine, after its own rules,
+// and the root attributes it does not set.
+func ExpandIncludes(raw []byte) ([]byte, error) {
+	if !bytes.Contains(raw, []byte("<include")) && !bytes.Contains(raw, []byte("extends")) {
+		return raw, nil
+	}
+	layout, err := scanRuleset(raw)
+	if err != nil {
+		if strings.Contains(err.Error(), "<include>") {
+			return nil, err
+		}
+		// Not well formed, the parser reports it
+		return raw, nil
+	}
+	return expandRuleset(raw, layout, nil)
+}
+
+func expandRuleset(raw []byte, l *rulesetLayout, stack []string) ([]byte, error) {
+	if len(l.includes) == 0 && l.extends == "" {
+		return raw, nil
+	}
+
+	out := raw
+	// Last include first, so the offsets of the previous ones stay valid
+	for i := len(l.includes) - 1; i >= 0; i-- {
+		inc := l.includes[i]
+		text, err := includeText(inc, l, stack)
+		if err != nil {
+			return nil, fmt.Errorf("include '%s' at line %d: %w", inc.ref, inc.line, err)
+		}
+		out = slices.Concat(out[:inc.span.start], text, out[inc.span.end:])
+	}
+	if l.extends == "" {
+		return out, nil
+	}
+
+	own, err := scanRuleset(out)
+	if err != nil {
+		return nil, err
+	}
+	base, baseRaw, err := resolveInclude(l.extends, stack)
+	if err != nil {
+		return nil, fmt.Errorf("extends '%s' at line %d: %w", l.extends, l.extendsLine, err)
+	}
+	if t := own.rootAttr("type"); t != "" && base.rootAttr("type") != "" && t != base.rootAttr("type") {
+		return nil, fmt.Errorf("extends '%s' at line %d: cannot extend a %s ruleset from a %s ruleset", l.extends, l.extendsLine, base.rootAttr("type"), t)
+	}
+
+	var b bytes.Buffer
+	b.Write(out[:own.rootTag.start])
+	writeRootTag(&b, own.root, base.root)
+	b.Write(out[own.rootTag.end:own.inner.end])
+	// Inherited content goes after the ruleset's own, so the lines of its own content do not move
+	pos := base.inner.start
+	for _, r := range base.rules {
+		if _, redefined := own.rule(r.id); redefined {
+			b.Write(baseRaw[pos:r.outer.start])
+			pos = r.outer.end
+		}
+	}
+	b.Write(baseRaw[pos:base.inner.end])
+	b.Write(out[own.inner.end:])
+	return b.Bytes(), nil
+}
+
+// includeText returns the text that replaces an include element
+func includeText(inc rulesetInclude, l *rulesetLayout, stack []string) ([]byte, error) {
+	if inc.ref == "" {
+		return nil, fmt.Errorf("ref cannot be empty")
+	}
+	included, includedRaw, err := resolveInclude(inc.ref, stack)
+	if err != nil {
+		return nil, err
+	}
+	if !inc.inRule {
+		if t := l.rootAttr("type"); t != "" && included.rootAttr("type") != "" && t != included.rootAttr("type") {
+			return nil, fmt.Errorf("cannot include a %s ruleset in a %s ruleset", included.rootAttr("type"), t)
+		}
+	}
+	if inc.rule == "" {
+		if inc.inRule {
+			return nil, fmt.Errorf("an include inside a rule needs the rule to insert")
+		}
+		return includedRaw[included.inner.start:included.inner.end], nil
+	}
+	rule, ok := included.rule(inc.rule)
+	if !ok {
+		return nil, fmt.Errorf("rule '%s' not found", inc.rule)
+	}
+	if inc.inRule {
+		return includedRaw[rule.inner.start:rule.inner.end], nil
+	}
+	return includedRaw[rule.outer.start:rule.outer.end], nil
+}
+
+// resolveInclude returns the expanded content of a referenced ruleset
+func resolveInclude(ref string, stack []string) (*rulesetLayout, []byte, error) {
+	if slices.Contains(stack, ref) {
+		return nil, nil, fmt.Errorf("include cycle %s", strings.Join(append(slices.Clone(stack), ref), " -> "))
+	}
+	if len(stack) >= maxIncludeDepth {
+		return nil, nil, fmt.Errorf("includes are nested deeper than %d rulesets", maxIncludeDepth)
+	}
+	content, ok := common.GetRawConfig("ruleset", ref)
+	if !ok {
+		return nil, nil, fmt.Errorf("ruleset not found")
+	}
+	stack = append(slices.Clone(stack), ref)
+	raw := []byte(content)
+	l, err := scanRuleset(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ruleset '%s' is not valid: %w", ref, err)
+	}
+	expanded, err := expandRuleset(raw, l, stack)
+	if err != nil {
+		return nil, nil, fmt.Errorf("in ruleset '%s': %w", ref, err)
+	}
+	if len(l.includes) == 0 && l.extends == "" {
+		return l, raw, nil
+	}
+	l, err = scanRuleset(expanded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ruleset '%s' is not valid after expansion: %w", ref, err)
+	}
+	return l, expanded, nil
+}
+
+// writeRootTag writes the root start tag of an extending ruleset, its own attributes followed by
+// the attributes of the base it does not set
+func writeRootTag(b *bytes.Buffer, own, base xml.StartElement) {
+	b.WriteString("<root")
+	seen := map[string]bool{"extends": true}
+	write := func(attrs []xml.Attr) {
+		for _, attr := range attrs {
+			if seen[attr.Name.Local] {
+				continue
+			}
+			seen[attr.Name.Local] = true
+			b.WriteString(" " + attr.Name.Local + `="`)
+			xml.EscapeText(b, []byte(attr.Value))
+			b.WriteString(`"`)
+		}
+	}
+	write(own.Attr)
+	write(base.Attr)
+	b.WriteString(">")
+}
@@ -0,0 +1,135 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func setIncludeRuleset(t *testing.T, id, raw string) {
+	t.Helper()
+	common.SetRawConfig("ruleset", id, raw)
+	t.Cleanup(func() { common.DeleteRawConfig("ruleset", id) })
+}
+
+func TestRulesetInclude(t *testing.T) {
+	setIncludeRuleset(t, "include_common", `
+<root type="DETECTION" name="common">
+  <mask field="password"/>
+  <rule id="external" name="external source">
+    <checklist condition="not a">
+      <check id="a" type="START" field="src_ip">10.</check>
+    </checklist>
+  </rule>
+  <rule id="root_login" name="root login">
+    <check type="EQU" field="user">root</check>
+  </rule>
+</root>`)
+
+	xml := `
+<root type="DETECTION" name="include">
+  <include ref="include_common.xml" rule="root_login"/>
+  <rule id="ssh" name="external ssh">
+    <check type="EQU" field="port">22</check>
+    <include ref="include_common" rule="external"/>
+  </rule>
+</root>`
+	rs := buildRulesetFromXML(t, xml)
+	if len(rs.Rules) != 2 || rs.Rules[0].ID != "root_login" || len(rs.Masks) != 0 {
+		t.Fatalf("unexpected expansion %+v", rs.Rules)
+	}
+
+	hits := func(event map[string]interface{}) string {
+		var ids []string
+		for _, res := range rs.EngineCheck(event) {
+			ids = append(ids, fmt.Sprint(res[HitRuleIdFieldName]))
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := hits(map[string]interface{}{"port": "22", "src_ip": "1.2.3.4", "user": "root"}); got != "TEST.RS.root_login,TEST.RS.ssh" {
+		t.Fatalf("unexpected hits %q", got)
+	}
+	if got := hits(map[string]interface{}{"port": "22", "src_ip": "10.0.0.1"}); got != "" {
+		t.Fatalf("unexpected hits %q", got)
+	}
+
+	// Including the whole ruleset brings its root elements
+	rs = buildRulesetFromXML(t, `<root type="DETECTION"><include ref="include_common"/></root>`)
+	if len(rs.Rules) != 2 || len(rs.Masks) != 1 {
+		t.Fatalf("unexpected expansion: %d rules, %d masks", len(rs.Rules), len(rs.Masks))
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<root type="DETECTION"><include ref="missing"/></root>`, "include 'missing' at line 1: ruleset not found"},
+		{`<root type="DETECTION"><include ref="include_common" rule="nope"/></root>`, "rule 'nope' not found"},
+		{`<root type="EXCLUDE"><include ref="include_common"/></root>`, "cannot include a DETECTION ruleset in a EXCLUDE ruleset"},
+		{`<root type="DETECTION"><rule id="r"><include ref="include_common"/></rule></root>`, "needs the rule to insert"},
+		{`<root type="DETECTION"><rule id="r"><check type="EQU" field="a">b</check></rule><x><include ref="include_common"/></x></root>`, "must be placed under <root> or inside a rule"},
+	} {
+		if _, err := ParseRuleset([]byte(tt.xml)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestRulesetExtends(t *testing.T) {
+	setIncludeRuleset(t, "extends_base", `
+<root type="DETECTION" name="base" explain="true">
+  <rule id="a" name="base a">
+    <check type="EQU" field="x">1</check>
+  </rule>
+  <rule id="b" name="base b">
+    <check type="EQU" field="x">2</check>
+  </rule>
+</root>`)
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION" name="child" extends="extends_base">
+  <rule id="b" name="child b">
+    <check type="EQU" field="x">3</check>
+  </rule>
+  <rule id="c" name="child c">
+    <check type="EQU" field="x">4</check>
+  </rule>
+</root>`)
+	var names []string
+	for _, rule := range rs.Rules {
+		names = append(names, rule.Name)
+	}
+	if strings.Join(names, ",") != "child b,child c,base a" {
+		t.Fatalf("unexpected rules %v", names)
+	}
+	if rs.Name != "child" || !rs.Explain {
+		t.Fatalf("root attributes not inherited: name %q explain %v", rs.Name, rs.Explain)
+	}
+
+	// Validation reports the expansion and keeps the lines of the ruleset's own content
+	result, err := ValidateWithDetails("", `<root type="DETECTION" extends="extends_base">
+  <rule id="c">
+    <check type="EQU" field="x">4</check>
+    <check type="BOGUS" field="x">4</check>
+  </rule>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsValid || !strings.Contains(result.Expanded, `<rule id="a" name="base a">`) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Errors[0].Line != 4 {
+		t.Fatalf("expected the error on line 4, got %+v", result.Errors)
+	}
+}
+
+func TestRulesetInclude_Cycle(t *testing.T) {
+	setIncludeRuleset(t, "cycle_a", `<root type="DETECTION"><include ref="cycle_b"/></root>`)
+	setIncludeRuleset(t, "cycle_b", `<root type="DETECTION" extends="cycle_a"></root>`)
+
+	_, err := ParseRuleset([]byte(`<root type="DETECTION"><include ref="cycle_a"/></root>`))
+	if err == nil || !strings.Contains(err.Error(), "include cycle cycle_a -> cycle_b -> cycle_a") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
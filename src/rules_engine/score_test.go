@@ -0,0 +1,102 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScore_Parse(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION"><rule id="r1">
+		<check type="SCORE_GT" field="user.name" entity="user">50</check>
+		<score entity="user" field="user.name" weight="20"/>
+		<score field="source_ip" weight="-5.5"/>
+	</rule></root>`)
+	rule := &rs.Rules[0]
+	var entities []string
+	for _, op := range *rule.Queue {
+		if op.Type == T_Score {
+			entities = append(entities, rule.ScoreMap[op.ID].Entity)
+		}
+	}
+	if strings.Join(entities, ",") != "user,source_ip" {
+		t.Fatalf("unexpected entities %v", entities)
+	}
+	for _, node := range rule.CheckMap {
+		if node.Entity != "user" || node.RiskScore != 50 {
+			t.Fatalf("unexpected check %+v", node)
+		}
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<score weight="1"/>`, "score field cannot be empty"},
+		{`<score field="ip" weight="0"/>`, "score weight must be a non-zero number"},
+		{`<score field="ip" weight="1" value="2"/>`, "only entity, field and weight are allowed"},
+		{`<score entity="a:b" field="ip" weight="1"/>`, "cannot contain ':'"},
+	} {
+		_, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<check type="SCORE_GT" field="ip">high</check>`, "SCORE_GT value must be a number"},
+		{`<check type="EQU" field="ip" entity="host">x</check>`, "entity is only supported by SCORE_GT checks"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestScore_Execute(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="failed_login">
+    <check type="EQU" field="action">login_failed</check>
+    <score entity="user" field="user" weight="30"/>
+  </rule>
+  <rule id="risky_user">
+    <check type="SCORE_GT" field="user">50</check>
+  </rule>
+</root>`)
+	hits := func(action, user string) []string {
+		var ids []string
+		for _, res := range rs.EngineCheck(map[string]interface{}{"action": action, "user": user}) {
+			ids = append(ids, res[HitRuleIdFieldName].(string))
+		}
+		return ids
+	}
+
+	// 30 does not exceed 50, 60 does once the second failure is scored
+	if ids := hits("login_failed", "alice"); len(ids) != 1 {
+		t.Fatalf("unexpected hits %v", ids)
+	}
+	if ids := hits("login_failed", "alice"); len(ids) != 2 || ids[1] != "TEST.RS.risky_user" {
+		t.Fatalf("expected the risky user rule to match, got %v", ids)
+	}
+	hits("login_failed", "bob")
+
+	if score, err := common.RiskScore("user", "alice"); err != nil || score < 59.9 || score > 60 {
+		t.Fatalf("unexpected score %g, %v", score, err)
+	}
+	top, err := common.RiskTop("user", 10)
+	if err != nil || len(top) != 2 || top[0].ID != "alice" || top[1].ID != "bob" {
+		t.Fatalf("unexpected top entities %+v, %v", top, err)
+	}
+	if top, err := common.RiskTop("user", 1); err != nil || len(top) != 1 || top[0].ID != "alice" {
+		t.Fatalf("unexpected top entity %+v, %v", top, err)
+	}
+}
@@ -0,0 +1,53 @@
+package rules_engine
+
+import "testing"
+
+func TestSequence_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<sequence group_by="ip" range="10m" time_field="ts">
+			<step id="fail" count="3"><check type="EQU" field="action">fail</check></step>
+			<step><check type="EQU" field="action">ok</check><any><check type="EQU" field="user">root</check></any></step>
+		</sequence>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	for _, sequence := range rs.Rules[0].SequenceMap {
+		if len(sequence.Steps) != 2 || sequence.Steps[0].Count != 3 || sequence.Steps[1].Count != 1 {
+			t.Fatalf("unexpected sequence %+v", sequence)
+		}
+		if len(sequence.Steps[1].Group.Children) != 2 || sequence.Steps[1].Group.Type != GroupTypeAll {
+			t.Fatalf("unexpected step %+v", sequence.Steps[1])
+		}
+	}
+
+	for _, bad := range []string{
+		`<sequence range="10m"><step><check type="EQU" field="a">1</check></step><step><check type="EQU" field="a">2</check></step></sequence>`,
+		`<sequence group_by="ip" range="10m"><step><check type="EQU" field="a">1</check></step></sequence>`,
+		`<sequence group_by="ip" range="10m"><step count="0"><check type="EQU" field="a">1</check></step><step><check type="EQU" field="a">2</check></step></sequence>`,
+		`<sequence group_by="ip" range="10m"><step><check type="EQU" field="a">1</check></step><step></step></sequence>`,
+		`<sequence group_by="ip" range="10m"><check type="EQU" field="a">1</check></sequence>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
+
+func TestSequence_Advance(t *testing.T) {
+	sequence := &Sequence{Steps: []SequenceStep{{Count: 2, Group: Group{Type: "first"}}, {Count: 1, Group: Group{Type: "second"}}}}
+	events := []string{"first", "second", "first", "first", "second"}
+	want := [][2]int{{0, 1}, {0, 1}, {1, 0}, {1, 0}, {2, 0}}
+
+	step, count := 0, 0
+	for i, event := range events {
+		step, count, _ = advanceSequence(sequence, step, count, func(group *Group) bool {
+			return group.Type == event
+		})
+		if step != want[i][0] || count != want[i][1] {
+			t.Fatalf("event %d: step=%d count=%d, want %v", i, step, count, want[i])
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session aggregate types
+const (
+	SessionCount    = "COUNT"
+	SessionSum      = "SUM"
+	SessionAvg      = "AVG"
+	SessionMin      = "MIN"
+	SessionMax      = "MAX"
+	SessionDistinct = "DISTINCT"
+	SessionValues   = "VALUES"
+	SessionFirst    = "FIRST"
+	SessionLast     = "LAST"
+)
+
+// Reasons a session closed, written to the closed_by field of the summary
+const (
+	SessionClosedByGap         = "gap"
+	SessionClosedByMaxDuration = "max_duration"
+	SessionClosedByStop        = "stop"
+)
+
+const (
+	// DefaultSessionPrefix is prepended to the fields of the summary of a <session> element without prefix
+	DefaultSessionPrefix = "session_"
+
+	// maxOpenSessions bounds the open sessions of a ruleset, events of new groups are not
+	// sessionized once it is reached
+	maxOpenSessions = 100000
+	// sessionMaxValues bounds the values a DISTINCT or VALUES aggregate keeps per session
+	sessionMaxValues = 1000
+	// sessionSweepInterval is how often idle sessions are closed
+	sessionSweepInterval = time.Second
+)
+
+// sessionSummaryFields are the fields every summary has, aggregates cannot use their names
+var sessionSummaryFields = []string{"start", "end", "duration", "event_count", "closed_by"}
+
+// processSession checks the settings of a session and parses its fields
+func processSession(session *Session, rulesetID, ruleID string, operationID int) error {
+	gap, err := common.ParseDurationToSecondsInt(session.Gap)
+	if err != nil {
+		return errors.New("session parse gap err: " + err.Error() + ", rule id: " + ruleID)
+	}
+	if gap <= 0 {
+		return errors.New("session gap must be positive, rule id: " + ruleID)
+	}
+	session.GapInt = gap
+	session.MaxDurationInt = 0
+	if session.MaxDuration != "" {
+		maxDuration, err := common.ParseDurationToSecondsInt(session.MaxDuration)
+		if err != nil {
+			return errors.New("session parse max_duration err: " + err.Error() + ", rule id: " + ruleID)
+		}
+		if maxDuration < gap {
+			return errors.New("session max_duration cannot be shorter than gap, rule id: " + ruleID)
+		}
+		session.MaxDurationInt = maxDuration
+	}
+	if session.Prefix == "" {
+		session.Prefix = DefaultSessionPrefix
+	}
+
+	session.GroupByFields, session.GroupByList = nil, nil
+	for _, field := range strings.Split(session.GroupBy, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			session.GroupByFields = append(session.GroupByFields, field)
+			session.GroupByList = append(session.GroupByList, common.StringToList(field))
+		}
+	}
+	if len(session.GroupByFields) == 0 {
+		return errors.New("session group_by cannot be empty, rule id: " + ruleID)
+	}
+	session.TimeFieldList = nil
+	if field := strings.TrimSpace(session.TimeField); field != "" {
+		session.TimeFieldList = common.StringToList(field)
+	}
+
+	names := make(map[string]bool, len(sessionSummaryFields)+len(session.Aggregates))
+	for _, name := range sessionSummaryFields {
+		names[name] = true
+	}
+	for i := range session.Aggregates {
+		aggregate := &session.Aggregates[i]
+		switch aggregate.Type {
+		case SessionCount, SessionSum, SessionAvg, SessionMin, SessionMax, SessionDistinct, SessionValues, SessionFirst, SessionLast:
+		default:
+			return errors.New("session aggregate type must be COUNT, SUM, AVG, MIN, MAX, DISTINCT, VALUES, FIRST or LAST, got '" + aggregate.Type + "', rule id: " + ruleID)
+		}
+		if aggregate.Field == "" {
+			return errors.New("session aggregate field cannot be empty, rule id: " + ruleID)
+		}
+		aggregate.FieldList = common.StringToList(aggregate.Field)
+		if aggregate.Name == "" {
+			aggregate.Name = strings.ToLower(aggregate.Type) + "_" + strings.ReplaceAll(aggregate.Field, ".", "_")
+		}
+		if names[aggregate.Name] {
+			return errors.New("session aggregate name '" + aggregate.Name + "' is used twice, rule id: " + ruleID)
+		}
+		names[aggregate.Name] = true
+	}
+
+	// Several sessions of a rule keep separate groups
+	session.GroupByID = rulesetID + ruleID + "_" + strconv.Itoa(operationID)
+	return nil
+}
+
+// sessionState is an open session
+type sessionState struct {
+	rule        *Rule
+	opIndex     int // index of the <session> in the queue of rule
+	operationID int
+	groupBy     []interface{} // values of the group_by fields of the first event
+	start       time.Time     // event time of the first event
+	end         time.Time     // latest event time
+	opened      time.Time     // processing time of the first event
+	seen        time.Time     // processing time of the last event
+	events      int
+	aggregates  []sessionAggregateState
+}
+
+type sessionAggregateState struct {
+	count       int
+	sum         float64
+	min, max    float64
+	first, last interface{}
+	seen        map[string]struct{}
+	values      []interface{}
+}
+
+// add updates the aggregate with the value of an event
+func (a *sessionAggregateState) add(aggregateType string, value interface{}) {
+	a.count++
+	switch aggregateType {
+	case SessionSum, SessionAvg, SessionMin, SessionMax:
+		f, ok := exprNumber(value)
+		if !ok {
+			a.count--
+			return
+		}
+		if a.count == 1 || f < a.min {
+			a.min = f
+		}
+		if a.count == 1 || f > a.max {
+			a.max = f
+		}
+		a.sum += f
+	case SessionDistinct, SessionValues:
+		if len(a.seen) >= sessionMaxValues {
+			return
+		}
+		s := exprString(value)
+		if _, ok := a.seen[s]; ok {
+			return
+		}
+		if a.seen == nil {
+			a.seen = make(map[string]struct{})
+		}
+		a.seen[s] = struct{}{}
+		a.values = append(a.values, s)
+	case SessionFirst:
+		if a.count == 1 {
+			a.first = value
+		}
+	case SessionLast:
+		a.last = value
+	}
+}
+
+// value returns the summary value of the aggregate, false when no event had a usable value
+func (a *sessionAggregateState) value(aggregateType string) (interface{}, bool) {
+	if a.count == 0 {
+		if aggregateType == SessionCount || aggregateType == SessionDistinct {
+			return 0, true
+		}
+		return nil, false
+	}
+	switch aggregateType {
+	case SessionSum:
+		return a.sum, true
+	case SessionAvg:
+		return a.sum / float64(a.count), true
+	case SessionMin:
+		return a.min, true
+	case SessionMax:
+		return a.max, true
+	case SessionDistinct:
+		return len(a.values), true
+	case SessionValues:
+		return a.values, true
+	case SessionFirst:
+		return a.first, true
+	case SessionLast:
+		return a.last, true
+	}
+	return a.count, true
+}
+
+// closeReason returns why the session closes before an event at ts is added, empty when the
+// event belongs to the session
+func (st *sessionState) closeReason(session *Session, ts time.Time) string {
+	if ts.Sub(st.end) > time.Duration(session.GapInt)*time.Second {
+		return SessionClosedByGap
+	}
+	if session.MaxDurationInt > 0 && ts.Sub(st.start) >= time.Duration(session.MaxDurationInt)*time.Second {
+		return SessionClosedByMaxDuration
+	}
+	return ""
+}
+
+// idleReason returns why the sweeper closes the session at the processing time now, empty while
+// it is open
+func (st *sessionState) idleReason(session *Session, now time.Time) string {
+	if now.Sub(st.seen) > time.Duration(session.GapInt)*time.Second {
+		return SessionClosedByGap
+	}
+	if session.MaxDurationInt > 0 && now.Sub(st.opened) >= time.Duration(session.MaxDurationInt)*time.Second {
+		return SessionClosedByMaxDuration
+	}
+	return ""
+}
+
+// summary returns the event the rule continues with once the session closed
+func (st *sessionState) summary(session *Session, reason string) map[string]interface{} {
+	summary := make(map[string]interface{}, len(session.GroupByList)+len(sessionSummaryFields)+len(session.Aggregates))
+	for i, path := range session.GroupByList {
+		if st.groupBy[i] != nil {
+			setSessionField(summary, path, st.groupBy[i])
+		}
+	}
+	summary[session.Prefix+"start"] = st.start.UTC().Format(time.RFC3339Nano)
+	summary[session.Prefix+"end"] = st.end.UTC().Format(time.RFC3339Nano)
+	summary[session.Prefix+"duration"] = st.end.Sub(st.start).Seconds()
+	summary[session.Prefix+"event_count"] = st.events
+	summary[session.Prefix+"closed_by"] = reason
+	for i := range session.Aggregates {
+		if v, ok := st.aggregates[i].value(session.Aggregates[i].Type); ok {
+			summary[session.Prefix+session.Aggregates[i].Name] = v
+		}
+	}
+	return summary
+}
+
+// setSessionField sets a group_by value at its path, creating the nested maps
+func setSessionField(data map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := data[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			data[key] = next
+		}
+		data = next
+	}
+	data[path[len(path)-1]] = value
+}
+
+// executeSession adds the event to the open session of its group. It returns the summary of the
+// session the event closed, when the event arrives more than gap after the last event of the
+// session or max_duration after its first event, and nil otherwise: the event is held by the
+// session and the rule stops.
+func (r *Ruleset) executeSession(rule *Rule, opIndex, operationID int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache) map[string]interface{} {
+	session, exists := rule.SessionMap[operationID]
+	if !exists {
+		return nil
+	}
+
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	sb.Reset()
+	sb.WriteString(session.GroupByID)
+	for i, field := range session.GroupByFields {
+		tmpData, _ := GetCheckDataFromCache(ruleCache, field, data, session.GroupByList[i])
+		sb.WriteByte(0)
+		sb.WriteString(tmpData)
+	}
+	key := sb.String()
+	stringBuilderPool.Put(sb)
+
+	ts := eventTime(session.TimeFieldList, data)
+	now := time.Now()
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[string]*sessionState)
+	}
+
+	var summary map[string]interface{}
+	st := r.sessions[key]
+	if st != nil {
+		if reason := st.closeReason(&session, ts); reason != "" {
+			summary = st.summary(&session, reason)
+			st = nil
+			delete(r.sessions, key)
+		}
+	}
+	if st == nil {
+		if len(r.sessions) >= maxOpenSessions {
+			r.sessionsDropped++
+			return summary
+		}
+		st = &sessionState{
+			rule:        rule,
+			opIndex:     opIndex,
+			operationID: operationID,
+			groupBy:     make([]interface{}, len(session.GroupByList)),
+			start:       ts,
+			end:         ts,
+			opened:      now,
+			aggregates:  make([]sessionAggregateState, len(session.Aggregates)),
+		}
+		for i, path := range session.GroupByList {
+			st.groupBy[i], _ = common.GetCheckDataWithType(data, path)
+		}
+		r.sessions[key] = st
+	}
+
+	st.events++
+	st.seen = now
+	if ts.After(st.end) {
+		st.end = ts
+	}
+	if ts.Before(st.start) {
+		st.start = ts
+	}
+	for i := range session.Aggregates {
+		aggregate := &session.Aggregates[i]
+		if v, ok := common.GetCheckDataWithType(data, aggregate.FieldList); ok && v != nil {
+			st.aggregates[i].add(aggregate.Type, v)
+		}
+	}
+	return summary
+}
+
+// closedSession is a session closed by the sweeper, with the summary the rule continues with
+type closedSession struct {
+	rule    *Rule
+	opIndex int
+	summary map[string]interface{}
+}
+
+// closeSessions closes the open sessions of the ruleset that are idle at now, or every open
+// session when all is true, and returns their summaries
+func (r *Ruleset) closeSessions(now time.Time, all bool) []closedSession {
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+	if r.sessionsDropped > 0 {
+		logger.Warn("Session limit reached, events of new groups were not sessionized", "ruleset", r.RulesetID, "limit", maxOpenSessions, "events", r.sessionsDropped)
+		r.sessionsDropped = 0
+	}
+
+	var closed []closedSession
+	for key, st := range r.sessions {
+		session := st.rule.SessionMap[st.operationID]
+		reason := SessionClosedByStop
+		if !all {
+			if reason = st.idleReason(&session, now); reason == "" {
+				continue
+			}
+		}
+		closed = append(closed, closedSession{rule: st.rule, opIndex: st.opIndex, summary: st.summary(&session, reason)})
+		delete(r.sessions, key)
+	}
+	return closed
+}
+
+// emitSessions runs the rest of the rules of closed sessions on their summaries and sends the
+// matches downstream
+func (r *Ruleset) emitSessions(closed []closedSession) {
+	if len(closed) == 0 {
+		return
+	}
+	ruleCache := ruleCachePool.Get().(map[string]common.CheckCoreCache)
+	for _, c := range closed {
+		for k := range ruleCache {
+			delete(ruleCache, k)
+		}
+		matched, _, res := r.executeRuleOperationsFrom(c.rule, c.opIndex+1, c.summary, ruleCache, nil)
+		if !matched {
+			continue
+		}
+		r.recordRuleHit(c.rule, res, ruleCache)
+		r.markRuleHit(c.rule, res, nil)
+		if r.hasOutputPolicy() {
+			r.applyOutputPolicy(res)
+		}
+		r.sendDownstream(res)
+	}
+	ruleCachePool.Put(ruleCache)
+}
+
+// hasSessions reports whether a rule of the ruleset has a <session>
+func (r *Ruleset) hasSessions() bool {
+	for i := range r.Rules {
+		if len(r.Rules[i].SessionMap) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runSessions closes idle sessions until the ruleset stops, then closes the open sessions so
+// their summaries are not lost
+func (r *Ruleset) runSessions(stop chan struct{}) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			r.emitSessions(r.closeSessions(time.Now(), true))
+			return
+		case now := <-ticker.C:
+			r.emitSessions(r.closeSessions(now, false))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sessionTestRules = `<root type="DETECTION">
+  <rule id="ip_session">
+    <check type="NOTNULL" field="src.ip"></check>
+    <session group_by="src.ip" gap="5m" max_duration="1h" time_field="ts">
+      <aggregate type="SUM" field="bytes"></aggregate>
+      <aggregate type="DISTINCT" field="port" name="ports"></aggregate>
+      <aggregate type="FIRST" field="user"></aggregate>
+    </session>
+    <check type="MT" field="session_sum_bytes">100</check>
+  </rule>
+</root>`
+
+func TestSession_GapClosesSession(t *testing.T) {
+	rs := buildRulesetFromXML(t, sessionTestRules)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(offset time.Duration, ip string, bytes, port int) map[string]interface{} {
+		return map[string]interface{}{
+			"src":   map[string]interface{}{"ip": ip},
+			"ts":    base.Add(offset).Format(time.RFC3339),
+			"bytes": bytes, "port": port, "user": "bob",
+		}
+	}
+
+	for _, e := range []map[string]interface{}{
+		event(0, "10.0.0.1", 60, 22),
+		event(time.Minute, "10.0.0.1", 50, 22),
+		event(2*time.Minute, "10.0.0.2", 500, 80),
+		event(4*time.Minute, "10.0.0.1", 10, 443),
+	} {
+		if res := rs.EngineCheck(e); len(res) != 0 {
+			t.Fatalf("unexpected result while the session is open: %v", res)
+		}
+	}
+
+	// An event more than gap after the last one closes the session and starts a new one
+	res := rs.EngineCheck(event(10*time.Minute, "10.0.0.1", 1, 22))
+	if len(res) != 1 {
+		t.Fatalf("expected the summary of the session, got %v", res)
+	}
+	summary := res[0]
+	if summary["src"].(map[string]interface{})["ip"] != "10.0.0.1" {
+		t.Fatalf("unexpected group_by fields %v", summary)
+	}
+	for field, want := range map[string]interface{}{
+		"session_event_count": 3,
+		"session_sum_bytes":   float64(120),
+		"session_ports":       2,
+		"session_first_user":  "bob",
+		"session_duration":    float64(240),
+		"session_closed_by":   SessionClosedByGap,
+		"session_start":       "2026-01-01T00:00:00Z",
+	} {
+		if summary[field] != want {
+			t.Errorf("%s = %v, want %v", field, summary[field], want)
+		}
+	}
+	if id := summary[HitRuleIdFieldName].(string); !strings.HasSuffix(id, ".ip_session") {
+		t.Errorf("unexpected hit rule id %s", id)
+	}
+
+	// The sessions left open are closed when the ruleset stops, the rest of the rule still applies
+	closed := rs.closeSessions(time.Now(), true)
+	if len(closed) != 2 {
+		t.Fatalf("expected two open sessions, got %d", len(closed))
+	}
+	var matched int
+	for _, c := range closed {
+		if ok, _, _ := rs.executeRuleOperationsFrom(c.rule, c.opIndex+1, c.summary, map[string]common.CheckCoreCache{}, nil); ok {
+			matched++
+			if c.summary["session_closed_by"] != SessionClosedByStop {
+				t.Errorf("unexpected closed_by %v", c.summary["session_closed_by"])
+			}
+		}
+	}
+	if matched != 1 {
+		t.Fatalf("expected only the session of 10.0.0.2 to match, got %d", matched)
+	}
+}
+
+func TestSession_IdleAndMaxDuration(t *testing.T) {
+	session := &Session{GapInt: 60, MaxDurationInt: 600}
+	now := time.Now()
+	st := &sessionState{start: now, end: now, opened: now, seen: now}
+	if reason := st.idleReason(session, now.Add(30*time.Second)); reason != "" {
+		t.Fatalf("unexpected close %s", reason)
+	}
+	if reason := st.idleReason(session, now.Add(2*time.Minute)); reason != SessionClosedByGap {
+		t.Fatalf("expected gap, got %q", reason)
+	}
+	st.seen = now.Add(10 * time.Minute)
+	if reason := st.idleReason(session, now.Add(10*time.Minute)); reason != SessionClosedByMaxDuration {
+		t.Fatalf("expected max_duration, got %q", reason)
+	}
+	st.end = now.Add(9 * time.Minute)
+	if reason := st.closeReason(session, now.Add(10*time.Minute)); reason != SessionClosedByMaxDuration {
+		t.Fatalf("expected max_duration, got %q", reason)
+	}
+}
+
+func TestSession_Validation(t *testing.T) {
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<session gap="5m"></session>`, "session group_by is required"},
+		{`<session group_by="ip" gap="5m"><check type="EQU" field="a">b</check></session>`, "only aggregate is allowed"},
+		{`<session group_by="ip" gap="5m"><aggregate type="MEDIAN" field="a"></aggregate></session>`, "session aggregate type must be"},
+		{`<session group_by="ip" gap="5m"><aggregate type="SUM" field="a" name="duration"></aggregate></session>`, "is used twice"},
+		{`<session group_by="ip" gap="5m" max_duration="1m"></session>`, "max_duration cannot be shorter than gap"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+
+	rs, err := ParseRuleset([]byte(`<root type="EXCLUDE"><rule id="r"><session group_by="ip" gap="5m"></session></rule></root>`))
+	if err == nil {
+		err = RulesetBuild(rs)
+	}
+	if err == nil || !strings.Contains(err.Error(), "only supported for DETECTION rulesets") {
+		t.Errorf("expected the session to be rejected in an EXCLUDE ruleset, got %v", err)
+	}
+}
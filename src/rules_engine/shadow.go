@@ -0,0 +1,167 @@
+package rules_engine
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ShadowRulesetSuffix is appended to the ruleset ID of a shadow ruleset, so its thresholds,
+// sequences and suppressions keep their state apart from the active version
+const ShadowRulesetSuffix = "__shadow"
+
+// ShadowStats counts how a shadow ruleset diverged from the active version on the same events.
+// A detection ruleset matches an event when one of its rules matches, an EXCLUDE ruleset when it
+// drops the event.
+type ShadowStats struct {
+	Events       uint64            `json:"events"`         // events evaluated by both versions
+	Both         uint64            `json:"both"`           // events matched by both versions
+	OnlyNew      uint64            `json:"only_new"`       // events only matched by the new version
+	OnlyOld      uint64            `json:"only_old"`       // events only matched by the active version
+	Differ       uint64            `json:"differ"`         // events whose matched rules differ
+	RulesOnlyNew map[string]uint64 `json:"rules_only_new"` // by rule ID, matches the active version did not have
+	RulesOnlyOld map[string]uint64 `json:"rules_only_old"` // by rule ID, matches the new version did not have
+}
+
+// shadowState is the comparison state of a shadow ruleset
+type shadowState struct {
+	mu    sync.Mutex
+	stats ShadowStats
+}
+
+// NewShadowRuleset builds the new version of a ruleset to evaluate in shadow mode. It never
+// forwards events, runs <plugin> actions or adds risk scores.
+func NewShadowRuleset(raw, rulesetID string) (*Ruleset, error) {
+	valiRes, err := ValidateWithDetails("", raw)
+	if err != nil {
+		return nil, err
+	}
+	if valiRes != nil && len(valiRes.Errors) > 0 {
+		return nil, errors.New(valiRes.Errors[0].Message)
+	}
+	ruleset, err := ParseRuleset([]byte(raw))
+	if err != nil {
+		return nil, err
+	}
+	// The ID is part of the state keys, it must be set before the build
+	ruleset.RulesetID = rulesetID + ShadowRulesetSuffix
+	if err := RulesetBuild(ruleset); err != nil {
+		ruleset.closeCaches()
+		return nil, err
+	}
+	ruleset.RawConfig = raw
+	ruleset.shadowState = &shadowState{}
+	return ruleset, nil
+}
+
+// SetShadow evaluates shadow on the events of the ruleset from now on, nil stops it
+func (r *Ruleset) SetShadow(shadow *Ruleset) {
+	r.shadow.Store(shadow)
+}
+
+// Shadow returns the ruleset evaluated in shadow mode, nil when there is none
+func (r *Ruleset) Shadow() *Ruleset {
+	return r.shadow.Load()
+}
+
+// IsShadow reports whether the ruleset was built by NewShadowRuleset
+func (r *Ruleset) IsShadow() bool {
+	return r.shadowState != nil
+}
+
+// compareShadow evaluates the shadow ruleset on an event and counts how its matches differ from
+// the results of the active version
+func (r *Ruleset) compareShadow(active *Ruleset, data map[string]interface{}, results []map[string]interface{}) {
+	shadowResults := r.EngineCheck(data)
+	r.shadowState.record(matchedRules(active, results), matchedRules(r, shadowResults))
+}
+
+// matchedRules returns the IDs of the rules of the ruleset that matched, from the hit rule IDs of
+// its results. The hit rule IDs of the rulesets before it are ignored.
+func matchedRules(r *Ruleset, results []map[string]interface{}) []string {
+	if !r.IsDetection {
+		if len(results) == 0 {
+			// The rules of an EXCLUDE ruleset are not told apart, the event was dropped
+			return []string{""}
+		}
+		return nil
+	}
+	var rules []string
+	prefix := r.RulesetID + "."
+	for _, res := range results {
+		hits, _ := res[HitRuleIdFieldName].(string)
+		for _, hit := range strings.Split(hits, ",") {
+			if id, ok := strings.CutPrefix(hit, prefix); ok {
+				rules = append(rules, id)
+			}
+		}
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func (s *shadowState) record(old, new []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &s.stats
+	stats.Events++
+	switch {
+	case len(old) > 0 && len(new) > 0:
+		stats.Both++
+	case len(new) > 0:
+		stats.OnlyNew++
+	case len(old) > 0:
+		stats.OnlyOld++
+	}
+	differ := false
+	for _, id := range new {
+		if !slices.Contains(old, id) {
+			differ = true
+			if id != "" {
+				if stats.RulesOnlyNew == nil {
+					stats.RulesOnlyNew = make(map[string]uint64)
+				}
+				stats.RulesOnlyNew[id]++
+			}
+		}
+	}
+	for _, id := range old {
+		if !slices.Contains(new, id) {
+			differ = true
+			if id != "" {
+				if stats.RulesOnlyOld == nil {
+					stats.RulesOnlyOld = make(map[string]uint64)
+				}
+				stats.RulesOnlyOld[id]++
+			}
+		}
+	}
+	if differ {
+		stats.Differ++
+	}
+}
+
+// TakeShadowStats returns the divergence counted since the last call and resets it
+func (r *Ruleset) TakeShadowStats() ShadowStats {
+	if r.shadowState == nil {
+		return ShadowStats{}
+	}
+	r.shadowState.mu.Lock()
+	defer r.shadowState.mu.Unlock()
+	stats := r.shadowState.stats
+	r.shadowState.stats = ShadowStats{}
+	return stats
+}
+
+// ReleaseShadow stops the caches of a shadow ruleset once it is detached. The fields are kept, an
+// event still being evaluated finds closed caches, which miss, rather than nil ones.
+func (r *Ruleset) ReleaseShadow() {
+	if r.Cache != nil {
+		r.Cache.Close()
+	}
+	if r.CacheForClassify != nil {
+		r.CacheForClassify.Close()
+	}
+}
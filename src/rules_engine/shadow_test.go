@@ -0,0 +1,75 @@
+package rules_engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShadowRuleset(t *testing.T) {
+	active := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="login">
+    <check type="EQU" field="action">login</check>
+  </rule>
+  <rule id="root">
+    <check type="EQU" field="user">root</check>
+  </rule>
+</root>`)
+	shadow, err := NewShadowRuleset(`
+<root type="DETECTION">
+  <rule id="login">
+    <check type="EQU" field="action">login</check>
+    <check type="EQU" field="result">failed</check>
+  </rule>
+  <rule id="sudo">
+    <check type="INCL" field="cmdline">sudo</check>
+  </rule>
+</root>`, active.RulesetID)
+	if err != nil {
+		t.Fatalf("NewShadowRuleset error: %v", err)
+	}
+	defer shadow.ReleaseShadow()
+	if !shadow.IsShadow() || active.IsShadow() {
+		t.Fatalf("IsShadow: got shadow %v, active %v", shadow.IsShadow(), active.IsShadow())
+	}
+	if shadow.RulesetID != "TEST.RS"+ShadowRulesetSuffix {
+		t.Fatalf("shadow ruleset ID: got %q", shadow.RulesetID)
+	}
+
+	active.SetShadow(shadow)
+	if active.Shadow() != shadow {
+		t.Fatal("Shadow does not return the attached ruleset")
+	}
+	for _, data := range []map[string]interface{}{
+		{"action": "login", "result": "failed"},                  // both
+		{"action": "login", "result": "ok"},                      // only old
+		{"action": "exec", "cmdline": "sudo -i"},                 // only new
+		{"action": "exec", "cmdline": "sudo -i", "user": "root"}, // both, rules differ
+		{"action": "logout"},                                     // neither
+	} {
+		active.Shadow().compareShadow(active, data, active.EngineCheck(data))
+	}
+
+	stats := active.Shadow().TakeShadowStats()
+	if stats.Events != 5 || stats.Both != 2 || stats.OnlyNew != 1 || stats.OnlyOld != 1 || stats.Differ != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.RulesOnlyNew["sudo"] != 2 || len(stats.RulesOnlyNew) != 1 {
+		t.Errorf("rules only in new: got %v", stats.RulesOnlyNew)
+	}
+	if stats.RulesOnlyOld["login"] != 1 || stats.RulesOnlyOld["root"] != 1 || len(stats.RulesOnlyOld) != 2 {
+		t.Errorf("rules only in old: got %v", stats.RulesOnlyOld)
+	}
+	if stats := shadow.TakeShadowStats(); stats.Events != 0 {
+		t.Errorf("stats not reset: %+v", stats)
+	}
+
+	active.SetShadow(nil)
+	if active.Shadow() != nil {
+		t.Error("shadow still attached")
+	}
+
+	if _, err := NewShadowRuleset(`<root type="DETECTION"><rule id="r"><check type="EQU">x</check></rule></root>`, "TEST.RS"); err == nil || !strings.Contains(err.Error(), "field") {
+		t.Errorf("expected invalid shadow ruleset error, got %v", err)
+	}
+}
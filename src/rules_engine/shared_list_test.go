@@ -0,0 +1,91 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInList_Check(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	lists := common.NewSharedListManager()
+	prev := common.GlobalSharedLists
+	common.GlobalSharedLists = lists
+	defer func() { common.GlobalSharedLists = prev }()
+
+	if _, err := lists.CreateList("vip_users", common.SharedListTypeUsername, "executives"); err != nil {
+		t.Fatalf("CreateList error: %v", err)
+	}
+	if _, err := lists.CreateList("bad_ips", common.SharedListTypeIP, ""); err != nil {
+		t.Fatalf("CreateList error: %v", err)
+	}
+	if _, err := lists.CreateList("vip_users", "", ""); err == nil {
+		t.Fatal("expected an error for a duplicate list")
+	}
+	if _, err := lists.CreateList("bad list", "", ""); err == nil {
+		t.Fatal("expected an error for an invalid name")
+	}
+	if _, err := lists.AddEntries("vip_users", []string{"Alice", " bob "}, 0); err != nil {
+		t.Fatalf("AddEntries error: %v", err)
+	}
+	if _, err := lists.AddEntries("bad_ips", []string{"2001:DB8::1"}, time.Hour); err != nil {
+		t.Fatalf("AddEntries error: %v", err)
+	}
+	if _, err := lists.AddEntries("bad_ips", []string{"not-an-ip"}, 0); err == nil {
+		t.Fatal("expected an error for an invalid IP entry")
+	}
+	if _, err := lists.AddEntries("missing", []string{"x"}, 0); err == nil {
+		t.Fatal("expected an error for a missing list")
+	}
+	info, entries, ok := lists.List("bad_ips")
+	if !ok || info.Entries != 1 || entries[0].ExpiresAt == 0 {
+		t.Fatalf("unexpected list %+v %+v", info, entries)
+	}
+
+	xml := `<root type="DETECTION"><rule id="r1">
+		<check type="IN_LIST" field="user">vip_users</check>
+		<check type="IN_LIST" field="ip">bad_ips, vip_users</check>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rs.IsDetection = true
+	rule := &rs.Rules[0]
+	for id, node := range rule.CheckMap {
+		if err := processCheckNode(&node, nil, rule.ID); err != nil {
+			t.Fatalf("processCheckNode error: %v", err)
+		}
+		rule.CheckMap[id] = node
+	}
+
+	run := func(event map[string]interface{}) bool {
+		ok, _, _ := rs.executeRuleOperations(rule, event, map[string]common.CheckCoreCache{}, nil)
+		return ok
+	}
+	if !run(map[string]interface{}{"user": "ALICE", "ip": "2001:db8::1"}) {
+		t.Fatal("expected a match")
+	}
+	if run(map[string]interface{}{"user": "carol", "ip": "2001:db8::1"}) {
+		t.Fatal("carol is not a VIP")
+	}
+	if _, err := lists.RemoveEntries("bad_ips", []string{"2001:db8::1"}); err != nil {
+		t.Fatalf("RemoveEntries error: %v", err)
+	}
+	if run(map[string]interface{}{"user": "alice", "ip": "2001:db8::1"}) {
+		t.Fatal("removed entry still matches")
+	}
+
+	if err := processCheckNode(&CheckNodes{Type: "IN_LIST", Field: "user", Value: "unknown"}, nil, "r1"); err == nil {
+		t.Fatal("expected an error for an unknown list")
+	}
+	if err := lists.DeleteList("vip_users"); err != nil {
+		t.Fatalf("DeleteList error: %v", err)
+	}
+	if lists.Has("vip_users") || lists.Contains([]string{"vip_users"}, "alice") {
+		t.Fatal("deleted list still present")
+	}
+}
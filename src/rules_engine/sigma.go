@@ -0,0 +1,623 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sigmaRule is the part of a Sigma rule used by the conversion
+type sigmaRule struct {
+	Title       string                 `yaml:"title"`
+	ID          string                 `yaml:"id"`
+	Description string                 `yaml:"description"`
+	Level       string                 `yaml:"level"`
+	Tags        []string               `yaml:"tags"`
+	Action      string                 `yaml:"action"`
+	Logsource   map[string]string      `yaml:"logsource"`
+	Detection   map[string]interface{} `yaml:"detection"`
+}
+
+// sigmaNode is a check or a group of the condition of a converted rule
+type sigmaNode struct {
+	group     string // GroupTypeAll, GroupTypeAny or GroupTypeNot, empty for a check
+	children  []*sigmaNode
+	checkType string
+	field     string
+	value     string
+}
+
+// ConvertSigma converts the Sigma rules of a YAML document, or of several documents separated by
+// "---", to a DETECTION ruleset. Field names and logsources are translated with mapping, which
+// may be nil.
+// Returns: the ruleset XML and the number of rules
+func ConvertSigma(content []byte, mapping *common.SigmaMapping) (string, int, error) {
+	if mapping == nil {
+		mapping = &common.SigmaMapping{}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<root type=\"DETECTION\">\n")
+	ids := make(map[string]bool)
+	count := 0
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var rule sigmaRule
+		if err := decoder.Decode(&rule); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", 0, fmt.Errorf("invalid Sigma YAML: %v", err)
+		}
+		if rule.Title == "" && rule.Detection == nil && rule.Action == "" {
+			continue
+		}
+		count++
+		if rule.ID == "" {
+			rule.ID = "sigma_" + strconv.Itoa(count)
+		}
+		if ids[rule.ID] {
+			return "", 0, fmt.Errorf("duplicate Sigma rule id '%s'", rule.ID)
+		}
+		ids[rule.ID] = true
+		if err := writeSigmaRule(&sb, &rule, mapping); err != nil {
+			return "", 0, fmt.Errorf("sigma rule '%s': %v", rule.ID, err)
+		}
+	}
+	if count == 0 {
+		return "", 0, errors.New("no Sigma rule found")
+	}
+	sb.WriteString("</root>\n")
+	return sb.String(), count, nil
+}
+
+func writeSigmaRule(sb *strings.Builder, rule *sigmaRule, mapping *common.SigmaMapping) error {
+	if rule.Action != "" {
+		return fmt.Errorf("rule collections (action: %s) are not supported", rule.Action)
+	}
+	if rule.Detection == nil {
+		return errors.New("detection is missing")
+	}
+
+	var conditions []string
+	selections := make(map[string]*sigmaNode, len(rule.Detection))
+	for name, v := range rule.Detection {
+		if name == "condition" {
+			switch c := v.(type) {
+			case string:
+				conditions = append(conditions, c)
+			case []interface{}:
+				for _, item := range c {
+					s, ok := item.(string)
+					if !ok {
+						return errors.New("condition must be a string or a list of strings")
+					}
+					conditions = append(conditions, s)
+				}
+			default:
+				return errors.New("condition must be a string or a list of strings")
+			}
+			continue
+		}
+		if name == "timeframe" {
+			return errors.New("timeframe is not supported, use a <threshold> or <sequence> instead")
+		}
+		node, err := sigmaSelection(name, v, mapping)
+		if err != nil {
+			return err
+		}
+		selections[name] = node
+	}
+	if len(conditions) == 0 {
+		return errors.New("detection condition is missing")
+	}
+
+	var alternatives []*sigmaNode
+	for _, condition := range conditions {
+		node, err := parseSigmaCondition(condition, selections)
+		if err != nil {
+			return err
+		}
+		alternatives = append(alternatives, node)
+	}
+	root := sigmaGroup(GroupTypeAll, append(sigmaLogsourceChecks(rule.Logsource, mapping), sigmaGroup(GroupTypeAny, alternatives)))
+
+	fmt.Fprintf(sb, "    <rule id=\"%s\" name=\"%s\">\n", sigmaEscape(rule.ID), sigmaEscape(rule.Title))
+	if desc := strings.TrimSpace(rule.Description); desc != "" {
+		fmt.Fprintf(sb, "        <desc>%s</desc>\n", sigmaEscape(desc))
+	}
+	if root.group == GroupTypeAll {
+		for _, child := range root.children {
+			child.write(sb, 2)
+		}
+	} else {
+		root.write(sb, 2)
+	}
+	fmt.Fprintf(sb, "        <append field=\"sigma_id\">%s</append>\n", sigmaEscape(rule.ID))
+	if rule.Level != "" {
+		fmt.Fprintf(sb, "        <append field=\"sigma_level\">%s</append>\n", sigmaEscape(rule.Level))
+	}
+	if len(rule.Tags) > 0 {
+		fmt.Fprintf(sb, "        <append field=\"sigma_tags\">%s</append>\n", sigmaEscape(strings.Join(rule.Tags, ",")))
+	}
+	sb.WriteString("    </rule>\n")
+	return nil
+}
+
+// sigmaLogsourceChecks returns the checks of the logsource mappings matching the logsource
+func sigmaLogsourceChecks(logsource map[string]string, mapping *common.SigmaMapping) []*sigmaNode {
+	var checks []*sigmaNode
+	for _, ls := range mapping.Logsources {
+		if (ls.Product != "" && ls.Product != logsource["product"]) ||
+			(ls.Category != "" && ls.Category != logsource["category"]) ||
+			(ls.Service != "" && ls.Service != logsource["service"]) {
+			continue
+		}
+		fields := make([]string, 0, len(ls.Conditions))
+		for field := range ls.Conditions {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			checks = append(checks, &sigmaNode{checkType: "EQU", field: field, value: ls.Conditions[field]})
+		}
+	}
+	return checks
+}
+
+// sigmaSelection converts a search identifier: a map of fields that must all match, or a list of
+// such maps of which one must match
+func sigmaSelection(name string, v interface{}, mapping *common.SigmaMapping) (*sigmaNode, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return sigmaFieldMap(v, mapping)
+	case []interface{}:
+		var children []*sigmaNode
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("keyword search '%s' is not supported, every value needs a field", name)
+			}
+			child, err := sigmaFieldMap(m, mapping)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		if len(children) == 0 {
+			return nil, fmt.Errorf("search identifier '%s' is empty", name)
+		}
+		return sigmaGroup(GroupTypeAny, children), nil
+	}
+	return nil, fmt.Errorf("search identifier '%s' must be a map or a list of maps", name)
+}
+
+func sigmaFieldMap(m map[string]interface{}, mapping *common.SigmaMapping) (*sigmaNode, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("empty field map")
+	}
+	sort.Strings(keys)
+
+	children := make([]*sigmaNode, 0, len(keys))
+	for _, key := range keys {
+		child, err := sigmaField(key, m[key], mapping)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return sigmaGroup(GroupTypeAll, children), nil
+}
+
+// sigmaField converts "field|modifier...: value", a list of values matches when any value
+// matches, or all of them with the all modifier
+func sigmaField(key string, v interface{}, mapping *common.SigmaMapping) (*sigmaNode, error) {
+	parts := strings.Split(key, "|")
+	field := parts[0]
+	if field == "" {
+		return nil, fmt.Errorf("keyword search '%s' is not supported, every value needs a field", key)
+	}
+	if mapped, ok := mapping.Fields[field]; ok {
+		field = mapped
+	}
+
+	op, all, cased, reFlags := "", false, false, ""
+	for _, mod := range parts[1:] {
+		switch mod {
+		case "all":
+			all = true
+		case "cased":
+			cased = true
+		case "i", "m", "s":
+			reFlags += mod
+		case "contains", "startswith", "endswith", "re", "cidr", "gt", "gte", "lt", "lte", "exists":
+			if op != "" {
+				return nil, fmt.Errorf("field '%s' combines the modifiers %s and %s", key, op, mod)
+			}
+			op = mod
+		default:
+			return nil, fmt.Errorf("modifier '%s' of field '%s' is not supported", mod, key)
+		}
+	}
+	if reFlags != "" && op != "re" {
+		return nil, fmt.Errorf("modifiers i, m and s of field '%s' need the re modifier", key)
+	}
+
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("field '%s' has no value", key)
+	}
+	children := make([]*sigmaNode, 0, len(values))
+	for _, value := range values {
+		child, err := sigmaValue(field, op, value, cased, reFlags)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %v", key, err)
+		}
+		children = append(children, child)
+	}
+	if all {
+		return sigmaGroup(GroupTypeAll, children), nil
+	}
+	return sigmaGroup(GroupTypeAny, children), nil
+}
+
+func sigmaValue(field, op string, v interface{}, cased bool, reFlags string) (*sigmaNode, error) {
+	check := func(checkType, value string) *sigmaNode {
+		return &sigmaNode{checkType: checkType, field: field, value: value}
+	}
+
+	if op == "exists" {
+		exists, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("exists needs true or false")
+		}
+		if exists {
+			return check("EXISTS", ""), nil
+		}
+		return check("NOT_EXISTS", ""), nil
+	}
+	if v == nil {
+		if op != "" {
+			return nil, fmt.Errorf("%s needs a value", op)
+		}
+		return check("ISNULL", ""), nil
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case int:
+		s = strconv.Itoa(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+
+	switch op {
+	case "gt", "lt", "gte", "lte":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("%s needs a number, got '%s'", op, s)
+		}
+		if op == "gt" {
+			return check("MT", s), nil
+		}
+		if op == "lt" {
+			return check("LT", s), nil
+		}
+		// MT and LT are strict, so inclusive bounds are only exact for integers
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs an integer, got '%s'", op, s)
+		}
+		if op == "gte" {
+			return check("MT", strconv.Itoa(n-1)), nil
+		}
+		return check("LT", strconv.Itoa(n+1)), nil
+	case "cidr":
+		return check("CIDR", s), nil
+	case "re":
+		if reFlags != "" {
+			s = "(?" + reFlags + ")" + s
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("regular expression '%s' is not supported: %v", s, err)
+		}
+		return check("REGEX", s), nil
+	case "contains":
+		s = "*" + s + "*"
+	case "startswith":
+		s = s + "*"
+	case "endswith":
+		s = "*" + s
+	default:
+		if _, isString := v.(string); !isString {
+			return check("EQU", s), nil
+		}
+	}
+	return sigmaWildcard(field, s, cased), nil
+}
+
+// sigmaWildcard converts a Sigma string with the wildcards * and ?, escaped with a backslash, to
+// the simplest matching check. Sigma strings are case-insensitive unless cased.
+func sigmaWildcard(field, s string, cased bool) *sigmaNode {
+	type token struct {
+		wild    byte
+		literal string
+	}
+	var tokens []token
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			tokens = append(tokens, token{literal: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '*' || s[i+1] == '?' || s[i+1] == '\\'):
+			lit.WriteByte(s[i+1])
+			i++
+		case c == '*' || c == '?':
+			flush()
+			// Consecutive stars match the same
+			if c == '*' && len(tokens) > 0 && tokens[len(tokens)-1].wild == '*' {
+				continue
+			}
+			tokens = append(tokens, token{wild: c})
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flush()
+
+	prefix := "NCS_"
+	if cased {
+		prefix = ""
+	}
+	check := func(checkType, value string) *sigmaNode {
+		return &sigmaNode{checkType: checkType, field: field, value: value}
+	}
+
+	// Values are trimmed by the parser, so literals with surrounding spaces are matched as regex
+	simple := true
+	for i, t := range tokens {
+		if t.wild == '?' || (t.wild == '*' && i != 0 && i != len(tokens)-1) || t.literal != strings.TrimSpace(t.literal) {
+			simple = false
+		}
+	}
+	if simple {
+		switch {
+		case len(tokens) == 0:
+			return check("ISNULL", "")
+		case len(tokens) == 1 && tokens[0].wild == '*':
+			return check("EXISTS", "")
+		case len(tokens) == 1:
+			return check(prefix+"EQU", tokens[0].literal)
+		case len(tokens) == 3:
+			return check(prefix+"INCL", tokens[1].literal)
+		case tokens[0].wild == '*':
+			return check(prefix+"END", tokens[1].literal)
+		default:
+			return check(prefix+"START", tokens[0].literal)
+		}
+	}
+
+	var re strings.Builder
+	if !cased {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	for _, t := range tokens {
+		switch t.wild {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(t.literal))
+		}
+	}
+	re.WriteString("$")
+	return check("REGEX", re.String())
+}
+
+// sigmaGroup groups nodes, a single node of an ALL or ANY group stands for the group and nested
+// groups of the same type are merged
+func sigmaGroup(group string, children []*sigmaNode) *sigmaNode {
+	if len(children) == 1 && group != GroupTypeNot {
+		return children[0]
+	}
+	node := &sigmaNode{group: group}
+	for _, child := range children {
+		if group != GroupTypeNot && child.group == group {
+			node.children = append(node.children, child.children...)
+		} else {
+			node.children = append(node.children, child)
+		}
+	}
+	return node
+}
+
+func (n *sigmaNode) write(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("    ", depth)
+	if n.group == "" {
+		fmt.Fprintf(sb, "%s<check type=\"%s\" field=\"%s\">%s</check>\n", indent, n.checkType, sigmaEscape(n.field), sigmaEscape(n.value))
+		return
+	}
+	tag := strings.ToLower(n.group)
+	fmt.Fprintf(sb, "%s<%s>\n", indent, tag)
+	children := n.children
+	// NOT negates all its children, so the children of a negated ALL group are written directly
+	if n.group == GroupTypeNot && len(children) == 1 && children[0].group == GroupTypeAll {
+		children = children[0].children
+	}
+	for _, child := range children {
+		child.write(sb, depth+1)
+	}
+	fmt.Fprintf(sb, "%s</%s>\n", indent, tag)
+}
+
+func sigmaEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sigmaConditionParser parses a Sigma condition: search identifiers combined with and, or, not
+// and parentheses, and "1 of" or "all of" a pattern or "them"
+type sigmaConditionParser struct {
+	tokens     []string
+	pos        int
+	selections map[string]*sigmaNode
+}
+
+func parseSigmaCondition(condition string, selections map[string]*sigmaNode) (*sigmaNode, error) {
+	if strings.Contains(condition, "|") {
+		return nil, fmt.Errorf("aggregation in condition '%s' is not supported, use a <threshold> instead", condition)
+	}
+	condition = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(condition)
+	p := &sigmaConditionParser{tokens: strings.Fields(condition), selections: selections}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("condition is empty")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in condition", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+func (p *sigmaConditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *sigmaConditionParser) parseOr() (*sigmaNode, error) {
+	return p.parseBinary("or", GroupTypeAny, p.parseAnd)
+}
+
+func (p *sigmaConditionParser) parseAnd() (*sigmaNode, error) {
+	return p.parseBinary("and", GroupTypeAll, p.parseNot)
+}
+
+func (p *sigmaConditionParser) parseBinary(op, group string, operand func() (*sigmaNode, error)) (*sigmaNode, error) {
+	node, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []*sigmaNode{node}
+	for p.peek() == op {
+		p.pos++
+		node, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	return sigmaGroup(group, children), nil
+}
+
+func (p *sigmaConditionParser) parseNot() (*sigmaNode, error) {
+	if p.peek() != "not" {
+		return p.parsePrimary()
+	}
+	p.pos++
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	// not not x is x
+	if node.group == GroupTypeNot && len(node.children) == 1 {
+		return node.children[0], nil
+	}
+	return sigmaGroup(GroupTypeNot, []*sigmaNode{node}), nil
+}
+
+func (p *sigmaConditionParser) parsePrimary() (*sigmaNode, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of condition")
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing ')' in condition")
+		}
+		p.pos++
+		return node, nil
+	case "1", "all", "any":
+		if p.pos+2 < len(p.tokens) && strings.ToLower(p.tokens[p.pos+1]) == "of" {
+			pattern := p.tokens[p.pos+2]
+			p.pos += 3
+			return p.quantifier(token, pattern)
+		}
+	case "and", "or", "not", ")", "of", "them":
+		return nil, fmt.Errorf("unexpected '%s' in condition", p.tokens[p.pos])
+	}
+
+	name := p.tokens[p.pos]
+	p.pos++
+	node, ok := p.selections[name]
+	if !ok {
+		return nil, fmt.Errorf("condition references unknown search identifier '%s'", name)
+	}
+	return node, nil
+}
+
+// quantifier converts "1 of pattern" and "all of pattern", them matches the search identifiers
+// not starting with an underscore
+func (p *sigmaConditionParser) quantifier(quantity, pattern string) (*sigmaNode, error) {
+	names := make([]string, 0, len(p.selections))
+	for name := range p.selections {
+		if pattern == "them" {
+			if !strings.HasPrefix(name, "_") {
+				names = append(names, name)
+			}
+		} else if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no search identifier matches '%s of %s'", quantity, pattern)
+	}
+	sort.Strings(names)
+
+	children := make([]*sigmaNode, 0, len(names))
+	for _, name := range names {
+		children = append(children, p.selections[name])
+	}
+	if quantity == "all" {
+		return sigmaGroup(GroupTypeAll, children), nil
+	}
+	return sigmaGroup(GroupTypeAny, children), nil
+}
@@ -0,0 +1,92 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"strings"
+	"testing"
+)
+
+const sigmaTestRule = `title: Suspicious PowerShell
+id: 1a2b3c
+description: Encoded PowerShell command
+level: high
+tags: [attack.execution, attack.t1059.001]
+logsource:
+    product: windows
+    category: process_creation
+detection:
+    selection:
+        Image|endswith: '\powershell.exe'
+        CommandLine|contains|all:
+            - ' -enc'
+            - 'bypass'
+    filter_admin:
+        User: 'admin*'
+        Path: 'C:\a\*b'
+    filter_path:
+        ParentImage: 'C:\Windows*cmd?.exe'
+    condition: selection and not 1 of filter_*
+`
+
+func TestConvertSigma(t *testing.T) {
+	mapping := &common.SigmaMapping{
+		Fields: map[string]string{"CommandLine": "process.command_line"},
+		Logsources: []common.SigmaLogsource{
+			{Product: "windows", Category: "process_creation", Conditions: map[string]string{"event_id": "1"}},
+			{Product: "linux", Conditions: map[string]string{"os": "linux"}},
+		},
+	}
+	content, rules, err := ConvertSigma([]byte(sigmaTestRule+"---\n"+strings.Replace(sigmaTestRule, "id: 1a2b3c", "id: 4d5e6f", 1)), mapping)
+	if err != nil {
+		t.Fatalf("ConvertSigma error: %v", err)
+	}
+	if rules != 2 {
+		t.Fatalf("expected 2 rules, got %d", rules)
+	}
+	for _, want := range []string{
+		`<check type="EQU" field="event_id">1</check>`,
+		`<check type="NCS_END" field="Image">\powershell.exe</check>`,
+		`<check type="REGEX" field="process.command_line">(?i)^.* -enc.*$</check>`,
+		`<check type="NCS_INCL" field="process.command_line">bypass</check>`,
+		`<check type="NCS_START" field="User">admin</check>`,
+		`<check type="REGEX" field="ParentImage">(?i)^C:\\Windows.*cmd.\.exe$</check>`,
+		`<check type="NCS_EQU" field="Path">C:\a*b</check>`,
+		`<append field="sigma_tags">attack.execution,attack.t1059.001</append>`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("expected %s in:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, `field="os"`) {
+		t.Fatalf("unexpected logsource checks in:\n%s", content)
+	}
+
+	rs, err := ParseRuleset([]byte(content))
+	if err != nil {
+		t.Fatalf("converted ruleset does not parse: %v\n%s", err, content)
+	}
+	if len(rs.Rules) != 2 || rs.Rules[0].ID != "1a2b3c" || rs.Rules[0].Name != "Suspicious PowerShell" {
+		t.Fatalf("unexpected rules %+v", rs.Rules)
+	}
+	for _, group := range rs.Rules[0].GroupMap {
+		if group.Type != GroupTypeNot || len(group.Children) != 1 || group.Children[0].Group.Type != GroupTypeAny {
+			t.Fatalf("unexpected filter group %+v", group)
+		}
+	}
+}
+
+func TestConvertSigma_Errors(t *testing.T) {
+	for _, detection := range []string{
+		"selection:\n        a: 1\n    condition: selection | count() > 5",
+		"selection:\n        a: 1\n    condition: selection and other",
+		"selection:\n        a|base64: x\n    condition: selection",
+		"keywords:\n        - evil\n    condition: keywords",
+		"selection:\n        a: 1\n    condition: (selection",
+		"selection:\n        a: 1",
+	} {
+		rule := "title: t\nlogsource:\n    product: x\ndetection:\n    " + detection + "\n"
+		if _, _, err := ConvertSigma([]byte(rule), nil); err == nil {
+			t.Fatalf("expected error for %q", detection)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package rules_engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Defaults of the threshold attribute of similarity checks
+const (
+	defaultLevenshteinDistance = 2
+	defaultJaroSimilarity      = 0.9
+)
+
+// SimilarityList is the parsed value of a LEVENSHTEIN, JARO or HOMOGLYPH check: the protected
+// values, lower-cased, and their homoglyph skeletons
+type SimilarityList struct {
+	entries   [][]rune
+	skeletons []string
+}
+
+// parseSimilarityList parses the comma separated protected values of a similarity check
+func parseSimilarityList(checkType, value string) (*SimilarityList, error) {
+	list := &SimilarityList{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		list.entries = append(list.entries, []rune(entry))
+		list.skeletons = append(list.skeletons, homoglyphSkeleton(entry))
+	}
+	if len(list.entries) == 0 {
+		return nil, fmt.Errorf("%s value must contain at least one protected value", checkType)
+	}
+	return list, nil
+}
+
+// parseSimilarityThreshold returns the threshold attribute of a similarity check: the largest
+// edit distance of LEVENSHTEIN and the lowest similarity of JARO
+func parseSimilarityThreshold(checkType, threshold string) (float64, error) {
+	switch checkType {
+	case "LEVENSHTEIN":
+		if threshold == "" {
+			return defaultLevenshteinDistance, nil
+		}
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("LEVENSHTEIN threshold must be a positive edit distance, got '%s'", threshold)
+		}
+		return float64(n), nil
+	case "JARO":
+		if threshold == "" {
+			return defaultJaroSimilarity, nil
+		}
+		f, err := strconv.ParseFloat(threshold, 64)
+		if err != nil || f <= 0 || f >= 1 {
+			return 0, fmt.Errorf("JARO threshold must be a similarity between 0 and 1, got '%s'", threshold)
+		}
+		return f, nil
+	}
+	if threshold != "" {
+		return 0, fmt.Errorf("threshold is only supported by LEVENSHTEIN and JARO checks")
+	}
+	return 0, nil
+}
+
+// Lookalike reports whether value is close to one of the protected values without being equal
+// to it, a value equal to a protected value is the value itself rather than a lookalike
+func (l *SimilarityList) Lookalike(checkType string, threshold float64, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	var skeleton string
+	if checkType == "HOMOGLYPH" {
+		// Before lower-casing, which hides a capital I
+		skeleton = homoglyphSkeleton(value)
+	}
+	value = strings.ToLower(value)
+	runes := []rune(value)
+	for i, entry := range l.entries {
+		if string(entry) == value {
+			continue
+		}
+		switch checkType {
+		case "LEVENSHTEIN":
+			if levenshtein(runes, entry, int(threshold)) <= int(threshold) {
+				return true
+			}
+		case "JARO":
+			if jaroWinkler(runes, entry) >= threshold {
+				return true
+			}
+		case "HOMOGLYPH":
+			if skeleton == l.skeletons[i] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// levenshtein returns the edit distance of a and b, or limit+1 once it is known to exceed limit
+func levenshtein(a, b []rune, limit int) int {
+	if diff := len(a) - len(b); diff > limit || -diff > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, from 0 to 1, which favors values
+// sharing a prefix of up to 4 characters
+func jaroWinkler(a, b []rune) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	window := max(max(len(a), len(b))/2-1, 0)
+	aMatched := make([]bool, len(a))
+	bMatched := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		for j := max(0, i-window); j < min(len(b), i+window+1); j++ {
+			if !bMatched[j] && a[i] == b[j] {
+				aMatched[i], bMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	transpositions := 0
+	j := 0
+	for i := range a {
+		if !aMatched[i] {
+			continue
+		}
+		for !bMatched[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// homoglyphs maps characters to the ASCII letter they are mistaken for
+var homoglyphs = map[rune]rune{
+	// Digits
+	'0': 'o', '1': 'l', '3': 'e', '5': 's',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'і': 'l', 'ї': 'l', 'ј': 'j', 'к': 'k', 'м': 'm',
+	'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd',
+	'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ь': 'b', 'п': 'n', 'г': 'r',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'μ': 'u', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'γ': 'y',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'ց': 'g', 'ո': 'n', 'հ': 'h',
+	// Latin lookalikes
+	'ı': 'l', 'ł': 'l', 'ɡ': 'g', 'ɑ': 'a', 'đ': 'd', 'ø': 'o',
+}
+
+// homoglyphSequences are letter pairs read as another letter
+var homoglyphSequences = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// homoglyphSkeleton reduces a value to the form two lookalike values share: punycode labels are
+// decoded, accents dropped, confusable characters and sequences replaced
+func homoglyphSkeleton(value string) string {
+	if strings.Contains(strings.ToLower(value), "xn--") {
+		if decoded, err := idna.ToUnicode(strings.ToLower(value)); err == nil {
+			value = decoded
+		}
+	}
+	var sb strings.Builder
+	for _, r := range norm.NFKD.String(value) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		// A capital I reads as a lower-case l
+		if r == 'I' {
+			r = 'l'
+		}
+		r = unicode.ToLower(r)
+		if g, ok := homoglyphs[r]; ok {
+			r = g
+		}
+		sb.WriteRune(r)
+	}
+	return homoglyphSequences.Replace(sb.String())
+}
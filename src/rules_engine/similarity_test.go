@@ -0,0 +1,122 @@
+package rules_engine
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarity_Metrics(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"paypal.com", "paypa1.com", 1},
+		{"paypal.com", "paypal.com", 0},
+		{"google.com", "gooogle.com", 1},
+		{"", "abc", 3},
+		{"münchen", "munchen", 1},
+	} {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b), 10); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if got := levenshtein([]rune("abcdef"), []rune("uvwxyz"), 2); got != 3 {
+		t.Errorf("levenshtein beyond the limit = %d, want 3", got)
+	}
+
+	for _, tt := range []struct {
+		a, b string
+		want float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dixon", "dicksonx", 0.813},
+		{"abc", "xyz", 0},
+		{"same", "same", 1},
+	} {
+		if got := jaroWinkler([]rune(tt.a), []rune(tt.b)); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f, want %.3f", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		a, b string
+		same bool
+	}{
+		{"pаypal.com", "paypal.com", true}, // Cyrillic а
+		{"xn--pypal-4ve.com", "paypal.com", true},
+		{"PAYPAI.COM", "paypal.com", true},
+		{"g00gle.com", "google.com", true},
+		{"rnicrosoft.com", "microsoft.com", true},
+		{"appIe.com", "apple.com", true},
+		{"gооgle.com", "google.com", true}, // Cyrillic о
+		{"bankofamérica.com", "bankofamerica.com", true},
+		{"paypal.org", "paypal.com", false},
+		{"mail.com", "mall.com", false},
+	} {
+		if got := homoglyphSkeleton(tt.a) == homoglyphSkeleton(tt.b); got != tt.same {
+			t.Errorf("skeleton(%q) == skeleton(%q) is %v, want %v (%q, %q)", tt.a, tt.b, got, tt.same, homoglyphSkeleton(tt.a), homoglyphSkeleton(tt.b))
+		}
+	}
+}
+
+func TestSimilarity_Rule(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="lookalike">
+  <rule id="typo" name="typo">
+    <check type="LEVENSHTEIN" field="domain">paypal.com, google.com</check>
+  </rule>
+  <rule id="jaro" name="jaro">
+    <check type="JARO" field="domain" threshold="0.92">microsoft.com</check>
+  </rule>
+  <rule id="glyph" name="glyph">
+    <check type="HOMOGLYPH" field="domain">paypal.com,apple.com</check>
+  </rule>
+ </root>`
+	rs := buildRulesetFromXML(t, xml)
+
+	cases := []struct {
+		domain string
+		rules  []string
+	}{
+		{"paypal.com", nil},
+		{"PayPal.com", nil},
+		{"paypa1.com", []string{"TEST.RS.typo", "TEST.RS.glyph"}},
+		{"paypall.com", []string{"TEST.RS.typo"}},
+		{"gogle.com", []string{"TEST.RS.typo"}},
+		{"micros0ft.com", []string{"TEST.RS.jaro"}},
+		{"xn--pple-43d.com", []string{"TEST.RS.glyph"}},
+		{"example.com", nil},
+	}
+	for _, c := range cases {
+		out := rs.EngineCheck(map[string]interface{}{"domain": c.domain})
+		var got []string
+		for _, o := range out {
+			got = append(got, o[HitRuleIdFieldName].(string))
+		}
+		if len(got) != len(c.rules) {
+			t.Fatalf("%s: matched %v, want %v", c.domain, got, c.rules)
+		}
+		for i := range got {
+			if got[i] != c.rules[i] {
+				t.Fatalf("%s: matched %v, want %v", c.domain, got, c.rules)
+			}
+		}
+	}
+
+	for _, bad := range []string{
+		`<check type="LEVENSHTEIN" field="d"></check>`,
+		`<check type="LEVENSHTEIN" field="d" threshold="0">a.com</check>`,
+		`<check type="JARO" field="d" threshold="1.5">a.com</check>`,
+		`<check type="HOMOGLYPH" field="d" threshold="2">a.com</check>`,
+	} {
+		xml := `<root type="DETECTION" name="bad"><rule id="r1" name="r1">` + bad + `</rule></root>`
+		rs, err := ParseRuleset([]byte(xml))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
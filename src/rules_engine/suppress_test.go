@@ -0,0 +1,63 @@
+package rules_engine
+
+import "testing"
+
+func TestSuppress_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1">
+		<check type="EQU" field="action">fail</check>
+		<suppress key="source_ip, user.name" window="30m"/>
+	</rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	rule := &rs.Rules[0]
+	if len(rule.SuppressMap) != 1 {
+		t.Fatalf("expected one suppress, got %d", len(rule.SuppressMap))
+	}
+	for id, suppress := range rule.SuppressMap {
+		if err := processSuppress(&suppress, "rs", rule.ID, id); err != nil {
+			t.Fatalf("processSuppress error: %v", err)
+		}
+		if suppress.WindowInt != 1800 {
+			t.Fatalf("window = %d, want 1800", suppress.WindowInt)
+		}
+		if len(suppress.KeyFields) != 2 || suppress.KeyFields[1] != "user.name" || len(suppress.KeyList[1]) != 2 {
+			t.Fatalf("unexpected key %+v", suppress)
+		}
+	}
+
+	for _, bad := range []string{
+		`<suppress key="ip"/>`,
+		`<suppress key="ip" window="30m" range="1h"/>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+	if _, err := ParseRuleset([]byte(`<root type="DETECTION"><suppress window="1m"/></root>`)); err == nil {
+		t.Fatal("expected parse error for suppress at root level")
+	}
+
+	for _, window := range []string{"soon", "0s"} {
+		suppress := Suppress{Window: window}
+		if err := processSuppress(&suppress, "rs", "r1", 1); err == nil {
+			t.Fatalf("expected error for window %q", window)
+		}
+	}
+}
+
+func TestSuppress_Counts(t *testing.T) {
+	r := &Ruleset{}
+	if got := r.GetSuppressedIncrementAndUpdate(); len(got) != 0 {
+		t.Fatalf("expected no counts, got %v", got)
+	}
+	r.suppressed = map[string]uint64{"r1": 2}
+	if got := r.GetSuppressedIncrementAndUpdate(); got["r1"] != 2 {
+		t.Fatalf("unexpected counts %v", got)
+	}
+	if got := r.GetSuppressedIncrementAndUpdate(); len(got) != 0 {
+		t.Fatalf("counts not reset, got %v", got)
+	}
+}
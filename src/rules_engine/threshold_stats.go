@@ -0,0 +1,259 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Count types of thresholds aggregating the numeric values of count_field
+const (
+	ThresholdCountAvg        = "AVG"
+	ThresholdCountMin        = "MIN"
+	ThresholdCountMax        = "MAX"
+	ThresholdCountPercentile = "PERCENTILE"
+)
+
+// defaultThresholdPercentile is the percentile of PERCENTILE thresholds without a percentile
+const defaultThresholdPercentile = 95
+
+// thresholdMaxSamples bounds the values kept per group of fixed and tumbling windows, the most
+// recent are kept
+const thresholdMaxSamples = 10000
+
+// isThresholdStat reports whether a count type aggregates the values of count_field
+func isThresholdStat(countType string) bool {
+	switch countType {
+	case ThresholdCountAvg, ThresholdCountMin, ThresholdCountMax, ThresholdCountPercentile:
+		return true
+	}
+	return false
+}
+
+// isValidThresholdCountType reports whether a count type is supported, empty counts events
+func isValidThresholdCountType(countType string) bool {
+	return countType == "" || countType == "SUM" || countType == "CLASSIFY" || isThresholdStat(countType)
+}
+
+// thresholdNeedsCountField reports whether a count type reads count_field
+func thresholdNeedsCountField(countType string) bool {
+	return countType == "SUM" || countType == "CLASSIFY" || isThresholdStat(countType)
+}
+
+// thresholdValueUnits are the size suffixes of threshold values, such as 5GB for a SUM of bytes
+var thresholdValueUnits = []struct {
+	suffix string
+	factor int
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+}
+
+// parseThresholdValue parses a threshold value, a positive integer with an optional KB, MB, GB or
+// TB suffix in powers of 1024
+func parseThresholdValue(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	factor := 1
+	for _, u := range thresholdValueUnits {
+		if n, ok := strings.CutSuffix(strings.ToUpper(s), u.suffix); ok {
+			s, factor = strings.TrimSpace(n), u.factor
+			break
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxInt/factor {
+		return 0, strconv.ErrRange
+	}
+	return v * factor, nil
+}
+
+// thresholdStat aggregates the values of a window
+func thresholdStat(threshold *Threshold, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	switch threshold.CountType {
+	case ThresholdCountMin:
+		return slices.Min(values)
+	case ThresholdCountMax:
+		return slices.Max(values)
+	case ThresholdCountPercentile:
+		return percentile(values, threshold.Percentile)
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the p-th percentile of values by linear interpolation between the closest
+// ranks, values are sorted in place
+func percentile(values []float64, p float64) float64 {
+	slices.Sort(values)
+	rank := p / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	return values[lower] + (rank-float64(lower))*(values[lower+1]-values[lower])
+}
+
+// parseStatValue reads the numeric value of count_field, false when missing or not a number
+func parseStatValue(ruleCache map[string]common.CheckCoreCache, threshold *Threshold, data map[string]interface{}) (float64, bool) {
+	s, ok := GetCheckDataFromCache(ruleCache, threshold.CountField, data, threshold.CountFieldList)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// statMember returns a unique sorted set member holding a value of a sliding window
+func statMember(ts time.Time, value float64) string {
+	return strconv.FormatInt(ts.UnixNano(), 36) + ":" + strconv.FormatUint(slidingMemberSeq.Add(1), 36) + ":" + strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// parseStatValues reads the values of sorted set members or list elements
+func parseStatValues(members []string) []float64 {
+	values := make([]float64, 0, len(members))
+	for _, m := range members {
+		if i := strings.LastIndexByte(m, ':'); i >= 0 {
+			m = m[i+1:]
+		}
+		if v, err := strconv.ParseFloat(m, 64); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// executeStatThreshold adds the value of count_field to the window of its group and aggregates the
+// window. The threshold is reached when the aggregate exceeds the threshold value, the window of
+// the group then starts over like for the other count types.
+func (r *Ruleset) executeStatThreshold(rule *Rule, threshold *Threshold, groupByKey string, groupByValues map[string]string, ts time.Time, ttl int, data map[string]interface{}, ruleCache map[string]common.CheckCoreCache, explain *matchExplanation) bool {
+	value, ok := parseStatValue(ruleCache, threshold, data)
+	if !ok {
+		return false
+	}
+	key := "FA_" + groupByKey
+
+	var values []float64
+	var err error
+	if threshold.LocalCache {
+		values = r.localStatWindow(key, threshold, value, ts, ttl)
+	} else {
+		values, err = redisStatWindow(key, threshold, value, ts, ttl)
+	}
+	if err != nil {
+		logger.Error("Threshold check error:", err, "GroupByKey:", groupByKey, "RuleID:", rule.ID, "RuleSetID:", r.RulesetID)
+		return false
+	}
+
+	stat := thresholdStat(threshold, values)
+	res := stat > float64(threshold.Value)
+	if res {
+		if threshold.LocalCache {
+			r.mu.Lock()
+			delete(r.statWindows, key)
+			r.mu.Unlock()
+		} else if err := common.RedisDel(key); err != nil {
+			logger.Error("failed to delete Redis key %s: %v", key, err)
+		}
+	}
+	explain.addThreshold(threshold, groupByValues, int(math.Round(stat)), res)
+	return res
+}
+
+// redisStatWindow adds a value to the window of a group in Redis and returns the values of the
+// window. Sliding windows are sorted sets scored by event time, the other windows lists whose
+// expiration is set by their first value.
+func redisStatWindow(key string, threshold *Threshold, value float64, ts time.Time, ttl int) ([]float64, error) {
+	if threshold.Window == ThresholdWindowSliding {
+		score := float64(ts.UnixMilli())
+		start := score - float64(threshold.RangeInt)*1000
+		_, members, err := common.RedisZWindowAdd(key, score, statMember(ts, value), start, score, ttl, true)
+		if err != nil {
+			return nil, err
+		}
+		return parseStatValues(members), nil
+	}
+	members, err := common.RedisLPushWindow(key, strconv.FormatFloat(value, 'g', -1, 64), thresholdMaxSamples, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return parseStatValues(members), nil
+}
+
+type statSample struct {
+	ts    int64 // event time in milliseconds
+	value float64
+}
+
+type statWindow struct {
+	samples []statSample
+	expires time.Time
+}
+
+// localStatWindow is redisStatWindow on the memory of this node
+func (r *Ruleset) localStatWindow(key string, threshold *Threshold, value float64, ts time.Time, ttl int) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.statWindows == nil {
+		r.statWindows = make(map[string]*statWindow)
+	}
+	r.slidingUpdates++
+	if r.slidingUpdates%slidingSweepEvery == 0 {
+		for k, w := range r.statWindows {
+			if now.After(w.expires) {
+				delete(r.statWindows, k)
+			}
+		}
+	}
+
+	w, ok := r.statWindows[key]
+	if !ok || now.After(w.expires) {
+		w = &statWindow{expires: now.Add(time.Duration(ttl) * time.Second)}
+		r.statWindows[key] = w
+	}
+	at := ts.UnixMilli()
+	w.samples = append(w.samples, statSample{ts: at, value: value})
+
+	if threshold.Window == ThresholdWindowSliding {
+		w.expires = now.Add(time.Duration(ttl) * time.Second)
+		start := at - int64(threshold.RangeInt)*1000
+		w.samples = slices.DeleteFunc(w.samples, func(s statSample) bool { return s.ts <= start })
+	} else if len(w.samples) > thresholdMaxSamples {
+		w.samples = slices.Delete(w.samples, 0, len(w.samples)-thresholdMaxSamples)
+	}
+
+	values := make([]float64, 0, len(w.samples))
+	for _, s := range w.samples {
+		if threshold.Window != ThresholdWindowSliding || s.ts <= at {
+			values = append(values, s.value)
+		}
+	}
+	return values
+}
+
+// thresholdValue returns the value set for the value_ref of a threshold, the value of the element
+// when there is none
+func thresholdValue(threshold *Threshold) int {
+	if threshold.ValueRef != "" {
+		if v, ok := common.GetThresholdValue(strings.TrimPrefix(threshold.ValueRef, common.ThresholdValueRefPrefix)); ok {
+			return v
+		}
+	}
+	return threshold.Value
+}
@@ -0,0 +1,113 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"testing"
+)
+
+func TestThresholdStats_Value(t *testing.T) {
+	for s, want := range map[string]int{"10": 10, "5GB": 5 << 30, "2 mb": 2 << 20, "1KB": 1024} {
+		if v, err := parseThresholdValue(s); err != nil || v != want {
+			t.Fatalf("parseThresholdValue(%q) = %d, %v", s, v, err)
+		}
+	}
+	for _, s := range []string{"", "GB", "1.5GB", "5PB"} {
+		if _, err := parseThresholdValue(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, tt := range []struct {
+		threshold Threshold
+		want      float64
+	}{
+		{Threshold{CountType: ThresholdCountAvg}, 5.5},
+		{Threshold{CountType: ThresholdCountMin}, 1},
+		{Threshold{CountType: ThresholdCountMax}, 10},
+		{Threshold{CountType: ThresholdCountPercentile, Percentile: 50}, 5.5},
+		{Threshold{CountType: ThresholdCountPercentile, Percentile: 90}, 9.1},
+		{Threshold{CountType: ThresholdCountPercentile, Percentile: 100}, 10},
+	} {
+		if got := thresholdStat(&tt.threshold, append([]float64(nil), values...)); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Fatalf("%s p%g: got %g, want %g", tt.threshold.CountType, tt.threshold.Percentile, got, tt.want)
+		}
+	}
+}
+
+func TestThresholdStats_Parse(t *testing.T) {
+	rs := buildRulesetFromXML(t, `<root type="DETECTION"><rule id="r1"><threshold group_by="user" range="1h" count_type="PERCENTILE" count_field="ms">2KB</threshold></rule></root>`)
+	for _, threshold := range rs.Rules[0].ThresholdMap {
+		if threshold.Value != 2048 || threshold.Percentile != defaultThresholdPercentile {
+			t.Fatalf("unexpected threshold %+v", threshold)
+		}
+	}
+
+	for _, bad := range []string{
+		`<threshold group_by="user" range="1h" count_type="AVG">5</threshold>`,
+		`<threshold group_by="user" range="1h" count_type="MEDIAN" count_field="ms">5</threshold>`,
+		`<threshold group_by="user" range="1h" count_type="MAX" count_field="ms" percentile="99">5</threshold>`,
+		`<threshold group_by="user" range="1h" count_type="PERCENTILE" count_field="ms" percentile="101">5</threshold>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
+
+func testThresholdStats(t *testing.T, localCache string) {
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="avg">
+    <threshold group_by="user" range="1h" count_type="AVG" count_field="ms" local_cache="`+localCache+`">100</threshold>
+  </rule>
+  <rule id="p90">
+    <threshold group_by="user" range="1h" window="sliding" count_type="PERCENTILE" percentile="90" count_field="ms" local_cache="`+localCache+`">600</threshold>
+  </rule>
+</root>`)
+	fired := func(user string, ms interface{}) []string {
+		var ids []string
+		for _, res := range rs.EngineCheck(map[string]interface{}{"user": user, "ms": ms}) {
+			ids = append(ids, res[HitRuleIdFieldName].(string))
+		}
+		return ids
+	}
+
+	// Average 50, then 100 reaching but not exceeding 100; values that are not numbers are ignored
+	for _, ms := range []interface{}{50, "n/a", 150} {
+		if ids := fired("alice", ms); len(ids) != 0 {
+			t.Fatalf("unexpected hits %v at %v", ids, ms)
+		}
+	}
+	if ids := fired("alice", 250); len(ids) != 1 || ids[0] != "TEST.RS.avg" {
+		t.Fatalf("expected avg to fire, got %v", ids)
+	}
+	// The window starts over once fired
+	if ids := fired("alice", 90); len(ids) != 0 {
+		t.Fatalf("unexpected hits %v after reset", ids)
+	}
+
+	// Nine fast requests then slow ones: p90 of 10 values is 509, of 11 values the slowest
+	for i := 0; i < 9; i++ {
+		fired("bob", 10)
+	}
+	if ids := fired("bob", 5000); len(ids) != 1 || ids[0] != "TEST.RS.avg" {
+		t.Fatalf("expected only avg to fire, got %v", ids)
+	}
+	if ids := fired("bob", 5000); len(ids) != 2 {
+		t.Fatalf("expected avg and p90 to fire, got %v", ids)
+	}
+}
+
+func TestThresholdStats_Local(t *testing.T) {
+	testThresholdStats(t, "true")
+}
+
+func TestThresholdStats_Redis(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	testThresholdStats(t, "false")
+}
@@ -0,0 +1,69 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestThresholdValueRef(t *testing.T) {
+	if err := common.RedisInitLite(filepath.Join(t.TempDir(), "lite.snapshot")); err != nil {
+		t.Skipf("embedded store unavailable: %v", err)
+	}
+	defer common.DeleteThresholdValue("thresholds/login_failures")
+	defer common.DeleteThresholdValue("thresholds/unset_default")
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="with_default">
+    <threshold group_by="user" range="1h" local_cache="true" value_ref="redis:thresholds/login_failures">2</threshold>
+  </rule>
+  <rule id="without_default">
+    <threshold group_by="user" range="1h" local_cache="true" value_ref="redis:thresholds/unset_default"/>
+  </rule>
+</root>`)
+	hits := func(user string) string {
+		var ids []string
+		for _, res := range rs.EngineCheck(map[string]interface{}{"user": user}) {
+			ids = append(ids, strings.TrimPrefix(res[HitRuleIdFieldName].(string), "TEST.RS."))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// The element value applies until a value is set, a threshold without one never fires
+	for i, want := range []string{"", "", "with_default"} {
+		if got := hits("alice"); got != want {
+			t.Fatalf("event %d: got hits %q, want %q", i, got, want)
+		}
+	}
+
+	if err := common.SetThresholdValue("thresholds/login_failures", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.SetThresholdValue("thresholds/unset_default", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := hits("bob"); got != "" {
+		t.Fatalf("got hits %q on the first event", got)
+	}
+	if got := hits("bob"); got != "with_default,without_default" {
+		t.Fatalf("got hits %q after setting the values", got)
+	}
+	if v, ok := common.GetThresholdValue("thresholds/login_failures"); !ok || v != 1 {
+		t.Fatalf("unexpected value %d, %v", v, ok)
+	}
+
+	for _, tt := range []struct {
+		xml, err string
+	}{
+		{`<threshold group_by="u" range="1h" value_ref="thresholds/x">3</threshold>`, "value_ref must start with 'redis:'"},
+		{`<threshold group_by="u" range="1h" value_ref="redis:bad name">3</threshold>`, "invalid threshold value_ref"},
+		{`<threshold group_by="u" range="1h"/>`, "threshold value is required"},
+	} {
+		_, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r">` + tt.xml + `</rule></root>`))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"AgentSmith-HUB/logger"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Threshold windows
+const (
+	// ThresholdWindowFixed starts counting at the first event of a group and resets after range
+	ThresholdWindowFixed = "fixed"
+	// ThresholdWindowSliding counts the events of the last range before each event
+	ThresholdWindowSliding = "sliding"
+	// ThresholdWindowTumbling counts in consecutive windows of range aligned to the unix epoch
+	ThresholdWindowTumbling = "tumbling"
+)
+
+// slidingSweepEvery is the number of local sliding window updates between two sweeps of the
+// windows of inactive groups
+const slidingSweepEvery = 1024
+
+var slidingMemberSeq atomic.Uint64
+
+// thresholdWindowError returns why the window settings of a threshold are invalid, "" if valid
+func thresholdWindowError(threshold *Threshold) string {
+	switch threshold.Window {
+	case "", ThresholdWindowFixed:
+		if strings.TrimSpace(threshold.TimeField) != "" {
+			return "threshold time_field requires window 'sliding' or 'tumbling'"
+		}
+	case ThresholdWindowSliding, ThresholdWindowTumbling:
+	default:
+		return "threshold window must be 'fixed', 'sliding' or 'tumbling', got '" + threshold.Window + "'"
+	}
+	return ""
+}
+
+// prepareThresholdWindow checks the window settings of a threshold and parses its time field
+func prepareThresholdWindow(threshold *Threshold, ruleID string) error {
+	if msg := thresholdWindowError(threshold); msg != "" {
+		return errors.New(msg + ", rule id: " + ruleID)
+	}
+	if threshold.Window == "" {
+		threshold.Window = ThresholdWindowFixed
+	}
+	threshold.TimeFieldList = nil
+	if field := strings.TrimSpace(threshold.TimeField); field != "" {
+		threshold.TimeFieldList = common.StringToList(field)
+	}
+	return nil
+}
+
+// thresholdTime returns the time an event is counted at: the value of the time field with event
+// time, the current time with processing time or when the field is missing or invalid
+func thresholdTime(threshold *Threshold, data map[string]interface{}) time.Time {
+	return eventTime(threshold.TimeFieldList, data)
+}
+
+// eventTime returns the value of the time field, the current time when there is no time field or
+// its value is missing or invalid
+func eventTime(timeFieldList []string, data map[string]interface{}) time.Time {
+	if timeFieldList != nil {
+		if v, ok := common.GetCheckDataWithType(data, timeFieldList); ok {
+			if t, ok := common.ParseEventTime(v); ok {
+				return t
+			}
+		}
+	}
+	return time.Now()
+}
+
+// tumblingWindow returns the window an event time falls in and the TTL of its counters in
+// seconds. With event time the counters live one more range to count late events.
+func tumblingWindow(threshold *Threshold, ts time.Time) (int64, int) {
+	rangeInt := int64(max(threshold.RangeInt, 1))
+	window := ts.Unix() / rangeInt
+	if threshold.TimeFieldList != nil {
+		return window, int(2 * rangeInt)
+	}
+	return window, int(max((window+1)*rangeInt-ts.Unix(), 1))
+}
+
+// slidingTTL returns how long the window of an idle group is kept, in seconds
+func slidingTTL(threshold *Threshold) int {
+	if threshold.TimeFieldList != nil {
+		return 2 * threshold.RangeInt
+	}
+	return threshold.RangeInt
+}
+
+// slidingMember returns a unique sorted set member of a counted or summed event
+func slidingMember(ts time.Time, value int) string {
+	return strconv.FormatInt(ts.UnixNano(), 36) + ":" + strconv.FormatUint(slidingMemberSeq.Add(1), 36) + ":" + strconv.Itoa(value)
+}
+
+// RedisFRQSliding counts in a sliding window using a Redis sorted set scored by event time in
+// milliseconds. With an empty member the event adds value to the window (count and sum), else
+// the member is a distinct value (classify).
+// Returns: true if the total of the window ending at ts exceeds threshold, and that total
+func RedisFRQSliding(groupByKey string, member string, value int, ts time.Time, rangeInt int, ttl int, threshold int) (bool, int, error) {
+	score := float64(ts.UnixMilli())
+	start := score - float64(rangeInt)*1000
+	withMembers := member == "" && value != 1
+	if member == "" {
+		member = slidingMember(ts, value)
+	}
+	count, members, err := common.RedisZWindowAdd(groupByKey, score, member, start, score, ttl, withMembers)
+	if err != nil {
+		return false, 0, err
+	}
+	total := int(count)
+	if withMembers {
+		total = 0
+		for _, m := range members {
+			if i := strings.LastIndexByte(m, ':'); i >= 0 {
+				v, _ := strconv.Atoi(m[i+1:])
+				total += v
+			}
+		}
+	}
+	if total > threshold {
+		if err := common.RedisDel(groupByKey); err != nil {
+			logger.Error("failed to delete Redis key %s: %v", groupByKey, err)
+		}
+		return true, total, nil
+	}
+	return false, total, nil
+}
+
+type slidingEntry struct {
+	ts     int64 // event time in milliseconds
+	value  int
+	member string
+}
+
+type slidingWindow struct {
+	entries []slidingEntry
+	expires time.Time
+}
+
+// LocalCacheFRQSliding is RedisFRQSliding on the memory of this node
+func (r *Ruleset) LocalCacheFRQSliding(groupByKey string, member string, value int, ts time.Time, rangeInt int, ttl int, threshold int) (bool, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.slidingWindows == nil {
+		r.slidingWindows = make(map[string]*slidingWindow)
+	}
+	r.slidingUpdates++
+	if r.slidingUpdates%slidingSweepEvery == 0 {
+		for k, w := range r.slidingWindows {
+			if now.After(w.expires) {
+				delete(r.slidingWindows, k)
+			}
+		}
+	}
+
+	w, ok := r.slidingWindows[groupByKey]
+	if !ok || now.After(w.expires) {
+		w = &slidingWindow{}
+		r.slidingWindows[groupByKey] = w
+	}
+	w.expires = now.Add(time.Duration(ttl) * time.Second)
+
+	at := ts.UnixMilli()
+	start := at - int64(rangeInt)*1000
+	kept := w.entries[:0]
+	found := false
+	for _, e := range w.entries {
+		if e.ts <= start {
+			continue
+		}
+		if member != "" && e.member == member {
+			e.ts = at
+			found = true
+		}
+		kept = append(kept, e)
+	}
+	if !found {
+		kept = append(kept, slidingEntry{ts: at, value: value, member: member})
+	}
+	w.entries = kept
+
+	total := 0
+	for _, e := range w.entries {
+		if e.ts > at {
+			continue
+		}
+		if member != "" {
+			total++
+		} else {
+			total += e.value
+		}
+	}
+	if total > threshold {
+		delete(r.slidingWindows, groupByKey)
+		return true, total, nil
+	}
+	return false, total, nil
+}
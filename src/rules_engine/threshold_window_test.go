@@ -0,0 +1,72 @@
+package rules_engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThresholdWindow_Parse(t *testing.T) {
+	xml := `<root type="DETECTION"><rule id="r1"><threshold group_by="ip" range="10m" window="sliding" time_field="ts">5</threshold></rule></root>`
+	rs, err := ParseRuleset([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseRuleset error: %v", err)
+	}
+	for _, threshold := range rs.Rules[0].ThresholdMap {
+		if threshold.Window != ThresholdWindowSliding || threshold.TimeField != "ts" {
+			t.Fatalf("unexpected threshold %+v", threshold)
+		}
+	}
+
+	for _, bad := range []string{
+		`<threshold group_by="ip" range="10m" window="hopping">5</threshold>`,
+		`<threshold group_by="ip" range="10m" time_field="ts">5</threshold>`,
+	} {
+		xml := `<root type="DETECTION"><rule id="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
+
+func TestThresholdWindow_LocalSliding(t *testing.T) {
+	r := &Ruleset{}
+	base := time.Unix(1_700_000_000, 0)
+
+	// 3 events within 10s never reset at a boundary, the 4th exceeds 3
+	for i, offset := range []int{0, 4, 8} {
+		fired, count, _ := r.LocalCacheFRQSliding("k", "", 1, base.Add(time.Duration(offset)*time.Second), 10, 20, 3)
+		if fired || count != i+1 {
+			t.Fatalf("event %d: fired=%v count=%d", i, fired, count)
+		}
+	}
+	// 12s: the event at 0s left the window
+	if fired, count, _ := r.LocalCacheFRQSliding("k", "", 1, base.Add(12*time.Second), 10, 20, 3); fired || count != 3 {
+		t.Fatalf("expected 3 events in window, got fired=%v count=%d", fired, count)
+	}
+	if fired, _, _ := r.LocalCacheFRQSliding("k", "", 1, base.Add(13*time.Second), 10, 20, 3); !fired {
+		t.Fatalf("expected threshold to fire")
+	}
+
+	// Distinct values count once
+	for _, member := range []string{"a", "b", "a"} {
+		if fired, _, _ := r.LocalCacheFRQSliding("c", member, 1, base, 10, 20, 2); fired {
+			t.Fatalf("unexpected fire for %s", member)
+		}
+	}
+	if fired, count, _ := r.LocalCacheFRQSliding("c", "c", 1, base, 10, 20, 2); !fired || count != 3 {
+		t.Fatalf("expected 3 distinct values to fire, got fired=%v count=%d", fired, count)
+	}
+}
+
+func TestThresholdWindow_Tumbling(t *testing.T) {
+	threshold := &Threshold{RangeInt: 60}
+	w1, ttl := tumblingWindow(threshold, time.Unix(1_700_000_050, 0))
+	w2, _ := tumblingWindow(threshold, time.Unix(1_700_000_099, 0))
+	w3, _ := tumblingWindow(threshold, time.Unix(1_700_000_100, 0))
+	if w1 != w2 || w2 == w3 {
+		t.Fatalf("unexpected windows %d %d %d", w1, w2, w3)
+	}
+	if ttl != 50 {
+		t.Fatalf("expected ttl to the end of the window, got %d", ttl)
+	}
+}
@@ -0,0 +1,227 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minutesPerDay is the exclusive end of a time of day, 24:00 closes a window at midnight
+const minutesPerDay = 24 * 60
+
+// timeWindow is a window of the day in minutes, end exclusive. A window whose end is before its
+// start wraps midnight.
+type timeWindow struct {
+	start int
+	end   int
+}
+
+// TimeSchedule is the parsed value of a TIME check: days of the week, windows of the day, a
+// timezone and holiday calendars whose days are outside the schedule
+type TimeSchedule struct {
+	days     [7]bool // indexed by time.Weekday
+	windows  []timeWindow
+	location *time.Location
+	holidays []*common.HolidayCalendar
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseTimeSchedule parses the space separated value of a TIME check, such as
+// "Mon-Fri 08:00-18:00 tz=Europe/Paris holidays=fr". It accepts:
+//   - days: names or ranges separated by commas (Mon-Fri, Sat,Sun), weekdays or weekends
+//   - windows: HH:MM-HH:MM separated by commas (08:00-12:00,13:00-17:00), 22:00-06:00 wraps midnight
+//   - tz=<IANA timezone>, UTC by default
+//   - holidays=<calendars of holiday_calendars in config.yaml, separated by commas>
+//
+// Every day and the whole day are in the schedule unless days or windows are given.
+func ParseTimeSchedule(value string) (*TimeSchedule, error) {
+	s := &TimeSchedule{location: time.UTC}
+	hasDays := false
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("TIME value cannot be empty")
+	}
+	for _, field := range fields {
+		key, arg, isOption := strings.Cut(field, "=")
+		switch {
+		case isOption && strings.EqualFold(key, "tz"):
+			loc, err := time.LoadLocation(arg)
+			if err != nil || arg == "" {
+				return nil, fmt.Errorf("unknown timezone %q", arg)
+			}
+			s.location = loc
+		case isOption && strings.EqualFold(key, "holidays"):
+			for _, name := range strings.Split(arg, ",") {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				cal, ok := common.GetHolidayCalendar(name)
+				if !ok {
+					return nil, fmt.Errorf("holiday calendar not found: %s, expected a calendar of holiday_calendars in config.yaml", name)
+				}
+				s.holidays = append(s.holidays, cal)
+			}
+		case isOption:
+			return nil, fmt.Errorf("unknown TIME option %q, expected tz or holidays", key)
+		case strings.Contains(field, ":"):
+			for _, w := range strings.Split(field, ",") {
+				window, err := parseTimeWindow(w)
+				if err != nil {
+					return nil, err
+				}
+				s.windows = append(s.windows, window)
+			}
+		default:
+			if err := s.parseDays(field); err != nil {
+				return nil, err
+			}
+			hasDays = true
+		}
+	}
+	if !hasDays {
+		for i := range s.days {
+			s.days[i] = true
+		}
+	}
+	return s, nil
+}
+
+func (s *TimeSchedule) parseDays(field string) error {
+	for _, part := range strings.Split(strings.ToLower(field), ",") {
+		switch part {
+		case "":
+			continue
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				s.days[d] = true
+			}
+			continue
+		case "weekends":
+			s.days[time.Saturday], s.days[time.Sunday] = true, true
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("unknown day %q, expected names such as Mon or Monday, weekdays or weekends", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("unknown day %q, expected names such as Mon or Monday, weekdays or weekends", to)
+			}
+		}
+		// Fri-Mon wraps the end of the week
+		for d := first; ; d = (d + 1) % 7 {
+			s.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeWindow(w string) (timeWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(w), "-")
+	if !ok {
+		return timeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", w)
+	}
+	start, err := parseTimeOfDay(from)
+	if err != nil || start == minutesPerDay {
+		return timeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", w)
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil || end == start {
+		return timeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM with different times", w)
+	}
+	return timeWindow{start: start, end: end}, nil
+}
+
+func parseTimeOfDay(v string) (int, error) {
+	h, m, ok := strings.Cut(v, ":")
+	if !ok || len(m) != 2 || len(h) == 0 || len(h) > 2 {
+		return 0, fmt.Errorf("invalid time %q", v)
+	}
+	hours, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, err
+	}
+	total := hours*60 + minutes
+	if hours < 0 || minutes < 0 || minutes > 59 || total > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q", v)
+	}
+	return total, nil
+}
+
+// Contains reports whether t is in the schedule. The part of a window after midnight belongs to
+// the day it started, so Fri 22:00-06:00 includes Saturday 03:00.
+func (s *TimeSchedule) Contains(t time.Time) bool {
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	if len(s.windows) == 0 {
+		return s.onDay(t)
+	}
+	for _, w := range s.windows {
+		switch {
+		case w.start < w.end:
+			if minute >= w.start && minute < w.end && s.onDay(t) {
+				return true
+			}
+		case minute >= w.start:
+			if s.onDay(t) {
+				return true
+			}
+		case minute < w.end:
+			if s.onDay(t.AddDate(0, 0, -1)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onDay reports whether the date of t is a day of the schedule and not a holiday
+func (s *TimeSchedule) onDay(t time.Time) bool {
+	if !s.days[t.Weekday()] {
+		return false
+	}
+	for _, cal := range s.holidays {
+		if cal.Contains(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTime evaluates a TIME check against the time in its field, or the current time when the
+// check has no field. A value that is not a timestamp never matches.
+func checkTime(checkNode *CheckNodes, data map[string]interface{}) bool {
+	if checkNode.Schedule == nil {
+		return false
+	}
+	if checkNode.FieldList == nil {
+		return checkNode.Schedule.Contains(time.Now())
+	}
+	v, ok := common.GetCheckDataWithType(data, checkNode.FieldList)
+	if !ok {
+		return false
+	}
+	t, ok := common.ParseEventTime(v)
+	return ok && checkNode.Schedule.Contains(t)
+}
@@ -0,0 +1,124 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"testing"
+	"time"
+)
+
+func TestTimeSchedule_Contains(t *testing.T) {
+	common.InitHolidayCalendars(common.HolidayCalendarsConfig{
+		"fr": {"12-25", "2026-11-11", "2026-12-28..2026-12-31"},
+	})
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", value, paris)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		schedule string
+		times    map[string]bool
+	}{
+		{"Mon-Fri 08:00-18:00 tz=Europe/Paris holidays=fr", map[string]bool{
+			"2026-10-14 08:00": true,  // Wednesday
+			"2026-10-14 17:59": true,  // end is exclusive
+			"2026-10-14 18:00": false, // end is exclusive
+			"2026-10-14 07:59": false,
+			"2026-10-17 10:00": false, // Saturday
+			"2026-11-11 10:00": false, // holiday
+			"2026-12-25 10:00": false, // yearly holiday
+			"2026-12-29 10:00": false, // range of holidays
+			"2027-01-04 10:00": true,
+		}},
+		{"Fri 22:00-06:00 tz=Europe/Paris", map[string]bool{
+			"2026-10-16 23:00": true,  // Friday night
+			"2026-10-17 03:00": true,  // still Friday's window
+			"2026-10-17 23:00": false, // Saturday night
+			"2026-10-16 03:00": false, // Thursday's night
+		}},
+		{"weekends tz=Europe/Paris", map[string]bool{
+			"2026-10-18 00:00": true,
+			"2026-10-19 00:00": false,
+		}},
+		{"Sat-Mon 08:00-12:00,14:00-24:00 tz=Europe/Paris", map[string]bool{
+			"2026-10-19 23:59": true,
+			"2026-10-19 13:00": false,
+			"2026-10-20 09:00": false, // Tuesday
+		}},
+	}
+	for _, tt := range tests {
+		s, err := ParseTimeSchedule(tt.schedule)
+		if err != nil {
+			t.Fatalf("ParseTimeSchedule(%q) error: %v", tt.schedule, err)
+		}
+		for value, want := range tt.times {
+			if got := s.Contains(at(value)); got != want {
+				t.Errorf("%q contains %s = %v, want %v", tt.schedule, value, got, want)
+			}
+		}
+	}
+
+	// UTC by default
+	s, _ := ParseTimeSchedule("09:00-10:00")
+	if !s.Contains(time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)) || s.Contains(at("2026-10-14 09:30")) {
+		t.Fatal("schedule without tz must use UTC")
+	}
+
+	for _, bad := range []string{
+		"",
+		"Mon-Funday",
+		"8-18",
+		"08:00",
+		"08:00-08:00",
+		"25:00-26:00",
+		"tz=Mars/Olympus",
+		"holidays=unknown",
+		"color=red",
+	} {
+		if _, err := ParseTimeSchedule(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+	if err := (common.HolidayCalendarsConfig{"x": {"2026-13-01"}}).Validate(); err == nil {
+		t.Fatal("expected an invalid holiday error")
+	}
+}
+
+func TestTimeCheck_Rule(t *testing.T) {
+	xml := `<root type="DETECTION" name="time"><rule id="r1" name="r1">
+		<check type="EQU" field="role">admin</check>
+		<not><check type="TIME" field="ts">Mon-Fri 08:00-18:00 tz=UTC</check></not>
+	</rule></root>`
+	rs := buildRulesetFromXML(t, xml)
+	run := func(event map[string]interface{}) bool {
+		return len(rs.EngineCheck(event)) == 1
+	}
+	if run(map[string]interface{}{"role": "admin", "ts": "2026-10-14T09:00:00Z"}) {
+		t.Fatal("admin login in business hours must not match")
+	}
+	if !run(map[string]interface{}{"role": "admin", "ts": "2026-10-14T21:00:00Z"}) {
+		t.Fatal("admin login after hours must match")
+	}
+	if !run(map[string]interface{}{"role": "admin", "ts": float64(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC).UnixMilli())}) {
+		t.Fatal("admin login on Saturday must match")
+	}
+
+	if _, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r1"><check type="TIME" field="ts"></check></rule></root>`)); err == nil {
+		t.Fatal("expected parse error for an empty TIME check")
+	}
+	if err := processCheckNode(&CheckNodes{Type: "TIME", Value: "Mon 08:00-09:00", Logic: "OR", Delimiter: "|"}, nil, "r1"); err == nil {
+		t.Fatal("expected an error for TIME with logic")
+	}
+	node := &CheckNodes{Type: "TIME", Value: "Mon-Sun 00:00-24:00"}
+	if err := processCheckNode(node, nil, "r1"); err != nil || !checkTime(node, nil) {
+		t.Fatalf("a check without field must use the current time, err %v", err)
+	}
+}
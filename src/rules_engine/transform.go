@@ -0,0 +1,136 @@
+package rules_engine
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// transformFunc converts a value, it returns false when the value cannot be converted
+type transformFunc func(string) (string, bool)
+
+// transformFuncs are the functions of TRANSFORM appends
+var transformFuncs = map[string]transformFunc{
+	"lower": func(s string) (string, bool) { return strings.ToLower(s), true },
+	"upper": func(s string) (string, bool) { return strings.ToUpper(s), true },
+	"trim":  func(s string) (string, bool) { return strings.TrimSpace(s), true },
+	"md5": func(s string) (string, bool) {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	},
+	"sha1": func(s string) (string, bool) {
+		sum := sha1.Sum([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	},
+	"sha256": func(s string) (string, bool) {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	},
+	"sha512": func(s string) (string, bool) {
+		sum := sha512.Sum512([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	},
+	"base64_encode": func(s string) (string, bool) { return base64.StdEncoding.EncodeToString([]byte(s)), true },
+	"base64_decode": base64Decode,
+	"hex_encode":    func(s string) (string, bool) { return hex.EncodeToString([]byte(s)), true },
+	"hex_decode":    hexDecode,
+	"url_encode":    func(s string) (string, bool) { return url.QueryEscape(s), true },
+	"url_decode":    urlDecode,
+	"utf16_decode":  utf16Decode,
+}
+
+// base64Decode accepts the standard and URL alphabets, with or without padding
+func base64Decode(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return string(b), true
+		}
+	}
+	return "", false
+}
+
+func hexDecode(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// urlDecode decodes %XX escapes and + as a space
+func urlDecode(s string) (string, bool) {
+	decoded, err := url.QueryUnescape(s)
+	return decoded, err == nil
+}
+
+// utf16Decode decodes UTF-16LE text, such as a decoded PowerShell -EncodedCommand
+func utf16Decode(s string) (string, bool) {
+	b := []byte(s)
+	if len(b)%2 != 0 {
+		return "", false
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	if len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// parseTransform parses the value of a TRANSFORM append, a source and functions separated by |
+// such as "_$cmdline | base64_decode | utf16_decode | lower". The source is a _$ field reference
+// or a template with _$ placeholders.
+func parseTransform(value string) (string, []transformFunc, error) {
+	parts := strings.Split(value, "|")
+	source := strings.TrimSpace(parts[0])
+	if source == "" {
+		return "", nil, fmt.Errorf("TRANSFORM source cannot be empty")
+	}
+	if len(parts) == 1 {
+		return "", nil, fmt.Errorf("TRANSFORM needs at least one function after the source, such as %s | sha256", source)
+	}
+	funcs := make([]transformFunc, 0, len(parts)-1)
+	for _, name := range parts[1:] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		fn, ok := transformFuncs[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown TRANSFORM function '%s', expected one of %s", name, strings.Join(transformFuncNames(), ", "))
+		}
+		funcs = append(funcs, fn)
+	}
+	return source, funcs, nil
+}
+
+func transformFuncNames() []string {
+	names := make([]string, 0, len(transformFuncs))
+	for name := range transformFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyTransforms runs the functions in order, it returns false when one of them fails
+func applyTransforms(value string, funcs []transformFunc) (string, bool) {
+	for _, fn := range funcs {
+		var ok bool
+		if value, ok = fn(value); !ok {
+			return "", false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,99 @@
+package rules_engine
+
+import (
+	"encoding/base64"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestTransform_Functions(t *testing.T) {
+	// PowerShell -EncodedCommand is base64 of UTF-16LE text
+	units := utf16.Encode([]rune("IEX (New-Object Net.WebClient)"))
+	raw := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		raw = append(raw, byte(u), byte(u>>8))
+	}
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		value string
+		chain string
+		want  string
+		ok    bool
+	}{
+		{"  Admin ", "trim | lower", "admin", true},
+		{"abc", "md5", "900150983cd24fb0d6963f7d28e17f72", true},
+		{"abc", "sha1", "a9993e364706816aba3e25717850c26c9cd0d89d", true},
+		{"abc", "SHA256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", true},
+		{"hello", "base64_encode | base64_decode", "hello", true},
+		{"aGVsbG8", "base64_decode", "hello", true},
+		{"not base64!", "base64_decode", "", false},
+		{"0x68656c6c6f", "hex_decode | upper", "HELLO", true},
+		{"zz", "hex_decode", "", false},
+		{"a%20b+c%2Fd", "url_decode", "a b c/d", true},
+		{"%zz", "url_decode", "", false},
+		{"a b/c", "url_encode", "a+b%2Fc", true},
+		{"hi", "hex_encode", "6869", true},
+		{encoded, "base64_decode | utf16_decode | lower", "iex (new-object net.webclient)", true},
+	}
+	for _, tt := range tests {
+		_, funcs, err := parseTransform("_$x | " + tt.chain)
+		if err != nil {
+			t.Fatalf("parseTransform(%q) error: %v", tt.chain, err)
+		}
+		got, ok := applyTransforms(tt.value, funcs)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%q | %s = %q, %v, want %q, %v", tt.value, tt.chain, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for _, bad := range []string{"", "_$x", "| lower", "_$x | rot13", "_$x | lower |"} {
+		if _, _, err := parseTransform(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestTransform_Append(t *testing.T) {
+	xml := `
+<root type="DETECTION" name="transform">
+  <rule id="r1" name="r1">
+    <check type="NOTNULL" field="user"></check>
+    <append type="TRANSFORM" field="user_hash">_$user | trim | lower | sha256</append>
+    <append type="TRANSFORM" field="decoded">_$payload | base64_decode</append>
+    <append type="TRANSFORM" field="key">_$user@_$host | lower</append>
+  </rule>
+ </root>`
+	rs := buildRulesetFromXML(t, xml)
+
+	out := rs.EngineCheck(map[string]interface{}{"user": " Alice ", "host": "WS01", "payload": "aGVsbG8="})
+	if len(out) != 1 {
+		t.Fatalf("expected one result, got %d", len(out))
+	}
+	if out[0]["user_hash"] != "2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90" {
+		t.Fatalf("unexpected user_hash %v", out[0]["user_hash"])
+	}
+	if out[0]["decoded"] != "hello" || out[0]["key"] != " alice @ws01" {
+		t.Fatalf("unexpected result %v", out[0])
+	}
+
+	// Nothing is appended for a missing field or a value a function cannot convert
+	out = rs.EngineCheck(map[string]interface{}{"user": "bob", "payload": "%%%"})
+	if len(out) != 1 {
+		t.Fatalf("expected one result, got %d", len(out))
+	}
+	if _, ok := out[0]["decoded"]; ok {
+		t.Fatalf("invalid base64 must not be appended: %v", out[0])
+	}
+
+	for _, bad := range []string{
+		`<append type="TRANSFORM" field="x">_$user | rot13</append>`,
+		`<append type="TRANSFORM" field="x">_$user</append>`,
+		`<append type="TRANSFORM" field="x"></append>`,
+	} {
+		xml := `<root type="DETECTION" name="bad"><rule id="r1" name="r1">` + bad + `</rule></root>`
+		if _, err := ParseRuleset([]byte(xml)); err == nil {
+			t.Fatalf("expected parse error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// validationCacheVersion changes when the format of the entries or the validation changes
+	validationCacheVersion = 1
+	// validationCacheMaxAge is the age after which entries that were not used are removed
+	validationCacheMaxAge = 30 * 24 * time.Hour
+	// validationCacheMaxEntries bounds the entries kept in memory
+	validationCacheMaxEntries = 4096
+)
+
+// validationCacheEntry is the content of a cache file
+type validationCacheEntry struct {
+	Version int
+	Rules   int
+	Created time.Time
+}
+
+// validationCache remembers the ruleset sources that passed validation, parsing and building, so
+// starting a node or applying a change skips ValidateWithDetails for them. Entries are keyed by the
+// sha256 of the build of the hub and the source, a changed source or binary is a miss.
+//
+// Only the validation is skipped: compiled regexes, plugins and scripts cannot be stored, so
+// ParseRuleset and RulesetBuild always run and still fail on what depends on the node, such as a
+// missing plugin.
+type validationCache struct {
+	mu      sync.RWMutex
+	dir     string
+	build   string
+	entries map[string]struct{}
+}
+
+var rulesetValidationCache = &validationCache{
+	build:   buildIdentity(),
+	entries: make(map[string]struct{}),
+}
+
+// InitValidationCache keeps the validated rulesets in dir, so they survive a restart. Entries older
+// than 30 days are removed.
+func InitValidationCache(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create ruleset validation cache directory: %w", err)
+	}
+	rulesetValidationCache.mu.Lock()
+	rulesetValidationCache.dir = dir
+	rulesetValidationCache.mu.Unlock()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read ruleset validation cache directory: %w", err)
+	}
+	removed := 0
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || f.IsDir() || time.Since(info.ModTime()) < validationCacheMaxAge {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, f.Name())) == nil {
+			removed++
+		}
+	}
+	logger.Info("Ruleset validation cache initialized", "dir", dir, "entries", len(files)-removed, "removed", removed)
+	return nil
+}
+
+// buildIdentity identifies the binary, a new build may validate differently
+func buildIdentity() string {
+	id := fmt.Sprintf("v%d", validationCacheVersion)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				id += ":" + s.Value
+			}
+		}
+		if strings.Contains(id, ":") {
+			return id
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if st, err := os.Stat(exe); err == nil {
+			id += fmt.Sprintf(":%d:%d", st.ModTime().UnixNano(), st.Size())
+		}
+	}
+	return id
+}
+
+func (c *validationCache) key(raw string) string {
+	h := sha256.New()
+	h.Write([]byte(c.build))
+	h.Write([]byte{0})
+	h.Write([]byte(raw))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// has reports whether raw was validated before, by this node or before its restart
+func (c *validationCache) has(raw string) bool {
+	if raw == "" {
+		return false
+	}
+	key := c.key(raw)
+	c.mu.RLock()
+	_, ok := c.entries[key]
+	dir := c.dir
+	c.mu.RUnlock()
+	if ok || dir == "" {
+		return ok
+	}
+
+	path := filepath.Join(dir, key+".bin")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var entry validationCacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil || entry.Version != validationCacheVersion {
+		_ = os.Remove(path)
+		return false
+	}
+	// Used entries are kept
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.remember(key)
+	return true
+}
+
+// add records that raw passed the validation
+func (c *validationCache) add(raw string, rules int) {
+	if raw == "" {
+		return
+	}
+	key := c.key(raw)
+	c.remember(key)
+
+	c.mu.RLock()
+	dir := c.dir
+	c.mu.RUnlock()
+	if dir == "" {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(validationCacheEntry{Version: validationCacheVersion, Rules: rules, Created: time.Now()}); err != nil {
+		return
+	}
+	// Write then rename, a reader never sees a partial entry
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		logger.Warn("Failed to write ruleset validation cache entry", "error", err)
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, key+".bin"))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		logger.Warn("Failed to write ruleset validation cache entry", "error", err)
+	}
+}
+
+func (c *validationCache) remember(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= validationCacheMaxEntries {
+		c.entries = make(map[string]struct{})
+	}
+	c.entries[key] = struct{}{}
+}
@@ -0,0 +1,102 @@
+package rules_engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidationCache(t *testing.T) {
+	saved := rulesetValidationCache
+	rulesetValidationCache = &validationCache{build: "test", entries: make(map[string]struct{})}
+	defer func() { rulesetValidationCache = saved }()
+
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.bin")
+	if err := os.WriteFile(stale, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * validationCacheMaxAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitValidationCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected the stale entry to be removed, got %v", err)
+	}
+
+	raw := `<root type="DETECTION"><rule id="r1"><check type="EQU" field="a">b</check></rule></root>`
+	if rulesetValidationCache.has(raw) {
+		t.Fatal("unexpected hit before verification")
+	}
+	rs, err := NewRuleset("", raw, "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rules) != 1 || rs.RawConfig != raw {
+		t.Fatalf("unexpected ruleset %d rules", len(rs.Rules))
+	}
+
+	// A restart only has the entries on disk
+	rulesetValidationCache.entries = make(map[string]struct{})
+	if !rulesetValidationCache.has(raw) {
+		t.Fatal("expected the entry to be loaded from disk")
+	}
+	if err := Verify("", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another build of the hub does not use the entries
+	rulesetValidationCache = &validationCache{dir: dir, build: "other", entries: make(map[string]struct{})}
+	if rulesetValidationCache.has(raw) {
+		t.Fatal("unexpected hit for another build")
+	}
+
+	// Rulesets failing verification are not recorded
+	bad := `<root type="DETECTION"><rule id="r1"><check type="NOPE" field="a">b</check></rule></root>`
+	if err := Verify("", bad); err == nil {
+		t.Fatal("expected verification error")
+	}
+	if rulesetValidationCache.has(bad) {
+		t.Fatal("unexpected hit for an invalid ruleset")
+	}
+	path := filepath.Join(dir, rulesetValidationCache.key(raw)+".bin")
+	if err := os.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rulesetValidationCache.has(raw) {
+		t.Fatal("unexpected hit for a corrupt entry")
+	}
+}
+
+func TestValidationCacheFromPath(t *testing.T) {
+	saved := rulesetValidationCache
+	rulesetValidationCache = &validationCache{build: "test", entries: make(map[string]struct{})}
+	defer func() { rulesetValidationCache = saved }()
+
+	if err := InitValidationCache(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	raw := `<root type="DETECTION"><rule id="r1"><check type="EQU" field="a">b</check></rule></root>`
+	path := filepath.Join(t.TempDir(), "from_path.xml")
+	if err := os.WriteFile(path, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry is keyed on the file content, not on the empty raw argument
+	if _, err := NewRuleset(path, "", "from_path"); err != nil {
+		t.Fatal(err)
+	}
+	if !rulesetValidationCache.has(raw) {
+		t.Fatal("expected the file content to be recorded")
+	}
+	if rulesetValidationCache.has("") {
+		t.Fatal("unexpected entry for the empty raw argument")
+	}
+	if err := Verify(path, ""); err != nil {
+		t.Fatal(err)
+	}
+}
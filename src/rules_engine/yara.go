@@ -0,0 +1,1225 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	regexp "github.com/BurntSushi/rure-go"
+)
+
+// YaraRules is a compiled YARA rule file. The commonly used part of the language is supported:
+//   - text strings with the nocase, wide, ascii, fullword and private modifiers
+//   - hex strings with wildcards (?? A? ?A), negations (~AB), jumps ([4] [2-8] [4-] [-]) and
+//     alternatives ((AB | CD EF))
+//   - regular expressions with the i and s flags and the nocase and fullword modifiers
+//   - conditions with and, or, not, comparisons, + - * \ %, string references ($a, $a at 0,
+//     $a in (0..100)), counts (#a), "of" expressions (any of them, 2 of ($a*), none of ($x, $y)),
+//     filesize, integer reads (uint16(0) == 0x5A4D, uint32be(0)) and references to previous rules
+//   - private and global rules, tags and meta, which are parsed and ignored
+//
+// Modules (import), include, for loops, @a and !a offsets and the xor and base64 modifiers are
+// not supported and fail the compilation. Counts and offsets are of non-overlapping matches.
+type YaraRules struct {
+	rules   []*yaraRule
+	strings []*yaraString
+}
+
+type yaraRule struct {
+	name    string
+	private bool
+	global  bool
+	cond    yaraExpr
+}
+
+type yaraString struct {
+	id       string
+	re       *regexp.Regex
+	fullword bool
+}
+
+// ===================== Lexer =====================
+
+type yaraTokenKind int
+
+const (
+	yaraEOF yaraTokenKind = iota
+	yaraIdent
+	yaraText
+	yaraHex
+	yaraRegex
+	yaraNumber
+	yaraStringID
+	yaraCount
+	yaraPunct
+)
+
+type yaraToken struct {
+	kind  yaraTokenKind
+	text  string
+	num   int64
+	flags string // flags of regular expressions
+	line  int
+}
+
+type yaraLexer struct {
+	src  string
+	pos  int
+	line int
+	prev yaraToken
+}
+
+func (l *yaraLexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+func (l *yaraLexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isYaraIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (l *yaraLexer) next() (yaraToken, error) {
+	if err := l.skipSpace(); err != nil {
+		return yaraToken{}, err
+	}
+	tok, err := l.scan()
+	if err != nil {
+		return tok, err
+	}
+	l.prev = tok
+	return tok, nil
+}
+
+func (l *yaraLexer) scan() (yaraToken, error) {
+	tok := yaraToken{line: l.line}
+	if l.pos >= len(l.src) {
+		tok.kind = yaraEOF
+		return tok, nil
+	}
+	c := l.src[l.pos]
+	afterAssign := l.prev.kind == yaraPunct && l.prev.text == "="
+
+	switch {
+	case c == '{' && afterAssign:
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return tok, l.errorf("unterminated hex string")
+		}
+		tok.kind, tok.text = yaraHex, l.src[l.pos+1:l.pos+end]
+		l.line += strings.Count(tok.text, "\n")
+		l.pos += end + 1
+		return tok, nil
+
+	case c == '/' && afterAssign:
+		var sb strings.Builder
+		i := l.pos + 1
+		for ; i < len(l.src) && l.src[i] != '/'; i++ {
+			if l.src[i] == '\n' {
+				return tok, l.errorf("unterminated regular expression")
+			}
+			if l.src[i] == '\\' && i+1 < len(l.src) {
+				if l.src[i+1] != '/' {
+					sb.WriteByte('\\')
+				}
+				i++
+			}
+			sb.WriteByte(l.src[i])
+		}
+		if i >= len(l.src) {
+			return tok, l.errorf("unterminated regular expression")
+		}
+		i++
+		start := i
+		for i < len(l.src) && (l.src[i] == 'i' || l.src[i] == 's') {
+			i++
+		}
+		tok.kind, tok.text, tok.flags = yaraRegex, sb.String(), l.src[start:i]
+		l.pos = i
+		return tok, nil
+
+	case c == '"':
+		var sb strings.Builder
+		i := l.pos + 1
+		for ; i < len(l.src) && l.src[i] != '"'; i++ {
+			if l.src[i] == '\n' {
+				return tok, l.errorf("unterminated string")
+			}
+			if l.src[i] != '\\' {
+				sb.WriteByte(l.src[i])
+				continue
+			}
+			i++
+			if i >= len(l.src) {
+				break
+			}
+			switch l.src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'x':
+				if i+2 >= len(l.src) {
+					return tok, l.errorf("invalid escape sequence")
+				}
+				b, err := strconv.ParseUint(l.src[i+1:i+3], 16, 8)
+				if err != nil {
+					return tok, l.errorf("invalid escape sequence \\x%s", l.src[i+1:i+3])
+				}
+				sb.WriteByte(byte(b))
+				i += 2
+			case '"', '\\':
+				sb.WriteByte(l.src[i])
+			default:
+				return tok, l.errorf("invalid escape sequence \\%c", l.src[i])
+			}
+		}
+		if i >= len(l.src) {
+			return tok, l.errorf("unterminated string")
+		}
+		tok.kind, tok.text = yaraText, sb.String()
+		l.pos = i + 1
+		return tok, nil
+
+	case c == '$' || c == '#':
+		i := l.pos + 1
+		for i < len(l.src) && isYaraIdentChar(l.src[i]) {
+			i++
+		}
+		if c == '$' && i < len(l.src) && l.src[i] == '*' {
+			i++
+		}
+		tok.kind, tok.text = yaraStringID, "$"+l.src[l.pos+1:i]
+		if c == '#' {
+			if i == l.pos+1 {
+				return tok, l.errorf("expected a string identifier after #")
+			}
+			tok.kind = yaraCount
+		}
+		l.pos = i
+		return tok, nil
+
+	case c == '@' || c == '!':
+		return tok, l.errorf("%c offsets are not supported", c)
+
+	case c >= '0' && c <= '9':
+		i := l.pos
+		base := 10
+		if strings.HasPrefix(l.src[i:], "0x") || strings.HasPrefix(l.src[i:], "0X") {
+			i += 2
+			base = 16
+		}
+		start := i
+		for i < len(l.src) && isYaraIdentChar(l.src[i]) && !strings.HasPrefix(l.src[i:], "KB") && !strings.HasPrefix(l.src[i:], "MB") {
+			i++
+		}
+		n, err := strconv.ParseInt(l.src[start:i], base, 64)
+		if err != nil {
+			return tok, l.errorf("invalid number %s", l.src[l.pos:i])
+		}
+		if strings.HasPrefix(l.src[i:], "KB") {
+			n, i = n<<10, i+2
+		} else if strings.HasPrefix(l.src[i:], "MB") {
+			n, i = n<<20, i+2
+		}
+		tok.kind, tok.num, tok.text = yaraNumber, n, l.src[l.pos:i]
+		l.pos = i
+		return tok, nil
+
+	case isYaraIdentChar(c):
+		i := l.pos
+		for i < len(l.src) && isYaraIdentChar(l.src[i]) {
+			i++
+		}
+		tok.kind, tok.text = yaraIdent, l.src[l.pos:i]
+		l.pos = i
+		return tok, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", ".."} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			tok.kind, tok.text = yaraPunct, op
+			l.pos += 2
+			return tok, nil
+		}
+	}
+	if strings.IndexByte("(){}[],:=<>+-*\\%", c) >= 0 {
+		tok.kind, tok.text = yaraPunct, string(c)
+		l.pos++
+		return tok, nil
+	}
+	return tok, l.errorf("unexpected character %q", c)
+}
+
+// ===================== Parser =====================
+
+type yaraParser struct {
+	lex   *yaraLexer
+	tok   yaraToken
+	rules *YaraRules
+	// strings of the rule being parsed, by identifier
+	ruleStrings []int
+	ruleNames   map[string]int
+}
+
+func (p *yaraParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *yaraParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.tok.line, fmt.Sprintf(format, args...))
+}
+
+func (p *yaraParser) is(kind yaraTokenKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *yaraParser) expect(kind yaraTokenKind, text string) error {
+	if !p.is(kind, text) {
+		return p.errorf("expected '%s', got '%s'", text, p.tok.text)
+	}
+	return p.advance()
+}
+
+// CompileYara compiles the rules of a YARA source
+func CompileYara(src string) (*YaraRules, error) {
+	p := &yaraParser{lex: &yaraLexer{src: src, line: 1}, rules: &YaraRules{}, ruleNames: map[string]int{}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for p.tok.kind != yaraEOF {
+		if p.is(yaraIdent, "import") || p.is(yaraIdent, "include") {
+			return nil, p.errorf("%s is not supported", p.tok.text)
+		}
+		if err := p.parseRule(); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.rules.rules) == 0 {
+		return nil, errors.New("no rule found")
+	}
+	return p.rules, nil
+}
+
+func (p *yaraParser) parseRule() error {
+	rule := &yaraRule{}
+	for p.is(yaraIdent, "private") || p.is(yaraIdent, "global") {
+		if p.tok.text == "private" {
+			rule.private = true
+		} else {
+			rule.global = true
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect(yaraIdent, "rule"); err != nil {
+		return err
+	}
+	if p.tok.kind != yaraIdent {
+		return p.errorf("expected a rule name")
+	}
+	rule.name = p.tok.text
+	if _, ok := p.ruleNames[rule.name]; ok {
+		return p.errorf("duplicated rule %s", rule.name)
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	// Tags
+	if p.is(yaraPunct, ":") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		for p.tok.kind == yaraIdent {
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := p.expect(yaraPunct, "{"); err != nil {
+		return err
+	}
+
+	p.ruleStrings = nil
+	if p.is(yaraIdent, "meta") {
+		if err := p.parseMeta(); err != nil {
+			return err
+		}
+	}
+	if p.is(yaraIdent, "strings") {
+		if err := p.parseStrings(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.name, err)
+		}
+	}
+	if err := p.expect(yaraIdent, "condition"); err != nil {
+		return err
+	}
+	if err := p.expect(yaraPunct, ":"); err != nil {
+		return err
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", rule.name, err)
+	}
+	rule.cond = cond
+	if err := p.expect(yaraPunct, "}"); err != nil {
+		return err
+	}
+
+	p.ruleNames[rule.name] = len(p.rules.rules)
+	p.rules.rules = append(p.rules.rules, rule)
+	return nil
+}
+
+func (p *yaraParser) parseMeta() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(yaraPunct, ":"); err != nil {
+		return err
+	}
+	for p.tok.kind == yaraIdent && !p.is(yaraIdent, "strings") && !p.is(yaraIdent, "condition") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expect(yaraPunct, "="); err != nil {
+			return err
+		}
+		if p.is(yaraPunct, "-") {
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		if p.tok.kind != yaraText && p.tok.kind != yaraNumber && !p.is(yaraIdent, "true") && !p.is(yaraIdent, "false") {
+			return p.errorf("invalid meta value '%s'", p.tok.text)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *yaraParser) parseStrings() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(yaraPunct, ":"); err != nil {
+		return err
+	}
+	anonymous := 0
+	for p.tok.kind == yaraStringID {
+		id := p.tok.text
+		if strings.HasSuffix(id, "*") {
+			return p.errorf("invalid string identifier %s", id)
+		}
+		if id == "$" {
+			anonymous++
+			id = "$\x00" + strconv.Itoa(anonymous)
+		}
+		for _, i := range p.ruleStrings {
+			if p.rules.strings[i].id == id {
+				return p.errorf("duplicated string identifier %s", id)
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expect(yaraPunct, "="); err != nil {
+			return err
+		}
+		value := p.tok
+		if value.kind != yaraText && value.kind != yaraHex && value.kind != yaraRegex {
+			return p.errorf("expected a string value for %s", id)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		modifiers := map[string]bool{}
+		for p.tok.kind == yaraIdent && !p.is(yaraIdent, "condition") {
+			modifiers[p.tok.text] = true
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		s, err := compileYaraString(id, value, modifiers)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", value.line, err)
+		}
+		p.ruleStrings = append(p.ruleStrings, len(p.rules.strings))
+		p.rules.strings = append(p.rules.strings, s)
+	}
+	return nil
+}
+
+func compileYaraString(id string, value yaraToken, modifiers map[string]bool) (*yaraString, error) {
+	allowed := map[yaraTokenKind][]string{
+		yaraText:  {"nocase", "wide", "ascii", "fullword", "private"},
+		yaraHex:   {"private"},
+		yaraRegex: {"nocase", "ascii", "fullword", "private"},
+	}[value.kind]
+	for m := range modifiers {
+		found := false
+		for _, a := range allowed {
+			found = found || a == m
+		}
+		if !found {
+			return nil, fmt.Errorf("modifier %s is not supported on %s", m, id)
+		}
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("(?-u)")
+	if modifiers["nocase"] {
+		pattern.WriteString("(?i)")
+	}
+	switch value.kind {
+	case yaraText:
+		if value.text == "" {
+			return nil, fmt.Errorf("string %s cannot be empty", id)
+		}
+		escape := func(wide bool) string {
+			var sb strings.Builder
+			for i := 0; i < len(value.text); i++ {
+				fmt.Fprintf(&sb, `\x%02X`, value.text[i])
+				if wide {
+					sb.WriteString(`\x00`)
+				}
+			}
+			return sb.String()
+		}
+		switch {
+		case modifiers["wide"] && modifiers["ascii"]:
+			pattern.WriteString("(?:" + escape(false) + "|" + escape(true) + ")")
+		case modifiers["wide"]:
+			pattern.WriteString(escape(true))
+		default:
+			pattern.WriteString(escape(false))
+		}
+	case yaraHex:
+		hex, err := yaraHexPattern(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex string %s: %w", id, err)
+		}
+		pattern.WriteString(hex)
+	case yaraRegex:
+		if strings.Contains(value.flags, "i") {
+			pattern.WriteString("(?i)")
+		}
+		if strings.Contains(value.flags, "s") {
+			pattern.WriteString("(?s)")
+		}
+		pattern.WriteString(value.text)
+	}
+
+	re, err := regexp.CompileOptions(pattern.String(), 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid string %s: %v", id, err)
+	}
+	return &yaraString{id: id, re: re, fullword: modifiers["fullword"]}, nil
+}
+
+// yaraHexPattern converts the content of a hex string to a byte regular expression
+func yaraHexPattern(hex string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)")
+	bytesCount := 0
+	depth := 0
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ", "|", " | ", "[", " [", "]", "] ").Replace(hex))
+	// Pairs of nibbles may be written without spaces, AB CD and ABCD are the same
+	var tokens []string
+	for _, f := range fields {
+		if f[0] == '[' || f == "(" || f == ")" || f == "|" {
+			tokens = append(tokens, f)
+			continue
+		}
+		negate := strings.HasPrefix(f, "~")
+		f = strings.TrimPrefix(f, "~")
+		if len(f) == 0 || len(f)%2 != 0 {
+			return "", fmt.Errorf("invalid byte %q", f)
+		}
+		for i := 0; i < len(f); i += 2 {
+			b := f[i : i+2]
+			if negate && i == 0 {
+				b = "~" + b
+			}
+			tokens = append(tokens, b)
+		}
+	}
+
+	for _, t := range tokens {
+		switch {
+		case t == "(":
+			depth++
+			sb.WriteString("(?:")
+		case t == ")":
+			if depth == 0 {
+				return "", errors.New("unbalanced parentheses")
+			}
+			depth--
+			sb.WriteString(")")
+		case t == "|":
+			if depth == 0 {
+				return "", errors.New("alternatives must be in parentheses")
+			}
+			sb.WriteString("|")
+		case t[0] == '[':
+			jump := strings.TrimSpace(t[1 : len(t)-1])
+			lo, hi, found := strings.Cut(jump, "-")
+			if !found {
+				hi = lo
+			}
+			lo, hi = strings.TrimSpace(lo), strings.TrimSpace(hi)
+			if lo == "" {
+				lo = "0"
+			}
+			if _, err := strconv.Atoi(lo); err != nil {
+				return "", fmt.Errorf("invalid jump %s", t)
+			}
+			if hi != "" {
+				if _, err := strconv.Atoi(hi); err != nil {
+					return "", fmt.Errorf("invalid jump %s", t)
+				}
+			}
+			if !found {
+				sb.WriteString(".{" + lo + "}")
+			} else {
+				sb.WriteString(".{" + lo + "," + hi + "}?")
+			}
+		default:
+			negate := strings.HasPrefix(t, "~")
+			t = strings.TrimPrefix(t, "~")
+			class, err := yaraByteClass(t)
+			if err != nil {
+				return "", err
+			}
+			if negate {
+				if class == "" {
+					return "", errors.New("~?? is not allowed")
+				}
+				sb.WriteString("[^" + class + "]")
+			} else if class == "" {
+				sb.WriteString(".")
+			} else {
+				sb.WriteString("[" + class + "]")
+			}
+			bytesCount++
+		}
+	}
+	if depth != 0 {
+		return "", errors.New("unbalanced parentheses")
+	}
+	if bytesCount == 0 {
+		return "", errors.New("no bytes")
+	}
+	return sb.String(), nil
+}
+
+// yaraByteClass returns the bytes matched by a byte of a hex string as the content of a regex
+// class, empty for ??
+func yaraByteClass(b string) (string, error) {
+	isHex := func(c byte) bool {
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+	}
+	hi, lo := b[0], b[1]
+	switch {
+	case hi == '?' && lo == '?':
+		return "", nil
+	case hi == '?' && isHex(lo):
+		var sb strings.Builder
+		for h := 0; h < 16; h++ {
+			fmt.Fprintf(&sb, `\x%X%c`, h, lo)
+		}
+		return sb.String(), nil
+	case isHex(hi) && lo == '?':
+		return fmt.Sprintf(`\x%c0-\x%cF`, hi, hi), nil
+	case isHex(hi) && isHex(lo):
+		return `\x` + b, nil
+	}
+	return "", fmt.Errorf("invalid byte %q", b)
+}
+
+// Expressions, evaluated to integers with booleans as 0 and 1
+
+type yaraExpr interface {
+	eval(s *yaraScan) int64
+}
+
+type yaraConst int64
+type yaraFilesize struct{}
+type yaraNot struct{ x yaraExpr }
+type yaraNeg struct{ x yaraExpr }
+type yaraBinary struct {
+	op   string
+	l, r yaraExpr
+}
+type yaraStringRef struct {
+	index    int
+	at       yaraExpr
+	lo, hi   yaraExpr
+	hasRange bool
+}
+type yaraStringCount struct{ index int }
+type yaraOf struct {
+	quantifier string // all, any or none, empty when count is set
+	count      yaraExpr
+	indexes    []int
+}
+type yaraIntRead struct {
+	size      int
+	signed    bool
+	bigEndian bool
+	offset    yaraExpr
+}
+type yaraRuleRef struct{ index int }
+
+func yaraBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c yaraConst) eval(*yaraScan) int64         { return int64(c) }
+func (yaraFilesize) eval(s *yaraScan) int64      { return int64(len(s.data)) }
+func (n yaraNot) eval(s *yaraScan) int64         { return yaraBool(n.x.eval(s) == 0) }
+func (n yaraNeg) eval(s *yaraScan) int64         { return -n.x.eval(s) }
+func (r yaraRuleRef) eval(s *yaraScan) int64     { return yaraBool(s.ruleResults[r.index]) }
+func (c yaraStringCount) eval(s *yaraScan) int64 { return int64(len(s.offsets(c.index)) / 2) }
+
+func (b yaraBinary) eval(s *yaraScan) int64 {
+	switch b.op {
+	case "and":
+		return yaraBool(b.l.eval(s) != 0 && b.r.eval(s) != 0)
+	case "or":
+		return yaraBool(b.l.eval(s) != 0 || b.r.eval(s) != 0)
+	}
+	l, r := b.l.eval(s), b.r.eval(s)
+	switch b.op {
+	case "==":
+		return yaraBool(l == r)
+	case "!=":
+		return yaraBool(l != r)
+	case "<":
+		return yaraBool(l < r)
+	case "<=":
+		return yaraBool(l <= r)
+	case ">":
+		return yaraBool(l > r)
+	case ">=":
+		return yaraBool(l >= r)
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "\\", "%":
+		if r == 0 {
+			return 0
+		}
+		if b.op == "%" {
+			return l % r
+		}
+		return l / r
+	}
+	return 0
+}
+
+func (r yaraStringRef) eval(s *yaraScan) int64 {
+	if r.at == nil && !r.hasRange {
+		return yaraBool(s.found(r.index))
+	}
+	offsets := s.offsets(r.index)
+	if r.at != nil {
+		at := r.at.eval(s)
+		for i := 0; i < len(offsets); i += 2 {
+			if int64(offsets[i]) == at {
+				return 1
+			}
+		}
+		return 0
+	}
+	lo, hi := r.lo.eval(s), r.hi.eval(s)
+	for i := 0; i < len(offsets); i += 2 {
+		if int64(offsets[i]) >= lo && int64(offsets[i]) <= hi {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (o yaraOf) eval(s *yaraScan) int64 {
+	want := int64(len(o.indexes))
+	switch o.quantifier {
+	case "any":
+		want = 1
+	case "none":
+		for _, i := range o.indexes {
+			if s.found(i) {
+				return 0
+			}
+		}
+		return 1
+	case "":
+		want = o.count.eval(s)
+	}
+	var n int64
+	for _, i := range o.indexes {
+		if s.found(i) {
+			n++
+			if n >= want {
+				return 1
+			}
+		}
+	}
+	return yaraBool(n >= want)
+}
+
+func (r yaraIntRead) eval(s *yaraScan) int64 {
+	off := r.offset.eval(s)
+	if off < 0 || off+int64(r.size) > int64(len(s.data)) {
+		return 0
+	}
+	b := s.data[off : off+int64(r.size)]
+	var order binary.ByteOrder = binary.LittleEndian
+	if r.bigEndian {
+		order = binary.BigEndian
+	}
+	switch r.size {
+	case 1:
+		if r.signed {
+			return int64(int8(b[0]))
+		}
+		return int64(b[0])
+	case 2:
+		if r.signed {
+			return int64(int16(order.Uint16(b)))
+		}
+		return int64(order.Uint16(b))
+	default:
+		if r.signed {
+			return int64(int32(order.Uint32(b)))
+		}
+		return int64(order.Uint32(b))
+	}
+}
+
+func (p *yaraParser) parseExpr() (yaraExpr, error) {
+	return p.parseBinary(0)
+}
+
+// Operator precedence, lowest first
+var yaraPrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "\\", "%"},
+}
+
+func (p *yaraParser) parseBinary(level int) (yaraExpr, error) {
+	if level == len(yaraPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range yaraPrecedence[level] {
+			if (p.tok.kind == yaraPunct || p.tok.kind == yaraIdent) && p.tok.text == candidate {
+				op = candidate
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = yaraBinary{op: op, l: left, r: right}
+	}
+}
+
+func (p *yaraParser) parseUnary() (yaraExpr, error) {
+	switch {
+	case p.is(yaraIdent, "not"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		// not binds tighter than and/or but looser than comparisons
+		x, err := p.parseBinary(2)
+		if err != nil {
+			return nil, err
+		}
+		return yaraNot{x}, nil
+	case p.is(yaraPunct, "-"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return yaraNeg{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *yaraParser) parsePrimary() (yaraExpr, error) {
+	tok := p.tok
+	switch tok.kind {
+	case yaraPunct:
+		if tok.text != "(" {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(yaraPunct, ")")
+
+	case yaraNumber:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is(yaraIdent, "of") {
+			return p.parseOf("", yaraConst(tok.num))
+		}
+		return yaraConst(tok.num), nil
+
+	case yaraCount:
+		index, err := p.stringIndex(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		return yaraStringCount{index}, p.advance()
+
+	case yaraStringID:
+		index, err := p.stringIndex(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		ref := yaraStringRef{index: index}
+		switch {
+		case p.is(yaraIdent, "at"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if ref.at, err = p.parseBinary(3); err != nil {
+				return nil, err
+			}
+		case p.is(yaraIdent, "in"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(yaraPunct, "("); err != nil {
+				return nil, err
+			}
+			if ref.lo, err = p.parseBinary(3); err != nil {
+				return nil, err
+			}
+			if err := p.expect(yaraPunct, ".."); err != nil {
+				return nil, err
+			}
+			if ref.hi, err = p.parseBinary(3); err != nil {
+				return nil, err
+			}
+			if err := p.expect(yaraPunct, ")"); err != nil {
+				return nil, err
+			}
+			ref.hasRange = true
+		}
+		return ref, nil
+
+	case yaraIdent:
+		switch tok.text {
+		case "true", "false":
+			return yaraConst(yaraBool(tok.text == "true")), p.advance()
+		case "filesize":
+			return yaraFilesize{}, p.advance()
+		case "all", "any", "none":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			return p.parseOf(tok.text, nil)
+		case "for":
+			return nil, p.errorf("for loops are not supported")
+		}
+		if read, ok := yaraIntReads[tok.text]; ok {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(yaraPunct, "("); err != nil {
+				return nil, err
+			}
+			offset, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			read.offset = offset
+			return read, p.expect(yaraPunct, ")")
+		}
+		if index, ok := p.ruleNames[tok.text]; ok {
+			return yaraRuleRef{index}, p.advance()
+		}
+		if strings.Contains(p.lex.src[p.lex.pos:min(p.lex.pos+1, len(p.lex.src))], ".") {
+			return nil, p.errorf("modules are not supported: %s", tok.text)
+		}
+		return nil, p.errorf("undefined identifier %s", tok.text)
+	}
+	return nil, p.errorf("unexpected '%s' in condition", tok.text)
+}
+
+var yaraIntReads = map[string]yaraIntRead{
+	"uint8": {size: 1}, "uint16": {size: 2}, "uint32": {size: 4},
+	"int8": {size: 1, signed: true}, "int16": {size: 2, signed: true}, "int32": {size: 4, signed: true},
+	"uint8be": {size: 1, bigEndian: true}, "uint16be": {size: 2, bigEndian: true}, "uint32be": {size: 4, bigEndian: true},
+	"int8be": {size: 1, signed: true, bigEndian: true}, "int16be": {size: 2, signed: true, bigEndian: true}, "int32be": {size: 4, signed: true, bigEndian: true},
+}
+
+func (p *yaraParser) parseOf(quantifier string, count yaraExpr) (yaraExpr, error) {
+	if err := p.expect(yaraIdent, "of"); err != nil {
+		return nil, err
+	}
+	of := yaraOf{quantifier: quantifier, count: count}
+	if p.is(yaraIdent, "them") {
+		of.indexes = p.ruleStrings
+		if len(of.indexes) == 0 {
+			return nil, p.errorf("rule has no strings")
+		}
+		return of, p.advance()
+	}
+	if err := p.expect(yaraPunct, "("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.tok.kind != yaraStringID {
+			return nil, p.errorf("expected a string identifier, got '%s'", p.tok.text)
+		}
+		id := p.tok.text
+		if prefix, ok := strings.CutSuffix(id, "*"); ok {
+			found := false
+			for _, i := range p.ruleStrings {
+				if strings.HasPrefix(p.rules.strings[i].id, prefix) {
+					of.indexes = append(of.indexes, i)
+					found = true
+				}
+			}
+			if !found {
+				return nil, p.errorf("no string matches %s", id)
+			}
+		} else {
+			index, err := p.stringIndex(id)
+			if err != nil {
+				return nil, err
+			}
+			of.indexes = append(of.indexes, index)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is(yaraPunct, ")") {
+			return of, p.advance()
+		}
+		if err := p.expect(yaraPunct, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *yaraParser) stringIndex(id string) (int, error) {
+	for _, i := range p.ruleStrings {
+		if p.rules.strings[i].id == id {
+			return i, nil
+		}
+	}
+	return 0, p.errorf("undefined string %s", id)
+}
+
+// ===================== Scanning =====================
+
+// yaraScan holds the string matches of one scanned value, computed when a condition needs them
+type yaraScan struct {
+	data        []byte
+	rules       *YaraRules
+	ruleResults []bool
+	matches     [][]int
+	computed    []bool
+}
+
+func (s *yaraScan) offsets(index int) []int {
+	if s.computed[index] {
+		return s.matches[index]
+	}
+	str := s.rules.strings[index]
+	all := str.re.FindAllBytes(s.data)
+	if str.fullword {
+		kept := all[:0]
+		for i := 0; i < len(all); i += 2 {
+			start, end := all[i], all[i+1]
+			if (start > 0 && isYaraWordByte(s.data[start-1])) || (end < len(s.data) && isYaraWordByte(s.data[end])) {
+				continue
+			}
+			kept = append(kept, start, end)
+		}
+		all = kept
+	}
+	s.matches[index], s.computed[index] = all, true
+	return all
+}
+
+func isYaraWordByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (s *yaraScan) found(index int) bool {
+	if !s.computed[index] && !s.rules.strings[index].fullword {
+		return s.rules.strings[index].re.IsMatchBytes(s.data)
+	}
+	return len(s.offsets(index)) > 0
+}
+
+// Match returns the names of the rules matching data, private rules are not reported
+func (y *YaraRules) Match(data []byte) []string {
+	return y.match(data, false)
+}
+
+// IsMatch reports whether a rule that is not private matches data
+func (y *YaraRules) IsMatch(data []byte) bool {
+	return len(y.match(data, true)) > 0
+}
+
+func (y *YaraRules) match(data []byte, first bool) []string {
+	s := &yaraScan{
+		data:        data,
+		rules:       y,
+		ruleResults: make([]bool, len(y.rules)),
+		matches:     make([][]int, len(y.strings)),
+		computed:    make([]bool, len(y.strings)),
+	}
+	// A global rule that does not match disables every rule of the file
+	for i, rule := range y.rules {
+		if rule.global {
+			s.ruleResults[i] = rule.cond.eval(s) != 0
+			if !s.ruleResults[i] {
+				return nil
+			}
+		}
+	}
+	var names []string
+	for i, rule := range y.rules {
+		if !rule.global {
+			s.ruleResults[i] = rule.cond.eval(s) != 0
+		}
+		if s.ruleResults[i] && !rule.private {
+			names = append(names, rule.name)
+			if first {
+				return names
+			}
+		}
+	}
+	return names
+}
+
+// ===================== Rule files =====================
+
+// yaraDir is the directory of config_root holding the rule files of YARA checks
+const yaraDir = "yara"
+
+var yaraFiles = struct {
+	sync.Mutex
+	m map[string]*yaraFile
+}{m: make(map[string]*yaraFile)}
+
+type yaraFile struct {
+	modTime time.Time
+	size    int64
+	rules   *YaraRules
+}
+
+// LoadYaraRules compiles a rule file of the yara directory of config_root. Compiled files are
+// reused until they change, rulesets pick up changes when they are rebuilt.
+func LoadYaraRules(name string) (*YaraRules, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || filepath.IsAbs(name) || strings.Contains(filepath.ToSlash(name), "..") {
+		return nil, fmt.Errorf("YARA rule file must be a file name relative to the %s directory, got '%s'", yaraDir, name)
+	}
+	root := ""
+	if common.Config != nil {
+		root = common.Config.ConfigRoot
+	}
+	path := filepath.Join(root, yaraDir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("YARA rule file not found: %s", name)
+	}
+
+	yaraFiles.Lock()
+	defer yaraFiles.Unlock()
+	if f, ok := yaraFiles.m[path]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f.rules, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read YARA rule file %s: %v", name, err)
+	}
+	rules, err := CompileYara(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid YARA rule file %s: %v", name, err)
+	}
+	yaraFiles.m[path] = &yaraFile{modTime: info.ModTime(), size: info.Size(), rules: rules}
+	return rules, nil
+}
@@ -0,0 +1,153 @@
+package rules_engine
+
+import (
+	"AgentSmith-HUB/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYara_Match(t *testing.T) {
+	rules, err := CompileYara(`
+/* test rules */
+rule text : script {
+    meta:
+        author = "soc"
+        score = 80
+    strings:
+        $a = "Invoke-Expression" nocase
+        $b = "DownloadString"
+    condition:
+        $a and #b >= 2 // two downloads
+}
+
+private rule mz { condition: uint16(0) == 0x5A4D }
+
+rule pe_payload {
+    strings:
+        $h = { 4D 5A ?? 00 [2-4] (AB | CD EF) ~00 }
+    condition:
+        mz and $h at 0 and filesize < 1KB
+}
+
+rule wide_word {
+    strings:
+        $w = "cmd" wide ascii fullword
+        $r = /eval\(\s*atob/is
+    condition:
+        any of them and not $r in (0..2)
+}
+
+rule counted {
+    strings:
+        $x1 = "one"
+        $x2 = "two"
+        $y = "three"
+    condition:
+        2 of ($x*) and none of ($y)
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		data string
+		want string
+	}{
+		{"iex: invoke-EXPRESSION (x.DownloadString(a)); DownloadString(b)", "text"},
+		{"invoke-expression DownloadString", ""},
+		{"MZ\x90\x00\x01\x02\xCD\xEF\x01rest", "pe_payload"},
+		{"MZ\x90\x00\x01\x02\xCD\xEF\x00rest", ""},
+		{"run cmd now", "wide_word"},
+		{"run cmdlet now", ""},
+		{"c\x00m\x00d\x00", "wide_word"},
+		{"xxx EVAL( atob", "wide_word"},
+		{"EVAL( atob", ""},
+		{"one two", "counted"},
+		{"one two three", ""},
+	} {
+		if got := strings.Join(rules.Match([]byte(tt.data)), ","); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestYara_Global(t *testing.T) {
+	rules, err := CompileYara(`
+global rule small { condition: filesize < 10 }
+rule a { strings: $a = "a" condition: $a }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rules.IsMatch([]byte("abc")) || rules.IsMatch([]byte("a long value")) {
+		t.Fatal("global rule not applied")
+	}
+}
+
+func TestYara_CompileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		src, err string
+	}{
+		{`import "pe" rule a { condition: pe.is_dll() }`, "import is not supported"},
+		{`rule a { condition: $a }`, "undefined string $a"},
+		{`rule a { strings: $a = "x" xor condition: $a }`, "modifier xor is not supported"},
+		{`rule a { strings: $a = { 4D 5 } condition: $a }`, "invalid hex string"},
+		{`rule a { strings: $a = "x" condition: @a[1] == 0 }`, "offsets are not supported"},
+		{`rule a { strings: $a = "x" condition: for any i in (1..2): ($a) }`, "for loops are not supported"},
+		{`rule a { condition: true } rule a { condition: true }`, "duplicated rule a"},
+		{`rule a { condition: b }`, "undefined identifier b"},
+	} {
+		if _, err := CompileYara(tt.src); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("CompileYara(%q): expected error %q, got %v", tt.src, tt.err, err)
+		}
+	}
+}
+
+func TestYara_Check(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, yaraDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, yaraDir, "ps.yar"), []byte(`
+rule encoded_powershell {
+    strings:
+        $ps = "powershell" nocase
+        $enc = /-enc\s+[A-Za-z0-9+\/=]{20,}/
+    condition:
+        all of them
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := common.Config
+	common.Config = &common.HubConfig{ConfigRoot: root}
+	t.Cleanup(func() { common.Config = oldConfig })
+
+	rs := buildRulesetFromXML(t, `
+<root type="DETECTION">
+  <rule id="ps" name="encoded powershell">
+    <check type="YARA" field="script">ps.yar</check>
+  </rule>
+</root>`)
+	if res := rs.EngineCheck(map[string]interface{}{"script": "PowerShell.exe -enc SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"}); len(res) != 1 {
+		t.Fatalf("expected a hit, got %v", res)
+	}
+	if res := rs.EngineCheck(map[string]interface{}{"script": "powershell.exe -File a.ps1"}); len(res) != 0 {
+		t.Fatalf("unexpected hit %v", res)
+	}
+
+	for _, tt := range []struct {
+		value, err string
+	}{
+		{"missing.yar", "YARA rule file not found: missing.yar"},
+		{"../ps.yar", "must be a file name relative to the yara directory"},
+	} {
+		rs, err := ParseRuleset([]byte(`<root type="DETECTION"><rule id="r"><check type="YARA" field="f">` + tt.value + `</check></rule></root>`))
+		if err == nil {
+			err = RulesetBuild(rs)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
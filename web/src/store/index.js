@@ -21,6 +21,24 @@ const store = createStore({
       { value: 'REGEX', detail: 'Regular expression check' },
       { value: 'ISNULL', detail: 'Field is null check' },
       { value: 'NOTNULL', detail: 'Field is not null check' },
+      { value: 'EXISTS', detail: 'Field exists check' },
+      { value: 'NOT_EXISTS', detail: 'Field does not exist check' },
+      { value: 'IS_TYPE', detail: 'Field value type check' },
+      { value: 'IS_NUMERIC', detail: 'Field is a number or a numeric string' },
+      { value: 'IS_IP', detail: 'Field is an IP address' },
+      { value: 'ARRAY_CONTAINS', detail: 'Array field contains the value' },
+      { value: 'ARRAY_LEN', detail: 'Array field length comparison' },
+      { value: 'CIDR', detail: 'IP address in CIDR networks check' },
+      { value: 'IP_RANGE', detail: 'IP address in ranges check' },
+      { value: 'INTEL', detail: 'Threat intel indicator check' },
+      { value: 'IN_LIST', detail: 'Shared list entry check' },
+      { value: 'EXPR', detail: 'Expression over event fields check' },
+      { value: 'TIME', detail: 'Time of day and calendar check' },
+      { value: 'LEVENSHTEIN', detail: 'Edit distance lookalike check' },
+      { value: 'JARO', detail: 'Jaro-Winkler similarity lookalike check' },
+      { value: 'HOMOGLYPH', detail: 'Homoglyph lookalike check' },
+      { value: 'YARA', detail: 'YARA rule file check' },
+      { value: 'SCORE_GT', detail: 'Entity risk score check' },
       { value: 'EQU', detail: 'Equal check (case insensitive)' },
       { value: 'NEQ', detail: 'Not equal check (case insensitive)' },
       { value: 'NCS_EQU', detail: 'Case-insensitive equal check' },
@@ -35,7 +53,11 @@ const store = createStore({
     ],
     countTypes: [
       { value: 'SUM', detail: 'Sum values' },
-      { value: 'CLASSIFY', detail: 'Count unique values' }
+      { value: 'CLASSIFY', detail: 'Count unique values' },
+      { value: 'AVG', detail: 'Average of values' },
+      { value: 'MIN', detail: 'Minimum of values' },
+      { value: 'MAX', detail: 'Maximum of values' },
+      { value: 'PERCENTILE', detail: 'Percentile of values' }
     ],
     rootTypes: [
       { value: 'DETECTION', detail: 'Detection rule type' },